@@ -8,6 +8,9 @@ import (
 	"strconv"
 	"time"
 
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/upstream"
+
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
@@ -24,6 +27,8 @@ type AutoScaler struct {
 	scaleDownCooldown time.Duration
 	lastScaleTime     time.Time
 	serviceName       string
+	upstreamHealth    config.UpstreamHealthConfig
+	outageSince       time.Time // 所有上游开始不可用的时间
 }
 
 // ScalingMetrics 扩缩容指标
@@ -34,6 +39,17 @@ type ScalingMetrics struct {
 	AverageResponseTime float64   `json:"avg_response_time"`
 	ErrorRate           float64   `json:"error_rate"`
 	Timestamp           time.Time `json:"timestamp"`
+
+	Upstreams []*upstream.Health `json:"upstreams,omitempty"`
+}
+
+// ScalingSignal 参与决策的单个信号
+type ScalingSignal struct {
+	Name      string  `json:"name"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	Triggered bool    `json:"triggered"`
+	Detail    string  `json:"detail,omitempty"`
 }
 
 // ScalingDecision 扩缩容决策
@@ -43,11 +59,15 @@ type ScalingDecision struct {
 	ToReplicas   int       `json:"to_replicas"`
 	Reason       string    `json:"reason"`
 	Timestamp    time.Time `json:"timestamp"`
+
+	Signals          []ScalingSignal `json:"signals,omitempty"`
+	Suppressed       bool            `json:"suppressed,omitempty"`
+	SuppressedReason string          `json:"suppressed_reason,omitempty"`
 }
 
-// NewAutoScaler 创建自动扩缩容器
-func NewAutoScaler(redisClient *redis.Client, serviceName string) *AutoScaler {
-	return &AutoScaler{
+// NewAutoScaler 创建自动扩缩容器，cfg为nil时使用默认参数
+func NewAutoScaler(redisClient *redis.Client, serviceName string, cfg *config.AutoScalingConfig) *AutoScaler {
+	as := &AutoScaler{
 		redisClient:       redisClient,
 		currentReplicas:   1,
 		minReplicas:       1,
@@ -58,6 +78,31 @@ func NewAutoScaler(redisClient *redis.Client, serviceName string) *AutoScaler {
 		scaleDownCooldown: time.Minute * 5,
 		serviceName:       serviceName,
 	}
+
+	if cfg != nil {
+		if cfg.MinReplicas > 0 {
+			as.minReplicas = cfg.MinReplicas
+			as.currentReplicas = cfg.MinReplicas
+		}
+		if cfg.MaxReplicas >= as.minReplicas {
+			as.maxReplicas = cfg.MaxReplicas
+		}
+		if cfg.TargetCPU > 0 {
+			as.targetCPU = cfg.TargetCPU
+		}
+		if cfg.TargetQPS > 0 {
+			as.targetQPS = cfg.TargetQPS
+		}
+		if cfg.ScaleUpCooldown > 0 {
+			as.scaleUpCooldown = cfg.ScaleUpCooldown
+		}
+		if cfg.ScaleDownCooldown > 0 {
+			as.scaleDownCooldown = cfg.ScaleDownCooldown
+		}
+		as.upstreamHealth = cfg.UpstreamHealth
+	}
+
+	return as
 }
 
 // Start 启动自动扩缩容
@@ -96,6 +141,15 @@ func (as *AutoScaler) evaluate(ctx context.Context) error {
 	// 根据指标做扩缩容决策
 	decision := as.makeScalingDecision(metrics)
 
+	if decision.Suppressed {
+		logrus.WithField("reason", decision.SuppressedReason).Info("Scale up suppressed")
+
+		// 被抑制的决策同样记录，便于在扩缩容历史中追溯
+		if err := as.storeScalingDecision(ctx, decision); err != nil {
+			logrus.WithError(err).Warn("Failed to store scaling decision")
+		}
+	}
+
 	if decision.Action != "no_action" {
 		logrus.WithFields(logrus.Fields{
 			"action":        decision.Action,
@@ -157,6 +211,16 @@ func (as *AutoScaler) getCurrentMetrics(ctx context.Context) (*ScalingMetrics, e
 		}
 	}
 
+	// 获取上游健康评分
+	if as.upstreamHealth.Enabled {
+		upstreams, err := upstream.LoadHealth(ctx, as.redisClient)
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to load upstream health")
+		} else {
+			metrics.Upstreams = upstreams
+		}
+	}
+
 	// 模拟CPU和内存使用率（在实际环境中应该从容器监控API获取）
 	metrics.CPUUsage = 45.0 + float64(metrics.CurrentQPS)/50.0 // 简单的模拟算法
 	metrics.MemoryUsage = 30.0 + float64(metrics.CurrentQPS)/100.0
@@ -173,6 +237,11 @@ func (as *AutoScaler) makeScalingDecision(metrics *ScalingMetrics) *ScalingDecis
 		Timestamp:    time.Now(),
 	}
 
+	upstreamSignal, saturated, outage := as.evaluateUpstreams(metrics)
+	if upstreamSignal != nil {
+		decision.Signals = append(decision.Signals, *upstreamSignal)
+	}
+
 	// 检查冷却时间
 	if time.Since(as.lastScaleTime) < as.scaleUpCooldown {
 		decision.Reason = "Still in cooldown period"
@@ -183,24 +252,47 @@ func (as *AutoScaler) makeScalingDecision(metrics *ScalingMetrics) *ScalingDecis
 	shouldScaleUp := false
 	var scaleUpReasons []string
 
-	if metrics.CPUUsage > as.targetCPU {
-		shouldScaleUp = true
-		scaleUpReasons = append(scaleUpReasons, fmt.Sprintf("CPU usage %.2f%% > target %.2f%%", metrics.CPUUsage, as.targetCPU))
-	}
-
-	if metrics.CurrentQPS > as.targetQPS {
-		shouldScaleUp = true
-		scaleUpReasons = append(scaleUpReasons, fmt.Sprintf("QPS %d > target %d", metrics.CurrentQPS, as.targetQPS))
+	addSignal := func(name string, value, threshold float64, detail string) {
+		triggered := value > threshold
+		decision.Signals = append(decision.Signals, ScalingSignal{
+			Name:      name,
+			Value:     value,
+			Threshold: threshold,
+			Triggered: triggered,
+		})
+		if triggered {
+			shouldScaleUp = true
+			scaleUpReasons = append(scaleUpReasons, detail)
+		}
 	}
 
-	if metrics.AverageResponseTime > 2.0 { // 响应时间超过2秒
-		shouldScaleUp = true
-		scaleUpReasons = append(scaleUpReasons, fmt.Sprintf("Response time %.2fs > 2.0s", metrics.AverageResponseTime))
+	addSignal("cpu", metrics.CPUUsage, as.targetCPU,
+		fmt.Sprintf("CPU usage %.2f%% > target %.2f%%", metrics.CPUUsage, as.targetCPU))
+	addSignal("qps", float64(metrics.CurrentQPS), float64(as.targetQPS),
+		fmt.Sprintf("QPS %d > target %d", metrics.CurrentQPS, as.targetQPS))
+	addSignal("response_time", metrics.AverageResponseTime, 2.0, // 响应时间超过2秒
+		fmt.Sprintf("Response time %.2fs > 2.0s", metrics.AverageResponseTime))
+	addSignal("error_rate", metrics.ErrorRate, 5.0, // 错误率超过5%
+		fmt.Sprintf("Error rate %.2f%% > 5%%", metrics.ErrorRate))
+
+	// 上游饱和时扩容只会产生更多429，抑制扩容
+	if shouldScaleUp && saturated {
+		decision.Suppressed = true
+		decision.SuppressedReason = fmt.Sprintf("Scale up suppressed: upstream saturation is the dominant error source (%s); would have scaled for %v",
+			upstreamSignal.Detail, scaleUpReasons)
+		decision.Reason = decision.SuppressedReason
+		return decision
 	}
 
-	if metrics.ErrorRate > 5.0 { // 错误率超过5%
-		shouldScaleUp = true
-		scaleUpReasons = append(scaleUpReasons, fmt.Sprintf("Error rate %.2f%% > 5%%", metrics.ErrorRate))
+	// 上游长时间不可用时缩容到最小副本数
+	if outage && as.upstreamHealth.ScaleDownOnOutage &&
+		time.Since(as.outageSince) >= as.upstreamHealth.OutageDuration &&
+		as.currentReplicas > as.minReplicas {
+		decision.Action = "scale_down"
+		decision.ToReplicas = as.minReplicas
+		decision.Reason = fmt.Sprintf("Scale down to minimum: all upstreams unavailable for %s (%s)",
+			time.Since(as.outageSince).Round(time.Second), upstreamSignal.Detail)
+		return decision
 	}
 
 	// 缩容条件检查
@@ -228,6 +320,62 @@ func (as *AutoScaler) makeScalingDecision(metrics *ScalingMetrics) *ScalingDecis
 	return decision
 }
 
+// evaluateUpstreams 根据上游健康评分判断是否饱和或整体不可用
+func (as *AutoScaler) evaluateUpstreams(metrics *ScalingMetrics) (*ScalingSignal, bool, bool) {
+	if !as.upstreamHealth.Enabled || len(metrics.Upstreams) == 0 {
+		as.outageSince = time.Time{}
+		return nil, false, false
+	}
+
+	var totalRequests, throttled, errored float64
+	minScore := 1.0
+	allDown := true
+	allCooling := true
+	for _, h := range metrics.Upstreams {
+		requests := float64(h.Requests)
+		totalRequests += requests
+		throttled += h.ThrottleRate * requests
+		errored += h.ErrorRate * requests
+		if h.Score < minScore {
+			minScore = h.Score
+		}
+		if h.Score >= as.upstreamHealth.OutageScore {
+			allDown = false
+		}
+		if !h.InCooldown(metrics.Timestamp) {
+			allCooling = false
+		}
+	}
+
+	throttleRate := 0.0
+	if totalRequests > 0 {
+		throttleRate = throttled / totalRequests
+	}
+
+	// 429占比超过阈值且多于其他上游错误，或所有上游均处于429冷却期
+	saturated := allCooling ||
+		(throttleRate >= as.upstreamHealth.SaturationThreshold && throttled >= errored)
+
+	if allDown {
+		if as.outageSince.IsZero() {
+			as.outageSince = metrics.Timestamp
+		}
+	} else {
+		as.outageSince = time.Time{}
+	}
+
+	signal := &ScalingSignal{
+		Name:      "upstream_health",
+		Value:     minScore,
+		Threshold: as.upstreamHealth.OutageScore,
+		Triggered: saturated || allDown,
+		Detail: fmt.Sprintf("min upstream score %.2f, upstream throttle rate %.2f%% (threshold %.2f%%), %d upstreams",
+			minScore, throttleRate*100, as.upstreamHealth.SaturationThreshold*100, len(metrics.Upstreams)),
+	}
+
+	return signal, saturated, allDown
+}
+
 // executeScaling 执行扩缩容操作
 func (as *AutoScaler) executeScaling(ctx context.Context, decision *ScalingDecision) error {
 	switch decision.Action {
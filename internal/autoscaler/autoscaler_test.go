@@ -0,0 +1,142 @@
+package autoscaler
+
+import (
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/upstream"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testScalingConfig() *config.AutoScalingConfig {
+	return &config.AutoScalingConfig{
+		MinReplicas:       1,
+		MaxReplicas:       10,
+		TargetCPU:         70,
+		TargetQPS:         1000,
+		ScaleUpCooldown:   time.Minute,
+		ScaleDownCooldown: time.Minute,
+		UpstreamHealth: config.UpstreamHealthConfig{
+			Enabled:             true,
+			SaturationThreshold: 0.2,
+			OutageScore:         0.2,
+			OutageDuration:      time.Minute,
+			ScaleDownOnOutage:   true,
+		},
+	}
+}
+
+func TestScaleUpWhenUpstreamsHealthy(t *testing.T) {
+	as := NewAutoScaler(nil, "test", testScalingConfig())
+
+	decision := as.makeScalingDecision(&ScalingMetrics{
+		CurrentQPS: 2000,
+		CPUUsage:   50,
+		Timestamp:  time.Now(),
+		Upstreams: []*upstream.Health{
+			{Name: "dashscope", Score: 0.95, Requests: 1000, ErrorRate: 0.01, ThrottleRate: 0.01},
+		},
+	})
+
+	assert.Equal(t, "scale_up", decision.Action)
+	assert.False(t, decision.Suppressed)
+	assert.Equal(t, 2, decision.ToReplicas)
+}
+
+func TestUpstreamThrottledHighQPSSuppressesScaleUp(t *testing.T) {
+	as := NewAutoScaler(nil, "test", testScalingConfig())
+
+	decision := as.makeScalingDecision(&ScalingMetrics{
+		CurrentQPS: 2000,
+		CPUUsage:   50,
+		ErrorRate:  40,
+		Timestamp:  time.Now(),
+		Upstreams: []*upstream.Health{
+			{Name: "dashscope", Score: 0.6, Requests: 1000, ErrorRate: 0.02, ThrottleRate: 0.4},
+		},
+	})
+
+	assert.Equal(t, "no_action", decision.Action)
+	assert.Equal(t, decision.FromReplicas, decision.ToReplicas)
+	assert.True(t, decision.Suppressed)
+	assert.Contains(t, decision.SuppressedReason, "upstream saturation")
+
+	var upstreamSignal *ScalingSignal
+	for i := range decision.Signals {
+		if decision.Signals[i].Name == "upstream_health" {
+			upstreamSignal = &decision.Signals[i]
+		}
+	}
+	assert.NotNil(t, upstreamSignal)
+	assert.True(t, upstreamSignal.Triggered)
+}
+
+func TestUpstreamCooldownSuppressesScaleUp(t *testing.T) {
+	as := NewAutoScaler(nil, "test", testScalingConfig())
+	now := time.Now()
+
+	decision := as.makeScalingDecision(&ScalingMetrics{
+		CurrentQPS: 2000,
+		Timestamp:  now,
+		Upstreams: []*upstream.Health{
+			{Name: "dashscope", Score: 0.9, CooldownUntil: now.Add(time.Minute)},
+		},
+	})
+
+	assert.Equal(t, "no_action", decision.Action)
+	assert.True(t, decision.Suppressed)
+}
+
+func TestUpstreamErrorsDoNotSuppressScaleUp(t *testing.T) {
+	as := NewAutoScaler(nil, "test", testScalingConfig())
+
+	// 上游5xx多于429，不视为饱和
+	decision := as.makeScalingDecision(&ScalingMetrics{
+		CurrentQPS: 2000,
+		Timestamp:  time.Now(),
+		Upstreams: []*upstream.Health{
+			{Name: "dashscope", Score: 0.5, Requests: 1000, ErrorRate: 0.5, ThrottleRate: 0.25},
+		},
+	})
+
+	assert.Equal(t, "scale_up", decision.Action)
+	assert.False(t, decision.Suppressed)
+}
+
+func TestProlongedOutageScalesToMinimum(t *testing.T) {
+	as := NewAutoScaler(nil, "test", testScalingConfig())
+	as.currentReplicas = 5
+
+	metrics := &ScalingMetrics{
+		CurrentQPS: 500,
+		Timestamp:  time.Now(),
+		Upstreams: []*upstream.Health{
+			{Name: "dashscope", Score: 0.05, Requests: 100, ErrorRate: 1, CircuitState: upstream.CircuitOpen},
+		},
+	}
+
+	// 首次检测到故障，尚未达到持续时间
+	decision := as.makeScalingDecision(metrics)
+	assert.NotEqual(t, "scale_down", decision.Action)
+
+	// 模拟故障持续超过阈值
+	as.outageSince = time.Now().Add(-2 * time.Minute)
+	decision = as.makeScalingDecision(metrics)
+	assert.Equal(t, "scale_down", decision.Action)
+	assert.Equal(t, 1, decision.ToReplicas)
+}
+
+func TestUpstreamScoreWeights(t *testing.T) {
+	weights := upstream.DefaultWeights()
+
+	healthy := &upstream.Health{CircuitState: upstream.CircuitClosed, ActiveHealthy: true}
+	assert.InDelta(t, 1.0, upstream.Score(healthy, weights), 0.001)
+
+	throttled := &upstream.Health{ThrottleRate: 1, CircuitState: upstream.CircuitClosed, ActiveHealthy: true}
+	assert.InDelta(t, 0.7, upstream.Score(throttled, weights), 0.001)
+
+	weights.ThrottleRate = 0
+	assert.InDelta(t, 1.0, upstream.Score(throttled, weights), 0.001)
+}
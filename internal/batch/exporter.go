@@ -0,0 +1,250 @@
+// Package batch exports audit events to object storage. Events are collected
+// in memory and uploaded as one gzipped newline-delimited JSON object per
+// batch, when the batch is full or the flush interval elapses.
+package batch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/lifecycle"
+	"go-aigateway/internal/security"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Default flush thresholds of the batching exporters
+const (
+	DefaultFlushInterval = 5 * time.Minute
+	DefaultMaxEvents     = 10000
+)
+
+const (
+	// maxPendingBatches caps the events kept for retry after failed uploads,
+	// in multiples of the batch size; the oldest events are dropped beyond it
+	maxPendingBatches = 10
+	// closeFlushTimeout bounds the upload of the last batch on Close
+	closeFlushTimeout = 30 * time.Second
+)
+
+// Exporter is a batching audit exporter managed by the component lifecycle
+type Exporter interface {
+	security.AuditExporter
+	lifecycle.Component
+	Flush(ctx context.Context) error
+}
+
+// New creates the exporter of cfg.Backend, or nil when export is off
+func New(cfg *config.AuditExportConfig) (Exporter, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case "s3":
+		return NewS3Exporter(cfg), nil
+	case "oss":
+		return NewOSSExporter(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown audit export backend %q", cfg.Backend)
+	}
+}
+
+// objectStore uploads one object to the configured bucket
+type objectStore interface {
+	put(ctx context.Context, key string, body []byte) error
+}
+
+// batcher 累积审计事件，达到 maxEvents 条或每隔 interval 上传一批。
+// 上传失败的事件保留到下一次刷新，最多保留 maxPendingBatches 批。
+type batcher struct {
+	lifecycle lifecycle.Guard
+	store     objectStore
+	prefix    string
+	interval  time.Duration
+	maxEvents int
+
+	mutex  sync.Mutex
+	events []security.AuditEvent
+
+	uploadMutex sync.Mutex // serializes uploads so retried events keep their order
+	full        chan struct{}
+	stop        chan struct{}
+	done        chan struct{}
+	started     bool
+	now         func() time.Time
+}
+
+func newBatcher(store objectStore, cfg *config.AuditExportConfig) *batcher {
+	interval := cfg.FlushInterval
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	maxEvents := cfg.MaxEvents
+	if maxEvents <= 0 {
+		maxEvents = DefaultMaxEvents
+	}
+	return &batcher{
+		store:     store,
+		prefix:    cfg.Prefix,
+		interval:  interval,
+		maxEvents: maxEvents,
+		full:      make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+		now:       time.Now,
+	}
+}
+
+// Export adds event to the current batch and wakes the uploader once the
+// batch is full
+func (b *batcher) Export(event security.AuditEvent) {
+	b.mutex.Lock()
+	b.events = append(b.events, event)
+	if excess := len(b.events) - b.maxEvents*maxPendingBatches; excess > 0 {
+		b.events = b.events[excess:]
+		logrus.WithField("dropped", excess).Warn("Audit export backlog is full, dropping oldest events")
+	}
+	full := len(b.events) >= b.maxEvents
+	b.mutex.Unlock()
+
+	if full {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Start launches the background uploader
+func (b *batcher) Start(ctx context.Context) error {
+	return b.lifecycle.Start(func() error {
+		b.started = true
+		go b.run(ctx)
+		return nil
+	})
+}
+
+// Close stops the uploader and uploads the events still pending
+func (b *batcher) Close() error {
+	return b.lifecycle.Close(func() error {
+		close(b.stop)
+		if b.started {
+			<-b.done
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), closeFlushTimeout)
+		defer cancel()
+		return b.Flush(ctx)
+	})
+}
+
+// State reports the lifecycle state of the exporter
+func (b *batcher) State() lifecycle.State {
+	return b.lifecycle.State()
+}
+
+func (b *batcher) run(ctx context.Context) {
+	defer close(b.done)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		case <-b.full:
+		}
+		if err := b.Flush(ctx); err != nil {
+			logrus.WithError(err).Error("Failed to upload audit events")
+		}
+	}
+}
+
+// Flush uploads the pending events as one object. On failure the events are
+// kept and retried with the next batch.
+func (b *batcher) Flush(ctx context.Context) error {
+	b.uploadMutex.Lock()
+	defer b.uploadMutex.Unlock()
+
+	b.mutex.Lock()
+	events := b.events
+	b.events = nil
+	b.mutex.Unlock()
+	if len(events) == 0 {
+		return nil
+	}
+
+	body, err := encodeEvents(events)
+	if err == nil {
+		err = b.store.put(ctx, b.objectKey(), body)
+	}
+	if err != nil {
+		b.mutex.Lock()
+		b.events = append(events, b.events...)
+		b.mutex.Unlock()
+		return fmt.Errorf("failed to export %d audit events: %w", len(events), err)
+	}
+	logrus.WithField("events", len(events)).Debug("Exported audit events")
+	return nil
+}
+
+// objectKey names a batch <prefix>/YYYY/MM/DD/<time>-<random>.jsonl.gz; the
+// random part keeps replicas flushing in the same second apart
+func (b *batcher) objectKey() string {
+	now := b.now().UTC()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := fmt.Sprintf("%s-%s.jsonl.gz", now.Format("20060102T150405Z"), hex.EncodeToString(suffix))
+	return path.Join(b.prefix, now.Format("2006/01/02"), name)
+}
+
+// encodeEvents writes events as gzipped newline-delimited JSON
+func encodeEvents(events []security.AuditEvent) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(gz)
+	for i := range events {
+		if err := encoder.Encode(&events[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DryRunExporter keeps exported events in memory instead of uploading them
+type DryRunExporter struct {
+	mutex  sync.Mutex
+	events []security.AuditEvent
+}
+
+// NewDryRunExporter creates an empty in-memory exporter
+func NewDryRunExporter() *DryRunExporter {
+	return &DryRunExporter{}
+}
+
+// Export records event
+func (d *DryRunExporter) Export(event security.AuditEvent) {
+	d.mutex.Lock()
+	d.events = append(d.events, event)
+	d.mutex.Unlock()
+}
+
+// Events returns the events recorded so far
+func (d *DryRunExporter) Events() []security.AuditEvent {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]security.AuditEvent(nil), d.events...)
+}
@@ -0,0 +1,169 @@
+package batch
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	uploadTimeout   = time.Minute
+)
+
+// S3Exporter uploads batches of audit events to an S3 bucket, or to any
+// S3-compatible store when an endpoint is configured
+type S3Exporter struct {
+	*batcher
+}
+
+// NewS3Exporter creates an exporter for the bucket of cfg. Requests are
+// path-style and signed with AWS Signature Version 4.
+func NewS3Exporter(cfg *config.AuditExportConfig) *S3Exporter {
+	region := cfg.Region
+	if region == "" {
+		region = defaultS3Region
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("s3.%s.amazonaws.com", region)
+	}
+	store := &s3Store{
+		endpoint:  withScheme(endpoint),
+		bucket:    cfg.Bucket,
+		region:    region,
+		accessKey: cfg.AccessKeyID,
+		secretKey: cfg.AccessKeySecret,
+		client:    httpclient.NewClient("audit_export", uploadTimeout),
+		now:       time.Now,
+	}
+	return &S3Exporter{batcher: newBatcher(store, cfg)}
+}
+
+type s3Store struct {
+	endpoint  string
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+func (s *s3Store) put(ctx context.Context, key string, body []byte) error {
+	objectPath := "/" + s.bucket + "/" + key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.endpoint+uriEncode(objectPath), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/gzip")
+	payloadHash := sha256.Sum256(body)
+	signV4(req, hex.EncodeToString(payloadHash[:]), s.accessKey, s.secretKey, s.region, "s3", s.now())
+
+	return doUpload(s.client, req, "s3")
+}
+
+// signV4 signs req with AWS Signature Version 4 over its host, its
+// X-Amz-* headers and Content-Type
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "range" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", t.Format("20060102"), region, service)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), t.Format("20060102"))
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode percent-encodes everything but unreserved characters and slashes,
+// as both S3 and OSS expect in object paths
+func uriEncode(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+// withScheme defaults endpoints without a scheme to HTTPS
+func withScheme(endpoint string) string {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	if strings.HasPrefix(endpoint, "http://") || strings.HasPrefix(endpoint, "https://") {
+		return endpoint
+	}
+	return "https://" + endpoint
+}
+
+// doUpload sends req and turns non-2xx answers into errors carrying the
+// start of the response body
+func doUpload(client *http.Client, req *http.Request, backend string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s upload failed: %w", backend, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s upload failed with status %d: %s", backend, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
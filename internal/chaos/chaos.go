@@ -0,0 +1,352 @@
+// Package chaos injects faults into gateway traffic so retries, fallbacks and
+// circuit breakers can be exercised in staging without a real provider outage.
+package chaos
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"sync"
+	"syscall"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Fault types
+const (
+	FaultLatency  = "latency"  // added delay drawn uniformly from [latency_min_ms, latency_max_ms]
+	FaultError    = "error"    // an error response with the given status and code
+	FaultReset    = "reset"    // the connection is dropped
+	FaultTruncate = "truncate" // the response stops after truncate_after_bytes
+	FaultCorrupt  = "corrupt"  // the response body is no longer valid JSON
+)
+
+// Layers a rule applies at
+const (
+	LayerInbound  = "inbound"  // before the gateway handles the request
+	LayerUpstream = "upstream" // on the gateway's call to the upstream
+)
+
+// InjectedHeader tags responses of requests that had a fault injected
+const InjectedHeader = "X-Chaos-Injected"
+
+var (
+	// ErrProductionRefused is returned when chaos is enabled in release mode without CHAOS_ALLOW_PRODUCTION
+	ErrProductionRefused = errors.New("chaos injection refuses to run with GIN_MODE=release unless CHAOS_ALLOW_PRODUCTION is set")
+	// ErrInvalidRule is returned for rules with an unknown layer or fault, or out-of-range values
+	ErrInvalidRule = errors.New("invalid chaos rule")
+	// ErrConnectionReset is returned by upstream calls that had a reset injected
+	ErrConnectionReset = fmt.Errorf("chaos: %w", syscall.ECONNRESET)
+)
+
+var injections = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "aigateway_chaos_injections_total",
+		Help: "Total number of faults injected by chaos rules",
+	},
+	[]string{"layer", "fault"},
+)
+
+// Collectors returns the package's metrics for the monitoring registry
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{injections}
+}
+
+// Match selects the requests a rule applies to; empty fields match everything
+type Match struct {
+	Route      string  `json:"route,omitempty"` // inbound route pattern, e.g. /v1/chat/completions
+	Model      string  `json:"model,omitempty"`
+	Tenant     string  `json:"tenant,omitempty"`
+	Percentage float64 `json:"percentage"` // share of matching requests faulted, 0-100
+}
+
+// Fault describes what happens to a matched request
+type Fault struct {
+	Type          string `json:"type"`
+	LatencyMinMs  int    `json:"latency_min_ms,omitempty"`
+	LatencyMaxMs  int    `json:"latency_max_ms,omitempty"`
+	Status        int    `json:"status,omitempty"` // error: defaults to 503
+	Code          string `json:"code,omitempty"`   // error: error code in the body
+	TruncateAfter int    `json:"truncate_after_bytes,omitempty"`
+}
+
+// Rule 故障注入规则。规则只保存在本实例内存中，到期自动失效；
+// 设置了 max_injections 的规则在注入次数用完后不再生效。
+type Rule struct {
+	ID            string    `json:"id"`
+	Layer         string    `json:"layer"`
+	Match         Match     `json:"match"`
+	Fault         Fault     `json:"fault"`
+	TTLSeconds    int64     `json:"ttl_seconds,omitempty"`
+	MaxInjections int64     `json:"max_injections,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	Injected      int64     `json:"injected"`
+}
+
+func (r *Rule) validate() error {
+	if r.Layer != LayerInbound && r.Layer != LayerUpstream {
+		return fmt.Errorf("%w: layer must be %s or %s", ErrInvalidRule, LayerInbound, LayerUpstream)
+	}
+	if r.Match.Percentage <= 0 || r.Match.Percentage > 100 {
+		return fmt.Errorf("%w: percentage must be greater than 0 and at most 100", ErrInvalidRule)
+	}
+	if r.TTLSeconds < 0 || r.MaxInjections < 0 {
+		return fmt.Errorf("%w: ttl_seconds and max_injections must not be negative", ErrInvalidRule)
+	}
+	f := r.Fault
+	switch f.Type {
+	case FaultLatency:
+		if f.LatencyMinMs < 0 || f.LatencyMaxMs < f.LatencyMinMs || f.LatencyMaxMs == 0 {
+			return fmt.Errorf("%w: latency needs 0 <= latency_min_ms <= latency_max_ms with a positive maximum", ErrInvalidRule)
+		}
+	case FaultError:
+		if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+			return fmt.Errorf("%w: error status must be between 400 and 599", ErrInvalidRule)
+		}
+	case FaultTruncate:
+		if f.TruncateAfter < 0 {
+			return fmt.Errorf("%w: truncate_after_bytes must not be negative", ErrInvalidRule)
+		}
+	case FaultReset, FaultCorrupt:
+	default:
+		return fmt.Errorf("%w: unknown fault type %q", ErrInvalidRule, f.Type)
+	}
+	return nil
+}
+
+func (r *Rule) matches(layer string, target Target) bool {
+	return r.Layer == layer &&
+		(r.Match.Route == "" || r.Match.Route == target.Route) &&
+		(r.Match.Model == "" || r.Match.Model == target.Model) &&
+		(r.Match.Tenant == "" || r.Match.Tenant == target.Tenant)
+}
+
+// Target is what rules match a request on
+type Target struct {
+	Route  string
+	Model  string
+	Tenant string
+}
+
+// Injector 故障注入器，按规则对入站请求或对上游的调用注入故障
+type Injector struct {
+	cfg    config.ChaosConfig
+	now    func() time.Time
+	random func() float64
+
+	mu    sync.Mutex
+	rules []*Rule
+}
+
+// New creates an injector, returning nil when chaos is disabled and
+// ErrProductionRefused in release mode without AllowProduction
+func New(cfg config.ChaosConfig, ginMode string) (*Injector, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	if ginMode == gin.ReleaseMode && !cfg.AllowProduction {
+		return nil, ErrProductionRefused
+	}
+	return &Injector{
+		cfg:    cfg,
+		now:    time.Now,
+		random: mathrand.Float64,
+	}, nil
+}
+
+var (
+	defaultInjectorMu sync.RWMutex
+	defaultInjector   *Injector
+)
+
+// SetDefault installs the injector consulted by the upstream transport; nil disables it
+func SetDefault(i *Injector) {
+	defaultInjectorMu.Lock()
+	defaultInjector = i
+	defaultInjectorMu.Unlock()
+}
+
+// Default returns the installed injector, or nil
+func Default() *Injector {
+	defaultInjectorMu.RLock()
+	defer defaultInjectorMu.RUnlock()
+	return defaultInjector
+}
+
+// SetRules replaces all rules. Rules without an ID get one; the TTL defaults
+// to CHAOS_DEFAULT_TTL and is capped at CHAOS_MAX_TTL.
+func (i *Injector) SetRules(rules []Rule) ([]Rule, error) {
+	now := i.now()
+	installed := make([]*Rule, 0, len(rules))
+	for _, rule := range rules {
+		rule := rule
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		if rule.ID == "" {
+			id := make([]byte, 4)
+			rand.Read(id)
+			rule.ID = hex.EncodeToString(id)
+		}
+		ttl := time.Duration(rule.TTLSeconds) * time.Second
+		if ttl == 0 {
+			ttl = i.cfg.DefaultTTL
+		}
+		if ttl > i.cfg.MaxTTL {
+			ttl = i.cfg.MaxTTL
+		}
+		rule.TTLSeconds = int64(ttl / time.Second)
+		rule.ExpiresAt = now.Add(ttl)
+		rule.Injected = 0
+		installed = append(installed, &rule)
+	}
+
+	i.mu.Lock()
+	i.rules = installed
+	i.mu.Unlock()
+	return i.Rules(), nil
+}
+
+// Rules returns the rules that have not expired
+func (i *Injector) Rules() []Rule {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.expire()
+	rules := make([]Rule, len(i.rules))
+	for n, rule := range i.rules {
+		rules[n] = *rule
+	}
+	return rules
+}
+
+// expire drops expired and exhausted rules; the caller holds i.mu
+func (i *Injector) expire() {
+	now := i.now()
+	live := i.rules[:0]
+	for _, rule := range i.rules {
+		exhausted := rule.MaxInjections > 0 && rule.Injected >= rule.MaxInjections
+		if now.Before(rule.ExpiresAt) && !exhausted {
+			live = append(live, rule)
+		}
+	}
+	i.rules = live
+}
+
+// matchesModels reports whether a live rule at layer matches on the model,
+// which is only worth extracting from the body then
+func (i *Injector) matchesModels(layer string) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, rule := range i.rules {
+		if rule.Layer == layer && rule.Match.Model != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// pick returns the fault to inject into a request, if any; the first matching rule wins
+func (i *Injector) pick(layer string, target Target) (Rule, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.expire()
+	for _, rule := range i.rules {
+		if !rule.matches(layer, target) {
+			continue
+		}
+		if i.random()*100 >= rule.Match.Percentage {
+			return Rule{}, false
+		}
+		rule.Injected++
+		injections.WithLabelValues(layer, rule.Fault.Type).Inc()
+		return *rule, true
+	}
+	return Rule{}, false
+}
+
+// latency draws the delay of a latency fault
+func (i *Injector) latency(f Fault) time.Duration {
+	i.mu.Lock()
+	spread := float64(f.LatencyMaxMs-f.LatencyMinMs) * i.random()
+	i.mu.Unlock()
+	return time.Duration(float64(f.LatencyMinMs)+spread) * time.Millisecond
+}
+
+// sleep waits d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// requestState carries a request's target and the faults injected into it
+type requestState struct {
+	target Target
+
+	mu       sync.Mutex
+	injected []string
+}
+
+func (s *requestState) tag(rule Rule) {
+	s.mu.Lock()
+	s.injected = append(s.injected, rule.Layer+":"+rule.Fault.Type+";rule="+rule.ID)
+	s.mu.Unlock()
+}
+
+// header returns the X-Chaos-Injected value, empty when nothing was injected
+func (s *requestState) header() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value := ""
+	for n, injected := range s.injected {
+		if n > 0 {
+			value += ", "
+		}
+		value += injected
+	}
+	return value
+}
+
+type stateKey struct{}
+
+func withState(ctx context.Context, state *requestState) context.Context {
+	return context.WithValue(ctx, stateKey{}, state)
+}
+
+func stateFrom(ctx context.Context) *requestState {
+	state, _ := ctx.Value(stateKey{}).(*requestState)
+	return state
+}
+
+// errorBody is the OpenAI-style error of an injected error fault
+func errorBody(f Fault) []byte {
+	code := f.Code
+	if code == "" {
+		code = "chaos_injected"
+	}
+	return []byte(fmt.Sprintf(`{"error":{"message":"Fault injected by chaos rule","type":"api_error","code":%q}}`, code))
+}
+
+func errorStatus(f Fault) int {
+	if f.Status == 0 {
+		return 503
+	}
+	return f.Status
+}
+
+// corrupt cuts data in half and appends bytes that cannot continue any JSON document
+func corrupt(data []byte) []byte {
+	out := make([]byte, 0, len(data)/2+3)
+	out = append(out, data[:len(data)/2]...)
+	return append(out, "\x00}{"...)
+}
@@ -0,0 +1,107 @@
+package chaos
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = config.ChaosConfig{Enabled: true, DefaultTTL: 15 * time.Minute, MaxTTL: time.Hour}
+
+func TestNewRefusesProductionUnlessAllowed(t *testing.T) {
+	inj, err := New(config.ChaosConfig{DefaultTTL: time.Minute, MaxTTL: time.Hour}, gin.DebugMode)
+	assert.NoError(t, err)
+	assert.Nil(t, inj, "chaos stays off unless enabled")
+
+	_, err = New(testConfig, gin.ReleaseMode)
+	assert.ErrorIs(t, err, ErrProductionRefused)
+
+	allowed := testConfig
+	allowed.AllowProduction = true
+	inj, err = New(allowed, gin.ReleaseMode)
+	assert.NoError(t, err)
+	assert.NotNil(t, inj)
+}
+
+func TestRulesExpireAfterTTL(t *testing.T) {
+	inj, err := New(testConfig, gin.TestMode)
+	require.NoError(t, err)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	inj.now = func() time.Time { return now }
+
+	rules, err := inj.SetRules([]Rule{
+		{Layer: LayerInbound, Match: Match{Percentage: 100}, Fault: Fault{Type: FaultError}},
+		{Layer: LayerUpstream, Match: Match{Percentage: 50}, Fault: Fault{Type: FaultReset}, TTLSeconds: 60},
+		{Layer: LayerUpstream, Match: Match{Percentage: 50}, Fault: Fault{Type: FaultReset}, TTLSeconds: 86400},
+	})
+	require.NoError(t, err)
+	require.Len(t, rules, 3)
+	assert.NotEmpty(t, rules[0].ID)
+	assert.Equal(t, int64(900), rules[0].TTLSeconds, "the default TTL applies")
+	assert.Equal(t, int64(3600), rules[2].TTLSeconds, "TTLs are capped at the maximum")
+
+	now = now.Add(2 * time.Minute)
+	assert.Len(t, inj.Rules(), 2)
+	now = now.Add(time.Hour)
+	assert.Empty(t, inj.Rules())
+	_, ok := inj.pick(LayerInbound, Target{})
+	assert.False(t, ok)
+
+	for _, invalid := range []Rule{
+		{Layer: "edge", Match: Match{Percentage: 100}, Fault: Fault{Type: FaultReset}},
+		{Layer: LayerInbound, Match: Match{Percentage: 0}, Fault: Fault{Type: FaultReset}},
+		{Layer: LayerInbound, Match: Match{Percentage: 100}, Fault: Fault{Type: FaultError, Status: 200}},
+		{Layer: LayerInbound, Match: Match{Percentage: 100}, Fault: Fault{Type: FaultLatency, LatencyMinMs: 50, LatencyMaxMs: 10}},
+		{Layer: LayerInbound, Match: Match{Percentage: 100}, Fault: Fault{Type: "meteor"}},
+	} {
+		_, err := inj.SetRules([]Rule{invalid})
+		assert.ErrorIs(t, err, ErrInvalidRule)
+	}
+}
+
+func TestInboundFaultsAreTagged(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	inj, err := New(testConfig, gin.TestMode)
+	require.NoError(t, err)
+	_, err = inj.SetRules([]Rule{
+		{ID: "qwen-errors", Layer: LayerInbound, Match: Match{Route: "/v1/chat/completions", Model: "qwen-max", Tenant: "acme", Percentage: 100}, Fault: Fault{Type: FaultError, Status: 429, Code: "rate_limit_exceeded"}},
+		{ID: "cut", Layer: LayerInbound, Match: Match{Route: "/v1/models", Percentage: 100}, Fault: Fault{Type: FaultTruncate, TruncateAfter: 10}},
+	})
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("tenant_id", c.GetHeader("X-Tenant")) }, inj.Middleware())
+	r.POST("/v1/chat/completions", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	r.GET("/v1/models", func(c *gin.Context) { c.String(http.StatusOK, strings.Repeat("x", 100)) })
+
+	chat := func(tenant, model string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"`+model+`"}`))
+		req.Header.Set("X-Tenant", tenant)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := chat("acme", "qwen-max")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "rate_limit_exceeded")
+	assert.Equal(t, "inbound:error;rule=qwen-errors", w.Header().Get(InjectedHeader))
+
+	for _, w := range []*httptest.ResponseRecorder{chat("other", "qwen-max"), chat("acme", "qwen-turbo")} {
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get(InjectedHeader))
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	assert.Equal(t, "xxxxxxxxxx", w.Body.String())
+	assert.Equal(t, "inbound:truncate;rule=cut", w.Header().Get(InjectedHeader))
+}
@@ -0,0 +1,155 @@
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxModelPeekBytes bounds how much of a request body is read to find the model
+const maxModelPeekBytes = 1 << 20
+
+// Middleware 入站故障注入中间件。它记录请求的路由、模型和租户供上游规则匹配，
+// 按入站规则注入故障，并在注入过故障的响应上设置 X-Chaos-Injected。
+func (i *Injector) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := &requestState{target: Target{
+			Route:  c.FullPath(),
+			Tenant: c.GetString("tenant_id"),
+		}}
+		if i.matchesModels(LayerInbound) || i.matchesModels(LayerUpstream) {
+			state.target.Model = peekModel(c.Request)
+		}
+		c.Request = c.Request.WithContext(withState(c.Request.Context(), state))
+
+		writer := &injectingWriter{ResponseWriter: c.Writer, state: state, truncateAt: -1}
+		c.Writer = writer
+
+		rule, ok := i.pick(LayerInbound, state.target)
+		if ok {
+			state.tag(rule)
+			logrus.WithFields(logrus.Fields{
+				"rule":  rule.ID,
+				"fault": rule.Fault.Type,
+				"route": state.target.Route,
+			}).Debug("Chaos fault injected into inbound request")
+
+			switch rule.Fault.Type {
+			case FaultLatency:
+				sleep(c.Request.Context(), i.latency(rule.Fault))
+			case FaultError:
+				c.Data(errorStatus(rule.Fault), "application/json", errorBody(rule.Fault))
+				c.Abort()
+				return
+			case FaultReset:
+				resetConnection(c)
+				return
+			case FaultTruncate:
+				writer.truncateAt = rule.Fault.TruncateAfter
+			case FaultCorrupt:
+				writer.corrupt = true
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// peekModel reads the model from a JSON request body and restores the body
+func peekModel(req *http.Request) string {
+	if req.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxModelPeekBytes))
+	if err != nil {
+		return ""
+	}
+	req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+	return modelOf(body)
+}
+
+func modelOf(body []byte) string {
+	var payload struct {
+		Model string `json:"model"`
+	}
+	if json.Unmarshal(body, &payload) != nil {
+		return ""
+	}
+	return payload.Model
+}
+
+// resetConnection drops the client connection; when the connection cannot be
+// hijacked (HTTP/2, tests) the request is aborted without a response instead
+func resetConnection(c *gin.Context) {
+	c.Abort()
+	if conn, _, err := c.Writer.Hijack(); err == nil {
+		conn.Close()
+		return
+	}
+	panic(http.ErrAbortHandler)
+}
+
+// injectingWriter tags the response and applies truncate and corrupt faults
+type injectingWriter struct {
+	gin.ResponseWriter
+	state *requestState
+
+	truncateAt int // bytes still allowed through; -1 for no limit
+	corrupt    bool
+	written    int
+}
+
+func (w *injectingWriter) tagHeader() {
+	if w.ResponseWriter.Written() {
+		return
+	}
+	if value := w.state.header(); value != "" {
+		w.ResponseWriter.Header().Set(InjectedHeader, value)
+	}
+	if w.truncateAt >= 0 || w.corrupt {
+		w.ResponseWriter.Header().Del("Content-Length")
+	}
+}
+
+func (w *injectingWriter) WriteHeader(code int) {
+	w.tagHeader()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *injectingWriter) WriteHeaderNow() {
+	w.tagHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *injectingWriter) Write(data []byte) (int, error) {
+	w.tagHeader()
+	n := len(data)
+	if w.corrupt {
+		// Only the first write is mangled so a streamed response stays broken at its start
+		w.corrupt = false
+		data = corrupt(data)
+	}
+	if w.truncateAt >= 0 {
+		allowed := w.truncateAt - w.written
+		if allowed <= 0 {
+			return n, nil
+		}
+		if len(data) > allowed {
+			data = data[:allowed]
+		}
+	}
+	written, err := w.ResponseWriter.Write(data)
+	w.written += written
+	if err != nil {
+		return written, err
+	}
+	return n, nil
+}
+
+func (w *injectingWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
@@ -0,0 +1,91 @@
+package chaos_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/middleware"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRedisKilledMidOperation closes Redis while requests are in flight: every
+// request is still answered, rate limits keep being enforced in memory, and
+// Redis is used again once it is back
+func TestRedisKilledMidOperation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{
+		Addr:        mr.Addr(),
+		MaxRetries:  -1,
+		DialTimeout: 100 * time.Millisecond,
+	})
+	t.Cleanup(func() { client.Close() })
+
+	limiter := middleware.NewRedisRateLimiter(client, 100000, 5, time.Minute)
+	collector := middleware.NewAdvancedMetricsCollector(client, nil)
+	r := gin.New()
+	r.Use(middleware.RedisRateLimit(limiter))
+	r.Use(middleware.AdvancedPrometheusMetrics(collector, nil))
+	r.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+	call := func(apiKey string) int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Clients with their own keys stay under the limit, so each request must succeed
+	var served, failed atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if code := call(fmt.Sprintf("sk-%d-%d", worker, i)); code == http.StatusOK {
+					served.Add(1)
+				} else {
+					failed.Add(1)
+				}
+			}
+		}(worker)
+	}
+
+	require.Eventually(t, func() bool { return served.Load() > 50 }, 2*time.Second, time.Millisecond)
+	mr.Close()
+	before := served.Load()
+	require.Eventually(t, func() bool { return served.Load() > before+50 }, 2*time.Second, time.Millisecond,
+		"requests are served while Redis is down")
+	close(stop)
+	wg.Wait()
+	assert.Zero(t, failed.Load())
+
+	// The user limit still holds with Redis down
+	for i := 0; i < 5; i++ {
+		require.Equal(t, http.StatusOK, call("sk-limited"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, call("sk-limited"))
+
+	// Once Redis is back the limiter counts there again
+	require.NoError(t, mr.Restart())
+	mr.FlushAll()
+	require.Eventually(t, func() bool { return call("sk-after") == http.StatusOK && mr.Exists("rate_limit:user:Bearer sk-after") },
+		2*time.Second, 10*time.Millisecond)
+}
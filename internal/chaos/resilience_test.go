@@ -0,0 +1,158 @@
+package chaos_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/chaos"
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/handlers"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/performance"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newInjector(t *testing.T, rules ...chaos.Rule) *chaos.Injector {
+	gin.SetMode(gin.TestMode)
+	inj, err := chaos.New(config.ChaosConfig{Enabled: true, DefaultTTL: time.Minute, MaxTTL: time.Hour}, gin.TestMode)
+	require.NoError(t, err)
+	_, err = inj.SetRules(rules)
+	require.NoError(t, err)
+	chaos.SetDefault(inj)
+	t.Cleanup(func() { chaos.SetDefault(nil) })
+	return inj
+}
+
+// chatUpstream answers every chat request with the requested model's name
+func chatUpstream(t *testing.T, calls *int64) *httptest.Server {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(calls, 1)
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": map[string]interface{}{"role": "assistant", "content": fmt.Sprintf("answer from %v", body["model"])}}},
+		})
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func TestInjectedUpstream503IsRetried(t *testing.T) {
+	var calls int64
+	upstream := chatUpstream(t, &calls)
+	newInjector(t, chaos.Rule{
+		ID:            "one-503",
+		Layer:         chaos.LayerUpstream,
+		Match:         chaos.Match{Percentage: 100},
+		Fault:         chaos.Fault{Type: chaos.FaultError, Status: http.StatusServiceUnavailable},
+		MaxInjections: 1,
+	})
+	client := httpclient.NewClient("chaos_test", 5*time.Second)
+
+	r := gin.New()
+	r.Use(chaos.Default().Middleware())
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		var statuses []int
+		err := middleware.RetryPolicy{MaxRetries: 2}.Do(c.Request.Context(), func(ctx context.Context) error {
+			req, _ := http.NewRequestWithContext(ctx, http.MethodPost, upstream.URL, strings.NewReader(`{"model":"qwen-turbo"}`))
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			statuses = append(statuses, resp.StatusCode)
+			if resp.StatusCode == http.StatusServiceUnavailable {
+				return fmt.Errorf("upstream status %d", resp.StatusCode)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		c.JSON(http.StatusOK, gin.H{"statuses": statuses})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"statuses":[503,200]}`, w.Body.String())
+	assert.Equal(t, int64(1), atomic.LoadInt64(&calls), "the injected 503 never reached the upstream")
+	assert.Equal(t, "upstream:error;rule=one-503", w.Header().Get(chaos.InjectedHeader))
+}
+
+func TestSustainedUpstreamFailureFallsBackToHealthyModel(t *testing.T) {
+	var calls int64
+	upstream := chatUpstream(t, &calls)
+	newInjector(t, chaos.Rule{
+		ID:    "qwen-max-down",
+		Layer: chaos.LayerUpstream,
+		Match: chaos.Match{Model: "qwen-max", Percentage: 100},
+		Fault: chaos.Fault{Type: chaos.FaultReset},
+	})
+
+	r := gin.New()
+	r.Use(chaos.Default().Middleware())
+	r.POST("/api/v1/ensemble", handlers.Ensemble(&config.Config{
+		TargetURL: upstream.URL,
+		Ensemble:  config.EnsembleConfig{Timeout: 5 * time.Second, MaxModels: 4},
+	}))
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/ensemble", strings.NewReader(
+			`{"models":["qwen-max","qwen-turbo"],"aggregation":"random","messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var result handlers.EnsembleResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.Equal(t, "qwen-turbo", result.Winner)
+		assert.Equal(t, "answer from qwen-turbo", result.Content)
+		assert.Equal(t, handlers.EnsembleStatusError, result.Responses[0].Status)
+		assert.Equal(t, "upstream:reset;rule=qwen-max-down", w.Header().Get(chaos.InjectedHeader))
+	}
+	assert.Equal(t, int64(3), atomic.LoadInt64(&calls), "only the healthy model reached the upstream")
+}
+
+func TestInjected503sOpenCircuitBreaker(t *testing.T) {
+	inj := newInjector(t, chaos.Rule{
+		Layer: chaos.LayerInbound,
+		Match: chaos.Match{Route: "/v1/chat/completions", Percentage: 100},
+		Fault: chaos.Fault{Type: chaos.FaultError, Status: http.StatusServiceUnavailable, Code: "service_unavailable"},
+	})
+	po := performance.NewPerformanceOptimizer(&config.Config{}, nil)
+
+	r := gin.New()
+	r.Use(po.CircuitBreakerMiddleware(), inj.Middleware())
+	r.POST("/v1/chat/completions", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+
+	call := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil))
+		return w
+	}
+	for i := 0; i < 5; i++ {
+		w := call()
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.NotEmpty(t, w.Header().Get(chaos.InjectedHeader))
+	}
+
+	// The breaker is open now and rejects requests before they reach the injector
+	_, err := inj.SetRules(nil)
+	require.NoError(t, err)
+	w := call()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "circuit breaker is open")
+	assert.Empty(t, w.Header().Get(chaos.InjectedHeader))
+}
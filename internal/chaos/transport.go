@@ -0,0 +1,134 @@
+package chaos
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Transport wraps an upstream round tripper with the default injector's
+// upstream rules. Requests that did not pass the inbound middleware are left alone.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return &transport{next: next}
+}
+
+type transport struct {
+	next http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	i := Default()
+	if i == nil {
+		return t.next.RoundTrip(req)
+	}
+	state := stateFrom(req.Context())
+	if state == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	target := state.target
+	if i.matchesModels(LayerUpstream) {
+		if model := requestModel(req); model != "" {
+			target.Model = model
+		}
+	}
+	rule, ok := i.pick(LayerUpstream, target)
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+	state.tag(rule)
+	logrus.WithFields(logrus.Fields{
+		"rule":  rule.ID,
+		"fault": rule.Fault.Type,
+		"host":  req.URL.Host,
+	}).Debug("Chaos fault injected into upstream call")
+
+	switch rule.Fault.Type {
+	case FaultLatency:
+		sleep(req.Context(), i.latency(rule.Fault))
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+	case FaultError:
+		body := errorBody(rule.Fault)
+		status := errorStatus(rule.Fault)
+		header := http.Header{}
+		header.Set("Content-Type", "application/json")
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+		header.Set(InjectedHeader, state.header())
+		return &http.Response{
+			Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+			StatusCode:    status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	case FaultReset:
+		return nil, ErrConnectionReset
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Header.Set(InjectedHeader, state.header())
+	switch rule.Fault.Type {
+	case FaultTruncate:
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Body = &truncatedBody{ReadCloser: resp.Body, remaining: rule.Fault.TruncateAfter}
+	case FaultCorrupt:
+		body, readErr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		body = corrupt(body)
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = int64(len(body))
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return resp, nil
+}
+
+// requestModel reads the model from a replayable request body
+func requestModel(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return ""
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, maxModelPeekBytes))
+	if err != nil {
+		return ""
+	}
+	return modelOf(data)
+}
+
+// truncatedBody ends an upstream body early, as a dropped connection would
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if len(p) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= n
+	return n, err
+}
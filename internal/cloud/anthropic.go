@@ -0,0 +1,326 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/logging"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrNotSupported is returned for operations a provider does not offer, such
+// as scaling a SaaS API
+var ErrNotSupported = errors.New("operation not supported by cloud provider")
+
+const (
+	anthropicBaseURL    = "https://api.anthropic.com"
+	anthropicAPIVersion = "2023-06-01"
+	anthropicKeyPrefix  = "sk-ant-"
+)
+
+// Anthropic Provider Implementation
+type AnthropicProvider struct {
+	config     *config.CloudIntegrationConfig
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+}
+
+func NewAnthropicProvider() (*AnthropicProvider, error) {
+	return &AnthropicProvider{
+		httpClient: httpclient.NewClient("cloud_integration", 30*time.Second),
+		baseURL:    anthropicBaseURL,
+	}, nil
+}
+
+func (ap *AnthropicProvider) Initialize(config *config.CloudIntegrationConfig) error {
+	apiKey := strings.TrimSpace(config.Credentials.APIKey)
+	if apiKey == "" {
+		return fmt.Errorf("anthropic API key is not configured")
+	}
+	if !strings.HasPrefix(apiKey, anthropicKeyPrefix) {
+		return fmt.Errorf("anthropic API key must start with %s", anthropicKeyPrefix)
+	}
+	ap.config = config
+	ap.apiKey = apiKey
+	logrus.Info("Initializing Anthropic cloud integration")
+	return nil
+}
+
+// get issues an authenticated GET against the Anthropic API
+func (ap *AnthropicProvider) get(path string, query url.Values) (*http.Response, error) {
+	target := ap.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-api-key", ap.apiKey)
+	req.Header.Set("anthropic-version", anthropicAPIVersion)
+	return ap.httpClient.Do(req)
+}
+
+// anthropicModel is an entry of GET /v1/models
+type anthropicModel struct {
+	ID          string    `json:"id"`
+	DisplayName string    `json:"display_name"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// GetServices lists the Claude models available to the API key
+func (ap *AnthropicProvider) GetServices() ([]ServiceInfo, error) {
+	logrus.Info("Fetching models from Anthropic")
+
+	var services []ServiceInfo
+	query := url.Values{"limit": {"100"}}
+	for {
+		resp, err := ap.get("/v1/models", query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Anthropic models: %w", err)
+		}
+		var page struct {
+			Data    []anthropicModel `json:"data"`
+			HasMore bool             `json:"has_more"`
+			LastID  string           `json:"last_id"`
+		}
+		err = decodeAnthropicResponse(resp, &page)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Anthropic models: %w", err)
+		}
+
+		for _, model := range page.Data {
+			services = append(services, ServiceInfo{
+				Name:      model.ID,
+				Type:      "model",
+				Status:    "available",
+				Instances: 1,
+				Region:    "global",
+				Endpoint:  ap.baseURL + "/v1/messages",
+				Tags: map[string]string{
+					"display_name": model.DisplayName,
+					"provider":     "anthropic",
+				},
+				CreatedAt: model.CreatedAt,
+				UpdatedAt: model.CreatedAt,
+			})
+		}
+		if !page.HasMore || page.LastID == "" {
+			return services, nil
+		}
+		query.Set("after_id", page.LastID)
+	}
+}
+
+// decodeAnthropicResponse decodes a 200 response into out and closes the body
+func decodeAnthropicResponse(resp *http.Response, out interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// GetServiceHealth pings the model endpoint; a model name checks that model,
+// an empty name the API as a whole
+func (ap *AnthropicProvider) GetServiceHealth(serviceName string) (*HealthStatus, error) {
+	logrus.WithField("service", serviceName).Info("Checking service health on Anthropic")
+
+	path, query := "/v1/models", url.Values{"limit": {"1"}}
+	if serviceName != "" {
+		path, query = "/v1/models/"+url.PathEscape(serviceName), nil
+	}
+
+	start := time.Now()
+	resp, err := ap.get(path, query)
+	latency := time.Since(start)
+	status := "unhealthy"
+	statusCode := 0
+	if err == nil {
+		statusCode = resp.StatusCode
+		resp.Body.Close()
+		if statusCode == http.StatusOK {
+			status = "healthy"
+		}
+	} else {
+		logrus.WithError(err).Warn("Anthropic health check failed")
+	}
+
+	return &HealthStatus{
+		Service: serviceName,
+		Status:  status,
+		Instances: []InstanceHealth{{
+			ID:       "anthropic-api",
+			Status:   status,
+			Endpoint: ap.baseURL,
+			Metrics:  map[string]float64{"latency_ms": float64(latency.Milliseconds())},
+		}},
+		Metrics: map[string]float64{
+			"latency_ms":  float64(latency.Milliseconds()),
+			"status_code": float64(statusCode),
+		},
+		LastChecked: time.Now(),
+	}, nil
+}
+
+func (ap *AnthropicProvider) ScaleService(serviceName string, replicas int) error {
+	return ErrNotSupported
+}
+
+// GetMetrics returns the gateway's own per-minute token usage of Anthropic models
+func (ap *AnthropicProvider) GetMetrics(serviceName string, timeRange TimeRange) (*MetricsData, error) {
+	counter := DefaultUsageCounter()
+	if counter == nil {
+		return nil, fmt.Errorf("token usage is not recorded without Redis")
+	}
+	return counter.Metrics(context.Background(), serviceName, timeRange)
+}
+
+// GetLogs returns the AI request audit events of the range still held in
+// memory, limited to one model when serviceName is set
+func (ap *AnthropicProvider) GetLogs(serviceName string, timeRange TimeRange) ([]LogEntry, error) {
+	var logs []LogEntry
+	for _, record := range logging.RecentAudit(timeRange.Start, timeRange.End) {
+		if record.Fields["event_type"] != "ai_request" {
+			continue
+		}
+		details, _ := record.Fields["details"].(map[string]interface{})
+		if serviceName != "" && details["model"] != serviceName {
+			continue
+		}
+		logs = append(logs, LogEntry{
+			Timestamp: record.Time,
+			Level:     strings.ToUpper(record.Level.String()),
+			Message:   record.Message,
+			Source:    "audit",
+			Fields:    record.Fields,
+		})
+	}
+	return logs, nil
+}
+
+func (ap *AnthropicProvider) UpdateConfiguration(serviceName string, config map[string]interface{}) error {
+	return ErrNotSupported
+}
+
+func (ap *AnthropicProvider) Close() error {
+	logrus.Info("Closing Anthropic cloud integration")
+	return nil
+}
+
+// usageRetention bounds how long per-minute usage buckets are kept
+const usageRetention = 24 * time.Hour
+
+// UsageCounter 在 Redis 中按分钟累计网关转发的 token 用量和请求数，
+// 每个模型一个哈希字段，供 SaaS 提供商的 GetMetrics 使用
+type UsageCounter struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+// NewUsageCounter creates a counter keeping buckets under usage:<provider>:<unix minute>
+func NewUsageCounter(client *redis.Client, provider string) *UsageCounter {
+	return &UsageCounter{
+		client: client,
+		prefix: "usage:" + provider + ":",
+		now:    time.Now,
+	}
+}
+
+func (u *UsageCounter) bucket(t time.Time) string {
+	return u.prefix + strconv.FormatInt(t.Unix()/60, 10)
+}
+
+// Record adds one request using tokens to the current minute
+func (u *UsageCounter) Record(ctx context.Context, model string, tokens int64) error {
+	key := u.bucket(u.now())
+	pipe := u.client.TxPipeline()
+	pipe.HIncrBy(ctx, key, "tokens:"+model, tokens)
+	pipe.HIncrBy(ctx, key, "requests:"+model, 1)
+	pipe.Expire(ctx, key, usageRetention)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Metrics returns per-minute total_tokens and requests within timeRange, summed
+// over all models or for one model. Minutes without traffic are omitted.
+func (u *UsageCounter) Metrics(ctx context.Context, model string, timeRange TimeRange) (*MetricsData, error) {
+	start := timeRange.Start.Truncate(time.Minute)
+	if oldest := u.now().Add(-usageRetention).Truncate(time.Minute); start.Before(oldest) {
+		start = oldest
+	}
+
+	var minutes []time.Time
+	pipe := u.client.Pipeline()
+	var cmds []*redis.MapStringStringCmd
+	for t := start; !t.After(timeRange.End); t = t.Add(time.Minute) {
+		minutes = append(minutes, t)
+		cmds = append(cmds, pipe.HGetAll(ctx, u.bucket(t)))
+	}
+	if len(cmds) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+			return nil, fmt.Errorf("failed to read token usage: %w", err)
+		}
+	}
+
+	data := &MetricsData{
+		Service:   model,
+		TimeRange: timeRange,
+		Metrics:   map[string][]DataPoint{"total_tokens": {}, "requests": {}},
+	}
+	for i, cmd := range cmds {
+		var tokens, requests float64
+		for field, value := range cmd.Val() {
+			kind, fieldModel, _ := strings.Cut(field, ":")
+			if model != "" && fieldModel != model {
+				continue
+			}
+			n, _ := strconv.ParseFloat(value, 64)
+			switch kind {
+			case "tokens":
+				tokens += n
+			case "requests":
+				requests += n
+			}
+		}
+		if requests == 0 {
+			continue
+		}
+		data.Metrics["total_tokens"] = append(data.Metrics["total_tokens"], DataPoint{Timestamp: minutes[i], Value: tokens})
+		data.Metrics["requests"] = append(data.Metrics["requests"], DataPoint{Timestamp: minutes[i], Value: requests})
+	}
+	return data, nil
+}
+
+var (
+	defaultUsageCounterMu sync.RWMutex
+	defaultUsageCounter   *UsageCounter
+)
+
+// SetUsageCounter installs the counter read by GetMetrics of SaaS providers; nil disables it
+func SetUsageCounter(u *UsageCounter) {
+	defaultUsageCounterMu.Lock()
+	defaultUsageCounter = u
+	defaultUsageCounterMu.Unlock()
+}
+
+// DefaultUsageCounter returns the installed usage counter, or nil
+func DefaultUsageCounter() *UsageCounter {
+	defaultUsageCounterMu.RLock()
+	defer defaultUsageCounterMu.RUnlock()
+	return defaultUsageCounter
+}
@@ -0,0 +1,115 @@
+package cloud
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/security"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func anthropicConfig(apiKey string) *config.CloudIntegrationConfig {
+	return &config.CloudIntegrationConfig{
+		Enabled:       true,
+		CloudProvider: "anthropic",
+		Credentials:   config.CloudCredentials{APIKey: apiKey},
+	}
+}
+
+func TestAnthropicProviderValidatesAPIKey(t *testing.T) {
+	_, err := NewCloudIntegrator(anthropicConfig(""))
+	assert.ErrorContains(t, err, "API key is not configured")
+	_, err = NewCloudIntegrator(anthropicConfig("not-a-key"))
+	assert.ErrorContains(t, err, "must start with sk-ant-")
+
+	integrator, err := NewCloudIntegrator(anthropicConfig("sk-ant-test"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, integrator.ScaleService("claude-sonnet-4", 3), ErrNotSupported)
+}
+
+func TestAnthropicProviderListsModelsAndPings(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "sk-ant-test", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicAPIVersion, r.Header.Get("anthropic-version"))
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/v1/models" && r.URL.Query().Get("after_id") == "":
+			w.Write([]byte(`{"data":[{"id":"claude-opus-4","display_name":"Claude Opus 4","created_at":"2025-05-22T00:00:00Z"}],"has_more":true,"last_id":"claude-opus-4"}`))
+		case r.URL.Path == "/v1/models":
+			w.Write([]byte(`{"data":[{"id":"claude-sonnet-4","display_name":"Claude Sonnet 4","created_at":"2025-05-22T00:00:00Z"}],"has_more":false}`))
+		case r.URL.Path == "/v1/models/claude-sonnet-4":
+			w.Write([]byte(`{"id":"claude-sonnet-4"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := NewAnthropicProvider()
+	require.NoError(t, err)
+	provider.baseURL = server.URL
+	require.NoError(t, provider.Initialize(anthropicConfig("sk-ant-test")))
+
+	services, err := provider.GetServices()
+	require.NoError(t, err)
+	require.Len(t, services, 2, "all pages are listed")
+	assert.Equal(t, "claude-opus-4", services[0].Name)
+	assert.Equal(t, "Claude Sonnet 4", services[1].Tags["display_name"])
+
+	health, err := provider.GetServiceHealth("claude-sonnet-4")
+	require.NoError(t, err)
+	assert.Equal(t, "healthy", health.Status)
+	health, err = provider.GetServiceHealth("claude-unknown")
+	require.NoError(t, err)
+	assert.Equal(t, "unhealthy", health.Status)
+}
+
+func TestAnthropicProviderReportsGatewayUsageAndLogs(t *testing.T) {
+	mr := miniredis.RunT(t)
+	counter := NewUsageCounter(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "anthropic")
+	start := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	counter.now = func() time.Time { return now }
+	SetUsageCounter(counter)
+	t.Cleanup(func() { SetUsageCounter(nil) })
+
+	ctx := context.Background()
+	require.NoError(t, counter.Record(ctx, "claude-sonnet-4", 100))
+	require.NoError(t, counter.Record(ctx, "claude-opus-4", 50))
+	now = start.Add(2 * time.Minute)
+	require.NoError(t, counter.Record(ctx, "claude-sonnet-4", 30))
+
+	provider := &AnthropicProvider{}
+	metrics, err := provider.GetMetrics("", TimeRange{Start: start, End: now})
+	require.NoError(t, err)
+	require.Len(t, metrics.Metrics["total_tokens"], 2, "idle minutes are omitted")
+	assert.Equal(t, 150.0, metrics.Metrics["total_tokens"][0].Value)
+	assert.Equal(t, 2.0, metrics.Metrics["requests"][0].Value)
+
+	metrics, err = provider.GetMetrics("claude-opus-4", TimeRange{Start: start, End: now})
+	require.NoError(t, err)
+	require.Len(t, metrics.Metrics["total_tokens"], 1)
+	assert.Equal(t, 50.0, metrics.Metrics["total_tokens"][0].Value)
+
+	before := time.Now()
+	audit := security.NewAuditLogger()
+	audit.Log(&security.AuditEvent{Type: "ai_request", Details: map[string]interface{}{"model": "claude-sonnet-4"}})
+	audit.Log(&security.AuditEvent{Type: "ai_request", Details: map[string]interface{}{"model": "qwen-max"}})
+	audit.Log(&security.AuditEvent{Type: "login"})
+
+	logs, err := provider.GetLogs("claude-sonnet-4", TimeRange{Start: before, End: time.Now()})
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+	assert.Equal(t, "audit", logs[0].Source)
+	logs, err = provider.GetLogs("", TimeRange{Start: before, End: time.Now()})
+	require.NoError(t, err)
+	assert.Len(t, logs, 2)
+}
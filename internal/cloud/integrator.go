@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/security"
 	"net/http"
 	"sort"
 	"strings"
@@ -99,6 +101,8 @@ func NewCloudIntegrator(cfg *config.CloudIntegrationConfig) (*CloudIntegrator, e
 		provider, err = NewAzureProvider()
 	case "gcp":
 		provider, err = NewGCPProvider()
+	case "anthropic":
+		provider, err = NewAnthropicProvider()
 	default:
 		return nil, fmt.Errorf("unsupported cloud provider: %s", cfg.CloudProvider)
 	}
@@ -174,9 +178,7 @@ type AliyunProvider struct {
 
 func NewAliyunProvider() (*AliyunProvider, error) {
 	return &AliyunProvider{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		httpClient: httpclient.NewClient("cloud_integration", 30*time.Second),
 	}, nil
 }
 
@@ -368,9 +370,7 @@ type AWSProvider struct {
 
 func NewAWSProvider() (*AWSProvider, error) {
 	return &AWSProvider{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		httpClient: security.UpstreamClient("cloud_integration", 30*time.Second),
 	}, nil
 }
 
@@ -793,9 +793,7 @@ type AzureProvider struct {
 
 func NewAzureProvider() (*AzureProvider, error) {
 	return &AzureProvider{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		client: httpclient.NewClient("cloud_integration", 30*time.Second),
 	}, nil
 }
 
@@ -999,9 +997,7 @@ type GCPProvider struct {
 
 func NewGCPProvider() (*GCPProvider, error) {
 	return &GCPProvider{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		client: httpclient.NewClient("cloud_integration", 30*time.Second),
 	}, nil
 }
 
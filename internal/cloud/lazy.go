@@ -0,0 +1,121 @@
+package cloud
+
+import (
+	"fmt"
+	"sync"
+
+	"go-aigateway/internal/config"
+)
+
+// Integrator is the cloud management surface used by the router
+type Integrator interface {
+	GetServices() ([]ServiceInfo, error)
+	GetServiceHealth(serviceName string) (*HealthStatus, error)
+	ScaleService(serviceName string, replicas int) error
+	GetMetrics(serviceName string, timeRange TimeRange) (*MetricsData, error)
+	GetLogs(serviceName string, timeRange TimeRange) ([]LogEntry, error)
+	UpdateConfiguration(serviceName string, config map[string]interface{}) error
+	Close() error
+}
+
+var (
+	_ Integrator = (*CloudIntegrator)(nil)
+	_ Integrator = (*LazyCloudIntegrator)(nil)
+)
+
+// LazyCloudIntegrator 延迟初始化的 CloudIntegrator：云服务商在第一次被调用时才创建和初始化。
+// 初始化失败的错误会被缓存，之后的调用直接返回该错误。
+type LazyCloudIntegrator struct {
+	config *config.CloudIntegrationConfig
+	newFn  func(*config.CloudIntegrationConfig) (*CloudIntegrator, error)
+
+	once       sync.Once
+	integrator *CloudIntegrator
+	err        error
+}
+
+// NewLazyCloudIntegrator returns an integrator that initializes the configured
+// provider on first use, or nil when cloud integration is disabled
+func NewLazyCloudIntegrator(cfg *config.CloudIntegrationConfig) *LazyCloudIntegrator {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &LazyCloudIntegrator{config: cfg, newFn: NewCloudIntegrator}
+}
+
+// init creates the underlying integrator exactly once
+func (l *LazyCloudIntegrator) init() (*CloudIntegrator, error) {
+	if l == nil {
+		return nil, fmt.Errorf("cloud integration not enabled")
+	}
+	l.once.Do(func() {
+		l.integrator, l.err = l.newFn(l.config)
+	})
+	return l.integrator, l.err
+}
+
+// Preload initializes the provider now instead of on first use
+func (l *LazyCloudIntegrator) Preload() error {
+	_, err := l.init()
+	return err
+}
+
+func (l *LazyCloudIntegrator) GetServices() ([]ServiceInfo, error) {
+	ci, err := l.init()
+	if err != nil {
+		return nil, err
+	}
+	return ci.GetServices()
+}
+
+func (l *LazyCloudIntegrator) GetServiceHealth(serviceName string) (*HealthStatus, error) {
+	ci, err := l.init()
+	if err != nil {
+		return nil, err
+	}
+	return ci.GetServiceHealth(serviceName)
+}
+
+func (l *LazyCloudIntegrator) ScaleService(serviceName string, replicas int) error {
+	ci, err := l.init()
+	if err != nil {
+		return err
+	}
+	return ci.ScaleService(serviceName, replicas)
+}
+
+func (l *LazyCloudIntegrator) GetMetrics(serviceName string, timeRange TimeRange) (*MetricsData, error) {
+	ci, err := l.init()
+	if err != nil {
+		return nil, err
+	}
+	return ci.GetMetrics(serviceName, timeRange)
+}
+
+func (l *LazyCloudIntegrator) GetLogs(serviceName string, timeRange TimeRange) ([]LogEntry, error) {
+	ci, err := l.init()
+	if err != nil {
+		return nil, err
+	}
+	return ci.GetLogs(serviceName, timeRange)
+}
+
+func (l *LazyCloudIntegrator) UpdateConfiguration(serviceName string, config map[string]interface{}) error {
+	ci, err := l.init()
+	if err != nil {
+		return err
+	}
+	return ci.UpdateConfiguration(serviceName, config)
+}
+
+// Close releases the provider if it was ever initialized, without initializing it
+func (l *LazyCloudIntegrator) Close() error {
+	if l == nil {
+		return nil
+	}
+	// Claim the once so a call racing with shutdown does not initialize afterwards
+	l.once.Do(func() {
+		l.err = fmt.Errorf("cloud integration closed")
+	})
+	return l.integrator.Close()
+}
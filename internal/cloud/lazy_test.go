@@ -0,0 +1,103 @@
+package cloud
+
+import (
+	"io"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var benchProviders = []string{"aliyun", "aws", "azure", "gcp"}
+
+func cloudConfig(provider string) *config.CloudIntegrationConfig {
+	return &config.CloudIntegrationConfig{
+		Enabled:       true,
+		CloudProvider: provider,
+		Region:        "us-west-2",
+		Credentials:   config.CloudCredentials{AccessKeyID: "id", AccessKeySecret: "secret"},
+	}
+}
+
+func TestLazyCloudIntegratorDefersInitialization(t *testing.T) {
+	calls := 0
+	lazy := NewLazyCloudIntegrator(cloudConfig("aliyun"))
+	lazy.newFn = func(cfg *config.CloudIntegrationConfig) (*CloudIntegrator, error) {
+		calls++
+		return NewCloudIntegrator(cfg)
+	}
+	assert.Equal(t, 0, calls)
+
+	_, err := lazy.GetServices()
+	require.NoError(t, err)
+	_, err = lazy.GetServiceHealth("ai-gateway")
+	require.NoError(t, err)
+	require.NoError(t, lazy.Preload())
+	assert.Equal(t, 1, calls)
+	require.NoError(t, lazy.Close())
+}
+
+func TestLazyCloudIntegratorCachesInitError(t *testing.T) {
+	calls := 0
+	lazy := NewLazyCloudIntegrator(cloudConfig("unknown"))
+	lazy.newFn = func(cfg *config.CloudIntegrationConfig) (*CloudIntegrator, error) {
+		calls++
+		return NewCloudIntegrator(cfg)
+	}
+
+	_, err := lazy.GetServices()
+	assert.ErrorContains(t, err, "unsupported cloud provider")
+	assert.Equal(t, err, lazy.ScaleService("ai-gateway", 2))
+	assert.Equal(t, err, lazy.Preload())
+	assert.Equal(t, 1, calls)
+}
+
+func TestLazyCloudIntegratorDisabledAndUnusedClose(t *testing.T) {
+	assert.Nil(t, NewLazyCloudIntegrator(&config.CloudIntegrationConfig{Enabled: false}))
+
+	var disabled *LazyCloudIntegrator
+	_, err := disabled.GetServices()
+	assert.Error(t, err)
+	assert.NoError(t, disabled.Close())
+
+	// Closing an unused integrator does not initialize it
+	lazy := NewLazyCloudIntegrator(cloudConfig("aws"))
+	require.NoError(t, lazy.Close())
+	assert.Nil(t, lazy.integrator)
+	_, err = lazy.GetServices()
+	assert.ErrorContains(t, err, "closed")
+}
+
+func silenceLogs(b *testing.B) {
+	out := logrus.StandardLogger().Out
+	logrus.SetOutput(io.Discard)
+	b.Cleanup(func() { logrus.SetOutput(out) })
+}
+
+// Startup with every provider configured and no cloud requests served
+func BenchmarkCloudStartupEager(b *testing.B) {
+	silenceLogs(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, p := range benchProviders {
+			ci, err := NewCloudIntegrator(cloudConfig(p))
+			if err != nil {
+				b.Fatal(err)
+			}
+			ci.Close()
+		}
+	}
+}
+
+func BenchmarkCloudStartupLazy(b *testing.B) {
+	silenceLogs(b)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, p := range benchProviders {
+			NewLazyCloudIntegrator(cloudConfig(p)).Close()
+		}
+	}
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"path"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -13,19 +16,119 @@ type Config struct {
 	GinMode        string
 	TargetURL      string
 	TargetKey      string
+	SmokeTestModel string // model the admin smoke test sends to the target API
 	GatewayKeys    []string
 	LogLevel       string
 	LogFormat      string
 	RateLimit      int
 	HealthCheck    bool
 	AllowedOrigins []string // CORS allowed origins
+	MaxImageSizeMB int      // Maximum size of a single vision image input
+
+	// Configuration files watched for changes, see ConfigWatcher
+	EnvFile    string // .env file loaded at startup
+	ConfigFile string // optional YAML file of environment variable overrides
+	HotReload  bool
+
+	// Upstream retries when a chat response does not match the request's response_schema
+	MaxSchemaRetries int
+
+	// Upstream retries allowed per second across all clients; retries beyond it return the upstream error
+	RetryBudgetPerSecond float64
+
+	// Per-endpoint QPS limits keyed by request path pattern, applied on top of RateLimit
+	EndpointRateLimits map[string]EndpointRateConfig
+
+	// Per-API-key sliding window limits, applied on top of RateLimit
+	KeyRateLimit KeyRateLimitConfig
+
+	// Roll the Redis rate limiter back to the pipeline that counts rejected
+	// requests instead of the sliding window script
+	RedisRateLimitLegacy bool
+
+	// Request body validation of the chat and completion endpoints
+	Validation ValidationConfig
+
+	// Client IP allowlist and blocklist
+	IPFilter IPFilterConfig
+	// ContentFilter redacts secrets and personal data in responses
+	ContentFilter ContentFilterConfig
+
+	// In-process cache of GET responses of the performance optimizer
+	ResponseCache ResponseCacheConfig
+
+	// Context window truncation
+	ContextTruncation ContextTruncationConfig
+
+	// Branchable conversation sessions
+	Sessions SessionConfig
+
+	// Deadline budgets sent to internal model servers
+	UpstreamBudget UpstreamBudgetConfig
+
+	// Fan-out of one query to several models
+	Ensemble EnsembleConfig
+
+	// Sentinel prompts detecting drift in provider model outputs
+	Sentinels SentinelConfig
+
+	// Priority admission queue
+	RequestQueue RequestQueueConfig
+
+	// Graceful shutdown draining
+	Shutdown ShutdownConfig
+
+	// Experimental HTTP/3 listener
+	QUIC QUICConfig
+
+	// Reserved capacity pools per tenant
+	Capacity CapacityConfig
+
+	// Emergency kill switches per tenant and per provider
+	KillSwitch KillSwitchConfig
+
+	// Versioned prompt templates used by the gateway's own prompts
+	Prompts PromptsConfig
+
+	// Developer sandbox keys served by the response simulator
+	Sandbox SandboxConfig
+
+	// Region-aware upstream selection
+	GeoRouting GeoRoutingConfig
+
+	// Model-based upstream selection through service sources
+	ModelRouting ModelRoutingConfig
+
+	// Secondary providers chat requests are retried against when the primary fails
+	Fallback FallbackConfig
+
+	// Fault injection for resilience testing in staging
+	Chaos ChaosConfig
+
+	// Outbound call policy against SSRF
+	Egress EgressConfig
+
+	// Which request and response headers cross the proxy
+	HeaderPolicy HeaderPolicyConfig
+
+	// Deprecated and retired model handling
+	ModelLifecycle ModelLifecycleConfig
 
 	// Security Configuration
 	Security SecurityConfig
 
+	// Batched export of audit events to object storage
+	AuditExport AuditExportConfig
+
+	// OIDC single sign-on
+	OIDC OIDCConfig
+
 	// Redis Configuration
 	Redis RedisConfig
 
+	// Persistent storage backend
+	Storage StorageConfig
+
 	// Service Discovery
 	ServiceDiscovery ServiceDiscoveryConfig
 
@@ -44,6 +147,9 @@ type Config struct {
 	// Monitoring
 	Monitoring MonitoringConfig
 
+	// Feature flags and experiment assignment
+	FeatureFlags FeatureFlagsConfig
+
 	// Local Model with Python
 	LocalModel LocalModelConfig
 }
@@ -56,6 +162,280 @@ type SecurityConfig struct {
 	RequireHTTPS    bool          // Force HTTPS in production
 	APIKeyPrefix    string        // Prefix for API keys
 	MaxAPIKeys      int           // Maximum number of API keys per user
+
+	JWTRotationInterval  time.Duration // how often a new JWT signing secret is generated, 0 disables rotation; needs Redis
+	JWTRotationKeepCount int           // previous secrets still accepted for validation
+
+	KeyEventSecret string // HMAC secret signing API key lifecycle events, defaults to JWTSecret
+	KeyEventMaxLen int64  // approximate number of key lifecycle events kept in the Redis stream
+
+	UsageSyncInterval time.Duration // how often API key LastUsed and token usage are written to storage
+
+	RefreshTokenExpiration time.Duration // lifetime of refresh tokens issued at login
+
+	// Client certificate presented to upstream providers (mutual TLS); disabled when unset
+	MTLSCertFile string
+	MTLSKeyFile  string
+	MTLSCAFile   string // CA bundle verifying upstream certificates, the system roots when empty
+}
+
+// AuditExportConfig configures shipping audit events as gzipped
+// newline-delimited JSON objects to an S3 or Alibaba Cloud OSS bucket.
+// Export is off when Backend is empty.
+type AuditExportConfig struct {
+	Backend         string // "s3" or "oss"
+	Bucket          string
+	Prefix          string // object key prefix, e.g. "audit/prod"
+	Endpoint        string // defaults to the public endpoint of Region
+	Region          string
+	AccessKeyID     string
+	AccessKeySecret string
+	FlushInterval   time.Duration // a batch is uploaded at least this often...
+	MaxEvents       int           // ...or as soon as it holds this many events
+}
+
+// OIDCConfig configures the authorization code flow (with PKCE) against an external OIDC provider
+type OIDCConfig struct {
+	Enabled            bool
+	IssuerURL          string
+	ClientID           string
+	ClientSecret       string
+	RedirectURL        string        // must point at /api/v1/auth/oidc/callback
+	Scopes             []string      // openid is always requested
+	StateTTL           time.Duration // lifetime of the stored PKCE verifier
+	DefaultPermissions []string      // permissions granted to users provisioned on first login
+}
+
+// RequestQueueConfig controls the priority admission queue in front of the proxy
+type RequestQueueConfig struct {
+	Enabled       bool
+	MaxConcurrent int // requests served at once
+	MaxQueued     int // requests waiting before new ones are rejected with 503
+	// TenantPriorities are the tiers of request owners, e.g. user IDs; a key's own priority takes precedence
+	TenantPriorities map[string]string
+}
+
+// ShutdownConfig controls how long in-flight requests may finish after SIGTERM
+type ShutdownConfig struct {
+	StreamingGrace time.Duration // streaming (SSE) responses
+	DefaultGrace   time.Duration // everything else
+}
+
+// QUICConfig controls the experimental HTTP/3 listener. It shares the server
+// port over UDP; the TCP listener then serves TLS with the same certificate.
+type QUICConfig struct {
+	Enabled      bool
+	CertFile     string
+	KeyFile      string
+	AltSvcMaxAge time.Duration // how long clients may remember the h3 advertisement
+}
+
+// CapacityConfig controls reserved capacity pools; pool sizes are managed via the admin API
+type CapacityConfig struct {
+	Enabled         bool
+	LeaseTTL        time.Duration // upper bound on how long a crashed replica's slots stay held
+	RefreshInterval time.Duration // how often the plan is reloaded and pool metrics refreshed
+}
+
+// KillSwitchConfig controls emergency kill switches; switches are armed via the admin API
+type KillSwitchConfig struct {
+	ConfirmWindow    time.Duration // how long a requested switch waits for its confirmation
+	MaxDuration      time.Duration // a switch expires after at most this long unless renewed
+	TwoPersonRule    bool          // the confirming admin must differ from the requesting one
+	ProviderFallback bool          // route around a killed provider instead of failing its requests
+	RefreshInterval  time.Duration // safety reload in case an invalidation message is lost
+	WebhookURL       string        // receives every switch change, empty disables
+}
+
+// PromptsConfig selects the prompt templates the gateway applies, as name@version
+// or name@latest references into the prompt store; empty uses none or the built-in prompt
+type PromptsConfig struct {
+	SystemTemplate  string // system prompt prepended to every chat completion
+	SummaryTemplate string // prompt of the history summarization model
+	AuditRequests   bool   // write an audit record with the applied template versions for every AI request
+}
+
+var promptRefPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}(@(latest|[1-9][0-9]*))?$`)
+
+// EndpointRateConfig 单个接口路径模式的QPS限制
+type EndpointRateConfig struct {
+	QPS int // requests per second per client IP
+}
+
+// ValidationConfig controls middleware.AIRequestValidator, which rejects
+// malformed chat and completion bodies with a 400 before they reach the upstream
+type ValidationConfig struct {
+	Enabled      bool
+	AllowedRoles []string // roles accepted in chat messages
+	MinMaxTokens int      // smallest max_tokens accepted
+	MaxMaxTokens int      // largest max_tokens accepted, 0 for no upper bound
+	// Per-route overrides keyed by route path, e.g. "/api/v1/chat"
+	Routes map[string]RouteValidationConfig
+}
+
+// IPFilterConfig controls middleware.IPFilter. Entries are CIDRs or exact
+// IPs; when the allowlist is non-empty only its addresses are admitted and
+// the blocklist is not consulted. X-Forwarded-For and X-Real-IP are honoured
+// only from TrustedProxies; by default no proxy is trusted.
+type IPFilterConfig struct {
+	Allowlist      []string
+	Blocklist      []string
+	TrustedProxies []string
+}
+
+// ContentFilterConfig controls middleware.ResponseFilter. PatternsFile holds
+// a JSON array of {"name", "pattern", "replacement"} objects applied after
+// the built-in patterns; setting it enables the filter by default.
+type ContentFilterConfig struct {
+	Enabled      bool
+	PatternsFile string
+}
+
+// RouteValidationConfig 单个路由的请求体校验设置
+type RouteValidationConfig struct {
+	Disabled     bool
+	MaxMaxTokens int // 0 keeps ValidationConfig.MaxMaxTokens
+}
+
+// KeyRateLimitConfig controls per-API-key rate limiting. Keys with a RateLimit
+// of their own get that many requests per Window; other keys get Requests.
+type KeyRateLimitConfig struct {
+	Enabled  bool
+	Requests int           // default per-key limit, 0 leaves keys without their own limit unlimited
+	Window   time.Duration // sliding window the limits apply to
+}
+
+// ResponseCacheConfig limits the response cache; least recently used
+// responses are evicted first once either limit is reached. With the redis
+// backend the cache is shared by all replicas and the limits do not apply.
+type ResponseCacheConfig struct {
+	MaxEntries   int
+	MaxSizeMB    int
+	Backend      string        // memory or redis
+	RedisTimeout time.Duration // a slower Redis lookup or write counts as a miss
+}
+
+// ChaosConfig controls fault injection rules managed through the admin API.
+// It refuses to run with GIN_MODE=release unless AllowProduction is set.
+type ChaosConfig struct {
+	Enabled         bool
+	AllowProduction bool
+	DefaultTTL      time.Duration // rules without a TTL expire after this long
+	MaxTTL          time.Duration // longest TTL a rule may ask for
+}
+
+// GeoRoutingConfig controls routing each client to the upstream endpoint with the lowest RTT from its region
+type GeoRoutingConfig struct {
+	Enabled       bool
+	GeoIPDatabase string        // MaxMind GeoLite2 Country or City database
+	LocalRegion   string        // region this replica probes from; probing is off when empty
+	Endpoints     []string      // provider=base URL pairs
+	ProbeInterval time.Duration // how often the local region's RTT estimates are refreshed
+}
+
+// ModelRoutingConfig controls where requests for models no service source lists are sent
+type ModelRoutingConfig struct {
+	// DefaultSource is the ID of the service source serving unmatched models;
+	// "target" keeps them on TargetURL, empty rejects them with 400
+	DefaultSource string
+}
+
+// FallbackConfig lists the providers a chat request is retried against, in
+// order, when the primary upstream answers 5xx or times out
+type FallbackConfig struct {
+	Providers []FallbackProviderConfig // from FALLBACK_PROVIDERS, e.g. "openai,anthropic"
+}
+
+// FallbackProviderConfig is one secondary provider, read from
+// FALLBACK_<NAME>_URL, FALLBACK_<NAME>_KEY and FALLBACK_<NAME>_MODEL
+type FallbackProviderConfig struct {
+	Name   string
+	URL    string // OpenAI-compatible base URL, e.g. https://api.openai.com/v1
+	APIKey string
+	Model  string // model requested from the provider; empty keeps the client's
+}
+
+// EgressConfig controls which destinations outbound HTTP and gRPC calls may reach.
+// Loopback, private, link-local and cloud metadata addresses are denied unless
+// allowed here, e.g. EGRESS_ALLOW_HOSTS=localhost for a local Consul agent.
+type EgressConfig struct {
+	Enabled        bool
+	AllowedSchemes []string
+	AllowHosts     []string // trusted hostnames, "*.example.com" for subdomains; exempt from the private range defaults
+	DenyHosts      []string // always denied
+	AllowCIDRs     []string // allowed even inside the default denied ranges
+	DenyCIDRs      []string // always denied, over any allow
+}
+
+// HeaderPolicyConfig extends the proxy's built-in header lists. Names are
+// case-insensitive and a trailing "*" matches a prefix, e.g. "X-Internal-*".
+type HeaderPolicyConfig struct {
+	ForwardUserAgent bool     // forward the client's User-Agent upstream
+	ForwardHeaders   []string // request headers forwarded in addition to the defaults
+	StripHeaders     []string // request headers always removed, in addition to the mandatory list
+	ResponseHeaders  []string // upstream response headers returned in addition to the defaults
+}
+
+// ModelLifecycleConfig controls requests for models marked deprecated or retired
+type ModelLifecycleConfig struct {
+	RetiredPolicy string // "migrate" rewrites retired models to their replacement, "reject" answers 400
+}
+
+// SandboxConfig controls the simulator answering requests made with sandbox keys
+type SandboxConfig struct {
+	Enabled          bool
+	Keys             []string      // static sandbox keys besides managed keys flagged sandbox
+	LatencyMin       time.Duration // simulated time to first byte is drawn between min and max
+	LatencyMax       time.Duration
+	CompletionTokens int           // simulated completion length, capped by max_tokens
+	ChunkInterval    time.Duration // delay between simulated stream chunks
+	TimeoutAfter     time.Duration // how long the timeout scenario hangs before failing
+	RateLimit        int           // requests per minute per sandbox key
+}
+
+// EnsembleConfig controls POST /api/v1/ensemble
+type EnsembleConfig struct {
+	Timeout   time.Duration // responses arriving later are reported as timed out
+	MaxModels int
+}
+
+// SentinelConfig controls scheduled sentinel prompt runs
+type SentinelConfig struct {
+	CheckInterval    time.Duration // how often due sentinels are looked for
+	DefaultInterval  time.Duration // cadence of sentinels that set none
+	DailyTokenBudget int64         // tokens all sentinel runs may spend per UTC day
+	HistoryLimit     int           // runs kept per sentinel
+}
+
+// UpstreamBudgetConfig controls X-Request-Timeout-Ms propagation. Budget-aware
+// upstreams are told how long the gateway will wait so they can cap generation.
+type UpstreamBudgetConfig struct {
+	AwareUpstreams []string                 // hosts ("host" or "host:port") that honour the budget header
+	ModelTimeouts  map[string]time.Duration // per-model request timeouts, measured from arrival at the gateway
+	MinBudget      time.Duration            // below this the request fails locally instead of being sent
+}
+
+// SessionConfig controls server-side conversation sessions and their branches
+type SessionConfig struct {
+	MaxBranchDepth int           // how many branches deep a tree may grow below its root
+	MaxBranches    int           // branches per conversation tree, the root not counted
+	MaxMessages    int           // messages kept per session
+	TTL            time.Duration // trees idle this long are dropped
+}
+
+// ContextTruncationConfig controls prompt truncation when a request exceeds the model context window
+type ContextTruncationConfig struct {
+	Enabled         bool
+	DefaultStrategy string // head, tail, middle
+	KeepFirstTurns  int    // Turns kept at the start by the middle strategy
+	KeepLastTurns   int    // Turns kept at the end by the middle strategy
+
+	// History summarization, enabled per key/tenant by the history_summarization flag
+	SummaryModel            string        // cheap model used to summarize old turns
+	SummaryMaxChars         int           // cap on the summary stub length
+	SummaryMinInterval      time.Duration // minimum time between summarizations of one conversation
+	SummaryRetention        time.Duration // summaries of conversations idle this long are dropped
+	SummaryMaxConversations int           // conversations whose summaries are kept, least recently used dropped first
 }
 
 type ServiceDiscoveryConfig struct {
@@ -64,6 +444,9 @@ type ServiceDiscoveryConfig struct {
 	Endpoints   []string
 	Namespace   string
 	RefreshRate time.Duration
+	LeaseTTL    time.Duration // lifetime of a registration (etcd lease, Consul TTL check) that is not kept alive
+	Kubeconfig  string        // kubeconfig path for kubernetes discovery; empty uses the in-cluster config
+	ACLToken    string        // Consul ACL token sent as X-Consul-Token
 }
 
 type RedisConfig struct {
@@ -74,6 +457,14 @@ type RedisConfig struct {
 	PoolSize int
 }
 
+// StorageConfig selects where stateful data (keys, routes, users) is persisted
+type StorageConfig struct {
+	Backend          string // redis, embedded
+	Path             string // Database file for the embedded backend
+	SnapshotInterval time.Duration
+	IdempotencyTTL   time.Duration // how long Idempotency-Key responses are replayed, 0 disables
+}
+
 type AutoScalingConfig struct {
 	Enabled           bool
 	MinReplicas       int
@@ -82,12 +473,152 @@ type AutoScalingConfig struct {
 	TargetQPS         int
 	ScaleUpCooldown   time.Duration
 	ScaleDownCooldown time.Duration
+	UpstreamHealth    UpstreamHealthConfig
+}
+
+// UpstreamHealthConfig controls how upstream health feeds into scaling decisions
+type UpstreamHealthConfig struct {
+	Enabled             bool
+	PublishInterval     time.Duration
+	ErrorWeight         float64
+	ThrottleWeight      float64
+	LatencyWeight       float64
+	CircuitWeight       float64
+	ActiveCheckWeight   float64
+	ActiveCheckInterval time.Duration // How often the configured upstreams are probed
+	ActiveCheckTimeout  time.Duration
+	LatencyTarget       time.Duration
+	SaturationThreshold float64       // Throttle rate (0-1) above which an upstream is considered saturated
+	OutageScore         float64       // Score below which an upstream is considered down
+	OutageDuration      time.Duration // How long all upstreams must be down before scaling to minimum
+	ScaleDownOnOutage   bool
 }
 
 type MonitoringConfig struct {
 	Enabled          bool
 	AlertsEnabled    bool
 	MetricsRetention time.Duration
+	SLOEvalInterval  time.Duration // how often SLO burn rates are evaluated for alerts
+	StatsD           StatsDConfig
+
+	// Periodic push to a Prometheus Pushgateway where scraping is not possible
+	PushGateway PushGatewayConfig
+
+	// Resumable live event stream for dashboards
+	Stream MonitoringStreamConfig
+
+	// Verbose request capture armed by error spikes
+	DebugCapture DebugCaptureConfig
+
+	// Outlier latency capture with goroutine dumps
+	SlowRequests SlowRequestConfig
+
+	// Aggregated request-shape distributions for capacity planning
+	RequestShapes RequestShapeConfig
+
+	// OpenTelemetry distributed tracing
+	Tracing TracingConfig
+
+	// Delivery of alerts and resolutions to webhook and DingTalk channels
+	Notifications AlertNotificationConfig
+
+	// Webhooks receiving every alert regardless of level, signed with WebhookSecret when set
+	WebhookURLs   []string
+	WebhookSecret string
+}
+
+// AlertNotificationConfig controls alert notifications. Every new alert and
+// every resolution is sent to each channel whose URL is set and whose
+// MinLevel the alert reaches; the channels can be replaced at runtime.
+type AlertNotificationConfig struct {
+	Webhook       NotificationChannelConfig
+	DingTalk      NotificationChannelConfig
+	MaxRetries    int           // attempts after a failed delivery
+	RetryBackoff  time.Duration // delay before the first retry, doubled for each further one
+	RatePerMinute int           // notifications per channel and minute, the rest are dropped; 0 is unlimited
+}
+
+// NotificationChannelConfig configures one notification channel; disabled when URL is empty
+type NotificationChannelConfig struct {
+	URL      string
+	Secret   string // HMAC-SHA256 signing secret, deliveries are unsigned when empty
+	MinLevel string // info, warning or critical
+}
+
+// TracingConfig controls OpenTelemetry tracing. W3C trace context is always
+// propagated; spans are only exported when OTLPEndpoint is set.
+type TracingConfig struct {
+	OTLPEndpoint string  // OTLP gRPC collector, host:port or http(s):// URL
+	Insecure     bool    // plaintext connection to the collector; implied by an http:// endpoint
+	ServiceName  string  // service.name resource attribute
+	SampleRatio  float64 // fraction of new traces sampled; sampled parents are always followed
+}
+
+// RequestShapeConfig controls request-shape analytics: sampled AI requests
+// are counted into hourly Redis buckets by prompt size, parameters and model
+type RequestShapeConfig struct {
+	Enabled    bool
+	SampleRate float64       // fraction of requests recorded; counts are scaled by its inverse
+	Retention  time.Duration // hourly buckets older than this are pruned
+	MaxModels  int           // distinct model names tracked, the rest are counted as "other"
+}
+
+// SlowRequestConfig controls the slow-request detector: requests slower than
+// their route's rolling P99 times Multiplier are stored in Redis with a goroutine dump
+type SlowRequestConfig struct {
+	Enabled         bool
+	Multiplier      float64       // a request is slow above P99 * Multiplier
+	SampleSize      int           // recent durations per route the P99 is computed over
+	MinSamples      int           // durations a route needs before requests are judged
+	MaxBodyBytes    int           // captured request bodies are truncated to this size
+	AlertThreshold  time.Duration // slow requests above this also notify Slack, 0 disables
+	SlackWebhookURL string
+}
+
+// DebugCaptureConfig controls adaptive debug capture: when the share of one
+// error category on a (route, model) pair spikes, full redacted exchanges of
+// that combination are kept in a bounded in-memory buffer for a while
+type DebugCaptureConfig struct {
+	Enabled        bool
+	ErrorThreshold float64       // error category share of requests in a window that arms capture
+	MinRequests    int           // requests a window needs before its error share counts
+	Window         time.Duration // error rate window
+	Duration       time.Duration // how long an activation stays armed
+	CoolDown       time.Duration // minimum time between automatic activations of one combination
+	MaxCaptures    int           // an activation disarms after this many captured exchanges
+	MemoryBudget   int           // bytes of captured exchanges kept in total, oldest evicted first
+	MaxBodyBytes   int           // request and response bodies are truncated to this size
+}
+
+// MonitoringStreamConfig controls the Redis ring buffer behind the resumable monitoring stream
+type MonitoringStreamConfig struct {
+	BufferSize  int           // events kept for resuming clients
+	Retention   time.Duration // events older than this are not replayed
+	ResumeBatch time.Duration // resume requests arriving within this window share one Redis read
+}
+
+// FeatureFlagsConfig controls per-request feature flag evaluation
+type FeatureFlagsConfig struct {
+	Enabled          bool
+	DebugKeys        []string // key IDs that receive the X-Feature-Flags debug header
+	AuditAssignments bool     // emit an audit event with each request's assignment
+}
+
+// StatsDConfig controls metric export to a StatsD/DogStatsD agent; disabled when Addr is empty
+type StatsDConfig struct {
+	Addr          string // UDP address of the agent, e.g. 127.0.0.1:8125
+	Format        string // dogstatsd or statsd
+	Env           string // value of the env: tag
+	FlushInterval time.Duration
+}
+
+// PushGatewayConfig controls pushing metrics to a Prometheus Pushgateway;
+// disabled when URL is empty
+type PushGatewayConfig struct {
+	URL      string
+	Interval time.Duration
+	Job      string // job label of the pushed group
+	Instance string // instance label of the pushed group, the hostname when empty
 }
 
 type ProtocolConversionConfig struct {
@@ -95,6 +626,21 @@ type ProtocolConversionConfig struct {
 	HTTPSToRPC  bool
 	GRPCSupport bool
 	Protocols   []string
+
+	// Cached gRPC connections unused this long are closed
+	GRPCIdleTimeout time.Duration
+	// TLS settings of gRPC upstreams by host:port; an endpoint listed here
+	// uses TLS even with the grpc:// scheme
+	GRPCTLS map[string]GRPCEndpointTLSConfig
+}
+
+// GRPCEndpointTLSConfig 单个 gRPC 上游的 TLS 配置：校验服务端证书的 CA，
+// 以及需要双向 TLS 时出示的客户端证书
+type GRPCEndpointTLSConfig struct {
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string // overrides the host name the certificate is verified against
 }
 
 type RAMAuthConfig struct {
@@ -105,21 +651,26 @@ type RAMAuthConfig struct {
 	RoleArn         string
 	PolicyDocument  string
 	CacheExpiration time.Duration
+	NonceCacheSize  int    // nonces remembered in memory when Redis is unavailable
+	Endpoint        string // RAM API endpoint users and policies are looked up at
+	Mock            bool   // derive users from access key names instead of RAM, for local development only
 }
 
 type CloudIntegrationConfig struct {
 	Enabled       bool
-	Provider      string // aliyun, aws, azure, gcp (alias for CloudProvider)
-	CloudProvider string // aliyun, aws, azure, gcp
+	Provider      string // aliyun, aws, azure, gcp, anthropic (alias for CloudProvider)
+	CloudProvider string // aliyun, aws, azure, gcp, anthropic
 	Region        string
 	Credentials   CloudCredentials
 	Services      []string
+	Preload       bool // initialize the provider at startup instead of on first use
 }
 
 type CloudCredentials struct {
 	AccessKeyID     string
 	AccessKeySecret string
 	SessionToken    string
+	APIKey          string // for API-key providers such as Anthropic
 }
 
 // LocalModelConfig represents the configuration for local models using Python
@@ -143,6 +694,27 @@ type LocalModelConfig struct {
 	LogResponses  bool
 	EnabledModels []string // List of enabled local models
 
+	// Hardware guard: refuse instead of downgrading a size that does not fit,
+	// and alert when the server's memory share exceeds the threshold
+	StrictHardware       bool
+	MemoryAlertThreshold float64
+	MonitorInterval      time.Duration
+
+	// Checkpointed generation: the Python server saves its progress every
+	// CheckpointTokens tokens so an interrupted generation can be resumed
+	CheckpointTokens  int
+	CheckpointTimeout time.Duration
+	CheckpointTTL     time.Duration
+
+	// Supervision: a stopped server gets StopGracePeriod after SIGTERM before
+	// it is killed; a server that exits on its own is restarted up to
+	// RestartMaxAttempts times in a row, waiting RestartBackoff doubled per
+	// attempt up to RestartMaxBackoff
+	StopGracePeriod    time.Duration
+	RestartMaxAttempts int
+	RestartBackoff     time.Duration
+	RestartMaxBackoff  time.Duration
+
 	// Third-party model support (阿里百炼/Alibaba DashScope)
 	ThirdParty ThirdPartyModelConfig
 }
@@ -163,6 +735,8 @@ func New() *Config {
 		GinMode:   getEnv("GIN_MODE", "release"),
 		TargetURL: getEnv("TARGET_URL", getEnv("TARGET_API_URL", "")),
 		TargetKey: getEnv("TARGET_KEY", getEnv("TARGET_API_KEY", "")),
+
+		SmokeTestModel: getEnv("SMOKE_TEST_MODEL", "gpt-3.5-turbo"),
 		GatewayKeys: func() []string {
 			keys := getEnv("GATEWAY_API_KEYS", "")
 			if keys == "" {
@@ -175,6 +749,178 @@ func New() *Config {
 		RateLimit:      getEnvInt("RATE_LIMIT_REQUESTS_PER_MINUTE", 60),
 		HealthCheck:    getEnvBool("HEALTH_CHECK_ENABLED", true),
 		AllowedOrigins: strings.Split(getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:5173"), ","),
+		MaxImageSizeMB: getEnvInt("MAX_IMAGE_SIZE_MB", 20),
+
+		EnvFile:    getEnv("ENV_FILE", ".env"),
+		ConfigFile: getEnv("CONFIG_FILE", ""),
+		HotReload:  getEnvBool("CONFIG_HOT_RELOAD", true),
+
+		MaxSchemaRetries: getEnvInt("MAX_SCHEMA_RETRIES", 2),
+
+		// Defaults to 10% of RATE_LIMIT
+		RetryBudgetPerSecond: getEnvFloat("RETRY_BUDGET_PER_SECOND", float64(getEnvInt("RATE_LIMIT_REQUESTS_PER_MINUTE", 60))*0.1),
+
+		EndpointRateLimits: parseEndpointRateLimits(getEnv("ENDPOINT_RATE_LIMITS", "")),
+		Validation: ValidationConfig{
+			Enabled:      getEnvBool("REQUEST_VALIDATION_ENABLED", true),
+			AllowedRoles: strings.Split(getEnv("REQUEST_VALIDATION_ROLES", "system,user,assistant"), ","),
+			MinMaxTokens: getEnvInt("REQUEST_VALIDATION_MIN_MAX_TOKENS", 1),
+			MaxMaxTokens: getEnvInt("REQUEST_VALIDATION_MAX_MAX_TOKENS", 0),
+			Routes:       parseRouteValidation(getEnv("REQUEST_VALIDATION_ROUTES", "")),
+		},
+		IPFilter: IPFilterConfig{
+			Allowlist:      getEnvStringSlice("IP_ALLOWLIST", nil),
+			Blocklist:      getEnvStringSlice("IP_BLOCKLIST", nil),
+			TrustedProxies: getEnvStringSlice("TRUSTED_PROXIES", nil),
+		},
+		ContentFilter: ContentFilterConfig{
+			Enabled:      getEnvBool("CONTENT_FILTER_ENABLED", getEnv("CONTENT_FILTER_PATTERNS", "") != ""),
+			PatternsFile: getEnv("CONTENT_FILTER_PATTERNS", ""),
+		},
+		KeyRateLimit: KeyRateLimitConfig{
+			Enabled:  getEnvBool("KEY_RATE_LIMIT_ENABLED", true),
+			Requests: getEnvInt("KEY_RATE_LIMIT_REQUESTS", 0),
+			Window:   getEnvDuration("KEY_RATE_LIMIT_WINDOW", time.Minute),
+		},
+		RedisRateLimitLegacy: getEnvBool("REDIS_RATE_LIMIT_LEGACY", false),
+		ResponseCache: ResponseCacheConfig{
+			MaxEntries:   getEnvInt("RESPONSE_CACHE_MAX_ENTRIES", 1000),
+			MaxSizeMB:    getEnvInt("RESPONSE_CACHE_MAX_SIZE_MB", 64),
+			Backend:      getEnv("RESPONSE_CACHE_BACKEND", "memory"),
+			RedisTimeout: getEnvDuration("RESPONSE_CACHE_REDIS_TIMEOUT", 50*time.Millisecond),
+		},
+
+		Sessions: SessionConfig{
+			MaxBranchDepth: getEnvInt("MAX_BRANCH_DEPTH", 5),
+			MaxBranches:    getEnvInt("MAX_BRANCHES", 10),
+			MaxMessages:    getEnvInt("SESSION_MAX_MESSAGES", 500),
+			TTL:            getEnvDuration("SESSION_TTL", 24*time.Hour),
+		},
+
+		Ensemble: EnsembleConfig{
+			Timeout:   time.Duration(getEnvInt("ENSEMBLE_TIMEOUT", 30)) * time.Second,
+			MaxModels: getEnvInt("ENSEMBLE_MAX_MODELS", 5),
+		},
+
+		Sentinels: SentinelConfig{
+			CheckInterval:    getEnvDuration("SENTINEL_CHECK_INTERVAL", time.Minute),
+			DefaultInterval:  getEnvDuration("SENTINEL_DEFAULT_INTERVAL", time.Hour),
+			DailyTokenBudget: int64(getEnvInt("SENTINEL_DAILY_TOKEN_BUDGET", 100000)),
+			HistoryLimit:     getEnvInt("SENTINEL_HISTORY_LIMIT", 500),
+		},
+
+		UpstreamBudget: UpstreamBudgetConfig{
+			AwareUpstreams: getEnvStringSlice("BUDGET_AWARE_UPSTREAMS", nil),
+			ModelTimeouts:  parseModelTimeouts(getEnv("MODEL_TIMEOUTS", "")),
+			MinBudget:      getEnvDuration("UPSTREAM_MIN_BUDGET", 100*time.Millisecond),
+		},
+
+		ContextTruncation: ContextTruncationConfig{
+			Enabled:         getEnvBool("CONTEXT_TRUNCATION_ENABLED", false),
+			DefaultStrategy: getEnv("CONTEXT_TRUNCATION_STRATEGY", "head"),
+			KeepFirstTurns:  getEnvInt("CONTEXT_TRUNCATION_KEEP_FIRST", 2),
+			KeepLastTurns:   getEnvInt("CONTEXT_TRUNCATION_KEEP_LAST", 4),
+
+			SummaryModel:            getEnv("CONTEXT_SUMMARY_MODEL", "qwen-turbo"),
+			SummaryMaxChars:         getEnvInt("CONTEXT_SUMMARY_MAX_CHARS", 2000),
+			SummaryMinInterval:      getEnvDuration("CONTEXT_SUMMARY_MIN_INTERVAL", time.Minute),
+			SummaryRetention:        getEnvDuration("CONTEXT_SUMMARY_RETENTION", 24*time.Hour),
+			SummaryMaxConversations: getEnvInt("CONTEXT_SUMMARY_MAX_CONVERSATIONS", 10000),
+		},
+
+		RequestQueue: RequestQueueConfig{
+			Enabled:          getEnvBool("REQUEST_QUEUE_ENABLED", false),
+			MaxConcurrent:    getEnvInt("REQUEST_QUEUE_MAX_CONCURRENT", 100),
+			MaxQueued:        getEnvInt("REQUEST_QUEUE_MAX_SIZE", 500),
+			TenantPriorities: parseTenantPriorities(getEnv("REQUEST_QUEUE_TENANT_PRIORITIES", "")),
+		},
+
+		Capacity: CapacityConfig{
+			Enabled:         getEnvBool("CAPACITY_POOLS_ENABLED", false),
+			LeaseTTL:        getEnvDuration("CAPACITY_LEASE_TTL", 10*time.Minute),
+			RefreshInterval: getEnvDuration("CAPACITY_REFRESH_INTERVAL", 15*time.Second),
+		},
+
+		KillSwitch: KillSwitchConfig{
+			ConfirmWindow:    getEnvDuration("KILL_SWITCH_CONFIRM_WINDOW", 2*time.Minute),
+			MaxDuration:      getEnvDuration("KILL_SWITCH_MAX_DURATION", 24*time.Hour),
+			TwoPersonRule:    getEnvBool("KILL_SWITCH_TWO_PERSON_RULE", true),
+			ProviderFallback: getEnvBool("KILL_SWITCH_PROVIDER_FALLBACK", true),
+			RefreshInterval:  getEnvDuration("KILL_SWITCH_REFRESH_INTERVAL", 30*time.Second),
+			WebhookURL:       getEnv("KILL_SWITCH_WEBHOOK_URL", ""),
+		},
+
+		Prompts: PromptsConfig{
+			SystemTemplate:  getEnv("PROMPT_SYSTEM_TEMPLATE", ""),
+			SummaryTemplate: getEnv("PROMPT_SUMMARY_TEMPLATE", ""),
+			AuditRequests:   getEnvBool("PROMPT_AUDIT_REQUESTS", true),
+		},
+
+		Sandbox: SandboxConfig{
+			Enabled:          getEnvBool("SANDBOX_ENABLED", true),
+			Keys:             getEnvStringSlice("SANDBOX_API_KEYS", nil),
+			LatencyMin:       getEnvDuration("SANDBOX_LATENCY_MIN", 50*time.Millisecond),
+			LatencyMax:       getEnvDuration("SANDBOX_LATENCY_MAX", 400*time.Millisecond),
+			CompletionTokens: getEnvInt("SANDBOX_COMPLETION_TOKENS", 32),
+			ChunkInterval:    getEnvDuration("SANDBOX_CHUNK_INTERVAL", 30*time.Millisecond),
+			TimeoutAfter:     getEnvDuration("SANDBOX_TIMEOUT_AFTER", 10*time.Second),
+			RateLimit:        getEnvInt("SANDBOX_RATE_LIMIT", 60),
+		},
+
+		GeoRouting: GeoRoutingConfig{
+			Enabled:       getEnvBool("GEO_ROUTING_ENABLED", false),
+			GeoIPDatabase: getEnv("GEOIP_DATABASE_PATH", "./data/GeoLite2-Country.mmdb"),
+			LocalRegion:   getEnv("GEO_ROUTING_REGION", ""),
+			Endpoints:     getEnvStringSlice("GEO_ROUTING_ENDPOINTS", nil),
+			ProbeInterval: getEnvDuration("GEO_ROUTING_PROBE_INTERVAL", time.Minute),
+		},
+
+		ModelRouting: ModelRoutingConfig{
+			DefaultSource: getEnv("MODEL_ROUTING_DEFAULT_SOURCE", "target"),
+		},
+
+		Fallback: FallbackConfig{
+			Providers: parseFallbackProviders(getEnvStringSlice("FALLBACK_PROVIDERS", nil)),
+		},
+
+		Chaos: ChaosConfig{
+			Enabled:         getEnvBool("CHAOS_ENABLED", false),
+			AllowProduction: getEnvBool("CHAOS_ALLOW_PRODUCTION", false),
+			DefaultTTL:      getEnvDuration("CHAOS_DEFAULT_TTL", 15*time.Minute),
+			MaxTTL:          getEnvDuration("CHAOS_MAX_TTL", 2*time.Hour),
+		},
+
+		Egress: EgressConfig{
+			Enabled:        getEnvBool("EGRESS_POLICY_ENABLED", true),
+			AllowedSchemes: getEnvStringSlice("EGRESS_ALLOWED_SCHEMES", []string{"http", "https"}),
+			AllowHosts:     getEnvStringSlice("EGRESS_ALLOW_HOSTS", nil),
+			DenyHosts:      getEnvStringSlice("EGRESS_DENY_HOSTS", nil),
+			AllowCIDRs:     getEnvStringSlice("EGRESS_ALLOW_CIDRS", nil),
+			DenyCIDRs:      getEnvStringSlice("EGRESS_DENY_CIDRS", nil),
+		},
+
+		HeaderPolicy: HeaderPolicyConfig{
+			ForwardUserAgent: getEnvBool("PROXY_FORWARD_USER_AGENT", false),
+			ForwardHeaders:   getEnvStringSlice("PROXY_FORWARD_HEADERS", nil),
+			StripHeaders:     getEnvStringSlice("PROXY_STRIP_HEADERS", nil),
+			ResponseHeaders:  getEnvStringSlice("PROXY_RESPONSE_HEADERS", nil),
+		},
+
+		ModelLifecycle: ModelLifecycleConfig{
+			RetiredPolicy: getEnv("MODEL_RETIRED_POLICY", "reject"),
+		},
+
+		Shutdown: ShutdownConfig{
+			StreamingGrace: getEnvDuration("SHUTDOWN_STREAMING_GRACE", 120*time.Second),
+			DefaultGrace:   getEnvDuration("SHUTDOWN_DEFAULT_GRACE", 15*time.Second),
+		},
+
+		QUIC: QUICConfig{
+			Enabled:      getEnvBool("QUIC_ENABLED", false),
+			CertFile:     getEnv("TLS_CERT_FILE", ""),
+			KeyFile:      getEnv("TLS_KEY_FILE", ""),
+			AltSvcMaxAge: getEnvDuration("QUIC_ALT_SVC_MAX_AGE", 30*24*time.Hour),
+		},
 
 		// Security Configuration
 		Security: SecurityConfig{
@@ -184,6 +930,43 @@ func New() *Config {
 			RequireHTTPS:    getEnvBool("REQUIRE_HTTPS", false),
 			APIKeyPrefix:    getEnv("API_KEY_PREFIX", "gw-"),
 			MaxAPIKeys:      getEnvInt("MAX_API_KEYS_PER_USER", 10),
+
+			JWTRotationInterval:  getEnvDuration("JWT_SECRET_ROTATION_INTERVAL", 24*time.Hour),
+			JWTRotationKeepCount: getEnvInt("JWT_ROTATION_KEEP_COUNT", 2),
+
+			KeyEventSecret: getEnv("KEY_EVENT_SIGNING_SECRET", ""),
+			KeyEventMaxLen: int64(getEnvInt("KEY_EVENT_STREAM_MAXLEN", 100000)),
+
+			UsageSyncInterval: getEnvDuration("AUTH_USAGE_SYNC_INTERVAL", time.Minute),
+
+			RefreshTokenExpiration: getEnvDuration("REFRESH_TOKEN_EXPIRATION", 7*24*time.Hour),
+
+			MTLSCertFile: getEnv("MTLS_CERT_FILE", ""),
+			MTLSKeyFile:  getEnv("MTLS_KEY_FILE", ""),
+			MTLSCAFile:   getEnv("MTLS_CA_FILE", ""),
+		},
+
+		AuditExport: AuditExportConfig{
+			Backend:         getEnv("AUDIT_EXPORT_BACKEND", ""),
+			Bucket:          getEnv("AUDIT_EXPORT_BUCKET", ""),
+			Prefix:          getEnv("AUDIT_EXPORT_PREFIX", "audit"),
+			Endpoint:        getEnv("AUDIT_EXPORT_ENDPOINT", ""),
+			Region:          getEnv("AUDIT_EXPORT_REGION", ""),
+			AccessKeyID:     getEnv("AUDIT_EXPORT_ACCESS_KEY_ID", getEnv("CLOUD_ACCESS_KEY_ID", "")),
+			AccessKeySecret: getEnv("AUDIT_EXPORT_ACCESS_KEY_SECRET", getEnv("CLOUD_ACCESS_KEY_SECRET", "")),
+			FlushInterval:   getEnvDuration("AUDIT_EXPORT_FLUSH_INTERVAL", 5*time.Minute),
+			MaxEvents:       getEnvInt("AUDIT_EXPORT_MAX_EVENTS", 10000),
+		},
+
+		OIDC: OIDCConfig{
+			Enabled:            getEnvBool("OIDC_ENABLED", false),
+			IssuerURL:          getEnv("OIDC_ISSUER_URL", ""),
+			ClientID:           getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret:       getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:        getEnv("OIDC_REDIRECT_URL", ""),
+			Scopes:             getEnvStringSlice("OIDC_SCOPES", []string{"profile", "email"}),
+			StateTTL:           getEnvDuration("OIDC_STATE_TTL", 10*time.Minute),
+			DefaultPermissions: getEnvStringSlice("OIDC_DEFAULT_PERMISSIONS", []string{"ai:chat", "ai:completion", "ai:models"}),
 		},
 
 		Redis: RedisConfig{
@@ -194,12 +977,22 @@ func New() *Config {
 			PoolSize: getEnvInt("REDIS_POOL_SIZE", 10),
 		},
 
+		Storage: StorageConfig{
+			Backend:          getEnv("STORAGE_BACKEND", "redis"),
+			Path:             getEnv("STORAGE_PATH", "./data/aigateway.db"),
+			SnapshotInterval: getEnvDuration("STORAGE_SNAPSHOT_INTERVAL", time.Hour),
+			IdempotencyTTL:   getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		},
+
 		ServiceDiscovery: ServiceDiscoveryConfig{
 			Enabled:     getEnvBool("SERVICE_DISCOVERY_ENABLED", false),
 			Type:        getEnv("SERVICE_DISCOVERY_TYPE", "consul"),
 			Endpoints:   strings.Split(getEnv("SERVICE_DISCOVERY_ENDPOINTS", ""), ","),
 			Namespace:   getEnv("SERVICE_DISCOVERY_NAMESPACE", "default"),
 			RefreshRate: getEnvDuration("SERVICE_DISCOVERY_REFRESH_RATE", 30*time.Second),
+			LeaseTTL:    getEnvDuration("SERVICE_DISCOVERY_LEASE_TTL", 15*time.Second),
+			Kubeconfig:  getEnv("SERVICE_DISCOVERY_KUBECONFIG", ""),
+			ACLToken:    getEnv("SERVICE_DISCOVERY_ACL_TOKEN", ""),
 		},
 
 		ProtocolConversion: ProtocolConversionConfig{
@@ -207,6 +1000,9 @@ func New() *Config {
 			HTTPSToRPC:  getEnvBool("HTTPS_TO_RPC_ENABLED", false),
 			GRPCSupport: getEnvBool("GRPC_SUPPORT_ENABLED", false),
 			Protocols:   strings.Split(getEnv("SUPPORTED_PROTOCOLS", "http,https"), ","),
+
+			GRPCIdleTimeout: getEnvDuration("GRPC_IDLE_TIMEOUT", 10*time.Minute),
+			GRPCTLS:         parseGRPCTLSEndpoints(getEnv("GRPC_TLS_ENDPOINTS", "")),
 		},
 
 		RAMAuth: RAMAuthConfig{
@@ -217,6 +1013,9 @@ func New() *Config {
 			RoleArn:         getEnv("RAM_ROLE_ARN", ""),
 			PolicyDocument:  getEnv("RAM_POLICY_DOCUMENT", ""),
 			CacheExpiration: getEnvDuration("RAM_CACHE_EXPIRATION", 15*time.Minute),
+			NonceCacheSize:  getEnvInt("RAM_NONCE_CACHE_SIZE", 100000),
+			Endpoint:        getEnv("RAM_ENDPOINT", "ram.aliyuncs.com"),
+			Mock:            getEnvBool("RAM_AUTH_MOCK", false),
 		}, CloudIntegration: CloudIntegrationConfig{
 			Enabled:       getEnvBool("CLOUD_INTEGRATION_ENABLED", false),
 			Provider:      getEnv("CLOUD_INTEGRATION_PROVIDER", getEnv("CLOUD_PROVIDER", "aws")),
@@ -226,8 +1025,10 @@ func New() *Config {
 				AccessKeyID:     getEnv("CLOUD_ACCESS_KEY_ID", ""),
 				AccessKeySecret: getEnv("CLOUD_ACCESS_KEY_SECRET", ""),
 				SessionToken:    getEnv("CLOUD_SESSION_TOKEN", ""),
+				APIKey:          getEnv("CLOUD_API_KEY", getEnv("ANTHROPIC_API_KEY", "")),
 			},
 			Services: strings.Split(getEnv("CLOUD_SERVICES", "ecs,rds,oss"), ","),
+			Preload:  getEnvBool("CLOUD_INTEGRATION_PRELOAD", false),
 		},
 
 		AutoScaling: AutoScalingConfig{
@@ -238,11 +1039,101 @@ func New() *Config {
 			TargetQPS:         getEnvInt("AUTO_SCALING_TARGET_QPS", 1000),
 			ScaleUpCooldown:   getEnvDuration("AUTO_SCALING_UP_COOLDOWN", 3*time.Minute),
 			ScaleDownCooldown: getEnvDuration("AUTO_SCALING_DOWN_COOLDOWN", 5*time.Minute),
+			UpstreamHealth: UpstreamHealthConfig{
+				Enabled:             getEnvBool("UPSTREAM_HEALTH_ENABLED", true),
+				PublishInterval:     getEnvDuration("UPSTREAM_HEALTH_PUBLISH_INTERVAL", 15*time.Second),
+				ErrorWeight:         getEnvFloat("UPSTREAM_HEALTH_ERROR_WEIGHT", 0.3),
+				ThrottleWeight:      getEnvFloat("UPSTREAM_HEALTH_THROTTLE_WEIGHT", 0.3),
+				LatencyWeight:       getEnvFloat("UPSTREAM_HEALTH_LATENCY_WEIGHT", 0.1),
+				CircuitWeight:       getEnvFloat("UPSTREAM_HEALTH_CIRCUIT_WEIGHT", 0.2),
+				ActiveCheckWeight:   getEnvFloat("UPSTREAM_HEALTH_ACTIVE_WEIGHT", 0.1),
+				ActiveCheckInterval: getEnvDuration("UPSTREAM_HEALTH_ACTIVE_CHECK_INTERVAL", 30*time.Second),
+				ActiveCheckTimeout:  getEnvDuration("UPSTREAM_HEALTH_ACTIVE_CHECK_TIMEOUT", 5*time.Second),
+				LatencyTarget:       getEnvDuration("UPSTREAM_HEALTH_LATENCY_TARGET", 2*time.Second),
+				SaturationThreshold: getEnvFloat("UPSTREAM_HEALTH_SATURATION_THRESHOLD", 0.2),
+				OutageScore:         getEnvFloat("UPSTREAM_HEALTH_OUTAGE_SCORE", 0.2),
+				OutageDuration:      getEnvDuration("UPSTREAM_HEALTH_OUTAGE_DURATION", 5*time.Minute),
+				ScaleDownOnOutage:   getEnvBool("UPSTREAM_HEALTH_SCALE_DOWN_ON_OUTAGE", false),
+			},
 		},
 		Monitoring: MonitoringConfig{
 			Enabled:          getEnvBool("MONITORING_ENABLED", true),
 			AlertsEnabled:    getEnvBool("MONITORING_ALERTS_ENABLED", true),
-			MetricsRetention: getEnvDuration("MONITORING_METRICS_RETENTION", 24*time.Hour)}, LocalModel: LocalModelConfig{
+			MetricsRetention: getEnvDuration("MONITORING_METRICS_RETENTION", 24*time.Hour),
+			SLOEvalInterval:  getEnvDuration("MONITORING_SLO_EVAL_INTERVAL", time.Minute),
+			StatsD: StatsDConfig{
+				Addr:          getEnv("STATSD_ADDR", ""),
+				Format:        getEnv("STATSD_FORMAT", "dogstatsd"),
+				Env:           getEnv("STATSD_ENV", "production"),
+				FlushInterval: getEnvDuration("STATSD_FLUSH_INTERVAL", 10*time.Second),
+			},
+			PushGateway: PushGatewayConfig{
+				URL:      getEnv("PROMETHEUS_PUSHGATEWAY_URL", ""),
+				Interval: getEnvDuration("PROMETHEUS_PUSH_INTERVAL", 15*time.Second),
+				Job:      getEnv("PROMETHEUS_PUSH_JOB", "aigateway"),
+				Instance: getEnv("PROMETHEUS_PUSH_INSTANCE", ""),
+			},
+			Stream: MonitoringStreamConfig{
+				BufferSize:  getEnvInt("MONITORING_STREAM_BUFFER_SIZE", 1000),
+				Retention:   getEnvDuration("MONITORING_STREAM_RETENTION", 5*time.Minute),
+				ResumeBatch: getEnvDuration("MONITORING_STREAM_RESUME_BATCH", 50*time.Millisecond),
+			},
+			DebugCapture: DebugCaptureConfig{
+				Enabled:        getEnvBool("DEBUG_CAPTURE_ENABLED", false),
+				ErrorThreshold: getEnvFloat("DEBUG_CAPTURE_ERROR_THRESHOLD", 0.5),
+				MinRequests:    getEnvInt("DEBUG_CAPTURE_MIN_REQUESTS", 20),
+				Window:         getEnvDuration("DEBUG_CAPTURE_WINDOW", time.Minute),
+				Duration:       getEnvDuration("DEBUG_CAPTURE_DURATION", 10*time.Minute),
+				CoolDown:       getEnvDuration("DEBUG_CAPTURE_COOLDOWN", 30*time.Minute),
+				MaxCaptures:    getEnvInt("DEBUG_CAPTURE_MAX_CAPTURES", 100),
+				MemoryBudget:   getEnvInt("DEBUG_CAPTURE_MEMORY_BUDGET_BYTES", 8<<20),
+				MaxBodyBytes:   getEnvInt("DEBUG_CAPTURE_MAX_BODY_BYTES", 16<<10),
+			},
+			Tracing: TracingConfig{
+				OTLPEndpoint: getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+				Insecure:     getEnvBool("OTEL_EXPORTER_OTLP_INSECURE", false),
+				ServiceName:  getEnv("OTEL_SERVICE_NAME", "aigateway"),
+				SampleRatio:  getEnvFloat("OTEL_TRACES_SAMPLE_RATIO", 1),
+			},
+			SlowRequests: SlowRequestConfig{
+				Enabled:         getEnvBool("SLOW_REQUEST_ENABLED", true),
+				Multiplier:      getEnvFloat("SLOW_REQUEST_MULTIPLIER", 3),
+				SampleSize:      getEnvInt("SLOW_REQUEST_SAMPLE_SIZE", 1000),
+				MinSamples:      getEnvInt("SLOW_REQUEST_MIN_SAMPLES", 100),
+				MaxBodyBytes:    getEnvInt("SLOW_REQUEST_MAX_BODY_BYTES", 64<<10),
+				AlertThreshold:  time.Duration(getEnvInt("SLOW_REQUEST_ALERT_THRESHOLD_MS", 0)) * time.Millisecond,
+				SlackWebhookURL: getEnv("SLOW_REQUEST_SLACK_WEBHOOK_URL", ""),
+			},
+			RequestShapes: RequestShapeConfig{
+				Enabled:    getEnvBool("REQUEST_SHAPES_ENABLED", true),
+				SampleRate: getEnvFloat("REQUEST_SHAPES_SAMPLE_RATE", 0.1),
+				Retention:  getEnvDuration("REQUEST_SHAPES_RETENTION", 7*24*time.Hour),
+				MaxModels:  getEnvInt("REQUEST_SHAPES_MAX_MODELS", 50),
+			},
+			Notifications: AlertNotificationConfig{
+				Webhook: NotificationChannelConfig{
+					URL:      getEnv("ALERT_WEBHOOK_URL", ""),
+					Secret:   getEnv("ALERT_WEBHOOK_SECRET", ""),
+					MinLevel: getEnv("ALERT_WEBHOOK_MIN_LEVEL", "warning"),
+				},
+				DingTalk: NotificationChannelConfig{
+					URL:      getEnv("ALERT_DINGTALK_URL", ""),
+					Secret:   getEnv("ALERT_DINGTALK_SECRET", ""),
+					MinLevel: getEnv("ALERT_DINGTALK_MIN_LEVEL", "warning"),
+				},
+				MaxRetries:    getEnvInt("ALERT_NOTIFY_MAX_RETRIES", 3),
+				RetryBackoff:  getEnvDuration("ALERT_NOTIFY_RETRY_BACKOFF", time.Second),
+				RatePerMinute: getEnvInt("ALERT_NOTIFY_RATE_PER_MINUTE", 20),
+			},
+			WebhookURLs:   getEnvStringSlice("MONITORING_WEBHOOK_URLS", nil),
+			WebhookSecret: getEnv("MONITORING_WEBHOOK_SECRET", ""),
+		},
+		FeatureFlags: FeatureFlagsConfig{
+			Enabled:          getEnvBool("FEATURE_FLAGS_ENABLED", true),
+			DebugKeys:        getEnvStringSlice("FEATURE_FLAGS_DEBUG_KEYS", []string{}),
+			AuditAssignments: getEnvBool("FEATURE_FLAGS_AUDIT", false),
+		},
+		LocalModel: LocalModelConfig{
 			Enabled:       getEnvBool("LOCAL_MODEL_ENABLED", false),
 			PythonPath:    getEnv("PYTHON_PATH", "python"),
 			ModelPath:     getEnv("MODEL_PATH", "./python/model"),
@@ -261,6 +1152,20 @@ func New() *Config {
 			LogRequests:   getEnvBool("LOCAL_MODEL_LOG_REQUESTS", true),
 			LogResponses:  getEnvBool("LOCAL_MODEL_LOG_RESPONSES", true),
 			EnabledModels: getEnvStringSlice("ENABLED_LOCAL_MODELS", []string{"tiny-llama", "phi-2", "miniLM"}),
+
+			StrictHardware:       getEnvBool("LOCAL_MODEL_STRICT_HARDWARE", false),
+			MemoryAlertThreshold: getEnvFloat("LOCAL_MODEL_MEMORY_ALERT_THRESHOLD", 0.9),
+			MonitorInterval:      getEnvDuration("LOCAL_MODEL_MONITOR_INTERVAL", 30*time.Second),
+
+			CheckpointTokens:  getEnvInt("LOCAL_MODEL_CHECKPOINT_TOKENS", 64),
+			CheckpointTimeout: getEnvDuration("LOCAL_MODEL_CHECKPOINT_TIMEOUT", 10*time.Minute),
+			CheckpointTTL:     getEnvDuration("LOCAL_MODEL_CHECKPOINT_TTL", 24*time.Hour),
+
+			StopGracePeriod:    getEnvDuration("LOCAL_MODEL_STOP_GRACE_PERIOD", 10*time.Second),
+			RestartMaxAttempts: getEnvInt("LOCAL_MODEL_RESTART_MAX_ATTEMPTS", 5),
+			RestartBackoff:     getEnvDuration("LOCAL_MODEL_RESTART_BACKOFF", time.Second),
+			RestartMaxBackoff:  getEnvDuration("LOCAL_MODEL_RESTART_MAX_BACKOFF", time.Minute),
+
 			// Third-party model configuration
 			ThirdParty: ThirdPartyModelConfig{
 				Enabled:      getEnvBool("THIRD_PARTY_MODEL_ENABLED", false),
@@ -282,6 +1187,59 @@ func (c *Config) ValidateConfig() error {
 		errors = append(errors, "JWT_SECRET must be set to a secure value in production")
 	}
 
+	if c.Security.JWTRotationInterval < 0 || c.Security.JWTRotationKeepCount < 0 {
+		errors = append(errors, "JWT_SECRET_ROTATION_INTERVAL and JWT_ROTATION_KEEP_COUNT must not be negative")
+	}
+	if c.Security.UsageSyncInterval <= 0 {
+		errors = append(errors, "AUTH_USAGE_SYNC_INTERVAL must be positive")
+	}
+	if c.Security.RefreshTokenExpiration <= c.Security.TokenExpiration {
+		errors = append(errors, "REFRESH_TOKEN_EXPIRATION must be longer than TOKEN_EXPIRATION")
+	}
+	if (c.Security.MTLSCertFile == "") != (c.Security.MTLSKeyFile == "") {
+		errors = append(errors, "MTLS_CERT_FILE and MTLS_KEY_FILE must be set together")
+	}
+	if c.Security.KeyEventMaxLen <= 0 {
+		errors = append(errors, "KEY_EVENT_STREAM_MAXLEN must be positive")
+	}
+	if c.RAMAuth.Enabled && !c.RAMAuth.Mock && (c.RAMAuth.AccessKeyID == "" || c.RAMAuth.AccessKeySecret == "") {
+		errors = append(errors, "RAM_ACCESS_KEY_ID and RAM_ACCESS_KEY_SECRET are required for RAM user lookups unless RAM_AUTH_MOCK is set")
+	}
+	if ae := c.AuditExport; ae.Backend != "" {
+		if ae.Backend != "s3" && ae.Backend != "oss" {
+			errors = append(errors, "AUDIT_EXPORT_BACKEND must be s3 or oss")
+		}
+		if ae.Bucket == "" || ae.AccessKeyID == "" || ae.AccessKeySecret == "" {
+			errors = append(errors, "AUDIT_EXPORT_BUCKET and audit export credentials are required when AUDIT_EXPORT_BACKEND is set")
+		}
+		if ae.FlushInterval <= 0 || ae.MaxEvents <= 0 {
+			errors = append(errors, "AUDIT_EXPORT_FLUSH_INTERVAL and AUDIT_EXPORT_MAX_EVENTS must be positive")
+		}
+	}
+	if uh := c.AutoScaling.UpstreamHealth; uh.Enabled && (uh.ActiveCheckInterval <= 0 || uh.ActiveCheckTimeout <= 0) {
+		errors = append(errors, "UPSTREAM_HEALTH_ACTIVE_CHECK_INTERVAL and UPSTREAM_HEALTH_ACTIVE_CHECK_TIMEOUT must be positive")
+	}
+	for _, entry := range c.IPFilter.Allowlist {
+		if !validIPEntry(entry) {
+			errors = append(errors, fmt.Sprintf("IP_ALLOWLIST entry %q is neither an IP nor a CIDR", entry))
+		}
+	}
+	for _, entry := range c.IPFilter.Blocklist {
+		if !validIPEntry(entry) {
+			errors = append(errors, fmt.Sprintf("IP_BLOCKLIST entry %q is neither an IP nor a CIDR", entry))
+		}
+	}
+	for _, entry := range c.IPFilter.TrustedProxies {
+		if !validIPEntry(entry) {
+			errors = append(errors, fmt.Sprintf("TRUSTED_PROXIES entry %q is neither an IP nor a CIDR", entry))
+		}
+	}
+	if cf := c.ContentFilter; cf.Enabled && cf.PatternsFile != "" {
+		if _, err := os.Stat(cf.PatternsFile); err != nil {
+			errors = append(errors, fmt.Sprintf("CONTENT_FILTER_PATTERNS file cannot be read: %v", err))
+		}
+	}
+
 	// Validate port
 	if c.Port == "" {
 		errors = append(errors, "PORT must be specified")
@@ -291,6 +1249,240 @@ func (c *Config) ValidateConfig() error {
 	if c.RateLimit <= 0 {
 		errors = append(errors, "RATE_LIMIT must be positive")
 	}
+	if c.LocalModel.Enabled && (c.LocalModel.MemoryAlertThreshold <= 0 || c.LocalModel.MemoryAlertThreshold > 1) {
+		errors = append(errors, "LOCAL_MODEL_MEMORY_ALERT_THRESHOLD must be in (0, 1]")
+	}
+	if c.LocalModel.Enabled && (c.LocalModel.CheckpointTokens <= 0 || c.LocalModel.CheckpointTimeout <= 0 || c.LocalModel.CheckpointTTL <= 0) {
+		errors = append(errors, "LOCAL_MODEL_CHECKPOINT_TOKENS, LOCAL_MODEL_CHECKPOINT_TIMEOUT and LOCAL_MODEL_CHECKPOINT_TTL must be positive")
+	}
+	if c.Monitoring.Enabled && (c.Monitoring.Stream.BufferSize <= 0 || c.Monitoring.Stream.Retention <= 0) {
+		errors = append(errors, "MONITORING_STREAM_BUFFER_SIZE and MONITORING_STREAM_RETENTION must be positive")
+	}
+	if dc := c.Monitoring.DebugCapture; dc.Enabled {
+		if dc.ErrorThreshold <= 0 || dc.ErrorThreshold > 1 {
+			errors = append(errors, "DEBUG_CAPTURE_ERROR_THRESHOLD must be between 0 and 1")
+		}
+		if dc.Window <= 0 || dc.Duration <= 0 || dc.MaxCaptures <= 0 || dc.MemoryBudget <= 0 || dc.MaxBodyBytes <= 0 {
+			errors = append(errors, "DEBUG_CAPTURE_WINDOW, _DURATION, _MAX_CAPTURES, _MEMORY_BUDGET_BYTES and _MAX_BODY_BYTES must be positive")
+		}
+	}
+	if c.Chaos.Enabled && (c.Chaos.DefaultTTL <= 0 || c.Chaos.MaxTTL < c.Chaos.DefaultTTL) {
+		errors = append(errors, "CHAOS_DEFAULT_TTL must be positive and at most CHAOS_MAX_TTL")
+	}
+
+	if rs := c.Monitoring.RequestShapes; rs.Enabled {
+		if rs.SampleRate <= 0 || rs.SampleRate > 1 {
+			errors = append(errors, "REQUEST_SHAPES_SAMPLE_RATE must be greater than 0 and at most 1")
+		}
+		if rs.Retention < time.Hour || rs.MaxModels <= 0 {
+			errors = append(errors, "REQUEST_SHAPES_RETENTION must be at least 1h and REQUEST_SHAPES_MAX_MODELS positive")
+		}
+	}
+	if sr := c.Monitoring.SlowRequests; sr.Enabled {
+		if sr.Multiplier < 1 {
+			errors = append(errors, "SLOW_REQUEST_MULTIPLIER must be at least 1")
+		}
+		if sr.SampleSize <= 0 || sr.MinSamples <= 0 || sr.MinSamples > sr.SampleSize || sr.MaxBodyBytes < 0 {
+			errors = append(errors, "SLOW_REQUEST_SAMPLE_SIZE and SLOW_REQUEST_MIN_SAMPLES must be positive with MIN_SAMPLES <= SAMPLE_SIZE")
+		}
+		if sr.AlertThreshold > 0 && sr.SlackWebhookURL != "" && !strings.HasPrefix(sr.SlackWebhookURL, "https://") {
+			errors = append(errors, "SLOW_REQUEST_SLACK_WEBHOOK_URL must be an https URL")
+		}
+	}
+
+	if c.GeoRouting.Enabled {
+		if len(c.GeoRouting.Endpoints) == 0 {
+			errors = append(errors, "GEO_ROUTING_ENDPOINTS must list at least one provider=url endpoint when geo routing is enabled")
+		}
+		for _, endpoint := range c.GeoRouting.Endpoints {
+			if name, url, ok := strings.Cut(endpoint, "="); !ok || name == "" || !strings.HasPrefix(url, "http") {
+				errors = append(errors, fmt.Sprintf("GEO_ROUTING_ENDPOINTS entry %q must be provider=http(s) URL", endpoint))
+			}
+		}
+		if c.GeoRouting.ProbeInterval <= 0 {
+			errors = append(errors, "GEO_ROUTING_PROBE_INTERVAL must be positive")
+		}
+	}
+	for _, provider := range c.Fallback.Providers {
+		if !strings.HasPrefix(provider.URL, "http://") && !strings.HasPrefix(provider.URL, "https://") {
+			errors = append(errors, fmt.Sprintf("FALLBACK_%s_URL must be an http(s) URL for fallback provider %q", fallbackEnvName(provider.Name), provider.Name))
+		}
+	}
+	if c.Sessions.MaxBranchDepth < 0 || c.Sessions.MaxBranches < 0 || c.Sessions.MaxMessages <= 0 || c.Sessions.TTL <= 0 {
+		errors = append(errors, "MAX_BRANCH_DEPTH and MAX_BRANCHES must not be negative, SESSION_MAX_MESSAGES and SESSION_TTL must be positive")
+	}
+	for model, timeout := range c.UpstreamBudget.ModelTimeouts {
+		if timeout <= 0 {
+			errors = append(errors, fmt.Sprintf("MODEL_TIMEOUTS entry for %q must be a positive duration", model))
+		}
+	}
+	if c.Ensemble.Timeout <= 0 || c.Ensemble.MaxModels < 2 {
+		errors = append(errors, "ENSEMBLE_TIMEOUT must be positive and ENSEMBLE_MAX_MODELS at least 2")
+	}
+	if s := c.Sentinels; s.CheckInterval <= 0 || s.DefaultInterval <= 0 || s.DailyTokenBudget < 0 || s.HistoryLimit <= 0 {
+		errors = append(errors, "SENTINEL_CHECK_INTERVAL, SENTINEL_DEFAULT_INTERVAL and SENTINEL_HISTORY_LIMIT must be positive, SENTINEL_DAILY_TOKEN_BUDGET not negative")
+	}
+	if c.QUIC.Enabled && (c.QUIC.CertFile == "" || c.QUIC.KeyFile == "") {
+		errors = append(errors, "QUIC_ENABLED requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if c.UpstreamBudget.MinBudget <= 0 {
+		errors = append(errors, "UPSTREAM_MIN_BUDGET must be positive")
+	}
+	if c.ModelLifecycle.RetiredPolicy != "migrate" && c.ModelLifecycle.RetiredPolicy != "reject" {
+		errors = append(errors, "MODEL_RETIRED_POLICY must be \"migrate\" or \"reject\"")
+	}
+	if c.Egress.Enabled {
+		for _, cidr := range append(append([]string{}, c.Egress.AllowCIDRs...), c.Egress.DenyCIDRs...) {
+			if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+				errors = append(errors, fmt.Sprintf("EGRESS CIDR %q is not a valid CIDR or IP address", cidr))
+			}
+		}
+	}
+	for pattern, limit := range c.EndpointRateLimits {
+		if _, err := path.Match(pattern, ""); err != nil || !strings.HasPrefix(pattern, "/") {
+			errors = append(errors, fmt.Sprintf("ENDPOINT_RATE_LIMITS pattern %q is not a valid path pattern", pattern))
+		}
+		if limit.QPS <= 0 {
+			errors = append(errors, fmt.Sprintf("ENDPOINT_RATE_LIMITS QPS for %q must be positive", pattern))
+		}
+	}
+	if v := c.Validation; v.Enabled {
+		if v.MinMaxTokens < 0 || v.MaxMaxTokens < 0 || (v.MaxMaxTokens > 0 && v.MinMaxTokens > v.MaxMaxTokens) {
+			errors = append(errors, "REQUEST_VALIDATION_MIN_MAX_TOKENS must not be negative or exceed REQUEST_VALIDATION_MAX_MAX_TOKENS")
+		}
+		for route, override := range v.Routes {
+			if !strings.HasPrefix(route, "/") {
+				errors = append(errors, fmt.Sprintf("REQUEST_VALIDATION_ROUTES route %q must be a path", route))
+			}
+			if !override.Disabled && override.MaxMaxTokens < v.MinMaxTokens {
+				errors = append(errors, fmt.Sprintf("REQUEST_VALIDATION_ROUTES max_tokens bound for %q must be \"off\" or at least %d", route, v.MinMaxTokens))
+			}
+		}
+	}
+	if c.ProtocolConversion.Enabled && c.ProtocolConversion.GRPCIdleTimeout < 0 {
+		errors = append(errors, "GRPC_IDLE_TIMEOUT must not be negative")
+	}
+	for address, endpoint := range c.ProtocolConversion.GRPCTLS {
+		if (endpoint.CertFile == "") != (endpoint.KeyFile == "") {
+			errors = append(errors, fmt.Sprintf("GRPC_TLS_ENDPOINTS entry %q must set both cert and key", address))
+		}
+	}
+	if c.ResponseCache.MaxEntries < 0 || c.ResponseCache.MaxSizeMB < 0 {
+		errors = append(errors, "RESPONSE_CACHE_MAX_ENTRIES and RESPONSE_CACHE_MAX_SIZE_MB must not be negative")
+	}
+	switch c.ResponseCache.Backend {
+	case "", "memory":
+	case "redis":
+		if !c.Redis.Enabled {
+			errors = append(errors, "RESPONSE_CACHE_BACKEND=redis requires REDIS_ENABLED")
+		}
+		if c.ResponseCache.RedisTimeout <= 0 {
+			errors = append(errors, "RESPONSE_CACHE_REDIS_TIMEOUT must be positive")
+		}
+	default:
+		errors = append(errors, "RESPONSE_CACHE_BACKEND must be memory or redis")
+	}
+	if c.KeyRateLimit.Enabled && (c.KeyRateLimit.Requests < 0 || c.KeyRateLimit.Window <= 0) {
+		errors = append(errors, "KEY_RATE_LIMIT_REQUESTS must not be negative and KEY_RATE_LIMIT_WINDOW must be positive")
+	}
+	if c.MaxSchemaRetries < 0 {
+		errors = append(errors, "MAX_SCHEMA_RETRIES must not be negative")
+	}
+	if c.RetryBudgetPerSecond < 0 {
+		errors = append(errors, "RETRY_BUDGET_PER_SECOND must not be negative")
+	}
+
+	// Validate storage backend
+	if c.Storage.Backend != "" && c.Storage.Backend != "redis" && c.Storage.Backend != "embedded" {
+		errors = append(errors, "STORAGE_BACKEND must be either redis or embedded")
+	}
+	if c.Storage.Backend == "embedded" && c.Storage.Path == "" {
+		errors = append(errors, "STORAGE_PATH must be specified for the embedded storage backend")
+	}
+	if c.Storage.IdempotencyTTL < 0 {
+		errors = append(errors, "IDEMPOTENCY_TTL must not be negative")
+	}
+
+	if c.ServiceDiscovery.Enabled && (c.ServiceDiscovery.Type == "etcd" || c.ServiceDiscovery.Type == "consul") && c.ServiceDiscovery.LeaseTTL < time.Second {
+		errors = append(errors, "SERVICE_DISCOVERY_LEASE_TTL must be at least 1s for "+c.ServiceDiscovery.Type)
+	}
+
+	if c.RequestQueue.Enabled && (c.RequestQueue.MaxConcurrent <= 0 || c.RequestQueue.MaxQueued < 0) {
+		errors = append(errors, "REQUEST_QUEUE_MAX_CONCURRENT must be positive and REQUEST_QUEUE_MAX_SIZE must not be negative")
+	}
+	for tenant, priority := range c.RequestQueue.TenantPriorities {
+		if priority != "high" && priority != "normal" && priority != "low" {
+			errors = append(errors, fmt.Sprintf("REQUEST_QUEUE_TENANT_PRIORITIES: priority of %s must be high, normal or low", tenant))
+		}
+	}
+
+	if c.Capacity.Enabled && (c.Capacity.LeaseTTL <= 0 || c.Capacity.RefreshInterval <= 0) {
+		errors = append(errors, "CAPACITY_LEASE_TTL and CAPACITY_REFRESH_INTERVAL must be positive")
+	}
+	if ks := c.KillSwitch; ks.ConfirmWindow <= 0 || ks.MaxDuration <= 0 || ks.RefreshInterval <= 0 {
+		errors = append(errors, "KILL_SWITCH_CONFIRM_WINDOW, KILL_SWITCH_MAX_DURATION and KILL_SWITCH_REFRESH_INTERVAL must be positive")
+	}
+	if url := c.KillSwitch.WebhookURL; url != "" && !strings.HasPrefix(url, "https://") {
+		errors = append(errors, "KILL_SWITCH_WEBHOOK_URL must be an https URL")
+	}
+	if ref := c.Prompts.SystemTemplate; ref != "" && !promptRefPattern.MatchString(ref) {
+		errors = append(errors, "PROMPT_SYSTEM_TEMPLATE must be a name@version or name@latest template reference")
+	}
+	if ref := c.Prompts.SummaryTemplate; ref != "" && !promptRefPattern.MatchString(ref) {
+		errors = append(errors, "PROMPT_SUMMARY_TEMPLATE must be a name@version or name@latest template reference")
+	}
+
+	if c.Sandbox.Enabled && (c.Sandbox.LatencyMin < 0 || c.Sandbox.LatencyMax < c.Sandbox.LatencyMin || c.Sandbox.RateLimit <= 0) {
+		errors = append(errors, "SANDBOX_LATENCY_MAX must not be below SANDBOX_LATENCY_MIN and SANDBOX_RATE_LIMIT must be positive")
+	}
+
+	if c.Shutdown.StreamingGrace < 0 || c.Shutdown.DefaultGrace < 0 {
+		errors = append(errors, "SHUTDOWN_STREAMING_GRACE and SHUTDOWN_DEFAULT_GRACE must not be negative")
+	}
+
+	if c.Monitoring.StatsD.Addr != "" && c.Monitoring.StatsD.Format != "statsd" && c.Monitoring.StatsD.Format != "dogstatsd" {
+		errors = append(errors, "STATSD_FORMAT must be either statsd or dogstatsd")
+	}
+
+	if c.Monitoring.PushGateway.URL != "" && (c.Monitoring.PushGateway.Interval <= 0 || c.Monitoring.PushGateway.Job == "") {
+		errors = append(errors, "PROMETHEUS_PUSH_INTERVAL must be positive and PROMETHEUS_PUSH_JOB set when PROMETHEUS_PUSHGATEWAY_URL is set")
+	}
+
+	if tr := c.Monitoring.Tracing; tr.OTLPEndpoint != "" && (tr.SampleRatio < 0 || tr.SampleRatio > 1) {
+		errors = append(errors, "OTEL_TRACES_SAMPLE_RATIO must be between 0 and 1")
+	}
+
+	notifications := c.Monitoring.Notifications
+	for _, channel := range []struct {
+		prefix string
+		NotificationChannelConfig
+	}{
+		{"ALERT_WEBHOOK", notifications.Webhook},
+		{"ALERT_DINGTALK", notifications.DingTalk},
+	} {
+		prefix := channel.prefix
+		if channel.URL != "" && !strings.HasPrefix(channel.URL, "https://") && !strings.HasPrefix(channel.URL, "http://") {
+			errors = append(errors, prefix+"_URL must be an http or https URL")
+		}
+		switch channel.MinLevel {
+		case "info", "warning", "critical":
+		default:
+			errors = append(errors, prefix+"_MIN_LEVEL must be info, warning or critical")
+		}
+	}
+	if notifications.MaxRetries < 0 || notifications.RetryBackoff < 0 || notifications.RatePerMinute < 0 {
+		errors = append(errors, "ALERT_NOTIFY_MAX_RETRIES, ALERT_NOTIFY_RETRY_BACKOFF and ALERT_NOTIFY_RATE_PER_MINUTE must not be negative")
+	}
+	for _, webhook := range c.Monitoring.WebhookURLs {
+		if webhook != "" && !strings.HasPrefix(webhook, "https://") && !strings.HasPrefix(webhook, "http://") {
+			errors = append(errors, "MONITORING_WEBHOOK_URLS must be http or https URLs")
+			break
+		}
+	}
+
+	if c.OIDC.Enabled && (c.OIDC.IssuerURL == "" || c.OIDC.ClientID == "" || c.OIDC.RedirectURL == "") {
+		errors = append(errors, "OIDC_ISSUER_URL, OIDC_CLIENT_ID and OIDC_REDIRECT_URL must be set when OIDC is enabled")
+	}
 
 	// Validate Redis configuration if enabled
 	if c.Redis.Enabled && c.Redis.Addr == "" {
@@ -347,6 +1539,155 @@ func getEnvFloat(key string, defaultValue float64) float64 {
 	return defaultValue
 }
 
+// parseEndpointRateLimits parses "pattern=qps" pairs separated by commas, e.g.
+// "/api/v1/chat=5,/v1/chat/*=10". Malformed QPS values are kept as 0 so
+// ValidateConfig reports them.
+func parseEndpointRateLimits(value string) map[string]EndpointRateConfig {
+	limits := make(map[string]EndpointRateConfig)
+	if value == "" {
+		return limits
+	}
+	for _, entry := range strings.Split(value, ",") {
+		pattern, qps, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if pattern == "" {
+			continue
+		}
+		limit, _ := strconv.Atoi(strings.TrimSpace(qps))
+		limits[strings.TrimSpace(pattern)] = EndpointRateConfig{QPS: limit}
+	}
+	return limits
+}
+
+// parseRouteValidation parses "route=max_tokens" pairs separated by commas,
+// where "off" disables validation on the route, e.g.
+// "/api/v1/chat=2048,/api/v1/completions=off". Malformed bounds are kept as 0
+// so ValidateConfig reports them.
+func parseRouteValidation(value string) map[string]RouteValidationConfig {
+	routes := make(map[string]RouteValidationConfig)
+	if value == "" {
+		return routes
+	}
+	for _, entry := range strings.Split(value, ",") {
+		route, bound, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if route == "" {
+			continue
+		}
+		bound = strings.TrimSpace(bound)
+		if bound == "off" {
+			routes[strings.TrimSpace(route)] = RouteValidationConfig{Disabled: true}
+			continue
+		}
+		maxTokens, _ := strconv.Atoi(bound)
+		routes[strings.TrimSpace(route)] = RouteValidationConfig{MaxMaxTokens: maxTokens}
+	}
+	return routes
+}
+
+// parseGRPCTLSEndpoints parses "host:port=field=value;field=value" entries
+// separated by commas, where field is ca, cert, key or server_name, e.g.
+// "payments:443=ca=/etc/gw/ca.pem;cert=/etc/gw/client.pem;key=/etc/gw/client.key".
+// Unknown fields are ignored.
+func parseGRPCTLSEndpoints(value string) map[string]GRPCEndpointTLSConfig {
+	endpoints := make(map[string]GRPCEndpointTLSConfig)
+	if value == "" {
+		return endpoints
+	}
+	for _, entry := range strings.Split(value, ",") {
+		address, fields, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if address == "" {
+			continue
+		}
+		var tlsConfig GRPCEndpointTLSConfig
+		for _, field := range strings.Split(fields, ";") {
+			name, setting, _ := strings.Cut(strings.TrimSpace(field), "=")
+			switch strings.TrimSpace(name) {
+			case "ca":
+				tlsConfig.CAFile = strings.TrimSpace(setting)
+			case "cert":
+				tlsConfig.CertFile = strings.TrimSpace(setting)
+			case "key":
+				tlsConfig.KeyFile = strings.TrimSpace(setting)
+			case "server_name":
+				tlsConfig.ServerName = strings.TrimSpace(setting)
+			}
+		}
+		endpoints[strings.TrimSpace(address)] = tlsConfig
+	}
+	return endpoints
+}
+
+// parseFallbackProviders reads the URL, key and model of each named fallback
+// provider from FALLBACK_<NAME>_* variables, keeping the given order
+func parseFallbackProviders(names []string) []FallbackProviderConfig {
+	var providers []FallbackProviderConfig
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		prefix := "FALLBACK_" + fallbackEnvName(name) + "_"
+		providers = append(providers, FallbackProviderConfig{
+			Name:   name,
+			URL:    strings.TrimSuffix(getEnv(prefix+"URL", ""), "/"),
+			APIKey: getEnv(prefix+"KEY", ""),
+			Model:  getEnv(prefix+"MODEL", ""),
+		})
+	}
+	return providers
+}
+
+// fallbackEnvName turns a provider name into its environment variable infix,
+// e.g. "azure-openai" into "AZURE_OPENAI"
+func fallbackEnvName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// parseModelTimeouts parses "model=duration" pairs separated by commas, e.g.
+// "qwen-max=60s,qwen-turbo=15s". Malformed durations are kept as 0 so
+// ValidateConfig reports them.
+func parseModelTimeouts(value string) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	if value == "" {
+		return timeouts
+	}
+	for _, entry := range strings.Split(value, ",") {
+		model, timeout, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if model == "" {
+			continue
+		}
+		duration, _ := time.ParseDuration(strings.TrimSpace(timeout))
+		timeouts[strings.TrimSpace(model)] = duration
+	}
+	return timeouts
+}
+
+// parseTenantPriorities parses "owner=tier" pairs separated by commas, e.g.
+// "alice=high,batch-jobs=low". Unknown tiers are kept so ValidateConfig
+// reports them.
+func parseTenantPriorities(value string) map[string]string {
+	priorities := make(map[string]string)
+	if value == "" {
+		return priorities
+	}
+	for _, entry := range strings.Split(value, ",") {
+		tenant, priority, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if tenant == "" {
+			continue
+		}
+		priorities[strings.TrimSpace(tenant)] = strings.ToLower(strings.TrimSpace(priority))
+	}
+	return priorities
+}
+
+// validIPEntry reports whether entry of an IP filter list is an IP or a CIDR;
+// blank entries are ignored
+func validIPEntry(entry string) bool {
+	if entry == "" {
+		return true
+	}
+	_, _, err := net.ParseCIDR(entry)
+	return err == nil || net.ParseIP(entry) != nil
+}
+
 func getEnvStringSlice(key string, defaultValue []string) []string {
 	if value := os.Getenv(key); value != "" {
 		// Split by comma and trim spaces
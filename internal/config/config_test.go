@@ -2,10 +2,12 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConfigNew(t *testing.T) {
@@ -40,6 +42,7 @@ func TestConfigDefaults(t *testing.T) {
 	assert.Equal(t, "info", cfg.LogLevel)
 	assert.Equal(t, 60, cfg.RateLimit)
 	assert.True(t, cfg.HealthCheck)
+	assert.Equal(t, 24*time.Hour, cfg.Security.JWTRotationInterval)
 }
 
 func TestRedisConfig(t *testing.T) {
@@ -148,3 +151,94 @@ func TestEmptyGatewayKeys(t *testing.T) {
 
 	assert.Empty(t, cfg.GatewayKeys)
 }
+
+func TestRequestValidationConfig(t *testing.T) {
+	os.Setenv("REQUEST_VALIDATION_ROUTES", "/api/v1/chat=2048, /api/v1/completions=off,/v1/completions=many")
+	defer os.Unsetenv("REQUEST_VALIDATION_ROUTES")
+
+	cfg := New()
+	assert.True(t, cfg.Validation.Enabled)
+	assert.Equal(t, []string{"system", "user", "assistant"}, cfg.Validation.AllowedRoles)
+	assert.Equal(t, map[string]RouteValidationConfig{
+		"/api/v1/chat":        {MaxMaxTokens: 2048},
+		"/api/v1/completions": {Disabled: true},
+		"/v1/completions":     {},
+	}, cfg.Validation.Routes)
+
+	cfg.Validation.MaxMaxTokens = 1024
+	cfg.Validation.MinMaxTokens = 2048
+	err := cfg.ValidateConfig()
+	assert.ErrorContains(t, err, "REQUEST_VALIDATION_MIN_MAX_TOKENS must not be negative or exceed REQUEST_VALIDATION_MAX_MAX_TOKENS")
+	assert.ErrorContains(t, err, `REQUEST_VALIDATION_ROUTES max_tokens bound for "/v1/completions" must be "off" or at least 2048`)
+}
+
+func TestGRPCTLSEndpointsConfig(t *testing.T) {
+	os.Setenv("GRPC_TLS_ENDPOINTS", "payments:443=ca=/etc/gw/ca.pem;cert=/etc/gw/client.pem;key=/etc/gw/client.key, search:9000=ca=/etc/gw/ca.pem;server_name=search.internal")
+	defer os.Unsetenv("GRPC_TLS_ENDPOINTS")
+
+	cfg := New()
+	assert.Equal(t, map[string]GRPCEndpointTLSConfig{
+		"payments:443": {CAFile: "/etc/gw/ca.pem", CertFile: "/etc/gw/client.pem", KeyFile: "/etc/gw/client.key"},
+		"search:9000":  {CAFile: "/etc/gw/ca.pem", ServerName: "search.internal"},
+	}, cfg.ProtocolConversion.GRPCTLS)
+	assert.Equal(t, 10*time.Minute, cfg.ProtocolConversion.GRPCIdleTimeout)
+
+	cfg.ProtocolConversion.GRPCTLS["ledger:443"] = GRPCEndpointTLSConfig{CertFile: "/etc/gw/client.pem"}
+	assert.ErrorContains(t, cfg.ValidateConfig(), `GRPC_TLS_ENDPOINTS entry "ledger:443" must set both cert and key`)
+}
+
+func TestEndpointRateLimitsConfig(t *testing.T) {
+	os.Setenv("ENDPOINT_RATE_LIMITS", "/api/v1/chat=5, /v1/chat/*=10")
+	defer os.Unsetenv("ENDPOINT_RATE_LIMITS")
+
+	cfg := New()
+	assert.Equal(t, map[string]EndpointRateConfig{
+		"/api/v1/chat": {QPS: 5},
+		"/v1/chat/*":   {QPS: 10},
+	}, cfg.EndpointRateLimits)
+
+	cfg.EndpointRateLimits["/api/v1/models"] = EndpointRateConfig{QPS: 0}
+	cfg.EndpointRateLimits["v1/[embeddings"] = EndpointRateConfig{QPS: 1}
+	err := cfg.ValidateConfig()
+	assert.ErrorContains(t, err, `ENDPOINT_RATE_LIMITS QPS for "/api/v1/models" must be positive`)
+	assert.ErrorContains(t, err, `"v1/[embeddings" is not a valid path pattern`)
+}
+
+func TestRequestQueueTenantPrioritiesConfig(t *testing.T) {
+	t.Setenv("REQUEST_QUEUE_TENANT_PRIORITIES", "alice=High, batch-jobs=low")
+
+	cfg := New()
+	assert.Equal(t, map[string]string{"alice": "high", "batch-jobs": "low"}, cfg.RequestQueue.TenantPriorities)
+
+	cfg.RequestQueue.TenantPriorities["bob"] = "urgent"
+	assert.ErrorContains(t, cfg.ValidateConfig(), "priority of bob must be high, normal or low")
+}
+
+func TestIPFilterEntriesAreValidated(t *testing.T) {
+	t.Setenv("JWT_SECRET", "a-secure-test-secret")
+	t.Setenv("IP_ALLOWLIST", "10.0.0.0/8, 192.0.2.1")
+	t.Setenv("IP_BLOCKLIST", "203.0.113.0/33,")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,proxy.internal")
+	cfg := New()
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.1"}, cfg.IPFilter.Allowlist)
+
+	err := cfg.ValidateConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `IP_BLOCKLIST entry "203.0.113.0/33" is neither an IP nor a CIDR`)
+	assert.Contains(t, err.Error(), `TRUSTED_PROXIES entry "proxy.internal" is neither an IP nor a CIDR`)
+	assert.NotContains(t, err.Error(), "IP_ALLOWLIST")
+}
+
+func TestContentFilterPatternsFile(t *testing.T) {
+	t.Setenv("JWT_SECRET", "a-secure-test-secret")
+	t.Setenv("CONTENT_FILTER_PATTERNS", filepath.Join(t.TempDir(), "missing.json"))
+	cfg := New()
+	assert.True(t, cfg.ContentFilter.Enabled, "a patterns file enables the filter")
+
+	err := cfg.ValidateConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "CONTENT_FILTER_PATTERNS")
+
+	t.Setenv("CONTENT_FILTER_ENABLED", "false")
+	assert.False(t, New().ContentFilter.Enabled)
+}
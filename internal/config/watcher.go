@@ -0,0 +1,293 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// reloadDebounce coalesces the several write events editors emit for one save
+const reloadDebounce = 200 * time.Millisecond
+
+// ConfigWatcher 监听 .env 和可选的 YAML 配置文件，变更后重新解析并校验配置，
+// 通过 Updates 发布新的 *Config，由 Reloader 换入 Snapshot。
+//
+// 可热更新:
+//   - RATE_LIMIT_REQUESTS_PER_MINUTE, GATEWAY_API_KEYS, CORS_ALLOWED_ORIGINS
+//     （限流、APIKeyAuth 和 CORS 中间件每个请求读取 Snapshot）
+//   - LOG_LEVEL, LOG_FORMAT
+//   - TOKEN_EXPIRATION, MAX_API_KEYS_PER_USER, API_KEY_PREFIX
+//   - MONITORING_METRICS_RETENTION
+//
+// 需要重启（见 RestartRequired）: 监听端口、GIN_MODE、TLS 证书路径、Redis 地址、
+// 存储后端以及 JWT 密钥，重载时记录日志并保留运行中的值。其余字段在重载后的
+// *Config 中可见，但已启动的组件不会重新读取。
+type ConfigWatcher struct {
+	envFile  string
+	yamlFile string
+	watcher  *fsnotify.Watcher
+	updates  chan *Config
+
+	mu      sync.Mutex
+	envKeys map[string]bool // variables last set from the files, cleared when removed there
+	pinned  map[string]bool // variables of the process environment, which win over the files
+}
+
+// NewConfigWatcher watches envFile and, when not empty, yamlFile. The YAML
+// file is a flat map of environment variable names to values and takes
+// precedence over the .env file.
+func NewConfigWatcher(envFile, yamlFile string) (*ConfigWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create config watcher: %w", err)
+	}
+
+	// Watch the directories: editors and ConfigMap mounts replace files
+	// rather than writing them in place, which drops a watch on the file
+	dirs := make(map[string]bool)
+	for _, file := range []string{envFile, yamlFile} {
+		if file == "" {
+			continue
+		}
+		dir := filepath.Dir(file)
+		if dirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+		}
+		dirs[dir] = true
+	}
+
+	w := &ConfigWatcher{
+		envFile:  envFile,
+		yamlFile: yamlFile,
+		watcher:  watcher,
+		updates:  make(chan *Config, 1),
+		envKeys:  make(map[string]bool),
+		pinned:   make(map[string]bool),
+	}
+
+	// As at startup, variables set in the environment itself are not
+	// overridden; the files' own values are what they were loaded from
+	values, err := w.readFiles()
+	if err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	for key, value := range values {
+		if current, ok := os.LookupEnv(key); ok && current != value {
+			w.pinned[key] = true
+		} else {
+			w.envKeys[key] = true
+		}
+	}
+	return w, nil
+}
+
+// Updates delivers each valid reloaded configuration. Only the newest is
+// kept when the subscriber falls behind.
+func (w *ConfigWatcher) Updates() <-chan *Config {
+	return w.updates
+}
+
+// Start processes file events until ctx is done or Close is called
+func (w *ConfigWatcher) Start(ctx context.Context) {
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !w.watches(event.Name) || event.Op == fsnotify.Chmod {
+				continue
+			}
+			debounce = time.After(reloadDebounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			logrus.WithError(err).Warn("Config watcher error")
+		case <-debounce:
+			debounce = nil
+			cfg, err := w.Reload()
+			if err != nil {
+				logrus.WithError(err).Error("Configuration reload rejected, keeping the running configuration")
+				continue
+			}
+			w.publish(cfg)
+			logrus.Info("Configuration reloaded")
+		}
+	}
+}
+
+func (w *ConfigWatcher) watches(name string) bool {
+	name = filepath.Clean(name)
+	return name == filepath.Clean(w.envFile) || (w.yamlFile != "" && name == filepath.Clean(w.yamlFile))
+}
+
+// publish replaces an update the subscriber has not received yet
+func (w *ConfigWatcher) publish(cfg *Config) {
+	for {
+		select {
+		case w.updates <- cfg:
+			return
+		default:
+		}
+		select {
+		case <-w.updates:
+		default:
+		}
+	}
+}
+
+// Reload re-reads the files into the environment and builds a validated
+// configuration from it
+func (w *ConfigWatcher) Reload() (*Config, error) {
+	values, err := w.readFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	for key := range w.envKeys {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+		}
+	}
+	w.envKeys = make(map[string]bool, len(values))
+	for key, value := range values {
+		if w.pinned[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		w.envKeys[key] = true
+	}
+	w.mu.Unlock()
+
+	cfg := New()
+	if err := cfg.ValidateConfig(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Close stops watching; Start returns once the watcher is closed
+func (w *ConfigWatcher) Close() error {
+	return w.watcher.Close()
+}
+
+// LoadFiles sets the variables of yamlFile, then of envFile (".env" when
+// empty), that are not in the environment yet. Missing files are skipped.
+func LoadFiles(envFile, yamlFile string) error {
+	if envFile == "" {
+		envFile = ".env"
+	}
+	var files []map[string]string
+	if yamlFile != "" {
+		values, err := ReadYAMLFile(yamlFile)
+		if err != nil && !os.IsNotExist(errors.Unwrap(err)) {
+			return err
+		}
+		files = append(files, values)
+	}
+	values, err := readEnvFile(envFile)
+	if err != nil {
+		return err
+	}
+	files = append(files, values)
+
+	for _, values := range files {
+		for key, value := range values {
+			if _, ok := os.LookupEnv(key); !ok {
+				os.Setenv(key, value)
+			}
+		}
+	}
+	return nil
+}
+
+// readFiles merges the .env file with the YAML overrides
+func (w *ConfigWatcher) readFiles() (map[string]string, error) {
+	values, err := readEnvFile(w.envFile)
+	if err != nil {
+		return nil, err
+	}
+	if w.yamlFile != "" {
+		overrides, err := ReadYAMLFile(w.yamlFile)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range overrides {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+func readEnvFile(path string) (map[string]string, error) {
+	values, err := godotenv.Read(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// ReadYAMLFile reads a flat YAML map of environment variable names to scalar values
+func ReadYAMLFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch v := value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("%s: %s must be a scalar", path, key)
+		case nil:
+			values[key] = ""
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// RestartRequired lists the settings that differ between old and updated but
+// are only read at startup
+func RestartRequired(old, updated *Config) []string {
+	var fields []string
+	check := func(name string, changed bool) {
+		if changed {
+			fields = append(fields, name)
+		}
+	}
+	check("PORT", old.Port != updated.Port)
+	check("GIN_MODE", old.GinMode != updated.GinMode)
+	check("TLS_CERT_FILE", old.QUIC.CertFile != updated.QUIC.CertFile)
+	check("TLS_KEY_FILE", old.QUIC.KeyFile != updated.QUIC.KeyFile)
+	check("REDIS_ADDR", old.Redis.Addr != updated.Redis.Addr)
+	check("STORAGE_BACKEND", old.Storage.Backend != updated.Storage.Backend)
+	check("JWT_SECRET", old.Security.JWTSecret != updated.Security.JWTSecret)
+	return fields
+}
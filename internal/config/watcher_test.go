@@ -0,0 +1,95 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unsetEnv clears keys for the test and restores them afterwards
+func unsetEnv(t *testing.T, keys ...string) {
+	for _, key := range keys {
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+}
+
+func nextConfig(t *testing.T, w *ConfigWatcher) *Config {
+	select {
+	case cfg := <-w.Updates():
+		return cfg
+	case <-time.After(3 * time.Second):
+		t.Fatal("no configuration published")
+		return nil
+	}
+}
+
+func TestConfigWatcherPublishesValidChanges(t *testing.T) {
+	unsetEnv(t, "RATE_LIMIT_REQUESTS_PER_MINUTE", "LOG_LEVEL", "PORT")
+	t.Setenv("JWT_SECRET", "watcher-test-secret")
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(envFile, []byte("RATE_LIMIT_REQUESTS_PER_MINUTE=60\nLOG_LEVEL=info\n"), 0o600))
+	require.NoError(t, LoadFiles(envFile, ""))
+
+	w, err := NewConfigWatcher(envFile, "")
+	require.NoError(t, err)
+	t.Cleanup(func() { w.Close() })
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go w.Start(ctx)
+
+	require.NoError(t, os.WriteFile(envFile, []byte("RATE_LIMIT_REQUESTS_PER_MINUTE=120\nLOG_LEVEL=debug\nPORT=9090\n"), 0o600))
+	cfg := nextConfig(t, w)
+	assert.Equal(t, 120, cfg.RateLimit)
+	assert.Equal(t, "debug", cfg.LogLevel)
+	previous := *cfg
+	previous.Port = "8080"
+	assert.Equal(t, []string{"PORT"}, RestartRequired(&previous, cfg))
+
+	// An invalid edit is rejected and the next valid one still goes through
+	require.NoError(t, os.WriteFile(envFile, []byte("RATE_LIMIT_REQUESTS_PER_MINUTE=-1\n"), 0o600))
+	select {
+	case cfg := <-w.Updates():
+		t.Fatalf("invalid configuration published: rate limit %d", cfg.RateLimit)
+	case <-time.After(time.Second):
+	}
+	require.NoError(t, os.WriteFile(envFile, []byte("RATE_LIMIT_REQUESTS_PER_MINUTE=30\n"), 0o600))
+	cfg = nextConfig(t, w)
+	assert.Equal(t, 30, cfg.RateLimit)
+	assert.Equal(t, "info", cfg.LogLevel, "a variable removed from the file falls back to its default")
+	assert.Equal(t, "8080", cfg.Port)
+}
+
+func TestConfigWatcherYAMLOverridesEnvFile(t *testing.T) {
+	unsetEnv(t, "RATE_LIMIT_REQUESTS_PER_MINUTE", "LOG_FORMAT")
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("JWT_SECRET", "watcher-test-secret")
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	yamlFile := filepath.Join(dir, "gateway.yaml")
+	require.NoError(t, os.WriteFile(envFile, []byte("RATE_LIMIT_REQUESTS_PER_MINUTE=60\nLOG_FORMAT=text\nLOG_LEVEL=debug\n"), 0o600))
+	require.NoError(t, os.WriteFile(yamlFile, []byte("RATE_LIMIT_REQUESTS_PER_MINUTE: 90\n"), 0o600))
+	require.NoError(t, LoadFiles(envFile, yamlFile))
+	assert.Equal(t, "90", os.Getenv("RATE_LIMIT_REQUESTS_PER_MINUTE"))
+
+	w, err := NewConfigWatcher(envFile, yamlFile)
+	require.NoError(t, err)
+	t.Cleanup(func() { w.Close() })
+
+	require.NoError(t, os.WriteFile(yamlFile, []byte("RATE_LIMIT_REQUESTS_PER_MINUTE: 45\nLOG_FORMAT: json\n"), 0o600))
+	cfg, err := w.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, 45, cfg.RateLimit)
+	assert.Equal(t, "json", cfg.LogFormat)
+	assert.Equal(t, "warn", cfg.LogLevel, "the process environment wins over the files")
+
+	require.NoError(t, os.WriteFile(yamlFile, []byte("RATE_LIMIT_REQUESTS_PER_MINUTE: [1, 2]\n"), 0o600))
+	_, err = w.Reload()
+	assert.ErrorContains(t, err, "must be a scalar")
+}
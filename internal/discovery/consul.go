@@ -0,0 +1,303 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+
+	"github.com/sirupsen/logrus"
+)
+
+// consulTokenHeader carries the ACL token on every Consul API request
+const consulTokenHeader = "X-Consul-Token"
+
+// ConsulDiscovery 基于 Consul agent HTTP API 的服务发现。每个实例注册一个 HTTP 检查和
+// 一个 TTL 检查，TTL 检查由后台协程按 TTL 的一半周期续约，注销时停止续约。
+// With an ACL token set every request carries it in X-Consul-Token.
+type ConsulDiscovery struct {
+	config *config.ServiceDiscoveryConfig
+	client *http.Client
+
+	mutex    sync.Mutex
+	token    string
+	renewers map[string]context.CancelFunc // TTL renewals by instance ID
+}
+
+func NewConsulDiscovery(cfg *config.ServiceDiscoveryConfig) (*ConsulDiscovery, error) {
+	c := &ConsulDiscovery{
+		config:   cfg,
+		client:   httpclient.NewClient("service_discovery", 10*time.Second),
+		renewers: make(map[string]context.CancelFunc),
+	}
+	c.SetACLToken(cfg.ACLToken)
+	return c, nil
+}
+
+// SetACLToken sets the token sent with all requests to ACL-enabled Consul clusters
+func (c *ConsulDiscovery) SetACLToken(token string) {
+	c.mutex.Lock()
+	c.token = token
+	c.mutex.Unlock()
+}
+
+// ttlCheckID returns the ID of the TTL check registered with an instance
+func ttlCheckID(instanceID string) string {
+	return "service:" + instanceID + ":ttl"
+}
+
+// do sends a request to each endpoint in turn until one answers with 2xx
+func (c *ConsulDiscovery) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	c.mutex.Lock()
+	token := c.token
+	c.mutex.Unlock()
+
+	var lastErr error
+	for _, endpoint := range c.config.Endpoints {
+		if endpoint = strings.TrimSpace(endpoint); endpoint == "" {
+			continue
+		}
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(endpoint, "/")+path, reader)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set(consulTokenHeader, token)
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			logrus.WithError(err).Warnf("Consul request to %s failed", endpoint)
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+		resp.Body.Close()
+		lastErr = fmt.Errorf("consul endpoint %s returned status %d", endpoint, resp.StatusCode)
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no Consul endpoints configured")
+	}
+	return nil, lastErr
+}
+
+func (c *ConsulDiscovery) Register(instance *ServiceInstance) error {
+	logrus.WithField("instance", instance.ID).Info("Registering service with Consul")
+
+	// Build Consul service registration payload
+	checkID := ttlCheckID(instance.ID)
+	ttl := c.config.LeaseTTL
+	registration := map[string]interface{}{
+		"ID":      instance.ID,
+		"Name":    instance.Name,
+		"Address": instance.Address,
+		"Port":    instance.Port,
+		"Tags":    instance.Tags,
+		"Meta":    instance.Meta,
+		"Checks": []map[string]interface{}{
+			{
+				"HTTP":                           fmt.Sprintf("%s://%s:%d/health", instance.Protocol, instance.Address, instance.Port),
+				"Interval":                       "10s",
+				"Timeout":                        "3s",
+				"DeregisterCriticalServiceAfter": "30s",
+			},
+			{
+				"CheckID":                        checkID,
+				"Name":                           "Gateway TTL heartbeat",
+				"TTL":                            ttl.String(),
+				"Status":                         "passing",
+				"DeregisterCriticalServiceAfter": "30s",
+			},
+		},
+	}
+
+	jsonData, err := json.Marshal(registration)
+	if err != nil {
+		return fmt.Errorf("failed to marshal registration data: %w", err)
+	}
+
+	resp, err := c.do(context.Background(), http.MethodPut, "/v1/agent/service/register", jsonData)
+	if err != nil {
+		return fmt.Errorf("failed to register service with any Consul endpoint: %w", err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.mutex.Lock()
+	if previous, ok := c.renewers[instance.ID]; ok {
+		previous()
+	}
+	c.renewers[instance.ID] = cancel
+	c.mutex.Unlock()
+	go c.startTTLRenewal(ctx, checkID, ttl)
+
+	logrus.WithField("instance", instance.ID).Info("Successfully registered service with Consul")
+	return nil
+}
+
+// startTTLRenewal marks the TTL check passing every interval/2 until ctx is done
+func (c *ConsulDiscovery) startTTLRenewal(ctx context.Context, checkID string, interval time.Duration) {
+	period := interval / 2
+	if period <= 0 {
+		return
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	path := "/v1/agent/check/pass/" + url.PathEscape(checkID)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			resp, err := c.do(ctx, http.MethodPut, path, nil)
+			if err != nil {
+				if ctx.Err() == nil {
+					logrus.WithError(err).WithField("check", checkID).Warn("Failed to renew Consul TTL check")
+				}
+				continue
+			}
+			resp.Body.Close()
+		}
+	}
+}
+
+// stopTTLRenewal cancels the TTL renewal of an instance, if any
+func (c *ConsulDiscovery) stopTTLRenewal(instanceID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if cancel, ok := c.renewers[instanceID]; ok {
+		cancel()
+		delete(c.renewers, instanceID)
+	}
+}
+
+func (c *ConsulDiscovery) Deregister(instanceID string) error {
+	logrus.WithField("instance", instanceID).Info("Deregistering service from Consul")
+
+	// Stop renewing first so a late renewal cannot race the deregistration
+	c.stopTTLRenewal(instanceID)
+
+	resp, err := c.do(context.Background(), http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(instanceID), nil)
+	if err != nil {
+		return fmt.Errorf("failed to deregister service from any Consul endpoint: %w", err)
+	}
+	resp.Body.Close()
+
+	logrus.WithField("instance", instanceID).Info("Successfully deregistered service from Consul")
+	return nil
+}
+
+func (c *ConsulDiscovery) Discover(serviceName string) ([]*ServiceInstance, error) {
+	logrus.WithField("service", serviceName).Info("Discovering services from Consul")
+
+	resp, err := c.do(context.Background(), http.MethodGet, "/v1/health/service/"+url.PathEscape(serviceName)+"?passing=true", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover services from any Consul endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var consulServices []struct {
+		Service struct {
+			ID      string            `json:"ID"`
+			Service string            `json:"Service"`
+			Address string            `json:"Address"`
+			Port    int               `json:"Port"`
+			Tags    []string          `json:"Tags"`
+			Meta    map[string]string `json:"Meta"`
+		} `json:"Service"`
+		Checks []struct {
+			Status string `json:"Status"`
+		} `json:"Checks"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&consulServices); err != nil {
+		return nil, fmt.Errorf("failed to decode Consul services: %w", err)
+	}
+
+	var instances []*ServiceInstance
+	for _, cs := range consulServices {
+		health := "unknown"
+		for _, check := range cs.Checks {
+			if check.Status == "passing" {
+				health = "healthy"
+				break
+			} else if check.Status == "critical" {
+				health = "unhealthy"
+			}
+		}
+
+		instances = append(instances, &ServiceInstance{
+			ID:       cs.Service.ID,
+			Name:     cs.Service.Service,
+			Address:  cs.Service.Address,
+			Port:     cs.Service.Port,
+			Protocol: "http", // Default to http
+			Tags:     cs.Service.Tags,
+			Meta:     cs.Service.Meta,
+			Health:   health,
+		})
+	}
+
+	return instances, nil
+}
+
+func (c *ConsulDiscovery) Watch(serviceName string, callback func([]*ServiceInstance)) error {
+	logrus.WithField("service", serviceName).Info("Watching service changes in Consul")
+
+	go func() {
+		ticker := time.NewTicker(30 * time.Second) // Poll every 30 seconds
+		defer ticker.Stop()
+
+		var lastInstances []*ServiceInstance
+
+		for {
+			select {
+			case <-ticker.C:
+				instances, err := c.Discover(serviceName)
+				if err != nil {
+					logrus.WithError(err).Error("Failed to discover services during watch")
+					continue
+				}
+
+				// Check if instances have changed
+				if !instancesEqual(lastInstances, instances) {
+					lastInstances = instances
+					callback(instances)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close stops all TTL renewals; Consul drops the checks once their TTL expires
+func (c *ConsulDiscovery) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for id, cancel := range c.renewers {
+		cancel()
+		delete(c.renewers, id)
+	}
+	return nil
+}
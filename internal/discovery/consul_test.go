@@ -0,0 +1,131 @@
+package discovery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConsul records agent API calls and the ACL token they carried
+type fakeConsul struct {
+	mu            sync.Mutex
+	registrations []map[string]interface{}
+	passes        map[string]int
+	deregistered  []string
+	tokens        map[string]bool
+}
+
+func newFakeConsul(t *testing.T) (*fakeConsul, *httptest.Server) {
+	f := &fakeConsul{passes: make(map[string]int), tokens: make(map[string]bool)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.tokens[r.Header.Get(consulTokenHeader)] = true
+
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/agent/service/register":
+			var registration map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&registration); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			f.registrations = append(f.registrations, registration)
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/agent/check/pass/"):
+			f.passes[strings.TrimPrefix(r.URL.Path, "/v1/agent/check/pass/")]++
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+			f.deregistered = append(f.deregistered, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/health/service/ai-gateway":
+			w.Write([]byte(`[{"Service":{"ID":"gw-1","Service":"ai-gateway","Address":"10.0.0.1","Port":8080},"Checks":[{"Status":"passing"}]}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeConsul) passCount(checkID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.passes[checkID]
+}
+
+func TestConsulRegisterRenewsTTLCheck(t *testing.T) {
+	fake, srv := newFakeConsul(t)
+	c, err := NewConsulDiscovery(&config.ServiceDiscoveryConfig{
+		Endpoints: []string{srv.URL},
+		LeaseTTL:  40 * time.Millisecond,
+		ACLToken:  "initial-token",
+	})
+	require.NoError(t, err)
+	defer c.Close()
+	c.SetACLToken("acl-token")
+
+	require.NoError(t, c.Register(&ServiceInstance{ID: "gw-1", Name: "ai-gateway", Address: "10.0.0.1", Port: 8080, Protocol: "http"}))
+
+	fake.mu.Lock()
+	require.Len(t, fake.registrations, 1)
+	checks := fake.registrations[0]["Checks"].([]interface{})
+	fake.mu.Unlock()
+	require.Len(t, checks, 2)
+	ttlCheck := checks[1].(map[string]interface{})
+	assert.Equal(t, "service:gw-1:ttl", ttlCheck["CheckID"])
+	assert.Equal(t, "40ms", ttlCheck["TTL"])
+	assert.Equal(t, "http://10.0.0.1:8080/health", checks[0].(map[string]interface{})["HTTP"])
+
+	// Renewals run at half the TTL
+	require.Eventually(t, func() bool { return fake.passCount("service:gw-1:ttl") >= 3 }, 2*time.Second, 5*time.Millisecond)
+
+	require.NoError(t, c.Deregister("gw-1"))
+	time.Sleep(20 * time.Millisecond) // let a renewal already in flight land
+	stopped := fake.passCount("service:gw-1:ttl")
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, stopped, fake.passCount("service:gw-1:ttl"), "deregistering stops the renewal")
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	assert.Equal(t, []string{"gw-1"}, fake.deregistered)
+	assert.Equal(t, map[string]bool{"acl-token": true}, fake.tokens, "every request carries the ACL token")
+}
+
+func TestConsulDiscoverSendsToken(t *testing.T) {
+	fake, srv := newFakeConsul(t)
+	c, err := NewConsulDiscovery(&config.ServiceDiscoveryConfig{
+		Endpoints: []string{"http://127.0.0.1:1", srv.URL},
+		ACLToken:  "acl-token",
+	})
+	require.NoError(t, err)
+
+	instances, err := c.Discover("ai-gateway")
+	require.NoError(t, err, "an unreachable endpoint falls through to the next one")
+	require.Len(t, instances, 1)
+	assert.Equal(t, "gw-1", instances[0].ID)
+	assert.Equal(t, "healthy", instances[0].Health)
+	assert.True(t, fake.tokens["acl-token"])
+
+	_, err = c.Discover("unknown")
+	assert.Error(t, err)
+}
+
+func TestConsulCloseStopsRenewals(t *testing.T) {
+	fake, srv := newFakeConsul(t)
+	c, err := NewConsulDiscovery(&config.ServiceDiscoveryConfig{Endpoints: []string{srv.URL}, LeaseTTL: 20 * time.Millisecond})
+	require.NoError(t, err)
+	require.NoError(t, c.Register(&ServiceInstance{ID: "gw-2", Name: "ai-gateway", Protocol: "http"}))
+	require.Eventually(t, func() bool { return fake.passCount("service:gw-2:ttl") > 0 }, 2*time.Second, 5*time.Millisecond)
+
+	require.NoError(t, c.Close())
+	time.Sleep(20 * time.Millisecond)
+	stopped := fake.passCount("service:gw-2:ttl")
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, stopped, fake.passCount("service:gw-2:ttl"))
+}
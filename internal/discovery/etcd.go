@@ -0,0 +1,473 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/sirupsen/logrus"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+	"go.uber.org/zap"
+)
+
+// etcdRequestTimeout bounds single etcd calls
+const etcdRequestTimeout = 5 * time.Second
+
+// etcdStore is the part of etcd the discovery uses; tests substitute an in-memory store
+type etcdStore interface {
+	Grant(ctx context.Context, ttl int64) (clientv3.LeaseID, error)
+	Put(ctx context.Context, key, value string, lease clientv3.LeaseID) error
+	Revoke(ctx context.Context, lease clientv3.LeaseID) error
+	KeepAlive(ctx context.Context, lease clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error)
+	// List returns the values under prefix in key order and the revision they were read at
+	List(ctx context.Context, prefix string) (values [][]byte, revision int64, err error)
+	// Watch reports changes under prefix from revision on
+	Watch(ctx context.Context, prefix string, revision int64) clientv3.WatchChan
+	Close() error
+}
+
+// etcdCampaign blocks until this gateway leads the election of a
+// service. lost is closed when leadership ends; resign gives it up.
+type etcdCampaign func(ctx context.Context, serviceName string) (lost <-chan struct{}, resign func(), err error)
+
+// EtcdDiscovery 基于 etcd v3 的服务发现。实例以 JSON 存放在 /<namespace>/services/<name>/<id>，
+// 绑定租约并由后台协程续约；进程退出或租约过期后实例自动消失。
+type EtcdDiscovery struct {
+	config   *config.ServiceDiscoveryConfig
+	store    etcdStore
+	campaign etcdCampaign // nil makes this gateway the leader of every service
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	mutex         sync.Mutex
+	registrations map[string]*etcdRegistration // by instance ID
+	wg            sync.WaitGroup
+	closeOnce     sync.Once
+	closeErr      error
+}
+
+// etcdRegistration is a registered instance and the lease keeping it alive
+type etcdRegistration struct {
+	instance *ServiceInstance
+	lease    clientv3.LeaseID
+}
+
+// NewEtcdDiscovery connects to the configured etcd endpoints. Keep-alives and
+// watchers stop, and registrations are revoked, when ctx is done or on Close.
+func NewEtcdDiscovery(ctx context.Context, cfg *config.ServiceDiscoveryConfig) (*EtcdDiscovery, error) {
+	var endpoints []string
+	for _, endpoint := range cfg.Endpoints {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("etcd discovery requires at least one endpoint")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: etcdRequestTimeout,
+		Logger:      zap.NewNop(), // errors are reported through logrus by the callers
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create etcd client: %w", err)
+	}
+
+	e := newEtcdDiscovery(ctx, cfg, &clientStore{client: client})
+	e.campaign = electionCampaign(client, cfg)
+	return e, nil
+}
+
+func newEtcdDiscovery(ctx context.Context, cfg *config.ServiceDiscoveryConfig, store etcdStore) *EtcdDiscovery {
+	e := &EtcdDiscovery{
+		config:        cfg,
+		store:         store,
+		registrations: make(map[string]*etcdRegistration),
+	}
+	e.ctx, e.cancel = context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			e.Close()
+		case <-e.ctx.Done():
+		}
+	}()
+	return e
+}
+
+// servicePrefix is the key prefix of all instances of a service
+func (e *EtcdDiscovery) servicePrefix(serviceName string) string {
+	return fmt.Sprintf("/%s/services/%s/", e.config.Namespace, serviceName)
+}
+
+func (e *EtcdDiscovery) instanceKey(instance *ServiceInstance) string {
+	return e.servicePrefix(instance.Name) + instance.ID
+}
+
+// leaseTTL returns the lease TTL in whole seconds, at least one
+func (e *EtcdDiscovery) leaseTTL() int64 {
+	if ttl := int64(e.config.LeaseTTL / time.Second); ttl > 0 {
+		return ttl
+	}
+	return 1
+}
+
+func (e *EtcdDiscovery) Register(instance *ServiceInstance) error {
+	logrus.WithField("instance", instance.ID).Info("Registering service with etcd")
+
+	lease, err := e.put(instance)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	previous := e.registrations[instance.ID]
+	e.registrations[instance.ID] = &etcdRegistration{instance: instance, lease: lease}
+	e.mutex.Unlock()
+	if previous != nil {
+		// A re-registration replaces the earlier lease
+		e.revoke(previous.lease)
+	}
+
+	e.wg.Add(1)
+	go e.keepAlive(instance.ID, lease)
+	return nil
+}
+
+// put writes an instance under a new lease
+func (e *EtcdDiscovery) put(instance *ServiceInstance) (clientv3.LeaseID, error) {
+	data, err := json.Marshal(instance)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal instance: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(e.ctx, etcdRequestTimeout)
+	defer cancel()
+	lease, err := e.store.Grant(ctx, e.leaseTTL())
+	if err != nil {
+		return 0, fmt.Errorf("failed to grant etcd lease: %w", err)
+	}
+	if err := e.store.Put(ctx, e.instanceKey(instance), string(data), lease); err != nil {
+		e.revoke(lease)
+		return 0, fmt.Errorf("failed to register instance in etcd: %w", err)
+	}
+	return lease, nil
+}
+
+// keepAlive refreshes an instance's lease until it is deregistered or the
+// discovery shuts down. A lease lost while etcd was unreachable is replaced by
+// registering the instance again.
+func (e *EtcdDiscovery) keepAlive(instanceID string, lease clientv3.LeaseID) {
+	defer e.wg.Done()
+
+	retry := time.Duration(e.leaseTTL()) * time.Second / 3
+	for {
+		responses, err := e.store.KeepAlive(e.ctx, lease)
+		if err == nil {
+			for range responses {
+			}
+		}
+		if e.ctx.Err() != nil {
+			return
+		}
+
+		// The channel closes when the lease expires or is revoked
+		e.mutex.Lock()
+		registration, ok := e.registrations[instanceID]
+		current := ok && registration.lease == lease
+		e.mutex.Unlock()
+		if !current {
+			return
+		}
+		logrus.WithField("instance", instanceID).Warn("etcd lease lost, registering instance again")
+
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+		newLease, err := e.put(registration.instance)
+		if err != nil {
+			logrus.WithError(err).WithField("instance", instanceID).Warn("Failed to register instance again")
+			continue
+		}
+
+		e.mutex.Lock()
+		if registration, ok = e.registrations[instanceID]; !ok || registration.lease != lease {
+			// Deregistered or replaced while the new lease was granted
+			e.mutex.Unlock()
+			e.revoke(newLease)
+			return
+		}
+		registration.lease = newLease
+		e.mutex.Unlock()
+		lease = newLease
+	}
+}
+
+// revoke revokes a lease, deleting the keys attached to it
+func (e *EtcdDiscovery) revoke(lease clientv3.LeaseID) error {
+	// The discovery context may already be done during shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+	defer cancel()
+	return e.store.Revoke(ctx, lease)
+}
+
+func (e *EtcdDiscovery) Deregister(instanceID string) error {
+	logrus.WithField("instance", instanceID).Info("Deregistering service from etcd")
+
+	e.mutex.Lock()
+	registration, ok := e.registrations[instanceID]
+	delete(e.registrations, instanceID)
+	e.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("instance %s is not registered", instanceID)
+	}
+
+	if err := e.revoke(registration.lease); err != nil {
+		return fmt.Errorf("failed to revoke etcd lease: %w", err)
+	}
+	return nil
+}
+
+func (e *EtcdDiscovery) Discover(serviceName string) ([]*ServiceInstance, error) {
+	logrus.WithField("service", serviceName).Debug("Discovering services from etcd")
+
+	instances, _, err := e.list(serviceName)
+	return instances, err
+}
+
+// list returns the instances of a service and the revision they were read at
+func (e *EtcdDiscovery) list(serviceName string) ([]*ServiceInstance, int64, error) {
+	ctx, cancel := context.WithTimeout(e.ctx, etcdRequestTimeout)
+	defer cancel()
+	values, revision, err := e.store.List(ctx, e.servicePrefix(serviceName))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to discover services from etcd: %w", err)
+	}
+
+	instances := make([]*ServiceInstance, 0, len(values))
+	for _, value := range values {
+		var instance ServiceInstance
+		if err := json.Unmarshal(value, &instance); err != nil {
+			logrus.WithError(err).WithField("service", serviceName).Warn("Skipping unreadable etcd instance")
+			continue
+		}
+		instances = append(instances, &instance)
+	}
+	return instances, revision, nil
+}
+
+// Watch calls callback with the current instances of a service whenever one is
+// put or deleted. Every gateway watches so each keeps its own view current;
+// work that must happen once per service across gateways belongs in Lead.
+func (e *EtcdDiscovery) Watch(serviceName string, callback func([]*ServiceInstance)) error {
+	logrus.WithField("service", serviceName).Info("Watching service changes in etcd")
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		for e.ctx.Err() == nil {
+			if err := e.watch(serviceName, callback); err != nil && e.ctx.Err() == nil {
+				logrus.WithError(err).WithField("service", serviceName).Warn("etcd watch interrupted, retrying")
+				e.pause()
+			}
+		}
+	}()
+	return nil
+}
+
+// watch reports the service's instances, then every change, until the watch is lost
+func (e *EtcdDiscovery) watch(serviceName string, callback func([]*ServiceInstance)) error {
+	instances, revision, err := e.list(serviceName)
+	if err != nil {
+		return err
+	}
+	callback(instances)
+
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+	events := e.store.Watch(ctx, e.servicePrefix(serviceName), revision+1)
+	for resp := range events {
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		changed := false
+		for _, event := range resp.Events {
+			if event.Type == clientv3.EventTypePut || event.Type == clientv3.EventTypeDelete {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+		instances, _, err := e.list(serviceName)
+		if err != nil {
+			return err
+		}
+		callback(instances)
+	}
+	return e.ctx.Err()
+}
+
+// Lead runs task on one gateway per service. Gateways elect a leader for the
+// service; the others stand by and take over when the leader's session ends.
+// task's context is cancelled when leadership is lost or the discovery shuts
+// down. A task returning early keeps leadership, so it runs once per term.
+func (e *EtcdDiscovery) Lead(serviceName string, task func(ctx context.Context)) {
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		for e.ctx.Err() == nil {
+			if err := e.lead(serviceName, task); err != nil && e.ctx.Err() == nil {
+				logrus.WithError(err).WithField("service", serviceName).Warn("etcd leadership lost, campaigning again")
+				e.pause()
+			}
+		}
+	}()
+}
+
+// lead campaigns for the service's election and, once elected, runs task
+// until leadership is lost
+func (e *EtcdDiscovery) lead(serviceName string, task func(ctx context.Context)) error {
+	ctx, cancel := context.WithCancel(e.ctx)
+	defer cancel()
+	if e.campaign != nil {
+		lost, resign, err := e.campaign(e.ctx, serviceName)
+		if err != nil {
+			return err
+		}
+		defer resign()
+		go func() {
+			select {
+			case <-lost:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+	logrus.WithField("service", serviceName).Info("Elected etcd leader")
+
+	task(ctx)
+	<-ctx.Done()
+	if e.ctx.Err() != nil {
+		return e.ctx.Err()
+	}
+	return fmt.Errorf("etcd session expired")
+}
+
+// pause waits before retrying an etcd operation
+func (e *EtcdDiscovery) pause() {
+	select {
+	case <-e.ctx.Done():
+	case <-time.After(time.Second):
+	}
+}
+
+// Close revokes this gateway's registrations, stops keep-alives and watchers
+// and closes the client; it is safe to call more than once
+func (e *EtcdDiscovery) Close() error {
+	e.closeOnce.Do(func() {
+		e.cancel()
+		e.wg.Wait()
+
+		e.mutex.Lock()
+		registrations := e.registrations
+		e.registrations = make(map[string]*etcdRegistration)
+		e.mutex.Unlock()
+		for id, registration := range registrations {
+			if err := e.revoke(registration.lease); err != nil {
+				logrus.WithError(err).WithField("instance", id).Warn("Failed to revoke etcd lease on shutdown")
+			}
+		}
+
+		e.closeErr = e.store.Close()
+	})
+	return e.closeErr
+}
+
+// electionCampaign elects leaders through etcd sessions under
+// /<namespace>/elections/<name>
+func electionCampaign(client *clientv3.Client, cfg *config.ServiceDiscoveryConfig) etcdCampaign {
+	hostname, _ := os.Hostname()
+	id := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	ttl := int(cfg.LeaseTTL / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+
+	return func(ctx context.Context, serviceName string) (<-chan struct{}, func(), error) {
+		session, err := concurrency.NewSession(client, concurrency.WithTTL(ttl), concurrency.WithContext(ctx))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create etcd session: %w", err)
+		}
+		election := concurrency.NewElection(session, fmt.Sprintf("/%s/elections/%s", cfg.Namespace, serviceName))
+		if err := election.Campaign(ctx, id); err != nil {
+			session.Close()
+			return nil, nil, fmt.Errorf("failed to campaign for leadership: %w", err)
+		}
+		resign := func() {
+			resignCtx, cancel := context.WithTimeout(context.Background(), etcdRequestTimeout)
+			defer cancel()
+			election.Resign(resignCtx)
+			session.Close()
+		}
+		return session.Done(), resign, nil
+	}
+}
+
+// clientStore adapts the etcd client to etcdStore
+type clientStore struct {
+	client *clientv3.Client
+}
+
+func (s *clientStore) Grant(ctx context.Context, ttl int64) (clientv3.LeaseID, error) {
+	resp, err := s.client.Grant(ctx, ttl)
+	if err != nil {
+		return 0, err
+	}
+	return resp.ID, nil
+}
+
+func (s *clientStore) Put(ctx context.Context, key, value string, lease clientv3.LeaseID) error {
+	_, err := s.client.Put(ctx, key, value, clientv3.WithLease(lease))
+	return err
+}
+
+func (s *clientStore) Revoke(ctx context.Context, lease clientv3.LeaseID) error {
+	_, err := s.client.Revoke(ctx, lease)
+	return err
+}
+
+func (s *clientStore) KeepAlive(ctx context.Context, lease clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	return s.client.KeepAlive(ctx, lease)
+}
+
+func (s *clientStore) List(ctx context.Context, prefix string) ([][]byte, int64, error) {
+	resp, err := s.client.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+	values := make([][]byte, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		values = append(values, kv.Value)
+	}
+	return values, resp.Header.Revision, nil
+}
+
+func (s *clientStore) Watch(ctx context.Context, prefix string, revision int64) clientv3.WatchChan {
+	return s.client.Watch(clientv3.WithRequireLeader(ctx), prefix, clientv3.WithPrefix(), clientv3.WithRev(revision))
+}
+
+func (s *clientStore) Close() error {
+	return s.client.Close()
+}
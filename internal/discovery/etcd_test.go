@@ -0,0 +1,352 @@
+package discovery
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeEtcd is an in-memory etcdStore with leases and prefix watches
+type fakeEtcd struct {
+	mu         sync.Mutex
+	revision   int64
+	nextLease  clientv3.LeaseID
+	values     map[string][]byte
+	leaseOf    map[string]clientv3.LeaseID
+	keepAlives map[clientv3.LeaseID][]chan *clientv3.LeaseKeepAliveResponse
+	watchers   map[chan clientv3.WatchResponse]string
+	closed     bool
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{
+		values:     make(map[string][]byte),
+		leaseOf:    make(map[string]clientv3.LeaseID),
+		keepAlives: make(map[clientv3.LeaseID][]chan *clientv3.LeaseKeepAliveResponse),
+		watchers:   make(map[chan clientv3.WatchResponse]string),
+	}
+}
+
+func (f *fakeEtcd) Grant(ctx context.Context, ttl int64) (clientv3.LeaseID, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nextLease++
+	f.keepAlives[f.nextLease] = nil
+	return f.nextLease, nil
+}
+
+func (f *fakeEtcd) Put(ctx context.Context, key, value string, lease clientv3.LeaseID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.values[key] = []byte(value)
+	f.leaseOf[key] = lease
+	f.notify(key, clientv3.EventTypePut)
+	return nil
+}
+
+func (f *fakeEtcd) Revoke(ctx context.Context, lease clientv3.LeaseID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expire(lease)
+	return nil
+}
+
+// expire deletes the lease's keys and ends its keep-alives; callers hold f.mu
+func (f *fakeEtcd) expire(lease clientv3.LeaseID) {
+	for key, owner := range f.leaseOf {
+		if owner == lease {
+			delete(f.values, key)
+			delete(f.leaseOf, key)
+			f.notify(key, clientv3.EventTypeDelete)
+		}
+	}
+	for _, ch := range f.keepAlives[lease] {
+		close(ch)
+	}
+	delete(f.keepAlives, lease)
+}
+
+func (f *fakeEtcd) KeepAlive(ctx context.Context, lease clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan *clientv3.LeaseKeepAliveResponse)
+	if _, alive := f.keepAlives[lease]; !alive {
+		close(ch)
+		return ch, nil
+	}
+	f.keepAlives[lease] = append(f.keepAlives[lease], ch)
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for i, existing := range f.keepAlives[lease] {
+			if existing == ch {
+				f.keepAlives[lease] = append(f.keepAlives[lease][:i], f.keepAlives[lease][i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (f *fakeEtcd) List(ctx context.Context, prefix string) ([][]byte, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for key := range f.values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	values := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, f.values[key])
+	}
+	return values, f.revision, nil
+}
+
+func (f *fakeEtcd) Watch(ctx context.Context, prefix string, revision int64) clientv3.WatchChan {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan clientv3.WatchResponse, 16)
+	f.watchers[ch] = prefix
+	go func() {
+		<-ctx.Done()
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		delete(f.watchers, ch)
+		close(ch)
+	}()
+	return ch
+}
+
+// notify sends an event to the watchers of key; callers hold f.mu
+func (f *fakeEtcd) notify(key string, eventType mvccpb.Event_EventType) {
+	f.revision++
+	for ch, prefix := range f.watchers {
+		if strings.HasPrefix(key, prefix) {
+			ch <- clientv3.WatchResponse{Events: []*clientv3.Event{{Type: eventType}}}
+		}
+	}
+}
+
+func (f *fakeEtcd) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return nil
+}
+
+func (f *fakeEtcd) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for key := range f.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func newFakeEtcdDiscovery(t *testing.T) (*EtcdDiscovery, *fakeEtcd) {
+	store := newFakeEtcd()
+	e := newEtcdDiscovery(context.Background(), &config.ServiceDiscoveryConfig{
+		Namespace: "gateway",
+		LeaseTTL:  time.Second,
+	}, store)
+	t.Cleanup(func() { e.Close() })
+	return e, store
+}
+
+func TestEtcdDiscoveryRegisterDiscoverDeregister(t *testing.T) {
+	e, store := newFakeEtcdDiscovery(t)
+
+	require.NoError(t, e.Register(&ServiceInstance{ID: "a", Name: "llm", Address: "10.0.0.1", Port: 8000}))
+	require.NoError(t, e.Register(&ServiceInstance{ID: "b", Name: "llm", Address: "10.0.0.2", Port: 8000}))
+	require.NoError(t, e.Register(&ServiceInstance{ID: "c", Name: "embeddings", Address: "10.0.0.3", Port: 8000}))
+	assert.Equal(t, []string{
+		"/gateway/services/embeddings/c",
+		"/gateway/services/llm/a",
+		"/gateway/services/llm/b",
+	}, store.keys())
+
+	instances, err := e.Discover("llm")
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+	assert.Equal(t, "10.0.0.1", instances[0].Address)
+
+	require.NoError(t, e.Deregister("a"))
+	instances, err = e.Discover("llm")
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	assert.Equal(t, "b", instances[0].ID)
+	assert.Error(t, e.Deregister("a"), "a revoked instance is no longer registered")
+}
+
+func TestEtcdDiscoveryWatchReportsChanges(t *testing.T) {
+	e, _ := newFakeEtcdDiscovery(t)
+	require.NoError(t, e.Register(&ServiceInstance{ID: "a", Name: "llm"}))
+
+	updates := make(chan []*ServiceInstance, 8)
+	require.NoError(t, e.Watch("llm", func(instances []*ServiceInstance) { updates <- instances }))
+	next := func() []*ServiceInstance {
+		select {
+		case instances := <-updates:
+			return instances
+		case <-time.After(time.Second):
+			t.Fatal("no watch callback")
+			return nil
+		}
+	}
+
+	assert.Len(t, next(), 1, "the watcher starts with the current instances")
+	require.NoError(t, e.Register(&ServiceInstance{ID: "b", Name: "llm"}))
+	assert.Len(t, next(), 2)
+	require.NoError(t, e.Deregister("a"))
+	instances := next()
+	require.Len(t, instances, 1)
+	assert.Equal(t, "b", instances[0].ID)
+}
+
+// fakeElection elects one campaigner per service; expire ends the leader's session
+type fakeElection struct {
+	mu      sync.Mutex
+	tokens  map[string]chan struct{}
+	leaders map[string]chan struct{} // lost channel of the current leader
+}
+
+func newFakeElection() *fakeElection {
+	return &fakeElection{tokens: make(map[string]chan struct{}), leaders: make(map[string]chan struct{})}
+}
+
+func (f *fakeElection) campaign(ctx context.Context, serviceName string) (<-chan struct{}, func(), error) {
+	f.mu.Lock()
+	token, ok := f.tokens[serviceName]
+	if !ok {
+		token = make(chan struct{}, 1)
+		f.tokens[serviceName] = token
+	}
+	f.mu.Unlock()
+
+	select {
+	case token <- struct{}{}:
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+	lost := make(chan struct{})
+	f.mu.Lock()
+	f.leaders[serviceName] = lost
+	f.mu.Unlock()
+	var once sync.Once
+	resign := func() { once.Do(func() { <-token }) }
+	return lost, resign, nil
+}
+
+func (f *fakeElection) expire(serviceName string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	close(f.leaders[serviceName])
+}
+
+func TestEtcdDiscoveryEveryGatewayWatchesOneLeads(t *testing.T) {
+	store := newFakeEtcd()
+	election := newFakeElection()
+	gateways := make([]*EtcdDiscovery, 2)
+	for i := range gateways {
+		gateways[i] = newEtcdDiscovery(context.Background(), &config.ServiceDiscoveryConfig{
+			Namespace: "gateway",
+			LeaseTTL:  time.Second,
+		}, store)
+		gateways[i].campaign = election.campaign
+		t.Cleanup(func() { gateways[i].Close() })
+	}
+
+	var mu sync.Mutex
+	seen := make([]int, len(gateways))
+	running := make([]bool, len(gateways))
+	for i, e := range gateways {
+		require.NoError(t, e.Watch("llm", func(instances []*ServiceInstance) {
+			mu.Lock()
+			seen[i] = len(instances)
+			mu.Unlock()
+		}))
+		e.Lead("llm", func(ctx context.Context) {
+			mu.Lock()
+			running[i] = true
+			mu.Unlock()
+			<-ctx.Done()
+			mu.Lock()
+			running[i] = false
+			mu.Unlock()
+		})
+	}
+	leaders := func() (count, index int) {
+		mu.Lock()
+		defer mu.Unlock()
+		for i, r := range running {
+			if r {
+				count, index = count+1, i
+			}
+		}
+		return count, index
+	}
+
+	require.NoError(t, gateways[0].Register(&ServiceInstance{ID: "a", Name: "llm"}))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen[0] == 1 && seen[1] == 1
+	}, time.Second, 10*time.Millisecond, "followers receive changes as well")
+
+	require.Eventually(t, func() bool { count, _ := leaders(); return count == 1 }, time.Second, 10*time.Millisecond)
+	_, first := leaders()
+	assert.Never(t, func() bool { count, _ := leaders(); return count > 1 }, 100*time.Millisecond, 10*time.Millisecond)
+
+	// The standby takes over once the leader's session ends
+	election.expire("llm")
+	assert.Eventually(t, func() bool {
+		count, index := leaders()
+		return count == 1 && index != first
+	}, 3*time.Second, 10*time.Millisecond)
+}
+
+func TestEtcdDiscoveryReregistersLostLease(t *testing.T) {
+	e, store := newFakeEtcdDiscovery(t)
+	require.NoError(t, e.Register(&ServiceInstance{ID: "a", Name: "llm"}))
+
+	store.mu.Lock()
+	store.expire(store.leaseOf["/gateway/services/llm/a"])
+	store.mu.Unlock()
+	assert.Empty(t, store.keys())
+
+	assert.Eventually(t, func() bool {
+		return len(store.keys()) == 1
+	}, 2*time.Second, 20*time.Millisecond, "the keep-alive registers the instance again")
+}
+
+func TestEtcdDiscoveryCloseRevokesAndStops(t *testing.T) {
+	e, store := newFakeEtcdDiscovery(t)
+	require.NoError(t, e.Register(&ServiceInstance{ID: "a", Name: "llm"}))
+	require.NoError(t, e.Watch("llm", func([]*ServiceInstance) {}))
+
+	require.NoError(t, e.Close())
+	assert.Empty(t, store.keys(), "registrations are revoked")
+	assert.Eventually(t, func() bool {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		return len(store.watchers) == 0 && store.closed
+	}, time.Second, 10*time.Millisecond, "watches are cancelled and the client closed")
+	require.NoError(t, e.Close(), "Close is idempotent")
+}
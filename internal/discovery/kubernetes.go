@@ -0,0 +1,362 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/sirupsen/logrus"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	// kubernetesRequestTimeout bounds single API server calls
+	kubernetesRequestTimeout = 10 * time.Second
+
+	// registeredLabel marks the pod of a gateway registered with the discovery
+	registeredLabel = "ai-gateway/registered"
+)
+
+// KubernetesDiscovery 基于 EndpointSlice 的服务发现。服务 <name> 的实例是命名空间内
+// 带 app=<name> 标签的 EndpointSlice 中的端点；Register 给网关自身的 Pod 打上
+// ai-gateway/registered 标签，最后一个实例注销或 Close 时移除。
+//
+// The gateway's service account needs the following role, bound with a
+// ClusterRoleBinding (or a RoleBinding in the discovery namespace):
+//
+//	apiVersion: rbac.authorization.k8s.io/v1
+//	kind: ClusterRole
+//	metadata:
+//	  name: ai-gateway-discovery
+//	rules:
+//	  - apiGroups: ["discovery.k8s.io"]
+//	    resources: ["endpointslices"]
+//	    verbs: ["get", "list", "watch"]
+//	  - apiGroups: [""]
+//	    resources: ["pods"]
+//	    verbs: ["patch"]
+//
+// The pod's own name and namespace come from the POD_NAME and POD_NAMESPACE
+// environment variables (set them through the downward API); the pod name
+// falls back to the hostname and the namespace to the discovery namespace.
+type KubernetesDiscovery struct {
+	config       *config.ServiceDiscoveryConfig
+	client       kubernetes.Interface
+	podName      string
+	podNamespace string
+	ctx          context.Context
+	cancel       context.CancelFunc
+
+	mutex         sync.Mutex
+	registrations map[string]bool // registered instance IDs
+	wg            sync.WaitGroup
+	closeOnce     sync.Once
+}
+
+// NewKubernetesDiscovery connects to the API server through the configured
+// kubeconfig, or the in-cluster config when none is set. Watchers stop, and
+// the registration label is removed, when ctx is done or on Close.
+func NewKubernetesDiscovery(ctx context.Context, cfg *config.ServiceDiscoveryConfig) (*KubernetesDiscovery, error) {
+	var restConfig *rest.Config
+	var err error
+	if cfg.Kubeconfig != "" {
+		restConfig, err = clientcmd.BuildConfigFromFlags("", cfg.Kubeconfig)
+	} else {
+		restConfig, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubernetes config: %w", err)
+	}
+
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	podName := os.Getenv("POD_NAME")
+	if podName == "" {
+		podName, _ = os.Hostname()
+	}
+	return newKubernetesDiscovery(ctx, cfg, client, podName, os.Getenv("POD_NAMESPACE")), nil
+}
+
+func newKubernetesDiscovery(ctx context.Context, cfg *config.ServiceDiscoveryConfig, client kubernetes.Interface, podName, podNamespace string) *KubernetesDiscovery {
+	if podNamespace == "" {
+		podNamespace = cfg.Namespace
+	}
+	k := &KubernetesDiscovery{
+		config:        cfg,
+		client:        client,
+		podName:       podName,
+		podNamespace:  podNamespace,
+		registrations: make(map[string]bool),
+	}
+	k.ctx, k.cancel = context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			k.Close()
+		case <-k.ctx.Done():
+		}
+	}()
+	return k
+}
+
+// serviceSelector selects the endpoint slices of a service
+func serviceSelector(serviceName string) (labels.Selector, error) {
+	selector, err := labels.ValidatedSelectorFromSet(labels.Set{"app": serviceName})
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubernetes service name %q: %w", serviceName, err)
+	}
+	return selector, nil
+}
+
+// Register labels the gateway's own pod as registered. Several instances may
+// be registered; the label stays until the last one is deregistered.
+func (k *KubernetesDiscovery) Register(instance *ServiceInstance) error {
+	logrus.WithField("instance", instance.ID).Info("Registering service with Kubernetes")
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if err := k.labelPod(true); err != nil {
+		return err
+	}
+	k.registrations[instance.ID] = true
+	return nil
+}
+
+func (k *KubernetesDiscovery) Deregister(instanceID string) error {
+	logrus.WithField("instance", instanceID).Info("Deregistering service from Kubernetes")
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if !k.registrations[instanceID] {
+		return fmt.Errorf("instance %s is not registered", instanceID)
+	}
+	delete(k.registrations, instanceID)
+	if len(k.registrations) > 0 {
+		return nil
+	}
+	return k.labelPod(false)
+}
+
+// labelPod sets or removes the registration label of the gateway's pod
+func (k *KubernetesDiscovery) labelPod(registered bool) error {
+	if k.podName == "" {
+		return fmt.Errorf("cannot determine the gateway's pod name, set POD_NAME")
+	}
+
+	var value interface{} // null removes the label in a merge patch
+	if registered {
+		value = "true"
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{registeredLabel: value},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal pod patch: %w", err)
+	}
+
+	// The discovery context may already be done during shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), kubernetesRequestTimeout)
+	defer cancel()
+	_, err = k.client.CoreV1().Pods(k.podNamespace).Patch(ctx, k.podName, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to patch pod %s/%s: %w", k.podNamespace, k.podName, err)
+	}
+	return nil
+}
+
+func (k *KubernetesDiscovery) Discover(serviceName string) ([]*ServiceInstance, error) {
+	logrus.WithField("service", serviceName).Debug("Discovering services from Kubernetes")
+
+	selector, err := serviceSelector(serviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(k.ctx, kubernetesRequestTimeout)
+	defer cancel()
+	list, err := k.client.DiscoveryV1().EndpointSlices(k.config.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover services from kubernetes: %w", err)
+	}
+
+	slices := make([]*discoveryv1.EndpointSlice, len(list.Items))
+	for i := range list.Items {
+		slices[i] = &list.Items[i]
+	}
+	return endpointSliceInstances(serviceName, slices), nil
+}
+
+// Watch calls callback with the current instances of a service once the
+// informer has synced, then whenever one of its endpoint slices is added,
+// updated or deleted and the instances changed
+func (k *KubernetesDiscovery) Watch(serviceName string, callback func([]*ServiceInstance)) error {
+	logrus.WithField("service", serviceName).Info("Watching service changes in Kubernetes")
+
+	selector, err := serviceSelector(serviceName)
+	if err != nil {
+		return err
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(k.client, 0,
+		informers.WithNamespace(k.config.Namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = selector.String()
+		}),
+	)
+	informer := factory.Discovery().V1().EndpointSlices()
+	lister := informer.Lister().EndpointSlices(k.config.Namespace)
+
+	var (
+		mutex    sync.Mutex
+		last     []*ServiceInstance
+		notified bool
+		synced   atomic.Bool
+	)
+	notify := func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		slices, err := lister.List(selector)
+		if err != nil {
+			logrus.WithError(err).WithField("service", serviceName).Warn("Failed to list cached endpoint slices")
+			return
+		}
+		instances := endpointSliceInstances(serviceName, slices)
+		if notified && instancesEqual(last, instances) {
+			return
+		}
+		last, notified = instances, true
+		callback(instances)
+	}
+	// Events of the initial list are folded into the notification after the sync
+	onEvent := func(interface{}) {
+		if synced.Load() {
+			notify()
+		}
+	}
+	if _, err := informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    onEvent,
+		UpdateFunc: func(_, obj interface{}) { onEvent(obj) },
+		DeleteFunc: onEvent,
+	}); err != nil {
+		return fmt.Errorf("failed to watch endpoint slices: %w", err)
+	}
+
+	k.wg.Add(1)
+	go func() {
+		defer k.wg.Done()
+		defer factory.Shutdown()
+
+		factory.Start(k.ctx.Done())
+		if !cache.WaitForCacheSync(k.ctx.Done(), informer.Informer().HasSynced) {
+			return
+		}
+		synced.Store(true)
+		notify()
+		<-k.ctx.Done()
+	}()
+	return nil
+}
+
+// endpointSliceInstances returns one instance per endpoint and port, sorted by ID
+func endpointSliceInstances(serviceName string, slices []*discoveryv1.EndpointSlice) []*ServiceInstance {
+	instances := []*ServiceInstance{}
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			if len(endpoint.Addresses) == 0 {
+				continue
+			}
+			// Consumers use the first address; the others are equivalent
+			address := endpoint.Addresses[0]
+			target := address
+			meta := map[string]string{
+				"namespace":     slice.Namespace,
+				"endpointslice": slice.Name,
+			}
+			if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+				target = endpoint.TargetRef.Name
+				meta["pod"] = endpoint.TargetRef.Name
+			}
+			if endpoint.NodeName != nil {
+				meta["node"] = *endpoint.NodeName
+			}
+			// A nil ready condition means unknown, which consumers treat as ready
+			health := "healthy"
+			if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+				health = "unhealthy"
+			}
+
+			for _, port := range slice.Ports {
+				if port.Port == nil {
+					continue
+				}
+				protocol := "http"
+				if port.AppProtocol != nil && *port.AppProtocol != "" {
+					protocol = *port.AppProtocol
+				}
+				instanceMeta := make(map[string]string, len(meta)+1)
+				for key, value := range meta {
+					instanceMeta[key] = value
+				}
+				if port.Name != nil && *port.Name != "" {
+					instanceMeta["port_name"] = *port.Name
+				}
+				instances = append(instances, &ServiceInstance{
+					ID:       fmt.Sprintf("%s:%d", target, *port.Port),
+					Name:     serviceName,
+					Address:  address,
+					Port:     int(*port.Port),
+					Protocol: protocol,
+					Meta:     instanceMeta,
+					Health:   health,
+				})
+			}
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances
+}
+
+// Close stops the watchers and removes the registration label; it is safe to
+// call more than once
+func (k *KubernetesDiscovery) Close() error {
+	k.closeOnce.Do(func() {
+		k.cancel()
+		k.wg.Wait()
+
+		k.mutex.Lock()
+		defer k.mutex.Unlock()
+		if len(k.registrations) == 0 {
+			return
+		}
+		k.registrations = make(map[string]bool)
+		if err := k.labelPod(false); err != nil {
+			logrus.WithError(err).Warn("Failed to remove the registration label on shutdown")
+		}
+	})
+	return nil
+}
@@ -0,0 +1,171 @@
+package discovery
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newFakeKubernetesDiscovery(t *testing.T, objects ...runtime.Object) (*KubernetesDiscovery, *fake.Clientset) {
+	client := fake.NewClientset(objects...)
+	k := newKubernetesDiscovery(context.Background(), &config.ServiceDiscoveryConfig{
+		Namespace: "ai",
+	}, client, "gateway-0", "")
+	t.Cleanup(func() { k.Close() })
+	return k, client
+}
+
+func endpointSlice(name, app string, endpoints ...discoveryv1.Endpoint) *discoveryv1.EndpointSlice {
+	port, portName, appProtocol := int32(8000), "http", "http"
+	return &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "ai",
+			Labels:    map[string]string{"app": app},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints:   endpoints,
+		Ports:       []discoveryv1.EndpointPort{{Name: &portName, Port: &port, AppProtocol: &appProtocol}},
+	}
+}
+
+func podEndpoint(pod, address string, ready bool) discoveryv1.Endpoint {
+	return discoveryv1.Endpoint{
+		Addresses:  []string{address},
+		Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		TargetRef:  &corev1.ObjectReference{Kind: "Pod", Name: pod, Namespace: "ai"},
+	}
+}
+
+func TestKubernetesDiscoverListsLabelledEndpointSlices(t *testing.T) {
+	other := endpointSlice("llm-other-ns", "llm", podEndpoint("llm-x", "10.1.0.9", true))
+	other.Namespace = "default"
+	k, _ := newFakeKubernetesDiscovery(t,
+		endpointSlice("llm-abc", "llm",
+			podEndpoint("llm-1", "10.1.0.2", false),
+			podEndpoint("llm-0", "10.1.0.1", true),
+		),
+		endpointSlice("embeddings-abc", "embeddings", podEndpoint("embeddings-0", "10.1.0.3", true)),
+		other,
+	)
+
+	instances, err := k.Discover("llm")
+	require.NoError(t, err)
+	require.Len(t, instances, 2, "only slices labelled app=llm in the discovery namespace")
+	assert.Equal(t, &ServiceInstance{
+		ID:       "llm-0:8000",
+		Name:     "llm",
+		Address:  "10.1.0.1",
+		Port:     8000,
+		Protocol: "http",
+		Meta: map[string]string{
+			"namespace":     "ai",
+			"endpointslice": "llm-abc",
+			"pod":           "llm-0",
+			"port_name":     "http",
+		},
+		Health: "healthy",
+	}, instances[0])
+	assert.Equal(t, "llm-1:8000", instances[1].ID)
+	assert.Equal(t, "unhealthy", instances[1].Health, "endpoints that are not ready are reported unhealthy")
+
+	instances, err = k.Discover("unknown")
+	require.NoError(t, err)
+	assert.Empty(t, instances)
+	_, err = k.Discover("not a label value")
+	assert.Error(t, err)
+}
+
+func TestKubernetesWatchReportsSliceEvents(t *testing.T) {
+	k, client := newFakeKubernetesDiscovery(t, endpointSlice("llm-abc", "llm", podEndpoint("llm-0", "10.1.0.1", true)))
+	// The fake clientset drops events sent before the informer's watch starts
+	watching := make(chan struct{})
+	var once sync.Once
+	client.PrependWatchReactor("endpointslices", func(k8stesting.Action) (bool, watch.Interface, error) {
+		once.Do(func() { close(watching) })
+		return false, nil, nil
+	})
+
+	updates := make(chan []*ServiceInstance, 8)
+	require.NoError(t, k.Watch("llm", func(instances []*ServiceInstance) { updates <- instances }))
+	next := func() []*ServiceInstance {
+		select {
+		case instances := <-updates:
+			return instances
+		case <-time.After(2 * time.Second):
+			t.Fatal("no watch callback")
+			return nil
+		}
+	}
+
+	assert.Len(t, next(), 1, "the watcher starts with the current instances")
+	select {
+	case <-watching:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the informer did not start watching")
+	}
+
+	slices := client.DiscoveryV1().EndpointSlices("ai")
+	ctx := context.Background()
+	_, err := slices.Create(ctx, endpointSlice("embeddings-abc", "embeddings", podEndpoint("embeddings-0", "10.1.0.3", true)), metav1.CreateOptions{})
+	require.NoError(t, err)
+	_, err = slices.Create(ctx, endpointSlice("llm-def", "llm", podEndpoint("llm-1", "10.1.0.2", true)), metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Len(t, next(), 2, "added slices are reported, other services' slices are not")
+
+	_, err = slices.Update(ctx, endpointSlice("llm-def", "llm", podEndpoint("llm-1", "10.1.0.2", false)), metav1.UpdateOptions{})
+	require.NoError(t, err)
+	instances := next()
+	require.Len(t, instances, 2)
+	assert.Equal(t, "unhealthy", instances[1].Health)
+
+	require.NoError(t, slices.Delete(ctx, "llm-abc", metav1.DeleteOptions{}))
+	instances = next()
+	require.Len(t, instances, 1)
+	assert.Equal(t, "llm-1:8000", instances[0].ID)
+}
+
+func TestKubernetesRegisterLabelsOwnPod(t *testing.T) {
+	k, client := newFakeKubernetesDiscovery(t, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway-0", Namespace: "ai", Labels: map[string]string{"app": "gateway"}},
+	})
+	podLabels := func() map[string]string {
+		pod, err := client.CoreV1().Pods("ai").Get(context.Background(), "gateway-0", metav1.GetOptions{})
+		require.NoError(t, err)
+		return pod.Labels
+	}
+
+	require.NoError(t, k.Register(&ServiceInstance{ID: "a", Name: "gateway"}))
+	require.NoError(t, k.Register(&ServiceInstance{ID: "b", Name: "gateway"}))
+	assert.Equal(t, map[string]string{"app": "gateway", registeredLabel: "true"}, podLabels())
+
+	require.NoError(t, k.Deregister("a"))
+	assert.Equal(t, "true", podLabels()[registeredLabel], "the label stays while an instance is registered")
+	require.NoError(t, k.Deregister("b"))
+	assert.Equal(t, map[string]string{"app": "gateway"}, podLabels())
+	assert.Error(t, k.Deregister("b"), "a deregistered instance is no longer registered")
+
+	require.NoError(t, k.Register(&ServiceInstance{ID: "c", Name: "gateway"}))
+	require.NoError(t, k.Close())
+	assert.NotContains(t, podLabels(), registeredLabel, "Close removes the label")
+	require.NoError(t, k.Close(), "Close is idempotent")
+}
+
+func TestKubernetesRegisterFailsWithoutPod(t *testing.T) {
+	k, _ := newFakeKubernetesDiscovery(t)
+	assert.Error(t, k.Register(&ServiceInstance{ID: "a", Name: "gateway"}))
+	assert.Error(t, k.Deregister("a"), "a failed registration is not recorded")
+}
@@ -0,0 +1,335 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-aigateway/internal/config"
+
+	"github.com/nacos-group/nacos-sdk-go/v2/clients"
+	"github.com/nacos-group/nacos-sdk-go/v2/clients/naming_client"
+	"github.com/nacos-group/nacos-sdk-go/v2/common/constant"
+	"github.com/nacos-group/nacos-sdk-go/v2/model"
+	"github.com/nacos-group/nacos-sdk-go/v2/vo"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// nacosGroup is the Nacos group all gateway services live in
+	nacosGroup = "DEFAULT_GROUP"
+
+	// nacosDefaultPort is used for endpoints without a port
+	nacosDefaultPort = 8848
+
+	// nacosTimeoutMs bounds single requests to the Nacos server
+	nacosTimeoutMs = 10000
+)
+
+// Metadata keys carrying the ServiceInstance fields Nacos has no place for
+const (
+	nacosMetaID       = "instance_id"
+	nacosMetaProtocol = "protocol"
+	nacosMetaTags     = "tags"
+	nacosMetaWeight   = "weight"
+)
+
+// NacosDiscovery 基于 Nacos 命名服务的服务发现。实例注册为 DEFAULT_GROUP 下的临时实例，
+// 由 SDK 维持心跳；实例 ID、协议和标签保存在 Nacos 元数据中。命名空间 default
+// 对应 Nacos 的 public 命名空间。
+type NacosDiscovery struct {
+	config *config.ServiceDiscoveryConfig
+	client naming_client.INamingClient
+
+	mutex         sync.Mutex
+	registrations map[string]vo.DeregisterInstanceParam // by instance ID
+	subscriptions []*vo.SubscribeParam
+	closeOnce     sync.Once
+}
+
+// NewNacosDiscovery creates a naming client for the configured endpoints,
+// given as host:port or as URLs such as http://host:8848/nacos
+func NewNacosDiscovery(cfg *config.ServiceDiscoveryConfig) (*NacosDiscovery, error) {
+	var servers []constant.ServerConfig
+	for _, endpoint := range cfg.Endpoints {
+		if endpoint = strings.TrimSpace(endpoint); endpoint == "" {
+			continue
+		}
+		server, err := nacosServerConfig(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, *server)
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("nacos discovery requires at least one endpoint")
+	}
+
+	namespace := cfg.Namespace
+	if namespace == "default" || namespace == "public" {
+		namespace = ""
+	}
+	client, err := clients.NewNamingClient(vo.NacosClientParam{
+		ClientConfig: constant.NewClientConfig(
+			constant.WithNamespaceId(namespace),
+			constant.WithTimeoutMs(nacosTimeoutMs),
+			constant.WithNotLoadCacheAtStart(true),
+			constant.WithLogLevel("warn"),
+		),
+		ServerConfigs: servers,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create nacos naming client: %w", err)
+	}
+	return newNacosDiscovery(cfg, client), nil
+}
+
+func newNacosDiscovery(cfg *config.ServiceDiscoveryConfig, client naming_client.INamingClient) *NacosDiscovery {
+	return &NacosDiscovery{
+		config:        cfg,
+		client:        client,
+		registrations: make(map[string]vo.DeregisterInstanceParam),
+	}
+}
+
+// nacosServerConfig parses one endpoint
+func nacosServerConfig(endpoint string) (*constant.ServerConfig, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	target, err := url.Parse(endpoint)
+	if err != nil || target.Hostname() == "" {
+		return nil, fmt.Errorf("invalid nacos endpoint %q", endpoint)
+	}
+
+	port := uint64(nacosDefaultPort)
+	if raw := target.Port(); raw != "" {
+		port, err = strconv.ParseUint(raw, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nacos endpoint port %q", raw)
+		}
+	}
+	opts := []constant.ServerOption{constant.WithScheme(target.Scheme)}
+	if path := strings.TrimSuffix(target.Path, "/"); path != "" {
+		opts = append(opts, constant.WithContextPath(path))
+	}
+	return constant.NewServerConfig(target.Hostname(), port, opts...), nil
+}
+
+// Register registers an ephemeral instance. The weight comes from the
+// "weight" metadata entry, 1 when absent.
+func (n *NacosDiscovery) Register(instance *ServiceInstance) error {
+	logrus.WithField("instance", instance.ID).Info("Registering service with Nacos")
+
+	if instance.Port <= 0 || instance.Port > 65535 {
+		return fmt.Errorf("invalid port %d for instance %s", instance.Port, instance.ID)
+	}
+	weight := 1.0
+	metadata := map[string]string{
+		nacosMetaID:       instance.ID,
+		nacosMetaProtocol: instance.Protocol,
+	}
+	for key, value := range instance.Meta {
+		metadata[key] = value
+	}
+	if raw, ok := instance.Meta[nacosMetaWeight]; ok {
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil || parsed <= 0 {
+			return fmt.Errorf("invalid weight %q for instance %s", raw, instance.ID)
+		}
+		weight = parsed
+	}
+	if len(instance.Tags) > 0 {
+		metadata[nacosMetaTags] = strings.Join(instance.Tags, ",")
+	}
+
+	param := vo.RegisterInstanceParam{
+		Ip:          instance.Address,
+		Port:        uint64(instance.Port),
+		Weight:      weight,
+		Enable:      true,
+		Healthy:     true,
+		Metadata:    metadata,
+		ServiceName: instance.Name,
+		GroupName:   nacosGroup,
+		Ephemeral:   true,
+	}
+	ok, err := n.client.RegisterInstance(param)
+	if err == nil && !ok {
+		err = fmt.Errorf("server rejected the registration")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to register instance %s with nacos: %w", instance.ID, err)
+	}
+
+	n.mutex.Lock()
+	n.registrations[instance.ID] = vo.DeregisterInstanceParam{
+		Ip:          param.Ip,
+		Port:        param.Port,
+		ServiceName: param.ServiceName,
+		GroupName:   param.GroupName,
+		Ephemeral:   param.Ephemeral,
+	}
+	n.mutex.Unlock()
+	return nil
+}
+
+func (n *NacosDiscovery) Deregister(instanceID string) error {
+	logrus.WithField("instance", instanceID).Info("Deregistering service from Nacos")
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	param, registered := n.registrations[instanceID]
+	if !registered {
+		return fmt.Errorf("instance %s is not registered", instanceID)
+	}
+	ok, err := n.client.DeregisterInstance(param)
+	if err == nil && !ok {
+		err = fmt.Errorf("server rejected the deregistration")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to deregister instance %s from nacos: %w", instanceID, err)
+	}
+	delete(n.registrations, instanceID)
+	return nil
+}
+
+// Discover returns the healthy, enabled instances of a service
+func (n *NacosDiscovery) Discover(serviceName string) ([]*ServiceInstance, error) {
+	logrus.WithField("service", serviceName).Debug("Discovering services from Nacos")
+
+	instances, err := n.client.SelectInstances(vo.SelectInstancesParam{
+		ServiceName: serviceName,
+		GroupName:   nacosGroup,
+		HealthyOnly: true,
+	})
+	if err != nil {
+		// The SDK reports a service without instances as an error
+		if strings.Contains(err.Error(), "instance list is empty") {
+			return []*ServiceInstance{}, nil
+		}
+		return nil, fmt.Errorf("failed to discover services from nacos: %w", err)
+	}
+	return nacosInstances(serviceName, instances), nil
+}
+
+// Watch subscribes to a service; Nacos calls back with all of its instances,
+// healthy or not, whenever they change
+func (n *NacosDiscovery) Watch(serviceName string, callback func([]*ServiceInstance)) error {
+	logrus.WithField("service", serviceName).Info("Watching service changes in Nacos")
+
+	var (
+		mutex    sync.Mutex
+		last     []*ServiceInstance
+		notified bool
+	)
+	param := &vo.SubscribeParam{
+		ServiceName: serviceName,
+		GroupName:   nacosGroup,
+		SubscribeCallback: func(services []model.Instance, err error) {
+			if err != nil {
+				logrus.WithError(err).WithField("service", serviceName).Warn("Nacos subscription error")
+				return
+			}
+			instances := nacosInstances(serviceName, services)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if notified && instancesEqual(last, instances) {
+				return
+			}
+			last, notified = instances, true
+			callback(instances)
+		},
+	}
+	if err := n.client.Subscribe(param); err != nil {
+		return fmt.Errorf("failed to subscribe to nacos service %s: %w", serviceName, err)
+	}
+
+	n.mutex.Lock()
+	n.subscriptions = append(n.subscriptions, param)
+	n.mutex.Unlock()
+	return nil
+}
+
+// nacosInstances converts Nacos instances, skipping disabled ones, sorted by ID
+func nacosInstances(serviceName string, hosts []model.Instance) []*ServiceInstance {
+	instances := []*ServiceInstance{}
+	for _, host := range hosts {
+		if !host.Enable {
+			continue
+		}
+		meta := make(map[string]string, len(host.Metadata))
+		for key, value := range host.Metadata {
+			meta[key] = value
+		}
+
+		id := meta[nacosMetaID]
+		if id == "" {
+			id = host.InstanceId
+		}
+		if id == "" {
+			id = net.JoinHostPort(host.Ip, strconv.FormatUint(host.Port, 10))
+		}
+		protocol := meta[nacosMetaProtocol]
+		if protocol == "" {
+			protocol = "http"
+		}
+		var tags []string
+		if raw := meta[nacosMetaTags]; raw != "" {
+			tags = strings.Split(raw, ",")
+		}
+		delete(meta, nacosMetaID)
+		delete(meta, nacosMetaProtocol)
+		delete(meta, nacosMetaTags)
+		if _, ok := meta[nacosMetaWeight]; !ok {
+			meta[nacosMetaWeight] = strconv.FormatFloat(host.Weight, 'f', -1, 64)
+		}
+		health := "healthy"
+		if !host.Healthy {
+			health = "unhealthy"
+		}
+
+		instances = append(instances, &ServiceInstance{
+			ID:       id,
+			Name:     serviceName,
+			Address:  host.Ip,
+			Port:     int(host.Port),
+			Protocol: protocol,
+			Tags:     tags,
+			Meta:     meta,
+			Health:   health,
+		})
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].ID < instances[j].ID
+	})
+	return instances
+}
+
+// Close unsubscribes the watchers, deregisters the remaining instances and
+// closes the client; it is safe to call more than once
+func (n *NacosDiscovery) Close() error {
+	n.closeOnce.Do(func() {
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+		for _, param := range n.subscriptions {
+			if err := n.client.Unsubscribe(param); err != nil {
+				logrus.WithError(err).WithField("service", param.ServiceName).Warn("Failed to unsubscribe from Nacos")
+			}
+		}
+		n.subscriptions = nil
+		for id, param := range n.registrations {
+			if _, err := n.client.DeregisterInstance(param); err != nil {
+				logrus.WithError(err).WithField("instance", id).Warn("Failed to deregister from Nacos on shutdown")
+			}
+		}
+		n.registrations = make(map[string]vo.DeregisterInstanceParam)
+		n.client.CloseClient()
+	})
+	return nil
+}
@@ -0,0 +1,223 @@
+package discovery
+
+import (
+	"errors"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/golang/mock/gomock"
+	"github.com/nacos-group/nacos-sdk-go/v2/mock"
+	"github.com/nacos-group/nacos-sdk-go/v2/model"
+	"github.com/nacos-group/nacos-sdk-go/v2/vo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockNamingClient completes the SDK's generated mock, which predates several
+// methods of INamingClient; the discovery does not call the stubbed ones
+type mockNamingClient struct {
+	*mock.MockINamingClient
+	closed int
+}
+
+var errNotMocked = errors.New("not mocked")
+
+func (m *mockNamingClient) BatchRegisterInstance(vo.BatchRegisterInstanceParam) (bool, error) {
+	return false, errNotMocked
+}
+
+func (m *mockNamingClient) UpdateInstance(vo.UpdateInstanceParam) (bool, error) {
+	return false, errNotMocked
+}
+
+func (m *mockNamingClient) SelectAllInstances(vo.SelectAllInstancesParam) ([]model.Instance, error) {
+	return nil, errNotMocked
+}
+
+func (m *mockNamingClient) GetAllServicesInfo(vo.GetAllServiceInfoParam) (model.ServiceList, error) {
+	return model.ServiceList{}, errNotMocked
+}
+
+func (m *mockNamingClient) ServerHealthy() bool {
+	return true
+}
+
+func (m *mockNamingClient) CloseClient() {
+	m.closed++
+}
+
+func newMockNacosDiscovery(t *testing.T) (*NacosDiscovery, *mockNamingClient) {
+	client := &mockNamingClient{MockINamingClient: mock.NewMockINamingClient(gomock.NewController(t))}
+	return newNacosDiscovery(&config.ServiceDiscoveryConfig{Namespace: "ai"}, client), client
+}
+
+func TestNacosRegisterAndDeregister(t *testing.T) {
+	n, client := newMockNacosDiscovery(t)
+
+	client.EXPECT().RegisterInstance(vo.RegisterInstanceParam{
+		Ip:      "10.0.0.5",
+		Port:    8080,
+		Weight:  2.5,
+		Enable:  true,
+		Healthy: true,
+		Metadata: map[string]string{
+			"instance_id": "gateway-1",
+			"protocol":    "http",
+			"tags":        "v1,edge",
+			"weight":      "2.5",
+			"zone":        "cn-hangzhou-a",
+		},
+		ServiceName: "gateway",
+		GroupName:   "DEFAULT_GROUP",
+		Ephemeral:   true,
+	}).Return(true, nil)
+	require.NoError(t, n.Register(&ServiceInstance{
+		ID:       "gateway-1",
+		Name:     "gateway",
+		Address:  "10.0.0.5",
+		Port:     8080,
+		Protocol: "http",
+		Tags:     []string{"v1", "edge"},
+		Meta:     map[string]string{"zone": "cn-hangzhou-a", "weight": "2.5"},
+	}))
+
+	client.EXPECT().DeregisterInstance(vo.DeregisterInstanceParam{
+		Ip:          "10.0.0.5",
+		Port:        8080,
+		ServiceName: "gateway",
+		GroupName:   "DEFAULT_GROUP",
+		Ephemeral:   true,
+	}).Return(true, nil)
+	require.NoError(t, n.Deregister("gateway-1"))
+	assert.Error(t, n.Deregister("gateway-1"), "a deregistered instance is no longer registered")
+
+	require.NoError(t, n.Close())
+	assert.Equal(t, 1, client.closed)
+}
+
+func TestNacosRegisterFailures(t *testing.T) {
+	n, client := newMockNacosDiscovery(t)
+
+	assert.Error(t, n.Register(&ServiceInstance{ID: "a", Name: "gateway", Port: 8080, Meta: map[string]string{"weight": "0"}}))
+
+	client.EXPECT().RegisterInstance(gomock.Any()).Return(false, nil)
+	assert.Error(t, n.Register(&ServiceInstance{ID: "a", Name: "gateway", Address: "10.0.0.5", Port: 8080}))
+	client.EXPECT().RegisterInstance(gomock.Any()).Return(false, errors.New("connection refused"))
+	assert.Error(t, n.Register(&ServiceInstance{ID: "a", Name: "gateway", Address: "10.0.0.5", Port: 8080}))
+	assert.Error(t, n.Deregister("a"), "a failed registration is not recorded")
+}
+
+func TestNacosDiscoverConvertsHealthyInstances(t *testing.T) {
+	n, client := newMockNacosDiscovery(t)
+
+	client.EXPECT().SelectInstances(vo.SelectInstancesParam{
+		ServiceName: "llm",
+		GroupName:   "DEFAULT_GROUP",
+		HealthyOnly: true,
+	}).Return([]model.Instance{
+		{
+			InstanceId: "10.0.0.7#8000#DEFAULT#DEFAULT_GROUP@@llm",
+			Ip:         "10.0.0.7",
+			Port:       8000,
+			Weight:     1,
+			Healthy:    true,
+			Enable:     true,
+		},
+		{
+			InstanceId: "10.0.0.6#9000#DEFAULT#DEFAULT_GROUP@@llm",
+			Ip:         "10.0.0.6",
+			Port:       9000,
+			Weight:     3,
+			Healthy:    true,
+			Enable:     true,
+			Metadata:   map[string]string{"instance_id": "llm-a", "protocol": "grpc", "tags": "gpu", "zone": "b"},
+		},
+	}, nil)
+
+	instances, err := n.Discover("llm")
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+	assert.Equal(t, &ServiceInstance{
+		ID:       "10.0.0.7#8000#DEFAULT#DEFAULT_GROUP@@llm",
+		Name:     "llm",
+		Address:  "10.0.0.7",
+		Port:     8000,
+		Protocol: "http",
+		Meta:     map[string]string{"weight": "1"},
+		Health:   "healthy",
+	}, instances[0])
+	assert.Equal(t, &ServiceInstance{
+		ID:       "llm-a",
+		Name:     "llm",
+		Address:  "10.0.0.6",
+		Port:     9000,
+		Protocol: "grpc",
+		Tags:     []string{"gpu"},
+		Meta:     map[string]string{"zone": "b", "weight": "3"},
+		Health:   "healthy",
+	}, instances[1])
+
+	client.EXPECT().SelectInstances(gomock.Any()).Return([]model.Instance{}, errors.New("instance list is empty!"))
+	instances, err = n.Discover("llm")
+	require.NoError(t, err)
+	assert.Empty(t, instances)
+
+	client.EXPECT().SelectInstances(gomock.Any()).Return(nil, errors.New("connection refused"))
+	_, err = n.Discover("llm")
+	assert.Error(t, err)
+}
+
+func TestNacosWatchConvertsSubscriptionCallbacks(t *testing.T) {
+	n, client := newMockNacosDiscovery(t)
+
+	var subscription *vo.SubscribeParam
+	client.EXPECT().Subscribe(gomock.Any()).DoAndReturn(func(param *vo.SubscribeParam) error {
+		subscription = param
+		return nil
+	})
+	var updates [][]*ServiceInstance
+	require.NoError(t, n.Watch("llm", func(instances []*ServiceInstance) { updates = append(updates, instances) }))
+	require.NotNil(t, subscription)
+	assert.Equal(t, "llm", subscription.ServiceName)
+
+	hosts := []model.Instance{
+		{Ip: "10.0.0.1", Port: 8000, Weight: 1, Healthy: true, Enable: true, Metadata: map[string]string{"instance_id": "llm-0"}},
+		{Ip: "10.0.0.2", Port: 8000, Weight: 1, Healthy: false, Enable: true, Metadata: map[string]string{"instance_id": "llm-1"}},
+		{Ip: "10.0.0.3", Port: 8000, Weight: 1, Healthy: true, Enable: false, Metadata: map[string]string{"instance_id": "llm-2"}},
+	}
+	subscription.SubscribeCallback(hosts, nil)
+	subscription.SubscribeCallback(hosts, nil)
+	subscription.SubscribeCallback(nil, errors.New("push failed"))
+	require.Len(t, updates, 1, "unchanged instances and errors are not reported")
+	require.Len(t, updates[0], 2, "disabled instances are skipped")
+	assert.Equal(t, "unhealthy", updates[0][1].Health)
+
+	hosts[1].Healthy = true
+	subscription.SubscribeCallback(hosts, nil)
+	require.Len(t, updates, 2)
+	assert.Equal(t, "healthy", updates[1][1].Health)
+
+	client.EXPECT().Unsubscribe(subscription).Return(nil)
+	require.NoError(t, n.Close())
+	require.NoError(t, n.Close(), "Close is idempotent")
+	assert.Equal(t, 1, client.closed)
+}
+
+func TestNacosServerConfig(t *testing.T) {
+	server, err := nacosServerConfig("nacos.internal")
+	require.NoError(t, err)
+	assert.Equal(t, "nacos.internal", server.IpAddr)
+	assert.Equal(t, uint64(8848), server.Port)
+	assert.Equal(t, "http", server.Scheme)
+
+	server, err = nacosServerConfig("https://10.0.0.9:9848/nacos/")
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.9", server.IpAddr)
+	assert.Equal(t, uint64(9848), server.Port)
+	assert.Equal(t, "https", server.Scheme)
+	assert.Equal(t, "/nacos", server.ContextPath)
+
+	_, err = nacosServerConfig("10.0.0.9:port")
+	assert.Error(t, err)
+}
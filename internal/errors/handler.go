@@ -7,6 +7,9 @@ import (
 	"runtime/debug"
 	"time"
 
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/logging"
+
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
@@ -48,7 +51,7 @@ type HealthChecker struct {
 // NewErrorHandler creates a new enhanced error handler
 func NewErrorHandler() *ErrorHandler {
 	return &ErrorHandler{
-		logger:        logrus.New(),
+		logger:        logging.Default(),
 		retryAttempts: 3,
 		retryDelay:    time.Second,
 		circuitBreaker: &CircuitBreaker{
@@ -244,7 +247,7 @@ func (hc *HealthChecker) checkAllServices() {
 }
 
 func (hc *HealthChecker) checkServiceHealth(endpoint string) bool {
-	client := &http.Client{Timeout: hc.timeout}
+	client := httpclient.NewClient("health_check", hc.timeout)
 
 	resp, err := client.Get(endpoint)
 	if err != nil {
@@ -7,6 +7,8 @@ import (
 	"runtime"
 	"time"
 
+	"go-aigateway/internal/logging"
+
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
@@ -21,7 +23,7 @@ type ImprovedErrorHandler struct {
 // NewImprovedErrorHandler creates an enhanced error handler
 func NewImprovedErrorHandler(environment string, enableDebug bool) *ImprovedErrorHandler {
 	return &ImprovedErrorHandler{
-		logger:      logrus.New(),
+		logger:      logging.Default(),
 		environment: environment,
 		enableDebug: enableDebug,
 	}
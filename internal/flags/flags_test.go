@@ -0,0 +1,180 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketIsDeterministic(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key_%d", i)
+		b := Bucket(SemanticCache, key)
+		assert.Equal(t, b, Bucket(SemanticCache, key))
+		assert.GreaterOrEqual(t, b, 0)
+		assert.Less(t, b, 100)
+	}
+}
+
+func TestPercentageRollout(t *testing.T) {
+	flag := &Flag{Name: SemanticCache, Enabled: true, Percentage: 30}
+
+	enabled := 0
+	for i := 0; i < 10000; i++ {
+		if flag.Evaluate(Subject{KeyID: fmt.Sprintf("key_%d", i)}) {
+			enabled++
+		}
+	}
+	// 分桶应近似均匀
+	assert.InDelta(t, 3000, enabled, 300)
+
+	// Raising the percentage only adds keys, it never removes existing ones
+	wider := &Flag{Name: SemanticCache, Enabled: true, Percentage: 60}
+	for i := 0; i < 1000; i++ {
+		subject := Subject{KeyID: fmt.Sprintf("key_%d", i)}
+		if flag.Evaluate(subject) {
+			assert.True(t, wider.Evaluate(subject))
+		}
+	}
+
+	// Anonymous callers are only included in full rollouts
+	assert.False(t, flag.Evaluate(Subject{}))
+	assert.True(t, (&Flag{Name: JSONRepair, Enabled: true, Percentage: 100}).Evaluate(Subject{}))
+}
+
+func TestTargetingPrecedence(t *testing.T) {
+	flag := &Flag{
+		Name:       JSONRepair,
+		Enabled:    true,
+		Percentage: 100,
+		AllowKeys:  []string{"key_allowed", "key_both"},
+		DenyKeys:   []string{"key_denied", "key_both"},
+		Tenants:    []string{"acme"},
+	}
+
+	tests := []struct {
+		name    string
+		subject Subject
+		want    bool
+	}{
+		{"deny wins over allow", Subject{KeyID: "key_both", Tenant: "acme"}, false},
+		{"deny wins over percentage", Subject{KeyID: "key_denied", Tenant: "acme"}, false},
+		{"allow wins over tenant filter", Subject{KeyID: "key_allowed", Tenant: "other"}, true},
+		{"tenant filter excludes", Subject{KeyID: "key_other", Tenant: "other"}, false},
+		{"tenant filter includes", Subject{KeyID: "key_other", Tenant: "acme"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, flag.Evaluate(tt.subject))
+		})
+	}
+
+	// The kill switch overrides every rule
+	flag.Enabled = false
+	assert.False(t, flag.Evaluate(Subject{KeyID: "key_allowed", Tenant: "acme"}))
+}
+
+func TestEnabledDefaults(t *testing.T) {
+	Defaults["test_default_on"] = true
+	defer delete(Defaults, "test_default_on")
+
+	ctx := context.Background()
+	assert.False(t, Enabled(ctx, SemanticCache))
+	assert.True(t, Enabled(ctx, "test_default_on"))
+	assert.False(t, Enabled(ctx, "undefined_flag"))
+
+	ctx = WithAssignment(ctx, Assignment{SemanticCache: true})
+	assert.True(t, Enabled(ctx, SemanticCache))
+	assert.True(t, Enabled(ctx, "test_default_on"))
+}
+
+func TestReplaceValidates(t *testing.T) {
+	svc := NewService(nil, nil)
+
+	assert.Error(t, svc.Replace(context.Background(), []Flag{{Name: "Bad Name"}}))
+	assert.Error(t, svc.Replace(context.Background(), []Flag{{Name: "x", Percentage: 101}}))
+	assert.Error(t, svc.Replace(context.Background(), []Flag{{Name: "x"}, {Name: "x"}}))
+
+	require.NoError(t, svc.Replace(context.Background(), []Flag{{Name: SemanticCache, Enabled: true, Percentage: 100}}))
+	assert.Len(t, svc.List(), 1)
+}
+
+func TestMiddlewareAttachesAssignment(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	svc := NewService(nil, nil)
+	require.NoError(t, svc.Replace(context.Background(), []Flag{
+		{Name: SemanticCache, Enabled: true, Percentage: 100},
+		{Name: JSONRepair, Enabled: false},
+	}))
+
+	debugKey := KeyFingerprint("debug-key")
+	cfg := &config.FeatureFlagsConfig{Enabled: true, DebugKeys: []string{debugKey}}
+
+	var seen bool
+	r := gin.New()
+	r.Use(Middleware(svc, cfg, nil, nil))
+	r.GET("/test", func(c *gin.Context) {
+		seen = Enabled(c, SemanticCache)
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer regular-key")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.True(t, seen)
+	assert.Empty(t, w.Header().Get("X-Feature-Flags"))
+
+	req = httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer debug-key")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, "json_repair=off,semantic_cache=on", w.Header().Get("X-Feature-Flags"))
+}
+
+func TestDefaultSubjectTenantIsKeyOwner(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	middleware.SetKeyOwnerResolver(func(apiKey string) (string, bool) {
+		return "acme", apiKey == "acme-key"
+	})
+	t.Cleanup(func() { middleware.SetKeyOwnerResolver(nil) })
+
+	svc := NewService(nil, nil)
+	require.NoError(t, svc.Replace(context.Background(), []Flag{
+		{Name: SemanticCache, Enabled: true, Percentage: 100, Tenants: []string{"acme"}},
+	}))
+
+	var tenant string
+	var seen bool
+	r := gin.New()
+	r.Use(Middleware(svc, &config.FeatureFlagsConfig{Enabled: true}, nil, nil))
+	r.GET("/test", func(c *gin.Context) {
+		tenant = c.GetString("tenant_id")
+		seen = Enabled(c, SemanticCache)
+		c.Status(http.StatusOK)
+	})
+	call := func(apiKey string) {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("X-Tenant-ID", "acme")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	call("acme-key")
+	assert.Equal(t, "acme", tenant)
+	assert.True(t, seen)
+
+	call("other-key")
+	assert.Equal(t, KeyFingerprint("other-key"), tenant, "X-Tenant-ID does not select the tenant")
+	assert.False(t, seen)
+}
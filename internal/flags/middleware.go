@@ -0,0 +1,103 @@
+package flags
+
+import (
+	"sort"
+	"strings"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxMetricFlags bounds the flag label cardinality of assignment metrics
+const maxMetricFlags = 32
+
+// SubjectResolver derives the flag subject from the raw API key of a request
+type SubjectResolver func(c *gin.Context, apiKey string) Subject
+
+// KeyFingerprint returns a stable, non-reversible identifier for keys that have no ID
+func KeyFingerprint(apiKey string) string {
+	return middleware.KeyFingerprint(apiKey)
+}
+
+// DefaultSubject identifies the caller by key fingerprint. The tenant is the owner of
+// its credentials, so X-Tenant-ID cannot move a request into another tenant's quota.
+func DefaultSubject(c *gin.Context, apiKey string) Subject {
+	subject := Subject{Tenant: middleware.RequestOwner(c)}
+	if apiKey != "" {
+		subject.KeyID = KeyFingerprint(apiKey)
+	}
+	return subject
+}
+
+// Middleware evaluates all flags once per request and attaches the assignment to the
+// request context. Allow-listed debug keys receive it in the X-Feature-Flags header.
+func Middleware(svc *Service, cfg *config.FeatureFlagsConfig, resolve SubjectResolver, audit *security.AuditLogger) gin.HandlerFunc {
+	if resolve == nil {
+		resolve = DefaultSubject
+	}
+
+	return func(c *gin.Context) {
+		if svc == nil {
+			c.Next()
+			return
+		}
+
+		subject := resolve(c, requestAPIKey(c))
+		assignment := svc.Evaluate(subject)
+
+		c.Request = c.Request.WithContext(WithAssignment(c.Request.Context(), assignment))
+		c.Set("feature_flags", assignment)
+		c.Set("flag_key_id", subject.KeyID)
+		c.Set("tenant_id", subject.Tenant)
+
+		recordAssignment(assignment)
+
+		if subject.KeyID != "" && contains(cfg.DebugKeys, subject.KeyID) {
+			c.Header("X-Feature-Flags", assignment.String())
+		}
+
+		if audit != nil && len(assignment) > 0 {
+			audit.LogWithContext(c.Request.Context(), &security.AuditEvent{
+				Type:      "feature_flags",
+				Action:    "assign",
+				Resource:  c.Request.URL.Path,
+				UserID:    subject.KeyID,
+				RemoteIP:  c.ClientIP(),
+				UserAgent: c.GetHeader("User-Agent"),
+				Details: map[string]interface{}{
+					"tenant":      subject.Tenant,
+					"assignments": assignment.String(),
+				},
+			})
+		}
+
+		c.Next()
+	}
+}
+
+// requestAPIKey extracts the caller's key from the Authorization or X-API-Key header
+func requestAPIKey(c *gin.Context) string {
+	if auth := c.GetHeader("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return c.GetHeader("X-API-Key")
+}
+
+// recordAssignment exports at most maxMetricFlags flags to keep label cardinality bounded
+func recordAssignment(assignment Assignment) {
+	names := make([]string, 0, len(assignment))
+	for name := range assignment {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > maxMetricFlags {
+		names = names[:maxMetricFlags]
+	}
+
+	for _, name := range names {
+		middleware.RecordFeatureFlagAssignment(name, assignment[name])
+	}
+}
@@ -0,0 +1,174 @@
+package flags
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/storage"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// InvalidationChannel is the Redis channel used to propagate flag changes between replicas
+const InvalidationChannel = "flags:invalidate"
+
+// Service 特性开关服务，定义可热更新并通过失效通知在实例间同步
+type Service struct {
+	mu          sync.RWMutex
+	flags       map[string]*Flag
+	store       storage.Store
+	redisClient *redis.Client
+	instanceID  string
+}
+
+// NewService creates a flag service. store and redisClient are optional; without a
+// store definitions live in memory, without Redis changes stay on this instance.
+func NewService(store storage.Store, redisClient *redis.Client) *Service {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &Service{
+		flags:       make(map[string]*Flag),
+		store:       store,
+		redisClient: redisClient,
+		instanceID:  hex.EncodeToString(id),
+	}
+}
+
+// Load replaces the in-memory definitions with those in the store
+func (s *Service) Load(ctx context.Context) error {
+	if s.store == nil {
+		return nil
+	}
+
+	records, err := s.store.List(ctx, storage.BucketFeatureFlags)
+	if err != nil {
+		return fmt.Errorf("failed to load feature flags: %w", err)
+	}
+
+	flags := make(map[string]*Flag, len(records))
+	for name, data := range records {
+		var flag Flag
+		if err := json.Unmarshal(data, &flag); err != nil {
+			logrus.WithError(err).WithField("flag", name).Warn("Skipping unreadable feature flag")
+			continue
+		}
+		flags[flag.Name] = &flag
+	}
+
+	s.mu.Lock()
+	s.flags = flags
+	s.mu.Unlock()
+
+	logrus.WithField("flags", len(flags)).Info("Feature flags loaded")
+	return nil
+}
+
+// List returns all flag definitions sorted by name
+func (s *Service) List() []Flag {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]Flag, 0, len(s.flags))
+	for _, flag := range s.flags {
+		result = append(result, *flag)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Replace validates and atomically swaps the full set of flag definitions,
+// persisting them and notifying other replicas
+func (s *Service) Replace(ctx context.Context, definitions []Flag) error {
+	now := time.Now()
+	flags := make(map[string]*Flag, len(definitions))
+	for i := range definitions {
+		flag := definitions[i]
+		if err := flag.Validate(); err != nil {
+			return err
+		}
+		if _, dup := flags[flag.Name]; dup {
+			return fmt.Errorf("duplicate flag %s", flag.Name)
+		}
+		flag.UpdatedAt = now
+		flags[flag.Name] = &flag
+	}
+
+	s.mu.Lock()
+	previous := s.flags
+	s.flags = flags
+	s.mu.Unlock()
+
+	if s.store != nil {
+		for name := range previous {
+			if _, kept := flags[name]; !kept {
+				if err := s.store.Delete(ctx, storage.BucketFeatureFlags, name); err != nil {
+					return fmt.Errorf("failed to delete flag %s: %w", name, err)
+				}
+			}
+		}
+		for name, flag := range flags {
+			data, err := json.Marshal(flag)
+			if err != nil {
+				return err
+			}
+			if err := s.store.Put(ctx, storage.BucketFeatureFlags, name, data); err != nil {
+				return fmt.Errorf("failed to persist flag %s: %w", name, err)
+			}
+		}
+	}
+
+	if s.redisClient != nil {
+		if err := s.redisClient.Publish(ctx, InvalidationChannel, s.instanceID).Err(); err != nil {
+			logrus.WithError(err).Warn("Failed to publish feature flag invalidation")
+		}
+	}
+	return nil
+}
+
+// Evaluate computes the assignment of every defined flag for a subject
+func (s *Service) Evaluate(subject Subject) Assignment {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	assignment := make(Assignment, len(s.flags))
+	for name, flag := range s.flags {
+		assignment[name] = flag.Evaluate(subject)
+	}
+	return assignment
+}
+
+// StartInvalidationListener reloads definitions when another replica changes them
+func (s *Service) StartInvalidationListener(ctx context.Context) {
+	if s.redisClient == nil || s.store == nil {
+		return
+	}
+
+	pubsub := s.redisClient.Subscribe(ctx, InvalidationChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			if msg.Payload == s.instanceID {
+				continue
+			}
+			if err := s.Load(ctx); err != nil {
+				logrus.WithError(err).Warn("Failed to reload feature flags after invalidation")
+			}
+		}
+	}
+}
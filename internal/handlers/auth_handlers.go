@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"go-aigateway/internal/middleware"
 	"go-aigateway/internal/security"
 
 	"github.com/gin-gonic/gin"
@@ -18,30 +22,52 @@ type LoginRequest struct {
 
 // LoginResponse represents the login response
 type LoginResponse struct {
-	Token     string `json:"token"`
-	ExpiresIn int64  `json:"expires_in"`
-	TokenType string `json:"token_type"`
+	Token        string `json:"token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
-// RefreshRequest represents the token refresh request
+// RefreshRequest represents the token refresh request. A refresh token issued
+// at login is preferred; a still valid access token is accepted as before.
 type RefreshRequest struct {
-	Token string `json:"token" binding:"required"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RevokeRequest represents the refresh token revocation request
+type RevokeRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutRequest represents the logout request. The refresh token of the
+// session is revoked; all_sessions revokes every refresh token of the user.
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	AllSessions  bool   `json:"all_sessions"`
 }
 
 // CreateAPIKeyRequest represents the API key creation request
 type CreateAPIKeyRequest struct {
+	UserID      string          `json:"user_id,omitempty"` // defaults to the calling user
 	Name        string          `json:"name" binding:"required"`
 	Permissions map[string]bool `json:"permissions"`
 	RateLimit   int             `json:"rate_limit"`
 	ExpiresAt   *int64          `json:"expires_at,omitempty"`
+	Sandbox     bool            `json:"sandbox,omitempty"` // simulated responses only, no upstream cost
+	// MetricDimensions label the key's request metrics, at most security.MaxMetricDimensions
+	MetricDimensions map[string]string `json:"metric_dimensions,omitempty"`
+	AllowedModels    []string          `json:"allowed_models,omitempty"`
+	AllowedMethods   []string          `json:"allowed_methods,omitempty"`
+	TokenBudget      int64             `json:"token_budget,omitempty"` // total tokens the key may spend
+	Priority         string            `json:"priority,omitempty"`     // request queue tier: high, normal or low
 }
 
 // UpdateAPIKeyRequest represents the API key update request
 type UpdateAPIKeyRequest struct {
-	Name        string          `json:"name,omitempty"`
+	Name        *string         `json:"name,omitempty"`
 	Permissions map[string]bool `json:"permissions,omitempty"`
-	RateLimit   int             `json:"rate_limit,omitempty"`
-	IsActive    *bool           `json:"is_active,omitempty"`
+	RateLimit   *int            `json:"rate_limit,omitempty"`
 }
 
 // Login handler for user authentication
@@ -113,10 +139,24 @@ func Login(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
 			return
 		}
 
+		refreshToken, err := localAuth.GenerateRefreshToken(user.ID)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to generate refresh token")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": "Failed to generate token",
+					"type":    "internal_server_error",
+					"code":    "token_generation_failed",
+				},
+			})
+			return
+		}
+
 		c.JSON(http.StatusOK, LoginResponse{
-			Token:     token,
-			ExpiresIn: 86400, // 24 hours
-			TokenType: "Bearer",
+			Token:        token,
+			ExpiresIn:    86400, // 24 hours
+			TokenType:    "Bearer",
+			RefreshToken: refreshToken,
 		})
 	}
 }
@@ -125,11 +165,30 @@ func Login(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
 func RefreshToken(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req RefreshRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
+		if err := c.ShouldBindJSON(&req); err != nil || (req.Token == "" && req.RefreshToken == "") {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 			return
 		}
 
+		if req.RefreshToken != "" {
+			// The refresh token is rotated on every use; the client must store the new one
+			accessToken, refreshToken, err := localAuth.RotateRefreshToken(req.RefreshToken)
+			if err != nil {
+				if errors.Is(err, security.ErrRefreshTokenReused) {
+					logrus.WithField("client_ip", c.ClientIP()).Warn("Revoked refresh token presented")
+				}
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+				return
+			}
+			c.JSON(http.StatusOK, LoginResponse{
+				Token:        accessToken,
+				ExpiresIn:    86400, // 24 hours
+				TokenType:    "Bearer",
+				RefreshToken: refreshToken,
+			})
+			return
+		}
+
 		// Validate and refresh token
 		claims, err := localAuth.ValidateJWT(req.Token)
 		if err != nil {
@@ -151,101 +210,343 @@ func RefreshToken(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
 	}
 }
 
-// CreateAPIKey handler for creating new API keys
-func CreateAPIKey(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
+// RevokeToken handler for revoking a refresh token, e.g. at logout. Unknown
+// tokens are reported as revoked so the endpoint does not reveal which exist.
+func RevokeToken(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var req CreateAPIKeyRequest
+		var req RevokeRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 			return
 		}
 
+		if err := localAuth.RevokeRefreshToken(req.RefreshToken); err != nil && !errors.Is(err, security.ErrRefreshTokenInvalid) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+	}
+}
+
+// Logout handler revoking the refresh tokens of the user authenticated by
+// JWTAuth. Access tokens already issued stay valid until they expire.
+func Logout(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LogoutRequest
+		if err := c.ShouldBindJSON(&req); err != nil || (req.RefreshToken == "" && !req.AllSessions) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "refresh_token or all_sessions is required",
+					"type":    "validation_error",
+					"code":    "invalid_format",
+				},
+			})
+			return
+		}
+		userID := c.GetString("user_id")
+		if userID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{
+					"message": "User not authenticated",
+					"type":    "authentication_error",
+					"code":    "missing_token",
+				},
+			})
+			return
+		}
+
+		if req.AllSessions {
+			revoked := localAuth.RevokeAllRefreshTokens(userID)
+			logrus.WithFields(logrus.Fields{
+				"user_id": userID,
+				"revoked": revoked,
+			}).Info("User logged out of all sessions")
+		} else if err := localAuth.RevokeUserRefreshToken(userID, req.RefreshToken); err != nil && !errors.Is(err, security.ErrRefreshTokenInvalid) {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": "Failed to revoke token",
+					"type":    "internal_server_error",
+					"code":    "token_revocation_failed",
+				},
+			})
+			return
+		}
+		// Unknown tokens and tokens of other users are not reported, as with RevokeToken
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+	}
+}
+
+// APIKeyResponse describes an issued or rotated API key. APIKey holds the
+// secret, which is returned only here and never stored.
+type APIKeyResponse struct {
+	ID          string     `json:"id"`
+	APIKey      string     `json:"api_key"`
+	Name        string     `json:"name"`
+	UserID      string     `json:"user_id"`
+	Permissions []string   `json:"permissions"`
+	RateLimit   int        `json:"rate_limit"`
+	Sandbox     bool       `json:"sandbox"`
+	Priority    string     `json:"priority,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Message     string     `json:"message"`
+}
+
+// newAPIKeyResponse describes apiKey, which was just issued or rotated for the
+// key with the given ID. The secret is returned even if the key cannot be
+// described, e.g. because its owner is disabled, as it would be lost otherwise.
+func newAPIKeyResponse(localAuth *security.LocalAuthenticator, id, apiKey, message string) *APIKeyResponse {
+	resp := &APIKeyResponse{ID: id, APIKey: apiKey, Message: message}
+	info, err := localAuth.DescribeAPIKey(apiKey)
+	if err != nil {
+		logrus.WithError(err).WithField("key_id", id).Warn("Issued API key cannot be described")
+		return resp
+	}
+	resp.ID = info.ID
+	resp.Name = info.Name
+	resp.UserID = info.UserID
+	resp.Permissions = info.Permissions
+	resp.RateLimit = info.RateLimit
+	resp.Sandbox = info.Sandbox
+	resp.Priority = info.Priority
+	resp.CreatedAt = info.CreatedAt
+	resp.ExpiresAt = info.ExpiresAt
+	return resp
+}
+
+// apiKeyError answers an API key management request with a structured error
+func apiKeyError(c *gin.Context, status int, message, errType, code string) {
+	c.JSON(status, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    errType,
+			"code":    code,
+		},
+	})
+}
+
+// unassignablePermissions are never granted through the API key endpoints,
+// whatever the caller holds
+var unassignablePermissions = map[string]bool{"*": true, "admin": true}
+
+// checkGrantablePermissions rejects permissions that cannot be granted or
+// that the caller does not hold itself, so a key never exceeds its issuer
+func checkGrantablePermissions(c *gin.Context, localAuth *security.LocalAuthenticator, permissions map[string]bool) error {
+	for permission, enabled := range permissions {
+		if !enabled {
+			continue
+		}
+		if unassignablePermissions[permission] {
+			return fmt.Errorf("permission %q cannot be granted to an API key", permission)
+		}
+		if !middleware.CallerHasPermission(c, localAuth, permission) {
+			return fmt.Errorf("permission %q is not held by the caller", permission)
+		}
+	}
+	return nil
+}
+
+// CreateAPIKey handler for creating new API keys. UserID defaults to the
+// calling user; the secret is returned once.
+func CreateAPIKey(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateAPIKeyRequest
+		if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Name) == "" {
+			apiKeyError(c, http.StatusBadRequest, "name is required", "validation_error", "invalid_format")
+			return
+		}
+		if err := security.ValidateMetricDimensions(req.MetricDimensions); err != nil {
+			apiKeyError(c, http.StatusBadRequest, err.Error(), "validation_error", "invalid_metric_dimensions")
+			return
+		}
+		if req.TokenBudget < 0 {
+			apiKeyError(c, http.StatusBadRequest, "token_budget cannot be negative", "validation_error", "invalid_token_budget")
+			return
+		}
+		if req.RateLimit < 0 {
+			apiKeyError(c, http.StatusBadRequest, "rate_limit cannot be negative", "validation_error", "invalid_rate_limit")
+			return
+		}
+		switch req.Priority {
+		case "", "high", "normal", "low":
+		default:
+			apiKeyError(c, http.StatusBadRequest, "priority must be high, normal or low", "validation_error", "invalid_priority")
+			return
+		}
+		if req.ExpiresAt != nil && !time.Unix(*req.ExpiresAt, 0).After(time.Now()) {
+			apiKeyError(c, http.StatusBadRequest, "expires_at must be in the future", "validation_error", "invalid_expiry")
+			return
+		}
+		if err := checkGrantablePermissions(c, localAuth, req.Permissions); err != nil {
+			apiKeyError(c, http.StatusForbidden, err.Error(), "authorization_error", "permission_not_grantable")
+			return
+		}
+
 		// Get user from context (set by auth middleware)
-		userID, exists := c.Get("user_id")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		callerID := c.GetString("user_id")
+		if callerID == "" {
+			apiKeyError(c, http.StatusUnauthorized, "User not authenticated", "authentication_error", "missing_user")
 			return
 		}
+		if req.UserID == "" {
+			req.UserID = callerID
+		}
 
 		// Create API key
-		apiKey, err := localAuth.CreateAPIKey(userID.(string), req.Name, req.Permissions, req.RateLimit, req.ExpiresAt)
+		apiKey, err := localAuth.CreateAPIKey(req.UserID, strings.TrimSpace(req.Name), req.Permissions, req.RateLimit, req.ExpiresAt)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+			logrus.WithError(err).WithField("user_id", req.UserID).Warn("Failed to create API key")
+			apiKeyError(c, http.StatusBadRequest, err.Error(), "invalid_request_error", "key_creation_failed")
+			return
+		}
+		if err := applyAPIKeyOptions(localAuth, apiKey, &req); err != nil {
+			logrus.WithError(err).WithField("user_id", req.UserID).Error("Failed to configure API key")
+			localAuth.RevokeAPIKey(apiKey)
+			apiKeyError(c, http.StatusInternalServerError, "Failed to create API key", "internal_server_error", "key_creation_failed")
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
-			"api_key": apiKey,
-			"message": "API key created successfully",
-		})
+		c.JSON(http.StatusCreated, newAPIKeyResponse(localAuth, "", apiKey, "API key created successfully"))
 	}
 }
 
-// ListAPIKeys handler for listing API keys
+// applyAPIKeyOptions applies the optional settings of req to a new key
+func applyAPIKeyOptions(localAuth *security.LocalAuthenticator, apiKey string, req *CreateAPIKeyRequest) error {
+	if req.Sandbox {
+		if err := localAuth.SetSandbox(apiKey, true); err != nil {
+			return err
+		}
+	}
+	if len(req.MetricDimensions) > 0 {
+		if err := localAuth.SetMetricDimensions(apiKey, req.MetricDimensions); err != nil {
+			return err
+		}
+	}
+	if len(req.AllowedModels) > 0 {
+		if err := localAuth.SetAllowedModels(apiKey, req.AllowedModels); err != nil {
+			return err
+		}
+	}
+	if len(req.AllowedMethods) > 0 {
+		if err := localAuth.SetAllowedMethods(apiKey, req.AllowedMethods); err != nil {
+			return err
+		}
+	}
+	if req.Priority != "" {
+		if err := localAuth.SetPriority(apiKey, req.Priority); err != nil {
+			return err
+		}
+	}
+	if req.TokenBudget > 0 {
+		return localAuth.SetTokenBudget(apiKey, req.TokenBudget)
+	}
+	return nil
+}
+
+// ListAPIKeys handler for listing the API keys of the user_id query
+// parameter, by default those of the calling user. Key hashes are masked.
 func ListAPIKeys(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get user from context
-		userID, exists := c.Get("user_id")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		userID := c.Query("user_id")
+		if userID == "" {
+			userID = c.GetString("user_id")
+		}
+		if userID == "" {
+			apiKeyError(c, http.StatusUnauthorized, "User not authenticated", "authentication_error", "missing_user")
 			return
 		}
-		// List API keys for user
-		apiKeys := localAuth.ListAPIKeys(userID.(string))
+		apiKeys := localAuth.ListAPIKeys(userID)
+		if apiKeys == nil {
+			apiKeys = []*security.APIKeyInfo{}
+		}
 
-		c.JSON(http.StatusOK, gin.H{"api_keys": apiKeys})
+		c.JSON(http.StatusOK, gin.H{"user_id": userID, "api_keys": apiKeys})
 	}
 }
 
-// DeleteAPIKey handler for deleting API keys
+// DeleteAPIKey handler for revoking the API key with the ID in the path
 func DeleteAPIKey(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		keyID := c.Param("id")
-		if keyID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "API key ID is required"})
-			return
-		}
-		// Get user from context
-		_, exists := c.Get("user_id")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		if err := localAuth.RevokeAPIKeyByID(keyID); err != nil {
+			if errors.Is(err, security.ErrAPIKeyNotFound) {
+				apiKeyError(c, http.StatusNotFound, "API key not found", "not_found_error", "key_not_found")
+				return
+			}
+			apiKeyError(c, http.StatusInternalServerError, "Failed to delete API key", "internal_server_error", "key_revocation_failed")
 			return
 		}
 
-		// Delete API key
-		err := localAuth.RevokeAPIKey(keyID)
+		c.JSON(http.StatusOK, gin.H{"id": keyID, "message": "API key deleted successfully"})
+	}
+}
+
+// RotateAPIKey handler for replacing the secret of the API key with the ID in
+// the path. The old secret stops working immediately; the new one is returned once.
+func RotateAPIKey(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyID := c.Param("id")
+		apiKey, err := localAuth.RotateAPIKeyByID(keyID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete API key"})
+			if errors.Is(err, security.ErrAPIKeyNotFound) {
+				apiKeyError(c, http.StatusNotFound, "API key not found", "not_found_error", "key_not_found")
+				return
+			}
+			apiKeyError(c, http.StatusInternalServerError, "Failed to rotate API key", "internal_server_error", "key_rotation_failed")
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "API key deleted successfully"})
+		c.JSON(http.StatusOK, newAPIKeyResponse(localAuth, keyID, apiKey, "API key rotated successfully"))
 	}
 }
 
-// UpdateAPIKey handler for updating API keys
+// UpdateAPIKey handler for changing the name, permissions or rate limit of the
+// API key with the ID in the path. Omitted fields are kept; new permissions are
+// checked like those of CreateAPIKey. The secret is unchanged and not returned.
 func UpdateAPIKey(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		keyID := c.Param("id")
-		if keyID == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "API key ID is required"})
-			return
-		}
-
 		var req UpdateAPIKeyRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+			apiKeyError(c, http.StatusBadRequest, "Invalid request format", "validation_error", "invalid_format")
 			return
 		}
-		// Get user from context
-		_, exists := c.Get("user_id")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		update := security.APIKeyUpdate{RateLimit: req.RateLimit}
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			if name == "" {
+				apiKeyError(c, http.StatusBadRequest, "name cannot be empty", "validation_error", "invalid_format")
+				return
+			}
+			update.Name = &name
+		}
+		if req.RateLimit != nil && *req.RateLimit < 0 {
+			apiKeyError(c, http.StatusBadRequest, "rate_limit cannot be negative", "validation_error", "invalid_rate_limit")
+			return
+		}
+		if req.Permissions != nil {
+			if err := checkGrantablePermissions(c, localAuth, req.Permissions); err != nil {
+				apiKeyError(c, http.StatusForbidden, err.Error(), "authorization_error", "permission_not_grantable")
+				return
+			}
+			update.Permissions = make([]string, 0, len(req.Permissions))
+			for permission, enabled := range req.Permissions {
+				if enabled {
+					update.Permissions = append(update.Permissions, permission)
+				}
+			}
+		}
+
+		keyID := c.Param("id")
+		info, err := localAuth.UpdateAPIKeyByID(keyID, update)
+		if err != nil {
+			if errors.Is(err, security.ErrAPIKeyNotFound) {
+				apiKeyError(c, http.StatusNotFound, "API key not found", "not_found_error", "key_not_found")
+				return
+			}
+			apiKeyError(c, http.StatusInternalServerError, "Failed to update API key", "internal_server_error", "key_update_failed")
 			return
 		}
 
-		// Update API key (implementation would depend on your storage layer)
-		// For now, return success message
-		c.JSON(http.StatusOK, gin.H{"message": "API key updated successfully"})
+		c.JSON(http.StatusOK, gin.H{"api_key": info, "message": "API key updated successfully"})
 	}
 }
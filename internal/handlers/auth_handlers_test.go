@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginRefreshRevoke(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("USER_ADMIN_PASSWORD", "admin-password")
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{JWTSecret: "test-secret", TokenExpiration: time.Hour})
+	r := gin.New()
+	r.POST("/login", Login(localAuth))
+	r.POST("/refresh", RefreshToken(localAuth))
+	r.POST("/revoke", RevokeToken(localAuth))
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data)))
+		return w
+	}
+
+	w := post("/login", gin.H{"username": "admin", "password": "admin-password"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var login LoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	require.NotEmpty(t, login.RefreshToken)
+
+	w = post("/refresh", gin.H{"refresh_token": login.RefreshToken})
+	require.Equal(t, http.StatusOK, w.Code)
+	var refreshed LoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+	_, err := localAuth.ValidateJWT(refreshed.Token)
+	assert.NoError(t, err)
+	require.NotEmpty(t, refreshed.RefreshToken, "the refresh token is rotated")
+	assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+
+	w = post("/refresh", gin.H{"refresh_token": refreshed.RefreshToken})
+	require.Equal(t, http.StatusOK, w.Code)
+	var rotated LoginResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+
+	assert.Equal(t, http.StatusBadRequest, post("/refresh", gin.H{}).Code)
+	assert.Equal(t, http.StatusOK, post("/revoke", gin.H{"refresh_token": rotated.RefreshToken}).Code)
+	assert.Equal(t, http.StatusOK, post("/revoke", gin.H{"refresh_token": "rt_unknown"}).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/refresh", gin.H{"refresh_token": rotated.RefreshToken}).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/refresh", gin.H{"refresh_token": login.RefreshToken}).Code, "a rotated token cannot be replayed")
+}
+
+func TestLogout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("USER_ADMIN_PASSWORD", "admin-password")
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{JWTSecret: "test-secret", TokenExpiration: time.Hour})
+	r := gin.New()
+	r.POST("/login", Login(localAuth))
+	r.POST("/refresh", RefreshToken(localAuth))
+	r.POST("/logout", middleware.JWTAuth(localAuth, ""), Logout(localAuth))
+	post := func(path, bearer string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data))
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	login := func() LoginResponse {
+		w := post("/login", "", gin.H{"username": "admin", "password": "admin-password"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp LoginResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	first, second := login(), login()
+	assert.Equal(t, http.StatusUnauthorized, post("/logout", "", gin.H{"refresh_token": first.RefreshToken}).Code, "logout needs an access token")
+	assert.Equal(t, http.StatusBadRequest, post("/logout", first.Token, gin.H{}).Code)
+
+	// Tokens of other users are left alone
+	otherToken, err := localAuth.GenerateRefreshToken("api-user")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, post("/logout", first.Token, gin.H{"refresh_token": otherToken}).Code)
+	assert.Equal(t, http.StatusOK, post("/refresh", "", gin.H{"refresh_token": otherToken}).Code)
+
+	assert.Equal(t, http.StatusOK, post("/logout", first.Token, gin.H{"refresh_token": first.RefreshToken}).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/refresh", "", gin.H{"refresh_token": first.RefreshToken}).Code)
+
+	third := login()
+	assert.Equal(t, http.StatusOK, post("/logout", third.Token, gin.H{"all_sessions": true}).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/refresh", "", gin.H{"refresh_token": second.RefreshToken}).Code)
+	assert.Equal(t, http.StatusUnauthorized, post("/refresh", "", gin.H{"refresh_token": third.RefreshToken}).Code)
+}
+
+func setupAPIKeysRouter(t *testing.T) (*gin.Engine, *security.LocalAuthenticator) {
+	gin.SetMode(gin.TestMode)
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{
+		JWTSecret:       "test-secret",
+		TokenExpiration: time.Hour,
+		MaxAPIKeys:      10,
+		APIKeyPrefix:    "gw-",
+	})
+	r := gin.New()
+	keys := r.Group("/api/v1/admin/api-keys", middleware.LocalAuth(localAuth, ""), middleware.RequirePermission(localAuth, security.PermissionAdminKeys))
+	keys.POST("", CreateAPIKey(localAuth))
+	keys.GET("", ListAPIKeys(localAuth))
+	keys.DELETE("/:id", DeleteAPIKey(localAuth))
+	keys.POST("/:id/rotate", RotateAPIKey(localAuth))
+	keys.PUT("/:id", UpdateAPIKey(localAuth))
+	return r, localAuth
+}
+
+// apiKeysRequest sends a request authenticated with a bearer token, or an
+// API key when the credential has the key prefix
+func apiKeysRequest(r *gin.Engine, method, path, credential string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if strings.HasPrefix(credential, "gw-") {
+		req.Header.Set("X-API-Key", credential)
+	} else if credential != "" {
+		req.Header.Set("Authorization", "Bearer "+credential)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIKeysLifecycle(t *testing.T) {
+	r, localAuth := setupAPIKeysRouter(t)
+	adminToken, err := localAuth.GenerateJWT("admin")
+	require.NoError(t, err)
+
+	// Create returns the secret once
+	expiresAt := time.Now().Add(24 * time.Hour).Unix()
+	w := apiKeysRequest(r, http.MethodPost, "/api/v1/admin/api-keys", adminToken, gin.H{
+		"user_id":     "api-user",
+		"name":        "billing service",
+		"permissions": gin.H{"ai:chat": true, "ai:embeddings": true},
+		"rate_limit":  50,
+		"expires_at":  expiresAt,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created APIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.True(t, strings.HasPrefix(created.APIKey, "gw-"))
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, "api-user", created.UserID)
+	assert.ElementsMatch(t, []string{"ai:chat", "ai:embeddings"}, created.Permissions)
+	assert.Equal(t, 50, created.RateLimit)
+	require.NotNil(t, created.ExpiresAt)
+	assert.Equal(t, expiresAt, created.ExpiresAt.Unix())
+
+	_, keyInfo, err := localAuth.ValidateAPIKey(created.APIKey)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, keyInfo.ID)
+
+	// List masks hashes and never contains the secret
+	w = apiKeysRequest(r, http.MethodGet, "/api/v1/admin/api-keys?user_id=api-user", adminToken, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.APIKey)
+	var listed struct {
+		Keys []security.APIKeyInfo `json:"api_keys"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	var found *security.APIKeyInfo
+	for i := range listed.Keys {
+		assert.True(t, strings.HasSuffix(listed.Keys[i].KeyHash, "..."), "hashes are masked")
+		if listed.Keys[i].ID == created.ID {
+			found = &listed.Keys[i]
+		}
+	}
+	require.NotNil(t, found)
+	assert.Equal(t, "billing service", found.Name)
+
+	// Updates change only the given fields and keep the secret
+	w = apiKeysRequest(r, http.MethodPut, "/api/v1/admin/api-keys/"+created.ID, adminToken, gin.H{
+		"name":        "billing",
+		"permissions": gin.H{"ai:chat": true},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), created.APIKey)
+	_, keyInfo, err = localAuth.ValidateAPIKey(created.APIKey)
+	require.NoError(t, err)
+	assert.Equal(t, "billing", keyInfo.Name)
+	assert.Equal(t, []string{"ai:chat"}, keyInfo.Permissions)
+	assert.Equal(t, 50, keyInfo.RateLimit)
+	w = apiKeysRequest(r, http.MethodPut, "/api/v1/admin/api-keys/"+created.ID, adminToken, gin.H{"permissions": gin.H{"*": true}})
+	assert.Equal(t, http.StatusForbidden, w.Code, "updates cannot grant what creation cannot")
+	assert.Equal(t, http.StatusBadRequest, apiKeysRequest(r, http.MethodPut, "/api/v1/admin/api-keys/"+created.ID, adminToken, gin.H{"rate_limit": -1}).Code)
+	assert.Equal(t, http.StatusNotFound, apiKeysRequest(r, http.MethodPut, "/api/v1/admin/api-keys/unknown", adminToken, gin.H{"name": "x"}).Code)
+
+	// Rotation keeps the ID and replaces the secret
+	w = apiKeysRequest(r, http.MethodPost, "/api/v1/admin/api-keys/"+created.ID+"/rotate", adminToken, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var rotated APIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rotated))
+	assert.Equal(t, created.ID, rotated.ID)
+	assert.NotEqual(t, created.APIKey, rotated.APIKey)
+	_, _, err = localAuth.ValidateAPIKey(created.APIKey)
+	assert.Error(t, err, "the old secret stops working")
+	_, _, err = localAuth.ValidateAPIKey(rotated.APIKey)
+	assert.NoError(t, err)
+
+	// Revocation
+	w = apiKeysRequest(r, http.MethodDelete, "/api/v1/admin/api-keys/"+created.ID, adminToken, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	_, _, err = localAuth.ValidateAPIKey(rotated.APIKey)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, apiKeysRequest(r, http.MethodDelete, "/api/v1/admin/api-keys/"+created.ID, adminToken, nil).Code)
+	assert.Equal(t, http.StatusNotFound, apiKeysRequest(r, http.MethodPost, "/api/v1/admin/api-keys/"+created.ID+"/rotate", adminToken, nil).Code)
+}
+
+func TestAPIKeysCreateValidation(t *testing.T) {
+	r, localAuth := setupAPIKeysRouter(t)
+	adminToken, err := localAuth.GenerateJWT("admin")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		body     gin.H
+		wantCode string
+	}{
+		{name: "missing name", body: gin.H{"permissions": gin.H{"ai:chat": true}}, wantCode: "invalid_format"},
+		{name: "negative rate limit", body: gin.H{"name": "k", "rate_limit": -1}, wantCode: "invalid_rate_limit"},
+		{name: "expiry in the past", body: gin.H{"name": "k", "expires_at": time.Now().Add(-time.Minute).Unix()}, wantCode: "invalid_expiry"},
+		{name: "unknown user", body: gin.H{"name": "k", "user_id": "nobody"}, wantCode: "key_creation_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := apiKeysRequest(r, http.MethodPost, "/api/v1/admin/api-keys", adminToken, tt.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantCode)
+		})
+	}
+
+	// Keys are created for the calling user by default
+	w := apiKeysRequest(r, http.MethodPost, "/api/v1/admin/api-keys", adminToken, gin.H{"name": "own key"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created APIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "admin", created.UserID)
+}
+
+func TestAPIKeysRequirePermission(t *testing.T) {
+	r, localAuth := setupAPIKeysRouter(t)
+	userToken, err := localAuth.GenerateJWT("api-user")
+	require.NoError(t, err)
+	userKey, err := localAuth.GenerateAPIKey("api-user", "user key", []string{"*"}, 0)
+	require.NoError(t, err)
+	// A key of an administrator still needs the permission itself
+	limitedAdminKey, err := localAuth.GenerateAPIKey("admin", "chat only", []string{"ai:chat"}, 0)
+	require.NoError(t, err)
+	adminKey, err := localAuth.GenerateAPIKey("admin", "key manager", []string{security.PermissionAdminKeys}, 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		credential string
+		wantStatus int
+	}{
+		{name: "anonymous", wantStatus: http.StatusUnauthorized},
+		{name: "user token", credential: userToken, wantStatus: http.StatusForbidden},
+		{name: "user key", credential: userKey, wantStatus: http.StatusForbidden},
+		{name: "admin key without admin:keys", credential: limitedAdminKey, wantStatus: http.StatusForbidden},
+		{name: "admin key with admin:keys", credential: adminKey, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := apiKeysRequest(r, http.MethodGet, "/api/v1/admin/api-keys", tt.credential, nil)
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestAPIKeysCreateCannotEscalatePermissions(t *testing.T) {
+	r, localAuth := setupAPIKeysRouter(t)
+	adminToken, err := localAuth.GenerateJWT("admin")
+	require.NoError(t, err)
+	managerKey, err := localAuth.GenerateAPIKey("admin", "key manager", []string{security.PermissionAdminKeys, "ai:chat"}, 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		credential  string
+		permissions gin.H
+		wantStatus  int
+	}{
+		{name: "wildcard", credential: adminToken, permissions: gin.H{"*": true}, wantStatus: http.StatusForbidden},
+		{name: "admin", credential: adminToken, permissions: gin.H{"admin": true}, wantStatus: http.StatusForbidden},
+		{name: "held by the key", credential: managerKey, permissions: gin.H{"ai:chat": true}, wantStatus: http.StatusCreated},
+		{name: "not held by the key", credential: managerKey, permissions: gin.H{"ai:embeddings": true}, wantStatus: http.StatusForbidden},
+		{name: "disabled entries are ignored", credential: managerKey, permissions: gin.H{"*": false, "ai:chat": true}, wantStatus: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := apiKeysRequest(r, http.MethodPost, "/api/v1/admin/api-keys", tt.credential, gin.H{
+				"user_id":     "api-user",
+				"name":        "delegated",
+				"permissions": tt.permissions,
+			})
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			if tt.wantStatus == http.StatusForbidden {
+				assert.Contains(t, w.Body.String(), "permission_not_grantable")
+			}
+		})
+	}
+}
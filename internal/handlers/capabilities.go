@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// CapabilitiesCacheTTL is how long a key's capabilities are cached; changes to
+// the key show up after at most this long
+const CapabilitiesCacheTTL = 60 * time.Second
+
+const capabilitiesCachePrefix = "gw:capabilities:"
+
+// AnyValue marks an unrestricted allow list
+const AnyValue = "*"
+
+// KeyCapabilities 某个API密钥当前可用的功能和限额
+type KeyCapabilities struct {
+	Features CapabilityFeatures `json:"features"`
+	Limits   CapabilityLimits   `json:"limits"`
+}
+
+// CapabilityFeatures 功能开关；允许列表为 ["*"] 表示不受限制
+type CapabilityFeatures struct {
+	Streaming       bool     `json:"streaming"`
+	Vision          bool     `json:"vision"`
+	FunctionCalling bool     `json:"function_calling"`
+	AllowedModels   []string `json:"allowed_models"`
+	AllowedMethods  []string `json:"allowed_methods"`
+}
+
+// CapabilityLimits 限额；token_budget_remaining 为 null 表示没有令牌预算
+type CapabilityLimits struct {
+	RateLimit            int    `json:"rate_limit"` // requests per minute
+	TokenBudgetRemaining *int64 `json:"token_budget_remaining"`
+}
+
+// capabilitiesFor derives the capabilities of a managed API key
+func capabilitiesFor(cfg *config.Config, key security.APIKeyInfo) KeyCapabilities {
+	caps := KeyCapabilities{
+		Features: CapabilityFeatures{
+			Streaming:       key.HasPermission(security.PermissionStreaming),
+			FunctionCalling: key.HasPermission(security.PermissionFunctionCalling),
+			AllowedModels:   []string{AnyValue},
+			AllowedMethods:  []string{AnyValue},
+		},
+		Limits: CapabilityLimits{RateLimit: cfg.RateLimit},
+	}
+
+	vision := key.HasPermission(security.PermissionVision)
+	if len(key.AllowedModels) > 0 {
+		caps.Features.AllowedModels = key.AllowedModels
+		// Vision also needs a model that accepts images
+		visionModel := false
+		for _, model := range key.AllowedModels {
+			if ModelSupportsVision(model) {
+				visionModel = true
+				break
+			}
+		}
+		vision = vision && visionModel
+	}
+	caps.Features.Vision = vision
+	if len(key.AllowedMethods) > 0 {
+		caps.Features.AllowedMethods = key.AllowedMethods
+	}
+	if key.RateLimit > 0 {
+		caps.Limits.RateLimit = key.RateLimit
+	}
+	if remaining := key.TokenBudgetRemaining(); remaining >= 0 {
+		caps.Limits.TokenBudgetRemaining = &remaining
+	}
+	return caps
+}
+
+// Capabilities tells the calling API key which features and limits apply to
+// it. Keys from GATEWAY_API_KEYS are unrestricted; managed keys are described
+// by their permissions, allow lists and token budget, cached in Redis.
+func Capabilities(cfg *config.Config, localAuth *security.LocalAuthenticator, client *redis.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if apiKey == "" {
+			apiKey = c.GetHeader("X-API-Key")
+		}
+
+		for _, key := range cfg.GatewayKeys {
+			if apiKey != "" && strings.TrimSpace(key) == apiKey {
+				c.JSON(http.StatusOK, KeyCapabilities{
+					Features: CapabilityFeatures{
+						Streaming:       true,
+						Vision:          true,
+						FunctionCalling: true,
+						AllowedModels:   []string{AnyValue},
+						AllowedMethods:  []string{AnyValue},
+					},
+					Limits: CapabilityLimits{RateLimit: cfg.RateLimit},
+				})
+				return
+			}
+		}
+
+		key, err := localAuth.DescribeAPIKey(apiKey)
+		if apiKey == "" || err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{
+					"message": "Invalid API key",
+					"type":    "authentication_error",
+					"code":    "invalid_api_key",
+				},
+			})
+			return
+		}
+
+		ctx := c.Request.Context()
+		cacheKey := capabilitiesCachePrefix + key.ID
+		if client != nil {
+			if cached, err := client.Get(ctx, cacheKey).Bytes(); err == nil {
+				c.Data(http.StatusOK, "application/json; charset=utf-8", cached)
+				return
+			}
+		}
+
+		caps := capabilitiesFor(cfg, key)
+		if client != nil {
+			if data, err := json.Marshal(caps); err == nil {
+				if err := client.Set(ctx, cacheKey, data, CapabilitiesCacheTTL).Err(); err != nil {
+					logrus.WithError(err).Warn("Failed to cache key capabilities")
+				}
+			}
+		}
+		c.JSON(http.StatusOK, caps)
+	}
+}
+
+var (
+	tokenUsageRecorderMu sync.RWMutex
+	tokenUsageRecorder   func(c *gin.Context, tokens int64)
+)
+
+// SetTokenUsageRecorder installs the function charging the tokens of each
+// successful upstream response to its caller; nil stops recording
+func SetTokenUsageRecorder(record func(c *gin.Context, tokens int64)) {
+	tokenUsageRecorderMu.Lock()
+	tokenUsageRecorder = record
+	tokenUsageRecorderMu.Unlock()
+}
+
+// recordTokenUsage charges the total tokens reported in a response's usage
+// and tracks them per key and model
+func recordTokenUsage(c *gin.Context, resp map[string]interface{}) {
+	trackUsage(c, resp)
+	trackTokens(c, resp)
+
+	tokenUsageRecorderMu.RLock()
+	record := tokenUsageRecorder
+	tokenUsageRecorderMu.RUnlock()
+	if record == nil {
+		return
+	}
+	usage, _ := resp["usage"].(map[string]interface{})
+	if total, ok := usage["total_tokens"].(float64); ok && total > 0 {
+		record(c, int64(total))
+	}
+}
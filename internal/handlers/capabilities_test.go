@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/security"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getCapabilities(r *gin.Engine, apiKey string) (int, KeyCapabilities) {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/capabilities", nil)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var caps KeyCapabilities
+	json.Unmarshal(w.Body.Bytes(), &caps)
+	return w.Code, caps
+}
+
+func TestCapabilitiesDifferPerKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{MaxAPIKeys: 10})
+	cfg := &config.Config{RateLimit: 60, GatewayKeys: []string{"gw-static-key"}}
+
+	full, err := localAuth.GenerateAPIKey("api-user", "full", []string{"ai:chat", security.PermissionStreaming, security.PermissionVision}, 100)
+	require.NoError(t, err)
+	require.NoError(t, localAuth.SetTokenBudget(full, 500000))
+	localAuth.ChargeTokens(full, 50000)
+
+	limited, err := localAuth.GenerateAPIKey("api-user", "limited", []string{"ai:chat", security.PermissionFunctionCalling, security.PermissionVision}, 0)
+	require.NoError(t, err)
+	require.NoError(t, localAuth.SetAllowedModels(limited, []string{"qwen-turbo"}))
+	require.NoError(t, localAuth.SetAllowedMethods(limited, []string{"chat.completions"}))
+
+	r := gin.New()
+	r.GET("/api/v1/capabilities", Capabilities(cfg, localAuth, client))
+
+	code, caps := getCapabilities(r, full)
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, caps.Features.Streaming)
+	assert.True(t, caps.Features.Vision)
+	assert.False(t, caps.Features.FunctionCalling)
+	assert.Equal(t, []string{AnyValue}, caps.Features.AllowedModels)
+	assert.Equal(t, []string{AnyValue}, caps.Features.AllowedMethods)
+	assert.Equal(t, 100, caps.Limits.RateLimit)
+	require.NotNil(t, caps.Limits.TokenBudgetRemaining)
+	assert.Equal(t, int64(450000), *caps.Limits.TokenBudgetRemaining)
+
+	code, caps = getCapabilities(r, limited)
+	require.Equal(t, http.StatusOK, code)
+	assert.False(t, caps.Features.Streaming)
+	assert.False(t, caps.Features.Vision, "the only allowed model is text-only")
+	assert.True(t, caps.Features.FunctionCalling)
+	assert.Equal(t, []string{"qwen-turbo"}, caps.Features.AllowedModels)
+	assert.Equal(t, []string{"chat.completions"}, caps.Features.AllowedMethods)
+	assert.Equal(t, 60, caps.Limits.RateLimit, "keys without a rate limit get the gateway default")
+	assert.Nil(t, caps.Limits.TokenBudgetRemaining)
+
+	code, caps = getCapabilities(r, "gw-static-key")
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, caps.Features.Streaming && caps.Features.Vision && caps.Features.FunctionCalling)
+
+	code, _ = getCapabilities(r, "sk-unknown")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestCapabilitiesCachedPerKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{MaxAPIKeys: 10})
+	apiKey, err := localAuth.GenerateAPIKey("api-user", "budgeted", []string{"ai:chat"}, 10)
+	require.NoError(t, err)
+	require.NoError(t, localAuth.SetTokenBudget(apiKey, 1000))
+
+	r := gin.New()
+	r.GET("/api/v1/capabilities", Capabilities(&config.Config{RateLimit: 60}, localAuth, client))
+
+	_, caps := getCapabilities(r, apiKey)
+	assert.Equal(t, int64(1000), *caps.Limits.TokenBudgetRemaining)
+
+	// Usage shows up once the cached entry expires
+	localAuth.ChargeTokens(apiKey, 400)
+	_, caps = getCapabilities(r, apiKey)
+	assert.Equal(t, int64(1000), *caps.Limits.TokenBudgetRemaining)
+
+	mr.FastForward(CapabilitiesCacheTTL + time.Second)
+	_, caps = getCapabilities(r, apiKey)
+	assert.Equal(t, int64(600), *caps.Limits.TokenBudgetRemaining)
+
+	// A revoked key is refused even while its capabilities are cached
+	require.NoError(t, localAuth.RevokeAPIKey(apiKey))
+	code, _ := getCapabilities(r, apiKey)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
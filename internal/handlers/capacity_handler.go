@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// GetCapacity returns the capacity plan and current pool occupancy
+func GetCapacity(pools *middleware.CapacityPools) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		usage, err := pools.Usage(c.Request.Context())
+		if err != nil {
+			logrus.WithError(err).Error("Failed to read capacity pool usage")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": "Failed to read capacity pool usage",
+					"type":    "internal_server_error",
+					"code":    "capacity_usage_failed",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"plan":  pools.Plan(),
+			"usage": usage,
+		})
+	}
+}
+
+// UpdateCapacity replaces the capacity plan; reservations may not exceed the total
+func UpdateCapacity(pools *middleware.CapacityPools) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var plan middleware.CapacityPlan
+		if err := c.ShouldBindJSON(&plan); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "Invalid request format",
+					"type":    "validation_error",
+					"code":    "invalid_format",
+				},
+			})
+			return
+		}
+
+		if err := pools.SetPlan(c.Request.Context(), &plan); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "validation_error",
+					"code":    "invalid_capacity_plan",
+				},
+			})
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"total":           plan.Total,
+			"pools":           len(plan.Pools),
+			"work_conserving": plan.WorkConserving,
+		}).Info("Capacity plan updated")
+
+		c.JSON(http.StatusOK, gin.H{
+			"plan":    pools.Plan(),
+			"message": "Capacity plan updated successfully",
+		})
+	}
+}
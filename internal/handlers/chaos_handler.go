@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-aigateway/internal/chaos"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ListChaosRules returns the chaos rules that have not expired
+func ListChaosRules(inj *chaos.Injector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"rules": inj.Rules()})
+	}
+}
+
+// UpdateChaosRules replaces all chaos rules
+func UpdateChaosRules(inj *chaos.Injector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Rules []chaos.Rule `json:"rules"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "Invalid request body",
+					"type":    "validation_error",
+					"code":    "invalid_chaos_rule",
+				},
+			})
+			return
+		}
+
+		rules, err := inj.SetRules(request.Rules)
+		if err != nil {
+			status, errType, code := http.StatusInternalServerError, "internal_server_error", "chaos_error"
+			if errors.Is(err, chaos.ErrInvalidRule) {
+				status, errType, code = http.StatusBadRequest, "validation_error", "invalid_chaos_rule"
+			}
+			c.JSON(status, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    errType,
+					"code":    code,
+				},
+			})
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"user_id": c.GetString("user_id"),
+			"rules":   len(rules),
+		}).Warn("Chaos rules updated")
+		c.JSON(http.StatusOK, gin.H{"rules": rules})
+	}
+}
+
+// ClearChaosRules removes all chaos rules
+func ClearChaosRules(inj *chaos.Injector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		inj.SetRules(nil)
+		logrus.WithField("user_id", c.GetString("user_id")).Warn("Chaos rules cleared")
+		c.JSON(http.StatusOK, gin.H{"rules": []chaos.Rule{}})
+	}
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// V2 response objects
+const (
+	ChatObjectV2     = "chat.completion"
+	EnsembleObjectV2 = "chat.ensemble"
+)
+
+// ChatResponseV2 V2聊天接口的响应：上游或集成结果放在data中，
+// 网关自身的信息（告警、结构化输出校验结果、会话）统一放在gateway中
+type ChatResponseV2 struct {
+	APIVersion int                    `json:"api_version"`
+	Object     string                 `json:"object"`
+	Data       map[string]interface{} `json:"data"`
+	Gateway    GatewayMetaV2          `json:"gateway"`
+}
+
+// GatewayMetaV2 网关对一次V2请求的附加说明
+type GatewayMetaV2 struct {
+	Warnings         []string       `json:"warnings,omitempty"`
+	SchemaValidation string         `json:"schema_validation,omitempty"`
+	Session          *SessionTurnV2 `json:"session,omitempty"`
+}
+
+// SessionTurnV2 本次请求续写的会话；分支请求时为新建的分支
+type SessionTurnV2 struct {
+	ID       string `json:"session_id"`
+	ParentID string `json:"parent_id,omitempty"`
+	Messages int    `json:"messages"`
+}
+
+// chatTurnV2 is what serving a V2 request needs to know to finish it
+type chatTurnV2 struct {
+	object   string
+	owner    string
+	session  *ConversationSession
+	messages []map[string]interface{} // the request's own messages, appended to the session
+}
+
+// ChatCompletionsV2 serves chat completions for API version 2. Requests are
+// handled by the V1 implementation, so structured output validation, routing
+// and hooks behave the same; V2 adds:
+//   - models: fan the request out as an ensemble instead of calling one model
+//   - session_id: continue a conversation session, prepending its history
+//   - branch_at: branch the session at a message index before continuing it
+//
+// and wraps successful responses in a ChatResponseV2 envelope. Streams are served as in V1.
+func ChatCompletionsV2(cfg *config.Config, sessions *ConversationSessions) gin.HandlerFunc {
+	chat := ChatCompletions(cfg)
+	ensemble := Ensemble(cfg)
+	return func(c *gin.Context) {
+		original := c.Writer
+		writer := &contractResponseWriter{ResponseWriter: original}
+		c.Writer = writer
+		turn := serveChatV2(c, chat, ensemble, sessions)
+		c.Writer = original
+
+		if writer.passthrough {
+			return
+		}
+		finishChatV2(c, writer, turn, sessions)
+	}
+}
+
+// serveChatV2 prepares the request and runs the V1 handler; it returns nil when
+// the request was rejected before reaching it
+func serveChatV2(c *gin.Context, chat, ensemble gin.HandlerFunc, sessions *ConversationSessions) *chatTurnV2 {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxRequestBodySize))
+	var request map[string]interface{}
+	if err == nil {
+		err = json.Unmarshal(body, &request)
+	}
+	if err != nil || request == nil {
+		invalidEnsembleRequest(c, "Invalid JSON format")
+		return nil
+	}
+
+	turn := &chatTurnV2{object: ChatObjectV2, owner: sessionOwner(c)}
+	handler := chat
+	if _, ok := request["models"]; ok {
+		turn.object, handler = EnsembleObjectV2, ensemble
+	}
+
+	if rawID, ok := request["session_id"]; ok {
+		session, err := chatV2Session(sessions, turn.owner, rawID, request["branch_at"])
+		if err != nil {
+			sessionError(c, err)
+			return nil
+		}
+		if stream, _ := request["stream"].(bool); stream {
+			sessionError(c, fmt.Errorf("sessions are not supported for streaming requests"))
+			return nil
+		}
+
+		messages, _ := request["messages"].([]interface{})
+		history := make([]interface{}, 0, len(session.Messages)+len(messages))
+		for _, message := range session.Messages {
+			history = append(history, message)
+		}
+		for _, message := range messages {
+			if m, ok := message.(map[string]interface{}); ok {
+				turn.messages = append(turn.messages, m)
+			}
+		}
+		request["messages"] = append(history, messages...)
+		if model, _ := request["model"].(string); model == "" && session.Model != "" {
+			request["model"] = session.Model
+		}
+		delete(request, "session_id")
+		delete(request, "branch_at")
+		turn.session = session
+
+		if body, err = json.Marshal(request); err != nil {
+			invalidEnsembleRequest(c, "Invalid JSON format")
+			return nil
+		}
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	handler(c)
+	return turn
+}
+
+// chatV2Session resolves the session a V2 request continues, branching it first when asked
+func chatV2Session(sessions *ConversationSessions, owner string, rawID, rawAt interface{}) (*ConversationSession, error) {
+	if sessions == nil {
+		return nil, fmt.Errorf("conversation sessions are not enabled")
+	}
+	id, _ := rawID.(string)
+	if id == "" {
+		return nil, fmt.Errorf("session_id must be a non-empty string")
+	}
+
+	var session ConversationSession
+	var err error
+	if rawAt != nil {
+		at, ok := rawAt.(float64)
+		if !ok || at < 0 || at != float64(int(at)) {
+			return nil, errBranchPosition
+		}
+		session, err = sessions.Branch(owner, id, int(at))
+	} else {
+		session, err = sessions.Get(owner, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// finishChatV2 writes the buffered V1 response in V2 form
+func finishChatV2(c *gin.Context, writer *contractResponseWriter, turn *chatTurnV2, sessions *ConversationSessions) {
+	status := writer.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	c.Writer.Header().Del("Content-Length")
+
+	var data map[string]interface{}
+	if !strings.Contains(writer.Header().Get("Content-Type"), "json") || json.Unmarshal(writer.buf.Bytes(), &data) != nil || data == nil {
+		c.Data(status, writer.Header().Get("Content-Type"), writer.buf.Bytes())
+		return
+	}
+	// Errors keep the V1 error object so clients can share error handling
+	if turn == nil || status >= http.StatusMultipleChoices {
+		data["api_version"] = 2
+		c.JSON(status, data)
+		return
+	}
+
+	response := ChatResponseV2{
+		APIVersion: 2,
+		Object:     turn.object,
+		Data:       data,
+		Gateway: GatewayMetaV2{
+			Warnings:         writer.Header().Values("X-Gateway-Warning"),
+			SchemaValidation: writer.Header().Get(SchemaValidationHeader),
+		},
+	}
+	delete(data, "warnings")
+
+	if turn.session != nil {
+		messages := append(turn.messages, assistantReplyV2(turn.object, data))
+		session, err := sessions.Append(turn.owner, turn.session.ID, messages)
+		if err != nil {
+			response.Gateway.Warnings = append(response.Gateway.Warnings, "session not updated: "+err.Error())
+			session = *turn.session
+		}
+		response.Gateway.Session = &SessionTurnV2{ID: session.ID, ParentID: session.ParentID, Messages: len(session.Messages)}
+	}
+	c.JSON(status, response)
+}
+
+// assistantReplyV2 is the message a V2 response adds to its session
+func assistantReplyV2(object string, data map[string]interface{}) map[string]interface{} {
+	if object == EnsembleObjectV2 {
+		content, _ := data["content"].(string)
+		return map[string]interface{}{"role": "assistant", "content": content}
+	}
+	if choices, ok := data["choices"].([]interface{}); ok && len(choices) > 0 {
+		if choice, ok := choices[0].(map[string]interface{}); ok {
+			if message, ok := choice["message"].(map[string]interface{}); ok {
+				return message
+			}
+		}
+	}
+	return map[string]interface{}{"role": "assistant", "content": ""}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupChatV2Router answers with the model name and the number of messages it
+// received, and records the last conversation sent upstream
+func setupChatV2Router(t *testing.T) (*gin.Engine, *ConversationSessions, func() []interface{}) {
+	gin.SetMode(gin.TestMode)
+	var mu sync.Mutex
+	var last []interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		messages, _ := body["messages"].([]interface{})
+		mu.Lock()
+		last = messages
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model":   body["model"],
+			"choices": []interface{}{map[string]interface{}{"message": map[string]interface{}{"role": "assistant", "content": "ok"}}},
+		})
+	}))
+	t.Cleanup(upstream.Close)
+
+	cfg := &config.Config{
+		TargetURL: upstream.URL,
+		Ensemble:  config.EnsembleConfig{Timeout: time.Second, MaxModels: 4},
+	}
+	sessions := NewConversationSessions(config.SessionConfig{MaxBranchDepth: 2, MaxBranches: 4, MaxMessages: 20, TTL: time.Hour})
+	router := gin.New()
+	router.POST("/v2/chat", ChatCompletionsV2(cfg, sessions))
+	return router, sessions, func() []interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+func TestChatV2ContinuesAndBranchesSessions(t *testing.T) {
+	router, sessions, upstreamMessages := setupChatV2Router(t)
+	session, err := sessions.Create("anonymous", "gpt-4o", []map[string]interface{}{
+		{"role": "user", "content": "hi"},
+		{"role": "assistant", "content": "hello"},
+	})
+	require.NoError(t, err)
+
+	w := postJSON(router, "/v2/chat", `{"session_id":"`+session.ID+`","messages":[{"role":"user","content":"more"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp ChatResponseV2
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, upstreamMessages(), 3, "the session history is prepended")
+	assert.Equal(t, "gpt-4o", resp.Data["model"], "the session model applies when the request has none")
+	require.NotNil(t, resp.Gateway.Session)
+	assert.Equal(t, session.ID, resp.Gateway.Session.ID)
+	assert.Equal(t, 4, resp.Gateway.Session.Messages, "the turn and the reply are appended")
+
+	// Branching after the first message leaves the original session untouched
+	w = postJSON(router, "/v2/chat", `{"model":"gpt-4o-mini","session_id":"`+session.ID+`","branch_at":1,"messages":[{"role":"user","content":"instead"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, upstreamMessages(), 2)
+	require.NotNil(t, resp.Gateway.Session)
+	assert.NotEqual(t, session.ID, resp.Gateway.Session.ID)
+	assert.Equal(t, session.ID, resp.Gateway.Session.ParentID)
+	assert.Equal(t, 3, resp.Gateway.Session.Messages)
+
+	original, err := sessions.Get("anonymous", session.ID)
+	require.NoError(t, err)
+	assert.Len(t, original.Messages, 4)
+
+	// Errors keep the V1 error object
+	w = postJSON(router, "/v2/chat", `{"session_id":"sess_missing","messages":[]}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"api_version":2,"error":{"message":"session not found","type":"invalid_request_error","code":"session_not_found"}}`, w.Body.String())
+
+	w = postJSON(router, "/v2/chat", `{"session_id":"`+session.ID+`","branch_at":-1,"messages":[]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"invalid_branch_position"`)
+}
+
+func TestChatV2Ensemble(t *testing.T) {
+	router, _, _ := setupChatV2Router(t)
+
+	w := postJSON(router, "/v2/chat", `{"models":["model-a","model-b"],"aggregation":"concat","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp ChatResponseV2
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, EnsembleObjectV2, resp.Object)
+	assert.Equal(t, EnsembleConcat, resp.Data["aggregation"])
+	assert.Len(t, resp.Data["responses"], 2)
+
+	w = postJSON(router, "/v2/chat", `{"models":["model-a"],"messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"api_version":2`)
+}
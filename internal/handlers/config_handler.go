@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// GetActiveConfig returns the active configuration with secrets redacted
+func GetActiveConfig(source config.Source) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"config": source.Current().Redacted()})
+	}
+}
+
+// ReloadConfig re-reads the configuration files and applies them without a
+// restart. An invalid configuration is rejected and the running one kept;
+// changed settings that need a restart are listed under ignored.
+func ReloadConfig(reloader *config.Reloader) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ignored, err := reloader.Reload()
+		if err != nil {
+			logrus.WithError(err).Warn("Configuration reload rejected")
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "validation_error",
+					"code":    "invalid_config",
+				},
+			})
+			return
+		}
+		if ignored == nil {
+			ignored = []string{}
+		}
+		logrus.WithField("user_id", c.GetString("user_id")).Info("Configuration reloaded")
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Configuration reloaded",
+			"ignored": ignored,
+			"config":  reloader.Current().Redacted(),
+		})
+	}
+}
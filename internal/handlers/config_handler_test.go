@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupConfigRouter serves the config admin endpoints next to /v1/models,
+// which is rate limited by the active configuration
+func setupConfigRouter(t *testing.T) (*gin.Engine, *config.Reloader, string) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "config-test-secret")
+	t.Setenv("RATE_LIMIT_REQUESTS_PER_MINUTE", "2")
+	t.Setenv("TARGET_KEY", "sk-upstream-secret")
+	reloader := config.NewReloader(config.NewSnapshot(config.New()), nil)
+
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{
+		JWTSecret:       "test-secret",
+		TokenExpiration: time.Hour,
+		MaxAPIKeys:      10,
+		APIKeyPrefix:    "gw-",
+	})
+	adminToken, err := localAuth.GenerateJWT("admin")
+	require.NoError(t, err)
+
+	limiter := middleware.NewIPRateLimiter(100)
+	limiter.SetConfigSource(reloader)
+	r := gin.New()
+	r.GET("/v1/models", limiter.Handler(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	admin := r.Group("/api/v1/admin/config")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	admin.GET("", GetActiveConfig(reloader))
+	admin.POST("/reload", ReloadConfig(reloader))
+	return r, reloader, adminToken
+}
+
+func configRequest(r *gin.Engine, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestReloadConfigChangesRateLimitWithoutRestart(t *testing.T) {
+	r, reloader, adminToken := setupConfigRouter(t)
+
+	for i := 0; i < 2; i++ {
+		require.Equal(t, http.StatusOK, configRequest(r, http.MethodGet, "/v1/models", "").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, configRequest(r, http.MethodGet, "/v1/models", "").Code)
+
+	// Raise the limit and change the port, which needs a restart
+	t.Setenv("RATE_LIMIT_REQUESTS_PER_MINUTE", "4")
+	t.Setenv("PORT", "9191")
+	w := configRequest(r, http.MethodPost, "/api/v1/admin/config/reload", adminToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Ignored []string               `json:"ignored"`
+		Config  map[string]interface{} `json:"config"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"PORT"}, resp.Ignored)
+	assert.Equal(t, float64(4), resp.Config["RateLimit"])
+	assert.NotEqual(t, "9191", reloader.Current().Port, "the port is kept until a restart")
+
+	// The same window now admits two more requests
+	assert.Equal(t, http.StatusOK, configRequest(r, http.MethodGet, "/v1/models", "").Code)
+	assert.Equal(t, http.StatusOK, configRequest(r, http.MethodGet, "/v1/models", "").Code)
+	assert.Equal(t, http.StatusTooManyRequests, configRequest(r, http.MethodGet, "/v1/models", "").Code)
+}
+
+func TestReloadConfigRejectsInvalidConfig(t *testing.T) {
+	r, reloader, adminToken := setupConfigRouter(t)
+
+	t.Setenv("RATE_LIMIT_REQUESTS_PER_MINUTE", "-5")
+	w := configRequest(r, http.MethodPost, "/api/v1/admin/config/reload", adminToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_config")
+	assert.Equal(t, 2, reloader.Current().RateLimit)
+}
+
+func TestGetActiveConfigRedactsSecrets(t *testing.T) {
+	r, _, adminToken := setupConfigRouter(t)
+
+	assert.Equal(t, http.StatusUnauthorized, configRequest(r, http.MethodGet, "/api/v1/admin/config", "").Code)
+
+	w := configRequest(r, http.MethodGet, "/api/v1/admin/config", adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "sk-upstream-secret")
+	assert.NotContains(t, w.Body.String(), "config-test-secret")
+	var resp struct {
+		Config map[string]interface{} `json:"config"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "[REDACTED]", resp.Config["TargetKey"])
+	assert.Equal(t, float64(2), resp.Config["RateLimit"])
+}
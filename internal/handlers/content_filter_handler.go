@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ListFilterPatterns returns the response filter patterns in the order they apply
+func ListFilterPatterns(filter *middleware.ContentFilter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		patterns := filter.Patterns()
+		specs := make([]middleware.FilterPatternSpec, 0, len(patterns))
+		for _, pattern := range patterns {
+			specs = append(specs, pattern.Spec())
+		}
+		c.JSON(http.StatusOK, gin.H{"patterns": specs})
+	}
+}
+
+// AddFilterPattern adds a response filter pattern without a restart. It is
+// kept in memory only; patterns that should survive restarts belong in the
+// CONTENT_FILTER_PATTERNS file.
+func AddFilterPattern(filter *middleware.ContentFilter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var spec middleware.FilterPatternSpec
+		if err := c.ShouldBindJSON(&spec); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "Invalid request format",
+					"type":    "validation_error",
+					"code":    "invalid_format",
+				},
+			})
+			return
+		}
+
+		pattern, err := middleware.CompileFilterPattern(spec)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "validation_error",
+					"code":    "invalid_filter_pattern",
+				},
+			})
+			return
+		}
+		filter.Add(pattern)
+
+		logrus.WithFields(logrus.Fields{
+			"name":    pattern.Name,
+			"user_id": c.GetString("user_id"),
+		}).Info("Response filter pattern added")
+
+		c.JSON(http.StatusCreated, gin.H{
+			"pattern": pattern.Spec(),
+			"message": "Filter pattern added successfully",
+		})
+	}
+}
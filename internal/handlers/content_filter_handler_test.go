@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddFilterPatternAppliesWithoutRestart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	filter := middleware.NewContentFilter(middleware.DefaultFilterPatterns())
+	r := gin.New()
+	r.GET("/api/v1/admin/filter-patterns", ListFilterPatterns(filter))
+	r.POST("/api/v1/admin/filter-patterns", AddFilterPattern(filter))
+	r.GET("/v1/answer", filter.Middleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"content": "employee E-104233, ssn 078-05-1120"})
+	})
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Contains(t, do(http.MethodGet, "/v1/answer", "").Body.String(), "employee E-104233, ssn [SSN]")
+
+	w := do(http.MethodPost, "/api/v1/admin/filter-patterns", `{"name":"employee_id","pattern":"E-\\d{6}","replacement":"[EMPLOYEE]"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Contains(t, do(http.MethodGet, "/v1/answer", "").Body.String(), "employee [EMPLOYEE], ssn [SSN]")
+
+	w = do(http.MethodGet, "/api/v1/admin/filter-patterns", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed struct {
+		Patterns []middleware.FilterPatternSpec `json:"patterns"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed.Patterns, len(middleware.DefaultFilterPatterns())+1)
+	assert.Equal(t, middleware.FilterPatternSpec{Name: "employee_id", Pattern: `E-\d{6}`, Replacement: "[EMPLOYEE]"}, listed.Patterns[len(listed.Patterns)-1])
+
+	w = do(http.MethodPost, "/api/v1/admin/filter-patterns", `{"name":"broken","pattern":"(unclosed"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_filter_pattern")
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/v1/admin/filter-patterns", `not json`).Code)
+}
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errSessionNotFound     = errors.New("session not found")
+	errBranchDepthExceeded = errors.New("maximum branch depth reached")
+	errBranchLimitExceeded = errors.New("maximum number of branches reached")
+	errBranchPosition      = errors.New("branch position is outside the conversation")
+	errSessionTooLong      = errors.New("session message limit reached")
+)
+
+// ConversationSession 服务端保存的会话。分支会话复制父会话在分支点之前的历史，
+// 之后与父会话互不影响；同一棵树共享根会话ID。
+type ConversationSession struct {
+	ID          string                   `json:"session_id"`
+	ParentID    string                   `json:"parent_id,omitempty"`
+	RootID      string                   `json:"root_id"`
+	Depth       int                      `json:"depth"`
+	BranchPoint int                      `json:"branch_point,omitempty"` // messages inherited from the parent
+	Model       string                   `json:"model,omitempty"`
+	Messages    []map[string]interface{} `json:"messages"`
+	CreatedAt   time.Time                `json:"created_at"`
+	UpdatedAt   time.Time                `json:"updated_at"`
+
+	owner    string
+	children []string
+}
+
+// SessionTree 会话树中的一个节点及其所有分支
+type SessionTree struct {
+	ConversationSession
+	Branches []*SessionTree `json:"branches"`
+}
+
+// sessionTreeState tracks the size and activity of one conversation tree
+type sessionTreeState struct {
+	branches   int
+	lastActive time.Time
+}
+
+// ConversationSessions 会话存储，按调用方隔离；整棵树空闲超过TTL后被清理
+type ConversationSessions struct {
+	cfg config.SessionConfig
+	now func() time.Time
+
+	mu        sync.Mutex
+	sessions  map[string]*ConversationSession
+	trees     map[string]*sessionTreeState // root ID -> state
+	lastSweep time.Time
+}
+
+// NewConversationSessions creates an in-memory session store
+func NewConversationSessions(cfg config.SessionConfig) *ConversationSessions {
+	return &ConversationSessions{
+		cfg:      cfg,
+		now:      time.Now,
+		sessions: make(map[string]*ConversationSession),
+		trees:    make(map[string]*sessionTreeState),
+	}
+}
+
+func newSessionID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "sess_" + hex.EncodeToString(b)
+}
+
+// copySession returns a snapshot safe to hand out of the lock
+func copySession(s *ConversationSession) ConversationSession {
+	out := *s
+	out.Messages = append([]map[string]interface{}{}, s.Messages...)
+	out.children = nil
+	return out
+}
+
+// sweepLocked drops trees idle longer than the TTL; callers hold mu
+func (cs *ConversationSessions) sweepLocked(now time.Time) {
+	if now.Sub(cs.lastSweep) < cs.cfg.TTL/10 {
+		return
+	}
+	cs.lastSweep = now
+	for rootID, tree := range cs.trees {
+		if now.Sub(tree.lastActive) < cs.cfg.TTL {
+			continue
+		}
+		delete(cs.trees, rootID)
+		for id, session := range cs.sessions {
+			if session.RootID == rootID {
+				delete(cs.sessions, id)
+			}
+		}
+	}
+}
+
+// getLocked returns a live session owned by owner; callers hold mu
+func (cs *ConversationSessions) getLocked(owner, id string) (*ConversationSession, error) {
+	session, ok := cs.sessions[id]
+	if !ok || session.owner != owner {
+		return nil, errSessionNotFound
+	}
+	if tree := cs.trees[session.RootID]; tree == nil || cs.now().Sub(tree.lastActive) >= cs.cfg.TTL {
+		return nil, errSessionNotFound
+	}
+	return session, nil
+}
+
+// Create starts a new conversation tree
+func (cs *ConversationSessions) Create(owner, model string, messages []map[string]interface{}) (ConversationSession, error) {
+	if len(messages) > cs.cfg.MaxMessages {
+		return ConversationSession{}, errSessionTooLong
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	now := cs.now()
+	cs.sweepLocked(now)
+	id := newSessionID()
+	session := &ConversationSession{
+		ID:        id,
+		RootID:    id,
+		Model:     model,
+		Messages:  append([]map[string]interface{}{}, messages...),
+		CreatedAt: now,
+		UpdatedAt: now,
+		owner:     owner,
+	}
+	cs.sessions[id] = session
+	cs.trees[id] = &sessionTreeState{lastActive: now}
+	return copySession(session), nil
+}
+
+// Get returns a session owned by owner
+func (cs *ConversationSessions) Get(owner, id string) (ConversationSession, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	session, err := cs.getLocked(owner, id)
+	if err != nil {
+		return ConversationSession{}, err
+	}
+	return copySession(session), nil
+}
+
+// Append continues a session; its branches and parent are unaffected
+func (cs *ConversationSessions) Append(owner, id string, messages []map[string]interface{}) (ConversationSession, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	session, err := cs.getLocked(owner, id)
+	if err != nil {
+		return ConversationSession{}, err
+	}
+	if len(session.Messages)+len(messages) > cs.cfg.MaxMessages {
+		return ConversationSession{}, errSessionTooLong
+	}
+	now := cs.now()
+	session.Messages = append(session.Messages, messages...)
+	session.UpdatedAt = now
+	cs.trees[session.RootID].lastActive = now
+	return copySession(session), nil
+}
+
+// Branch copies the first `at` messages of a session into a new child session;
+// a negative position branches at the current end of the conversation
+func (cs *ConversationSessions) Branch(owner, id string, at int) (ConversationSession, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	parent, err := cs.getLocked(owner, id)
+	if err != nil {
+		return ConversationSession{}, err
+	}
+	if at < 0 {
+		at = len(parent.Messages)
+	}
+	if at > len(parent.Messages) {
+		return ConversationSession{}, errBranchPosition
+	}
+	if parent.Depth+1 > cs.cfg.MaxBranchDepth {
+		return ConversationSession{}, errBranchDepthExceeded
+	}
+	tree := cs.trees[parent.RootID]
+	if tree.branches >= cs.cfg.MaxBranches {
+		return ConversationSession{}, errBranchLimitExceeded
+	}
+
+	now := cs.now()
+	child := &ConversationSession{
+		ID:          newSessionID(),
+		ParentID:    parent.ID,
+		RootID:      parent.RootID,
+		Depth:       parent.Depth + 1,
+		BranchPoint: at,
+		Model:       parent.Model,
+		// Messages are never mutated in place, so sharing the maps is safe
+		Messages:  append([]map[string]interface{}{}, parent.Messages[:at]...),
+		CreatedAt: now,
+		UpdatedAt: now,
+		owner:     owner,
+	}
+	cs.sessions[child.ID] = child
+	parent.children = append(parent.children, child.ID)
+	tree.branches++
+	tree.lastActive = now
+	return copySession(child), nil
+}
+
+// Tree returns the whole conversation tree a session belongs to, from its root
+func (cs *ConversationSessions) Tree(owner, id string) (*SessionTree, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	session, err := cs.getLocked(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	return cs.buildTreeLocked(cs.sessions[session.RootID]), nil
+}
+
+func (cs *ConversationSessions) buildTreeLocked(session *ConversationSession) *SessionTree {
+	node := &SessionTree{ConversationSession: copySession(session), Branches: []*SessionTree{}}
+	for _, childID := range session.children {
+		if child, ok := cs.sessions[childID]; ok {
+			node.Branches = append(node.Branches, cs.buildTreeLocked(child))
+		}
+	}
+	return node
+}
+
+// sessionOwner scopes sessions to the calling API key
+func sessionOwner(c *gin.Context) string {
+	return DefaultModelCaller(c).KeyID
+}
+
+func sessionError(c *gin.Context, err error) {
+	status, code := http.StatusBadRequest, "invalid_request"
+	switch {
+	case errors.Is(err, errSessionNotFound):
+		status, code = http.StatusNotFound, "session_not_found"
+	case errors.Is(err, errBranchDepthExceeded):
+		status, code = http.StatusUnprocessableEntity, "branch_depth_exceeded"
+	case errors.Is(err, errBranchLimitExceeded):
+		status, code = http.StatusUnprocessableEntity, "branch_limit_exceeded"
+	case errors.Is(err, errBranchPosition):
+		code = "invalid_branch_position"
+	case errors.Is(err, errSessionTooLong):
+		status, code = http.StatusUnprocessableEntity, "session_too_long"
+	}
+	c.JSON(status, gin.H{
+		"error": gin.H{
+			"message": err.Error(),
+			"type":    "invalid_request_error",
+			"code":    code,
+		},
+	})
+}
+
+// SessionMessagesRequest 创建或续写会话的请求
+type SessionMessagesRequest struct {
+	Model    string                   `json:"model"`
+	Messages []map[string]interface{} `json:"messages"`
+}
+
+// BranchSessionRequest 分支请求；At 为空时在当前位置分支
+type BranchSessionRequest struct {
+	At *int `json:"at"`
+}
+
+// CreateSession starts a conversation session
+func CreateSession(cs *ConversationSessions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SessionMessagesRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			sessionError(c, fmt.Errorf("invalid request format"))
+			return
+		}
+		session, err := cs.Create(sessionOwner(c), req.Model, req.Messages)
+		if err != nil {
+			sessionError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, session)
+	}
+}
+
+// GetSession returns a session with its messages
+func GetSession(cs *ConversationSessions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, err := cs.Get(sessionOwner(c), c.Param("id"))
+		if err != nil {
+			sessionError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+// AppendSessionMessages continues a session with more messages
+func AppendSessionMessages(cs *ConversationSessions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req SessionMessagesRequest
+		if err := c.ShouldBindJSON(&req); err != nil || len(req.Messages) == 0 {
+			sessionError(c, fmt.Errorf("messages are required"))
+			return
+		}
+		session, err := cs.Append(sessionOwner(c), c.Param("id"), req.Messages)
+		if err != nil {
+			sessionError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, session)
+	}
+}
+
+// BranchSession copies a session's history into a new branch
+func BranchSession(cs *ConversationSessions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req BranchSessionRequest
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				sessionError(c, fmt.Errorf("invalid request format"))
+				return
+			}
+		}
+		at := -1
+		if req.At != nil {
+			if *req.At < 0 {
+				sessionError(c, errBranchPosition)
+				return
+			}
+			at = *req.At
+		}
+
+		session, err := cs.Branch(sessionOwner(c), c.Param("id"), at)
+		if err != nil {
+			sessionError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, session)
+	}
+}
+
+// GetSessionTree returns the conversation tree a session belongs to
+func GetSessionTree(cs *ConversationSessions) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tree, err := cs.Tree(sessionOwner(c), c.Param("id"))
+		if err != nil {
+			sessionError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, tree)
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSessionRouter(cfg config.SessionConfig) (*gin.Engine, *ConversationSessions) {
+	gin.SetMode(gin.TestMode)
+	sessions := NewConversationSessions(cfg)
+	router := gin.New()
+	router.POST("/api/v1/sessions", CreateSession(sessions))
+	router.GET("/api/v1/sessions/:id", GetSession(sessions))
+	router.POST("/api/v1/sessions/:id/messages", AppendSessionMessages(sessions))
+	router.POST("/api/v1/sessions/:id/branch", BranchSession(sessions))
+	router.GET("/api/v1/sessions/:id/tree", GetSessionTree(sessions))
+	return router, sessions
+}
+
+func defaultSessionConfig() config.SessionConfig {
+	return config.SessionConfig{MaxBranchDepth: 5, MaxBranches: 10, MaxMessages: 500, TTL: time.Hour}
+}
+
+func sessionCall(router *gin.Engine, method, path, apiKey, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func decodeSession(t *testing.T, w *httptest.ResponseRecorder) ConversationSession {
+	var session ConversationSession
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session), w.Body.String())
+	return session
+}
+
+func userTurns(texts ...string) string {
+	messages := make([]map[string]string, 0, len(texts))
+	for _, text := range texts {
+		messages = append(messages, map[string]string{"role": "user", "content": text})
+	}
+	data, _ := json.Marshal(map[string]interface{}{"model": "qwen-turbo", "messages": messages})
+	return string(data)
+}
+
+func TestSessionBranchCopiesHistory(t *testing.T) {
+	router, _ := setupSessionRouter(defaultSessionConfig())
+
+	w := sessionCall(router, http.MethodPost, "/api/v1/sessions", "key-a", userTurns("one", "two", "three"))
+	require.Equal(t, http.StatusCreated, w.Code)
+	root := decodeSession(t, w)
+	assert.Equal(t, root.ID, root.RootID)
+
+	// Default branch point is the current end of the conversation
+	w = sessionCall(router, http.MethodPost, "/api/v1/sessions/"+root.ID+"/branch", "key-a", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	branch := decodeSession(t, w)
+	assert.NotEqual(t, root.ID, branch.ID)
+	assert.Equal(t, root.ID, branch.ParentID)
+	assert.Equal(t, root.ID, branch.RootID)
+	assert.Equal(t, 1, branch.Depth)
+	assert.Len(t, branch.Messages, 3)
+
+	// An explicit position keeps only the earlier messages
+	w = sessionCall(router, http.MethodPost, "/api/v1/sessions/"+root.ID+"/branch", "key-a", `{"at":1}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	early := decodeSession(t, w)
+	require.Len(t, early.Messages, 1)
+	assert.Equal(t, "one", early.Messages[0]["content"])
+
+	w = sessionCall(router, http.MethodPost, "/api/v1/sessions/"+root.ID+"/branch", "key-a", `{"at":4}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_branch_position")
+
+	// Sessions are private to the API key that created them
+	w = sessionCall(router, http.MethodPost, "/api/v1/sessions/"+root.ID+"/branch", "key-b", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = sessionCall(router, http.MethodGet, "/api/v1/sessions/"+root.ID+"/tree", "key-b", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSessionBranchesContinueIndependently(t *testing.T) {
+	router, _ := setupSessionRouter(defaultSessionConfig())
+
+	root := decodeSession(t, sessionCall(router, http.MethodPost, "/api/v1/sessions", "key-a", userTurns("hello")))
+	branch := decodeSession(t, sessionCall(router, http.MethodPost, "/api/v1/sessions/"+root.ID+"/branch", "key-a", ""))
+
+	w := sessionCall(router, http.MethodPost, "/api/v1/sessions/"+branch.ID+"/messages", "key-a", userTurns("branch turn"))
+	require.Equal(t, http.StatusOK, w.Code)
+	w = sessionCall(router, http.MethodPost, "/api/v1/sessions/"+root.ID+"/messages", "key-a", userTurns("root turn", "another"))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	got := decodeSession(t, sessionCall(router, http.MethodGet, "/api/v1/sessions/"+branch.ID, "key-a", ""))
+	require.Len(t, got.Messages, 2)
+	assert.Equal(t, "branch turn", got.Messages[1]["content"])
+	got = decodeSession(t, sessionCall(router, http.MethodGet, "/api/v1/sessions/"+root.ID, "key-a", ""))
+	require.Len(t, got.Messages, 3)
+	assert.Equal(t, "root turn", got.Messages[1]["content"])
+
+	// The tree is the same whichever node it is requested from
+	nested := decodeSession(t, sessionCall(router, http.MethodPost, "/api/v1/sessions/"+branch.ID+"/branch", "key-a", ""))
+	w = sessionCall(router, http.MethodGet, "/api/v1/sessions/"+nested.ID+"/tree", "key-a", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var tree SessionTree
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tree))
+	assert.Equal(t, root.ID, tree.ID)
+	require.Len(t, tree.Branches, 1)
+	assert.Equal(t, branch.ID, tree.Branches[0].ID)
+	require.Len(t, tree.Branches[0].Branches, 1)
+	assert.Equal(t, nested.ID, tree.Branches[0].Branches[0].ID)
+	assert.Empty(t, tree.Branches[0].Branches[0].Branches)
+}
+
+func TestSessionBranchLimits(t *testing.T) {
+	cfg := defaultSessionConfig()
+	cfg.MaxBranchDepth = 2
+	cfg.MaxBranches = 3
+	router, _ := setupSessionRouter(cfg)
+
+	root := decodeSession(t, sessionCall(router, http.MethodPost, "/api/v1/sessions", "key-a", userTurns("hello")))
+	id := root.ID
+	for depth := 1; depth <= 2; depth++ {
+		w := sessionCall(router, http.MethodPost, "/api/v1/sessions/"+id+"/branch", "key-a", "")
+		require.Equal(t, http.StatusCreated, w.Code)
+		id = decodeSession(t, w).ID
+	}
+	w := sessionCall(router, http.MethodPost, "/api/v1/sessions/"+id+"/branch", "key-a", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "branch_depth_exceeded")
+
+	// The root can still branch until the tree holds MaxBranches branches
+	w = sessionCall(router, http.MethodPost, "/api/v1/sessions/"+root.ID+"/branch", "key-a", "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = sessionCall(router, http.MethodPost, "/api/v1/sessions/"+root.ID+"/branch", "key-a", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "branch_limit_exceeded")
+}
+
+func TestSessionTreeExpires(t *testing.T) {
+	cfg := defaultSessionConfig()
+	router, sessions := setupSessionRouter(cfg)
+	now := time.Now()
+	sessions.now = func() time.Time { return now }
+
+	root := decodeSession(t, sessionCall(router, http.MethodPost, "/api/v1/sessions", "key-a", userTurns("hello")))
+	branch := decodeSession(t, sessionCall(router, http.MethodPost, "/api/v1/sessions/"+root.ID+"/branch", "key-a", ""))
+
+	// Activity anywhere in the tree keeps the whole tree alive
+	now = now.Add(cfg.TTL - time.Minute)
+	require.Equal(t, http.StatusOK, sessionCall(router, http.MethodPost, "/api/v1/sessions/"+branch.ID+"/messages", "key-a", userTurns("more")).Code)
+	now = now.Add(cfg.TTL - time.Minute)
+	assert.Equal(t, http.StatusOK, sessionCall(router, http.MethodGet, "/api/v1/sessions/"+root.ID, "key-a", "").Code)
+
+	now = now.Add(cfg.TTL)
+	assert.Equal(t, http.StatusNotFound, sessionCall(router, http.MethodGet, "/api/v1/sessions/"+root.ID, "key-a", "").Code)
+	sessionCall(router, http.MethodPost, "/api/v1/sessions", "key-a", userTurns("new"))
+	sessions.mu.Lock()
+	defer sessions.mu.Unlock()
+	assert.Len(t, sessions.sessions, 1)
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-aigateway/internal/monitoring"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultDebugCaptureLimit = 50
+
+// DebugCaptureRequest 手动开启/关闭调试抓取的请求
+type DebugCaptureRequest struct {
+	Route       string `json:"route" binding:"required"`
+	Model       string `json:"model"`
+	Category    string `json:"category"`
+	DurationSec int    `json:"duration_seconds"`
+	MaxCaptures int    `json:"max_captures"`
+}
+
+func (r DebugCaptureRequest) target() monitoring.CaptureTarget {
+	return monitoring.CaptureTarget{Route: r.Route, Model: r.Model, Category: r.Category}
+}
+
+func invalidDebugCaptureRequest(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "invalid_request_error",
+			"code":    "invalid_parameter",
+		},
+	})
+}
+
+// GetDebugCaptures lists live activations and the redacted exchanges captured,
+// filtered by ?route, ?model and ?category, newest first
+func GetDebugCaptures(dc *monitoring.DebugCapture) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultDebugCaptureLimit)))
+		if err != nil || limit <= 0 {
+			invalidDebugCaptureRequest(c, "limit must be a positive integer")
+			return
+		}
+		filter := monitoring.CaptureTarget{
+			Route:    c.Query("route"),
+			Model:    c.Query("model"),
+			Category: c.Query("category"),
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"activations":  dc.Activations(),
+			"captures":     dc.Captures(filter, limit),
+			"memory_bytes": dc.MemoryUsage(),
+		})
+	}
+}
+
+// StartDebugCapture arms capture for a route, model and error category by hand
+func StartDebugCapture(dc *monitoring.DebugCapture) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req DebugCaptureRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			invalidDebugCaptureRequest(c, "route is required")
+			return
+		}
+		activation, err := dc.Start(req.target(), c.GetString("user_id"), time.Duration(req.DurationSec)*time.Second, req.MaxCaptures)
+		if err != nil {
+			invalidDebugCaptureRequest(c, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"activation": activation})
+	}
+}
+
+// StopDebugCapture disarms a capture before it expires
+func StopDebugCapture(dc *monitoring.DebugCapture) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req DebugCaptureRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			invalidDebugCaptureRequest(c, "route is required")
+			return
+		}
+		if !dc.Stop(req.target(), c.GetString("user_id")) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{
+					"message": "No debug capture is active for this target",
+					"type":    "not_found_error",
+					"code":    "capture_not_found",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"stopped": true})
+	}
+}
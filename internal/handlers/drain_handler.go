@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"go-aigateway/internal/lifecycle"
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Readiness fails as soon as shutdown draining starts so load balancers stop routing here,
+// and while a required component is not running
+func Readiness(drainer *middleware.Drainer, components *lifecycle.Manager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if drainer.Draining() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":    "draining",
+				"timestamp": time.Now().Unix(),
+			})
+			return
+		}
+		var statuses []lifecycle.ComponentStatus
+		if components != nil {
+			statuses = components.Statuses()
+			if !components.Ready() {
+				c.JSON(http.StatusServiceUnavailable, gin.H{
+					"status":     "not_ready",
+					"components": statuses,
+					"timestamp":  time.Now().Unix(),
+				})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status":     "ready",
+			"components": statuses,
+			"timestamp":  time.Now().Unix(),
+		})
+	}
+}
+
+// GetInflight lists in-flight request counts by route and the oldest request age
+func GetInflight(drainer *middleware.Drainer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, drainer.Snapshot())
+	}
+}
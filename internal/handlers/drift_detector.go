@@ -0,0 +1,798 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/flags"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/monitoring"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Sentinel run statuses
+const (
+	SentinelRunOK      = "ok"
+	SentinelRunError   = "error"
+	SentinelRunSkipped = "skipped" // the daily sentinel token budget is spent
+)
+
+const (
+	sentinelsKey            = "gw:sentinels"
+	sentinelHistoryPrefix   = "gw:sentinel_history:"
+	sentinelLockPrefix      = "gw:sentinel_lock:"
+	sentinelTokensPrefix    = "gw:sentinel_tokens:"
+	sentinelRunTimeout      = 60 * time.Second
+	sentinelMaxResponseSize = 4096 // characters of a response kept in history
+)
+
+// Sentinel defaults
+const (
+	defaultSentinelMaxTokens       = 256
+	defaultSentinelThreshold       = 0.8
+	defaultSentinelConsecutiveRuns = 3
+)
+
+// ErrSentinelNotFound is returned for unknown sentinel IDs
+var ErrSentinelNotFound = errors.New("sentinel not found")
+
+// Sentinel calls are bounded by sentinelRunTimeout through their context
+var sentinelClient = httpclient.NewClient("sentinel", 0)
+
+// SentinelAlertSink 接收哨兵漂移告警，*monitoring.MonitoringSystem 实现了该接口
+type SentinelAlertSink interface {
+	EvaluateRule(ctx context.Context, rule *monitoring.Rule, value float64, firing bool)
+}
+
+// SentinelMessage is one message of a sentinel's pinned chat request
+type SentinelMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// SentinelBaseline 哨兵提示词的基线回答及其指纹
+type SentinelBaseline struct {
+	Fingerprint string    `json:"fingerprint"` // sha256 of the sorted response tokens
+	Response    string    `json:"response"`
+	ApprovedAt  time.Time `json:"approved_at"`
+	ApprovedBy  string    `json:"approved_by,omitempty"` // empty when captured by the first run
+}
+
+// Sentinel 固定的哨兵提示词：以 temperature 0 定期发送给服务商，
+// 回答与基线的相似度持续偏低时说明服务商悄悄更换了模型版本
+type Sentinel struct {
+	ID              string            `json:"id"`
+	Name            string            `json:"name"`
+	Provider        string            `json:"provider"`
+	Model           string            `json:"model"`
+	SystemPrompt    string            `json:"system_prompt,omitempty"` // prompt template reference prepended as the system message
+	Messages        []SentinelMessage `json:"messages"`
+	MaxTokens       int               `json:"max_tokens"`
+	IntervalSeconds int               `json:"interval_seconds"`
+	Threshold       float64           `json:"threshold"`        // similarity below which a run counts as drifted
+	ConsecutiveRuns int               `json:"consecutive_runs"` // drifted runs in a row that raise the alert
+	Baseline        *SentinelBaseline `json:"baseline,omitempty"`
+	LastRunAt       *time.Time        `json:"last_run_at,omitempty"`
+	LastSimilarity  *float64          `json:"last_similarity,omitempty"`
+	LastResponse    string            `json:"last_response,omitempty"`
+	DriftStreak     int               `json:"drift_streak"`
+	CreatedAt       time.Time         `json:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at"`
+}
+
+// Validate checks the definition and fills in defaults
+func (s *Sentinel) Validate(targets map[string]SmokeTarget) error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("name is required")
+	}
+	if s.Provider == "" {
+		s.Provider = "openai"
+	}
+	target, ok := targets[s.Provider]
+	if !ok {
+		return fmt.Errorf("unknown or unconfigured provider: %s", s.Provider)
+	}
+	if s.Model == "" {
+		s.Model = target.Model
+	}
+	if s.Model == "" {
+		return errors.New("model is required")
+	}
+	if len(s.Messages) == 0 {
+		return errors.New("messages are required")
+	}
+	if s.SystemPrompt != "" {
+		if _, err := ParsePromptRef(s.SystemPrompt); err != nil {
+			return err
+		}
+	}
+	for _, m := range s.Messages {
+		if m.Role == "" || m.Content == "" {
+			return errors.New("every message needs a role and content")
+		}
+	}
+	if s.MaxTokens == 0 {
+		s.MaxTokens = defaultSentinelMaxTokens
+	}
+	if s.Threshold == 0 {
+		s.Threshold = defaultSentinelThreshold
+	}
+	if s.ConsecutiveRuns == 0 {
+		s.ConsecutiveRuns = defaultSentinelConsecutiveRuns
+	}
+	switch {
+	case s.MaxTokens < 0:
+		return errors.New("max_tokens must be positive")
+	case s.IntervalSeconds < 0:
+		return errors.New("interval_seconds must not be negative")
+	case s.Threshold < 0 || s.Threshold > 1:
+		return errors.New("threshold must be between 0 and 1")
+	case s.ConsecutiveRuns < 0:
+		return errors.New("consecutive_runs must be positive")
+	}
+	return nil
+}
+
+// SentinelRun 一次哨兵运行的记录
+type SentinelRun struct {
+	At         time.Time `json:"at"`
+	Status     string    `json:"status"`
+	Similarity *float64  `json:"similarity,omitempty"`
+	Drifted    bool      `json:"drifted"`
+	Response   string    `json:"response,omitempty"`
+	Tokens     int       `json:"tokens"`
+	Error      string    `json:"error,omitempty"`
+
+	// Prompt template versions the run was sent with
+	PromptTemplates []AppliedPrompt `json:"prompt_templates,omitempty"`
+}
+
+// DriftDetector 定期运行哨兵提示词，检测服务商模型版本变化导致的回答漂移。
+// 定义、运行历史和每日 token 用量都保存在 Redis 中；每个哨兵的运行由分布式锁保护，
+// 多实例部署时同一时刻只有一个实例运行它。
+type DriftDetector struct {
+	client     *redis.Client
+	cfg        config.SentinelConfig
+	targets    map[string]SmokeTarget
+	alerts     SentinelAlertSink
+	instanceID string
+	now        func() time.Time
+}
+
+// NewDriftDetector creates a detector calling the given providers. alerts is optional.
+func NewDriftDetector(client *redis.Client, cfg config.SentinelConfig, targets map[string]SmokeTarget, alerts SentinelAlertSink) *DriftDetector {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &DriftDetector{
+		client:     client,
+		cfg:        cfg,
+		targets:    targets,
+		alerts:     alerts,
+		instanceID: hex.EncodeToString(id),
+		now:        time.Now,
+	}
+}
+
+// Targets returns the providers sentinels may run against
+func (d *DriftDetector) Targets() map[string]SmokeTarget {
+	return d.targets
+}
+
+// Create validates and stores a new sentinel; its first run captures the baseline
+func (d *DriftDetector) Create(ctx context.Context, s *Sentinel) error {
+	if err := s.Validate(d.targets); err != nil {
+		return err
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	s.ID = "snt_" + hex.EncodeToString(id)
+	s.CreatedAt = d.now()
+	s.Baseline = nil
+	s.LastRunAt, s.LastSimilarity, s.LastResponse, s.DriftStreak = nil, nil, "", 0
+	return d.save(ctx, s)
+}
+
+func (d *DriftDetector) save(ctx context.Context, s *Sentinel) error {
+	s.UpdatedAt = d.now()
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := d.client.HSet(ctx, sentinelsKey, s.ID, data).Err(); err != nil {
+		return fmt.Errorf("failed to store sentinel: %w", err)
+	}
+	return nil
+}
+
+// Get returns one sentinel
+func (d *DriftDetector) Get(ctx context.Context, id string) (*Sentinel, error) {
+	data, err := d.client.HGet(ctx, sentinelsKey, id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSentinelNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sentinel: %w", err)
+	}
+	var s Sentinel
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode sentinel: %w", err)
+	}
+	return &s, nil
+}
+
+// List returns every sentinel, oldest first
+func (d *DriftDetector) List(ctx context.Context) ([]*Sentinel, error) {
+	records, err := d.client.HGetAll(ctx, sentinelsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sentinels: %w", err)
+	}
+	sentinels := make([]*Sentinel, 0, len(records))
+	for id, data := range records {
+		var s Sentinel
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			logrus.WithError(err).WithField("sentinel", id).Warn("Skipping unreadable sentinel")
+			continue
+		}
+		sentinels = append(sentinels, &s)
+	}
+	sort.Slice(sentinels, func(i, j int) bool {
+		return sentinels[i].CreatedAt.Before(sentinels[j].CreatedAt)
+	})
+	return sentinels, nil
+}
+
+// PromptRefs lists the prompt templates referenced by sentinels, so they cannot be retired while in use
+func (d *DriftDetector) PromptRefs(ctx context.Context) ([]string, error) {
+	sentinels, err := d.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, s := range sentinels {
+		if s.SystemPrompt != "" {
+			refs = append(refs, s.SystemPrompt)
+		}
+	}
+	return refs, nil
+}
+
+// Delete removes a sentinel, its history and any alert it raised
+func (d *DriftDetector) Delete(ctx context.Context, id string) error {
+	s, err := d.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := d.client.HDel(ctx, sentinelsKey, id).Err(); err != nil {
+		return fmt.Errorf("failed to delete sentinel: %w", err)
+	}
+	d.client.Del(ctx, sentinelHistoryPrefix+id)
+	d.raiseAlert(ctx, s, false)
+	return nil
+}
+
+// History returns the most recent runs of a sentinel, newest first
+func (d *DriftDetector) History(ctx context.Context, id string, limit int) ([]SentinelRun, error) {
+	if _, err := d.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > d.cfg.HistoryLimit {
+		limit = d.cfg.HistoryLimit
+	}
+	records, err := d.client.LRange(ctx, sentinelHistoryPrefix+id, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sentinel history: %w", err)
+	}
+	runs := make([]SentinelRun, 0, len(records))
+	for _, data := range records {
+		var run SentinelRun
+		if err := json.Unmarshal([]byte(data), &run); err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// Approve makes response the new baseline, or the last response when empty,
+// and clears any drift alert
+func (d *DriftDetector) Approve(ctx context.Context, id, response, approvedBy string) (*Sentinel, error) {
+	s, err := d.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if response == "" {
+		response = s.LastResponse
+	}
+	if response == "" {
+		return nil, errors.New("sentinel has not run yet; pass the baseline response explicitly")
+	}
+	s.Baseline = newSentinelBaseline(response, approvedBy, d.now())
+	s.DriftStreak = 0
+	if err := d.save(ctx, s); err != nil {
+		return nil, err
+	}
+	d.raiseAlert(ctx, s, false)
+	return s, nil
+}
+
+func newSentinelBaseline(response, approvedBy string, at time.Time) *SentinelBaseline {
+	return &SentinelBaseline{
+		Fingerprint: responseFingerprint(response),
+		Response:    response,
+		ApprovedAt:  at,
+		ApprovedBy:  approvedBy,
+	}
+}
+
+// responseFingerprint hashes the sorted token set, so whitespace, case and
+// punctuation changes keep the fingerprint
+func responseFingerprint(response string) string {
+	set := tokenSet(response)
+	tokens := make([]string, 0, len(set))
+	for token := range set {
+		tokens = append(tokens, token)
+	}
+	sort.Strings(tokens)
+	sum := sha256.Sum256([]byte(strings.Join(tokens, " ")))
+	return hex.EncodeToString(sum[:])
+}
+
+// interval is how often the sentinel runs
+func (d *DriftDetector) interval(s *Sentinel) time.Duration {
+	if s.IntervalSeconds > 0 {
+		return time.Duration(s.IntervalSeconds) * time.Second
+	}
+	return d.cfg.DefaultInterval
+}
+
+// Start runs due sentinels every check interval until ctx is done
+func (d *DriftDetector) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.RunDue(ctx)
+		}
+	}
+}
+
+// RunDue runs every sentinel whose interval has passed since its last run
+func (d *DriftDetector) RunDue(ctx context.Context) {
+	sentinels, err := d.List(ctx)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to list sentinels")
+		return
+	}
+	now := d.now()
+	for _, s := range sentinels {
+		if s.LastRunAt != nil && now.Sub(*s.LastRunAt) < d.interval(s) {
+			continue
+		}
+		if _, err := d.Run(ctx, s.ID, false); err != nil {
+			logrus.WithError(err).WithField("sentinel", s.ID).Warn("Sentinel run failed")
+		}
+	}
+}
+
+// Run runs one sentinel under its distributed lock. A nil run means another
+// instance holds the lock, or, unless force, the sentinel ran within its interval.
+func (d *DriftDetector) Run(ctx context.Context, id string, force bool) (*SentinelRun, error) {
+	if _, err := d.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	// The lock spans one run; the last run time re-read under it keeps the cadence
+	lockKey := sentinelLockPrefix + id
+	acquired, err := d.client.SetNX(ctx, lockKey, d.instanceID, sentinelRunTimeout+10*time.Second).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire sentinel lock: %w", err)
+	}
+	if !acquired {
+		return nil, nil
+	}
+	defer d.client.Del(context.Background(), lockKey)
+
+	// Reload under the lock; another instance may have just run it
+	s, err := d.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !force && s.LastRunAt != nil && d.now().Sub(*s.LastRunAt) < d.interval(s) {
+		return nil, nil
+	}
+
+	run := d.execute(ctx, s)
+	if err := d.record(ctx, s, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// execute calls the provider and compares the answer with the baseline
+func (d *DriftDetector) execute(ctx context.Context, s *Sentinel) *SentinelRun {
+	run := &SentinelRun{At: d.now(), Status: SentinelRunError}
+
+	tokensKey := sentinelTokensPrefix + run.At.UTC().Format("20060102")
+	if budget := d.cfg.DailyTokenBudget; budget > 0 {
+		spent, err := d.client.Get(ctx, tokensKey).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			run.Error = "failed to read sentinel token budget"
+			return run
+		}
+		// Reserve the worst case so the budget is never overrun
+		if spent+int64(s.MaxTokens) > budget {
+			run.Status = SentinelRunSkipped
+			run.Error = "daily sentinel token budget exhausted"
+			return run
+		}
+	}
+
+	target, ok := d.targets[s.Provider]
+	if !ok {
+		run.Error = "provider is no longer configured: " + s.Provider
+		return run
+	}
+	messages := s.Messages
+	if s.SystemPrompt != "" {
+		ps := DefaultPromptStore()
+		if ps == nil {
+			run.Error = "prompt templates are not enabled"
+			return run
+		}
+		t, err := ps.Resolve(s.SystemPrompt, flags.Subject{})
+		if err != nil {
+			run.Error = err.Error()
+			return run
+		}
+		messages = append([]SentinelMessage{{Role: "system", Content: t.Body}}, messages...)
+		run.PromptTemplates = []AppliedPrompt{{Ref: t.Ref(), Hash: t.Hash}}
+	}
+	response, tokens, err := callSentinel(ctx, target, s, messages)
+	run.Tokens = tokens
+	if tokens > 0 {
+		pipe := d.client.TxPipeline()
+		pipe.IncrBy(ctx, tokensKey, int64(tokens))
+		pipe.Expire(ctx, tokensKey, 48*time.Hour)
+		if _, err := pipe.Exec(ctx); err != nil {
+			logrus.WithError(err).Warn("Failed to record sentinel token usage")
+		}
+	}
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+
+	run.Status = SentinelRunOK
+	run.Response = response
+	if s.Baseline != nil {
+		similarity := jaccard(tokenSet(s.Baseline.Response), tokenSet(response))
+		run.Similarity = &similarity
+		run.Drifted = similarity < s.Threshold
+	}
+	return run
+}
+
+// callSentinel sends the pinned request at temperature 0 and returns the answer and tokens spent
+func callSentinel(ctx context.Context, target SmokeTarget, s *Sentinel, messages []SentinelMessage) (string, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, sentinelRunTimeout)
+	defer cancel()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model":       s.Model,
+		"messages":    messages,
+		"max_tokens":  s.MaxTokens,
+		"temperature": 0,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	endpoint := strings.TrimSuffix(target.BaseURL, "/") + "/chat/completions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gateway-Internal", "sentinel")
+	if target.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+target.APIKey)
+	}
+
+	start := time.Now()
+	resp, err := sentinelClient.Do(req)
+	if err != nil {
+		return "", 0, errors.New("failed to reach provider")
+	}
+	defer resp.Body.Close()
+	monitoring.RecordProviderRequest(target.Name, s.Model, resp.StatusCode, time.Since(start))
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxRequestBodySize))
+	if err != nil {
+		return "", 0, errors.New("failed to read provider response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("provider returned status %d", resp.StatusCode)
+	}
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &completion); err != nil || len(completion.Choices) == 0 {
+		return "", completion.Usage.TotalTokens, errors.New("provider returned no choices")
+	}
+	tokens := completion.Usage.TotalTokens
+	if tokens == 0 {
+		// Providers that omit usage are charged the worst case
+		tokens = s.MaxTokens
+	}
+	return completion.Choices[0].Message.Content, tokens, nil
+}
+
+// record stores the run, updates the sentinel and raises or clears the drift alert
+func (d *DriftDetector) record(ctx context.Context, s *Sentinel, run *SentinelRun) error {
+	outcome := run.Status
+	if run.Drifted {
+		outcome = "drift"
+	}
+	middleware.RecordSentinelRun(s.ID, outcome, run.Tokens)
+
+	if run.Status != SentinelRunSkipped {
+		at := run.At
+		s.LastRunAt = &at
+	}
+	if run.Status == SentinelRunOK {
+		s.LastResponse = run.Response
+		s.LastSimilarity = run.Similarity
+		switch {
+		case s.Baseline == nil:
+			s.Baseline = newSentinelBaseline(run.Response, "", run.At)
+		case run.Drifted:
+			s.DriftStreak++
+		default:
+			s.DriftStreak = 0
+		}
+	}
+	if err := d.save(ctx, s); err != nil {
+		return err
+	}
+
+	stored := *run
+	if len(stored.Response) > sentinelMaxResponseSize {
+		stored.Response = stored.Response[:sentinelMaxResponseSize]
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	historyKey := sentinelHistoryPrefix + s.ID
+	pipe := d.client.TxPipeline()
+	pipe.LPush(ctx, historyKey, data)
+	pipe.LTrim(ctx, historyKey, 0, int64(d.cfg.HistoryLimit-1))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store sentinel run: %w", err)
+	}
+
+	// Errors and skipped runs say nothing about drift, so the alert keeps its state
+	if run.Status == SentinelRunOK {
+		d.raiseAlert(ctx, s, s.DriftStreak >= s.ConsecutiveRuns)
+	}
+	return nil
+}
+
+func (d *DriftDetector) raiseAlert(ctx context.Context, s *Sentinel, firing bool) {
+	if d.alerts == nil {
+		return
+	}
+	similarity := 1.0
+	if s.LastSimilarity != nil {
+		similarity = *s.LastSimilarity
+	}
+	d.alerts.EvaluateRule(ctx, sentinelDriftRule(s), similarity, firing)
+}
+
+// sentinelDriftRule is the alert raised while a sentinel keeps drifting from its baseline
+func sentinelDriftRule(s *Sentinel) *monitoring.Rule {
+	return &monitoring.Rule{
+		ID:          "sentinel_" + s.ID + "_drift",
+		Name:        "Sentinel drift: " + s.Name,
+		Description: fmt.Sprintf("Responses of %s model %s stayed below similarity %.2f to the approved baseline for %d runs", s.Provider, s.Model, s.Threshold, s.ConsecutiveRuns),
+		MetricKey:   "sentinel_similarity",
+		Operator:    "<",
+		Threshold:   s.Threshold,
+		Level:       monitoring.AlertLevelWarning,
+		Enabled:     true,
+	}
+}
+
+func sentinelError(c *gin.Context, err error) {
+	if errors.Is(err, ErrSentinelNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": err.Error(),
+				"type":    "invalid_request_error",
+				"code":    "sentinel_not_found",
+			},
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": gin.H{
+			"message": err.Error(),
+			"type":    "internal_server_error",
+			"code":    "storage_error",
+		},
+	})
+}
+
+func invalidSentinel(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "validation_error",
+			"code":    "invalid_sentinel",
+		},
+	})
+}
+
+func auditSentinel(c *gin.Context, audit *security.AuditLogger, action string, s *Sentinel, details map[string]interface{}) {
+	audit.LogWithContext(c.Request.Context(), &security.AuditEvent{
+		Type:      "sentinel",
+		Action:    action,
+		Resource:  s.ID,
+		UserID:    c.GetString("user_id"),
+		RemoteIP:  c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		Details:   details,
+	})
+}
+
+// CreateSentinel registers a sentinel prompt; its first run captures the baseline
+func CreateSentinel(d *DriftDetector, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var s Sentinel
+		if err := c.ShouldBindJSON(&s); err != nil {
+			invalidSentinel(c, "Invalid request format")
+			return
+		}
+		if err := s.Validate(d.Targets()); err != nil {
+			invalidSentinel(c, err.Error())
+			return
+		}
+		if s.SystemPrompt != "" {
+			ps := DefaultPromptStore()
+			if ps == nil {
+				invalidSentinel(c, "prompt templates are not enabled")
+				return
+			}
+			if _, err := ps.Resolve(s.SystemPrompt, flags.Subject{}); err != nil {
+				invalidSentinel(c, err.Error())
+				return
+			}
+		}
+		if err := d.Create(c.Request.Context(), &s); err != nil {
+			sentinelError(c, err)
+			return
+		}
+		auditSentinel(c, audit, "create", &s, map[string]interface{}{
+			"name":     s.Name,
+			"provider": s.Provider,
+			"model":    s.Model,
+		})
+		c.JSON(http.StatusCreated, s)
+	}
+}
+
+// ListSentinels returns every sentinel with its latest result
+func ListSentinels(d *DriftDetector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sentinels, err := d.List(c.Request.Context())
+		if err != nil {
+			sentinelError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"sentinels": sentinels})
+	}
+}
+
+// GetSentinelHistory returns the most recent runs of a sentinel, newest first
+func GetSentinelHistory(d *DriftDetector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		runs, err := d.History(c.Request.Context(), c.Param("id"), limit)
+		if err != nil {
+			sentinelError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"runs": runs})
+	}
+}
+
+// RunSentinel runs a sentinel now regardless of its cadence
+func RunSentinel(d *DriftDetector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run, err := d.Run(c.Request.Context(), c.Param("id"), true)
+		if err != nil {
+			sentinelError(c, err)
+			return
+		}
+		if run == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": gin.H{
+					"message": "The sentinel is running on another instance",
+					"type":    "invalid_request_error",
+					"code":    "sentinel_running",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusOK, run)
+	}
+}
+
+// ApproveSentinelBaseline accepts a new baseline after an intended provider change.
+// The body may carry the approved response; otherwise the last response is approved.
+func ApproveSentinelBaseline(d *DriftDetector, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Response string `json:"response"`
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				invalidSentinel(c, "Invalid request format")
+				return
+			}
+		}
+		s, err := d.Approve(c.Request.Context(), c.Param("id"), request.Response, c.GetString("user_id"))
+		if err != nil {
+			if errors.Is(err, ErrSentinelNotFound) {
+				sentinelError(c, err)
+			} else {
+				invalidSentinel(c, err.Error())
+			}
+			return
+		}
+		auditSentinel(c, audit, "approve_baseline", s, map[string]interface{}{
+			"fingerprint": s.Baseline.Fingerprint,
+		})
+		c.JSON(http.StatusOK, s)
+	}
+}
+
+// DeleteSentinel removes a sentinel and its history
+func DeleteSentinel(d *DriftDetector, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if err := d.Delete(c.Request.Context(), id); err != nil {
+			sentinelError(c, err)
+			return
+		}
+		auditSentinel(c, audit, "delete", &Sentinel{ID: id}, nil)
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/monitoring"
+	"go-aigateway/internal/security"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSentinelProvider answers every chat request with a reply the test can change
+type fakeSentinelProvider struct {
+	mu       sync.Mutex
+	reply    string
+	calls    atomic.Int32
+	internal atomic.Int32 // requests marked as gateway-internal
+}
+
+func (f *fakeSentinelProvider) setReply(reply string) {
+	f.mu.Lock()
+	f.reply = reply
+	f.mu.Unlock()
+}
+
+func (f *fakeSentinelProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.calls.Add(1)
+	if r.Header.Get("X-Gateway-Internal") == "sentinel" {
+		f.internal.Add(1)
+	}
+	var req map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&req)
+	if req["temperature"] != float64(0) {
+		http.Error(w, "sentinels must run at temperature 0", http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	reply := f.reply
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":%q}}],"usage":{"total_tokens":50}}`, reply)
+}
+
+type recordedSentinelAlert struct {
+	rule   string
+	firing bool
+}
+
+type fakeSentinelAlerts struct {
+	mu     sync.Mutex
+	alerts []recordedSentinelAlert
+}
+
+func (s *fakeSentinelAlerts) EvaluateRule(_ context.Context, rule *monitoring.Rule, _ float64, firing bool) {
+	s.mu.Lock()
+	s.alerts = append(s.alerts, recordedSentinelAlert{rule.ID, firing})
+	s.mu.Unlock()
+}
+
+func (s *fakeSentinelAlerts) last() recordedSentinelAlert {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.alerts) == 0 {
+		return recordedSentinelAlert{}
+	}
+	return s.alerts[len(s.alerts)-1]
+}
+
+func setupDriftDetector(t *testing.T, budget int64) (*gin.Engine, *DriftDetector, *fakeSentinelProvider, *fakeSentinelAlerts) {
+	gin.SetMode(gin.TestMode)
+
+	provider := &fakeSentinelProvider{reply: "The capital of France is Paris."}
+	upstream := httptest.NewServer(provider)
+	t.Cleanup(upstream.Close)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	alerts := &fakeSentinelAlerts{}
+	targets := map[string]SmokeTarget{"openai": {Name: "openai", BaseURL: upstream.URL, Model: "gpt-4o"}}
+	cfg := config.SentinelConfig{
+		CheckInterval:    time.Minute,
+		DefaultInterval:  time.Hour,
+		DailyTokenBudget: budget,
+		HistoryLimit:     10,
+	}
+	d := NewDriftDetector(client, cfg, targets, alerts)
+
+	audit := security.NewAuditLogger()
+	r := gin.New()
+	r.POST("/api/v1/admin/sentinels", CreateSentinel(d, audit))
+	r.GET("/api/v1/admin/sentinels", ListSentinels(d))
+	r.GET("/api/v1/admin/sentinels/:id/history", GetSentinelHistory(d))
+	r.POST("/api/v1/admin/sentinels/:id/run", RunSentinel(d))
+	r.POST("/api/v1/admin/sentinels/:id/approve", ApproveSentinelBaseline(d, audit))
+	r.DELETE("/api/v1/admin/sentinels/:id", DeleteSentinel(d, audit))
+	return r, d, provider, alerts
+}
+
+func createSentinel(t *testing.T, r *gin.Engine) Sentinel {
+	w := postJSON(r, "/api/v1/admin/sentinels", `{"name":"capital","messages":[{"role":"user","content":"What is the capital of France?"}],"threshold":0.6,"consecutive_runs":2}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var s Sentinel
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &s))
+	return s
+}
+
+func runSentinel(t *testing.T, r *gin.Engine, id string) SentinelRun {
+	w := postJSON(r, "/api/v1/admin/sentinels/"+id+"/run", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var run SentinelRun
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+	return run
+}
+
+func TestSentinelDriftRaisesAndClearsAlert(t *testing.T) {
+	r, d, provider, alerts := setupDriftDetector(t, 0)
+	s := createSentinel(t, r)
+	assert.Equal(t, "gpt-4o", s.Model)
+	assert.Equal(t, 256, s.MaxTokens)
+	rule := "sentinel_" + s.ID + "_drift"
+
+	// The first run captures the baseline
+	run := runSentinel(t, r, s.ID)
+	assert.Equal(t, SentinelRunOK, run.Status)
+	assert.Nil(t, run.Similarity)
+	stored, err := d.Get(context.Background(), s.ID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.Baseline)
+	assert.Equal(t, responseFingerprint("the capital of FRANCE is paris"), stored.Baseline.Fingerprint)
+
+	// Same answer: no drift
+	run = runSentinel(t, r, s.ID)
+	require.NotNil(t, run.Similarity)
+	assert.Equal(t, 1.0, *run.Similarity)
+	assert.False(t, alerts.last().firing)
+
+	// The provider swaps its model: one drifted run is not enough, two are
+	provider.setReply("Paris, obviously. Anything else I can help with today?")
+	run = runSentinel(t, r, s.ID)
+	assert.True(t, run.Drifted)
+	assert.False(t, alerts.last().firing)
+	runSentinel(t, r, s.ID)
+	assert.Equal(t, recordedSentinelAlert{rule, true}, alerts.last())
+
+	// Re-approving the new answer as the baseline clears the alert
+	w := postJSON(r, "/api/v1/admin/sentinels/"+s.ID+"/approve", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, recordedSentinelAlert{rule, false}, alerts.last())
+	run = runSentinel(t, r, s.ID)
+	assert.False(t, run.Drifted)
+	assert.False(t, alerts.last().firing)
+
+	// History is newest first and every call was marked internal
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/sentinels/"+s.ID+"/history?limit=3", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var history struct {
+		Runs []SentinelRun `json:"runs"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	require.Len(t, history.Runs, 3)
+	assert.False(t, history.Runs[0].Drifted)
+	assert.True(t, history.Runs[1].Drifted)
+	assert.Equal(t, provider.calls.Load(), provider.internal.Load())
+}
+
+func TestSentinelDailyTokenBudget(t *testing.T) {
+	// Each run may spend 256 tokens and spends 50; a second run would risk overrunning 300
+	r, _, provider, _ := setupDriftDetector(t, 300)
+	s := createSentinel(t, r)
+
+	assert.Equal(t, SentinelRunOK, runSentinel(t, r, s.ID).Status)
+	run := runSentinel(t, r, s.ID)
+	assert.Equal(t, SentinelRunSkipped, run.Status)
+	assert.Equal(t, int32(1), provider.calls.Load())
+}
+
+func TestSentinelScheduledRunsHonourCadenceAndLock(t *testing.T) {
+	r, d, provider, _ := setupDriftDetector(t, 0)
+	s := createSentinel(t, r)
+	ctx := context.Background()
+
+	// Another instance holds the lock
+	require.NoError(t, d.client.Set(ctx, sentinelLockPrefix+s.ID, "other", time.Minute).Err())
+	d.RunDue(ctx)
+	assert.Equal(t, int32(0), provider.calls.Load())
+	w := postJSON(r, "/api/v1/admin/sentinels/"+s.ID+"/run", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	d.client.Del(ctx, sentinelLockPrefix+s.ID)
+
+	d.RunDue(ctx)
+	d.RunDue(ctx)
+	assert.Equal(t, int32(1), provider.calls.Load(), "a sentinel runs once per interval")
+
+	now := time.Now()
+	d.now = func() time.Time { return now.Add(2 * time.Hour) }
+	d.RunDue(ctx)
+	assert.Equal(t, int32(2), provider.calls.Load())
+}
+
+func TestSentinelValidationAndDelete(t *testing.T) {
+	r, d, _, _ := setupDriftDetector(t, 0)
+
+	for _, body := range []string{
+		`{"messages":[{"role":"user","content":"hi"}]}`,
+		`{"name":"x","messages":[]}`,
+		`{"name":"x","provider":"dashscope","messages":[{"role":"user","content":"hi"}]}`,
+		`{"name":"x","threshold":1.5,"messages":[{"role":"user","content":"hi"}]}`,
+	} {
+		w := postJSON(r, "/api/v1/admin/sentinels", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	s := createSentinel(t, r)
+	w := postJSON(r, "/api/v1/admin/sentinels/"+s.ID+"/approve", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "nothing to approve before the first run")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/admin/sentinels/"+s.ID, nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	_, err := d.Get(context.Background(), s.ID)
+	assert.ErrorIs(t, err, ErrSentinelNotFound)
+	w = postJSON(r, "/api/v1/admin/sentinels/"+s.ID+"/run", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
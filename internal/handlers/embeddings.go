@@ -0,0 +1,416 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"unicode/utf8"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/localmodel"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Embedding encoding formats, mirroring OpenAI's encoding_format parameter
+const (
+	EncodingFloat  = "float"
+	EncodingBase64 = "base64" // little-endian packed float32
+)
+
+// MaxEmbeddingInputChars bounds each embedding input. Providers limit inputs
+// to 8192 tokens, approximated here by characters, which for most text is
+// stricter than the provider.
+const MaxEmbeddingInputChars = 8192
+
+var (
+	localModelServerMu sync.RWMutex
+	localModelServer   *localmodel.PythonModelServer
+)
+
+// SetLocalModelServer installs the local model server Embeddings uses when
+// the local model is enabled; nil proxies embeddings to the target
+func SetLocalModelServer(server *localmodel.PythonModelServer) {
+	localModelServerMu.Lock()
+	localModelServer = server
+	localModelServerMu.Unlock()
+}
+
+// DefaultLocalModelServer returns the installed local model server, or nil
+func DefaultLocalModelServer() *localmodel.PythonModelServer {
+	localModelServerMu.RLock()
+	defer localModelServerMu.RUnlock()
+	return localModelServer
+}
+
+// EmbeddingOptions 向量后处理选项，通过路由Actions中的"embedding"配置，
+// models中按模型覆盖路由级配置
+type EmbeddingOptions struct {
+	Dimensions int                         `json:"dimensions,omitempty"` // target size, 0 keeps the native size
+	Pad        bool                        `json:"pad,omitempty"`        // zero-pad vectors shorter than Dimensions
+	Normalize  bool                        `json:"normalize,omitempty"`  // L2-normalize the output
+	Models     map[string]EmbeddingOptions `json:"models,omitempty"`
+}
+
+// EmbeddingProcessing 返回给客户端的处理说明
+type EmbeddingProcessing struct {
+	Dimensions         int    `json:"dimensions"`
+	OriginalDimensions int    `json:"original_dimensions"`
+	Truncated          bool   `json:"truncated"`
+	Padded             bool   `json:"padded"`
+	Normalized         bool   `json:"normalized"`
+	EncodingFormat     string `json:"encoding_format"`
+}
+
+// embeddingOptionsFor reads the options configured on the matched route for a model
+func embeddingOptionsFor(actions map[string]interface{}, model string) (EmbeddingOptions, error) {
+	var opts EmbeddingOptions
+	raw, ok := actions["embedding"]
+	if !ok {
+		return opts, nil
+	}
+	data, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(data, &opts)
+	}
+	if err != nil {
+		return opts, fmt.Errorf("invalid embedding route action: %w", err)
+	}
+	if override, ok := opts.Models[model]; ok {
+		opts = override
+	}
+	opts.Models = nil
+	if opts.Dimensions < 0 {
+		return opts, fmt.Errorf("embedding dimensions must not be negative")
+	}
+	return opts, nil
+}
+
+// validateEmbeddingOptions checks the options against the model capability registry;
+// models missing from the registry are not checked
+func validateEmbeddingOptions(model string, opts EmbeddingOptions) error {
+	info, ok := GetThirdPartyModelInfo()[model]
+	if !ok || info.EmbeddingDimensions == 0 || opts.Dimensions == 0 {
+		return nil
+	}
+	if opts.Dimensions > info.EmbeddingDimensions && !opts.Pad {
+		return fmt.Errorf("model %s returns %d dimensions; padding to %d must be enabled explicitly",
+			model, info.EmbeddingDimensions, opts.Dimensions)
+	}
+	if opts.Dimensions < info.EmbeddingDimensions && !info.MatryoshkaEmbeddings {
+		return fmt.Errorf("model %s does not support dimension reduction", model)
+	}
+	return nil
+}
+
+// ProcessEmbedding resizes and normalizes one vector. Truncation always
+// renormalizes, since a prefix of a Matryoshka embedding is only meaningful
+// at unit length.
+func ProcessEmbedding(vec []float64, opts EmbeddingOptions) ([]float64, EmbeddingProcessing, error) {
+	info := EmbeddingProcessing{OriginalDimensions: len(vec)}
+	out := vec
+
+	switch {
+	case opts.Dimensions > 0 && len(vec) > opts.Dimensions:
+		out = append([]float64(nil), vec[:opts.Dimensions]...)
+		info.Truncated = true
+	case opts.Dimensions > 0 && len(vec) < opts.Dimensions:
+		if !opts.Pad {
+			return nil, info, fmt.Errorf("embedding has %d dimensions, fewer than the configured %d", len(vec), opts.Dimensions)
+		}
+		out = make([]float64, opts.Dimensions)
+		copy(out, vec)
+		info.Padded = true
+	}
+
+	if opts.Normalize || info.Truncated {
+		out = l2Normalize(out)
+		info.Normalized = true
+	}
+	info.Dimensions = len(out)
+	return out, info, nil
+}
+
+func l2Normalize(vec []float64) []float64 {
+	var sum float64
+	for _, v := range vec {
+		sum += v * v
+	}
+	if sum == 0 {
+		return vec
+	}
+	norm := math.Sqrt(sum)
+	out := make([]float64, len(vec))
+	for i, v := range vec {
+		out[i] = v / norm
+	}
+	return out
+}
+
+// EncodeEmbedding renders a vector in the requested encoding format
+func EncodeEmbedding(vec []float64, format string) interface{} {
+	if format != EncodingBase64 {
+		return vec
+	}
+	buf := make([]byte, 4*len(vec))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(v)))
+	}
+	return base64.StdEncoding.EncodeToString(buf)
+}
+
+// DecodeEmbedding parses a float array or a base64 packed float32 vector
+func DecodeEmbedding(raw interface{}) ([]float64, error) {
+	switch v := raw.(type) {
+	case []float64:
+		return v, nil
+	case []interface{}:
+		vec := make([]float64, len(v))
+		for i, x := range v {
+			f, ok := x.(float64)
+			if !ok {
+				return nil, fmt.Errorf("embedding element %d is not a number", i)
+			}
+			vec[i] = f
+		}
+		return vec, nil
+	case string:
+		buf, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(buf)%4 != 0 {
+			return nil, fmt.Errorf("invalid base64 embedding")
+		}
+		vec := make([]float64, len(buf)/4)
+		for i := range vec {
+			vec[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:])))
+		}
+		return vec, nil
+	default:
+		return nil, fmt.Errorf("unsupported embedding type %T", raw)
+	}
+}
+
+// embeddingProcessor 在代理路径与本地模型路径上共享的后处理状态
+type embeddingProcessor struct {
+	actions map[string]interface{}
+	format  string
+	opts    EmbeddingOptions
+}
+
+// prepare reads encoding_format and the route options from the client request.
+// Upstreams are always asked for floats so vectors can be post-processed and
+// the client's encoding honored even by providers that ignore the field.
+func (p *embeddingProcessor) prepare(request map[string]interface{}) (bool, error) {
+	p.format = EncodingFloat
+	if raw, ok := request["encoding_format"]; ok {
+		format, _ := raw.(string)
+		if format != EncodingFloat && format != EncodingBase64 {
+			return false, fmt.Errorf("encoding_format must be %q or %q", EncodingFloat, EncodingBase64)
+		}
+		p.format = format
+	}
+
+	model, _ := request["model"].(string)
+	opts, err := embeddingOptionsFor(p.actions, model)
+	if err != nil {
+		return false, err
+	}
+	if err := validateEmbeddingOptions(model, opts); err != nil {
+		return false, err
+	}
+	p.opts = opts
+
+	if p.format == EncodingFloat {
+		return false, nil
+	}
+	request["encoding_format"] = EncodingFloat
+	return true, nil
+}
+
+// processResponse post-processes and re-encodes every vector in an embeddings response
+func (p *embeddingProcessor) processResponse(resp map[string]interface{}) error {
+	data, ok := resp["data"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var summary EmbeddingProcessing
+	for i, item := range data {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		vec, err := DecodeEmbedding(entry["embedding"])
+		if err != nil {
+			return fmt.Errorf("data[%d]: %w", i, err)
+		}
+		processed, info, err := ProcessEmbedding(vec, p.opts)
+		if err != nil {
+			return fmt.Errorf("data[%d]: %w", i, err)
+		}
+		entry["embedding"] = EncodeEmbedding(processed, p.format)
+		summary = info
+	}
+
+	summary.EncodingFormat = p.format
+	resp["embedding_processing"] = summary
+	return nil
+}
+
+// processLocalResponse applies the options to a typed local model response
+func (p *embeddingProcessor) processLocalResponse(response *localmodel.EmbeddingResponse) (map[string]interface{}, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	var resp map[string]interface{}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	if err := p.processResponse(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// validateEmbeddingInput requires a non-empty input of strings of at most
+// MaxEmbeddingInputChars characters. A single string is rewritten into a
+// one-element array, which the local model server requires and DashScope's
+// compatible mode accepts like OpenAI.
+func validateEmbeddingInput(request map[string]interface{}) (bool, error) {
+	var inputs []interface{}
+	modified := false
+	switch input := request["input"].(type) {
+	case string:
+		inputs = []interface{}{input}
+		request["input"] = inputs
+		modified = true
+	case []interface{}:
+		inputs = input
+	case nil:
+		return false, fmt.Errorf("input is required")
+	default:
+		return false, fmt.Errorf("input must be a string or an array of strings")
+	}
+	if len(inputs) == 0 {
+		return false, fmt.Errorf("input must not be empty")
+	}
+	for i, item := range inputs {
+		text, ok := item.(string)
+		if !ok {
+			return false, fmt.Errorf("input[%d] must be a string", i)
+		}
+		if text == "" {
+			return false, fmt.Errorf("input[%d] must not be empty", i)
+		}
+		if n := utf8.RuneCountInString(text); n > MaxEmbeddingInputChars {
+			return false, fmt.Errorf("input[%d] has %d characters, more than the limit of %d", i, n, MaxEmbeddingInputChars)
+		}
+	}
+	return modified, nil
+}
+
+// Embeddings handler serves OpenAI-compatible /embeddings requests with
+// dimension and encoding post-processing. They are answered by the local
+// model server when the local model is enabled, otherwise proxied to the
+// target, e.g. DashScope's compatible mode endpoint.
+func Embeddings(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.LocalModel.Enabled {
+			if server := DefaultLocalModelServer(); server != nil {
+				serveLocalEmbeddings(c, server)
+				return
+			}
+		}
+
+		p := &embeddingProcessor{actions: routeActions(c)}
+		proxyRequestWithHooks(c, cfg, "/embeddings", chainHooks(
+			&proxyHooks{
+				request:          validateEmbeddingInput,
+				requestErrorCode: "invalid_input",
+			},
+			&proxyHooks{
+				request:  p.prepare,
+				response: p.processResponse,
+
+				requestErrorCode: "invalid_embedding_options",
+			},
+		))
+	}
+}
+
+// serveLocalEmbeddings answers an embeddings request with the local model
+// server, applying the same validation and route options as the proxy
+func serveLocalEmbeddings(c *gin.Context, server *localmodel.PythonModelServer) {
+	rejectRequest := func(message, code string) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": message,
+				"type":    "invalid_request_error",
+				"code":    code,
+			},
+		})
+	}
+
+	var raw map[string]interface{}
+	if err := c.ShouldBindJSON(&raw); err != nil || raw == nil {
+		logrus.WithError(err).Error("Failed to parse request body")
+		rejectRequest("Failed to parse request body", "bad_request")
+		return
+	}
+	if _, err := validateEmbeddingInput(raw); err != nil {
+		rejectRequest(err.Error(), "invalid_input")
+		return
+	}
+
+	// Apply the same dimension and encoding options as the proxied endpoint
+	processor := &embeddingProcessor{actions: routeActions(c)}
+	if _, err := processor.prepare(raw); err != nil {
+		rejectRequest(err.Error(), "invalid_embedding_options")
+		return
+	}
+
+	var request localmodel.EmbeddingRequest
+	data, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(data, &request)
+	}
+	if err != nil {
+		rejectRequest("Failed to parse request body", "bad_request")
+		return
+	}
+	request.EncodingFormat = EncodingFloat
+
+	// Call local model
+	response, err := server.Embedding(c.Request.Context(), &request)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to call local model")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"message": "Failed to call local model",
+				"type":    "internal_server_error",
+				"code":    "local_model_error",
+			},
+		})
+		return
+	}
+
+	result, err := processor.processLocalResponse(response)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to process local model embeddings")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"message": err.Error(),
+				"type":    "internal_server_error",
+				"code":    "local_model_error",
+			},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/localmodel"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Fixture vectors whose information is concentrated in the leading dimensions,
+// as with Matryoshka-trained models
+var embeddingFixtures = [][]float64{
+	{0.62, 0.41, -0.33, 0.28, 0.05, -0.03, 0.02, 0.01},
+	{0.58, 0.45, -0.30, 0.31, -0.04, 0.02, -0.01, 0.03},
+	{-0.51, 0.12, 0.47, -0.40, 0.03, 0.04, 0.02, -0.02},
+}
+
+func cosine(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+func norm(v []float64) float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x * x
+	}
+	return math.Sqrt(sum)
+}
+
+func TestProcessEmbeddingTruncationPreservesSimilarity(t *testing.T) {
+	opts := EmbeddingOptions{Dimensions: 4}
+
+	var truncated [][]float64
+	for _, vec := range embeddingFixtures {
+		out, info, err := ProcessEmbedding(vec, opts)
+		require.NoError(t, err)
+		assert.Len(t, out, 4)
+		assert.True(t, info.Truncated)
+		assert.True(t, info.Normalized)
+		assert.Equal(t, 8, info.OriginalDimensions)
+		assert.InDelta(t, 1.0, norm(out), 1e-9)
+		truncated = append(truncated, out)
+	}
+
+	for i := range embeddingFixtures {
+		for j := i + 1; j < len(embeddingFixtures); j++ {
+			before := cosine(embeddingFixtures[i], embeddingFixtures[j])
+			after := cosine(truncated[i], truncated[j])
+			assert.InDelta(t, before, after, 0.02, "pair %d/%d", i, j)
+		}
+	}
+	// Ranking is preserved: 0 stays closer to 1 than to 2
+	assert.Greater(t, cosine(truncated[0], truncated[1]), cosine(truncated[0], truncated[2]))
+}
+
+func TestProcessEmbeddingPadding(t *testing.T) {
+	vec := embeddingFixtures[0][:4]
+
+	_, _, err := ProcessEmbedding(vec, EmbeddingOptions{Dimensions: 6})
+	assert.Error(t, err)
+
+	out, info, err := ProcessEmbedding(vec, EmbeddingOptions{Dimensions: 6, Pad: true})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.62, 0.41, -0.33, 0.28, 0, 0}, out)
+	assert.True(t, info.Padded)
+	assert.False(t, info.Normalized)
+	assert.InDelta(t, 1.0, cosine(out[:4], vec), 1e-12)
+}
+
+func TestProcessEmbeddingNormalizeToggle(t *testing.T) {
+	vec := []float64{3, 4}
+
+	out, info, err := ProcessEmbedding(vec, EmbeddingOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, vec, out)
+	assert.False(t, info.Normalized)
+
+	out, info, err = ProcessEmbedding(vec, EmbeddingOptions{Normalize: true})
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{0.6, 0.8}, out, 1e-12)
+	assert.True(t, info.Normalized)
+}
+
+func TestEncodeEmbeddingBase64RoundTrip(t *testing.T) {
+	vec := embeddingFixtures[2]
+	encoded, ok := EncodeEmbedding(vec, EncodingBase64).(string)
+	require.True(t, ok)
+
+	decoded, err := DecodeEmbedding(encoded)
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, vec, decoded, 1e-6)
+
+	assert.Equal(t, vec, EncodeEmbedding(vec, EncodingFloat))
+}
+
+func TestValidateEmbeddingOptionsAgainstRegistry(t *testing.T) {
+	assert.NoError(t, validateEmbeddingOptions("text-embedding-v3", EmbeddingOptions{Dimensions: 512}))
+	assert.Error(t, validateEmbeddingOptions("text-embedding-v1", EmbeddingOptions{Dimensions: 512}))
+	assert.Error(t, validateEmbeddingOptions("text-embedding-v3", EmbeddingOptions{Dimensions: 2048}))
+	assert.NoError(t, validateEmbeddingOptions("text-embedding-v3", EmbeddingOptions{Dimensions: 2048, Pad: true}))
+	assert.NoError(t, validateEmbeddingOptions("unknown-model", EmbeddingOptions{Dimensions: 3}))
+}
+
+func setupEmbeddingsRouter(t *testing.T, actions map[string]interface{}) (*gin.Engine, *[]map[string]interface{}) {
+	gin.SetMode(gin.TestMode)
+
+	var upstreamRequests []map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req map[string]interface{}
+		json.Unmarshal(body, &req)
+		upstreamRequests = append(upstreamRequests, req)
+
+		data := make([]map[string]interface{}, len(embeddingFixtures))
+		for i, vec := range embeddingFixtures {
+			data[i] = map[string]interface{}{"object": "embedding", "index": i, "embedding": vec}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"object": "list", "data": data, "model": req["model"]})
+	}))
+	t.Cleanup(upstream.Close)
+
+	h := NewServiceHandler()
+	router := gin.New()
+	router.Use(h.RouteActionsMiddleware())
+	router.POST("/v1/embeddings", Embeddings(&config.Config{TargetURL: upstream.URL}))
+	RegisterServiceRoutes(router, h)
+
+	route := Route{Name: "embeddings", Path: "/v1/embeddings", Method: "POST", Enabled: true, Actions: actions}
+	body, _ := json.Marshal(route)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/routes", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	return router, &upstreamRequests
+}
+
+func TestEmbeddingsHandlerBase64WithTruncation(t *testing.T) {
+	router, upstreamRequests := setupEmbeddingsRouter(t, map[string]interface{}{
+		"embedding": map[string]interface{}{"dimensions": 4},
+	})
+
+	w := postJSON(router, "/v1/embeddings", `{"model":"text-embedding-v3","input":["a","b","c"],"encoding_format":"base64"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	require.Len(t, *upstreamRequests, 1)
+	assert.Equal(t, EncodingFloat, (*upstreamRequests)[0]["encoding_format"])
+
+	var resp struct {
+		Data []struct {
+			Embedding string `json:"embedding"`
+		} `json:"data"`
+		Processing EmbeddingProcessing `json:"embedding_processing"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 3)
+
+	vec, err := DecodeEmbedding(resp.Data[0].Embedding)
+	require.NoError(t, err)
+	assert.Len(t, vec, 4)
+	assert.InDelta(t, 1.0, norm(vec), 1e-6)
+
+	assert.Equal(t, EmbeddingProcessing{
+		Dimensions:         4,
+		OriginalDimensions: 8,
+		Truncated:          true,
+		Normalized:         true,
+		EncodingFormat:     EncodingBase64,
+	}, resp.Processing)
+}
+
+func TestEmbeddingsHandlerRejectsUnsupportedReduction(t *testing.T) {
+	router, upstreamRequests := setupEmbeddingsRouter(t, map[string]interface{}{
+		"embedding": map[string]interface{}{
+			"models": map[string]interface{}{"text-embedding-v1": map[string]interface{}{"dimensions": 256}},
+		},
+	})
+
+	w := postJSON(router, "/v1/embeddings", `{"model":"text-embedding-v1","input":["a"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_embedding_options")
+	assert.Empty(t, *upstreamRequests)
+
+	w = postJSON(router, "/v1/embeddings", `{"model":"text-embedding-v1","input":["a"],"encoding_format":"int8"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestEmbeddingsHandlerWithoutRouteActions(t *testing.T) {
+	router, _ := setupEmbeddingsRouter(t, nil)
+
+	w := postJSON(router, "/v1/embeddings", `{"model":"text-embedding-v1","input":["a"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	processing := resp["embedding_processing"].(map[string]interface{})
+	assert.Equal(t, float64(8), processing["dimensions"])
+	assert.Equal(t, false, processing["normalized"])
+	assert.Equal(t, EncodingFloat, processing["encoding_format"])
+}
+
+// embeddingServer is a fake embeddings API recording the requests it answers
+func embeddingServer(t *testing.T, requests *[]map[string]interface{}) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		*requests = append(*requests, req)
+
+		inputs, _ := req["input"].([]interface{})
+		data := make([]map[string]interface{}, len(inputs))
+		for i := range inputs {
+			data[i] = map[string]interface{}{"object": "embedding", "index": i, "embedding": embeddingFixtures[i%len(embeddingFixtures)]}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"object": "list",
+			"data":   data,
+			"model":  req["model"],
+			"usage":  map[string]interface{}{"prompt_tokens": len(inputs), "total_tokens": len(inputs)},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEmbeddingsRouting(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tooLong := strings.Repeat("字", MaxEmbeddingInputChars+1)
+
+	tests := []struct {
+		name       string
+		local      bool
+		body       string
+		wantStatus int
+		wantCode   string
+		wantInputs []interface{} // input received by the serving backend
+	}{
+		{name: "proxy batch", body: `{"model":"text-embedding-v3","input":["a","b"]}`, wantStatus: http.StatusOK, wantInputs: []interface{}{"a", "b"}},
+		{name: "proxy single string", body: `{"model":"text-embedding-v3","input":"a"}`, wantStatus: http.StatusOK, wantInputs: []interface{}{"a"}},
+		{name: "proxy empty input", body: `{"model":"text-embedding-v3","input":[]}`, wantStatus: http.StatusBadRequest, wantCode: "invalid_input"},
+		{name: "proxy missing input", body: `{"model":"text-embedding-v3"}`, wantStatus: http.StatusBadRequest, wantCode: "invalid_input"},
+		{name: "proxy token arrays", body: `{"model":"text-embedding-v3","input":[[1,2]]}`, wantStatus: http.StatusBadRequest, wantCode: "invalid_input"},
+		{name: "proxy input too long", body: `{"model":"text-embedding-v3","input":["a","` + tooLong + `"]}`, wantStatus: http.StatusBadRequest, wantCode: "invalid_input"},
+		{name: "proxy input at the limit", body: `{"model":"text-embedding-v3","input":["` + tooLong[len("字"):] + `"]}`, wantStatus: http.StatusOK, wantInputs: []interface{}{tooLong[len("字"):]}},
+		{name: "local batch", local: true, body: `{"model":"bge-small","input":["a","b","c"]}`, wantStatus: http.StatusOK, wantInputs: []interface{}{"a", "b", "c"}},
+		{name: "local single string", local: true, body: `{"model":"bge-small","input":"a"}`, wantStatus: http.StatusOK, wantInputs: []interface{}{"a"}},
+		{name: "local empty string", local: true, body: `{"model":"bge-small","input":[""]}`, wantStatus: http.StatusBadRequest, wantCode: "invalid_input"},
+		{name: "local input too long", local: true, body: `{"model":"bge-small","input":["` + tooLong + `"]}`, wantStatus: http.StatusBadRequest, wantCode: "invalid_input"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var proxied, local []map[string]interface{}
+			target := embeddingServer(t, &proxied)
+			localServer := embeddingServer(t, &local)
+			port, err := strconv.Atoi(localServer.URL[strings.LastIndex(localServer.URL, ":")+1:])
+			require.NoError(t, err)
+
+			localCfg := config.LocalModelConfig{
+				Enabled:       tt.local,
+				ServerHost:    "127.0.0.1",
+				ServerPort:    port,
+				Timeout:       5 * time.Second,
+				RetryAttempts: 1,
+			}
+			SetLocalModelServer(localmodel.NewPythonModelServer(&localCfg))
+			t.Cleanup(func() { SetLocalModelServer(nil) })
+
+			router := gin.New()
+			router.POST("/v1/embeddings", Embeddings(&config.Config{TargetURL: target.URL, LocalModel: localCfg}))
+			w := postJSON(router, "/v1/embeddings", tt.body)
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+
+			if tt.wantCode != "" {
+				assert.Contains(t, w.Body.String(), tt.wantCode)
+				assert.Empty(t, proxied)
+				assert.Empty(t, local)
+				return
+			}
+
+			served, other := proxied, local
+			if tt.local {
+				served, other = local, proxied
+			}
+			require.Len(t, served, 1)
+			assert.Empty(t, other)
+			assert.Equal(t, tt.wantInputs, served[0]["input"])
+
+			var resp struct {
+				Object string `json:"object"`
+				Data   []struct {
+					Object    string    `json:"object"`
+					Index     int       `json:"index"`
+					Embedding []float64 `json:"embedding"`
+				} `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, "list", resp.Object)
+			require.Len(t, resp.Data, len(tt.wantInputs))
+			for i, item := range resp.Data {
+				assert.Equal(t, "embedding", item.Object)
+				assert.Equal(t, i, item.Index)
+				assert.Len(t, item.Embedding, len(embeddingFixtures[0]))
+			}
+		})
+	}
+}
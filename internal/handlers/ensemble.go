@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/monitoring"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Ensemble aggregation strategies
+const (
+	EnsembleVote   = "vote"   // the response most similar to the others wins
+	EnsembleConcat = "concat" // all responses joined, no winner
+	EnsembleRandom = "random" // one successful response picked uniformly
+)
+
+// Ensemble response statuses
+const (
+	EnsembleStatusOK      = "ok"
+	EnsembleStatusError   = "error"
+	EnsembleStatusTimeout = "timeout"
+)
+
+// voteAgreementThreshold is the token similarity at which two responses count as agreeing
+const voteAgreementThreshold = 0.5
+
+// Calls are bounded by the ensemble timeout through their context
+var ensembleClient = httpclient.NewClient("ensemble", 0)
+
+// EnsembleResponse 单个模型在集成请求中的回答
+type EnsembleResponse struct {
+	Model     string                 `json:"model"`
+	Status    string                 `json:"status"`
+	Content   string                 `json:"content,omitempty"`
+	Error     string                 `json:"error,omitempty"`
+	LatencyMs int64                  `json:"latency_ms"`
+	Usage     map[string]interface{} `json:"usage,omitempty"`
+}
+
+// EnsembleResult 集成请求的结果；concat 策略没有胜出者
+type EnsembleResult struct {
+	Aggregation string             `json:"aggregation"`
+	Winner      string             `json:"winner,omitempty"`
+	Content     string             `json:"content"`
+	Agreement   *float64           `json:"agreement,omitempty"` // vote: share of responses agreeing with the winner
+	Responses   []EnsembleResponse `json:"responses"`
+}
+
+func invalidEnsembleRequest(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "invalid_request_error",
+			"code":    "invalid_parameter",
+		},
+	})
+}
+
+// Ensemble sends the same chat request to several models concurrently and
+// aggregates the answers that arrive within the ensemble timeout.
+// Other chat parameters (temperature, max_tokens, ...) are passed to every model.
+func Ensemble(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request map[string]interface{}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			invalidEnsembleRequest(c, "Invalid JSON format")
+			return
+		}
+
+		models, err := ensembleModels(request["models"], cfg.Ensemble.MaxModels)
+		if err != nil {
+			invalidEnsembleRequest(c, err.Error())
+			return
+		}
+		if messages, ok := request["messages"].([]interface{}); !ok || len(messages) == 0 {
+			invalidEnsembleRequest(c, "messages are required")
+			return
+		}
+		aggregation, _ := request["aggregation"].(string)
+		if aggregation == "" {
+			aggregation = EnsembleVote
+		}
+		if aggregation != EnsembleVote && aggregation != EnsembleConcat && aggregation != EnsembleRandom {
+			invalidEnsembleRequest(c, "aggregation must be vote, concat or random")
+			return
+		}
+		if stream, _ := request["stream"].(bool); stream {
+			invalidEnsembleRequest(c, "streaming is not supported for ensemble requests")
+			return
+		}
+
+		delete(request, "models")
+		delete(request, "aggregation")
+		endpoint := strings.TrimSuffix(cfg.TargetURL, "/") + "/chat/completions"
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), cfg.Ensemble.Timeout)
+		defer cancel()
+		responses := make([]EnsembleResponse, len(models))
+		var wg sync.WaitGroup
+		for i, model := range models {
+			wg.Add(1)
+			go func(i int, model string) {
+				defer wg.Done()
+				responses[i] = callEnsembleModel(ctx, endpoint, cfg.TargetKey, model, request)
+			}(i, model)
+		}
+		wg.Wait()
+
+		result := aggregateEnsemble(aggregation, responses)
+		outcome := "success"
+		switch successful := len(successfulResponses(responses)); {
+		case successful == 0:
+			outcome = "failure"
+		case successful < len(responses):
+			outcome = "partial"
+		}
+		middleware.RecordEnsembleRequest(aggregation, outcome)
+
+		if outcome == "failure" {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": gin.H{
+					"message": "No model answered the ensemble request",
+					"type":    "api_error",
+					"code":    "ensemble_failed",
+				},
+				"responses": responses,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// ensembleModels validates the requested model list
+func ensembleModels(raw interface{}, maxModels int) ([]string, error) {
+	list, ok := raw.([]interface{})
+	if !ok || len(list) < 2 {
+		return nil, errors.New("models must list at least two models")
+	}
+	if len(list) > maxModels {
+		return nil, fmt.Errorf("at most %d models may be combined", maxModels)
+	}
+	seen := make(map[string]bool, len(list))
+	models := make([]string, 0, len(list))
+	for _, item := range list {
+		model, _ := item.(string)
+		if model == "" {
+			return nil, errors.New("models must be non-empty strings")
+		}
+		if seen[model] {
+			return nil, fmt.Errorf("model %q is listed twice", model)
+		}
+		seen[model] = true
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+// callEnsembleModel sends the request to one model
+func callEnsembleModel(ctx context.Context, endpoint, apiKey, model string, request map[string]interface{}) (result EnsembleResponse) {
+	start := time.Now()
+	result = EnsembleResponse{Model: model, Status: EnsembleStatusError}
+	host := ""
+	if target, err := url.Parse(endpoint); err == nil {
+		host = target.Host
+	}
+	status := 0
+	defer func() {
+		duration := time.Since(start)
+		result.LatencyMs = duration.Milliseconds()
+		monitoring.RecordProviderRequest(providerForModel(model, host), model, status, duration)
+		monitoring.DefaultMonitoringSystem().RecordResponseTime(duration, model, providerForModel(model, host), result.Status == EnsembleStatusOK)
+	}()
+
+	payload := make(map[string]interface{}, len(request)+1)
+	for key, value := range request {
+		payload[key] = value
+	}
+	payload["model"] = model
+	body, err := json.Marshal(payload)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gateway-Internal", "ensemble")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := ensembleClient.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Status = EnsembleStatusTimeout
+			result.Error = "no response within the ensemble timeout"
+		} else {
+			result.Error = "failed to reach model"
+		}
+		return result
+	}
+	defer resp.Body.Close()
+	status = resp.StatusCode
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxRequestBodySize))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			result.Status = EnsembleStatusTimeout
+		}
+		result.Error = "failed to read model response"
+		return result
+	}
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("model returned status %d", resp.StatusCode)
+		return result
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage map[string]interface{} `json:"usage"`
+	}
+	if err := json.Unmarshal(data, &completion); err != nil || len(completion.Choices) == 0 {
+		result.Error = "model returned no choices"
+		return result
+	}
+	result.Status = EnsembleStatusOK
+	result.Content = completion.Choices[0].Message.Content
+	result.Usage = completion.Usage
+	return result
+}
+
+func successfulResponses(responses []EnsembleResponse) []EnsembleResponse {
+	var ok []EnsembleResponse
+	for _, r := range responses {
+		if r.Status == EnsembleStatusOK {
+			ok = append(ok, r)
+		}
+	}
+	return ok
+}
+
+// aggregateEnsemble combines the successful responses; responses keep request order
+func aggregateEnsemble(aggregation string, responses []EnsembleResponse) EnsembleResult {
+	result := EnsembleResult{Aggregation: aggregation, Responses: responses}
+	candidates := successfulResponses(responses)
+	if len(candidates) == 0 {
+		return result
+	}
+
+	switch aggregation {
+	case EnsembleConcat:
+		parts := make([]string, 0, len(candidates))
+		for _, r := range candidates {
+			parts = append(parts, fmt.Sprintf("[%s]\n%s", r.Model, r.Content))
+		}
+		result.Content = strings.Join(parts, "\n\n")
+	case EnsembleRandom:
+		winner := candidates[rand.Intn(len(candidates))]
+		result.Winner, result.Content = winner.Model, winner.Content
+	default:
+		winner, agreement := voteEnsemble(candidates)
+		result.Winner, result.Content = winner.Model, winner.Content
+		result.Agreement = &agreement
+	}
+	return result
+}
+
+// voteEnsemble picks the response with the highest total token similarity to
+// the others, so the answer most models converge on wins; ties go to the
+// earlier model. agreement is the share of responses similar to the winner.
+func voteEnsemble(candidates []EnsembleResponse) (EnsembleResponse, float64) {
+	tokens := make([]map[string]bool, len(candidates))
+	for i, r := range candidates {
+		tokens[i] = tokenSet(r.Content)
+	}
+
+	best, bestScore := 0, -1.0
+	for i := range candidates {
+		score := 0.0
+		for j := range candidates {
+			if i != j {
+				score += jaccard(tokens[i], tokens[j])
+			}
+		}
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	agreeing := 0
+	for j := range candidates {
+		if j == best || jaccard(tokens[best], tokens[j]) >= voteAgreementThreshold {
+			agreeing++
+		}
+	}
+	return candidates[best], float64(agreeing) / float64(len(candidates))
+}
+
+// tokenSet splits text into lowercase word tokens; CJK text has no spaces,
+// so each Han character is a token of its own
+func tokenSet(text string) map[string]bool {
+	set := make(map[string]bool)
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			set[word.String()] = true
+			word.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flush()
+			set[string(r)] = true
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return set
+}
+
+// jaccard is the size of the intersection over the size of the union
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for token := range a {
+		if b[token] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
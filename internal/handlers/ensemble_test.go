@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupEnsembleRouter answers each model with a fixed reply; "slow" never answers in time
+func setupEnsembleRouter(t *testing.T, timeout time.Duration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	replies := map[string]string{
+		"model-a": "Paris is the capital of France.",
+		"model-b": "The capital of France is Paris",
+		"model-c": "Berlin.",
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		model, _ := body["model"].(string)
+		if model == "slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			return
+		}
+		reply, ok := replies[model]
+		if !ok {
+			http.Error(w, `{"error":"unknown model"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{map[string]interface{}{"message": map[string]string{"role": "assistant", "content": reply}}},
+		})
+	}))
+	t.Cleanup(upstream.Close)
+
+	router := gin.New()
+	router.POST("/api/v1/ensemble", Ensemble(&config.Config{
+		TargetURL: upstream.URL,
+		Ensemble:  config.EnsembleConfig{Timeout: timeout, MaxModels: 4},
+	}))
+	return router
+}
+
+func ensembleCall(router *gin.Engine, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/ensemble", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+const ensembleMessages = `"messages":[{"role":"user","content":"What is the capital of France?"}]`
+
+func TestEnsembleVotePicksMajority(t *testing.T) {
+	router := setupEnsembleRouter(t, time.Second)
+
+	w := ensembleCall(router, `{"models":["model-c","model-a","model-b"],"aggregation":"vote",`+ensembleMessages+`}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result EnsembleResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	// model-a and model-b agree token for token; the tie goes to the earlier one
+	assert.Equal(t, "model-a", result.Winner)
+	assert.Equal(t, "Paris is the capital of France.", result.Content)
+	require.NotNil(t, result.Agreement)
+	assert.InDelta(t, 2.0/3.0, *result.Agreement, 0.001)
+	require.Len(t, result.Responses, 3)
+	assert.Equal(t, "model-c", result.Responses[0].Model)
+}
+
+func TestEnsembleConcatAndRandom(t *testing.T) {
+	router := setupEnsembleRouter(t, time.Second)
+
+	w := ensembleCall(router, `{"models":["model-a","model-c"],"aggregation":"concat",`+ensembleMessages+`}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var result EnsembleResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Empty(t, result.Winner)
+	assert.Equal(t, "[model-a]\nParis is the capital of France.\n\n[model-c]\nBerlin.", result.Content)
+
+	w = ensembleCall(router, `{"models":["model-a","model-c"],"aggregation":"random",`+ensembleMessages+`}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Contains(t, []string{"model-a", "model-c"}, result.Winner)
+}
+
+func TestEnsembleTimeoutAndFailures(t *testing.T) {
+	router := setupEnsembleRouter(t, 200*time.Millisecond)
+
+	start := time.Now()
+	w := ensembleCall(router, `{"models":["slow","model-a","unknown"],`+ensembleMessages+`}`)
+	assert.Less(t, time.Since(start), time.Second)
+	require.Equal(t, http.StatusOK, w.Code)
+	var result EnsembleResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, EnsembleVote, result.Aggregation)
+	assert.Equal(t, "model-a", result.Winner)
+	assert.Equal(t, EnsembleStatusTimeout, result.Responses[0].Status)
+	assert.Equal(t, EnsembleStatusError, result.Responses[2].Status)
+
+	w = ensembleCall(router, `{"models":["slow","unknown"],`+ensembleMessages+`}`)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "ensemble_failed")
+}
+
+func TestEnsembleValidation(t *testing.T) {
+	router := setupEnsembleRouter(t, time.Second)
+
+	for _, body := range []string{
+		`{"models":["model-a"],` + ensembleMessages + `}`,
+		`{"models":["model-a","model-a"],` + ensembleMessages + `}`,
+		`{"models":["a","b","c","d","e"],` + ensembleMessages + `}`,
+		`{"models":["model-a","model-b"],"aggregation":"median",` + ensembleMessages + `}`,
+		`{"models":["model-a","model-b"]}`,
+		`{"models":["model-a","model-b"],"stream":true,` + ensembleMessages + `}`,
+	} {
+		w := ensembleCall(router, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestTokenSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, jaccard(tokenSet("Hello, world"), tokenSet("world hello")))
+	assert.Equal(t, 0.0, jaccard(tokenSet("yes"), tokenSet("no")))
+	// Han characters are compared one by one
+	assert.InDelta(t, 0.75, jaccard(tokenSet("北京是首都"), tokenSet("首都是北京吗")), 0.2)
+}
@@ -0,0 +1,495 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Redis keys used by the experiment controller
+const (
+	experimentsKey          = "gw:experiments"
+	experimentResultsPrefix = "gw:experiment_results:"
+	// experimentNotEnrolled is stored for users outside the traffic fraction so exclusion is sticky too
+	experimentNotEnrolled = "-"
+	// ExperimentAssignmentTTL 用户分组的保留时间
+	ExperimentAssignmentTTL = 30 * 24 * time.Hour
+)
+
+// ErrExperimentNotFound is returned for unknown experiment IDs
+var ErrExperimentNotFound = errors.New("experiment not found")
+
+// Variant 实验分组，按权重分配流量并路由到指定模型
+type Variant struct {
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	Model  string  `json:"model"`
+}
+
+// Experiment 由网关控制的 A/B 实验
+type Experiment struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Variants        []Variant `json:"variants"`
+	TrafficFraction float64   `json:"traffic_fraction"`
+	Active          bool      `json:"active"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Validate checks an experiment definition and names unnamed variants after their model
+func (e *Experiment) Validate() error {
+	if strings.TrimSpace(e.Name) == "" {
+		return errors.New("name is required")
+	}
+	if len(e.Variants) < 2 {
+		return errors.New("at least two variants are required")
+	}
+	if e.TrafficFraction <= 0 || e.TrafficFraction > 1 {
+		return errors.New("traffic_fraction must be in (0, 1]")
+	}
+
+	seen := make(map[string]bool, len(e.Variants))
+	for i := range e.Variants {
+		v := &e.Variants[i]
+		if v.Model == "" {
+			return fmt.Errorf("variant %d: model is required", i)
+		}
+		if v.Weight <= 0 {
+			return fmt.Errorf("variant %d: weight must be positive", i)
+		}
+		if v.Name == "" {
+			v.Name = v.Model
+		}
+		if v.Name == experimentNotEnrolled || strings.Contains(v.Name, ":") {
+			return fmt.Errorf("variant %d: invalid name %q", i, v.Name)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("duplicate variant %q", v.Name)
+		}
+		seen[v.Name] = true
+	}
+	return nil
+}
+
+// variant returns the named variant
+func (e *Experiment) variant(name string) (Variant, bool) {
+	for _, v := range e.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// pick draws a variant, or experimentNotEnrolled for users outside the traffic fraction
+func (e *Experiment) pick(rng func() float64) string {
+	if rng() >= e.TrafficFraction {
+		return experimentNotEnrolled
+	}
+	var total float64
+	for _, v := range e.Variants {
+		total += v.Weight
+	}
+	r := rng() * total
+	for _, v := range e.Variants {
+		if r < v.Weight {
+			return v.Name
+		}
+		r -= v.Weight
+	}
+	return e.Variants[len(e.Variants)-1].Name
+}
+
+// ExperimentAssignment 用户在某个实验中的分组
+type ExperimentAssignment struct {
+	ExperimentID string
+	Variant      Variant
+}
+
+// VariantResult 分组表现统计
+type VariantResult struct {
+	Variant               string  `json:"variant"`
+	Model                 string  `json:"model"`
+	Users                 int64   `json:"users"`
+	Requests              int64   `json:"requests"`
+	Errors                int64   `json:"errors"`
+	ErrorRate             float64 `json:"error_rate"`
+	AvgLatencyMS          float64 `json:"avg_latency_ms"`
+	AvgPromptTokens       float64 `json:"avg_prompt_tokens"`
+	AvgCompletionTokens   float64 `json:"avg_completion_tokens"`
+	TotalCompletionTokens int64   `json:"total_completion_tokens"`
+}
+
+// ExperimentController 以网关作为实验控制器：定义存放在 Redis 中，
+// 用户分组通过 gw:experiments:<experimentID>:<userID> 保持粘性，所有实例共享。
+type ExperimentController struct {
+	client *redis.Client
+	rngMu  sync.Mutex
+	rng    *mathrand.Rand
+}
+
+// NewExperimentController creates a controller backed by Redis
+func NewExperimentController(client *redis.Client) *ExperimentController {
+	return &ExperimentController{
+		client: client,
+		rng:    mathrand.New(mathrand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+var (
+	defaultExperimentControllerMu sync.RWMutex
+	defaultExperimentController   *ExperimentController
+)
+
+// SetExperimentController installs the controller consulted by chat completions
+func SetExperimentController(ec *ExperimentController) {
+	defaultExperimentControllerMu.Lock()
+	defaultExperimentController = ec
+	defaultExperimentControllerMu.Unlock()
+}
+
+// DefaultExperimentController returns the controller consulted by chat completions, or nil
+func DefaultExperimentController() *ExperimentController {
+	defaultExperimentControllerMu.RLock()
+	defer defaultExperimentControllerMu.RUnlock()
+	return defaultExperimentController
+}
+
+func (ec *ExperimentController) random() float64 {
+	ec.rngMu.Lock()
+	defer ec.rngMu.Unlock()
+	return ec.rng.Float64()
+}
+
+func assignmentKey(experimentID, userID string) string {
+	return fmt.Sprintf("%s:%s:%s", experimentsKey, experimentID, userID)
+}
+
+// Create validates and stores a new active experiment
+func (ec *ExperimentController) Create(ctx context.Context, exp *Experiment) error {
+	if err := exp.Validate(); err != nil {
+		return err
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	exp.ID = "exp_" + hex.EncodeToString(id)
+	exp.Active = true
+	exp.CreatedAt = time.Now()
+	return ec.save(ctx, exp)
+}
+
+func (ec *ExperimentController) save(ctx context.Context, exp *Experiment) error {
+	data, err := json.Marshal(exp)
+	if err != nil {
+		return err
+	}
+	if err := ec.client.HSet(ctx, experimentsKey, exp.ID, data).Err(); err != nil {
+		return fmt.Errorf("failed to store experiment: %w", err)
+	}
+	return nil
+}
+
+// Get returns one experiment
+func (ec *ExperimentController) Get(ctx context.Context, id string) (*Experiment, error) {
+	data, err := ec.client.HGet(ctx, experimentsKey, id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrExperimentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load experiment: %w", err)
+	}
+	var exp Experiment
+	if err := json.Unmarshal(data, &exp); err != nil {
+		return nil, fmt.Errorf("failed to decode experiment: %w", err)
+	}
+	return &exp, nil
+}
+
+// List returns every experiment, oldest first
+func (ec *ExperimentController) List(ctx context.Context) ([]*Experiment, error) {
+	records, err := ec.client.HGetAll(ctx, experimentsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load experiments: %w", err)
+	}
+	experiments := make([]*Experiment, 0, len(records))
+	for id, data := range records {
+		var exp Experiment
+		if err := json.Unmarshal([]byte(data), &exp); err != nil {
+			logrus.WithError(err).WithField("experiment", id).Warn("Skipping unreadable experiment")
+			continue
+		}
+		experiments = append(experiments, &exp)
+	}
+	sort.Slice(experiments, func(i, j int) bool {
+		return experiments[i].CreatedAt.Before(experiments[j].CreatedAt)
+	})
+	return experiments, nil
+}
+
+// Stop deactivates an experiment; its assignments and results are kept
+func (ec *ExperimentController) Stop(ctx context.Context, id string) (*Experiment, error) {
+	exp, err := ec.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	exp.Active = false
+	return exp, ec.save(ctx, exp)
+}
+
+// Assign returns the variant the user is enrolled in for the first active experiment
+// that enrolls them. Assignments are sticky: the first draw is stored and reused.
+func (ec *ExperimentController) Assign(ctx context.Context, userID string) (*ExperimentAssignment, error) {
+	if userID == "" {
+		return nil, nil
+	}
+	experiments, err := ec.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, exp := range experiments {
+		if !exp.Active {
+			continue
+		}
+		key := assignmentKey(exp.ID, userID)
+		name := exp.pick(ec.random)
+		won, err := ec.client.SetNX(ctx, key, name, ExperimentAssignmentTTL).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to store experiment assignment: %w", err)
+		}
+		if won {
+			if name != experimentNotEnrolled {
+				ec.client.HIncrBy(ctx, experimentResultsPrefix+exp.ID, name+":users", 1)
+			}
+		} else if name, err = ec.client.Get(ctx, key).Result(); err != nil {
+			return nil, fmt.Errorf("failed to load experiment assignment: %w", err)
+		}
+
+		if variant, ok := exp.variant(name); ok {
+			return &ExperimentAssignment{ExperimentID: exp.ID, Variant: variant}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Record adds one request outcome to a variant's statistics
+func (ec *ExperimentController) Record(ctx context.Context, a *ExperimentAssignment, status int, latency time.Duration, promptTokens, completionTokens int64) {
+	key := experimentResultsPrefix + a.ExperimentID
+	v := a.Variant.Name
+
+	pipe := ec.client.TxPipeline()
+	pipe.HIncrBy(ctx, key, v+":requests", 1)
+	if status >= http.StatusBadRequest {
+		pipe.HIncrBy(ctx, key, v+":errors", 1)
+	}
+	pipe.HIncrBy(ctx, key, v+":latency_ms", latency.Milliseconds())
+	pipe.HIncrBy(ctx, key, v+":prompt_tokens", promptTokens)
+	pipe.HIncrBy(ctx, key, v+":completion_tokens", completionTokens)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logrus.WithError(err).WithField("experiment", a.ExperimentID).Warn("Failed to record experiment result")
+	}
+}
+
+// Results returns per-variant performance statistics
+func (ec *ExperimentController) Results(ctx context.Context, id string) (*Experiment, []VariantResult, error) {
+	exp, err := ec.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields, err := ec.client.HGetAll(ctx, experimentResultsPrefix+id).Result()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load experiment results: %w", err)
+	}
+	counter := func(variant, name string) int64 {
+		n, _ := strconv.ParseInt(fields[variant+":"+name], 10, 64)
+		return n
+	}
+	ratio := func(a, b int64) float64 {
+		if b == 0 {
+			return 0
+		}
+		return math.Round(float64(a)/float64(b)*1000) / 1000
+	}
+
+	results := make([]VariantResult, 0, len(exp.Variants))
+	for _, v := range exp.Variants {
+		requests := counter(v.Name, "requests")
+		errs := counter(v.Name, "errors")
+		completion := counter(v.Name, "completion_tokens")
+		results = append(results, VariantResult{
+			Variant:               v.Name,
+			Model:                 v.Model,
+			Users:                 counter(v.Name, "users"),
+			Requests:              requests,
+			Errors:                errs,
+			ErrorRate:             ratio(errs, requests),
+			AvgLatencyMS:          ratio(counter(v.Name, "latency_ms"), requests),
+			AvgPromptTokens:       ratio(counter(v.Name, "prompt_tokens"), requests),
+			AvgCompletionTokens:   ratio(completion, requests),
+			TotalCompletionTokens: completion,
+		})
+	}
+	return exp, results, nil
+}
+
+// experimentUserID identifies the user for assignment: the OpenAI "user" field,
+// then the X-User-ID header, then the authenticated user or tenant
+func experimentUserID(c *gin.Context, request map[string]interface{}) string {
+	if user, _ := request["user"].(string); user != "" {
+		return user
+	}
+	if user := c.GetHeader("X-User-ID"); user != "" {
+		return user
+	}
+	if user := c.GetString("user_id"); user != "" {
+		return user
+	}
+	return c.GetString("tenant_id")
+}
+
+// experimentChatHooks routes enrolled users to their variant's model and records the outcome
+func experimentChatHooks(c *gin.Context, ec *ExperimentController) (*proxyHooks, func()) {
+	var assignment *ExperimentAssignment
+	var promptTokens, completionTokens int64
+	start := time.Now()
+
+	hooks := &proxyHooks{
+		request: func(request map[string]interface{}) (bool, error) {
+			a, err := ec.Assign(c.Request.Context(), experimentUserID(c, request))
+			if err != nil {
+				// Experiments never block traffic
+				logrus.WithError(err).Warn("Experiment assignment failed")
+				return false, nil
+			}
+			if a == nil {
+				return false, nil
+			}
+			assignment = a
+			c.Header("X-Experiment-ID", a.ExperimentID)
+			c.Header("X-Experiment-Variant", a.Variant.Name)
+			request["model"] = a.Variant.Model
+			return true, nil
+		},
+		response: func(resp map[string]interface{}) error {
+			if usage, ok := resp["usage"].(map[string]interface{}); ok {
+				p, _ := usage["prompt_tokens"].(float64)
+				r, _ := usage["completion_tokens"].(float64)
+				promptTokens, completionTokens = int64(p), int64(r)
+			}
+			return nil
+		},
+	}
+
+	done := func() {
+		if assignment != nil {
+			ec.Record(context.Background(), assignment, c.Writer.Status(), time.Since(start), promptTokens, completionTokens)
+		}
+	}
+	return hooks, done
+}
+
+// CreateExperiment defines a new experiment
+func CreateExperiment(ec *ExperimentController) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var exp Experiment
+		if err := c.ShouldBindJSON(&exp); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "Invalid request format",
+					"type":    "validation_error",
+					"code":    "invalid_format",
+				},
+			})
+			return
+		}
+		if err := exp.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "validation_error",
+					"code":    "invalid_experiment",
+				},
+			})
+			return
+		}
+		if err := ec.Create(c.Request.Context(), &exp); err != nil {
+			experimentStorageError(c, err)
+			return
+		}
+		c.JSON(http.StatusCreated, exp)
+	}
+}
+
+// ListExperiments returns every experiment
+func ListExperiments(ec *ExperimentController) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		experiments, err := ec.List(c.Request.Context())
+		if err != nil {
+			experimentStorageError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"experiments": experiments})
+	}
+}
+
+// StopExperiment ends an experiment; assigned users return to the requested model
+func StopExperiment(ec *ExperimentController) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exp, err := ec.Stop(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			experimentStorageError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, exp)
+	}
+}
+
+// GetExperimentResults returns per-variant performance statistics
+func GetExperimentResults(ec *ExperimentController) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exp, results, err := ec.Results(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			experimentStorageError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"experiment": exp,
+			"results":    results,
+		})
+	}
+}
+
+func experimentStorageError(c *gin.Context, err error) {
+	if errors.Is(err, ErrExperimentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": err.Error(),
+				"type":    "invalid_request_error",
+				"code":    "experiment_not_found",
+			},
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": gin.H{
+			"message": err.Error(),
+			"type":    "internal_server_error",
+			"code":    "storage_error",
+		},
+	})
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupExperimentRouter(t *testing.T) (*gin.Engine, *ExperimentController, *miniredis.Miniredis) {
+	gin.SetMode(gin.TestMode)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		w.Header().Set("Content-Type", "application/json")
+		if req["model"] == "broken-model" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":{"message":"boom"}}`))
+			return
+		}
+		fmt.Fprintf(w, `{"model":%q,"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5}}`, req["model"])
+	}))
+	t.Cleanup(upstream.Close)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	ec := NewExperimentController(client)
+	SetExperimentController(ec)
+	t.Cleanup(func() { SetExperimentController(nil) })
+
+	cfg := &config.Config{TargetURL: upstream.URL}
+	r := gin.New()
+	r.POST("/api/v1/experiments", CreateExperiment(ec))
+	r.POST("/api/v1/experiments/:id/stop", StopExperiment(ec))
+	r.GET("/api/v1/experiments/:id/results", GetExperimentResults(ec))
+	r.POST("/v1/chat/completions", ChatCompletions(cfg))
+	return r, ec, mr
+}
+
+func createExperiment(t *testing.T, r *gin.Engine, body string) Experiment {
+	w := postJSON(r, "/api/v1/experiments", body)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var exp Experiment
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &exp))
+	return exp
+}
+
+func chatAs(r *gin.Engine, user string) *httptest.ResponseRecorder {
+	return postJSON(r, "/v1/chat/completions", fmt.Sprintf(`{"model":"gpt-3.5-turbo","user":%q,"messages":[]}`, user))
+}
+
+func TestExperimentStickyAssignmentRoutesToVariant(t *testing.T) {
+	r, _, mr := setupExperimentRouter(t)
+	exp := createExperiment(t, r, `{
+		"name": "cheaper-model",
+		"traffic_fraction": 1,
+		"variants": [
+			{"name": "control", "weight": 1, "model": "gpt-4"},
+			{"name": "treatment", "weight": 1, "model": "gpt-4o-mini"}
+		]
+	}`)
+	assert.True(t, exp.Active)
+
+	seen := map[string]int{}
+	for i := 0; i < 40; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		w := chatAs(r, user)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, exp.ID, w.Header().Get("X-Experiment-ID"))
+		variant := w.Header().Get("X-Experiment-Variant")
+		seen[variant]++
+
+		// The upstream received the variant's model
+		want := map[string]string{"control": "gpt-4", "treatment": "gpt-4o-mini"}[variant]
+		assert.Contains(t, w.Body.String(), want)
+
+		// The assignment is stored and reused
+		stored, err := mr.Get(fmt.Sprintf("gw:experiments:%s:%s", exp.ID, user))
+		require.NoError(t, err)
+		assert.Equal(t, variant, stored)
+		for j := 0; j < 2; j++ {
+			assert.Equal(t, variant, chatAs(r, user).Header().Get("X-Experiment-Variant"))
+		}
+	}
+	assert.Positive(t, seen["control"])
+	assert.Positive(t, seen["treatment"])
+
+	// Stopped experiments no longer route traffic
+	require.Equal(t, http.StatusOK, postJSON(r, "/api/v1/experiments/"+exp.ID+"/stop", "").Code)
+	w := chatAs(r, "user-0")
+	assert.Empty(t, w.Header().Get("X-Experiment-ID"))
+	assert.Contains(t, w.Body.String(), "gpt-3.5-turbo")
+}
+
+func TestExperimentTrafficFractionExcludesUsersStickily(t *testing.T) {
+	r, ec, _ := setupExperimentRouter(t)
+	createExperiment(t, r, `{
+		"name": "tiny",
+		"traffic_fraction": 0.000001,
+		"variants": [{"weight": 1, "model": "gpt-4"}, {"weight": 1, "model": "gpt-4o"}]
+	}`)
+
+	w := chatAs(r, "outsider")
+	assert.Empty(t, w.Header().Get("X-Experiment-ID"))
+	assert.Contains(t, w.Body.String(), "gpt-3.5-turbo")
+
+	a, err := ec.Assign(context.Background(), "outsider")
+	require.NoError(t, err)
+	assert.Nil(t, a)
+}
+
+func TestExperimentResults(t *testing.T) {
+	r, _, _ := setupExperimentRouter(t)
+	exp := createExperiment(t, r, `{
+		"name": "reliability",
+		"traffic_fraction": 1,
+		"variants": [
+			{"name": "good", "weight": 1, "model": "gpt-4"},
+			{"name": "bad", "weight": 1, "model": "broken-model"}
+		]
+	}`)
+
+	for i := 0; i < 20; i++ {
+		chatAs(r, fmt.Sprintf("user-%d", i))
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/experiments/"+exp.ID+"/results", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Results []VariantResult `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Results, 2)
+
+	good, bad := body.Results[0], body.Results[1]
+	assert.Equal(t, int64(20), good.Requests+bad.Requests)
+	assert.Equal(t, int64(20), good.Users+bad.Users)
+	assert.Equal(t, int64(0), good.Errors)
+	assert.Equal(t, bad.Requests, bad.Errors)
+	if bad.Requests > 0 {
+		assert.Equal(t, 1.0, bad.ErrorRate)
+	}
+	if good.Requests > 0 {
+		assert.Equal(t, 10.0, good.AvgPromptTokens)
+		assert.Equal(t, 5.0, good.AvgCompletionTokens)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/experiments/exp_missing/results", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestExperimentValidation(t *testing.T) {
+	r, _, _ := setupExperimentRouter(t)
+
+	for _, body := range []string{
+		`{"name":"x","traffic_fraction":1,"variants":[{"weight":1,"model":"a"}]}`,
+		`{"name":"x","traffic_fraction":0,"variants":[{"weight":1,"model":"a"},{"weight":1,"model":"b"}]}`,
+		`{"name":"x","traffic_fraction":1,"variants":[{"weight":0,"model":"a"},{"weight":1,"model":"b"}]}`,
+		`{"name":"x","traffic_fraction":1,"variants":[{"weight":1,"model":"a"},{"weight":1,"model":"a"}]}`,
+	} {
+		w := postJSON(r, "/api/v1/experiments", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Contains(t, w.Body.String(), "invalid_experiment")
+	}
+}
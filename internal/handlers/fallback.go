@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/logging"
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FallbackProviderHeader names the provider that served a request wrapped by
+// a FallbackRouter
+const FallbackProviderHeader = "X-AI-Gateway-Provider"
+
+// fallbackProviderKey holds the fallback provider the current attempt is sent to
+const fallbackProviderKey = "fallback_provider"
+
+// FallbackRouter 主上游返回 5xx 或超时时，按配置顺序把同一请求重试到备用提供商。
+// 成功的响应直接透传（包括流式响应），失败的响应先缓冲，全部尝试失败后返回最后一次的错误。
+type FallbackRouter struct {
+	providers []config.FallbackProviderConfig
+}
+
+// NewFallbackRouter creates a router retrying against the fallback providers of cfg
+func NewFallbackRouter(cfg *config.Config) *FallbackRouter {
+	return &FallbackRouter{providers: cfg.Fallback.Providers}
+}
+
+// Wrap returns primary retried against the fallback providers. Without
+// providers primary is returned unchanged.
+func (fr *FallbackRouter) Wrap(primary gin.HandlerFunc) gin.HandlerFunc {
+	if fr == nil || len(fr.providers) == 0 {
+		return primary
+	}
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, MaxRequestBodySize))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "Failed to read request body",
+					"type":    "invalid_request_error",
+					"code":    "bad_request",
+				},
+			})
+			return
+		}
+
+		original := c.Writer
+		headers := original.Header().Clone()
+		defer func() { c.Writer = original }()
+
+		attempt := func(provider *config.FallbackProviderConfig) *fallbackWriter {
+			resetHeaders(original.Header(), headers)
+			writer := &fallbackWriter{ResponseWriter: original}
+			requestBody := body
+			if provider != nil {
+				writer.provider = provider.Name
+				requestBody = withModel(body, provider.Model)
+				c.Set(fallbackProviderKey, provider)
+			}
+			c.Writer = writer
+			c.Request.Body = io.NopCloser(bytes.NewReader(requestBody))
+			c.Request.ContentLength = int64(len(requestBody))
+			primary(c)
+			return writer
+		}
+
+		writer := attempt(nil)
+		ks := DefaultKillSwitches()
+		for i := range fr.providers {
+			if !writer.failed() || c.Request.Context().Err() != nil {
+				break
+			}
+			provider := &fr.providers[i]
+			if ks != nil && providerKilled(ks, provider.Name, provider.URL, "") {
+				middleware.RecordKillSwitchProvider()
+				continue
+			}
+			logging.FromContext(c).WithField("provider", provider.Name).
+				WithField("status", writer.status).
+				Warn("Upstream failed, retrying against fallback provider")
+			writer = attempt(provider)
+		}
+		if writer.failed() {
+			writer.release()
+		}
+	}
+}
+
+// fallbackTarget returns the fallback provider the current attempt goes to
+func fallbackTarget(c *gin.Context) (*config.FallbackProviderConfig, bool) {
+	value, ok := c.Get(fallbackProviderKey)
+	if !ok {
+		return nil, false
+	}
+	provider, ok := value.(*config.FallbackProviderConfig)
+	return provider, ok
+}
+
+// withModel replaces the model of a JSON request body; body is returned
+// unchanged when model is empty or the body is not a JSON object
+func withModel(body []byte, model string) []byte {
+	if model == "" {
+		return body
+	}
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal(body, &request); err != nil {
+		return body
+	}
+	request["model"], _ = json.Marshal(model)
+	rewritten, err := json.Marshal(request)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// resetHeaders makes header equal to snapshot, dropping what a failed attempt set
+func resetHeaders(header, snapshot http.Header) {
+	for name := range header {
+		delete(header, name)
+	}
+	for name, values := range snapshot {
+		header[name] = values
+	}
+}
+
+// fallbackWriter holds back 5xx responses so the request can be retried, and
+// passes every other response straight through
+type fallbackWriter struct {
+	gin.ResponseWriter
+	provider  string // fallback provider of the attempt, empty for the primary
+	buf       bytes.Buffer
+	status    int
+	committed bool
+}
+
+func (w *fallbackWriter) WriteHeader(code int) {
+	if w.committed {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *fallbackWriter) WriteHeaderNow() {
+	if !w.committed && w.status < http.StatusInternalServerError {
+		w.commit()
+	}
+	if w.committed {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *fallbackWriter) Write(data []byte) (int, error) {
+	if !w.committed && w.status < http.StatusInternalServerError {
+		w.commit()
+	}
+	if w.committed {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+func (w *fallbackWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *fallbackWriter) Status() int {
+	if w.committed || w.status == 0 {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *fallbackWriter) Written() bool {
+	return w.committed || w.status != 0 || w.buf.Len() > 0
+}
+
+// Flush 流式响应开始后不再回退
+func (w *fallbackWriter) Flush() {
+	if !w.committed && w.status < http.StatusInternalServerError {
+		w.commit()
+	}
+	if w.committed {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// failed reports whether the attempt ended in a held back 5xx response
+func (w *fallbackWriter) failed() bool {
+	return !w.committed && w.status >= http.StatusInternalServerError
+}
+
+// commit sends the status and the provider header to the client
+func (w *fallbackWriter) commit() {
+	w.committed = true
+	provider := w.provider
+	if provider == "" {
+		if provider = w.Header().Get(UpstreamProviderHeader); provider == "" {
+			provider = primaryProvider
+		}
+	}
+	w.Header().Set(FallbackProviderHeader, provider)
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+// release writes the held back response once no provider is left to try
+func (w *fallbackWriter) release() {
+	w.commit()
+	w.ResponseWriter.Write(w.buf.Bytes())
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fallbackUpstream answers every request with status and counts the calls
+func fallbackUpstream(t *testing.T, name string, status int, calls *atomic.Int32) *httptest.Server {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var request struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		fmt.Fprintf(w, `{"served_by":%q,"model":%q,"auth":%q}`, name, request.Model, r.Header.Get("Authorization"))
+	}))
+	t.Cleanup(upstream.Close)
+	return upstream
+}
+
+func TestFallbackRouterRetriesSecondaryProviders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var primaryCalls, openaiCalls, anthropicCalls atomic.Int32
+	primary := fallbackUpstream(t, "dashscope", http.StatusServiceUnavailable, &primaryCalls)
+	openai := fallbackUpstream(t, "openai", http.StatusBadGateway, &openaiCalls)
+	anthropic := fallbackUpstream(t, "anthropic", http.StatusOK, &anthropicCalls)
+
+	cfg := &config.Config{
+		TargetURL: primary.URL,
+		TargetKey: "sk-primary",
+		Fallback: config.FallbackConfig{Providers: []config.FallbackProviderConfig{
+			{Name: "openai", URL: openai.URL, APIKey: "sk-openai"},
+			{Name: "anthropic", URL: anthropic.URL, APIKey: "sk-anthropic", Model: "claude-3-5-haiku"},
+		}},
+	}
+	router := gin.New()
+	router.POST("/v1/chat/completions", NewFallbackRouter(cfg).Wrap(ChatCompletions(cfg)))
+
+	w := postJSON(router, "/v1/chat/completions", `{"model":"qwen-max","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "anthropic", w.Header().Get(FallbackProviderHeader))
+	assert.Equal(t, "anthropic", w.Header().Get(UpstreamProviderHeader))
+	assert.JSONEq(t, `{"served_by":"anthropic","model":"claude-3-5-haiku","auth":"Bearer sk-anthropic"}`, w.Body.String())
+	assert.EqualValues(t, 1, primaryCalls.Load())
+	assert.EqualValues(t, 1, openaiCalls.Load())
+	assert.EqualValues(t, 1, anthropicCalls.Load())
+}
+
+func TestFallbackRouterKeepsPrimaryResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var primaryCalls, fallbackCalls atomic.Int32
+	fallback := fallbackUpstream(t, "openai", http.StatusOK, &fallbackCalls)
+
+	for _, status := range []int{http.StatusOK, http.StatusBadRequest} {
+		primary := fallbackUpstream(t, "dashscope", status, &primaryCalls)
+		cfg := &config.Config{
+			TargetURL: primary.URL,
+			Fallback: config.FallbackConfig{Providers: []config.FallbackProviderConfig{
+				{Name: "openai", URL: fallback.URL},
+			}},
+		}
+		router := gin.New()
+		router.POST("/v1/chat/completions", NewFallbackRouter(cfg).Wrap(ChatCompletions(cfg)))
+
+		w := postJSON(router, "/v1/chat/completions", `{"model":"qwen-max","messages":[]}`)
+		assert.Equal(t, status, w.Code)
+		assert.Equal(t, primaryProvider, w.Header().Get(FallbackProviderHeader))
+		assert.Contains(t, w.Body.String(), "dashscope")
+	}
+	assert.Zero(t, fallbackCalls.Load(), "only 5xx responses are retried")
+}
+
+func TestFallbackRouterReturnsLastFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var primaryCalls, fallbackCalls atomic.Int32
+	primary := fallbackUpstream(t, "dashscope", http.StatusServiceUnavailable, &primaryCalls)
+	fallback := fallbackUpstream(t, "openai", http.StatusInternalServerError, &fallbackCalls)
+
+	cfg := &config.Config{
+		TargetURL: primary.URL,
+		Fallback: config.FallbackConfig{Providers: []config.FallbackProviderConfig{
+			{Name: "openai", URL: fallback.URL},
+		}},
+	}
+	router := gin.New()
+	router.POST("/v1/chat/completions", NewFallbackRouter(cfg).Wrap(ChatCompletions(cfg)))
+
+	w := postJSON(router, "/v1/chat/completions", `{"model":"qwen-max","messages":[]}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "openai", w.Header().Get(FallbackProviderHeader))
+	assert.Contains(t, w.Body.String(), `"served_by":"openai"`)
+}
+
+func TestFallbackRouterWithoutProviders(t *testing.T) {
+	primary := ChatCompletions(&config.Config{})
+	wrapped := NewFallbackRouter(&config.Config{}).Wrap(primary)
+	assert.Equal(t, fmt.Sprintf("%p", primary), fmt.Sprintf("%p", wrapped))
+}
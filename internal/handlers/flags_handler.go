@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-aigateway/internal/flags"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateFlagsRequest replaces the full set of feature flag definitions
+type UpdateFlagsRequest struct {
+	Flags []flags.Flag `json:"flags"`
+}
+
+// GetFlags returns all feature flag definitions
+func GetFlags(svc *flags.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"flags": svc.List(),
+		})
+	}
+}
+
+// UpdateFlags replaces feature flag definitions; changes take effect immediately
+func UpdateFlags(svc *flags.Service, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req UpdateFlagsRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "Invalid request format",
+					"type":    "validation_error",
+					"code":    "invalid_format",
+				},
+			})
+			return
+		}
+
+		if err := svc.Replace(c.Request.Context(), req.Flags); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "validation_error",
+					"code":    "invalid_flag",
+				},
+			})
+			return
+		}
+
+		names := make([]string, 0, len(req.Flags))
+		for _, flag := range req.Flags {
+			names = append(names, flag.Name)
+		}
+		audit.LogWithContext(c.Request.Context(), &security.AuditEvent{
+			Type:      "feature_flags",
+			Action:    "update",
+			Resource:  "/api/v1/admin/flags",
+			UserID:    c.GetString("user_id"),
+			RemoteIP:  c.ClientIP(),
+			UserAgent: c.GetHeader("User-Agent"),
+			Details:   map[string]interface{}{"flags": names},
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"flags":   svc.List(),
+			"message": "Feature flags updated successfully",
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net"
+	"net/url"
+	"sync"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/routing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpstreamProviderHeader names the provider endpoint geo routing picked
+const UpstreamProviderHeader = "X-Upstream-Provider"
+
+var (
+	defaultGeoRouterMu sync.RWMutex
+	defaultGeoRouter   *routing.GeoRouter
+)
+
+// SetGeoRouter installs the router choosing upstream endpoints by client region; nil disables it
+func SetGeoRouter(r *routing.GeoRouter) {
+	defaultGeoRouterMu.Lock()
+	defaultGeoRouter = r
+	defaultGeoRouterMu.Unlock()
+}
+
+// DefaultGeoRouter returns the geo router consulted by the proxy, or nil
+func DefaultGeoRouter() *routing.GeoRouter {
+	defaultGeoRouterMu.RLock()
+	defer defaultGeoRouterMu.RUnlock()
+	return defaultGeoRouter
+}
+
+// primaryProvider is the kill switch label of the configured target, as named by SmokeTargets
+const primaryProvider = "openai"
+
+// upstreamBase returns the base URL to proxy to: the geo-routed endpoint when
+// geo routing is enabled, otherwise the configured target. ok is false when a
+// kill switch stopped the provider and no other endpoint may take the request.
+func upstreamBase(c *gin.Context, cfg *config.Config, model string) (base string, ok bool) {
+	ks := DefaultKillSwitches()
+	killed := func(provider, base string) bool {
+		return ks != nil && providerKilled(ks, provider, base, model)
+	}
+
+	gr := DefaultGeoRouter()
+	var selection routing.Selection
+	ip := net.ParseIP(c.ClientIP())
+	if gr != nil {
+		selection = gr.Select(c.Request.Context(), ip)
+	}
+	if selection.URL == "" {
+		if killed(primaryProvider, cfg.TargetURL) {
+			middleware.RecordKillSwitchProvider()
+			return "", false
+		}
+		return cfg.TargetURL, true
+	}
+
+	if killed(selection.Provider, selection.URL) {
+		middleware.RecordKillSwitchProvider()
+		if !ks.ProviderFallback() {
+			return "", false
+		}
+		selection = gr.SelectAvoiding(c.Request.Context(), ip, func(endpoint routing.Endpoint) bool {
+			return killed(endpoint.Provider, endpoint.URL)
+		})
+		if selection.URL == "" {
+			return "", false
+		}
+	}
+	c.Header(UpstreamProviderHeader, selection.Provider)
+	return selection.URL, true
+}
+
+// providerKilled reports whether a kill switch stopped the provider serving
+// model at base, by provider label, host or the model's provider
+func providerKilled(ks *middleware.KillSwitches, provider, base, model string) bool {
+	host := ""
+	if target, err := url.Parse(base); err == nil {
+		host = target.Host
+	}
+	return ks.ProviderKilled(provider) || ks.ProviderKilled(host) || ks.ProviderKilled(providerForModel(model, host))
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/routing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyUsesGeoRoutedEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var endpoints []routing.Endpoint
+	for _, name := range []string{"eu", "us"} {
+		name := name
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"served_by":%q}`, name)
+		}))
+		t.Cleanup(upstream.Close)
+		endpoints = append(endpoints, routing.Endpoint{Provider: "openai-" + name, URL: upstream.URL})
+	}
+
+	// Without geo data the router alternates between endpoints
+	SetGeoRouter(routing.NewGeoRouter(nil, nil, endpoints))
+	t.Cleanup(func() { SetGeoRouter(nil) })
+
+	router := gin.New()
+	router.POST("/v1/chat/completions", ChatCompletions(&config.Config{TargetURL: "http://unused.invalid"}))
+
+	w := postJSON(router, "/v1/chat/completions", `{"model":"gpt-4","messages":[]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "openai-eu", w.Header().Get(UpstreamProviderHeader))
+	assert.JSONEq(t, `{"served_by":"eu"}`, w.Body.String())
+
+	w = postJSON(router, "/v1/chat/completions", `{"model":"gpt-4","messages":[]}`)
+	assert.Equal(t, "openai-us", w.Header().Get(UpstreamProviderHeader))
+	assert.JSONEq(t, `{"served_by":"us"}`, w.Body.String())
+}
@@ -2,11 +2,18 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go-aigateway/internal/config"
+	"go-aigateway/internal/flags"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/logging"
 	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/monitoring"
 	"go-aigateway/internal/security"
+	"go-aigateway/internal/upstream"
 	"io"
 	"net/http"
 	"strings"
@@ -14,6 +21,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -21,6 +29,19 @@ const (
 	RequestTimeout     = 30 * time.Second
 )
 
+// proxyClient executes non-GET proxy requests under the egress policy
+var proxyClient = httpclient.NewClient("proxy", RequestTimeout)
+
+// streamClient executes streamed proxy requests. A stream may outlive
+// RequestTimeout, so only the wait for the response headers is bounded.
+var streamClient = httpclient.WrapClient("proxy", &http.Client{Transport: streamTransport()})
+
+func streamTransport() *http.Transport {
+	t := httpclient.Transport("proxy")
+	t.ResponseHeaderTimeout = RequestTimeout
+	return t
+}
+
 // HealthCheck handler
 func HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -31,10 +52,38 @@ func HealthCheck(c *gin.Context) {
 	})
 }
 
-// ChatCompletions handler
+// ChatCompletions handler. Requests with "stream": true get the upstream's
+// server-sent events re-emitted as they arrive, ending with data: [DONE];
+// other requests get one JSON response.
 func ChatCompletions(cfg *config.Config) gin.HandlerFunc {
+	structured := NewStructuredOutputValidator(cfg)
 	return func(c *gin.Context) {
-		proxyRequest(c, cfg, "/chat/completions")
+		// Responses of requests carrying a response_schema are validated last, after any model rewrite
+		hooks := structured.hooks(c)
+
+		// Template versions applied to the request are collected for its audit record
+		if ps := DefaultPromptStore(); ps != nil {
+			ctx, applied := withAppliedPrompts(c.Request.Context())
+			c.Request = c.Request.WithContext(ctx)
+			defer func() { ps.auditAIRequest(c, applied.list()) }()
+			if cfg.Prompts.SystemTemplate != "" {
+				hooks = chainHooks(systemPromptHooks(c, ps, cfg.Prompts.SystemTemplate), hooks)
+			}
+		}
+
+		// Request shapes are recorded as sent upstream, after every rewrite
+		if ra := DefaultRequestShapeAnalytics(); ra != nil {
+			hooks = chainHooks(hooks, ra.hooks(c))
+		}
+
+		// Users enrolled in an active experiment are routed to their variant's model
+		if ec := DefaultExperimentController(); ec != nil {
+			experimentHooks, done := experimentChatHooks(c, ec)
+			proxyRequestWithHooks(c, cfg, "/chat/completions", chainHooks(experimentHooks, hooks))
+			done()
+			return
+		}
+		proxyRequestWithHooks(c, cfg, "/chat/completions", hooks)
 	}
 }
 
@@ -52,9 +101,57 @@ func Models(cfg *config.Config) gin.HandlerFunc {
 	}
 }
 
+// proxyHooks 端点特定的请求/响应改写钩子
+type proxyHooks struct {
+	// request may rewrite the decoded JSON request; it reports whether the body changed
+	request func(request map[string]interface{}) (bool, error)
+	// response rewrites a successful decoded JSON response
+	response func(resp map[string]interface{}) error
+	// requestErrorCode is reported when request returns an error
+	requestErrorCode string
+}
+
+// chainHooks runs request hooks in order and response hooks in reverse order,
+// so the first hook sees the final response
+func chainHooks(hooks ...*proxyHooks) *proxyHooks {
+	chained := &proxyHooks{}
+	chained.request = func(request map[string]interface{}) (bool, error) {
+		modified := false
+		for _, h := range hooks {
+			if h.request == nil {
+				continue
+			}
+			changed, err := h.request(request)
+			if err != nil {
+				chained.requestErrorCode = h.requestErrorCode
+				return false, err
+			}
+			modified = modified || changed
+		}
+		return modified, nil
+	}
+	chained.response = func(resp map[string]interface{}) error {
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if hooks[i].response == nil {
+				continue
+			}
+			if err := hooks[i].response(resp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return chained
+}
+
 // Generic proxy handler
 func proxyRequest(c *gin.Context, cfg *config.Config, endpoint string) {
+	proxyRequestWithHooks(c, cfg, endpoint, nil)
+}
+
+func proxyRequestWithHooks(c *gin.Context, cfg *config.Config, endpoint string, hooks *proxyHooks) {
 	start := time.Now()
+	logger := logging.FromContext(c)
 
 	// Validate request body size
 	if c.Request.ContentLength > MaxRequestBodySize {
@@ -72,7 +169,7 @@ func proxyRequest(c *gin.Context, cfg *config.Config, endpoint string) {
 	limitedReader := http.MaxBytesReader(c.Writer, c.Request.Body, MaxRequestBodySize)
 	body, err := io.ReadAll(limitedReader)
 	if err != nil {
-		logrus.WithError(err).Error("Failed to read request body")
+		logger.WithError(err).Error("Failed to read request body")
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": gin.H{
 				"message": "Failed to read request body",
@@ -83,11 +180,17 @@ func proxyRequest(c *gin.Context, cfg *config.Config, endpoint string) {
 		return
 	}
 
+	// Warnings surfaced to the client about request rewrites
+	var warnings []string
+	var model string
+	var decoded map[string]interface{}
+	var hideStreamUsage bool // the gateway asked for stream usage the client did not request
+
 	// Validate JSON if content type is JSON
 	if strings.Contains(c.GetHeader("Content-Type"), "application/json") && len(body) > 0 {
 		var jsonData interface{}
 		if err := json.Unmarshal(body, &jsonData); err != nil {
-			logrus.WithError(err).Error("Invalid JSON in request body")
+			logger.WithError(err).Error("Invalid JSON in request body")
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": gin.H{
 					"message": "Invalid JSON format",
@@ -97,17 +200,112 @@ func proxyRequest(c *gin.Context, cfg *config.Config, endpoint string) {
 			})
 			return
 		}
+
+		if request, ok := jsonData.(map[string]interface{}); ok {
+			decoded = request
+			modified := false
+			model, _ = request["model"].(string)
+
+			// Deprecated models are flagged, retired ones migrated or rejected
+			if lr := DefaultModelLifecycle(); lr != nil && model != "" {
+				resolved, ok := lr.Apply(c, request, model)
+				if !ok {
+					return
+				}
+				if resolved != model {
+					model = resolved
+					modified = true
+				}
+			}
+			c.Set(middleware.ModelContextKey, model)
+
+			// Validate multi-modal (vision) content
+			if HasImageContent(request) {
+				validator := NewImageValidator(cfg.MaxImageSizeMB)
+				if err := validator.ValidateMessages(c.Request.Context(), request); err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{
+						"error": gin.H{
+							"message": err.Error(),
+							"type":    "invalid_request_error",
+							"code":    "invalid_image",
+						},
+					})
+					return
+				}
+
+				if !ModelSupportsVision(model) && StripImageContent(request) {
+					warnings = append(warnings, VisionStrippedWarning)
+					modified = true
+				}
+			}
+
+			// Truncate prompts that exceed the model context window
+			if cfg.ContextTruncation.Enabled {
+				truncated := false
+				conversationID := c.GetHeader("X-Conversation-ID")
+				if hs := DefaultHistorySummarizer(); hs != nil && conversationID != "" && flags.Enabled(c, flags.HistorySummarization) {
+					truncated = hs.Apply(c.Request.Context(), middleware.RequestOwner(c), conversationID, request)
+				} else {
+					truncated = NewContextWindowTruncator(&cfg.ContextTruncation).Truncate(request)
+				}
+				if truncated {
+					c.Header("X-Context-Truncated", "true")
+					modified = true
+				}
+			}
+
+			if hooks != nil && hooks.request != nil {
+				changed, err := hooks.request(request)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{
+						"error": gin.H{
+							"message": err.Error(),
+							"type":    "invalid_request_error",
+							"code":    hooks.requestErrorCode,
+						},
+					})
+					return
+				}
+				modified = modified || changed
+			}
+
+			// Streamed chat reports usage only when asked to, so ask for it to meter the request
+			if endpoint == "/chat/completions" && requestStreamUsage(request) {
+				hideStreamUsage = true
+				modified = true
+			}
+
+			if modified {
+				if modifiedBody, err := json.Marshal(request); err == nil {
+					body = modifiedBody
+				}
+			}
+		}
+	}
+
+	// Streamed chat completions are forwarded chunk by chunk
+	streaming, _ := decoded["stream"].(bool)
+
+	// Mocked routes answer here, after validation and before any upstream is selected
+	if mock := routeMockFor(c); mock != nil {
+		serveMock(c, mock, decoded)
+		return
 	}
 
 	// Sanitize endpoint parameter
 	endpoint = security.SanitizeInput(endpoint)
 
-	// Create target URL
-	targetURL := strings.TrimSuffix(cfg.TargetURL, "/") + endpoint
+	// Create target URL from the provider serving the model, otherwise the
+	// configured target preferring the lowest-RTT endpoint for the client's region
+	base, targetKey, ok := modelUpstream(c, cfg, model)
+	if !ok {
+		return
+	}
+	targetURL := strings.TrimSuffix(base, "/") + endpoint
 
 	// Validate target URL
 	if !strings.HasPrefix(targetURL, "http://") && !strings.HasPrefix(targetURL, "https://") {
-		logrus.WithField("target_url", targetURL).Error("Invalid target URL")
+		logger.WithField("target_url", targetURL).Error("Invalid target URL")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{
 				"message": "Invalid target configuration",
@@ -118,10 +316,16 @@ func proxyRequest(c *gin.Context, cfg *config.Config, endpoint string) {
 		return
 	}
 
-	// Create new request
-	req, err := http.NewRequest(c.Request.Method, targetURL, bytes.NewBuffer(body))
+	// Create new request. Values of the inbound context such as the chaos state
+	// travel with it, but a disconnecting client only cancels the upstream call of
+	// a stream; other responses are still read so they can be cached and billed.
+	reqCtx := context.WithoutCancel(c.Request.Context())
+	if streaming {
+		reqCtx = c.Request.Context()
+	}
+	req, err := http.NewRequestWithContext(reqCtx, c.Request.Method, targetURL, bytes.NewBuffer(body))
 	if err != nil {
-		logrus.WithError(err).Error("Failed to create proxy request")
+		logger.WithError(err).Error("Failed to create proxy request")
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": gin.H{
 				"message": "Internal server error",
@@ -132,20 +336,14 @@ func proxyRequest(c *gin.Context, cfg *config.Config, endpoint string) {
 		return
 	}
 
-	// Copy headers from original request
-	for key, values := range c.Request.Header {
-		// Skip Authorization header as we'll set our own
-		if strings.ToLower(key) == "authorization" {
-			continue
-		}
-		for _, value := range values {
-			req.Header.Add(key, value)
-		}
-	}
+	// Forward only the client headers the header policy allows
+	headerPolicy := DefaultHeaderPolicy()
+	headerOpts := routeHeaderOptions(routeActions(c))
+	headerPolicy.ApplyRequest(c.Request.Header, req.Header, headerOpts)
 
 	// Set target API authorization
-	if cfg.TargetKey != "" {
-		req.Header.Set("Authorization", "Bearer "+cfg.TargetKey)
+	if targetKey != "" {
+		req.Header.Set("Authorization", "Bearer "+targetKey)
 	}
 
 	// Set content type if not present
@@ -157,24 +355,89 @@ func proxyRequest(c *gin.Context, cfg *config.Config, endpoint string) {
 	req.URL.RawQuery = c.Request.URL.RawQuery
 
 	// Log request
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"method":     req.Method,
 		"url":        req.URL.String(),
 		"client_ip":  c.ClientIP(),
 		"user_agent": c.GetHeader("User-Agent"),
 	}).Info("Proxying request")
 
-	// Execute request
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	// Budget-aware upstreams are told how long the gateway will wait for them
+	upstreamCtx := c.Request.Context()
+	if budgetAware(&cfg.UpstreamBudget, req.URL) {
+		if deadline, ok := upstreamDeadline(c, &cfg.UpstreamBudget, model, start); ok {
+			ctx, cancel := context.WithDeadline(upstreamCtx, deadline)
+			defer cancel()
+			upstreamCtx = ctx
+			req = req.WithContext(ctx)
+			if err := httpclient.ApplyBudget(req, cfg.UpstreamBudget.MinBudget); err != nil {
+				middleware.RecordProxyRequest(endpoint, http.StatusGatewayTimeout, time.Since(start))
+				logger.WithError(err).Warn("Request deadline exhausted before calling the upstream")
+				c.JSON(http.StatusGatewayTimeout, gin.H{
+					"error": gin.H{
+						"message": "Request deadline exhausted before the upstream could be called",
+						"type":    "timeout_error",
+						"code":    "deadline_exceeded",
+					},
+				})
+				return
+			}
+		}
 	}
 
-	resp, err := client.Do(req)
+	// The upstream call is a child span of the request
+	req, span := startUpstreamSpan(req, endpoint, model)
+	defer span.End()
+	upstreamCtx = trace.ContextWithSpan(upstreamCtx, span)
+
+	// Execute request; identical concurrent GETs such as /models share one upstream call
+	var resp *http.Response
+	upstreamStart := time.Now()
+	switch {
+	case req.Method == http.MethodGet:
+		resp, err = httpclient.Default().Do(req.WithContext(upstreamCtx))
+	case streaming:
+		resp, err = streamClient.Do(req)
+	default:
+		resp, err = proxyClient.Do(req)
+	}
 	if err != nil {
+		endUpstreamSpan(span, 0, err)
 		duration := time.Since(start)
-		middleware.RecordProxyRequest(endpoint, http.StatusBadGateway, duration)
+		if errors.Is(err, httpclient.ErrEgressDenied) {
+			middleware.RecordProxyRequest(endpoint, http.StatusForbidden, duration)
+			logger.WithError(err).Warn("Proxy target denied by egress policy")
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": gin.H{
+					"message": "Target API is not allowed by the egress policy",
+					"type":    "security_error",
+					"code":    "egress_denied",
+				},
+			})
+			return
+		}
+		timedOut := errors.Is(err, context.DeadlineExceeded)
+		if timedOut {
+			middleware.RecordProxyRequest(endpoint, http.StatusGatewayTimeout, duration)
+		} else {
+			middleware.RecordProxyRequest(endpoint, http.StatusBadGateway, duration)
+		}
+		upstream.DefaultRegistry().RecordResult(req.URL.Host, 0, duration, nil)
+		monitoring.RecordProviderRequest(providerForModel(model, req.URL.Host), model, 0, duration)
+		monitoring.DefaultMonitoringSystem().RecordResponseTime(duration, model, providerForModel(model, req.URL.Host), false)
 
-		logrus.WithError(err).Error("Failed to execute proxy request")
+		if timedOut {
+			logger.WithError(err).Warn("Upstream did not answer within the request deadline")
+			c.JSON(http.StatusGatewayTimeout, gin.H{
+				"error": gin.H{
+					"message": "Target API did not respond within the request deadline",
+					"type":    "timeout_error",
+					"code":    "deadline_exceeded",
+				},
+			})
+			return
+		}
+		logger.WithError(err).Error("Failed to execute proxy request")
 		c.JSON(http.StatusBadGateway, gin.H{
 			"error": gin.H{
 				"message": "Failed to connect to target API",
@@ -185,14 +448,39 @@ func proxyRequest(c *gin.Context, cfg *config.Config, endpoint string) {
 		return
 	}
 	defer resp.Body.Close()
+	endUpstreamSpan(span, resp.StatusCode, nil)
+
+	// Stream chunks to the client as they arrive; errors before the stream starts are read whole below
+	if streaming && resp.StatusCode == http.StatusOK && httpclient.IsEventStream(resp.Header) {
+		upstream.DefaultRegistry().RecordResult(req.URL.Host, resp.StatusCode, time.Since(start), resp.Header)
+		copyResponseHeaders(c, resp.Header, headerPolicy, headerOpts, warnings)
+		written, err := streamEvents(c, resp.Body, hideStreamUsage)
+		duration := time.Since(start)
+		middleware.RecordProxyRequest(endpoint, resp.StatusCode, duration)
+		monitoring.RecordProviderRequest(providerForModel(model, req.URL.Host), model, resp.StatusCode, duration)
+		monitoring.DefaultMonitoringSystem().RecordResponseTime(duration, model, providerForModel(model, req.URL.Host), err == nil)
+
+		fields := logrus.Fields{
+			"status_code":   resp.StatusCode,
+			"response_size": written,
+			"duration_ms":   duration.Milliseconds(),
+		}
+		if err != nil {
+			logger.WithFields(fields).WithError(err).Warn("Stream ended early")
+			return
+		}
+		logger.WithFields(fields).Info("Streamed response from target API")
+		return
+	}
 
 	// Read response body
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		duration := time.Since(start)
 		middleware.RecordProxyRequest(endpoint, http.StatusBadGateway, duration)
+		monitoring.DefaultMonitoringSystem().RecordResponseTime(duration, model, providerForModel(model, req.URL.Host), false)
 
-		logrus.WithError(err).Error("Failed to read response body")
+		logger.WithError(err).Error("Failed to read response body")
 		c.JSON(http.StatusBadGateway, gin.H{
 			"error": gin.H{
 				"message": "Failed to read target API response",
@@ -206,23 +494,22 @@ func proxyRequest(c *gin.Context, cfg *config.Config, endpoint string) {
 	// Record successful proxy request metrics
 	duration := time.Since(start)
 	middleware.RecordProxyRequest(endpoint, resp.StatusCode, duration)
+	upstream.DefaultRegistry().RecordResult(req.URL.Host, resp.StatusCode, duration, resp.Header)
+	monitoring.RecordProviderRequest(providerForModel(model, req.URL.Host), model, resp.StatusCode, duration)
+	monitoring.DefaultMonitoringSystem().RecordResponseTime(duration, model, providerForModel(model, req.URL.Host), resp.StatusCode < http.StatusBadRequest)
+	httpclient.ObserveServedTime(req.URL.Host, resp.Header, time.Since(upstreamStart))
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			c.Header(key, value)
-		}
-	}
+	copyResponseHeaders(c, resp.Header, headerPolicy, headerOpts, warnings)
 
 	// Log response
-	logrus.WithFields(logrus.Fields{
+	logger.WithFields(logrus.Fields{
 		"status_code":   resp.StatusCode,
 		"response_size": len(respBody),
 		"duration_ms":   duration.Milliseconds(),
 	}).Info("Received response from target API")
 
-	// Handle streaming responses
-	if strings.Contains(resp.Header.Get("Content-Type"), "text/event-stream") {
+	// Event streams of requests that did not ask to stream are passed on whole
+	if httpclient.IsEventStream(resp.Header) {
 		c.Header("Content-Type", "text/event-stream")
 		c.Header("Cache-Control", "no-cache")
 		c.Header("Connection", "keep-alive")
@@ -236,6 +523,28 @@ func proxyRequest(c *gin.Context, cfg *config.Config, endpoint string) {
 		var jsonResp map[string]interface{}
 		if err := json.Unmarshal(respBody, &jsonResp); err == nil {
 			// Modify response if needed (e.g., add gateway info)
+			if len(warnings) > 0 {
+				jsonResp["warnings"] = warnings
+			}
+			if hooks != nil && hooks.response != nil && resp.StatusCode == http.StatusOK {
+				if err := hooks.response(jsonResp); err != nil {
+					logger.WithError(err).Error("Failed to process target API response")
+					c.JSON(http.StatusBadGateway, gin.H{
+						"error": gin.H{
+							"message": err.Error(),
+							"type":    "api_response_error",
+							"code":    "response_error",
+						},
+					})
+					return
+				}
+			}
+			if resp.StatusCode == http.StatusOK {
+				recordTokenUsage(c, jsonResp)
+				setUsageAttributes(span, jsonResp)
+			}
+			// The body is re-encoded, so the upstream length no longer applies
+			c.Writer.Header().Del("Content-Length")
 			c.JSON(resp.StatusCode, jsonResp)
 			return
 		}
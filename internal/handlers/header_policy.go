@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"go-aigateway/internal/config"
+)
+
+// defaultForwardHeaders 默认转发给上游的请求头：内容协商和幂等键
+var defaultForwardHeaders = []string{
+	"accept",
+	"accept-language",
+	"content-type",
+	"idempotency-key",
+	"x-request-id",
+}
+
+// mandatoryStripHeaders 永远不会转发给上游的请求头：客户端凭证、Cookie、网关内部头和逐跳头。
+// The upstream credential is injected by the proxy after the policy is applied.
+var mandatoryStripHeaders = []string{
+	"authorization",
+	"proxy-authorization",
+	"x-api-key",
+	"api-key",
+	"cookie",
+	"x-gateway-*",
+	"x-ca-*",
+	"connection",
+	"keep-alive",
+	"proxy-connection",
+	"te",
+	"trailer",
+	"transfer-encoding",
+	"upgrade",
+}
+
+// defaultResponseHeaders 默认返回给客户端的上游响应头：请求ID和限流提示
+var defaultResponseHeaders = []string{
+	"content-type",
+	"cache-control",
+	"retry-after",
+	"request-id",
+	"x-request-id",
+	"x-ratelimit-*",
+}
+
+// mandatoryResponseStripHeaders 上游响应中永远不会返回给客户端的头
+var mandatoryResponseStripHeaders = []string{
+	"set-cookie",
+	"x-gateway-*",
+	"x-ca-*",
+	"connection",
+	"keep-alive",
+	"proxy-connection",
+	"te",
+	"trailer",
+	"transfer-encoding",
+	"upgrade",
+}
+
+// HeaderOptions 路由Actions中"headers"的配置，在全局头策略之上按路由增减
+type HeaderOptions struct {
+	Forward         []string          `json:"forward,omitempty"`          // extra request headers forwarded upstream
+	Remove          []string          `json:"remove,omitempty"`           // request headers not forwarded on this route
+	Set             map[string]string `json:"set,omitempty"`              // static request headers sent upstream
+	ResponseForward []string          `json:"response_forward,omitempty"` // extra upstream response headers returned
+	ResponseRemove  []string          `json:"response_remove,omitempty"`  // upstream response headers not returned
+}
+
+// HeaderDisposition 一次请求中每个请求头的处理结果，按头名排序
+type HeaderDisposition struct {
+	Forwarded []string `json:"forwarded"` // client headers sent upstream
+	Stripped  []string `json:"stripped"`  // removed by the mandatory strip-list
+	Dropped   []string `json:"dropped"`   // not on the allow-list or removed by the route
+	Added     []string `json:"added"`     // static headers set by the route
+}
+
+// HeaderPolicy 代理层的请求头透传/剥离策略
+type HeaderPolicy struct {
+	forward       []string
+	strip         []string
+	response      []string
+	responseStrip []string
+}
+
+// NewHeaderPolicy builds the policy from configuration; nil uses the built-in lists
+func NewHeaderPolicy(cfg *config.HeaderPolicyConfig) *HeaderPolicy {
+	p := &HeaderPolicy{
+		forward:       append([]string(nil), defaultForwardHeaders...),
+		strip:         append([]string(nil), mandatoryStripHeaders...),
+		response:      append([]string(nil), defaultResponseHeaders...),
+		responseStrip: mandatoryResponseStripHeaders,
+	}
+	if cfg == nil {
+		return p
+	}
+	if cfg.ForwardUserAgent {
+		p.forward = append(p.forward, "user-agent")
+	}
+	p.forward = append(p.forward, normalizeHeaderPatterns(cfg.ForwardHeaders)...)
+	p.strip = append(p.strip, normalizeHeaderPatterns(cfg.StripHeaders)...)
+	p.response = append(p.response, normalizeHeaderPatterns(cfg.ResponseHeaders)...)
+	return p
+}
+
+var (
+	defaultHeaderPolicyMu sync.RWMutex
+	defaultHeaderPolicy   = NewHeaderPolicy(nil)
+)
+
+// SetHeaderPolicy installs the header policy used by the proxy; nil restores the built-in lists
+func SetHeaderPolicy(p *HeaderPolicy) {
+	if p == nil {
+		p = NewHeaderPolicy(nil)
+	}
+	defaultHeaderPolicyMu.Lock()
+	defaultHeaderPolicy = p
+	defaultHeaderPolicyMu.Unlock()
+}
+
+// DefaultHeaderPolicy returns the header policy used by the proxy
+func DefaultHeaderPolicy() *HeaderPolicy {
+	defaultHeaderPolicyMu.RLock()
+	defer defaultHeaderPolicyMu.RUnlock()
+	return defaultHeaderPolicy
+}
+
+// ApplyRequest copies the client headers allowed upstream from in to out and
+// reports what happened to each one
+func (p *HeaderPolicy) ApplyRequest(in, out http.Header, opts *HeaderOptions) HeaderDisposition {
+	if opts == nil {
+		opts = &HeaderOptions{}
+	}
+	routeForward := normalizeHeaderPatterns(opts.Forward)
+	routeRemove := normalizeHeaderPatterns(opts.Remove)
+
+	disposition := HeaderDisposition{Forwarded: []string{}, Stripped: []string{}, Dropped: []string{}, Added: []string{}}
+	for key, values := range in {
+		name := strings.ToLower(key)
+		switch {
+		case matchHeader(p.strip, name):
+			disposition.Stripped = append(disposition.Stripped, key)
+		case matchHeader(routeRemove, name):
+			disposition.Dropped = append(disposition.Dropped, key)
+		case matchHeader(p.forward, name) || matchHeader(routeForward, name):
+			for _, value := range values {
+				out.Add(key, value)
+			}
+			disposition.Forwarded = append(disposition.Forwarded, key)
+		default:
+			disposition.Dropped = append(disposition.Dropped, key)
+		}
+	}
+	for key, value := range opts.Set {
+		key = http.CanonicalHeaderKey(key)
+		if matchHeader(p.strip, strings.ToLower(key)) {
+			disposition.Stripped = append(disposition.Stripped, key)
+			continue
+		}
+		out.Set(key, value)
+		disposition.Added = append(disposition.Added, key)
+	}
+
+	sort.Strings(disposition.Forwarded)
+	sort.Strings(disposition.Stripped)
+	sort.Strings(disposition.Dropped)
+	sort.Strings(disposition.Added)
+	return disposition
+}
+
+// AllowResponse reports whether an upstream response header is returned to the client
+func (p *HeaderPolicy) AllowResponse(key string, opts *HeaderOptions) bool {
+	name := strings.ToLower(key)
+	if matchHeader(p.responseStrip, name) {
+		return false
+	}
+	if opts != nil {
+		if matchHeader(normalizeHeaderPatterns(opts.ResponseRemove), name) {
+			return false
+		}
+		if matchHeader(normalizeHeaderPatterns(opts.ResponseForward), name) {
+			return true
+		}
+	}
+	return matchHeader(p.response, name)
+}
+
+// ResponseAllowList returns the response header patterns returned to clients on a route
+func (p *HeaderPolicy) ResponseAllowList(opts *HeaderOptions) []string {
+	patterns := append([]string(nil), p.response...)
+	if opts != nil {
+		patterns = append(patterns, normalizeHeaderPatterns(opts.ResponseForward)...)
+		remove := normalizeHeaderPatterns(opts.ResponseRemove)
+		kept := patterns[:0]
+		for _, pattern := range patterns {
+			if !matchHeader(remove, pattern) {
+				kept = append(kept, pattern)
+			}
+		}
+		patterns = kept
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// compileHeaderOptions validates the "headers" action of a route. Headers on
+// the mandatory strip-lists cannot be forwarded, set or returned by a route.
+func compileHeaderOptions(actions map[string]interface{}) (*HeaderOptions, error) {
+	raw, ok := actions["headers"]
+	if !ok {
+		return nil, nil
+	}
+	var opts HeaderOptions
+	data, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(data, &opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid headers action: %w", err)
+	}
+
+	requestNames := append([]string(nil), opts.Forward...)
+	for key := range opts.Set {
+		requestNames = append(requestNames, key)
+	}
+	for _, names := range [][]string{requestNames, opts.Remove, opts.ResponseForward, opts.ResponseRemove} {
+		for _, name := range names {
+			if !validHeaderPattern(name) {
+				return nil, fmt.Errorf("invalid header name %q in headers action", name)
+			}
+		}
+	}
+
+	for key := range opts.Set {
+		if strings.Contains(key, "*") {
+			return nil, fmt.Errorf("header %q in headers.set must not contain a wildcard", key)
+		}
+	}
+	for _, name := range requestNames {
+		if matchHeader(mandatoryStripHeaders, strings.ToLower(name)) || overlapsHeaderPatterns(mandatoryStripHeaders, name) {
+			return nil, fmt.Errorf("header %q is always stripped and cannot be forwarded", name)
+		}
+	}
+	for _, name := range opts.ResponseForward {
+		if matchHeader(mandatoryResponseStripHeaders, strings.ToLower(name)) || overlapsHeaderPatterns(mandatoryResponseStripHeaders, name) {
+			return nil, fmt.Errorf("response header %q is always stripped and cannot be returned", name)
+		}
+	}
+	return &opts, nil
+}
+
+// routeHeaderOptions returns the header options of the matched route, nil when
+// it has none. Routes are validated on save, so an invalid action here is ignored.
+func routeHeaderOptions(actions map[string]interface{}) *HeaderOptions {
+	opts, _ := compileHeaderOptions(actions)
+	return opts
+}
+
+func normalizeHeaderPatterns(names []string) []string {
+	var patterns []string
+	for _, name := range names {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			patterns = append(patterns, name)
+		}
+	}
+	return patterns
+}
+
+// matchHeader reports whether a lowercase header name matches any pattern;
+// a trailing "*" matches a prefix
+func matchHeader(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// overlapsHeaderPatterns reports whether a wildcard route pattern such as
+// "x-gateway-*" or "*" would cover a header on a strip-list
+func overlapsHeaderPatterns(strip []string, pattern string) bool {
+	prefix, ok := strings.CutSuffix(strings.ToLower(strings.TrimSpace(pattern)), "*")
+	if !ok {
+		return false
+	}
+	for _, stripped := range strip {
+		if strings.HasPrefix(strings.TrimSuffix(stripped, "*"), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// validHeaderPattern accepts RFC 7230 token characters with an optional trailing "*"
+func validHeaderPattern(name string) bool {
+	name = strings.TrimSuffix(strings.TrimSpace(name), "*")
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r > 0x7e || r <= ' ' || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", r) {
+			return false
+		}
+	}
+	return true
+}
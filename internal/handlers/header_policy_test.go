@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sensitiveHeaders must never reach an upstream, whatever the configuration
+var sensitiveHeaders = map[string]string{
+	"Authorization":       "Bearer client-key",
+	"Proxy-Authorization": "Basic abc",
+	"X-Api-Key":           "client-key",
+	"Cookie":              "session=secret",
+	"X-Ca-Key":            "aliyun-key",
+	"X-Ca-Signature":      "signature",
+	"X-Gateway-Internal":  "spoofed",
+}
+
+func setupHeaderRouter(t *testing.T, cfg *config.HeaderPolicyConfig) (*gin.Engine, *http.Header) {
+	gin.SetMode(gin.TestMode)
+
+	received := &http.Header{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*received = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-ID", "upstream-req-1")
+		w.Header().Set("X-RateLimit-Remaining-Requests", "99")
+		w.Header().Set("Set-Cookie", "provider=internal")
+		w.Header().Set("X-Dashscope-Node", "node-17")
+		w.Header().Set("X-Gateway-Mocked", "true")
+		w.Write([]byte(`{"id":"chatcmpl-1"}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	SetHeaderPolicy(NewHeaderPolicy(cfg))
+	t.Cleanup(func() { SetHeaderPolicy(nil) })
+
+	h := NewServiceHandler()
+	router := gin.New()
+	router.Use(h.RouteActionsMiddleware())
+	router.POST("/v1/chat/completions", ChatCompletions(&config.Config{TargetURL: upstream.URL, TargetKey: "upstream-key"}))
+	RegisterServiceRoutes(router, h)
+	return router, received
+}
+
+func sendWithHeaders(router *gin.Engine, headers map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4"}`))
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestHeaderPolicyNeverForwardsSensitiveHeaders(t *testing.T) {
+	// Even a configuration trying to forward them cannot override the strip-list
+	router, received := setupHeaderRouter(t, &config.HeaderPolicyConfig{
+		ForwardHeaders: []string{"Cookie", "X-Ca-*"},
+	})
+
+	headers := map[string]string{
+		"Idempotency-Key": "idem-1",
+		"Accept":          "application/json",
+		"User-Agent":      "client-sdk/1.0",
+		"X-Internal-Team": "search",
+	}
+	for key, value := range sensitiveHeaders {
+		headers[key] = value
+	}
+	w := sendWithHeaders(router, headers)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	for key := range sensitiveHeaders {
+		if key == "Authorization" {
+			continue
+		}
+		assert.Empty(t, received.Get(key), key)
+	}
+	assert.Equal(t, "Bearer upstream-key", received.Get("Authorization"))
+	assert.Equal(t, "idem-1", received.Get("Idempotency-Key"))
+	assert.Equal(t, "application/json", received.Get("Accept"))
+	assert.Empty(t, received.Get("X-Internal-Team"))
+	assert.NotEqual(t, "client-sdk/1.0", received.Get("User-Agent"), "user agent is opt-in")
+
+	// Only allow-listed upstream response headers reach the client
+	assert.Equal(t, "upstream-req-1", w.Header().Get("X-Request-ID"))
+	assert.Equal(t, "99", w.Header().Get("X-RateLimit-Remaining-Requests"))
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+	assert.Empty(t, w.Header().Get("X-Dashscope-Node"))
+	assert.Empty(t, w.Header().Get("X-Gateway-Mocked"))
+}
+
+func TestHeaderPolicyConfiguredHeaders(t *testing.T) {
+	router, received := setupHeaderRouter(t, &config.HeaderPolicyConfig{
+		ForwardUserAgent: true,
+		ForwardHeaders:   []string{"X-Internal-*"},
+		StripHeaders:     []string{"X-Internal-Secret"},
+		ResponseHeaders:  []string{"X-Dashscope-Node"},
+	})
+
+	w := sendWithHeaders(router, map[string]string{
+		"User-Agent":        "client-sdk/1.0",
+		"X-Internal-Team":   "search",
+		"X-Internal-Secret": "s3cret",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "client-sdk/1.0", received.Get("User-Agent"))
+	assert.Equal(t, "search", received.Get("X-Internal-Team"))
+	assert.Empty(t, received.Get("X-Internal-Secret"))
+	assert.Equal(t, "node-17", w.Header().Get("X-Dashscope-Node"))
+}
+
+func TestHeaderPolicyRouteActions(t *testing.T) {
+	router, received := setupHeaderRouter(t, nil)
+	w := postJSON(router, "/api/v1/routes", `{"name":"chat","path":"/v1/chat/completions","method":"POST","enabled":true,
+		"actions":{"headers":{
+			"forward":["X-Tenant-ID"],
+			"remove":["Idempotency-Key"],
+			"set":{"X-DashScope-WorkSpace":"ws-1"},
+			"response_forward":["X-Dashscope-Node"],
+			"response_remove":["X-Request-ID"]
+		}}}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = sendWithHeaders(router, map[string]string{
+		"X-Tenant-ID":     "tenant-a",
+		"Idempotency-Key": "idem-1",
+		"Cookie":          "session=secret",
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "tenant-a", received.Get("X-Tenant-ID"))
+	assert.Equal(t, "ws-1", received.Get("X-DashScope-WorkSpace"))
+	assert.Empty(t, received.Get("Idempotency-Key"))
+	assert.Empty(t, received.Get("Cookie"))
+	assert.Equal(t, "node-17", w.Header().Get("X-Dashscope-Node"))
+	assert.Empty(t, w.Header().Get("X-Request-ID"))
+}
+
+func TestHeaderPolicyRejectsRoutesForwardingStrippedHeaders(t *testing.T) {
+	router, _ := setupHeaderRouter(t, nil)
+
+	for _, headers := range []string{
+		`{"forward":["Cookie"]}`,
+		`{"forward":["x-gateway-*"]}`,
+		`{"set":{"Authorization":"Bearer other"}}`,
+		`{"set":{"X-Ca-*":"v"}}`,
+		`{"response_forward":["Set-Cookie"]}`,
+		`{"forward":["bad header"]}`,
+	} {
+		w := postJSON(router, "/api/v1/routes", `{"name":"r","path":"/x","enabled":true,"actions":{"headers":`+headers+`}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, headers)
+		assert.Contains(t, w.Body.String(), "INVALID_SCHEMA", headers)
+	}
+}
+
+func TestTraceRouteShowsHeaderDisposition(t *testing.T) {
+	router, _ := setupHeaderRouter(t, nil)
+	w := postJSON(router, "/api/v1/routes", `{"name":"chat","path":"/v1/chat/completions","method":"POST","enabled":true,
+		"actions":{"headers":{"forward":["X-Tenant-ID"],"set":{"X-DashScope-WorkSpace":"ws-1"}}}}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = postJSON(router, "/api/v1/routes/trace", `{"method":"POST","path":"/v1/chat/completions","headers":{
+		"X-Tenant-ID":"tenant-a","Authorization":"Bearer k","X-Ca-Key":"k","Accept":"*/*","X-Debug":"1"}}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Data RouteTrace `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Data.Matched)
+	assert.Equal(t, "chat", resp.Data.RouteName)
+	assert.Equal(t, HeaderDisposition{
+		Forwarded: []string{"Accept", "X-Tenant-Id"},
+		Stripped:  []string{"Authorization", "X-Ca-Key"},
+		Dropped:   []string{"X-Debug"},
+		Added:     []string{"X-Dashscope-Workspace"},
+	}, resp.Data.RequestHeaders)
+	assert.Contains(t, resp.Data.ResponseHeaders, "x-ratelimit-*")
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultKeyEventCount = 50
+	maxKeyEventCount     = 1000
+	maxKeyEventBlock     = 30 * time.Second
+)
+
+// streamIDPattern matches Redis stream entry IDs such as "1718000000000-0"
+var streamIDPattern = regexp.MustCompile(`^\d+(-\d+)?$`)
+
+// GetKeyEvents returns API key lifecycle events after ?from=<stream-id>. The
+// ID of the last event is the from value of the next page; ?block=<ms> waits
+// for new events when none are pending.
+func GetKeyEvents(stream *security.KeyEventStream) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from := c.DefaultQuery("from", "0")
+		count, countErr := strconv.ParseInt(c.DefaultQuery("count", strconv.Itoa(defaultKeyEventCount)), 10, 64)
+		blockMs, blockErr := strconv.Atoi(c.DefaultQuery("block", "0"))
+		if (from != "$" && !streamIDPattern.MatchString(from)) || countErr != nil || count <= 0 || blockErr != nil || blockMs < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "from must be a stream ID, count a positive integer and block a non-negative number of milliseconds",
+					"type":    "invalid_request_error",
+					"code":    "invalid_parameter",
+				},
+			})
+			return
+		}
+		if count > maxKeyEventCount {
+			count = maxKeyEventCount
+		}
+		block := time.Duration(blockMs) * time.Millisecond
+		if block > maxKeyEventBlock {
+			block = maxKeyEventBlock
+		}
+
+		events, err := stream.Read(c.Request.Context(), from, count, block)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to read API key events")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": "Failed to read API key events",
+					"type":    "internal_server_error",
+					"code":    "key_events_failed",
+				},
+			})
+			return
+		}
+
+		next := from
+		if len(events) > 0 {
+			next = events[len(events)-1].ID
+		}
+		c.JSON(http.StatusOK, gin.H{"events": events, "next": next})
+	}
+}
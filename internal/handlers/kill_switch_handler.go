@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	defaultKillSwitchesMu sync.RWMutex
+	defaultKillSwitches   *middleware.KillSwitches
+)
+
+// SetKillSwitches installs the kill switches consulted when selecting an upstream; nil disables them
+func SetKillSwitches(ks *middleware.KillSwitches) {
+	defaultKillSwitchesMu.Lock()
+	defaultKillSwitches = ks
+	defaultKillSwitchesMu.Unlock()
+}
+
+// DefaultKillSwitches returns the kill switches consulted by the proxy, or nil
+func DefaultKillSwitches() *middleware.KillSwitches {
+	defaultKillSwitchesMu.RLock()
+	defer defaultKillSwitchesMu.RUnlock()
+	return defaultKillSwitches
+}
+
+func killSwitchError(c *gin.Context, err error) {
+	status, errType, code := http.StatusInternalServerError, "internal_server_error", "storage_error"
+	switch {
+	case errors.Is(err, middleware.ErrInvalidKillSwitch):
+		status, errType, code = http.StatusBadRequest, "validation_error", "invalid_kill_switch"
+	case errors.Is(err, middleware.ErrKillSwitchSameAdmin):
+		status, errType, code = http.StatusConflict, "permission_error", "confirmation_required"
+	case errors.Is(err, middleware.ErrKillSwitchNotFound):
+		status, errType, code = http.StatusNotFound, "invalid_request_error", "kill_switch_not_found"
+	}
+	c.JSON(status, gin.H{
+		"error": gin.H{
+			"message": err.Error(),
+			"type":    errType,
+			"code":    code,
+		},
+	})
+}
+
+// ArmKillSwitch requests a kill switch, confirms a pending request or renews
+// an active switch. param names the path parameter holding the target.
+func ArmKillSwitch(ks *middleware.KillSwitches, scope, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			Reason   string `json:"reason"`
+			Duration string `json:"duration"` // e.g. "2h", capped at the configured maximum
+		}
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&request); err != nil {
+				killSwitchError(c, middleware.ErrInvalidKillSwitch)
+				return
+			}
+		}
+		var duration time.Duration
+		if request.Duration != "" {
+			parsed, err := time.ParseDuration(request.Duration)
+			if err != nil || parsed <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": gin.H{
+						"message": "duration must be a positive duration such as \"2h\"",
+						"type":    "validation_error",
+						"code":    "invalid_duration",
+					},
+				})
+				return
+			}
+			duration = parsed
+		}
+
+		sw, change, err := ks.Arm(c.Request.Context(), scope, c.Param(param), c.GetString("user_id"), request.Reason, duration)
+		if err != nil {
+			killSwitchError(c, err)
+			return
+		}
+		status := http.StatusOK
+		if change == middleware.KillSwitchRequested {
+			// Nothing is blocked until a second admin confirms
+			status = http.StatusAccepted
+		}
+		c.JSON(status, gin.H{
+			"status": change,
+			"switch": sw,
+		})
+	}
+}
+
+// LiftKillSwitch deactivates a kill switch or withdraws a pending request
+func LiftKillSwitch(ks *middleware.KillSwitches, scope, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sw, err := ks.Lift(c.Request.Context(), scope, c.Param(param), c.GetString("user_id"))
+		if err != nil {
+			killSwitchError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status": middleware.KillSwitchLifted,
+			"switch": sw,
+		})
+	}
+}
+
+// ListKillSwitches returns the active and pending kill switches
+func ListKillSwitches(ks *middleware.KillSwitches) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switches, err := ks.List(c.Request.Context())
+		if err != nil {
+			killSwitchError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"switches": switches})
+	}
+}
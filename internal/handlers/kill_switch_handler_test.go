@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/monitoring"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type killSwitchAlerts struct {
+	mu     sync.Mutex
+	firing map[string]bool
+}
+
+func (a *killSwitchAlerts) EvaluateRule(_ context.Context, rule *monitoring.Rule, _ float64, firing bool) {
+	a.mu.Lock()
+	a.firing[rule.ID] = firing
+	a.mu.Unlock()
+}
+
+func (a *killSwitchAlerts) isFiring(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.firing[id]
+}
+
+var testKillSwitchConfig = config.KillSwitchConfig{
+	ConfirmWindow:   time.Minute,
+	MaxDuration:     4 * time.Hour,
+	TwoPersonRule:   true,
+	RefreshInterval: time.Hour, // changes must arrive through the invalidation channel
+}
+
+// setupKillSwitchReplica builds one gateway replica: the admin routes, which
+// take the admin from the X-Admin header, and a tenant-protected endpoint
+func setupKillSwitchReplica(t *testing.T, client *redis.Client, alerts middleware.KillSwitchAlertSink) (*gin.Engine, *middleware.KillSwitches) {
+	gin.SetMode(gin.TestMode)
+	ks := middleware.NewKillSwitches(client, testKillSwitchConfig, nil, alerts)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go ks.Start(ctx)
+
+	r := gin.New()
+	admin := r.Group("/api/v1/admin/kill", func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-Admin")) })
+	admin.GET("", ListKillSwitches(ks))
+	admin.POST("/tenant/:id", ArmKillSwitch(ks, middleware.KillScopeTenant, "id"))
+	admin.DELETE("/tenant/:id", LiftKillSwitch(ks, middleware.KillScopeTenant, "id"))
+	admin.POST("/provider/:label", ArmKillSwitch(ks, middleware.KillScopeProvider, "label"))
+
+	protected := r.Group("/v1", ks.Middleware(nil))
+	protected.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r, ks
+}
+
+func killRequest(r *gin.Engine, method, path, admin, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	if body != "" {
+		req = httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("X-Admin", admin)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func pingAs(r *gin.Engine, tenant string) int {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/ping", nil)
+	req.Header.Set("X-Tenant-ID", tenant)
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func newKillSwitchRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+func TestKillSwitchPropagatesToOtherReplicas(t *testing.T) {
+	mr, client := newKillSwitchRedis(t)
+	a, _ := setupKillSwitchReplica(t, client, nil)
+	b, _ := setupKillSwitchReplica(t, client, nil)
+	require.Eventually(t, func() bool {
+		return mr.PubSubNumSub(middleware.KillSwitchChannel)[middleware.KillSwitchChannel] == 2
+	}, time.Second, 10*time.Millisecond)
+
+	require.Equal(t, http.StatusAccepted, killRequest(a, http.MethodPost, "/api/v1/admin/kill/tenant/acme", "alice", `{"reason":"leaked keys"}`).Code)
+	// A request alone blocks nothing
+	assert.Equal(t, http.StatusOK, pingAs(b, "acme"))
+
+	// Confirmed on replica B, enforced on replica A within the propagation budget
+	start := time.Now()
+	require.Equal(t, http.StatusOK, killRequest(b, http.MethodPost, "/api/v1/admin/kill/tenant/acme", "bob", "").Code)
+	assert.Equal(t, http.StatusForbidden, pingAs(b, "acme"))
+	require.Eventually(t, func() bool { return pingAs(a, "acme") == http.StatusForbidden }, 2*time.Second, 5*time.Millisecond)
+	t.Logf("kill switch reached the other replica after %s", time.Since(start))
+	assert.Equal(t, http.StatusOK, pingAs(a, "globex"))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/v1/ping", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	a.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), `"code":"emergency_lockout"`)
+
+	// Lifting propagates the same way
+	require.Equal(t, http.StatusOK, killRequest(a, http.MethodDelete, "/api/v1/admin/kill/tenant/acme", "alice", "").Code)
+	require.Eventually(t, func() bool { return pingAs(b, "acme") == http.StatusOK }, 2*time.Second, 5*time.Millisecond)
+	assert.Equal(t, http.StatusNotFound, killRequest(a, http.MethodDelete, "/api/v1/admin/kill/tenant/acme", "alice", "").Code)
+}
+
+func TestKillSwitchConfirmationFlow(t *testing.T) {
+	mr, client := newKillSwitchRedis(t)
+	alerts := &killSwitchAlerts{firing: make(map[string]bool)}
+	r, _ := setupKillSwitchReplica(t, client, alerts)
+
+	assert.Equal(t, http.StatusBadRequest, killRequest(r, http.MethodPost, "/api/v1/admin/kill/tenant/acme", "alice", `{"duration":"soon"}`).Code)
+
+	require.Equal(t, http.StatusAccepted, killRequest(r, http.MethodPost, "/api/v1/admin/kill/tenant/acme", "alice", "").Code)
+	// The requester cannot confirm their own request
+	w := killRequest(r, http.MethodPost, "/api/v1/admin/kill/tenant/acme", "alice", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, http.StatusOK, pingAs(r, "acme"))
+
+	// An unconfirmed request lapses after the confirmation window
+	mr.FastForward(2 * time.Minute)
+	w = killRequest(r, http.MethodPost, "/api/v1/admin/kill/tenant/acme", "bob", "")
+	require.Equal(t, http.StatusAccepted, w.Code, "a lapsed request starts over")
+
+	w = killRequest(r, http.MethodPost, "/api/v1/admin/kill/tenant/acme", "alice", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var armed struct {
+		Status string                `json:"status"`
+		Switch middleware.KillSwitch `json:"switch"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &armed))
+	assert.Equal(t, middleware.KillSwitchActivated, armed.Status)
+	assert.Equal(t, "bob", armed.Switch.RequestedBy)
+	assert.Equal(t, "alice", armed.Switch.ConfirmedBy)
+	assert.True(t, alerts.isFiring("kill_switch_tenant_acme"))
+
+	// Another call on an active switch renews it
+	w = killRequest(r, http.MethodPost, "/api/v1/admin/kill/tenant/acme", "carol", `{"duration":"1h"}`)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &armed))
+	assert.Equal(t, middleware.KillSwitchRenewed, armed.Status)
+
+	w = killRequest(r, http.MethodGet, "/api/v1/admin/kill", "carol", "")
+	assert.Contains(t, w.Body.String(), `"target":"acme"`)
+
+	require.Equal(t, http.StatusOK, killRequest(r, http.MethodDelete, "/api/v1/admin/kill/tenant/acme", "carol", "").Code)
+	assert.False(t, alerts.isFiring("kill_switch_tenant_acme"))
+	assert.Equal(t, http.StatusOK, pingAs(r, "acme"))
+}
+
+func TestKilledProviderFailsOrFallsBack(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	ks := middleware.NewKillSwitches(nil, testKillSwitchConfig, nil, nil)
+	SetKillSwitches(ks)
+	t.Cleanup(func() { SetKillSwitches(nil) })
+	ctx := context.Background()
+	_, _, err := ks.Arm(ctx, middleware.KillScopeProvider, "openai", "alice", "leaked key", 0)
+	require.NoError(t, err)
+	_, _, err = ks.Arm(ctx, middleware.KillScopeProvider, "openai", "bob", "", 0)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/chat/completions", ChatCompletions(&config.Config{TargetURL: upstream.URL}))
+	w := postJSON(r, "/v1/chat/completions", `{"model":"gpt-4o","messages":[]}`)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"provider_lockout"`)
+
+	_, err = ks.Lift(ctx, middleware.KillScopeProvider, "openai", "alice")
+	require.NoError(t, err)
+	w = postJSON(r, "/v1/chat/completions", `{"model":"gpt-4o","messages":[]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
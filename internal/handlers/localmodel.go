@@ -78,6 +78,7 @@ func (h *LocalModelHandler) LocalChatCompletions() gin.HandlerFunc {
 			return
 		}
 
+		recordLocalUsage(c, response.Model, response.Usage.PromptTokens, response.Usage.CompletionTokens, response.Usage.TotalTokens)
 		c.JSON(http.StatusOK, response)
 	}
 }
@@ -135,56 +136,28 @@ func (h *LocalModelHandler) LocalCompletions() gin.HandlerFunc {
 			return
 		}
 
+		recordLocalUsage(c, response.Model, response.Usage.PromptTokens, response.Usage.CompletionTokens, response.Usage.TotalTokens)
 		c.JSON(http.StatusOK, response)
 	}
 }
 
+// recordLocalUsage charges and tracks the usage of a local model response like
+// that of an upstream response
+func recordLocalUsage(c *gin.Context, model string, promptTokens, completionTokens, totalTokens int) {
+	recordTokenUsage(c, map[string]interface{}{
+		"model": model,
+		"usage": map[string]interface{}{
+			"prompt_tokens":     float64(promptTokens),
+			"completion_tokens": float64(completionTokens),
+			"total_tokens":      float64(totalTokens),
+		},
+	})
+}
+
 // LocalEmbeddings handles requests to the local embeddings API
 func (h *LocalModelHandler) LocalEmbeddings() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Read request body
-		body, err := io.ReadAll(c.Request.Body)
-		if err != nil {
-			logrus.WithError(err).Error("Failed to read request body")
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": gin.H{
-					"message": "Failed to read request body",
-					"type":    "invalid_request_error",
-					"code":    "bad_request",
-				},
-			})
-			return
-		}
-
-		// Parse request
-		var request localmodel.EmbeddingRequest
-		if err := json.Unmarshal(body, &request); err != nil {
-			logrus.WithError(err).Error("Failed to parse request body")
-			c.JSON(http.StatusBadRequest, gin.H{
-				"error": gin.H{
-					"message": "Failed to parse request body",
-					"type":    "invalid_request_error",
-					"code":    "bad_request",
-				},
-			})
-			return
-		}
-
-		// Call local model
-		response, err := h.manager.GetServer().Embedding(c.Request.Context(), &request)
-		if err != nil {
-			logrus.WithError(err).Error("Failed to call local model")
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": gin.H{
-					"message": "Failed to call local model",
-					"type":    "internal_server_error",
-					"code":    "local_model_error",
-				},
-			})
-			return
-		}
-
-		c.JSON(http.StatusOK, response)
+		serveLocalEmbeddings(c, h.manager.GetServer())
 	}
 }
 
@@ -209,6 +182,13 @@ func (h *LocalModelHandler) LocalModels() gin.HandlerFunc {
 	}
 }
 
+// LocalStatus returns the supervision status of the local model server process
+func (h *LocalModelHandler) LocalStatus() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, h.manager.Status())
+	}
+}
+
 // RegisterLocalModelRoutes registers the local model routes
 func RegisterLocalModelRoutes(r *gin.Engine, handler *LocalModelHandler) {
 	// Local model routes
@@ -217,4 +197,5 @@ func RegisterLocalModelRoutes(r *gin.Engine, handler *LocalModelHandler) {
 	localModel.POST("/completions", handler.LocalCompletions())
 	localModel.POST("/embeddings", handler.LocalEmbeddings())
 	localModel.GET("/models", handler.LocalModels())
+	localModel.GET("/status", handler.LocalStatus())
 }
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/localmodel"
+	"go-aigateway/internal/logging"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckpointIDHeader carries the checkpoint ID of a checkpointed generation.
+// Clients may choose the ID up front so they can resume even if the
+// connection drops before any response arrives.
+const CheckpointIDHeader = "X-Checkpoint-ID"
+
+// LocalModelCheckpointHandler serves checkpointed local model generations
+type LocalModelCheckpointHandler struct {
+	checkpointer *localmodel.InferenceCheckpointer
+	config       *config.LocalModelConfig
+}
+
+// NewLocalModelCheckpointHandler creates a new checkpointed generation handler
+func NewLocalModelCheckpointHandler(checkpointer *localmodel.InferenceCheckpointer, cfg *config.LocalModelConfig) *LocalModelCheckpointHandler {
+	return &LocalModelCheckpointHandler{
+		checkpointer: checkpointer,
+		config:       cfg,
+	}
+}
+
+func checkpointError(c *gin.Context, err error) {
+	status, errType, code := http.StatusBadRequest, "invalid_request_error", "invalid_parameter"
+	message := err.Error()
+	switch {
+	case errors.Is(err, localmodel.ErrCheckpointNotFound):
+		status, code = http.StatusNotFound, "checkpoint_not_found"
+	case errors.Is(err, localmodel.ErrCheckpointExists):
+		status, code = http.StatusConflict, "checkpoint_exists"
+	case errors.Is(err, localmodel.ErrInvalidCheckpointID):
+		// 400 invalid_parameter
+	default:
+		logging.FromContext(c).WithError(err).Error("Checkpointed generation failed")
+		status, errType, code = http.StatusBadGateway, "api_error", "local_model_error"
+		message = "Checkpointed generation did not complete; resume it with the checkpoint ID"
+	}
+	c.JSON(status, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    errType,
+			"code":    code,
+		},
+	})
+}
+
+// Generate starts a checkpointed chat generation
+func (h *LocalModelCheckpointHandler) Generate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request localmodel.ChatCompletionRequest
+		if err := c.ShouldBindJSON(&request); err != nil || len(request.Messages) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "Request must be a chat completion with messages",
+					"type":    "invalid_request_error",
+					"code":    "bad_request",
+				},
+			})
+			return
+		}
+		if request.Temperature == 0 {
+			request.Temperature = h.config.Temperature
+		}
+
+		id := c.GetHeader(CheckpointIDHeader)
+		if id == "" {
+			id = localmodel.NewCheckpointID()
+		}
+		c.Header(CheckpointIDHeader, id)
+
+		response, err := h.checkpointer.Generate(c.Request.Context(), DefaultModelCaller(c).KeyID, id, &request)
+		if err != nil {
+			checkpointError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// Resume continues a checkpointed generation from its last checkpoint
+func (h *LocalModelCheckpointHandler) Resume() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("checkpointID")
+		c.Header(CheckpointIDHeader, id)
+		response, err := h.checkpointer.Resume(c.Request.Context(), DefaultModelCaller(c).KeyID, id)
+		if err != nil {
+			checkpointError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// GetCheckpoint returns the state of a checkpointed generation
+func (h *LocalModelCheckpointHandler) GetCheckpoint() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		meta, err := h.checkpointer.Get(c.Request.Context(), DefaultModelCaller(c).KeyID, c.Param("checkpointID"))
+		if err != nil {
+			checkpointError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, meta)
+	}
+}
+
+// RegisterLocalModelCheckpointRoutes registers the checkpointed generation routes
+func RegisterLocalModelCheckpointRoutes(r *gin.Engine, handler *LocalModelCheckpointHandler, source config.Source, localAuth *security.LocalAuthenticator) {
+	local := r.Group("/api/v1/local")
+	local.Use(middleware.APIKeyAuth(source, localAuth))
+	local.POST("/generate", handler.Generate())
+	local.POST("/resume/:checkpointID", handler.Resume())
+	local.GET("/checkpoints/:checkpointID", handler.GetCheckpoint())
+}
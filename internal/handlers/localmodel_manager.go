@@ -255,9 +255,16 @@ func (h *LocalModelManagerHandler) GetModelStatus() gin.HandlerFunc {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
+		response := gin.H{
 			"status": status,
-		})
+		}
+		// Requested vs effective size after the hardware check
+		if h.manager != nil {
+			if selection := h.manager.GetServer().SizeSelection(); selection != nil {
+				response["size"] = selection
+			}
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"go-aigateway/internal/logging"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LogLevelRequest 临时调整日志级别的请求；duration_seconds 为空时默认15分钟
+type LogLevelRequest struct {
+	Level       string `json:"level" binding:"required"`
+	DurationSec int    `json:"duration_seconds"`
+}
+
+// GetLogLevel reports the current log level and when a temporary change reverts
+func GetLogLevel(lc *logging.LevelController) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, lc.Status())
+	}
+}
+
+// UpdateLogLevel changes the log level for a limited time
+func UpdateLogLevel(lc *logging.LevelController, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req LogLevelRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "level is required",
+					"type":    "invalid_request_error",
+					"code":    "invalid_parameter",
+				},
+			})
+			return
+		}
+
+		status, err := lc.Set(req.Level, time.Duration(req.DurationSec)*time.Second)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "invalid_request_error",
+					"code":    "invalid_parameter",
+				},
+			})
+			return
+		}
+
+		audit.LogWithContext(c.Request.Context(), &security.AuditEvent{
+			Type:      "log_level",
+			Action:    "update",
+			Resource:  "/api/v1/admin/log-level",
+			UserID:    c.GetString("user_id"),
+			RemoteIP:  c.ClientIP(),
+			UserAgent: c.GetHeader("User-Agent"),
+			Details:   map[string]interface{}{"level": status.Level, "revert_at": status.RevertAt},
+		})
+		c.JSON(http.StatusOK, status)
+	}
+}
+
+// ResetLogLevel reverts a temporary change right away
+func ResetLogLevel(lc *logging.LevelController, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := lc.Reset()
+		audit.LogWithContext(c.Request.Context(), &security.AuditEvent{
+			Type:      "log_level",
+			Action:    "reset",
+			Resource:  "/api/v1/admin/log-level",
+			UserID:    c.GetString("user_id"),
+			RemoteIP:  c.ClientIP(),
+			UserAgent: c.GetHeader("User-Agent"),
+			Details:   map[string]interface{}{"level": status.Level},
+		})
+		c.JSON(http.StatusOK, status)
+	}
+}
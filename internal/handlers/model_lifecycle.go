@@ -0,0 +1,531 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/flags"
+	"go-aigateway/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// ModelLifecycleInvalidationChannel is the Redis channel used to propagate lifecycle changes between replicas
+const ModelLifecycleInvalidationChannel = "models:lifecycle:invalidate"
+
+// deprecatedUsageKeyPrefix prefixes the Redis hashes counting deprecated model calls per key
+const deprecatedUsageKeyPrefix = "gw:models:deprecated_usage:"
+
+// Model lifecycle states
+const (
+	ModelStateActive     = "active"
+	ModelStateDeprecated = "deprecated"
+	ModelStateRetired    = "retired"
+)
+
+// What to do with requests for retired models
+const (
+	RetiredPolicyMigrate = "migrate"
+	RetiredPolicyReject  = "reject"
+)
+
+// ModelLifecycle 模型生命周期状态：已弃用的模型仍可调用但返回告警头，已下线的模型按配置迁移到替代模型或拒绝
+type ModelLifecycle struct {
+	Model       string    `json:"model"`
+	State       string    `json:"state"`
+	SunsetDate  string    `json:"sunset_date,omitempty"` // YYYY-MM-DD
+	Replacement string    `json:"replacement,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate checks a lifecycle definition
+func (l *ModelLifecycle) Validate() error {
+	if strings.TrimSpace(l.Model) == "" {
+		return fmt.Errorf("model is required")
+	}
+	switch l.State {
+	case ModelStateActive, ModelStateDeprecated, ModelStateRetired:
+	default:
+		return fmt.Errorf("state must be %q, %q or %q", ModelStateActive, ModelStateDeprecated, ModelStateRetired)
+	}
+	if l.SunsetDate != "" {
+		if _, err := time.Parse(time.DateOnly, l.SunsetDate); err != nil {
+			return fmt.Errorf("sunset_date must be a YYYY-MM-DD date")
+		}
+	}
+	if l.Replacement == l.Model {
+		return fmt.Errorf("a model cannot replace itself")
+	}
+	return nil
+}
+
+// ModelCaller identifies who is calling a model
+type ModelCaller struct {
+	KeyID         string   // reported in the deprecation report
+	AllowedModels []string // models the caller may use, empty allows any
+}
+
+// allows reports whether the caller may use a model
+func (c ModelCaller) allows(model string) bool {
+	if len(c.AllowedModels) == 0 {
+		return true
+	}
+	for _, allowed := range c.AllowedModels {
+		if allowed == model {
+			return true
+		}
+	}
+	return false
+}
+
+// ModelCallerResolver derives the caller of a request
+type ModelCallerResolver func(c *gin.Context) ModelCaller
+
+// DefaultModelCaller identifies callers by the fingerprint of their bearer token
+func DefaultModelCaller(c *gin.Context) ModelCaller {
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if token == "" {
+		return ModelCaller{KeyID: "anonymous"}
+	}
+	return ModelCaller{KeyID: flags.KeyFingerprint(token)}
+}
+
+// DeprecationUsage 弃用报告中一个模型的调用统计
+type DeprecationUsage struct {
+	Model       string           `json:"model"`
+	SunsetDate  string           `json:"sunset_date,omitempty"`
+	Replacement string           `json:"replacement,omitempty"`
+	Total       int64            `json:"total"`
+	Keys        map[string]int64 `json:"keys"`
+}
+
+// ModelLifecycleRegistry 模型生命周期登记，定义持久化到存储并通过失效通知在实例间同步
+type ModelLifecycleRegistry struct {
+	mu            sync.RWMutex
+	models        map[string]*ModelLifecycle
+	usage         map[string]map[string]int64 // used without Redis
+	store         storage.Store
+	redisClient   *redis.Client
+	instanceID    string
+	retiredPolicy string
+	resolveCaller ModelCallerResolver
+}
+
+// NewModelLifecycleRegistry creates a registry. store and redisClient are optional; without
+// a store definitions live in memory, without Redis changes and usage stay on this instance.
+func NewModelLifecycleRegistry(store storage.Store, redisClient *redis.Client, retiredPolicy string) *ModelLifecycleRegistry {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &ModelLifecycleRegistry{
+		models:        make(map[string]*ModelLifecycle),
+		usage:         make(map[string]map[string]int64),
+		store:         store,
+		redisClient:   redisClient,
+		instanceID:    hex.EncodeToString(id),
+		retiredPolicy: retiredPolicy,
+		resolveCaller: DefaultModelCaller,
+	}
+}
+
+// SetCallerResolver replaces how the key ID and model allow-list of a request are found
+func (r *ModelLifecycleRegistry) SetCallerResolver(resolve ModelCallerResolver) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resolveCaller = resolve
+}
+
+// Load replaces the in-memory definitions with those in the store
+func (r *ModelLifecycleRegistry) Load(ctx context.Context) error {
+	if r.store == nil {
+		return nil
+	}
+
+	records, err := r.store.List(ctx, storage.BucketModelLifecycle)
+	if err != nil {
+		return fmt.Errorf("failed to load model lifecycles: %w", err)
+	}
+
+	models := make(map[string]*ModelLifecycle, len(records))
+	for name, data := range records {
+		var lifecycle ModelLifecycle
+		if err := json.Unmarshal(data, &lifecycle); err != nil {
+			logrus.WithError(err).WithField("model", name).Warn("Skipping unreadable model lifecycle")
+			continue
+		}
+		models[lifecycle.Model] = &lifecycle
+	}
+
+	r.mu.Lock()
+	r.models = models
+	r.mu.Unlock()
+	return nil
+}
+
+// List returns all lifecycle definitions sorted by model
+func (r *ModelLifecycleRegistry) List() []ModelLifecycle {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]ModelLifecycle, 0, len(r.models))
+	for _, lifecycle := range r.models {
+		result = append(result, *lifecycle)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Model < result[j].Model })
+	return result
+}
+
+// Get returns the lifecycle of a model; unregistered models are active
+func (r *ModelLifecycleRegistry) Get(model string) ModelLifecycle {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if lifecycle, ok := r.models[model]; ok {
+		return *lifecycle
+	}
+	return ModelLifecycle{Model: model, State: ModelStateActive}
+}
+
+// Put validates, persists and publishes a lifecycle definition
+func (r *ModelLifecycleRegistry) Put(ctx context.Context, lifecycle ModelLifecycle) (ModelLifecycle, error) {
+	if err := lifecycle.Validate(); err != nil {
+		return ModelLifecycle{}, err
+	}
+	if lifecycle.Replacement != "" {
+		if replacement := r.Get(lifecycle.Replacement); replacement.State == ModelStateRetired {
+			return ModelLifecycle{}, fmt.Errorf("replacement %s is itself retired", lifecycle.Replacement)
+		}
+	}
+	lifecycle.UpdatedAt = time.Now().UTC()
+
+	if r.store != nil {
+		data, err := json.Marshal(lifecycle)
+		if err != nil {
+			return ModelLifecycle{}, err
+		}
+		if err := r.store.Put(ctx, storage.BucketModelLifecycle, lifecycle.Model, data); err != nil {
+			return ModelLifecycle{}, fmt.Errorf("failed to persist model lifecycle: %w", err)
+		}
+	}
+
+	r.mu.Lock()
+	r.models[lifecycle.Model] = &lifecycle
+	r.mu.Unlock()
+	r.invalidate(ctx)
+	return lifecycle, nil
+}
+
+// Delete returns a model to the active state, reporting whether it had a definition
+func (r *ModelLifecycleRegistry) Delete(ctx context.Context, model string) (bool, error) {
+	r.mu.RLock()
+	_, exists := r.models[model]
+	r.mu.RUnlock()
+	if !exists {
+		return false, nil
+	}
+
+	if r.store != nil {
+		if err := r.store.Delete(ctx, storage.BucketModelLifecycle, model); err != nil {
+			return false, fmt.Errorf("failed to delete model lifecycle: %w", err)
+		}
+	}
+
+	r.mu.Lock()
+	delete(r.models, model)
+	r.mu.Unlock()
+	r.invalidate(ctx)
+	return true, nil
+}
+
+func (r *ModelLifecycleRegistry) invalidate(ctx context.Context) {
+	if r.redisClient == nil {
+		return
+	}
+	if err := r.redisClient.Publish(ctx, ModelLifecycleInvalidationChannel, r.instanceID).Err(); err != nil {
+		logrus.WithError(err).Warn("Failed to publish model lifecycle invalidation")
+	}
+}
+
+// StartInvalidationListener reloads definitions when another replica changes them
+func (r *ModelLifecycleRegistry) StartInvalidationListener(ctx context.Context) {
+	if r.redisClient == nil || r.store == nil {
+		return
+	}
+
+	pubsub := r.redisClient.Subscribe(ctx, ModelLifecycleInvalidationChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			if msg.Payload == r.instanceID {
+				continue
+			}
+			if err := r.Load(ctx); err != nil {
+				logrus.WithError(err).Warn("Failed to reload model lifecycles after invalidation")
+			}
+		}
+	}
+}
+
+// recordDeprecatedUse counts a call to a deprecated model by a key
+func (r *ModelLifecycleRegistry) recordDeprecatedUse(ctx context.Context, model, keyID string) {
+	if r.redisClient != nil {
+		if err := r.redisClient.HIncrBy(ctx, deprecatedUsageKeyPrefix+model, keyID, 1).Err(); err != nil {
+			logrus.WithError(err).Warn("Failed to count deprecated model usage")
+		}
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.usage[model] == nil {
+		r.usage[model] = make(map[string]int64)
+	}
+	r.usage[model][keyID]++
+}
+
+// DeprecationReport returns per-key call counts of every deprecated or retired model
+func (r *ModelLifecycleRegistry) DeprecationReport(ctx context.Context) ([]DeprecationUsage, error) {
+	report := []DeprecationUsage{}
+	for _, lifecycle := range r.List() {
+		if lifecycle.State == ModelStateActive {
+			continue
+		}
+		usage := DeprecationUsage{
+			Model:       lifecycle.Model,
+			SunsetDate:  lifecycle.SunsetDate,
+			Replacement: lifecycle.Replacement,
+			Keys:        make(map[string]int64),
+		}
+
+		if r.redisClient != nil {
+			counts, err := r.redisClient.HGetAll(ctx, deprecatedUsageKeyPrefix+lifecycle.Model).Result()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read deprecated model usage: %w", err)
+			}
+			for keyID, count := range counts {
+				n, _ := strconv.ParseInt(count, 10, 64)
+				usage.Keys[keyID] = n
+			}
+		} else {
+			r.mu.RLock()
+			for keyID, n := range r.usage[lifecycle.Model] {
+				usage.Keys[keyID] = n
+			}
+			r.mu.RUnlock()
+		}
+
+		for _, n := range usage.Keys {
+			usage.Total += n
+		}
+		report = append(report, usage)
+	}
+	return report, nil
+}
+
+// modelsCompatible reports whether a request for one model can be served by another
+func modelsCompatible(request map[string]interface{}, from, to string) bool {
+	if HasImageContent(request) && !ModelSupportsVision(to) {
+		return false
+	}
+	registry := GetThirdPartyModelInfo()
+	fromInfo, fromKnown := registry[from]
+	toInfo, toKnown := registry[to]
+	if !fromKnown || !toKnown || fromInfo.ModelType == toInfo.ModelType {
+		return true
+	}
+	// Multimodal models also serve text-only chat
+	return fromInfo.ModelType == "chat" && toInfo.ModelType == "multimodal"
+}
+
+// modelRetiredError answers a request for a retired model that is not migrated
+func modelRetiredError(c *gin.Context, lifecycle ModelLifecycle, reason string) {
+	message := fmt.Sprintf("Model %s has been retired", lifecycle.Model)
+	if lifecycle.Replacement != "" {
+		message += fmt.Sprintf("; use %s instead", lifecycle.Replacement)
+	}
+	if reason != "" {
+		message += " (" + reason + ")"
+	}
+	errBody := gin.H{
+		"message": message,
+		"type":    "invalid_request_error",
+		"code":    "model_retired",
+	}
+	if lifecycle.Replacement != "" {
+		errBody["replacement"] = lifecycle.Replacement
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": errBody})
+}
+
+// Apply enforces the lifecycle of the requested model. It returns the model
+// the request should be sent to, and false when it already answered the request.
+func (r *ModelLifecycleRegistry) Apply(c *gin.Context, request map[string]interface{}, model string) (string, bool) {
+	lifecycle := r.Get(model)
+	switch lifecycle.State {
+	case ModelStateDeprecated:
+		c.Header("X-Model-Deprecated", "true")
+		if lifecycle.Replacement != "" {
+			c.Header("X-Model-Replacement", lifecycle.Replacement)
+		}
+		if lifecycle.SunsetDate != "" {
+			c.Header("X-Model-Sunset", lifecycle.SunsetDate)
+		}
+		r.mu.RLock()
+		resolve := r.resolveCaller
+		r.mu.RUnlock()
+		r.recordDeprecatedUse(c.Request.Context(), model, resolve(c).KeyID)
+		return model, true
+
+	case ModelStateRetired:
+		if r.retiredPolicy != RetiredPolicyMigrate || lifecycle.Replacement == "" {
+			modelRetiredError(c, lifecycle, "")
+			return "", false
+		}
+		r.mu.RLock()
+		resolve := r.resolveCaller
+		r.mu.RUnlock()
+		caller := resolve(c)
+		if !caller.allows(lifecycle.Replacement) {
+			modelRetiredError(c, lifecycle, "the replacement is not allowed for this API key")
+			return "", false
+		}
+		if !modelsCompatible(request, model, lifecycle.Replacement) {
+			modelRetiredError(c, lifecycle, "the replacement does not support this request")
+			return "", false
+		}
+
+		r.recordDeprecatedUse(c.Request.Context(), model, caller.KeyID)
+		request["model"] = lifecycle.Replacement
+		c.Header("X-Model-Retired", "true")
+		c.Header("X-Model-Migrated-From", model)
+		c.Header("X-Model-Replacement", lifecycle.Replacement)
+		logrus.WithFields(logrus.Fields{
+			"model":       model,
+			"replacement": lifecycle.Replacement,
+		}).Info("Migrated request for retired model")
+		return lifecycle.Replacement, true
+	}
+	return model, true
+}
+
+var (
+	defaultModelLifecycleMu sync.RWMutex
+	defaultModelLifecycle   *ModelLifecycleRegistry
+)
+
+// SetModelLifecycle installs the registry consulted by the proxy; nil disables lifecycle checks
+func SetModelLifecycle(r *ModelLifecycleRegistry) {
+	defaultModelLifecycleMu.Lock()
+	defaultModelLifecycle = r
+	defaultModelLifecycleMu.Unlock()
+}
+
+// DefaultModelLifecycle returns the installed registry, or nil
+func DefaultModelLifecycle() *ModelLifecycleRegistry {
+	defaultModelLifecycleMu.RLock()
+	defer defaultModelLifecycleMu.RUnlock()
+	return defaultModelLifecycle
+}
+
+// ListModelLifecycles returns all lifecycle definitions
+func ListModelLifecycles(r *ModelLifecycleRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"models": r.List()})
+	}
+}
+
+// PutModelLifecycle sets the lifecycle state of the model named in the path
+func PutModelLifecycle(r *ModelLifecycleRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var lifecycle ModelLifecycle
+		if err := c.ShouldBindJSON(&lifecycle); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "Invalid request format",
+					"type":    "validation_error",
+					"code":    "invalid_format",
+				},
+			})
+			return
+		}
+		lifecycle.Model = c.Param("model")
+
+		saved, err := r.Put(c.Request.Context(), lifecycle)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "validation_error",
+					"code":    "invalid_lifecycle",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"model": saved})
+	}
+}
+
+// DeleteModelLifecycle returns the model named in the path to the active state
+func DeleteModelLifecycle(r *ModelLifecycleRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deleted, err := r.Delete(c.Request.Context(), c.Param("model"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "internal_server_error",
+					"code":    "lifecycle_delete_failed",
+				},
+			})
+			return
+		}
+		if !deleted {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{
+					"message": "Model has no lifecycle definition",
+					"type":    "not_found_error",
+					"code":    "lifecycle_not_found",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Model lifecycle removed"})
+	}
+}
+
+// GetDeprecationReport returns per-key usage of deprecated and retired models
+func GetDeprecationReport(r *ModelLifecycleRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := r.DeprecationReport(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "internal_server_error",
+					"code":    "deprecation_report_failed",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"models": report})
+	}
+}
@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/storage"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupLifecycleRouter proxies chat completions to an upstream recording the requested model
+func setupLifecycleRouter(t *testing.T, registry *ModelLifecycleRegistry) (*gin.Engine, func() string) {
+	gin.SetMode(gin.TestMode)
+
+	var mu sync.Mutex
+	var lastModel string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		lastModel, _ = body["model"].(string)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	SetModelLifecycle(registry)
+	t.Cleanup(func() { SetModelLifecycle(nil) })
+
+	router := gin.New()
+	router.POST("/v1/chat/completions", ChatCompletions(&config.Config{TargetURL: upstream.URL, MaxImageSizeMB: 20}))
+	return router, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return lastModel
+	}
+}
+
+func lifecycleChat(router *gin.Engine, apiKey string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func textRequest(model string) map[string]interface{} {
+	return map[string]interface{}{
+		"model":    model,
+		"messages": []interface{}{map[string]interface{}{"role": "user", "content": "hi"}},
+	}
+}
+
+func TestModelLifecycleDeprecated(t *testing.T) {
+	registry := NewModelLifecycleRegistry(nil, nil, RetiredPolicyReject)
+	_, err := registry.Put(context.Background(), ModelLifecycle{
+		Model:       "qwen-1.8b-chat",
+		State:       ModelStateDeprecated,
+		SunsetDate:  "2026-12-31",
+		Replacement: "qwen-turbo",
+	})
+	require.NoError(t, err)
+	router, upstreamModel := setupLifecycleRouter(t, registry)
+
+	w := lifecycleChat(router, "key-a", textRequest("qwen-1.8b-chat"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "qwen-1.8b-chat", upstreamModel())
+	assert.Equal(t, "true", w.Header().Get("X-Model-Deprecated"))
+	assert.Equal(t, "qwen-turbo", w.Header().Get("X-Model-Replacement"))
+	assert.Equal(t, "2026-12-31", w.Header().Get("X-Model-Sunset"))
+
+	lifecycleChat(router, "key-a", textRequest("qwen-1.8b-chat"))
+	lifecycleChat(router, "key-b", textRequest("qwen-1.8b-chat"))
+
+	// Active models carry no lifecycle headers
+	w = lifecycleChat(router, "key-a", textRequest("qwen-turbo"))
+	assert.Empty(t, w.Header().Get("X-Model-Deprecated"))
+
+	report, err := registry.DeprecationReport(context.Background())
+	require.NoError(t, err)
+	require.Len(t, report, 1)
+	assert.Equal(t, int64(3), report[0].Total)
+	assert.Len(t, report[0].Keys, 2)
+}
+
+func TestModelLifecycleRetiredReject(t *testing.T) {
+	registry := NewModelLifecycleRegistry(nil, nil, RetiredPolicyReject)
+	_, err := registry.Put(context.Background(), ModelLifecycle{Model: "qwen-1.8b-chat", State: ModelStateRetired, Replacement: "qwen-turbo"})
+	require.NoError(t, err)
+	router, upstreamModel := setupLifecycleRouter(t, registry)
+
+	w := lifecycleChat(router, "key-a", textRequest("qwen-1.8b-chat"))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"model_retired"`)
+	assert.Contains(t, w.Body.String(), `"replacement":"qwen-turbo"`)
+	assert.Empty(t, upstreamModel())
+}
+
+func TestModelLifecycleRetiredMigrate(t *testing.T) {
+	registry := NewModelLifecycleRegistry(nil, nil, RetiredPolicyMigrate)
+	ctx := context.Background()
+	_, err := registry.Put(ctx, ModelLifecycle{Model: "qwen-1.8b-chat", State: ModelStateRetired, Replacement: "qwen-turbo"})
+	require.NoError(t, err)
+	_, err = registry.Put(ctx, ModelLifecycle{Model: "qwen-vl-v1", State: ModelStateRetired, Replacement: "qwen-turbo"})
+	require.NoError(t, err)
+	_, err = registry.Put(ctx, ModelLifecycle{Model: "qwen-old", State: ModelStateRetired})
+	require.NoError(t, err)
+	router, upstreamModel := setupLifecycleRouter(t, registry)
+
+	w := lifecycleChat(router, "key-a", textRequest("qwen-1.8b-chat"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "qwen-turbo", upstreamModel())
+	assert.Equal(t, "qwen-1.8b-chat", w.Header().Get("X-Model-Migrated-From"))
+	assert.Equal(t, "qwen-turbo", w.Header().Get("X-Model-Replacement"))
+
+	// A vision request is never migrated to a text-only model
+	image := "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("small image"))
+	w = lifecycleChat(router, "key-a", visionRequest("qwen-vl-v1", image))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "model_retired")
+	assert.Contains(t, w.Body.String(), "does not support this request")
+
+	// Without a replacement there is nothing to migrate to
+	w = lifecycleChat(router, "key-a", textRequest("qwen-old"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestModelLifecycleMigrationRespectsAllowList(t *testing.T) {
+	registry := NewModelLifecycleRegistry(nil, nil, RetiredPolicyMigrate)
+	_, err := registry.Put(context.Background(), ModelLifecycle{Model: "qwen-1.8b-chat", State: ModelStateRetired, Replacement: "qwen-turbo"})
+	require.NoError(t, err)
+	registry.SetCallerResolver(func(c *gin.Context) ModelCaller {
+		caller := DefaultModelCaller(c)
+		if c.GetHeader("Authorization") == "Bearer restricted" {
+			caller.AllowedModels = []string{"qwen-1.8b-chat", "qwen-max"}
+		}
+		return caller
+	})
+	router, upstreamModel := setupLifecycleRouter(t, registry)
+
+	w := lifecycleChat(router, "restricted", textRequest("qwen-1.8b-chat"))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "not allowed for this API key")
+	assert.Empty(t, upstreamModel())
+
+	w = lifecycleChat(router, "unrestricted", textRequest("qwen-1.8b-chat"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "qwen-turbo", upstreamModel())
+}
+
+func TestModelLifecycleValidation(t *testing.T) {
+	registry := NewModelLifecycleRegistry(nil, nil, RetiredPolicyMigrate)
+	ctx := context.Background()
+
+	for _, lifecycle := range []ModelLifecycle{
+		{Model: "a", State: "sunset"},
+		{Model: "a", State: ModelStateDeprecated, SunsetDate: "31/12/2026"},
+		{Model: "a", State: ModelStateRetired, Replacement: "a"},
+	} {
+		_, err := registry.Put(ctx, lifecycle)
+		assert.Error(t, err, lifecycle)
+	}
+
+	_, err := registry.Put(ctx, ModelLifecycle{Model: "b", State: ModelStateRetired})
+	require.NoError(t, err)
+	_, err = registry.Put(ctx, ModelLifecycle{Model: "a", State: ModelStateRetired, Replacement: "b"})
+	assert.ErrorContains(t, err, "itself retired")
+}
+
+func TestModelLifecycleInvalidationBus(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := storage.NewRedisStore(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writer := NewModelLifecycleRegistry(store, client, RetiredPolicyReject)
+	reader := NewModelLifecycleRegistry(store, client, RetiredPolicyReject)
+	go reader.StartInvalidationListener(ctx)
+	// Wait for the subscription before publishing
+	require.Eventually(t, func() bool {
+		return len(mr.PubSubChannels("")) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	_, err := writer.Put(ctx, ModelLifecycle{Model: "qwen-1.8b-chat", State: ModelStateDeprecated})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return reader.Get("qwen-1.8b-chat").State == ModelStateDeprecated
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = writer.Delete(ctx, "qwen-1.8b-chat")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return reader.Get("qwen-1.8b-chat").State == ModelStateActive
+	}, time.Second, 10*time.Millisecond)
+}
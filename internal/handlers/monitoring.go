@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -9,6 +11,7 @@ import (
 	"go-aigateway/internal/autoscaler"
 	"go-aigateway/internal/middleware"
 	"go-aigateway/internal/monitoring"
+	"go-aigateway/internal/performance"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
@@ -21,6 +24,10 @@ type MonitoringHandler struct {
 	monitoringSystem *monitoring.MonitoringSystem
 	autoScaler       *autoscaler.AutoScaler
 	rateLimiter      *middleware.RedisRateLimiter
+	capacityPools    *middleware.CapacityPools
+	stream           *monitoring.StreamHub
+	requestShapes    *RequestShapeAnalytics
+	loadBalancer     *performance.PerformanceOptimizer
 }
 
 // NewMonitoringHandler 创建监控处理器
@@ -40,6 +47,85 @@ func NewMonitoringHandler(
 	}
 }
 
+// SetCapacityPools 在仪表板摘要中展示容量池占用
+func (h *MonitoringHandler) SetCapacityPools(pools *middleware.CapacityPools) {
+	h.capacityPools = pools
+}
+
+// SetStreamHub 启用可断点续传的实时事件流
+func (h *MonitoringHandler) SetStreamHub(hub *monitoring.StreamHub) {
+	h.stream = hub
+}
+
+// SetRequestShapes 启用请求形态分布查询，并在仪表板摘要中展示最近24小时的分布
+func (h *MonitoringHandler) SetRequestShapes(ra *RequestShapeAnalytics) {
+	h.requestShapes = ra
+}
+
+// SetLoadBalancer 启用负载均衡后端及其延迟均值的查询
+func (h *MonitoringHandler) SetLoadBalancer(po *performance.PerformanceOptimizer) {
+	h.loadBalancer = po
+}
+
+// streamHeartbeat keeps idle SSE connections open through proxies
+const streamHeartbeat = 15 * time.Second
+
+// StreamEvents 以SSE推送实时指标和告警。重连的客户端通过Last-Event-ID头或resume_token参数
+// 补收断开期间的事件；位置已过期时收到resync事件，需要重新加载状态。
+func (h *MonitoringHandler) StreamEvents(c *gin.Context) {
+	resume := c.GetHeader("Last-Event-ID")
+	if resume == "" {
+		resume = c.Query("resume_token")
+	}
+	var lastID int64
+	if resume != "" {
+		id, err := strconv.ParseInt(resume, 10, 64)
+		if err != nil || id < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid Last-Event-ID or resume_token",
+			})
+			return
+		}
+		lastID = id
+	}
+
+	sub := h.stream.Subscribe(lastID)
+	defer h.stream.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprint(c.Writer, "retry: 2000\n\n")
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": keepalive\n\n")
+			c.Writer.Flush()
+		case event, ok := <-sub.C:
+			if !ok {
+				// Dropped or shutting down; the client reconnects and resumes
+				return
+			}
+			data := event.Data
+			if event.Type == monitoring.StreamEventResync {
+				data, _ = json.Marshal(gin.H{"reason": "resume position no longer retained", "resume_token": event.ID})
+			}
+			fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+			c.Writer.Flush()
+		}
+	}
+}
+
 // GetMetrics 获取实时指标
 func (h *MonitoringHandler) GetMetrics(c *gin.Context) {
 	ctx := context.Background()
@@ -282,6 +368,35 @@ func (h *MonitoringHandler) GetSystemStatus(c *gin.Context) {
 	})
 }
 
+// GetBackends 获取负载均衡后端的状态与延迟指数加权均值，键为后端URL
+func (h *MonitoringHandler) GetBackends(c *gin.Context) {
+	if h.loadBalancer == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"error":   "Load balancer is not available",
+		})
+		return
+	}
+
+	backends := make(map[string]interface{})
+	for _, backend := range h.loadBalancer.Backends() {
+		backends[backend.URL] = map[string]interface{}{
+			"latency_ewma_ms": float64(backend.LatencyEWMA) / float64(time.Millisecond),
+			"active":          backend.Active,
+			"health_score":    backend.HealthScore,
+			"weight":          backend.Weight,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": map[string]interface{}{
+			"backends": backends,
+			"count":    len(backends),
+		},
+	})
+}
+
 // GetDashboardStats 获取仪表板统计数据
 func (h *MonitoringHandler) GetDashboardStats(c *gin.Context) {
 	ctx := context.Background()
@@ -330,6 +445,18 @@ func (h *MonitoringHandler) GetDashboardStats(c *gin.Context) {
 		"status":          "healthy",
 	}
 
+	if h.capacityPools != nil {
+		if usage, err := h.capacityPools.Usage(ctx); err == nil && usage != nil {
+			dashboardStats["capacityPools"] = usage
+		}
+	}
+
+	if h.requestShapes != nil {
+		if report, err := h.requestShapes.Report(ctx, 24*time.Hour, ""); err == nil {
+			dashboardStats["requestShapes"] = report
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data":    dashboardStats,
@@ -371,5 +498,11 @@ func RegisterMonitoringRoutes(r *gin.Engine, handler *MonitoringHandler) {
 		monitoring.GET("/scaling/history", handler.GetScalingHistory)
 		monitoring.GET("/system/status", handler.GetSystemStatus)
 		monitoring.GET("/dashboard/stats", handler.GetDashboardStats)
+		if handler.stream != nil {
+			monitoring.GET("/stream", handler.StreamEvents)
+		}
+		if handler.requestShapes != nil {
+			monitoring.GET("/request-shapes", handler.GetRequestShapes)
+		}
 	}
 }
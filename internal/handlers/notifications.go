@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/monitoring"
+
+	"github.com/gin-gonic/gin"
+)
+
+// notificationChannelSettings 一个通知渠道的配置；读取时只报告是否设置了密钥
+type notificationChannelSettings struct {
+	URL       *string `json:"url,omitempty"`
+	Secret    *string `json:"secret,omitempty"`
+	MinLevel  *string `json:"min_level,omitempty"`
+	HasSecret bool    `json:"has_secret"`
+}
+
+// notificationSettings is the body of GET and PUT /api/v1/monitoring/notifications;
+// fields missing from a PUT keep their current value
+type notificationSettings struct {
+	Webhook       *notificationChannelSettings `json:"webhook,omitempty"`
+	DingTalk      *notificationChannelSettings `json:"dingtalk,omitempty"`
+	MaxRetries    *int                         `json:"max_retries,omitempty"`
+	RetryBackoff  *string                      `json:"retry_backoff,omitempty"` // Go duration, e.g. "2s"
+	RatePerMinute *int                         `json:"rate_per_minute,omitempty"`
+}
+
+func channelSettings(channel config.NotificationChannelConfig) *notificationChannelSettings {
+	return &notificationChannelSettings{
+		URL:       &channel.URL,
+		MinLevel:  &channel.MinLevel,
+		HasSecret: channel.Secret != "",
+	}
+}
+
+// apply overrides the fields present in the request
+func (s *notificationChannelSettings) apply(channel *config.NotificationChannelConfig) {
+	if s == nil {
+		return
+	}
+	if s.URL != nil {
+		channel.URL = *s.URL
+	}
+	if s.Secret != nil {
+		channel.Secret = *s.Secret
+	}
+	if s.MinLevel != nil {
+		channel.MinLevel = *s.MinLevel
+	}
+}
+
+func notificationResponse(cfg config.AlertNotificationConfig) notificationSettings {
+	backoff := cfg.RetryBackoff.String()
+	return notificationSettings{
+		Webhook:       channelSettings(cfg.Webhook),
+		DingTalk:      channelSettings(cfg.DingTalk),
+		MaxRetries:    &cfg.MaxRetries,
+		RetryBackoff:  &backoff,
+		RatePerMinute: &cfg.RatePerMinute,
+	}
+}
+
+// GetNotifications 返回当前的告警通知渠道配置，不包含密钥
+func GetNotifications(ms *monitoring.MonitoringSystem) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    notificationResponse(ms.NotificationConfig()),
+		})
+	}
+}
+
+// UpdateNotifications 覆盖告警通知渠道配置，请求中缺少的字段保持不变；
+// 清空 url 即停用该渠道。覆盖在重启前一直有效。
+func UpdateNotifications(ms *monitoring.MonitoringSystem) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request notificationSettings
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   "Invalid request body: " + err.Error(),
+			})
+			return
+		}
+
+		cfg := ms.NotificationConfig()
+		request.Webhook.apply(&cfg.Webhook)
+		request.DingTalk.apply(&cfg.DingTalk)
+		if request.MaxRetries != nil {
+			cfg.MaxRetries = *request.MaxRetries
+		}
+		if request.RetryBackoff != nil {
+			backoff, err := time.ParseDuration(*request.RetryBackoff)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"error":   "retry_backoff must be a duration such as 2s",
+				})
+				return
+			}
+			cfg.RetryBackoff = backoff
+		}
+		if request.RatePerMinute != nil {
+			cfg.RatePerMinute = *request.RatePerMinute
+		}
+
+		if err := ms.UpdateNotifications(cfg); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    notificationResponse(cfg),
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// OIDCLoginResponse OIDC登录成功后返回的网关凭证
+type OIDCLoginResponse struct {
+	LoginResponse
+	SessionID string `json:"session_id"`
+	UserID    string `json:"user_id"`
+}
+
+// OIDCAuthorize redirects the user agent to the identity provider with a PKCE challenge
+func OIDCAuthorize(oidcAuth *security.OIDCAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		url, err := oidcAuth.AuthorizeURL(c.Request.Context())
+		if err != nil {
+			logrus.WithError(err).Error("Failed to start OIDC authorization")
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": gin.H{
+					"message": "Identity provider unavailable",
+					"type":    "authentication_error",
+					"code":    "oidc_unavailable",
+				},
+			})
+			return
+		}
+		c.Redirect(http.StatusFound, url)
+	}
+}
+
+// OIDCCallback exchanges the authorization code and issues a gateway JWT
+func OIDCCallback(oidcAuth *security.OIDCAuthenticator, tokenExpiresIn int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if providerErr := c.Query("error"); providerErr != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{
+					"message": "Authorization denied by identity provider: " + providerErr,
+					"type":    "authentication_error",
+					"code":    "oidc_denied",
+				},
+			})
+			return
+		}
+
+		state, code := c.Query("state"), c.Query("code")
+		if state == "" || code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "state and code are required",
+					"type":    "validation_error",
+					"code":    "invalid_callback",
+				},
+			})
+			return
+		}
+
+		result, err := oidcAuth.HandleCallback(c.Request.Context(), state, code, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			logrus.WithError(err).Warn("OIDC callback failed")
+			code := "oidc_login_failed"
+			if errors.Is(err, security.ErrUnknownState) {
+				code = "invalid_state"
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{
+					"message": "OIDC login failed",
+					"type":    "authentication_error",
+					"code":    code,
+				},
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, OIDCLoginResponse{
+			LoginResponse: LoginResponse{
+				Token:     result.Token,
+				ExpiresIn: tokenExpiresIn,
+				TokenType: "Bearer",
+			},
+			SessionID: result.Session.ID,
+			UserID:    result.User.ID,
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-aigateway/internal/performance"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCircuitBreakers 返回每个服务熔断器的状态与失败次数，便于排查请求被拒绝的原因
+func GetCircuitBreakers(po *performance.PerformanceOptimizer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		breakers := po.CircuitBreakers()
+		c.JSON(http.StatusOK, gin.H{
+			"circuit_breakers": breakers,
+			"total":            len(breakers),
+		})
+	}
+}
+
+// FlushCache 清除响应缓存；带 prefix 参数时只清除请求路径以其开头的条目
+func FlushCache(po *performance.PerformanceOptimizer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		prefix := c.Query("prefix")
+		flushed, err := po.InvalidateCache(c.Request.Context(), prefix)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": "Failed to flush response cache: " + err.Error(),
+					"type":    "internal_server_error",
+					"code":    "cache_flush_failed",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"flushed": flushed,
+			"prefix":  prefix,
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/performance"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCircuitBreakers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	po := performance.NewPerformanceOptimizer(&config.Config{}, nil)
+
+	r := gin.New()
+	r.GET("/api/v1/performance/circuit-breakers", GetCircuitBreakers(po))
+	upstream := r.Group("/upstream", func(c *gin.Context) { c.Set("service_name", "dashscope") }, po.CircuitBreakerMiddleware())
+	upstream.GET("", func(c *gin.Context) { c.Status(http.StatusBadGateway) })
+
+	for i := 0; i < 5; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/upstream", nil))
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/upstream", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/performance/circuit-breakers", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		CircuitBreakers []performance.CircuitBreakerStatus `json:"circuit_breakers"`
+		Total           int                                `json:"total"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, 1, resp.Total)
+	assert.Equal(t, "dashscope", resp.CircuitBreakers[0].Service)
+	assert.Equal(t, "open", resp.CircuitBreakers[0].State)
+	assert.Equal(t, int64(5), resp.CircuitBreakers[0].FailureCount)
+	assert.NotNil(t, resp.CircuitBreakers[0].LastFailure)
+}
+
+func TestMonitoringHandlerGetBackends(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	po := performance.NewPerformanceOptimizer(&config.Config{}, nil)
+	po.AddBackend("http://upstream-a", 2)
+	h := NewMonitoringHandler(nil, nil, nil, nil, nil)
+
+	r := gin.New()
+	r.GET("/api/v1/admin/backends", h.GetBackends)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/backends", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	h.SetLoadBalancer(po)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/backends", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data struct {
+			Backends map[string]struct {
+				LatencyEWMAMs float64 `json:"latency_ewma_ms"`
+				Active        bool    `json:"active"`
+				Weight        int     `json:"weight"`
+			} `json:"backends"`
+			Count int `json:"count"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Data.Count)
+	backend := resp.Data.Backends["http://upstream-a"]
+	assert.True(t, backend.Active)
+	assert.Equal(t, 2, backend.Weight)
+	assert.Zero(t, backend.LatencyEWMAMs)
+}
+
+func TestFlushCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	po := performance.NewPerformanceOptimizer(&config.Config{}, nil)
+
+	r := gin.New()
+	r.DELETE("/api/v1/cache", FlushCache(po))
+	cached := r.Group("", po.IntelligentCachingMiddleware(0))
+	for _, path := range []string{"/api/v1/models", "/api/v1/models/qwen-max", "/api/v1/stats"} {
+		cached.GET(path, func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	flush := func(target string) map[string]interface{} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, target, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+	resp := flush("/api/v1/cache?prefix=/api/v1/models")
+	assert.Equal(t, float64(2), resp["flushed"])
+	assert.Equal(t, "/api/v1/models", resp["prefix"])
+	assert.Equal(t, float64(1), flush("/api/v1/cache")["flushed"])
+	assert.Equal(t, float64(0), flush("/api/v1/cache")["flushed"])
+}
@@ -0,0 +1,1107 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/flags"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/security"
+	"go-aigateway/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// PromptInvalidationChannel is the Redis channel used to propagate prompt template changes between replicas
+const PromptInvalidationChannel = "prompts:invalidate"
+
+// promptVersionClaimPrefix prefixes the Redis keys claiming a version number, so two
+// replicas creating a template at once cannot both write the same version
+const promptVersionClaimPrefix = "gw:prompts:version:"
+
+// PromptLatest selects the newest active version of a template
+const PromptLatest = "latest"
+
+var promptNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,63}$`)
+
+var (
+	// ErrPromptNotFound is returned for unknown template names and versions
+	ErrPromptNotFound = errors.New("prompt template not found")
+	// ErrPromptRetired is returned when a retired version is referenced or recreated
+	ErrPromptRetired = errors.New("prompt template version is retired")
+	// ErrPromptReferenced is returned when retiring a version that is still in use
+	ErrPromptReferenced = errors.New("prompt template version is still referenced")
+	// ErrInvalidPrompt is returned for malformed templates, references, pins and rollouts
+	ErrInvalidPrompt = errors.New("invalid prompt template")
+)
+
+// PromptTemplate 提示模板的一个不可变版本，按正文哈希寻址；正文变化即产生新版本
+type PromptTemplate struct {
+	Name        string     `json:"name"`
+	Version     int        `json:"version"`
+	Hash        string     `json:"hash"` // sha256 of the body
+	Body        string     `json:"body"`
+	Description string     `json:"description,omitempty"`
+	CreatedBy   string     `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+	RetiredBy   string     `json:"retired_by,omitempty"`
+}
+
+// Ref returns the exact name@version reference of the template
+func (t *PromptTemplate) Ref() string {
+	return t.Name + "@" + strconv.Itoa(t.Version)
+}
+
+// PromptRollout 同名模板两个版本之间的百分比灰度，复用特性开关的分桶算法
+type PromptRollout struct {
+	Name       string    `json:"name"`
+	Stable     int       `json:"stable"`
+	Candidate  int       `json:"candidate"`
+	Percentage int       `json:"percentage"` // share of keys served the candidate, 0-100
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// PromptPin 租户固定使用某个模板版本
+type PromptPin struct {
+	Tenant    string    `json:"tenant"`
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PromptRef is a parsed name@version or name@latest reference; Version 0 means latest
+type PromptRef struct {
+	Name    string
+	Version int
+}
+
+// ParsePromptRef parses name@version, name@latest or a bare name, which means latest
+func ParsePromptRef(ref string) (PromptRef, error) {
+	name, version, found := strings.Cut(strings.TrimSpace(ref), "@")
+	if !promptNamePattern.MatchString(name) {
+		return PromptRef{}, fmt.Errorf("%w: reference %q needs a name of lowercase letters, digits, '_', '.' or '-'", ErrInvalidPrompt, ref)
+	}
+	if !found || version == PromptLatest {
+		return PromptRef{Name: name}, nil
+	}
+	n, err := strconv.Atoi(version)
+	if err != nil || n < 1 {
+		return PromptRef{}, fmt.Errorf("%w: reference %q must end in @latest or a positive version", ErrInvalidPrompt, ref)
+	}
+	return PromptRef{Name: name, Version: n}, nil
+}
+
+// String renders the reference in name@version form
+func (r PromptRef) String() string {
+	if r.Version == 0 {
+		return r.Name + "@" + PromptLatest
+	}
+	return r.Name + "@" + strconv.Itoa(r.Version)
+}
+
+// PromptReferrer lists the template references a consumer currently uses
+type PromptReferrer func(ctx context.Context) ([]string, error)
+
+// AppliedPrompt identifies the exact template version applied to a request
+type AppliedPrompt struct {
+	Ref  string `json:"ref"`
+	Hash string `json:"hash"`
+}
+
+// PromptSummary 模板名下的版本概况
+type PromptSummary struct {
+	Name     string         `json:"name"`
+	Latest   int            `json:"latest"` // newest active version, 0 if all are retired
+	Versions int            `json:"versions"`
+	Rollout  *PromptRollout `json:"rollout,omitempty"`
+}
+
+// PromptStore 版本化的提示模板库：持久化到存储，缓存在内存并通过失效通知在实例间同步
+type PromptStore struct {
+	mu        sync.RWMutex
+	templates map[string][]*PromptTemplate // name -> versions, index version-1
+	rollouts  map[string]*PromptRollout
+	pins      map[string]map[string]int // tenant -> name -> version
+	referrers []PromptReferrer
+
+	store       storage.Store
+	redisClient *redis.Client
+	instanceID  string
+	audit       *security.AuditLogger
+	now         func() time.Time
+}
+
+// NewPromptStore creates a prompt store. store and redisClient are optional; without
+// a store templates live in memory, without Redis changes stay on this instance.
+// Applied template versions of AI requests are written to audit when it is set.
+func NewPromptStore(store storage.Store, redisClient *redis.Client, audit *security.AuditLogger) *PromptStore {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	return &PromptStore{
+		templates:   make(map[string][]*PromptTemplate),
+		rollouts:    make(map[string]*PromptRollout),
+		pins:        make(map[string]map[string]int),
+		store:       store,
+		redisClient: redisClient,
+		instanceID:  hex.EncodeToString(id),
+		audit:       audit,
+		now:         time.Now,
+	}
+}
+
+// AddReferrer registers a consumer whose references block retiring the versions they use
+func (ps *PromptStore) AddReferrer(referrer PromptReferrer) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.referrers = append(ps.referrers, referrer)
+}
+
+// Load replaces the in-memory templates, rollouts and pins with those in the store
+func (ps *PromptStore) Load(ctx context.Context) error {
+	if ps.store == nil {
+		return nil
+	}
+
+	records, err := ps.store.List(ctx, storage.BucketPromptTemplates)
+	if err != nil {
+		return fmt.Errorf("failed to load prompt templates: %w", err)
+	}
+	templates := make(map[string][]*PromptTemplate)
+	for key, data := range records {
+		var t PromptTemplate
+		if err := json.Unmarshal(data, &t); err != nil || t.Version < 1 {
+			logrus.WithError(err).WithField("template", key).Warn("Skipping unreadable prompt template")
+			continue
+		}
+		versions := templates[t.Name]
+		for len(versions) < t.Version {
+			versions = append(versions, nil)
+		}
+		versions[t.Version-1] = &t
+		templates[t.Name] = versions
+	}
+
+	records, err = ps.store.List(ctx, storage.BucketPromptRollouts)
+	if err != nil {
+		return fmt.Errorf("failed to load prompt rollouts: %w", err)
+	}
+	rollouts := make(map[string]*PromptRollout, len(records))
+	for name, data := range records {
+		var rollout PromptRollout
+		if err := json.Unmarshal(data, &rollout); err != nil {
+			logrus.WithError(err).WithField("template", name).Warn("Skipping unreadable prompt rollout")
+			continue
+		}
+		rollouts[rollout.Name] = &rollout
+	}
+
+	records, err = ps.store.List(ctx, storage.BucketPromptPins)
+	if err != nil {
+		return fmt.Errorf("failed to load prompt pins: %w", err)
+	}
+	pins := make(map[string]map[string]int)
+	for key, data := range records {
+		var pin PromptPin
+		if err := json.Unmarshal(data, &pin); err != nil {
+			logrus.WithError(err).WithField("pin", key).Warn("Skipping unreadable prompt pin")
+			continue
+		}
+		if pins[pin.Tenant] == nil {
+			pins[pin.Tenant] = make(map[string]int)
+		}
+		pins[pin.Tenant][pin.Name] = pin.Version
+	}
+
+	ps.mu.Lock()
+	ps.templates = templates
+	ps.rollouts = rollouts
+	ps.pins = pins
+	ps.mu.Unlock()
+	return nil
+}
+
+func promptHash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// Create stores body as the next version of a template. A body identical to an
+// existing version returns that version instead, reporting created as false.
+func (ps *PromptStore) Create(ctx context.Context, name, body, description, createdBy string) (PromptTemplate, bool, error) {
+	if !promptNamePattern.MatchString(name) {
+		return PromptTemplate{}, false, fmt.Errorf("%w: name must be 1-64 lowercase letters, digits, '_', '.' or '-'", ErrInvalidPrompt)
+	}
+	if strings.TrimSpace(body) == "" {
+		return PromptTemplate{}, false, fmt.Errorf("%w: body is required", ErrInvalidPrompt)
+	}
+	hash := promptHash(body)
+
+	// A lost version claim means another replica created the same version; reload and retry
+	for attempt := 0; attempt < 3; attempt++ {
+		ps.mu.RLock()
+		versions := ps.templates[name]
+		var existing *PromptTemplate
+		for _, t := range versions {
+			if t != nil && t.Hash == hash {
+				existing = t
+				break
+			}
+		}
+		next := len(versions) + 1
+		ps.mu.RUnlock()
+
+		if existing != nil {
+			if existing.RetiredAt != nil {
+				return *existing, false, fmt.Errorf("%w: %s has the same body", ErrPromptRetired, existing.Ref())
+			}
+			return *existing, false, nil
+		}
+
+		t := &PromptTemplate{
+			Name:        name,
+			Version:     next,
+			Hash:        hash,
+			Body:        body,
+			Description: description,
+			CreatedBy:   createdBy,
+			CreatedAt:   ps.now().UTC(),
+		}
+		claimed, err := ps.claimVersion(ctx, t)
+		if err != nil {
+			return PromptTemplate{}, false, err
+		}
+		if !claimed {
+			if err := ps.Load(ctx); err != nil {
+				return PromptTemplate{}, false, err
+			}
+			continue
+		}
+		if err := ps.persist(ctx, storage.BucketPromptTemplates, t.Ref(), t); err != nil {
+			return PromptTemplate{}, false, err
+		}
+
+		ps.mu.Lock()
+		if len(ps.templates[name]) >= next {
+			// Another request on this instance took the version first
+			ps.mu.Unlock()
+			continue
+		}
+		ps.templates[name] = append(ps.templates[name], t)
+		ps.mu.Unlock()
+		ps.invalidate(ctx)
+		return *t, true, nil
+	}
+	return PromptTemplate{}, false, fmt.Errorf("failed to allocate a version for prompt template %s", name)
+}
+
+// claimVersion reserves a version number across replicas; without Redis there is nothing to race
+func (ps *PromptStore) claimVersion(ctx context.Context, t *PromptTemplate) (bool, error) {
+	if ps.redisClient == nil {
+		return true, nil
+	}
+	claimed, err := ps.redisClient.SetNX(ctx, promptVersionClaimPrefix+t.Ref(), t.Hash, 0).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim prompt template version: %w", err)
+	}
+	return claimed, nil
+}
+
+func (ps *PromptStore) persist(ctx context.Context, bucket, key string, value interface{}) error {
+	if ps.store == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := ps.store.Put(ctx, bucket, key, data); err != nil {
+		return fmt.Errorf("failed to persist %s: %w", bucket, err)
+	}
+	return nil
+}
+
+func (ps *PromptStore) unpersist(ctx context.Context, bucket, key string) error {
+	if ps.store == nil {
+		return nil
+	}
+	if err := ps.store.Delete(ctx, bucket, key); err != nil {
+		return fmt.Errorf("failed to delete from %s: %w", bucket, err)
+	}
+	return nil
+}
+
+// List returns an overview of every template name
+func (ps *PromptStore) List() []PromptSummary {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	result := make([]PromptSummary, 0, len(ps.templates))
+	for name, versions := range ps.templates {
+		summary := PromptSummary{Name: name, Versions: len(versions)}
+		if latest := latestActive(versions); latest != nil {
+			summary.Latest = latest.Version
+		}
+		if rollout, ok := ps.rollouts[name]; ok {
+			copied := *rollout
+			summary.Rollout = &copied
+		}
+		result = append(result, summary)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Versions returns every version of a template, oldest first
+func (ps *PromptStore) Versions(name string) ([]PromptTemplate, error) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	versions, ok := ps.templates[name]
+	if !ok {
+		return nil, ErrPromptNotFound
+	}
+	result := make([]PromptTemplate, 0, len(versions))
+	for _, t := range versions {
+		if t != nil {
+			result = append(result, *t)
+		}
+	}
+	return result, nil
+}
+
+// Get returns one version of a template, retired or not
+func (ps *PromptStore) Get(name string, version int) (PromptTemplate, error) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	if t := ps.version(name, version); t != nil {
+		return *t, nil
+	}
+	return PromptTemplate{}, ErrPromptNotFound
+}
+
+// version returns a version or nil; callers hold ps.mu
+func (ps *PromptStore) version(name string, version int) *PromptTemplate {
+	versions := ps.templates[name]
+	if version < 1 || version > len(versions) {
+		return nil
+	}
+	return versions[version-1]
+}
+
+func latestActive(versions []*PromptTemplate) *PromptTemplate {
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i] != nil && versions[i].RetiredAt == nil {
+			return versions[i]
+		}
+	}
+	return nil
+}
+
+// Resolve returns the template a reference selects for a subject. An explicit
+// version always wins; for name@latest a pin of the subject's tenant comes
+// first, then an active rollout, then the newest active version.
+func (ps *PromptStore) Resolve(ref string, subject flags.Subject) (PromptTemplate, error) {
+	parsed, err := ParsePromptRef(ref)
+	if err != nil {
+		return PromptTemplate{}, err
+	}
+
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	version := parsed.Version
+	if version == 0 {
+		if pinned, ok := ps.pins[subject.Tenant][parsed.Name]; ok && subject.Tenant != "" {
+			version = pinned
+		} else if rollout, ok := ps.rollouts[parsed.Name]; ok {
+			version = rollout.Stable
+			// 匿名请求没有稳定的分桶依据，始终使用稳定版本
+			if subject.KeyID != "" && flags.Bucket("prompt:"+parsed.Name, subject.KeyID) < rollout.Percentage {
+				version = rollout.Candidate
+			}
+		}
+	}
+	if version == 0 {
+		if latest := latestActive(ps.templates[parsed.Name]); latest != nil {
+			return *latest, nil
+		}
+		return PromptTemplate{}, fmt.Errorf("%w: %s", ErrPromptNotFound, parsed)
+	}
+
+	t := ps.version(parsed.Name, version)
+	if t == nil {
+		return PromptTemplate{}, fmt.Errorf("%w: %s@%d", ErrPromptNotFound, parsed.Name, version)
+	}
+	if t.RetiredAt != nil {
+		return PromptTemplate{}, fmt.Errorf("%w: %s", ErrPromptRetired, t.Ref())
+	}
+	return *t, nil
+}
+
+// requireActive checks a version exists and is not retired; callers hold ps.mu
+func (ps *PromptStore) requireActive(name string, version int) error {
+	t := ps.version(name, version)
+	if t == nil {
+		return fmt.Errorf("%w: %s@%d", ErrPromptNotFound, name, version)
+	}
+	if t.RetiredAt != nil {
+		return fmt.Errorf("%w: %s", ErrPromptRetired, t.Ref())
+	}
+	return nil
+}
+
+// Pins returns every tenant pin of a template, sorted by tenant
+func (ps *PromptStore) Pins(name string) []PromptPin {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	pins := []PromptPin{}
+	for tenant, names := range ps.pins {
+		if version, ok := names[name]; ok {
+			pins = append(pins, PromptPin{Tenant: tenant, Name: name, Version: version})
+		}
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i].Tenant < pins[j].Tenant })
+	return pins
+}
+
+func promptPinKey(tenant, name string) string {
+	return tenant + "/" + name
+}
+
+// SetPin makes a tenant's name@latest references resolve to a fixed version
+func (ps *PromptStore) SetPin(ctx context.Context, tenant, name string, version int) (PromptPin, error) {
+	if strings.TrimSpace(tenant) == "" {
+		return PromptPin{}, fmt.Errorf("%w: tenant is required", ErrInvalidPrompt)
+	}
+	ps.mu.RLock()
+	err := ps.requireActive(name, version)
+	ps.mu.RUnlock()
+	if err != nil {
+		return PromptPin{}, err
+	}
+
+	pin := PromptPin{Tenant: tenant, Name: name, Version: version, UpdatedAt: ps.now().UTC()}
+	if err := ps.persist(ctx, storage.BucketPromptPins, promptPinKey(tenant, name), pin); err != nil {
+		return PromptPin{}, err
+	}
+	ps.mu.Lock()
+	if ps.pins[tenant] == nil {
+		ps.pins[tenant] = make(map[string]int)
+	}
+	ps.pins[tenant][name] = version
+	ps.mu.Unlock()
+	ps.invalidate(ctx)
+	return pin, nil
+}
+
+// DeletePin removes a tenant pin
+func (ps *PromptStore) DeletePin(ctx context.Context, tenant, name string) error {
+	ps.mu.RLock()
+	_, ok := ps.pins[tenant][name]
+	ps.mu.RUnlock()
+	if !ok {
+		return ErrPromptNotFound
+	}
+	if err := ps.unpersist(ctx, storage.BucketPromptPins, promptPinKey(tenant, name)); err != nil {
+		return err
+	}
+	ps.mu.Lock()
+	delete(ps.pins[tenant], name)
+	if len(ps.pins[tenant]) == 0 {
+		delete(ps.pins, tenant)
+	}
+	ps.mu.Unlock()
+	ps.invalidate(ctx)
+	return nil
+}
+
+// SetRollout splits name@latest references between two active versions
+func (ps *PromptStore) SetRollout(ctx context.Context, rollout PromptRollout) (PromptRollout, error) {
+	if rollout.Percentage < 0 || rollout.Percentage > 100 {
+		return PromptRollout{}, fmt.Errorf("%w: percentage must be between 0 and 100", ErrInvalidPrompt)
+	}
+	if rollout.Stable == rollout.Candidate {
+		return PromptRollout{}, fmt.Errorf("%w: stable and candidate must be different versions", ErrInvalidPrompt)
+	}
+	ps.mu.RLock()
+	err := ps.requireActive(rollout.Name, rollout.Stable)
+	if err == nil {
+		err = ps.requireActive(rollout.Name, rollout.Candidate)
+	}
+	ps.mu.RUnlock()
+	if err != nil {
+		return PromptRollout{}, err
+	}
+
+	rollout.UpdatedAt = ps.now().UTC()
+	if err := ps.persist(ctx, storage.BucketPromptRollouts, rollout.Name, rollout); err != nil {
+		return PromptRollout{}, err
+	}
+	ps.mu.Lock()
+	ps.rollouts[rollout.Name] = &rollout
+	ps.mu.Unlock()
+	ps.invalidate(ctx)
+	return rollout, nil
+}
+
+// DeleteRollout ends a rollout; name@latest references return to the newest version
+func (ps *PromptStore) DeleteRollout(ctx context.Context, name string) error {
+	ps.mu.RLock()
+	_, ok := ps.rollouts[name]
+	ps.mu.RUnlock()
+	if !ok {
+		return ErrPromptNotFound
+	}
+	if err := ps.unpersist(ctx, storage.BucketPromptRollouts, name); err != nil {
+		return err
+	}
+	ps.mu.Lock()
+	delete(ps.rollouts, name)
+	ps.mu.Unlock()
+	ps.invalidate(ctx)
+	return nil
+}
+
+// references reports who still uses a version: explicit references, pins, rollouts,
+// and name@latest references while it is the newest active version
+func (ps *PromptStore) references(ctx context.Context, t *PromptTemplate) ([]string, error) {
+	ps.mu.RLock()
+	referrers := append([]PromptReferrer(nil), ps.referrers...)
+	latest := latestActive(ps.templates[t.Name])
+	var users []string
+	for tenant, names := range ps.pins {
+		if names[t.Name] == t.Version {
+			users = append(users, "pin of tenant "+tenant)
+		}
+	}
+	if rollout, ok := ps.rollouts[t.Name]; ok && (rollout.Stable == t.Version || rollout.Candidate == t.Version) {
+		users = append(users, "rollout")
+	}
+	ps.mu.RUnlock()
+
+	for _, referrer := range referrers {
+		refs, err := referrer(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check prompt template references: %w", err)
+		}
+		for _, ref := range refs {
+			parsed, err := ParsePromptRef(ref)
+			if err != nil || parsed.Name != t.Name {
+				continue
+			}
+			if parsed.Version == t.Version || (parsed.Version == 0 && latest != nil && latest.Version == t.Version) {
+				users = append(users, ref)
+			}
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+// Retire stops a version from being resolved. Its body is kept for the audit trail.
+func (ps *PromptStore) Retire(ctx context.Context, name string, version int, retiredBy string) (PromptTemplate, error) {
+	ps.mu.RLock()
+	current := ps.version(name, version)
+	ps.mu.RUnlock()
+	if current == nil {
+		return PromptTemplate{}, ErrPromptNotFound
+	}
+	if current.RetiredAt != nil {
+		return *current, nil
+	}
+	users, err := ps.references(ctx, current)
+	if err != nil {
+		return PromptTemplate{}, err
+	}
+	if len(users) > 0 {
+		return PromptTemplate{}, fmt.Errorf("%w by %s", ErrPromptReferenced, strings.Join(users, ", "))
+	}
+
+	retired := *current
+	now := ps.now().UTC()
+	retired.RetiredAt = &now
+	retired.RetiredBy = retiredBy
+	if err := ps.persist(ctx, storage.BucketPromptTemplates, retired.Ref(), &retired); err != nil {
+		return PromptTemplate{}, err
+	}
+	ps.mu.Lock()
+	ps.templates[name][version-1] = &retired
+	ps.mu.Unlock()
+	ps.invalidate(ctx)
+	return retired, nil
+}
+
+// PromptDiffLine is one line of a diff between two template versions
+type PromptDiffLine struct {
+	Op   string `json:"op"` // "=", "-" or "+"
+	Text string `json:"text"`
+}
+
+// Diff compares two versions of a template line by line
+func (ps *PromptStore) Diff(name string, from, to int) ([]PromptDiffLine, error) {
+	a, err := ps.Get(name, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ps.Get(name, to)
+	if err != nil {
+		return nil, err
+	}
+	return diffLines(strings.Split(a.Body, "\n"), strings.Split(b.Body, "\n")), nil
+}
+
+// diffLines computes a minimal line diff from the longest common subsequence
+func diffLines(a, b []string) []PromptDiffLine {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff []PromptDiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, PromptDiffLine{Op: "=", Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, PromptDiffLine{Op: "-", Text: a[i]})
+			i++
+		default:
+			diff = append(diff, PromptDiffLine{Op: "+", Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, PromptDiffLine{Op: "-", Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, PromptDiffLine{Op: "+", Text: b[j]})
+	}
+	return diff
+}
+
+func (ps *PromptStore) invalidate(ctx context.Context) {
+	if ps.redisClient == nil {
+		return
+	}
+	if err := ps.redisClient.Publish(ctx, PromptInvalidationChannel, ps.instanceID).Err(); err != nil {
+		logrus.WithError(err).Warn("Failed to publish prompt template invalidation")
+	}
+}
+
+// StartInvalidationListener reloads templates when another replica changes them
+func (ps *PromptStore) StartInvalidationListener(ctx context.Context) {
+	if ps.redisClient == nil || ps.store == nil {
+		return
+	}
+
+	pubsub := ps.redisClient.Subscribe(ctx, PromptInvalidationChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			if msg.Payload == ps.instanceID {
+				continue
+			}
+			if err := ps.Load(ctx); err != nil {
+				logrus.WithError(err).Warn("Failed to reload prompt templates after invalidation")
+			}
+		}
+	}
+}
+
+// appliedPrompts collects the template versions applied while serving one request
+type appliedPrompts struct {
+	mu      sync.Mutex
+	applied []AppliedPrompt
+}
+
+type appliedPromptsKey struct{}
+
+type promptSubjectKey struct{}
+
+// withAppliedPrompts attaches a collector of applied template versions to ctx
+func withAppliedPrompts(ctx context.Context) (context.Context, *appliedPrompts) {
+	collector := &appliedPrompts{}
+	return context.WithValue(ctx, appliedPromptsKey{}, collector), collector
+}
+
+// recordAppliedPrompt adds a template version to the collector in ctx, if any
+func recordAppliedPrompt(ctx context.Context, applied AppliedPrompt) {
+	collector, ok := ctx.Value(appliedPromptsKey{}).(*appliedPrompts)
+	if !ok {
+		return
+	}
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	for _, a := range collector.applied {
+		if a == applied {
+			return
+		}
+	}
+	collector.applied = append(collector.applied, applied)
+}
+
+func (a *appliedPrompts) list() []AppliedPrompt {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]AppliedPrompt{}, a.applied...)
+}
+
+// withPromptSubject carries the subject templates are resolved for into background work
+func withPromptSubject(ctx context.Context, subject flags.Subject) context.Context {
+	return context.WithValue(ctx, promptSubjectKey{}, subject)
+}
+
+func promptSubjectFrom(ctx context.Context) flags.Subject {
+	subject, _ := ctx.Value(promptSubjectKey{}).(flags.Subject)
+	return subject
+}
+
+// promptSubject identifies the caller of a request the way feature flags do
+func promptSubject(c *gin.Context) flags.Subject {
+	subject := flags.Subject{KeyID: c.GetString("flag_key_id"), Tenant: c.GetString("tenant_id")}
+	if subject.Tenant == "" {
+		subject.Tenant = c.GetHeader("X-Tenant-ID")
+	}
+	if subject.KeyID == "" {
+		if caller := DefaultModelCaller(c); caller.KeyID != "anonymous" {
+			subject.KeyID = caller.KeyID
+		}
+	}
+	return subject
+}
+
+// ResolveApplied resolves a reference and records the version in ctx for the audit trail
+func (ps *PromptStore) ResolveApplied(ctx context.Context, ref string, subject flags.Subject) (PromptTemplate, error) {
+	t, err := ps.Resolve(ref, subject)
+	if err != nil {
+		return PromptTemplate{}, err
+	}
+	recordAppliedPrompt(ctx, AppliedPrompt{Ref: t.Ref(), Hash: t.Hash})
+	return t, nil
+}
+
+// systemPromptHooks prepends the resolved gateway system prompt to chat requests
+func systemPromptHooks(c *gin.Context, ps *PromptStore, ref string) *proxyHooks {
+	return &proxyHooks{
+		request: func(request map[string]interface{}) (bool, error) {
+			messages, ok := request["messages"].([]interface{})
+			if !ok {
+				return false, nil
+			}
+			t, err := ps.ResolveApplied(c.Request.Context(), ref, promptSubject(c))
+			if err != nil {
+				// A missing gateway prompt must not take chat traffic down
+				logrus.WithError(err).WithField("template", ref).Error("Failed to resolve system prompt template")
+				return false, nil
+			}
+			system := map[string]interface{}{"role": "system", "content": t.Body}
+			request["messages"] = append([]interface{}{system}, messages...)
+			return true, nil
+		},
+	}
+}
+
+// auditAIRequest writes the audit record of an AI request with the exact template versions applied
+func (ps *PromptStore) auditAIRequest(c *gin.Context, applied []AppliedPrompt) {
+	if ps.audit == nil {
+		return
+	}
+	subject := promptSubject(c)
+	ps.audit.LogWithContext(c.Request.Context(), &security.AuditEvent{
+		Type:      "ai_request",
+		Action:    c.Request.Method,
+		Resource:  c.Request.URL.Path,
+		UserID:    subject.KeyID,
+		RemoteIP:  c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		Details: map[string]interface{}{
+			"tenant":           subject.Tenant,
+			"model":            c.GetString(middleware.ModelContextKey),
+			"status":           c.Writer.Status(),
+			"prompt_templates": applied,
+		},
+	})
+}
+
+var (
+	defaultPromptStoreMu sync.RWMutex
+	defaultPromptStore   *PromptStore
+)
+
+// SetPromptStore installs the prompt store consulted by the proxy and sentinels; nil disables templates
+func SetPromptStore(ps *PromptStore) {
+	defaultPromptStoreMu.Lock()
+	defaultPromptStore = ps
+	defaultPromptStoreMu.Unlock()
+}
+
+// DefaultPromptStore returns the installed prompt store, or nil
+func DefaultPromptStore() *PromptStore {
+	defaultPromptStoreMu.RLock()
+	defer defaultPromptStoreMu.RUnlock()
+	return defaultPromptStore
+}
+
+func promptError(c *gin.Context, err error) {
+	status, errType, code := http.StatusInternalServerError, "internal_server_error", "storage_error"
+	switch {
+	case errors.Is(err, ErrInvalidPrompt):
+		status, errType, code = http.StatusBadRequest, "validation_error", "invalid_prompt"
+	case errors.Is(err, ErrPromptNotFound):
+		status, errType, code = http.StatusNotFound, "invalid_request_error", "prompt_not_found"
+	case errors.Is(err, ErrPromptRetired):
+		status, errType, code = http.StatusConflict, "invalid_request_error", "prompt_retired"
+	case errors.Is(err, ErrPromptReferenced):
+		status, errType, code = http.StatusConflict, "invalid_request_error", "prompt_referenced"
+	}
+	c.JSON(status, gin.H{
+		"error": gin.H{
+			"message": err.Error(),
+			"type":    errType,
+			"code":    code,
+		},
+	})
+}
+
+func auditPrompt(c *gin.Context, audit *security.AuditLogger, action, resource string, details map[string]interface{}) {
+	audit.LogWithContext(c.Request.Context(), &security.AuditEvent{
+		Type:      "prompt_template",
+		Action:    action,
+		Resource:  resource,
+		UserID:    c.GetString("user_id"),
+		RemoteIP:  c.ClientIP(),
+		UserAgent: c.GetHeader("User-Agent"),
+		Details:   details,
+	})
+}
+
+// promptVersionParam parses a version path or query parameter
+func promptVersionParam(value string) (int, error) {
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("%w: version must be a positive integer", ErrInvalidPrompt)
+	}
+	return version, nil
+}
+
+// CreatePromptTemplate stores a template body as a new immutable version
+func CreatePromptTemplate(ps *PromptStore, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name        string `json:"name"`
+			Body        string `json:"body"`
+			Description string `json:"description"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			promptError(c, fmt.Errorf("%w: invalid request format", ErrInvalidPrompt))
+			return
+		}
+
+		t, created, err := ps.Create(c.Request.Context(), req.Name, req.Body, req.Description, c.GetString("user_id"))
+		if err != nil {
+			promptError(c, err)
+			return
+		}
+		if !created {
+			// Content addressing: the same body is the same version
+			c.JSON(http.StatusOK, t)
+			return
+		}
+		auditPrompt(c, audit, "create", t.Ref(), map[string]interface{}{"hash": t.Hash})
+		c.JSON(http.StatusCreated, t)
+	}
+}
+
+// ListPromptTemplates returns every template name with its newest version and rollout
+func ListPromptTemplates(ps *PromptStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"prompts": ps.List()})
+	}
+}
+
+// ListPromptVersions returns every version and tenant pin of a template
+func ListPromptVersions(ps *PromptStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		name := c.Param("name")
+		versions, err := ps.Versions(name)
+		if err != nil {
+			promptError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"name":     name,
+			"versions": versions,
+			"pins":     ps.Pins(name),
+		})
+	}
+}
+
+// GetPromptVersion returns one version of a template
+func GetPromptVersion(ps *PromptStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version, err := promptVersionParam(c.Param("version"))
+		if err != nil {
+			promptError(c, err)
+			return
+		}
+		t, err := ps.Get(c.Param("name"), version)
+		if err != nil {
+			promptError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// DiffPromptVersions compares the versions given by the from and to query parameters
+func DiffPromptVersions(ps *PromptStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, err := promptVersionParam(c.Query("from"))
+		if err != nil {
+			promptError(c, err)
+			return
+		}
+		to, err := promptVersionParam(c.Query("to"))
+		if err != nil {
+			promptError(c, err)
+			return
+		}
+		diff, err := ps.Diff(c.Param("name"), from, to)
+		if err != nil {
+			promptError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"name":  c.Param("name"),
+			"from":  from,
+			"to":    to,
+			"lines": diff,
+		})
+	}
+}
+
+// RetirePromptVersion retires a version that nothing references any more
+func RetirePromptVersion(ps *PromptStore, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		version, err := promptVersionParam(c.Param("version"))
+		if err != nil {
+			promptError(c, err)
+			return
+		}
+		t, err := ps.Retire(c.Request.Context(), c.Param("name"), version, c.GetString("user_id"))
+		if err != nil {
+			promptError(c, err)
+			return
+		}
+		auditPrompt(c, audit, "retire", t.Ref(), nil)
+		c.JSON(http.StatusOK, t)
+	}
+}
+
+// PutPromptPin pins a tenant to one version of a template
+func PutPromptPin(ps *PromptStore, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Version int `json:"version"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			promptError(c, fmt.Errorf("%w: invalid request format", ErrInvalidPrompt))
+			return
+		}
+		pin, err := ps.SetPin(c.Request.Context(), c.Param("tenant"), c.Param("name"), req.Version)
+		if err != nil {
+			promptError(c, err)
+			return
+		}
+		auditPrompt(c, audit, "pin", c.Param("name"), map[string]interface{}{
+			"tenant":  pin.Tenant,
+			"version": pin.Version,
+		})
+		c.JSON(http.StatusOK, pin)
+	}
+}
+
+// DeletePromptPin removes a tenant's pin
+func DeletePromptPin(ps *PromptStore, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := ps.DeletePin(c.Request.Context(), c.Param("tenant"), c.Param("name")); err != nil {
+			promptError(c, err)
+			return
+		}
+		auditPrompt(c, audit, "unpin", c.Param("name"), map[string]interface{}{"tenant": c.Param("tenant")})
+		c.JSON(http.StatusOK, gin.H{"message": "Prompt pin removed"})
+	}
+}
+
+// PutPromptRollout splits a template's traffic between two versions
+func PutPromptRollout(ps *PromptStore, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rollout PromptRollout
+		if err := c.ShouldBindJSON(&rollout); err != nil {
+			promptError(c, fmt.Errorf("%w: invalid request format", ErrInvalidPrompt))
+			return
+		}
+		rollout.Name = c.Param("name")
+		saved, err := ps.SetRollout(c.Request.Context(), rollout)
+		if err != nil {
+			promptError(c, err)
+			return
+		}
+		auditPrompt(c, audit, "rollout", saved.Name, map[string]interface{}{
+			"stable":     saved.Stable,
+			"candidate":  saved.Candidate,
+			"percentage": saved.Percentage,
+		})
+		c.JSON(http.StatusOK, saved)
+	}
+}
+
+// DeletePromptRollout ends a template's rollout
+func DeletePromptRollout(ps *PromptStore, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := ps.DeleteRollout(c.Request.Context(), c.Param("name")); err != nil {
+			promptError(c, err)
+			return
+		}
+		auditPrompt(c, audit, "end_rollout", c.Param("name"), nil)
+		c.JSON(http.StatusOK, gin.H{"message": "Prompt rollout removed"})
+	}
+}
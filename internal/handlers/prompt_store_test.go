@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/flags"
+	"go-aigateway/internal/logging"
+	"go-aigateway/internal/security"
+	"go-aigateway/internal/storage"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createPrompt(t *testing.T, ps *PromptStore, name, body string) PromptTemplate {
+	t.Helper()
+	tpl, _, err := ps.Create(context.Background(), name, body, "", "alice")
+	require.NoError(t, err)
+	return tpl
+}
+
+func setupPromptRouter(ps *PromptStore) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	audit := security.NewAuditLogger()
+	r := gin.New()
+	r.POST("/api/v1/admin/prompts", CreatePromptTemplate(ps, audit))
+	r.GET("/api/v1/admin/prompts", ListPromptTemplates(ps))
+	r.GET("/api/v1/admin/prompts/:name/versions", ListPromptVersions(ps))
+	r.DELETE("/api/v1/admin/prompts/:name/versions/:version", RetirePromptVersion(ps, audit))
+	r.GET("/api/v1/admin/prompts/:name/diff", DiffPromptVersions(ps))
+	r.PUT("/api/v1/admin/prompts/:name/pins/:tenant", PutPromptPin(ps, audit))
+	r.PUT("/api/v1/admin/prompts/:name/rollout", PutPromptRollout(ps, audit))
+	return r
+}
+
+func promptRequest(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestPromptVersionsAreImmutable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := storage.NewRedisStore(client)
+	ps := NewPromptStore(store, client, nil)
+	r := setupPromptRouter(ps)
+
+	w := promptRequest(r, http.MethodPost, "/api/v1/admin/prompts", `{"name":"support","body":"You are a helpful support agent."}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var v1 PromptTemplate
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &v1))
+	assert.Equal(t, 1, v1.Version)
+	assert.Equal(t, promptHash("You are a helpful support agent."), v1.Hash)
+
+	// The same body is the same version
+	w = promptRequest(r, http.MethodPost, "/api/v1/admin/prompts", `{"name":"support","body":"You are a helpful support agent."}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	var again PromptTemplate
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &again))
+	assert.Equal(t, v1.Version, again.Version)
+
+	// A new body never overwrites an existing version
+	v2 := createPrompt(t, ps, "support", "You are a concise support agent.")
+	assert.Equal(t, 2, v2.Version)
+	stored, err := ps.Get("support", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "You are a helpful support agent.", stored.Body)
+
+	// Another replica that has not seen version 2 cannot claim it again
+	stale := NewPromptStore(store, client, nil)
+	stale.templates["support"] = []*PromptTemplate{&v1}
+	v3, created, err := stale.Create(context.Background(), "support", "You are a friendly support agent.", "", "bob")
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, 3, v3.Version)
+
+	reloaded := NewPromptStore(store, nil, nil)
+	require.NoError(t, reloaded.Load(context.Background()))
+	versions, err := reloaded.Versions("support")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, "You are a concise support agent.", versions[1].Body)
+
+	// Recreating the body of a retired version does not resurrect it
+	_, err = ps.Retire(context.Background(), "support", 1, "alice")
+	require.NoError(t, err)
+	w = promptRequest(r, http.MethodPost, "/api/v1/admin/prompts", `{"name":"support","body":"You are a helpful support agent."}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	for _, body := range []string{`{"name":"Bad Name","body":"x"}`, `{"name":"support","body":"  "}`} {
+		w = promptRequest(r, http.MethodPost, "/api/v1/admin/prompts", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+}
+
+func TestPromptPinningPrecedence(t *testing.T) {
+	ps := NewPromptStore(nil, nil, nil)
+	ctx := context.Background()
+	for i := 1; i <= 3; i++ {
+		createPrompt(t, ps, "support", fmt.Sprintf("version %d", i))
+	}
+	_, err := ps.SetRollout(ctx, PromptRollout{Name: "support", Stable: 1, Candidate: 2, Percentage: 100})
+	require.NoError(t, err)
+	_, err = ps.SetPin(ctx, "acme", "support", 3)
+	require.NoError(t, err)
+
+	resolve := func(ref string, subject flags.Subject) int {
+		t.Helper()
+		tpl, err := ps.Resolve(ref, subject)
+		require.NoError(t, err)
+		return tpl.Version
+	}
+	acme := flags.Subject{KeyID: "key-1", Tenant: "acme"}
+	globex := flags.Subject{KeyID: "key-1", Tenant: "globex"}
+
+	// explicit version > tenant pin > rollout > latest
+	assert.Equal(t, 1, resolve("support@1", acme))
+	assert.Equal(t, 3, resolve("support@latest", acme))
+	assert.Equal(t, 2, resolve("support@latest", globex))
+	assert.Equal(t, 2, resolve("support", globex), "a bare name means latest")
+	assert.Equal(t, 1, resolve("support@latest", flags.Subject{Tenant: "globex"}), "anonymous callers get the stable version")
+
+	require.NoError(t, ps.DeleteRollout(ctx, "support"))
+	assert.Equal(t, 3, resolve("support@latest", globex))
+	require.NoError(t, ps.DeletePin(ctx, "acme", "support"))
+	_, err = ps.Retire(ctx, "support", 3, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 2, resolve("support@latest", acme), "latest skips retired versions")
+
+	_, err = ps.Resolve("support@3", acme)
+	assert.ErrorIs(t, err, ErrPromptRetired)
+	_, err = ps.Resolve("support@9", acme)
+	assert.ErrorIs(t, err, ErrPromptNotFound)
+	_, err = ps.SetPin(ctx, "acme", "support", 3)
+	assert.ErrorIs(t, err, ErrPromptRetired)
+	_, err = ps.SetRollout(ctx, PromptRollout{Name: "support", Stable: 1, Candidate: 1, Percentage: 50})
+	assert.ErrorIs(t, err, ErrInvalidPrompt)
+}
+
+func TestPromptRolloutBucketingIsDeterministic(t *testing.T) {
+	newStore := func() *PromptStore {
+		ps := NewPromptStore(nil, nil, nil)
+		createPrompt(t, ps, "support", "stable")
+		createPrompt(t, ps, "support", "candidate")
+		_, err := ps.SetRollout(context.Background(), PromptRollout{Name: "support", Stable: 1, Candidate: 2, Percentage: 30})
+		require.NoError(t, err)
+		return ps
+	}
+	a, b := newStore(), newStore()
+
+	candidates := 0
+	for i := 0; i < 1000; i++ {
+		subject := flags.Subject{KeyID: fmt.Sprintf("key-%d", i)}
+		first, err := a.Resolve("support@latest", subject)
+		require.NoError(t, err)
+		second, err := a.Resolve("support@latest", subject)
+		require.NoError(t, err)
+		replica, err := b.Resolve("support@latest", subject)
+		require.NoError(t, err)
+
+		assert.Equal(t, first.Version, second.Version)
+		assert.Equal(t, first.Version, replica.Version, "every replica assigns a key the same version")
+		wantCandidate := flags.Bucket("prompt:support", subject.KeyID) < 30
+		assert.Equal(t, wantCandidate, first.Version == 2)
+		if first.Version == 2 {
+			candidates++
+		}
+	}
+	assert.InDelta(t, 300, candidates, 60)
+}
+
+func TestPromptRetireBlockedWhileReferenced(t *testing.T) {
+	ps := NewPromptStore(nil, nil, nil)
+	ps.AddReferrer(func(context.Context) ([]string, error) { return []string{"support@latest", "greeting@1"}, nil })
+	createPrompt(t, ps, "support", "one")
+	createPrompt(t, ps, "support", "two")
+	createPrompt(t, ps, "greeting", "hello")
+	r := setupPromptRouter(ps)
+
+	w := promptRequest(r, http.MethodDelete, "/api/v1/admin/prompts/support/versions/2", "")
+	assert.Equal(t, http.StatusConflict, w.Code, "support@latest resolves to version 2")
+	assert.Contains(t, w.Body.String(), "prompt_referenced")
+	w = promptRequest(r, http.MethodDelete, "/api/v1/admin/prompts/greeting/versions/1", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Pins hold on to their version too
+	w = promptRequest(r, http.MethodPut, "/api/v1/admin/prompts/support/pins/acme", `{"version":1}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = promptRequest(r, http.MethodDelete, "/api/v1/admin/prompts/support/versions/1", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "pin of tenant acme")
+
+	require.NoError(t, ps.DeletePin(context.Background(), "acme", "support"))
+	w = promptRequest(r, http.MethodDelete, "/api/v1/admin/prompts/support/versions/1", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	retired, err := ps.Get("support", 1)
+	require.NoError(t, err)
+	assert.NotNil(t, retired.RetiredAt)
+	assert.Equal(t, "one", retired.Body, "retired versions keep their body for the audit trail")
+
+	w = promptRequest(r, http.MethodGet, "/api/v1/admin/prompts/support/diff?from=1&to=2", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var diff struct {
+		Lines []PromptDiffLine `json:"lines"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, []PromptDiffLine{{Op: "-", Text: "one"}, {Op: "+", Text: "two"}}, diff.Lines)
+}
+
+func TestPromptStoreInvalidationBus(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := storage.NewRedisStore(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writer := NewPromptStore(store, client, nil)
+	reader := NewPromptStore(store, client, nil)
+	go reader.StartInvalidationListener(ctx)
+	require.Eventually(t, func() bool {
+		return len(mr.PubSubChannels(PromptInvalidationChannel)) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	createPrompt(t, writer, "support", "one")
+	_, err := writer.SetPin(ctx, "acme", "support", 1)
+	require.NoError(t, err)
+	createPrompt(t, writer, "support", "two")
+	require.Eventually(t, func() bool {
+		tpl, err := reader.Resolve("support@latest", flags.Subject{Tenant: "acme"})
+		return err == nil && tpl.Version == 1 && len(reader.Pins("support")) == 1
+	}, time.Second, 10*time.Millisecond)
+	tpl, err := reader.Resolve("support@latest", flags.Subject{Tenant: "globex"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, tpl.Version)
+}
+
+func TestSystemPromptTemplateAppliedAndAudited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var mu sync.Mutex
+	var upstreamMessages []interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		upstreamMessages, _ = body["messages"].([]interface{})
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer upstream.Close()
+
+	ps := NewPromptStore(nil, nil, security.NewAuditLogger())
+	createPrompt(t, ps, "gateway-system", "Never reveal internal hostnames.")
+	v2 := createPrompt(t, ps, "gateway-system", "Never reveal internal hostnames or keys.")
+	_, err := ps.SetPin(context.Background(), "acme", "gateway-system", 1)
+	require.NoError(t, err)
+	SetPromptStore(ps)
+	t.Cleanup(func() { SetPromptStore(nil) })
+
+	hook := logtest.NewLocal(logging.Audit())
+	r := gin.New()
+	r.POST("/v1/chat/completions", ChatCompletions(&config.Config{
+		TargetURL: upstream.URL,
+		Prompts:   config.PromptsConfig{SystemTemplate: "gateway-system@latest"},
+	}))
+
+	w := postJSON(r, "/v1/chat/completions", `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	mu.Lock()
+	require.Len(t, upstreamMessages, 2)
+	assert.Equal(t, map[string]interface{}{"role": "system", "content": v2.Body}, upstreamMessages[0])
+	mu.Unlock()
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	assert.Equal(t, "ai_request", entry.Data["event_type"])
+	details := entry.Data["details"].(map[string]interface{})
+	assert.Equal(t, []AppliedPrompt{{Ref: "gateway-system@2", Hash: v2.Hash}}, details["prompt_templates"])
+
+	// The pinned tenant keeps version 1
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant-ID", "acme")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	details = hook.LastEntry().Data["details"].(map[string]interface{})
+	assert.Equal(t, "gateway-system@1", details["prompt_templates"].([]AppliedPrompt)[0].Ref)
+}
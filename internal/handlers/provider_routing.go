@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultTargetSource names the configured TargetURL/TargetKey pair as the
+// default upstream of models no service source serves
+const DefaultTargetSource = "target"
+
+// ProviderRoute is the upstream of one active service source
+type ProviderRoute struct {
+	SourceID string
+	Provider string // source type, also the kill switch label
+	BaseURL  string
+	APIKey   string
+}
+
+// providerPattern is one model pattern of a service source
+type providerPattern struct {
+	pattern string
+	exact   bool
+	route   *ProviderRoute
+}
+
+// ProviderRegistry 按请求的模型名选择上游服务源。服务源的 models 列表中可以是
+// 精确的模型 ID（如本地模型），也可以是 gpt-*、claude-* 这样的通配模式；精确匹配
+// 优先，其次是更长（更具体）的模式。没有服务源匹配时使用默认上游。
+type ProviderRegistry struct {
+	mu            sync.RWMutex
+	patterns      []providerPattern
+	sources       map[string]*ProviderRoute // active sources by ID
+	defaultSource string
+}
+
+// NewProviderRegistry creates a registry routing unmatched models to the configured target
+func NewProviderRegistry() *ProviderRegistry {
+	return &ProviderRegistry{
+		sources:       make(map[string]*ProviderRoute),
+		defaultSource: DefaultTargetSource,
+	}
+}
+
+// SetDefaultSource sets the upstream of models no source serves: a service
+// source ID, DefaultTargetSource, or empty to reject them
+func (r *ProviderRegistry) SetDefaultSource(id string) {
+	r.mu.Lock()
+	r.defaultSource = id
+	r.mu.Unlock()
+}
+
+// Update replaces the routing table with the active sources
+func (r *ProviderRegistry) Update(sources []ServiceSource) {
+	var patterns []providerPattern
+	active := make(map[string]*ProviderRoute, len(sources))
+	for _, source := range sources {
+		if source.Status != "active" || source.Endpoint == "" {
+			continue
+		}
+		route := &ProviderRoute{
+			SourceID: source.ID,
+			Provider: source.Type,
+			BaseURL:  source.Endpoint,
+			APIKey:   source.APIKey,
+		}
+		active[source.ID] = route
+		for _, pattern := range source.Models {
+			patterns = append(patterns, providerPattern{
+				pattern: pattern,
+				exact:   !strings.ContainsAny(pattern, `*?[\`),
+				route:   route,
+			})
+		}
+	}
+	// Stable, so equally specific patterns keep the order sources were created in
+	sort.SliceStable(patterns, func(i, j int) bool {
+		if patterns[i].exact != patterns[j].exact {
+			return patterns[i].exact
+		}
+		return len(patterns[i].pattern) > len(patterns[j].pattern)
+	})
+
+	r.mu.Lock()
+	r.patterns = patterns
+	r.sources = active
+	r.mu.Unlock()
+}
+
+// Resolve returns the source serving model. A nil route with ok true means the
+// configured target serves it; ok is false when no upstream serves the model.
+func (r *ProviderRegistry) Resolve(model string) (*ProviderRoute, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, p := range r.patterns {
+		if p.exact {
+			if p.pattern == model {
+				return p.route, true
+			}
+			continue
+		}
+		if matched, _ := path.Match(p.pattern, model); matched {
+			return p.route, true
+		}
+	}
+	switch r.defaultSource {
+	case DefaultTargetSource:
+		return nil, true
+	case "":
+		return nil, false
+	default:
+		route, ok := r.sources[r.defaultSource]
+		return route, ok
+	}
+}
+
+// validateModelPatterns checks the models list of a service source
+func validateModelPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return fmt.Errorf("model patterns must not be empty")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid model pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+var (
+	defaultProviderRegistryMu sync.RWMutex
+	defaultProviderRegistry   *ProviderRegistry
+)
+
+// SetProviderRegistry installs the registry the proxy routes models with; nil
+// sends every request to the configured target
+func SetProviderRegistry(r *ProviderRegistry) {
+	defaultProviderRegistryMu.Lock()
+	defaultProviderRegistry = r
+	defaultProviderRegistryMu.Unlock()
+}
+
+// DefaultProviderRegistry returns the registry consulted by the proxy, or nil
+func DefaultProviderRegistry() *ProviderRegistry {
+	defaultProviderRegistryMu.RLock()
+	defer defaultProviderRegistryMu.RUnlock()
+	return defaultProviderRegistry
+}
+
+// modelUpstream returns the base URL and credentials to proxy a request for
+// model to. Retries of a FallbackRouter go to its fallback provider.
+// Requests without a model, and models routed to the default target, go
+// through upstreamBase. ok is false once an error response was written.
+func modelUpstream(c *gin.Context, cfg *config.Config, model string) (base, apiKey string, ok bool) {
+	if provider, ok := fallbackTarget(c); ok {
+		c.Header(UpstreamProviderHeader, provider.Name)
+		return provider.URL, provider.APIKey, true
+	}
+
+	var route *ProviderRoute
+	if registry := DefaultProviderRegistry(); registry != nil && model != "" {
+		var served bool
+		if route, served = registry.Resolve(model); !served {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": fmt.Sprintf("The model '%s' is not served by any configured provider", model),
+					"type":    "invalid_request_error",
+					"code":    "model_not_supported",
+				},
+			})
+			return "", "", false
+		}
+	}
+
+	if route == nil {
+		if base, ok = upstreamBase(c, cfg, model); !ok {
+			writeProviderLockout(c)
+		}
+		return base, cfg.TargetKey, ok
+	}
+	if ks := DefaultKillSwitches(); ks != nil && providerKilled(ks, route.Provider, route.BaseURL, model) {
+		middleware.RecordKillSwitchProvider()
+		writeProviderLockout(c)
+		return "", "", false
+	}
+	c.Header(UpstreamProviderHeader, route.Provider)
+	return route.BaseURL, route.APIKey, true
+}
+
+func writeProviderLockout(c *gin.Context) {
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": gin.H{
+			"message": "The upstream provider is suspended by an emergency kill switch",
+			"type":    "api_error",
+			"code":    "provider_lockout",
+		},
+	})
+}
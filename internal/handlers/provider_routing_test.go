@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderRegistryResolve(t *testing.T) {
+	registry := NewProviderRegistry()
+	registry.Update([]ServiceSource{
+		{ID: "openai", Type: "openai", Endpoint: "https://openai.example", Status: "active", Models: []string{"gpt-*"}},
+		{ID: "mini", Type: "openai", Endpoint: "https://mini.example", Status: "active", Models: []string{"gpt-4o-mini*"}},
+		{ID: "local", Type: "local", Endpoint: "http://local.example", Status: "active", Models: []string{"gpt-4o-mini"}},
+		{ID: "claude", Type: "anthropic", Endpoint: "https://claude.example", Status: "inactive", Models: []string{"claude-*"}},
+	})
+
+	for model, want := range map[string]string{
+		"gpt-4":            "openai",
+		"gpt-4o-mini-2024": "mini",
+		"gpt-4o-mini":      "local",
+		"claude-3-opus":    "",
+		"qwen-turbo":       "",
+	} {
+		route, ok := registry.Resolve(model)
+		require.True(t, ok, model)
+		if want == "" {
+			assert.Nil(t, route, "%s goes to the configured target", model)
+			continue
+		}
+		require.NotNil(t, route, model)
+		assert.Equal(t, want, route.SourceID, model)
+	}
+
+	registry.SetDefaultSource("openai")
+	route, ok := registry.Resolve("qwen-turbo")
+	require.True(t, ok)
+	assert.Equal(t, "openai", route.SourceID)
+
+	registry.SetDefaultSource("claude")
+	_, ok = registry.Resolve("qwen-turbo")
+	assert.False(t, ok, "an inactive default source serves nothing")
+
+	registry.SetDefaultSource("")
+	_, ok = registry.Resolve("qwen-turbo")
+	assert.False(t, ok)
+}
+
+func TestProxyRoutesByModelThroughServiceSources(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newUpstream := func(name string) *httptest.Server {
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"served_by":%q,"authorization":%q}`, name, r.Header.Get("Authorization"))
+		}))
+		t.Cleanup(upstream.Close)
+		return upstream
+	}
+	target, claude := newUpstream("target"), newUpstream("claude")
+
+	handler := NewServiceHandler()
+	handler.Providers().SetDefaultSource("")
+	SetProviderRegistry(handler.Providers())
+	t.Cleanup(func() { SetProviderRegistry(nil) })
+
+	router := gin.New()
+	RegisterServiceRoutes(router, handler)
+	router.POST("/v1/chat/completions", ChatCompletions(&config.Config{TargetURL: target.URL, TargetKey: "target-key"}))
+
+	w := postJSON(router, "/v1/chat/completions", `{"model":"claude-3-opus","messages":[]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "model_not_supported")
+
+	w = postJSON(router, "/api/v1/service-sources", `{"name":"Claude","type":"anthropic","endpoint":"`+claude.URL+`","apiKey":"claude-key","models":["claude-*"]}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Data ServiceSource `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	// The new source serves its models without a restart, with its own credentials
+	w = postJSON(router, "/v1/chat/completions", `{"model":"claude-3-opus","messages":[]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "anthropic", w.Header().Get(UpstreamProviderHeader))
+	assert.JSONEq(t, `{"served_by":"claude","authorization":"Bearer claude-key"}`, w.Body.String())
+
+	// Unmatched models fall back to the configured target once it is the default
+	handler.Providers().SetDefaultSource(DefaultTargetSource)
+	w = postJSON(router, "/v1/chat/completions", `{"model":"qwen-turbo","messages":[]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"served_by":"target","authorization":"Bearer target-key"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/service-sources/"+created.Data.ID+"/toggle", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	w = postJSON(router, "/v1/chat/completions", `{"model":"claude-3-opus","messages":[]}`)
+	assert.JSONEq(t, `{"served_by":"target","authorization":"Bearer target-key"}`, w.Body.String(), "inactive sources no longer serve their models")
+
+	w = postJSON(router, "/api/v1/service-sources", `{"name":"Bad","type":"openai","endpoint":"`+claude.URL+`","models":["gpt-["]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
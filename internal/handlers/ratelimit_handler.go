@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// GetEndpointRateStats returns the current request rate of each rate limited endpoint pattern
+func GetEndpointRateStats(limiter *middleware.EndpointRateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		stats, err := limiter.Stats(c.Request.Context())
+		if err != nil {
+			logrus.WithError(err).Error("Failed to read endpoint rate limit stats")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": "Failed to read endpoint rate limit stats",
+					"type":    "internal_server_error",
+					"code":    "endpoint_rate_stats_failed",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"endpoints": stats})
+	}
+}
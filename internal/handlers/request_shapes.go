@@ -0,0 +1,413 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	requestShapeKeyPrefix = "gw:request_shapes:"
+	requestShapeHoursKey  = "gw:request_shapes:hours"  // sorted set of hourly bucket keys by hour
+	requestShapeModelsKey = "gw:request_shapes:models" // model names tracked individually
+	requestShapeHour      = "2006010215"
+)
+
+// Request shape dimensions
+const (
+	ShapePromptTokens = "prompt_tokens"
+	ShapeMaxTokens    = "max_tokens"
+	ShapeTemperature  = "temperature"
+	ShapeMessages     = "messages"
+	ShapeStreaming    = "streaming"
+)
+
+const (
+	// ShapeUnset is the bucket of optional parameters the request does not set
+	ShapeUnset = "unset"
+	// ShapeOtherModel counts models beyond the tracked model limit
+	ShapeOtherModel = "other"
+	// shapeRequests is the pseudo dimension holding the request count of a model
+	shapeRequests = "requests"
+)
+
+// shapeBucket covers values from the previous bucket's upper bound up to, but excluding, upper
+type shapeBucket struct {
+	upper float64
+	label string
+}
+
+var (
+	promptTokenBuckets = []shapeBucket{
+		{256, "0-256"}, {1024, "256-1k"}, {4096, "1k-4k"}, {16384, "4k-16k"}, {32768, "16k-32k"}, {math.Inf(1), "32k+"},
+	}
+	maxTokenBuckets = []shapeBucket{
+		{256, "0-256"}, {1024, "256-1k"}, {4096, "1k-4k"}, {math.Inf(1), "4k+"},
+	}
+	temperatureBuckets = []shapeBucket{
+		{0.5, "0-0.5"}, {1.0, "0.5-1"}, {1.5, "1-1.5"}, {math.Inf(1), "1.5+"},
+	}
+	messageCountBuckets = []shapeBucket{
+		{2, "1"}, {5, "2-4"}, {11, "5-10"}, {21, "11-20"}, {math.Inf(1), "21+"},
+	}
+)
+
+func bucketOf(buckets []shapeBucket, value float64) string {
+	for _, b := range buckets {
+		if value < b.upper {
+			return b.label
+		}
+	}
+	return buckets[len(buckets)-1].label
+}
+
+// RequestShape 一次请求的形态，只包含分桶后的值，不保存任何内容
+type RequestShape struct {
+	Model        string
+	PromptTokens string
+	MaxTokens    string
+	Temperature  string
+	Messages     string
+	Streaming    string
+}
+
+// ShapeOf buckets a decoded chat completion request
+func ShapeOf(request map[string]interface{}) RequestShape {
+	shape := RequestShape{
+		MaxTokens:   ShapeUnset,
+		Temperature: ShapeUnset,
+		Streaming:   "false",
+	}
+	shape.Model, _ = request["model"].(string)
+
+	messages, _ := request["messages"].([]interface{})
+	tokens := 0
+	for _, raw := range messages {
+		if m, ok := raw.(map[string]interface{}); ok {
+			tokens += EstimateMessageTokens(m)
+		}
+	}
+	shape.PromptTokens = bucketOf(promptTokenBuckets, float64(tokens))
+	shape.Messages = bucketOf(messageCountBuckets, float64(len(messages)))
+
+	if maxTokens, ok := request["max_tokens"].(float64); ok {
+		shape.MaxTokens = bucketOf(maxTokenBuckets, maxTokens)
+	}
+	if temperature, ok := request["temperature"].(float64); ok {
+		shape.Temperature = bucketOf(temperatureBuckets, temperature)
+	}
+	if stream, _ := request["stream"].(bool); stream {
+		shape.Streaming = "true"
+	}
+	return shape
+}
+
+func (s RequestShape) dimensions() map[string]string {
+	return map[string]string{
+		ShapePromptTokens: s.PromptTokens,
+		ShapeMaxTokens:    s.MaxTokens,
+		ShapeTemperature:  s.Temperature,
+		ShapeMessages:     s.Messages,
+		ShapeStreaming:    s.Streaming,
+	}
+}
+
+// RequestShapeAnalytics 请求形态分析：抽样的 AI 请求按提示词长度、参数和模型分桶，
+// 以小时为粒度累加到 Redis 计数器中。计数按抽样率的倒数放大，因此报告的是估计的
+// 总请求数；超过保留期的小时桶会被清理。
+type RequestShapeAnalytics struct {
+	client *redis.Client
+	cfg    config.RequestShapeConfig
+	now    func() time.Time
+	random func() float64
+
+	mu     sync.Mutex
+	models map[string]bool // models known to be tracked individually
+}
+
+// NewRequestShapeAnalytics creates analytics storing their counters in client
+func NewRequestShapeAnalytics(client *redis.Client, cfg config.RequestShapeConfig) *RequestShapeAnalytics {
+	return &RequestShapeAnalytics{
+		client: client,
+		cfg:    cfg,
+		now:    time.Now,
+		random: rand.Float64,
+		models: make(map[string]bool),
+	}
+}
+
+var (
+	defaultRequestShapesMu sync.RWMutex
+	defaultRequestShapes   *RequestShapeAnalytics
+)
+
+// SetRequestShapeAnalytics installs the analytics recording chat completions; nil disables recording
+func SetRequestShapeAnalytics(ra *RequestShapeAnalytics) {
+	defaultRequestShapesMu.Lock()
+	defaultRequestShapes = ra
+	defaultRequestShapesMu.Unlock()
+}
+
+// DefaultRequestShapeAnalytics returns the installed analytics, or nil
+func DefaultRequestShapeAnalytics() *RequestShapeAnalytics {
+	defaultRequestShapesMu.RLock()
+	defer defaultRequestShapesMu.RUnlock()
+	return defaultRequestShapes
+}
+
+// hooks records the shape of the request as it is sent upstream; sandbox traffic is skipped
+func (ra *RequestShapeAnalytics) hooks(c *gin.Context) *proxyHooks {
+	return &proxyHooks{
+		request: func(request map[string]interface{}) (bool, error) {
+			if !c.GetBool(middleware.SandboxContextKey) {
+				shape := ShapeOf(request)
+				go func() {
+					ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+					defer cancel()
+					if err := ra.Observe(ctx, shape); err != nil {
+						logrus.WithError(err).Debug("Failed to record request shape")
+					}
+				}()
+			}
+			return false, nil
+		},
+	}
+}
+
+// Observe counts a request shape if it is sampled, weighted by the inverse sample rate
+func (ra *RequestShapeAnalytics) Observe(ctx context.Context, shape RequestShape) error {
+	rate := ra.cfg.SampleRate
+	if rate <= 0 || ra.random() >= rate {
+		return nil
+	}
+	weight := 1 / rate
+
+	model, err := ra.trackedModel(ctx, shape.Model)
+	if err != nil {
+		return err
+	}
+
+	hour := ra.now().UTC().Truncate(time.Hour)
+	key := requestShapeKeyPrefix + hour.Format(requestShapeHour)
+	var added *redis.IntCmd
+	_, err = ra.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HIncrByFloat(ctx, key, shapeField(model, shapeRequests, "total"), weight)
+		for dimension, bucket := range shape.dimensions() {
+			pipe.HIncrByFloat(ctx, key, shapeField(model, dimension, bucket), weight)
+		}
+		pipe.Expire(ctx, key, ra.cfg.Retention+time.Hour)
+		added = pipe.ZAddNX(ctx, requestShapeHoursKey, redis.Z{Score: float64(hour.Unix()), Member: key})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The first request of an hour prunes the buckets that fell out of retention
+	if added.Val() > 0 {
+		return ra.Prune(ctx)
+	}
+	return nil
+}
+
+// trackedModel returns model, or ShapeOtherModel once MaxModels models are tracked
+func (ra *RequestShapeAnalytics) trackedModel(ctx context.Context, model string) (string, error) {
+	if model == "" {
+		model = "unknown"
+	}
+	ra.mu.Lock()
+	known := ra.models[model]
+	ra.mu.Unlock()
+	if known {
+		return model, nil
+	}
+
+	member, err := ra.client.SIsMember(ctx, requestShapeModelsKey, model).Result()
+	if err != nil {
+		return "", err
+	}
+	if !member {
+		count, err := ra.client.SCard(ctx, requestShapeModelsKey).Result()
+		if err != nil {
+			return "", err
+		}
+		if count >= int64(ra.cfg.MaxModels) {
+			return ShapeOtherModel, nil
+		}
+		if err := ra.client.SAdd(ctx, requestShapeModelsKey, model).Err(); err != nil {
+			return "", err
+		}
+	}
+	ra.mu.Lock()
+	ra.models[model] = true
+	ra.mu.Unlock()
+	return model, nil
+}
+
+// Prune deletes the hourly buckets older than the retention period
+func (ra *RequestShapeAnalytics) Prune(ctx context.Context) error {
+	cutoff := ra.now().UTC().Truncate(time.Hour).Add(-ra.cfg.Retention)
+	stale, err := ra.client.ZRangeByScore(ctx, requestShapeHoursKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: "(" + strconv.FormatInt(cutoff.Unix(), 10),
+	}).Result()
+	if err != nil || len(stale) == 0 {
+		return err
+	}
+	members := make([]interface{}, len(stale))
+	for i, key := range stale {
+		members[i] = key
+	}
+	_, err = ra.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, stale...)
+		pipe.ZRem(ctx, requestShapeHoursKey, members...)
+		return nil
+	})
+	return err
+}
+
+func shapeField(model, dimension, bucket string) string {
+	return model + "|" + dimension + "|" + bucket
+}
+
+// RequestShapeDistribution 一组请求的估计请求数和各维度的分桶计数
+type RequestShapeDistribution struct {
+	Requests      float64                       `json:"requests"`
+	Distributions map[string]map[string]float64 `json:"distributions"`
+}
+
+func (d *RequestShapeDistribution) add(dimension, bucket string, count float64) {
+	if dimension == shapeRequests {
+		d.Requests += count
+		return
+	}
+	if d.Distributions == nil {
+		d.Distributions = make(map[string]map[string]float64)
+	}
+	if d.Distributions[dimension] == nil {
+		d.Distributions[dimension] = make(map[string]float64)
+	}
+	d.Distributions[dimension][bucket] += count
+}
+
+func (d *RequestShapeDistribution) round() {
+	d.Requests = math.Round(d.Requests)
+	for _, buckets := range d.Distributions {
+		for bucket, count := range buckets {
+			buckets[bucket] = math.Round(count)
+		}
+	}
+}
+
+// RequestShapeReport 时间窗口内的请求形态分布；按模型分组时每个模型单独列出
+type RequestShapeReport struct {
+	Window     string  `json:"window"`
+	SampleRate float64 `json:"sample_rate"`
+	RequestShapeDistribution
+	Groups map[string]*RequestShapeDistribution `json:"groups,omitempty"`
+}
+
+// errUnknownShapeGroup is returned for group_by values other than model
+var errUnknownShapeGroup = errors.New("group_by must be empty or model")
+
+// Report aggregates the hourly buckets of the last window, capped at the
+// retention period, optionally grouped by model
+func (ra *RequestShapeAnalytics) Report(ctx context.Context, window time.Duration, groupBy string) (*RequestShapeReport, error) {
+	if groupBy != "" && groupBy != "model" {
+		return nil, errUnknownShapeGroup
+	}
+	if window > ra.cfg.Retention {
+		window = ra.cfg.Retention
+	}
+
+	report := &RequestShapeReport{Window: window.String(), SampleRate: ra.cfg.SampleRate}
+	report.Distributions = make(map[string]map[string]float64)
+	if groupBy != "" {
+		report.Groups = make(map[string]*RequestShapeDistribution)
+	}
+
+	// The current, partial hour counts towards the window
+	current := ra.now().UTC().Truncate(time.Hour)
+	hours := int(math.Ceil(window.Hours()))
+	cmds := make([]*redis.MapStringStringCmd, 0, hours)
+	_, err := ra.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i := 0; i < hours; i++ {
+			key := requestShapeKeyPrefix + current.Add(-time.Duration(i)*time.Hour).Format(requestShapeHour)
+			cmds = append(cmds, pipe.HGetAll(ctx, key))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cmd := range cmds {
+		for field, value := range cmd.Val() {
+			parts := strings.SplitN(field, "|", 3)
+			count, err := strconv.ParseFloat(value, 64)
+			if len(parts) != 3 || err != nil {
+				continue
+			}
+			report.add(parts[1], parts[2], count)
+			if report.Groups != nil {
+				group := report.Groups[parts[0]]
+				if group == nil {
+					group = &RequestShapeDistribution{Distributions: make(map[string]map[string]float64)}
+					report.Groups[parts[0]] = group
+				}
+				group.add(parts[1], parts[2], count)
+			}
+		}
+	}
+
+	report.round()
+	for _, group := range report.Groups {
+		group.round()
+	}
+	return report, nil
+}
+
+// GetRequestShapes 返回请求形态分布，window 默认 24h，group_by=model 时按模型分组
+func (h *MonitoringHandler) GetRequestShapes(c *gin.Context) {
+	window, err := time.ParseDuration(c.DefaultQuery("window", "24h"))
+	if err != nil || window <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "window must be a positive duration such as 24h",
+		})
+		return
+	}
+
+	report, err := h.requestShapes.Report(c.Request.Context(), window, c.Query("group_by"))
+	if errors.Is(err, errUnknownShapeGroup) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "Failed to load request shapes",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
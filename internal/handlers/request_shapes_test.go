@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRequestShapes(t *testing.T, cfg config.RequestShapeConfig) (*RequestShapeAnalytics, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRequestShapeAnalytics(client, cfg), mr
+}
+
+func TestRequestShapeBucketBoundaries(t *testing.T) {
+	cases := []struct {
+		buckets []shapeBucket
+		value   float64
+		want    string
+	}{
+		{promptTokenBuckets, 0, "0-256"},
+		{promptTokenBuckets, 255, "0-256"},
+		{promptTokenBuckets, 256, "256-1k"},
+		{promptTokenBuckets, 4095, "1k-4k"},
+		{promptTokenBuckets, 4096, "4k-16k"},
+		{promptTokenBuckets, 32768, "32k+"},
+		{maxTokenBuckets, 1024, "1k-4k"},
+		{temperatureBuckets, 0.49, "0-0.5"},
+		{temperatureBuckets, 1.0, "1-1.5"},
+		{temperatureBuckets, 1.5, "1.5+"},
+		{messageCountBuckets, 1, "1"},
+		{messageCountBuckets, 4, "2-4"},
+		{messageCountBuckets, 5, "5-10"},
+		{messageCountBuckets, 21, "21+"},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, bucketOf(tc.buckets, tc.value), "%v", tc.value)
+	}
+
+	// 4 overhead tokens + 1020 chars / 4 = 259 tokens
+	shape := ShapeOf(map[string]interface{}{
+		"model":    "qwen-turbo",
+		"messages": []interface{}{map[string]interface{}{"role": "user", "content": strings.Repeat("a", 1020)}},
+		"stream":   true,
+		"top_p":    0.9,
+	})
+	assert.Equal(t, RequestShape{
+		Model:        "qwen-turbo",
+		PromptTokens: "256-1k",
+		MaxTokens:    ShapeUnset,
+		Temperature:  ShapeUnset,
+		Messages:     "1",
+		Streaming:    "true",
+	}, shape)
+}
+
+func TestRequestShapeSamplingScalesCounts(t *testing.T) {
+	ra, _ := newTestRequestShapes(t, config.RequestShapeConfig{SampleRate: 0.25, Retention: 24 * time.Hour, MaxModels: 1})
+	draws := []float64{0.1, 0.2, 0.9, 0.3, 0.6, 0.8, 0.5, 0.7}
+	ra.random = func() float64 {
+		draw := draws[0]
+		draws = draws[1:]
+		return draw
+	}
+
+	ctx := context.Background()
+	hot := RequestShape{Model: "qwen-max", PromptTokens: "4k-16k", MaxTokens: "0-256", Temperature: "1.5+", Messages: "2-4", Streaming: "false"}
+	cold := hot
+	cold.Model = "qwen-turbo"
+	cold.Temperature = "0-0.5"
+	for i := 0; i < 4; i++ {
+		require.NoError(t, ra.Observe(ctx, hot))
+		require.NoError(t, ra.Observe(ctx, cold))
+	}
+
+	// Two of the eight draws fall below the 0.25 rate; each sample stands for four requests
+	report, err := ra.Report(ctx, 24*time.Hour, "model")
+	require.NoError(t, err)
+	assert.Equal(t, float64(8), report.Requests)
+	assert.Equal(t, float64(4), report.Distributions[ShapeTemperature]["1.5+"])
+	assert.Equal(t, float64(4), report.Distributions[ShapeTemperature]["0-0.5"])
+
+	// Only one model is tracked by name; the second is counted as other
+	require.Len(t, report.Groups, 2)
+	assert.Equal(t, float64(4), report.Groups["qwen-max"].Requests)
+	assert.Equal(t, float64(4), report.Groups[ShapeOtherModel].Requests)
+
+	_, err = ra.Report(ctx, time.Hour, "tenant")
+	assert.ErrorIs(t, err, errUnknownShapeGroup)
+}
+
+func TestRequestShapeRetentionPrunesOldHours(t *testing.T) {
+	ra, mr := newTestRequestShapes(t, config.RequestShapeConfig{SampleRate: 1, Retention: 3 * time.Hour, MaxModels: 10})
+	now := time.Date(2026, 3, 1, 10, 15, 0, 0, time.UTC)
+	ra.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	shape := RequestShape{Model: "qwen-turbo", PromptTokens: "0-256", MaxTokens: ShapeUnset, Temperature: ShapeUnset, Messages: "1", Streaming: "false"}
+	require.NoError(t, ra.Observe(ctx, shape))
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, ra.Observe(ctx, shape))
+	assert.True(t, mr.Exists(requestShapeKeyPrefix+"2026030110"))
+
+	// The first request of 14:00 prunes the 10:00 bucket, which is older than three hours
+	now = now.Add(2 * time.Hour)
+	require.NoError(t, ra.Observe(ctx, shape))
+	assert.False(t, mr.Exists(requestShapeKeyPrefix+"2026030110"))
+	assert.True(t, mr.Exists(requestShapeKeyPrefix+"2026030112"))
+	hours, err := mr.ZMembers(requestShapeHoursKey)
+	require.NoError(t, err)
+	assert.Equal(t, []string{requestShapeKeyPrefix + "2026030112", requestShapeKeyPrefix + "2026030114"}, hours)
+
+	// Windows longer than the retention are capped
+	report, err := ra.Report(ctx, 48*time.Hour, "")
+	require.NoError(t, err)
+	assert.Equal(t, "3h0m0s", report.Window)
+	assert.Equal(t, float64(2), report.Requests)
+}
+
+func TestRequestShapesEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ra, _ := newTestRequestShapes(t, config.RequestShapeConfig{SampleRate: 1, Retention: 24 * time.Hour, MaxModels: 10})
+	require.NoError(t, ra.Observe(context.Background(), ShapeOf(map[string]interface{}{
+		"model":       "qwen-plus",
+		"messages":    []interface{}{map[string]interface{}{"role": "user", "content": "hi"}},
+		"temperature": 1.8,
+	})))
+
+	h := NewMonitoringHandler(nil, nil, nil, nil, nil)
+	h.SetRequestShapes(ra)
+	r := gin.New()
+	RegisterMonitoringRoutes(r, h)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/monitoring/request-shapes?window=24h&group_by=model", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data RequestShapeReport `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, float64(1), resp.Data.Requests)
+	assert.Equal(t, float64(1), resp.Data.Groups["qwen-plus"].Distributions[ShapeTemperature]["1.5+"])
+
+	for _, query := range []string{"window=soon", "window=-1h", "group_by=tenant"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/monitoring/request-shapes?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
@@ -0,0 +1,615 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Response statuses of the Responses API
+const (
+	ResponseStatusInProgress = "in_progress"
+	ResponseStatusCompleted  = "completed"
+	ResponseStatusIncomplete = "incomplete"
+)
+
+// featureNotSupportedError 网关无法转换为聊天补全的 Responses API 功能
+type featureNotSupportedError string
+
+func (e featureNotSupportedError) Error() string { return string(e) }
+
+// responsesPassthroughFields are Responses request fields with the same meaning in chat completions
+var responsesPassthroughFields = []string{"model", "temperature", "top_p", "user", "parallel_tool_calls", "stream"}
+
+func responsesError(c *gin.Context, err error) {
+	code := "invalid_request"
+	var unsupported featureNotSupportedError
+	if errors.As(err, &unsupported) {
+		code = "feature_not_supported"
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"message": err.Error(),
+			"type":    "invalid_request_error",
+			"code":    code,
+		},
+	})
+}
+
+// Responses serves the OpenAI Responses API (POST /v1/responses) on top of
+// chat completions: the request is translated into a chat request, handled by
+// the standard chat pipeline, and the result translated back, including the
+// response.* streaming events. The gateway keeps no responses, so stateful
+// features such as previous_response_id and built-in tools are rejected.
+func Responses(cfg *config.Config) gin.HandlerFunc {
+	chat := ChatCompletions(cfg)
+	return func(c *gin.Context) {
+		var request map[string]interface{}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			responsesError(c, fmt.Errorf("Invalid JSON format"))
+			return
+		}
+		chatRequest, err := responsesToChat(request)
+		if err != nil {
+			responsesError(c, err)
+			return
+		}
+		body, err := json.Marshal(chatRequest)
+		if err != nil {
+			responsesError(c, err)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Request.ContentLength = int64(len(body))
+
+		original := c.Writer
+		writer := &contractResponseWriter{ResponseWriter: original, unbounded: true}
+		c.Writer = writer
+		chat(c)
+		c.Writer = original
+		if writer.passthrough {
+			return
+		}
+
+		status := writer.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		contentType := writer.Header().Get("Content-Type")
+		// Errors already use the OpenAI error object the Responses API shares
+		if status >= http.StatusMultipleChoices {
+			c.Data(status, contentType, writer.buf.Bytes())
+			return
+		}
+		c.Writer.Header().Del("Content-Length")
+
+		completion, err := readChatCompletion(contentType, writer.buf.Bytes())
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "api_response_error",
+					"code":    "response_error",
+				},
+			})
+			return
+		}
+
+		if stream, _ := request["stream"].(bool); stream {
+			writeResponseEvents(c, request, completion)
+			return
+		}
+		c.JSON(http.StatusOK, completion.response(request, newResponsesID("msg_")))
+	}
+}
+
+// responsesToChat translates a Responses API request into a chat completion request
+func responsesToChat(request map[string]interface{}) (map[string]interface{}, error) {
+	for _, field := range []string{"previous_response_id", "conversation", "prompt"} {
+		if request[field] != nil {
+			return nil, featureNotSupportedError(field + " is not supported: the gateway does not store responses, send the full conversation as input")
+		}
+	}
+	if background, _ := request["background"].(bool); background {
+		return nil, featureNotSupportedError("background responses are not supported")
+	}
+
+	chat := make(map[string]interface{})
+	for _, field := range responsesPassthroughFields {
+		if value, ok := request[field]; ok {
+			chat[field] = value
+		}
+	}
+	if stream, _ := request["stream"].(bool); stream {
+		chat["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	if maxTokens, ok := request["max_output_tokens"]; ok {
+		chat["max_tokens"] = maxTokens
+	}
+	if reasoning, ok := request["reasoning"].(map[string]interface{}); ok && reasoning["effort"] != nil {
+		chat["reasoning_effort"] = reasoning["effort"]
+	}
+	if text, ok := request["text"].(map[string]interface{}); ok {
+		if format, ok := text["format"].(map[string]interface{}); ok {
+			chat["response_format"] = responsesTextFormat(format)
+		}
+	}
+
+	if rawTools, ok := request["tools"].([]interface{}); ok && len(rawTools) > 0 {
+		tools := make([]interface{}, 0, len(rawTools))
+		for _, raw := range rawTools {
+			tool, _ := raw.(map[string]interface{})
+			if kind, _ := tool["type"].(string); kind != "function" {
+				return nil, featureNotSupportedError(fmt.Sprintf("built-in tool %q is not supported, only function tools are", kind))
+			}
+			function := make(map[string]interface{})
+			for _, field := range []string{"name", "description", "parameters", "strict"} {
+				if value, ok := tool[field]; ok {
+					function[field] = value
+				}
+			}
+			tools = append(tools, map[string]interface{}{"type": "function", "function": function})
+		}
+		chat["tools"] = tools
+	}
+	if choice, ok := request["tool_choice"]; ok {
+		if named, ok := choice.(map[string]interface{}); ok {
+			if named["type"] != "function" {
+				return nil, featureNotSupportedError(fmt.Sprintf("tool_choice %v is not supported", named["type"]))
+			}
+			choice = map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": named["name"]}}
+		}
+		chat["tool_choice"] = choice
+	}
+
+	var messages []interface{}
+	if instructions, _ := request["instructions"].(string); instructions != "" {
+		messages = append(messages, map[string]interface{}{"role": "system", "content": instructions})
+	}
+	switch input := request["input"].(type) {
+	case string:
+		messages = append(messages, map[string]interface{}{"role": "user", "content": input})
+	case []interface{}:
+		for _, raw := range input {
+			item, ok := raw.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("input items must be objects")
+			}
+			var err error
+			if messages, err = appendInputItem(messages, item); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("input must be a string or an array of input items")
+	}
+	if len(messages) == 0 {
+		return nil, fmt.Errorf("input is required")
+	}
+	chat["messages"] = messages
+	return chat, nil
+}
+
+// responsesTextFormat maps text.format to the chat response_format
+func responsesTextFormat(format map[string]interface{}) map[string]interface{} {
+	if format["type"] != "json_schema" {
+		return map[string]interface{}{"type": format["type"]}
+	}
+	schema := make(map[string]interface{})
+	for _, field := range []string{"name", "description", "schema", "strict"} {
+		if value, ok := format[field]; ok {
+			schema[field] = value
+		}
+	}
+	return map[string]interface{}{"type": "json_schema", "json_schema": schema}
+}
+
+// appendInputItem appends the chat message an input item translates to
+func appendInputItem(messages []interface{}, item map[string]interface{}) ([]interface{}, error) {
+	kind, _ := item["type"].(string)
+	switch kind {
+	case "", "message":
+		role, _ := item["role"].(string)
+		switch role {
+		case "user", "assistant", "system":
+		case "developer":
+			// Not every OpenAI-compatible upstream knows the developer role
+			role = "system"
+		default:
+			return nil, fmt.Errorf("unsupported message role %q", role)
+		}
+		content, err := inputContent(role, item["content"])
+		if err != nil {
+			return nil, err
+		}
+		return append(messages, map[string]interface{}{"role": role, "content": content}), nil
+
+	case "function_call":
+		call := map[string]interface{}{
+			"id":       item["call_id"],
+			"type":     "function",
+			"function": map[string]interface{}{"name": item["name"], "arguments": item["arguments"]},
+		}
+		// Consecutive calls belong to one assistant turn
+		if n := len(messages); n > 0 {
+			if last, _ := messages[n-1].(map[string]interface{}); last["role"] == "assistant" {
+				if calls, ok := last["tool_calls"].([]interface{}); ok {
+					last["tool_calls"] = append(calls, call)
+					return messages, nil
+				}
+			}
+		}
+		return append(messages, map[string]interface{}{"role": "assistant", "content": nil, "tool_calls": []interface{}{call}}), nil
+
+	case "function_call_output":
+		output, ok := item["output"].(string)
+		if !ok {
+			raw, _ := json.Marshal(item["output"])
+			output = string(raw)
+		}
+		return append(messages, map[string]interface{}{"role": "tool", "tool_call_id": item["call_id"], "content": output}), nil
+
+	case "item_reference":
+		return nil, featureNotSupportedError("item_reference input items are not supported: the gateway does not store responses")
+	}
+	return nil, featureNotSupportedError(fmt.Sprintf("input item type %q is not supported", kind))
+}
+
+// inputContent translates message content parts into chat content
+func inputContent(role string, raw interface{}) (interface{}, error) {
+	switch content := raw.(type) {
+	case string:
+		return content, nil
+	case []interface{}:
+		var parts []interface{}
+		var text strings.Builder
+		for _, rawPart := range content {
+			part, _ := rawPart.(map[string]interface{})
+			kind, _ := part["type"].(string)
+			switch kind {
+			case "input_text", "output_text":
+				value, _ := part["text"].(string)
+				text.WriteString(value)
+				parts = append(parts, map[string]interface{}{"type": "text", "text": value})
+			case "input_image":
+				url, _ := part["image_url"].(string)
+				if url == "" {
+					return nil, featureNotSupportedError("input_image parts must carry an image_url; file_id references are not supported")
+				}
+				image := map[string]interface{}{"url": url}
+				if detail, ok := part["detail"]; ok {
+					image["detail"] = detail
+				}
+				parts = append(parts, map[string]interface{}{"type": "image_url", "image_url": image})
+			default:
+				return nil, featureNotSupportedError(fmt.Sprintf("content part type %q is not supported", kind))
+			}
+		}
+		// Only user messages may carry multimodal parts
+		if role != "user" {
+			return text.String(), nil
+		}
+		return parts, nil
+	}
+	return nil, fmt.Errorf("message content must be a string or an array of content parts")
+}
+
+// chatCompletion is what the translation needs from a chat completion,
+// whether it arrived as one JSON object or as stream chunks
+type chatCompletion struct {
+	id           string
+	model        string
+	created      int64
+	content      strings.Builder
+	deltas       []string // content in the order it streamed
+	refusal      string
+	toolCalls    map[int]map[string]interface{}
+	finishReason string
+	usage        map[string]interface{}
+}
+
+// readChatCompletion decodes a chat completion response or event stream
+func readChatCompletion(contentType string, body []byte) (*chatCompletion, error) {
+	completion := &chatCompletion{toolCalls: make(map[int]map[string]interface{})}
+	if !strings.Contains(contentType, "text/event-stream") {
+		var resp map[string]interface{}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			return nil, fmt.Errorf("Target API returned an invalid chat completion")
+		}
+		completion.add(resp, "message")
+		return completion, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), MaxRequestBodySize)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if data = strings.TrimSpace(data); !ok || data == "" || data == "[DONE]" {
+			continue
+		}
+		var chunk map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("Target API returned an invalid stream chunk")
+		}
+		completion.add(chunk, "delta")
+	}
+	return completion, scanner.Err()
+}
+
+// add merges a response or stream chunk; field is "message" or "delta"
+func (cc *chatCompletion) add(chunk map[string]interface{}, field string) {
+	if id, _ := chunk["id"].(string); id != "" {
+		cc.id = id
+	}
+	if model, _ := chunk["model"].(string); model != "" {
+		cc.model = model
+	}
+	if created, ok := chunk["created"].(float64); ok {
+		cc.created = int64(created)
+	}
+	if usage, ok := chunk["usage"].(map[string]interface{}); ok {
+		cc.usage = usage
+	}
+
+	choices, _ := chunk["choices"].([]interface{})
+	if len(choices) == 0 {
+		return
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	if reason, _ := choice["finish_reason"].(string); reason != "" {
+		cc.finishReason = reason
+	}
+	message, _ := choice[field].(map[string]interface{})
+	if content, _ := message["content"].(string); content != "" {
+		cc.content.WriteString(content)
+		cc.deltas = append(cc.deltas, content)
+	}
+	if refusal, _ := message["refusal"].(string); refusal != "" {
+		cc.refusal += refusal
+	}
+	calls, _ := message["tool_calls"].([]interface{})
+	for i, raw := range calls {
+		call, _ := raw.(map[string]interface{})
+		index := i
+		if streamed, ok := call["index"].(float64); ok {
+			index = int(streamed)
+		}
+		merged := cc.toolCalls[index]
+		if merged == nil {
+			merged = map[string]interface{}{"arguments": ""}
+			cc.toolCalls[index] = merged
+		}
+		if id, _ := call["id"].(string); id != "" {
+			merged["call_id"] = id
+		}
+		function, _ := call["function"].(map[string]interface{})
+		if name, _ := function["name"].(string); name != "" {
+			merged["name"] = name
+		}
+		if arguments, _ := function["arguments"].(string); arguments != "" {
+			merged["arguments"] = merged["arguments"].(string) + arguments
+		}
+	}
+}
+
+// messageItem is the assistant message output item, or nil when the model only called tools
+func (cc *chatCompletion) messageItem(id, status string) map[string]interface{} {
+	if cc.content.Len() == 0 && cc.refusal == "" && len(cc.toolCalls) > 0 {
+		return nil
+	}
+	content := []interface{}{}
+	if status == ResponseStatusCompleted || status == ResponseStatusIncomplete {
+		if cc.content.Len() > 0 || cc.refusal == "" {
+			content = append(content, outputTextPart(cc.content.String()))
+		}
+		if cc.refusal != "" {
+			content = append(content, map[string]interface{}{"type": "refusal", "refusal": cc.refusal})
+		}
+	}
+	return map[string]interface{}{"type": "message", "id": id, "status": status, "role": "assistant", "content": content}
+}
+
+// functionCallItems are the tool calls as function_call output items, in call order
+func (cc *chatCompletion) functionCallItems() []map[string]interface{} {
+	indexes := make([]int, 0, len(cc.toolCalls))
+	for index := range cc.toolCalls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	items := make([]map[string]interface{}, 0, len(indexes))
+	for _, index := range indexes {
+		call := cc.toolCalls[index]
+		items = append(items, map[string]interface{}{
+			"type":      "function_call",
+			"id":        newResponsesID("fc_"),
+			"call_id":   call["call_id"],
+			"name":      call["name"],
+			"arguments": call["arguments"],
+			"status":    ResponseStatusCompleted,
+		})
+	}
+	return items
+}
+
+// status maps the chat finish reason to the response status and incomplete details
+func (cc *chatCompletion) status() (string, interface{}) {
+	switch cc.finishReason {
+	case "length":
+		return ResponseStatusIncomplete, map[string]interface{}{"reason": "max_output_tokens"}
+	case "content_filter":
+		return ResponseStatusIncomplete, map[string]interface{}{"reason": "content_filter"}
+	}
+	return ResponseStatusCompleted, nil
+}
+
+// response builds the final response object; messageID names the message output item
+func (cc *chatCompletion) response(request map[string]interface{}, messageID string) map[string]interface{} {
+	status, incomplete := cc.status()
+	output := []interface{}{}
+	if item := cc.messageItem(messageID, status); item != nil {
+		output = append(output, item)
+	}
+	for _, item := range cc.functionCallItems() {
+		output = append(output, item)
+	}
+
+	resp := cc.responseObject(request, status)
+	resp["output"] = output
+	resp["incomplete_details"] = incomplete
+	resp["usage"] = responsesUsage(cc.usage)
+	return resp
+}
+
+// responseObject is the response envelope without output
+func (cc *chatCompletion) responseObject(request map[string]interface{}, status string) map[string]interface{} {
+	id := "resp_" + strings.TrimPrefix(cc.id, "chatcmpl-")
+	if cc.id == "" {
+		id = newResponsesID("resp_")
+	}
+	created := cc.created
+	if created == 0 {
+		created = time.Now().Unix()
+	}
+	model := cc.model
+	if model == "" {
+		model, _ = request["model"].(string)
+	}
+	resp := map[string]interface{}{
+		"id":                 id,
+		"object":             "response",
+		"created_at":         created,
+		"status":             status,
+		"model":              model,
+		"output":             []interface{}{},
+		"error":              nil,
+		"incomplete_details": nil,
+		"usage":              nil,
+	}
+	for _, field := range []string{"instructions", "max_output_tokens", "metadata", "temperature", "top_p", "tool_choice", "tools", "text"} {
+		resp[field] = request[field]
+	}
+	return resp
+}
+
+func outputTextPart(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "output_text", "text": text, "annotations": []interface{}{}}
+}
+
+// responsesUsage renames chat token usage to the Responses API fields
+func responsesUsage(usage map[string]interface{}) interface{} {
+	if usage == nil {
+		return nil
+	}
+	cached, reasoning := 0.0, 0.0
+	if details, ok := usage["prompt_tokens_details"].(map[string]interface{}); ok {
+		cached, _ = details["cached_tokens"].(float64)
+	}
+	if details, ok := usage["completion_tokens_details"].(map[string]interface{}); ok {
+		reasoning, _ = details["reasoning_tokens"].(float64)
+	}
+	return map[string]interface{}{
+		"input_tokens":          usage["prompt_tokens"],
+		"input_tokens_details":  map[string]interface{}{"cached_tokens": cached},
+		"output_tokens":         usage["completion_tokens"],
+		"output_tokens_details": map[string]interface{}{"reasoning_tokens": reasoning},
+		"total_tokens":          usage["total_tokens"],
+	}
+}
+
+// responseEventWriter numbers and writes Responses API server-sent events
+type responseEventWriter struct {
+	w        io.Writer
+	sequence int
+}
+
+func (e *responseEventWriter) emit(event string, payload map[string]interface{}) {
+	payload["type"] = event
+	payload["sequence_number"] = e.sequence
+	e.sequence++
+	data, _ := json.Marshal(payload)
+	fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, data)
+}
+
+// writeResponseEvents replays a chat completion as the Responses API event stream
+func writeResponseEvents(c *gin.Context, request map[string]interface{}, cc *chatCompletion) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	events := &responseEventWriter{w: c.Writer}
+
+	inProgress := cc.responseObject(request, ResponseStatusInProgress)
+	events.emit("response.created", map[string]interface{}{"response": inProgress})
+	events.emit("response.in_progress", map[string]interface{}{"response": inProgress})
+
+	messageID := newResponsesID("msg_")
+	final := cc.response(request, messageID)
+	status, _ := final["status"].(string)
+	for index, raw := range final["output"].([]interface{}) {
+		item := raw.(map[string]interface{})
+		switch item["type"] {
+		case "message":
+			events.emit("response.output_item.added", map[string]interface{}{
+				"output_index": index,
+				"item":         cc.messageItem(messageID, ResponseStatusInProgress),
+			})
+			events.emit("response.content_part.added", map[string]interface{}{
+				"item_id": messageID, "output_index": index, "content_index": 0, "part": outputTextPart(""),
+			})
+			for _, delta := range cc.deltas {
+				events.emit("response.output_text.delta", map[string]interface{}{
+					"item_id": messageID, "output_index": index, "content_index": 0, "delta": delta,
+				})
+			}
+			text := cc.content.String()
+			events.emit("response.output_text.done", map[string]interface{}{
+				"item_id": messageID, "output_index": index, "content_index": 0, "text": text,
+			})
+			events.emit("response.content_part.done", map[string]interface{}{
+				"item_id": messageID, "output_index": index, "content_index": 0, "part": outputTextPart(text),
+			})
+
+		case "function_call":
+			added := make(map[string]interface{}, len(item))
+			for key, value := range item {
+				added[key] = value
+			}
+			added["arguments"], added["status"] = "", ResponseStatusInProgress
+			events.emit("response.output_item.added", map[string]interface{}{"output_index": index, "item": added})
+			events.emit("response.function_call_arguments.delta", map[string]interface{}{
+				"item_id": item["id"], "output_index": index, "delta": item["arguments"],
+			})
+			events.emit("response.function_call_arguments.done", map[string]interface{}{
+				"item_id": item["id"], "output_index": index, "arguments": item["arguments"],
+			})
+		}
+		events.emit("response.output_item.done", map[string]interface{}{"output_index": index, "item": item})
+	}
+
+	if status == ResponseStatusIncomplete {
+		events.emit("response.incomplete", map[string]interface{}{"response": final})
+	} else {
+		events.emit("response.completed", map[string]interface{}{"response": final})
+	}
+	c.Writer.Flush()
+}
+
+func newResponsesID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeActionsKey gin上下文中保存匹配路由Actions的键
+const routeActionsKey = "route_actions"
+
+// routeFor returns the enabled route matching the request. Of several matches
+// the one with the highest priority wins, then the most specific path.
+func (h *ServiceHandler) routeFor(method, path string, header http.Header) (Route, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var best Route
+	bestSpecificity, found := 0, false
+	for _, route := range h.routes {
+		if !route.Enabled || !routeMethodMatch(route.Method, method) {
+			continue
+		}
+		specificity, ok := routePathMatch(route.Path, path)
+		if !ok || !routeHeadersMatch(route.Conditions, header) {
+			continue
+		}
+		if !found || route.Priority > best.Priority ||
+			(route.Priority == best.Priority && specificity > bestSpecificity) {
+			best, bestSpecificity, found = route, specificity, true
+		}
+	}
+	return best, found
+}
+
+// mockFor returns the compiled mock of a route version, nil when it is not mocked
+func (h *ServiceHandler) mockFor(route Route) *routeMock {
+	if contract := h.compiledContract(route); contract != nil {
+		return contract.mock
+	}
+	return nil
+}
+
+// RouteActionsMiddleware exposes the actions and mock of the route matching the request to handlers
+// and applies the route's response headers
+func (h *ServiceHandler) RouteActionsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if route, ok := h.routeFor(c.Request.Method, c.Request.URL.Path, c.Request.Header); ok {
+			h.recordRouteHit(route.ID)
+			if len(route.Actions) > 0 {
+				c.Set(routeActionsKey, route.Actions)
+			}
+			if mock := h.mockFor(route); mock != nil {
+				c.Set(routeMockKey, mock)
+			}
+			if headers := h.responseHeadersFor(route); headers != nil {
+				writer := &responseHeaderWriter{ResponseWriter: c.Writer, ctx: c, headers: headers}
+				c.Writer = writer
+				c.Next()
+				// Bodiless responses are flushed by gin without passing through the wrapper
+				writer.applyOnce()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// routeActions returns the actions of the matched route, nil when none matched
+func routeActions(c *gin.Context) map[string]interface{} {
+	actions, _ := c.Get(routeActionsKey)
+	m, _ := actions.(map[string]interface{})
+	return m
+}
+
+// RouteTraceRequest 路由试运行请求：描述一个假想的客户端请求，Body可选，用于检查请求契约
+type RouteTraceRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path" binding:"required"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// RouteTrace 试运行结果：匹配到的路由、其契约以及请求/响应头的处置
+type RouteTrace struct {
+	Matched              bool              `json:"matched"`
+	RouteID              string            `json:"routeId,omitempty"`
+	RouteName            string            `json:"routeName,omitempty"`
+	Target               string            `json:"target,omitempty"`
+	Mocked               bool              `json:"mocked"`
+	RequestSchema        json.RawMessage   `json:"requestSchema,omitempty"`
+	ResponseSchema       json.RawMessage   `json:"responseSchema,omitempty"`
+	ResponseContractMode string            `json:"responseContractMode,omitempty"`
+	RequestValidated     bool              `json:"requestValidated"` // the body was checked against the request schema
+	RequestViolations    []SchemaViolation `json:"requestViolations,omitempty"`
+	RequestHeaders       HeaderDisposition `json:"requestHeaders"`
+	ResponseHeaders      []string          `json:"responseHeaders"` // allow-listed upstream response header patterns
+}
+
+// TraceRoute dry-runs a request through route matching, the request contract
+// and the header policy without contacting the upstream
+func (h *ServiceHandler) TraceRoute(c *gin.Context) {
+	var req RouteTraceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid request body",
+				"details": err.Error(),
+			},
+		})
+		return
+	}
+	if req.Method == "" {
+		req.Method = http.MethodPost
+	}
+
+	in := make(http.Header, len(req.Headers))
+	for key, value := range req.Headers {
+		in.Set(key, value)
+	}
+
+	var trace RouteTrace
+	var opts *HeaderOptions
+	if route, ok := h.routeFor(req.Method, req.Path, in); ok {
+		trace.Matched = true
+		trace.RouteID = route.ID
+		trace.RouteName = route.Name
+		trace.Target = route.Target
+		trace.Mocked = h.mockFor(route) != nil
+		trace.RequestSchema = route.RequestSchema
+		trace.ResponseSchema = route.ResponseSchema
+		trace.ResponseContractMode = route.ResponseContractMode
+		opts = routeHeaderOptions(route.Actions)
+
+		// Bodies the proxy would pass unchecked are not validated here either
+		contract := h.compiledContract(route)
+		if contract != nil && contract.request != nil && len(req.Body) > 0 && len(req.Body) <= MaxContractValidationSize {
+			violations, err := validateBody(contract.request, req.Body)
+			if err != nil {
+				violations = []SchemaViolation{{Pointer: "/", Message: err.Error()}}
+			}
+			trace.RequestValidated = true
+			trace.RequestViolations = violations
+		}
+	}
+
+	policy := DefaultHeaderPolicy()
+	trace.RequestHeaders = policy.ApplyRequest(in, make(http.Header), opts)
+	trace.ResponseHeaders = policy.ResponseAllowList(opts)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    trace,
+	})
+}
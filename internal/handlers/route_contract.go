@@ -0,0 +1,358 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Response contract violation handling modes
+const (
+	ContractModeLog    = "log"    // Only log the violation
+	ContractModeHeader = "header" // Pass the response through with an X-Contract-Warning header
+	ContractModeReject = "reject" // Replace the response with 502 upstream_contract_violation
+)
+
+// MaxContractValidationSize bodies larger than this are passed through without validation
+const MaxContractValidationSize = 1 << 20 // 1MB
+
+// errNotJSON is returned when a body that must satisfy a schema is not JSON
+var errNotJSON = errors.New("body is not valid JSON")
+
+// SchemaViolation describes a single schema failure at a JSON pointer
+type SchemaViolation struct {
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+// routeContract holds the compiled schemas for one version of a route
+type routeContract struct {
+	version  int
+	request  *jsonschema.Schema
+	response *jsonschema.Schema
+	mock     *routeMock // set when the route answers with a mock response
+
+	responseHeaders *routeResponseHeaders // set when the route adds or removes response headers
+}
+
+// compileSchema compiles a draft 2020-12 JSON Schema document
+func compileSchema(url string, doc json.RawMessage) (*jsonschema.Schema, error) {
+	if len(doc) == 0 {
+		return nil, nil
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	if err := compiler.AddResource(url, bytes.NewReader(doc)); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(url)
+}
+
+// compileRouteContract validates and compiles the schemas attached to a route
+func compileRouteContract(route *Route) (*routeContract, error) {
+	switch route.ResponseContractMode {
+	case "", ContractModeLog, ContractModeHeader, ContractModeReject:
+	default:
+		return nil, fmt.Errorf("invalid responseContractMode %q", route.ResponseContractMode)
+	}
+
+	contract := &routeContract{version: route.Version}
+
+	var err error
+	if contract.request, err = compileSchema("route://contract/request.json", route.RequestSchema); err != nil {
+		return nil, fmt.Errorf("invalid requestSchema: %w", err)
+	}
+	if contract.response, err = compileSchema("route://contract/response.json", route.ResponseSchema); err != nil {
+		return nil, fmt.Errorf("invalid responseSchema: %w", err)
+	}
+	if contract.mock, err = compileRouteMock(route.Actions); err != nil {
+		return nil, err
+	}
+	if _, err = compileHeaderOptions(route.Actions); err != nil {
+		return nil, err
+	}
+	if contract.responseHeaders, err = compileResponseHeaders(route.Actions); err != nil {
+		return nil, err
+	}
+	if _, err = compileRouteTimeout(route.Actions); err != nil {
+		return nil, err
+	}
+	if _, err = compileRouteRateLimit(route.Actions); err != nil {
+		return nil, err
+	}
+	if _, err = routeHeaderConditions(route.Conditions); err != nil {
+		return nil, err
+	}
+	return contract, nil
+}
+
+// validateBody validates a JSON body against a schema and returns the failing pointers
+func validateBody(schema *jsonschema.Schema, body []byte) ([]SchemaViolation, error) {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, errNotJSON
+	}
+
+	err := schema.Validate(doc)
+	if err == nil {
+		return nil, nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, err
+	}
+
+	var violations []SchemaViolation
+	for _, e := range validationErr.BasicOutput().Errors {
+		// 只保留叶子错误，父级错误只是汇总信息
+		if strings.HasPrefix(e.Error, "doesn't validate with") {
+			continue
+		}
+		pointer := e.InstanceLocation
+		if pointer == "" {
+			pointer = "/"
+		}
+		violations = append(violations, SchemaViolation{Pointer: pointer, Message: e.Error})
+	}
+	if len(violations) == 0 {
+		violations = append(violations, SchemaViolation{Pointer: "/", Message: validationErr.Message})
+	}
+	return violations, nil
+}
+
+// compiledContract returns the compiled contract of a route version, nil when
+// the route changed since it was compiled
+func (h *ServiceHandler) compiledContract(route Route) *routeContract {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	contract := h.contracts[route.ID]
+	if contract == nil || contract.version != route.Version {
+		return nil
+	}
+	return contract
+}
+
+// contractFor returns the compiled contract of the route matching the request,
+// matched like the route proxy does, so prefix routes are enforced as well
+func (h *ServiceHandler) contractFor(method, path string, header http.Header) (string, string, *routeContract) {
+	route, ok := h.routeFor(method, path, header)
+	if !ok {
+		return "", "", nil
+	}
+	contract := h.compiledContract(route)
+	if contract == nil {
+		return "", "", nil
+	}
+	return route.ID, route.ResponseContractMode, contract
+}
+
+// RouteContractMiddleware enforces per-route request/response JSON schema contracts
+func (h *ServiceHandler) RouteContractMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		routeID, mode, contract := h.contractFor(c.Request.Method, c.Request.URL.Path, c.Request.Header)
+		if contract == nil || (contract.request == nil && contract.response == nil) {
+			c.Next()
+			return
+		}
+
+		if contract.request != nil && c.Request.Body != nil &&
+			c.Request.ContentLength <= MaxContractValidationSize {
+			body, err := io.ReadAll(io.LimitReader(c.Request.Body, MaxContractValidationSize+1))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": gin.H{
+						"message": "Failed to read request body",
+						"type":    "invalid_request_error",
+						"code":    "bad_request",
+					},
+				})
+				c.Abort()
+				return
+			}
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+
+			if len(body) <= MaxContractValidationSize {
+				violations, err := validateBody(contract.request, body)
+				if err != nil {
+					middleware.RecordSchemaViolation(routeID, "request", "/")
+					c.JSON(http.StatusBadRequest, gin.H{
+						"error": gin.H{
+							"message": "Request body must be valid JSON",
+							"type":    "validation_error",
+							"code":    "invalid_json",
+						},
+					})
+					c.Abort()
+					return
+				}
+				if len(violations) > 0 {
+					for _, v := range violations {
+						middleware.RecordSchemaViolation(routeID, "request", v.Pointer)
+					}
+					c.JSON(http.StatusBadRequest, gin.H{
+						"error": gin.H{
+							"message":    "Request body does not match the route contract",
+							"type":       "validation_error",
+							"code":       "request_contract_violation",
+							"violations": violations,
+						},
+					})
+					c.Abort()
+					return
+				}
+			}
+		}
+
+		if contract.response == nil {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		writer := &contractResponseWriter{ResponseWriter: original}
+		c.Writer = writer
+		c.Next()
+		c.Writer = original
+
+		if writer.passthrough {
+			logrus.WithField("route", routeID).Debug("Response too large or streamed, skipped contract validation")
+			return
+		}
+		writer.finish(routeID, mode, contract.response)
+	}
+}
+
+// contractResponseWriter buffers responses for validation and falls back to
+// streaming once the body exceeds MaxContractValidationSize or is flushed
+type contractResponseWriter struct {
+	gin.ResponseWriter
+	buf         bytes.Buffer
+	status      int
+	passthrough bool
+	unbounded   bool // buffer the whole body, even when the handler flushes a stream
+}
+
+func (w *contractResponseWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *contractResponseWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *contractResponseWriter) Write(data []byte) (int, error) {
+	if !w.passthrough && !w.unbounded && w.buf.Len()+len(data) > MaxContractValidationSize {
+		w.startPassthrough()
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+func (w *contractResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *contractResponseWriter) Status() int {
+	if w.passthrough || w.status == 0 {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *contractResponseWriter) Written() bool {
+	return w.passthrough || w.status != 0 || w.buf.Len() > 0
+}
+
+// Flush 流式响应无法整体校验，直接切换为透传；unbounded 时继续缓冲，由调用方整体转换
+func (w *contractResponseWriter) Flush() {
+	if w.unbounded {
+		return
+	}
+	w.startPassthrough()
+	w.ResponseWriter.Flush()
+}
+
+func (w *contractResponseWriter) startPassthrough() {
+	if w.passthrough {
+		return
+	}
+	w.passthrough = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.buf.Len() > 0 {
+		w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+// finish validates the buffered response and writes it according to mode
+func (w *contractResponseWriter) finish(routeID, mode string, schema *jsonschema.Schema) {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	body := w.buf.Bytes()
+	var violations []SchemaViolation
+	if status < 300 && strings.Contains(w.Header().Get("Content-Type"), "json") && len(body) > 0 {
+		var err error
+		violations, err = validateBody(schema, body)
+		if err != nil {
+			violations = []SchemaViolation{{Pointer: "/", Message: err.Error()}}
+		}
+	}
+
+	if len(violations) > 0 {
+		for _, v := range violations {
+			middleware.RecordSchemaViolation(routeID, "response", v.Pointer)
+		}
+		logrus.WithFields(logrus.Fields{
+			"route":      routeID,
+			"violations": violations,
+		}).Warn("Upstream response violates route contract")
+
+		switch mode {
+		case ContractModeHeader:
+			w.Header().Set("X-Contract-Warning", fmt.Sprintf("response violates route contract at %s", violations[0].Pointer))
+		case ContractModeReject:
+			body, _ = json.Marshal(gin.H{
+				"error": gin.H{
+					"message":    "Upstream response does not match the route contract",
+					"type":       "api_response_error",
+					"code":       "upstream_contract_violation",
+					"violations": violations,
+				},
+			})
+			status = http.StatusBadGateway
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		}
+	}
+
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(status)
+	w.ResponseWriter.Write(body)
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRequestSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["model", "messages"],
+	"properties": {
+		"model": {"type": "string"},
+		"messages": {
+			"type": "array",
+			"items": {
+				"type": "object",
+				"required": ["role"],
+				"properties": {"role": {"enum": ["system", "user", "assistant"]}}
+			}
+		}
+	}
+}`
+
+const testResponseSchema = `{
+	"type": "object",
+	"required": ["id"],
+	"properties": {"id": {"type": "string"}}
+}`
+
+func setupContractRouter(t *testing.T, mode string, upstreamBody string) (*gin.Engine, *ServiceHandler) {
+	gin.SetMode(gin.TestMode)
+	h := NewServiceHandler()
+
+	router := gin.New()
+	router.Use(h.RouteContractMiddleware())
+	router.POST("/internal/model", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", []byte(upstreamBody))
+	})
+	RegisterServiceRoutes(router, h)
+
+	route := Route{
+		Name:                 "internal model",
+		Path:                 "/internal/model",
+		Method:               "POST",
+		Enabled:              true,
+		RequestSchema:        json.RawMessage(testRequestSchema),
+		ResponseSchema:       json.RawMessage(testResponseSchema),
+		ResponseContractMode: mode,
+	}
+	body, _ := json.Marshal(route)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/routes", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	return router, h
+}
+
+func postJSON(router *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRouteContractValidRequest(t *testing.T) {
+	router, _ := setupContractRouter(t, ContractModeReject, `{"id":"resp-1"}`)
+
+	w := postJSON(router, "/internal/model", `{"model":"m","messages":[{"role":"user"}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"resp-1"}`, w.Body.String())
+}
+
+func TestRouteContractInvalidRequest(t *testing.T) {
+	router, _ := setupContractRouter(t, ContractModeLog, `{"id":"resp-1"}`)
+
+	w := postJSON(router, "/internal/model", `{"model":"m","messages":[{"role":"robot"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var resp struct {
+		Error struct {
+			Code       string            `json:"code"`
+			Violations []SchemaViolation `json:"violations"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "request_contract_violation", resp.Error.Code)
+	require.NotEmpty(t, resp.Error.Violations)
+	assert.Equal(t, "/messages/0/role", resp.Error.Violations[0].Pointer)
+}
+
+func TestRouteContractNonJSONRequest(t *testing.T) {
+	router, _ := setupContractRouter(t, ContractModeLog, `{"id":"resp-1"}`)
+
+	w := postJSON(router, "/internal/model", `model=m`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_json")
+}
+
+func TestRouteContractOversizedRequestSkipsValidation(t *testing.T) {
+	router, _ := setupContractRouter(t, ContractModeLog, `{"id":"resp-1"}`)
+
+	// 超过阈值的请求体不做校验，直接透传
+	body := `{"padding":"` + strings.Repeat("x", MaxContractValidationSize) + `"}`
+	w := postJSON(router, "/internal/model", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRouteContractResponseModes(t *testing.T) {
+	valid := `{"model":"m","messages":[]}`
+
+	router, _ := setupContractRouter(t, ContractModeLog, `{"id":1}`)
+	w := postJSON(router, "/internal/model", valid)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("X-Contract-Warning"))
+
+	router, _ = setupContractRouter(t, ContractModeHeader, `{"id":1}`)
+	w = postJSON(router, "/internal/model", valid)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("X-Contract-Warning"), "/id")
+
+	router, _ = setupContractRouter(t, ContractModeReject, `{"id":1}`)
+	w = postJSON(router, "/internal/model", valid)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "upstream_contract_violation")
+
+	router, _ = setupContractRouter(t, ContractModeReject, `not json`)
+	w = postJSON(router, "/internal/model", valid)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
+
+func TestRouteContractInvalidSchemaRejected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewServiceHandler()
+	router := gin.New()
+	RegisterServiceRoutes(router, h)
+
+	w := postJSON(router, "/api/v1/routes", `{"name":"bad","path":"/x","requestSchema":{"type":"no-such-type"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "INVALID_SCHEMA")
+}
+
+func TestRouteContractPrefixRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewServiceHandler()
+	router := gin.New()
+	router.Use(h.RouteContractMiddleware())
+	router.POST("/internal/model", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", []byte(`{"id":"resp-1"}`))
+	})
+	RegisterServiceRoutes(router, h)
+
+	w := postJSON(router, "/api/v1/routes", `{"name":"internal","path":"/internal/*","method":"POST","enabled":true,
+		"requestSchema":`+testRequestSchema+`}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	// Prefix routes are matched like the route proxy matches them
+	w = postJSON(router, "/internal/model", `{"model":"m","messages":[{"role":"robot"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "request_contract_violation")
+
+	w = postJSON(router, "/internal/model", `{"model":"m","messages":[{"role":"user"}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTraceRouteIncludesContract(t *testing.T) {
+	router, _ := setupContractRouter(t, ContractModeReject, `{"id":"resp-1"}`)
+
+	trace := func(body string) RouteTrace {
+		w := postJSON(router, "/api/v1/routes/trace", body)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			Data RouteTrace `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data
+	}
+
+	result := trace(`{"path":"/internal/model","body":{"model":"m","messages":[{"role":"robot"}]}}`)
+	assert.True(t, result.Matched)
+	assert.JSONEq(t, testRequestSchema, string(result.RequestSchema))
+	assert.JSONEq(t, testResponseSchema, string(result.ResponseSchema))
+	assert.Equal(t, ContractModeReject, result.ResponseContractMode)
+	assert.True(t, result.RequestValidated)
+	require.Len(t, result.RequestViolations, 1)
+	assert.Equal(t, "/messages/0/role", result.RequestViolations[0].Pointer)
+
+	result = trace(`{"path":"/internal/model","body":{"model":"m","messages":[]}}`)
+	assert.True(t, result.RequestValidated)
+	assert.Empty(t, result.RequestViolations)
+
+	result = trace(`{"path":"/internal/model"}`)
+	assert.False(t, result.RequestValidated, "without a body only the schemas are shown")
+}
+
+func TestRouteExportImportKeepsContracts(t *testing.T) {
+	source, _ := setupContractRouter(t, ContractModeReject, `{"id":"resp-1"}`)
+	w := httptest.NewRecorder()
+	source.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/routes/export", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var exported struct {
+		Data RouteBundle `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &exported))
+	// The default route is exported alongside the contract route
+	require.Len(t, exported.Data.Routes, 2)
+	bundle, err := json.Marshal(exported.Data)
+	require.NoError(t, err)
+
+	// Import into a fresh gateway: the schemas are compiled and enforced there,
+	// and the default route it already has is updated
+	gin.SetMode(gin.TestMode)
+	h := NewServiceHandler()
+	router := gin.New()
+	router.Use(h.RouteContractMiddleware())
+	router.POST("/internal/model", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", []byte(`{"wrong":true}`))
+	})
+	RegisterServiceRoutes(router, h)
+
+	w = postJSON(router, "/api/v1/routes/import", string(bundle))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"created":1,"updated":1}`, responseData(t, w))
+
+	w = postJSON(router, "/internal/model", `{"model":"m","messages":[{"role":"robot"}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = postJSON(router, "/internal/model", `{"model":"m","messages":[{"role":"user"}]}`)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "upstream_contract_violation")
+
+	// Importing again updates the route in place
+	w = postJSON(router, "/api/v1/routes/import", string(bundle))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{"created":0,"updated":2}`, responseData(t, w))
+	h.mu.RLock()
+	require.Len(t, h.routes, 2)
+	assert.Equal(t, "internal model", h.routes[1].Name)
+	assert.Equal(t, 2, h.routes[1].Version)
+	h.mu.RUnlock()
+
+	// A bundle with an invalid schema is rejected whole
+	w = postJSON(router, "/api/v1/routes/import", `{"routes":[
+		{"name":"new","path":"/new","enabled":true},
+		{"name":"bad","path":"/bad","requestSchema":{"type":"no-such-type"}}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "INVALID_SCHEMA")
+	h.mu.RLock()
+	assert.Len(t, h.routes, 2)
+	h.mu.RUnlock()
+
+	// So is one that conflicts with itself
+	w = postJSON(router, "/api/v1/routes/import", `{"routes":[
+		{"name":"a","path":"/same","method":"POST","enabled":true},
+		{"name":"b","path":"/same","method":"POST","enabled":true}]}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "ROUTE_CONFLICT")
+}
+
+// responseData returns the data field of a success response as JSON
+func responseData(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return string(resp.Data)
+}
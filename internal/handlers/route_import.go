@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteBundle 路由导入/导出文档：完整的路由定义，包括请求/响应契约schema
+type RouteBundle struct {
+	Routes []Route `json:"routes"`
+}
+
+// ExportRoutes returns every route, with its schemas, as a bundle ImportRoutes accepts
+func (h *ServiceHandler) ExportRoutes(c *gin.Context) {
+	h.mu.RLock()
+	bundle := RouteBundle{Routes: append([]Route{}, h.routes...)}
+	h.mu.RUnlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    bundle,
+	})
+}
+
+// ImportRoutes creates or updates the routes of a bundle. Routes are matched by
+// ID: known IDs are updated, others created. Every route is validated and its
+// schemas compiled before any is saved, so a bundle is applied whole or not at all.
+func (h *ServiceHandler) ImportRoutes(c *gin.Context) {
+	var bundle RouteBundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": "Invalid request body",
+			},
+		})
+		return
+	}
+
+	seen := make(map[string]bool, len(bundle.Routes))
+	for i := range bundle.Routes {
+		route := &bundle.Routes[i]
+		if route.ID == "" {
+			route.ID = generateID()
+		}
+		if seen[route.ID] {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "INVALID_REQUEST",
+					"message": fmt.Sprintf("Route %s appears more than once", route.ID),
+				},
+			})
+			return
+		}
+		seen[route.ID] = true
+		if rejectEgressTarget(c, "route_target", route.Target) {
+			return
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	existing := make(map[string]int, len(h.routes))
+	for i, route := range h.routes {
+		existing[route.ID] = i
+	}
+
+	now := time.Now()
+	routes := append([]Route{}, h.routes...)
+	contracts := make(map[string]*routeContract, len(bundle.Routes))
+	var created, updated int
+	for i := range bundle.Routes {
+		route := &bundle.Routes[i]
+		route.UpdatedAt = now
+		index, exists := existing[route.ID]
+		if exists {
+			previous := h.routes[index]
+			route.Version = previous.Version + 1
+			route.CreatedAt = previous.CreatedAt
+		} else {
+			route.Version = 1
+			route.CreatedAt = now
+		}
+
+		contract, err := compileRouteContract(route)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "INVALID_SCHEMA",
+					"message": fmt.Sprintf("route %q: %v", route.Name, err),
+				},
+			})
+			return
+		}
+
+		// Mocking a route that serves real traffic must be confirmed explicitly
+		if exists {
+			previous := h.contracts[route.ID]
+			wasMocked := previous != nil && previous.version == h.routes[index].Version && previous.mock != nil
+			if contract.mock != nil && !wasMocked && h.hasLiveTraffic(route.ID) && c.Query("confirm") != "true" {
+				c.JSON(http.StatusConflict, gin.H{
+					"success": false,
+					"error": gin.H{
+						"code":    "CONFIRMATION_REQUIRED",
+						"message": fmt.Sprintf("Route %s has live traffic; pass confirm=true to enable its mock", route.ID),
+					},
+				})
+				return
+			}
+			routes[index] = *route
+			updated++
+		} else {
+			routes = append(routes, *route)
+			created++
+		}
+		contracts[route.ID] = contract
+	}
+
+	for i := range bundle.Routes {
+		if otherID, conflict := conflictingRoute(routes, &bundle.Routes[i]); conflict {
+			c.JSON(http.StatusConflict, gin.H{
+				"success": false,
+				"error": gin.H{
+					"code":    "ROUTE_CONFLICT",
+					"message": fmt.Sprintf("Route %s is enabled with the same path, method and priority as %s", bundle.Routes[i].ID, otherID),
+				},
+			})
+			return
+		}
+	}
+
+	h.routes = routes
+	for i := range bundle.Routes {
+		route := &bundle.Routes[i]
+		h.contracts[route.ID] = contracts[route.ID]
+		h.persistRoute(route)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"created": created,
+			"updated": updated,
+		},
+	})
+}
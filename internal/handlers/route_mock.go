@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxMockBodySize 模拟响应体（静态或模板渲染结果）的上限
+	MaxMockBodySize = 64 * 1024
+	// MaxMockLatency 模拟响应可注入的最大延迟
+	MaxMockLatency = 30 * time.Second
+
+	// MockedHeader is set on every response served by a route mock
+	MockedHeader = "X-Gateway-Mocked"
+
+	// mockLiveTrafficWindow a route matched within this window has live traffic,
+	// and enabling a mock on it must be confirmed
+	mockLiveTrafficWindow = 5 * time.Minute
+
+	// routeMockKey gin上下文中保存匹配路由模拟响应的键
+	routeMockKey = "route_mock"
+)
+
+// MockOptions 路由Actions中"mock"的配置：上游还未就绪时由网关直接返回的响应
+type MockOptions struct {
+	Enabled   bool              `json:"enabled"`
+	Status    int               `json:"status,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Body      json.RawMessage   `json:"body,omitempty"`       // static JSON body
+	Template  string            `json:"template,omitempty"`   // text/template rendering a JSON body
+	LatencyMs int               `json:"latency_ms,omitempty"` // artificial latency before responding
+}
+
+// MockTemplateData 模板可访问的请求字段
+type MockTemplateData struct {
+	Model           string
+	LastUserMessage string
+	Method          string
+	Path            string
+	Request         map[string]interface{}
+}
+
+// routeMock is the compiled mock of one route version
+type routeMock struct {
+	status  int
+	headers map[string]string
+	body    []byte
+	tmpl    *template.Template
+	latency time.Duration
+}
+
+var mockTemplateFuncs = template.FuncMap{
+	// json encodes a value so request fields can be embedded in the body safely
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// compileRouteMock validates the "mock" action of a route; routes without an
+// enabled mock compile to nil
+func compileRouteMock(actions map[string]interface{}) (*routeMock, error) {
+	raw, ok := actions["mock"]
+	if !ok {
+		return nil, nil
+	}
+	var opts MockOptions
+	data, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(data, &opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid mock action: %w", err)
+	}
+	if !opts.Enabled {
+		return nil, nil
+	}
+
+	mock := &routeMock{
+		status:  opts.Status,
+		headers: opts.Headers,
+		latency: time.Duration(opts.LatencyMs) * time.Millisecond,
+	}
+	if mock.status == 0 {
+		mock.status = http.StatusOK
+	}
+	if mock.status < 100 || mock.status > 599 {
+		return nil, fmt.Errorf("invalid mock status %d", opts.Status)
+	}
+	if opts.LatencyMs < 0 || mock.latency > MaxMockLatency {
+		return nil, fmt.Errorf("mock latency must be between 0 and %dms", MaxMockLatency.Milliseconds())
+	}
+
+	switch {
+	case len(opts.Body) > 0 && opts.Template != "":
+		return nil, fmt.Errorf("mock body and template are mutually exclusive")
+	case opts.Template != "":
+		if len(opts.Template) > MaxMockBodySize {
+			return nil, fmt.Errorf("mock template exceeds %d bytes", MaxMockBodySize)
+		}
+		mock.tmpl, err = template.New("mock").Funcs(mockTemplateFuncs).Option("missingkey=zero").Parse(opts.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mock template: %w", err)
+		}
+		// Rendering sample data catches templates that cannot produce JSON
+		if _, err := mock.render(MockTemplateData{Model: "model", LastUserMessage: "message"}); err != nil {
+			return nil, err
+		}
+	default:
+		if len(opts.Body) > MaxMockBodySize {
+			return nil, fmt.Errorf("mock body exceeds %d bytes", MaxMockBodySize)
+		}
+		if len(opts.Body) > 0 {
+			mock.body = []byte(opts.Body)
+		} else {
+			mock.body = []byte("{}")
+		}
+	}
+	return mock, nil
+}
+
+// render produces the response body for a request
+func (m *routeMock) render(data MockTemplateData) ([]byte, error) {
+	if m.tmpl == nil {
+		return m.body, nil
+	}
+	var buf bytes.Buffer
+	if err := m.tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render mock template: %w", err)
+	}
+	if buf.Len() > MaxMockBodySize {
+		return nil, fmt.Errorf("rendered mock body exceeds %d bytes", MaxMockBodySize)
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("mock template does not render valid JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+// routeMockFor returns the mock of the matched route, nil when it is not mocked
+func routeMockFor(c *gin.Context) *routeMock {
+	mock, _ := c.Get(routeMockKey)
+	m, _ := mock.(*routeMock)
+	return m
+}
+
+// serveMock answers the request with the route mock instead of calling the upstream
+func serveMock(c *gin.Context, mock *routeMock, request map[string]interface{}) {
+	data := MockTemplateData{
+		Method:  c.Request.Method,
+		Path:    c.Request.URL.Path,
+		Request: request,
+	}
+	data.Model, _ = request["model"].(string)
+	data.LastUserMessage = lastUserMessage(request)
+
+	body, err := mock.render(data)
+	if err != nil {
+		logrus.WithError(err).WithField("path", data.Path).Error("Failed to render route mock")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"message": err.Error(),
+				"type":    "configuration_error",
+				"code":    "invalid_mock_response",
+			},
+		})
+		return
+	}
+
+	if mock.latency > 0 {
+		timer := time.NewTimer(mock.latency)
+		select {
+		case <-timer.C:
+		case <-c.Request.Context().Done():
+			timer.Stop()
+			return
+		}
+	}
+
+	contentType := "application/json"
+	for key, value := range mock.headers {
+		if strings.EqualFold(key, "Content-Type") {
+			contentType = value
+			continue
+		}
+		c.Header(key, value)
+	}
+	c.Header(MockedHeader, "true")
+
+	logrus.WithFields(logrus.Fields{
+		"method":    data.Method,
+		"path":      data.Path,
+		"model":     data.Model,
+		"status":    mock.status,
+		"client_ip": c.ClientIP(),
+	}).Info("Served route mock response")
+
+	c.Data(mock.status, contentType, body)
+}
+
+// lastUserMessage returns the text of the last user message of a chat request
+func lastUserMessage(request map[string]interface{}) string {
+	messages, _ := request["messages"].([]interface{})
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg, _ := messages[i].(map[string]interface{})
+		if role, _ := msg["role"].(string); role != "user" {
+			continue
+		}
+		switch content := msg["content"].(type) {
+		case string:
+			return content
+		case []interface{}:
+			var parts []string
+			for _, part := range content {
+				if p, ok := part.(map[string]interface{}); ok && p["type"] == "text" {
+					if text, ok := p["text"].(string); ok {
+						parts = append(parts, text)
+					}
+				}
+			}
+			return strings.Join(parts, "\n")
+		}
+		return ""
+	}
+	return ""
+}
+
+// recordRouteHit remembers that a route served traffic
+func (h *ServiceHandler) recordRouteHit(routeID string) {
+	h.routeHits.Store(routeID, time.Now())
+}
+
+// hasLiveTraffic reports whether a route matched requests recently
+func (h *ServiceHandler) hasLiveTraffic(routeID string) bool {
+	last, ok := h.routeHits.Load(routeID)
+	return ok && time.Since(last.(time.Time)) < mockLiveTrafficWindow
+}
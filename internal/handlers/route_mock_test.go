@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupMockRouter(t *testing.T) (*gin.Engine, *int32) {
+	gin.SetMode(gin.TestMode)
+
+	var upstreamHits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&upstreamHits, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"source":"upstream"}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	h := NewServiceHandler()
+	router := gin.New()
+	router.Use(h.RouteActionsMiddleware())
+	router.POST("/internal/model", ChatCompletions(&config.Config{TargetURL: upstream.URL}))
+	RegisterServiceRoutes(router, h)
+	return router, &upstreamHits
+}
+
+func createMockRoute(t *testing.T, router *gin.Engine, actions string) string {
+	w := postJSON(router, "/api/v1/routes", `{"name":"prototype","path":"/internal/model","method":"POST","enabled":true,"actions":`+actions+`}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp struct {
+		Data Route `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp.Data.ID
+}
+
+func putJSON(router *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRouteMockTemplateRendering(t *testing.T) {
+	router, upstreamHits := setupMockRouter(t)
+	createMockRoute(t, router, `{"mock":{
+		"enabled": true,
+		"status": 201,
+		"headers": {"X-Prototype": "v0"},
+		"template": "{\"model\":{{json .Model}},\"echo\":{{json .LastUserMessage}}}"
+	}}`)
+
+	w := postJSON(router, "/internal/model", `{"model":"internal-v1","messages":[
+		{"role":"user","content":"first"},
+		{"role":"assistant","content":"ok"},
+		{"role":"user","content":[{"type":"text","text":"say \"hi\""}]}
+	]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "true", w.Header().Get(MockedHeader))
+	assert.Equal(t, "v0", w.Header().Get("X-Prototype"))
+	assert.JSONEq(t, `{"model":"internal-v1","echo":"say \"hi\""}`, w.Body.String())
+	assert.Equal(t, int32(0), atomic.LoadInt32(upstreamHits))
+
+	// Request validation still runs before the mock
+	w = postJSON(router, "/internal/model", `{"model":`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get(MockedHeader))
+}
+
+func TestRouteMockStaticBodyAndLatency(t *testing.T) {
+	router, upstreamHits := setupMockRouter(t)
+	createMockRoute(t, router, `{"mock":{"enabled":true,"body":{"id":"mock-1"},"latency_ms":150}}`)
+
+	start := time.Now()
+	w := postJSON(router, "/internal/model", `{"model":"internal-v1"}`)
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"mock-1"}`, w.Body.String())
+	assert.Equal(t, int32(0), atomic.LoadInt32(upstreamHits))
+}
+
+func TestRouteMockDisabledProxiesUpstream(t *testing.T) {
+	router, upstreamHits := setupMockRouter(t)
+	createMockRoute(t, router, `{"mock":{"enabled":false,"body":{"id":"mock-1"}}}`)
+
+	w := postJSON(router, "/internal/model", `{"model":"internal-v1"}`)
+	assert.Contains(t, w.Body.String(), "upstream")
+	assert.Empty(t, w.Header().Get(MockedHeader))
+	assert.Equal(t, int32(1), atomic.LoadInt32(upstreamHits))
+}
+
+func TestRouteMockValidatedOnSave(t *testing.T) {
+	router, _ := setupMockRouter(t)
+
+	oversized := `{"blob":"` + strings.Repeat("x", MaxMockBodySize) + `"}`
+	for _, mock := range []string{
+		`{"enabled":true,"template":"{{.Model"}`,
+		`{"enabled":true,"template":"not json {{.Model}}"}`,
+		`{"enabled":true,"body":` + oversized + `}`,
+		`{"enabled":true,"body":{},"template":"{}"}`,
+		`{"enabled":true,"status":42}`,
+		`{"enabled":true,"latency_ms":600000}`,
+	} {
+		w := postJSON(router, "/api/v1/routes", `{"name":"bad","path":"/internal/model","actions":{"mock":`+mock+`}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, mock)
+	}
+}
+
+func TestRouteMockOnLiveRouteRequiresConfirmation(t *testing.T) {
+	router, _ := setupMockRouter(t)
+	id := createMockRoute(t, router, `{}`)
+
+	// The route serves real traffic
+	require.Equal(t, http.StatusOK, postJSON(router, "/internal/model", `{"model":"internal-v1"}`).Code)
+
+	update := `{"name":"prototype","path":"/internal/model","method":"POST","enabled":true,"actions":{"mock":{"enabled":true}}}`
+	w := putJSON(router, "/api/v1/routes/"+id, update)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "CONFIRMATION_REQUIRED")
+
+	w = putJSON(router, "/api/v1/routes/"+id+"?confirm=true", update)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "true", postJSON(router, "/internal/model", `{}`).Header().Get(MockedHeader))
+
+	// Editing an already mocked route needs no confirmation
+	w = putJSON(router, "/api/v1/routes/"+id, strings.Replace(update, `"enabled":true}`, `"enabled":true,"status":202}`, 1))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/logging"
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// rateLimitAction is the route action capping the requests a proxied route
+// accepts per minute, across all clients: {"rateLimit": 100}
+const rateLimitAction = "rateLimit"
+
+// routeRateWindow is the window of the rateLimit action
+const routeRateWindow = time.Minute
+
+// routeProxyClient forwards requests to route targets. Streams may be long
+// lived, so only the wait for the response headers and the route timeout bound a request.
+var routeProxyClient = httpclient.WrapClient("route_target", &http.Client{Transport: routeProxyTransport()})
+
+func routeProxyTransport() *http.Transport {
+	t := httpclient.Transport("route_target")
+	t.ResponseHeaderTimeout = RequestTimeout
+	return t
+}
+
+// routeMethodMatch reports whether a route method accepts the request method;
+// an empty method or "*" accepts any
+func routeMethodMatch(routeMethod, method string) bool {
+	return routeMethod == "" || routeMethod == "*" || strings.EqualFold(routeMethod, method)
+}
+
+// routePathMatch reports whether a route path matches the request path. A
+// trailing "*" makes the path a prefix. The returned specificity ranks exact
+// paths above prefixes and longer prefixes above shorter ones.
+func routePathMatch(routePath, requestPath string) (int, bool) {
+	if prefix, ok := strings.CutSuffix(routePath, "*"); ok {
+		return len(prefix), strings.HasPrefix(requestPath, prefix)
+	}
+	return math.MaxInt, routePath == requestPath
+}
+
+// routeHeaderConditions returns the "headers" condition of a route: header
+// names to required values, where "*" requires any value and a trailing "*"
+// a prefix, e.g. {"headers": {"Authorization": "Bearer *"}}
+func routeHeaderConditions(conditions map[string]interface{}) (map[string]string, error) {
+	raw, ok := conditions["headers"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	switch headers := raw.(type) {
+	case map[string]string:
+		return headers, nil
+	case map[string]interface{}:
+		out := make(map[string]string, len(headers))
+		for name, value := range headers {
+			text, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid headers condition %q: value must be a string", name)
+			}
+			out[name] = text
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("invalid headers condition: must be an object of header names to values")
+}
+
+// routeHeadersMatch reports whether the request headers satisfy the route's header conditions
+func routeHeadersMatch(conditions map[string]interface{}, header http.Header) bool {
+	// Conditions were validated when the route was saved
+	required, _ := routeHeaderConditions(conditions)
+	for name, pattern := range required {
+		value := header.Get(name)
+		if value == "" {
+			return false
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if !strings.HasPrefix(value, prefix) {
+				return false
+			}
+		} else if value != pattern {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeRouteMethod maps the methods a route accepts to a comparable key
+func normalizeRouteMethod(method string) string {
+	if method == "" {
+		return "*"
+	}
+	return strings.ToUpper(method)
+}
+
+// conflictingRouteLocked returns the ID of another enabled route with the same
+// path, method and priority as route; callers hold h.mu
+func (h *ServiceHandler) conflictingRouteLocked(route *Route) (string, bool) {
+	return conflictingRoute(h.routes, route)
+}
+
+// conflictingRoute returns the ID of another enabled route among routes with
+// the same path, method and priority as route
+func conflictingRoute(routes []Route, route *Route) (string, bool) {
+	if !route.Enabled {
+		return "", false
+	}
+	for _, other := range routes {
+		if other.ID == route.ID || !other.Enabled {
+			continue
+		}
+		if other.Path == route.Path && other.Priority == route.Priority &&
+			normalizeRouteMethod(other.Method) == normalizeRouteMethod(route.Method) {
+			return other.ID, true
+		}
+	}
+	return "", false
+}
+
+// rejectRouteConflict answers 409 when route conflicts with another enabled route; callers hold h.mu
+func (h *ServiceHandler) rejectRouteConflict(c *gin.Context, route *Route) bool {
+	otherID, conflict := h.conflictingRouteLocked(route)
+	if !conflict {
+		return false
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"success": false,
+		"error": gin.H{
+			"code":    "ROUTE_CONFLICT",
+			"message": fmt.Sprintf("Route %s is enabled with the same path, method and priority", otherID),
+		},
+	})
+	return true
+}
+
+// compileRouteRateLimit validates the "rateLimit" action of a route; zero means unset
+func compileRouteRateLimit(actions map[string]interface{}) (int, error) {
+	raw, ok := actions[rateLimitAction]
+	if !ok {
+		return 0, nil
+	}
+	var limit float64
+	switch value := raw.(type) {
+	case int:
+		limit = float64(value)
+	case float64:
+		limit = value
+	default:
+		return 0, fmt.Errorf("invalid %s action: must be a number of requests per minute", rateLimitAction)
+	}
+	if limit <= 0 || limit != math.Trunc(limit) {
+		return 0, fmt.Errorf("invalid %s action %v: must be a positive integer", rateLimitAction, raw)
+	}
+	return int(limit), nil
+}
+
+// routeTargetURL builds the upstream URL of a request: exact routes forward to
+// the target as is, prefix routes append the rest of the request path
+func routeTargetURL(route Route, requestURL *url.URL) (string, error) {
+	if !strings.HasPrefix(route.Target, "http://") && !strings.HasPrefix(route.Target, "https://") {
+		return "", fmt.Errorf("route target %q is not an http(s) URL", route.Target)
+	}
+	target := route.Target
+	if prefix, ok := strings.CutSuffix(route.Path, "*"); ok {
+		target = strings.TrimSuffix(target, "/") + "/" + strings.TrimPrefix(strings.TrimPrefix(requestURL.Path, prefix), "/")
+	}
+	if requestURL.RawQuery != "" {
+		if strings.Contains(target, "?") {
+			target += "&" + requestURL.RawQuery
+		} else {
+			target += "?" + requestURL.RawQuery
+		}
+	}
+	return target, nil
+}
+
+// RouteProxyMiddleware forwards requests that no gateway endpoint serves to the
+// target of the matching enabled route, applying its rateLimit and timeout
+// actions. Gateway endpoints keep their handlers; a route on their path only
+// supplies actions to them. Routes are looked up per request, so changes made
+// through the routes API apply immediately.
+func (h *ServiceHandler) RouteProxyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.FullPath() != "" {
+			c.Next()
+			return
+		}
+		route, ok := h.routeFor(c.Request.Method, c.Request.URL.Path, c.Request.Header)
+		if !ok || route.Target == "" {
+			c.Next()
+			return
+		}
+		h.recordRouteHit(route.ID)
+
+		// Route actions were validated when the route was saved
+		if limit, _ := compileRouteRateLimit(route.Actions); limit > 0 {
+			if allowed, remaining := h.routeLimits.Allow(route.ID, limit, routeRateWindow); !allowed {
+				c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+				c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+				c.Header("Retry-After", strconv.Itoa(int(routeRateWindow.Seconds())))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+					"error": gin.H{
+						"message": "Route rate limit exceeded",
+						"type":    "rate_limit_error",
+						"code":    "route_rate_limit_exceeded",
+					},
+				})
+				return
+			}
+		}
+
+		h.proxyRoute(c, route)
+		c.Abort()
+	}
+}
+
+// proxyRoute forwards the request to the route target and copies the response back
+func (h *ServiceHandler) proxyRoute(c *gin.Context, route Route) {
+	logger := logging.FromContext(c)
+
+	if mock := h.mockFor(route); mock != nil {
+		body, _ := io.ReadAll(io.LimitReader(c.Request.Body, MaxRequestBodySize))
+		var request map[string]interface{}
+		_ = json.Unmarshal(body, &request)
+		serveMock(c, mock, request)
+		return
+	}
+
+	targetURL, err := routeTargetURL(route, c.Request.URL)
+	if err != nil {
+		logger.WithError(err).WithField("route_id", route.ID).Error("Invalid route target")
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": gin.H{
+				"message": "Invalid target configuration",
+				"type":    "configuration_error",
+				"code":    "invalid_target",
+			},
+		})
+		return
+	}
+
+	// The route timeout is counted from the request's arrival
+	ctx := c.Request.Context()
+	if timeout, _ := compileRouteTimeout(route.Actions); timeout > 0 {
+		start, found := middleware.RequestStart(c)
+		if !found {
+			start = time.Now()
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, start.Add(timeout))
+		defer cancel()
+	}
+
+	var body io.Reader = http.NoBody
+	if c.Request.Body != nil {
+		body = c.Request.Body
+	}
+	req, err := http.NewRequestWithContext(ctx, c.Request.Method, targetURL, body)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create route proxy request")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": gin.H{
+				"message": "Internal server error",
+				"type":    "internal_server_error",
+				"code":    "proxy_error",
+			},
+		})
+		return
+	}
+	req.ContentLength = c.Request.ContentLength
+
+	headerPolicy := DefaultHeaderPolicy()
+	headerOpts := routeHeaderOptions(route.Actions)
+	headerPolicy.ApplyRequest(c.Request.Header, req.Header, headerOpts)
+
+	start := time.Now()
+	resp, err := routeProxyClient.Do(req)
+	if err != nil {
+		fields := logrus.Fields{"route_id": route.ID, "target": req.URL.Host}
+		switch {
+		case errors.Is(err, httpclient.ErrEgressDenied):
+			logger.WithError(err).WithFields(fields).Warn("Route target denied by egress policy")
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": gin.H{
+					"message": "Target API is not allowed by the egress policy",
+					"type":    "security_error",
+					"code":    "egress_denied",
+				},
+			})
+		case errors.Is(err, context.DeadlineExceeded):
+			logger.WithError(err).WithFields(fields).Warn("Route target did not answer within the route timeout")
+			c.JSON(http.StatusGatewayTimeout, gin.H{
+				"error": gin.H{
+					"message": "Target API did not respond within the request deadline",
+					"type":    "timeout_error",
+					"code":    "deadline_exceeded",
+				},
+			})
+		default:
+			logger.WithError(err).WithFields(fields).Error("Failed to execute route proxy request")
+			c.JSON(http.StatusBadGateway, gin.H{
+				"error": gin.H{
+					"message": "Failed to connect to target API",
+					"type":    "api_connection_error",
+					"code":    "connection_error",
+				},
+			})
+		}
+		return
+	}
+	defer resp.Body.Close()
+
+	copyResponseHeaders(c, resp.Header, headerPolicy, headerOpts, nil)
+	if httpclient.IsEventStream(resp.Header) {
+		if err := copyFlushing(c, resp.StatusCode, resp.Body); err != nil {
+			logger.WithError(err).WithField("route_id", route.ID).Warn("Route stream ended early")
+		}
+		return
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logger.WithError(err).WithField("route_id", route.ID).Error("Failed to read route target response")
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": gin.H{
+				"message": "Failed to read target API response",
+				"type":    "api_response_error",
+				"code":    "response_error",
+			},
+		})
+		return
+	}
+
+	logger.WithFields(logrus.Fields{
+		"route_id":      route.ID,
+		"method":        req.Method,
+		"target":        req.URL.Host,
+		"status_code":   resp.StatusCode,
+		"response_size": len(respBody),
+		"duration_ms":   time.Since(start).Milliseconds(),
+	}).Info("Proxied request through route")
+
+	c.Writer.Header().Del("Content-Length")
+	c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), respBody)
+}
+
+// copyFlushing passes an event stream through unchanged, flushing after every read
+func copyFlushing(c *gin.Context, status int, body io.Reader) error {
+	c.Writer.Header().Del("Content-Length")
+	c.Status(status)
+	c.Writer.WriteHeaderNow()
+	flusher, _ := c.Writer.(http.Flusher)
+
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, werr := c.Writer.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
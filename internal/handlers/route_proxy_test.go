@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRouteProxy(t *testing.T) (*gin.Engine, *httptest.Server) {
+	gin.SetMode(gin.TestMode)
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(time.Second):
+			case <-r.Context().Done():
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"path": r.URL.Path, "query": r.URL.RawQuery})
+	}))
+	t.Cleanup(target.Close)
+
+	h := NewServiceHandler()
+	router := gin.New()
+	router.Use(h.RouteProxyMiddleware())
+	router.GET("/gateway/endpoint", func(c *gin.Context) { c.String(http.StatusOK, "gateway") })
+	RegisterServiceRoutes(router, h)
+	return router, target
+}
+
+func createRoute(t *testing.T, router *gin.Engine, route Route) (*httptest.ResponseRecorder, string) {
+	body, _ := json.Marshal(route)
+	w := postJSON(router, "/api/v1/routes", string(body))
+	var resp struct {
+		Data Route `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp.Data.ID
+}
+
+func TestRouteProxyMatching(t *testing.T) {
+	router, target := setupRouteProxy(t)
+	routes := []Route{
+		{Name: "prefix", Path: "/ext/*", Method: "GET", Target: target.URL + "/prefix", Enabled: true},
+		{Name: "longer prefix", Path: "/ext/models/*", Method: "GET", Target: target.URL + "/models", Enabled: true},
+		{Name: "exact", Path: "/ext/models/list", Method: "GET", Target: target.URL + "/exact", Enabled: true},
+		{Name: "beta header", Path: "/ext/models/list", Method: "GET", Target: target.URL + "/beta", Enabled: true, Priority: 5,
+			Conditions: map[string]interface{}{"headers": map[string]interface{}{"X-Channel": "beta*"}}},
+		{Name: "post only", Path: "/ext/post", Method: "POST", Target: target.URL + "/post", Enabled: true},
+		{Name: "disabled", Path: "/disabled", Target: target.URL + "/disabled"},
+		{Name: "gateway path", Path: "/gateway/endpoint", Target: target.URL + "/shadow", Enabled: true},
+	}
+	for _, route := range routes {
+		w, _ := createRoute(t, router, route)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		header   map[string]string
+		wantCode int
+		wantPath string
+	}{
+		{name: "prefix remainder and query", method: "GET", path: "/ext/a/b?x=1", wantCode: http.StatusOK, wantPath: "/prefix/a/b"},
+		{name: "longest prefix", method: "GET", path: "/ext/models/gpt", wantCode: http.StatusOK, wantPath: "/models/gpt"},
+		{name: "exact beats prefix", method: "GET", path: "/ext/models/list", wantCode: http.StatusOK, wantPath: "/exact"},
+		{name: "header condition with priority", method: "GET", path: "/ext/models/list", header: map[string]string{"X-Channel": "beta-2"}, wantCode: http.StatusOK, wantPath: "/beta"},
+		{name: "method mismatch", method: "GET", path: "/ext/post", wantCode: http.StatusOK, wantPath: "/prefix/post"},
+		{name: "method match", method: "POST", path: "/ext/post", wantCode: http.StatusOK, wantPath: "/post"},
+		{name: "disabled route", method: "GET", path: "/disabled", wantCode: http.StatusNotFound},
+		{name: "gateway endpoint keeps its handler", method: "GET", path: "/gateway/endpoint", wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, tt.wantCode, w.Code, w.Body.String())
+			if tt.wantPath == "" {
+				return
+			}
+			var got map[string]string
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			assert.Equal(t, tt.wantPath, got["path"])
+			if tt.name == "prefix remainder and query" {
+				assert.Equal(t, "x=1", got["query"])
+			}
+		})
+	}
+}
+
+func TestRouteProxyActions(t *testing.T) {
+	router, target := setupRouteProxy(t)
+
+	w, _ := createRoute(t, router, Route{Name: "limited", Path: "/limited", Target: target.URL, Enabled: true,
+		Actions: map[string]interface{}{"rateLimit": 2}})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, getPath(router, "/limited").Code)
+	}
+	w = getPath(router, "/limited")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	w, _ = createRoute(t, router, Route{Name: "slow", Path: "/slow", Target: target.URL + "/slow", Enabled: true,
+		Actions: map[string]interface{}{"timeout": "50ms"}})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusGatewayTimeout, getPath(router, "/slow").Code)
+
+	w, _ = createRoute(t, router, Route{Name: "bad limit", Path: "/bad", Target: target.URL, Enabled: true,
+		Actions: map[string]interface{}{"rateLimit": "many"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestRouteChangesApplyWithoutRestart(t *testing.T) {
+	router, target := setupRouteProxy(t)
+
+	w, id := createRoute(t, router, Route{Name: "live", Path: "/live", Target: target.URL + "/v1", Enabled: true})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(t, http.StatusOK, getPath(router, "/live").Code)
+
+	body, _ := json.Marshal(Route{Name: "live", Path: "/live", Target: target.URL + "/v2", Enabled: true})
+	require.Equal(t, http.StatusOK, putJSON(router, "/api/v1/routes/"+id, string(body)).Code)
+	var got map[string]string
+	require.NoError(t, json.Unmarshal(getPath(router, "/live").Body.Bytes(), &got))
+	assert.Equal(t, "/v2", got["path"])
+
+	require.Equal(t, http.StatusOK, postJSON(router, "/api/v1/routes/"+id+"/toggle", "").Code)
+	assert.Equal(t, http.StatusNotFound, getPath(router, "/live").Code)
+}
+
+func TestRouteConflictDetection(t *testing.T) {
+	router, target := setupRouteProxy(t)
+
+	w, _ := createRoute(t, router, Route{Name: "first", Path: "/dup", Method: "get", Target: target.URL, Enabled: true})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w, _ = createRoute(t, router, Route{Name: "same", Path: "/dup", Method: "GET", Target: target.URL, Enabled: true})
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w, _ = createRoute(t, router, Route{Name: "other priority", Path: "/dup", Method: "GET", Target: target.URL, Enabled: true, Priority: 2})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// A disabled duplicate may exist but not be enabled alongside the first
+	w, id := createRoute(t, router, Route{Name: "disabled", Path: "/dup", Method: "GET", Target: target.URL})
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusConflict, postJSON(router, "/api/v1/routes/"+id+"/toggle", "").Code)
+
+	body, _ := json.Marshal(Route{Name: "disabled", Path: "/dup", Method: "GET", Target: target.URL, Enabled: true})
+	assert.Equal(t, http.StatusConflict, putJSON(router, "/api/v1/routes/"+id, string(body)).Code)
+}
+
+func getPath(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// responseHeadersAction is the route action adding and removing response
+// headers: {"X-Served-By": "gateway", "X-Trace": "{{.RequestID}}", "-Server": ""}
+const responseHeadersAction = "response_headers"
+
+// reservedResponseHeaders frame the response and cannot be set or removed by a route
+var reservedResponseHeaders = []string{
+	"content-length",
+	"transfer-encoding",
+	"connection",
+	"keep-alive",
+	"trailer",
+	"upgrade",
+}
+
+// ResponseHeaderData 响应头模板可用的变量
+type ResponseHeaderData struct {
+	RequestID string
+	UserID    string
+	Timestamp string // RFC 3339, UTC
+}
+
+type responseHeaderValue struct {
+	name     string
+	template *template.Template
+}
+
+// routeResponseHeaders is the compiled "response_headers" action of a route
+type routeResponseHeaders struct {
+	set    []responseHeaderValue
+	remove []string // lowercase patterns, a trailing "*" matches a prefix
+}
+
+// compileResponseHeaders validates and compiles the "response_headers" action.
+// Keys prefixed with "-" name headers to remove; other values are templates.
+func compileResponseHeaders(actions map[string]interface{}) (*routeResponseHeaders, error) {
+	raw, ok := actions[responseHeadersAction]
+	if !ok {
+		return nil, nil
+	}
+	entries, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid %s action: must be an object of header names to values", responseHeadersAction)
+	}
+
+	headers := &routeResponseHeaders{}
+	for key, value := range entries {
+		name, remove := strings.CutPrefix(strings.TrimSpace(key), "-")
+		if !validHeaderPattern(name) || (!remove && strings.Contains(name, "*")) {
+			return nil, fmt.Errorf("invalid header name %q in %s action", key, responseHeadersAction)
+		}
+		lower := strings.ToLower(name)
+		if matchHeader(reservedResponseHeaders, lower) || overlapsHeaderPatterns(reservedResponseHeaders, lower) {
+			return nil, fmt.Errorf("header %q cannot be changed by a route", name)
+		}
+		if remove {
+			headers.remove = append(headers.remove, lower)
+			continue
+		}
+
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("value of header %q in %s action must be a string", name, responseHeadersAction)
+		}
+		tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+		if err == nil {
+			// Unknown fields only surface on execution; render once against zero data to catch them
+			err = tmpl.Execute(&bytes.Buffer{}, ResponseHeaderData{})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for header %q: %w", name, err)
+		}
+		headers.set = append(headers.set, responseHeaderValue{name: http.CanonicalHeaderKey(name), template: tmpl})
+	}
+	return headers, nil
+}
+
+// apply removes and then sets the configured headers
+func (r *routeResponseHeaders) apply(header http.Header, data ResponseHeaderData) {
+	if len(r.remove) > 0 {
+		for key := range header {
+			if matchHeader(r.remove, strings.ToLower(key)) {
+				header.Del(key)
+			}
+		}
+	}
+	for _, value := range r.set {
+		var buf bytes.Buffer
+		if err := value.template.Execute(&buf, data); err != nil {
+			logrus.WithError(err).WithField("header", value.name).Warn("Failed to render route response header")
+			continue
+		}
+		// Rendered values come from request data; never let them split the header
+		header.Set(value.name, strings.NewReplacer("\r", "", "\n", "").Replace(buf.String()))
+	}
+}
+
+// responseHeadersFor returns the compiled response headers of a route version, nil when it has none
+func (h *ServiceHandler) responseHeadersFor(route Route) *routeResponseHeaders {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	contract := h.contracts[route.ID]
+	if contract == nil || contract.version != route.Version {
+		return nil
+	}
+	return contract.responseHeaders
+}
+
+// responseHeaderData collects the template variables of a request
+func responseHeaderData(c *gin.Context) ResponseHeaderData {
+	requestID := c.GetString("request_id")
+	if requestID == "" {
+		requestID = c.Writer.Header().Get("X-Request-ID")
+	}
+	if requestID == "" {
+		requestID = c.GetHeader("X-Request-ID")
+	}
+	return ResponseHeaderData{
+		RequestID: requestID,
+		UserID:    c.GetString("user_id"),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// responseHeaderWriter applies a route's response headers just before they are sent
+type responseHeaderWriter struct {
+	gin.ResponseWriter
+	ctx     *gin.Context
+	headers *routeResponseHeaders
+	applied bool
+}
+
+func (w *responseHeaderWriter) applyOnce() {
+	if w.applied || w.ResponseWriter.Written() {
+		return
+	}
+	w.applied = true
+	w.headers.apply(w.ResponseWriter.Header(), responseHeaderData(w.ctx))
+}
+
+func (w *responseHeaderWriter) WriteHeaderNow() {
+	w.applyOnce()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *responseHeaderWriter) Write(data []byte) (int, error) {
+	w.applyOnce()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseHeaderWriter) WriteString(s string) (int, error) {
+	w.applyOnce()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *responseHeaderWriter) Flush() {
+	w.applyOnce()
+	w.ResponseWriter.Flush()
+}
+
+func (w *responseHeaderWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.applied = true
+	return w.ResponseWriter.Hijack()
+}
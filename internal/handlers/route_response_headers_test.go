@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupResponseHeaderRouter(t *testing.T, actions string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	h := NewServiceHandler()
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("request_id", "req-42")
+		c.Set("user_id", "alice")
+		c.Next()
+	})
+	router.Use(h.RouteActionsMiddleware())
+	router.POST("/internal/model", func(c *gin.Context) {
+		c.Header("Server", "upstream/1.2")
+		c.Header("X-Upstream-Region", "cn-hangzhou")
+		c.Header("X-Upstream-Node", "node-7")
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	router.POST("/internal/empty", func(c *gin.Context) {
+		c.Header("Server", "upstream/1.2")
+		c.Status(http.StatusNoContent)
+	})
+	RegisterServiceRoutes(router, h)
+
+	for _, path := range []string{"/internal/model", "/internal/empty"} {
+		w := postJSON(router, "/api/v1/routes", `{"name":"headers","path":"`+path+`","method":"POST","enabled":true,"actions":{"response_headers":`+actions+`}}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	}
+	return router
+}
+
+func TestRouteResponseHeadersStatic(t *testing.T) {
+	router := setupResponseHeaderRouter(t, `{"X-Served-By":"ai-gateway","Cache-Control":"no-store"}`)
+
+	w := postJSON(router, "/internal/model", `{}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ai-gateway", w.Header().Get("X-Served-By"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "upstream/1.2", w.Header().Get("Server"))
+}
+
+func TestRouteResponseHeadersTemplated(t *testing.T) {
+	router := setupResponseHeaderRouter(t, `{"X-Trace":"{{.RequestID}}/{{.UserID}}","X-Served-At":"{{.Timestamp}}"}`)
+
+	w := postJSON(router, "/internal/model", `{}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "req-42/alice", w.Header().Get("X-Trace"))
+	servedAt, err := time.Parse(time.RFC3339, w.Header().Get("X-Served-At"))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), servedAt, time.Minute)
+}
+
+func TestRouteResponseHeadersRemove(t *testing.T) {
+	router := setupResponseHeaderRouter(t, `{"-Server":"","-X-Upstream-*":"","X-Served-By":"ai-gateway"}`)
+
+	w := postJSON(router, "/internal/model", `{}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Server"))
+	assert.Empty(t, w.Header().Get("X-Upstream-Region"))
+	assert.Empty(t, w.Header().Get("X-Upstream-Node"))
+	assert.Equal(t, "ai-gateway", w.Header().Get("X-Served-By"))
+
+	// Bodiless responses get the same treatment
+	w = postJSON(router, "/internal/empty", `{}`)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Header().Get("Server"))
+	assert.Equal(t, "ai-gateway", w.Header().Get("X-Served-By"))
+}
+
+func TestRouteResponseHeadersValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	RegisterServiceRoutes(router, NewServiceHandler())
+
+	for _, actions := range []string{
+		`["X-Served-By"]`,
+		`{"X-Trace":"{{.Unknown}}"}`,
+		`{"X-Trace":"{{.RequestID"}`,
+		`{"Content-Length":"0"}`,
+		`{"-Transfer-Encoding":""}`,
+		`{"X-Wild-*":"value"}`,
+		`{"X-Count":3}`,
+	} {
+		w := postJSON(router, "/api/v1/routes", `{"name":"bad","path":"/bad","method":"POST","enabled":true,"actions":{"response_headers":`+actions+`}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code, actions)
+	}
+}
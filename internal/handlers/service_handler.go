@@ -1,9 +1,16 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/storage"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -36,6 +43,9 @@ type ServiceSource struct {
 	Description string    `json:"description"`
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
+
+	// Model IDs or path.Match patterns such as gpt-* whose requests the proxy sends to this source
+	Models []string `json:"models,omitempty"`
 }
 
 // Route represents a routing rule
@@ -45,12 +55,18 @@ type Route struct {
 	Path       string                 `json:"path"`
 	Method     string                 `json:"method"`
 	Target     string                 `json:"target"`
-	Priority   int                    `json:"priority"`
+	Priority   int                    `json:"priority"` // higher wins among routes matching a request
 	Enabled    bool                   `json:"enabled"`
 	Conditions map[string]interface{} `json:"conditions"`
 	Actions    map[string]interface{} `json:"actions"`
 	CreatedAt  time.Time              `json:"createdAt"`
 	UpdatedAt  time.Time              `json:"updatedAt"`
+
+	// Optional draft 2020-12 JSON Schema contracts enforced on the proxy path
+	RequestSchema        json.RawMessage `json:"requestSchema,omitempty"`
+	ResponseSchema       json.RawMessage `json:"responseSchema,omitempty"`
+	ResponseContractMode string          `json:"responseContractMode,omitempty"` // log, header, reject
+	Version              int             `json:"version"`
 }
 
 // ServiceHandler handles service-related requests
@@ -58,6 +74,12 @@ type ServiceHandler struct {
 	services       []Service
 	serviceSources []ServiceSource
 	routes         []Route
+	contracts      map[string]*routeContract // compiled schemas keyed by route ID
+	store          storage.Store             // optional persistent store
+	routeHits      sync.Map                  // route ID -> time of the last matched request
+	routeLimits    *middleware.MemoryWindows // rateLimit action windows keyed by route ID
+	providers      *ProviderRegistry         // model routing table built from the active sources
+	mu             sync.RWMutex
 }
 
 // NewServiceHandler creates a new service handler
@@ -134,23 +156,35 @@ func NewServiceHandler() *ServiceHandler {
 			Target:   "https://api.openai.com/v1/chat/completions",
 			Priority: 1,
 			Enabled:  true,
+			Version:  1,
 			Conditions: map[string]interface{}{
 				"headers": map[string]string{"Authorization": "Bearer *"},
 			},
 			Actions: map[string]interface{}{
 				"rateLimit": 100,
-				"timeout":   30000,
+				"timeout":   "30s",
 			},
 			CreatedAt: now,
 			UpdatedAt: now,
 		},
 	}
 
-	return &ServiceHandler{
+	h := &ServiceHandler{
 		services:       services,
 		serviceSources: serviceSources,
 		routes:         routes,
+		contracts:      make(map[string]*routeContract),
+		routeLimits:    middleware.NewMemoryWindows(),
+		providers:      NewProviderRegistry(),
+	}
+	h.providers.Update(h.serviceSources)
+	for i := range h.routes {
+		if contract, err := compileRouteContract(&h.routes[i]); err == nil {
+			h.contracts[h.routes[i].ID] = contract
+		}
 	}
+
+	return h
 }
 
 // GetServices returns all services
@@ -235,8 +269,31 @@ func (h *ServiceHandler) RefreshService(c *gin.Context) {
 	})
 }
 
+// Providers returns the model routing table kept in sync with the service sources
+func (h *ServiceHandler) Providers() *ProviderRegistry {
+	return h.providers
+}
+
+// rejectModelPatterns answers 400 when a service source lists an invalid model pattern
+func rejectModelPatterns(c *gin.Context, patterns []string) bool {
+	if err := validateModelPatterns(patterns); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INVALID_REQUEST",
+				"message": err.Error(),
+			},
+		})
+		return true
+	}
+	return false
+}
+
 // GetServiceSources returns all service sources
 func (h *ServiceHandler) GetServiceSources(c *gin.Context) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data":    h.serviceSources,
@@ -258,13 +315,21 @@ func (h *ServiceHandler) CreateServiceSource(c *gin.Context) {
 		return
 	}
 
+	if rejectEgressTarget(c, "service_source", req.Endpoint) || rejectModelPatterns(c, req.Models) {
+		return
+	}
+
 	now := time.Now()
 	req.ID = generateID()
 	req.CreatedAt = now
 	req.UpdatedAt = now
 	req.Status = "active"
 
+	h.mu.Lock()
 	h.serviceSources = append(h.serviceSources, req)
+	h.persistServiceSource(&req)
+	h.providers.Update(h.serviceSources)
+	h.mu.Unlock()
 
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
@@ -286,6 +351,12 @@ func (h *ServiceHandler) UpdateServiceSource(c *gin.Context) {
 		})
 		return
 	}
+	if rejectEgressTarget(c, "service_source", req.Endpoint) || rejectModelPatterns(c, req.Models) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
 	for i, source := range h.serviceSources {
 		if source.ID == id {
@@ -293,6 +364,8 @@ func (h *ServiceHandler) UpdateServiceSource(c *gin.Context) {
 			req.CreatedAt = source.CreatedAt
 			req.UpdatedAt = time.Now()
 			h.serviceSources[i] = req
+			h.persistServiceSource(&req)
+			h.providers.Update(h.serviceSources)
 
 			c.JSON(http.StatusOK, gin.H{
 				"success": true,
@@ -315,9 +388,14 @@ func (h *ServiceHandler) UpdateServiceSource(c *gin.Context) {
 func (h *ServiceHandler) DeleteServiceSource(c *gin.Context) {
 	id := c.Param("id")
 
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	for i, source := range h.serviceSources {
 		if source.ID == id {
 			h.serviceSources = append(h.serviceSources[:i], h.serviceSources[i+1:]...)
+			h.unpersist(storage.BucketServiceSources, id)
+			h.providers.Update(h.serviceSources)
 			c.JSON(http.StatusOK, gin.H{
 				"success": true,
 				"message": "Service source deleted successfully",
@@ -339,6 +417,9 @@ func (h *ServiceHandler) DeleteServiceSource(c *gin.Context) {
 func (h *ServiceHandler) ToggleServiceSourceStatus(c *gin.Context) {
 	id := c.Param("id")
 
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	for i, source := range h.serviceSources {
 		if source.ID == id {
 			if source.Status == "active" {
@@ -347,6 +428,8 @@ func (h *ServiceHandler) ToggleServiceSourceStatus(c *gin.Context) {
 				h.serviceSources[i].Status = "active"
 			}
 			h.serviceSources[i].UpdatedAt = time.Now()
+			h.persistServiceSource(&h.serviceSources[i])
+			h.providers.Update(h.serviceSources)
 
 			c.JSON(http.StatusOK, gin.H{
 				"success": true,
@@ -367,6 +450,9 @@ func (h *ServiceHandler) ToggleServiceSourceStatus(c *gin.Context) {
 
 // GetRoutes returns all routes
 func (h *ServiceHandler) GetRoutes(c *gin.Context) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data":    h.routes,
@@ -387,12 +473,37 @@ func (h *ServiceHandler) CreateRoute(c *gin.Context) {
 		return
 	}
 
+	if rejectEgressTarget(c, "route_target", req.Target) {
+		return
+	}
+
 	now := time.Now()
 	req.ID = generateID()
+	req.Version = 1
 	req.CreatedAt = now
 	req.UpdatedAt = now
 
+	contract, err := compileRouteContract(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "INVALID_SCHEMA",
+				"message": err.Error(),
+			},
+		})
+		return
+	}
+
+	h.mu.Lock()
+	if h.rejectRouteConflict(c, &req) {
+		h.mu.Unlock()
+		return
+	}
 	h.routes = append(h.routes, req)
+	h.contracts[req.ID] = contract
+	h.persistRoute(&req)
+	h.mu.Unlock()
 
 	c.JSON(http.StatusCreated, gin.H{
 		"success": true,
@@ -414,13 +525,52 @@ func (h *ServiceHandler) UpdateRoute(c *gin.Context) {
 		})
 		return
 	}
+	if rejectEgressTarget(c, "route_target", req.Target) {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
 
 	for i, route := range h.routes {
 		if route.ID == id {
 			req.ID = id
+			req.Version = route.Version + 1
 			req.CreatedAt = route.CreatedAt
 			req.UpdatedAt = time.Now()
+
+			contract, err := compileRouteContract(&req)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"success": false,
+					"error": gin.H{
+						"code":    "INVALID_SCHEMA",
+						"message": err.Error(),
+					},
+				})
+				return
+			}
+
+			// Mocking a route that serves real traffic must be confirmed explicitly
+			previous := h.contracts[id]
+			wasMocked := previous != nil && previous.version == route.Version && previous.mock != nil
+			if contract.mock != nil && !wasMocked && h.hasLiveTraffic(id) && c.Query("confirm") != "true" {
+				c.JSON(http.StatusConflict, gin.H{
+					"success": false,
+					"error": gin.H{
+						"code":    "CONFIRMATION_REQUIRED",
+						"message": "Route has live traffic; pass confirm=true to enable its mock",
+					},
+				})
+				return
+			}
+			if h.rejectRouteConflict(c, &req) {
+				return
+			}
+
 			h.routes[i] = req
+			h.contracts[id] = contract
+			h.persistRoute(&req)
 
 			c.JSON(http.StatusOK, gin.H{
 				"success": true,
@@ -443,9 +593,14 @@ func (h *ServiceHandler) UpdateRoute(c *gin.Context) {
 func (h *ServiceHandler) DeleteRoute(c *gin.Context) {
 	id := c.Param("id")
 
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	for i, route := range h.routes {
 		if route.ID == id {
 			h.routes = append(h.routes[:i], h.routes[i+1:]...)
+			delete(h.contracts, id)
+			h.unpersist(storage.BucketRoutes, id)
 			c.JSON(http.StatusOK, gin.H{
 				"success": true,
 				"message": "Route deleted successfully",
@@ -467,10 +622,18 @@ func (h *ServiceHandler) DeleteRoute(c *gin.Context) {
 func (h *ServiceHandler) ToggleRouteStatus(c *gin.Context) {
 	id := c.Param("id")
 
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	for i, route := range h.routes {
 		if route.ID == id {
-			h.routes[i].Enabled = !route.Enabled
+			route.Enabled = !route.Enabled
+			if h.rejectRouteConflict(c, &route) {
+				return
+			}
+			h.routes[i].Enabled = route.Enabled
 			h.routes[i].UpdatedAt = time.Now()
+			h.persistRoute(&h.routes[i])
 
 			c.JSON(http.StatusOK, gin.H{
 				"success": true,
@@ -511,4 +674,28 @@ func RegisterServiceRoutes(r *gin.Engine, handler *ServiceHandler) {
 	api.PUT("/routes/:id", handler.UpdateRoute)
 	api.DELETE("/routes/:id", handler.DeleteRoute)
 	api.POST("/routes/:id/toggle", handler.ToggleRouteStatus)
+	api.POST("/routes/trace", handler.TraceRoute)
+	api.GET("/routes/export", handler.ExportRoutes)
+	api.POST("/routes/import", handler.ImportRoutes)
+}
+
+// rejectEgressTarget validates a user-supplied upstream URL against the egress
+// policy when it is saved, so a blocked target fails at configuration time
+// rather than on the first proxied request. Targets without a scheme name
+// services resolved by discovery and are checked when dialled.
+func rejectEgressTarget(c *gin.Context, feature, target string) bool {
+	if !strings.Contains(target, "://") {
+		return false
+	}
+	if err := httpclient.ValidateEgressURL(c.Request.Context(), feature, target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error": gin.H{
+				"code":    "EGRESS_DENIED",
+				"message": err.Error(),
+			},
+		})
+		return true
+	}
+	return false
 }
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"go-aigateway/internal/storage"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SetStore attaches a persistent store to the service handler. Routes and service
+// sources already in the store replace the built-in defaults; an empty store is
+// seeded with them.
+func (h *ServiceHandler) SetStore(store storage.Store) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ctx := context.Background()
+	h.store = store
+
+	storedRoutes, err := store.List(ctx, storage.BucketRoutes)
+	if err != nil {
+		return fmt.Errorf("failed to load routes: %w", err)
+	}
+	storedSources, err := store.List(ctx, storage.BucketServiceSources)
+	if err != nil {
+		return fmt.Errorf("failed to load service sources: %w", err)
+	}
+
+	if len(storedRoutes) == 0 && len(storedSources) == 0 {
+		for i := range h.routes {
+			h.persistRoute(&h.routes[i])
+		}
+		for i := range h.serviceSources {
+			h.persistServiceSource(&h.serviceSources[i])
+		}
+		return nil
+	}
+
+	routes := make([]Route, 0, len(storedRoutes))
+	for id, data := range storedRoutes {
+		var route Route
+		if err := json.Unmarshal(data, &route); err != nil {
+			logrus.WithError(err).WithField("route_id", id).Warn("Skipping unreadable route record")
+			continue
+		}
+		routes = append(routes, route)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].CreatedAt.Before(routes[j].CreatedAt) })
+
+	sources := make([]ServiceSource, 0, len(storedSources))
+	for id, data := range storedSources {
+		var source ServiceSource
+		if err := json.Unmarshal(data, &source); err != nil {
+			logrus.WithError(err).WithField("source_id", id).Warn("Skipping unreadable service source record")
+			continue
+		}
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].CreatedAt.Before(sources[j].CreatedAt) })
+
+	h.routes = routes
+	h.serviceSources = sources
+	h.providers.Update(h.serviceSources)
+	h.contracts = make(map[string]*routeContract, len(routes))
+	for i := range h.routes {
+		contract, err := compileRouteContract(&h.routes[i])
+		if err != nil {
+			logrus.WithError(err).WithField("route_id", h.routes[i].ID).Warn("Stored route has an invalid schema contract")
+			continue
+		}
+		h.contracts[h.routes[i].ID] = contract
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"routes":          len(h.routes),
+		"service_sources": len(h.serviceSources),
+	}).Info("Loaded routes and service sources from persistent store")
+	return nil
+}
+
+// persistRoute writes a route to the store; callers hold h.mu
+func (h *ServiceHandler) persistRoute(route *Route) {
+	h.persist(storage.BucketRoutes, route.ID, route)
+}
+
+// persistServiceSource writes a service source to the store; callers hold h.mu
+func (h *ServiceHandler) persistServiceSource(source *ServiceSource) {
+	h.persist(storage.BucketServiceSources, source.ID, source)
+}
+
+func (h *ServiceHandler) persist(bucket, id string, value interface{}) {
+	if h.store == nil {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err == nil {
+		err = h.store.Put(context.Background(), bucket, id, data)
+	}
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"bucket": bucket, "id": id}).Error("Failed to persist record")
+	}
+}
+
+// unpersist removes a record from the store; callers hold h.mu
+func (h *ServiceHandler) unpersist(bucket, id string) {
+	if h.store == nil {
+		return
+	}
+	if err := h.store.Delete(context.Background(), bucket, id); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"bucket": bucket, "id": id}).Error("Failed to delete persisted record")
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-aigateway/internal/monitoring"
+	"go-aigateway/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// GetSLOStatus returns compliance, remaining error budget and burn rates per SLO
+func GetSLOStatus(tracker *monitoring.SLOTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		statuses, err := tracker.Status(c.Request.Context(), c.Query("tenant"))
+		if err != nil {
+			logrus.WithError(err).Error("Failed to compute SLO status")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": "Failed to compute SLO status",
+					"type":    "internal_server_error",
+					"code":    "slo_status_failed",
+				},
+			})
+			return
+		}
+		if statuses == nil {
+			statuses = []monitoring.SLOStatus{}
+		}
+		c.JSON(http.StatusOK, gin.H{"slos": statuses})
+	}
+}
+
+// ListSLOs returns all SLO definitions
+func ListSLOs(tracker *monitoring.SLOTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"slos": tracker.List()})
+	}
+}
+
+// UpsertSLO creates or replaces the SLO named in the path
+func UpsertSLO(tracker *monitoring.SLOTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var slo monitoring.SLO
+		if err := c.ShouldBindJSON(&slo); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "Invalid request format",
+					"type":    "validation_error",
+					"code":    "invalid_format",
+				},
+			})
+			return
+		}
+		slo.ID = c.Param("id")
+
+		saved, err := tracker.Upsert(c.Request.Context(), slo)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "validation_error",
+					"code":    "invalid_slo",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusOK, saved)
+	}
+}
+
+// DeleteSLO removes an SLO definition
+func DeleteSLO(tracker *monitoring.SLOTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := tracker.Delete(c.Request.Context(), c.Param("id"))
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{
+					"message": "SLO not found",
+					"type":    "invalid_request_error",
+					"code":    "slo_not_found",
+				},
+			})
+			return
+		}
+		if err != nil {
+			logrus.WithError(err).Error("Failed to delete SLO")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": "Failed to delete SLO",
+					"type":    "internal_server_error",
+					"code":    "slo_delete_failed",
+				},
+			})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// GetSlowRequests returns the most recent slow requests, newest first, up to ?limit
+func GetSlowRequests(detector *middleware.SlowRequestDetector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": "limit must be a positive integer",
+					"type":    "invalid_request_error",
+					"code":    "invalid_parameter",
+				},
+			})
+			return
+		}
+
+		requests, err := detector.List(c.Request.Context(), limit)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to list slow requests")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": gin.H{
+					"message": "Failed to read slow requests",
+					"type":    "internal_server_error",
+					"code":    "slow_requests_failed",
+				},
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"requests": requests})
+	}
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SmokeTestTimeout 单个服务商冒烟测试的超时时间
+const SmokeTestTimeout = 10 * time.Second
+
+const smokeTestPrompt = "Say OK"
+
+// smokeTestClient is bounded by the per-target context deadline
+var smokeTestClient = httpclient.NewClient("smoke_test", 0)
+
+// Smoke test outcomes
+const (
+	SmokeTestPass = "pass"
+	SmokeTestFail = "fail"
+)
+
+// SmokeTarget 可进行冒烟测试的上游服务商
+type SmokeTarget struct {
+	Name    string
+	BaseURL string
+	APIKey  string
+	Model   string
+}
+
+// SmokeTestResult 冒烟测试结果
+type SmokeTestResult struct {
+	Provider  string `json:"provider"`
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SmokeTargets returns the configured OpenAI-compatible providers: the primary
+// target API and, when enabled, the third-party model provider
+func SmokeTargets(cfg *config.Config) map[string]SmokeTarget {
+	targets := make(map[string]SmokeTarget)
+	if cfg.TargetURL != "" {
+		targets["openai"] = SmokeTarget{
+			Name:    "openai",
+			BaseURL: cfg.TargetURL,
+			APIKey:  cfg.TargetKey,
+			Model:   cfg.SmokeTestModel,
+		}
+	}
+	if tp := cfg.LocalModel.ThirdParty; tp.Enabled && tp.BaseURL != "" {
+		targets[tp.Provider] = SmokeTarget{
+			Name:    tp.Provider,
+			BaseURL: tp.BaseURL,
+			APIKey:  tp.APIKey,
+			Model:   tp.DefaultModel,
+		}
+	}
+	return targets
+}
+
+// RunSmokeTest sends a short prompt and expects a non-error completion within SmokeTestTimeout
+func RunSmokeTest(ctx context.Context, target SmokeTarget) SmokeTestResult {
+	result := SmokeTestResult{Provider: target.Name, Status: SmokeTestFail}
+
+	ctx, cancel := context.WithTimeout(ctx, SmokeTestTimeout)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":      target.Model,
+		"messages":   []map[string]string{{"role": "user", "content": smokeTestPrompt}},
+		"max_tokens": 5,
+	})
+	url := strings.TrimSuffix(target.BaseURL, "/") + "/chat/completions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if target.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+target.APIKey)
+	}
+
+	start := time.Now()
+	resp, err := smokeTestClient.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	latency := time.Since(start)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	var completion struct {
+		Choices []json.RawMessage `json:"choices"`
+		Error   *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	decodeErr := json.Unmarshal(respBody, &completion)
+
+	switch {
+	case resp.StatusCode != http.StatusOK:
+		result.Error = fmt.Sprintf("upstream returned status %d", resp.StatusCode)
+		if decodeErr == nil && completion.Error != nil && completion.Error.Message != "" {
+			result.Error += ": " + completion.Error.Message
+		}
+	case decodeErr != nil:
+		result.Error = "invalid JSON response: " + decodeErr.Error()
+	case completion.Error != nil:
+		result.Error = completion.Error.Message
+	case len(completion.Choices) == 0:
+		result.Error = "response contained no choices"
+	default:
+		result.Status = SmokeTestPass
+		result.LatencyMS = latency.Milliseconds()
+	}
+	return result
+}
+
+// SmokeTest runs the smoke test against one provider, or every configured provider concurrently with provider=all
+func SmokeTest(cfg *config.Config, audit *security.AuditLogger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider := c.DefaultQuery("provider", "all")
+		targets := SmokeTargets(cfg)
+
+		var selected []SmokeTarget
+		if provider == "all" {
+			for _, target := range targets {
+				selected = append(selected, target)
+			}
+			sort.Slice(selected, func(i, j int) bool { return selected[i].Name < selected[j].Name })
+		} else if target, ok := targets[provider]; ok {
+			selected = append(selected, target)
+		}
+
+		if len(selected) == 0 {
+			names := make([]string, 0, len(targets))
+			for name := range targets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message":   fmt.Sprintf("Unknown or unconfigured provider: %s", provider),
+					"type":      "invalid_request_error",
+					"code":      "unknown_provider",
+					"providers": names,
+				},
+			})
+			return
+		}
+
+		results := make([]SmokeTestResult, len(selected))
+		var wg sync.WaitGroup
+		for i, target := range selected {
+			wg.Add(1)
+			go func(i int, target SmokeTarget) {
+				defer wg.Done()
+				results[i] = RunSmokeTest(c.Request.Context(), target)
+			}(i, target)
+		}
+		wg.Wait()
+
+		for _, result := range results {
+			audit.LogWithContext(c.Request.Context(), &security.AuditEvent{
+				Type:      "smoke_test",
+				Action:    result.Status,
+				Resource:  result.Provider,
+				UserID:    c.GetString("user_id"),
+				RemoteIP:  c.ClientIP(),
+				UserAgent: c.GetHeader("User-Agent"),
+				Details: map[string]interface{}{
+					"latency_ms": result.LatencyMS,
+					"error":      result.Error,
+				},
+			})
+		}
+
+		if provider != "all" {
+			c.JSON(http.StatusOK, results[0])
+			return
+		}
+
+		status := SmokeTestPass
+		for _, result := range results {
+			if result.Status != SmokeTestPass {
+				status = SmokeTestFail
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"status": status, "results": results})
+	}
+}
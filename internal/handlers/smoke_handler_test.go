@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSmokeUpstream(t *testing.T, status int, body string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+
+		var req map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Contains(t, req["messages"].([]interface{})[0], "content")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func setupSmokeRouter(cfg *config.Config) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/v1/admin/smoke-test", SmokeTest(cfg, security.NewAuditLogger()))
+	return r
+}
+
+func TestSmokeTestDistinguishesPassAndFail(t *testing.T) {
+	healthy := newSmokeUpstream(t, http.StatusOK, `{"id":"1","choices":[{"message":{"role":"assistant","content":"OK"}}]}`)
+	broken := newSmokeUpstream(t, http.StatusUnauthorized, `{"error":{"message":"invalid api key"}}`)
+
+	cfg := &config.Config{TargetURL: healthy.URL, TargetKey: "test-key", SmokeTestModel: "gpt-test"}
+	cfg.LocalModel.ThirdParty = config.ThirdPartyModelConfig{
+		Enabled:      true,
+		Provider:     "alililian",
+		BaseURL:      broken.URL,
+		APIKey:       "test-key",
+		DefaultModel: "qwen-turbo",
+	}
+	r := setupSmokeRouter(cfg)
+
+	w := postJSON(r, "/api/v1/admin/smoke-test?provider=openai", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var pass SmokeTestResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &pass))
+	assert.Equal(t, SmokeTestResult{Provider: "openai", Status: SmokeTestPass, LatencyMS: pass.LatencyMS}, pass)
+
+	w = postJSON(r, "/api/v1/admin/smoke-test?provider=alililian", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var fail SmokeTestResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fail))
+	assert.Equal(t, SmokeTestFail, fail.Status)
+	assert.Contains(t, fail.Error, "401")
+	assert.Contains(t, fail.Error, "invalid api key")
+
+	w = postJSON(r, "/api/v1/admin/smoke-test?provider=all", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var all struct {
+		Status  string            `json:"status"`
+		Results []SmokeTestResult `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &all))
+	assert.Equal(t, SmokeTestFail, all.Status)
+	require.Len(t, all.Results, 2)
+	assert.Equal(t, "alililian", all.Results[0].Provider)
+	assert.Equal(t, SmokeTestFail, all.Results[0].Status)
+	assert.Equal(t, "openai", all.Results[1].Provider)
+	assert.Equal(t, SmokeTestPass, all.Results[1].Status)
+}
+
+func TestSmokeTestUnknownProvider(t *testing.T) {
+	r := setupSmokeRouter(&config.Config{TargetURL: "http://127.0.0.1:1"})
+
+	w := postJSON(r, "/api/v1/admin/smoke-test?provider=anthropic", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown_provider")
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-aigateway/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// BackupHandler streams a consistent snapshot of the embedded store
+func BackupHandler(store storage.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		backupper, ok := store.(storage.Backupper)
+		if store == nil || !ok || !store.Capabilities().Backup {
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": gin.H{
+					"message": "Backup is only supported by the embedded storage backend",
+					"type":    "not_implemented",
+					"code":    "backup_unsupported",
+				},
+			})
+			return
+		}
+
+		filename := fmt.Sprintf("aigateway-backup-%s.db", time.Now().UTC().Format("20060102-150405"))
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		c.Status(http.StatusOK)
+
+		n, err := backupper.Backup(c.Writer)
+		if err != nil {
+			// 响应头已发送，只能记录日志
+			logrus.WithError(err).Error("Storage backup failed")
+			return
+		}
+		logrus.WithField("bytes", n).Info("Storage backup completed")
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamChunkSize is the read buffer for upstream event streams
+const streamChunkSize = 32 * 1024
+
+// copyResponseHeaders copies the upstream headers the header policy allows
+// and adds the gateway's warnings
+func copyResponseHeaders(c *gin.Context, header http.Header, policy *HeaderPolicy, opts *HeaderOptions, warnings []string) {
+	for key, values := range header {
+		if !policy.AllowResponse(key, opts) {
+			continue
+		}
+		for _, value := range values {
+			c.Header(key, value)
+		}
+	}
+
+	for _, warning := range warnings {
+		c.Writer.Header().Add("X-Gateway-Warning", warning)
+	}
+}
+
+// streamEvents 将上游 SSE 响应逐行转发给客户端，每个事件结束或暂无数据时 flush。
+// 客户端断开时请求上下文被取消，上游读取随之失败，转发结束。上游正常结束但
+// 未发送 data: [DONE] 时（如 DashScope 原生接口）由网关补发。流结束时按最后一个
+// 带 usage 的数据块（stream_options.include_usage）记录令牌用量；hideUsage 时
+// 该选项由网关代为开启，只含用量的数据块不转发给客户端。
+func streamEvents(c *gin.Context, body io.Reader, hideUsage bool) (int64, error) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	// The length of the upstream stream does not survive re-chunking
+	c.Writer.Header().Del("Content-Length")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	flusher, _ := c.Writer.(http.Flusher)
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	flush()
+
+	var written int64
+	var usageChunk map[string]interface{}
+	done, lineOpen, skipEvent := false, false, false
+	reader := bufio.NewReaderSize(body, streamChunkSize)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if data, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+				data = bytes.TrimSpace(data)
+				if string(data) == "[DONE]" {
+					done = true
+				} else if chunk := usageFromChunk(data); chunk != nil {
+					usageChunk = chunk
+					if hideUsage && usageOnlyChunk(chunk) {
+						skipEvent = true
+					}
+				}
+			}
+			// The hidden usage event is dropped through its terminating blank line
+			if skipEvent {
+				if len(bytes.TrimSpace(line)) == 0 {
+					skipEvent = false
+				}
+			} else {
+				n, writeErr := c.Writer.Write(line)
+				written += int64(n)
+				if writeErr != nil {
+					return written, writeErr
+				}
+				lineOpen = line[len(line)-1] != '\n'
+				// Flush each complete event, and whatever arrived before the upstream paused
+				if len(bytes.TrimSpace(line)) == 0 || reader.Buffered() == 0 {
+					flush()
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			if !done {
+				terminator := "data: [DONE]\n\n"
+				if lineOpen {
+					terminator = "\n\n" + terminator
+				}
+				n, _ := io.WriteString(c.Writer, terminator)
+				written += int64(n)
+			}
+			flush()
+			if usageChunk != nil {
+				recordTokenUsage(c, usageChunk)
+			} else {
+				middleware.RecordUnmeteredStream(c.GetString(middleware.ModelContextKey))
+			}
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// usageFromChunk decodes a stream chunk carrying a usage block, nil for other chunks
+func usageFromChunk(data []byte) map[string]interface{} {
+	if !bytes.Contains(data, []byte(`"usage"`)) {
+		return nil
+	}
+	var chunk map[string]interface{}
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return nil
+	}
+	if _, ok := chunk["usage"].(map[string]interface{}); !ok {
+		return nil
+	}
+	return chunk
+}
+
+// usageOnlyChunk reports whether a chunk carries nothing but usage, like the
+// final chunk OpenAI sends with "choices": [] when include_usage is set
+func usageOnlyChunk(chunk map[string]interface{}) bool {
+	choices, ok := chunk["choices"].([]interface{})
+	return !ok || len(choices) == 0
+}
+
+// requestStreamUsage sets stream_options.include_usage on a streamed request.
+// It reports whether the gateway added it, i.e. the client did not ask for usage.
+func requestStreamUsage(request map[string]interface{}) bool {
+	if stream, _ := request["stream"].(bool); !stream {
+		return false
+	}
+	options, _ := request["stream_options"].(map[string]interface{})
+	if include, _ := options["include_usage"].(bool); include {
+		return false
+	}
+	if options == nil {
+		options = make(map[string]interface{})
+		request["stream_options"] = options
+	}
+	options["include_usage"] = true
+	return true
+}
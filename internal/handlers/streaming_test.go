@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/performance"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func streamChunk(content string) string {
+	return fmt.Sprintf("data: {\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{\"content\":%q}}]}\n\n", content)
+}
+
+// newStreamingGateway serves chat completions behind the performance middleware the gateway runs with
+func newStreamingGateway(t *testing.T, upstreamURL string) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	po := performance.NewPerformanceOptimizer(&config.Config{}, nil)
+	r := gin.New()
+	r.Use(po.IntelligentCachingMiddleware(time.Minute), po.AdaptiveCompressionMiddleware())
+	r.POST("/v1/chat/completions", ChatCompletions(&config.Config{TargetURL: upstreamURL}))
+	gateway := httptest.NewServer(r)
+	t.Cleanup(gateway.Close)
+	return gateway
+}
+
+func postStream(t *testing.T, ctx context.Context, url string) *http.Response {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url+"/v1/chat/completions",
+		strings.NewReader(`{"model":"qwen-turbo","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	// Set explicitly so the client does not decompress transparently
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func readEvent(t *testing.T, reader *bufio.Reader) string {
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	blank, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "\n", blank)
+	return strings.TrimSpace(line)
+}
+
+func TestChatCompletionsStreamsChunksIncrementally(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, readBody(r), `"stream":true`)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, streamChunk("Hel"))
+		w.(http.Flusher).Flush()
+		// The rest is only sent once the client has seen the first delta
+		<-release
+		fmt.Fprint(w, streamChunk("lo"))
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+	gateway := newStreamingGateway(t, upstream.URL)
+
+	resp := postStream(t, context.Background(), gateway.URL)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"), "streams are not compressed")
+
+	reader := bufio.NewReader(resp.Body)
+	assert.Equal(t, strings.TrimSpace(streamChunk("Hel")), readEvent(t, reader))
+	close(release)
+	assert.Equal(t, strings.TrimSpace(streamChunk("lo")), readEvent(t, reader))
+	assert.Equal(t, "data: [DONE]", readEvent(t, reader))
+}
+
+func TestChatCompletionsStreamKeepsChunkOrderAndTerminates(t *testing.T) {
+	deltas := []string{"The", " capital", " of", " France", " is", " Paris", "."}
+	cases := []struct {
+		name     string
+		sendDone bool
+	}{
+		{"upstream sends [DONE]", true},
+		// DashScope's native stream ends without a terminator
+		{"gateway adds [DONE]", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for _, delta := range deltas {
+					fmt.Fprint(w, streamChunk(delta))
+					w.(http.Flusher).Flush()
+				}
+				if tc.sendDone {
+					fmt.Fprint(w, "data: [DONE]\n\n")
+				}
+			}))
+			defer upstream.Close()
+			gateway := newStreamingGateway(t, upstream.URL)
+
+			resp := postStream(t, context.Background(), gateway.URL)
+			defer resp.Body.Close()
+			reader := bufio.NewReader(resp.Body)
+			for _, delta := range deltas {
+				assert.Equal(t, strings.TrimSpace(streamChunk(delta)), readEvent(t, reader))
+			}
+			assert.Equal(t, "data: [DONE]", readEvent(t, reader))
+			_, err := reader.ReadByte()
+			assert.ErrorIs(t, err, io.EOF, "nothing follows the terminator")
+		})
+	}
+}
+
+func TestChatCompletionsStreamRequestsUsage(t *testing.T) {
+	const usageChunk = `data: {"object":"chat.completion.chunk","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`
+	cases := []struct {
+		name      string
+		request   string
+		forwarded bool
+	}{
+		{"gateway asks for usage and hides it", `{"model":"qwen-turbo","stream":true,"messages":[{"role":"user","content":"hi"}]}`, false},
+		{"client asked for usage", `{"model":"qwen-turbo","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":"hi"}]}`, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var charged atomic.Int64
+			SetTokenUsageRecorder(func(c *gin.Context, tokens int64) { charged.Add(tokens) })
+			t.Cleanup(func() { SetTokenUsageRecorder(nil) })
+
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Contains(t, readBody(r), `"stream_options":{"include_usage":true}`)
+				w.Header().Set("Content-Type", "text/event-stream")
+				fmt.Fprint(w, streamChunk("Hi"))
+				fmt.Fprint(w, usageChunk+"\n\n")
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}))
+			defer upstream.Close()
+			gateway := newStreamingGateway(t, upstream.URL)
+
+			req, err := http.NewRequest(http.MethodPost, gateway.URL+"/v1/chat/completions", strings.NewReader(tc.request))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			reader := bufio.NewReader(resp.Body)
+			assert.Equal(t, strings.TrimSpace(streamChunk("Hi")), readEvent(t, reader))
+			if tc.forwarded {
+				assert.Equal(t, usageChunk, readEvent(t, reader))
+			}
+			assert.Equal(t, "data: [DONE]", readEvent(t, reader))
+			_, err = reader.ReadByte()
+			assert.ErrorIs(t, err, io.EOF)
+			assert.Equal(t, int64(12), charged.Load(), "the stream is metered either way")
+		})
+	}
+}
+
+func TestChatCompletionsStreamCancelledOnClientDisconnect(t *testing.T) {
+	upstreamDone := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, streamChunk("Hel"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+			close(upstreamDone)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer upstream.Close()
+	gateway := newStreamingGateway(t, upstream.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	resp := postStream(t, ctx, gateway.URL)
+	defer resp.Body.Close()
+	assert.Equal(t, strings.TrimSpace(streamChunk("Hel")), readEvent(t, bufio.NewReader(resp.Body)))
+	cancel()
+
+	select {
+	case <-upstreamDone:
+	case <-time.After(3 * time.Second):
+		t.Fatal("the upstream request was not cancelled after the client disconnected")
+	}
+}
+
+func TestChatCompletionsNonStreamingStillCompressed(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"Hello"}}]}`)
+	}))
+	defer upstream.Close()
+	gateway := newStreamingGateway(t, upstream.URL)
+
+	req, _ := http.NewRequest(http.MethodPost, gateway.URL+"/v1/chat/completions",
+		strings.NewReader(`{"model":"qwen-turbo","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "application/json")
+	assert.True(t, resp.Uncompressed, "the JSON response was gzip encoded")
+}
+
+func readBody(r *http.Request) string {
+	var b strings.Builder
+	bufio.NewReader(r.Body).WriteTo(&b)
+	return b.String()
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// Values of the X-Schema-Validation header
+const (
+	SchemaValidationPass  = "pass"  // the first response matched the schema
+	SchemaValidationRetry = "retry" // a retried response matched the schema
+	SchemaValidationFail  = "fail"  // no response matched the schema
+)
+
+// SchemaValidationHeader reports the structured output validation result
+const SchemaValidationHeader = "X-Schema-Validation"
+
+var (
+	defaultRetryBudgetMu sync.RWMutex
+	defaultRetryBudget   *middleware.RetryBudget
+)
+
+// SetRetryBudget installs the global budget upstream retries draw from; nil leaves retries unlimited
+func SetRetryBudget(b *middleware.RetryBudget) {
+	defaultRetryBudgetMu.Lock()
+	defaultRetryBudget = b
+	defaultRetryBudgetMu.Unlock()
+}
+
+// DefaultRetryBudget returns the global retry budget, or nil
+func DefaultRetryBudget() *middleware.RetryBudget {
+	defaultRetryBudgetMu.RLock()
+	defer defaultRetryBudgetMu.RUnlock()
+	return defaultRetryBudget
+}
+
+// StructuredOutputValidator 结构化输出校验：请求体中带有response_schema时，
+// 将助手回复内容按JSON解析并用该JSON Schema校验，不通过则把schema作为格式要求
+// 追加到系统提示后重试上游。
+type StructuredOutputValidator struct {
+	targetURL  string
+	targetKey  string
+	maxRetries int
+	client     *http.Client
+}
+
+// NewStructuredOutputValidator creates a validator retrying against the configured target API
+func NewStructuredOutputValidator(cfg *config.Config) *StructuredOutputValidator {
+	return &StructuredOutputValidator{
+		targetURL:  strings.TrimSuffix(cfg.TargetURL, "/") + "/chat/completions",
+		targetKey:  cfg.TargetKey,
+		maxRetries: cfg.MaxSchemaRetries,
+		client:     httpclient.NewClient("structured_output", RequestTimeout),
+	}
+}
+
+// hooks returns the proxy hooks validating one chat completion request
+func (v *StructuredOutputValidator) hooks(c *gin.Context) *proxyHooks {
+	var schema *jsonschema.Schema
+	var rawSchema json.RawMessage
+	var request map[string]interface{}
+
+	return &proxyHooks{
+		request: func(req map[string]interface{}) (bool, error) {
+			raw, ok := req["response_schema"]
+			if !ok {
+				return false, nil
+			}
+			// The field is gateway-only and never reaches the upstream
+			delete(req, "response_schema")
+
+			if stream, _ := req["stream"].(bool); stream {
+				return false, fmt.Errorf("response_schema is not supported for streaming requests")
+			}
+			if _, ok := raw.(map[string]interface{}); !ok {
+				return false, fmt.Errorf("response_schema must be a JSON Schema object")
+			}
+			var err error
+			if rawSchema, err = json.Marshal(raw); err == nil {
+				schema, err = compileSchema("request://response_schema.json", rawSchema)
+			}
+			if err != nil {
+				return false, fmt.Errorf("invalid response_schema: %w", err)
+			}
+			request = req
+			return true, nil
+		},
+		response: func(resp map[string]interface{}) error {
+			if schema == nil {
+				return nil
+			}
+
+			violations := validateAssistantContent(schema, resp)
+			if len(violations) == 0 {
+				c.Header(SchemaValidationHeader, SchemaValidationPass)
+				return nil
+			}
+
+			retryRequest := withFormatInstruction(request, rawSchema)
+			for attempt := 1; attempt <= v.maxRetries; attempt++ {
+				if !DefaultRetryBudget().Allow() {
+					logrus.Warn("Retry budget exhausted, returning the unvalidated response")
+					break
+				}
+				logrus.WithFields(logrus.Fields{
+					"attempt":    attempt,
+					"violations": violations,
+				}).Warn("Model response does not match response_schema, retrying")
+
+				retried, err := v.call(c.Request.Context(), retryRequest)
+				if err != nil {
+					logrus.WithError(err).Warn("Structured output retry failed")
+					break
+				}
+				// Gateway warnings about the original request still apply
+				if warnings, ok := resp["warnings"]; ok {
+					retried["warnings"] = warnings
+				}
+				replaceJSON(resp, retried)
+				if violations = validateAssistantContent(schema, resp); len(violations) == 0 {
+					c.Header(SchemaValidationHeader, SchemaValidationRetry)
+					return nil
+				}
+			}
+
+			c.Header(SchemaValidationHeader, SchemaValidationFail)
+			return nil
+		},
+		requestErrorCode: "invalid_response_schema",
+	}
+}
+
+// call sends a chat completion request to the target API
+func (v *StructuredOutputValidator) call(ctx context.Context, request map[string]interface{}) (map[string]interface{}, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.targetURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if v.targetKey != "" {
+		req.Header.Set("Authorization", "Bearer "+v.targetKey)
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxRequestBodySize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("target API returned status %d", resp.StatusCode)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("invalid target API response: %w", err)
+	}
+	return out, nil
+}
+
+// validateAssistantContent validates the first choice's message content against the schema
+func validateAssistantContent(schema *jsonschema.Schema, resp map[string]interface{}) []SchemaViolation {
+	content, ok := assistantContent(resp)
+	if !ok {
+		return []SchemaViolation{{Pointer: "/", Message: "response has no assistant content"}}
+	}
+	violations, err := validateBody(schema, []byte(content))
+	if err != nil {
+		return []SchemaViolation{{Pointer: "/", Message: err.Error()}}
+	}
+	return violations
+}
+
+// assistantContent returns choices[0].message.content
+func assistantContent(resp map[string]interface{}) (string, bool) {
+	choices, _ := resp["choices"].([]interface{})
+	if len(choices) == 0 {
+		return "", false
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	message, _ := choice["message"].(map[string]interface{})
+	content, ok := message["content"].(string)
+	return content, ok
+}
+
+// withFormatInstruction copies the request with the schema appended to the system prompt
+func withFormatInstruction(request map[string]interface{}, schema json.RawMessage) map[string]interface{} {
+	instruction := "Respond only with a JSON document that matches this JSON Schema, without any other text:\n" + string(schema)
+
+	out := make(map[string]interface{}, len(request))
+	for k, v := range request {
+		out[k] = v
+	}
+
+	messages, _ := request["messages"].([]interface{})
+	if len(messages) > 0 {
+		if first, ok := messages[0].(map[string]interface{}); ok && first["role"] == "system" {
+			if content, ok := first["content"].(string); ok {
+				system := make(map[string]interface{}, len(first))
+				for k, v := range first {
+					system[k] = v
+				}
+				system["content"] = content + "\n\n" + instruction
+				out["messages"] = append([]interface{}{system}, messages[1:]...)
+				return out
+			}
+		}
+	}
+	out["messages"] = append([]interface{}{map[string]interface{}{"role": "system", "content": instruction}}, messages...)
+	return out
+}
+
+// replaceJSON replaces the contents of dst with src
+func replaceJSON(dst, src map[string]interface{}) {
+	for k := range dst {
+		delete(dst, k)
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+}
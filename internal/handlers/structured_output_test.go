@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const personSchema = `{
+	"type": "object",
+	"required": ["name", "age"],
+	"properties": {"name": {"type": "string"}, "age": {"type": "integer"}}
+}`
+
+// structuredUpstream answers with the content returned by reply for each received request
+func structuredUpstream(t *testing.T, reply func(call int, request map[string]interface{}) string) (*gin.Engine, *[]map[string]interface{}) {
+	gin.SetMode(gin.TestMode)
+
+	var mu sync.Mutex
+	var requests []map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		call := len(requests)
+		mu.Unlock()
+
+		content, _ := json.Marshal(reply(call, req))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"chatcmpl-%d","choices":[{"index":0,"message":{"role":"assistant","content":%s}}]}`, call, content)
+	}))
+	t.Cleanup(upstream.Close)
+
+	router := gin.New()
+	router.POST("/v1/chat/completions", ChatCompletions(&config.Config{TargetURL: upstream.URL, MaxSchemaRetries: 2}))
+	return router, &requests
+}
+
+func structuredRequest(schema string) string {
+	return `{"model":"gpt-4","messages":[{"role":"system","content":"You are helpful."},{"role":"user","content":"Who is Ada?"}],"response_schema":` + schema + `}`
+}
+
+func TestStructuredOutputValidResponsePasses(t *testing.T) {
+	router, requests := structuredUpstream(t, func(int, map[string]interface{}) string {
+		return `{"name":"Ada","age":36}`
+	})
+
+	w := postJSON(router, "/v1/chat/completions", structuredRequest(personSchema))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, SchemaValidationPass, w.Header().Get(SchemaValidationHeader))
+	require.Len(t, *requests, 1)
+	assert.NotContains(t, (*requests)[0], "response_schema")
+}
+
+func TestStructuredOutputRetriesWithFormatInstruction(t *testing.T) {
+	router, requests := structuredUpstream(t, func(call int, _ map[string]interface{}) string {
+		if call == 1 {
+			return "Ada Lovelace was 36."
+		}
+		return `{"name":"Ada","age":36}`
+	})
+
+	w := postJSON(router, "/v1/chat/completions", structuredRequest(personSchema))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, SchemaValidationRetry, w.Header().Get(SchemaValidationHeader))
+	assert.Contains(t, w.Body.String(), "chatcmpl-2")
+
+	require.Len(t, *requests, 2)
+	messages := (*requests)[1]["messages"].([]interface{})
+	require.Len(t, messages, 2)
+	system := messages[0].(map[string]interface{})["content"].(string)
+	assert.True(t, strings.HasPrefix(system, "You are helpful."))
+	assert.Contains(t, system, `"required":["name","age"]`)
+	assert.NotContains(t, (*requests)[1], "response_schema")
+}
+
+func TestStructuredOutputMaxRetriesExhausted(t *testing.T) {
+	router, requests := structuredUpstream(t, func(int, map[string]interface{}) string {
+		return `{"name":"Ada","age":"thirty-six"}`
+	})
+
+	w := postJSON(router, "/v1/chat/completions", structuredRequest(personSchema))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, SchemaValidationFail, w.Header().Get(SchemaValidationHeader))
+	assert.Len(t, *requests, 3)
+}
+
+func TestStructuredOutputRequestValidation(t *testing.T) {
+	router, requests := structuredUpstream(t, func(int, map[string]interface{}) string { return "{}" })
+
+	for _, body := range []string{
+		structuredRequest(`{"type":"no-such-type"}`),
+		structuredRequest(`"not a schema"`),
+		`{"model":"gpt-4","stream":true,"messages":[],"response_schema":` + personSchema + `}`,
+	} {
+		w := postJSON(router, "/v1/chat/completions", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Contains(t, w.Body.String(), "invalid_response_schema")
+	}
+	assert.Empty(t, *requests)
+
+	// Requests without a schema are not validated
+	w := postJSON(router, "/v1/chat/completions", `{"model":"gpt-4","messages":[]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(SchemaValidationHeader))
+}
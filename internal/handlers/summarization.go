@@ -0,0 +1,503 @@
+package handlers
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/flags"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// summaryPrompt 摘要模型使用的固定提示
+const summaryPrompt = "Summarize the following conversation between a user and an assistant. " +
+	"Preserve every constraint, preference, fact and decision the user stated. " +
+	"Write concise plain text without preamble."
+
+// summaryStubPrefix 摘要占位消息的前缀
+const summaryStubPrefix = "Summary of earlier conversation: "
+
+// Summarizer 将一段对话压缩为摘要
+type Summarizer interface {
+	Summarize(ctx context.Context, messages []map[string]interface{}) (string, error)
+}
+
+// ModelSummarizer 调用OpenAI兼容接口上的廉价模型生成摘要
+type ModelSummarizer struct {
+	endpoint  string
+	apiKey    string
+	model     string
+	client    *http.Client
+	prompts   *PromptStore
+	promptRef string
+}
+
+// NewModelSummarizer creates a summarizer that calls model on the configured target API
+func NewModelSummarizer(targetURL, apiKey, model string) *ModelSummarizer {
+	return &ModelSummarizer{
+		endpoint: strings.TrimSuffix(targetURL, "/") + "/chat/completions",
+		apiKey:   apiKey,
+		model:    model,
+		client:   httpclient.NewClient("summarization", 30*time.Second),
+	}
+}
+
+// SetPromptTemplate makes the summarizer use a versioned prompt template instead of the built-in prompt
+func (s *ModelSummarizer) SetPromptTemplate(prompts *PromptStore, ref string) {
+	s.prompts = prompts
+	s.promptRef = ref
+}
+
+// prompt resolves the summarization prompt for the tenant in ctx, falling back to the built-in prompt
+func (s *ModelSummarizer) prompt(ctx context.Context) string {
+	if s.prompts == nil || s.promptRef == "" {
+		return summaryPrompt
+	}
+	t, err := s.prompts.ResolveApplied(ctx, s.promptRef, promptSubjectFrom(ctx))
+	if err != nil {
+		logrus.WithError(err).WithField("template", s.promptRef).Warn("Failed to resolve summarization prompt template, using the built-in prompt")
+		return summaryPrompt
+	}
+	return t.Body
+}
+
+// Summarize sends the transcript with the summarization prompt
+func (s *ModelSummarizer) Summarize(ctx context.Context, messages []map[string]interface{}) (string, error) {
+	var transcript strings.Builder
+	for _, m := range messages {
+		role, _ := m["role"].(string)
+		transcript.WriteString(role)
+		transcript.WriteString(": ")
+		transcript.WriteString(messageText(m))
+		transcript.WriteString("\n")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model": s.model,
+		"messages": []map[string]string{
+			{"role": "system", "content": s.prompt(ctx)},
+			{"role": "user", "content": transcript.String()},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gateway-Internal", "summarization")
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("summarization request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("summarization model returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid summarization response: %w", err)
+	}
+	if len(result.Choices) == 0 || strings.TrimSpace(result.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("summarization model returned no content")
+	}
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+}
+
+// SummaryRecord 摘要与被替换原始消息的对应关系
+type SummaryRecord struct {
+	ConversationID string                   `json:"conversation_id"`
+	Owner          string                   `json:"owner"` // middleware.RequestOwner of the conversation
+	Summary        string                   `json:"summary"`
+	Covered        int                      `json:"covered"` // leading non-system messages replaced by the stub
+	Originals      []map[string]interface{} `json:"originals"`
+	CreatedAt      time.Time                `json:"created_at"`
+
+	// Prompt template versions the summary was written with
+	PromptTemplates []AppliedPrompt `json:"prompt_templates,omitempty"`
+
+	prefixHash string
+}
+
+// HistorySummarizer 对超出上下文窗口的会话，异步地用廉价模型摘要最早的消息，
+// 之后的请求用一条系统摘要消息替换这些消息。摘要尚未生成或失败时退回head策略。
+// 会话按调用方（middleware.RequestOwner）隔离，闲置超过 retention 或超出
+// maxConversations 时按最近最少使用淘汰。
+type HistorySummarizer struct {
+	summarizer       Summarizer
+	truncator        *ContextWindowTruncator
+	maxStubChars     int
+	minInterval      time.Duration
+	retention        time.Duration
+	maxConversations int
+
+	mu            sync.Mutex
+	conversations map[summaryKey]*list.Element
+	order         *list.List // of *summaryConversation, most recently used first
+	inflight      sync.WaitGroup
+}
+
+// summaryKey identifies a conversation of one owner; conversation IDs are
+// chosen by clients and may collide across owners
+type summaryKey struct {
+	owner          string
+	conversationID string
+}
+
+// summaryConversation holds the summaries of one conversation
+type summaryConversation struct {
+	key         summaryKey
+	records     []*SummaryRecord // oldest first
+	lastAttempt time.Time
+	lastUsed    time.Time
+}
+
+var (
+	defaultHistorySummarizer   *HistorySummarizer
+	defaultHistorySummarizerMu sync.RWMutex
+)
+
+// NewHistorySummarizer creates a history summarizer
+func NewHistorySummarizer(summarizer Summarizer, cfg *config.ContextTruncationConfig) *HistorySummarizer {
+	maxChars := cfg.SummaryMaxChars
+	if maxChars <= 0 {
+		maxChars = 2000
+	}
+	retention := cfg.SummaryRetention
+	if retention <= 0 {
+		retention = 24 * time.Hour
+	}
+	maxConversations := cfg.SummaryMaxConversations
+	if maxConversations <= 0 {
+		maxConversations = 10000
+	}
+	return &HistorySummarizer{
+		summarizer:       summarizer,
+		truncator:        NewContextWindowTruncator(cfg),
+		maxStubChars:     maxChars,
+		minInterval:      cfg.SummaryMinInterval,
+		retention:        retention,
+		maxConversations: maxConversations,
+		conversations:    make(map[summaryKey]*list.Element),
+		order:            list.New(),
+	}
+}
+
+// SetHistorySummarizer installs the summarizer used by the proxy
+func SetHistorySummarizer(hs *HistorySummarizer) {
+	defaultHistorySummarizerMu.Lock()
+	defaultHistorySummarizer = hs
+	defaultHistorySummarizerMu.Unlock()
+}
+
+// DefaultHistorySummarizer returns the summarizer used by the proxy, or nil
+func DefaultHistorySummarizer() *HistorySummarizer {
+	defaultHistorySummarizerMu.RLock()
+	defer defaultHistorySummarizerMu.RUnlock()
+	return defaultHistorySummarizer
+}
+
+// Apply fits the request into the model context window, returning whether the
+// messages were changed. A known summary of the conversation prefix is substituted
+// first; if the request still does not fit, a new summary is scheduled and the
+// oldest messages are dropped for this request. The prompt template versions of
+// a substituted summary are recorded in ctx. Summaries are only shared between
+// requests of the same owner.
+func (hs *HistorySummarizer) Apply(ctx context.Context, owner, conversationID string, request map[string]interface{}) bool {
+	_, limit, messages, ok := hs.truncator.contextLimit(request)
+	if !ok || EstimateTokens(messages) <= limit {
+		return false
+	}
+
+	systems, turns := splitSystemMessages(messages)
+
+	result := messages
+	covered := 0
+	key := summaryKey{owner: owner, conversationID: conversationID}
+	if record := hs.latestRecord(key, turns); record != nil {
+		covered = record.Covered
+		result = buildSummarized(systems, record.Summary, turns[covered:])
+		for _, applied := range record.PromptTemplates {
+			recordAppliedPrompt(ctx, applied)
+		}
+	}
+
+	if EstimateTokens(result) > limit {
+		hs.schedule(key, systems, turns, covered, limit)
+		result = truncateHead(result, limit)
+	}
+
+	setMessages(request, result)
+	return true
+}
+
+// Records returns the summaries of an owner's conversation, oldest first
+func (hs *HistorySummarizer) Records(owner, conversationID string) []SummaryRecord {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	conv := hs.conversation(summaryKey{owner: owner, conversationID: conversationID}, false)
+	if conv == nil {
+		return []SummaryRecord{}
+	}
+	records := make([]SummaryRecord, 0, len(conv.records))
+	for _, r := range conv.records {
+		records = append(records, *r)
+	}
+	return records
+}
+
+// conversation returns the entry of key and marks it used, creating it when
+// create is set. Idle entries are dropped first and the least recently used
+// beyond maxConversations afterwards. Callers hold hs.mu.
+func (hs *HistorySummarizer) conversation(key summaryKey, create bool) *summaryConversation {
+	now := time.Now()
+	for back := hs.order.Back(); back != nil && now.Sub(back.Value.(*summaryConversation).lastUsed) > hs.retention; back = hs.order.Back() {
+		hs.removeConversation(back)
+	}
+
+	if element, ok := hs.conversations[key]; ok {
+		conv := element.Value.(*summaryConversation)
+		conv.lastUsed = now
+		hs.order.MoveToFront(element)
+		return conv
+	}
+	if !create {
+		return nil
+	}
+	conv := &summaryConversation{key: key, lastUsed: now}
+	hs.conversations[key] = hs.order.PushFront(conv)
+	for hs.order.Len() > hs.maxConversations {
+		hs.removeConversation(hs.order.Back())
+	}
+	return conv
+}
+
+func (hs *HistorySummarizer) removeConversation(element *list.Element) {
+	hs.order.Remove(element)
+	delete(hs.conversations, element.Value.(*summaryConversation).key)
+}
+
+// Wait blocks until in-flight summarizations finish
+func (hs *HistorySummarizer) Wait() {
+	hs.inflight.Wait()
+}
+
+// latestRecord returns the newest summary whose originals are still the conversation prefix
+func (hs *HistorySummarizer) latestRecord(key summaryKey, turns []map[string]interface{}) *SummaryRecord {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	conv := hs.conversation(key, false)
+	if conv == nil {
+		return nil
+	}
+	for i := len(conv.records) - 1; i >= 0; i-- {
+		r := conv.records[i]
+		// 始终保留最后一条消息
+		if r.Covered < len(turns) && hashMessages(turns[:r.Covered]) == r.prefixHash {
+			return r
+		}
+	}
+	return nil
+}
+
+// schedule starts an asynchronous summarization unless one ran recently for the conversation
+func (hs *HistorySummarizer) schedule(key summaryKey, systems, turns []map[string]interface{}, covered, limit int) {
+	// 为摘要占位消息预留空间后，计算需要摘要的最早消息数
+	stubTokens := hs.maxStubChars/4 + messageOverheadTokens + len(summaryStubPrefix)/4
+	budget := limit - EstimateTokens(systems) - stubTokens
+	remaining := EstimateTokens(turns)
+	chunk := 0
+	for chunk < len(turns)-1 && remaining > budget {
+		remaining -= EstimateMessageTokens(turns[chunk])
+		chunk++
+	}
+	if chunk <= covered {
+		return
+	}
+
+	hs.mu.Lock()
+	conv := hs.conversation(key, true)
+	if !conv.lastAttempt.IsZero() && time.Since(conv.lastAttempt) < hs.minInterval {
+		hs.mu.Unlock()
+		return
+	}
+	conv.lastAttempt = time.Now()
+	previous := findRecord(conv.records, covered, turns)
+	hs.mu.Unlock()
+
+	originals := append([]map[string]interface{}(nil), turns[:chunk]...)
+
+	// 已有摘要时只需把旧摘要与新增消息一起重新摘要
+	input := originals
+	if previous != nil {
+		input = append([]map[string]interface{}{summaryStub(previous.Summary)}, turns[covered:chunk]...)
+	}
+
+	hs.inflight.Add(1)
+	go func() {
+		defer hs.inflight.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		ctx, applied := withAppliedPrompts(withPromptSubject(ctx, flags.Subject{Tenant: key.owner}))
+
+		logger := logrus.WithFields(logrus.Fields{
+			"conversation_id": key.conversationID,
+			"owner":           key.owner,
+			"internal":        true,
+			"messages":        len(input),
+		})
+
+		summary, err := hs.summarizer.Summarize(ctx, input)
+		if err != nil {
+			middleware.RecordInternalSummarization("failure")
+			logger.WithError(err).Warn("Conversation summarization failed, falling back to drop-oldest")
+			return
+		}
+		middleware.RecordInternalSummarization("success")
+		logger.Info("Conversation summarized")
+
+		record := &SummaryRecord{
+			ConversationID: key.conversationID,
+			Owner:          key.owner,
+			Summary:        truncateUTF8(summary, hs.maxStubChars),
+			Covered:        chunk,
+			Originals:      originals,
+			CreatedAt:      time.Now(),
+			prefixHash:     hashMessages(originals),
+
+			PromptTemplates: applied.list(),
+		}
+
+		hs.mu.Lock()
+		conv := hs.conversation(key, true)
+		conv.records = append(conv.records, record)
+		hs.mu.Unlock()
+	}()
+}
+
+// findRecord returns the record covering exactly covered messages; callers hold hs.mu
+func findRecord(records []*SummaryRecord, covered int, turns []map[string]interface{}) *SummaryRecord {
+	if covered == 0 {
+		return nil
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		if records[i].Covered == covered && hashMessages(turns[:covered]) == records[i].prefixHash {
+			return records[i]
+		}
+	}
+	return nil
+}
+
+// GetConversationSummaries returns a conversation's summaries together with the
+// original messages they replaced. Callers only see their own conversations.
+func GetConversationSummaries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hs := DefaultHistorySummarizer()
+		if hs == nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": gin.H{
+					"message": "History summarization is not enabled",
+					"type":    "invalid_request_error",
+					"code":    "summarization_disabled",
+				},
+			})
+			return
+		}
+
+		conversationID := c.Param("id")
+		c.JSON(http.StatusOK, gin.H{
+			"conversation_id": conversationID,
+			"summaries":       hs.Records(middleware.RequestOwner(c), conversationID),
+		})
+	}
+}
+
+func splitSystemMessages(messages []map[string]interface{}) (systems, turns []map[string]interface{}) {
+	for _, m := range messages {
+		if isSystemMessage(m) {
+			systems = append(systems, m)
+		} else {
+			turns = append(turns, m)
+		}
+	}
+	return systems, turns
+}
+
+// buildSummarized places the summary stub after the system prompts and before the remaining turns
+func buildSummarized(systems []map[string]interface{}, summary string, turns []map[string]interface{}) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(systems)+1+len(turns))
+	result = append(result, systems...)
+	result = append(result, summaryStub(summary))
+	return append(result, turns...)
+}
+
+func summaryStub(summary string) map[string]interface{} {
+	return map[string]interface{}{"role": "system", "content": summaryStubPrefix + summary}
+}
+
+func hashMessages(messages []map[string]interface{}) string {
+	data, _ := json.Marshal(messages)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func messageText(m map[string]interface{}) string {
+	switch content := m["content"].(type) {
+	case string:
+		return content
+	case []interface{}:
+		var texts []string
+		for _, part := range content {
+			if p, ok := part.(map[string]interface{}); ok {
+				if text, ok := p["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+		return strings.Join(texts, " ")
+	}
+	return ""
+}
+
+// truncateUTF8 caps s at max bytes without splitting a character, matching how tokens are estimated
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSummaryBackend 模拟摘要模型，返回固定摘要并统计调用次数
+func fakeSummaryBackend(t *testing.T, status int, calls *int32) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		assert.Equal(t, "summarization", r.Header.Get("X-Gateway-Internal"))
+
+		var body map[string]interface{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "cheap-model", body["model"])
+
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []interface{}{
+				map[string]interface{}{"message": map[string]interface{}{
+					"role":    "assistant",
+					"content": "user wants answers in French " + strings.Repeat("and more detail ", 20),
+				}},
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestHistorySummarizer(url string, minInterval time.Duration) *HistorySummarizer {
+	hs := NewHistorySummarizer(NewModelSummarizer(url, "", "cheap-model"), &config.ContextTruncationConfig{
+		Enabled:            true,
+		DefaultStrategy:    "head",
+		SummaryMaxChars:    40,
+		SummaryMinInterval: minInterval,
+	})
+	hs.truncator.models = map[string]ThirdPartyModelInfo{
+		"test-model": {ModelType: "chat", MaxContextTokens: 80},
+	}
+	return hs
+}
+
+func conversationRequest(extra ...interface{}) map[string]interface{} {
+	messages := []interface{}{
+		message("system", "S0", 10),
+		message("user", "U1", 20),
+		message("assistant", "A1", 20),
+		message("user", "U2", 20),
+		message("assistant", "A2", 20),
+		message("user", "U3", 10),
+	}
+	return map[string]interface{}{"model": "test-model", "messages": append(messages, extra...)}
+}
+
+func requestTokens(t *testing.T, request map[string]interface{}) int {
+	_, _, messages, ok := newTestTruncator(TruncateHead).contextLimit(request)
+	require.True(t, ok)
+	return EstimateTokens(messages)
+}
+
+func TestHistorySummarizerInsertsStub(t *testing.T) {
+	var calls int32
+	server := fakeSummaryBackend(t, http.StatusOK, &calls)
+	hs := newTestHistorySummarizer(server.URL, time.Hour)
+
+	// The first oversized request drops the oldest turns while the summary is built
+	request := conversationRequest()
+	assert.True(t, hs.Apply(context.Background(), "owner-a", "conv-1", request))
+	assert.LessOrEqual(t, requestTokens(t, request), 80)
+	assert.Equal(t, []string{"S0", "A1", "U2", "A2", "U3"}, contents(t, request))
+
+	hs.Wait()
+	records := hs.Records("owner-a", "conv-1")
+	require.Len(t, records, 1)
+	assert.Equal(t, 3, records[0].Covered)
+	assert.Len(t, records[0].Originals, 3)
+	assert.Equal(t, "owner-a", records[0].Owner)
+	assert.LessOrEqual(t, len(records[0].Summary), 40, "stub content is capped")
+
+	// Later requests replace the summarized prefix with the stub after the system prompt
+	request = conversationRequest()
+	assert.True(t, hs.Apply(context.Background(), "owner-a", "conv-1", request))
+	assert.LessOrEqual(t, requestTokens(t, request), 80)
+	assert.Equal(t, []string{"S0", "Su", "A2", "U3"}, contents(t, request))
+
+	stub := request["messages"].([]interface{})[1].(map[string]interface{})
+	assert.Equal(t, "system", stub["role"])
+	assert.True(t, strings.HasPrefix(stub["content"].(string), summaryStubPrefix+"user wants answers in French"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHistorySummarizerBoundsFrequency(t *testing.T) {
+	var calls int32
+	server := fakeSummaryBackend(t, http.StatusOK, &calls)
+	hs := newTestHistorySummarizer(server.URL, time.Hour)
+
+	hs.Apply(context.Background(), "owner-a", "conv-1", conversationRequest())
+	hs.Wait()
+
+	// The conversation keeps growing, but another summary is not due yet
+	request := conversationRequest(message("assistant", "A3", 30), message("user", "U4", 10))
+	assert.True(t, hs.Apply(context.Background(), "owner-a", "conv-1", request))
+	hs.Wait()
+
+	assert.LessOrEqual(t, requestTokens(t, request), 80)
+	assert.Equal(t, "Su", contents(t, request)[1])
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Len(t, hs.Records("owner-a", "conv-1"), 1)
+}
+
+func TestHistorySummarizerFallsBackOnFailure(t *testing.T) {
+	var calls int32
+	server := fakeSummaryBackend(t, http.StatusInternalServerError, &calls)
+	hs := newTestHistorySummarizer(server.URL, 0)
+
+	for i := 0; i < 2; i++ {
+		request := conversationRequest()
+		assert.True(t, hs.Apply(context.Background(), "owner-a", "conv-1", request))
+		hs.Wait()
+		assert.LessOrEqual(t, requestTokens(t, request), 80)
+		assert.Equal(t, []string{"S0", "A1", "U2", "A2", "U3"}, contents(t, request))
+	}
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Empty(t, hs.Records("owner-a", "conv-1"))
+}
+
+func TestHistorySummarizerIgnoresFittingRequests(t *testing.T) {
+	hs := newTestHistorySummarizer("http://127.0.0.1:1", time.Hour)
+
+	request := map[string]interface{}{
+		"model":    "test-model",
+		"messages": []interface{}{message("user", "U1", 20)},
+	}
+	assert.False(t, hs.Apply(context.Background(), "owner-a", "conv-1", request))
+	assert.Empty(t, hs.Records("owner-a", "conv-1"))
+}
+
+func TestHistorySummarizerIsolatesOwners(t *testing.T) {
+	var calls int32
+	server := fakeSummaryBackend(t, http.StatusOK, &calls)
+	hs := newTestHistorySummarizer(server.URL, time.Hour)
+
+	hs.Apply(context.Background(), "owner-a", "conv-1", conversationRequest())
+	hs.Wait()
+	require.Len(t, hs.Records("owner-a", "conv-1"), 1)
+	assert.Empty(t, hs.Records("owner-b", "conv-1"))
+
+	// Another owner reusing the conversation ID gets no summary of owner-a's conversation
+	request := conversationRequest()
+	assert.True(t, hs.Apply(context.Background(), "owner-b", "conv-1", request))
+	assert.NotContains(t, contents(t, request), "Su")
+	hs.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "owner-b's conversation is summarized on its own")
+}
+
+func TestHistorySummarizerBoundsConversations(t *testing.T) {
+	var calls int32
+	server := fakeSummaryBackend(t, http.StatusOK, &calls)
+	hs := newTestHistorySummarizer(server.URL, time.Hour)
+	hs.maxConversations = 2
+
+	for _, conversationID := range []string{"conv-1", "conv-2", "conv-3"} {
+		hs.Apply(context.Background(), "owner-a", conversationID, conversationRequest())
+		hs.Wait()
+	}
+	assert.Empty(t, hs.Records("owner-a", "conv-1"), "the least recently used conversation is dropped")
+	assert.Len(t, hs.Records("owner-a", "conv-2"), 1)
+	assert.Len(t, hs.Records("owner-a", "conv-3"), 1)
+
+	// Idle conversations expire
+	hs.retention = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	assert.Empty(t, hs.Records("owner-a", "conv-3"))
+	assert.Zero(t, hs.order.Len())
+	assert.Empty(t, hs.conversations)
+}
+
+func TestGetConversationSummariesScopedToOwner(t *testing.T) {
+	var calls int32
+	server := fakeSummaryBackend(t, http.StatusOK, &calls)
+	hs := newTestHistorySummarizer(server.URL, time.Hour)
+	SetHistorySummarizer(hs)
+	t.Cleanup(func() { SetHistorySummarizer(nil) })
+	middleware.SetKeyOwnerResolver(func(apiKey string) (string, bool) {
+		return map[string]string{"key-a": "alice", "key-b": "bob"}[apiKey], apiKey != "unmanaged"
+	})
+	t.Cleanup(func() { middleware.SetKeyOwnerResolver(nil) })
+
+	hs.Apply(context.Background(), "alice", "conv-1", conversationRequest())
+	hs.Wait()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/v1/conversations/:id/summaries", GetConversationSummaries())
+	summaries := func(apiKey, tenant string) []SummaryRecord {
+		req := httptest.NewRequest(http.MethodGet, "/v1/conversations/conv-1/summaries", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("X-Tenant-ID", tenant)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Summaries []SummaryRecord `json:"summaries"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Summaries
+	}
+
+	assert.Len(t, summaries("key-a", ""), 1)
+	assert.Empty(t, summaries("key-b", "alice"), "X-Tenant-ID does not select the owner")
+	assert.Empty(t, summaries("unmanaged", ""))
+}
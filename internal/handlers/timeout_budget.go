@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// timeoutAction is the route action capping how long the gateway waits for a
+// request, measured from its arrival: {"timeout": "20s"}
+const timeoutAction = "timeout"
+
+// compileRouteTimeout validates the "timeout" action of a route; zero means unset
+func compileRouteTimeout(actions map[string]interface{}) (time.Duration, error) {
+	raw, ok := actions[timeoutAction]
+	if !ok {
+		return 0, nil
+	}
+	text, ok := raw.(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid %s action: must be a duration such as \"20s\"", timeoutAction)
+	}
+	timeout, err := time.ParseDuration(text)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s action %q: must be a positive duration", timeoutAction, text)
+	}
+	return timeout, nil
+}
+
+// budgetAware reports whether an upstream honours the X-Request-Timeout-Ms header
+func budgetAware(cfg *config.UpstreamBudgetConfig, target *url.URL) bool {
+	for _, host := range cfg.AwareUpstreams {
+		if strings.EqualFold(host, target.Host) || strings.EqualFold(host, target.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// upstreamDeadline is the earliest of the request context deadline and the
+// route and model timeouts counted from the request's arrival, so time spent
+// in admission queues comes out of the upstream's budget
+func upstreamDeadline(c *gin.Context, cfg *config.UpstreamBudgetConfig, model string, fallbackStart time.Time) (time.Time, bool) {
+	deadline, ok := c.Request.Context().Deadline()
+
+	start, found := middleware.RequestStart(c)
+	if !found {
+		start = fallbackStart
+	}
+	earliest := func(timeout time.Duration) {
+		if timeout <= 0 {
+			return
+		}
+		if candidate := start.Add(timeout); !ok || candidate.Before(deadline) {
+			deadline, ok = candidate, true
+		}
+	}
+	// Route actions were validated when the route was saved
+	timeout, _ := compileRouteTimeout(routeActions(c))
+	earliest(timeout)
+	earliest(cfg.ModelTimeouts[model])
+	return deadline, ok
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupBudgetRouter proxies chat completions behind an admission phase taking admission
+func setupBudgetRouter(t *testing.T, budget config.UpstreamBudgetConfig, admission time.Duration, aware bool) (*gin.Engine, func() (string, int)) {
+	gin.SetMode(gin.TestMode)
+
+	var mu sync.Mutex
+	var lastBudget string
+	var calls int
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastBudget = r.Header.Get(httpclient.TimeoutBudgetHeader)
+		calls++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set(httpclient.ServedInHeader, "5")
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	if aware {
+		target, err := url.Parse(upstream.URL)
+		require.NoError(t, err)
+		budget.AwareUpstreams = []string{target.Host}
+	}
+	if budget.MinBudget == 0 {
+		budget.MinBudget = 100 * time.Millisecond
+	}
+
+	router := gin.New()
+	router.Use(middleware.RequestTimeout(2 * time.Second))
+	// Stands in for the priority queue and rate limiters holding the request back
+	router.Use(func(c *gin.Context) {
+		time.Sleep(admission)
+		c.Next()
+	})
+	router.POST("/v1/chat/completions", ChatCompletions(&config.Config{TargetURL: upstream.URL, MaxImageSizeMB: 20, UpstreamBudget: budget}))
+	return router, func() (string, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return lastBudget, calls
+	}
+}
+
+func TestUpstreamBudgetShrinksWithAdmissionTime(t *testing.T) {
+	budgetAfter := func(admission time.Duration) int {
+		router, upstreamSaw := setupBudgetRouter(t, config.UpstreamBudgetConfig{}, admission, true)
+		w := lifecycleChat(router, "key-a", textRequest("qwen-turbo"))
+		require.Equal(t, http.StatusOK, w.Code)
+		value, _ := upstreamSaw()
+		ms, err := strconv.Atoi(value)
+		require.NoError(t, err, "budget header %q", value)
+		return ms
+	}
+
+	fast := budgetAfter(0)
+	assert.LessOrEqual(t, fast, 2000)
+	assert.Greater(t, fast, 1500)
+
+	// Both budgets are truncated to whole milliseconds and the fast request's own
+	// overhead varies, so allow some slack rather than an exact 400ms difference
+	const slack = 50
+	slow := budgetAfter(400 * time.Millisecond)
+	assert.LessOrEqual(t, slow, fast-400+slack)
+	assert.Greater(t, slow, 0)
+}
+
+func TestUpstreamBudgetModelTimeout(t *testing.T) {
+	budget := config.UpstreamBudgetConfig{ModelTimeouts: map[string]time.Duration{"qwen-max": time.Second}}
+	router, upstreamSaw := setupBudgetRouter(t, budget, 0, true)
+
+	w := lifecycleChat(router, "key-a", textRequest("qwen-max"))
+	require.Equal(t, http.StatusOK, w.Code)
+	value, _ := upstreamSaw()
+	ms, err := strconv.Atoi(value)
+	require.NoError(t, err)
+	// The model timeout is tighter than the 2s request timeout
+	assert.LessOrEqual(t, ms, 1000)
+	assert.Greater(t, ms, 500)
+}
+
+func TestUpstreamBudgetExhaustedFailsLocally(t *testing.T) {
+	budget := config.UpstreamBudgetConfig{ModelTimeouts: map[string]time.Duration{"qwen-max": 200 * time.Millisecond}}
+	router, upstreamSaw := setupBudgetRouter(t, budget, 250*time.Millisecond, true)
+
+	w := lifecycleChat(router, "key-a", textRequest("qwen-max"))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), "deadline_exceeded")
+	_, calls := upstreamSaw()
+	assert.Zero(t, calls)
+}
+
+func TestUpstreamBudgetOnlyForAwareUpstreams(t *testing.T) {
+	router, upstreamSaw := setupBudgetRouter(t, config.UpstreamBudgetConfig{}, 0, false)
+
+	w := lifecycleChat(router, "key-a", textRequest("qwen-turbo"))
+	require.Equal(t, http.StatusOK, w.Code)
+	value, calls := upstreamSaw()
+	assert.Equal(t, 1, calls)
+	assert.Empty(t, value)
+}
+
+func TestCompileRouteTimeout(t *testing.T) {
+	timeout, err := compileRouteTimeout(map[string]interface{}{"timeout": "20s"})
+	require.NoError(t, err)
+	assert.Equal(t, 20*time.Second, timeout)
+
+	timeout, err = compileRouteTimeout(nil)
+	require.NoError(t, err)
+	assert.Zero(t, timeout)
+
+	for _, value := range []interface{}{"soon", "-1s", float64(20)} {
+		_, err := compileRouteTimeout(map[string]interface{}{"timeout": value})
+		assert.Error(t, err, value)
+	}
+}
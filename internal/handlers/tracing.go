@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of upstream calls. Without a configured provider
+// its spans are non-recording and the attributes below are never built.
+var tracer = otel.Tracer("go-aigateway/handlers")
+
+// startUpstreamSpan starts the client span of an upstream call and returns req
+// bound to it, so the W3C trace headers name this span as the parent
+func startUpstreamSpan(req *http.Request, endpoint, model string) (*http.Request, trace.Span) {
+	ctx, span := tracer.Start(req.Context(), "upstream "+endpoint, trace.WithSpanKind(trace.SpanKindClient))
+	if span.IsRecording() {
+		span.SetAttributes(
+			attribute.String("http.method", req.Method),
+			attribute.String("server.address", req.URL.Host),
+			attribute.String("ai.model", model),
+			attribute.String("ai.provider", providerForModel(model, req.URL.Host)),
+		)
+	}
+	return req.WithContext(ctx), span
+}
+
+// endUpstreamSpan records the upstream status, or err when there is no response
+func endUpstreamSpan(span trace.Span, status int, err error) {
+	if !span.IsRecording() {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// setUsageAttributes records the token usage of an OpenAI-style response
+func setUsageAttributes(span trace.Span, resp map[string]interface{}) {
+	if !span.IsRecording() {
+		return
+	}
+	usage, _ := resp["usage"].(map[string]interface{})
+	for _, key := range []string{"prompt_tokens", "completion_tokens", "total_tokens"} {
+		if tokens, ok := usage[key].(float64); ok {
+			span.SetAttributes(attribute.Int64("ai.usage."+key, int64(tokens)))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// useTestTracer records the spans of the package tracer for the test
+func useTestTracer(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := tracer
+	tracer = provider.Tracer("test")
+	t.Cleanup(func() { tracer = previous })
+	return recorder
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestProxyUpstreamSpan(t *testing.T) {
+	recorder := useTestTracer(t)
+	var traceParent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceParent = r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gin.H{
+			"id":    "chatcmpl-1",
+			"usage": gin.H{"prompt_tokens": 12, "completion_tokens": 30, "total_tokens": 42},
+		})
+	}))
+	defer upstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/chat/completions", ChatHandler(&config.Config{TargetURL: upstream.URL, TargetKey: "test-key"}))
+
+	body, _ := json.Marshal(gin.H{"model": "gpt-4o", "messages": []gin.H{{"role": "user", "content": "hi"}}})
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, "upstream /chat/completions", span.Name())
+	assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+	attrs := spanAttributes(span)
+	assert.Equal(t, "gpt-4o", attrs["ai.model"].AsString())
+	assert.NotEmpty(t, attrs["ai.provider"].AsString())
+	assert.Equal(t, int64(http.StatusOK), attrs["http.status_code"].AsInt64())
+	assert.Equal(t, int64(12), attrs["ai.usage.prompt_tokens"].AsInt64())
+	assert.Equal(t, int64(30), attrs["ai.usage.completion_tokens"].AsInt64())
+	assert.Equal(t, int64(42), attrs["ai.usage.total_tokens"].AsInt64())
+
+	// The upstream sees the upstream span as its parent
+	sc := span.SpanContext()
+	assert.Equal(t, "00-"+sc.TraceID().String()+"-"+sc.SpanID().String()+"-01", traceParent)
+}
+
+func TestProxyUpstreamSpanRecordsFailure(t *testing.T) {
+	recorder := useTestTracer(t)
+	upstream := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	upstream.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/v1/completions", CompletionHandler(&config.Config{TargetURL: upstream.URL}))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/completions", bytes.NewReader([]byte(`{"model":"gpt-4o","prompt":"hi"}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusBadGateway, w.Code)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "upstream /completions", spans[0].Name())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.NotEmpty(t, spans[0].Events(), "the error is recorded")
+}
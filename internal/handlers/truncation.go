@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"go-aigateway/internal/config"
+)
+
+// TruncationStrategy 上下文截断策略
+type TruncationStrategy string
+
+const (
+	// TruncateHead 从最早的消息开始删除
+	TruncateHead TruncationStrategy = "head"
+	// TruncateTail 从最新的消息开始删除，保留最后一轮用户消息
+	TruncateTail TruncationStrategy = "tail"
+	// TruncateMiddle 保留系统提示、前M轮和后N轮，删除中间部分
+	TruncateMiddle TruncationStrategy = "middle"
+)
+
+// messageOverheadTokens 每条消息的格式开销（role、分隔符等）
+const messageOverheadTokens = 4
+
+// ContextWindowTruncator 在提示超过模型上下文窗口时截断消息列表
+type ContextWindowTruncator struct {
+	enabled         bool
+	defaultStrategy TruncationStrategy
+	keepFirstTurns  int
+	keepLastTurns   int
+	models          map[string]ThirdPartyModelInfo
+}
+
+// NewContextWindowTruncator 创建上下文截断器
+func NewContextWindowTruncator(cfg *config.ContextTruncationConfig) *ContextWindowTruncator {
+	return &ContextWindowTruncator{
+		enabled:         cfg.Enabled,
+		defaultStrategy: TruncationStrategy(cfg.DefaultStrategy),
+		keepFirstTurns:  cfg.KeepFirstTurns,
+		keepLastTurns:   cfg.KeepLastTurns,
+		models:          GetThirdPartyModelInfo(),
+	}
+}
+
+// EstimateMessageTokens 粗略估算单条消息的token数（约4个字符一个token）
+func EstimateMessageTokens(message map[string]interface{}) int {
+	chars := 0
+	switch content := message["content"].(type) {
+	case string:
+		chars = len(content)
+	case []interface{}:
+		// 多模态消息只计算文本部分
+		for _, part := range content {
+			if p, ok := part.(map[string]interface{}); ok {
+				if text, ok := p["text"].(string); ok {
+					chars += len(text)
+				}
+			}
+		}
+	}
+	return chars/4 + messageOverheadTokens
+}
+
+// EstimateTokens 估算消息列表的token总数
+func EstimateTokens(messages []map[string]interface{}) int {
+	total := 0
+	for _, m := range messages {
+		total += EstimateMessageTokens(m)
+	}
+	return total
+}
+
+// Truncate 截断请求中的messages字段，返回是否发生了截断
+func (t *ContextWindowTruncator) Truncate(request map[string]interface{}) bool {
+	if t == nil || !t.enabled {
+		return false
+	}
+
+	info, limit, messages, ok := t.contextLimit(request)
+	if !ok || EstimateTokens(messages) <= limit {
+		return false
+	}
+
+	strategy := info.TruncationStrategy
+	if strategy == "" {
+		strategy = t.defaultStrategy
+	}
+
+	var truncated []map[string]interface{}
+	switch strategy {
+	case TruncateTail:
+		truncated = truncateTail(messages, limit)
+	case TruncateMiddle:
+		truncated = truncateMiddle(messages, limit, t.keepFirstTurns, t.keepLastTurns)
+	default:
+		truncated = truncateHead(messages, limit)
+	}
+
+	if len(truncated) == len(messages) {
+		return false
+	}
+
+	setMessages(request, truncated)
+	return true
+}
+
+// contextLimit 返回请求模型的上下文窗口和消息列表，模型未登记或消息格式不正确时ok为false
+func (t *ContextWindowTruncator) contextLimit(request map[string]interface{}) (info ThirdPartyModelInfo, limit int, messages []map[string]interface{}, ok bool) {
+	model, _ := request["model"].(string)
+	info, ok = t.models[model]
+	if !ok {
+		return info, 0, nil, false
+	}
+	limit = info.MaxContextTokens
+	if limit <= 0 {
+		limit = info.MaxTokens
+	}
+	if limit <= 0 {
+		return info, 0, nil, false
+	}
+
+	rawMessages, ok := request["messages"].([]interface{})
+	if !ok {
+		return info, 0, nil, false
+	}
+	messages = make([]map[string]interface{}, 0, len(rawMessages))
+	for _, raw := range rawMessages {
+		m, isMap := raw.(map[string]interface{})
+		if !isMap {
+			return info, 0, nil, false
+		}
+		messages = append(messages, m)
+	}
+	return info, limit, messages, true
+}
+
+func setMessages(request map[string]interface{}, messages []map[string]interface{}) {
+	result := make([]interface{}, len(messages))
+	for i, m := range messages {
+		result[i] = m
+	}
+	request["messages"] = result
+}
+
+func isSystemMessage(m map[string]interface{}) bool {
+	role, _ := m["role"].(string)
+	return role == "system"
+}
+
+// lastUserIndex 返回最后一条用户消息的下标
+func lastUserIndex(messages []map[string]interface{}) int {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if role, _ := messages[i]["role"].(string); role == "user" {
+			return i
+		}
+	}
+	return len(messages) - 1
+}
+
+// removeUntilFits 按给定顺序删除消息直到总token数不超过限制
+func removeUntilFits(messages []map[string]interface{}, limit int, order []int) []map[string]interface{} {
+	removed := make(map[int]bool)
+	total := EstimateTokens(messages)
+	for _, idx := range order {
+		if total <= limit {
+			break
+		}
+		removed[idx] = true
+		total -= EstimateMessageTokens(messages[idx])
+	}
+
+	result := make([]map[string]interface{}, 0, len(messages)-len(removed))
+	for i, m := range messages {
+		if !removed[i] {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// truncateHead 删除最早的非系统消息，始终保留最后一条消息
+func truncateHead(messages []map[string]interface{}, limit int) []map[string]interface{} {
+	var order []int
+	for i := 0; i < len(messages)-1; i++ {
+		if !isSystemMessage(messages[i]) {
+			order = append(order, i)
+		}
+	}
+	return removeUntilFits(messages, limit, order)
+}
+
+// truncateTail 删除最新的消息，保留最后一轮用户消息
+func truncateTail(messages []map[string]interface{}, limit int) []map[string]interface{} {
+	keep := lastUserIndex(messages)
+	var order []int
+	for i := len(messages) - 1; i >= 0; i-- {
+		if i != keep && !isSystemMessage(messages[i]) {
+			order = append(order, i)
+		}
+	}
+	return removeUntilFits(messages, limit, order)
+}
+
+// truncateMiddle 保留系统提示、前firstTurns条和后lastTurns条消息，从中间开始删除
+func truncateMiddle(messages []map[string]interface{}, limit, firstTurns, lastTurns int) []map[string]interface{} {
+	var turns []int
+	for i, m := range messages {
+		if !isSystemMessage(m) {
+			turns = append(turns, i)
+		}
+	}
+
+	if firstTurns < 0 {
+		firstTurns = 0
+	}
+	if lastTurns < 1 {
+		lastTurns = 1
+	}
+	if firstTurns+lastTurns >= len(turns) {
+		return truncateHead(messages, limit)
+	}
+
+	// 先删除中间部分（从最早的中间消息开始），仍超出时再按head策略处理
+	var order []int
+	order = append(order, turns[firstTurns:len(turns)-lastTurns]...)
+	result := removeUntilFits(messages, limit, order)
+	if EstimateTokens(result) > limit {
+		result = truncateHead(result, limit)
+	}
+	return result
+}
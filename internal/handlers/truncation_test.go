@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTruncator(strategy TruncationStrategy) *ContextWindowTruncator {
+	t := NewContextWindowTruncator(&config.ContextTruncationConfig{
+		Enabled:         true,
+		DefaultStrategy: string(strategy),
+		KeepFirstTurns:  1,
+		KeepLastTurns:   2,
+	})
+	t.models = map[string]ThirdPartyModelInfo{
+		"test-model": {ModelType: "chat", MaxContextTokens: 80},
+	}
+	return t
+}
+
+// message 构造一条约占 tokens 个token的消息
+func message(role, tag string, tokens int) interface{} {
+	content := tag + strings.Repeat("x", (tokens-messageOverheadTokens)*4-len(tag))
+	return map[string]interface{}{"role": role, "content": content}
+}
+
+func contents(t *testing.T, request map[string]interface{}) []string {
+	messages, ok := request["messages"].([]interface{})
+	require.True(t, ok)
+	var tags []string
+	for _, m := range messages {
+		content := m.(map[string]interface{})["content"].(string)
+		tags = append(tags, content[:2])
+	}
+	return tags
+}
+
+func longConversation() map[string]interface{} {
+	return map[string]interface{}{
+		"model": "test-model",
+		"messages": []interface{}{
+			message("system", "s0", 20),
+			message("user", "u1", 20),
+			message("assistant", "a1", 20),
+			message("user", "u2", 20),
+			message("assistant", "a2", 20),
+			message("user", "u3", 20),
+		},
+	}
+}
+
+func TestTruncateHeadStrategy(t *testing.T) {
+	request := longConversation()
+	assert.True(t, newTestTruncator(TruncateHead).Truncate(request))
+	assert.Equal(t, []string{"s0", "u2", "a2", "u3"}, contents(t, request))
+}
+
+func TestTruncateTailStrategy(t *testing.T) {
+	request := longConversation()
+	assert.True(t, newTestTruncator(TruncateTail).Truncate(request))
+	assert.Equal(t, []string{"s0", "u1", "a1", "u3"}, contents(t, request))
+}
+
+func TestTruncateMiddleStrategy(t *testing.T) {
+	request := longConversation()
+	assert.True(t, newTestTruncator(TruncateMiddle).Truncate(request))
+	assert.Equal(t, []string{"s0", "u1", "a2", "u3"}, contents(t, request))
+}
+
+func TestTruncateModelStrategyOverridesDefault(t *testing.T) {
+	truncator := newTestTruncator(TruncateHead)
+	truncator.models["test-model"] = ThirdPartyModelInfo{MaxContextTokens: 80, TruncationStrategy: TruncateTail}
+
+	request := longConversation()
+	assert.True(t, truncator.Truncate(request))
+	assert.Equal(t, []string{"s0", "u1", "a1", "u3"}, contents(t, request))
+}
+
+func TestTruncateWithinLimit(t *testing.T) {
+	request := map[string]interface{}{
+		"model":    "test-model",
+		"messages": []interface{}{message("user", "u1", 20)},
+	}
+	assert.False(t, newTestTruncator(TruncateHead).Truncate(request))
+}
+
+func TestTruncateDisabledOrUnknownModel(t *testing.T) {
+	disabled := NewContextWindowTruncator(&config.ContextTruncationConfig{Enabled: false})
+	assert.False(t, disabled.Truncate(longConversation()))
+
+	request := longConversation()
+	request["model"] = "unknown-model"
+	assert.False(t, newTestTruncator(TruncateHead).Truncate(request))
+}
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/monitoring"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultUsageRangeDays is the range of a usage query without from/to: the last seven days
+const DefaultUsageRangeDays = 7
+
+var (
+	usageTrackerMu     sync.RWMutex
+	usageTracker       *monitoring.UsageTracker
+	usageKeyIDResolver func(c *gin.Context) (string, bool)
+	tokenTracker       *monitoring.TokenTracker
+)
+
+// SetUsageTracker installs the tracker counting the tokens of each successful
+// upstream response per API key and model. resolve maps a request to the ID
+// of its managed key; requests it rejects are not tracked. A nil tracker
+// stops tracking.
+func SetUsageTracker(tracker *monitoring.UsageTracker, resolve func(c *gin.Context) (string, bool)) {
+	usageTrackerMu.Lock()
+	usageTracker = tracker
+	usageKeyIDResolver = resolve
+	usageTrackerMu.Unlock()
+}
+
+// SetTokenTracker installs the tracker counting the tokens of each successful
+// upstream response per API key for billing; nil stops tracking
+func SetTokenTracker(tracker *monitoring.TokenTracker) {
+	usageTrackerMu.Lock()
+	tokenTracker = tracker
+	usageTrackerMu.Unlock()
+}
+
+// usageTokens reads the token counts of a usage block
+func usageTokens(usage map[string]interface{}) monitoring.TokenUsage {
+	tokens := func(name string) int64 {
+		value, _ := usage[name].(float64)
+		return int64(value)
+	}
+	return monitoring.TokenUsage{
+		PromptTokens:     tokens("prompt_tokens"),
+		CompletionTokens: tokens("completion_tokens"),
+		TotalTokens:      tokens("total_tokens"),
+	}
+}
+
+// trackTokens adds the usage block of a response to the caller's token counters
+func trackTokens(c *gin.Context, resp map[string]interface{}) {
+	usageTrackerMu.RLock()
+	tracker := tokenTracker
+	usageTrackerMu.RUnlock()
+	if tracker == nil {
+		return
+	}
+	usage, ok := resp["usage"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	apiKey := middleware.APIKeyFromRequest(c)
+	if apiKey == "" {
+		return
+	}
+	if err := tracker.Record(c.Request.Context(), apiKey, usageTokens(usage)); err != nil {
+		logrus.WithError(err).Warn("Failed to track token usage for billing")
+	}
+}
+
+// trackUsage records the usage block of a response against the caller's key
+func trackUsage(c *gin.Context, resp map[string]interface{}) {
+	usageTrackerMu.RLock()
+	tracker, resolve := usageTracker, usageKeyIDResolver
+	usageTrackerMu.RUnlock()
+	if tracker == nil || resolve == nil {
+		return
+	}
+	usage, ok := resp["usage"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	keyID, ok := resolve(c)
+	if !ok {
+		return
+	}
+
+	// The model actually billed is the one the upstream reports
+	model, _ := resp["model"].(string)
+	if model == "" {
+		model = c.GetString(middleware.ModelContextKey)
+	}
+	err := tracker.Record(c.Request.Context(), keyID, model, usageTokens(usage))
+	if err != nil {
+		logrus.WithError(err).WithField("key_id", keyID).Warn("Failed to track token usage")
+	}
+}
+
+// usageRange parses the optional from/to query parameters (YYYY-MM-DD, UTC)
+func usageRange(c *gin.Context) (time.Time, time.Time, bool) {
+	to := time.Now().UTC()
+	from := to.AddDate(0, 0, -(DefaultUsageRangeDays - 1))
+	for _, param := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		raw := c.Query(param.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": param.name + " must be a date in the form YYYY-MM-DD",
+					"type":    "invalid_request_error",
+					"code":    "invalid_date",
+				},
+			})
+			return time.Time{}, time.Time{}, false
+		}
+		*param.value = parsed
+	}
+	return from, to, true
+}
+
+// usageError answers a failed usage query: 400 for ranges the tracker refuses, 500 otherwise
+func usageError(c *gin.Context, err error) {
+	if errors.Is(err, monitoring.ErrInvalidUsageRange) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": err.Error(),
+				"type":    "invalid_request_error",
+				"code":    "invalid_range",
+			},
+		})
+		return
+	}
+	logrus.WithError(err).Error("Failed to read token usage")
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error": gin.H{
+			"message": "Failed to read token usage",
+			"type":    "internal_server_error",
+			"code":    "usage_unavailable",
+		},
+	})
+}
+
+// GetUsage returns daily token usage of every managed API key, or of the key
+// given by key_id, with per-model counts
+func GetUsage(tracker *monitoring.UsageTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		from, to, ok := usageRange(c)
+		if !ok {
+			return
+		}
+
+		var keys []*monitoring.KeyUsage
+		var err error
+		if keyID := c.Query("key_id"); keyID != "" {
+			var usage *monitoring.KeyUsage
+			if usage, err = tracker.KeyUsage(c.Request.Context(), keyID, from, to); err == nil {
+				keys = []*monitoring.KeyUsage{usage}
+			}
+		} else {
+			keys, err = tracker.AllUsage(c.Request.Context(), from, to)
+		}
+		if err != nil {
+			usageError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"from": from.Format("2006-01-02"),
+			"to":   to.Format("2006-01-02"),
+			"keys": keys,
+		})
+	}
+}
+
+// GetMyUsage returns the daily token usage of the calling managed API key
+func GetMyUsage(tracker *monitoring.UsageTracker, localAuth *security.LocalAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if apiKey == "" {
+			apiKey = c.GetHeader("X-API-Key")
+		}
+		key, err := localAuth.DescribeAPIKey(apiKey)
+		if apiKey == "" || err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{
+					"message": "Usage is tracked for managed API keys only",
+					"type":    "authentication_error",
+					"code":    "invalid_api_key",
+				},
+			})
+			return
+		}
+
+		from, to, ok := usageRange(c)
+		if !ok {
+			return
+		}
+		usage, err := tracker.KeyUsage(c.Request.Context(), key.ID, from, to)
+		if err != nil {
+			usageError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"from":  from.Format("2006-01-02"),
+			"to":    to.Format("2006-01-02"),
+			"usage": usage,
+		})
+	}
+}
+
+// invalidUsageParameter answers a usage query with a malformed parameter
+func invalidUsageParameter(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    "invalid_request_error",
+			"code":    "invalid_parameter",
+		},
+	})
+}
+
+// GetTokenUsage returns the daily token series of one API key for billing. The
+// key is given as api_key, or as api_key_hash when only its hash is known,
+// e.g. from GetTopConsumers.
+func GetTokenUsage(tracker *monitoring.TokenTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keyHash := c.Query("api_key_hash")
+		if apiKey := c.Query("api_key"); apiKey != "" {
+			keyHash = monitoring.HashAPIKey(apiKey)
+		}
+		if keyHash == "" {
+			invalidUsageParameter(c, "api_key or api_key_hash is required")
+			return
+		}
+		from, to, ok := usageRange(c)
+		if !ok {
+			return
+		}
+
+		series, err := tracker.DailySeries(c.Request.Context(), keyHash, from, to)
+		if err != nil {
+			usageError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"api_key_hash": keyHash,
+			"from":         from.Format("2006-01-02"),
+			"to":           to.Format("2006-01-02"),
+			"days":         series,
+		})
+	}
+}
+
+// GetTopConsumers returns the n API keys (default 10) consuming the most
+// tokens over window (default 24h)
+func GetTopConsumers(tracker *monitoring.TokenTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		n := 10
+		if raw := c.Query("n"); raw != "" {
+			parsed, err := strconv.Atoi(raw)
+			if err != nil || parsed <= 0 {
+				invalidUsageParameter(c, "n must be a positive integer")
+				return
+			}
+			n = parsed
+		}
+		window := 24 * time.Hour
+		if raw := c.Query("window"); raw != "" {
+			parsed, err := time.ParseDuration(raw)
+			if err != nil || parsed < 0 {
+				invalidUsageParameter(c, "window must be a duration such as \"168h\"")
+				return
+			}
+			window = parsed
+		}
+
+		stats, err := tracker.GetTopConsumers(n, window)
+		if err != nil {
+			usageError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"window":    window.String(),
+			"consumers": stats,
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/monitoring"
+	"go-aigateway/internal/security"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamingUsageIsTrackedPerKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	tracker := monitoring.NewUsageTracker(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{MaxAPIKeys: 10})
+	apiKey, err := localAuth.GenerateAPIKey("api-user", "usage", []string{"ai:chat"}, 0)
+	require.NoError(t, err)
+	other, err := localAuth.GenerateAPIKey("api-user", "other", []string{"ai:chat"}, 0)
+	require.NoError(t, err)
+
+	SetUsageTracker(tracker, func(c *gin.Context) (string, bool) {
+		keyID, _, ok := localAuth.LookupAPIKey(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		return keyID, ok
+	})
+	t.Cleanup(func() { SetUsageTracker(nil, nil) })
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, streamChunk("Hi"))
+		// The final chunk of an include_usage stream carries the totals
+		fmt.Fprint(w, `data: {"model":"qwen-turbo-latest","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":3,"total_tokens":15}}`+"\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	r := gin.New()
+	r.POST("/v1/chat/completions", ChatCompletions(&config.Config{TargetURL: upstream.URL}))
+	r.GET("/api/v1/usage/me", GetMyUsage(tracker, localAuth))
+	gateway := httptest.NewServer(r)
+	defer gateway.Close()
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, gateway.URL+"/v1/chat/completions",
+		strings.NewReader(`{"model":"qwen-turbo","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	getUsage := func(key string) (int, map[string]json.RawMessage) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/usage/me", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		r.ServeHTTP(w, req)
+		var body map[string]json.RawMessage
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	code, body := getUsage(apiKey)
+	require.Equal(t, http.StatusOK, code)
+	var usage monitoring.KeyUsage
+	require.NoError(t, json.Unmarshal(body["usage"], &usage))
+	assert.Equal(t, monitoring.UsageCounts{Requests: 1, PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}, usage.Totals)
+	assert.Equal(t, int64(15), usage.Models["qwen-turbo-latest"].TotalTokens, "usage is billed to the model the upstream reports")
+
+	code, body = getUsage(other)
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal(body["usage"], &usage))
+	assert.Empty(t, usage.Days)
+
+	code, _ = getUsage("sk-unknown")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestGetUsageValidatesRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	r := gin.New()
+	r.GET("/api/v1/usage", GetUsage(monitoring.NewUsageTracker(redis.NewClient(&redis.Options{Addr: mr.Addr()}))))
+
+	for query, want := range map[string]int{
+		"":                               http.StatusOK,
+		"?from=2024-03-01&to=2024-03-07": http.StatusOK,
+		"?from=03/01/2024":               http.StatusBadRequest,
+		"?from=2024-03-07&to=2024-03-01": http.StatusBadRequest,
+		"?from=2020-01-01&to=2024-01-01": http.StatusBadRequest,
+		"?key_id=missing&from=2024-03-01&to=2024-03-01": http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/usage"+query, nil))
+		assert.Equal(t, want, w.Code, query)
+	}
+}
+
+func TestTokenUsageReports(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	tracker := monitoring.NewTokenTracker(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	SetTokenTracker(tracker)
+	t.Cleanup(func() { SetTokenTracker(nil) })
+
+	r := gin.New()
+	r.POST("/respond", func(c *gin.Context) {
+		recordTokenUsage(c, map[string]interface{}{
+			"usage": map[string]interface{}{"prompt_tokens": float64(8), "completion_tokens": float64(4), "total_tokens": float64(12)},
+		})
+		c.Status(http.StatusOK)
+	})
+	r.GET("/api/v1/admin/usage", GetTokenUsage(tracker))
+	r.GET("/api/v1/admin/usage/top", GetTopConsumers(tracker))
+
+	for _, apiKey := range []string{"sk-a", "sk-a", "sk-b"} {
+		req := httptest.NewRequest(http.MethodPost, "/respond", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/respond", nil))
+
+	get := func(url string) (int, map[string]json.RawMessage) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		var body map[string]json.RawMessage
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body
+	}
+
+	today := time.Now().UTC()
+	from := today.AddDate(0, 0, -1).Format("2006-01-02")
+	code, body := get("/api/v1/admin/usage?api_key=sk-a&from=" + from)
+	require.Equal(t, http.StatusOK, code)
+	var days []monitoring.DailyTokens
+	require.NoError(t, json.Unmarshal(body["days"], &days))
+	require.Len(t, days, 2)
+	assert.Equal(t, monitoring.DailyTokens{Date: from}, days[0])
+	assert.Equal(t, monitoring.DailyTokens{Date: today.Format("2006-01-02"), PromptTokens: 16, CompletionTokens: 8, TotalTokens: 24}, days[1])
+
+	code, body = get("/api/v1/admin/usage/top?n=1")
+	require.Equal(t, http.StatusOK, code)
+	var consumers []monitoring.UsageStat
+	require.NoError(t, json.Unmarshal(body["consumers"], &consumers))
+	assert.Equal(t, []monitoring.UsageStat{{APIKeyHash: monitoring.HashAPIKey("sk-a"), TotalTokens: 24}}, consumers,
+		"requests without an API key are not tracked")
+
+	code, body = get("/api/v1/admin/usage?api_key_hash=" + consumers[0].APIKeyHash)
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal(body["days"], &days))
+	assert.Len(t, days, DefaultUsageRangeDays)
+
+	for _, url := range []string{
+		"/api/v1/admin/usage",
+		"/api/v1/admin/usage?api_key=sk-a&from=2024-03-07&to=2024-03-01",
+		"/api/v1/admin/usage/top?n=0",
+		"/api/v1/admin/usage/top?window=week",
+	} {
+		code, _ := get(url)
+		assert.Equal(t, http.StatusBadRequest, code, url)
+	}
+}
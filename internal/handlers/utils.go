@@ -36,6 +36,8 @@ func GetThirdPartyModelInfo() map[string]ThirdPartyModelInfo {
 			ChineseName: "通义千问-Max长文本版",
 			ModelType:   "chat",
 			MaxTokens:   30000,
+			// 长文档场景保留开头的文档内容和最近的对话
+			TruncationStrategy: TruncateMiddle,
 		},
 		"qwen2-72b-instruct": {
 			Provider:    "alibaba-dashscope",
@@ -64,22 +66,27 @@ func GetThirdPartyModelInfo() map[string]ThirdPartyModelInfo {
 
 		// 文本嵌入模型系列
 		"text-embedding-v1": {
-			Provider:    "alibaba-dashscope",
-			ChineseName: "通用文本向量 Small",
-			ModelType:   "embedding",
-			MaxTokens:   2048,
+			Provider:            "alibaba-dashscope",
+			ChineseName:         "通用文本向量 Small",
+			ModelType:           "embedding",
+			MaxTokens:           2048,
+			EmbeddingDimensions: 1536,
 		},
 		"text-embedding-v2": {
-			Provider:    "alibaba-dashscope",
-			ChineseName: "通用文本向量 Large",
-			ModelType:   "embedding",
-			MaxTokens:   2048,
+			Provider:            "alibaba-dashscope",
+			ChineseName:         "通用文本向量 Large",
+			ModelType:           "embedding",
+			MaxTokens:           2048,
+			EmbeddingDimensions: 1536,
 		},
 		"text-embedding-v3": {
-			Provider:    "alibaba-dashscope",
-			ChineseName: "通用文本向量 Large v3",
-			ModelType:   "embedding",
-			MaxTokens:   8192,
+			Provider:            "alibaba-dashscope",
+			ChineseName:         "通用文本向量 Large v3",
+			ModelType:           "embedding",
+			MaxTokens:           8192,
+			EmbeddingDimensions: 1024,
+			// v3 支持 1024/768/512 等可变维度输出
+			MatryoshkaEmbeddings: true,
 		},
 
 		// 多模态模型
@@ -118,6 +125,20 @@ type ThirdPartyModelInfo struct {
 	ChineseName string // Chinese name of the model
 	ModelType   string // Type: "chat", "embedding", "multimodal", "speech-to-text", "text-to-speech"
 	MaxTokens   int    // Maximum tokens supported
+
+	MaxContextTokens   int                // Context window size, falls back to MaxTokens when zero
+	TruncationStrategy TruncationStrategy // truncation_strategy: "head", "tail" or "middle"; empty uses the gateway default
+
+	EmbeddingDimensions  int  // Native vector size of embedding models
+	MatryoshkaEmbeddings bool // Leading dimensions carry most information, so vectors may be truncated
+}
+
+// providerForModel returns the registered provider of a model, falling back to the upstream host
+func providerForModel(model, host string) string {
+	if info, ok := GetThirdPartyModelInfo()[model]; ok && info.Provider != "" {
+		return info.Provider
+	}
+	return host
 }
 
 // IsThirdPartyModel checks if a model ID belongs to third-party providers (阿里百炼)
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-aigateway/internal/httpclient"
+)
+
+// VisionStrippedWarning 提供商不支持视觉输入时附加到响应中的警告
+const VisionStrippedWarning = "image inputs were removed because the target model does not support vision"
+
+// supportedImageMediaTypes data URI允许的图片类型
+var supportedImageMediaTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/jpg":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// ImageValidator 校验OpenAI vision格式中的image_url内容
+type ImageValidator struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// NewImageValidator 创建图片校验器，maxSizeMB为单张图片的大小上限
+func NewImageValidator(maxSizeMB int) *ImageValidator {
+	return &ImageValidator{
+		client:   httpclient.NewClient("vision_image_fetch", 5*time.Second),
+		maxBytes: int64(maxSizeMB) * 1024 * 1024,
+	}
+}
+
+// HasImageContent 判断请求中是否包含图片输入
+func HasImageContent(request map[string]interface{}) bool {
+	messages, _ := request["messages"].([]interface{})
+	for _, raw := range messages {
+		message, _ := raw.(map[string]interface{})
+		parts, _ := message["content"].([]interface{})
+		for _, p := range parts {
+			if part, ok := p.(map[string]interface{}); ok && part["type"] == "image_url" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidateMessages 校验多模态消息格式及其中的图片
+func (v *ImageValidator) ValidateMessages(ctx context.Context, request map[string]interface{}) error {
+	messages, ok := request["messages"].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	for i, raw := range messages {
+		message, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("messages[%d] must be an object", i)
+		}
+
+		switch content := message["content"].(type) {
+		case string, nil:
+			continue
+		case []interface{}:
+			for j, p := range content {
+				part, ok := p.(map[string]interface{})
+				if !ok {
+					return fmt.Errorf("messages[%d].content[%d] must be an object", i, j)
+				}
+				if err := v.validatePart(ctx, part); err != nil {
+					return fmt.Errorf("messages[%d].content[%d]: %w", i, j, err)
+				}
+			}
+		default:
+			return fmt.Errorf("messages[%d].content must be a string or an array", i)
+		}
+	}
+	return nil
+}
+
+// validatePart 校验单个content片段
+func (v *ImageValidator) validatePart(ctx context.Context, part map[string]interface{}) error {
+	switch part["type"] {
+	case "text":
+		if _, ok := part["text"].(string); !ok {
+			return fmt.Errorf("text part requires a string text field")
+		}
+		return nil
+	case "image_url":
+		imageURL, _ := part["image_url"].(map[string]interface{})
+		rawURL, _ := imageURL["url"].(string)
+		if rawURL == "" {
+			return fmt.Errorf("image_url part requires image_url.url")
+		}
+		if strings.HasPrefix(rawURL, "data:") {
+			return v.validateDataURI(rawURL)
+		}
+		return v.validateRemoteImage(ctx, rawURL)
+	default:
+		return fmt.Errorf("unsupported content part type %v", part["type"])
+	}
+}
+
+// validateDataURI 校验base64编码的data URI
+func (v *ImageValidator) validateDataURI(dataURI string) error {
+	header, data, found := strings.Cut(strings.TrimPrefix(dataURI, "data:"), ",")
+	if !found || !strings.HasSuffix(header, ";base64") {
+		return fmt.Errorf("image data URI must be base64 encoded")
+	}
+
+	mediaType := strings.TrimSuffix(header, ";base64")
+	if !supportedImageMediaTypes[strings.ToLower(mediaType)] {
+		return fmt.Errorf("unsupported image media type %q", mediaType)
+	}
+
+	if int64(base64.StdEncoding.DecodedLen(len(data))) > v.maxBytes {
+		return fmt.Errorf("image exceeds maximum size of %d MB", v.maxBytes/(1024*1024))
+	}
+	if _, err := base64.StdEncoding.DecodeString(data); err != nil {
+		return fmt.Errorf("invalid base64 image data")
+	}
+	return nil
+}
+
+// validateRemoteImage 校验图片URL为可访问的HTTPS地址
+func (v *ImageValidator) validateRemoteImage(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("invalid image URL")
+	}
+	if parsed.Scheme != "https" {
+		return fmt.Errorf("image URL must use https")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("invalid image URL")
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("image URL is not reachable")
+	}
+	resp.Body.Close()
+
+	// 部分存储服务不支持HEAD，405视为可访问
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusMethodNotAllowed {
+		return fmt.Errorf("image URL returned status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > v.maxBytes {
+		return fmt.Errorf("image exceeds maximum size of %d MB", v.maxBytes/(1024*1024))
+	}
+	return nil
+}
+
+// ModelSupportsVision 判断模型是否支持图片输入，未登记的模型交由上游判断
+func ModelSupportsVision(model string) bool {
+	info, ok := GetThirdPartyModelInfo()[model]
+	if !ok {
+		return true
+	}
+	return info.ModelType == "multimodal"
+}
+
+// StripImageContent 移除消息中的图片片段，仅保留文本，返回是否有内容被移除
+func StripImageContent(request map[string]interface{}) bool {
+	messages, ok := request["messages"].([]interface{})
+	if !ok {
+		return false
+	}
+
+	stripped := false
+	for _, raw := range messages {
+		message, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		parts, ok := message["content"].([]interface{})
+		if !ok {
+			continue
+		}
+
+		var texts []string
+		for _, p := range parts {
+			part, _ := p.(map[string]interface{})
+			if part["type"] == "text" {
+				if text, ok := part["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			} else {
+				stripped = true
+			}
+		}
+		message["content"] = strings.Join(texts, "\n")
+	}
+	return stripped
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func visionRequest(model, imageURL string) map[string]interface{} {
+	return map[string]interface{}{
+		"model": model,
+		"messages": []interface{}{
+			map[string]interface{}{
+				"role": "user",
+				"content": []interface{}{
+					map[string]interface{}{"type": "text", "text": "What is in this image?"},
+					map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": imageURL}},
+				},
+			},
+		},
+	}
+}
+
+func TestImageValidatorValidURL(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	validator := NewImageValidator(20)
+	validator.client = server.Client()
+
+	err := validator.ValidateMessages(context.Background(), visionRequest("qwen-vl-plus", server.URL+"/cat.png"))
+	assert.NoError(t, err)
+}
+
+func TestImageValidatorInvalidURLs(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	validator := NewImageValidator(20)
+	validator.client = server.Client()
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"plain http", "http://example.com/cat.png"},
+		{"not a url", "://bad"},
+		{"not found", server.URL + "/missing.png"},
+		{"unreachable", "https://127.0.0.1:1/cat.png"},
+		{"non image data uri", "data:text/plain;base64,aGVsbG8="},
+		{"not base64", "data:image/png;base64,!!!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.ValidateMessages(context.Background(), visionRequest("qwen-vl-plus", tt.url))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestImageValidatorBase64Size(t *testing.T) {
+	validator := NewImageValidator(1)
+
+	small := base64.StdEncoding.EncodeToString([]byte("small image"))
+	assert.NoError(t, validator.ValidateMessages(context.Background(),
+		visionRequest("qwen-vl-plus", "data:image/png;base64,"+small)))
+
+	oversized := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 2*1024*1024)))
+	err := validator.ValidateMessages(context.Background(),
+		visionRequest("qwen-vl-plus", "data:image/png;base64,"+oversized))
+	assert.ErrorContains(t, err, "maximum size")
+}
+
+func TestStripImagesForNonVisionProvider(t *testing.T) {
+	assert.True(t, ModelSupportsVision("qwen-vl-max"))
+	assert.False(t, ModelSupportsVision("qwen-turbo"))
+
+	request := visionRequest("qwen-turbo", "https://example.com/cat.png")
+	assert.True(t, HasImageContent(request))
+	assert.True(t, StripImageContent(request))
+	assert.False(t, HasImageContent(request))
+
+	message := request["messages"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "What is in this image?", message["content"])
+}
+
+func TestChatCompletionsStripsImagesWithWarning(t *testing.T) {
+	var upstreamBody map[string]interface{}
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&upstreamBody)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion"}`))
+	}))
+	defer mockServer.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/chat/completions", ChatCompletions(&config.Config{TargetURL: mockServer.URL, MaxImageSizeMB: 20}))
+
+	small := base64.StdEncoding.EncodeToString([]byte("small image"))
+	body, _ := json.Marshal(visionRequest("qwen-turbo", "data:image/png;base64,"+small))
+	req, _ := http.NewRequest("POST", "/chat/completions", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, VisionStrippedWarning, w.Header().Get("X-Gateway-Warning"))
+	assert.Contains(t, w.Body.String(), VisionStrippedWarning)
+
+	message := upstreamBody["messages"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "What is in this image?", message["content"])
+}
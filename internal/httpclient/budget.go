@@ -0,0 +1,85 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// TimeoutBudgetHeader tells a budget-aware upstream how many milliseconds the gateway will wait
+	TimeoutBudgetHeader = "X-Request-Timeout-Ms"
+	// ServedInHeader is reported by upstreams with their own processing time in milliseconds
+	ServedInHeader = "X-Served-In-Ms"
+)
+
+// ErrBudgetExhausted is returned when too little of the request deadline is left to call an upstream
+var ErrBudgetExhausted = errors.New("request deadline budget exhausted")
+
+var (
+	upstreamServedDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "aigateway_upstream_served_duration_seconds",
+			Help:    "Upstream processing time reported in the X-Served-In-Ms response header",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 30},
+		},
+		[]string{"upstream"},
+	)
+
+	upstreamOverheadDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "aigateway_upstream_overhead_duration_seconds",
+			Help:    "Time of an upstream call not spent processing it upstream: network and upstream queueing",
+			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2, 5},
+		},
+		[]string{"upstream"},
+	)
+)
+
+// RemainingBudget returns how much of ctx's deadline is left. ok is false when ctx
+// has no deadline; ErrBudgetExhausted is returned when less than minBudget remains.
+func RemainingBudget(ctx context.Context, minBudget time.Duration) (remaining time.Duration, ok bool, err error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false, nil
+	}
+	remaining = time.Until(deadline)
+	// The header carries whole milliseconds; never advertise a zero or negative budget
+	if remaining < max(minBudget, time.Millisecond) {
+		return remaining, true, fmt.Errorf("%w: %s left", ErrBudgetExhausted, remaining.Round(time.Millisecond))
+	}
+	return remaining, true, nil
+}
+
+// ApplyBudget sets the TimeoutBudgetHeader of req from its context deadline.
+// Requests without a deadline are left alone.
+func ApplyBudget(req *http.Request, minBudget time.Duration) error {
+	remaining, ok, err := RemainingBudget(req.Context(), minBudget)
+	if !ok || err != nil {
+		return err
+	}
+	req.Header.Set(TimeoutBudgetHeader, strconv.FormatInt(remaining.Milliseconds(), 10))
+	return nil
+}
+
+// ObserveServedTime splits an upstream call of total duration into the processing
+// time the upstream reports and the remainder spent on the network and in queues
+func ObserveServedTime(upstream string, header http.Header, total time.Duration) {
+	value := strings.TrimSpace(header.Get(ServedInHeader))
+	if value == "" {
+		return
+	}
+	ms, err := strconv.ParseFloat(value, 64)
+	if err != nil || ms < 0 {
+		return
+	}
+	served := time.Duration(ms * float64(time.Millisecond))
+	upstreamServedDuration.WithLabelValues(upstream).Observe(served.Seconds())
+	upstreamOverheadDuration.WithLabelValues(upstream).Observe(max(total-served, 0).Seconds())
+}
@@ -0,0 +1,60 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyBudget(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "http://models.internal/v1/chat", nil)
+	require.NoError(t, err)
+
+	// Without a deadline there is no budget to send
+	require.NoError(t, ApplyBudget(req, 100*time.Millisecond))
+	assert.Empty(t, req.Header.Get(TimeoutBudgetHeader))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req = req.WithContext(ctx)
+	require.NoError(t, ApplyBudget(req, 100*time.Millisecond))
+	ms, err := strconv.Atoi(req.Header.Get(TimeoutBudgetHeader))
+	require.NoError(t, err)
+	assert.LessOrEqual(t, ms, 5000)
+	assert.Greater(t, ms, 4000)
+}
+
+func TestRemainingBudgetExhausted(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, ok, err := RemainingBudget(ctx, 100*time.Millisecond)
+	assert.True(t, ok)
+	assert.True(t, errors.Is(err, ErrBudgetExhausted))
+
+	// An expired deadline is never advertised, whatever the minimum
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	req, _ := http.NewRequestWithContext(expired, http.MethodPost, "http://models.internal/v1/chat", nil)
+	assert.ErrorIs(t, ApplyBudget(req, 0), ErrBudgetExhausted)
+	assert.Empty(t, req.Header.Get(TimeoutBudgetHeader))
+}
+
+func TestObserveServedTime(t *testing.T) {
+	before := testutil.CollectAndCount(upstreamServedDuration)
+
+	ObserveServedTime("no-header.internal", http.Header{}, time.Second)
+	ObserveServedTime("garbage.internal", http.Header{ServedInHeader: {"soon"}}, time.Second)
+	assert.Equal(t, before, testutil.CollectAndCount(upstreamServedDuration))
+
+	ObserveServedTime("served.internal", http.Header{ServedInHeader: {"250"}}, time.Second)
+	assert.Equal(t, before+1, testutil.CollectAndCount(upstreamServedDuration))
+	assert.Equal(t, 1, testutil.CollectAndCount(upstreamOverheadDuration.WithLabelValues("served.internal").(prometheus.Histogram)))
+}
@@ -0,0 +1,411 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/chaos"
+	"go-aigateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrEgressDenied is wrapped by every error returned for a call the egress policy blocks
+var ErrEgressDenied = errors.New("egress denied by policy")
+
+// Egress denial reasons
+const (
+	EgressReasonScheme   = "scheme"
+	EgressReasonHost     = "host"
+	EgressReasonAddress  = "address"
+	EgressReasonResolve  = "resolve"
+	EgressReasonMetadata = "metadata"
+)
+
+var egressDenied = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "aigateway_security_egress_denied_total",
+		Help: "Total number of outbound calls blocked by the egress policy",
+	},
+	[]string{"feature", "reason"},
+)
+
+// defaultDeniedRanges are blocked unless explicitly allowed: loopback, RFC1918,
+// carrier-grade NAT, link-local, multicast and their IPv6 counterparts
+var defaultDeniedRanges = mustParseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.168.0.0/16", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+// metadataAddresses are cloud instance metadata services; only an allowed CIDR
+// unlocks them, an allowed hostname does not
+var metadataAddresses = []net.IP{
+	net.ParseIP("169.254.169.254"), // AWS, GCP, Azure
+	net.ParseIP("100.100.100.200"), // Alibaba Cloud
+	net.ParseIP("fd00:ec2::254"),   // AWS IPv6
+}
+
+// EgressError 出站调用被策略拒绝
+type EgressError struct {
+	Feature string // gateway feature that attempted the call
+	Target  string // URL or host:port
+	Reason  string
+	Detail  string
+}
+
+func (e *EgressError) Error() string {
+	return fmt.Sprintf("egress to %s denied for %s (%s): %s", e.Target, e.Feature, e.Reason, e.Detail)
+}
+
+func (e *EgressError) Unwrap() error {
+	return ErrEgressDenied
+}
+
+// EgressPolicy 出站访问策略：按协议、主机名和解析后的IP地址决定是否放行，防止SSRF
+type EgressPolicy struct {
+	schemes    map[string]bool
+	allowHosts []string
+	denyHosts  []string
+	allowCIDRs []*net.IPNet
+	denyCIDRs  []*net.IPNet
+	lookupIP   func(ctx context.Context, host string) ([]net.IP, error)
+}
+
+// NewEgressPolicy builds a policy from configuration
+func NewEgressPolicy(cfg config.EgressConfig) (*EgressPolicy, error) {
+	p := &EgressPolicy{
+		schemes:    make(map[string]bool),
+		allowHosts: normalizeHosts(cfg.AllowHosts),
+		denyHosts:  normalizeHosts(cfg.DenyHosts),
+		lookupIP: func(ctx context.Context, host string) ([]net.IP, error) {
+			return net.DefaultResolver.LookupIP(ctx, "ip", host)
+		},
+	}
+	for _, scheme := range cfg.AllowedSchemes {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+			p.schemes[scheme] = true
+		}
+	}
+	var err error
+	if p.allowCIDRs, err = parseCIDRs(cfg.AllowCIDRs); err != nil {
+		return nil, err
+	}
+	if p.denyCIDRs, err = parseCIDRs(cfg.DenyCIDRs); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// CheckURL validates the scheme and hostname of a URL without resolving it
+func (p *EgressPolicy) CheckURL(feature, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return &EgressError{Feature: feature, Target: rawURL, Reason: EgressReasonHost, Detail: "not an absolute URL"}
+	}
+	if len(p.schemes) > 0 && !p.schemes[strings.ToLower(u.Scheme)] {
+		return &EgressError{Feature: feature, Target: rawURL, Reason: EgressReasonScheme, Detail: "scheme " + u.Scheme + " is not allowed"}
+	}
+	host := strings.ToLower(u.Hostname())
+	if matchHost(p.denyHosts, host) {
+		return &EgressError{Feature: feature, Target: rawURL, Reason: EgressReasonHost, Detail: "host " + host + " is denied"}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if reason, detail := p.checkIP(ip, matchHost(p.allowHosts, host)); reason != "" {
+			return &EgressError{Feature: feature, Target: rawURL, Reason: reason, Detail: detail}
+		}
+	}
+	return nil
+}
+
+// ValidateURL is the save-time check for URLs entered in admin APIs: CheckURL
+// plus the addresses the host currently resolves to. Hosts that do not resolve
+// yet are accepted; the dialer checks them again on every connection.
+func (p *EgressPolicy) ValidateURL(ctx context.Context, feature, rawURL string) error {
+	if err := p.CheckURL(feature, rawURL); err != nil {
+		return err
+	}
+	u, _ := url.Parse(rawURL)
+	if _, err := p.resolve(ctx, feature, u.Host, u.Hostname()); err != nil && !isResolveFailure(err) {
+		return err
+	}
+	return nil
+}
+
+// resolve returns the vetted addresses of host; every resolved address must be allowed
+func (p *EgressPolicy) resolve(ctx context.Context, feature, target, host string) ([]net.IP, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if matchHost(p.denyHosts, host) {
+		return nil, &EgressError{Feature: feature, Target: target, Reason: EgressReasonHost, Detail: "host " + host + " is denied"}
+	}
+	trusted := matchHost(p.allowHosts, host)
+
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		var err error
+		if ips, err = p.lookupIP(ctx, host); err != nil || len(ips) == 0 {
+			return nil, &EgressError{Feature: feature, Target: target, Reason: EgressReasonResolve, Detail: fmt.Sprintf("cannot resolve %s: %v", host, err)}
+		}
+	}
+	for _, ip := range ips {
+		if reason, detail := p.checkIP(ip, trusted); reason != "" {
+			return nil, &EgressError{Feature: feature, Target: target, Reason: reason, Detail: detail}
+		}
+	}
+	return ips, nil
+}
+
+// checkIP returns a denial reason for ip, or "". Explicit denies win over
+// explicit allows, which win over the default private ranges.
+func (p *EgressPolicy) checkIP(ip net.IP, trustedHost bool) (string, string) {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	if containsIP(p.denyCIDRs, ip) {
+		return EgressReasonAddress, ip.String() + " is in a denied range"
+	}
+	if containsIP(p.allowCIDRs, ip) {
+		return "", ""
+	}
+	for _, metadata := range metadataAddresses {
+		if metadata.Equal(ip) {
+			return EgressReasonMetadata, ip.String() + " is a cloud metadata endpoint"
+		}
+	}
+	if !trustedHost && containsIP(defaultDeniedRanges, ip) {
+		return EgressReasonAddress, ip.String() + " is a private or link-local address"
+	}
+	return "", ""
+}
+
+func isResolveFailure(err error) bool {
+	var egressErr *EgressError
+	return errors.As(err, &egressErr) && egressErr.Reason == EgressReasonResolve
+}
+
+var (
+	defaultEgressMu      sync.RWMutex
+	defaultEgress        *EgressPolicy
+	defaultEgressAuditor func(ctx context.Context, violation *EgressError)
+)
+
+// SetEgressPolicy installs the process-wide policy enforced by every client from
+// this package; nil allows all destinations
+func SetEgressPolicy(p *EgressPolicy) {
+	defaultEgressMu.Lock()
+	defaultEgress = p
+	defaultEgressMu.Unlock()
+}
+
+// DefaultEgressPolicy returns the installed policy, or nil
+func DefaultEgressPolicy() *EgressPolicy {
+	defaultEgressMu.RLock()
+	defer defaultEgressMu.RUnlock()
+	return defaultEgress
+}
+
+// SetEgressAuditor registers the callback notified of every blocked call
+func SetEgressAuditor(audit func(ctx context.Context, violation *EgressError)) {
+	defaultEgressMu.Lock()
+	defaultEgressAuditor = audit
+	defaultEgressMu.Unlock()
+}
+
+// ValidateEgressURL checks a URL against the installed policy, for save-time validation
+func ValidateEgressURL(ctx context.Context, feature, rawURL string) error {
+	if p := DefaultEgressPolicy(); p != nil {
+		return p.ValidateURL(ctx, feature, rawURL)
+	}
+	return nil
+}
+
+// reportEgress records a blocked call in metrics, logs and the audit trail
+func reportEgress(ctx context.Context, err error) {
+	var violation *EgressError
+	if !errors.As(err, &violation) {
+		return
+	}
+	egressDenied.WithLabelValues(violation.Feature, violation.Reason).Inc()
+	logrus.WithFields(logrus.Fields{
+		"feature": violation.Feature,
+		"target":  violation.Target,
+		"reason":  violation.Reason,
+	}).Warn("Blocked outbound call by egress policy")
+
+	defaultEgressMu.RLock()
+	audit := defaultEgressAuditor
+	defaultEgressMu.RUnlock()
+	if audit != nil {
+		audit(ctx, violation)
+	}
+}
+
+// DialFunc matches net.Dialer.DialContext
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// EgressDialContext wraps dial so each connection is checked against the
+// installed policy. The host is resolved once and the vetted address is dialed,
+// so a DNS answer cannot change between the check and the connection.
+func EgressDialContext(feature string, dial DialFunc) DialFunc {
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		p := DefaultEgressPolicy()
+		if p == nil {
+			return dial(ctx, network, addr)
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := p.resolve(ctx, feature, addr, host)
+		if err != nil {
+			reportEgress(ctx, err)
+			return nil, err
+		}
+
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// Transport returns a transport whose connections obey the egress policy.
+// HTTP_PROXY and HTTPS_PROXY are not honoured: a proxy would resolve and dial
+// the target itself, where the policy cannot check the address.
+func Transport(feature string) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.Proxy = nil
+	t.DialContext = EgressDialContext(feature, nil)
+	return t
+}
+
+// NewClient returns an HTTP client for feature that obeys the egress policy on
+// the first request and after every redirect
+func NewClient(feature string, timeout time.Duration) *http.Client {
+	return WrapClient(feature, &http.Client{Timeout: timeout, Transport: Transport(feature)})
+}
+
+// WrapClient adds the egress URL checks to a client whose transport already
+// dials through EgressDialContext without a proxy. Upstream chaos rules apply
+// after the checks.
+func WrapClient(feature string, client *http.Client) *http.Client {
+	next := client.Transport
+	if next == nil {
+		next = Transport(feature)
+	}
+	client.Transport = &egressRoundTripper{feature: feature, next: chaos.Transport(next)}
+
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if p := DefaultEgressPolicy(); p != nil {
+			if err := p.CheckURL(feature, req.URL.String()); err != nil {
+				reportEgress(req.Context(), err)
+				return err
+			}
+		}
+		if checkRedirect != nil {
+			return checkRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return client
+}
+
+// egressRoundTripper rejects disallowed schemes and hosts before dialing and
+// propagates the trace context of allowed requests
+type egressRoundTripper struct {
+	feature string
+	next    http.RoundTripper
+}
+
+func (t *egressRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if p := DefaultEgressPolicy(); p != nil {
+		if err := p.CheckURL(t.feature, req.URL.String()); err != nil {
+			reportEgress(req.Context(), err)
+			return nil, err
+		}
+	}
+	return t.next.RoundTrip(withTraceContext(req))
+}
+
+func normalizeHosts(hosts []string) []string {
+	var normalized []string
+	for _, host := range hosts {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			normalized = append(normalized, host)
+		}
+	}
+	return normalized
+}
+
+// matchHost reports whether host equals a pattern or is a subdomain of a "*.domain" pattern
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if pattern == host {
+			return true
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok && strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			if ip := net.ParseIP(value); ip != nil && ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", value, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func mustParseCIDRs(values ...string) []*net.IPNet {
+	nets, err := parseCIDRs(values)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
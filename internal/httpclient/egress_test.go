@@ -0,0 +1,199 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// installPolicy installs a policy whose resolver answers from hosts
+func installPolicy(t *testing.T, cfg config.EgressConfig, hosts map[string]string) *EgressPolicy {
+	if cfg.AllowedSchemes == nil {
+		cfg.AllowedSchemes = []string{"http", "https"}
+	}
+	p, err := NewEgressPolicy(cfg)
+	require.NoError(t, err)
+	p.lookupIP = func(_ context.Context, host string) ([]net.IP, error) {
+		if ip, ok := hosts[host]; ok {
+			return []net.IP{net.ParseIP(ip)}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	SetEgressPolicy(p)
+	t.Cleanup(func() {
+		SetEgressPolicy(nil)
+		SetEgressAuditor(nil)
+	})
+	return p
+}
+
+// recordAudits collects the violations passed to the auditor
+func recordAudits(t *testing.T) func() []*EgressError {
+	var mu sync.Mutex
+	var violations []*EgressError
+	SetEgressAuditor(func(_ context.Context, violation *EgressError) {
+		mu.Lock()
+		violations = append(violations, violation)
+		mu.Unlock()
+	})
+	return func() []*EgressError {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*EgressError(nil), violations...)
+	}
+}
+
+func TestEgressDeniesHostResolvingToMetadata(t *testing.T) {
+	// A public-looking name that resolves to the metadata service, as in DNS rebinding
+	installPolicy(t, config.EgressConfig{}, map[string]string{
+		"rebind.example.com":   "169.254.169.254",
+		"internal.example.com": "10.1.2.3",
+	})
+	audits := recordAudits(t)
+	before := testutil.ToFloat64(egressDenied.WithLabelValues("test", EgressReasonMetadata))
+
+	client := NewClient("test", time.Second)
+	_, err := client.Get("http://rebind.example.com/latest/meta-data/")
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrEgressDenied)
+
+	var violation *EgressError
+	require.ErrorAs(t, err, &violation)
+	assert.Equal(t, EgressReasonMetadata, violation.Reason)
+	assert.Equal(t, "test", violation.Feature)
+	assert.Equal(t, before+1, testutil.ToFloat64(egressDenied.WithLabelValues("test", EgressReasonMetadata)))
+
+	_, err = client.Get("http://internal.example.com/")
+	assert.ErrorIs(t, err, ErrEgressDenied)
+
+	recorded := audits()
+	require.Len(t, recorded, 2)
+	assert.Equal(t, "rebind.example.com:80", recorded[0].Target)
+	assert.Equal(t, EgressReasonAddress, recorded[1].Reason)
+}
+
+func TestEgressDeniesRedirectToMetadata(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer upstream.Close()
+
+	// The test server itself is reachable only because loopback is explicitly allowed
+	installPolicy(t, config.EgressConfig{AllowCIDRs: []string{"127.0.0.1"}}, nil)
+	audits := recordAudits(t)
+
+	_, err := NewClient("proxy", time.Second).Get(upstream.URL)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrEgressDenied)
+	require.Len(t, audits(), 1)
+	assert.Equal(t, EgressReasonMetadata, audits()[0].Reason)
+}
+
+func TestEgressDeniesLoopbackByDefault(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer upstream.Close()
+
+	installPolicy(t, config.EgressConfig{}, nil)
+	_, err := NewClient("proxy", time.Second).Get(upstream.URL)
+	assert.ErrorIs(t, err, ErrEgressDenied)
+
+	// Without a policy every destination is allowed
+	SetEgressPolicy(nil)
+	resp, err := NewClient("proxy", time.Second).Get(upstream.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestEgressPolicyPrecedence(t *testing.T) {
+	p := installPolicy(t, config.EgressConfig{
+		AllowHosts: []string{"model.internal", "*.corp.example"},
+		DenyHosts:  []string{"blocked.example.com"},
+		AllowCIDRs: []string{"10.20.0.0/16", "169.254.169.254"},
+		DenyCIDRs:  []string{"10.20.30.0/24", "203.0.113.0/24"},
+	}, map[string]string{
+		"model.internal":      "192.168.1.10",
+		"llm.corp.example":    "10.9.9.9",
+		"meta.corp.example":   "100.100.100.200",
+		"public.example.com":  "203.0.113.7",
+		"blocked.example.com": "93.184.216.34",
+	})
+	ctx := context.Background()
+
+	tests := []struct {
+		url    string
+		reason string
+	}{
+		{"https://api.openai.com/v1", ""},
+		{"http://10.20.1.1/", ""},
+		{"http://10.20.30.1/", EgressReasonAddress},
+		{"http://169.254.169.254/", ""},
+		{"https://model.internal/", ""},
+		{"https://llm.corp.example/", ""},
+		{"https://meta.corp.example/", EgressReasonMetadata},
+		{"https://public.example.com/", EgressReasonAddress},
+		{"https://blocked.example.com/", EgressReasonHost},
+		{"http://[::1]:8080/", EgressReasonAddress},
+		{"ftp://api.openai.com/", EgressReasonScheme},
+		{"file:///etc/passwd", EgressReasonHost},
+		{"https://not-yet-registered.example.org/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := p.ValidateURL(ctx, "test", tt.url)
+			if tt.reason == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var violation *EgressError
+			require.ErrorAs(t, err, &violation)
+			assert.Equal(t, tt.reason, violation.Reason)
+		})
+	}
+}
+
+func TestEgressDialContextDialsVettedAddress(t *testing.T) {
+	installPolicy(t, config.EgressConfig{AllowHosts: []string{"model.internal"}}, map[string]string{
+		"model.internal": "192.168.1.10",
+	})
+
+	var dialed string
+	dial := EgressDialContext("test", func(_ context.Context, _, addr string) (net.Conn, error) {
+		dialed = addr
+		return nil, errors.New("refused")
+	})
+	_, err := dial(context.Background(), "tcp", "model.internal:8000")
+	assert.EqualError(t, err, "refused")
+	assert.Equal(t, "192.168.1.10:8000", dialed)
+}
+
+func TestEgressTransportBypassesEnvironmentProxy(t *testing.T) {
+	installPolicy(t, config.EgressConfig{}, map[string]string{"metadata.attacker.example": "169.254.169.254"})
+	var proxied bool
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+	}))
+	defer proxy.Close()
+	t.Setenv("HTTP_PROXY", proxy.URL)
+
+	// A proxy would dial the target where the policy cannot see it
+	assert.Nil(t, Transport("test").Proxy)
+
+	_, err := NewClient("test", time.Second).Get("http://metadata.attacker.example/latest/meta-data/")
+	var violation *EgressError
+	require.ErrorAs(t, err, &violation)
+	assert.False(t, proxied)
+}
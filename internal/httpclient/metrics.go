@@ -0,0 +1,15 @@
+package httpclient
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Collectors returns the package's metrics for the caller to register; the
+// monitoring package registers them with the gateway registry
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		upstreamServedDuration,
+		upstreamOverheadDuration,
+		egressDenied,
+		coalescedRequests,
+		coalescedBytesSaved,
+	}
+}
@@ -0,0 +1,248 @@
+// Package httpclient 提供网关对外 HTTP 调用的公共层。
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultMaxBodySize 可合并响应体的上限，更大的响应不参与合并
+const DefaultMaxBodySize = 1 << 20
+
+// coalesceKeyHeaders are the request headers that can change a GET response;
+// requests differing only in other headers share a flight
+var coalesceKeyHeaders = []string{
+	"Authorization",
+	"Accept",
+	"Accept-Encoding",
+	"Accept-Language",
+	"OpenAI-Organization",
+	"X-Tenant-ID",
+}
+
+var (
+	coalescedRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aigateway_httpclient_coalesced_requests_total",
+			Help: "Total number of idempotent upstream calls served by another caller's in-flight request",
+		},
+		[]string{"host"},
+	)
+
+	coalescedBytesSaved = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aigateway_httpclient_coalesced_bytes_saved_total",
+			Help: "Total response bytes not transferred from upstreams thanks to request coalescing",
+		},
+		[]string{"host"},
+	)
+)
+
+// Coalescer 单飞层：并发的相同幂等 GET 请求共享一次上游往返，
+// 每个调用方拿到独立的响应副本。飞行在其所有调用方都离开后才会取消，
+// 完成后立即移除，错误不会被保留给之后的调用方。
+type Coalescer struct {
+	client      *http.Client
+	maxBodySize int64
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight 一次共享的上游请求
+type flight struct {
+	done    chan struct{}
+	waiters int
+	cancel  context.CancelFunc
+
+	status int
+	header http.Header
+	body   []byte
+	err    error
+
+	// oversized is a response larger than maxBodySize, handed whole to one caller;
+	// the others make their own request
+	oversized *http.Response
+	claimed   bool
+}
+
+// New creates a coalescer issuing requests with client. Responses larger than
+// maxBodySize are not shared; maxBodySize <= 0 uses DefaultMaxBodySize.
+func New(client *http.Client, maxBodySize int64) *Coalescer {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	return &Coalescer{
+		client:      client,
+		maxBodySize: maxBodySize,
+		flights:     make(map[string]*flight),
+	}
+}
+
+var defaultCoalescer = New(NewClient("proxy", 30*time.Second), DefaultMaxBodySize)
+
+// Default returns the process-wide coalescer
+func Default() *Coalescer {
+	return defaultCoalescer
+}
+
+// Get issues a coalesced GET request
+func (c *Coalescer) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+// Do sends the request. GET and HEAD requests without a body are coalesced with
+// identical in-flight requests; everything else goes straight to the client.
+func (c *Coalescer) Do(req *http.Request) (*http.Response, error) {
+	if (req.Method != http.MethodGet && req.Method != http.MethodHead) || (req.Body != nil && req.Body != http.NoBody) {
+		return c.client.Do(req)
+	}
+
+	key := coalesceKey(req)
+	ctx := req.Context()
+
+	c.mu.Lock()
+	f, shared := c.flights[key]
+	if !shared {
+		// The flight outlives any single caller's context but keeps its values
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), cancel: cancel}
+		c.flights[key] = f
+		go c.fly(key, f, req.Clone(flightCtx))
+	}
+	f.waiters++
+	c.mu.Unlock()
+
+	select {
+	case <-f.done:
+	case <-ctx.Done():
+		c.leave(key, f)
+		return nil, ctx.Err()
+	}
+
+	if f.oversized != nil {
+		c.mu.Lock()
+		claim := !f.claimed
+		f.claimed = true
+		c.mu.Unlock()
+		if claim {
+			return f.oversized, nil
+		}
+		return c.client.Do(req)
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	if shared {
+		coalescedRequests.WithLabelValues(req.URL.Host).Inc()
+		coalescedBytesSaved.WithLabelValues(req.URL.Host).Add(float64(len(f.body)))
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.status, http.StatusText(f.status)),
+		StatusCode:    f.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(f.body)),
+		ContentLength: int64(len(f.body)),
+		Request:       req,
+	}, nil
+}
+
+// leave drops a caller that gave up; the flight is canceled once nobody waits for it
+func (c *Coalescer) leave(key string, f *flight) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f.waiters--
+	if f.waiters == 0 {
+		f.cancel()
+		if c.flights[key] == f {
+			delete(c.flights, key)
+		}
+	}
+}
+
+// fly performs the shared request and buffers the response for every waiter
+func (c *Coalescer) fly(key string, f *flight, req *http.Request) {
+	defer func() {
+		c.mu.Lock()
+		// Completed flights are forgotten at once so failures are never replayed
+		if c.flights[key] == f {
+			delete(c.flights, key)
+		}
+		c.mu.Unlock()
+		close(f.done)
+	}()
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		f.err = err
+		f.cancel()
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, c.maxBodySize+1))
+	if err != nil {
+		resp.Body.Close()
+		f.err = err
+		f.cancel()
+		return
+	}
+	if int64(len(body)) > c.maxBodySize {
+		// Too large to buffer for everyone: one caller streams the rest
+		rest := resp.Body
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), rest), closerFunc(func() error {
+			err := rest.Close()
+			f.cancel()
+			return err
+		})}
+		f.oversized = resp
+		return
+	}
+	resp.Body.Close()
+	f.cancel()
+
+	f.status = resp.StatusCode
+	f.header = resp.Header
+	f.body = body
+}
+
+type closerFunc func() error
+
+func (fn closerFunc) Close() error { return fn() }
+
+// coalesceKey identifies requests that are guaranteed the same response
+func coalesceKey(req *http.Request) string {
+	h := sha256.New()
+	for _, name := range coalesceKeyHeaders {
+		for _, value := range req.Header.Values(name) {
+			h.Write([]byte(name))
+			h.Write([]byte{0})
+			h.Write([]byte(value))
+			h.Write([]byte{0})
+		}
+	}
+	return req.Method + " " + req.URL.String() + " " + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,236 @@
+package httpclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalescerSharesOneUpstreamRequest(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":[{"id":"gpt-4"}]}`))
+	}))
+	defer upstream.Close()
+
+	c := New(upstream.Client(), 0)
+
+	const callers = 500
+	var wg sync.WaitGroup
+	bodies := make([]string, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := c.Get(context.Background(), upstream.URL+"/models")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			bodies[i] = string(body)
+			// Each caller owns its copy
+			resp.Header.Set("X-Mutated", "yes")
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	for i := 0; i < callers; i++ {
+		require.NoError(t, errs[i])
+		assert.Equal(t, `{"data":[{"id":"gpt-4"}]}`, bodies[i])
+	}
+
+	// The finished flight is not reused
+	resp, err := c.Get(context.Background(), upstream.URL+"/models")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+	assert.Empty(t, resp.Header.Get("X-Mutated"))
+}
+
+func TestCoalescerKeysOnRelevantHeaders(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(r.Header.Get("Authorization")))
+	}))
+	defer upstream.Close()
+
+	c := New(upstream.Client(), 0)
+	var wg sync.WaitGroup
+	for _, key := range []string{"Bearer a", "Bearer a", "Bearer b"} {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, upstream.URL, nil)
+			req.Header.Set("Authorization", key)
+			req.Header.Set("User-Agent", "caller-"+key) // irrelevant to the key
+			resp, err := c.Do(req)
+			require.NoError(t, err)
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, key, string(body))
+		}(key)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+}
+
+func TestCoalescerCancellationOnlyWhenAllCallersLeave(t *testing.T) {
+	release := make(chan struct{})
+	canceled := make(chan struct{}, 1)
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		select {
+		case <-release:
+			w.Write([]byte("ok"))
+		case <-r.Context().Done():
+			canceled <- struct{}{}
+		}
+	}))
+	defer upstream.Close()
+	c := New(upstream.Client(), 0)
+
+	// The first caller gives up, the second still gets the response
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := c.Get(ctx1, upstream.URL)
+		first <- err
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&hits) == 1 }, time.Second, time.Millisecond)
+
+	second := make(chan string, 1)
+	go func() {
+		resp, err := c.Get(context.Background(), upstream.URL)
+		if err != nil {
+			second <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		second <- string(body)
+	}()
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, f := range c.flights {
+			return f.waiters == 2
+		}
+		return false
+	}, time.Second, time.Millisecond)
+
+	cancel1()
+	assert.ErrorIs(t, <-first, context.Canceled)
+	close(release)
+	assert.Equal(t, "ok", <-second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	// When every caller is gone the upstream request is canceled
+	release = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Get(ctx, upstream.URL)
+		done <- err
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&hits) == 2 }, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("shared flight was not canceled after all callers left")
+	}
+}
+
+func TestCoalescerDoesNotReplayFailures(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("recovered"))
+	}))
+	defer upstream.Close()
+	c := New(upstream.Client(), 0)
+
+	resp, err := c.Get(context.Background(), upstream.URL)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	resp, err = c.Get(context.Background(), upstream.URL)
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "recovered", string(body))
+}
+
+func TestCoalescerOversizedResponsesBypass(t *testing.T) {
+	large := strings.Repeat("x", 2048)
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(large))
+	}))
+	defer upstream.Close()
+	c := New(upstream.Client(), 1024)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := c.Get(context.Background(), upstream.URL)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, large, string(body))
+		}()
+	}
+	wg.Wait()
+
+	// One shared attempt plus a request of their own for each caller that could not share it
+	assert.Equal(t, int32(3), atomic.LoadInt32(&hits))
+}
+
+func TestCoalescerPassesThroughNonIdempotentRequests(t *testing.T) {
+	var hits int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer upstream.Close()
+	c := New(upstream.Client(), 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodPost, upstream.URL, strings.NewReader("{}"))
+			resp, err := c.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(5), atomic.LoadInt32(&hits))
+}
@@ -0,0 +1,11 @@
+package httpclient
+
+import (
+	"net/http"
+	"strings"
+)
+
+// IsEventStream reports whether header describes a server-sent event stream
+func IsEventStream(header http.Header) bool {
+	return strings.Contains(header.Get("Content-Type"), "text/event-stream")
+}
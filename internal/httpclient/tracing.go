@@ -0,0 +1,33 @@
+package httpclient
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceContext propagates the W3C traceparent and tracestate headers
+var traceContext = propagation.TraceContext{}
+
+// InjectTraceContext writes the span context of ctx to header as W3C trace
+// context so upstream spans join the caller's trace; without a span in ctx
+// header is left untouched
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	traceContext.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// withTraceContext returns req carrying the trace context of its context,
+// cloned so the caller's request is not modified
+func withTraceContext(req *http.Request) *http.Request {
+	if !trace.SpanContextFromContext(req.Context()).IsValid() {
+		return req
+	}
+	req = req.Clone(req.Context())
+	traceContext.Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	return req
+}
@@ -0,0 +1,94 @@
+// Package lifecycle defines the Start/Close contract shared by the gateway's
+// long-running components: Start is idempotent and fails after Close, Close
+// may be called any number of times, and State reports where a component is.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// State 组件生命周期状态
+type State string
+
+const (
+	StateCreated  State = "created"
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	StateDegraded State = "degraded" // running, but not fully healthy
+	StateClosed   State = "closed"
+)
+
+// ErrClosed is returned by Start once a component has been closed
+var ErrClosed = errors.New("component is closed")
+
+// Component is a long-running part of the gateway
+type Component interface {
+	Start(ctx context.Context) error
+	Close() error
+	State() State
+}
+
+// Guard implements the lifecycle contract for a component. Transitions are
+// serialized, so concurrent Start calls run the start function once and the
+// others wait for its result; State never blocks.
+// The zero value is a Guard in StateCreated.
+type Guard struct {
+	mu    sync.Mutex
+	state atomic.Value // State
+}
+
+// State returns the current state
+func (g *Guard) State() State {
+	if state, ok := g.state.Load().(State); ok {
+		return state
+	}
+	return StateCreated
+}
+
+// Start runs start unless the component is already up. A failed start
+// returns to StateCreated so it may be retried; after Close it returns ErrClosed.
+func (g *Guard) Start(start func() error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch g.State() {
+	case StateClosed:
+		return ErrClosed
+	case StateRunning, StateDegraded:
+		return nil
+	}
+	g.state.Store(StateStarting)
+	if err := start(); err != nil {
+		g.state.Store(StateCreated)
+		return err
+	}
+	g.state.Store(StateRunning)
+	return nil
+}
+
+// Close runs stop the first time it is called, started or not, so stop must
+// cope with a component that never started. A Close during Start waits for
+// the start to finish.
+func (g *Guard) Close(stop func() error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.State() == StateClosed {
+		return nil
+	}
+	g.state.Store(StateClosed)
+	return stop()
+}
+
+// SetDegraded moves a started component between running and degraded;
+// other states are left alone
+func (g *Guard) SetDegraded(degraded bool) {
+	from, to := StateRunning, StateDegraded
+	if !degraded {
+		from, to = to, from
+	}
+	g.state.CompareAndSwap(from, to)
+}
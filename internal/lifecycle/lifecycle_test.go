@@ -0,0 +1,218 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/discovery"
+	"go-aigateway/internal/lifecycle"
+	"go-aigateway/internal/monitoring"
+	"go-aigateway/internal/performance"
+	"go-aigateway/internal/protocol"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hammer calls fn from n goroutines at once
+func hammer(n int, fn func()) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			fn()
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
+
+func TestGuardRunsStartAndStopOnce(t *testing.T) {
+	var g lifecycle.Guard
+	var starts, stops atomic.Int32
+	assert.Equal(t, lifecycle.StateCreated, g.State())
+
+	hammer(20, func() {
+		assert.NoError(t, g.Start(func() error {
+			starts.Add(1)
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}))
+	})
+	assert.Equal(t, int32(1), starts.Load())
+	assert.Equal(t, lifecycle.StateRunning, g.State())
+
+	g.SetDegraded(true)
+	assert.Equal(t, lifecycle.StateDegraded, g.State())
+	g.SetDegraded(false)
+	assert.Equal(t, lifecycle.StateRunning, g.State())
+
+	hammer(20, func() {
+		assert.NoError(t, g.Close(func() error {
+			stops.Add(1)
+			return nil
+		}))
+	})
+	assert.Equal(t, int32(1), stops.Load())
+	assert.Equal(t, lifecycle.StateClosed, g.State())
+
+	err := g.Start(func() error { return nil })
+	assert.ErrorIs(t, err, lifecycle.ErrClosed)
+	g.SetDegraded(true)
+	assert.Equal(t, lifecycle.StateClosed, g.State())
+}
+
+func TestGuardFailedStartCanBeRetried(t *testing.T) {
+	var g lifecycle.Guard
+	assert.Error(t, g.Start(func() error { return errors.New("boom") }))
+	assert.Equal(t, lifecycle.StateCreated, g.State())
+	require.NoError(t, g.Start(func() error { return nil }))
+	assert.Equal(t, lifecycle.StateRunning, g.State())
+}
+
+func TestGuardCloseWaitsForStart(t *testing.T) {
+	var g lifecycle.Guard
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go g.Start(func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+	assert.Equal(t, lifecycle.StateStarting, g.State())
+
+	closed := make(chan struct{})
+	var stopped bool
+	go func() {
+		g.Close(func() error {
+			stopped = true
+			return nil
+		})
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned before Start finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+	assert.True(t, stopped)
+	assert.Equal(t, lifecycle.StateClosed, g.State())
+}
+
+// fakeComponent records its calls and optionally blocks in Start
+type fakeComponent struct {
+	lifecycle.Guard
+	name    string
+	order   *[]string
+	mu      *sync.Mutex
+	release chan struct{}
+	err     error
+}
+
+func (f *fakeComponent) Start(context.Context) error {
+	return f.Guard.Start(func() error {
+		if f.release != nil {
+			<-f.release
+		}
+		return f.err
+	})
+}
+
+func (f *fakeComponent) Close() error {
+	return f.Guard.Close(func() error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		*f.order = append(*f.order, f.name)
+		return nil
+	})
+}
+
+func TestManagerStartsAndClosesInOrder(t *testing.T) {
+	var order []string
+	var mu sync.Mutex
+	newFake := func(name string) *fakeComponent {
+		return &fakeComponent{name: name, order: &order, mu: &mu}
+	}
+	first, second := newFake("first"), newFake("second")
+	slow := newFake("slow")
+	slow.release = make(chan struct{})
+
+	m := lifecycle.NewManager()
+	m.Register("first", first)
+	m.RegisterOptional("slow", slow)
+	m.Register("second", second)
+	assert.False(t, m.Ready())
+
+	// The optional component keeps starting in the background without gating readiness
+	require.NoError(t, m.StartAll(context.Background()))
+	assert.True(t, m.Ready())
+	assert.Eventually(t, func() bool { return slow.State() == lifecycle.StateStarting }, time.Second, time.Millisecond)
+	assert.Equal(t, []lifecycle.ComponentStatus{
+		{Name: "first", State: lifecycle.StateRunning, Required: true},
+		{Name: "slow", State: lifecycle.StateStarting},
+		{Name: "second", State: lifecycle.StateRunning, Required: true},
+	}, m.Statuses())
+	close(slow.release)
+
+	require.NoError(t, m.CloseAll())
+	assert.Equal(t, []string{"second", "slow", "first"}, order)
+	assert.False(t, m.Ready())
+
+	failing := lifecycle.NewManager()
+	failing.Register("broken", &fakeComponent{name: "broken", order: &order, mu: &mu, err: errors.New("no backend")})
+	assert.ErrorContains(t, failing.StartAll(context.Background()), "failed to start broken: no backend")
+}
+
+func TestComponentsSurviveConcurrentStartAndClose(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	newDiscovery := func() lifecycle.Component {
+		m, err := discovery.NewManager(context.Background(), &config.ServiceDiscoveryConfig{Enabled: true, Type: "consul", RefreshRate: time.Second})
+		require.NoError(t, err)
+		return m
+	}
+	newMonitoring := func() lifecycle.Component {
+		return monitoring.NewMonitoringSystem(&config.MonitoringConfig{Enabled: true}, nil, reg)
+	}
+	components := map[string]func() lifecycle.Component{
+		"discovery":  newDiscovery,
+		"monitoring": newMonitoring,
+		"performance": func() lifecycle.Component {
+			return performance.NewPerformanceOptimizer(&config.Config{}, reg)
+		},
+		"protocol": func() lifecycle.Component {
+			return protocol.NewProtocolConverter(&config.ProtocolConversionConfig{Enabled: true})
+		},
+	}
+
+	for name, create := range components {
+		t.Run(name, func(t *testing.T) {
+			// Constructing twice must not panic on duplicate Prometheus registration
+			create()
+			c := create()
+			assert.Equal(t, lifecycle.StateCreated, c.State())
+
+			hammer(10, func() { assert.NoError(t, c.Start(context.Background())) })
+			assert.Equal(t, lifecycle.StateRunning, c.State())
+
+			hammer(10, func() {
+				c.Start(context.Background())
+				assert.NoError(t, c.Close())
+			})
+			assert.Equal(t, lifecycle.StateClosed, c.State())
+			assert.ErrorIs(t, c.Start(context.Background()), lifecycle.ErrClosed)
+			assert.NoError(t, c.Close())
+		})
+	}
+}
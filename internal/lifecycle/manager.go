@@ -0,0 +1,111 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ComponentStatus 组件状态，供就绪探针展示
+type ComponentStatus struct {
+	Name     string `json:"name"`
+	State    State  `json:"state"`
+	Required bool   `json:"required"`
+}
+
+type entry struct {
+	name      string
+	component Component
+	required  bool
+}
+
+// Manager starts registered components in order, closes them in reverse and
+// reports their states. Required components gate readiness; optional ones
+// start in the background and are only reported.
+type Manager struct {
+	mu      sync.Mutex
+	entries []entry
+}
+
+// NewManager creates an empty component manager
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Register adds a component that must be running for the gateway to be ready
+func (m *Manager) Register(name string, component Component) {
+	m.add(entry{name: name, component: component, required: true})
+}
+
+// RegisterOptional adds a slow or non-essential component, such as the local model server
+func (m *Manager) RegisterOptional(name string, component Component) {
+	m.add(entry{name: name, component: component})
+}
+
+func (m *Manager) add(e entry) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = append(m.entries, e)
+}
+
+func (m *Manager) snapshot() []entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]entry(nil), m.entries...)
+}
+
+// StartAll starts the required components in registration order, stopping at
+// the first failure, and launches the optional ones in the background
+func (m *Manager) StartAll(ctx context.Context) error {
+	for _, e := range m.snapshot() {
+		if !e.required {
+			go func(e entry) {
+				if err := e.component.Start(ctx); err != nil {
+					logrus.WithError(err).WithField("component", e.name).Error("Failed to start component")
+				} else {
+					logrus.WithField("component", e.name).Info("Component started")
+				}
+			}(e)
+			continue
+		}
+		if err := e.component.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start %s: %w", e.name, err)
+		}
+	}
+	return nil
+}
+
+// CloseAll closes every component in reverse registration order
+func (m *Manager) CloseAll() error {
+	entries := m.snapshot()
+	var errs []error
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := entries[i].component.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", entries[i].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Statuses lists the components in registration order
+func (m *Manager) Statuses() []ComponentStatus {
+	entries := m.snapshot()
+	statuses := make([]ComponentStatus, 0, len(entries))
+	for _, e := range entries {
+		statuses = append(statuses, ComponentStatus{Name: e.name, State: e.component.State(), Required: e.required})
+	}
+	return statuses
+}
+
+// Ready reports whether every required component is running, possibly degraded
+func (m *Manager) Ready() bool {
+	for _, status := range m.Statuses() {
+		if status.Required && status.State != StateRunning && status.State != StateDegraded {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,258 @@
+package localmodel
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Checkpointed generation states
+const (
+	CheckpointRunning     = "running"
+	CheckpointCompleted   = "completed"
+	CheckpointInterrupted = "interrupted" // the connection to the model server dropped; resumable
+	CheckpointFailed      = "failed"      // the model server rejected the request
+)
+
+const checkpointKeyPrefix = "localmodel:checkpoint:"
+
+var (
+	// ErrCheckpointNotFound is returned for unknown or expired checkpoint IDs
+	ErrCheckpointNotFound = errors.New("checkpoint not found")
+	// ErrCheckpointExists is returned when a new generation reuses a checkpoint ID
+	ErrCheckpointExists = errors.New("checkpoint already exists")
+	// ErrInvalidCheckpointID is returned for IDs the model server would refuse as file names
+	ErrInvalidCheckpointID = errors.New("checkpoint ID must be 1-64 letters, digits, '-' or '_'")
+)
+
+var checkpointIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// CheckpointRequest is sent to the model server's /v1/checkpoint endpoint
+type CheckpointRequest struct {
+	ChatCompletionRequest
+	CheckpointID    string `json:"checkpoint_id"`
+	CheckpointEvery int    `json:"checkpoint_every"`
+	Resume          bool   `json:"resume,omitempty"`
+}
+
+// CheckpointResponse is a chat completion produced by a checkpointed generation
+type CheckpointResponse struct {
+	ChatCompletionResponse
+	CheckpointID      string `json:"checkpoint_id"`
+	ResumedFromTokens int    `json:"resumed_from_tokens"`
+}
+
+// CheckpointMeta 断点续传生成的元数据，保存在 Redis 中，网关重启后仍可恢复
+type CheckpointMeta struct {
+	ID              string                `json:"id"`
+	Owner           string                `json:"-"`
+	Status          string                `json:"status"`
+	Request         ChatCompletionRequest `json:"request"`
+	CheckpointEvery int                   `json:"checkpoint_every"`
+	Attempts        int                   `json:"attempts"`
+	Error           string                `json:"error,omitempty"`
+	CreatedAt       time.Time             `json:"created_at"`
+	UpdatedAt       time.Time             `json:"updated_at"`
+	Result          *CheckpointResponse   `json:"result,omitempty"`
+}
+
+// storedCheckpoint persists the owner, which the API representation hides
+type storedCheckpoint struct {
+	CheckpointMeta
+	Owner string `json:"owner"`
+}
+
+// InferenceCheckpointer runs long local generations that the model server
+// checkpoints to disk every few tokens, so a generation interrupted by a
+// dropped connection or a gateway restart resumes instead of starting over.
+type InferenceCheckpointer struct {
+	config     *config.LocalModelConfig
+	redis      *redis.Client
+	httpClient *http.Client
+	endpoint   string
+	now        func() time.Time
+}
+
+// NewInferenceCheckpointer creates a checkpointer storing metadata in redisClient
+func NewInferenceCheckpointer(cfg *config.LocalModelConfig, redisClient *redis.Client) *InferenceCheckpointer {
+	return &InferenceCheckpointer{
+		config: cfg,
+		redis:  redisClient,
+		// Checkpointed generations outlast the regular local model timeout
+		httpClient: &http.Client{Timeout: cfg.CheckpointTimeout},
+		endpoint:   fmt.Sprintf("http://%s:%d/v1/checkpoint", cfg.ServerHost, cfg.ServerPort),
+		now:        time.Now,
+	}
+}
+
+// NewCheckpointID returns a random checkpoint ID
+func NewCheckpointID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "ckpt_" + hex.EncodeToString(b)
+}
+
+// Generate starts a checkpointed chat generation under id; only owner may resume it
+func (ic *InferenceCheckpointer) Generate(ctx context.Context, owner, id string, request *ChatCompletionRequest) (*CheckpointResponse, error) {
+	if !checkpointIDPattern.MatchString(id) {
+		return nil, ErrInvalidCheckpointID
+	}
+	if request.MaxTokens == 0 {
+		request.MaxTokens = ic.config.MaxTokens
+	}
+
+	now := ic.now()
+	meta := &CheckpointMeta{
+		ID:              id,
+		Owner:           owner,
+		Status:          CheckpointRunning,
+		Request:         *request,
+		CheckpointEvery: ic.config.CheckpointTokens,
+		Attempts:        1,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	data, err := json.Marshal(storedCheckpoint{CheckpointMeta: *meta, Owner: owner})
+	if err != nil {
+		return nil, err
+	}
+	created, err := ic.redis.SetNX(ctx, checkpointKeyPrefix+id, data, ic.config.CheckpointTTL).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to save checkpoint metadata: %w", err)
+	}
+	if !created {
+		return nil, ErrCheckpointExists
+	}
+	return ic.run(ctx, meta, false)
+}
+
+// Resume continues the generation from its last checkpoint. A completed
+// generation returns its stored result without calling the model server.
+func (ic *InferenceCheckpointer) Resume(ctx context.Context, owner, id string) (*CheckpointResponse, error) {
+	meta, err := ic.Get(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+	if meta.Status == CheckpointCompleted && meta.Result != nil {
+		return meta.Result, nil
+	}
+
+	meta.Attempts++
+	meta.Status = CheckpointRunning
+	meta.Error = ""
+	if err := ic.save(ctx, meta); err != nil {
+		return nil, err
+	}
+	return ic.run(ctx, meta, true)
+}
+
+// Get returns the metadata of a checkpointed generation; other owners' generations are not found
+func (ic *InferenceCheckpointer) Get(ctx context.Context, owner, id string) (*CheckpointMeta, error) {
+	if !checkpointIDPattern.MatchString(id) {
+		return nil, ErrCheckpointNotFound
+	}
+	data, err := ic.redis.Get(ctx, checkpointKeyPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrCheckpointNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint metadata: %w", err)
+	}
+	var stored storedCheckpoint
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint metadata: %w", err)
+	}
+	if stored.Owner != owner {
+		return nil, ErrCheckpointNotFound
+	}
+	stored.CheckpointMeta.Owner = stored.Owner
+	return &stored.CheckpointMeta, nil
+}
+
+// run calls the model server and records the outcome
+func (ic *InferenceCheckpointer) run(ctx context.Context, meta *CheckpointMeta, resume bool) (*CheckpointResponse, error) {
+	result, interrupted, err := ic.call(ctx, &CheckpointRequest{
+		ChatCompletionRequest: meta.Request,
+		CheckpointID:          meta.ID,
+		CheckpointEvery:       meta.CheckpointEvery,
+		Resume:                resume,
+	})
+
+	switch {
+	case err == nil:
+		meta.Status = CheckpointCompleted
+		meta.Result = result
+	case interrupted:
+		meta.Status = CheckpointInterrupted
+		meta.Error = err.Error()
+	default:
+		meta.Status = CheckpointFailed
+		meta.Error = err.Error()
+	}
+	// Record the outcome even when the caller has gone away
+	if saveErr := ic.save(context.WithoutCancel(ctx), meta); saveErr != nil {
+		logrus.WithError(saveErr).WithField("checkpoint_id", meta.ID).Error("Failed to update checkpoint metadata")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// call sends one request to the model server; interrupted reports a dropped
+// connection or cancellation rather than a rejection by the server
+func (ic *InferenceCheckpointer) call(ctx context.Context, request *CheckpointRequest) (result *CheckpointResponse, interrupted bool, err error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ic.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ic.httpClient.Do(req)
+	if err != nil {
+		return nil, true, fmt.Errorf("checkpointed generation interrupted: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("checkpointed generation interrupted: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("model server returned status %d: %s", resp.StatusCode, bytes.TrimSpace(data))
+	}
+	var response CheckpointResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, false, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return &response, false, nil
+}
+
+func (ic *InferenceCheckpointer) save(ctx context.Context, meta *CheckpointMeta) error {
+	meta.UpdatedAt = ic.now()
+	data, err := json.Marshal(storedCheckpoint{CheckpointMeta: *meta, Owner: meta.Owner})
+	if err != nil {
+		return err
+	}
+	if err := ic.redis.Set(ctx, checkpointKeyPrefix+meta.ID, data, ic.config.CheckpointTTL).Err(); err != nil {
+		return fmt.Errorf("failed to save checkpoint metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package localmodel
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCheckpointServer mimics the Python /v1/checkpoint endpoint with a
+// deterministic model: token i of a generation is "tok<i>". dropAfter, when
+// set, kills the connection once that many tokens exist, like a network drop.
+type fakeCheckpointServer struct {
+	mu          sync.Mutex
+	checkpoints map[string][]string // saved tokens by checkpoint ID
+	dropAfter   int
+	calls       atomic.Int32
+}
+
+func (f *fakeCheckpointServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.calls.Add(1)
+	var req CheckpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var tokens []string
+	f.mu.Lock()
+	if req.Resume {
+		tokens = append(tokens, f.checkpoints[req.CheckpointID]...)
+	}
+	dropAfter := f.dropAfter
+	f.dropAfter = 0
+	f.mu.Unlock()
+	resumedFrom := len(tokens)
+
+	for len(tokens) < req.MaxTokens {
+		tokens = append(tokens, "tok"+strconv.Itoa(len(tokens)))
+		if len(tokens)%req.CheckpointEvery == 0 || len(tokens) == req.MaxTokens {
+			f.mu.Lock()
+			f.checkpoints[req.CheckpointID] = append([]string(nil), tokens...)
+			f.mu.Unlock()
+		}
+		if dropAfter > 0 && len(tokens) == dropAfter {
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	var resp CheckpointResponse
+	resp.CheckpointID = req.CheckpointID
+	resp.ResumedFromTokens = resumedFrom
+	resp.Choices = append(resp.Choices, struct {
+		Index        int         `json:"index"`
+		Message      ChatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	}{Message: ChatMessage{Role: "assistant", Content: strings.Join(tokens, " ")}, FinishReason: "stop"})
+	resp.Usage.CompletionTokens = len(tokens)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func newTestCheckpointer(t *testing.T) (*InferenceCheckpointer, *fakeCheckpointServer) {
+	fake := &fakeCheckpointServer{checkpoints: make(map[string][]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	mr := miniredis.RunT(t)
+
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(target.Port())
+	require.NoError(t, err)
+	cfg := &config.LocalModelConfig{
+		ServerHost:        target.Hostname(),
+		ServerPort:        port,
+		MaxTokens:         20,
+		CheckpointTokens:  4,
+		CheckpointTimeout: 5 * time.Second,
+		CheckpointTTL:     time.Hour,
+	}
+	return NewInferenceCheckpointer(cfg, redis.NewClient(&redis.Options{Addr: mr.Addr()})), fake
+}
+
+func TestCheckpointedGenerationResumesAfterInterrupt(t *testing.T) {
+	ic, fake := newTestCheckpointer(t)
+	ctx := context.Background()
+	request := func() *ChatCompletionRequest {
+		return &ChatCompletionRequest{Messages: []ChatMessage{{Role: "user", Content: "Count"}}}
+	}
+
+	reference, err := ic.Generate(ctx, "alice", "reference", request())
+	require.NoError(t, err)
+	assert.Equal(t, 0, reference.ResumedFromTokens)
+
+	// The connection drops after 10 tokens; the last checkpoint holds 8
+	fake.dropAfter = 10
+	_, err = ic.Generate(ctx, "alice", "interrupted", request())
+	require.Error(t, err)
+	meta, err := ic.Get(ctx, "alice", "interrupted")
+	require.NoError(t, err)
+	assert.Equal(t, CheckpointInterrupted, meta.Status)
+
+	resumed, err := ic.Resume(ctx, "alice", "interrupted")
+	require.NoError(t, err)
+	assert.Equal(t, 8, resumed.ResumedFromTokens)
+	assert.Equal(t, reference.Choices[0].Message.Content, resumed.Choices[0].Message.Content)
+
+	meta, err = ic.Get(ctx, "alice", "interrupted")
+	require.NoError(t, err)
+	assert.Equal(t, CheckpointCompleted, meta.Status)
+	assert.Equal(t, 2, meta.Attempts)
+	assert.Empty(t, meta.Error)
+
+	// Resuming a completed generation returns the stored result
+	calls := fake.calls.Load()
+	again, err := ic.Resume(ctx, "alice", "interrupted")
+	require.NoError(t, err)
+	assert.Equal(t, resumed, again)
+	assert.Equal(t, calls, fake.calls.Load())
+}
+
+func TestCheckpointIDs(t *testing.T) {
+	ic, _ := newTestCheckpointer(t)
+	ctx := context.Background()
+
+	_, err := ic.Generate(ctx, "alice", "../etc/passwd", &ChatCompletionRequest{})
+	assert.ErrorIs(t, err, ErrInvalidCheckpointID)
+
+	_, err = ic.Generate(ctx, "alice", "dup", &ChatCompletionRequest{})
+	require.NoError(t, err)
+	_, err = ic.Generate(ctx, "alice", "dup", &ChatCompletionRequest{})
+	assert.ErrorIs(t, err, ErrCheckpointExists)
+
+	_, err = ic.Resume(ctx, "alice", "missing")
+	assert.ErrorIs(t, err, ErrCheckpointNotFound)
+	// Another key cannot see or resume the generation
+	_, err = ic.Resume(ctx, "bob", "dup")
+	assert.ErrorIs(t, err, ErrCheckpointNotFound)
+	meta, err := ic.Get(ctx, "alice", "dup")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", meta.Owner)
+
+	id := NewCheckpointID()
+	assert.Regexp(t, checkpointIDPattern, id)
+	assert.NotEqual(t, id, NewCheckpointID())
+	assert.True(t, strings.HasPrefix(id, "ckpt_"))
+}
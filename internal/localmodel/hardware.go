@@ -0,0 +1,289 @@
+package localmodel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Model sizes in ascending order of resource needs
+var modelSizes = []string{"small", "medium", "large"}
+
+// ModelRequirements 每种模型规格运行所需的资源
+type ModelRequirements struct {
+	GPUMemoryMB int64 // weights plus runtime overhead in fp16 on a GPU
+	RAMMB       int64 // weights plus runtime overhead in fp32 on the CPU
+	// KVCacheMBPer1kTokens is the generation-time memory for 1000 batched tokens
+	KVCacheMBPer1kTokens int64
+}
+
+// ModelResourceTable 模型规格资源表，按server.py中MODEL_MAP的最大模型估算
+var ModelResourceTable = map[string]ModelRequirements{
+	"small":  {GPUMemoryMB: 3 * 1024, RAMMB: 6 * 1024, KVCacheMBPer1kTokens: 24},
+	"medium": {GPUMemoryMB: 6 * 1024, RAMMB: 12 * 1024, KVCacheMBPer1kTokens: 48},
+	"large":  {GPUMemoryMB: 16 * 1024, RAMMB: 32 * 1024, KVCacheMBPer1kTokens: 128},
+}
+
+const (
+	// maxBatchTokensCap bounds the generation guard passed to the Python server
+	maxBatchTokensCap = 32768
+	// minBatchTokens is the smallest useful guard; tighter fits are rejected
+	minBatchTokens = 512
+	// memoryHeadroom keeps a share of the free memory untouched by the guard
+	memoryHeadroom = 0.1
+)
+
+// HardwareInfo 启动前探测到的硬件资源
+type HardwareInfo struct {
+	GPUCount       int   `json:"gpu_count"`
+	GPUFreeMB      int64 `json:"gpu_free_mb"` // free memory of the roomiest GPU
+	GPUTotalMB     int64 `json:"gpu_total_mb"`
+	RAMTotalMB     int64 `json:"ram_total_mb"`
+	RAMAvailableMB int64 `json:"ram_available_mb"`
+}
+
+// ResourceUsage 模型服务进程运行时的资源占用
+type ResourceUsage struct {
+	RSSMB      int64 `json:"rss_mb"`
+	RAMTotalMB int64 `json:"ram_total_mb"`
+	GPUUsedMB  int64 `json:"gpu_used_mb"` // summed over all GPUs
+	GPUTotalMB int64 `json:"gpu_total_mb"`
+}
+
+// HardwareProbe reports the resources available to and used by the model server
+type HardwareProbe interface {
+	Probe(ctx context.Context) (HardwareInfo, error)
+	Usage(ctx context.Context, pid int) (ResourceUsage, error)
+}
+
+// SystemProbe 通过nvidia-smi和/proc探测硬件；读取函数可替换以便测试
+type SystemProbe struct {
+	NvidiaSMI  func(ctx context.Context, query string) ([]byte, error)
+	Meminfo    func() ([]byte, error)
+	ProcStatus func(pid int) ([]byte, error)
+}
+
+// NewSystemProbe returns a probe reading the local machine
+func NewSystemProbe() *SystemProbe {
+	return &SystemProbe{
+		NvidiaSMI: func(ctx context.Context, query string) ([]byte, error) {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			return exec.CommandContext(ctx, "nvidia-smi", "--query-gpu="+query, "--format=csv,noheader,nounits").Output()
+		},
+		Meminfo: func() ([]byte, error) {
+			return os.ReadFile("/proc/meminfo")
+		},
+		ProcStatus: func(pid int) ([]byte, error) {
+			return os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+		},
+	}
+}
+
+// Probe reads GPU and RAM resources. A machine without nvidia-smi has no GPU;
+// failing to read the RAM is an error.
+func (p *SystemProbe) Probe(ctx context.Context) (HardwareInfo, error) {
+	var info HardwareInfo
+
+	if out, err := p.NvidiaSMI(ctx, "memory.free,memory.total"); err == nil {
+		gpus, err := parseGPUMemory(out)
+		if err != nil {
+			return info, err
+		}
+		info.GPUCount = len(gpus)
+		for _, gpu := range gpus {
+			if gpu[0] > info.GPUFreeMB {
+				info.GPUFreeMB, info.GPUTotalMB = gpu[0], gpu[1]
+			}
+		}
+	}
+
+	data, err := p.Meminfo()
+	if err != nil {
+		return info, fmt.Errorf("failed to read memory info: %w", err)
+	}
+	if info.RAMTotalMB, info.RAMAvailableMB, err = parseMeminfo(data); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+// Usage samples the resident memory of a process and the memory used on all GPUs
+func (p *SystemProbe) Usage(ctx context.Context, pid int) (ResourceUsage, error) {
+	var usage ResourceUsage
+
+	status, err := p.ProcStatus(pid)
+	if err != nil {
+		return usage, fmt.Errorf("failed to read process status: %w", err)
+	}
+	if usage.RSSMB, err = parseVmRSS(status); err != nil {
+		return usage, err
+	}
+	data, err := p.Meminfo()
+	if err != nil {
+		return usage, fmt.Errorf("failed to read memory info: %w", err)
+	}
+	if usage.RAMTotalMB, _, err = parseMeminfo(data); err != nil {
+		return usage, err
+	}
+
+	if out, err := p.NvidiaSMI(ctx, "memory.used,memory.total"); err == nil {
+		gpus, err := parseGPUMemory(out)
+		if err != nil {
+			return usage, err
+		}
+		for _, gpu := range gpus {
+			usage.GPUUsedMB += gpu[0]
+			usage.GPUTotalMB += gpu[1]
+		}
+	}
+	return usage, nil
+}
+
+// parseGPUMemory parses nvidia-smi csv output with two MiB columns per GPU
+func parseGPUMemory(out []byte) ([][2]int64, error) {
+	var gpus [][2]int64
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected nvidia-smi output %q", line)
+		}
+		var gpu [2]int64
+		for i, field := range fields {
+			v, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("unexpected nvidia-smi output %q", line)
+			}
+			gpu[i] = v
+		}
+		gpus = append(gpus, gpu)
+	}
+	return gpus, nil
+}
+
+// parseMeminfo returns MemTotal and MemAvailable in MiB
+func parseMeminfo(data []byte) (int64, int64, error) {
+	var total, available int64 = -1, -1
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb / 1024
+		case "MemAvailable:":
+			available = kb / 1024
+		}
+	}
+	if total < 0 || available < 0 {
+		return 0, 0, fmt.Errorf("meminfo lacks MemTotal or MemAvailable")
+	}
+	return total, available, nil
+}
+
+// parseVmRSS returns the VmRSS of a /proc/<pid>/status file in MiB
+func parseVmRSS(data []byte) (int64, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "VmRSS:" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("unexpected VmRSS value %q", fields[1])
+			}
+			return kb / 1024, nil
+		}
+	}
+	return 0, fmt.Errorf("process status lacks VmRSS")
+}
+
+// SizeSelection 硬件检查后实际使用的模型规格
+type SizeSelection struct {
+	Requested      string       `json:"requested"`
+	Effective      string       `json:"effective"`
+	Downgraded     bool         `json:"downgraded"`
+	Device         string       `json:"device"` // cuda or cpu
+	MaxBatchTokens int          `json:"max_batch_tokens"`
+	Hardware       HardwareInfo `json:"hardware"`
+}
+
+// SelectModelSize picks the largest size up to requested that fits the hardware.
+// In strict mode a requested size that does not fit is an error instead of a downgrade.
+func SelectModelSize(requested string, hw HardwareInfo, strict bool) (*SizeSelection, error) {
+	requestedIdx := -1
+	for i, size := range modelSizes {
+		if size == requested {
+			requestedIdx = i
+		}
+	}
+	if requestedIdx < 0 {
+		return nil, fmt.Errorf("unknown model size %q", requested)
+	}
+
+	device, free := "cpu", hw.RAMAvailableMB
+	if hw.GPUCount > 0 {
+		device, free = "cuda", hw.GPUFreeMB
+	}
+
+	for i := requestedIdx; i >= 0; i-- {
+		size := modelSizes[i]
+		batchTokens, ok := batchTokensFor(ModelResourceTable[size], device, free)
+		if !ok {
+			if strict {
+				return nil, fmt.Errorf("model size %s needs %dMB of %s memory, only %dMB free",
+					size, requiredMB(ModelResourceTable[size], device), device, free)
+			}
+			continue
+		}
+		return &SizeSelection{
+			Requested:      requested,
+			Effective:      size,
+			Downgraded:     i != requestedIdx,
+			Device:         device,
+			MaxBatchTokens: batchTokens,
+			Hardware:       hw,
+		}, nil
+	}
+	return nil, fmt.Errorf("no model size fits: %dMB of %s memory free, %s needs %dMB",
+		free, device, modelSizes[0], requiredMB(ModelResourceTable[modelSizes[0]], device))
+}
+
+func requiredMB(req ModelRequirements, device string) int64 {
+	if device == "cuda" {
+		return req.GPUMemoryMB
+	}
+	return req.RAMMB
+}
+
+// batchTokensFor computes the generation-time token guard for the memory left
+// after loading the weights; a size fits when it leaves room for minBatchTokens
+func batchTokensFor(req ModelRequirements, device string, freeMB int64) (int, bool) {
+	spare := float64(freeMB)*(1-memoryHeadroom) - float64(requiredMB(req, device))
+	if spare <= 0 {
+		return 0, false
+	}
+	tokens := int64(spare * 1000 / float64(req.KVCacheMBPer1kTokens))
+	if tokens < minBatchTokens {
+		return 0, false
+	}
+	if tokens > maxBatchTokensCap {
+		tokens = maxBatchTokensCap
+	}
+	return int(tokens), true
+}
@@ -0,0 +1,172 @@
+package localmodel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/monitoring"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMeminfo = `MemTotal:       16384000 kB
+MemFree:         1024000 kB
+MemAvailable:    8192000 kB
+Buffers:          102400 kB
+`
+
+// fakeProbe returns canned nvidia-smi and /proc outputs; a nil GPU output means no nvidia-smi
+func fakeProbe(gpuFree, gpuUsed, procStatus string) *SystemProbe {
+	return &SystemProbe{
+		NvidiaSMI: func(_ context.Context, query string) ([]byte, error) {
+			if gpuFree == "" {
+				return nil, errors.New("nvidia-smi: command not found")
+			}
+			if query == "memory.used,memory.total" {
+				return []byte(gpuUsed), nil
+			}
+			return []byte(gpuFree), nil
+		},
+		Meminfo:    func() ([]byte, error) { return []byte(testMeminfo), nil },
+		ProcStatus: func(int) ([]byte, error) { return []byte(procStatus), nil },
+	}
+}
+
+func TestSystemProbeParsesOutputs(t *testing.T) {
+	hw, err := fakeProbe("4096, 8192\n20480, 24576\n", "", "").Probe(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, HardwareInfo{
+		GPUCount:       2,
+		GPUFreeMB:      20480,
+		GPUTotalMB:     24576,
+		RAMTotalMB:     16000,
+		RAMAvailableMB: 8000,
+	}, hw)
+
+	hw, err = fakeProbe("", "", "").Probe(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, hw.GPUCount)
+	assert.Equal(t, int64(8000), hw.RAMAvailableMB)
+
+	_, err = fakeProbe("garbage", "", "").Probe(context.Background())
+	assert.Error(t, err)
+}
+
+func TestSelectModelSize(t *testing.T) {
+	tests := []struct {
+		name       string
+		requested  string
+		hw         HardwareInfo
+		effective  string
+		device     string
+		downgraded bool
+	}{
+		{"large fits a 24GB GPU", "large", HardwareInfo{GPUCount: 1, GPUFreeMB: 24000}, "large", "cuda", false},
+		{"large downgraded on an 8GB GPU", "large", HardwareInfo{GPUCount: 1, GPUFreeMB: 8000}, "medium", "cuda", true},
+		{"large downgraded to small on a 4GB GPU", "large", HardwareInfo{GPUCount: 1, GPUFreeMB: 4000}, "small", "cuda", true},
+		{"cpu uses available RAM", "large", HardwareInfo{RAMAvailableMB: 16000}, "medium", "cpu", true},
+		{"small requested stays small", "small", HardwareInfo{GPUCount: 1, GPUFreeMB: 80000}, "small", "cuda", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selection, err := SelectModelSize(tt.requested, tt.hw, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.requested, selection.Requested)
+			assert.Equal(t, tt.effective, selection.Effective)
+			assert.Equal(t, tt.device, selection.Device)
+			assert.Equal(t, tt.downgraded, selection.Downgraded)
+			assert.GreaterOrEqual(t, selection.MaxBatchTokens, minBatchTokens)
+			assert.LessOrEqual(t, selection.MaxBatchTokens, maxBatchTokensCap)
+		})
+	}
+
+	// More free memory leaves room for larger batches
+	tight, err := SelectModelSize("large", HardwareInfo{GPUCount: 1, GPUFreeMB: 19000}, false)
+	require.NoError(t, err)
+	roomy, err := SelectModelSize("large", HardwareInfo{GPUCount: 1, GPUFreeMB: 20000}, false)
+	require.NoError(t, err)
+	assert.Less(t, tight.MaxBatchTokens, roomy.MaxBatchTokens)
+
+	_, err = SelectModelSize("small", HardwareInfo{GPUCount: 1, GPUFreeMB: 1024}, false)
+	assert.ErrorContains(t, err, "no model size fits")
+	_, err = SelectModelSize("huge", HardwareInfo{}, false)
+	assert.Error(t, err)
+}
+
+func TestSelectModelSizeStrictMode(t *testing.T) {
+	_, err := SelectModelSize("large", HardwareInfo{GPUCount: 1, GPUFreeMB: 8000}, true)
+	assert.ErrorContains(t, err, "model size large needs 16384MB of cuda memory")
+
+	selection, err := SelectModelSize("medium", HardwareInfo{GPUCount: 1, GPUFreeMB: 8000}, true)
+	require.NoError(t, err)
+	assert.Equal(t, "medium", selection.Effective)
+}
+
+func TestServerSelectModelSize(t *testing.T) {
+	cfg := &config.LocalModelConfig{ModelSize: "large"}
+	pms := NewPythonModelServer(cfg)
+	pms.probe = fakeProbe("8000, 8192", "", "")
+
+	selection, err := pms.selectModelSize(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "medium", selection.Effective)
+	assert.True(t, selection.Downgraded)
+
+	cfg.StrictHardware = true
+	_, err = pms.selectModelSize(context.Background())
+	assert.Error(t, err)
+
+	// A failed probe starts the requested size unguarded, except in strict mode
+	pms.probe = &SystemProbe{
+		NvidiaSMI: func(context.Context, string) ([]byte, error) { return nil, errors.New("missing") },
+		Meminfo:   func() ([]byte, error) { return nil, errors.New("no /proc") },
+	}
+	_, err = pms.selectModelSize(context.Background())
+	assert.ErrorContains(t, err, "hardware probe failed")
+
+	cfg.StrictHardware = false
+	selection, err = pms.selectModelSize(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &SizeSelection{Requested: "large", Effective: "large"}, selection)
+}
+
+type recordedAlert struct {
+	rule   string
+	value  float64
+	firing bool
+}
+
+type fakeAlertSink struct{ alerts []recordedAlert }
+
+func (s *fakeAlertSink) EvaluateRule(_ context.Context, rule *monitoring.Rule, value float64, firing bool) {
+	s.alerts = append(s.alerts, recordedAlert{rule.ID, value, firing})
+}
+
+func TestCheckResourcesRaisesMemoryAlerts(t *testing.T) {
+	sink := &fakeAlertSink{}
+	pms := NewPythonModelServer(&config.LocalModelConfig{MemoryAlertThreshold: 0.9})
+	pms.SetAlertSink(sink)
+	// 15000 of 16000MB RSS, 12000 of 24576MB GPU memory
+	pms.probe = fakeProbe("1, 1", "12000, 24576", "Name:\tpython\nVmRSS:\t15360000 kB\n")
+
+	usage, err := pms.checkResources(context.Background(), 1234)
+	require.NoError(t, err)
+	assert.Equal(t, int64(15000), usage.RSSMB)
+	require.Len(t, sink.alerts, 2)
+	assert.Equal(t, "local_model_ram_pressure", sink.alerts[0].rule)
+	assert.True(t, sink.alerts[0].firing)
+	assert.InDelta(t, 0.9375, sink.alerts[0].value, 1e-9)
+	assert.Equal(t, "local_model_gpu_pressure", sink.alerts[1].rule)
+	assert.False(t, sink.alerts[1].firing)
+
+	// Without GPUs only the RAM rule is evaluated
+	sink.alerts = nil
+	pms.probe = fakeProbe("", "", "VmRSS:\t1024000 kB\n")
+	_, err = pms.checkResources(context.Background(), 1234)
+	require.NoError(t, err)
+	require.Len(t, sink.alerts, 1)
+	assert.False(t, sink.alerts[0].firing)
+}
@@ -3,12 +3,37 @@ package localmodel
 import (
 	"context"
 	"sync"
+	"time"
+
+	"go-aigateway/internal/lifecycle"
+
+	"github.com/sirupsen/logrus"
 )
 
-// Manager manages the Python model server
+// Manager manages the Python model server and restarts it when its process dies
 type Manager struct {
 	server *PythonModelServer
-	mu     sync.Mutex
+
+	superviseOnce  sync.Once
+	stopSupervisor context.CancelFunc
+	supervisorDone chan struct{}
+
+	mu        sync.Mutex
+	restarts  int
+	lastError string
+	lastExit  *ProcessExit
+	gaveUp    bool
+}
+
+// ServerStatus 本地模型服务进程的监督状态
+type ServerStatus struct {
+	State     lifecycle.State `json:"state"`
+	Running   bool            `json:"running"`
+	PID       int             `json:"pid,omitempty"`
+	Restarts  int             `json:"restarts"`
+	LastError string          `json:"last_error,omitempty"`
+	LastExit  *ProcessExit    `json:"last_exit,omitempty"`
+	GaveUp    bool            `json:"gave_up"` // restart attempts are exhausted
 }
 
 // NewManager creates a new instance of the Python model server manager
@@ -18,21 +43,140 @@ func NewManager(server *PythonModelServer) *Manager {
 	}
 }
 
-// Start starts the Python model server
+// Start starts the Python model server and, once it is up, the supervisor
+// restarting it when its process exits
 func (m *Manager) Start(ctx context.Context) error {
+	if err := m.server.Start(ctx); err != nil {
+		m.recordError(err)
+		return err
+	}
+	m.superviseOnce.Do(func() {
+		supervisorCtx, cancel := context.WithCancel(context.Background())
+		m.mu.Lock()
+		m.stopSupervisor = cancel
+		m.supervisorDone = make(chan struct{})
+		m.mu.Unlock()
+		go m.supervise(supervisorCtx)
+	})
+	return nil
+}
+
+// Close stops the supervisor and the Python model server
+func (m *Manager) Close() error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-	return m.server.Start(ctx)
+	stop, done := m.stopSupervisor, m.supervisorDone
+	m.mu.Unlock()
+	if stop != nil {
+		stop()
+		<-done
+	}
+	return m.server.Close()
 }
 
-// Stop stops the Python model server
-func (m *Manager) Stop() error {
+// State reports the lifecycle state of the Python model server
+func (m *Manager) State() lifecycle.State {
+	return m.server.State()
+}
+
+// Status reports whether the server process is running and how often it was restarted
+func (m *Manager) Status() ServerStatus {
+	pid, running := m.server.Running()
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.server.Stop()
+	return ServerStatus{
+		State:     m.server.State(),
+		Running:   running,
+		PID:       pid,
+		Restarts:  m.restarts,
+		LastError: m.lastError,
+		LastExit:  m.lastExit,
+		GaveUp:    m.gaveUp,
+	}
 }
 
 // GetServer returns the Python model server
 func (m *Manager) GetServer() *PythonModelServer {
 	return m.server
 }
+
+func (m *Manager) recordError(err error) {
+	m.mu.Lock()
+	m.lastError = err.Error()
+	m.mu.Unlock()
+}
+
+// supervise waits on the server process and restarts it when it exits on its
+// own. Consecutive failures back off exponentially; a process that stayed up
+// for RestartMaxBackoff resets the count. After RestartMaxAttempts failed
+// restarts in a row the server is left down and degraded.
+func (m *Manager) supervise(ctx context.Context) {
+	defer close(m.supervisorDone)
+	cfg := m.server.config
+
+	attempts := 0
+	startedAt := time.Now()
+	for {
+		exit, ok := m.server.awaitExit(ctx)
+		if !ok {
+			return
+		}
+		logger := logrus.WithFields(logrus.Fields{"pid": exit.PID, "exit_code": exit.ExitCode})
+		logger.Warn("Python model server exited unexpectedly")
+		m.mu.Lock()
+		m.lastExit = &exit
+		if exit.Error != "" {
+			m.lastError = exit.Error
+		}
+		m.mu.Unlock()
+		m.server.lifecycle.SetDegraded(true)
+
+		if time.Since(startedAt) >= cfg.RestartMaxBackoff {
+			attempts = 0
+		}
+		for {
+			if attempts >= cfg.RestartMaxAttempts {
+				logger.WithField("attempts", attempts).Error("Giving up restarting the Python model server")
+				m.mu.Lock()
+				m.gaveUp = true
+				m.mu.Unlock()
+				return
+			}
+			attempts++
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(restartBackoff(cfg.RestartBackoff, cfg.RestartMaxBackoff, attempts)):
+			}
+
+			err := m.server.restart(ctx)
+			if err == nil {
+				startedAt = time.Now()
+				m.mu.Lock()
+				m.restarts++
+				m.mu.Unlock()
+				pid, _ := m.server.Running()
+				logrus.WithFields(logrus.Fields{"pid": pid, "attempt": attempts}).Info("Python model server restarted")
+				break
+			}
+			if ctx.Err() != nil || m.server.State() == lifecycle.StateClosed {
+				return
+			}
+			logger.WithError(err).WithField("attempt", attempts).Error("Failed to restart Python model server")
+			m.recordError(err)
+		}
+	}
+}
+
+// restartBackoff is the wait before restart attempt n (1-based): base doubled
+// per attempt, capped at maxWait
+func restartBackoff(base, maxWait time.Duration, attempt int) time.Duration {
+	wait := base
+	for i := 1; i < attempt && wait < maxWait; i++ {
+		wait *= 2
+	}
+	if maxWait > 0 && wait > maxWait {
+		wait = maxWait
+	}
+	return wait
+}
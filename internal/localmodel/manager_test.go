@@ -0,0 +1,108 @@
+package localmodel
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/lifecycle"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSupervisedManager launches the shell scripts in turn, repeating the last one
+func newSupervisedManager(t *testing.T, cfg *config.LocalModelConfig, scripts ...string) (*Manager, *atomic.Int32) {
+	cfg.ModelSize = "small"
+	pms := NewPythonModelServer(cfg)
+	pms.probe = fakeProbe("", "", "")
+	spawned := &atomic.Int32{}
+	pms.launch = func(context.Context, *SizeSelection) (*os.Process, bool, error) {
+		n := int(spawned.Add(1))
+		script := scripts[min(n, len(scripts))-1]
+		cmd := exec.Command("sh", "-c", script)
+		if err := cmd.Start(); err != nil {
+			return nil, false, err
+		}
+		return cmd.Process, true, nil
+	}
+	m := NewManager(pms)
+	t.Cleanup(func() { m.Close() })
+	return m, spawned
+}
+
+func TestManagerRestartsExitedServer(t *testing.T) {
+	m, spawned := newSupervisedManager(t, &config.LocalModelConfig{
+		RestartMaxAttempts: 3,
+		RestartBackoff:     time.Millisecond,
+		RestartMaxBackoff:  time.Second,
+	}, "exit 3", "sleep 60")
+
+	require.NoError(t, m.Start(context.Background()))
+	require.Eventually(t, func() bool { return m.Status().Restarts == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	status := m.Status()
+	assert.True(t, status.Running)
+	assert.NotZero(t, status.PID)
+	assert.Equal(t, lifecycle.StateRunning, status.State)
+	require.NotNil(t, status.LastExit)
+	assert.Equal(t, 3, status.LastExit.ExitCode)
+	assert.NotEmpty(t, status.LastError)
+	assert.False(t, status.GaveUp)
+	assert.Equal(t, int32(2), spawned.Load())
+
+	// Stopping the manager is not mistaken for a crash
+	require.NoError(t, m.Close())
+	assert.False(t, m.Status().Running)
+	assert.Equal(t, int32(2), spawned.Load())
+}
+
+func TestManagerGivesUpAfterMaxAttempts(t *testing.T) {
+	m, spawned := newSupervisedManager(t, &config.LocalModelConfig{
+		RestartMaxAttempts: 2,
+		RestartBackoff:     time.Millisecond,
+		RestartMaxBackoff:  time.Second,
+	}, "exit 1")
+
+	require.NoError(t, m.Start(context.Background()))
+	require.Eventually(t, func() bool { return m.Status().GaveUp }, 5*time.Second, 10*time.Millisecond)
+
+	status := m.Status()
+	assert.False(t, status.Running)
+	assert.Equal(t, 2, status.Restarts)
+	assert.Equal(t, lifecycle.StateDegraded, status.State)
+	assert.Equal(t, int32(3), spawned.Load())
+}
+
+func TestCloseStopsGracefullyBeforeKilling(t *testing.T) {
+	cfg := &config.LocalModelConfig{StopGracePeriod: 5 * time.Second, RestartMaxAttempts: 3, RestartBackoff: time.Millisecond}
+	// Exits on SIGTERM at the next loop iteration
+	m, _ := newSupervisedManager(t, cfg, `trap "exit 0" TERM; while true; do sleep 0.05; done`)
+	require.NoError(t, m.Start(context.Background()))
+
+	start := time.Now()
+	require.NoError(t, m.Close())
+	assert.Less(t, time.Since(start), 2*time.Second, "a server handling SIGTERM is not waited on for the whole grace period")
+	assert.False(t, m.Status().Running)
+
+	cfg = &config.LocalModelConfig{StopGracePeriod: 200 * time.Millisecond}
+	m, _ = newSupervisedManager(t, cfg, `trap "" TERM; while true; do sleep 0.05; done`)
+	require.NoError(t, m.Start(context.Background()))
+	// Give the shell time to install its trap
+	time.Sleep(100 * time.Millisecond)
+
+	start = time.Now()
+	require.NoError(t, m.Close())
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "a server ignoring SIGTERM is killed after the grace period")
+	assert.False(t, m.Status().Running)
+}
+
+func TestRestartBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, restartBackoff(time.Second, time.Minute, 1))
+	assert.Equal(t, 4*time.Second, restartBackoff(time.Second, time.Minute, 3))
+	assert.Equal(t, time.Minute, restartBackoff(time.Second, time.Minute, 20))
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
 	"io"
 	"net/http"
 	"os"
@@ -262,7 +263,7 @@ func (mm *ModelManager) GetModelStatus(modelID string) (string, error) {
 
 	// Check if the model is currently running by making a request to the health endpoint
 	// This assumes the server is running on localhost:5000
-	resp, err := http.Get("http://localhost:5000/health")
+	resp, err := httpclient.Default().Get(context.Background(), "http://localhost:5000/health")
 	if err == nil && resp.StatusCode == http.StatusOK {
 		resp.Body.Close()
 		return "running", nil
@@ -304,7 +305,7 @@ func (mm *ModelManager) StartModel(ctx context.Context, modelID string, modelTyp
 
 	// Wait for the server to start
 	for i := 0; i < 10; i++ {
-		resp, err := http.Get("http://localhost:5000/health")
+		resp, err := httpclient.Default().Get(context.Background(), "http://localhost:5000/health")
 		if err == nil && resp.StatusCode == http.StatusOK {
 			resp.Body.Close()
 			return nil
@@ -352,7 +353,7 @@ func (mm *ModelManager) UpdateModelSettings(modelID string, maxTokens int, tempe
 
 // GetServerHealth checks if the server is running
 func (mm *ModelManager) GetServerHealth() (bool, error) {
-	resp, err := http.Get("http://localhost:5000/health")
+	resp, err := httpclient.Default().Get(context.Background(), "http://localhost:5000/health")
 	if err != nil {
 		return false, nil
 	}
@@ -367,7 +368,7 @@ func (mm *ModelManager) GetServerHealth() (bool, error) {
 
 // GetServerModels gets the models available from the server
 func (mm *ModelManager) GetServerModels() (map[string]interface{}, error) {
-	resp, err := http.Get("http://localhost:5000/v1/models")
+	resp, err := httpclient.Default().Get(context.Background(), "http://localhost:5000/v1/models")
 	if err != nil {
 		return nil, err
 	}
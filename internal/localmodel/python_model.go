@@ -4,26 +4,61 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/lifecycle"
+	"go-aigateway/internal/security"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracer creates the spans of calls to the local model server
+var tracer = otel.Tracer("go-aigateway/localmodel")
+
 // PythonModelServer handles interactions with a local Python model server
 type PythonModelServer struct {
 	config        *config.LocalModelConfig
+	lifecycle     lifecycle.Guard
 	serverProcess *os.Process
-	serverRunning bool
 	mu            sync.Mutex
 	httpClient    *http.Client
+
+	// launch prepares and spawns the server process and reports whether it
+	// passed its health check; replaced in tests
+	launch func(ctx context.Context, selection *SizeSelection) (process *os.Process, healthy bool, err error)
+
+	probe       HardwareProbe
+	alerts      AlertSink
+	selection   atomic.Pointer[SizeSelection]
+	stopMonitor context.CancelFunc
+
+	// exited is closed once the current process has been reaped, with its
+	// outcome in lastExit; stopping is set by Close so exits are not restarted
+	exited   chan struct{}
+	lastExit ProcessExit
+	stopping bool
+}
+
+// ProcessExit describes how a server process ended
+type ProcessExit struct {
+	PID      int    `json:"pid"`
+	ExitCode int    `json:"exit_code"` // -1 when killed by a signal
+	Error    string `json:"error,omitempty"`
 }
 
 // ChatMessage represents a message in a chat conversation
@@ -87,8 +122,9 @@ type CompletionResponse struct {
 
 // EmbeddingRequest represents a request to the embeddings API
 type EmbeddingRequest struct {
-	Model string   `json:"model"`
-	Input []string `json:"input"`
+	Model          string   `json:"model"`
+	Input          []string `json:"input"`
+	EncodingFormat string   `json:"encoding_format,omitempty"`
 }
 
 // EmbeddingResponse represents a response from the embeddings API
@@ -122,47 +158,190 @@ type ModelsResponse struct {
 
 // NewPythonModelServer creates a new instance of the Python model server
 func NewPythonModelServer(cfg *config.LocalModelConfig) *PythonModelServer {
-	return &PythonModelServer{
+	pms := &PythonModelServer{
 		config: cfg,
 		httpClient: &http.Client{
 			Timeout: cfg.Timeout,
 		},
+		probe: NewSystemProbe(),
 	}
+	// The local server is not subject to the egress policy; only the mTLS transport applies
+	if transport := security.UpstreamTransport(); transport != nil {
+		pms.httpClient.Transport = transport
+	}
+	pms.launch = pms.launchProcess
+	return pms
 }
 
-// Start launches the Python model server
-func (pms *PythonModelServer) Start(ctx context.Context) error {
+// SetAlertSink sends memory pressure alerts of the running server to sink
+func (pms *PythonModelServer) SetAlertSink(sink AlertSink) {
 	pms.mu.Lock()
 	defer pms.mu.Unlock()
+	pms.alerts = sink
+}
+
+// SizeSelection returns the requested and effective model size of the last start, nil before any
+func (pms *PythonModelServer) SizeSelection() *SizeSelection {
+	return pms.selection.Load()
+}
+
+// Start launches the Python model server. Concurrent and repeated calls spawn
+// a single process; a server that does not pass its health check stays up as degraded.
+func (pms *PythonModelServer) Start(ctx context.Context) error {
+	healthy := true
+	err := pms.lifecycle.Start(func() error {
+		// Make sure the model fits before spending minutes on loading it
+		selection, err := pms.selectModelSize(ctx)
+		if err != nil {
+			return fmt.Errorf("local model does not fit the hardware: %w", err)
+		}
+		pms.selection.Store(selection)
 
-	if pms.serverRunning {
+		process, ok, err := pms.launch(ctx, selection)
+		if err != nil {
+			return err
+		}
+		healthy = ok
+
+		pms.mu.Lock()
+		pms.adopt(process)
+		pms.mu.Unlock()
 		return nil
+	})
+	if err == nil && !healthy {
+		// The process is up and may still be loading the model; keep it rather
+		// than spawn a second one on the next Start
+		pms.lifecycle.SetDegraded(true)
+	}
+	return err
+}
+
+// State reports the lifecycle state of the server
+func (pms *PythonModelServer) State() lifecycle.State {
+	return pms.lifecycle.State()
+}
+
+// adopt makes process the running server: it is reaped in the background,
+// which is the only Wait on it, and its resources are monitored. Callers hold pms.mu.
+func (pms *PythonModelServer) adopt(process *os.Process) {
+	exited := make(chan struct{})
+	pms.serverProcess = process
+	pms.exited = exited
+	go func() {
+		state, err := process.Wait()
+		exit := ProcessExit{PID: process.Pid, ExitCode: -1}
+		if state != nil {
+			exit.ExitCode = state.ExitCode()
+		}
+		if err != nil {
+			exit.Error = err.Error()
+		} else if state != nil && !state.Success() {
+			exit.Error = state.String()
+		}
+		pms.mu.Lock()
+		pms.lastExit = exit
+		pms.mu.Unlock()
+		close(exited)
+	}()
+
+	if pms.stopMonitor != nil {
+		pms.stopMonitor()
+		pms.stopMonitor = nil
+	}
+	if pms.config.MonitorInterval > 0 {
+		monitorCtx, cancel := context.WithCancel(context.Background())
+		pms.stopMonitor = cancel
+		go pms.monitorResources(monitorCtx, process.Pid, pms.config.MonitorInterval)
+	}
+}
+
+// Running reports the PID of the live server process
+func (pms *PythonModelServer) Running() (pid int, running bool) {
+	pms.mu.Lock()
+	defer pms.mu.Unlock()
+	if pms.serverProcess == nil {
+		return 0, false
+	}
+	select {
+	case <-pms.exited:
+		return 0, false
+	default:
+		return pms.serverProcess.Pid, true
+	}
+}
+
+// awaitExit blocks until the current process exits and returns how it ended.
+// ok is false when ctx ends first, no process was started, or the server is
+// being stopped, so the exit is not to be restarted.
+func (pms *PythonModelServer) awaitExit(ctx context.Context) (exit ProcessExit, ok bool) {
+	pms.mu.Lock()
+	exited := pms.exited
+	pms.mu.Unlock()
+	if exited == nil {
+		return ProcessExit{}, false
+	}
+
+	select {
+	case <-ctx.Done():
+		return ProcessExit{}, false
+	case <-exited:
+	}
+	pms.mu.Lock()
+	defer pms.mu.Unlock()
+	return pms.lastExit, !pms.stopping
+}
+
+// restart launches a new process after the previous one exited
+func (pms *PythonModelServer) restart(ctx context.Context) error {
+	selection := pms.selection.Load()
+	if selection == nil {
+		return fmt.Errorf("local model server was never started")
+	}
+	process, healthy, err := pms.launch(ctx, selection)
+	if err != nil {
+		return err
+	}
+
+	pms.mu.Lock()
+	if pms.stopping {
+		pms.mu.Unlock()
+		// Close won the race; do not leave the new process behind
+		process.Kill()
+		process.Wait()
+		return lifecycle.ErrClosed
 	}
+	pms.adopt(process)
+	pms.mu.Unlock()
+	pms.lifecycle.SetDegraded(!healthy)
+	return nil
+}
 
+// launchProcess installs dependencies, spawns the server and waits for its health check
+func (pms *PythonModelServer) launchProcess(ctx context.Context, selection *SizeSelection) (*os.Process, bool, error) {
 	// Ensure model directory exists
 	if err := os.MkdirAll(pms.config.ModelPath, 0755); err != nil {
-		return fmt.Errorf("failed to create model directory: %w", err)
+		return nil, false, fmt.Errorf("failed to create model directory: %w", err)
 	}
 
 	// Create Python server script
 	scriptPath := filepath.Join(pms.config.ModelPath, "server.py")
 	if err := pms.createServerScript(scriptPath); err != nil {
-		return fmt.Errorf("failed to create server script: %w", err)
+		return nil, false, fmt.Errorf("failed to create server script: %w", err)
 	}
 
 	// Create requirements.txt
 	requirementsPath := filepath.Join(pms.config.ModelPath, "requirements.txt")
 	if err := pms.createRequirementsFile(requirementsPath); err != nil {
-		return fmt.Errorf("failed to create requirements file: %w", err)
+		return nil, false, fmt.Errorf("failed to create requirements file: %w", err)
 	}
 
 	// Install requirements
 	logrus.Info("Installing Python dependencies...")
-	cmd := exec.Command(pms.config.PythonPath, "-m", "pip", "install", "-r", requirementsPath)
+	cmd := exec.CommandContext(ctx, pms.config.PythonPath, "-m", "pip", "install", "-r", requirementsPath)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to install Python dependencies: %w", err)
+		return nil, false, fmt.Errorf("failed to install Python dependencies: %w", err)
 	}
 	// Start the Python server
 	logrus.WithFields(logrus.Fields{
@@ -177,7 +356,11 @@ func (pms *PythonModelServer) Start(ctx context.Context) error {
 		"--host", pms.config.ServerHost,
 		"--port", fmt.Sprintf("%d", pms.config.ServerPort),
 		"--model-type", pms.config.ModelType,
-		"--model-size", pms.config.ModelSize,
+		"--model-size", selection.Effective,
+		"--checkpoint-dir", filepath.Join(pms.config.ModelPath, "checkpoints"),
+	}
+	if selection.MaxBatchTokens > 0 {
+		cmdArgs = append(cmdArgs, "--max-batch-tokens", fmt.Sprintf("%d", selection.MaxBatchTokens))
 	}
 
 	// Add third-party flag if enabled
@@ -185,6 +368,7 @@ func (pms *PythonModelServer) Start(ctx context.Context) error {
 		cmdArgs = append(cmdArgs, "--use-third-party")
 	}
 
+	// The server outlives the start request, so it is not bound to ctx
 	cmd = exec.Command(pms.config.PythonPath, cmdArgs...)
 
 	// Set environment variables for third-party configuration
@@ -198,12 +382,9 @@ func (pms *PythonModelServer) Start(ctx context.Context) error {
 	cmd.Stderr = os.Stderr
 
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start Python server: %w", err)
+		return nil, false, fmt.Errorf("failed to start Python server: %w", err)
 	}
 
-	pms.serverProcess = cmd.Process
-	pms.serverRunning = true
-
 	// Wait for server to start
 	time.Sleep(2 * time.Second)
 
@@ -214,7 +395,7 @@ func (pms *PythonModelServer) Start(ctx context.Context) error {
 		if err == nil && resp.StatusCode == http.StatusOK {
 			logrus.Info("Python model server started successfully")
 			resp.Body.Close()
-			return nil
+			return cmd.Process, true, nil
 		}
 		if resp != nil {
 			resp.Body.Close()
@@ -222,29 +403,57 @@ func (pms *PythonModelServer) Start(ctx context.Context) error {
 		time.Sleep(1 * time.Second)
 	}
 
-	return fmt.Errorf("failed to connect to Python server")
+	logrus.Warn("Python model server did not pass its health check")
+	return cmd.Process, false, nil
 }
 
-// Stop stops the Python model server
-func (pms *PythonModelServer) Stop() error {
-	pms.mu.Lock()
-	defer pms.mu.Unlock()
+// Close stops the Python model server; it cannot be started again. The
+// process gets SIGTERM and StopGracePeriod to exit before it is killed.
+func (pms *PythonModelServer) Close() error {
+	return pms.lifecycle.Close(func() error {
+		pms.mu.Lock()
+		pms.stopping = true
+		process, exited := pms.serverProcess, pms.exited
+		if pms.stopMonitor != nil {
+			pms.stopMonitor()
+			pms.stopMonitor = nil
+		}
+		pms.mu.Unlock()
+		if process == nil {
+			return nil
+		}
 
-	if !pms.serverRunning {
+		select {
+		case <-exited:
+			return nil
+		default:
+		}
+		logrus.Info("Stopping Python model server...")
+		if err := process.Signal(syscall.SIGTERM); err == nil && pms.config.StopGracePeriod > 0 {
+			select {
+			case <-exited:
+				return nil
+			case <-time.After(pms.config.StopGracePeriod):
+				logrus.WithField("grace_period", pms.config.StopGracePeriod).Warn("Python model server did not exit in time, killing it")
+			}
+		}
+		if err := process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			return fmt.Errorf("failed to stop Python server: %w", err)
+		}
+		// The reaper collects the process so it does not linger as a zombie
+		<-exited
 		return nil
-	}
-
-	logrus.Info("Stopping Python model server...")
-	if err := pms.serverProcess.Kill(); err != nil {
-		return fmt.Errorf("failed to stop Python server: %w", err)
-	}
-
-	pms.serverRunning = false
-	return nil
+	})
 }
 
 // ChatCompletion sends a request to the chat completions API
 func (pms *PythonModelServer) ChatCompletion(ctx context.Context, request *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	ctx, span := tracer.Start(ctx, "PythonModelServer.ChatCompletion",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("ai.model", request.Model), attribute.String("ai.provider", "local")),
+	)
+	defer span.End()
+
 	if request.MaxTokens == 0 {
 		request.MaxTokens = pms.config.MaxTokens
 	}
@@ -255,13 +464,23 @@ func (pms *PythonModelServer) ChatCompletion(ctx context.Context, request *ChatC
 	serverURL := fmt.Sprintf("http://%s:%d/v1/chat/completions", pms.config.ServerHost, pms.config.ServerPort)
 	result, err := pms.retryRequest(ctx, serverURL, request, &ChatCompletionResponse{})
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
-	return result.(*ChatCompletionResponse), nil
+	resp := result.(*ChatCompletionResponse)
+	setUsageAttributes(span, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
+	return resp, nil
 }
 
 // Completion sends a request to the completions API
 func (pms *PythonModelServer) Completion(ctx context.Context, request *CompletionRequest) (*CompletionResponse, error) {
+	ctx, span := tracer.Start(ctx, "PythonModelServer.Completion",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("ai.model", request.Model), attribute.String("ai.provider", "local")),
+	)
+	defer span.End()
+
 	if request.MaxTokens == 0 {
 		request.MaxTokens = pms.config.MaxTokens
 	}
@@ -272,9 +491,13 @@ func (pms *PythonModelServer) Completion(ctx context.Context, request *Completio
 	serverURL := fmt.Sprintf("http://%s:%d/v1/completions", pms.config.ServerHost, pms.config.ServerPort)
 	result, err := pms.retryRequest(ctx, serverURL, request, &CompletionResponse{})
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return nil, err
 	}
-	return result.(*CompletionResponse), nil
+	resp := result.(*CompletionResponse)
+	setUsageAttributes(span, resp.Usage.PromptTokens, resp.Usage.CompletionTokens, resp.Usage.TotalTokens)
+	return resp, nil
 }
 
 // Embedding sends a request to the embeddings API
@@ -297,14 +520,33 @@ func (pms *PythonModelServer) Models(ctx context.Context) (*ModelsResponse, erro
 	return result.(*ModelsResponse), nil
 }
 
-// retryRequest retries a request to the server with backoff
-func (pms *PythonModelServer) retryRequest(ctx context.Context, url string, requestBody interface{}, responseBody interface{}) (interface{}, error) {
+// retryRequest retries a request to the server with backoff. All attempts
+// share one span, whose context is sent to the server.
+func (pms *PythonModelServer) retryRequest(ctx context.Context, url string, requestBody interface{}, responseBody interface{}) (_ interface{}, err error) {
+	ctx, span := tracer.Start(ctx, "PythonModelServer.retryRequest",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.url", url)),
+	)
 	var (
-		resp *http.Response
-		err  error
+		resp     *http.Response
+		attempts int
 	)
+	defer func() {
+		if span.IsRecording() {
+			span.SetAttributes(attribute.Int("retry.attempts", attempts))
+			if resp != nil {
+				span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+			}
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+		}
+		span.End()
+	}()
 
 	for attempt := 0; attempt < pms.config.RetryAttempts; attempt++ {
+		attempts = attempt + 1
 		if attempt > 0 {
 			logrus.WithFields(logrus.Fields{
 				"attempt": attempt + 1,
@@ -335,6 +577,7 @@ func (pms *PythonModelServer) retryRequest(ctx context.Context, url string, requ
 		}
 
 		req.Header.Set("Content-Type", "application/json")
+		httpclient.InjectTraceContext(ctx, req.Header)
 
 		// Send request
 		resp, err = pms.httpClient.Do(req)
@@ -386,6 +629,7 @@ import argparse
 import json
 import time
 import logging
+import re
 from typing import List, Dict, Any, Optional
 import os
 import sys
@@ -406,6 +650,11 @@ tokenizer = None
 embedding_model = None
 model_type = "chat"
 model_size = "small"
+# Generation-time memory guard computed by the gateway: prompt plus new tokens per request, 0 disables it
+max_batch_tokens = 0
+# Directory holding checkpoints of interruptible generations
+checkpoint_dir = "checkpoints"
+CHECKPOINT_ID_PATTERN = re.compile(r'^[A-Za-z0-9_-]{1,64}$')
 
 # Model selection based on size
 MODEL_MAP = {
@@ -426,6 +675,41 @@ MODEL_MAP = {
     }
 }
 
+def guard_max_tokens(prompt_tokens, max_tokens):
+    """Clamps max_tokens to the memory guard; returns None when the prompt alone exceeds it"""
+    if max_batch_tokens <= 0:
+        return max_tokens
+    if prompt_tokens >= max_batch_tokens:
+        return None
+    return min(max_tokens, max_batch_tokens - prompt_tokens)
+
+def format_chat_prompt(messages):
+    prompt = ""
+    for msg in messages:
+        role = msg['role']
+        content = msg['content']
+        if role == 'system':
+            prompt += f"<|system|>\n{content}\n"
+        elif role == 'user':
+            prompt += f"<|user|>\n{content}\n"
+        elif role == 'assistant':
+            prompt += f"<|assistant|>\n{content}\n"
+    return prompt + "<|assistant|>\n"
+
+def load_checkpoint(checkpoint_id):
+    path = os.path.join(checkpoint_dir, f"{checkpoint_id}.json")
+    if not os.path.exists(path):
+        return None
+    with open(path) as f:
+        return json.load(f)
+
+def save_checkpoint(checkpoint_id, state):
+    # Write and rename so an interrupted save never leaves a torn checkpoint
+    path = os.path.join(checkpoint_dir, f"{checkpoint_id}.json")
+    with open(path + ".tmp", "w") as f:
+        json.dump(state, f)
+    os.replace(path + ".tmp", path)
+
 def initialize_model():
     global model, tokenizer, embedding_model, model_type, model_size
     
@@ -465,21 +749,14 @@ def chat_completions():
         logger.info(f"Chat completion request with {len(messages)} messages")
         
         # Format the conversation for the model
-        prompt = ""
-        for msg in messages:
-            role = msg['role']
-            content = msg['content']
-            if role == 'system':
-                prompt += f"<|system|>\n{content}\n"
-            elif role == 'user':
-                prompt += f"<|user|>\n{content}\n"
-            elif role == 'assistant':
-                prompt += f"<|assistant|>\n{content}\n"
-        
-        prompt += "<|assistant|>\n"
+        prompt = format_chat_prompt(messages)
         
         inputs = tokenizer(prompt, return_tensors="pt").to(model.device)
         
+        max_tokens = guard_max_tokens(inputs["input_ids"].shape[1], max_tokens)
+        if max_tokens is None:
+            return jsonify({"error": f"prompt exceeds the memory guard of {max_batch_tokens} tokens"}), 413
+        
         # Generate response
         outputs = model.generate(
             inputs["input_ids"],
@@ -520,6 +797,85 @@ def chat_completions():
         logger.error(f"Error in chat completions: {str(e)}")
         return jsonify({"error": str(e)}), 500
 
+@app.route('/v1/checkpoint', methods=['POST'])
+def checkpoint_generation():
+    """Generates a chat completion in chunks of checkpoint_every tokens, saving the
+    tokens after each chunk; with resume set, generation continues from the saved tokens"""
+    try:
+        data = request.json
+        checkpoint_id = data.get('checkpoint_id', '')
+        if not CHECKPOINT_ID_PATTERN.match(checkpoint_id):
+            return jsonify({"error": "invalid checkpoint_id"}), 400
+        messages = data.get('messages', [])
+        max_tokens = data.get('max_tokens', 1024)
+        temperature = data.get('temperature', 0.7)
+        every = max(1, int(data.get('checkpoint_every', 64)))
+        model_name = data.get('model', MODEL_MAP[model_size][model_type])
+        
+        state = load_checkpoint(checkpoint_id) if data.get('resume') else None
+        if state is None:
+            prompt_ids = tokenizer(format_chat_prompt(messages), return_tensors="pt")["input_ids"][0].tolist()
+            state = {"prompt_tokens": len(prompt_ids), "token_ids": prompt_ids, "done": False}
+        resumed_from = len(state["token_ids"]) - state["prompt_tokens"]
+        logger.info(f"Checkpointed generation {checkpoint_id} starting at token {resumed_from}")
+        
+        max_tokens = guard_max_tokens(state["prompt_tokens"], max_tokens)
+        if max_tokens is None:
+            return jsonify({"error": f"prompt exceeds the memory guard of {max_batch_tokens} tokens"}), 413
+        
+        while not state["done"]:
+            remaining = max_tokens - (len(state["token_ids"]) - state["prompt_tokens"])
+            if remaining > 0:
+                input_ids = torch.tensor([state["token_ids"]], device=model.device)
+                outputs = model.generate(
+                    input_ids,
+                    max_new_tokens=min(every, remaining),
+                    temperature=temperature,
+                    do_sample=temperature > 0,
+                )
+                new_ids = outputs[0][input_ids.shape[1]:].tolist()
+                state["token_ids"].extend(new_ids)
+                remaining -= len(new_ids)
+            else:
+                new_ids = []
+            if remaining <= 0 or not new_ids or tokenizer.eos_token_id in new_ids:
+                state["done"] = True
+            save_checkpoint(checkpoint_id, state)
+        
+        completion_ids = state["token_ids"][state["prompt_tokens"]:]
+        response_text = tokenizer.decode(completion_ids, skip_special_tokens=True)
+        
+        response = {
+            "id": f"chatcmpl-{checkpoint_id}",
+            "object": "chat.completion",
+            "created": int(time.time()),
+            "model": model_name,
+            "system_fingerprint": "local-python-model",
+            "checkpoint_id": checkpoint_id,
+            "resumed_from_tokens": resumed_from,
+            "choices": [
+                {
+                    "index": 0,
+                    "message": {
+                        "role": "assistant",
+                        "content": response_text.strip()
+                    },
+                    "finish_reason": "stop"
+                }
+            ],
+            "usage": {
+                "prompt_tokens": state["prompt_tokens"],
+                "completion_tokens": len(completion_ids),
+                "total_tokens": len(state["token_ids"])
+            }
+        }
+        
+        return jsonify(response)
+    
+    except Exception as e:
+        logger.error(f"Error in checkpointed generation: {str(e)}")
+        return jsonify({"error": str(e)}), 500
+
 @app.route('/v1/completions', methods=['POST'])
 def completions():
     try:
@@ -533,6 +889,10 @@ def completions():
         
         inputs = tokenizer(prompt, return_tensors="pt").to(model.device)
         
+        max_tokens = guard_max_tokens(inputs["input_ids"].shape[1], max_tokens)
+        if max_tokens is None:
+            return jsonify({"error": f"prompt exceeds the memory guard of {max_batch_tokens} tokens"}), 413
+        
         # Generate response
         outputs = model.generate(
             inputs["input_ids"],
@@ -665,11 +1025,16 @@ if __name__ == '__main__':
     parser.add_argument('--port', type=int, default=5000, help='Port to bind the server to')
     parser.add_argument('--model-type', type=str, default='chat', choices=['chat', 'completion', 'embedding'], help='Type of model to use')
     parser.add_argument('--model-size', type=str, default='small', choices=['small', 'medium', 'large'], help='Size of model to use')
+    parser.add_argument('--max-batch-tokens', type=int, default=0, help='Maximum prompt plus generated tokens per request')
+    parser.add_argument('--checkpoint-dir', type=str, default='checkpoints', help='Directory for generation checkpoints')
     
     args = parser.parse_args()
     
     model_type = args.model_type
     model_size = args.model_size
+    max_batch_tokens = args.max_batch_tokens
+    checkpoint_dir = args.checkpoint_dir
+    os.makedirs(checkpoint_dir, exist_ok=True)
     
     logger.info(f"Starting server with model type: {model_type}, size: {model_size}")
     initialize_model()
@@ -690,3 +1055,12 @@ accelerate==0.25.0
 `
 	return os.WriteFile(requirementsPath, []byte(requirements), 0644)
 }
+
+// setUsageAttributes records the token usage of a local model response
+func setUsageAttributes(span trace.Span, promptTokens, completionTokens, totalTokens int) {
+	span.SetAttributes(
+		attribute.Int("ai.usage.prompt_tokens", promptTokens),
+		attribute.Int("ai.usage.completion_tokens", completionTokens),
+		attribute.Int("ai.usage.total_tokens", totalTokens),
+	)
+}
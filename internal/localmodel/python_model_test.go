@@ -0,0 +1,156 @@
+package localmodel
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/lifecycle"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// newTestServer replaces the Python launch with a sleeping process and counts spawns
+func newTestServer(t *testing.T, healthy bool) (*PythonModelServer, *atomic.Int32) {
+	pms := NewPythonModelServer(&config.LocalModelConfig{ModelSize: "small"})
+	pms.probe = fakeProbe("", "", "")
+	spawned := &atomic.Int32{}
+	pms.launch = func(context.Context, *SizeSelection) (*os.Process, bool, error) {
+		spawned.Add(1)
+		// Widen the window for concurrent starts
+		time.Sleep(20 * time.Millisecond)
+		cmd := exec.Command("sleep", "60")
+		if err := cmd.Start(); err != nil {
+			return nil, false, err
+		}
+		return cmd.Process, healthy, nil
+	}
+	t.Cleanup(func() { pms.Close() })
+	return pms, spawned
+}
+
+func TestPythonModelServerSpawnsOnce(t *testing.T) {
+	pms, spawned := newTestServer(t, true)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, pms.Start(context.Background()))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), spawned.Load())
+	assert.Equal(t, lifecycle.StateRunning, pms.State())
+	require.NotNil(t, pms.SizeSelection())
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, pms.Close())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, lifecycle.StateClosed, pms.State())
+	assert.ErrorIs(t, pms.Start(context.Background()), lifecycle.ErrClosed)
+	assert.Equal(t, int32(1), spawned.Load())
+}
+
+func TestPythonModelServerUnhealthyIsDegraded(t *testing.T) {
+	pms, spawned := newTestServer(t, false)
+
+	require.NoError(t, pms.Start(context.Background()))
+	assert.Equal(t, lifecycle.StateDegraded, pms.State())
+	// A degraded server is not spawned a second time
+	require.NoError(t, pms.Start(context.Background()))
+	assert.Equal(t, int32(1), spawned.Load())
+}
+
+func TestPythonModelServerCloseBeforeStart(t *testing.T) {
+	pms, spawned := newTestServer(t, true)
+
+	require.NoError(t, pms.Close())
+	assert.ErrorIs(t, pms.Start(context.Background()), lifecycle.ErrClosed)
+	assert.Zero(t, spawned.Load())
+}
+
+func TestPythonModelServerChatCompletionSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := tracer
+	tracer = provider.Tracer("test")
+	t.Cleanup(func() { tracer = previous })
+
+	var calls atomic.Int32
+	var traceParent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt fails and is retried
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		traceParent = r.Header.Get("traceparent")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"model": "qwen-local",
+			"usage": map[string]int{"prompt_tokens": 5, "completion_tokens": 7, "total_tokens": 12},
+		})
+	}))
+	defer server.Close()
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	require.NoError(t, err)
+	serverPort, _ := strconv.Atoi(port)
+
+	pms := NewPythonModelServer(&config.LocalModelConfig{
+		ServerHost:    host,
+		ServerPort:    serverPort,
+		RetryAttempts: 2,
+		Timeout:       time.Second,
+		MaxTokens:     16,
+	})
+	resp, err := pms.ChatCompletion(context.Background(), &ChatCompletionRequest{Model: "qwen-local"})
+	require.NoError(t, err)
+	assert.Equal(t, 12, resp.Usage.TotalTokens)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	retry, chat := spans[0], spans[1]
+	assert.Equal(t, "PythonModelServer.retryRequest", retry.Name())
+	assert.Equal(t, "PythonModelServer.ChatCompletion", chat.Name())
+	assert.Equal(t, chat.SpanContext().SpanID(), retry.Parent().SpanID())
+
+	retryAttrs := attributeMap(retry.Attributes())
+	assert.Equal(t, int64(2), retryAttrs["retry.attempts"].AsInt64())
+	assert.Equal(t, int64(http.StatusOK), retryAttrs["http.status_code"].AsInt64())
+	assert.Contains(t, traceParent, retry.SpanContext().SpanID().String(), "the server sees the retry span as its parent")
+
+	chatAttrs := attributeMap(chat.Attributes())
+	assert.Equal(t, "qwen-local", chatAttrs["ai.model"].AsString())
+	assert.Equal(t, "local", chatAttrs["ai.provider"].AsString())
+	assert.Equal(t, int64(5), chatAttrs["ai.usage.prompt_tokens"].AsInt64())
+	assert.Equal(t, int64(7), chatAttrs["ai.usage.completion_tokens"].AsInt64())
+	assert.Equal(t, int64(12), chatAttrs["ai.usage.total_tokens"].AsInt64())
+}
+
+func attributeMap(kvs []attribute.KeyValue) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value, len(kvs))
+	for _, kv := range kvs {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
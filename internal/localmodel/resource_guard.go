@@ -0,0 +1,117 @@
+package localmodel
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-aigateway/internal/monitoring"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AlertSink 接收本地模型内存压力告警，*monitoring.MonitoringSystem 实现了该接口
+type AlertSink interface {
+	EvaluateRule(ctx context.Context, rule *monitoring.Rule, value float64, firing bool)
+}
+
+// Memory pressure rules evaluated by the resource monitor
+var (
+	localModelRAMRule = &monitoring.Rule{
+		ID:          "local_model_ram_pressure",
+		Name:        "Local model RAM pressure",
+		Description: "Local model server resident memory as a share of total RAM",
+		MetricKey:   "local_model_ram_usage",
+		Operator:    ">",
+		Level:       monitoring.AlertLevelWarning,
+		Enabled:     true,
+	}
+	localModelGPURule = &monitoring.Rule{
+		ID:          "local_model_gpu_pressure",
+		Name:        "Local model GPU memory pressure",
+		Description: "GPU memory in use as a share of total GPU memory",
+		MetricKey:   "local_model_gpu_usage",
+		Operator:    ">",
+		Level:       monitoring.AlertLevelWarning,
+		Enabled:     true,
+	}
+)
+
+// selectModelSize probes the hardware and picks the model size to start. When
+// the hardware cannot be probed the requested size is used unguarded, unless strict.
+func (pms *PythonModelServer) selectModelSize(ctx context.Context) (*SizeSelection, error) {
+	requested := pms.config.ModelSize
+	hw, err := pms.probe.Probe(ctx)
+	if err != nil {
+		if pms.config.StrictHardware {
+			return nil, fmt.Errorf("hardware probe failed: %w", err)
+		}
+		logrus.WithError(err).Warn("Hardware probe failed, starting the local model without a memory guard")
+		return &SizeSelection{Requested: requested, Effective: requested}, nil
+	}
+
+	selection, err := SelectModelSize(requested, hw, pms.config.StrictHardware)
+	if err != nil {
+		return nil, err
+	}
+	if selection.Downgraded {
+		logrus.WithFields(logrus.Fields{
+			"requested_size": selection.Requested,
+			"effective_size": selection.Effective,
+			"device":         selection.Device,
+			"gpu_free_mb":    hw.GPUFreeMB,
+			"ram_free_mb":    hw.RAMAvailableMB,
+		}).Warn("!!! Not enough memory for the requested local model size, DOWNGRADED to the largest size that fits !!!")
+	}
+	return selection, nil
+}
+
+// checkResources samples the model server's memory once and fires or resolves
+// the pressure alerts
+func (pms *PythonModelServer) checkResources(ctx context.Context, pid int) (ResourceUsage, error) {
+	usage, err := pms.probe.Usage(ctx, pid)
+	if err != nil {
+		return usage, err
+	}
+
+	threshold := pms.config.MemoryAlertThreshold
+	check := func(rule *monitoring.Rule, used, total int64) {
+		if total <= 0 {
+			return
+		}
+		ratio := float64(used) / float64(total)
+		firing := ratio > threshold
+		if firing {
+			logrus.WithFields(logrus.Fields{
+				"rule":      rule.ID,
+				"usage":     ratio,
+				"threshold": threshold,
+			}).Warn("Local model server is close to running out of memory")
+		}
+		if pms.alerts != nil {
+			r := *rule
+			r.Threshold = threshold
+			pms.alerts.EvaluateRule(ctx, &r, ratio, firing)
+		}
+	}
+	check(localModelRAMRule, usage.RSSMB, usage.RAMTotalMB)
+	check(localModelGPURule, usage.GPUUsedMB, usage.GPUTotalMB)
+	return usage, nil
+}
+
+// monitorResources samples the model server's memory periodically until ctx is cancelled
+func (pms *PythonModelServer) monitorResources(ctx context.Context, pid int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := pms.checkResources(ctx, pid); err != nil {
+				logrus.WithError(err).Debug("Failed to sample local model resource usage")
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultLevelDuration applies when a temporary level change names no duration
+	DefaultLevelDuration = 15 * time.Minute
+	// MaxLevelDuration bounds how long a temporary level may stay in force
+	MaxLevelDuration = 24 * time.Hour
+)
+
+// LevelStatus 当前日志级别及临时调整的恢复时间
+type LevelStatus struct {
+	Level     string     `json:"level"`
+	BaseLevel string     `json:"base_level"`
+	RevertAt  *time.Time `json:"revert_at,omitempty"`
+}
+
+// LevelController 运行时临时调整日志级别，到期后自动恢复为启动时配置的级别
+type LevelController struct {
+	logger *logrus.Logger
+
+	mu       sync.Mutex
+	base     logrus.Level
+	timer    *time.Timer
+	revertAt time.Time
+}
+
+// NewLevelController controls logger, reverting to its current level
+func NewLevelController(logger *logrus.Logger) *LevelController {
+	return &LevelController{logger: logger, base: logger.GetLevel()}
+}
+
+// Set switches to level for d, then reverts to the base level.
+// A zero duration uses DefaultLevelDuration.
+func (lc *LevelController) Set(level string, d time.Duration) (LevelStatus, error) {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return LevelStatus{}, fmt.Errorf("unknown log level %q", level)
+	}
+	if d == 0 {
+		d = DefaultLevelDuration
+	}
+	if d < 0 || d > MaxLevelDuration {
+		return LevelStatus{}, fmt.Errorf("duration must be between 0 and %s", MaxLevelDuration)
+	}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if lc.timer != nil {
+		lc.timer.Stop()
+	}
+	lc.logger.SetLevel(parsed)
+	lc.revertAt = time.Now().Add(d)
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		lc.mu.Lock()
+		defer lc.mu.Unlock()
+		// A later Set replaced this timer; leave its level alone
+		if lc.timer != timer {
+			return
+		}
+		lc.resetLocked()
+		logrus.WithField("level", lc.base.String()).Info("Temporary log level expired")
+	})
+	lc.timer = timer
+	return lc.statusLocked(), nil
+}
+
+// Reset reverts to the base level immediately
+func (lc *LevelController) Reset() LevelStatus {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	if lc.timer != nil {
+		lc.timer.Stop()
+	}
+	lc.resetLocked()
+	return lc.statusLocked()
+}
+
+// SetBase changes the level reverted to, e.g. after LOG_LEVEL is reloaded. It
+// applies at once unless a temporary level is in force, which keeps running
+// until it expires.
+func (lc *LevelController) SetBase(level string) error {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("unknown log level %q", level)
+	}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.base = parsed
+	if lc.timer == nil {
+		lc.logger.SetLevel(parsed)
+	}
+	return nil
+}
+
+// Status reports the current and base level
+func (lc *LevelController) Status() LevelStatus {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return lc.statusLocked()
+}
+
+func (lc *LevelController) resetLocked() {
+	lc.timer = nil
+	lc.revertAt = time.Time{}
+	lc.logger.SetLevel(lc.base)
+}
+
+func (lc *LevelController) statusLocked() LevelStatus {
+	status := LevelStatus{
+		Level:     lc.logger.GetLevel().String(),
+		BaseLevel: lc.base.String(),
+	}
+	if lc.timer != nil {
+		revertAt := lc.revertAt.UTC()
+		status.RevertAt = &revertAt
+	}
+	return status
+}
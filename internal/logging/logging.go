@@ -0,0 +1,134 @@
+// Package logging holds the gateway's shared logger. Components take it at
+// construction instead of creating their own, so LOG_LEVEL and LOG_FORMAT
+// apply everywhere; per-request fields travel in the gin context.
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ContextKey is the gin context key holding the request-scoped *logrus.Entry
+const ContextKey = "logger"
+
+// requestIDPattern limits client-supplied request IDs to something safe to log and echo
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// audit shares the configured formatter and output but always logs at info:
+// a temporary LOG_LEVEL=error must not drop the security audit trail
+var audit = logrus.New()
+
+// Default returns the shared logger configured by Setup
+func Default() *logrus.Logger {
+	return logrus.StandardLogger()
+}
+
+// Audit returns the logger for security audit events
+func Audit() *logrus.Logger {
+	return audit
+}
+
+// Setup configures level, format and output of the shared loggers.
+// Unknown levels fall back to info, unknown formats to text.
+func Setup(level, format string, out io.Writer) {
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		parsed = logrus.InfoLevel
+	}
+
+	SetFormat(format)
+	for _, logger := range []*logrus.Logger{Default(), audit} {
+		logger.SetOutput(out)
+	}
+	Default().SetLevel(parsed)
+	audit.SetLevel(logrus.InfoLevel)
+}
+
+// SetFormat switches the shared and audit loggers between "json" and text
+// output without touching their level, e.g. after a configuration reload
+func SetFormat(format string) {
+	var formatter logrus.Formatter
+	if format == "json" {
+		formatter = &logrus.JSONFormatter{}
+	} else {
+		formatter = &logrus.TextFormatter{FullTimestamp: true}
+	}
+	for _, logger := range []*logrus.Logger{Default(), audit} {
+		logger.SetFormatter(formatter)
+	}
+}
+
+// FromContext returns the request-scoped entry set by Middleware, or a bare
+// entry of the shared logger outside a request
+func FromContext(c *gin.Context) *logrus.Entry {
+	if c != nil {
+		if entry, ok := c.Value(ContextKey).(*logrus.Entry); ok {
+			return entry
+		}
+	}
+	return logrus.NewEntry(Default())
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Middleware assigns each request an ID (reusing a well-formed X-Request-ID),
+// stores an entry carrying request_id, key_id and route in the context and
+// logs the finished request. keyID identifies the caller's key; nil omits it.
+func Middleware(keyID func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		requestID := c.GetHeader("X-Request-ID")
+		if !requestIDPattern.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		c.Set("request_id", requestID)
+		c.Header("X-Request-ID", requestID)
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		fields := logrus.Fields{
+			"request_id": requestID,
+			"route":      route,
+		}
+		if keyID != nil {
+			if id := keyID(c); id != "" {
+				fields["key_id"] = id
+			}
+		}
+		entry := Default().WithFields(fields)
+		c.Set(ContextKey, entry)
+
+		c.Next()
+
+		entry = entry.WithFields(logrus.Fields{
+			"method":      c.Request.Method,
+			"path":        c.Request.URL.Path,
+			"status":      c.Writer.Status(),
+			"duration_ms": time.Since(start).Milliseconds(),
+			"client_ip":   c.ClientIP(),
+		})
+		if len(c.Errors) > 0 {
+			entry = entry.WithField("errors", c.Errors.String())
+		}
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			entry.Error("Request completed")
+		case status >= 400:
+			entry.Warn("Request completed")
+		default:
+			entry.Info("Request completed")
+		}
+	}
+}
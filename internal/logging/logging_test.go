@@ -0,0 +1,170 @@
+package logging_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/logging"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupBuffer points the shared loggers at a buffer for the duration of a test
+func setupBuffer(t *testing.T, level string) *bytes.Buffer {
+	logger := logging.Default()
+	prevLevel, prevOut, prevFormatter := logger.GetLevel(), logger.Out, logger.Formatter
+	t.Cleanup(func() {
+		logging.Setup(prevLevel.String(), "text", prevOut)
+		logger.SetFormatter(prevFormatter)
+	})
+
+	var buf bytes.Buffer
+	logging.Setup(level, "json", &buf)
+	return &buf
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line), scanner.Text())
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestConfiguredLevelSuppressesComponentInfoLogs(t *testing.T) {
+	buf := setupBuffer(t, "error")
+	gin.SetMode(gin.TestMode)
+
+	// Components built after Setup share its level
+	sessions := security.NewSessionManager()
+	session, err := sessions.CreateSession("user-1", time.Minute)
+	require.NoError(t, err)
+	sessions.DestroySession(session.ID)
+
+	router := gin.New()
+	router.Use(logging.Middleware(nil))
+	router.GET("/ok", func(c *gin.Context) {
+		logging.FromContext(c).Info("handled")
+		c.Status(http.StatusOK)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	assert.Empty(t, buf.String())
+
+	logging.Default().Error("boom")
+	lines := logLines(t, buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "boom", lines[0]["msg"])
+
+	// The audit trail is kept whatever the level
+	buf.Reset()
+	security.NewAuditLogger().Log(&security.AuditEvent{ID: "evt-1", Type: "test"})
+	lines = logLines(t, buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "evt-1", lines[0]["event_id"])
+}
+
+func TestMiddlewareRequestScopedEntry(t *testing.T) {
+	buf := setupBuffer(t, "info")
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(logging.Middleware(func(c *gin.Context) string {
+		return "fp_" + c.GetHeader("Authorization")
+	}))
+	router.GET("/v1/items/:id", func(c *gin.Context) {
+		logging.FromContext(c).WithField("step", "inside").Warn("handling")
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/items/42", nil)
+	req.Header.Set("Authorization", "key")
+	req.Header.Set("X-Request-ID", "req-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "req-123", w.Header().Get("X-Request-ID"))
+
+	lines := logLines(t, buf)
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.Equal(t, "req-123", line["request_id"])
+		assert.Equal(t, "fp_key", line["key_id"])
+		assert.Equal(t, "/v1/items/:id", line["route"])
+	}
+	assert.Equal(t, "inside", lines[0]["step"])
+	assert.Equal(t, "Request completed", lines[1]["msg"])
+	assert.EqualValues(t, http.StatusOK, lines[1]["status"])
+
+	// Malformed IDs are replaced rather than echoed
+	req = httptest.NewRequest(http.MethodGet, "/v1/items/42", nil)
+	req.Header.Set("X-Request-ID", "bad id\r\nX-Evil: 1")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+	assert.NotContains(t, w.Header().Get("X-Request-ID"), " ")
+}
+
+func TestFromContextOutsideRequest(t *testing.T) {
+	assert.Same(t, logging.Default(), logging.FromContext(nil).Logger)
+}
+
+func TestLevelControllerReverts(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.InfoLevel)
+	lc := logging.NewLevelController(logger)
+
+	_, err := lc.Set("chatty", time.Minute)
+	assert.Error(t, err)
+	_, err = lc.Set("debug", logging.MaxLevelDuration+time.Second)
+	assert.Error(t, err)
+
+	status, err := lc.Set("debug", 30*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, "debug", status.Level)
+	assert.Equal(t, "info", status.BaseLevel)
+	require.NotNil(t, status.RevertAt)
+	require.Eventually(t, func() bool {
+		return logger.GetLevel() == logrus.InfoLevel
+	}, time.Second, 5*time.Millisecond)
+	assert.Nil(t, lc.Status().RevertAt)
+
+	// A newer change is not reverted by the timer of the one it replaced
+	_, err = lc.Set("warn", 20*time.Millisecond)
+	require.NoError(t, err)
+	_, err = lc.Set("trace", time.Minute)
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, logrus.TraceLevel, logger.GetLevel())
+
+	status = lc.Reset()
+	assert.Equal(t, "info", status.Level)
+	assert.Nil(t, status.RevertAt)
+}
+
+func TestLevelControllerSetBase(t *testing.T) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.InfoLevel)
+	lc := logging.NewLevelController(logger)
+
+	assert.Error(t, lc.SetBase("chatty"))
+	require.NoError(t, lc.SetBase("warn"))
+	assert.Equal(t, logrus.WarnLevel, logger.GetLevel())
+
+	// A temporary level stays until it is reset, then the new base applies
+	_, err := lc.Set("debug", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, lc.SetBase("error"))
+	assert.Equal(t, logrus.DebugLevel, logger.GetLevel())
+	assert.Equal(t, "error", lc.Reset().Level)
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// recentAuditSize bounds the audit events kept in memory for RecentAudit
+const recentAuditSize = 1000
+
+// AuditRecord is an audit event as it was logged
+type AuditRecord struct {
+	Time    time.Time
+	Level   logrus.Level
+	Message string
+	Fields  logrus.Fields
+}
+
+// recentHook 审计日志的内存环形缓冲，保留最近的事件供管理接口查询
+type recentHook struct {
+	mu      sync.Mutex
+	records []AuditRecord
+	next    int
+}
+
+var recentAudit = &recentHook{records: make([]AuditRecord, 0, recentAuditSize)}
+
+func init() {
+	audit.AddHook(recentAudit)
+}
+
+func (h *recentHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *recentHook) Fire(entry *logrus.Entry) error {
+	fields := make(logrus.Fields, len(entry.Data))
+	for k, v := range entry.Data {
+		fields[k] = v
+	}
+	record := AuditRecord{Time: entry.Time, Level: entry.Level, Message: entry.Message, Fields: fields}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.records) < recentAuditSize {
+		h.records = append(h.records, record)
+		return nil
+	}
+	h.records[h.next] = record
+	h.next = (h.next + 1) % recentAuditSize
+	return nil
+}
+
+// RecentAudit returns the audit events still in memory that were logged
+// within [since, until], oldest first
+func RecentAudit(since, until time.Time) []AuditRecord {
+	recentAudit.mu.Lock()
+	defer recentAudit.mu.Unlock()
+
+	var records []AuditRecord
+	n := len(recentAudit.records)
+	for i := 0; i < n; i++ {
+		record := recentAudit.records[(recentAudit.next+i)%n]
+		if record.Time.Before(since) || record.Time.After(until) {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AltSvc advertises the HTTP/3 listener on port to HTTP/1.1 and HTTP/2 clients
+func AltSvc(port string, maxAge time.Duration) gin.HandlerFunc {
+	value := fmt.Sprintf(`h3=":%s"; ma=%d`, port, int64(maxAge.Seconds()))
+	return func(c *gin.Context) {
+		// Requests already on QUIC need no advertisement
+		if c.Request.ProtoMajor < 3 {
+			c.Header("Alt-Svc", value)
+		}
+		c.Next()
+	}
+}
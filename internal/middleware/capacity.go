@@ -0,0 +1,635 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// SharedPool is the name of the pool every tenant may use
+const SharedPool = "shared"
+
+// Lease kinds: a slot in the caller's own reservation, in the shared pool, or
+// in another pool's idle reservation (work-conserving mode)
+const (
+	LeaseReserved = "reserved"
+	LeaseShared   = "shared"
+	LeaseBorrowed = "borrowed"
+)
+
+const capacityPlanKey = "plan"
+
+var (
+	capacityPoolInUse = metricsFactory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aigateway_capacity_pool_in_use",
+			Help: "Concurrent requests holding a slot in each capacity pool",
+		},
+		[]string{"pool", "kind"},
+	)
+
+	capacityPoolSize = metricsFactory.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "aigateway_capacity_pool_size",
+			Help: "Configured size of each capacity pool",
+		},
+		[]string{"pool"},
+	)
+
+	capacityAdmissions = metricsFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aigateway_capacity_pool_admissions_total",
+			Help: "Total number of requests admitted per capacity pool",
+		},
+		[]string{"pool", "kind"},
+	)
+
+	capacityRejections = metricsFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aigateway_capacity_pool_rejections_total",
+			Help: "Total number of requests rejected per capacity pool of the caller",
+		},
+		[]string{"pool"},
+	)
+)
+
+// ReservedPool 为指定租户预留的并发容量
+type ReservedPool struct {
+	Name    string   `json:"name"`
+	Size    int      `json:"size"`
+	Tenants []string `json:"tenants"`
+}
+
+// CapacityPlan 全局并发容量划分：共享池加若干预留池
+type CapacityPlan struct {
+	Total int `json:"total"`
+	// WorkConserving lets the shared pool borrow idle reserved slots; borrowing
+	// from a pool stops once its owner needs them until all borrowers finish
+	WorkConserving bool           `json:"work_conserving"`
+	Pools          []ReservedPool `json:"pools"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+// Validate checks that reservations fit within the total capacity
+func (p *CapacityPlan) Validate() error {
+	if p.Total <= 0 {
+		return fmt.Errorf("total capacity must be positive")
+	}
+	names := make(map[string]bool)
+	tenants := make(map[string]string)
+	reserved := 0
+	for _, pool := range p.Pools {
+		if pool.Name == "" || pool.Name == SharedPool {
+			return fmt.Errorf("invalid pool name %q", pool.Name)
+		}
+		if names[pool.Name] {
+			return fmt.Errorf("duplicate pool %q", pool.Name)
+		}
+		names[pool.Name] = true
+		if pool.Size <= 0 {
+			return fmt.Errorf("pool %s: size must be positive", pool.Name)
+		}
+		if len(pool.Tenants) == 0 {
+			return fmt.Errorf("pool %s: at least one tenant is required", pool.Name)
+		}
+		for _, tenant := range pool.Tenants {
+			if other, ok := tenants[tenant]; ok {
+				return fmt.Errorf("tenant %s is assigned to both %s and %s", tenant, other, pool.Name)
+			}
+			tenants[tenant] = pool.Name
+		}
+		reserved += pool.Size
+	}
+	if reserved > p.Total {
+		return fmt.Errorf("reserved capacity %d exceeds total capacity %d", reserved, p.Total)
+	}
+	return nil
+}
+
+// SharedSize returns the capacity left after reservations
+func (p *CapacityPlan) SharedSize() int {
+	shared := p.Total
+	for _, pool := range p.Pools {
+		shared -= pool.Size
+	}
+	return shared
+}
+
+// poolIndex returns the 1-based index of the tenant's pool, 0 when it has none
+func (p *CapacityPlan) poolIndex(tenant string) int {
+	if tenant == "" {
+		return 0
+	}
+	for i, pool := range p.Pools {
+		for _, t := range pool.Tenants {
+			if t == tenant {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// CapacityLease 已占用的容量槽位，请求结束时释放
+type CapacityLease struct {
+	ID   string
+	Pool string
+	Kind string
+}
+
+// PoolUsage 单个容量池的占用情况
+type PoolUsage struct {
+	Name       string `json:"name"`
+	Size       int    `json:"size"`
+	InUse      int    `json:"in_use"`   // slots held by the pool's own tenants (or by anyone for the shared pool)
+	Borrowed   int    `json:"borrowed"` // idle reserved slots lent to the shared pool
+	Reclaiming bool   `json:"reclaiming"`
+}
+
+// CapacityUsage 全部容量池的占用快照
+type CapacityUsage struct {
+	Total          int         `json:"total"`
+	WorkConserving bool        `json:"work_conserving"`
+	Pools          []PoolUsage `json:"pools"` // shared pool first
+}
+
+// capacityAccounting 容量计数后端，Redis实现在多副本间共享计数
+type capacityAccounting interface {
+	admit(ctx context.Context, plan *CapacityPlan, poolIndex int, id string) (*CapacityLease, error)
+	release(ctx context.Context, lease *CapacityLease) error
+	usage(ctx context.Context, plan *CapacityPlan) (*CapacityUsage, error)
+}
+
+// CapacityPools 按租户预留容量的准入控制
+type CapacityPools struct {
+	mu    sync.RWMutex
+	plan  *CapacityPlan
+	acct  capacityAccounting
+	store storage.Store
+}
+
+// NewCapacityPools creates admission control coordinated through Redis, or
+// counted in memory when redisClient is nil. leaseTTL bounds how long slots
+// held by a crashed replica stay occupied and must exceed the longest request.
+func NewCapacityPools(redisClient *redis.Client, store storage.Store, leaseTTL time.Duration) *CapacityPools {
+	var acct capacityAccounting = newMemoryCapacity()
+	if redisClient != nil {
+		acct = &redisCapacity{client: redisClient, leaseTTL: leaseTTL}
+	}
+	return &CapacityPools{acct: acct, store: store}
+}
+
+// Load reads the persisted plan
+func (cp *CapacityPools) Load(ctx context.Context) error {
+	if cp.store == nil {
+		return nil
+	}
+	data, err := cp.store.Get(ctx, storage.BucketCapacity, capacityPlanKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var plan CapacityPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return fmt.Errorf("invalid capacity plan: %w", err)
+	}
+	cp.mu.Lock()
+	cp.plan = &plan
+	cp.mu.Unlock()
+	return nil
+}
+
+// Plan returns a copy of the current plan, nil when capacity is not partitioned
+func (cp *CapacityPools) Plan() *CapacityPlan {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	if cp.plan == nil {
+		return nil
+	}
+	plan := *cp.plan
+	plan.Pools = append([]ReservedPool(nil), cp.plan.Pools...)
+	return &plan
+}
+
+// SetPlan validates, persists and applies a plan
+func (cp *CapacityPools) SetPlan(ctx context.Context, plan *CapacityPlan) error {
+	if err := plan.Validate(); err != nil {
+		return err
+	}
+	plan.UpdatedAt = time.Now()
+	if cp.store != nil {
+		data, err := json.Marshal(plan)
+		if err != nil {
+			return err
+		}
+		if err := cp.store.Put(ctx, storage.BucketCapacity, capacityPlanKey, data); err != nil {
+			return err
+		}
+	}
+	cp.mu.Lock()
+	cp.plan = plan
+	cp.mu.Unlock()
+	return nil
+}
+
+// Admit takes a slot for the tenant: its reserved pool first, then the shared
+// pool, then (in work-conserving mode) idle reserved slots. A nil lease means
+// the request must be rejected.
+func (cp *CapacityPools) Admit(ctx context.Context, tenant string) (*CapacityLease, error) {
+	plan := cp.Plan()
+	if plan == nil {
+		return &CapacityLease{}, nil
+	}
+
+	index := plan.poolIndex(tenant)
+	callerPool := SharedPool
+	if index > 0 {
+		callerPool = plan.Pools[index-1].Name
+	}
+
+	lease, err := cp.acct.admit(ctx, plan, index, newLeaseID())
+	if err != nil {
+		return nil, err
+	}
+	if lease == nil {
+		capacityRejections.WithLabelValues(callerPool).Inc()
+		return nil, nil
+	}
+	capacityAdmissions.WithLabelValues(lease.Pool, lease.Kind).Inc()
+	return lease, nil
+}
+
+// Release frees a slot taken by Admit
+func (cp *CapacityPools) Release(ctx context.Context, lease *CapacityLease) {
+	if lease == nil || lease.ID == "" {
+		return
+	}
+	if err := cp.acct.release(ctx, lease); err != nil {
+		logrus.WithError(err).WithField("pool", lease.Pool).Warn("Failed to release capacity slot")
+	}
+}
+
+// Usage returns pool occupancy, nil when capacity is not partitioned
+func (cp *CapacityPools) Usage(ctx context.Context) (*CapacityUsage, error) {
+	plan := cp.Plan()
+	if plan == nil {
+		return nil, nil
+	}
+	return cp.acct.usage(ctx, plan)
+}
+
+// Start reloads the plan so admin changes reach every replica, and refreshes pool gauges
+func (cp *CapacityPools) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cp.Load(ctx); err != nil {
+				logrus.WithError(err).Warn("Failed to reload capacity plan")
+			}
+			usage, err := cp.Usage(ctx)
+			if err != nil {
+				logrus.WithError(err).Warn("Failed to read capacity pool usage")
+				continue
+			}
+			if usage == nil {
+				continue
+			}
+			for _, pool := range usage.Pools {
+				capacityPoolSize.WithLabelValues(pool.Name).Set(float64(pool.Size))
+				capacityPoolInUse.WithLabelValues(pool.Name, "own").Set(float64(pool.InUse))
+				capacityPoolInUse.WithLabelValues(pool.Name, LeaseBorrowed).Set(float64(pool.Borrowed))
+			}
+		}
+	}
+}
+
+// Middleware applies admission control to AI requests. The tenant comes from the
+// feature flag middleware when it runs first, otherwise from RequestOwner; either
+// way it is the owner of the credentials, never the X-Tenant-ID header.
+func (cp *CapacityPools) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isAIRequest(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		tenant := c.GetString("tenant_id")
+		if tenant == "" {
+			tenant = RequestOwner(c)
+		}
+
+		lease, err := cp.Admit(c.Request.Context(), tenant)
+		if err != nil {
+			// 计数后端不可用时放行，避免容量控制成为单点故障
+			logrus.WithError(err).Error("Capacity admission check failed")
+			c.Next()
+			return
+		}
+		if lease == nil {
+			c.Header("Retry-After", "1")
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": gin.H{
+					"message": "Gateway capacity exhausted, please retry later",
+					"type":    "overloaded_error",
+					"code":    "capacity_exhausted",
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		defer cp.Release(context.Background(), lease)
+		c.Next()
+	}
+}
+
+func newLeaseID() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// memoryCapacity 单实例内存计数
+type memoryCapacity struct {
+	mu         sync.Mutex
+	shared     int
+	reserved   map[string]int
+	borrowed   map[string]int
+	reclaiming map[string]bool
+}
+
+func newMemoryCapacity() *memoryCapacity {
+	return &memoryCapacity{
+		reserved:   make(map[string]int),
+		borrowed:   make(map[string]int),
+		reclaiming: make(map[string]bool),
+	}
+}
+
+func (m *memoryCapacity) admit(_ context.Context, plan *CapacityPlan, index int, id string) (*CapacityLease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if index > 0 {
+		pool := plan.Pools[index-1]
+		if m.reserved[pool.Name] < pool.Size {
+			m.reserved[pool.Name]++
+			if m.reserved[pool.Name]+m.borrowed[pool.Name] > pool.Size {
+				m.reclaiming[pool.Name] = true
+			}
+			return &CapacityLease{ID: id, Pool: pool.Name, Kind: LeaseReserved}, nil
+		}
+	}
+
+	if m.shared < plan.SharedSize() {
+		m.shared++
+		return &CapacityLease{ID: id, Pool: SharedPool, Kind: LeaseShared}, nil
+	}
+
+	if plan.WorkConserving {
+		for _, pool := range plan.Pools {
+			if m.reclaiming[pool.Name] {
+				continue
+			}
+			if m.reserved[pool.Name]+m.borrowed[pool.Name] < pool.Size {
+				m.borrowed[pool.Name]++
+				return &CapacityLease{ID: id, Pool: pool.Name, Kind: LeaseBorrowed}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryCapacity) release(_ context.Context, lease *CapacityLease) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch lease.Kind {
+	case LeaseReserved:
+		if m.reserved[lease.Pool] > 0 {
+			m.reserved[lease.Pool]--
+		}
+	case LeaseShared:
+		if m.shared > 0 {
+			m.shared--
+		}
+	case LeaseBorrowed:
+		if m.borrowed[lease.Pool] > 0 {
+			m.borrowed[lease.Pool]--
+		}
+		if m.borrowed[lease.Pool] == 0 {
+			delete(m.reclaiming, lease.Pool)
+		}
+	}
+	return nil
+}
+
+func (m *memoryCapacity) usage(_ context.Context, plan *CapacityPlan) (*CapacityUsage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := &CapacityUsage{Total: plan.Total, WorkConserving: plan.WorkConserving}
+	usage.Pools = append(usage.Pools, PoolUsage{Name: SharedPool, Size: plan.SharedSize(), InUse: m.shared})
+	for _, pool := range plan.Pools {
+		usage.Pools = append(usage.Pools, PoolUsage{
+			Name:       pool.Name,
+			Size:       pool.Size,
+			InUse:      m.reserved[pool.Name],
+			Borrowed:   m.borrowed[pool.Name],
+			Reclaiming: m.reclaiming[pool.Name],
+		})
+	}
+	return usage, nil
+}
+
+// redisCapacity 在Redis中以带过期时间的租约有序集合计数，多副本共享
+type redisCapacity struct {
+	client   *redis.Client
+	leaseTTL time.Duration
+}
+
+const capacityKeyPrefix = "capacity:"
+
+func capacitySharedKey() string { return capacityKeyPrefix + SharedPool }
+
+func capacityPoolKeys(pool string) (reserved, borrowed, reclaim string) {
+	base := capacityKeyPrefix + "pool:" + pool
+	return base + ":reserved", base + ":borrowed", base + ":reclaim"
+}
+
+// admitScript mirrors memoryCapacity.admit. KEYS: the shared lease set, then per
+// pool its reserved and borrowed lease sets and reclaim flag. Lease scores are
+// expiry times, so slots of crashed replicas free themselves.
+var admitScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local expiry = tonumber(ARGV[2])
+local id = ARGV[3]
+local shared_size = tonumber(ARGV[4])
+local conserving = ARGV[5] == "1"
+local mine = tonumber(ARGV[6])
+local n = (#KEYS - 1) / 3
+
+local function count(key)
+	redis.call("ZREMRANGEBYSCORE", key, "-inf", now)
+	return redis.call("ZCARD", key)
+end
+
+if mine > 0 then
+	local base = 1 + 3 * (mine - 1)
+	local size = tonumber(ARGV[6 + mine])
+	local used = count(KEYS[base + 1])
+	if used < size then
+		redis.call("ZADD", KEYS[base + 1], expiry, id)
+		if used + 1 + count(KEYS[base + 2]) > size then
+			redis.call("SET", KEYS[base + 3], "1")
+		end
+		return {"reserved", mine}
+	end
+end
+
+if count(KEYS[1]) < shared_size then
+	redis.call("ZADD", KEYS[1], expiry, id)
+	return {"shared", 0}
+end
+
+if conserving then
+	for i = 1, n do
+		local base = 1 + 3 * (i - 1)
+		local borrowed = count(KEYS[base + 2])
+		if borrowed == 0 then
+			redis.call("DEL", KEYS[base + 3])
+		end
+		if redis.call("EXISTS", KEYS[base + 3]) == 0 and count(KEYS[base + 1]) + borrowed < tonumber(ARGV[6 + i]) then
+			redis.call("ZADD", KEYS[base + 2], expiry, id)
+			return {"borrowed", i}
+		end
+	end
+end
+
+return {"rejected", 0}
+`)
+
+// releaseCapacityScript removes a lease; the last borrower leaving ends reclaiming
+var releaseCapacityScript = redis.NewScript(`
+redis.call("ZREM", KEYS[1], ARGV[1])
+if #KEYS > 1 and redis.call("ZCARD", KEYS[1]) == 0 then
+	redis.call("DEL", KEYS[2])
+end
+return 1
+`)
+
+func (r *redisCapacity) admit(ctx context.Context, plan *CapacityPlan, index int, id string) (*CapacityLease, error) {
+	now := time.Now()
+	keys := []string{capacitySharedKey()}
+	args := []interface{}{
+		now.UnixMilli(),
+		now.Add(r.leaseTTL).UnixMilli(),
+		id,
+		plan.SharedSize(),
+		boolArg(plan.WorkConserving),
+		index,
+	}
+	for _, pool := range plan.Pools {
+		reserved, borrowed, reclaim := capacityPoolKeys(pool.Name)
+		keys = append(keys, reserved, borrowed, reclaim)
+		args = append(args, pool.Size)
+	}
+
+	result, err := admitScript.Run(ctx, r.client, keys, args...).Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(result) != 2 {
+		return nil, fmt.Errorf("unexpected admission result %v", result)
+	}
+	kind, _ := result[0].(string)
+	poolIndex, _ := result[1].(int64)
+
+	switch kind {
+	case LeaseShared:
+		return &CapacityLease{ID: id, Pool: SharedPool, Kind: LeaseShared}, nil
+	case LeaseReserved, LeaseBorrowed:
+		return &CapacityLease{ID: id, Pool: plan.Pools[poolIndex-1].Name, Kind: kind}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func (r *redisCapacity) release(ctx context.Context, lease *CapacityLease) error {
+	var keys []string
+	reserved, borrowed, reclaim := capacityPoolKeys(lease.Pool)
+	switch lease.Kind {
+	case LeaseShared:
+		keys = []string{capacitySharedKey()}
+	case LeaseReserved:
+		keys = []string{reserved}
+	case LeaseBorrowed:
+		keys = []string{borrowed, reclaim}
+	default:
+		return nil
+	}
+	return releaseCapacityScript.Run(ctx, r.client, keys, lease.ID).Err()
+}
+
+func (r *redisCapacity) usage(ctx context.Context, plan *CapacityPlan) (*CapacityUsage, error) {
+	now := fmt.Sprintf("(%d", time.Now().UnixMilli())
+
+	pipe := r.client.Pipeline()
+	shared := pipe.ZCount(ctx, capacitySharedKey(), now, "+inf")
+	type poolCmds struct {
+		reserved, borrowed *redis.IntCmd
+	}
+	cmds := make([]poolCmds, len(plan.Pools))
+	reclaims := make([]*redis.IntCmd, len(plan.Pools))
+	for i, pool := range plan.Pools {
+		reserved, borrowed, reclaim := capacityPoolKeys(pool.Name)
+		cmds[i] = poolCmds{
+			reserved: pipe.ZCount(ctx, reserved, now, "+inf"),
+			borrowed: pipe.ZCount(ctx, borrowed, now, "+inf"),
+		}
+		reclaims[i] = pipe.Exists(ctx, reclaim)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	usage := &CapacityUsage{Total: plan.Total, WorkConserving: plan.WorkConserving}
+	usage.Pools = append(usage.Pools, PoolUsage{Name: SharedPool, Size: plan.SharedSize(), InUse: int(shared.Val())})
+	for i, pool := range plan.Pools {
+		usage.Pools = append(usage.Pools, PoolUsage{
+			Name:       pool.Name,
+			Size:       pool.Size,
+			InUse:      int(cmds[i].reserved.Val()),
+			Borrowed:   int(cmds[i].borrowed.Val()),
+			Reclaiming: reclaims[i].Val() > 0,
+		})
+	}
+	return usage, nil
+}
+
+func boolArg(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,209 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// capacityBackends returns pools counted in memory and through Redis
+func capacityBackends(t *testing.T) map[string]*CapacityPools {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return map[string]*CapacityPools{
+		"memory": NewCapacityPools(nil, nil, time.Minute),
+		"redis":  NewCapacityPools(client, nil, time.Minute),
+	}
+}
+
+func TestCapacityPlanValidate(t *testing.T) {
+	valid := &CapacityPlan{Total: 10, Pools: []ReservedPool{{Name: "gold", Size: 4, Tenants: []string{"acme"}}}}
+	assert.NoError(t, valid.Validate())
+	assert.Equal(t, 6, valid.SharedSize())
+
+	over := &CapacityPlan{Total: 5, Pools: []ReservedPool{
+		{Name: "gold", Size: 4, Tenants: []string{"acme"}},
+		{Name: "silver", Size: 2, Tenants: []string{"globex"}},
+	}}
+	assert.ErrorContains(t, over.Validate(), "exceeds total")
+
+	twice := &CapacityPlan{Total: 10, Pools: []ReservedPool{
+		{Name: "gold", Size: 2, Tenants: []string{"acme"}},
+		{Name: "silver", Size: 2, Tenants: []string{"acme"}},
+	}}
+	assert.Error(t, twice.Validate())
+
+	shared := &CapacityPlan{Total: 10, Pools: []ReservedPool{{Name: SharedPool, Size: 2, Tenants: []string{"acme"}}}}
+	assert.Error(t, shared.Validate())
+}
+
+// TestCapacityGuaranteeUnderSaturation floods the gateway from many tenants and
+// checks the flagship tenant still gets its full reservation
+func TestCapacityGuaranteeUnderSaturation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	SetKeyOwnerResolver(func(apiKey string) (string, bool) {
+		return strings.CutPrefix(apiKey, "key-")
+	})
+	t.Cleanup(func() { SetKeyOwnerResolver(nil) })
+
+	for name, pools := range capacityBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, pools.SetPlan(context.Background(), &CapacityPlan{
+				Total: 10,
+				Pools: []ReservedPool{{Name: "flagship", Size: 4, Tenants: []string{"acme"}}},
+			}))
+
+			release := make(chan struct{})
+			var active int32
+			r := gin.New()
+			r.Use(pools.Middleware())
+			r.POST("/v1/chat/completions", func(c *gin.Context) {
+				atomic.AddInt32(&active, 1)
+				<-release
+				c.Status(http.StatusOK)
+			})
+
+			send := func(tenant string) *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+				req.Header.Set("Authorization", "Bearer key-"+tenant)
+				// Every caller claims the flagship tenant; only the key owner counts
+				req.Header.Set("X-Tenant-ID", "acme")
+				r.ServeHTTP(w, req)
+				return w
+			}
+
+			var wg sync.WaitGroup
+			var rejected int32
+			fire := func(n int, tenant func(i int) string) {
+				for i := 0; i < n; i++ {
+					wg.Add(1)
+					go func(i int) {
+						defer wg.Done()
+						if send(tenant(i)).Code == http.StatusServiceUnavailable {
+							atomic.AddInt32(&rejected, 1)
+						}
+					}(i)
+				}
+			}
+
+			// 40 requests from other tenants saturate the 6-slot shared pool
+			fire(40, func(i int) string { return fmt.Sprintf("noisy-%d", i) })
+			require.Eventually(t, func() bool {
+				return atomic.LoadInt32(&active) == 6 && atomic.LoadInt32(&rejected) == 34
+			}, 2*time.Second, 5*time.Millisecond)
+
+			// The flagship tenant still gets all 4 reserved slots
+			fire(4, func(int) string { return "acme" })
+			require.Eventually(t, func() bool { return atomic.LoadInt32(&active) == 10 }, 2*time.Second, 5*time.Millisecond)
+			assert.Equal(t, int32(34), atomic.LoadInt32(&rejected))
+
+			// Beyond its reservation it competes for the saturated shared pool
+			w := send("acme")
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			assert.Equal(t, "1", w.Header().Get("Retry-After"))
+			assert.Contains(t, w.Body.String(), "capacity_exhausted")
+
+			usage, err := pools.Usage(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, PoolUsage{Name: SharedPool, Size: 6, InUse: 6}, usage.Pools[0])
+			assert.Equal(t, PoolUsage{Name: "flagship", Size: 4, InUse: 4}, usage.Pools[1])
+
+			close(release)
+			wg.Wait()
+
+			usage, err = pools.Usage(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 0, usage.Pools[0].InUse)
+			assert.Equal(t, 0, usage.Pools[1].InUse)
+		})
+	}
+}
+
+func TestCapacityWorkConservingSpillAndReclaim(t *testing.T) {
+	ctx := context.Background()
+
+	for name, pools := range capacityBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, pools.SetPlan(ctx, &CapacityPlan{
+				Total:          6,
+				WorkConserving: true,
+				Pools:          []ReservedPool{{Name: "flagship", Size: 4, Tenants: []string{"acme"}}},
+			}))
+
+			// With the owner idle, others use the shared pool and then its reservation
+			var noisy []*CapacityLease
+			for i := 0; i < 6; i++ {
+				lease, err := pools.Admit(ctx, "noisy")
+				require.NoError(t, err)
+				require.NotNil(t, lease, "admission %d", i)
+				noisy = append(noisy, lease)
+			}
+			assert.Equal(t, LeaseBorrowed, noisy[5].Kind)
+			lease, err := pools.Admit(ctx, "noisy")
+			require.NoError(t, err)
+			assert.Nil(t, lease)
+
+			// The owner returns and is admitted at once; nothing in flight is cut
+			owner, err := pools.Admit(ctx, "acme")
+			require.NoError(t, err)
+			require.NotNil(t, owner)
+			assert.Equal(t, LeaseReserved, owner.Kind)
+
+			usage, err := pools.Usage(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, PoolUsage{Name: "flagship", Size: 4, InUse: 1, Borrowed: 4, Reclaiming: true}, usage.Pools[1])
+
+			// Freed borrowed slots are not lent out again while the pool is reclaimed,
+			// even though the owner leaves room for them
+			var borrowed []*CapacityLease
+			for _, l := range noisy {
+				if l.Kind == LeaseBorrowed {
+					borrowed = append(borrowed, l)
+				}
+			}
+			require.Len(t, borrowed, 4)
+			pools.Release(ctx, borrowed[0])
+			pools.Release(ctx, borrowed[1])
+			lease, err = pools.Admit(ctx, "noisy")
+			require.NoError(t, err)
+			assert.Nil(t, lease)
+
+			// Once every borrower has finished the reservation is whole and lending resumes
+			for _, l := range borrowed[2:] {
+				pools.Release(ctx, l)
+			}
+			usage, err = pools.Usage(ctx)
+			require.NoError(t, err)
+			assert.False(t, usage.Pools[1].Reclaiming)
+
+			lease, err = pools.Admit(ctx, "noisy")
+			require.NoError(t, err)
+			require.NotNil(t, lease)
+			assert.Equal(t, LeaseBorrowed, lease.Kind)
+		})
+	}
+}
+
+func TestCapacityWithoutPlanAdmitsEverything(t *testing.T) {
+	pools := NewCapacityPools(nil, nil, time.Minute)
+
+	lease, err := pools.Admit(context.Background(), "anyone")
+	require.NoError(t, err)
+	require.NotNil(t, lease)
+	pools.Release(context.Background(), lease)
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"go-aigateway/internal/monitoring"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ModelContextKey gin上下文中保存请求模型名的键，由代理处理器在解析请求体后设置
+const ModelContextKey = "model"
+
+// captureWriter tees up to limit bytes of the response for debug capture
+type captureWriter struct {
+	gin.ResponseWriter
+	body  bytes.Buffer
+	limit int
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.tee(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.tee([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *captureWriter) tee(data []byte) {
+	// Keep one byte past the limit so truncation is still reported
+	if room := w.limit + 1 - w.body.Len(); room > 0 {
+		if len(data) > room {
+			data = data[:room]
+		}
+		w.body.Write(data)
+	}
+}
+
+// DebugCapture feeds request outcomes to the error spike detector and, while
+// a capture is armed for the route, records the full exchange. Unarmed
+// requests pay a single atomic load.
+func DebugCapture(dc *monitoring.DebugCapture) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+
+		if !dc.Armed() || !dc.Wants(route) {
+			c.Next()
+			// Simulated sandbox traffic would only add noise to the error rates
+			if !c.GetBool(SandboxContextKey) {
+				dc.Record(route, c.GetString(ModelContextKey), c.Writer.Status())
+			}
+			return
+		}
+
+		start := time.Now()
+		limit := dc.MaxBodyBytes()
+		requestHeader := c.Request.Header.Clone()
+		var requestBody []byte
+		if c.Request.Body != nil {
+			data, err := io.ReadAll(io.LimitReader(c.Request.Body, int64(limit)+1))
+			if err == nil {
+				requestBody = data
+				c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(data), c.Request.Body))
+			}
+		}
+		writer := &captureWriter{ResponseWriter: c.Writer, limit: limit}
+		c.Writer = writer
+
+		c.Next()
+
+		if c.GetBool(SandboxContextKey) {
+			return
+		}
+		model := c.GetString(ModelContextKey)
+		status := c.Writer.Status()
+		dc.Record(route, model, status)
+		dc.Capture(route, model, monitoring.RawExchange{
+			Method:         c.Request.Method,
+			Path:           c.Request.URL.RequestURI(),
+			Status:         status,
+			Duration:       time.Since(start),
+			RequestHeader:  requestHeader,
+			RequestBody:    requestBody,
+			ResponseHeader: c.Writer.Header().Clone(),
+			ResponseBody:   writer.body.Bytes(),
+		})
+	}
+}
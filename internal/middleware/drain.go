@@ -0,0 +1,449 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Request classes, each with its own shutdown grace period
+const (
+	RequestClassStreaming = "streaming"
+	RequestClassDefault   = "default"
+)
+
+// ErrRequestDrained is returned to handlers writing to a response cut at shutdown
+var ErrRequestDrained = errors.New("request cut by shutdown drain")
+
+// aiPathPrefixes are the model-serving endpoints refused while draining;
+// health and admin endpoints stay available
+var aiPathPrefixes = []string{
+	"/v1/",
+	"/local/",
+	"/api/v1/chat",
+	"/api/v1/completions",
+	"/api/v1/embeddings",
+	"/api/v1/models",
+}
+
+// maxStreamPeekBytes bounds the request body read to detect "stream": true
+const maxStreamPeekBytes = 1 << 20
+
+// drainWriter serializes handler writes with a forced close from the drain loop
+type drainWriter struct {
+	gin.ResponseWriter
+	mu        sync.Mutex
+	streaming bool
+	closed    bool
+}
+
+func (w *drainWriter) detectStreamingLocked() {
+	if strings.Contains(w.ResponseWriter.Header().Get("Content-Type"), "text/event-stream") {
+		w.streaming = true
+	}
+}
+
+func (w *drainWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (w *drainWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.detectStreamingLocked()
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *drainWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrRequestDrained
+	}
+	w.detectStreamingLocked()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *drainWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, ErrRequestDrained
+	}
+	w.detectStreamingLocked()
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *drainWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.detectStreamingLocked()
+		w.ResponseWriter.Flush()
+	}
+}
+
+func (w *drainWriter) isStreaming() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.streaming
+}
+
+// forceClose ends the response: streams get a final SSE error event, requests
+// that have not responded yet get a 503. Later handler writes are dropped.
+func (w *drainWriter) forceClose(retryAfter int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.closed = true
+
+	switch {
+	case w.streaming && w.ResponseWriter.Written():
+		payload, _ := json.Marshal(gin.H{
+			"error": gin.H{
+				"message": "Gateway is shutting down, the response was cut short",
+				"type":    "server_shutdown",
+				"code":    "shutdown_drain_timeout",
+			},
+		})
+		w.ResponseWriter.WriteString("event: error\ndata: " + string(payload) + "\n\n")
+		w.ResponseWriter.Flush()
+	case !w.ResponseWriter.Written():
+		payload, _ := json.Marshal(gin.H{
+			"error": gin.H{
+				"message": "Gateway is shutting down, please retry",
+				"type":    "server_shutdown",
+				"code":    "shutdown_drain_timeout",
+			},
+		})
+		w.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.ResponseWriter.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		w.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+		w.ResponseWriter.Write(payload)
+	}
+}
+
+// inflightRequest 正在处理的请求
+type inflightRequest struct {
+	route  string
+	start  time.Time
+	writer *drainWriter
+	cancel context.CancelFunc
+	cut    bool
+	// drained is set for requests already in flight when draining started;
+	// only these count towards the shutdown report
+	drained bool
+}
+
+func (r *inflightRequest) class() string {
+	if r.writer.isStreaming() {
+		return RequestClassStreaming
+	}
+	return RequestClassDefault
+}
+
+// RouteInflight 单个路由的在途请求统计
+type RouteInflight struct {
+	Route            string  `json:"route"`
+	Count            int     `json:"count"`
+	Streaming        int     `json:"streaming"`
+	OldestAgeSeconds float64 `json:"oldest_age_seconds"`
+}
+
+// InflightSnapshot 在途请求快照
+type InflightSnapshot struct {
+	Draining         bool            `json:"draining"`
+	Total            int             `json:"total"`
+	Streaming        int             `json:"streaming"`
+	OldestAgeSeconds float64         `json:"oldest_age_seconds"`
+	Routes           []RouteInflight `json:"routes"`
+}
+
+// ShutdownReport 关闭时的请求排空结果
+type ShutdownReport struct {
+	InflightAtStart int            `json:"inflight_at_start"`
+	Completed       int            `json:"completed"`
+	Cut             int            `json:"cut"`
+	CutByClass      map[string]int `json:"cut_by_class"`
+	Duration        time.Duration  `json:"duration"`
+}
+
+// Drainer 跟踪在途请求，在关闭时按请求类别的宽限期等待其完成
+type Drainer struct {
+	mu         sync.Mutex
+	nextID     uint64
+	inflight   map[uint64]*inflightRequest
+	draining   bool
+	drainStart time.Time
+	completed  int
+	done       chan struct{} // closed when the last in-flight request finishes while draining
+
+	streamingGrace time.Duration
+	defaultGrace   time.Duration
+	pollInterval   time.Duration
+}
+
+// NewDrainer creates a drainer with the configured per-class grace periods
+func NewDrainer(cfg config.ShutdownConfig) *Drainer {
+	return &Drainer{
+		inflight:       make(map[uint64]*inflightRequest),
+		streamingGrace: cfg.StreamingGrace,
+		defaultGrace:   cfg.DefaultGrace,
+		pollInterval:   100 * time.Millisecond,
+	}
+}
+
+// Draining reports whether shutdown has started; readiness fails from that point
+func (d *Drainer) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+func (d *Drainer) grace(class string) time.Duration {
+	if class == RequestClassStreaming {
+		return d.streamingGrace
+	}
+	return d.defaultGrace
+}
+
+// retryAfterSeconds tells refused clients to come back once this instance is replaced
+func (d *Drainer) retryAfterSeconds() int {
+	return int(d.defaultGrace.Seconds()) + 1
+}
+
+// Middleware registers every request in the in-flight registry and refuses new
+// AI requests with 503 once draining has started
+func (d *Drainer) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if d.Draining() && isAIRequest(c.Request.URL.Path) {
+			c.Header("Retry-After", strconv.Itoa(d.retryAfterSeconds()))
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": gin.H{
+					"message": "Gateway is shutting down, please retry",
+					"type":    "server_shutdown",
+					"code":    "server_draining",
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		writer := &drainWriter{ResponseWriter: c.Writer, streaming: requestsStream(c.Request)}
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		req := &inflightRequest{route: route, start: time.Now(), writer: writer, cancel: cancel}
+
+		d.mu.Lock()
+		d.nextID++
+		id := d.nextID
+		d.inflight[id] = req
+		d.mu.Unlock()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer = writer
+		defer d.finish(id)
+		defer cancel()
+
+		c.Next()
+	}
+}
+
+// finish removes a request from the registry
+func (d *Drainer) finish(id uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	req, ok := d.inflight[id]
+	if !ok {
+		return
+	}
+	delete(d.inflight, id)
+	if req.drained && !req.cut {
+		d.completed++
+	}
+	if d.draining && len(d.inflight) == 0 && d.done != nil {
+		close(d.done)
+		d.done = nil
+	}
+}
+
+// Snapshot returns in-flight counts by route and the oldest request age
+func (d *Drainer) Snapshot() InflightSnapshot {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	snapshot := InflightSnapshot{Draining: d.draining, Routes: []RouteInflight{}}
+	byRoute := make(map[string]*RouteInflight)
+	for _, req := range d.inflight {
+		age := now.Sub(req.start).Seconds()
+		streaming := req.class() == RequestClassStreaming
+
+		stats, ok := byRoute[req.route]
+		if !ok {
+			stats = &RouteInflight{Route: req.route}
+			byRoute[req.route] = stats
+		}
+		stats.Count++
+		snapshot.Total++
+		if streaming {
+			stats.Streaming++
+			snapshot.Streaming++
+		}
+		if age > stats.OldestAgeSeconds {
+			stats.OldestAgeSeconds = age
+		}
+		if age > snapshot.OldestAgeSeconds {
+			snapshot.OldestAgeSeconds = age
+		}
+	}
+
+	for _, stats := range byRoute {
+		snapshot.Routes = append(snapshot.Routes, *stats)
+	}
+	sort.Slice(snapshot.Routes, func(i, j int) bool { return snapshot.Routes[i].Route < snapshot.Routes[j].Route })
+	return snapshot
+}
+
+// Drain stops admitting AI requests and waits for in-flight requests, cutting
+// each one that outlives the grace period of its class. It returns once the
+// registry is empty or ctx is done, and logs a shutdown report.
+func (d *Drainer) Drain(ctx context.Context) ShutdownReport {
+	d.mu.Lock()
+	d.draining = true
+	d.drainStart = time.Now()
+	report := ShutdownReport{InflightAtStart: len(d.inflight), CutByClass: make(map[string]int)}
+	for _, req := range d.inflight {
+		req.drained = true
+	}
+	done := make(chan struct{})
+	if len(d.inflight) == 0 {
+		close(done)
+	} else {
+		d.done = done
+	}
+	d.mu.Unlock()
+
+	logrus.WithField("inflight", report.InflightAtStart).Info("Draining in-flight requests")
+
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+wait:
+	for {
+		select {
+		case <-done:
+			break wait
+		case <-ctx.Done():
+			break wait
+		case <-ticker.C:
+			d.cutExpired(report.CutByClass)
+		}
+	}
+
+	d.mu.Lock()
+	report.Completed = d.completed
+	for _, n := range report.CutByClass {
+		report.Cut += n
+	}
+	report.Duration = time.Since(d.drainStart)
+	remaining := len(d.inflight)
+	d.mu.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"inflight_at_start": report.InflightAtStart,
+		"completed":         report.Completed,
+		"cut":               report.Cut,
+		"cut_streaming":     report.CutByClass[RequestClassStreaming],
+		"cut_default":       report.CutByClass[RequestClassDefault],
+		"still_running":     remaining,
+		"duration_ms":       report.Duration.Milliseconds(),
+	}).Info("Shutdown drain report")
+
+	return report
+}
+
+// cutExpired force-closes requests past the grace period of their class
+func (d *Drainer) cutExpired(cutByClass map[string]int) {
+	d.mu.Lock()
+	elapsed := time.Since(d.drainStart)
+	var expired []*inflightRequest
+	for _, req := range d.inflight {
+		if req.cut {
+			continue
+		}
+		class := req.class()
+		if elapsed >= d.grace(class) {
+			req.cut = true
+			cutByClass[class]++
+			expired = append(expired, req)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, req := range expired {
+		logrus.WithFields(logrus.Fields{
+			"route":       req.route,
+			"class":       req.class(),
+			"age_seconds": time.Since(req.start).Seconds(),
+		}).Warn("Cutting in-flight request at shutdown grace deadline")
+		req.writer.forceClose(d.retryAfterSeconds())
+		req.cancel()
+	}
+}
+
+func isAIRequest(path string) bool {
+	for _, prefix := range aiPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestsStream reports whether the client asked for a streamed response,
+// either by Accept header or by "stream": true in a JSON body
+func requestsStream(r *http.Request) bool {
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return true
+	}
+	if r.Body == nil || r.ContentLength <= 0 || r.ContentLength > maxStreamPeekBytes ||
+		!strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		return false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxStreamPeekBytes))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil {
+		return false
+	}
+	var payload struct {
+		Stream bool `json:"stream"`
+	}
+	return json.Unmarshal(body, &payload) == nil && payload.Stream
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupDrainRouter(drainer *Drainer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(drainer.Middleware())
+	r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// Finishes shortly after being asked to
+	r.POST("/v1/slow", func(c *gin.Context) {
+		select {
+		case <-time.After(50 * time.Millisecond):
+			c.JSON(http.StatusOK, gin.H{"ok": true})
+		case <-c.Request.Context().Done():
+		}
+	})
+	// Never finishes on its own
+	r.POST("/v1/stuck", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+	})
+	// Streams for the requested duration
+	r.POST("/v1/stream", func(c *gin.Context) {
+		duration, _ := time.ParseDuration(c.Query("for"))
+		c.Header("Content-Type", "text/event-stream")
+		c.Writer.WriteString("data: first\n\n")
+		c.Writer.Flush()
+
+		select {
+		case <-time.After(duration):
+			c.Writer.WriteString("data: [DONE]\n\n")
+		case <-c.Request.Context().Done():
+		}
+	})
+	return r
+}
+
+func TestDrainerPerClassGrace(t *testing.T) {
+	drainer := NewDrainer(config.ShutdownConfig{
+		StreamingGrace: 400 * time.Millisecond,
+		DefaultGrace:   100 * time.Millisecond,
+	})
+	drainer.pollInterval = 10 * time.Millisecond
+	r := setupDrainRouter(drainer)
+
+	paths := map[string]string{
+		"slow":           "/v1/slow",
+		"stuck":          "/v1/stuck",
+		"stream_short":   "/v1/stream?for=250ms",
+		"stream_forever": "/v1/stream?for=1h",
+	}
+
+	var mu sync.Mutex
+	results := make(map[string]*httptest.ResponseRecorder)
+	finished := make(map[string]time.Duration)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for name, path := range paths {
+		wg.Add(1)
+		go func(name, path string) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+			mu.Lock()
+			results[name] = w
+			finished[name] = time.Since(start)
+			mu.Unlock()
+		}(name, path)
+	}
+
+	require.Eventually(t, func() bool {
+		s := drainer.Snapshot()
+		return s.Total == 4 && s.Streaming == 2
+	}, time.Second, 5*time.Millisecond)
+
+	snapshot := drainer.Snapshot()
+	assert.False(t, snapshot.Draining)
+	require.Len(t, snapshot.Routes, 3)
+	assert.Equal(t, "/v1/stream", snapshot.Routes[1].Route)
+	assert.Equal(t, 2, snapshot.Routes[1].Count)
+
+	// SIGTERM
+	reportCh := make(chan ShutdownReport, 1)
+	go func() { reportCh <- drainer.Drain(context.Background()) }()
+	require.Eventually(t, drainer.Draining, time.Second, time.Millisecond)
+
+	// New AI requests are refused, health still answers
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/slow", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "server_draining")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	report := <-reportCh
+	wg.Wait()
+
+	assert.Equal(t, 4, report.InflightAtStart)
+	assert.Equal(t, 2, report.Completed)
+	assert.Equal(t, 2, report.Cut)
+	assert.Equal(t, 1, report.CutByClass[RequestClassDefault])
+	assert.Equal(t, 1, report.CutByClass[RequestClassStreaming])
+
+	// Completed within grace
+	assert.Equal(t, http.StatusOK, results["slow"].Code)
+	assert.Contains(t, results["stream_short"].Body.String(), "data: [DONE]")
+
+	// Non-streaming request cut at the default grace with a 503
+	assert.Equal(t, http.StatusServiceUnavailable, results["stuck"].Code)
+	assert.Contains(t, results["stuck"].Body.String(), "shutdown_drain_timeout")
+	assert.Less(t, finished["stuck"], 350*time.Millisecond)
+
+	// Stream kept until the streaming grace, then ended with an SSE error event
+	body := results["stream_forever"].Body.String()
+	assert.True(t, strings.HasPrefix(body, "data: first\n\n"))
+	assert.Contains(t, body, "event: error\ndata: ")
+	assert.Contains(t, body, "shutdown_drain_timeout")
+	assert.GreaterOrEqual(t, finished["stream_forever"], 400*time.Millisecond)
+}
+
+func TestDrainerWithoutInflightReturnsImmediately(t *testing.T) {
+	drainer := NewDrainer(config.ShutdownConfig{StreamingGrace: time.Minute, DefaultGrace: time.Minute})
+
+	report := drainer.Drain(context.Background())
+	assert.Equal(t, 0, report.InflightAtStart)
+	assert.Equal(t, 0, report.Cut)
+	assert.True(t, drainer.Draining())
+}
+
+func TestRequestsStreamDetectsStreamFlag(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m","stream":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	assert.True(t, requestsStream(req))
+
+	// The body is still readable by handlers
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"model":"m","stream":true}`, string(body))
+
+	req = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{"model":"m"}`))
+	req.Header.Set("Content-Type", "application/json")
+	assert.False(t, requestsStream(req))
+}
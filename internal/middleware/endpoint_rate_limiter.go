@@ -0,0 +1,253 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// endpointKeyPrefix keeps endpoint counters apart from the global rate_limit: keys
+const endpointKeyPrefix = "ratelimit:endpoint:"
+
+// endpointRule is one configured path pattern with its limit
+type endpointRule struct {
+	pattern   string
+	qps       int
+	throttled atomic.Int64
+}
+
+// EndpointRateStats 单个接口路径模式的当前请求速率
+type EndpointRateStats struct {
+	Pattern       string  `json:"pattern"`
+	QPSLimit      int     `json:"qps_limit"`
+	CurrentRate   float64 `json:"current_rate"` // requests per second over the last window, all clients
+	ActiveClients int     `json:"active_clients"`
+	Throttled     int64   `json:"throttled_total"` // rejected by this instance since start
+}
+
+// EndpointRateLimiter 按接口路径模式限制每个客户端IP的QPS，与全局限流相互独立。
+// Counters live in Redis when a client is given, otherwise in process memory.
+type EndpointRateLimiter struct {
+	rules  []*endpointRule // most specific pattern first
+	window time.Duration
+	redis  *RedisRateLimiter
+
+	mu        sync.Mutex
+	local     map[string][]time.Time
+	lastSweep time.Time
+}
+
+// NewEndpointRateLimiter creates a limiter for the configured endpoint patterns
+func NewEndpointRateLimiter(client *redis.Client, limits map[string]config.EndpointRateConfig) *EndpointRateLimiter {
+	l := &EndpointRateLimiter{
+		window: time.Second,
+		local:  make(map[string][]time.Time),
+	}
+	for pattern, limit := range limits {
+		l.rules = append(l.rules, &endpointRule{pattern: pattern, qps: limit.QPS})
+	}
+	// Literal paths win over wildcards, then longer patterns over shorter ones
+	sort.Slice(l.rules, func(i, j int) bool {
+		a, b := l.rules[i].pattern, l.rules[j].pattern
+		if aLit, bLit := isLiteralPattern(a), isLiteralPattern(b); aLit != bLit {
+			return aLit
+		}
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		return a < b
+	})
+	if client != nil {
+		// Throttled attempts count towards the current rate, as in the in-memory windows
+		l.redis = &RedisRateLimiter{client: client, windowSize: l.window, keyPrefix: endpointKeyPrefix, legacy: true, now: time.Now}
+	}
+	return l
+}
+
+func isLiteralPattern(pattern string) bool {
+	return !strings.ContainsAny(pattern, `*?[\`)
+}
+
+// match returns the rule for a request path, or nil when no pattern matches
+func (l *EndpointRateLimiter) match(requestPath string) *endpointRule {
+	for _, rule := range l.rules {
+		if ok, _ := path.Match(rule.pattern, requestPath); ok {
+			return rule
+		}
+	}
+	return nil
+}
+
+// Middleware rejects requests over the limit of the endpoint pattern they match
+func (l *EndpointRateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule := l.match(c.Request.URL.Path)
+		if rule == nil {
+			c.Next()
+			return
+		}
+
+		clientIP := c.ClientIP()
+		allowed, remaining, err := l.allow(c.Request.Context(), rule, clientIP)
+		if err != nil {
+			// Fail open like the global limiter when Redis is unavailable
+			logrus.WithError(err).Error("Endpoint rate limit check failed")
+			c.Next()
+			return
+		}
+
+		resetAt := time.Now().Add(l.window).Unix()
+		c.Header("X-Endpoint-RateLimit-Limit", strconv.Itoa(rule.qps))
+		c.Header("X-Endpoint-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			rule.throttled.Add(1)
+			RecordRateLimitHit("endpoint:" + rule.pattern)
+			c.Header("Retry-After", strconv.Itoa(int(l.window.Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": gin.H{
+					"message": "Endpoint rate limit exceeded",
+					"type":    "rate_limit_error",
+					"code":    "endpoint_rate_limit_exceeded",
+					"details": map[string]interface{}{
+						"endpoint": rule.pattern,
+						"limit":    rule.qps,
+						"reset_at": resetAt,
+					},
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// allow counts the request against the client's window for the rule
+func (l *EndpointRateLimiter) allow(ctx context.Context, rule *endpointRule, clientIP string) (bool, int, error) {
+	key := rule.pattern + ":" + clientIP
+	if l.redis != nil {
+		return l.redis.checkLimit(ctx, key, rule.qps)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+	recent := pruneBefore(l.local[key], now.Add(-l.window))
+	count := len(recent)
+	l.local[key] = append(recent, now)
+
+	remaining := rule.qps - count - 1
+	if remaining < 0 {
+		remaining = 0
+	}
+	return count < rule.qps, remaining, nil
+}
+
+// sweep drops idle clients from the in-memory counters once a minute
+func (l *EndpointRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+	for key, times := range l.local {
+		if recent := pruneBefore(times, now.Add(-l.window)); len(recent) == 0 {
+			delete(l.local, key)
+		} else {
+			l.local[key] = recent
+		}
+	}
+}
+
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// Stats reports the current request rate of every configured endpoint pattern
+func (l *EndpointRateLimiter) Stats(ctx context.Context) ([]EndpointRateStats, error) {
+	stats := make([]EndpointRateStats, 0, len(l.rules))
+	for _, rule := range l.rules {
+		requests, clients, err := l.windowCounts(ctx, rule)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, EndpointRateStats{
+			Pattern:       rule.pattern,
+			QPSLimit:      rule.qps,
+			CurrentRate:   float64(requests) / l.window.Seconds(),
+			ActiveClients: clients,
+			Throttled:     rule.throttled.Load(),
+		})
+	}
+	return stats, nil
+}
+
+// windowCounts sums the requests in the current window over all clients of a rule
+func (l *EndpointRateLimiter) windowCounts(ctx context.Context, rule *endpointRule) (int, int, error) {
+	now := time.Now()
+	cutoff := now.Add(-l.window)
+
+	if l.redis == nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		requests, clients := 0, 0
+		prefix := rule.pattern + ":"
+		for key, times := range l.local {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			if n := len(pruneBefore(times, cutoff)); n > 0 {
+				requests += n
+				clients++
+			}
+		}
+		return requests, clients, nil
+	}
+
+	// Patterns may hold glob characters, which SCAN MATCH would interpret
+	match := escapeGlob(endpointKeyPrefix+rule.pattern+":") + "*"
+	since := "(" + strconv.FormatInt(cutoff.UnixNano(), 10)
+	requests, clients := 0, 0
+	client := l.redis.redisClient()
+	iter := client.Scan(ctx, 0, match, 100).Iterator()
+	for iter.Next(ctx) {
+		n, err := client.ZCount(ctx, iter.Val(), since, "+inf").Result()
+		if err != nil {
+			return 0, 0, err
+		}
+		if n > 0 {
+			requests += int(n)
+			clients++
+		}
+	}
+	return requests, clients, iter.Err()
+}
+
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`*?[]\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
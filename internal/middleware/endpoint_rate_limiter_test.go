@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testEndpointLimits = map[string]config.EndpointRateConfig{
+	"/api/v1/chat":  {QPS: 3},
+	"/api/v1/*":     {QPS: 100},
+	"/v1/engines/*": {QPS: 1},
+}
+
+// endpointLimiters returns limiters counting in memory and through Redis
+func endpointLimiters(t *testing.T) map[string]*EndpointRateLimiter {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return map[string]*EndpointRateLimiter{
+		"memory": NewEndpointRateLimiter(nil, testEndpointLimits),
+		"redis":  NewEndpointRateLimiter(client, testEndpointLimits),
+	}
+}
+
+func endpointRouter(limiter *EndpointRateLimiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(limiter.Middleware())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST("/api/v1/chat", ok)
+	router.GET("/api/v1/models", ok)
+	router.GET("/health", ok)
+	return router
+}
+
+func requestFrom(router *gin.Engine, method, path, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = ip + ":1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestEndpointRateLimitIsPerEndpoint(t *testing.T) {
+	for name, limiter := range endpointLimiters(t) {
+		t.Run(name, func(t *testing.T) {
+			router := endpointRouter(limiter)
+
+			for i := 0; i < 3; i++ {
+				w := requestFrom(router, http.MethodPost, "/api/v1/chat", "10.0.0.1")
+				require.Equal(t, http.StatusOK, w.Code)
+			}
+			w := requestFrom(router, http.MethodPost, "/api/v1/chat", "10.0.0.1")
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+			assert.Contains(t, w.Body.String(), "endpoint_rate_limit_exceeded")
+			assert.Equal(t, "3", w.Header().Get("X-Endpoint-RateLimit-Limit"))
+
+			// The throttled client can still call a cheaper endpoint
+			w = requestFrom(router, http.MethodGet, "/api/v1/models", "10.0.0.1")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "100", w.Header().Get("X-Endpoint-RateLimit-Limit"))
+
+			// Other clients have their own budget, and unmatched paths are not limited
+			assert.Equal(t, http.StatusOK, requestFrom(router, http.MethodPost, "/api/v1/chat", "10.0.0.2").Code)
+			w = requestFrom(router, http.MethodGet, "/health", "10.0.0.1")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, w.Header().Get("X-Endpoint-RateLimit-Limit"))
+
+			stats, err := limiter.Stats(context.Background())
+			require.NoError(t, err)
+			require.Len(t, stats, 3)
+			byPattern := map[string]EndpointRateStats{}
+			for _, s := range stats {
+				byPattern[s.Pattern] = s
+			}
+			assert.Equal(t, 2, byPattern["/api/v1/chat"].ActiveClients)
+			assert.Equal(t, float64(5), byPattern["/api/v1/chat"].CurrentRate)
+			assert.Equal(t, int64(1), byPattern["/api/v1/chat"].Throttled)
+			assert.Equal(t, float64(1), byPattern["/api/v1/*"].CurrentRate)
+			assert.Zero(t, byPattern["/v1/engines/*"].CurrentRate)
+		})
+	}
+}
+
+func TestEndpointRateLimitWindowSlides(t *testing.T) {
+	limiter := NewEndpointRateLimiter(nil, map[string]config.EndpointRateConfig{"/api/v1/chat": {QPS: 1}})
+	limiter.window = 50 * time.Millisecond
+	router := endpointRouter(limiter)
+
+	assert.Equal(t, http.StatusOK, requestFrom(router, http.MethodPost, "/api/v1/chat", "10.0.0.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, requestFrom(router, http.MethodPost, "/api/v1/chat", "10.0.0.1").Code)
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, requestFrom(router, http.MethodPost, "/api/v1/chat", "10.0.0.1").Code)
+}
+
+func TestEndpointRateLimitMostSpecificPatternWins(t *testing.T) {
+	limiter := NewEndpointRateLimiter(nil, map[string]config.EndpointRateConfig{
+		"/v1/*":                {QPS: 1},
+		"/v1/*/completions":    {QPS: 2},
+		"/v1/chat/completions": {QPS: 3},
+	})
+
+	assert.Equal(t, 3, limiter.match("/v1/chat/completions").qps)
+	assert.Equal(t, 2, limiter.match("/v1/engines/completions").qps)
+	assert.Equal(t, 1, limiter.match("/v1/models").qps)
+	assert.Nil(t, limiter.match("/api/v1/models"))
+}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// maxIdempotentResponseBytes caps the responses kept for replay; larger ones are not replayed
+const maxIdempotentResponseBytes = 1 << 20
+
+// idempotencyRecord is the stored outcome of a request with an Idempotency-Key
+type idempotencyRecord struct {
+	RequestHash string    `json:"request_hash"`
+	Completed   bool      `json:"completed"`
+	Status      int       `json:"status,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// idempotencyWriter keeps the response for replay until it exceeds the cap
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.keep(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *idempotencyWriter) keep(data []byte) {
+	if w.overflow || w.body.Len()+len(data) > maxIdempotentResponseBytes {
+		w.overflow = true
+		return
+	}
+	w.body.Write(data)
+}
+
+// Idempotency 为携带 Idempotency-Key 的 POST 请求保存响应，在 ttl 内以相同的键和请求体重试时
+// 直接重放，而不会再次调用上游。键按 RequestOwner 隔离；同一键换了请求体返回 422，
+// 首个请求仍在处理时返回 409。流式、超过 1MB 和 5xx 的响应不保存，可以重试。
+// Records live in store, so they survive restarts with the embedded backend and
+// are shared through Redis; a duplicate racing the first request on another
+// replica may still be processed once more.
+func Idempotency(store storage.Store, ttl time.Duration) gin.HandlerFunc {
+	var mutex sync.Mutex // serialises the check-and-reserve on this instance
+	var lastSweep time.Time
+
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" || c.Request.Method != http.MethodPost {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			data, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				c.Next()
+				return
+			}
+			body = data
+			c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		}
+		hash := sha256.Sum256(append([]byte(c.Request.Method+" "+c.Request.URL.Path+"\n"), body...))
+		requestHash := hex.EncodeToString(hash[:])
+		ownerKey := sha256.Sum256([]byte(RequestOwner(c) + "\n" + key))
+		recordKey := hex.EncodeToString(ownerKey[:16])
+		// The outcome is stored even when the client has gone away
+		ctx := context.WithoutCancel(c.Request.Context())
+
+		mutex.Lock()
+		if time.Now().Sub(lastSweep) >= time.Hour {
+			lastSweep = time.Now()
+			sweepIdempotencyRecords(ctx, store, time.Now())
+		}
+		var record idempotencyRecord
+		data, err := store.Get(ctx, storage.BucketIdempotency, recordKey)
+		if err == nil && json.Unmarshal(data, &record) == nil && time.Now().Before(record.ExpiresAt) {
+			mutex.Unlock()
+			replayIdempotent(c, record, requestHash)
+			return
+		}
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			mutex.Unlock()
+			logrus.WithError(err).Warn("Idempotency record lookup failed, processing the request")
+			c.Next()
+			return
+		}
+		reserved := idempotencyRecord{RequestHash: requestHash, ExpiresAt: time.Now().Add(ttl)}
+		if err := putIdempotencyRecord(ctx, store, recordKey, reserved); err != nil {
+			mutex.Unlock()
+			logrus.WithError(err).Warn("Failed to reserve idempotency key, processing the request")
+			c.Next()
+			return
+		}
+		mutex.Unlock()
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		contentType := writer.Header().Get("Content-Type")
+		if writer.Status() >= http.StatusInternalServerError || writer.overflow || strings.HasPrefix(contentType, "text/event-stream") {
+			// Not replayable; release the key so the client can retry
+			store.Delete(ctx, storage.BucketIdempotency, recordKey)
+			return
+		}
+		reserved.Completed = true
+		reserved.Status = writer.Status()
+		reserved.ContentType = contentType
+		reserved.Body = writer.body.Bytes()
+		if err := putIdempotencyRecord(ctx, store, recordKey, reserved); err != nil {
+			logrus.WithError(err).Warn("Failed to store idempotent response")
+		}
+	}
+}
+
+// replayIdempotent answers a request whose key has a record
+func replayIdempotent(c *gin.Context, record idempotencyRecord, requestHash string) {
+	switch {
+	case record.RequestHash != requestHash:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": gin.H{
+				"message": "Idempotency-Key was already used with a different request",
+				"type":    "invalid_request_error",
+				"code":    "idempotency_key_reused",
+			},
+		})
+	case !record.Completed:
+		c.JSON(http.StatusConflict, gin.H{
+			"error": gin.H{
+				"message": "A request with this Idempotency-Key is still being processed",
+				"type":    "invalid_request_error",
+				"code":    "idempotency_request_in_progress",
+			},
+		})
+	default:
+		c.Header("Idempotent-Replayed", "true")
+		c.Data(record.Status, record.ContentType, record.Body)
+	}
+	c.Abort()
+}
+
+func putIdempotencyRecord(ctx context.Context, store storage.Store, key string, record idempotencyRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, storage.BucketIdempotency, key, data)
+}
+
+// sweepIdempotencyRecords deletes expired records
+func sweepIdempotencyRecords(ctx context.Context, store storage.Store, now time.Time) {
+	records, err := store.List(ctx, storage.BucketIdempotency)
+	if err != nil {
+		return
+	}
+	for key, data := range records {
+		var record idempotencyRecord
+		if json.Unmarshal(data, &record) != nil || !now.Before(record.ExpiresAt) {
+			store.Delete(ctx, storage.BucketIdempotency, key)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyReplaysStoredResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "gateway.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	calls := 0
+	r := gin.New()
+	r.Use(Idempotency(store, time.Hour))
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		calls++
+		if c.GetHeader("X-Fail") != "" {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "upstream"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"id": calls})
+	})
+	call := func(apiKey, idempotencyKey, body string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		if idempotencyKey != "" {
+			req.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	first := call("key-a", "retry-1", `{"model":"qwen"}`)
+	require.Equal(t, http.StatusOK, first.Code)
+	replay := call("key-a", "retry-1", `{"model":"qwen"}`)
+	assert.Equal(t, http.StatusOK, replay.Code)
+	assert.Equal(t, first.Body.String(), replay.Body.String())
+	assert.Equal(t, "true", replay.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 1, calls, "the retry is not processed again")
+
+	w := call("key-a", "retry-1", `{"model":"other"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "idempotency_key_reused")
+
+	// Keys are scoped to the caller, and requests without a key always run
+	assert.Equal(t, http.StatusOK, call("key-b", "retry-1", `{"model":"qwen"}`).Code)
+	assert.Equal(t, 2, calls)
+	call("key-a", "", `{"model":"qwen"}`)
+	assert.Equal(t, 3, calls)
+
+	// Server errors release the key so the client can retry
+	assert.Equal(t, http.StatusBadGateway, call("key-a", "retry-2", `{}`, "X-Fail", "1").Code)
+	assert.Equal(t, http.StatusOK, call("key-a", "retry-2", `{}`).Code)
+	assert.Equal(t, 5, calls)
+}
+
+func TestIdempotencyRejectsRequestsInProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "gateway.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	r := gin.New()
+	r.Use(Idempotency(store, time.Hour))
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusOK)
+	})
+	call := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "slow")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- call() }()
+	<-started
+	w := call()
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "idempotency_request_in_progress")
+	close(release)
+	assert.Equal(t, http.StatusOK, (<-done).Code)
+}
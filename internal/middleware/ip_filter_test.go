@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trustedProxyAddr is the remote address of requests without an explicit one,
+// a proxy whose forwarding headers are honoured
+const trustedProxyAddr = "192.0.2.100:4000"
+
+func ipFilterStatus(t *testing.T, handler gin.HandlerFunc, forwardedFor, remoteAddr string) int {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	require.NoError(t, r.SetTrustedProxies([]string{"192.0.2.100"}))
+	r.Use(handler)
+	r.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	req.RemoteAddr = trustedProxyAddr
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code == http.StatusForbidden {
+		var body struct {
+			Error struct {
+				Type string `json:"type"`
+				Code string `json:"code"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, "permission_error", body.Error.Type)
+		assert.Equal(t, "ip_not_allowed", body.Error.Code)
+	}
+	return w.Code
+}
+
+func TestIPFilterBlocklist(t *testing.T) {
+	handler := IPFilter(&config.IPFilterConfig{Blocklist: []string{"203.0.113.0/24", " 198.51.100.7", "2001:db8::/32", "not-an-ip", ""}})
+
+	assert.Equal(t, http.StatusForbidden, ipFilterStatus(t, handler, "203.0.113.9", ""))
+	assert.Equal(t, http.StatusForbidden, ipFilterStatus(t, handler, "10.0.0.1, 198.51.100.7", ""), "the hop added by the trusted proxy is the client")
+	assert.Equal(t, http.StatusOK, ipFilterStatus(t, handler, "198.51.100.7, 10.0.0.1", ""), "earlier hops are client supplied")
+	assert.Equal(t, http.StatusForbidden, ipFilterStatus(t, handler, "2001:db8::1", ""))
+	assert.Equal(t, http.StatusForbidden, ipFilterStatus(t, handler, "", "203.0.113.10:4321"), "without proxy headers the remote address is used")
+	assert.Equal(t, http.StatusOK, ipFilterStatus(t, handler, "198.51.100.8", ""))
+	assert.Equal(t, http.StatusOK, ipFilterStatus(t, handler, "192.0.2.1", ""))
+}
+
+func TestIPFilterAllowlistTakesPrecedence(t *testing.T) {
+	handler := IPFilter(&config.IPFilterConfig{
+		Allowlist: []string{"10.0.0.0/8", "192.0.2.1"},
+		Blocklist: []string{"10.1.0.0/16"},
+	})
+
+	assert.Equal(t, http.StatusOK, ipFilterStatus(t, handler, "10.2.3.4", ""))
+	assert.Equal(t, http.StatusOK, ipFilterStatus(t, handler, "10.1.2.3", ""), "allowlisted addresses pass even when blocklisted")
+	assert.Equal(t, http.StatusOK, ipFilterStatus(t, handler, "::ffff:192.0.2.1", ""))
+	assert.Equal(t, http.StatusForbidden, ipFilterStatus(t, handler, "192.0.2.2", ""))
+	assert.Equal(t, http.StatusForbidden, ipFilterStatus(t, handler, "garbage", ""), "unparseable addresses are not allowlisted")
+}
+
+func TestIPFilterWithoutListsAllowsAll(t *testing.T) {
+	handler := IPFilter(&config.IPFilterConfig{})
+	assert.Equal(t, http.StatusOK, ipFilterStatus(t, handler, "203.0.113.9", ""))
+}
+
+func TestIPFilterIgnoresForwardingHeadersOfUntrustedPeers(t *testing.T) {
+	handler := IPFilter(&config.IPFilterConfig{Blocklist: []string{"203.0.113.0/24"}})
+
+	assert.Equal(t, http.StatusForbidden, ipFilterStatus(t, handler, "192.0.2.1", "203.0.113.10:4321"), "a blocked client cannot spoof X-Forwarded-For")
+
+	allowlisted := IPFilter(&config.IPFilterConfig{Allowlist: []string{"192.0.2.1"}})
+	assert.Equal(t, http.StatusForbidden, ipFilterStatus(t, allowlisted, "192.0.2.1", "198.51.100.20:4321"))
+	assert.Equal(t, http.StatusOK, ipFilterStatus(t, allowlisted, "192.0.2.1", ""))
+}
+
+func TestIPFilterUnparseableAddressFailsClosed(t *testing.T) {
+	handler := IPFilter(&config.IPFilterConfig{Blocklist: []string{"192.0.2.100", "203.0.113.0/24"}})
+
+	// A malformed forwarded address falls back to the remote address
+	assert.Equal(t, http.StatusForbidden, ipFilterStatus(t, handler, "garbage", ""))
+	assert.Equal(t, http.StatusForbidden, ipFilterStatus(t, handler, "", "unix-socket"), "unparseable remote addresses are rejected")
+	assert.Equal(t, http.StatusOK, ipFilterStatus(t, handler, "198.51.100.8", ""))
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIMethod names the API method of a request for APIKeyInfo.AllowedMethods:
+// the static segments of its route below /v1 joined by dots, so both
+// /v1/chat/completions and /v1/engines/:engine/chat/completions are "chat.completions"
+func APIMethod(c *gin.Context) string {
+	path := c.FullPath()
+	if path == "" {
+		path = c.Request.URL.Path
+	}
+	var parts []string
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "/v1/"), "/") {
+		if segment == "" || segment == "engines" || strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			continue
+		}
+		parts = append(parts, segment)
+	}
+	return strings.Join(parts, ".")
+}
+
+// KeyEntitlements enforces the AllowedMethods and TokenBudget of managed keys
+// accepted by APIKeyAuth, so it must be registered after it. Other requests pass.
+func KeyEntitlements(localAuth *security.LocalAuthenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, managed := c.Get(APIKeyInfoContextKey); !managed {
+			c.Next()
+			return
+		}
+
+		method := APIMethod(c)
+		switch err := localAuth.CheckKeyUsage(APIKeyFromRequest(c), method); {
+		case errors.Is(err, security.ErrMethodNotAllowed):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": gin.H{
+					"message": "This API key may not call " + method,
+					"type":    "permission_error",
+					"code":    "method_not_allowed",
+				},
+			})
+		case errors.Is(err, security.ErrTokenBudgetExhausted):
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": gin.H{
+					"message": "This API key has spent its token budget",
+					"type":    "insufficient_quota",
+					"code":    "token_budget_exhausted",
+				},
+			})
+		default:
+			c.Next()
+		}
+	}
+}
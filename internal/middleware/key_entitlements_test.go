@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyEntitlementsEnforceMethodsAndBudget(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{MaxAPIKeys: 10, APIKeyPrefix: "gw-"})
+	chatOnly, err := localAuth.GenerateAPIKey("api-user", "chat only", []string{"ai:chat"}, 0)
+	require.NoError(t, err)
+	require.NoError(t, localAuth.SetAllowedMethods(chatOnly, []string{"chat.completions"}))
+	budgeted, err := localAuth.GenerateAPIKey("api-user", "budgeted", []string{"ai:chat"}, 0)
+	require.NoError(t, err)
+	require.NoError(t, localAuth.SetTokenBudget(budgeted, 100))
+
+	r := gin.New()
+	api := r.Group("/v1", APIKeyAuth(config.NewSnapshot(&config.Config{GatewayKeys: []string{"static-key"}}), localAuth), KeyEntitlements(localAuth))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	api.POST("/chat/completions", ok)
+	api.POST("/engines/:engine/chat/completions", ok)
+	api.POST("/embeddings", ok)
+	call := func(apiKey, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, call(chatOnly, "/v1/chat/completions").Code)
+	assert.Equal(t, http.StatusOK, call(chatOnly, "/v1/engines/qwen/chat/completions").Code)
+	w := call(chatOnly, "/v1/embeddings")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "method_not_allowed")
+	assert.Equal(t, http.StatusOK, call("static-key", "/v1/embeddings").Code, "gateway keys are unrestricted")
+
+	localAuth.ChargeTokens(budgeted, 99)
+	assert.Equal(t, http.StatusOK, call(budgeted, "/v1/embeddings").Code)
+	localAuth.ChargeTokens(budgeted, 1)
+	w = call(budgeted, "/v1/chat/completions")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "token_budget_exhausted")
+}
@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// keyedKeyPrefix keeps per-key windows apart from the global rate_limit: keys
+const keyedKeyPrefix = "ratelimit:key:"
+
+// RatePolicy allows Requests per sliding Window
+type RatePolicy struct {
+	Requests int
+	Window   time.Duration
+}
+
+// KeyedRateLimiter 按 API Key 限流，使用 Redis 有序集合实现滑动窗口：
+// 窗口内每个被放行的请求是一个成员，分数为请求时间，超出窗口的成员被移除。
+// 被拒绝的请求不计入窗口，因此持续超限的客户端不会把自己永久锁住。
+// Redis 不可用（客户端为 nil 或调用失败）时降级为进程内窗口，限额按实例生效。
+type KeyedRateLimiter struct {
+	client  *redis.Client
+	keyFunc func(*gin.Context) string
+	policy  RatePolicy // for keys without a policy of their own; Requests 0 leaves them unlimited
+	lookup  func(c *gin.Context) (RatePolicy, bool)
+	now     func() time.Time
+	local   memoryWindows // fallback while Redis is unavailable
+}
+
+// NewKeyedRateLimiter creates a limiter counting requests per key returned by
+// keyFunc, e.g. AuthenticatedKeyID; requests for which keyFunc returns "" are
+// not limited. client may be nil to count in process memory only.
+func NewKeyedRateLimiter(client *redis.Client, keyFunc func(*gin.Context) string, policy RatePolicy) *KeyedRateLimiter {
+	return &KeyedRateLimiter{
+		client:  client,
+		keyFunc: keyFunc,
+		policy:  policy,
+		now:     time.Now,
+	}
+}
+
+// SetPolicyLookup installs a per-request policy source consulted before the default policy
+func (l *KeyedRateLimiter) SetPolicyLookup(lookup func(c *gin.Context) (RatePolicy, bool)) {
+	l.lookup = lookup
+}
+
+// APIKeyFromRequest returns the API key of a request from the Authorization
+// bearer token or the X-API-Key header, or ""
+func APIKeyFromRequest(c *gin.Context) string {
+	if token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return c.GetHeader("X-API-Key")
+}
+
+// AuthenticatedKeyID returns the ID of the key APIKeyAuth accepted, or "".
+// Unlike the raw credential, a client cannot vary it to get a fresh window.
+func AuthenticatedKeyID(c *gin.Context) string {
+	return c.GetString(APIKeyIDContextKey)
+}
+
+// APIKeyPolicies limits managed keys accepted by APIKeyAuth to their
+// APIKeyInfo.RateLimit per window. Gateway keys and unlimited keys fall back
+// to the default policy.
+func APIKeyPolicies(window time.Duration) func(c *gin.Context) (RatePolicy, bool) {
+	return func(c *gin.Context) (RatePolicy, bool) {
+		value, exists := c.Get(APIKeyInfoContextKey)
+		info, ok := value.(*security.APIKeyInfo)
+		if !exists || !ok || info.RateLimit <= 0 {
+			return RatePolicy{}, false
+		}
+		return RatePolicy{Requests: info.RateLimit, Window: window}, true
+	}
+}
+
+// policyFor returns the policy applying to the request
+func (l *KeyedRateLimiter) policyFor(c *gin.Context) RatePolicy {
+	if l.lookup != nil {
+		if policy, ok := l.lookup(c); ok {
+			return policy
+		}
+	}
+	return l.policy
+}
+
+// keyedWindowScript trims the window, admits the request when there is room
+// and returns {allowed, count, oldest score}. Scores are milliseconds.
+var keyedWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+local count = redis.call("ZCARD", KEYS[1])
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", KEYS[1], now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call("PEXPIRE", KEYS[1], window)
+
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+local first = now
+if oldest[2] then
+	first = tonumber(oldest[2])
+end
+return {allowed, count, first}
+`)
+
+// rateDecision is the outcome of counting one request
+type rateDecision struct {
+	allowed   bool
+	remaining int
+	resetAt   time.Time // when the oldest request leaves the window and frees a slot
+}
+
+// windowKey names key's window without storing the key itself
+func windowKey(key string) string {
+	digest := sha256.Sum256([]byte(key))
+	return keyedKeyPrefix + hex.EncodeToString(digest[:16])
+}
+
+// allow counts a request against key's sliding window in Redis
+func (l *KeyedRateLimiter) allow(ctx context.Context, key string, policy RatePolicy) (rateDecision, error) {
+	if l.client == nil {
+		return rateDecision{}, errRedisUnavailable
+	}
+	now := l.now()
+	member := make([]byte, 6)
+	rand.Read(member)
+	result, err := keyedWindowScript.Run(ctx, l.client,
+		[]string{windowKey(key)},
+		now.UnixMilli(), policy.Window.Milliseconds(), policy.Requests,
+		strconv.FormatInt(now.UnixMilli(), 10)+"-"+hex.EncodeToString(member),
+	).Int64Slice()
+	if err != nil {
+		return rateDecision{}, err
+	}
+
+	remaining := policy.Requests - int(result[1])
+	if remaining < 0 {
+		remaining = 0
+	}
+	return rateDecision{
+		allowed:   result[0] == 1,
+		remaining: remaining,
+		resetAt:   time.UnixMilli(result[2]).Add(policy.Window),
+	}, nil
+}
+
+// Middleware sets X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset
+// on every limited request and rejects requests over the key's policy with 429
+func (l *KeyedRateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := l.keyFunc(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+		policy := l.policyFor(c)
+		if policy.Requests <= 0 || policy.Window <= 0 {
+			c.Next()
+			return
+		}
+
+		decision, err := l.allow(c.Request.Context(), key, policy)
+		if err != nil {
+			if !errors.Is(err, errRedisUnavailable) {
+				logrus.WithError(err).Warn("API key rate limit check failed, using in-memory limits")
+			}
+			decision = l.local.limit([]rateScope{{key: windowKey(key), limit: policy.Requests}}, policy.Window, l.now())[0]
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(policy.Requests))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(decision.remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(float64(decision.resetAt.UnixMilli())/1000)), 10))
+		if !decision.allowed {
+			RecordRateLimitHit("api_key")
+			retryAfter := int(math.Ceil(decision.resetAt.Sub(l.now()).Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error": gin.H{
+					"message": "API key rate limit exceeded",
+					"type":    "rate_limit_error",
+					"code":    "api_key_rate_limit_exceeded",
+					"details": map[string]interface{}{
+						"limit":    policy.Requests,
+						"window":   policy.Window.String(),
+						"reset_at": decision.resetAt.Unix(),
+					},
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
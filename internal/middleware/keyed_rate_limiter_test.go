@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/security"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyedRateLimiterSlidingWindow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{MaxAPIKeys: 10})
+	limited, err := localAuth.GenerateAPIKey("api-user", "limited", []string{"ai:chat"}, 2)
+	require.NoError(t, err)
+	unlimited, err := localAuth.GenerateAPIKey("api-user", "default", []string{"ai:chat"}, 0)
+	require.NoError(t, err)
+
+	limiter := NewKeyedRateLimiter(client, AuthenticatedKeyID, RatePolicy{Requests: 3, Window: time.Minute})
+	limiter.SetPolicyLookup(APIKeyPolicies(time.Minute))
+	start := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	limiter.now = func() time.Time { return now }
+
+	live := config.NewSnapshot(&config.Config{GatewayKeys: []string{"gw-static-key"}})
+	r := gin.New()
+	r.Use(APIKeyAuth(live, localAuth), limiter.Middleware())
+	r.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+	call := func(apiKey string, at time.Duration) *httptest.ResponseRecorder {
+		now = start.Add(at)
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call(limited, 0)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"), "the key's own limit applies")
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, strconv.FormatInt(start.Add(time.Minute).Unix(), 10), w.Header().Get("X-RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusOK, call(limited, 30*time.Second).Code)
+	w = call(limited, 40*time.Second)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "20", w.Header().Get("Retry-After"), "the first request leaves the window at 60s")
+	assert.Contains(t, w.Body.String(), "api_key_rate_limit_exceeded")
+
+	// The window slides: one slot frees at 60s, the next only at 90s
+	assert.Equal(t, http.StatusOK, call(limited, 61*time.Second).Code)
+	w = call(limited, 62*time.Second)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "28", w.Header().Get("Retry-After"))
+
+	// Keys without a limit of their own share the default policy but not a window
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, call(unlimited, 62*time.Second).Code)
+		assert.Equal(t, http.StatusOK, call("gw-static-key", 62*time.Second).Code)
+	}
+	w = call("gw-static-key", 62*time.Second)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3", w.Header().Get("X-RateLimit-Limit"))
+
+	// Unknown tokens are rejected by APIKeyAuth and never open a window of their own
+	for i := 0; i < 5; i++ {
+		w = call("gw-random-"+strconv.Itoa(i), 62*time.Second)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+	}
+	assert.Len(t, mr.Keys(), 3, "one window per authenticated key")
+}
+
+func TestKeyedRateLimiterFallsBackToMemory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	limiter := NewKeyedRateLimiter(client, AuthenticatedKeyID, RatePolicy{Requests: 2, Window: time.Minute})
+	start := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return start }
+
+	live := config.NewSnapshot(&config.Config{GatewayKeys: []string{"sk-any", "sk-other"}})
+	r := gin.New()
+	r.Use(APIKeyAuth(live, nil), limiter.Middleware())
+	r.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+	mr.Close()
+
+	call := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, call("sk-any").Code)
+	}
+	w := call("sk-any")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "the limit still holds while Redis is down")
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, strconv.FormatInt(start.Add(time.Minute).Unix(), 10), w.Header().Get("X-RateLimit-Reset"))
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, call("sk-other").Code, "keys keep their own windows")
+
+	// Without a client the limiter counts in memory from the start
+	memory := NewKeyedRateLimiter(nil, AuthenticatedKeyID, RatePolicy{Requests: 1, Window: time.Minute})
+	r = gin.New()
+	r.Use(APIKeyAuth(live, nil), memory.Middleware())
+	r.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+	assert.Equal(t, http.StatusOK, call("sk-any").Code)
+	assert.Equal(t, http.StatusTooManyRequests, call("sk-any").Code)
+}
+
+func TestKeyedRateLimiterKeepsKeysApart(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	clients := map[string]*redis.Client{
+		"memory": nil,
+		"redis":  client,
+	}
+	for name, client := range clients {
+		t.Run(name, func(t *testing.T) {
+			localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{MaxAPIKeys: 10})
+			one, err := localAuth.GenerateAPIKey("api-user", "one", []string{"ai:chat"}, 1)
+			require.NoError(t, err)
+			three, err := localAuth.GenerateAPIKey("api-user", "three", []string{"ai:chat"}, 3)
+			require.NoError(t, err)
+			unlimited, err := localAuth.GenerateAPIKey("api-user", "unlimited", []string{"ai:chat"}, 0)
+			require.NoError(t, err)
+
+			limiter := NewKeyedRateLimiter(client, AuthenticatedKeyID, RatePolicy{Window: time.Minute})
+			limiter.SetPolicyLookup(APIKeyPolicies(time.Minute))
+			r := gin.New()
+			r.Use(APIKeyAuth(config.NewSnapshot(&config.Config{}), localAuth), limiter.Middleware())
+			r.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+			call := func(apiKey string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+				req.Header.Set("Authorization", "Bearer "+apiKey)
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+				return w
+			}
+
+			w := call(one)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "1", w.Header().Get("X-RateLimit-Limit"))
+			assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+			assert.NotEmpty(t, w.Header().Get("X-RateLimit-Reset"))
+			w = call(one)
+			assert.Equal(t, http.StatusTooManyRequests, w.Code)
+			assert.NotEmpty(t, w.Header().Get("Retry-After"))
+			assert.Contains(t, w.Body.String(), "api_key_rate_limit_exceeded")
+
+			// The exhausted key leaves the other key's window untouched
+			for i := 0; i < 3; i++ {
+				w = call(three)
+				assert.Equal(t, http.StatusOK, w.Code)
+			}
+			assert.Equal(t, "3", w.Header().Get("X-RateLimit-Limit"))
+			assert.Equal(t, http.StatusTooManyRequests, call(three).Code)
+
+			for i := 0; i < 10; i++ {
+				w = call(unlimited)
+				assert.Equal(t, http.StatusOK, w.Code)
+			}
+			assert.Empty(t, w.Header().Get("X-RateLimit-Limit"), "without a default policy RateLimit 0 is unlimited")
+		})
+	}
+}
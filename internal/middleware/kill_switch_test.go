@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/monitoring"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type killSwitchAlerts struct {
+	mu     sync.Mutex
+	firing map[string]bool
+}
+
+func (a *killSwitchAlerts) EvaluateRule(_ context.Context, rule *monitoring.Rule, _ float64, firing bool) {
+	a.mu.Lock()
+	a.firing[rule.ID] = firing
+	a.mu.Unlock()
+}
+
+func (a *killSwitchAlerts) isFiring(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.firing[id]
+}
+
+func TestKillSwitchAutoExpires(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	alerts := &killSwitchAlerts{firing: make(map[string]bool)}
+	ks := NewKillSwitches(client, config.KillSwitchConfig{
+		ConfirmWindow:   time.Minute,
+		MaxDuration:     4 * time.Hour,
+		TwoPersonRule:   true,
+		RefreshInterval: time.Minute,
+	}, nil, alerts)
+	ctx := context.Background()
+
+	_, _, err := ks.Arm(ctx, KillScopeTenant, "acme", "alice", "incident", 10*time.Hour)
+	require.NoError(t, err)
+	sw, change, err := ks.Arm(ctx, KillScopeTenant, "acme", "bob", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, KillSwitchActivated, change)
+	// The requested duration is capped at the maximum
+	assert.Equal(t, int64((4 * time.Hour).Seconds()), sw.DurationSeconds)
+	assert.True(t, ks.TenantKilled("acme"))
+
+	// Past the maximum the switch stops applying, its key expires and its alert resolves
+	mr.FastForward(5 * time.Hour)
+	later := time.Now().Add(5 * time.Hour)
+	ks.now = func() time.Time { return later }
+	assert.False(t, ks.TenantKilled("acme"))
+	ks.refresh(ctx)
+	assert.False(t, alerts.isFiring("kill_switch_tenant_acme"))
+	switches, err := ks.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, switches)
+}
+
+func TestKillSwitchWithoutRedis(t *testing.T) {
+	ks := NewKillSwitches(nil, config.KillSwitchConfig{
+		ConfirmWindow:   time.Minute,
+		MaxDuration:     time.Hour,
+		RefreshInterval: time.Minute,
+	}, nil, nil)
+	ctx := context.Background()
+
+	// Without the two-person rule the requester may confirm a second time
+	_, change, err := ks.Arm(ctx, KillScopeProvider, "dashscope", "alice", "leaked key", 0)
+	require.NoError(t, err)
+	assert.Equal(t, KillSwitchRequested, change)
+	assert.False(t, ks.ProviderKilled("dashscope"))
+	_, change, err = ks.Arm(ctx, KillScopeProvider, "dashscope", "alice", "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, KillSwitchActivated, change)
+	assert.True(t, ks.ProviderKilled("dashscope"))
+
+	_, _, err = ks.Arm(ctx, "region", "eu", "alice", "", 0)
+	assert.ErrorIs(t, err, ErrInvalidKillSwitch)
+	_, err = ks.Lift(ctx, KillScopeTenant, "acme", "alice")
+	assert.ErrorIs(t, err, ErrKillSwitchNotFound)
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// memoryKeyWindows 进程内的按 Key 滑动窗口，Redis 不可用时使用
+type memoryKeyWindows struct {
+	mutex     sync.Mutex
+	requests  map[string][]time.Time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func newMemoryKeyWindows() *memoryKeyWindows {
+	return &memoryKeyWindows{
+		requests: make(map[string][]time.Time),
+		now:      time.Now,
+	}
+}
+
+// allow admits a request for key when fewer than limit were admitted in the
+// last window and returns the requests left
+func (w *memoryKeyWindows) allow(key string, limit int, window time.Duration) (bool, int) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	now := w.now()
+	windowStart := now.Add(-window)
+	if now.Sub(w.lastSweep) >= window {
+		// Idle keys are dropped once per window so the map does not grow unbounded
+		for k, times := range w.requests {
+			if len(times) == 0 || !times[len(times)-1].After(windowStart) {
+				delete(w.requests, k)
+			}
+		}
+		w.lastSweep = now
+	}
+
+	times := w.requests[key]
+	kept := times[:0]
+	for _, t := range times {
+		if t.After(windowStart) {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) >= limit {
+		w.requests[key] = kept
+		return false, 0
+	}
+	kept = append(kept, now)
+	w.requests[key] = kept
+	return true, limit - len(kept)
+}
+
+// MemoryWindows is an in-process sliding window limiter for arbitrary keys,
+// such as the routes of the dynamic route proxy
+type MemoryWindows struct {
+	windows *memoryKeyWindows
+}
+
+// NewMemoryWindows creates an empty set of sliding windows
+func NewMemoryWindows() *MemoryWindows {
+	return &MemoryWindows{windows: newMemoryKeyWindows()}
+}
+
+// Allow admits a request for key when fewer than limit were admitted in the
+// last window and returns the requests left
+func (m *MemoryWindows) Allow(key string, limit int, window time.Duration) (bool, int) {
+	return m.windows.allow(key, limit, window)
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryKeyWindowsSlide(t *testing.T) {
+	windows := newMemoryKeyWindows()
+	start := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	windows.now = func() time.Time { return now }
+
+	allowed, remaining := windows.allow("key", 2, time.Minute)
+	assert.True(t, allowed)
+	assert.Equal(t, 1, remaining)
+	now = start.Add(30 * time.Second)
+	allowed, _ = windows.allow("key", 2, time.Minute)
+	assert.True(t, allowed)
+	allowed, _ = windows.allow("key", 2, time.Minute)
+	assert.False(t, allowed)
+
+	// The first request leaves the window after a minute
+	now = start.Add(61 * time.Second)
+	allowed, remaining = windows.allow("key", 2, time.Minute)
+	assert.True(t, allowed)
+	assert.Equal(t, 0, remaining)
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/security"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricDimensionsLabelScrapeOutput(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	auth := security.NewLocalAuthenticator(&config.SecurityConfig{
+		JWTSecret:    "secret",
+		APIKeyPrefix: "gw-",
+		MaxAPIKeys:   10,
+	})
+	chatbot, err := auth.GenerateAPIKey("api-user", "chatbot", []string{"ai:chat"}, 60)
+	require.NoError(t, err)
+	require.NoError(t, auth.SetMetricDimensions(chatbot, map[string]string{"product": "chatbot", "tier": "premium"}))
+	search, err := auth.GenerateAPIKey("api-user", "search", []string{"ai:chat"}, 60)
+	require.NoError(t, err)
+	require.NoError(t, auth.SetMetricDimensions(search, map[string]string{"product": "search", "team": "discovery"}))
+	plain, err := auth.GenerateAPIKey("api-user", "plain", []string{"ai:chat"}, 60)
+	require.NoError(t, err)
+
+	reg := prometheus.NewRegistry()
+	r := gin.New()
+	r.Use(AdvancedPrometheusMetrics(NewAdvancedMetricsCollector(client, reg), auth.MetricDimensions))
+	r.GET("/v1/dimension-test", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/metrics", gin.WrapH(promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
+
+	for _, key := range []string{chatbot, search, search, plain} {
+		req := httptest.NewRequest(http.MethodGet, "/v1/dimension-test", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	// Labels are sorted; dimensions a key lacks are empty, which PromQL treats as absent
+	assert.Contains(t, body, `aigateway_api_key_dimension_requests_total{endpoint="/v1/dimension-test",product="chatbot",status="200",team="",tier="premium"} 1`)
+	assert.Contains(t, body, `aigateway_api_key_dimension_requests_total{endpoint="/v1/dimension-test",product="search",status="200",team="discovery",tier=""} 2`)
+	assert.Contains(t, body, `aigateway_api_key_dimension_request_duration_seconds_total{endpoint="/v1/dimension-test",product="search",status="200",team="discovery",tier=""}`)
+}
+
+func TestMetricDimensionValidation(t *testing.T) {
+	assert.NoError(t, security.ValidateMetricDimensions(nil))
+	assert.NoError(t, security.ValidateMetricDimensions(map[string]string{"product": "chatbot", "cost_center": "42"}))
+
+	for _, dimensions := range []map[string]string{
+		{"Product": "chatbot"},
+		{"product-name": "chatbot"},
+		{"__name": "x"},
+		{"status": "gold"},
+		{"product": ""},
+		{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5", "f": "6"},
+	} {
+		assert.Error(t, security.ValidateMetricDimensions(dimensions), dimensions)
+	}
+}
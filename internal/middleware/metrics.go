@@ -3,135 +3,379 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"go-aigateway/internal/monitoring"
+
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
 )
 
+// metricsFactory registers the gateway's metrics with the monitoring registry
+var metricsFactory = promauto.With(monitoring.Registry())
+
 var (
-	httpRequestsTotal = promauto.NewCounterVec(
+	httpRequestsTotal = metricsFactory.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "http_requests_total",
+			Name: "aigateway_http_requests_total",
 			Help: "Total number of HTTP requests",
 		},
-		[]string{"method", "endpoint", "status"},
+		[]string{"method", "endpoint", "status", "sandbox"},
 	)
 
-	httpRequestDuration = promauto.NewHistogramVec(
+	httpRequestDuration = metricsFactory.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name:    "http_request_duration_seconds",
+			Name:    "aigateway_http_request_duration_seconds",
 			Help:    "HTTP request duration in seconds",
 			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 2, 5, 10},
 		},
-		[]string{"method", "endpoint"},
+		[]string{"method", "endpoint", "sandbox"},
 	)
 
-	apiKeyUsage = promauto.NewCounterVec(
+	apiKeyUsage = metricsFactory.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "api_key_usage_total",
+			Name: "aigateway_api_key_usage_total",
 			Help: "Total number of API key usages",
 		},
 		[]string{"key_prefix"},
 	)
 
-	rateLimitHits = promauto.NewCounterVec(
+	rateLimitHits = metricsFactory.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "rate_limit_hits_total",
+			Name: "aigateway_rate_limit_hits_total",
 			Help: "Total number of rate limit hits",
 		},
 		[]string{"client_ip"},
 	)
 
-	proxyRequestsTotal = promauto.NewCounterVec(
+	proxyRequestsTotal = metricsFactory.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "proxy_requests_total",
+			Name: "aigateway_proxy_requests_total",
 			Help: "Total number of proxy requests",
 		},
 		[]string{"endpoint", "status"},
 	)
 
-	proxyRequestDuration = promauto.NewHistogramVec(
+	proxyRequestDuration = metricsFactory.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name:    "proxy_request_duration_seconds",
+			Name:    "aigateway_proxy_request_duration_seconds",
 			Help:    "Proxy request duration in seconds",
 			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 2, 5, 10},
 		},
 		[]string{"endpoint"},
 	)
 
+	routeSchemaViolations = metricsFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aigateway_route_schema_violations_total",
+			Help: "Total number of route JSON schema contract violations",
+		},
+		[]string{"route", "direction", "pointer_prefix"},
+	)
+
+	unmeteredStreams = metricsFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aigateway_unmetered_streams_total",
+			Help: "Total number of streamed responses that ended without reporting token usage",
+		},
+		[]string{"model"},
+	)
+
+	internalSummarizations = metricsFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aigateway_internal_summarization_requests_total",
+			Help: "Total number of gateway-internal conversation summarization calls",
+		},
+		[]string{"outcome"},
+	)
+
+	sentinelRuns = metricsFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aigateway_sentinel_runs_total",
+			Help: "Total number of gateway-internal sentinel prompt runs",
+		},
+		[]string{"sentinel", "outcome"},
+	)
+
+	sentinelTokens = metricsFactory.NewCounter(
+		prometheus.CounterOpts{
+			Name: "aigateway_sentinel_tokens_total",
+			Help: "Total number of tokens spent by sentinel prompt runs",
+		},
+	)
+
+	ensembleRequests = metricsFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aigateway_ensemble_requests_total",
+			Help: "Total number of ensemble requests fanned out to several models",
+		},
+		[]string{"aggregation", "outcome"},
+	)
+
+	featureFlagAssignments = metricsFactory.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "aigateway_feature_flag_assignments_total",
+			Help: "Total number of per-request feature flag assignments",
+		},
+		[]string{"flag", "variant"},
+	)
+
 	// 新增的高级监控指标
-	backendSuccessRate = promauto.NewGaugeVec(
+	backendSuccessRate = metricsFactory.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "backend_success_rate",
+			Name: "aigateway_backend_success_rate",
 			Help: "Backend service success rate percentage",
 		},
 		[]string{"backend", "endpoint"},
 	)
 
-	requestQPS = promauto.NewGaugeVec(
+	requestQPS = metricsFactory.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "request_qps",
+			Name: "aigateway_request_qps",
 			Help: "Current requests per second",
 		},
 		[]string{"endpoint"},
 	)
 
-	concurrentConnections = promauto.NewGauge(
+	concurrentConnections = metricsFactory.NewGauge(
 		prometheus.GaugeOpts{
-			Name: "concurrent_connections",
+			Name: "aigateway_concurrent_connections",
 			Help: "Current number of concurrent connections",
 		},
 	)
 
-	errorRate = promauto.NewGaugeVec(
+	errorRate = metricsFactory.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "error_rate",
+			Name: "aigateway_error_rate",
 			Help: "Error rate percentage",
 		},
 		[]string{"endpoint"},
 	)
 
-	responseTimePercentile = promauto.NewHistogramVec(
+	responseTimePercentile = metricsFactory.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name:    "response_time_percentile_seconds",
+			Name:    "aigateway_response_time_percentile_seconds",
 			Help:    "Response time percentiles",
 			Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 2, 5, 10},
 		},
 		[]string{"endpoint", "percentile"},
 	)
 
-	activeUsers = promauto.NewGauge(
+	activeUsers = metricsFactory.NewGauge(
 		prometheus.GaugeOpts{
-			Name: "active_users",
+			Name: "aigateway_active_users",
 			Help: "Number of active users in the last minute",
 		},
 	)
 
-	bytesTransferred = promauto.NewCounterVec(
+	bytesTransferred = metricsFactory.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "bytes_transferred_total",
+			Name: "aigateway_bytes_transferred_total",
 			Help: "Total bytes transferred",
 		},
 		[]string{"direction"}, // "in" or "out"
 	)
 )
 
+// dimensionSeries is one combination of endpoint, status and key dimensions
+type dimensionSeries struct {
+	endpoint   string
+	status     string
+	dimensions map[string]string
+	count      float64
+	seconds    float64
+}
+
+// dimensionCollector 按 API 密钥自定义维度（如 product、tier）统计请求。不同密钥的维度名
+// 各不相同，因此每次抓取都以所有已出现维度名的并集作为标签，密钥缺少的维度取空值——
+// Prometheus 将空值标签视为不存在，所以新维度出现时已有序列的身份不变。
+type dimensionCollector struct {
+	mu     sync.Mutex
+	names  map[string]bool
+	series map[string]*dimensionSeries
+}
+
+func newDimensionCollector() *dimensionCollector {
+	return &dimensionCollector{
+		names:  make(map[string]bool),
+		series: make(map[string]*dimensionSeries),
+	}
+}
+
+func (dc *dimensionCollector) observe(endpoint, status string, dimensions map[string]string, duration time.Duration) {
+	names := make([]string, 0, len(dimensions))
+	for name := range dimensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var key strings.Builder
+	key.WriteString(endpoint + "\xff" + status)
+	for _, name := range names {
+		key.WriteString("\xff" + name + "=" + dimensions[name])
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	series, ok := dc.series[key.String()]
+	if !ok {
+		series = &dimensionSeries{endpoint: endpoint, status: status, dimensions: dimensions}
+		dc.series[key.String()] = series
+		for _, name := range names {
+			dc.names[name] = true
+		}
+	}
+	series.count++
+	series.seconds += duration.Seconds()
+}
+
+// Describe sends nothing: the label set grows with the dimensions in use, so the collector is unchecked
+func (dc *dimensionCollector) Describe(chan<- *prometheus.Desc) {}
+
+// Collect emits every series with the union of dimension names as labels
+func (dc *dimensionCollector) Collect(ch chan<- prometheus.Metric) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	names := make([]string, 0, len(dc.names))
+	for name := range dc.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	labels := append([]string{"endpoint", "status"}, names...)
+	requests := prometheus.NewDesc("aigateway_api_key_dimension_requests_total",
+		"Total number of requests by the metric dimensions of their API key", labels, nil)
+	seconds := prometheus.NewDesc("aigateway_api_key_dimension_request_duration_seconds_total",
+		"Total request duration in seconds by the metric dimensions of their API key", labels, nil)
+
+	for _, series := range dc.series {
+		values := make([]string, 0, len(labels))
+		values = append(values, series.endpoint, series.status)
+		for _, name := range names {
+			values = append(values, series.dimensions[name])
+		}
+		ch <- prometheus.MustNewConstMetric(requests, prometheus.CounterValue, series.count, values...)
+		ch <- prometheus.MustNewConstMetric(seconds, prometheus.CounterValue, series.seconds, values...)
+	}
+}
+
 // AdvancedMetricsCollector 高级指标收集器
 type AdvancedMetricsCollector struct {
+	clientMu    sync.RWMutex
 	redisClient *redis.Client
+	// requestsByDimension counts requests by the metric dimensions of their API key
+	requestsByDimension *dimensionCollector
+	// buffer holds the real-time metrics of requests served while Redis is unavailable
+	buffer metricsBuffer
 }
 
-// NewAdvancedMetricsCollector 创建高级指标收集器
-func NewAdvancedMetricsCollector(redisClient *redis.Client) *AdvancedMetricsCollector {
-	return &AdvancedMetricsCollector{
-		redisClient: redisClient,
+const (
+	// maxBufferedSamples bounds the response times kept while Redis is
+	// unavailable, as many as the Redis sample list holds
+	maxBufferedSamples = 100
+	// maxBufferedUsers bounds the active users remembered during an outage
+	maxBufferedUsers = 10000
+)
+
+// metricsBuffer 在 Redis 不可用时于本地累计实时指标，Redis 恢复后的下一次收集写回
+type metricsBuffer struct {
+	mutex    sync.Mutex
+	requests int64
+	errors   int64
+	samples  []float64
+	users    map[string]struct{}
+}
+
+func (b *metricsBuffer) record(status int, duration time.Duration, userKey string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.requests++
+	if status >= 400 {
+		b.errors++
+	}
+	b.samples = append(b.samples, duration.Seconds())
+	if len(b.samples) > maxBufferedSamples {
+		b.samples = b.samples[len(b.samples)-maxBufferedSamples:]
+	}
+	if b.users == nil {
+		b.users = make(map[string]struct{})
+	}
+	if len(b.users) < maxBufferedUsers {
+		b.users[userKey] = struct{}{}
 	}
 }
 
+// take empties the buffer and returns its contents
+func (b *metricsBuffer) take() (requests, errors int64, samples []float64, users []string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for user := range b.users {
+		users = append(users, user)
+	}
+	requests, errors, samples = b.requests, b.errors, b.samples
+	b.requests, b.errors, b.samples, b.users = 0, 0, nil, nil
+	return requests, errors, samples, users
+}
+
+// restore puts back contents that could not be written to Redis
+func (b *metricsBuffer) restore(requests, errors int64, samples []float64, users []string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.requests += requests
+	b.errors += errors
+	b.samples = append(samples, b.samples...)
+	if len(b.samples) > maxBufferedSamples {
+		b.samples = b.samples[len(b.samples)-maxBufferedSamples:]
+	}
+	if b.users == nil {
+		b.users = make(map[string]struct{})
+	}
+	for _, user := range users {
+		if len(b.users) >= maxBufferedUsers {
+			break
+		}
+		b.users[user] = struct{}{}
+	}
+}
+
+// NewAdvancedMetricsCollector 创建高级指标收集器。按维度的请求指标注册到 reg，
+// 每个注册表只应注册一个收集器；reg 为 nil 时不导出这些指标。
+// redisClient 可为 nil，此时实时指标缓存在本地，直到 SetRedisClient 提供客户端。
+func NewAdvancedMetricsCollector(redisClient *redis.Client, reg prometheus.Registerer) *AdvancedMetricsCollector {
+	collector := &AdvancedMetricsCollector{
+		redisClient:         redisClient,
+		requestsByDimension: newDimensionCollector(),
+	}
+	if reg != nil {
+		reg.MustRegister(collector.requestsByDimension)
+	}
+	return collector
+}
+
+// SetRedisClient switches the collector to client, e.g. once Redis is
+// reachable after starting without it. Buffered metrics are written on the
+// next collection.
+func (amc *AdvancedMetricsCollector) SetRedisClient(client *redis.Client) {
+	amc.clientMu.Lock()
+	amc.redisClient = client
+	amc.clientMu.Unlock()
+}
+
+func (amc *AdvancedMetricsCollector) client() *redis.Client {
+	amc.clientMu.RLock()
+	defer amc.clientMu.RUnlock()
+	return amc.redisClient
+}
+
 // PrometheusMetrics middleware to collect metrics
 func PrometheusMetrics() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -147,14 +391,20 @@ func PrometheusMetrics() gin.HandlerFunc {
 		status := strconv.Itoa(c.Writer.Status())
 		endpoint := c.FullPath()
 		method := c.Request.Method
+		sandbox := strconv.FormatBool(c.GetBool(SandboxContextKey))
 
 		// 记录基础指标
-		httpRequestsTotal.WithLabelValues(method, endpoint, status).Inc()
-		httpRequestDuration.WithLabelValues(method, endpoint).Observe(duration)
+		httpRequestsTotal.WithLabelValues(method, endpoint, status, sandbox).Inc()
+		httpRequestDuration.WithLabelValues(method, endpoint, sandbox).Observe(duration)
 
 		// 记录字节传输量
-		bytesTransferred.WithLabelValues("in").Add(float64(c.Request.ContentLength))
-		bytesTransferred.WithLabelValues("out").Add(float64(c.Writer.Size()))
+		// 未知长度为 -1，计数器不能减少
+		if c.Request.ContentLength > 0 {
+			bytesTransferred.WithLabelValues("in").Add(float64(c.Request.ContentLength))
+		}
+		if c.Writer.Size() > 0 {
+			bytesTransferred.WithLabelValues("out").Add(float64(c.Writer.Size()))
+		}
 
 		// 记录响应时间百分位数
 		responseTimePercentile.WithLabelValues(endpoint, "p50").Observe(duration)
@@ -163,8 +413,9 @@ func PrometheusMetrics() gin.HandlerFunc {
 	})
 }
 
-// AdvancedPrometheusMetrics 高级Prometheus指标中间件
-func AdvancedPrometheusMetrics(collector *AdvancedMetricsCollector) gin.HandlerFunc {
+// AdvancedPrometheusMetrics 高级Prometheus指标中间件。dimensionsFor 返回 API 密钥的自定义
+// 指标维度（可为 nil），带维度的密钥的请求额外按维度计数。
+func AdvancedPrometheusMetrics(collector *AdvancedMetricsCollector, dimensionsFor func(apiKey string) map[string]string) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		start := time.Now()
 		endpoint := c.FullPath()
@@ -174,27 +425,49 @@ func AdvancedPrometheusMetrics(collector *AdvancedMetricsCollector) gin.HandlerF
 		duration := time.Since(start)
 		status := c.Writer.Status()
 
-		// 更新Redis中的实时指标
+		if dimensionsFor != nil {
+			if token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); token != "" {
+				if dimensions := dimensionsFor(token); len(dimensions) > 0 {
+					collector.requestsByDimension.observe(endpoint, strconv.Itoa(status), dimensions, duration)
+				}
+			}
+		}
+
+		// 更新Redis中的实时指标。The user is read here as gin reuses the context
+		// once the request completes.
+		userKey := c.GetHeader("Authorization")
+		if userKey == "" {
+			userKey = c.ClientIP()
+		}
 		ctx := context.Background()
-		go collector.updateRealTimeMetrics(ctx, endpoint, status, duration, c)
+		go collector.updateRealTimeMetrics(ctx, endpoint, status, duration, userKey)
 	})
 }
 
-// updateRealTimeMetrics 更新实时指标到Redis
-func (amc *AdvancedMetricsCollector) updateRealTimeMetrics(ctx context.Context, endpoint string, status int, duration time.Duration, c *gin.Context) {
+// updateRealTimeMetrics 更新实时指标到Redis；Redis 不可用时缓存在本地
+func (amc *AdvancedMetricsCollector) updateRealTimeMetrics(ctx context.Context, endpoint string, status int, duration time.Duration, userKey string) {
+	client := amc.client()
+	if client == nil {
+		amc.buffer.record(status, duration, userKey)
+		return
+	}
+
 	// 更新QPS统计
 	qpsKey := "metrics:qps:current"
-	amc.redisClient.Incr(ctx, qpsKey)
-	amc.redisClient.Expire(ctx, qpsKey, time.Second)
+	if err := client.Incr(ctx, qpsKey).Err(); err != nil {
+		amc.buffer.record(status, duration, userKey)
+		return
+	}
+	client.Expire(ctx, qpsKey, time.Second)
 
 	// 更新平均响应时间（使用滑动窗口）
 	responseTimeKey := "metrics:response_time:samples"
-	amc.redisClient.RPush(ctx, responseTimeKey, duration.Seconds())
-	amc.redisClient.LTrim(ctx, responseTimeKey, -100, -1) // 保持最近100个样本
-	amc.redisClient.Expire(ctx, responseTimeKey, time.Minute*5)
+	client.RPush(ctx, responseTimeKey, duration.Seconds())
+	client.LTrim(ctx, responseTimeKey, -100, -1) // 保持最近100个样本
+	client.Expire(ctx, responseTimeKey, time.Minute*5)
 
 	// 计算平均响应时间
-	samples, _ := amc.redisClient.LRange(ctx, responseTimeKey, 0, -1).Result()
+	samples, _ := client.LRange(ctx, responseTimeKey, 0, -1).Result()
 	if len(samples) > 0 {
 		var total float64
 		for _, sample := range samples {
@@ -203,29 +476,29 @@ func (amc *AdvancedMetricsCollector) updateRealTimeMetrics(ctx context.Context,
 			}
 		}
 		avg := total / float64(len(samples))
-		amc.redisClient.Set(ctx, "metrics:response_time:avg", avg, time.Minute*5)
+		client.Set(ctx, "metrics:response_time:avg", avg, time.Minute*5)
 	}
 
 	// 更新错误率统计
 	errorKey := "metrics:errors:total"
 	totalKey := "metrics:requests:total"
 
-	amc.redisClient.Incr(ctx, totalKey)
-	amc.redisClient.Expire(ctx, totalKey, time.Minute)
+	client.Incr(ctx, totalKey)
+	client.Expire(ctx, totalKey, time.Minute)
 
 	if status >= 400 {
-		amc.redisClient.Incr(ctx, errorKey)
-		amc.redisClient.Expire(ctx, errorKey, time.Minute)
+		client.Incr(ctx, errorKey)
+		client.Expire(ctx, errorKey, time.Minute)
 	}
 
 	// 计算错误率
 	go func() {
-		errorCount, _ := amc.redisClient.Get(ctx, errorKey).Int()
-		totalCount, _ := amc.redisClient.Get(ctx, totalKey).Int()
+		errorCount, _ := client.Get(ctx, errorKey).Int()
+		totalCount, _ := client.Get(ctx, totalKey).Int()
 
 		if totalCount > 0 {
 			errorRateVal := float64(errorCount) / float64(totalCount) * 100
-			amc.redisClient.Set(ctx, "metrics:error_rate:current", errorRateVal, time.Minute*5)
+			client.Set(ctx, "metrics:error_rate:current", errorRateVal, time.Minute*5)
 			errorRate.WithLabelValues(endpoint).Set(errorRateVal)
 		}
 	}()
@@ -235,33 +508,28 @@ func (amc *AdvancedMetricsCollector) updateRealTimeMetrics(ctx context.Context,
 		backendSuccessRate.WithLabelValues("backend", endpoint).Set(100.0)
 	} else {
 		// 计算最近的成功率
-		go amc.calculateBackendSuccessRate(ctx, endpoint)
+		go amc.calculateBackendSuccessRate(ctx, client, endpoint)
 	}
 
 	// 更新活跃用户数（基于IP和API Key）
-	userKey := c.GetHeader("Authorization")
-	if userKey == "" {
-		userKey = c.ClientIP()
-	}
-
 	activeUserKey := "metrics:active_users"
-	amc.redisClient.SAdd(ctx, activeUserKey, userKey)
-	amc.redisClient.Expire(ctx, activeUserKey, time.Minute)
+	client.SAdd(ctx, activeUserKey, userKey)
+	client.Expire(ctx, activeUserKey, time.Minute)
 
 	// 更新活跃用户数指标
 	go func() {
-		count, _ := amc.redisClient.SCard(ctx, activeUserKey).Result()
+		count, _ := client.SCard(ctx, activeUserKey).Result()
 		activeUsers.Set(float64(count))
 	}()
 }
 
 // calculateBackendSuccessRate 计算后端成功率
-func (amc *AdvancedMetricsCollector) calculateBackendSuccessRate(ctx context.Context, endpoint string) {
+func (amc *AdvancedMetricsCollector) calculateBackendSuccessRate(ctx context.Context, client *redis.Client, endpoint string) {
 	successKey := fmt.Sprintf("metrics:backend:success:%s", endpoint)
 	totalKey := fmt.Sprintf("metrics:backend:total:%s", endpoint)
 
-	successCount, _ := amc.redisClient.Get(ctx, successKey).Int()
-	totalCount, _ := amc.redisClient.Get(ctx, totalKey).Int()
+	successCount, _ := client.Get(ctx, successKey).Int()
+	totalCount, _ := client.Get(ctx, totalKey).Int()
 
 	if totalCount > 0 {
 		successRateVal := float64(successCount) / float64(totalCount) * 100
@@ -286,25 +554,76 @@ func (amc *AdvancedMetricsCollector) StartMetricsCollector(ctx context.Context)
 
 // collectAndUpdateMetrics 收集并更新指标
 func (amc *AdvancedMetricsCollector) collectAndUpdateMetrics(ctx context.Context) {
+	client := amc.client()
+	if client == nil {
+		return
+	}
+
+	// 写回 Redis 不可用期间缓存的指标
+	if err := amc.flushBuffer(ctx, client); err != nil {
+		logrus.WithError(err).Debug("Redis unavailable, keeping real-time metrics buffered")
+		return
+	}
+
 	// 更新QPS指标
-	qpsStr, _ := amc.redisClient.Get(ctx, "metrics:qps:current").Result()
+	qpsStr, _ := client.Get(ctx, "metrics:qps:current").Result()
 	if qps, err := strconv.Atoi(qpsStr); err == nil {
 		requestQPS.WithLabelValues("total").Set(float64(qps * 6)) // 转换为每分钟请求数
 	}
 
 	// 清理过期的指标数据
-	amc.cleanupExpiredMetrics(ctx)
+	amc.cleanupExpiredMetrics(ctx, client)
+}
+
+// flushBuffer writes the metrics buffered while Redis was unavailable; they
+// stay buffered when the write fails
+func (amc *AdvancedMetricsCollector) flushBuffer(ctx context.Context, client *redis.Client) error {
+	requests, errors, samples, users := amc.buffer.take()
+	if requests == 0 {
+		return nil
+	}
+
+	pipe := client.TxPipeline()
+	pipe.IncrBy(ctx, "metrics:requests:total", requests)
+	pipe.Expire(ctx, "metrics:requests:total", time.Minute)
+	if errors > 0 {
+		pipe.IncrBy(ctx, "metrics:errors:total", errors)
+		pipe.Expire(ctx, "metrics:errors:total", time.Minute)
+	}
+	if len(samples) > 0 {
+		values := make([]interface{}, len(samples))
+		for i, sample := range samples {
+			values[i] = sample
+		}
+		pipe.RPush(ctx, "metrics:response_time:samples", values...)
+		pipe.LTrim(ctx, "metrics:response_time:samples", -maxBufferedSamples, -1)
+		pipe.Expire(ctx, "metrics:response_time:samples", time.Minute*5)
+	}
+	if len(users) > 0 {
+		members := make([]interface{}, len(users))
+		for i, user := range users {
+			members[i] = user
+		}
+		pipe.SAdd(ctx, "metrics:active_users", members...)
+		pipe.Expire(ctx, "metrics:active_users", time.Minute)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		amc.buffer.restore(requests, errors, samples, users)
+		return err
+	}
+	logrus.WithField("requests", requests).Info("Flushed real-time metrics buffered while Redis was unavailable")
+	return nil
 }
 
 // cleanupExpiredMetrics 清理过期的指标数据
-func (amc *AdvancedMetricsCollector) cleanupExpiredMetrics(ctx context.Context) {
+func (amc *AdvancedMetricsCollector) cleanupExpiredMetrics(ctx context.Context, client *redis.Client) {
 	// 清理过期的QPS数据
 	pattern := "metrics:qps:*"
-	keys, _ := amc.redisClient.Keys(ctx, pattern).Result()
+	keys, _ := client.Keys(ctx, pattern).Result()
 	for _, key := range keys {
-		ttl, _ := amc.redisClient.TTL(ctx, key).Result()
+		ttl, _ := client.TTL(ctx, key).Result()
 		if ttl < 0 { // 没有过期时间的key
-			amc.redisClient.Del(ctx, key)
+			client.Del(ctx, key)
 		}
 	}
 }
@@ -319,6 +638,47 @@ func RecordRateLimitHit(clientIP string) {
 	rateLimitHits.WithLabelValues(clientIP).Inc()
 }
 
+// RecordSchemaViolation records a route schema contract violation, grouped by the
+// first segment of the failing JSON pointer to keep label cardinality bounded
+func RecordSchemaViolation(route, direction, pointer string) {
+	prefix := "/"
+	if parts := strings.SplitN(strings.TrimPrefix(pointer, "/"), "/", 2); parts[0] != "" {
+		prefix = "/" + parts[0]
+	}
+	routeSchemaViolations.WithLabelValues(route, direction, prefix).Inc()
+}
+
+// RecordUnmeteredStream records a streamed response whose upstream reported no usage
+func RecordUnmeteredStream(model string) {
+	unmeteredStreams.WithLabelValues(model).Inc()
+}
+
+// RecordInternalSummarization records an internal summarization call (success, failure)
+func RecordInternalSummarization(outcome string) {
+	internalSummarizations.WithLabelValues(outcome).Inc()
+}
+
+// RecordSentinelRun records an internal sentinel run (ok, drift, error, skipped) and the tokens it spent
+func RecordSentinelRun(sentinel, outcome string, tokens int) {
+	sentinelRuns.WithLabelValues(sentinel, outcome).Inc()
+	sentinelTokens.Add(float64(tokens))
+}
+
+// RecordEnsembleRequest records an ensemble request by aggregation and outcome (success, partial, failure)
+func RecordEnsembleRequest(aggregation, outcome string) {
+	ensembleRequests.WithLabelValues(aggregation, outcome).Inc()
+}
+
+// RecordFeatureFlagAssignment records the variant a request was assigned for a flag.
+// Callers bound the flag label to defined flags.
+func RecordFeatureFlagAssignment(flag string, enabled bool) {
+	variant := "off"
+	if enabled {
+		variant = "on"
+	}
+	featureFlagAssignments.WithLabelValues(flag, variant).Inc()
+}
+
 // RecordProxyRequest records proxy request metrics
 func RecordProxyRequest(endpoint string, status int, duration time.Duration) {
 	statusStr := strconv.Itoa(status)
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdvancedMetricsBufferWhileRedisUnavailable(t *testing.T) {
+	ctx := context.Background()
+	collector := NewAdvancedMetricsCollector(nil, nil)
+
+	collector.updateRealTimeMetrics(ctx, "/v1/chat/completions", http.StatusOK, 100*time.Millisecond, "Bearer sk-one")
+	collector.updateRealTimeMetrics(ctx, "/v1/chat/completions", http.StatusOK, 200*time.Millisecond, "Bearer sk-two")
+	collector.updateRealTimeMetrics(ctx, "/v1/chat/completions", http.StatusBadGateway, 300*time.Millisecond, "Bearer sk-one")
+	collector.collectAndUpdateMetrics(ctx)
+
+	// A failing flush keeps the metrics buffered
+	down := miniredis.RunT(t)
+	downClient := redis.NewClient(&redis.Options{Addr: down.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { downClient.Close() })
+	down.Close()
+	collector.SetRedisClient(downClient)
+	collector.collectAndUpdateMetrics(ctx)
+	collector.updateRealTimeMetrics(ctx, "/v1/chat/completions", http.StatusOK, 400*time.Millisecond, "10.0.0.1")
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	collector.SetRedisClient(client)
+	collector.collectAndUpdateMetrics(ctx)
+
+	total, err := client.Get(ctx, "metrics:requests:total").Int()
+	require.NoError(t, err)
+	assert.Equal(t, 4, total)
+	errors, err := client.Get(ctx, "metrics:errors:total").Int()
+	require.NoError(t, err)
+	assert.Equal(t, 1, errors)
+	samples, err := client.LRange(ctx, "metrics:response_time:samples", 0, -1).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0.1", "0.2", "0.3", "0.4"}, samples)
+	users, err := client.SMembers(ctx, "metrics:active_users").Result()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Bearer sk-one", "Bearer sk-two", "10.0.0.1"}, users)
+
+	// Flushed metrics are not written again
+	collector.collectAndUpdateMetrics(ctx)
+	total, err = client.Get(ctx, "metrics:requests:total").Int()
+	require.NoError(t, err)
+	assert.Equal(t, 4, total)
+}
@@ -8,16 +8,18 @@ import (
 	"time"
 
 	"go-aigateway/internal/config"
+	"go-aigateway/internal/logging"
 	"go-aigateway/internal/ram"
 	"go-aigateway/internal/security"
 
 	"github.com/gin-gonic/gin"
-	"github.com/sirupsen/logrus"
 )
 
-// CORS middleware with configurable origins
-func CORS(cfg *config.Config) gin.HandlerFunc {
+// CORS middleware with configurable origins, read from source on every
+// request so reloaded CORS_ALLOWED_ORIGINS apply immediately
+func CORS(source config.Source) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		cfg := source.Current()
 		origin := c.Request.Header.Get("Origin")
 
 		// Default allowed origins for development
@@ -78,8 +80,12 @@ func CORS(cfg *config.Config) gin.HandlerFunc {
 	}
 }
 
-// API Key authentication middleware
-func APIKeyAuth(cfg *config.Config) gin.HandlerFunc {
+// API Key authentication middleware. The gateway keys are read from source
+// on every request, so reloaded GATEWAY_API_KEYS apply immediately. Other keys
+// are validated by localAuth when it is not nil, which sets the owning user and
+// the key's APIKeyInfo in the context like LocalAuth. Either way the key's ID
+// is stored under APIKeyIDContextKey.
+func APIKeyAuth(source config.Source, localAuth *security.LocalAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -108,23 +114,26 @@ func APIKeyAuth(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
-		// Validate API key
-		valid := false
-		for _, key := range cfg.GatewayKeys {
+		// Validate API key, first against the gateway keys, then the managed keys
+		keyID := ""
+		for _, key := range source.Current().GatewayKeys {
 			if strings.TrimSpace(key) == token {
-				valid = true
-				// Record API key usage for metrics
-				keyPrefix := token
-				if len(token) > 10 {
-					keyPrefix = token[:10] + "..."
-				}
-				RecordAPIKeyUsage(keyPrefix)
+				keyID = KeyFingerprint(token)
 				break
 			}
 		}
+		if keyID == "" && localAuth != nil {
+			if userInfo, keyInfo, err := localAuth.ValidateAPIKey(token); err == nil && userInfo != nil && keyInfo != nil {
+				keyID = keyInfo.ID
+				c.Set("user_id", userInfo.ID)
+				c.Set("permissions", userInfo.Permissions)
+				c.Set("auth_type", "api_key")
+				c.Set(APIKeyInfoContextKey, keyInfo)
+			}
+		}
 
-		if !valid {
-			logrus.WithField("token", token[:min(len(token), 10)]+"...").Warn("Invalid API key attempt")
+		if keyID == "" {
+			logging.FromContext(c).WithField("token", token[:min(len(token), 10)]+"...").Warn("Invalid API key attempt")
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": gin.H{
 					"message": "Invalid API key",
@@ -136,6 +145,14 @@ func APIKeyAuth(cfg *config.Config) gin.HandlerFunc {
 			return
 		}
 
+		// Record API key usage for metrics
+		keyPrefix := token
+		if len(token) > 10 {
+			keyPrefix = token[:10] + "..."
+		}
+		RecordAPIKeyUsage(keyPrefix)
+		c.Set(APIKeyIDContextKey, keyID)
+
 		c.Next()
 	}
 }
@@ -169,7 +186,7 @@ func RAMAuth(authenticator *ram.RAMAuthenticator) gin.HandlerFunc {
 		// Validate signature
 		valid, err := authenticator.ValidateRequest(c.Request, accessKeyID, signature, timestamp)
 		if err != nil {
-			logrus.WithError(err).Error("RAM authentication validation error")
+			logging.FromContext(c).WithError(err).Error("RAM authentication validation error")
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error": gin.H{
 					"message": "RAM authentication validation failed",
@@ -200,7 +217,9 @@ func RAMAuth(authenticator *ram.RAMAuthenticator) gin.HandlerFunc {
 }
 
 // Local JWT authentication middleware
-// LocalAuth middleware for JWT-based authentication
+// LocalAuth middleware for JWT-based authentication. requiredPermission must be
+// held by the authenticated user, directly or through "*"; with an API key the
+// key must hold it as well, so a narrowly scoped key of an admin stays narrow.
 func LocalAuth(localAuth *security.LocalAuthenticator, requiredPermission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get token from Authorization header or API key header
@@ -231,7 +250,7 @@ func LocalAuth(localAuth *security.LocalAuthenticator, requiredPermission string
 			// Validate API key
 			userInfo, keyInfo, err := localAuth.ValidateAPIKey(token)
 			if err != nil || userInfo == nil || keyInfo == nil {
-				logrus.WithError(err).Error("API key validation failed")
+				logging.FromContext(c).WithError(err).Error("API key validation failed")
 				c.JSON(http.StatusUnauthorized, gin.H{
 					"error": gin.H{
 						"message": "Invalid API key",
@@ -243,16 +262,9 @@ func LocalAuth(localAuth *security.LocalAuthenticator, requiredPermission string
 				return
 			}
 
-			// Check permission - look for permission in user's permissions slice
+			// Check permission - both the owner and the key itself must hold it
 			if requiredPermission != "" {
-				hasPermission := false
-				for _, perm := range userInfo.Permissions {
-					if perm == requiredPermission {
-						hasPermission = true
-						break
-					}
-				}
-				if !hasPermission {
+				if !grantsPermission(userInfo.Permissions, requiredPermission) || !keyInfo.HasPermission(requiredPermission) {
 					c.JSON(http.StatusForbidden, gin.H{
 						"error": gin.H{
 							"message": "Insufficient permissions",
@@ -269,64 +281,152 @@ func LocalAuth(localAuth *security.LocalAuthenticator, requiredPermission string
 			c.Set("user_id", userInfo.ID)
 			c.Set("permissions", userInfo.Permissions)
 			c.Set("auth_type", "api_key")
-		} else {
-			// Validate JWT token
-			claims, err := localAuth.ValidateJWT(token)
-			if err != nil {
-				logrus.WithError(err).Error("JWT validation failed")
-				c.JSON(http.StatusUnauthorized, gin.H{
-					"error": gin.H{
-						"message": "Invalid or expired token",
-						"type":    "authentication_error",
-						"code":    "invalid_token",
-					},
-				})
-				c.Abort()
-				return
-			}
+			c.Set(APIKeyInfoContextKey, keyInfo)
+		} else if !authenticateJWT(c, localAuth, token, requiredPermission) {
+			return
+		}
 
-			// Check permission - look for permission in claims permissions slice
-			if requiredPermission != "" {
-				hasPermission := false
-				for _, perm := range claims.Permissions {
-					if perm == requiredPermission {
-						hasPermission = true
-						break
-					}
-				}
-				if !hasPermission {
-					c.JSON(http.StatusForbidden, gin.H{
-						"error": gin.H{
-							"message": "Insufficient permissions",
-							"type":    "authorization_error",
-							"code":    "insufficient_permissions",
-						},
-					})
-					c.Abort()
-					return
-				}
-			}
+		c.Next()
+	}
+}
 
-			// Set user context
-			c.Set("user_id", claims.UserID)
-			c.Set("permissions", claims.Permissions)
-			c.Set("auth_type", "jwt")
+// JWTClaimsContextKey is the gin context key of the validated JWT claims
+// (*security.Claims), set by JWTAuth and LocalAuth
+const JWTClaimsContextKey = "jwt_claims"
+
+// APIKeyInfoContextKey is the gin context key of the validated managed key
+// (*security.APIKeyInfo), set by LocalAuth and APIKeyAuth
+const APIKeyInfoContextKey = "api_key_info"
+
+// APIKeyIDContextKey is the gin context key of the ID of the key APIKeyAuth
+// accepted: the managed key's ID, or the fingerprint of a gateway key
+const APIKeyIDContextKey = "api_key_id"
+
+// JWTAuth accepts only an Authorization: Bearer access token issued by login or
+// refresh, never an API key. It stores user_id, username, roles, permissions and
+// the full claims in the context; a non-empty requiredPermission must be in the
+// claims, directly or through "*".
+func JWTAuth(localAuth *security.LocalAuthenticator, requiredPermission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error": gin.H{
+					"message": "Missing bearer token",
+					"type":    "authentication_error",
+					"code":    "missing_token",
+				},
+			})
+			c.Abort()
+			return
+		}
+		if !authenticateJWT(c, localAuth, token, requiredPermission) {
+			return
 		}
+		c.Next()
+	}
+}
 
+// RequirePermission requires the user authenticated by LocalAuth or JWTAuth to
+// hold permission, e.g. "admin:keys", checked against the user's current roles
+// and permissions by LocalAuthenticator.CheckPermission. With an API key, the key
+// itself must hold the permission as well.
+func RequirePermission(localAuth *security.LocalAuthenticator, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !CallerHasPermission(c, localAuth, permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": gin.H{
+					"message": "Insufficient permissions",
+					"type":    "authorization_error",
+					"code":    "insufficient_permissions",
+				},
+			})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
-// Rate limiter middleware with cleanup
-type rateLimiter struct {
+// CallerHasPermission reports whether the user authenticated by LocalAuth or
+// JWTAuth holds permission, and when authenticated with an API key, whether
+// the key holds it as well
+func CallerHasPermission(c *gin.Context, localAuth *security.LocalAuthenticator, permission string) bool {
+	resource, action, _ := strings.Cut(permission, ":")
+	if !localAuth.CheckPermission(c.GetString("user_id"), resource, action) {
+		return false
+	}
+	if value, exists := c.Get(APIKeyInfoContextKey); exists {
+		keyInfo, ok := value.(*security.APIKeyInfo)
+		return ok && keyInfo.HasPermission(permission)
+	}
+	return true
+}
+
+// grantsPermission reports whether permissions contain required or "*", which
+// the default admin user holds in place of individual permissions
+func grantsPermission(permissions []string, required string) bool {
+	for _, perm := range permissions {
+		if perm == required || perm == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateJWT validates token, checks requiredPermission and stores the
+// claims in the context. Failures are answered and the request aborted.
+func authenticateJWT(c *gin.Context, localAuth *security.LocalAuthenticator, token, requiredPermission string) bool {
+	claims, err := localAuth.ValidateJWT(token)
+	if err != nil {
+		logging.FromContext(c).WithError(err).Error("JWT validation failed")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": gin.H{
+				"message": "Invalid or expired token",
+				"type":    "authentication_error",
+				"code":    "invalid_token",
+			},
+		})
+		c.Abort()
+		return false
+	}
+
+	// Check permission - look for permission in claims permissions slice
+	if requiredPermission != "" {
+		if !grantsPermission(claims.Permissions, requiredPermission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": gin.H{
+					"message": "Insufficient permissions",
+					"type":    "authorization_error",
+					"code":    "insufficient_permissions",
+				},
+			})
+			c.Abort()
+			return false
+		}
+	}
+
+	// Set user context
+	c.Set("user_id", claims.UserID)
+	c.Set("username", claims.Username)
+	c.Set("roles", claims.Roles)
+	c.Set("permissions", claims.Permissions)
+	c.Set("auth_type", "jwt")
+	c.Set(JWTClaimsContextKey, claims)
+	return true
+}
+
+// IPRateLimiter limits requests per client IP over a one minute window
+type IPRateLimiter struct {
 	requests map[string][]time.Time
 	mutex    sync.RWMutex
 	limit    int
+	source   config.Source // overrides limit when set
 	cleanup  *time.Ticker
 }
 
-func newRateLimiter(limit int) *rateLimiter {
-	rl := &rateLimiter{
+func newRateLimiter(limit int) *IPRateLimiter {
+	rl := &IPRateLimiter{
 		requests: make(map[string][]time.Time),
 		limit:    limit,
 		cleanup:  time.NewTicker(5 * time.Minute), // Cleanup every 5 minutes
@@ -338,7 +438,7 @@ func newRateLimiter(limit int) *rateLimiter {
 	return rl
 }
 
-func (rl *rateLimiter) cleanupOldEntries() {
+func (rl *IPRateLimiter) cleanupOldEntries() {
 	for range rl.cleanup.C {
 		rl.mutex.Lock()
 		now := time.Now()
@@ -363,12 +463,36 @@ func (rl *rateLimiter) cleanupOldEntries() {
 }
 
 func RateLimiter(requestsPerMinute int) gin.HandlerFunc {
-	limiter := newRateLimiter(requestsPerMinute)
+	return NewIPRateLimiter(requestsPerMinute).Handler()
+}
+
+// NewIPRateLimiter creates a limiter whose limit can be changed at runtime
+// through UpdateConfig
+func NewIPRateLimiter(requestsPerMinute int) *IPRateLimiter {
+	return newRateLimiter(requestsPerMinute)
+}
+
+// UpdateConfig applies a reloaded RATE_LIMIT_REQUESTS_PER_MINUTE; requests
+// already in the window still count against the new limit
+func (rl *IPRateLimiter) UpdateConfig(cfg *config.Config) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.limit = cfg.RateLimit
+}
+
+// SetConfigSource makes the limit follow RATE_LIMIT_REQUESTS_PER_MINUTE of
+// source, read on every request, e.g. a snapshot swapped on reload
+func (rl *IPRateLimiter) SetConfigSource(source config.Source) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.source = source
+}
 
+func (rl *IPRateLimiter) Handler() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		clientIP := c.ClientIP()
 
-		if !limiter.allow(clientIP) {
+		if !rl.allow(clientIP) {
 			// Record rate limit hit for metrics
 			RecordRateLimitHit(clientIP)
 
@@ -387,7 +511,7 @@ func RateLimiter(requestsPerMinute int) gin.HandlerFunc {
 	}
 }
 
-func (rl *rateLimiter) allow(clientIP string) bool {
+func (rl *IPRateLimiter) allow(clientIP string) bool {
 	rl.mutex.Lock()
 	defer rl.mutex.Unlock()
 
@@ -406,7 +530,11 @@ func (rl *rateLimiter) allow(clientIP string) bool {
 	}
 
 	// Check if under limit
-	if len(rl.requests[clientIP]) >= rl.limit {
+	limit := rl.limit
+	if rl.source != nil {
+		limit = rl.source.Current().RateLimit
+	}
+	if len(rl.requests[clientIP]) >= limit {
 		return false
 	}
 
@@ -422,9 +550,24 @@ func min(a, b int) int {
 	return b
 }
 
-// Request timeout middleware
+// RequestStartKey gin上下文中记录请求到达网关时间的键
+const RequestStartKey = "request_start"
+
+// RequestStart returns when the request reached the gateway, before any admission queueing
+func RequestStart(c *gin.Context) (time.Time, bool) {
+	start, ok := c.Get(RequestStartKey)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, ok := start.(time.Time)
+	return t, ok
+}
+
+// Request timeout middleware; also records the arrival time that per-route
+// and per-model timeouts are measured from
 func RequestTimeout(timeout time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		c.Set(RequestStartKey, time.Now())
 		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
 		defer cancel()
 
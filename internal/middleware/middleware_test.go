@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalAuthWildcardPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{
+		JWTSecret:       "test-secret",
+		TokenExpiration: time.Hour,
+		MaxAPIKeys:      10,
+		APIKeyPrefix:    "gw-",
+	})
+	adminToken, err := localAuth.GenerateJWT("admin")
+	require.NoError(t, err)
+	adminKey, err := localAuth.GenerateAPIKey("admin", "admin", []string{"*"}, 0)
+	require.NoError(t, err)
+	adminChatKey, err := localAuth.GenerateAPIKey("admin", "chat", []string{"ai:chat"}, 0)
+	require.NoError(t, err)
+	userToken, err := localAuth.GenerateJWT("api-user")
+	require.NoError(t, err)
+	userKey, err := localAuth.GenerateAPIKey("api-user", "user", []string{"ai:chat"}, 0)
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.GET("/admin", LocalAuth(localAuth, "admin"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name       string
+		header     string
+		credential string
+		wantStatus int
+	}{
+		{name: "admin token", header: "Authorization", credential: "Bearer " + adminToken, wantStatus: http.StatusOK},
+		{name: "admin key", header: "X-API-Key", credential: adminKey, wantStatus: http.StatusOK},
+		{name: "chat key of the admin", header: "X-API-Key", credential: adminChatKey, wantStatus: http.StatusForbidden},
+		{name: "user token", header: "Authorization", credential: "Bearer " + userToken, wantStatus: http.StatusForbidden},
+		{name: "user key", header: "X-API-Key", credential: userKey, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			req.Header.Set(tt.header, tt.credential)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestAPIKeyAuthAcceptsManagedKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{MaxAPIKeys: 10, APIKeyPrefix: "gw-"})
+	managed, err := localAuth.GenerateAPIKey("api-user", "client", []string{"ai:chat"}, 0)
+	require.NoError(t, err)
+	_, keyInfo, err := localAuth.ValidateAPIKey(managed)
+	require.NoError(t, err)
+
+	var keyID, userID string
+	live := config.NewSnapshot(&config.Config{GatewayKeys: []string{"static-key"}})
+	handler := func(c *gin.Context) {
+		keyID, userID = AuthenticatedKeyID(c), c.GetString("user_id")
+		c.Status(http.StatusOK)
+	}
+	call := func(r *gin.Engine, apiKey string) int {
+		keyID, userID = "", ""
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	r := gin.New()
+	r.GET("/v1/models", APIKeyAuth(live, localAuth), handler)
+	assert.Equal(t, http.StatusOK, call(r, managed))
+	assert.Equal(t, keyInfo.ID, keyID)
+	assert.Equal(t, "api-user", userID)
+	assert.Equal(t, http.StatusOK, call(r, "static-key"))
+	assert.Equal(t, KeyFingerprint("static-key"), keyID)
+	assert.Empty(t, userID)
+	assert.Equal(t, http.StatusUnauthorized, call(r, "gw-unknown"))
+
+	// Without an authenticator only the gateway keys are accepted
+	r = gin.New()
+	r.GET("/v1/models", APIKeyAuth(live, nil), handler)
+	assert.Equal(t, http.StatusUnauthorized, call(r, managed))
+}
@@ -0,0 +1,269 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Priority tiers, highest first
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+var priorityTiers = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// OverflowEstimator 使用指数移动平均跟踪各优先级的排队时间，用于估算等待时长
+type OverflowEstimator struct {
+	mu          sync.Mutex
+	alpha       float64
+	waitEMA     map[string]float64 // seconds spent queued before dequeue, per tier
+	serviceEMA  float64            // seconds a request holds a slot
+	hasService  bool
+	hasWaitTier map[string]bool
+}
+
+// NewOverflowEstimator creates an estimator; alpha is the EMA smoothing factor in (0, 1]
+func NewOverflowEstimator(alpha float64) *OverflowEstimator {
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+	return &OverflowEstimator{
+		alpha:       alpha,
+		waitEMA:     make(map[string]float64),
+		hasWaitTier: make(map[string]bool),
+	}
+}
+
+// ObserveDequeue records how long a request of the given tier waited in the queue
+func (e *OverflowEstimator) ObserveDequeue(tier string, wait time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.hasWaitTier[tier] {
+		e.waitEMA[tier] = wait.Seconds()
+		e.hasWaitTier[tier] = true
+		return
+	}
+	e.waitEMA[tier] = e.alpha*wait.Seconds() + (1-e.alpha)*e.waitEMA[tier]
+}
+
+// ObserveService records how long a request held a concurrency slot
+func (e *OverflowEstimator) ObserveService(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.hasService {
+		e.serviceEMA = d.Seconds()
+		e.hasService = true
+		return
+	}
+	e.serviceEMA = e.alpha*d.Seconds() + (1-e.alpha)*e.serviceEMA
+}
+
+// EstimateWait returns the expected wait in whole seconds for a request of the given
+// tier arriving behind depth queued requests. It never returns less than one second.
+func (e *OverflowEstimator) EstimateWait(tier string, depth, concurrency int) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	estimate := e.waitEMA[tier]
+
+	// 按队列深度和平均处理时间估算，取两者中较大的值
+	if concurrency > 0 {
+		service := e.serviceEMA
+		if !e.hasService {
+			service = 1
+		}
+		if drain := float64(depth+1) / float64(concurrency) * service; drain > estimate {
+			estimate = drain
+		}
+	}
+
+	return int(math.Max(1, math.Ceil(estimate)))
+}
+
+// queueWaiter is a request waiting for a concurrency slot
+type queueWaiter struct {
+	ready    chan struct{}
+	enqueued time.Time
+}
+
+// PriorityResolver returns the tier of a request; unknown tiers are served as normal
+type PriorityResolver func(c *gin.Context) string
+
+// PriorityQueue 有界的优先级准入队列，超过并发数的请求排队，队列满时返回503
+type PriorityQueue struct {
+	mu            sync.Mutex
+	maxConcurrent int
+	maxQueued     int
+	active        int
+	waiting       map[string][]*queueWaiter
+	estimator     *OverflowEstimator
+	resolve       PriorityResolver // nil serves every request as normal
+}
+
+// NewPriorityQueue creates a queue admitting maxConcurrent requests with up to maxQueued waiting
+func NewPriorityQueue(maxConcurrent, maxQueued int) *PriorityQueue {
+	return &PriorityQueue{
+		maxConcurrent: maxConcurrent,
+		maxQueued:     maxQueued,
+		waiting:       make(map[string][]*queueWaiter),
+		estimator:     NewOverflowEstimator(0.2),
+	}
+}
+
+// SetPriorityResolver installs the source of request tiers. Call it before serving.
+func (q *PriorityQueue) SetPriorityResolver(resolve PriorityResolver) {
+	q.resolve = resolve
+}
+
+// Estimator returns the queue's overflow estimator
+func (q *PriorityQueue) Estimator() *OverflowEstimator {
+	return q.estimator
+}
+
+// Depth returns the number of queued requests
+func (q *PriorityQueue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depthLocked()
+}
+
+func (q *PriorityQueue) depthLocked() int {
+	depth := 0
+	for _, waiters := range q.waiting {
+		depth += len(waiters)
+	}
+	return depth
+}
+
+// Middleware admits requests by the priority tier of their credentials. Mount
+// it after authentication; clients cannot choose their tier.
+func (q *PriorityQueue) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tier := q.priority(c)
+
+		q.mu.Lock()
+		if q.active < q.maxConcurrent && q.depthLocked() == 0 {
+			q.active++
+			q.mu.Unlock()
+			q.serve(c)
+			return
+		}
+
+		depth := q.depthLocked()
+		if depth >= q.maxQueued {
+			q.mu.Unlock()
+			estimate := q.estimator.EstimateWait(tier, depth, q.maxConcurrent)
+
+			c.Header("Retry-After", strconv.Itoa(estimate))
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": gin.H{
+					"message":                "Request queue is full, please retry later",
+					"type":                   "overloaded_error",
+					"code":                   "queue_full",
+					"estimated_wait_seconds": estimate,
+					"queue_depth":            depth,
+				},
+			})
+			c.Abort()
+			return
+		}
+
+		waiter := &queueWaiter{ready: make(chan struct{}), enqueued: time.Now()}
+		q.waiting[tier] = append(q.waiting[tier], waiter)
+		q.mu.Unlock()
+
+		select {
+		case <-waiter.ready:
+			q.estimator.ObserveDequeue(tier, time.Since(waiter.enqueued))
+			q.serve(c)
+		case <-c.Request.Context().Done():
+			if !q.remove(tier, waiter) {
+				// 已被分配槽位，需要归还
+				q.release()
+			}
+			c.Abort()
+		}
+	}
+}
+
+// serve runs the handler chain while holding a slot
+func (q *PriorityQueue) serve(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		q.estimator.ObserveService(time.Since(start))
+		q.release()
+	}()
+	c.Next()
+}
+
+// release hands the slot to the highest-priority waiter or frees it
+func (q *PriorityQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, tier := range priorityTiers {
+		if waiters := q.waiting[tier]; len(waiters) > 0 {
+			next := waiters[0]
+			q.waiting[tier] = waiters[1:]
+			close(next.ready)
+			return
+		}
+	}
+	q.active--
+}
+
+// remove drops a waiter that gave up, reporting whether it was still queued
+func (q *PriorityQueue) remove(tier string, waiter *queueWaiter) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	waiters := q.waiting[tier]
+	for i, w := range waiters {
+		if w == waiter {
+			q.waiting[tier] = append(waiters[:i], waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// priority returns the tier the resolver assigns to a request
+func (q *PriorityQueue) priority(c *gin.Context) string {
+	if q.resolve == nil {
+		return PriorityNormal
+	}
+	switch tier := q.resolve(c); tier {
+	case PriorityHigh, PriorityLow:
+		return tier
+	default:
+		return PriorityNormal
+	}
+}
+
+// KeyPriorities assigns the tier of the request's API key issued by localAuth
+// or, failing that, the tier tenants lists for the key's owner, or for the
+// RequestOwner of other credentials
+func KeyPriorities(localAuth *security.LocalAuthenticator, tenants map[string]string) PriorityResolver {
+	return func(c *gin.Context) string {
+		if apiKey := APIKeyFromRequest(c); apiKey != "" && localAuth != nil {
+			if info, err := localAuth.DescribeAPIKey(apiKey); err == nil {
+				if info.Priority != "" {
+					return info.Priority
+				}
+				return tenants[info.UserID]
+			}
+		}
+		return tenants[RequestOwner(c)]
+	}
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPriorityQueueOverflowIncludesEstimatedWait(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	queue := NewPriorityQueue(1, 2)
+	release := make(chan struct{})
+
+	r := gin.New()
+	r.Use(queue.Middleware())
+	r.GET("/work", func(c *gin.Context) {
+		<-release
+		c.Status(http.StatusOK)
+	})
+
+	// One request holds the slot and two more fill the queue
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/work", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+		}()
+	}
+	require.Eventually(t, func() bool { return queue.Depth() == 2 }, time.Second, 5*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/work", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	var body struct {
+		Error struct {
+			Code                 string `json:"code"`
+			EstimatedWaitSeconds int    `json:"estimated_wait_seconds"`
+			QueueDepth           int    `json:"queue_depth"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "queue_full", body.Error.Code)
+	assert.Greater(t, body.Error.EstimatedWaitSeconds, 0)
+	assert.Equal(t, 2, body.Error.QueueDepth)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 0, queue.Depth())
+}
+
+func TestPriorityQueueServesHigherTierFirst(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{MaxAPIKeys: 10})
+	highKey, err := localAuth.GenerateAPIKey("api-user", "interactive", []string{"ai:chat"}, 0)
+	require.NoError(t, err)
+	require.NoError(t, localAuth.SetPriority(highKey, PriorityHigh))
+	lowKey, err := localAuth.GenerateAPIKey("api-user", "batch", []string{"ai:chat"}, 0)
+	require.NoError(t, err)
+
+	// The owner's tier applies to keys without a priority of their own
+	queue := NewPriorityQueue(1, 10)
+	queue.SetPriorityResolver(KeyPriorities(localAuth, map[string]string{"api-user": PriorityLow}))
+	release := make(chan struct{})
+	var order []string
+	var mu sync.Mutex
+
+	r := gin.New()
+	r.Use(queue.Middleware())
+	r.GET("/work", func(c *gin.Context) {
+		if c.Query("block") == "1" {
+			<-release
+		}
+		mu.Lock()
+		order = append(order, c.Query("name"))
+		mu.Unlock()
+		c.Status(http.StatusOK)
+	})
+
+	send := func(wg *sync.WaitGroup, url, apiKey string) {
+		defer wg.Done()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		// The client's own claim has no effect
+		req.Header.Set("X-Priority", PriorityHigh)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var blocker, wg sync.WaitGroup
+	blocker.Add(1)
+	go send(&blocker, "/work?block=1&name=blocker", "gw-static-key")
+	require.Eventually(t, func() bool {
+		queue.mu.Lock()
+		defer queue.mu.Unlock()
+		return queue.active == 1
+	}, time.Second, 5*time.Millisecond)
+
+	wg.Add(1)
+	go send(&wg, "/work?name=low", lowKey)
+	require.Eventually(t, func() bool { return queue.Depth() == 1 }, time.Second, 5*time.Millisecond)
+	wg.Add(1)
+	go send(&wg, "/work?name=normal", "gw-static-key")
+	require.Eventually(t, func() bool { return queue.Depth() == 2 }, time.Second, 5*time.Millisecond)
+	wg.Add(1)
+	go send(&wg, "/work?name=high", highKey)
+	require.Eventually(t, func() bool { return queue.Depth() == 3 }, time.Second, 5*time.Millisecond)
+
+	close(release)
+	blocker.Wait()
+	wg.Wait()
+
+	assert.Equal(t, []string{"blocker", "high", "normal", "low"}, order)
+}
+
+func TestOverflowEstimatorEMA(t *testing.T) {
+	e := NewOverflowEstimator(0.5)
+	e.ObserveDequeue(PriorityNormal, 4*time.Second)
+	e.ObserveDequeue(PriorityNormal, 8*time.Second)
+
+	// EMA is 6s; draining one queued request behind a 1s service time is less
+	e.ObserveService(time.Second)
+	assert.Equal(t, 6, e.EstimateWait(PriorityNormal, 1, 1))
+
+	// A deep queue dominates the per-tier average
+	assert.Equal(t, 20, e.EstimateWait(PriorityNormal, 19, 1))
+
+	// Unknown tiers and empty history still report at least one second
+	assert.Equal(t, 1, NewOverflowEstimator(0.2).EstimateWait(PriorityHigh, 0, 10))
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPRateLimiterUpdateConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewIPRateLimiter(1)
+	r := gin.New()
+	r.Use(limiter.Handler())
+	r.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+	call := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call())
+	assert.Equal(t, http.StatusTooManyRequests, call())
+
+	// Raising the limit admits more requests within the same window
+	limiter.UpdateConfig(&config.Config{RateLimit: 3})
+	assert.Equal(t, http.StatusOK, call())
+	assert.Equal(t, http.StatusOK, call())
+	assert.Equal(t, http.StatusTooManyRequests, call())
+}
+
+func TestIPRateLimiterFollowsConfigSnapshot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	live := config.NewSnapshot(&config.Config{RateLimit: 2})
+	limiter := NewIPRateLimiter(100)
+	limiter.SetConfigSource(live)
+	r := gin.New()
+	r.Use(limiter.Handler())
+	r.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+	call := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call())
+	assert.Equal(t, http.StatusOK, call())
+	assert.Equal(t, http.StatusTooManyRequests, call())
+
+	// A reload swapping in a higher limit applies to the next request
+	live.Apply(&config.Config{RateLimit: 3})
+	assert.Equal(t, http.StatusOK, call())
+	assert.Equal(t, http.StatusTooManyRequests, call())
+}
+
+func TestCORSAndAPIKeyAuthFollowConfigSnapshot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	live := config.NewSnapshot(&config.Config{
+		GatewayKeys:    []string{"key-old"},
+		AllowedOrigins: []string{"https://old.example.com"},
+	})
+	r := gin.New()
+	r.Use(CORS(live), APIKeyAuth(live, nil))
+	r.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+	call := func(key, origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call("key-old", "https://old.example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://old.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, http.StatusUnauthorized, call("key-new", "https://new.example.com").Code)
+
+	live.Apply(&config.Config{
+		GatewayKeys:    []string{"key-new"},
+		AllowedOrigins: []string{"https://new.example.com"},
+	})
+	w = call("key-new", "https://new.example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://new.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	w = call("key-old", "https://old.example.com")
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "a removed key stops working")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
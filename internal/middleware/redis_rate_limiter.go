@@ -2,26 +2,46 @@ package middleware
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
+	"go-aigateway/internal/config"
+
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
 
-// RedisRateLimiter Redis全局限流器
+// RedisRateLimiter Redis全局限流器。默认使用滑动窗口：每个请求由一个 Lua 脚本
+// 同时计入全局与客户端窗口，一次往返返回剩余额度与重置时间，被拒绝的请求不计入窗口。
+// The legacy pipeline, which also counts rejected requests and checks each
+// scope in its own round trip, stays available for rollback.
+// Redis 不可用（客户端为 nil 或调用失败）时降级为进程内窗口，限额按实例生效。
 type RedisRateLimiter struct {
+	clientMu    sync.RWMutex
 	client      *redis.Client
 	globalLimit int           // 全局QPS限制
 	userLimit   int           // 单用户QPS限制
+	source      config.Source // 设置后单用户限制取自其 RateLimit，随配置重载生效
 	windowSize  time.Duration // 时间窗口大小
 	keyPrefix   string        // Redis key前缀
+	legacy      bool          // use the pre-script pipeline
+	now         func() time.Time
+	local       memoryWindows // fallback while Redis is unavailable
 }
 
-// NewRedisRateLimiter 创建Redis限流器
+// errRedisUnavailable is returned by limiters without a Redis client
+var errRedisUnavailable = errors.New("redis is unavailable")
+
+// NewRedisRateLimiter 创建Redis限流器。redisClient 可为 nil，此时使用进程内窗口直到
+// SetRedisClient 提供客户端。
 func NewRedisRateLimiter(redisClient *redis.Client, globalLimit, userLimit int, windowSize time.Duration) *RedisRateLimiter {
 	return &RedisRateLimiter{
 		client:      redisClient,
@@ -29,43 +49,89 @@ func NewRedisRateLimiter(redisClient *redis.Client, globalLimit, userLimit int,
 		userLimit:   userLimit,
 		windowSize:  windowSize,
 		keyPrefix:   "rate_limit:",
+		now:         time.Now,
+	}
+}
+
+// SetRedisClient switches the limiter to client, e.g. once Redis is reachable
+// after starting without it; nil falls back to the in-memory windows
+func (r *RedisRateLimiter) SetRedisClient(client *redis.Client) {
+	r.clientMu.Lock()
+	r.client = client
+	r.clientMu.Unlock()
+}
+
+func (r *RedisRateLimiter) redisClient() *redis.Client {
+	r.clientMu.RLock()
+	defer r.clientMu.RUnlock()
+	return r.client
+}
+
+// SetLegacyWindow switches back to the pipeline limiter used before the
+// sliding window script
+func (r *RedisRateLimiter) SetLegacyWindow(legacy bool) {
+	r.legacy = legacy
+}
+
+// SetConfigSource makes the user limit follow RATE_LIMIT_REQUESTS_PER_MINUTE
+// of source, e.g. a snapshot swapped on reload. Call it before serving.
+func (r *RedisRateLimiter) SetConfigSource(source config.Source) {
+	r.source = source
+}
+
+// currentUserLimit returns the user limit in effect
+func (r *RedisRateLimiter) currentUserLimit() int {
+	if r.source != nil {
+		return r.source.Current().RateLimit
 	}
+	return r.userLimit
 }
 
 // RedisRateLimit Redis全局限流中间件
 func RedisRateLimit(limiter *RedisRateLimiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx := context.Background()
 		clientIP := c.ClientIP()
 		userKey := c.GetHeader("Authorization") // 使用API Key作为用户标识
 		if userKey == "" {
 			userKey = clientIP
 		}
 
-		// 检查全局限流
-		globalAllowed, globalRemaining, err := limiter.checkLimit(ctx, "global", limiter.globalLimit)
+		scopes := []rateScope{
+			{key: "global", limit: limiter.globalLimit},
+			{key: fmt.Sprintf("user:%s", userKey), limit: limiter.currentUserLimit()},
+		}
+		decisions, err := limiter.limitScopes(c.Request.Context(), scopes)
 		if err != nil {
-			logrus.WithError(err).Error("Redis rate limit check failed")
 			// 如果Redis出错，降级到内存限流
-			c.Next()
-			return
+			if !errors.Is(err, errRedisUnavailable) {
+				logrus.WithError(err).Warn("Redis rate limit check failed, using in-memory limits")
+			}
+			decisions = limiter.local.limit(scopes, limiter.windowSize, limiter.now())
 		}
 
-		if !globalAllowed {
-			RecordRateLimitHit("global")
-			c.Header("X-RateLimit-Limit", strconv.Itoa(limiter.globalLimit))
-			c.Header("X-RateLimit-Remaining", strconv.Itoa(globalRemaining))
-			c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(limiter.windowSize).Unix(), 10))
+		for i, decision := range decisions {
+			if decision.allowed {
+				continue
+			}
+			scope, code := "Global", "global_rate_limit_exceeded"
+			if i > 0 {
+				scope, code = "User", "user_rate_limit_exceeded"
+				RecordRateLimitHit(clientIP)
+			} else {
+				RecordRateLimitHit("global")
+			}
+			limiter.setHeaders(c, scopes[i].limit, decision)
+			c.Header("Retry-After", strconv.Itoa(limiter.retryAfter(decision)))
 
 			c.JSON(http.StatusTooManyRequests, gin.H{
 				"error": gin.H{
-					"message": "Global rate limit exceeded",
+					"message": scope + " rate limit exceeded",
 					"type":    "rate_limit_error",
-					"code":    "global_rate_limit_exceeded",
+					"code":    code,
 					"details": map[string]interface{}{
-						"limit":     limiter.globalLimit,
-						"remaining": globalRemaining,
-						"reset_at":  time.Now().Add(limiter.windowSize).Unix(),
+						"limit":     scopes[i].limit,
+						"remaining": decision.remaining,
+						"reset_at":  decision.resetAt.Unix(),
 					},
 				},
 			})
@@ -73,52 +139,168 @@ func RedisRateLimit(limiter *RedisRateLimiter) gin.HandlerFunc {
 			return
 		}
 
-		// 检查用户限流
-		userAllowed, userRemaining, err := limiter.checkLimit(ctx, fmt.Sprintf("user:%s", userKey), limiter.userLimit)
-		if err != nil {
-			logrus.WithError(err).Error("Redis user rate limit check failed")
-			c.Next()
-			return
-		}
+		// 设置响应头
+		limiter.setHeaders(c, scopes[len(scopes)-1].limit, decisions[len(decisions)-1])
+
+		c.Next()
+	}
+}
 
-		if !userAllowed {
-			RecordRateLimitHit(clientIP)
-			c.Header("X-RateLimit-Limit", strconv.Itoa(limiter.userLimit))
-			c.Header("X-RateLimit-Remaining", strconv.Itoa(userRemaining))
-			c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(limiter.windowSize).Unix(), 10))
+// setHeaders sets the X-RateLimit headers of one scope
+func (r *RedisRateLimiter) setHeaders(c *gin.Context, limit int, decision rateDecision) {
+	c.Header("X-RateLimit-Limit", strconv.Itoa(limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(decision.remaining))
+	c.Header("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(float64(decision.resetAt.UnixMilli())/1000)), 10))
+}
 
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": gin.H{
-					"message": "User rate limit exceeded",
-					"type":    "rate_limit_error",
-					"code":    "user_rate_limit_exceeded",
-					"details": map[string]interface{}{
-						"limit":     limiter.userLimit,
-						"remaining": userRemaining,
-						"reset_at":  time.Now().Add(limiter.windowSize).Unix(),
-					},
-				},
-			})
-			c.Abort()
-			return
-		}
+// retryAfter returns the whole seconds until a rejected scope frees a slot, at least 1
+func (r *RedisRateLimiter) retryAfter(decision rateDecision) int {
+	seconds := int(math.Ceil(decision.resetAt.Sub(r.now()).Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
 
-		// 设置响应头
-		c.Header("X-RateLimit-Limit", strconv.Itoa(limiter.userLimit))
-		c.Header("X-RateLimit-Remaining", strconv.Itoa(userRemaining))
-		c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(limiter.windowSize).Unix(), 10))
+// rateScope is one window a request counts against
+type rateScope struct {
+	key   string
+	limit int
+}
 
-		c.Next()
+// slidingWindowScript counts one request against every window in KEYS: each
+// is trimmed to scores after ARGV[2], and when all of them have room the
+// request is added to all, otherwise to none. ARGV[3] is the TTL in
+// milliseconds, ARGV[4] the member and ARGV[5..] the limits. It returns
+// {allowed, count, oldest score} per key. Scores are nanoseconds as in the
+// legacy pipeline so both can share keys during a rollback; they are passed
+// as strings because Lua would format large numbers with fewer digits.
+var slidingWindowScript = redis.NewScript(`
+local counts = {}
+local admit = true
+for i, key in ipairs(KEYS) do
+	redis.call("ZREMRANGEBYSCORE", key, "-inf", ARGV[2])
+	counts[i] = redis.call("ZCARD", key)
+	if counts[i] >= tonumber(ARGV[4 + i]) then
+		admit = false
+	end
+end
+
+local result = {}
+for i, key in ipairs(KEYS) do
+	local allowed = 0
+	if counts[i] < tonumber(ARGV[4 + i]) then
+		allowed = 1
+	end
+	if admit then
+		redis.call("ZADD", key, ARGV[1], ARGV[4])
+		counts[i] = counts[i] + 1
+	end
+	redis.call("PEXPIRE", key, ARGV[3])
+
+	local first = tonumber(ARGV[1])
+	local oldest = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+	if oldest[2] then
+		first = tonumber(oldest[2])
+	end
+	table.insert(result, allowed)
+	table.insert(result, counts[i])
+	table.insert(result, first)
+end
+return result
+`)
+
+// limitScopes counts a request against each scope in one script call. The
+// request is admitted only when every decision is allowed.
+func (r *RedisRateLimiter) limitScopes(ctx context.Context, scopes []rateScope) ([]rateDecision, error) {
+	client := r.redisClient()
+	if client == nil {
+		return nil, errRedisUnavailable
 	}
+	if r.legacy {
+		return r.limitScopesLegacy(ctx, client, scopes)
+	}
+
+	now := r.now()
+	nowNano := strconv.FormatInt(now.UnixNano(), 10)
+	member := make([]byte, 6)
+	rand.Read(member)
+	ttl := r.windowSize.Milliseconds()
+	if ttl < 1 {
+		ttl = 1
+	}
+	keys := make([]string, len(scopes))
+	args := []interface{}{
+		nowNano,
+		strconv.FormatInt(now.Add(-r.windowSize).UnixNano(), 10),
+		ttl,
+		nowNano + "-" + hex.EncodeToString(member),
+	}
+	for i, scope := range scopes {
+		keys[i] = r.keyPrefix + scope.key
+		args = append(args, scope.limit)
+	}
+
+	// Run tries EVALSHA first and loads the script only when Redis lacks it
+	result, err := slidingWindowScript.Run(ctx, client, keys, args...).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+	if len(result) != 3*len(scopes) {
+		return nil, fmt.Errorf("unexpected rate limit script result of %d values", len(result))
+	}
+
+	decisions := make([]rateDecision, len(scopes))
+	for i, scope := range scopes {
+		remaining := scope.limit - int(result[3*i+1])
+		if remaining < 0 {
+			remaining = 0
+		}
+		decisions[i] = rateDecision{
+			allowed:   result[3*i] == 1,
+			remaining: remaining,
+			resetAt:   time.Unix(0, result[3*i+2]).Add(r.windowSize),
+		}
+	}
+	return decisions, nil
 }
 
-// checkLimit 检查限流，使用滑动窗口算法
+// limitScopesLegacy checks the scopes one after another and stops at the first rejection
+func (r *RedisRateLimiter) limitScopesLegacy(ctx context.Context, client *redis.Client, scopes []rateScope) ([]rateDecision, error) {
+	var decisions []rateDecision
+	for _, scope := range scopes {
+		allowed, remaining, err := r.checkLimitLegacy(ctx, client, scope.key, scope.limit)
+		if err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, rateDecision{
+			allowed:   allowed,
+			remaining: remaining,
+			resetAt:   r.now().Add(r.windowSize),
+		})
+		if !allowed {
+			break
+		}
+	}
+	return decisions, nil
+}
+
+// checkLimit 检查单个窗口的限流
 func (r *RedisRateLimiter) checkLimit(ctx context.Context, key string, limit int) (bool, int, error) {
-	now := time.Now()
+	decisions, err := r.limitScopes(ctx, []rateScope{{key: key, limit: limit}})
+	if err != nil {
+		return false, 0, err
+	}
+	return decisions[0].allowed, decisions[0].remaining, nil
+}
+
+// checkLimitLegacy 检查限流，旧版管道实现：被拒绝的请求同样计入窗口
+func (r *RedisRateLimiter) checkLimitLegacy(ctx context.Context, client *redis.Client, key string, limit int) (bool, int, error) {
+	now := r.now()
 	windowStart := now.Add(-r.windowSize)
 	redisKey := r.keyPrefix + key
 
-	pipe := r.client.TxPipeline()
+	pipe := client.TxPipeline()
 
 	// 移除过期的记录
 	pipe.ZRemRangeByScore(ctx, redisKey, "0", strconv.FormatInt(windowStart.UnixNano(), 10))
@@ -151,11 +333,15 @@ func (r *RedisRateLimiter) checkLimit(ctx context.Context, key string, limit int
 
 // GetRateLimitStats 获取限流统计信息
 func (r *RedisRateLimiter) GetRateLimitStats(ctx context.Context) (map[string]interface{}, error) {
+	client := r.redisClient()
+	if client == nil {
+		return nil, errRedisUnavailable
+	}
 	stats := make(map[string]interface{})
 
 	// 获取全局统计
 	globalKey := r.keyPrefix + "global"
-	globalCount, err := r.client.ZCard(ctx, globalKey).Result()
+	globalCount, err := client.ZCard(ctx, globalKey).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -166,7 +352,7 @@ func (r *RedisRateLimiter) GetRateLimitStats(ctx context.Context) (map[string]in
 
 	// 获取活跃用户数
 	pattern := r.keyPrefix + "user:*"
-	keys, err := r.client.Keys(ctx, pattern).Result()
+	keys, err := client.Keys(ctx, pattern).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -176,3 +362,68 @@ func (r *RedisRateLimiter) GetRateLimitStats(ctx context.Context) (map[string]in
 
 	return stats, nil
 }
+
+// memoryWindows counts requests in process memory with the rules of the
+// sliding window script: a request is added to every window when all of them
+// have room, otherwise to none
+type memoryWindows struct {
+	mutex     sync.Mutex
+	requests  map[string][]time.Time
+	lastSweep time.Time
+}
+
+func (m *memoryWindows) limit(scopes []rateScope, window time.Duration, now time.Time) []rateDecision {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.requests == nil {
+		m.requests = make(map[string][]time.Time)
+	}
+	m.sweep(now, window)
+
+	cutoff := now.Add(-window)
+	admit := true
+	counts := make([]int, len(scopes))
+	for i, scope := range scopes {
+		recent := pruneBefore(m.requests[scope.key], cutoff)
+		m.requests[scope.key] = recent
+		counts[i] = len(recent)
+		if counts[i] >= scope.limit {
+			admit = false
+		}
+	}
+
+	decisions := make([]rateDecision, len(scopes))
+	for i, scope := range scopes {
+		allowed := counts[i] < scope.limit
+		if admit {
+			m.requests[scope.key] = append(m.requests[scope.key], now)
+			counts[i]++
+		}
+		oldest := now
+		if times := m.requests[scope.key]; len(times) > 0 {
+			oldest = times[0]
+		}
+		remaining := scope.limit - counts[i]
+		if remaining < 0 {
+			remaining = 0
+		}
+		decisions[i] = rateDecision{allowed: allowed, remaining: remaining, resetAt: oldest.Add(window)}
+	}
+	return decisions
+}
+
+// sweep drops idle keys once a minute; the caller holds the mutex
+func (m *memoryWindows) sweep(now time.Time, window time.Duration) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for key, times := range m.requests {
+		if recent := pruneBefore(times, now.Add(-window)); len(recent) == 0 {
+			delete(m.requests, key)
+		} else {
+			m.requests[key] = recent
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// redisLimiterRouter returns a router limited by a Redis limiter whose clock
+// the test controls
+func redisLimiterRouter(t *testing.T, globalLimit, userLimit int) (*RedisRateLimiter, *time.Time, func(apiKey string) *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRedisRateLimiter(client, globalLimit, userLimit, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	r := gin.New()
+	r.Use(RedisRateLimit(limiter))
+	r.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+	call := func(apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	return limiter, &now, call
+}
+
+func TestRedisRateLimitRejectsBurstAcrossWindowBoundary(t *testing.T) {
+	_, now, call := redisLimiterRouter(t, 1000, 10)
+	start := *now
+
+	// A full window's worth of requests at the end of one minute...
+	*now = start.Add(59 * time.Second)
+	for i := 0; i < 10; i++ {
+		w := call("sk-one")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "10", w.Header().Get("X-RateLimit-Limit"))
+	}
+	// ...leaves no room at the start of the next one
+	*now = start.Add(61 * time.Second)
+	w := call("sk-one")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "user_rate_limit_exceeded")
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "58", w.Header().Get("Retry-After"), "the first request leaves the window at 1:59")
+
+	// Once the burst slides out of the window the client is admitted again
+	*now = start.Add(119 * time.Second)
+	w = call("sk-one")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "9", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Empty(t, w.Header().Get("Retry-After"))
+}
+
+func TestRedisRateLimitFollowsConfigSnapshot(t *testing.T) {
+	limiter, _, call := redisLimiterRouter(t, 1000, 100)
+	live := config.NewSnapshot(&config.Config{RateLimit: 2})
+	limiter.SetConfigSource(live)
+
+	require.Equal(t, http.StatusOK, call("sk-one").Code)
+	require.Equal(t, http.StatusOK, call("sk-one").Code)
+	assert.Equal(t, http.StatusTooManyRequests, call("sk-one").Code)
+
+	// A reloaded RATE_LIMIT_REQUESTS_PER_MINUTE applies without a restart
+	live.Apply(&config.Config{RateLimit: 3})
+	w := call("sk-one")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, http.StatusTooManyRequests, call("sk-one").Code)
+}
+
+func TestRedisRateLimitRejectedRequestsDoNotCount(t *testing.T) {
+	_, now, call := redisLimiterRouter(t, 1000, 2)
+	start := *now
+
+	assert.Equal(t, http.StatusOK, call("sk-one").Code)
+	*now = start.Add(30 * time.Second)
+	assert.Equal(t, http.StatusOK, call("sk-one").Code)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusTooManyRequests, call("sk-one").Code)
+	}
+
+	// The first request has left the window; the rejected retries did not take its place
+	*now = start.Add(61 * time.Second)
+	w := call("sk-one")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+}
+
+func TestRedisRateLimitGlobalScope(t *testing.T) {
+	limiter, _, call := redisLimiterRouter(t, 3, 10)
+
+	assert.Equal(t, http.StatusOK, call("sk-one").Code)
+	assert.Equal(t, http.StatusOK, call("sk-two").Code)
+	assert.Equal(t, http.StatusOK, call("sk-three").Code)
+
+	w := call("sk-four")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "global_rate_limit_exceeded")
+	assert.Equal(t, "3", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// A request rejected globally is not counted against its client either
+	stats, err := limiter.GetRateLimitStats(t.Context())
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, stats["global_current_requests"])
+	assert.Equal(t, 3, stats["active_users"])
+}
+
+func TestRedisRateLimitLegacyWindow(t *testing.T) {
+	limiter, now, call := redisLimiterRouter(t, 1000, 2)
+	limiter.SetLegacyWindow(true)
+	start := *now
+
+	// The legacy pipeline uses the timestamp as member, so requests need distinct times
+	assert.Equal(t, http.StatusOK, call("sk-one").Code)
+	*now = start.Add(10 * time.Second)
+	assert.Equal(t, http.StatusOK, call("sk-one").Code)
+	*now = start.Add(30 * time.Second)
+	w := call("sk-one")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// The legacy pipeline counts the rejected request, so it still blocks the client
+	*now = start.Add(61 * time.Second)
+	assert.Equal(t, http.StatusTooManyRequests, call("sk-one").Code)
+}
+
+func TestRedisRateLimitFallsBackToMemoryWithoutRedis(t *testing.T) {
+	limiter, now, call := redisLimiterRouter(t, 1000, 2)
+	limiter.SetRedisClient(nil)
+	start := *now
+
+	assert.Equal(t, http.StatusOK, call("sk-one").Code)
+	*now = start.Add(30 * time.Second)
+	w := call("sk-one")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	w = call("sk-one")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"), "the first request leaves the in-memory window at 1:00")
+	assert.Equal(t, http.StatusOK, call("sk-two").Code, "clients keep separate windows")
+
+	// Rejected requests are not counted in memory either
+	*now = start.Add(61 * time.Second)
+	assert.Equal(t, http.StatusOK, call("sk-one").Code)
+}
+
+func TestRedisRateLimitFallsBackToMemoryWhenRedisFails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	limiter := NewRedisRateLimiter(nil, 1000, 1, time.Minute)
+
+	r := gin.New()
+	r.Use(RedisRateLimit(limiter))
+	r.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+	call := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+		return w.Code
+	}
+
+	// Redis becomes available after the limiter was created without it
+	limiter.SetRedisClient(client)
+	assert.Equal(t, http.StatusOK, call())
+	assert.True(t, mr.Exists("rate_limit:global"))
+	assert.Equal(t, http.StatusTooManyRequests, call())
+
+	// The in-memory windows do not know the requests counted in Redis
+	mr.Close()
+	assert.Equal(t, http.StatusOK, call())
+	assert.Equal(t, http.StatusTooManyRequests, call())
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyOwnerResolver returns the user owning a managed API key
+type KeyOwnerResolver func(apiKey string) (owner string, ok bool)
+
+var (
+	keyOwnerResolver   KeyOwnerResolver
+	keyOwnerResolverMu sync.RWMutex
+)
+
+// SetKeyOwnerResolver installs the lookup RequestOwner uses for managed API keys
+func SetKeyOwnerResolver(resolve KeyOwnerResolver) {
+	keyOwnerResolverMu.Lock()
+	keyOwnerResolver = resolve
+	keyOwnerResolverMu.Unlock()
+}
+
+// requestOwnerContextKey caches the owner resolved by RequestOwner
+const requestOwnerContextKey = "request_owner"
+
+// KeyFingerprint returns a stable, non-reversible identifier for keys that have no ID
+func KeyFingerprint(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return "fp_" + hex.EncodeToString(sum[:8])
+}
+
+// RequestOwner 返回请求凭据所属的主体：LocalAuth/JWTAuth 认证的用户、托管 API Key 的所属用户，
+// 否则为 Key 本身的指纹；没有凭据时为空。与 X-Tenant-ID 不同，客户端无法自行指定，
+// 因此按租户划分的状态和配额都以它为键。
+func RequestOwner(c *gin.Context) string {
+	if owner := c.GetString(requestOwnerContextKey); owner != "" {
+		return owner
+	}
+	owner := c.GetString("user_id")
+	if owner == "" {
+		owner = requestOwnerFromKey(c)
+	}
+	if owner != "" {
+		c.Set(requestOwnerContextKey, owner)
+	}
+	return owner
+}
+
+func requestOwnerFromKey(c *gin.Context) string {
+	apiKey, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || apiKey == "" {
+		apiKey = c.GetHeader("X-API-Key")
+	}
+	if apiKey == "" {
+		return ""
+	}
+
+	keyOwnerResolverMu.RLock()
+	resolve := keyOwnerResolver
+	keyOwnerResolverMu.RUnlock()
+	if resolve != nil {
+		if owner, ok := resolve(apiKey); ok && owner != "" {
+			return owner
+		}
+	}
+	return KeyFingerprint(apiKey)
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestOwner(t *testing.T) {
+	SetKeyOwnerResolver(func(apiKey string) (string, bool) {
+		if apiKey == "managed-key" {
+			return "alice", true
+		}
+		return "", false
+	})
+	t.Cleanup(func() { SetKeyOwnerResolver(nil) })
+
+	owner := func(setup func(req *http.Request, c *gin.Context)) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+		c.Request.Header.Set("X-Tenant-ID", "spoofed")
+		setup(c.Request, c)
+		return RequestOwner(c)
+	}
+
+	assert.Equal(t, "alice", owner(func(req *http.Request, _ *gin.Context) {
+		req.Header.Set("Authorization", "Bearer managed-key")
+	}))
+	assert.Equal(t, "alice", owner(func(req *http.Request, _ *gin.Context) {
+		req.Header.Set("X-API-Key", "managed-key")
+	}))
+	assert.Equal(t, KeyFingerprint("gateway-key"), owner(func(req *http.Request, _ *gin.Context) {
+		req.Header.Set("Authorization", "Bearer gateway-key")
+	}), "keys without an owner are identified by their fingerprint")
+	assert.Equal(t, "bob", owner(func(req *http.Request, c *gin.Context) {
+		req.Header.Set("Authorization", "Bearer managed-key")
+		c.Set("user_id", "bob")
+	}), "the user authenticated by LocalAuth takes precedence")
+	assert.Empty(t, owner(func(*http.Request, *gin.Context) {}), "X-Tenant-ID alone is no owner")
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AIRequestKind selects the body checks AIRequestValidator applies
+type AIRequestKind string
+
+const (
+	ChatRequest       AIRequestKind = "chat"       // messages is required
+	CompletionRequest AIRequestKind = "completion" // prompt is required
+)
+
+// AIRequestValidator 在请求转发到上游之前校验聊天和补全请求体：chat 请求的 messages
+// 不能为空且每条消息的 role 必须在允许列表中，completion 请求的 prompt 不能为空，
+// max_tokens 必须在配置的范围内。校验失败返回结构化的 400 错误，param 指出出错的字段。
+// 请求体读取后会被还原，后续处理器可以再次读取 c.Request.Body。
+func AIRequestValidator(cfg *config.ValidationConfig, kind AIRequestKind) gin.HandlerFunc {
+	roles := make(map[string]bool, len(cfg.AllowedRoles))
+	var allowed []string
+	for _, role := range cfg.AllowedRoles {
+		if role = strings.TrimSpace(role); role != "" && !roles[role] {
+			roles[role] = true
+			allowed = append(allowed, role)
+		}
+	}
+	allowedRoles := strings.Join(allowed, ", ")
+
+	return func(c *gin.Context) {
+		route := cfg.Routes[c.FullPath()]
+		if !cfg.Enabled || route.Disabled {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			rejectAIRequest(c, "Failed to read request body", "", "bad_request")
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var request map[string]interface{}
+		if err := json.Unmarshal(body, &request); err != nil || request == nil {
+			rejectAIRequest(c, "Request body must be a JSON object", "", "invalid_json")
+			return
+		}
+
+		maxMaxTokens := cfg.MaxMaxTokens
+		if route.MaxMaxTokens > 0 {
+			maxMaxTokens = route.MaxMaxTokens
+		}
+		var message, param string
+		switch kind {
+		case ChatRequest:
+			message, param = validateMessages(request["messages"], roles, allowedRoles)
+		case CompletionRequest:
+			message, param = validatePrompt(request["prompt"])
+		}
+		if message == "" {
+			message, param = validateMaxTokens(request["max_tokens"], cfg.MinMaxTokens, maxMaxTokens)
+		}
+		if message != "" {
+			rejectAIRequest(c, message, param, "invalid_parameter")
+			return
+		}
+		c.Next()
+	}
+}
+
+// validateMessages checks the messages of a chat request, returning the
+// problem and the offending parameter, or empty strings
+func validateMessages(raw interface{}, roles map[string]bool, allowedRoles string) (string, string) {
+	messages, ok := raw.([]interface{})
+	if !ok || len(messages) == 0 {
+		return "messages must be a non-empty array", "messages"
+	}
+	for i, raw := range messages {
+		param := fmt.Sprintf("messages[%d]", i)
+		message, ok := raw.(map[string]interface{})
+		if !ok {
+			return param + " must be an object", param
+		}
+		role, _ := message["role"].(string)
+		if !roles[role] {
+			return fmt.Sprintf("%s.role must be one of %s", param, allowedRoles), param + ".role"
+		}
+	}
+	return "", ""
+}
+
+// validatePrompt checks the prompt of a completion request: a non-empty string
+// or a non-empty array of prompts
+func validatePrompt(raw interface{}) (string, string) {
+	switch prompt := raw.(type) {
+	case string:
+		if strings.TrimSpace(prompt) != "" {
+			return "", ""
+		}
+	case []interface{}:
+		if len(prompt) > 0 {
+			return "", ""
+		}
+	}
+	return "prompt must be a non-empty string or array", "prompt"
+}
+
+// validateMaxTokens checks the optional max_tokens against [minTokens, maxTokens];
+// maxTokens 0 leaves it without an upper bound
+func validateMaxTokens(raw interface{}, minTokens, maxTokens int) (string, string) {
+	if raw == nil {
+		return "", ""
+	}
+	value, ok := raw.(float64)
+	if !ok || value != math.Trunc(value) {
+		return "max_tokens must be an integer", "max_tokens"
+	}
+	if value < float64(minTokens) || (maxTokens > 0 && value > float64(maxTokens)) {
+		if maxTokens > 0 {
+			return fmt.Sprintf("max_tokens must be between %d and %d", minTokens, maxTokens), "max_tokens"
+		}
+		return fmt.Sprintf("max_tokens must be at least %d", minTokens), "max_tokens"
+	}
+	return "", ""
+}
+
+func rejectAIRequest(c *gin.Context, message, param, code string) {
+	errorBody := gin.H{
+		"message": message,
+		"type":    "invalid_request_error",
+		"code":    code,
+	}
+	if param != "" {
+		errorBody["param"] = param
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": errorBody})
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newValidatedRouter(cfg *config.ValidationConfig, received *string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	handler := func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		*received = string(body)
+		c.Status(http.StatusOK)
+	}
+	r.POST("/api/v1/chat", AIRequestValidator(cfg, ChatRequest), handler)
+	r.POST("/api/v1/completions", AIRequestValidator(cfg, CompletionRequest), handler)
+	r.POST("/v1/chat/completions", AIRequestValidator(cfg, ChatRequest), handler)
+	return r
+}
+
+func TestAIRequestValidator(t *testing.T) {
+	cfg := &config.ValidationConfig{
+		Enabled:      true,
+		AllowedRoles: []string{"system", "user", "assistant"},
+		MinMaxTokens: 1,
+		MaxMaxTokens: 4096,
+		Routes: map[string]config.RouteValidationConfig{
+			"/api/v1/chat":         {MaxMaxTokens: 100},
+			"/v1/chat/completions": {Disabled: true},
+		},
+	}
+	var received string
+	r := newValidatedRouter(cfg, &received)
+
+	for _, tc := range []struct {
+		name  string
+		path  string
+		body  string
+		param string // empty when the request is accepted
+	}{
+		{"chat", "/api/v1/chat", `{"messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}],"max_tokens":100}`, ""},
+		{"missing messages", "/api/v1/chat", `{"model":"qwen-turbo"}`, "messages"},
+		{"empty messages", "/api/v1/chat", `{"messages":[]}`, "messages"},
+		{"message not an object", "/api/v1/chat", `{"messages":["hi"]}`, "messages[0]"},
+		{"unknown role", "/api/v1/chat", `{"messages":[{"role":"user","content":"hi"},{"role":"robot","content":"hi"}]}`, "messages[1].role"},
+		{"route max_tokens bound", "/api/v1/chat", `{"messages":[{"role":"user","content":"hi"}],"max_tokens":101}`, "max_tokens"},
+		{"max_tokens below minimum", "/api/v1/completions", `{"prompt":"hi","max_tokens":0}`, "max_tokens"},
+		{"fractional max_tokens", "/api/v1/completions", `{"prompt":"hi","max_tokens":1.5}`, "max_tokens"},
+		{"max_tokens string", "/api/v1/completions", `{"prompt":"hi","max_tokens":"10"}`, "max_tokens"},
+		{"global max_tokens bound", "/api/v1/completions", `{"prompt":"hi","max_tokens":4096}`, ""},
+		{"prompt array", "/api/v1/completions", `{"prompt":["a","b"]}`, ""},
+		{"blank prompt", "/api/v1/completions", `{"prompt":"  "}`, "prompt"},
+		{"missing prompt", "/api/v1/completions", `{"messages":[{"role":"user","content":"hi"}]}`, "prompt"},
+		{"validation disabled on route", "/v1/chat/completions", `{"messages":[]}`, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			received = ""
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body)))
+			if tc.param == "" {
+				assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+				assert.Equal(t, tc.body, received, "the body is preserved for the handler")
+				return
+			}
+			require.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Empty(t, received, "rejected requests do not reach the handler")
+			var resp struct {
+				Error struct {
+					Message string `json:"message"`
+					Type    string `json:"type"`
+					Code    string `json:"code"`
+					Param   string `json:"param"`
+				} `json:"error"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, "invalid_request_error", resp.Error.Type)
+			assert.Equal(t, "invalid_parameter", resp.Error.Code)
+			assert.Equal(t, tc.param, resp.Error.Param)
+			assert.NotEmpty(t, resp.Error.Message)
+		})
+	}
+}
+
+func TestAIRequestValidatorRejectsInvalidJSON(t *testing.T) {
+	var received string
+	r := newValidatedRouter(&config.ValidationConfig{Enabled: true, AllowedRoles: []string{"user"}}, &received)
+
+	for _, body := range []string{`{"messages":`, `[]`, `null`, ``} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/chat", strings.NewReader(body)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Contains(t, w.Body.String(), `"invalid_json"`, body)
+	}
+}
+
+func TestAIRequestValidatorDisabled(t *testing.T) {
+	var received string
+	r := newValidatedRouter(&config.ValidationConfig{}, &received)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/chat", strings.NewReader(`not json`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "not json", received)
+}
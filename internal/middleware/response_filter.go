@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FilterPattern 响应内容过滤规则：响应体中匹配 Pattern 的内容替换为 Replacement，
+// Replacement 可用 $1 等引用分组，按原样写入响应
+type FilterPattern struct {
+	Name        string
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+// FilterPatternSpec is the JSON form of a FilterPattern, as read from
+// CONTENT_FILTER_PATTERNS and POST /api/v1/admin/filter-patterns
+type FilterPatternSpec struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// CompileFilterPattern compiles the expression of spec
+func CompileFilterPattern(spec FilterPatternSpec) (FilterPattern, error) {
+	if strings.TrimSpace(spec.Name) == "" {
+		return FilterPattern{}, fmt.Errorf("filter pattern name is required")
+	}
+	if spec.Pattern == "" {
+		return FilterPattern{}, fmt.Errorf("filter pattern %s has no expression", spec.Name)
+	}
+	re, err := regexp.Compile(spec.Pattern)
+	if err != nil {
+		return FilterPattern{}, fmt.Errorf("invalid filter pattern %s: %w", spec.Name, err)
+	}
+	return FilterPattern{Name: spec.Name, Pattern: re, Replacement: spec.Replacement}, nil
+}
+
+// Spec returns the JSON form of the pattern
+func (p FilterPattern) Spec() FilterPatternSpec {
+	return FilterPatternSpec{Name: p.Name, Pattern: p.Pattern.String(), Replacement: p.Replacement}
+}
+
+// LoadFilterPatterns reads a JSON array of FilterPatternSpec from path
+func LoadFilterPatterns(path string) ([]FilterPattern, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var specs []FilterPatternSpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("invalid filter patterns in %s: %w", path, err)
+	}
+	patterns := make([]FilterPattern, 0, len(specs))
+	for _, spec := range specs {
+		pattern, err := CompileFilterPattern(spec)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// DefaultFilterPatterns returns the built-in patterns for secrets and personal
+// data. Card numbers are matched by issuer prefix and grouping rather than
+// any long digit run, so IDs and timestamps in JSON bodies are left alone.
+func DefaultFilterPatterns() []FilterPattern {
+	return []FilterPattern{
+		{Name: "aws_access_key_id", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`), Replacement: "[AWS_ACCESS_KEY]"},
+		{Name: "aws_secret_access_key", Pattern: regexp.MustCompile(`(?i)(aws_?secret_?(?:access_?)?key\W{1,4})[A-Za-z0-9/+=]{40}\b`), Replacement: "${1}[AWS_SECRET_KEY]"},
+		{Name: "api_key", Pattern: regexp.MustCompile(`\b(?:sk|gw)-[A-Za-z0-9_-]{16,}`), Replacement: "[API_KEY]"},
+		{Name: "ssn", Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), Replacement: "[SSN]"},
+		{Name: "credit_card", Pattern: regexp.MustCompile(`\b(?:(?:4\d{3}|5[1-5]\d{2}|2[2-7]\d{2}|6(?:011|5\d{2}))(?:[ -]?\d{4}){3}|3[47]\d{2}[ -]?\d{6}[ -]?\d{5})\b`), Replacement: "[CARD]"},
+		{Name: "email", Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), Replacement: "[EMAIL]"},
+	}
+}
+
+// ContentFilter 对响应体做敏感内容过滤。规则可在运行时通过 Add 追加，无需重启。
+type ContentFilter struct {
+	mutex    sync.RWMutex
+	patterns []FilterPattern
+}
+
+// NewContentFilter creates a filter applying patterns in order
+func NewContentFilter(patterns []FilterPattern) *ContentFilter {
+	return &ContentFilter{patterns: append([]FilterPattern(nil), patterns...)}
+}
+
+// ResponseFilter redacts every match of patterns in response bodies
+func ResponseFilter(patterns []FilterPattern) gin.HandlerFunc {
+	return NewContentFilter(patterns).Middleware()
+}
+
+// Add appends patterns, which apply to responses started afterwards
+func (f *ContentFilter) Add(patterns ...FilterPattern) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.patterns = append(f.patterns, patterns...)
+}
+
+// Patterns returns the patterns in the order they are applied
+func (f *ContentFilter) Patterns() []FilterPattern {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	return append([]FilterPattern(nil), f.patterns...)
+}
+
+// Middleware buffers the response and writes it with all patterns applied.
+// Streamed responses are filtered chunk by chunk on every flush, so a match
+// split across two chunks is not redacted. Compressed and binary bodies are
+// passed through unchanged.
+func (f *ContentFilter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		patterns := f.Patterns()
+		if len(patterns) == 0 {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		writer := &responseFilterWriter{ResponseWriter: original, patterns: patterns}
+		c.Writer = writer
+		c.Next()
+		c.Writer = original
+		writer.finish()
+	}
+}
+
+// applyFilterPatterns replaces the matches of every pattern in data
+func applyFilterPatterns(data []byte, patterns []FilterPattern) []byte {
+	for _, p := range patterns {
+		data = p.Pattern.ReplaceAll(data, []byte(p.Replacement))
+	}
+	return data
+}
+
+// filterableContentType reports whether a body of contentType is text the
+// patterns can apply to
+func filterableContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return contentType == "" ||
+		strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "xml") ||
+		strings.Contains(contentType, "event-stream")
+}
+
+// responseFilterWriter holds back the body until it is flushed or the handler
+// returns, and writes it filtered
+type responseFilterWriter struct {
+	gin.ResponseWriter
+	patterns    []FilterPattern
+	buf         bytes.Buffer
+	status      int
+	decided     bool
+	passthrough bool // compressed or binary body, written unchanged
+	committed   bool
+}
+
+// decide picks passthrough from the headers once the body starts
+func (w *responseFilterWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	header := w.ResponseWriter.Header()
+	encoding := header.Get("Content-Encoding")
+	w.passthrough = (encoding != "" && encoding != "identity") || !filterableContentType(header.Get("Content-Type"))
+	if !w.passthrough {
+		// The filtered body differs in length
+		header.Del("Content-Length")
+	}
+}
+
+func (w *responseFilterWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	w.decide()
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+}
+
+func (w *responseFilterWriter) WriteHeader(code int) {
+	if w.committed {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *responseFilterWriter) WriteHeaderNow() {
+	if w.committed {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *responseFilterWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.passthrough {
+		w.commit()
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+func (w *responseFilterWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responseFilterWriter) Status() int {
+	if w.committed || w.status == 0 {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *responseFilterWriter) Written() bool {
+	return w.committed || w.status != 0 || w.buf.Len() > 0
+}
+
+// Flush writes the buffered chunk filtered, keeping streamed responses streaming
+func (w *responseFilterWriter) Flush() {
+	w.writeBuffered()
+	w.ResponseWriter.Flush()
+}
+
+func (w *responseFilterWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.committed = true
+	w.passthrough = true
+	return w.ResponseWriter.Hijack()
+}
+
+// writeBuffered commits the status and writes the buffered body filtered
+func (w *responseFilterWriter) writeBuffered() {
+	w.commit()
+	if w.buf.Len() == 0 {
+		return
+	}
+	w.ResponseWriter.Write(applyFilterPatterns(w.buf.Bytes(), w.patterns))
+	w.buf.Reset()
+}
+
+// finish writes what the handler left buffered
+func (w *responseFilterWriter) finish() {
+	if w.committed && w.buf.Len() == 0 {
+		return
+	}
+	if w.status == 0 && w.buf.Len() == 0 {
+		return
+	}
+	w.writeBuffered()
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var retryBudgetExhausted = metricsFactory.NewCounter(
+	prometheus.CounterOpts{
+		Name: "aigateway_retry_budget_exhausted_total",
+		Help: "Total number of upstream retries skipped because the global retry budget was exhausted",
+	},
+)
+
+// RetryBudget 全局重试预算：所有客户端的重试共享一个令牌桶，
+// 上游故障时限制重试总量，避免重试风暴放大负载
+type RetryBudget struct {
+	mu       sync.Mutex
+	rate     float64 // tokens added per second
+	capacity float64
+	tokens   float64
+	last     time.Time
+	now      func() time.Time
+}
+
+// NewRetryBudget creates a budget allowing perSecond retries per second on
+// average, with bursts of up to one second's worth. A budget of zero allows no retries.
+func NewRetryBudget(perSecond float64) *RetryBudget {
+	capacity := perSecond
+	if perSecond > 0 {
+		capacity = math.Max(perSecond, 1)
+	}
+	b := &RetryBudget{
+		rate:     perSecond,
+		capacity: capacity,
+		tokens:   capacity,
+		now:      time.Now,
+	}
+	b.last = b.now()
+	return b
+}
+
+// Allow takes one token for a retry attempt. It reports false when the budget
+// is exhausted, in which case the caller must return the upstream error instead
+// of retrying. A nil budget allows every retry.
+func (b *RetryBudget) Allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		retryBudgetExhausted.Inc()
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// RetryPolicy retries a failed call with a fixed delay. Each retry beyond the
+// first attempt is drawn from the shared budget.
+type RetryPolicy struct {
+	MaxRetries int
+	Delay      time.Duration
+	Budget     *RetryBudget
+}
+
+// Do runs call until it succeeds, the retries or the budget run out, or ctx
+// is done, and returns the last error
+func (p RetryPolicy) Do(ctx context.Context, call func(ctx context.Context) error) error {
+	err := call(ctx)
+	for attempt := 0; err != nil && attempt < p.MaxRetries; attempt++ {
+		if !p.Budget.Allow() {
+			return err
+		}
+		if p.Delay > 0 {
+			select {
+			case <-time.After(p.Delay):
+			case <-ctx.Done():
+				return err
+			}
+		}
+		err = call(ctx)
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUpstreamDown = errors.New("upstream unavailable")
+
+func frozenRetryBudget(perSecond float64) (*RetryBudget, *time.Time) {
+	now := time.Now()
+	b := NewRetryBudget(perSecond)
+	b.now = func() time.Time { return now }
+	b.last = now
+	return b, &now
+}
+
+func TestRetryBudgetLimitsConcurrentRetries(t *testing.T) {
+	budget, _ := frozenRetryBudget(10)
+	policy := RetryPolicy{MaxRetries: 3, Budget: budget}
+	exhaustedBefore := testutil.ToFloat64(retryBudgetExhausted)
+
+	// Every request fails once; the outage ends before its first retry
+	var calls atomic.Int32
+	var succeeded, failed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			first := true
+			err := policy.Do(context.Background(), func(context.Context) error {
+				calls.Add(1)
+				if first {
+					first = false
+					return errUpstreamDown
+				}
+				return nil
+			})
+			if err == nil {
+				succeeded.Add(1)
+			} else {
+				assert.ErrorIs(t, err, errUpstreamDown)
+				failed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(110), calls.Load(), "100 first attempts and 10 retries")
+	assert.Equal(t, int32(10), succeeded.Load())
+	assert.Equal(t, int32(90), failed.Load())
+	assert.Equal(t, 90.0, testutil.ToFloat64(retryBudgetExhausted)-exhaustedBefore)
+}
+
+func TestRetryBudgetSparesFirstAttempts(t *testing.T) {
+	budget, _ := frozenRetryBudget(1)
+	require.True(t, budget.Allow())
+	require.False(t, budget.Allow())
+
+	// Requests that succeed first time never need the exhausted budget
+	policy := RetryPolicy{MaxRetries: 3, Budget: budget}
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, policy.Do(context.Background(), func(context.Context) error { return nil }))
+	}
+}
+
+func TestRetryBudgetReplenishes(t *testing.T) {
+	budget, now := frozenRetryBudget(2)
+	assert.True(t, budget.Allow())
+	assert.True(t, budget.Allow())
+	assert.False(t, budget.Allow())
+
+	*now = now.Add(500 * time.Millisecond)
+	assert.True(t, budget.Allow())
+	assert.False(t, budget.Allow())
+
+	// Idle time never banks more than the burst capacity
+	*now = now.Add(time.Hour)
+	assert.True(t, budget.Allow())
+	assert.True(t, budget.Allow())
+	assert.False(t, budget.Allow())
+
+	assert.False(t, NewRetryBudget(0).Allow(), "a zero budget disables retries")
+	var unlimited *RetryBudget
+	assert.True(t, unlimited.Allow())
+}
@@ -0,0 +1,292 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/providers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// SandboxContextKey marks requests made with a sandbox key; SLOs skip them and metrics label them
+const SandboxContextKey = "sandbox"
+
+// SandboxHeader is set on every response served to a sandbox key
+const SandboxHeader = "X-Gateway-Sandbox"
+
+// SandboxScenarioHeader selects a simulated failure
+const SandboxScenarioHeader = "X-Sandbox-Scenario"
+
+// Sandbox serves AI requests made with sandbox keys from the simulator provider,
+// so they never reach a real upstream. isSandboxKey reports managed keys flagged
+// sandbox; the static keys in cfg.Keys are always sandbox keys. Other requests pass through.
+func Sandbox(cfg *config.SandboxConfig, provider providers.Provider, isSandboxKey func(apiKey string) bool) gin.HandlerFunc {
+	static := make(map[string]bool, len(cfg.Keys))
+	for _, key := range cfg.Keys {
+		if key = strings.TrimSpace(key); key != "" {
+			static[key] = true
+		}
+	}
+	limiter := newRateLimiter(cfg.RateLimit)
+
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || (!static[token] && (isSandboxKey == nil || !isSandboxKey(token))) {
+			c.Next()
+			return
+		}
+
+		c.Set(SandboxContextKey, true)
+		c.Header(SandboxHeader, "true")
+		if !isAIRequest(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		// Sandbox keys share nothing with production rate limits
+		if !limiter.allow(token) {
+			c.Header("Retry-After", "60")
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": gin.H{
+					"message": "Sandbox rate limit exceeded",
+					"type":    "rate_limit_error",
+					"code":    "sandbox_rate_limit_exceeded",
+				},
+			})
+			return
+		}
+
+		scenario := c.GetHeader(SandboxScenarioHeader)
+		if !providers.IsValidSandboxScenario(scenario) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": fmt.Sprintf("Unknown sandbox scenario: %s", scenario),
+					"type":    "invalid_request_error",
+					"code":    "invalid_sandbox_scenario",
+				},
+			})
+			return
+		}
+		c.Request = c.Request.WithContext(providers.WithSandboxScenario(c.Request.Context(), scenario))
+
+		path := c.Request.URL.Path
+		switch {
+		case strings.HasSuffix(path, "/chat/completions") || path == "/api/v1/chat":
+			serveSandboxChat(c, provider)
+		case strings.HasSuffix(path, "/completions"):
+			serveSandboxCompletion(c, provider)
+		case strings.HasSuffix(path, "/embeddings"):
+			serveSandboxEmbeddings(c, provider)
+		case strings.HasSuffix(path, "/models") && c.Request.Method == http.MethodGet:
+			serveSandboxModels(c, provider)
+		default:
+			c.JSON(http.StatusNotImplemented, gin.H{
+				"error": gin.H{
+					"message": "Endpoint is not available to sandbox keys",
+					"type":    "invalid_request_error",
+					"code":    "sandbox_unsupported",
+				},
+			})
+		}
+		c.Abort()
+	}
+}
+
+// bindSandboxRequest decodes the request body, answering 400 on failure
+func bindSandboxRequest(c *gin.Context, v interface{}) bool {
+	if err := json.NewDecoder(c.Request.Body).Decode(v); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": "Invalid request body: " + err.Error(),
+				"type":    "invalid_request_error",
+				"code":    "invalid_request_body",
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// writeSandboxError renders a simulated upstream failure
+func writeSandboxError(c *gin.Context, err error) {
+	var sandboxErr *providers.SandboxError
+	if !errors.As(err, &sandboxErr) {
+		// The client went away or the request timed out in the gateway
+		logrus.WithError(err).Debug("Sandbox simulation aborted")
+		c.Status(http.StatusGatewayTimeout)
+		return
+	}
+	if sandboxErr.Status == http.StatusTooManyRequests {
+		c.Header("Retry-After", "1")
+	}
+	c.JSON(sandboxErr.Status, gin.H{
+		"error": gin.H{
+			"message": sandboxErr.Message,
+			"type":    sandboxErr.Type,
+			"code":    sandboxErr.Code,
+		},
+	})
+}
+
+func serveSandboxChat(c *gin.Context, provider providers.Provider) {
+	var req providers.ChatRequest
+	if !bindSandboxRequest(c, &req) {
+		return
+	}
+
+	if !req.Stream {
+		resp, err := provider.Chat(c.Request.Context(), &req)
+		if err != nil {
+			writeSandboxError(c, err)
+			return
+		}
+		choices := make([]gin.H, len(resp.Choices))
+		for i, choice := range resp.Choices {
+			choices[i] = gin.H{
+				"index":         choice.Index,
+				"message":       gin.H{"role": choice.Message.Role, "content": choice.Message.Content},
+				"finish_reason": choice.FinishReason,
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"id":      resp.ID,
+			"object":  resp.Object,
+			"created": resp.Created,
+			"model":   resp.Model,
+			"choices": choices,
+			"usage":   resp.Usage,
+		})
+		return
+	}
+
+	chunks, err := provider.ChatStream(c.Request.Context(), &req)
+	if err != nil {
+		writeSandboxError(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	for chunk := range chunks {
+		if chunk.Done {
+			break
+		}
+		choices := make([]gin.H, len(chunk.Choices))
+		for i, choice := range chunk.Choices {
+			delta := gin.H{}
+			if choice.Delta != nil {
+				if choice.Delta.Role != "" {
+					delta["role"] = choice.Delta.Role
+				}
+				if choice.Delta.Content != "" {
+					delta["content"] = choice.Delta.Content
+				}
+			}
+			var finishReason interface{}
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+			choices[i] = gin.H{"index": choice.Index, "delta": delta, "finish_reason": finishReason}
+		}
+		data, _ := json.Marshal(gin.H{
+			"id":      chunk.ID,
+			"object":  chunk.Object,
+			"created": chunk.Created,
+			"model":   chunk.Model,
+			"choices": choices,
+		})
+		fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+	}
+	if c.Request.Context().Err() == nil {
+		fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+		c.Writer.Flush()
+	}
+}
+
+func serveSandboxCompletion(c *gin.Context, provider providers.Provider) {
+	var req struct {
+		Model     string `json:"model"`
+		Prompt    string `json:"prompt"`
+		MaxTokens *int   `json:"max_tokens"`
+	}
+	if !bindSandboxRequest(c, &req) {
+		return
+	}
+
+	resp, err := provider.Chat(c.Request.Context(), &providers.ChatRequest{
+		Model:     req.Model,
+		Messages:  []providers.Message{{Role: "user", Content: req.Prompt}},
+		MaxTokens: req.MaxTokens,
+	})
+	if err != nil {
+		writeSandboxError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      strings.Replace(resp.ID, "chatcmpl-", "cmpl-", 1),
+		"object":  "text_completion",
+		"created": resp.Created,
+		"model":   resp.Model,
+		"choices": []gin.H{{
+			"index":         0,
+			"text":          resp.Choices[0].Message.Content,
+			"finish_reason": resp.Choices[0].FinishReason,
+		}},
+		"usage": resp.Usage,
+	})
+}
+
+func serveSandboxEmbeddings(c *gin.Context, provider providers.Provider) {
+	var raw struct {
+		Model string          `json:"model"`
+		Input json.RawMessage `json:"input"`
+	}
+	if !bindSandboxRequest(c, &raw) {
+		return
+	}
+	req := &providers.EmbeddingsRequest{Model: raw.Model}
+	var single string
+	if err := json.Unmarshal(raw.Input, &single); err == nil {
+		req.Input = []string{single}
+	} else if err := json.Unmarshal(raw.Input, &req.Input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": gin.H{
+				"message": "input must be a string or an array of strings",
+				"type":    "invalid_request_error",
+				"code":    "invalid_input",
+			},
+		})
+		return
+	}
+
+	resp, err := provider.Embeddings(c.Request.Context(), req)
+	if err != nil {
+		writeSandboxError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"object": resp.Object,
+		"model":  resp.Model,
+		"data":   resp.Data,
+		"usage":  gin.H{"prompt_tokens": resp.Usage.PromptTokens, "total_tokens": resp.Usage.TotalTokens},
+	})
+}
+
+func serveSandboxModels(c *gin.Context, provider providers.Provider) {
+	created := time.Now().Unix()
+	data := make([]gin.H, 0, len(provider.GetModels()))
+	for _, model := range provider.GetModels() {
+		data = append(data, gin.H{"id": model.Name, "object": "model", "created": created, "owned_by": provider.GetName()})
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": data})
+}
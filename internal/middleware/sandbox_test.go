@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/providers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sandboxTestKey = "sk-sandbox-test"
+
+func setupSandboxRouter(cfg *config.SandboxConfig) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+	provider := providers.NewSandboxProvider(providers.SandboxOptions{
+		LatencyMin:       cfg.LatencyMin,
+		LatencyMax:       cfg.LatencyMax,
+		CompletionTokens: cfg.CompletionTokens,
+		ChunkInterval:    cfg.ChunkInterval,
+		TimeoutAfter:     cfg.TimeoutAfter,
+	})
+
+	upstreamCalls := 0
+	r := gin.New()
+	r.Use(Sandbox(cfg, provider, func(apiKey string) bool { return apiKey == sandboxTestKey }))
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		upstreamCalls++
+		c.JSON(http.StatusOK, gin.H{"upstream": true})
+	})
+	return r, &upstreamCalls
+}
+
+func sandboxRequest(r http.Handler, key, scenario, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+key)
+	req.Header.Set("Content-Type", "application/json")
+	if scenario != "" {
+		req.Header.Set(SandboxScenarioHeader, scenario)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func testSandboxConfig() *config.SandboxConfig {
+	return &config.SandboxConfig{
+		Enabled:          true,
+		LatencyMin:       time.Millisecond,
+		LatencyMax:       5 * time.Millisecond,
+		CompletionTokens: 12,
+		ChunkInterval:    20 * time.Millisecond,
+		TimeoutAfter:     50 * time.Millisecond,
+		RateLimit:        100,
+	}
+}
+
+func TestSandboxSimulatesDeterministicResponses(t *testing.T) {
+	r, upstreamCalls := setupSandboxRouter(testSandboxConfig())
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hello sandbox"}]}`
+
+	w := sandboxRequest(r, sandboxTestKey, "", body)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get(SandboxHeader))
+
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage providers.Usage `json:"usage"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	content := resp.Choices[0].Message.Content
+	assert.Contains(t, content, "hello sandbox")
+	assert.Len(t, strings.Fields(content), 12)
+	assert.Equal(t, 12, resp.Usage.CompletionTokens)
+
+	// The same prompt always gets the same answer
+	again := sandboxRequest(r, sandboxTestKey, "", body)
+	assert.Contains(t, again.Body.String(), content)
+
+	// Real keys pass through to the upstream handler
+	w = sandboxRequest(r, "sk-real", "", body)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(SandboxHeader))
+	assert.Equal(t, 1, *upstreamCalls)
+}
+
+func TestSandboxScenarioInjection(t *testing.T) {
+	r, upstreamCalls := setupSandboxRouter(testSandboxConfig())
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+
+	w := sandboxRequest(r, sandboxTestKey, providers.SandboxScenarioRateLimited, body)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "rate_limit_exceeded")
+
+	start := time.Now()
+	w = sandboxRequest(r, sandboxTestKey, providers.SandboxScenarioTimeout, body)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), "upstream_timeout")
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+	w = sandboxRequest(r, sandboxTestKey, providers.SandboxScenarioContentFiltered, body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "content_filter")
+
+	// Mid-stream filtering ends the stream early with finish_reason content_filter
+	w = sandboxRequest(r, sandboxTestKey, providers.SandboxScenarioContentFiltered,
+		`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"finish_reason":"content_filter"`)
+	assert.True(t, strings.HasSuffix(w.Body.String(), "data: [DONE]\n\n"))
+
+	w = sandboxRequest(r, sandboxTestKey, "meltdown", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_sandbox_scenario")
+
+	assert.Equal(t, 0, *upstreamCalls)
+}
+
+func TestSandboxRateLimitedSeparately(t *testing.T) {
+	cfg := testSandboxConfig()
+	cfg.RateLimit = 2
+	cfg.Keys = []string{"sk-static-sandbox"}
+	r, _ := setupSandboxRouter(cfg)
+	body := `{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, sandboxRequest(r, sandboxTestKey, "", body).Code)
+	}
+	w := sandboxRequest(r, sandboxTestKey, "", body)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "sandbox_rate_limit_exceeded")
+
+	// Each sandbox key has its own budget
+	assert.Equal(t, http.StatusOK, sandboxRequest(r, "sk-static-sandbox", "", body).Code)
+}
+
+func TestSandboxStreamingChunkCadence(t *testing.T) {
+	r, _ := setupSandboxRouter(testSandboxConfig())
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/chat/completions",
+		strings.NewReader(`{"model":"gpt-4","stream":true,"messages":[{"role":"user","content":"stream please"}]}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+sandboxTestKey)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "true", resp.Header.Get(SandboxHeader))
+
+	var arrivals []time.Time
+	var content strings.Builder
+	var finishReason string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") || line == "data: [DONE]" {
+			continue
+		}
+		var chunk struct {
+			Object  string `json:"object"`
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason *string `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &chunk))
+		assert.Equal(t, "chat.completion.chunk", chunk.Object)
+		if text := chunk.Choices[0].Delta.Content; text != "" {
+			arrivals = append(arrivals, time.Now())
+			content.WriteString(text)
+		}
+		if chunk.Choices[0].FinishReason != nil {
+			finishReason = *chunk.Choices[0].FinishReason
+		}
+	}
+	require.NoError(t, scanner.Err())
+
+	// One token per chunk, spaced by the chunk interval
+	require.Len(t, arrivals, 12)
+	assert.Len(t, strings.Fields(content.String()), 12)
+	assert.Contains(t, content.String(), "stream please")
+	assert.Equal(t, "length", finishReason)
+	for i := 1; i < len(arrivals); i++ {
+		assert.GreaterOrEqual(t, arrivals[i].Sub(arrivals[i-1]), 10*time.Millisecond, "chunk %d arrived too early", i)
+	}
+	assert.GreaterOrEqual(t, arrivals[len(arrivals)-1].Sub(arrivals[0]), 11*20*time.Millisecond)
+}
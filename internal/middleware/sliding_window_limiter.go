@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"time"
 
+	"go-aigateway/internal/logging"
+
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
@@ -22,7 +24,7 @@ type SlidingWindowRateLimiter struct {
 func NewSlidingWindowRateLimiter(client *redis.Client, limit int, windowSize time.Duration) *SlidingWindowRateLimiter {
 	return &SlidingWindowRateLimiter{
 		client:     client,
-		logger:     logrus.New(),
+		logger:     logging.Default(),
 		windowSize: windowSize,
 		limit:      limit,
 	}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go-aigateway/internal/monitoring"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SLOTracking classifies every request against the configured SLOs. It must be
+// registered before RequestTimeout: the context is captured up front because
+// inner middleware cancel their derived contexts once they return.
+func SLOTracking(tracker *monitoring.SLOTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		start := time.Now()
+
+		c.Next()
+
+		// Simulated sandbox traffic says nothing about real service levels
+		if c.GetBool(SandboxContextKey) {
+			return
+		}
+
+		tenant := c.GetString("tenant_id")
+		if tenant == "" {
+			tenant = c.GetHeader("X-Tenant-ID")
+		}
+		tracker.Record(context.Background(), monitoring.Outcome{
+			Tenant:   tenant,
+			Status:   c.Writer.Status(),
+			Duration: time.Since(start),
+			Canceled: errors.Is(ctx.Err(), context.Canceled),
+			Time:     start,
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/monitoring"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SlowRequestsKey is the Redis list holding the most recent slow requests, newest first
+	SlowRequestsKey = "gw:slow:requests"
+
+	maxSlowRequests       = 100
+	maxGoroutineDumpBytes = 256 << 10
+	slowRequestStoreLimit = 5 * time.Second
+)
+
+// SlowRequest 一次耗时异常的请求：脱敏后的完整请求、耗时及发生时的goroutine快照
+type SlowRequest struct {
+	ID            string            `json:"id"`
+	Time          time.Time         `json:"time"`
+	Method        string            `json:"method"`
+	Path          string            `json:"path"`
+	Route         string            `json:"route"`
+	Model         string            `json:"model,omitempty"`
+	UserID        string            `json:"user_id,omitempty"`
+	Status        int               `json:"status"`
+	DurationMs    int64             `json:"duration_ms"`
+	P99Ms         int64             `json:"p99_ms"`
+	ThresholdMs   int64             `json:"threshold_ms"`
+	Headers       map[string]string `json:"headers"`
+	Body          string            `json:"body,omitempty"`
+	BodyTruncated bool              `json:"body_truncated,omitempty"`
+	Goroutines    string            `json:"goroutines"`
+}
+
+// latencySamples is a ring of recent durations with a cached P99
+type latencySamples struct {
+	values      []time.Duration
+	next        int
+	sinceUpdate int
+	p99         time.Duration
+}
+
+func (s *latencySamples) add(d time.Duration, size int) {
+	if len(s.values) < size {
+		s.values = append(s.values, d)
+	} else {
+		s.values[s.next] = d
+		s.next = (s.next + 1) % size
+	}
+	s.sinceUpdate++
+	// Re-sorting on every request is wasteful; the P99 moves slowly
+	if s.p99 == 0 || s.sinceUpdate >= max(size/10, 1) {
+		sorted := append([]time.Duration(nil), s.values...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		s.p99 = sorted[(len(sorted)*99-1)/100]
+		s.sinceUpdate = 0
+	}
+}
+
+// SlowRequestDetector 慢请求检测：请求耗时超过所在路由滚动P99的若干倍时，
+// 将请求（去掉认证信息）、耗时和goroutine快照写入Redis，超过告警阈值时通知Slack
+type SlowRequestDetector struct {
+	client *redis.Client
+	cfg    config.SlowRequestConfig
+	slack  *http.Client
+
+	mu     sync.Mutex
+	routes map[string]*latencySamples
+}
+
+// NewSlowRequestDetector creates a detector storing slow requests in client
+func NewSlowRequestDetector(client *redis.Client, cfg config.SlowRequestConfig) *SlowRequestDetector {
+	return &SlowRequestDetector{
+		client: client,
+		cfg:    cfg,
+		slack:  httpclient.NewClient("slow_request_alert", 5*time.Second),
+		routes: make(map[string]*latencySamples),
+	}
+}
+
+// observe judges a duration against the route's P99 before adding it to the samples
+func (d *SlowRequestDetector) observe(route string, duration time.Duration) (p99, threshold time.Duration, slow bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	samples := d.routes[route]
+	if samples == nil {
+		samples = &latencySamples{}
+		d.routes[route] = samples
+	}
+	if len(samples.values) >= d.cfg.MinSamples {
+		p99 = samples.p99
+		threshold = time.Duration(float64(p99) * d.cfg.Multiplier)
+		slow = duration > threshold
+	}
+	samples.add(duration, d.cfg.SampleSize)
+	return p99, threshold, slow
+}
+
+// Middleware times every request and captures the outliers
+func (d *SlowRequestDetector) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		var body *limitedBuffer
+		if c.Request.Body != nil && d.cfg.MaxBodyBytes > 0 {
+			// Keep what the handlers read; the request is only known to be slow afterwards
+			body = &limitedBuffer{limit: d.cfg.MaxBodyBytes}
+			c.Request.Body = readCloser{Reader: io.TeeReader(c.Request.Body, body), Closer: c.Request.Body}
+		}
+
+		c.Next()
+
+		duration := time.Since(start)
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		p99, threshold, slow := d.observe(route, duration)
+		if !slow || c.GetBool(SandboxContextKey) {
+			return
+		}
+
+		entry := SlowRequest{
+			ID:          fmt.Sprintf("slow-%d", start.UnixNano()),
+			Time:        start.UTC(),
+			Method:      c.Request.Method,
+			Path:        monitoring.RedactText(c.Request.URL.RequestURI()),
+			Route:       route,
+			Model:       c.GetString(ModelContextKey),
+			UserID:      c.GetString("user_id"),
+			Status:      c.Writer.Status(),
+			DurationMs:  duration.Milliseconds(),
+			P99Ms:       p99.Milliseconds(),
+			ThresholdMs: threshold.Milliseconds(),
+			Headers:     monitoring.RedactHeaders(c.Request.Header),
+			Goroutines:  goroutineDump(),
+		}
+		if body != nil {
+			entry.Body = monitoring.RedactText(string(bytes.ToValidUTF8(body.Bytes(), nil)))
+			entry.BodyTruncated = body.truncated
+		}
+
+		// Storing and alerting must not delay the response any further
+		go d.record(entry, duration)
+	}
+}
+
+func (d *SlowRequestDetector) record(entry SlowRequest, duration time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), slowRequestStoreLimit)
+	defer cancel()
+
+	logrus.WithFields(logrus.Fields{
+		"route":        entry.Route,
+		"duration_ms":  entry.DurationMs,
+		"threshold_ms": entry.ThresholdMs,
+		"status":       entry.Status,
+	}).Warn("Slow request captured")
+
+	if err := d.store(ctx, entry); err != nil {
+		logrus.WithError(err).Error("Failed to store slow request")
+	}
+	if d.cfg.AlertThreshold > 0 && d.cfg.SlackWebhookURL != "" && duration >= d.cfg.AlertThreshold {
+		if err := d.notifySlack(ctx, entry); err != nil {
+			logrus.WithError(err).Error("Failed to send slow request alert to Slack")
+		}
+	}
+}
+
+func (d *SlowRequestDetector) store(ctx context.Context, entry SlowRequest) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	pipe := d.client.TxPipeline()
+	pipe.LPush(ctx, SlowRequestsKey, data)
+	pipe.LTrim(ctx, SlowRequestsKey, 0, maxSlowRequests-1)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// List returns up to limit of the most recent slow requests, newest first
+func (d *SlowRequestDetector) List(ctx context.Context, limit int) ([]SlowRequest, error) {
+	if limit <= 0 || limit > maxSlowRequests {
+		limit = maxSlowRequests
+	}
+	raw, err := d.client.LRange(ctx, SlowRequestsKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read slow requests: %w", err)
+	}
+	entries := make([]SlowRequest, 0, len(raw))
+	for _, item := range raw {
+		var entry SlowRequest
+		if err := json.Unmarshal([]byte(item), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// notifySlack posts a short summary to the Slack incoming webhook
+func (d *SlowRequestDetector) notifySlack(ctx context.Context, entry SlowRequest) error {
+	payload, _ := json.Marshal(map[string]string{
+		"text": fmt.Sprintf(":snail: Slow request %s %s took %dms (route P99 %dms, status %d, id %s)",
+			entry.Method, entry.Route, entry.DurationMs, entry.P99Ms, entry.Status, entry.ID),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.cfg.SlackWebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.slack.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// goroutineDump returns the aggregated goroutine profile, truncated to a bounded size
+func goroutineDump() string {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return ""
+	}
+	if buf.Len() > maxGoroutineDumpBytes {
+		return string(buf.Bytes()[:maxGoroutineDumpBytes]) + "\n... truncated"
+	}
+	return buf.String()
+}
+
+// limitedBuffer keeps the first limit bytes written to it
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
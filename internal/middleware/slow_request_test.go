@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func slowRequestRouter(t *testing.T, cfg config.SlowRequestConfig) (*SlowRequestDetector, *gin.Engine) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	gin.SetMode(gin.TestMode)
+	detector := NewSlowRequestDetector(client, cfg)
+	router := gin.New()
+	router.Use(detector.Middleware())
+	router.POST("/v1/chat/completions", func(c *gin.Context) {
+		io.ReadAll(c.Request.Body)
+		c.Set(ModelContextKey, "qwen-max")
+		if delay, err := time.ParseDuration(c.Query("delay")); err == nil {
+			time.Sleep(delay)
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	// Warm the route up with a 5ms P99
+	for i := 0; i < cfg.MinSamples; i++ {
+		detector.observe("/v1/chat/completions", 5*time.Millisecond)
+	}
+	return detector, router
+}
+
+func postSlow(router *gin.Engine, delay string) {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions?delay="+delay, strings.NewReader(`{"model":"qwen-max","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-secret-key")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestSlowRequestDetectorCapturesOutliers(t *testing.T) {
+	detector, router := slowRequestRouter(t, config.SlowRequestConfig{
+		Enabled:      true,
+		Multiplier:   3,
+		SampleSize:   100,
+		MinSamples:   20,
+		MaxBodyBytes: 1024,
+	})
+
+	postSlow(router, "0s")
+	postSlow(router, "60ms")
+
+	var captured []SlowRequest
+	require.Eventually(t, func() bool {
+		captured, _ = detector.List(context.Background(), 10)
+		return len(captured) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	entry := captured[0]
+	assert.Equal(t, "/v1/chat/completions", entry.Route)
+	assert.Equal(t, "qwen-max", entry.Model)
+	assert.Equal(t, http.StatusOK, entry.Status)
+	assert.GreaterOrEqual(t, entry.DurationMs, int64(60))
+	assert.Equal(t, int64(5), entry.P99Ms)
+	assert.Equal(t, int64(15), entry.ThresholdMs)
+	assert.Equal(t, "[REDACTED]", entry.Headers["Authorization"])
+	assert.Contains(t, entry.Body, `"content":"hi"`)
+	assert.Contains(t, entry.Goroutines, "goroutine profile")
+}
+
+func TestSlowRequestDetectorNeedsBaseline(t *testing.T) {
+	detector := NewSlowRequestDetector(nil, config.SlowRequestConfig{Multiplier: 3, SampleSize: 10, MinSamples: 5})
+
+	for i := 0; i < 4; i++ {
+		_, _, slow := detector.observe("/v1/models", time.Duration(i+1)*time.Millisecond)
+		assert.False(t, slow)
+	}
+	// Requests are only judged once the route has enough samples
+	_, _, slow := detector.observe("/v1/models", time.Second)
+	assert.False(t, slow)
+	_, _, slow = detector.observe("/v1/models", time.Second)
+	assert.False(t, slow, "a second outlier moves the P99 of a small sample")
+
+	_, _, slow = detector.observe("/v1/embeddings", time.Hour)
+	assert.False(t, slow, "routes are judged separately")
+}
+
+func TestSlowRequestDetectorTrimsAndAlerts(t *testing.T) {
+	var alerts int32
+	var text string
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		text = payload["text"]
+		atomic.AddInt32(&alerts, 1)
+	}))
+	defer slack.Close()
+
+	detector, _ := slowRequestRouter(t, config.SlowRequestConfig{
+		Enabled:         true,
+		Multiplier:      3,
+		SampleSize:      100,
+		MinSamples:      20,
+		AlertThreshold:  time.Second,
+		SlackWebhookURL: slack.URL,
+	})
+
+	ctx := context.Background()
+	for i := 0; i < maxSlowRequests+5; i++ {
+		require.NoError(t, detector.store(ctx, SlowRequest{ID: "slow-" + string(rune('a'+i%26))}))
+	}
+	all, err := detector.List(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, all, maxSlowRequests)
+
+	// Only requests above the alert threshold reach Slack
+	detector.record(SlowRequest{ID: "fast", Route: "/v1/chat/completions", DurationMs: 500}, 500*time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&alerts))
+	detector.record(SlowRequest{ID: "slow-1", Route: "/v1/chat/completions", DurationMs: 2000}, 2*time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&alerts))
+	assert.Contains(t, text, "/v1/chat/completions took 2000ms")
+}
@@ -0,0 +1,484 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/security"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+)
+
+// Debug capture error categories
+const (
+	CaptureCategoryClientError   = "client_error"
+	CaptureCategoryRateLimited   = "rate_limited"
+	CaptureCategoryTimeout       = "timeout"
+	CaptureCategoryUpstreamError = "upstream_error"
+)
+
+// Reasons a capture is armed or disarmed
+const (
+	CaptureReasonErrorSpike  = "error_spike"
+	CaptureReasonManual      = "manual"
+	CaptureReasonExpired     = "expired"
+	CaptureReasonMaxCaptures = "max_captures"
+)
+
+var debugCaptureActivations = promauto.With(registry).NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "aigateway_debug_capture_activations_total",
+		Help: "Total number of debug capture activations",
+	},
+	[]string{"reason"},
+)
+
+// ErrorCategory classifies a response status, "" for success
+func ErrorCategory(status int) string {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return CaptureCategoryRateLimited
+	case status == http.StatusGatewayTimeout || status == http.StatusRequestTimeout:
+		return CaptureCategoryTimeout
+	case status >= 500:
+		return CaptureCategoryUpstreamError
+	case status >= 400:
+		return CaptureCategoryClientError
+	}
+	return ""
+}
+
+// CaptureTarget 一个(路由, 模型, 错误类别)组合；激活中Model或Category为空表示匹配任意值
+type CaptureTarget struct {
+	Route    string `json:"route"`
+	Model    string `json:"model"`
+	Category string `json:"category"`
+}
+
+func (t CaptureTarget) String() string {
+	return fmt.Sprintf("%s|%s|%s", t.Route, t.Model, t.Category)
+}
+
+// matches reports whether an exchange falls under an activation or filter
+func (t CaptureTarget) matches(exchange CaptureTarget) bool {
+	return (t.Route == "" || t.Route == exchange.Route) &&
+		(t.Model == "" || t.Model == exchange.Model) &&
+		(t.Category == "" || t.Category == exchange.Category)
+}
+
+// CaptureActivation 一次调试抓取的激活
+type CaptureActivation struct {
+	CaptureTarget
+	Reason      string    `json:"reason"`
+	Actor       string    `json:"actor,omitempty"`
+	ArmedAt     time.Time `json:"armed_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	MaxCaptures int       `json:"max_captures"`
+	Captured    int       `json:"captured"`
+}
+
+// RawExchange is a request/response pair before redaction
+type RawExchange struct {
+	Method         string
+	Path           string
+	Status         int
+	Duration       time.Duration
+	RequestHeader  http.Header
+	RequestBody    []byte
+	ResponseHeader http.Header
+	ResponseBody   []byte
+}
+
+// CapturedExchange 已脱敏的请求/响应记录
+type CapturedExchange struct {
+	ID string `json:"id"`
+	CaptureTarget
+	Time              time.Time         `json:"time"`
+	Method            string            `json:"method"`
+	Path              string            `json:"path"`
+	Status            int               `json:"status"`
+	DurationMs        int64             `json:"duration_ms"`
+	RequestHeaders    map[string]string `json:"request_headers"`
+	RequestBody       string            `json:"request_body,omitempty"`
+	ResponseHeaders   map[string]string `json:"response_headers"`
+	ResponseBody      string            `json:"response_body,omitempty"`
+	RequestTruncated  bool              `json:"request_truncated,omitempty"`
+	ResponseTruncated bool              `json:"response_truncated,omitempty"`
+
+	size int
+}
+
+// Auditor records security audit events; *security.AuditLogger implements it
+type Auditor interface {
+	LogWithContext(ctx context.Context, event *security.AuditEvent)
+}
+
+// ruleEvaluator raises and resolves alerts; *MonitoringSystem implements it
+type ruleEvaluator interface {
+	EvaluateRule(ctx context.Context, rule *Rule, value float64, firing bool)
+}
+
+type outcomeWindow struct {
+	start  time.Time
+	total  int
+	errors map[string]int
+}
+
+// captureNotice is an activation change to audit and alert on outside the lock
+type captureNotice struct {
+	activation CaptureActivation
+	armed      bool
+	reason     string
+}
+
+// DebugCapture 自适应调试抓取：某个(路由, 模型, 错误类别)的错误率突增时，在有限的内存中
+// 保存该组合完整的脱敏请求/响应，超时或达到抓取上限后自动解除。每次激活都会写审计事件并告警。
+type DebugCapture struct {
+	cfg    config.DebugCaptureConfig
+	audit  Auditor
+	alerts ruleEvaluator
+	now    func() time.Time
+
+	// armed counts active activations so unarmed requests skip capture with one atomic load
+	armed atomic.Int32
+
+	mu       sync.Mutex
+	windows  map[[2]string]*outcomeWindow
+	active   map[CaptureTarget]*CaptureActivation
+	lastAuto map[CaptureTarget]time.Time
+	captures []*CapturedExchange // oldest first
+	bytes    int
+	seq      uint64
+}
+
+// NewDebugCapture creates the capture; audit and ms may be nil
+func NewDebugCapture(cfg config.DebugCaptureConfig, audit Auditor, ms *MonitoringSystem) *DebugCapture {
+	dc := &DebugCapture{
+		cfg:      cfg,
+		audit:    audit,
+		now:      time.Now,
+		windows:  make(map[[2]string]*outcomeWindow),
+		active:   make(map[CaptureTarget]*CaptureActivation),
+		lastAuto: make(map[CaptureTarget]time.Time),
+	}
+	if ms != nil {
+		dc.alerts = ms
+	}
+	return dc
+}
+
+// Armed reports whether any activation is live; the only cost on unarmed requests
+func (dc *DebugCapture) Armed() bool {
+	return dc.armed.Load() > 0
+}
+
+// MaxBodyBytes is the size bodies are truncated to
+func (dc *DebugCapture) MaxBodyBytes() int {
+	return dc.cfg.MaxBodyBytes
+}
+
+// Wants reports whether requests to route may be captured
+func (dc *DebugCapture) Wants(route string) bool {
+	dc.mu.Lock()
+	notices := dc.expireLocked()
+	wanted := false
+	for target := range dc.active {
+		if target.Route == route {
+			wanted = true
+			break
+		}
+	}
+	dc.mu.Unlock()
+	dc.notify(notices)
+	return wanted
+}
+
+// Record counts a request outcome and arms capture for its combination when
+// that error category's share of the window passes the threshold
+func (dc *DebugCapture) Record(route, model string, status int) {
+	now := dc.now()
+	category := ErrorCategory(status)
+
+	dc.mu.Lock()
+	notices := dc.expireLocked()
+
+	key := [2]string{route, model}
+	window := dc.windows[key]
+	if window == nil || now.Sub(window.start) >= dc.cfg.Window {
+		window = &outcomeWindow{start: now, errors: make(map[string]int)}
+		dc.windows[key] = window
+	}
+	window.total++
+
+	if category != "" {
+		window.errors[category]++
+		target := CaptureTarget{Route: route, Model: model, Category: category}
+		share := float64(window.errors[category]) / float64(window.total)
+		if window.total >= dc.cfg.MinRequests && share >= dc.cfg.ErrorThreshold && dc.active[target] == nil {
+			if last, ok := dc.lastAuto[target]; !ok || now.Sub(last) >= dc.cfg.CoolDown {
+				dc.lastAuto[target] = now
+				activation := dc.armLocked(target, CaptureReasonErrorSpike, "", dc.cfg.Duration, dc.cfg.MaxCaptures)
+				notices = append(notices, captureNotice{activation: activation, armed: true, reason: CaptureReasonErrorSpike})
+			}
+		}
+	}
+	dc.mu.Unlock()
+	dc.notify(notices)
+}
+
+// Capture stores a redacted exchange if an activation covers it
+func (dc *DebugCapture) Capture(route, model string, raw RawExchange) bool {
+	target := CaptureTarget{Route: route, Model: model, Category: ErrorCategory(raw.Status)}
+
+	dc.mu.Lock()
+	notices := dc.expireLocked()
+	var activation *CaptureActivation
+	for _, a := range dc.active {
+		if a.CaptureTarget.matches(target) {
+			activation = a
+			break
+		}
+	}
+	dc.mu.Unlock()
+	if activation == nil {
+		dc.notify(notices)
+		return false
+	}
+
+	exchange := dc.redact(target, raw)
+
+	dc.mu.Lock()
+	// The activation may have ended while redacting
+	if dc.active[activation.CaptureTarget] != activation {
+		dc.mu.Unlock()
+		dc.notify(notices)
+		return false
+	}
+	dc.seq++
+	exchange.ID = fmt.Sprintf("cap-%d", dc.seq)
+	dc.captures = append(dc.captures, exchange)
+	dc.bytes += exchange.size
+	for dc.bytes > dc.cfg.MemoryBudget && len(dc.captures) > 0 {
+		dc.bytes -= dc.captures[0].size
+		dc.captures[0] = nil
+		dc.captures = dc.captures[1:]
+	}
+
+	activation.Captured++
+	if activation.Captured >= activation.MaxCaptures {
+		notices = append(notices, dc.disarmLocked(activation.CaptureTarget, CaptureReasonMaxCaptures))
+	}
+	dc.mu.Unlock()
+	dc.notify(notices)
+	return true
+}
+
+// redact builds the stored form of an exchange
+func (dc *DebugCapture) redact(target CaptureTarget, raw RawExchange) *CapturedExchange {
+	exchange := &CapturedExchange{
+		CaptureTarget:   target,
+		Time:            dc.now(),
+		Method:          raw.Method,
+		Path:            RedactText(raw.Path),
+		Status:          raw.Status,
+		DurationMs:      raw.Duration.Milliseconds(),
+		RequestHeaders:  RedactHeaders(raw.RequestHeader),
+		ResponseHeaders: RedactHeaders(raw.ResponseHeader),
+	}
+	exchange.RequestBody, exchange.RequestTruncated = RedactBody(raw.RequestBody, dc.cfg.MaxBodyBytes)
+	exchange.ResponseBody, exchange.ResponseTruncated = RedactBody(raw.ResponseBody, dc.cfg.MaxBodyBytes)
+
+	size := len(exchange.Method) + len(exchange.Path) + len(exchange.RequestBody) + len(exchange.ResponseBody)
+	for _, headers := range []map[string]string{exchange.RequestHeaders, exchange.ResponseHeaders} {
+		for key, value := range headers {
+			size += len(key) + len(value)
+		}
+	}
+	exchange.size = size
+	return exchange
+}
+
+// Start arms capture manually; zero duration or maxCaptures use the configured defaults
+func (dc *DebugCapture) Start(target CaptureTarget, actor string, duration time.Duration, maxCaptures int) (CaptureActivation, error) {
+	if target.Route == "" {
+		return CaptureActivation{}, fmt.Errorf("route is required")
+	}
+	if duration <= 0 || duration > dc.cfg.Duration {
+		duration = dc.cfg.Duration
+	}
+	if maxCaptures <= 0 || maxCaptures > dc.cfg.MaxCaptures {
+		maxCaptures = dc.cfg.MaxCaptures
+	}
+
+	dc.mu.Lock()
+	var notices []captureNotice
+	if dc.active[target] != nil {
+		notices = append(notices, dc.disarmLocked(target, CaptureReasonManual))
+	}
+	activation := dc.armLocked(target, CaptureReasonManual, actor, duration, maxCaptures)
+	notices = append(notices, captureNotice{activation: activation, armed: true, reason: CaptureReasonManual})
+	dc.mu.Unlock()
+	dc.notify(notices)
+	return activation, nil
+}
+
+// Stop disarms an activation, reporting whether it was active
+func (dc *DebugCapture) Stop(target CaptureTarget, actor string) bool {
+	dc.mu.Lock()
+	if dc.active[target] == nil {
+		dc.mu.Unlock()
+		return false
+	}
+	notice := dc.disarmLocked(target, CaptureReasonManual)
+	notice.activation.Actor = actor
+	dc.mu.Unlock()
+	dc.notify([]captureNotice{notice})
+	return true
+}
+
+// Activations returns the live activations
+func (dc *DebugCapture) Activations() []CaptureActivation {
+	dc.mu.Lock()
+	notices := dc.expireLocked()
+	activations := make([]CaptureActivation, 0, len(dc.active))
+	for _, a := range dc.active {
+		activations = append(activations, *a)
+	}
+	dc.mu.Unlock()
+	dc.notify(notices)
+
+	sort.Slice(activations, func(i, j int) bool { return activations[i].ArmedAt.Before(activations[j].ArmedAt) })
+	return activations
+}
+
+// Captures returns up to limit stored exchanges matching filter, newest first
+func (dc *DebugCapture) Captures(filter CaptureTarget, limit int) []CapturedExchange {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	captures := []CapturedExchange{}
+	for i := len(dc.captures) - 1; i >= 0 && (limit <= 0 || len(captures) < limit); i-- {
+		if filter.matches(dc.captures[i].CaptureTarget) {
+			captures = append(captures, *dc.captures[i])
+		}
+	}
+	return captures
+}
+
+// MemoryUsage returns the bytes held by stored exchanges
+func (dc *DebugCapture) MemoryUsage() int {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	return dc.bytes
+}
+
+// armLocked records an activation; callers hold dc.mu
+func (dc *DebugCapture) armLocked(target CaptureTarget, reason, actor string, duration time.Duration, maxCaptures int) CaptureActivation {
+	now := dc.now()
+	activation := &CaptureActivation{
+		CaptureTarget: target,
+		Reason:        reason,
+		Actor:         actor,
+		ArmedAt:       now,
+		ExpiresAt:     now.Add(duration),
+		MaxCaptures:   maxCaptures,
+	}
+	dc.active[target] = activation
+	dc.armed.Add(1)
+	debugCaptureActivations.WithLabelValues(reason).Inc()
+	return *activation
+}
+
+// disarmLocked removes an activation; callers hold dc.mu
+func (dc *DebugCapture) disarmLocked(target CaptureTarget, reason string) captureNotice {
+	activation := dc.active[target]
+	delete(dc.active, target)
+	dc.armed.Add(-1)
+	return captureNotice{activation: *activation, reason: reason}
+}
+
+// expireLocked disarms activations past their expiry; callers hold dc.mu
+func (dc *DebugCapture) expireLocked() []captureNotice {
+	if dc.armed.Load() == 0 {
+		return nil
+	}
+	now := dc.now()
+	var notices []captureNotice
+	for target, activation := range dc.active {
+		if !now.Before(activation.ExpiresAt) {
+			notices = append(notices, dc.disarmLocked(target, CaptureReasonExpired))
+		}
+	}
+	return notices
+}
+
+// notify audits and alerts on every activation change so capture can never run unnoticed
+func (dc *DebugCapture) notify(notices []captureNotice) {
+	ctx := context.Background()
+	for _, notice := range notices {
+		a := notice.activation
+		eventType := "debug_capture_disarmed"
+		if notice.armed {
+			eventType = "debug_capture_armed"
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"route":    a.Route,
+			"model":    a.Model,
+			"category": a.Category,
+			"reason":   notice.reason,
+			"actor":    a.Actor,
+			"captured": a.Captured,
+		}).Warn(strings.ReplaceAll(eventType, "_", " "))
+
+		if dc.audit != nil {
+			dc.audit.LogWithContext(ctx, &security.AuditEvent{
+				ID:        generateCaptureEventID(),
+				Type:      eventType,
+				Action:    notice.reason,
+				Resource:  a.CaptureTarget.String(),
+				UserID:    a.Actor,
+				Timestamp: dc.now(),
+				Details: map[string]interface{}{
+					"route":        a.Route,
+					"model":        a.Model,
+					"category":     a.Category,
+					"expires_at":   a.ExpiresAt,
+					"max_captures": a.MaxCaptures,
+					"captured":     a.Captured,
+				},
+			})
+		}
+		if dc.alerts != nil {
+			dc.alerts.EvaluateRule(ctx, debugCaptureRule(a.CaptureTarget), float64(a.Captured), notice.armed)
+		}
+	}
+}
+
+// debugCaptureRule is the alert raised while a combination is being captured
+func debugCaptureRule(target CaptureTarget) *Rule {
+	return &Rule{
+		ID:          "debug_capture_" + target.String(),
+		Name:        "Debug capture armed for " + target.Route,
+		Description: fmt.Sprintf("Verbose request capture is active for route %s, model %q, category %q", target.Route, target.Model, target.Category),
+		MetricKey:   "debug_capture_captured",
+		Operator:    ">=",
+		Level:       AlertLevelWarning,
+		Enabled:     true,
+	}
+}
+
+var captureEventSeq atomic.Uint64
+
+func generateCaptureEventID() string {
+	return fmt.Sprintf("debug-capture-%d-%d", time.Now().UnixNano(), captureEventSeq.Add(1))
+}
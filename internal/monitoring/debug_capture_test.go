@@ -0,0 +1,231 @@
+package monitoring
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/security"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAuditor struct {
+	mu     sync.Mutex
+	events []*security.AuditEvent
+}
+
+func (a *fakeAuditor) LogWithContext(_ context.Context, event *security.AuditEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.events = append(a.events, event)
+}
+
+func (a *fakeAuditor) types() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var types []string
+	for _, event := range a.events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+type fakeEvaluator struct {
+	firing map[string]bool
+}
+
+func (e *fakeEvaluator) EvaluateRule(_ context.Context, rule *Rule, _ float64, firing bool) {
+	e.firing[rule.ID] = firing
+}
+
+func newTestDebugCapture(cfg config.DebugCaptureConfig) (*DebugCapture, *fakeAuditor, *fakeEvaluator, *time.Time) {
+	auditor := &fakeAuditor{}
+	evaluator := &fakeEvaluator{firing: make(map[string]bool)}
+	dc := NewDebugCapture(cfg, auditor, nil)
+	dc.alerts = evaluator
+	now := time.Date(2026, 5, 1, 9, 0, 0, 0, time.UTC)
+	dc.now = func() time.Time { return now }
+	return dc, auditor, evaluator, &now
+}
+
+func testDebugCaptureConfig() config.DebugCaptureConfig {
+	return config.DebugCaptureConfig{
+		Enabled:        true,
+		ErrorThreshold: 0.5,
+		MinRequests:    10,
+		Window:         time.Minute,
+		Duration:       10 * time.Minute,
+		CoolDown:       30 * time.Minute,
+		MaxCaptures:    3,
+		MemoryBudget:   1 << 20,
+		MaxBodyBytes:   1 << 10,
+	}
+}
+
+func rawExchange(status int, body string) RawExchange {
+	return RawExchange{
+		Method:         http.MethodPost,
+		Path:           "/v1/chat/completions",
+		Status:         status,
+		RequestHeader:  http.Header{"Content-Type": {"application/json"}},
+		RequestBody:    []byte(body),
+		ResponseHeader: http.Header{},
+		ResponseBody:   []byte(`{"error":{"message":"upstream failed"}}`),
+	}
+}
+
+func TestDebugCaptureArmsOnErrorSpike(t *testing.T) {
+	dc, auditor, evaluator, _ := newTestDebugCapture(testDebugCaptureConfig())
+	target := CaptureTarget{Route: "/v1/chat/completions", Model: "qwen-max", Category: CaptureCategoryUpstreamError}
+
+	// Errors below the minimum volume do not arm
+	for i := 0; i < 4; i++ {
+		dc.Record(target.Route, target.Model, http.StatusOK)
+	}
+	for i := 0; i < 5; i++ {
+		dc.Record(target.Route, target.Model, http.StatusBadGateway)
+	}
+	assert.False(t, dc.Armed())
+
+	dc.Record(target.Route, target.Model, http.StatusBadGateway)
+	require.True(t, dc.Armed())
+	assert.True(t, dc.Wants(target.Route))
+	assert.False(t, dc.Wants("/v1/embeddings"))
+
+	activations := dc.Activations()
+	require.Len(t, activations, 1)
+	assert.Equal(t, target, activations[0].CaptureTarget)
+	assert.Equal(t, CaptureReasonErrorSpike, activations[0].Reason)
+	assert.Equal(t, []string{"debug_capture_armed"}, auditor.types())
+	assert.True(t, evaluator.firing["debug_capture_"+target.String()])
+
+	// Only the spiking combination is captured
+	assert.False(t, dc.Capture(target.Route, "qwen-turbo", rawExchange(http.StatusBadGateway, `{}`)))
+	assert.False(t, dc.Capture(target.Route, target.Model, rawExchange(http.StatusOK, `{}`)))
+	assert.True(t, dc.Capture(target.Route, target.Model, rawExchange(http.StatusBadGateway, `{}`)))
+	assert.Len(t, dc.Captures(CaptureTarget{}, 0), 1)
+}
+
+func TestDebugCaptureDisarmsAfterMaxCapturesAndCoolsDown(t *testing.T) {
+	dc, auditor, evaluator, now := newTestDebugCapture(testDebugCaptureConfig())
+	route, model := "/v1/chat/completions", "qwen-max"
+	target := CaptureTarget{Route: route, Model: model, Category: CaptureCategoryTimeout}
+	spike := func() {
+		for i := 0; i < 10; i++ {
+			dc.Record(route, model, http.StatusGatewayTimeout)
+		}
+	}
+
+	spike()
+	require.True(t, dc.Armed())
+	for i := 0; i < 3; i++ {
+		assert.True(t, dc.Capture(route, model, rawExchange(http.StatusGatewayTimeout, `{}`)))
+	}
+	assert.False(t, dc.Armed())
+	assert.False(t, dc.Capture(route, model, rawExchange(http.StatusGatewayTimeout, `{}`)))
+	assert.Equal(t, []string{"debug_capture_armed", "debug_capture_disarmed"}, auditor.types())
+	assert.False(t, evaluator.firing["debug_capture_"+target.String()])
+
+	// A new spike inside the cool-down does not re-arm
+	*now = now.Add(2 * time.Minute)
+	spike()
+	assert.False(t, dc.Armed())
+
+	*now = now.Add(30 * time.Minute)
+	spike()
+	assert.True(t, dc.Armed())
+
+	// Activations expire on their own
+	*now = now.Add(11 * time.Minute)
+	assert.False(t, dc.Wants(route))
+	assert.False(t, dc.Armed())
+	assert.Equal(t, "debug_capture_disarmed", auditor.types()[len(auditor.types())-1])
+}
+
+func TestDebugCaptureManualStartStop(t *testing.T) {
+	dc, auditor, _, _ := newTestDebugCapture(testDebugCaptureConfig())
+
+	_, err := dc.Start(CaptureTarget{}, "admin", 0, 0)
+	assert.Error(t, err)
+
+	target := CaptureTarget{Route: "/v1/embeddings"}
+	activation, err := dc.Start(target, "admin", time.Hour, 100)
+	require.NoError(t, err)
+	// Manual activations are clamped to the configured limits
+	assert.Equal(t, 3, activation.MaxCaptures)
+	assert.Equal(t, 10*time.Minute, activation.ExpiresAt.Sub(activation.ArmedAt))
+
+	// An empty model and category match any
+	assert.True(t, dc.Capture("/v1/embeddings", "text-embedding-v2", rawExchange(http.StatusOK, `{}`)))
+
+	assert.True(t, dc.Stop(target, "admin"))
+	assert.False(t, dc.Stop(target, "admin"))
+	assert.False(t, dc.Armed())
+	require.Len(t, auditor.events, 2)
+	assert.Equal(t, "admin", auditor.events[1].UserID)
+}
+
+func TestDebugCaptureRedactsExchanges(t *testing.T) {
+	dc, _, _, _ := newTestDebugCapture(testDebugCaptureConfig())
+	_, err := dc.Start(CaptureTarget{Route: "/v1/chat/completions"}, "admin", 0, 0)
+	require.NoError(t, err)
+
+	raw := rawExchange(http.StatusBadRequest, `{"model":"qwen-max","max_tokens":256,"api_key":"abc","messages":[{"role":"user","content":"mail me at jane.doe@example.com or 13812345678, key sk-abcdefghijklmnopqrstuvwx"}]}`)
+	raw.RequestHeader.Set("Authorization", "Bearer sk-secret")
+	raw.RequestHeader.Set("X-API-Key", "gw-12345")
+	raw.Path = "/v1/chat/completions?email=jane.doe@example.com"
+	require.True(t, dc.Capture("/v1/chat/completions", "qwen-max", raw))
+
+	captured := dc.Captures(CaptureTarget{}, 1)[0]
+	assert.Equal(t, redactedValue, captured.RequestHeaders["Authorization"])
+	assert.Equal(t, redactedValue, captured.RequestHeaders["X-Api-Key"])
+	assert.Equal(t, "application/json", captured.RequestHeaders["Content-Type"])
+	assert.Equal(t, "/v1/chat/completions?email=[EMAIL]", captured.Path)
+
+	body := captured.RequestBody
+	assert.Contains(t, body, `"max_tokens":256`)
+	assert.Contains(t, body, `"api_key":"[REDACTED]"`)
+	assert.Contains(t, body, "[EMAIL]")
+	assert.Contains(t, body, "[PHONE]")
+	assert.Contains(t, body, "[API_KEY]")
+	assert.NotContains(t, body, "jane.doe")
+	assert.NotContains(t, body, "13812345678")
+	assert.Equal(t, CaptureCategoryClientError, captured.Category)
+}
+
+func TestDebugCaptureMemoryBudget(t *testing.T) {
+	cfg := testDebugCaptureConfig()
+	cfg.MaxCaptures = 100
+	cfg.MaxBodyBytes = 512
+	cfg.MemoryBudget = 2048
+	dc, _, _, _ := newTestDebugCapture(cfg)
+	_, err := dc.Start(CaptureTarget{Route: "/v1/chat/completions"}, "admin", 0, 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		require.True(t, dc.Capture("/v1/chat/completions", "qwen-max", rawExchange(http.StatusOK, strings.Repeat("x", 1000))))
+	}
+
+	captures := dc.Captures(CaptureTarget{}, 0)
+	assert.LessOrEqual(t, dc.MemoryUsage(), cfg.MemoryBudget)
+	assert.NotEmpty(t, captures)
+	assert.Less(t, len(captures), 20)
+	// The oldest exchanges are evicted first
+	assert.Equal(t, "cap-20", captures[0].ID)
+	assert.True(t, captures[0].RequestTruncated)
+	assert.Len(t, captures[0].RequestBody, cfg.MaxBodyBytes)
+}
+
+func TestErrorCategory(t *testing.T) {
+	assert.Equal(t, "", ErrorCategory(http.StatusOK))
+	assert.Equal(t, CaptureCategoryClientError, ErrorCategory(http.StatusBadRequest))
+	assert.Equal(t, CaptureCategoryRateLimited, ErrorCategory(http.StatusTooManyRequests))
+	assert.Equal(t, CaptureCategoryTimeout, ErrorCategory(http.StatusGatewayTimeout))
+	assert.Equal(t, CaptureCategoryUpstreamError, ErrorCategory(http.StatusBadGateway))
+}
@@ -6,8 +6,9 @@ import (
 	"fmt"
 	"time"
 
+	"go-aigateway/internal/logging"
+
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
@@ -40,44 +41,48 @@ type ErrorEvent struct {
 	Details     map[string]interface{} `json:"details,omitempty"`
 }
 
-// NewErrorTracker creates a new error tracker
-func NewErrorTracker(redisClient *redis.Client) *ErrorTracker {
+// NewErrorTracker creates a new error tracker whose metrics are registered
+// with reg, or with the monitoring registry when reg is nil
+func NewErrorTracker(redisClient *redis.Client, reg prometheus.Registerer) *ErrorTracker {
+	if reg == nil {
+		reg = registry
+	}
 	return &ErrorTracker{
 		redis:  redisClient,
-		logger: logrus.New(),
+		logger: logging.Default(),
 
-		errorCounter: promauto.NewCounterVec(
+		errorCounter: registerOnce(reg, prometheus.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "error_events_total",
+				Name: "aigateway_error_events_total",
 				Help: "Total number of error events",
 			},
 			[]string{"level", "code", "source"},
-		),
+		)),
 
-		errorRate: promauto.NewGaugeVec(
+		errorRate: registerOnce(reg, prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: "error_rate",
+				Name: "aigateway_tracked_error_rate",
 				Help: "Current error rate per minute",
 			},
 			[]string{"level", "source"},
-		),
+		)),
 
-		responseTime: promauto.NewHistogramVec(
+		responseTime: registerOnce(reg, prometheus.NewHistogramVec(
 			prometheus.HistogramOpts{
-				Name:    "http_request_duration_seconds",
+				Name:    "aigateway_tracked_request_duration_seconds",
 				Help:    "HTTP request duration in seconds",
 				Buckets: prometheus.DefBuckets,
 			},
 			[]string{"method", "path", "status"},
-		),
+		)),
 
-		securityEvents: promauto.NewCounterVec(
+		securityEvents: registerOnce(reg, prometheus.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "security_events_total",
+				Name: "aigateway_security_events_total",
 				Help: "Total number of security events",
 			},
 			[]string{"event_type", "severity"},
-		),
+		)),
 	}
 }
 
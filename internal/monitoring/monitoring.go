@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"go-aigateway/internal/config"
+	"go-aigateway/internal/lifecycle"
+	"go-aigateway/internal/resources"
 	"net/http"
 	"runtime"
+	"sort"
 	"sync"
 	"time"
 
@@ -25,6 +28,9 @@ const (
 	AlertLevelCritical AlertLevel = "critical"
 )
 
+// maxModelLabels bounds the distinct model labels of the response time histogram
+const maxModelLabels = 100
+
 // Alert represents a monitoring alert
 type Alert struct {
 	ID         string                 `json:"id"`
@@ -66,57 +72,133 @@ type Metrics struct {
 // MonitoringSystem represents the monitoring system
 type MonitoringSystem struct {
 	config      *config.MonitoringConfig
+	lifecycle   lifecycle.Guard
 	redisClient *redis.Client
 	rules       map[string]*Rule
-	alerts      map[string]*Alert
+	alerts      map[string]*Alert    // one per rule, by rule ID
+	breaching   map[string]time.Time // when each rule's condition started holding
 	metrics     *Metrics
 	mutex       sync.RWMutex
 
+	// Inputs of the QPS and CPU usage metrics
+	requests requestRate
+	cpu      *resources.CPUSampler
+
 	// Prometheus metrics
+	registry          *prometheus.Registry
 	requestCounter    prometheus.Counter
 	errorCounter      prometheus.Counter
-	responseTimeHist  prometheus.Histogram
+	responseTimeHist  *prometheus.HistogramVec // by model, provider and status
 	activeConnections prometheus.Gauge
 	systemCPU         prometheus.Gauge
 	systemMemory      prometheus.Gauge
+	systemQPS         prometheus.Gauge
+
+	// Models seen as response time labels, bounded by maxModelLabels
+	modelLabelsMutex sync.Mutex
+	modelLabels      map[string]struct{}
+
+	// Resumable live event stream for dashboards
+	stream *StreamHub
+
+	// Alert notification channels, replaceable at runtime
+	notifyMutex         sync.RWMutex
+	notifications       config.AlertNotificationConfig
+	channels            []*notificationChannel
+	notifiers           []*notificationChannel // registered with AddNotifier
+	notificationMetrics *notificationMetrics
 
 	// Channels for real-time monitoring
 	metricsChan chan *Metrics
-	alertsChan  chan *Alert
+	alertsChan  chan *AlertNotification
 	stopChan    chan struct{}
 }
 
-// NewMonitoringSystem creates a new monitoring system
-func NewMonitoringSystem(cfg *config.MonitoringConfig, redisClient *redis.Client) *MonitoringSystem {
+var (
+	defaultMonitoringMu sync.RWMutex
+	defaultMonitoring   *MonitoringSystem
+)
+
+// SetDefaultMonitoringSystem installs the monitoring system request handlers
+// record into; nil stops recording
+func SetDefaultMonitoringSystem(ms *MonitoringSystem) {
+	defaultMonitoringMu.Lock()
+	defaultMonitoring = ms
+	defaultMonitoringMu.Unlock()
+}
+
+// DefaultMonitoringSystem returns the installed monitoring system, or nil;
+// its Record methods are no-ops on nil
+func DefaultMonitoringSystem() *MonitoringSystem {
+	defaultMonitoringMu.RLock()
+	defer defaultMonitoringMu.RUnlock()
+	return defaultMonitoring
+}
+
+// NewMonitoringSystem creates a new monitoring system whose metrics are
+// registered with reg, or with the monitoring registry when reg is nil
+func NewMonitoringSystem(cfg *config.MonitoringConfig, redisClient *redis.Client, reg *prometheus.Registry) *MonitoringSystem {
 	if !cfg.Enabled {
 		return nil
 	}
+	if reg == nil {
+		reg = registry
+	}
 
 	ms := &MonitoringSystem{
 		config:      cfg,
 		redisClient: redisClient,
+		registry:    reg,
 		rules:       make(map[string]*Rule),
 		alerts:      make(map[string]*Alert),
+		breaching:   make(map[string]time.Time),
 		metrics:     &Metrics{},
+		modelLabels: make(map[string]struct{}),
+		cpu:         resources.NewCPUSampler(),
 		metricsChan: make(chan *Metrics, 100),
-		alertsChan:  make(chan *Alert, 100),
+		alertsChan:  make(chan *AlertNotification, alertQueueSize),
 		stopChan:    make(chan struct{}),
 	}
 
 	// Initialize Prometheus metrics
 	ms.initPrometheusMetrics()
+	ms.notificationMetrics = newNotificationMetrics(reg)
+
+	// Invalid channels are rejected by ValidateConfig; notifications stay off otherwise
+	if err := ms.UpdateNotifications(cfg.Notifications); err != nil {
+		logrus.WithError(err).Error("Invalid alert notification configuration, notifications disabled")
+	}
+	if urls := nonEmpty(cfg.WebhookURLs); len(urls) > 0 {
+		ms.AddNotifier(NewWebhookNotifierURLs(urls, cfg.WebhookSecret))
+	}
 
 	// Add default monitoring rules
 	ms.addDefaultRules()
 
-	// Start background monitoring
-	go ms.backgroundMonitoring()
-	go ms.metricsCollector()
-	go ms.alertProcessor()
-
 	return ms
 }
 
+// Start launches background monitoring; repeated calls are no-ops
+func (ms *MonitoringSystem) Start(ctx context.Context) error {
+	if ms == nil {
+		return nil
+	}
+	return ms.lifecycle.Start(func() error {
+		go ms.backgroundMonitoring()
+		go ms.metricsCollector()
+		go ms.alertProcessor()
+		return nil
+	})
+}
+
+// State reports the lifecycle state of the monitoring system
+func (ms *MonitoringSystem) State() lifecycle.State {
+	if ms == nil {
+		return lifecycle.StateClosed
+	}
+	return ms.lifecycle.State()
+}
+
 // initPrometheusMetrics initializes Prometheus metrics
 func (ms *MonitoringSystem) initPrometheusMetrics() {
 	ms.requestCounter = prometheus.NewCounter(prometheus.CounterOpts{
@@ -129,11 +211,11 @@ func (ms *MonitoringSystem) initPrometheusMetrics() {
 		Help: "Total number of errors",
 	})
 
-	ms.responseTimeHist = prometheus.NewHistogram(prometheus.HistogramOpts{
+	ms.responseTimeHist = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "aigateway_response_time_seconds",
-		Help:    "Response time in seconds",
+		Help:    "Response time in seconds by model, provider and status (success or error)",
 		Buckets: prometheus.DefBuckets,
-	})
+	}, []string{"model", "provider", "status"})
 
 	ms.activeConnections = prometheus.NewGauge(prometheus.GaugeOpts{
 		Name: "aigateway_active_connections",
@@ -150,15 +232,19 @@ func (ms *MonitoringSystem) initPrometheusMetrics() {
 		Help: "Memory usage in bytes",
 	})
 
-	// Register all metrics
-	prometheus.MustRegister(
-		ms.requestCounter,
-		ms.errorCounter,
-		ms.responseTimeHist,
-		ms.activeConnections,
-		ms.systemCPU,
-		ms.systemMemory,
-	)
+	ms.systemQPS = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "aigateway_qps",
+		Help: "Requests per second averaged over the last minute",
+	})
+
+	// Register all metrics; a second monitoring system shares the first one's collectors
+	ms.requestCounter = registerOnce(ms.registry, ms.requestCounter)
+	ms.errorCounter = registerOnce(ms.registry, ms.errorCounter)
+	ms.responseTimeHist = registerOnce(ms.registry, ms.responseTimeHist)
+	ms.activeConnections = registerOnce(ms.registry, ms.activeConnections)
+	ms.systemCPU = registerOnce(ms.registry, ms.systemCPU)
+	ms.systemMemory = registerOnce(ms.registry, ms.systemMemory)
+	ms.systemQPS = registerOnce(ms.registry, ms.systemQPS)
 }
 
 // addDefaultRules adds default monitoring rules
@@ -232,6 +318,7 @@ func (ms *MonitoringSystem) RecordRequest() {
 		return
 	}
 	ms.requestCounter.Inc()
+	ms.requests.add(time.Now())
 
 	ms.mutex.Lock()
 	ms.metrics.RequestCount++
@@ -250,12 +337,38 @@ func (ms *MonitoringSystem) RecordError() {
 	ms.mutex.Unlock()
 }
 
-// RecordResponseTime records response time metric
-func (ms *MonitoringSystem) RecordResponseTime(duration time.Duration) {
+// RecordResponseTime records the response time of a request for model served
+// by provider. Models come from request bodies, so only the first
+// maxModelLabels distinct models get their own label; later ones are "other".
+func (ms *MonitoringSystem) RecordResponseTime(duration time.Duration, model, provider string, success bool) {
 	if ms == nil {
 		return
 	}
-	ms.responseTimeHist.Observe(duration.Seconds())
+	status := "success"
+	if !success {
+		status = "error"
+	}
+	if provider == "" {
+		provider = "unknown"
+	}
+	ms.responseTimeHist.WithLabelValues(ms.modelLabel(model), provider, status).Observe(duration.Seconds())
+}
+
+// modelLabel returns the label value recorded for model
+func (ms *MonitoringSystem) modelLabel(model string) string {
+	if model == "" {
+		return "unknown"
+	}
+	ms.modelLabelsMutex.Lock()
+	defer ms.modelLabelsMutex.Unlock()
+	if _, ok := ms.modelLabels[model]; ok {
+		return model
+	}
+	if len(ms.modelLabels) >= maxModelLabels {
+		return "other"
+	}
+	ms.modelLabels[model] = struct{}{}
+	return model
 }
 
 // UpdateActiveConnections updates active connections metric
@@ -286,90 +399,108 @@ func (ms *MonitoringSystem) backgroundMonitoring() {
 func (ms *MonitoringSystem) collectSystemMetrics() {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
+	now := time.Now()
+	qps := ms.requests.perSecond(now)
+
+	// CPU usage keeps its previous value when it cannot be sampled
+	cpuUsage, cpuSampled := 0.0, false
+	if ms.cpu != nil {
+		var err error
+		cpuUsage, cpuSampled, err = ms.cpu.Sample(now)
+		if err != nil {
+			logrus.WithError(err).Debug("Failed to sample process CPU usage")
+		}
+	}
 
 	ms.mutex.Lock()
 	ms.metrics.GoroutineCount = runtime.NumGoroutine()
 	ms.metrics.MemoryUsage = float64(m.Alloc) / 1024 / 1024 // MB
-	ms.metrics.Timestamp = time.Now()
+	ms.metrics.QPS = qps
+	if cpuSampled {
+		ms.metrics.CPUUsage = cpuUsage
+	}
+	ms.metrics.Timestamp = now
 
-	// Calculate QPS and error rate from counters
+	// Calculate error rate from counters
 	if ms.metrics.RequestCount > 0 {
 		ms.metrics.ErrorRate = (float64(ms.metrics.ErrorCount) / float64(ms.metrics.RequestCount)) * 100
 	}
+	snapshot := *ms.metrics
 	ms.mutex.Unlock()
 
 	// Update Prometheus metrics
 	ms.systemMemory.Set(float64(m.Alloc))
+	ms.systemQPS.Set(snapshot.QPS)
+	ms.systemCPU.Set(snapshot.CPUUsage)
 
 	// Send metrics to channel for processing
 	select {
-	case ms.metricsChan <- ms.metrics:
+	case ms.metricsChan <- &snapshot:
 	default:
 		// Channel full, skip this update
 	}
 }
 
-// checkRules checks monitoring rules and generates alerts
+// checkRules evaluates the monitoring rules against the current metrics
 func (ms *MonitoringSystem) checkRules() {
-	ms.mutex.RLock()
-	currentMetrics := *ms.metrics
-	ms.mutex.RUnlock()
+	ms.evaluateRules(context.Background(), time.Now())
+}
 
-	for _, rule := range ms.rules {
-		if !rule.Enabled {
-			continue
-		}
+// evaluateRules keeps at most one open alert per rule. A rule fires once its
+// condition has held for rule.Duration, and its alert is resolved at the first
+// evaluation where the condition no longer holds or the rule is disabled.
+func (ms *MonitoringSystem) evaluateRules(ctx context.Context, now time.Time) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if ms.breaching == nil {
+		ms.breaching = make(map[string]time.Time)
+	}
 
-		var value float64
-		switch rule.MetricKey {
-		case "qps":
-			value = currentMetrics.QPS
-		case "error_rate":
-			value = currentMetrics.ErrorRate
-		case "average_response_time":
-			value = currentMetrics.AverageResponseTime
-		case "cpu_usage":
-			value = currentMetrics.CPUUsage
-		case "memory_usage":
-			value = currentMetrics.MemoryUsage
-		default:
+	for _, rule := range ms.rules {
+		value, ok := metricValue(ms.metrics, rule.MetricKey)
+		if !ok {
 			continue
 		}
 
-		if ms.evaluateCondition(value, rule.Operator, rule.Threshold) {
-			alert := &Alert{
-				ID:        fmt.Sprintf("%s_%d", rule.ID, time.Now().Unix()),
-				Level:     rule.Level,
-				Title:     rule.Name,
-				Message:   fmt.Sprintf("%s: %s %s %.2f (threshold: %.2f)", rule.Name, rule.MetricKey, rule.Operator, value, rule.Threshold),
-				Timestamp: time.Now(),
-				Metadata: map[string]interface{}{
-					"rule_id":       rule.ID,
-					"metric_key":    rule.MetricKey,
-					"current_value": value,
-					"threshold":     rule.Threshold,
-					"operator":      rule.Operator,
-				},
+		var err error
+		if rule.Enabled && ms.evaluateCondition(value, rule.Operator, rule.Threshold) {
+			since, held := ms.breaching[rule.ID]
+			if !held {
+				since = now
+				ms.breaching[rule.ID] = now
 			}
-
-			ms.alerts[alert.ID] = alert
-
-			// Send alert to channel
-			select {
-			case ms.alertsChan <- alert:
-			default:
-				logrus.Warn("Alert channel full, dropping alert")
+			if now.Sub(since) < rule.Duration {
+				continue
 			}
-
-			logrus.WithFields(logrus.Fields{
-				"alert_id": alert.ID,
-				"level":    alert.Level,
-				"message":  alert.Message,
-			}).Warn("Alert triggered")
+			err = ms.createOrUpdateAlert(ctx, rule, value)
+		} else {
+			delete(ms.breaching, rule.ID)
+			err = ms.resolveAlert(ctx, rule.ID)
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("rule_id", rule.ID).Error("Failed to update alert")
 		}
 	}
 }
 
+// metricValue returns the metric a rule's MetricKey names
+func metricValue(metrics *Metrics, key string) (float64, bool) {
+	switch key {
+	case "qps":
+		return metrics.QPS, true
+	case "error_rate":
+		return metrics.ErrorRate, true
+	case "average_response_time":
+		return metrics.AverageResponseTime, true
+	case "cpu_usage":
+		return metrics.CPUUsage, true
+	case "memory_usage":
+		return metrics.MemoryUsage, true
+	default:
+		return 0, false
+	}
+}
+
 // evaluateCondition evaluates a monitoring condition
 func (ms *MonitoringSystem) evaluateCondition(value float64, operator string, threshold float64) bool {
 	switch operator {
@@ -402,16 +533,13 @@ func (ms *MonitoringSystem) metricsCollector() {
 	}
 }
 
-// alertProcessor processes alerts from the channel
-func (ms *MonitoringSystem) alertProcessor() {
-	for {
-		select {
-		case <-ms.stopChan:
-			return
-		case alert := <-ms.alertsChan:
-			ms.processAlert(alert)
-		}
-	}
+// UpdateConfig applies a reloaded monitoring configuration. Only the metrics
+// retention is read per use; StatsD, the Pushgateway and the event stream
+// keep the settings they were started with until a restart.
+func (ms *MonitoringSystem) UpdateConfig(cfg *config.Config) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.config = &cfg.Monitoring
 }
 
 // storeMetrics stores metrics to Redis
@@ -429,8 +557,12 @@ func (ms *MonitoringSystem) storeMetrics(metrics *Metrics) {
 		return
 	}
 
+	ms.mutex.RLock()
+	retention := ms.config.MetricsRetention
+	ms.mutex.RUnlock()
+
 	key := fmt.Sprintf("metrics:current:%d", time.Now().Unix())
-	if err := ms.redisClient.Set(ctx, key, metricsJSON, ms.config.MetricsRetention).Err(); err != nil {
+	if err := ms.redisClient.Set(ctx, key, metricsJSON, retention).Err(); err != nil {
 		logrus.WithError(err).Error("Failed to store metrics in Redis")
 	}
 
@@ -448,35 +580,23 @@ func (ms *MonitoringSystem) storeMetrics(metrics *Metrics) {
 	if _, err := pipe.Exec(ctx); err != nil {
 		logrus.WithError(err).Error("Failed to store time-series metrics")
 	}
-}
 
-// processAlert processes and potentially sends alerts
-func (ms *MonitoringSystem) processAlert(alert *Alert) {
-	if ms.redisClient == nil {
-		return
-	}
+	ms.publish(ctx, StreamEventMetrics, metrics)
+}
 
-	ctx := context.Background()
+// SetStreamHub 将指标和告警事件发布到实时流
+func (ms *MonitoringSystem) SetStreamHub(hub *StreamHub) {
+	ms.stream = hub
+}
 
-	// Store alert in Redis
-	alertJSON, err := json.Marshal(alert)
-	if err != nil {
-		logrus.WithError(err).Error("Failed to marshal alert")
+// publish sends an event to the live stream, if one is attached
+func (ms *MonitoringSystem) publish(ctx context.Context, eventType string, payload interface{}) {
+	if ms.stream == nil {
 		return
 	}
-
-	key := fmt.Sprintf("alerts:%s", alert.ID)
-	if err := ms.redisClient.Set(ctx, key, alertJSON, 24*time.Hour).Err(); err != nil {
-		logrus.WithError(err).Error("Failed to store alert in Redis")
-	}
-
-	// Add to alerts list
-	if err := ms.redisClient.LPush(ctx, "alerts:list", alert.ID).Err(); err != nil {
-		logrus.WithError(err).Error("Failed to add alert to list")
+	if _, err := ms.stream.Publish(ctx, eventType, payload); err != nil {
+		logrus.WithError(err).WithField("type", eventType).Warn("Failed to publish monitoring stream event")
 	}
-
-	// Keep only recent alerts (last 1000)
-	ms.redisClient.LTrim(ctx, "alerts:list", 0, 999)
 }
 
 // GetMetrics returns current system metrics
@@ -500,6 +620,9 @@ func (ms *MonitoringSystem) GetAlerts(limit int) ([]*Alert, error) {
 
 	if ms.redisClient == nil {
 		// Return in-memory alerts
+		ms.mutex.RLock()
+		defer ms.mutex.RUnlock()
+
 		var alerts []*Alert
 		count := 0
 		for _, alert := range ms.alerts {
@@ -538,19 +661,25 @@ func (ms *MonitoringSystem) GetAlerts(limit int) ([]*Alert, error) {
 	return alerts, nil
 }
 
-// GetMetricsHandler returns an HTTP handler for Prometheus metrics
+// GetMetricsHandler returns an HTTP handler serving the metrics of the
+// monitoring system's registry
 func (ms *MonitoringSystem) GetMetricsHandler() http.Handler {
-	return promhttp.Handler()
+	if ms == nil {
+		return MetricsHandler()
+	}
+	return promhttp.HandlerFor(ms.registry, promhttp.HandlerOpts{})
 }
 
-// Close stops the monitoring system
+// Close stops the monitoring system; it is safe to call more than once
 func (ms *MonitoringSystem) Close() error {
 	if ms == nil {
 		return nil
 	}
 
-	close(ms.stopChan)
-	return nil
+	return ms.lifecycle.Close(func() error {
+		close(ms.stopChan)
+		return nil
+	})
 }
 
 // createOrUpdateAlert 创建或更新告警
@@ -572,6 +701,7 @@ func (ms *MonitoringSystem) createOrUpdateAlert(ctx context.Context, rule *Rule,
 		Resolved:  false,
 		Metadata: map[string]interface{}{
 			"rule_id":       rule.ID,
+			"metric_key":    rule.MetricKey,
 			"current_value": value,
 			"threshold":     rule.Threshold,
 			"operator":      rule.Operator,
@@ -579,6 +709,11 @@ func (ms *MonitoringSystem) createOrUpdateAlert(ctx context.Context, rule *Rule,
 	}
 
 	ms.alerts[alertID] = alert
+	ms.enqueueNotification(AlertEventFiring, alert)
+
+	if ms.redisClient == nil {
+		return nil
+	}
 
 	// 存储到Redis
 	alertData, err := json.Marshal(alert)
@@ -591,9 +726,14 @@ func (ms *MonitoringSystem) createOrUpdateAlert(ctx context.Context, rule *Rule,
 		return err
 	}
 
-	// 添加到告警列表
+	// 添加到告警列表；重新触发的告警移到最近告警列表的最前面
 	alertListKey := "alerts:active"
 	ms.redisClient.SAdd(ctx, alertListKey, alertID)
+	ms.redisClient.SRem(ctx, "alerts:resolved", alertID)
+	ms.redisClient.LRem(ctx, "alerts:list", 0, alertID)
+	ms.redisClient.LPush(ctx, "alerts:list", alertID)
+	ms.redisClient.LTrim(ctx, "alerts:list", 0, 999)
+	ms.publish(ctx, StreamEventAlert, alert)
 
 	// 记录日志
 	logrus.WithFields(logrus.Fields{
@@ -620,6 +760,11 @@ func (ms *MonitoringSystem) resolveAlert(ctx context.Context, ruleID string) err
 	now := time.Now()
 	alert.Resolved = true
 	alert.ResolvedAt = &now
+	ms.enqueueNotification(AlertEventResolved, alert)
+
+	if ms.redisClient == nil {
+		return nil
+	}
 
 	// 更新Redis
 	alertData, err := json.Marshal(alert)
@@ -639,6 +784,7 @@ func (ms *MonitoringSystem) resolveAlert(ctx context.Context, ruleID string) err
 	// 添加到已解决告警列表
 	resolvedListKey := "alerts:resolved"
 	ms.redisClient.SAdd(ctx, resolvedListKey, alertID)
+	ms.publish(ctx, StreamEventAlertResolved, alert)
 
 	logrus.WithFields(logrus.Fields{
 		"alert_id": alert.ID,
@@ -648,8 +794,28 @@ func (ms *MonitoringSystem) resolveAlert(ctx context.Context, ruleID string) err
 	return nil
 }
 
+// EvaluateRule 根据外部计算的结果（如SLO燃烧率、本地模型内存占用）触发或解除规则对应的告警
+func (ms *MonitoringSystem) EvaluateRule(ctx context.Context, rule *Rule, value float64, firing bool) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	var err error
+	if firing {
+		err = ms.createOrUpdateAlert(ctx, rule, value)
+	} else {
+		err = ms.resolveAlert(ctx, rule.ID)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("rule_id", rule.ID).Error("Failed to update alert")
+	}
+}
+
 // GetActiveAlerts 获取活跃告警
 func (ms *MonitoringSystem) GetActiveAlerts(ctx context.Context) ([]*Alert, error) {
+	if ms.redisClient == nil {
+		return ms.memoryAlerts(func(alert *Alert) bool { return !alert.Resolved }), nil
+	}
+
 	alertListKey := "alerts:active"
 	alertIDs, err := ms.redisClient.SMembers(ctx, alertListKey).Result()
 	if err != nil {
@@ -677,6 +843,14 @@ func (ms *MonitoringSystem) GetActiveAlerts(ctx context.Context) ([]*Alert, erro
 
 // GetAlertHistory 获取告警历史
 func (ms *MonitoringSystem) GetAlertHistory(ctx context.Context, limit int) ([]*Alert, error) {
+	if ms.redisClient == nil {
+		alerts := ms.memoryAlerts(func(*Alert) bool { return true })
+		if len(alerts) > limit {
+			alerts = alerts[:limit]
+		}
+		return alerts, nil
+	}
+
 	// 获取活跃和已解决的告警
 	activeAlerts, _ := ms.GetActiveAlerts(ctx)
 
@@ -711,17 +885,50 @@ func (ms *MonitoringSystem) GetAlertHistory(ctx context.Context, limit int) ([]*
 	return allAlerts, nil
 }
 
+// memoryAlerts returns copies of the in-memory alerts matching keep, newest first
+func (ms *MonitoringSystem) memoryAlerts(keep func(*Alert) bool) []*Alert {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	alerts := []*Alert{}
+	for _, alert := range ms.alerts {
+		if keep(alert) {
+			alertCopy := *alert
+			alerts = append(alerts, &alertCopy)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].Timestamp.After(alerts[j].Timestamp)
+	})
+	return alerts
+}
+
 // AddRule 添加监控规则
 func (ms *MonitoringSystem) AddRule(rule *Rule) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
 	ms.rules[rule.ID] = rule
 }
 
-// RemoveRule 移除监控规则
+// RemoveRule 移除监控规则，并解决该规则未解决的告警
 func (ms *MonitoringSystem) RemoveRule(ruleID string) {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
 	delete(ms.rules, ruleID)
+	delete(ms.breaching, ruleID)
+	if err := ms.resolveAlert(context.Background(), ruleID); err != nil {
+		logrus.WithError(err).WithField("rule_id", ruleID).Error("Failed to resolve alert of removed rule")
+	}
 }
 
 // GetRules 获取所有监控规则
 func (ms *MonitoringSystem) GetRules() map[string]*Rule {
-	return ms.rules
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	rules := make(map[string]*Rule, len(ms.rules))
+	for id, rule := range ms.rules {
+		rules[id] = rule
+	}
+	return rules
 }
@@ -0,0 +1,160 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newErrorRateMonitor returns a monitoring system evaluating only the default
+// high_error_rate rule (> 5% for one minute)
+func newErrorRateMonitor(t *testing.T, redisClient *redis.Client) *MonitoringSystem {
+	ms := NewMonitoringSystem(&config.MonitoringConfig{Enabled: true}, redisClient, prometheus.NewRegistry())
+	for id := range ms.GetRules() {
+		if id != "high_error_rate" {
+			ms.RemoveRule(id)
+		}
+	}
+	return ms
+}
+
+// recordTraffic records requests of which errors failed and refreshes the error rate
+func recordTraffic(ms *MonitoringSystem, requests, errors int) {
+	for i := 0; i < requests; i++ {
+		ms.RecordRequest()
+	}
+	for i := 0; i < errors; i++ {
+		ms.RecordError()
+	}
+	ms.collectSystemMetrics()
+}
+
+func TestSustainedErrorRateRaisesOneAlertThatResolves(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ms := newErrorRateMonitor(t, redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	evaluate := func(cycle int) {
+		ms.evaluateRules(ctx, start.Add(time.Duration(cycle)*30*time.Second))
+	}
+
+	recordTraffic(ms, 10, 1)
+	evaluate(0)
+	evaluate(1)
+	active, err := ms.GetActiveAlerts(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, active, "the rule fires only after the condition held for its duration")
+
+	for cycle := 2; cycle <= 10; cycle++ {
+		evaluate(cycle)
+	}
+	active, err = ms.GetActiveAlerts(ctx)
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+	assert.Equal(t, "high_error_rate", active[0].ID)
+	recent, err := mr.List("alerts:list")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"high_error_rate"}, recent, "a sustained condition is one alert")
+
+	recordTraffic(ms, 100, 0)
+	evaluate(11)
+	active, err = ms.GetActiveAlerts(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, active, "the alert resolves once the rate falls")
+
+	history, err := ms.GetAlertHistory(ctx, 10)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.True(t, history[0].Resolved)
+	assert.NotNil(t, history[0].ResolvedAt)
+}
+
+func TestErrorRateAlertRequiresUninterruptedBreach(t *testing.T) {
+	ms := newErrorRateMonitor(t, nil)
+	ctx := context.Background()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	recordTraffic(ms, 10, 1)
+	ms.evaluateRules(ctx, start)
+	recordTraffic(ms, 100, 0)
+	ms.evaluateRules(ctx, start.Add(30*time.Second))
+	recordTraffic(ms, 0, 20)
+	ms.evaluateRules(ctx, start.Add(time.Minute))
+	active, err := ms.GetActiveAlerts(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, active, "a recovery restarts the duration")
+
+	ms.evaluateRules(ctx, start.Add(2*time.Minute))
+	active, err = ms.GetActiveAlerts(ctx)
+	require.NoError(t, err)
+	require.Len(t, active, 1)
+
+	ms.RemoveRule("high_error_rate")
+	active, err = ms.GetActiveAlerts(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, active, "removing a rule resolves its alert")
+}
+
+func TestResponseTimeIsLabelledByModelProviderAndStatus(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	ms := NewMonitoringSystem(&config.MonitoringConfig{Enabled: true}, nil, reg)
+
+	ms.RecordResponseTime(2*time.Second, "gpt-4", "openai", true)
+	ms.RecordResponseTime(500*time.Millisecond, "qwen-max", "alibaba-dashscope", true)
+	ms.RecordResponseTime(250*time.Millisecond, "qwen-max", "alibaba-dashscope", true)
+	ms.RecordResponseTime(time.Second, "qwen-max", "alibaba-dashscope", false)
+
+	expected := `
+# HELP aigateway_response_time_seconds Response time in seconds by model, provider and status (success or error)
+# TYPE aigateway_response_time_seconds histogram
+` + histogramSeries(`model="gpt-4",provider="openai",status="success"`, 2, 1, 8) +
+		histogramSeries(`model="qwen-max",provider="alibaba-dashscope",status="error"`, 1, 1, 7) +
+		histogramSeries(`model="qwen-max",provider="alibaba-dashscope",status="success"`, 0.75, 2, 5, 6)
+	require.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected), "aigateway_response_time_seconds"))
+	assert.Equal(t, 3, testutil.CollectAndCount(ms.responseTimeHist))
+}
+
+func TestResponseTimeModelLabelsAreBounded(t *testing.T) {
+	ms := NewMonitoringSystem(&config.MonitoringConfig{Enabled: true}, nil, prometheus.NewRegistry())
+
+	for i := 0; i < maxModelLabels+50; i++ {
+		ms.RecordResponseTime(time.Millisecond, fmt.Sprintf("model-%d", i), "openai", true)
+	}
+	ms.RecordResponseTime(time.Millisecond, "", "", false)
+	assert.Equal(t, maxModelLabels+2, testutil.CollectAndCount(ms.responseTimeHist), "extra models share the other label")
+	var other dto.Metric
+	require.NoError(t, ms.responseTimeHist.WithLabelValues("other", "openai", "success").(prometheus.Histogram).Write(&other))
+	assert.EqualValues(t, 50, other.GetHistogram().GetSampleCount())
+}
+
+// histogramSeries renders one series of the response time histogram with
+// the default buckets; each value of firstBuckets is the index of the first
+// bucket counting one of the observations
+func histogramSeries(labels string, sum float64, count int, firstBuckets ...int) string {
+	var b strings.Builder
+	for i, bound := range prometheus.DefBuckets {
+		cumulative := 0
+		for _, first := range firstBuckets {
+			if i >= first {
+				cumulative++
+			}
+		}
+		fmt.Fprintf(&b, "aigateway_response_time_seconds_bucket{%s,le=\"%g\"} %d\n", labels, bound, cumulative)
+	}
+	fmt.Fprintf(&b, "aigateway_response_time_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, count)
+	fmt.Fprintf(&b, "aigateway_response_time_seconds_sum{%s} %g\n", labels, sum)
+	fmt.Fprintf(&b, "aigateway_response_time_seconds_count{%s} %d\n", labels, count)
+	return b.String()
+}
@@ -0,0 +1,534 @@
+package monitoring
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// AlertEvent is what happened to the alert a notification is about
+type AlertEvent string
+
+const (
+	AlertEventFiring   AlertEvent = "firing"
+	AlertEventResolved AlertEvent = "resolved"
+)
+
+// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the
+// webhook body, keyed with the channel secret
+const WebhookSignatureHeader = "X-Gateway-Signature"
+
+// SignatureHeader carries the same signature for receivers that verify the
+// generic header name
+const SignatureHeader = "X-Signature"
+
+const (
+	// notificationTimeout bounds one delivery attempt
+	notificationTimeout = 10 * time.Second
+
+	// alertQueueSize is the number of notifications waiting for delivery;
+	// further ones are dropped
+	alertQueueSize = 100
+
+	// webhookMaxAttempts and webhookRetryBackoff bound WebhookNotifier.Send;
+	// the backoff doubles after every failed attempt
+	webhookMaxAttempts  = 3
+	webhookRetryBackoff = 500 * time.Millisecond
+)
+
+// AlertNotification 一次告警通知：新告警触发或告警解决
+type AlertNotification struct {
+	Event AlertEvent `json:"event"`
+	Alert Alert      `json:"alert"`
+}
+
+// Notifier delivers alert notifications to one channel
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, notification *AlertNotification) error
+}
+
+// WebhookNotifier POSTs notifications as JSON to one or more URLs. With a
+// secret the body is signed in the X-Gateway-Signature and X-Signature
+// headers so receivers can verify it.
+type WebhookNotifier struct {
+	urls    []string
+	secret  string
+	client  *http.Client
+	backoff time.Duration
+}
+
+// NewWebhookNotifier creates a notifier posting to url, signing with secret when set
+func NewWebhookNotifier(url, secret string) *WebhookNotifier {
+	return NewWebhookNotifierURLs([]string{url}, secret)
+}
+
+// NewWebhookNotifierURLs creates a notifier posting every alert to each of
+// urls, signing with secret when set
+func NewWebhookNotifierURLs(urls []string, secret string) *WebhookNotifier {
+	return &WebhookNotifier{
+		urls:    urls,
+		secret:  secret,
+		client:  httpclient.NewClient("alert_webhook", notificationTimeout),
+		backoff: webhookRetryBackoff,
+	}
+}
+
+func (w *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+// Notify posts the notification once to every URL; retries are left to the
+// caller, which retries each URL on its own through perURL
+func (w *WebhookNotifier) Notify(ctx context.Context, notification *AlertNotification) error {
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert notification: %w", err)
+	}
+	var errs []error
+	for _, target := range w.urls {
+		if err := w.post(ctx, target, payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Send posts alert to every URL, as a resolution when the alert is resolved.
+// A failed URL is retried up to three attempts in total with exponential
+// backoff; the URLs that already succeeded are not posted to again.
+func (w *WebhookNotifier) Send(alert *Alert) error {
+	notification := &AlertNotification{Event: AlertEventFiring, Alert: *alert}
+	if alert.Resolved {
+		notification.Event = AlertEventResolved
+	}
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert notification: %w", err)
+	}
+
+	var errs []error
+	for _, target := range w.urls {
+		var err error
+		for attempt := 0; attempt < webhookMaxAttempts; attempt++ {
+			if attempt > 0 {
+				time.Sleep(w.backoff << (attempt - 1))
+			}
+			if err = w.post(context.Background(), target, payload); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("webhook %s failed after %d attempts: %w", target, webhookMaxAttempts, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// perURL splits the notifier into one notifier per URL
+func (w *WebhookNotifier) perURL() []*WebhookNotifier {
+	notifiers := make([]*WebhookNotifier, len(w.urls))
+	for i, target := range w.urls {
+		notifiers[i] = &WebhookNotifier{urls: []string{target}, secret: w.secret, client: w.client, backoff: w.backoff}
+	}
+	return notifiers
+}
+
+// post delivers one signed payload to target
+func (w *WebhookNotifier) post(ctx context.Context, target string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != "" {
+		signature := "sha256=" + SignWebhookPayload(w.secret, payload)
+		req.Header.Set(WebhookSignatureHeader, signature)
+		req.Header.Set(SignatureHeader, signature)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignWebhookPayload returns the hex HMAC-SHA256 of a webhook body
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DingTalkNotifier 通过钉钉群机器人发送 markdown 消息。设置了加签密钥时，
+// 按钉钉的要求在 URL 上附加 timestamp 和 sign 参数。
+type DingTalkNotifier struct {
+	url    string
+	secret string
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewDingTalkNotifier creates a notifier for the robot webhook url, signing
+// requests with secret when set
+func NewDingTalkNotifier(url, secret string) *DingTalkNotifier {
+	return &DingTalkNotifier{
+		url:    url,
+		secret: secret,
+		client: httpclient.NewClient("alert_dingtalk", notificationTimeout),
+		now:    time.Now,
+	}
+}
+
+func (d *DingTalkNotifier) Name() string {
+	return "dingtalk"
+}
+
+func (d *DingTalkNotifier) Notify(ctx context.Context, notification *AlertNotification) error {
+	alert := notification.Alert
+	title := fmt.Sprintf("[%s] %s", strings.ToUpper(string(alert.Level)), alert.Title)
+	text := fmt.Sprintf("### %s\n\n%s\n\n- 告警 ID: %s\n- 触发时间: %s",
+		title, alert.Message, alert.ID, alert.Timestamp.Format(time.RFC3339))
+	if notification.Event == AlertEventResolved {
+		title = "[RESOLVED] " + alert.Title
+		text = fmt.Sprintf("### %s\n\n告警已解决\n\n- 告警 ID: %s\n- 触发时间: %s",
+			title, alert.ID, alert.Timestamp.Format(time.RFC3339))
+		if alert.ResolvedAt != nil {
+			text += "\n- 解决时间: " + alert.ResolvedAt.Format(time.RFC3339)
+		}
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"msgtype":  "markdown",
+		"markdown": map[string]string{"title": title, "text": text},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal dingtalk message: %w", err)
+	}
+
+	target, err := d.signedURL()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("dingtalk webhook returned status %d", resp.StatusCode)
+	}
+	// DingTalk reports rejected messages with status 200 and a non-zero errcode
+	var result struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err == nil && result.ErrCode != 0 {
+		return fmt.Errorf("dingtalk webhook returned error %d: %s", result.ErrCode, result.ErrMsg)
+	}
+	return nil
+}
+
+// signedURL appends the timestamp and sign parameters when a secret is set:
+// sign is the base64 HMAC-SHA256 of "<timestamp>\n<secret>" keyed with the secret
+func (d *DingTalkNotifier) signedURL() (string, error) {
+	if d.secret == "" {
+		return d.url, nil
+	}
+	target, err := url.Parse(d.url)
+	if err != nil {
+		return "", fmt.Errorf("invalid dingtalk webhook url: %w", err)
+	}
+	timestamp := strconv.FormatInt(d.now().UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(d.secret))
+	mac.Write([]byte(timestamp + "\n" + d.secret))
+
+	query := target.Query()
+	query.Set("timestamp", timestamp)
+	query.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	target.RawQuery = query.Encode()
+	return target.String(), nil
+}
+
+// levelRank orders alert levels for the channels' minimum level
+var levelRank = map[AlertLevel]int{
+	AlertLevelInfo:     0,
+	AlertLevelWarning:  1,
+	AlertLevelCritical: 2,
+}
+
+// notificationChannel is a notifier with its minimum level and rate cap
+type notificationChannel struct {
+	notifier      Notifier
+	minLevel      AlertLevel
+	ratePerMinute int
+	registered    bool // added with AddNotifier rather than configured
+
+	mutex       sync.Mutex
+	windowStart time.Time
+	sent        int
+}
+
+// allow reports whether the channel may send another notification in the
+// current minute
+func (ch *notificationChannel) allow(now time.Time) bool {
+	if ch.ratePerMinute <= 0 {
+		return true
+	}
+	ch.mutex.Lock()
+	defer ch.mutex.Unlock()
+	if now.Sub(ch.windowStart) >= time.Minute {
+		ch.windowStart, ch.sent = now, 0
+	}
+	if ch.sent >= ch.ratePerMinute {
+		return false
+	}
+	ch.sent++
+	return true
+}
+
+// nonEmpty drops the blank entries of a comma separated list
+func nonEmpty(values []string) []string {
+	var result []string
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// newNotificationChannels creates the channels whose URL is set
+func newNotificationChannels(cfg config.AlertNotificationConfig) ([]*notificationChannel, error) {
+	var channels []*notificationChannel
+	add := func(name string, channel config.NotificationChannelConfig, create func(url, secret string) Notifier) error {
+		if channel.URL == "" {
+			return nil
+		}
+		target, err := url.Parse(channel.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("%s url must be an http or https URL", name)
+		}
+		level := AlertLevel(channel.MinLevel)
+		if _, ok := levelRank[level]; !ok {
+			return fmt.Errorf("%s min_level must be info, warning or critical", name)
+		}
+		channels = append(channels, &notificationChannel{
+			notifier:      create(channel.URL, channel.Secret),
+			minLevel:      level,
+			ratePerMinute: cfg.RatePerMinute,
+		})
+		return nil
+	}
+
+	if cfg.MaxRetries < 0 || cfg.RetryBackoff < 0 || cfg.RatePerMinute < 0 {
+		return nil, fmt.Errorf("max_retries, retry_backoff and rate_per_minute must not be negative")
+	}
+	if err := add("webhook", cfg.Webhook, func(url, secret string) Notifier {
+		return NewWebhookNotifier(url, secret)
+	}); err != nil {
+		return nil, err
+	}
+	if err := add("dingtalk", cfg.DingTalk, func(url, secret string) Notifier {
+		return NewDingTalkNotifier(url, secret)
+	}); err != nil {
+		return nil, err
+	}
+	return channels, nil
+}
+
+// notificationMetrics count notifications that were not delivered
+type notificationMetrics struct {
+	failed  *prometheus.CounterVec
+	dropped *prometheus.CounterVec
+}
+
+func newNotificationMetrics(reg prometheus.Registerer) *notificationMetrics {
+	return &notificationMetrics{
+		failed: registerOnce(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aigateway_alert_notifications_failed_total",
+			Help: "Alert notifications that could not be delivered after all retries, by channel",
+		}, []string{"channel"})),
+		dropped: registerOnce(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aigateway_alert_notifications_dropped_total",
+			Help: "Alert notifications dropped by a channel's rate cap or a full delivery queue, by channel",
+		}, []string{"channel"})),
+	}
+}
+
+// UpdateNotifications replaces the notification channels, e.g. from the
+// admin API. The override lasts until the next restart; configuration
+// reloads do not touch it.
+func (ms *MonitoringSystem) UpdateNotifications(cfg config.AlertNotificationConfig) error {
+	channels, err := newNotificationChannels(cfg)
+	if err != nil {
+		return err
+	}
+	ms.notifyMutex.Lock()
+	defer ms.notifyMutex.Unlock()
+	ms.notifications = cfg
+	ms.channels = channels
+	return nil
+}
+
+// NotificationConfig returns the current notification channel configuration
+func (ms *MonitoringSystem) NotificationConfig() config.AlertNotificationConfig {
+	ms.notifyMutex.RLock()
+	defer ms.notifyMutex.RUnlock()
+	return ms.notifications
+}
+
+// AddNotifier registers a notifier that receives every alert and resolution
+// regardless of level, in addition to the configured channels. Registered
+// notifiers survive UpdateNotifications. Notifiers with a Send(*Alert) error
+// method, such as WebhookNotifier, retry on their own; the others are retried
+// like the channels.
+func (ms *MonitoringSystem) AddNotifier(n Notifier) {
+	if ms == nil || n == nil {
+		return
+	}
+	ms.notifyMutex.Lock()
+	defer ms.notifyMutex.Unlock()
+	ms.notifiers = append(ms.notifiers, &notificationChannel{notifier: n, minLevel: AlertLevelInfo, registered: true})
+}
+
+// alertSender is implemented by notifiers that retry failed deliveries themselves
+type alertSender interface {
+	Send(alert *Alert) error
+}
+
+// enqueueNotification queues a copy of alert for delivery without blocking
+// the rule evaluation; it is a no-op when no channel is configured
+func (ms *MonitoringSystem) enqueueNotification(event AlertEvent, alert *Alert) {
+	ms.notifyMutex.RLock()
+	configured := len(ms.channels) > 0 || len(ms.notifiers) > 0
+	ms.notifyMutex.RUnlock()
+	if !configured || ms.alertsChan == nil {
+		return
+	}
+
+	select {
+	case ms.alertsChan <- &AlertNotification{Event: event, Alert: *alert}:
+	default:
+		ms.notificationMetrics.dropped.WithLabelValues("queue").Inc()
+		logrus.WithField("alert_id", alert.ID).Warn("Alert notification queue full, dropping notification")
+	}
+}
+
+// alertProcessor delivers queued notifications until the system is closed
+func (ms *MonitoringSystem) alertProcessor() {
+	for {
+		select {
+		case <-ms.stopChan:
+			return
+		case notification := <-ms.alertsChan:
+			ms.deliver(notification)
+		}
+	}
+}
+
+// deliver sends a notification to every channel whose minimum level the alert
+// reaches. Channels are served concurrently so a failing one does not delay
+// the others; deliver returns once every channel is done.
+func (ms *MonitoringSystem) deliver(notification *AlertNotification) {
+	ms.notifyMutex.RLock()
+	channels := append(append([]*notificationChannel(nil), ms.channels...), ms.notifiers...)
+	maxRetries, backoff := ms.notifications.MaxRetries, ms.notifications.RetryBackoff
+	ms.notifyMutex.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, ch := range channels {
+		if levelRank[notification.Alert.Level] < levelRank[ch.minLevel] {
+			continue
+		}
+		name := ch.notifier.Name()
+		if !ch.allow(time.Now()) {
+			ms.notificationMetrics.dropped.WithLabelValues(name).Inc()
+			logrus.WithFields(logrus.Fields{
+				"channel":  name,
+				"alert_id": notification.Alert.ID,
+			}).Warn("Alert notification rate cap reached, dropping notification")
+			continue
+		}
+
+		wg.Add(1)
+		go func(ch *notificationChannel) {
+			defer wg.Done()
+			var err error
+			if sender, ok := ch.notifier.(alertSender); ok && ch.registered {
+				err = sender.Send(&notification.Alert)
+			} else {
+				err = ms.notifyWithRetry(ch.notifier, notification, maxRetries, backoff)
+			}
+			if err != nil {
+				ms.notificationMetrics.failed.WithLabelValues(name).Inc()
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"channel":  name,
+					"alert_id": notification.Alert.ID,
+					"event":    notification.Event,
+				}).Error("Failed to deliver alert notification")
+			}
+		}(ch)
+	}
+	wg.Wait()
+}
+
+// notifyWithRetry retries a failed delivery up to maxRetries times, doubling
+// the delay from backoff; closing the system abandons the remaining retries
+func (ms *MonitoringSystem) notifyWithRetry(notifier Notifier, notification *AlertNotification, maxRetries int, backoff time.Duration) error {
+	// URLs of a webhook are retried on their own so those that accepted the
+	// notification are not posted to again
+	if webhook, ok := notifier.(*WebhookNotifier); ok && len(webhook.urls) > 1 {
+		var errs []error
+		for _, single := range webhook.perURL() {
+			if err := ms.notifyWithRetry(single, notification, maxRetries, backoff); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+		err = notifier.Notify(ctx, notification)
+		cancel()
+		if err == nil || attempt >= maxRetries {
+			return err
+		}
+
+		select {
+		case <-ms.stopChan:
+			return err
+		case <-time.After(backoff << attempt):
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package monitoring
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newNotifyingMonitor(t *testing.T, notifications config.AlertNotificationConfig) *MonitoringSystem {
+	ms := NewMonitoringSystem(&config.MonitoringConfig{Enabled: true, Notifications: notifications}, nil, prometheus.NewRegistry())
+	require.NoError(t, ms.Start(context.Background()))
+	t.Cleanup(func() { ms.Close() })
+	return ms
+}
+
+func TestWebhookReceivesSignedAlertAndResolution(t *testing.T) {
+	received := make(chan *AlertNotification, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "sha256="+SignWebhookPayload("s3cret", body), r.Header.Get(WebhookSignatureHeader))
+		var notification AlertNotification
+		assert.NoError(t, json.Unmarshal(body, &notification))
+		received <- &notification
+	}))
+	defer server.Close()
+
+	ms := newNotifyingMonitor(t, config.AlertNotificationConfig{
+		Webhook: config.NotificationChannelConfig{URL: server.URL, Secret: "s3cret", MinLevel: "warning"},
+	})
+	next := func() *AlertNotification {
+		select {
+		case notification := <-received:
+			return notification
+		case <-time.After(2 * time.Second):
+			t.Fatal("no notification delivered")
+			return nil
+		}
+	}
+
+	ctx := context.Background()
+	info := &Rule{ID: "info_rule", Name: "Info", Level: AlertLevelInfo}
+	ms.EvaluateRule(ctx, info, 1, true)
+	rule := &Rule{ID: "queue_depth", Name: "Queue Depth", Level: AlertLevelCritical, Operator: ">", Threshold: 10}
+	ms.EvaluateRule(ctx, rule, 42, true)
+	ms.EvaluateRule(ctx, rule, 42, true)
+
+	notification := next()
+	assert.Equal(t, AlertEventFiring, notification.Event)
+	assert.Equal(t, "queue_depth", notification.Alert.ID, "alerts below the channel's minimum level are not sent")
+
+	ms.EvaluateRule(ctx, rule, 3, false)
+	notification = next()
+	assert.Equal(t, AlertEventResolved, notification.Event)
+	assert.True(t, notification.Alert.Resolved)
+	assert.NotNil(t, notification.Alert.ResolvedAt)
+
+	select {
+	case extra := <-received:
+		t.Fatalf("unexpected notification %+v: an open alert is notified once", extra)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNotificationRetriesThenCountsFailure(t *testing.T) {
+	var attempts atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer flaky.Close()
+
+	ms := NewMonitoringSystem(&config.MonitoringConfig{Enabled: true, Notifications: config.AlertNotificationConfig{
+		Webhook:      config.NotificationChannelConfig{URL: flaky.URL, MinLevel: "info"},
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	}}, nil, prometheus.NewRegistry())
+	failed := ms.notificationMetrics.failed.WithLabelValues("webhook")
+	notification := &AlertNotification{Event: AlertEventFiring, Alert: Alert{ID: "a", Level: AlertLevelWarning}}
+
+	ms.deliver(notification)
+	assert.Equal(t, int32(3), attempts.Load(), "two retries after the first failure")
+	assert.Zero(t, testutil.ToFloat64(failed))
+
+	attempts.Store(-10)
+	ms.deliver(notification)
+	assert.Equal(t, int32(-7), attempts.Load())
+	assert.Equal(t, float64(1), testutil.ToFloat64(failed), "a delivery failing every attempt is counted")
+}
+
+func TestNotificationRetriesOnlyFailedWebhookURLs(t *testing.T) {
+	var attempts, healthy atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer flaky.Close()
+	steady := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		healthy.Add(1)
+	}))
+	defer steady.Close()
+
+	ms := NewMonitoringSystem(&config.MonitoringConfig{Enabled: true, Notifications: config.AlertNotificationConfig{
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	}}, nil, prometheus.NewRegistry())
+	notifier := NewWebhookNotifierURLs([]string{steady.URL, flaky.URL}, "")
+	notification := &AlertNotification{Event: AlertEventFiring, Alert: Alert{ID: "a", Level: AlertLevelWarning}}
+
+	require.NoError(t, ms.notifyWithRetry(notifier, notification, 2, time.Millisecond))
+	assert.Equal(t, int32(3), attempts.Load(), "the failing URL is retried")
+	assert.Equal(t, int32(1), healthy.Load(), "a URL that succeeded is not posted to again")
+}
+
+func TestNotificationRateCapDropsStorm(t *testing.T) {
+	var delivered atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delivered.Add(1)
+	}))
+	defer server.Close()
+
+	ms := NewMonitoringSystem(&config.MonitoringConfig{Enabled: true, Notifications: config.AlertNotificationConfig{
+		Webhook:       config.NotificationChannelConfig{URL: server.URL, MinLevel: "info"},
+		RatePerMinute: 2,
+	}}, nil, prometheus.NewRegistry())
+	for i := 0; i < 5; i++ {
+		ms.deliver(&AlertNotification{Event: AlertEventFiring, Alert: Alert{ID: "a", Level: AlertLevelCritical}})
+	}
+	assert.Equal(t, int32(2), delivered.Load())
+	assert.Equal(t, float64(3), testutil.ToFloat64(ms.notificationMetrics.dropped.WithLabelValues("webhook")))
+}
+
+func TestDingTalkSignsMarkdownMessage(t *testing.T) {
+	var query map[string][]string
+	var message struct {
+		MsgType  string `json:"msgtype"`
+		Markdown struct {
+			Title string `json:"title"`
+			Text  string `json:"text"`
+		} `json:"markdown"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&message))
+		w.Write([]byte(`{"errcode":0,"errmsg":"ok"}`))
+	}))
+	defer server.Close()
+
+	notifier := NewDingTalkNotifier(server.URL+"/robot/send?access_token=abc", "SEC123")
+	notifier.now = func() time.Time { return time.UnixMilli(1700000000000) }
+	require.NoError(t, notifier.Notify(context.Background(), &AlertNotification{
+		Event: AlertEventFiring,
+		Alert: Alert{ID: "high_error_rate", Level: AlertLevelCritical, Title: "High Error Rate Alert", Message: "error rate 9%"},
+	}))
+
+	mac := hmac.New(sha256.New, []byte("SEC123"))
+	mac.Write([]byte("1700000000000\nSEC123"))
+	assert.Equal(t, []string{"abc"}, query["access_token"])
+	assert.Equal(t, []string{"1700000000000"}, query["timestamp"])
+	assert.Equal(t, []string{base64.StdEncoding.EncodeToString(mac.Sum(nil))}, query["sign"])
+	assert.Equal(t, "markdown", message.MsgType)
+	assert.Equal(t, "[CRITICAL] High Error Rate Alert", message.Markdown.Title)
+	assert.Contains(t, message.Markdown.Text, "error rate 9%")
+}
+
+func TestDingTalkReportsRejectedMessage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"errcode":310000,"errmsg":"sign not match"}`))
+	}))
+	defer server.Close()
+
+	err := NewDingTalkNotifier(server.URL, "").Notify(context.Background(), &AlertNotification{Event: AlertEventResolved})
+	assert.ErrorContains(t, err, "sign not match")
+}
+
+func TestUpdateNotificationsValidatesChannels(t *testing.T) {
+	ms := NewMonitoringSystem(&config.MonitoringConfig{Enabled: true}, nil, prometheus.NewRegistry())
+
+	assert.Error(t, ms.UpdateNotifications(config.AlertNotificationConfig{
+		Webhook: config.NotificationChannelConfig{URL: "ftp://example.com", MinLevel: "info"},
+	}))
+	assert.Error(t, ms.UpdateNotifications(config.AlertNotificationConfig{
+		DingTalk: config.NotificationChannelConfig{URL: "https://oapi.dingtalk.com/robot/send", MinLevel: "urgent"},
+	}))
+	assert.Empty(t, ms.channels, "a rejected update keeps the previous channels")
+
+	cfg := config.AlertNotificationConfig{
+		DingTalk: config.NotificationChannelConfig{URL: "https://oapi.dingtalk.com/robot/send", MinLevel: "critical"},
+	}
+	require.NoError(t, ms.UpdateNotifications(cfg))
+	assert.Equal(t, cfg, ms.NotificationConfig())
+	require.Len(t, ms.channels, 1)
+	assert.Equal(t, "dingtalk", ms.channels[0].notifier.Name())
+}
+
+func TestWebhookSendSignsAndPostsToEveryURL(t *testing.T) {
+	received := make(chan *http.Request, 2)
+	bodies := make(chan []byte, 2)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+	})
+	first := httptest.NewServer(handler)
+	defer first.Close()
+	second := httptest.NewServer(handler)
+	defer second.Close()
+
+	notifier := NewWebhookNotifierURLs([]string{first.URL, second.URL}, "s3cret")
+	require.NoError(t, notifier.Send(&Alert{ID: "queue_depth", Level: AlertLevelCritical, Resolved: true}))
+
+	for i := 0; i < 2; i++ {
+		r, body := <-received, <-bodies
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "sha256="+SignWebhookPayload("s3cret", body), r.Header.Get(SignatureHeader))
+		assert.Equal(t, r.Header.Get(SignatureHeader), r.Header.Get(WebhookSignatureHeader))
+
+		var notification AlertNotification
+		require.NoError(t, json.Unmarshal(body, &notification))
+		assert.Equal(t, AlertEventResolved, notification.Event)
+		assert.Equal(t, "queue_depth", notification.Alert.ID)
+	}
+}
+
+func TestWebhookSendRetriesWithBackoff(t *testing.T) {
+	var attempts atomic.Int32
+	var healthy atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer flaky.Close()
+	steady := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		healthy.Add(1)
+	}))
+	defer steady.Close()
+
+	notifier := NewWebhookNotifierURLs([]string{flaky.URL, steady.URL}, "")
+	notifier.backoff = 10 * time.Millisecond
+	start := time.Now()
+	require.NoError(t, notifier.Send(&Alert{ID: "a"}))
+	assert.Equal(t, int32(3), attempts.Load(), "the third attempt succeeds")
+	assert.Equal(t, int32(1), healthy.Load(), "a URL that succeeded is not posted to again")
+	assert.GreaterOrEqual(t, time.Since(start), 30*time.Millisecond, "backoff doubles between attempts")
+
+	attempts.Store(-10)
+	err := notifier.Send(&Alert{ID: "a"})
+	assert.ErrorContains(t, err, "after 3 attempts")
+	assert.Equal(t, int32(-7), attempts.Load(), "no more than three attempts")
+}
+
+func TestAddNotifierReceivesEveryAlert(t *testing.T) {
+	received := make(chan *AlertNotification, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification AlertNotification
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&notification))
+		received <- &notification
+	}))
+	defer server.Close()
+
+	ms := newNotifyingMonitor(t, config.AlertNotificationConfig{})
+	ms.AddNotifier(NewWebhookNotifier(server.URL, ""))
+	require.NoError(t, ms.UpdateNotifications(config.AlertNotificationConfig{}), "registered notifiers survive channel updates")
+
+	rule := &Rule{ID: "info_rule", Name: "Info", Level: AlertLevelInfo}
+	ms.EvaluateRule(context.Background(), rule, 1, true)
+	select {
+	case notification := <-received:
+		assert.Equal(t, AlertEventFiring, notification.Event)
+		assert.Equal(t, "info_rule", notification.Alert.ID, "registered notifiers get alerts of every level")
+	case <-time.After(2 * time.Second):
+		t.Fatal("no notification delivered")
+	}
+}
+
+func TestMonitoringWebhookURLsRegisterNotifier(t *testing.T) {
+	ms := NewMonitoringSystem(&config.MonitoringConfig{
+		Enabled:     true,
+		WebhookURLs: []string{"http://a.example/hook", " ", "http://b.example/hook"},
+	}, nil, prometheus.NewRegistry())
+	require.Len(t, ms.notifiers, 1)
+	webhook, ok := ms.notifiers[0].notifier.(*WebhookNotifier)
+	require.True(t, ok)
+	assert.Equal(t, []string{"http://a.example/hook", "http://b.example/hook"}, webhook.urls)
+}
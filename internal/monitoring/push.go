@@ -0,0 +1,100 @@
+package monitoring
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/logging"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/sirupsen/logrus"
+)
+
+var pushFailures = promauto.With(registry).NewCounter(
+	prometheus.CounterOpts{
+		Name: "aigateway_pushgateway_push_failures_total",
+		Help: "Total number of failed pushes to the Prometheus Pushgateway",
+	},
+)
+
+// MetricsPusher 周期性地将注册表中的指标推送到 Prometheus Pushgateway，
+// 用于无法抓取网关的环境。推送失败只记录日志和计数，不影响请求处理。
+type MetricsPusher struct {
+	pusher   *push.Pusher
+	interval time.Duration
+	logger   *logrus.Logger
+}
+
+// NewMetricsPusher creates a pusher for the metrics gathered by gatherer,
+// returning nil when cfg.URL is empty
+func NewMetricsPusher(cfg *config.PushGatewayConfig, gatherer prometheus.Gatherer) *MetricsPusher {
+	if cfg.URL == "" {
+		return nil
+	}
+
+	job := cfg.Job
+	if job == "" {
+		job = "aigateway"
+	}
+	instance := cfg.Instance
+	if instance == "" {
+		instance, _ = os.Hostname()
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+
+	pusher := push.New(cfg.URL, job).
+		Gatherer(gatherer).
+		Client(httpclient.NewClient("prometheus_push", 10*time.Second))
+	if instance != "" {
+		pusher = pusher.Grouping("instance", instance)
+	}
+
+	return &MetricsPusher{
+		pusher:   pusher,
+		interval: interval,
+		logger:   logging.Default(),
+	}
+}
+
+// Start pushes metrics every interval until ctx is cancelled, with a final push on the way out
+func (p *MetricsPusher) Start(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.Push(context.Background())
+			return
+		case <-ticker.C:
+			p.Push(ctx)
+		}
+	}
+}
+
+// Push replaces the pushed group with the current metrics
+func (p *MetricsPusher) Push(ctx context.Context) error {
+	if p == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.interval)
+	defer cancel()
+
+	if err := p.pusher.PushContext(ctx); err != nil {
+		pushFailures.Inc()
+		p.logger.WithError(err).Warn("Failed to push metrics to the Pushgateway")
+		return err
+	}
+	return nil
+}
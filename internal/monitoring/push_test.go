@@ -0,0 +1,58 @@
+package monitoring
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsPusherDisabledWithoutURL(t *testing.T) {
+	assert.Nil(t, NewMetricsPusher(&config.PushGatewayConfig{}, registry))
+}
+
+func TestMetricsPusherPushesAndCountsFailures(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "aigateway_push_test_total", Help: "test"})
+	reg.MustRegister(counter)
+	counter.Add(3)
+
+	var path, body string
+	fail := false
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		path, body = r.URL.Path, string(data)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	pusher := NewMetricsPusher(&config.PushGatewayConfig{
+		URL:      gateway.URL,
+		Interval: time.Second,
+		Job:      "aigateway",
+		Instance: "gw-1",
+	}, reg)
+	require.NotNil(t, pusher)
+
+	require.NoError(t, pusher.Push(context.Background()))
+	assert.Equal(t, "/metrics/job/aigateway/instance/gw-1", path)
+	assert.Contains(t, body, "aigateway_push_test_total")
+
+	fail = true
+	before := testutil.ToFloat64(pushFailures)
+	assert.Error(t, pusher.Push(context.Background()))
+	assert.Equal(t, before+1, testutil.ToFloat64(pushFailures))
+}
@@ -0,0 +1,91 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const redactedValue = "[REDACTED]"
+
+// sensitiveNamePattern matches header names and JSON fields whose values are
+// credentials and are dropped entirely
+var sensitiveNamePattern = regexp.MustCompile(`(?i)(auth|cookie|token|secret|signature|pass(word)?|api[_-]?key|credential|private[_-]?key|x-ca-key)`)
+
+// piiPatterns 文本中的个人信息和凭证，按顺序替换（身份证号先于银行卡号）
+var piiPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=-]+`), "Bearer " + redactedValue},
+	{regexp.MustCompile(`\b(sk|gw)-[A-Za-z0-9_-]{16,}`), "[API_KEY]"},
+	{regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`), "[EMAIL]"},
+	{regexp.MustCompile(`\b\d{17}[\dXx]\b`), "[ID_NUMBER]"},
+	{regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), "[CARD]"},
+	{regexp.MustCompile(`\+?\d[\d\s().-]{7,}\d`), "[PHONE]"},
+}
+
+// RedactText masks credentials and personal data in free text
+func RedactText(s string) string {
+	for _, p := range piiPatterns {
+		s = p.pattern.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// RedactHeaders flattens headers, dropping credential values and masking PII in the rest
+func RedactHeaders(h http.Header) map[string]string {
+	redacted := make(map[string]string, len(h))
+	for key, values := range h {
+		if sensitiveNamePattern.MatchString(key) {
+			redacted[key] = redactedValue
+			continue
+		}
+		redacted[key] = RedactText(strings.Join(values, ", "))
+	}
+	return redacted
+}
+
+// RedactBody masks credentials and PII in a request or response body and
+// truncates the result to limit bytes. JSON bodies keep their structure with
+// credential fields replaced; anything else is treated as text.
+func RedactBody(body []byte, limit int) (string, bool) {
+	var doc interface{}
+	var out string
+	if err := json.Unmarshal(body, &doc); err == nil {
+		data, _ := json.Marshal(redactJSON(doc))
+		out = string(data)
+	} else {
+		out = RedactText(string(body))
+	}
+
+	if limit > 0 && len(out) > limit {
+		return strings.ToValidUTF8(out[:limit], ""), true
+	}
+	return out, false
+}
+
+func redactJSON(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key := range value {
+			// max_tokens and similar counters are not credentials
+			if sensitiveNamePattern.MatchString(key) && !strings.HasSuffix(strings.ToLower(key), "_tokens") {
+				value[key] = redactedValue
+				continue
+			}
+			value[key] = redactJSON(value[key])
+		}
+		return value
+	case []interface{}:
+		for i := range value {
+			value[i] = redactJSON(value[i])
+		}
+		return value
+	case string:
+		return RedactText(value)
+	default:
+		return value
+	}
+}
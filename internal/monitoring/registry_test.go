@@ -0,0 +1,62 @@
+package monitoring_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/monitoring"
+	"go-aigateway/internal/performance"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitoringSystemRebuildsOnOwnRegistry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.MonitoringConfig{Enabled: true}
+
+	var ms *monitoring.MonitoringSystem
+	for i := 0; i < 2; i++ {
+		require.NotPanics(t, func() {
+			ms = monitoring.NewMonitoringSystem(cfg, nil, monitoring.Registry())
+			require.NoError(t, ms.Start(context.Background()))
+			require.NoError(t, ms.Close())
+		})
+	}
+	performance.NewPerformanceOptimizer(&config.Config{}, monitoring.Registry())
+
+	// Exercise the request metrics so labelled series show up in the scrape
+	r := gin.New()
+	r.Use(middleware.PrometheusMetrics())
+	r.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ping", nil))
+
+	w := httptest.NewRecorder()
+	ms.GetMetricsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, "aigateway_requests_total")
+	assert.Contains(t, body, "aigateway_http_requests_total")
+	assert.Contains(t, body, "aigateway_performance_requests_total")
+
+	series := 0
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "# HELP") {
+			continue
+		}
+		name := strings.TrimPrefix(line, "# TYPE ")
+		assert.Truef(t, strings.HasPrefix(name, "aigateway_"), "series outside the aigateway_ namespace: %s", line)
+		series++
+	}
+	assert.NotZero(t, series)
+	assert.NotContains(t, body, "go_goroutines", "runtime collectors are not exposed")
+}
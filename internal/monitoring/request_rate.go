@@ -0,0 +1,57 @@
+package monitoring
+
+import (
+	"sync"
+	"time"
+)
+
+// qpsWindowSeconds is the span QPS is averaged over
+const qpsWindowSeconds = 60
+
+// requestRate 以每秒一个桶的环形缓冲统计最近一分钟的请求数；零值即可使用
+type requestRate struct {
+	mutex   sync.Mutex
+	counts  [qpsWindowSeconds]int64
+	seconds [qpsWindowSeconds]int64 // the unix second each bucket counts
+	started time.Time
+}
+
+// add counts one request at now
+func (r *requestRate) add(now time.Time) {
+	second := now.Unix()
+	i := second % qpsWindowSeconds
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.started.IsZero() {
+		r.started = now
+	}
+	if r.seconds[i] != second {
+		r.seconds[i], r.counts[i] = second, 0
+	}
+	r.counts[i]++
+}
+
+// perSecond returns the average request rate over the last minute, or over
+// the time since the first request when that is shorter
+func (r *requestRate) perSecond(now time.Time) float64 {
+	second := now.Unix()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.started.IsZero() {
+		return 0
+	}
+	var total int64
+	for i, bucket := range r.seconds {
+		if bucket > second-qpsWindowSeconds && bucket <= second {
+			total += r.counts[i]
+		}
+	}
+
+	span := qpsWindowSeconds * time.Second
+	if elapsed := now.Sub(r.started); elapsed < span {
+		span = max(elapsed, time.Second)
+	}
+	return float64(total) / span.Seconds()
+}
@@ -0,0 +1,72 @@
+package monitoring
+
+import (
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/resources"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestRateAveragesOverLastMinute(t *testing.T) {
+	var rate requestRate
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Zero(t, rate.perSecond(start))
+
+	// 10 requests per second for two minutes
+	for second := 0; second < 120; second++ {
+		for i := 0; i < 10; i++ {
+			rate.add(start.Add(time.Duration(second) * time.Second))
+		}
+	}
+	now := start.Add(119 * time.Second)
+	assert.InDelta(t, 10, rate.perSecond(now), 0.001)
+
+	// Traffic stops; the window drains
+	assert.InDelta(t, 5, rate.perSecond(now.Add(30*time.Second)), 0.001)
+	assert.Zero(t, rate.perSecond(now.Add(time.Minute)))
+}
+
+func TestRequestRateShortlyAfterStart(t *testing.T) {
+	var rate requestRate
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 40; i++ {
+		rate.add(start.Add(time.Duration(i) * 250 * time.Millisecond))
+	}
+	assert.InDelta(t, 4, rate.perSecond(start.Add(10*time.Second)), 0.001,
+		"before a minute has passed the rate is averaged over the time since the first request")
+}
+
+func TestCollectSystemMetricsReportsQPSAndCPU(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	ms := NewMonitoringSystem(&config.MonitoringConfig{Enabled: true}, nil, reg)
+	stat := []byte("1 (gateway) S 0 1 1 0 -1 0 0 0 0 0 0 0 0 0 20 0 1 0 1 0 0")
+	ms.cpu = &resources.CPUSampler{
+		ReadStat: func() ([]byte, error) { return stat, nil },
+		NumCPU:   1,
+	}
+	ms.collectSystemMetrics()
+
+	for i := 0; i < 50; i++ {
+		ms.RecordRequest()
+	}
+	stat = []byte("1 (gateway) S 0 1 1 0 -1 0 0 0 0 0 100000 0 0 0 20 0 1 0 1 0 0")
+	ms.collectSystemMetrics()
+
+	metrics := ms.GetMetrics()
+	assert.Greater(t, metrics.QPS, 0.0)
+	assert.Equal(t, metrics.QPS, testutil.ToFloat64(ms.systemQPS))
+	assert.Equal(t, float64(100), metrics.CPUUsage, "CPU usage is capped at all cores busy")
+	assert.Equal(t, float64(100), testutil.ToFloat64(ms.systemCPU))
+
+	require.Len(t, ms.metricsChan, 2)
+	<-ms.metricsChan
+	stored := <-ms.metricsChan
+	assert.Equal(t, metrics.QPS, stored.QPS, "the metrics stored in Redis carry the QPS")
+	assert.Equal(t, metrics.CPUUsage, stored.CPUUsage)
+}
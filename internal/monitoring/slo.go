@@ -0,0 +1,601 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/storage"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Burn-rate alert thresholds, following the multi-window multi-burn-rate
+// recipe from the Google SRE workbook for a 28 day budget: the fast alert
+// fires when 2% of the budget is spent in 1h, the slow one at 5% in 6h. The
+// short windows (1/12 of the long ones) make alerts reset quickly once the
+// burn stops.
+const (
+	FastBurnThreshold = 14.4
+	SlowBurnThreshold = 6.0
+
+	fastBurnLongWindow  = time.Hour
+	fastBurnShortWindow = 5 * time.Minute
+	slowBurnLongWindow  = 6 * time.Hour
+	slowBurnShortWindow = 30 * time.Minute
+
+	// 分钟级计数保留到最长的告警窗口，之后只保留降采样的小时计数
+	minuteRetention = slowBurnLongWindow + time.Hour
+)
+
+// DefaultSLOWindow 默认滚动窗口28天
+const DefaultSLOWindow = 28 * 24 * time.Hour
+
+// SLO 服务等级目标，Tenant为空时作用于全部请求
+type SLO struct {
+	ID                 string        `json:"id"`
+	Tenant             string        `json:"tenant,omitempty"`
+	AvailabilityTarget float64       `json:"availability_target"`          // e.g. 0.995
+	LatencyThreshold   time.Duration `json:"latency_threshold,omitempty"`  // zero disables the latency objective
+	LatencyPercentile  float64       `json:"latency_percentile,omitempty"` // share of requests that must be under the threshold, e.g. 0.95
+	Window             time.Duration `json:"window"`
+	UpdatedAt          time.Time     `json:"updated_at"`
+}
+
+// Validate checks targets and fills in the default window
+func (s *SLO) Validate() error {
+	if s.ID == "" {
+		return fmt.Errorf("slo id is required")
+	}
+	if s.AvailabilityTarget <= 0 || s.AvailabilityTarget >= 1 {
+		return fmt.Errorf("slo %s: availability_target must be between 0 and 1", s.ID)
+	}
+	if s.LatencyThreshold < 0 {
+		return fmt.Errorf("slo %s: latency_threshold must not be negative", s.ID)
+	}
+	if s.LatencyThreshold > 0 && (s.LatencyPercentile <= 0 || s.LatencyPercentile >= 1) {
+		return fmt.Errorf("slo %s: latency_percentile must be between 0 and 1", s.ID)
+	}
+	if s.Window == 0 {
+		s.Window = DefaultSLOWindow
+	}
+	if s.Window < slowBurnLongWindow {
+		return fmt.Errorf("slo %s: window must be at least %s", s.ID, slowBurnLongWindow)
+	}
+	return nil
+}
+
+func (s *SLO) appliesTo(tenant string) bool {
+	return s.Tenant == "" || s.Tenant == tenant
+}
+
+// Outcome 单个请求的结果
+type Outcome struct {
+	Tenant   string
+	Status   int
+	Duration time.Duration
+	Canceled bool // client went away before the response was written
+	Time     time.Time
+}
+
+// Excluded reports whether the request is outside every SLO: client errors
+// (4xx) and requests the client cancelled say nothing about the gateway.
+func (o Outcome) Excluded() bool {
+	if o.Canceled || o.Status == 499 {
+		return true
+	}
+	return o.Status >= 400 && o.Status < 500
+}
+
+// sloCounts 单个时间桶内的计数
+type sloCounts struct {
+	Valid           int64 `json:"valid"`
+	AvailabilityBad int64 `json:"availability_bad"`
+	LatencyValid    int64 `json:"latency_valid"`
+	LatencyBad      int64 `json:"latency_bad"`
+	Excluded        int64 `json:"excluded"`
+}
+
+func (c *sloCounts) add(o sloCounts) {
+	c.Valid += o.Valid
+	c.AvailabilityBad += o.AvailabilityBad
+	c.LatencyValid += o.LatencyValid
+	c.LatencyBad += o.LatencyBad
+	c.Excluded += o.Excluded
+}
+
+// classify converts an outcome into counts for one SLO. Latency is only judged
+// on successful requests so a failure is not charged to both budgets.
+func classify(slo *SLO, o Outcome) sloCounts {
+	if o.Excluded() {
+		return sloCounts{Excluded: 1}
+	}
+	c := sloCounts{Valid: 1}
+	if o.Status >= 500 {
+		c.AvailabilityBad = 1
+		return c
+	}
+	if slo.LatencyThreshold > 0 {
+		c.LatencyValid = 1
+		if o.Duration > slo.LatencyThreshold {
+			c.LatencyBad = 1
+		}
+	}
+	return c
+}
+
+// sloCounter 滚动计数存储：分钟桶用于燃烧率，小时桶（降采样）用于整个窗口的达标率
+type sloCounter interface {
+	incr(ctx context.Context, slo *SLO, at time.Time, c sloCounts) error
+	minutes(ctx context.Context, sloID string, from, to time.Time) (sloCounts, error)
+	hours(ctx context.Context, sloID string, from, to time.Time) (sloCounts, error)
+}
+
+// redisSLOCounter 多实例共享的计数，键为 slo:<id>:m:<unix分钟> 与 slo:<id>:h:<unix小时>
+type redisSLOCounter struct {
+	client *redis.Client
+}
+
+func (r *redisSLOCounter) incr(ctx context.Context, slo *SLO, at time.Time, c sloCounts) error {
+	minuteKey := fmt.Sprintf("slo:%s:m:%d", slo.ID, at.Unix()/60)
+	hourKey := fmt.Sprintf("slo:%s:h:%d", slo.ID, at.Unix()/3600)
+
+	pipe := r.client.Pipeline()
+	for _, key := range []string{minuteKey, hourKey} {
+		pipe.HIncrBy(ctx, key, "valid", c.Valid)
+		pipe.HIncrBy(ctx, key, "availability_bad", c.AvailabilityBad)
+		pipe.HIncrBy(ctx, key, "latency_valid", c.LatencyValid)
+		pipe.HIncrBy(ctx, key, "latency_bad", c.LatencyBad)
+		pipe.HIncrBy(ctx, key, "excluded", c.Excluded)
+	}
+	pipe.Expire(ctx, minuteKey, minuteRetention)
+	pipe.Expire(ctx, hourKey, slo.Window+time.Hour)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *redisSLOCounter) sum(ctx context.Context, prefix string, first, last int64) (sloCounts, error) {
+	var total sloCounts
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, 0, last-first+1)
+	for b := first; b <= last; b++ {
+		cmds = append(cmds, pipe.HGetAll(ctx, prefix+strconv.FormatInt(b, 10)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return total, err
+	}
+	for _, cmd := range cmds {
+		fields := cmd.Val()
+		total.add(sloCounts{
+			Valid:           parseCount(fields["valid"]),
+			AvailabilityBad: parseCount(fields["availability_bad"]),
+			LatencyValid:    parseCount(fields["latency_valid"]),
+			LatencyBad:      parseCount(fields["latency_bad"]),
+			Excluded:        parseCount(fields["excluded"]),
+		})
+	}
+	return total, nil
+}
+
+func (r *redisSLOCounter) minutes(ctx context.Context, sloID string, from, to time.Time) (sloCounts, error) {
+	return r.sum(ctx, fmt.Sprintf("slo:%s:m:", sloID), from.Unix()/60, to.Unix()/60)
+}
+
+func (r *redisSLOCounter) hours(ctx context.Context, sloID string, from, to time.Time) (sloCounts, error) {
+	return r.sum(ctx, fmt.Sprintf("slo:%s:h:", sloID), from.Unix()/3600, to.Unix()/3600)
+}
+
+func parseCount(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+// memorySLOCounter 未启用Redis时使用，仅统计本实例
+type memorySLOCounter struct {
+	mu      sync.Mutex
+	minute  map[string]map[int64]sloCounts
+	hour    map[string]map[int64]sloCounts
+	windows map[string]time.Duration
+}
+
+func newMemorySLOCounter() *memorySLOCounter {
+	return &memorySLOCounter{
+		minute:  make(map[string]map[int64]sloCounts),
+		hour:    make(map[string]map[int64]sloCounts),
+		windows: make(map[string]time.Duration),
+	}
+}
+
+func (m *memorySLOCounter) incr(ctx context.Context, slo *SLO, at time.Time, c sloCounts) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.minute[slo.ID] == nil {
+		m.minute[slo.ID] = make(map[int64]sloCounts)
+		m.hour[slo.ID] = make(map[int64]sloCounts)
+	}
+	m.windows[slo.ID] = slo.Window
+
+	mb, hb := at.Unix()/60, at.Unix()/3600
+	_, existing := m.minute[slo.ID][mb]
+	counts := m.minute[slo.ID][mb]
+	counts.add(c)
+	m.minute[slo.ID][mb] = counts
+	counts = m.hour[slo.ID][hb]
+	counts.add(c)
+	m.hour[slo.ID][hb] = counts
+
+	// 每分钟第一次写入时顺带清理过期桶
+	if !existing {
+		m.prune(slo.ID, at)
+	}
+	return nil
+}
+
+func (m *memorySLOCounter) prune(sloID string, now time.Time) {
+	minMinute := now.Add(-minuteRetention).Unix() / 60
+	for b := range m.minute[sloID] {
+		if b < minMinute {
+			delete(m.minute[sloID], b)
+		}
+	}
+	minHour := now.Add(-m.windows[sloID]-time.Hour).Unix() / 3600
+	for b := range m.hour[sloID] {
+		if b < minHour {
+			delete(m.hour[sloID], b)
+		}
+	}
+}
+
+func (m *memorySLOCounter) sum(buckets map[int64]sloCounts, first, last int64) sloCounts {
+	var total sloCounts
+	for b, c := range buckets {
+		if b >= first && b <= last {
+			total.add(c)
+		}
+	}
+	return total
+}
+
+func (m *memorySLOCounter) minutes(ctx context.Context, sloID string, from, to time.Time) (sloCounts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sum(m.minute[sloID], from.Unix()/60, to.Unix()/60), nil
+}
+
+func (m *memorySLOCounter) hours(ctx context.Context, sloID string, from, to time.Time) (sloCounts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sum(m.hour[sloID], from.Unix()/3600, to.Unix()/3600), nil
+}
+
+// ObjectiveStatus 单个目标（可用性或延迟）的达标情况
+type ObjectiveStatus struct {
+	Target               float64 `json:"target"`
+	SLI                  float64 `json:"sli"`
+	Compliant            bool    `json:"compliant"`
+	ErrorBudgetRemaining float64 `json:"error_budget_remaining"` // fraction of the window's budget left, negative when overspent
+	BurnRate1h           float64 `json:"burn_rate_1h"`
+	BurnRate6h           float64 `json:"burn_rate_6h"`
+	FastBurn             bool    `json:"fast_burn"`
+	SlowBurn             bool    `json:"slow_burn"`
+}
+
+// SLOStatus 返回给仪表盘的SLO状态
+type SLOStatus struct {
+	SLO          SLO              `json:"slo"`
+	Requests     int64            `json:"requests"`
+	Excluded     int64            `json:"excluded"`
+	Availability ObjectiveStatus  `json:"availability"`
+	Latency      *ObjectiveStatus `json:"latency,omitempty"`
+	EvaluatedAt  time.Time        `json:"evaluated_at"`
+}
+
+// errorRatio 返回坏请求占比，没有有效请求时为0
+func errorRatio(bad, valid int64) float64 {
+	if valid == 0 {
+		return 0
+	}
+	return float64(bad) / float64(valid)
+}
+
+// BurnRate 错误预算消耗速度，1表示恰好在窗口结束时耗尽预算
+func BurnRate(bad, valid int64, target float64) float64 {
+	return errorRatio(bad, valid) / (1 - target)
+}
+
+// ErrorBudgetRemaining 窗口内剩余的错误预算比例
+func ErrorBudgetRemaining(bad, valid int64, target float64) float64 {
+	if valid == 0 {
+		return 1
+	}
+	allowed := float64(valid) * (1 - target)
+	return 1 - float64(bad)/allowed
+}
+
+// SLOTracker 按租户跟踪SLO，维护滚动计数并通过MonitoringSystem产生燃烧率告警
+type SLOTracker struct {
+	mu      sync.RWMutex
+	slos    map[string]*SLO
+	counter sloCounter
+	store   storage.Store
+	ms      *MonitoringSystem
+	now     func() time.Time
+}
+
+// NewSLOTracker creates a tracker. redisClient, store and ms are optional: without
+// Redis counts are per instance, without a store definitions live in memory,
+// without a monitoring system burn rates are reported but no alerts are raised.
+func NewSLOTracker(redisClient *redis.Client, store storage.Store, ms *MonitoringSystem) *SLOTracker {
+	var counter sloCounter = newMemorySLOCounter()
+	if redisClient != nil {
+		counter = &redisSLOCounter{client: redisClient}
+	}
+	return &SLOTracker{
+		slos:    make(map[string]*SLO),
+		counter: counter,
+		store:   store,
+		ms:      ms,
+		now:     time.Now,
+	}
+}
+
+// Load reads SLO definitions from the store
+func (t *SLOTracker) Load(ctx context.Context) error {
+	if t.store == nil {
+		return nil
+	}
+	records, err := t.store.List(ctx, storage.BucketSLOs)
+	if err != nil {
+		return fmt.Errorf("failed to load SLOs: %w", err)
+	}
+
+	for id, data := range records {
+		var slo SLO
+		if err := json.Unmarshal(data, &slo); err != nil {
+			logrus.WithError(err).WithField("slo", id).Warn("Skipping unreadable SLO")
+			continue
+		}
+		t.mu.Lock()
+		t.slos[slo.ID] = &slo
+		t.mu.Unlock()
+		t.registerRules(&slo)
+	}
+	logrus.WithField("slos", len(records)).Info("SLO definitions loaded")
+	return nil
+}
+
+// List returns all definitions sorted by ID
+func (t *SLOTracker) List() []SLO {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	result := make([]SLO, 0, len(t.slos))
+	for _, slo := range t.slos {
+		result = append(result, *slo)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Upsert validates and stores a definition
+func (t *SLOTracker) Upsert(ctx context.Context, slo SLO) (*SLO, error) {
+	if err := slo.Validate(); err != nil {
+		return nil, err
+	}
+	slo.UpdatedAt = t.now()
+
+	if t.store != nil {
+		data, err := json.Marshal(slo)
+		if err != nil {
+			return nil, err
+		}
+		if err := t.store.Put(ctx, storage.BucketSLOs, slo.ID, data); err != nil {
+			return nil, fmt.Errorf("failed to persist SLO %s: %w", slo.ID, err)
+		}
+	}
+
+	t.mu.Lock()
+	t.slos[slo.ID] = &slo
+	t.mu.Unlock()
+	t.registerRules(&slo)
+	return &slo, nil
+}
+
+// Delete removes a definition and its alert rules
+func (t *SLOTracker) Delete(ctx context.Context, id string) error {
+	t.mu.Lock()
+	_, exists := t.slos[id]
+	delete(t.slos, id)
+	t.mu.Unlock()
+
+	if !exists {
+		return storage.ErrNotFound
+	}
+	if t.ms != nil {
+		for _, rule := range burnRules(&SLO{ID: id}) {
+			t.ms.RemoveRule(rule.ID)
+		}
+	}
+	if t.store != nil {
+		return t.store.Delete(ctx, storage.BucketSLOs, id)
+	}
+	return nil
+}
+
+// Record classifies a request against every SLO that applies to its tenant
+func (t *SLOTracker) Record(ctx context.Context, o Outcome) {
+	if o.Time.IsZero() {
+		o.Time = t.now()
+	}
+
+	t.mu.RLock()
+	matching := make([]*SLO, 0, len(t.slos))
+	for _, slo := range t.slos {
+		if slo.appliesTo(o.Tenant) {
+			matching = append(matching, slo)
+		}
+	}
+	t.mu.RUnlock()
+
+	for _, slo := range matching {
+		if err := t.counter.incr(ctx, slo, o.Time, classify(slo, o)); err != nil {
+			logrus.WithError(err).WithField("slo", slo.ID).Warn("Failed to record SLO outcome")
+		}
+	}
+}
+
+// Status computes compliance, remaining budget and burn rates for every SLO,
+// optionally filtered by tenant
+func (t *SLOTracker) Status(ctx context.Context, tenant string) ([]SLOStatus, error) {
+	now := t.now()
+	var result []SLOStatus
+	for _, slo := range t.List() {
+		if tenant != "" && slo.Tenant != tenant {
+			continue
+		}
+		status, err := t.status(ctx, &slo, now)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *status)
+	}
+	return result, nil
+}
+
+func (t *SLOTracker) status(ctx context.Context, slo *SLO, now time.Time) (*SLOStatus, error) {
+	window, err := t.counter.hours(ctx, slo.ID, now.Add(-slo.Window), now)
+	if err != nil {
+		return nil, err
+	}
+	var burn [4]sloCounts
+	for i, w := range []time.Duration{fastBurnLongWindow, fastBurnShortWindow, slowBurnLongWindow, slowBurnShortWindow} {
+		// 分钟桶包含当前分钟，因此起点向后偏移一分钟
+		if burn[i], err = t.counter.minutes(ctx, slo.ID, now.Add(-w+time.Minute), now); err != nil {
+			return nil, err
+		}
+	}
+
+	status := &SLOStatus{
+		SLO:         *slo,
+		Requests:    window.Valid,
+		Excluded:    window.Excluded,
+		EvaluatedAt: now,
+	}
+
+	status.Availability = objective(slo.AvailabilityTarget,
+		window.AvailabilityBad, window.Valid,
+		func(c sloCounts) (int64, int64) { return c.AvailabilityBad, c.Valid }, burn)
+
+	if slo.LatencyThreshold > 0 {
+		latency := objective(slo.LatencyPercentile,
+			window.LatencyBad, window.LatencyValid,
+			func(c sloCounts) (int64, int64) { return c.LatencyBad, c.LatencyValid }, burn)
+		status.Latency = &latency
+	}
+	return status, nil
+}
+
+// objective 计算单个目标的状态，burn依次为1h、5m、6h、30m窗口的计数
+func objective(target float64, bad, valid int64, pick func(sloCounts) (int64, int64), burn [4]sloCounts) ObjectiveStatus {
+	rates := make([]float64, len(burn))
+	for i, c := range burn {
+		b, v := pick(c)
+		rates[i] = BurnRate(b, v, target)
+	}
+
+	return ObjectiveStatus{
+		Target:               target,
+		SLI:                  1 - errorRatio(bad, valid),
+		Compliant:            errorRatio(bad, valid) <= 1-target,
+		ErrorBudgetRemaining: ErrorBudgetRemaining(bad, valid, target),
+		BurnRate1h:           rates[0],
+		BurnRate6h:           rates[2],
+		FastBurn:             rates[0] > FastBurnThreshold && rates[1] > FastBurnThreshold,
+		SlowBurn:             rates[2] > SlowBurnThreshold && rates[3] > SlowBurnThreshold,
+	}
+}
+
+// burnRules 每个SLO的燃烧率告警规则，由Evaluate而不是checkRules触发
+func burnRules(slo *SLO) []*Rule {
+	var rules []*Rule
+	for _, sli := range []string{"availability", "latency"} {
+		rules = append(rules,
+			&Rule{
+				ID:          fmt.Sprintf("slo_%s_%s_fast_burn", slo.ID, sli),
+				Name:        fmt.Sprintf("SLO %s %s fast burn", slo.ID, sli),
+				Description: fmt.Sprintf("SLO %s %s error budget burn rate over 1h (and 5m)", slo.ID, sli),
+				MetricKey:   "slo_burn_rate_1h",
+				Operator:    ">",
+				Threshold:   FastBurnThreshold,
+				Duration:    fastBurnLongWindow,
+				Level:       AlertLevelCritical,
+				Enabled:     true,
+			},
+			&Rule{
+				ID:          fmt.Sprintf("slo_%s_%s_slow_burn", slo.ID, sli),
+				Name:        fmt.Sprintf("SLO %s %s slow burn", slo.ID, sli),
+				Description: fmt.Sprintf("SLO %s %s error budget burn rate over 6h (and 30m)", slo.ID, sli),
+				MetricKey:   "slo_burn_rate_6h",
+				Operator:    ">",
+				Threshold:   SlowBurnThreshold,
+				Duration:    slowBurnLongWindow,
+				Level:       AlertLevelWarning,
+				Enabled:     true,
+			})
+	}
+	return rules
+}
+
+func (t *SLOTracker) registerRules(slo *SLO) {
+	if t.ms == nil {
+		return
+	}
+	for _, rule := range burnRules(slo) {
+		t.ms.AddRule(rule)
+	}
+}
+
+// Evaluate computes every SLO's status and fires or resolves burn-rate alerts
+func (t *SLOTracker) Evaluate(ctx context.Context) ([]SLOStatus, error) {
+	statuses, err := t.Status(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	if t.ms == nil {
+		return statuses, nil
+	}
+
+	for _, s := range statuses {
+		rules := burnRules(&s.SLO)
+		t.ms.EvaluateRule(ctx, rules[0], s.Availability.BurnRate1h, s.Availability.FastBurn)
+		t.ms.EvaluateRule(ctx, rules[1], s.Availability.BurnRate6h, s.Availability.SlowBurn)
+		if s.Latency != nil {
+			t.ms.EvaluateRule(ctx, rules[2], s.Latency.BurnRate1h, s.Latency.FastBurn)
+			t.ms.EvaluateRule(ctx, rules[3], s.Latency.BurnRate6h, s.Latency.SlowBurn)
+		}
+	}
+	return statuses, nil
+}
+
+// Start evaluates SLOs periodically until ctx is cancelled
+func (t *SLOTracker) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := t.Evaluate(ctx); err != nil {
+				logrus.WithError(err).Warn("SLO evaluation failed")
+			}
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package monitoring
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sloEpoch = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestSLOTracker returns a tracker with a frozen clock and an in-memory alert sink
+func newTestSLOTracker(t *testing.T, redisClient *redis.Client) (*SLOTracker, *MonitoringSystem, *time.Time) {
+	ms := &MonitoringSystem{
+		rules:   make(map[string]*Rule),
+		alerts:  make(map[string]*Alert),
+		metrics: &Metrics{},
+	}
+	tracker := NewSLOTracker(redisClient, nil, ms)
+	now := sloEpoch
+	tracker.now = func() time.Time { return now }
+
+	_, err := tracker.Upsert(context.Background(), SLO{
+		ID:                 "acme",
+		Tenant:             "acme",
+		AvailabilityTarget: 0.995,
+		LatencyThreshold:   3 * time.Second,
+		LatencyPercentile:  0.95,
+	})
+	require.NoError(t, err)
+	return tracker, ms, &now
+}
+
+// feed records n outcomes spread over the minute starting at `at`
+func feed(tracker *SLOTracker, at time.Time, n int, o Outcome) {
+	for i := 0; i < n; i++ {
+		o.Time = at.Add(time.Duration(i) * time.Minute / time.Duration(n))
+		tracker.Record(context.Background(), o)
+	}
+}
+
+func activeAlerts(ms *MonitoringSystem) map[string]bool {
+	active := make(map[string]bool)
+	for id, alert := range ms.alerts {
+		if !alert.Resolved {
+			active[id] = true
+		}
+	}
+	return active
+}
+
+func TestOutcomeExclusions(t *testing.T) {
+	assert.True(t, Outcome{Status: 400}.Excluded())
+	assert.True(t, Outcome{Status: 404}.Excluded())
+	assert.True(t, Outcome{Status: 499}.Excluded())
+	assert.True(t, Outcome{Status: 200, Canceled: true}.Excluded())
+	assert.False(t, Outcome{Status: 200}.Excluded())
+	assert.False(t, Outcome{Status: 502}.Excluded())
+
+	slo := &SLO{AvailabilityTarget: 0.99, LatencyThreshold: time.Second, LatencyPercentile: 0.9}
+	assert.Equal(t, sloCounts{Excluded: 1}, classify(slo, Outcome{Status: 429}))
+	assert.Equal(t, sloCounts{Valid: 1, AvailabilityBad: 1}, classify(slo, Outcome{Status: 503, Duration: 5 * time.Second}))
+	assert.Equal(t, sloCounts{Valid: 1, LatencyValid: 1, LatencyBad: 1}, classify(slo, Outcome{Status: 200, Duration: 2 * time.Second}))
+	assert.Equal(t, sloCounts{Valid: 1, LatencyValid: 1}, classify(slo, Outcome{Status: 200, Duration: 500 * time.Millisecond}))
+}
+
+func TestSLOValidate(t *testing.T) {
+	slo := SLO{ID: "global", AvailabilityTarget: 0.999}
+	require.NoError(t, slo.Validate())
+	assert.Equal(t, DefaultSLOWindow, slo.Window)
+
+	assert.Error(t, (&SLO{ID: "x", AvailabilityTarget: 1}).Validate())
+	assert.Error(t, (&SLO{ID: "x", AvailabilityTarget: 0.99, LatencyThreshold: time.Second}).Validate())
+	assert.Error(t, (&SLO{ID: "x", AvailabilityTarget: 0.99, Window: time.Hour}).Validate())
+}
+
+func TestSLOErrorBudgetMath(t *testing.T) {
+	tracker, _, _ := newTestSLOTracker(t, nil)
+
+	// 1000 valid requests spread over the last 10 days: 2 failures, 30 slow
+	day := 24 * time.Hour
+	for d := 1; d <= 10; d++ {
+		at := sloEpoch.Add(-time.Duration(d) * day)
+		feed(tracker, at, 95, Outcome{Tenant: "acme", Status: 200, Duration: time.Second})
+		feed(tracker, at.Add(time.Minute), 3, Outcome{Tenant: "acme", Status: 200, Duration: 4 * time.Second})
+	}
+	feed(tracker, sloEpoch.Add(-2*day), 2, Outcome{Tenant: "acme", Status: 500})
+	// excluded outcomes and other tenants do not count
+	feed(tracker, sloEpoch.Add(-3*day), 50, Outcome{Tenant: "acme", Status: 404})
+	feed(tracker, sloEpoch.Add(-3*day), 10, Outcome{Tenant: "acme", Status: 200, Canceled: true})
+	feed(tracker, sloEpoch.Add(-3*day), 100, Outcome{Tenant: "other", Status: 500})
+	// outside the 28 day window
+	feed(tracker, sloEpoch.Add(-40*day), 100, Outcome{Tenant: "acme", Status: 500})
+
+	statuses, err := tracker.Status(context.Background(), "acme")
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	s := statuses[0]
+
+	assert.Equal(t, int64(982), s.Requests)
+	assert.Equal(t, int64(60), s.Excluded)
+
+	// 2 bad of 982 against a budget of 0.5% → 2/4.91 spent
+	assert.InDelta(t, 1-2.0/982, s.Availability.SLI, 1e-9)
+	assert.True(t, s.Availability.Compliant)
+	assert.InDelta(t, 1-2/(982*0.005), s.Availability.ErrorBudgetRemaining, 1e-9)
+
+	// 30 slow of 980 successful against a 5% budget
+	require.NotNil(t, s.Latency)
+	assert.InDelta(t, 1-30.0/980, s.Latency.SLI, 1e-9)
+	assert.True(t, s.Latency.Compliant)
+	assert.InDelta(t, 1-30/(980*0.05), s.Latency.ErrorBudgetRemaining, 1e-9)
+
+	// nothing happened in the last 6h
+	assert.Zero(t, s.Availability.BurnRate1h)
+	assert.Zero(t, s.Availability.BurnRate6h)
+}
+
+func TestSLOBurnRateAlerts(t *testing.T) {
+	tracker, ms, now := newTestSLOTracker(t, nil)
+	ctx := context.Background()
+
+	// 7% errors in the last few minutes: burn rate 14 is above the slow
+	// threshold (6) but just under the fast one (14.4)
+	feed(tracker, sloEpoch.Add(-3*time.Minute), 93, Outcome{Tenant: "acme", Status: 200, Duration: time.Second})
+	feed(tracker, sloEpoch.Add(-2*time.Minute), 7, Outcome{Tenant: "acme", Status: 503})
+
+	statuses, err := tracker.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.InDelta(t, 14.0, statuses[0].Availability.BurnRate1h, 1e-9)
+	assert.False(t, statuses[0].Availability.FastBurn)
+	assert.True(t, statuses[0].Availability.SlowBurn)
+	assert.Equal(t, map[string]bool{"slo_acme_availability_slow_burn": true}, activeAlerts(ms))
+	assert.Equal(t, AlertLevelWarning, ms.alerts["slo_acme_availability_slow_burn"].Level)
+
+	// another 3 failures push the error ratio to ~9.7% (burn 19.4)
+	feed(tracker, sloEpoch.Add(-time.Minute), 3, Outcome{Tenant: "acme", Status: 500})
+	_, err = tracker.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.True(t, activeAlerts(ms)["slo_acme_availability_fast_burn"])
+	assert.Equal(t, AlertLevelCritical, ms.alerts["slo_acme_availability_fast_burn"].Level)
+
+	// 40 minutes later the 5m window is clean, so the fast alert resets even
+	// though the 1h window still burns fast; the 30m window clears the slow one
+	*now = sloEpoch.Add(40 * time.Minute)
+	statuses, err = tracker.Evaluate(ctx)
+	require.NoError(t, err)
+	assert.Greater(t, statuses[0].Availability.BurnRate1h, FastBurnThreshold)
+	assert.Empty(t, activeAlerts(ms))
+	assert.True(t, ms.alerts["slo_acme_availability_fast_burn"].Resolved)
+}
+
+func TestSLOLatencyBurnAndTenantScoping(t *testing.T) {
+	tracker, ms, _ := newTestSLOTracker(t, nil)
+	ctx := context.Background()
+	_, err := tracker.Upsert(ctx, SLO{ID: "global", AvailabilityTarget: 0.99})
+	require.NoError(t, err)
+
+	// every acme request is slow; other tenants only count against the global SLO
+	feed(tracker, sloEpoch.Add(-time.Minute), 20, Outcome{Tenant: "acme", Status: 200, Duration: 5 * time.Second})
+	feed(tracker, sloEpoch.Add(-time.Minute), 20, Outcome{Tenant: "beta", Status: 200, Duration: 5 * time.Second})
+
+	statuses, err := tracker.Evaluate(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+
+	byID := map[string]SLOStatus{}
+	for _, s := range statuses {
+		byID[s.SLO.ID] = s
+	}
+	assert.Equal(t, int64(20), byID["acme"].Requests)
+	assert.Equal(t, int64(40), byID["global"].Requests)
+	assert.Nil(t, byID["global"].Latency)
+	assert.InDelta(t, 20.0, byID["acme"].Latency.BurnRate1h, 1e-9)
+
+	active := activeAlerts(ms)
+	assert.True(t, active["slo_acme_latency_fast_burn"])
+	assert.True(t, active["slo_acme_latency_slow_burn"])
+	assert.False(t, active["slo_acme_availability_fast_burn"])
+
+	require.NoError(t, tracker.Delete(ctx, "acme"))
+	_, ok := ms.GetRules()["slo_acme_latency_fast_burn"]
+	assert.False(t, ok)
+}
+
+func TestSLORedisCounter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	tracker, _, _ := newTestSLOTracker(t, client)
+	feed(tracker, sloEpoch.Add(-2*time.Hour), 10, Outcome{Tenant: "acme", Status: 502})
+	feed(tracker, sloEpoch.Add(-time.Minute), 90, Outcome{Tenant: "acme", Status: 200, Duration: time.Second})
+
+	// a second instance sharing Redis sees the same counts
+	other, _, _ := newTestSLOTracker(t, client)
+	statuses, err := other.Status(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, int64(100), statuses[0].Requests)
+	assert.InDelta(t, 0.9, statuses[0].Availability.SLI, 1e-9)
+	assert.InDelta(t, 20.0, statuses[0].Availability.BurnRate6h, 1e-9)
+	assert.Zero(t, statuses[0].Availability.BurnRate1h)
+
+	minuteKey := "slo:acme:m:" + itoa(sloEpoch.Add(-time.Minute).Unix()/60)
+	hourKey := "slo:acme:h:" + itoa(sloEpoch.Add(-time.Minute).Unix()/3600)
+	assert.Equal(t, minuteRetention, mr.TTL(minuteKey))
+	assert.Equal(t, DefaultSLOWindow+time.Hour, mr.TTL(hourKey))
+}
+
+func itoa(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,255 @@
+package monitoring
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/sirupsen/logrus"
+)
+
+// StatsD tag formats
+const (
+	StatsDFormatDogStatsD = "dogstatsd" // name:1|c|#env:prod,provider:x
+	StatsDFormatStatsD    = "statsd"    // name,env=prod,provider=x:1|c (Telegraf style)
+)
+
+const statsDNamespace = "aigateway."
+
+// statsDSeries 单个provider/model组合的累计指标
+type statsDSeries struct {
+	provider     string
+	model        string
+	requests     int64
+	errors       int64
+	latencySum   time.Duration
+	latencyCount int64
+}
+
+// StatsDReporter 周期性地将网关指标以StatsD/DogStatsD格式推送到Datadog agent
+type StatsDReporter struct {
+	client   statsd.ClientInterface
+	format   string
+	env      string
+	interval time.Duration
+	system   *MonitoringSystem
+
+	series map[string]*statsDSeries
+	mutex  sync.Mutex
+}
+
+var (
+	defaultStatsD   *StatsDReporter
+	defaultStatsDMu sync.RWMutex
+)
+
+// NewStatsDReporter creates a reporter for cfg.Addr, returning nil when StatsD export is disabled
+func NewStatsDReporter(cfg *config.StatsDConfig) (*StatsDReporter, error) {
+	if cfg.Addr == "" {
+		return nil, nil
+	}
+
+	format := cfg.Format
+	if format == "" {
+		format = StatsDFormatDogStatsD
+	}
+	if format != StatsDFormatDogStatsD && format != StatsDFormatStatsD {
+		return nil, fmt.Errorf("unsupported StatsD format: %s", format)
+	}
+
+	// 客户端聚合会合并相同指标，这里每个周期只发送一次，直接关闭
+	client, err := statsd.New(cfg.Addr,
+		statsd.WithoutTelemetry(),
+		statsd.WithoutOriginDetection(),
+		statsd.WithoutClientSideAggregation(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create StatsD client: %w", err)
+	}
+
+	interval := cfg.FlushInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	return &StatsDReporter{
+		client:   client,
+		format:   format,
+		env:      cfg.Env,
+		interval: interval,
+		series:   make(map[string]*statsDSeries),
+	}, nil
+}
+
+// SetDefaultStatsDReporter installs the reporter used by RecordProviderRequest
+func SetDefaultStatsDReporter(r *StatsDReporter) {
+	defaultStatsDMu.Lock()
+	defaultStatsD = r
+	defaultStatsDMu.Unlock()
+}
+
+// RecordProviderRequest records an upstream call on the default reporter, if any
+func RecordProviderRequest(provider, model string, status int, latency time.Duration) {
+	defaultStatsDMu.RLock()
+	r := defaultStatsD
+	defaultStatsDMu.RUnlock()
+	r.RecordRequest(provider, model, status, latency)
+}
+
+// AttachMonitoringSystem adds the monitoring system's runtime gauges to each flush
+func (r *StatsDReporter) AttachMonitoringSystem(ms *MonitoringSystem) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	r.system = ms
+	r.mutex.Unlock()
+}
+
+// RecordRequest records a single upstream request. Status 0 or >= 500 counts as an error.
+func (r *StatsDReporter) RecordRequest(provider, model string, status int, latency time.Duration) {
+	if r == nil {
+		return
+	}
+	if provider == "" {
+		provider = "unknown"
+	}
+	if model == "" {
+		model = "unknown"
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := provider + "|" + model
+	s, ok := r.series[key]
+	if !ok {
+		s = &statsDSeries{provider: provider, model: model}
+		r.series[key] = s
+	}
+	s.requests++
+	if status == 0 || status >= 500 {
+		s.errors++
+	}
+	s.latencySum += latency
+	s.latencyCount++
+}
+
+// Start flushes metrics every interval until ctx is cancelled
+func (r *StatsDReporter) Start(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.Flush()
+			return
+		case <-ticker.C:
+			r.Flush()
+		}
+	}
+}
+
+// Flush sends the counters accumulated since the last flush and the current gauges
+func (r *StatsDReporter) Flush() {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	series := make([]*statsDSeries, 0, len(r.series))
+	for _, s := range r.series {
+		snapshot := *s
+		series = append(series, &snapshot)
+		// 计数器按周期发送增量
+		s.requests, s.errors, s.latencySum, s.latencyCount = 0, 0, 0, 0
+	}
+	system := r.system
+	r.mutex.Unlock()
+
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].provider != series[j].provider {
+			return series[i].provider < series[j].provider
+		}
+		return series[i].model < series[j].model
+	})
+
+	for _, s := range series {
+		if s.requests == 0 {
+			continue
+		}
+		tags := []string{"env:" + r.env, "provider:" + s.provider, "model:" + s.model}
+		r.count("requests", s.requests, tags)
+		r.count("errors", s.errors, tags)
+		r.gauge("latency.avg_ms", float64(s.latencySum.Milliseconds())/float64(s.latencyCount), tags)
+		r.gauge("error_rate", float64(s.errors)/float64(s.requests), tags)
+	}
+
+	if metrics := system.GetMetrics(); metrics != nil {
+		tags := []string{"env:" + r.env}
+		r.gauge("goroutines", float64(metrics.GoroutineCount), tags)
+		r.gauge("memory_mb", metrics.MemoryUsage, tags)
+		r.gauge("system.error_rate", metrics.ErrorRate, tags)
+	}
+
+	if err := r.client.Flush(); err != nil {
+		logrus.WithError(err).Warn("Failed to flush StatsD metrics")
+	}
+}
+
+// Close flushes and closes the underlying client
+func (r *StatsDReporter) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.Flush()
+	return r.client.Close()
+}
+
+func (r *StatsDReporter) count(name string, value int64, tags []string) {
+	name, tags = r.formatName(name, tags)
+	if err := r.client.Count(name, value, tags, 1); err != nil {
+		logrus.WithError(err).WithField("metric", name).Debug("Failed to send StatsD count")
+	}
+}
+
+func (r *StatsDReporter) gauge(name string, value float64, tags []string) {
+	name, tags = r.formatName(name, tags)
+	if err := r.client.Gauge(name, value, tags, 1); err != nil {
+		logrus.WithError(err).WithField("metric", name).Debug("Failed to send StatsD gauge")
+	}
+}
+
+// formatName applies the namespace and, for plain StatsD, folds tags into the metric name
+func (r *StatsDReporter) formatName(name string, tags []string) (string, []string) {
+	name = statsDNamespace + name
+	if r.format == StatsDFormatDogStatsD {
+		return name, tags
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, tag := range tags {
+		key, value, _ := strings.Cut(tag, ":")
+		b.WriteString(",")
+		b.WriteString(sanitizeStatsDTag(key))
+		b.WriteString("=")
+		b.WriteString(sanitizeStatsDTag(value))
+	}
+	return b.String(), nil
+}
+
+// sanitizeStatsDTag replaces characters that are separators in the StatsD line protocol
+func sanitizeStatsDTag(s string) string {
+	return strings.NewReplacer(",", "_", "=", "_", ":", "_", "|", "_", " ", "_").Replace(s)
+}
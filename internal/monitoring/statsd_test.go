@@ -0,0 +1,92 @@
+package monitoring
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listenStatsD starts a UDP listener and returns its address and a function collecting received lines
+func listenStatsD(t *testing.T) (string, func() []string) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	collect := func() []string {
+		var lines []string
+		buf := make([]byte, 65536)
+		for {
+			conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return lines
+			}
+			for _, line := range strings.Split(strings.TrimSpace(string(buf[:n])), "\n") {
+				if line != "" {
+					lines = append(lines, line)
+				}
+			}
+		}
+	}
+	return conn.LocalAddr().String(), collect
+}
+
+func TestStatsDReporterDogStatsDFormat(t *testing.T) {
+	addr, collect := listenStatsD(t)
+
+	reporter, err := NewStatsDReporter(&config.StatsDConfig{Addr: addr, Format: StatsDFormatDogStatsD, Env: "test"})
+	require.NoError(t, err)
+	defer reporter.Close()
+
+	reporter.RecordRequest("alibaba-dashscope", "qwen-turbo", 200, 100*time.Millisecond)
+	reporter.RecordRequest("alibaba-dashscope", "qwen-turbo", 502, 300*time.Millisecond)
+	reporter.Flush()
+
+	lines := collect()
+	tags := "|#env:test,provider:alibaba-dashscope,model:qwen-turbo"
+	assert.Contains(t, lines, "aigateway.requests:2|c"+tags)
+	assert.Contains(t, lines, "aigateway.errors:1|c"+tags)
+	assert.Contains(t, lines, "aigateway.latency.avg_ms:200|g"+tags)
+	assert.Contains(t, lines, "aigateway.error_rate:0.5|g"+tags)
+}
+
+func TestStatsDReporterStatsDFormat(t *testing.T) {
+	addr, collect := listenStatsD(t)
+
+	reporter, err := NewStatsDReporter(&config.StatsDConfig{Addr: addr, Format: StatsDFormatStatsD, Env: "test"})
+	require.NoError(t, err)
+	defer reporter.Close()
+
+	reporter.RecordRequest("alibaba-dashscope", "qwen-max", 200, 50*time.Millisecond)
+	reporter.Flush()
+
+	lines := collect()
+	assert.Contains(t, lines, "aigateway.requests,env=test,provider=alibaba-dashscope,model=qwen-max:1|c")
+	assert.Contains(t, lines, "aigateway.latency.avg_ms,env=test,provider=alibaba-dashscope,model=qwen-max:50|g")
+	for _, line := range lines {
+		assert.NotContains(t, line, "|#", "plain StatsD output must not carry DogStatsD tags")
+	}
+
+	// Counters are sent as deltas, so an idle interval emits nothing
+	reporter.Flush()
+	assert.Empty(t, collect())
+}
+
+func TestStatsDReporterDisabled(t *testing.T) {
+	reporter, err := NewStatsDReporter(&config.StatsDConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, reporter)
+
+	// A nil reporter is safe to use
+	reporter.RecordRequest("p", "m", 200, time.Millisecond)
+	reporter.Flush()
+
+	_, err = NewStatsDReporter(&config.StatsDConfig{Addr: "127.0.0.1:8125", Format: "graphite"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,328 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Redis keys shared by all replicas
+const (
+	streamSeqKey     = "monitoring:stream:seq"
+	streamEventsKey  = "monitoring:stream:events"
+	streamChannelKey = "monitoring:stream"
+)
+
+// Stream event types
+const (
+	StreamEventMetrics       = "metrics"
+	StreamEventAlert         = "alert"
+	StreamEventAlertResolved = "alert_resolved"
+	// StreamEventResync tells a resuming client that its position aged out and it must reload state
+	StreamEventResync = "resync"
+)
+
+// subscriberBuffer bounds the events queued for one client; slower clients are dropped and resume
+const subscriberBuffer = 256
+
+// StreamEvent 监控实时流中的一条事件，ID在所有副本间单调递增
+type StreamEvent struct {
+	ID   int64           `json:"id"`
+	Type string          `json:"type"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// StreamSubscriber receives events for one connected client. C is closed when
+// the subscriber is dropped for falling behind or the hub stops.
+type StreamSubscriber struct {
+	C <-chan StreamEvent
+
+	ch    chan StreamEvent
+	floor int64         // events at or below this ID were seen or replayed and are skipped
+	held  []StreamEvent // live events received while the backlog is read
+	done  bool
+}
+
+// StreamHub 可断点续传的监控事件流：事件写入Redis环形缓冲区并通过pub/sub扇出到各副本的客户端。
+// Resuming clients are batched so a reconnect storm costs one Redis read per batch.
+type StreamHub struct {
+	client *redis.Client
+	cfg    config.MonitoringStreamConfig
+	now    func() time.Time
+
+	mu          sync.Mutex
+	subscribers map[*StreamSubscriber]struct{}
+	pending     []*StreamSubscriber
+	flushing    bool
+
+	backlogReads atomic.Int64
+}
+
+// NewStreamHub creates a hub; Run must be started to deliver live events
+func NewStreamHub(client *redis.Client, cfg config.MonitoringStreamConfig) *StreamHub {
+	return &StreamHub{
+		client:      client,
+		cfg:         cfg,
+		now:         time.Now,
+		subscribers: make(map[*StreamSubscriber]struct{}),
+	}
+}
+
+// Publish assigns the next sequence ID, appends the event to the ring buffer
+// and broadcasts it to every replica
+func (h *StreamHub) Publish(ctx context.Context, eventType string, payload interface{}) (StreamEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return StreamEvent{}, err
+	}
+	id, err := h.client.Incr(ctx, streamSeqKey).Result()
+	if err != nil {
+		return StreamEvent{}, err
+	}
+
+	event := StreamEvent{ID: id, Type: eventType, Time: h.now(), Data: data}
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return StreamEvent{}, err
+	}
+
+	pipe := h.client.TxPipeline()
+	pipe.ZAdd(ctx, streamEventsKey, redis.Z{Score: float64(id), Member: encoded})
+	pipe.ZRemRangeByRank(ctx, streamEventsKey, 0, int64(-h.cfg.BufferSize-1))
+	pipe.Expire(ctx, streamEventsKey, h.cfg.Retention)
+	pipe.Publish(ctx, streamChannelKey, encoded)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return StreamEvent{}, err
+	}
+	return event, nil
+}
+
+// Run fans out events published by any replica until ctx is cancelled
+func (h *StreamHub) Run(ctx context.Context) {
+	pubsub := h.client.Subscribe(ctx, streamChannelKey)
+	defer pubsub.Close()
+
+	// Wait for the subscription so no event published after Run returns control is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		if ctx.Err() == nil {
+			logrus.WithError(err).Error("Failed to subscribe to the monitoring stream")
+		}
+		return
+	}
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			h.closeAll()
+			return
+		case msg, ok := <-messages:
+			if !ok {
+				h.closeAll()
+				return
+			}
+			var event StreamEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				logrus.WithError(err).Warn("Dropping malformed monitoring stream event")
+				continue
+			}
+			h.dispatch(event)
+		}
+	}
+}
+
+// Subscribe registers a client. lastID is the last event the client saw, from
+// Last-Event-ID or a resume token; 0 starts with live events only.
+func (h *StreamHub) Subscribe(lastID int64) *StreamSubscriber {
+	ch := make(chan StreamEvent, subscriberBuffer)
+	sub := &StreamSubscriber{C: ch, ch: ch, floor: lastID}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if lastID <= 0 {
+		h.subscribers[sub] = struct{}{}
+		return sub
+	}
+
+	h.pending = append(h.pending, sub)
+	if !h.flushing {
+		h.flushing = true
+		time.AfterFunc(h.cfg.ResumeBatch, h.flushPending)
+	}
+	return sub
+}
+
+// Unsubscribe removes a client and closes its channel
+func (h *StreamHub) Unsubscribe(sub *StreamSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.subscribers, sub)
+	for i, p := range h.pending {
+		if p == sub {
+			h.pending = append(h.pending[:i], h.pending[i+1:]...)
+			break
+		}
+	}
+	h.close(sub)
+}
+
+// flushPending replays the missed events to every client that asked to resume
+// since the last flush, using a single Redis read for the whole batch
+func (h *StreamHub) flushPending() {
+	h.mu.Lock()
+	batch := h.pending
+	h.pending = nil
+	h.flushing = false
+	h.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+
+	from := batch[0].floor
+	for _, sub := range batch[1:] {
+		if sub.floor < from {
+			from = sub.floor
+		}
+	}
+
+	backlog, latest, err := h.readBacklog(context.Background(), from)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to read the monitoring stream backlog")
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, sub := range batch {
+		if sub.done {
+			continue
+		}
+		if err != nil || missedEvents(sub.floor, backlog, latest) {
+			h.send(sub, StreamEvent{ID: latest, Type: StreamEventResync, Time: h.now()})
+			sub.floor = latest
+		}
+		for _, event := range backlog {
+			if h.send(sub, event) {
+				sub.floor = event.ID
+			}
+		}
+		for _, event := range sub.held {
+			h.send(sub, event)
+		}
+		sub.held = nil
+		if !sub.done {
+			h.subscribers[sub] = struct{}{}
+		}
+	}
+}
+
+// readBacklog returns the retained events after the given ID and the latest assigned ID
+func (h *StreamHub) readBacklog(ctx context.Context, after int64) ([]StreamEvent, int64, error) {
+	h.backlogReads.Add(1)
+
+	pipe := h.client.Pipeline()
+	seqCmd := pipe.Get(ctx, streamSeqKey)
+	eventsCmd := pipe.ZRangeByScore(ctx, streamEventsKey, &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(after, 10),
+		Max: "+inf",
+	})
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, 0, err
+	}
+
+	latest, err := seqCmd.Int64()
+	if err != nil && err != redis.Nil {
+		return nil, 0, err
+	}
+
+	cutoff := h.now().Add(-h.cfg.Retention)
+	events := make([]StreamEvent, 0, len(eventsCmd.Val()))
+	for _, raw := range eventsCmd.Val() {
+		var event StreamEvent
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			continue
+		}
+		if event.Time.Before(cutoff) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, latest, nil
+}
+
+// missedEvents reports whether events after last were assigned but are no longer retained
+func missedEvents(last int64, backlog []StreamEvent, latest int64) bool {
+	if last >= latest {
+		return false
+	}
+	for _, event := range backlog {
+		if event.ID > last {
+			return event.ID != last+1
+		}
+	}
+	return true
+}
+
+// dispatch delivers a live event to ready clients and holds it for resuming ones
+func (h *StreamHub) dispatch(event StreamEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		h.send(sub, event)
+	}
+	for _, sub := range h.pending {
+		sub.held = append(sub.held, event)
+	}
+}
+
+// send queues an event the client has not seen yet; callers hold h.mu. Live
+// events are not ordered across replicas, so only the replayed floor is skipped.
+func (h *StreamHub) send(sub *StreamSubscriber, event StreamEvent) bool {
+	if sub.done || (event.Type != StreamEventResync && event.ID <= sub.floor) {
+		return false
+	}
+	select {
+	case sub.ch <- event:
+		return true
+	default:
+		// A client this far behind reconnects and resumes from its last event
+		logrus.WithField("event_id", event.ID).Warn("Dropping slow monitoring stream client")
+		delete(h.subscribers, sub)
+		h.close(sub)
+		return false
+	}
+}
+
+func (h *StreamHub) close(sub *StreamSubscriber) {
+	if !sub.done {
+		sub.done = true
+		close(sub.ch)
+	}
+}
+
+func (h *StreamHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		h.close(sub)
+	}
+	for _, sub := range h.pending {
+		h.close(sub)
+	}
+	h.subscribers = make(map[*StreamSubscriber]struct{})
+	h.pending = nil
+}
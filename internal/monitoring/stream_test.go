@@ -0,0 +1,197 @@
+package monitoring
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testStreamConfig = config.MonitoringStreamConfig{
+	BufferSize:  100,
+	Retention:   5 * time.Minute,
+	ResumeBatch: 20 * time.Millisecond,
+}
+
+func newStreamRedis(t *testing.T) *redis.Client {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// runHub starts a hub and waits for its pub/sub subscription
+func runHub(t *testing.T, client *redis.Client, cfg config.MonitoringStreamConfig) *StreamHub {
+	hub := NewStreamHub(client, cfg)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go hub.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		counts, err := client.PubSubNumSub(context.Background(), streamChannelKey).Result()
+		return err == nil && counts[streamChannelKey] > 0
+	}, time.Second, 5*time.Millisecond)
+	return hub
+}
+
+func publishN(t *testing.T, hub *StreamHub, n int) {
+	for i := 0; i < n; i++ {
+		_, err := hub.Publish(context.Background(), StreamEventMetrics, map[string]int{"n": i})
+		require.NoError(t, err)
+	}
+}
+
+// receive reads n events from a subscriber
+func receive(t *testing.T, sub *StreamSubscriber, n int) []StreamEvent {
+	events := make([]StreamEvent, 0, n)
+	for len(events) < n {
+		select {
+		case event, ok := <-sub.C:
+			require.True(t, ok, "subscriber closed after %d events", len(events))
+			events = append(events, event)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("received %d of %d events", len(events), n)
+		}
+	}
+	return events
+}
+
+func eventIDs(events []StreamEvent) []int64 {
+	ids := make([]int64, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+func TestStreamResumeReplaysMissedEvents(t *testing.T) {
+	client := newStreamRedis(t)
+	hub := runHub(t, client, testStreamConfig)
+
+	publishN(t, hub, 5)
+	sub := hub.Subscribe(2)
+	defer hub.Unsubscribe(sub)
+
+	assert.Equal(t, []int64{3, 4, 5}, eventIDs(receive(t, sub, 3)))
+
+	// After the backlog the client continues with live events
+	publishN(t, hub, 1)
+	event := receive(t, sub, 1)[0]
+	assert.Equal(t, int64(6), event.ID)
+	assert.Equal(t, StreamEventMetrics, event.Type)
+	assert.JSONEq(t, `{"n":0}`, string(event.Data))
+}
+
+func TestStreamResumeAfterExpirySendsResync(t *testing.T) {
+	client := newStreamRedis(t)
+	cfg := testStreamConfig
+	cfg.BufferSize = 3
+	hub := runHub(t, client, cfg)
+
+	publishN(t, hub, 6)
+
+	// Events 2 and 3 were pushed out of the ring buffer
+	sub := hub.Subscribe(1)
+	defer hub.Unsubscribe(sub)
+	resync := receive(t, sub, 1)[0]
+	assert.Equal(t, StreamEventResync, resync.Type)
+	assert.Equal(t, int64(6), resync.ID)
+
+	publishN(t, hub, 1)
+	assert.Equal(t, int64(7), receive(t, sub, 1)[0].ID)
+
+	// Events older than the retention are not replayed even while still buffered
+	hub.now = func() time.Time { return time.Now().Add(10 * time.Minute) }
+	late := hub.Subscribe(6)
+	defer hub.Unsubscribe(late)
+	resync = receive(t, late, 1)[0]
+	assert.Equal(t, StreamEventResync, resync.Type)
+	assert.Equal(t, int64(7), resync.ID)
+
+	// A client that is up to date needs no replay
+	current := hub.Subscribe(7)
+	defer hub.Unsubscribe(current)
+	publishN(t, hub, 1)
+	assert.Equal(t, int64(8), receive(t, current, 1)[0].ID)
+}
+
+func TestStreamSequenceConsistentAcrossReplicas(t *testing.T) {
+	client := newStreamRedis(t)
+	replicaA := runHub(t, client, testStreamConfig)
+	replicaB := runHub(t, client, testStreamConfig)
+
+	subA := replicaA.Subscribe(0)
+	defer replicaA.Unsubscribe(subA)
+	subB := replicaB.Subscribe(0)
+	defer replicaB.Unsubscribe(subB)
+
+	var wg sync.WaitGroup
+	for _, hub := range []*StreamHub{replicaA, replicaB} {
+		wg.Add(1)
+		go func(hub *StreamHub) {
+			defer wg.Done()
+			publishN(t, hub, 20)
+		}(hub)
+	}
+	wg.Wait()
+
+	want := make([]int64, 40)
+	for i := range want {
+		want[i] = int64(i + 1)
+	}
+	for _, sub := range []*StreamSubscriber{subA, subB} {
+		ids := eventIDs(receive(t, sub, 40))
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		assert.Equal(t, want, ids)
+	}
+
+	// A client resuming on the other replica continues from the shared sequence
+	resumed := replicaB.Subscribe(35)
+	defer replicaB.Unsubscribe(resumed)
+	assert.Equal(t, []int64{36, 37, 38, 39, 40}, eventIDs(receive(t, resumed, 5)))
+}
+
+func TestStreamResumeStormSharesBacklogRead(t *testing.T) {
+	client := newStreamRedis(t)
+	hub := runHub(t, client, testStreamConfig)
+	publishN(t, hub, 10)
+
+	subs := make([]*StreamSubscriber, 50)
+	for i := range subs {
+		subs[i] = hub.Subscribe(int64(i%9 + 1))
+		defer hub.Unsubscribe(subs[i])
+	}
+
+	for i, sub := range subs {
+		from := int64(i%9 + 1)
+		events := receive(t, sub, int(10-from))
+		assert.Equal(t, from+1, events[0].ID)
+		assert.Equal(t, int64(10), events[len(events)-1].ID)
+	}
+	assert.Equal(t, int64(1), hub.backlogReads.Load())
+}
+
+func TestStreamDropsSlowSubscriber(t *testing.T) {
+	client := newStreamRedis(t)
+	hub := runHub(t, client, testStreamConfig)
+
+	sub := hub.Subscribe(0)
+	publishN(t, hub, subscriberBuffer+1)
+
+	assert.Eventually(t, func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return sub.done
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Len(t, receive(t, sub, subscriberBuffer), subscriberBuffer)
+	_, ok := <-sub.C
+	assert.False(t, ok)
+}
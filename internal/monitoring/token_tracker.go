@@ -0,0 +1,175 @@
+package monitoring
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenKeyPrefix 按天的令牌计数：usage:<YYYY-MM-DD> 是当天各密钥哈希按总令牌数排序的
+// 有序集合，usage:<YYYY-MM-DD>:<api_key_hash> 是某个密钥当天的 prompt/completion/total 计数
+const (
+	tokenKeyPrefix = "usage:"
+	tokenDayLayout = "2006-01-02"
+)
+
+// tokenQueryTimeout bounds the Redis reads of GetTopConsumers
+const tokenQueryTimeout = 5 * time.Second
+
+// DailyTokens 某个密钥一天（UTC）消耗的令牌数
+type DailyTokens struct {
+	Date             string `json:"date"` // YYYY-MM-DD
+	PromptTokens     int64  `json:"prompt_tokens"`
+	CompletionTokens int64  `json:"completion_tokens"`
+	TotalTokens      int64  `json:"total_tokens"`
+}
+
+// UsageStat 一个密钥在统计窗口内消耗的令牌总数
+type UsageStat struct {
+	APIKeyHash  string `json:"api_key_hash"`
+	TotalTokens int64  `json:"total_tokens"`
+}
+
+// TokenTracker counts the tokens of every API key, managed or configured, in
+// Redis sorted sets keyed by the SHA-256 of the key, so billing can be
+// aggregated per key and day and the heaviest consumers ranked
+type TokenTracker struct {
+	client *redis.Client
+	now    func() time.Time
+}
+
+// NewTokenTracker creates a token tracker on client
+func NewTokenTracker(client *redis.Client) *TokenTracker {
+	return &TokenTracker{client: client, now: time.Now}
+}
+
+// HashAPIKey returns the hex SHA-256 identifying an API key in the token counters
+func HashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+func tokenRankingKey(day time.Time) string {
+	return tokenKeyPrefix + day.UTC().Format(tokenDayLayout)
+}
+
+func tokenKey(keyHash string, day time.Time) string {
+	return tokenRankingKey(day) + ":" + keyHash
+}
+
+// Record adds the usage of one response to today's counters of apiKey
+func (t *TokenTracker) Record(ctx context.Context, apiKey string, usage TokenUsage) error {
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if usage.TotalTokens == 0 {
+		return nil
+	}
+	keyHash := HashAPIKey(apiKey)
+	now := t.now()
+	key, ranking := tokenKey(keyHash, now), tokenRankingKey(now)
+
+	_, err := t.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZIncrBy(ctx, key, float64(usage.PromptTokens), usageFieldPromptTokens)
+		pipe.ZIncrBy(ctx, key, float64(usage.CompletionTokens), usageFieldCompletionTokens)
+		pipe.ZIncrBy(ctx, key, float64(usage.TotalTokens), usageFieldTotalTokens)
+		pipe.Expire(ctx, key, UsageRetention)
+		pipe.ZIncrBy(ctx, ranking, float64(usage.TotalTokens), keyHash)
+		pipe.Expire(ctx, ranking, UsageRetention)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record token usage: %w", err)
+	}
+	return nil
+}
+
+// DailySeries returns the tokens of the key with the given hash for every day
+// from..to inclusive, days without usage included as zero
+func (t *TokenTracker) DailySeries(ctx context.Context, keyHash string, from, to time.Time) ([]DailyTokens, error) {
+	days, err := usageDays(from, to)
+	if err != nil {
+		return nil, err
+	}
+	cmds := make([]*redis.ZSliceCmd, len(days))
+	_, err = t.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, day := range days {
+			cmds[i] = pipe.ZRangeWithScores(ctx, tokenKey(keyHash, day), 0, -1)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token usage: %w", err)
+	}
+
+	series := make([]DailyTokens, len(days))
+	for i, cmd := range cmds {
+		series[i].Date = days[i].Format(tokenDayLayout)
+		for _, z := range cmd.Val() {
+			value := int64(z.Score)
+			switch z.Member {
+			case usageFieldPromptTokens:
+				series[i].PromptTokens = value
+			case usageFieldCompletionTokens:
+				series[i].CompletionTokens = value
+			case usageFieldTotalTokens:
+				series[i].TotalTokens = value
+			}
+		}
+	}
+	return series, nil
+}
+
+// GetTopConsumers returns the n keys that consumed the most tokens over the
+// days the window reaches back to, today included, heaviest first
+func (t *TokenTracker) GetTopConsumers(n int, window time.Duration) ([]UsageStat, error) {
+	if n <= 0 {
+		return []UsageStat{}, nil
+	}
+	now := t.now()
+	days, err := usageDays(now.Add(-window), now)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tokenQueryTimeout)
+	defer cancel()
+	cmds := make([]*redis.ZSliceCmd, len(days))
+	_, err = t.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, day := range days {
+			cmds[i] = pipe.ZRangeWithScores(ctx, tokenRankingKey(day), 0, -1)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token rankings: %w", err)
+	}
+
+	totals := make(map[string]int64)
+	for _, cmd := range cmds {
+		for _, z := range cmd.Val() {
+			if keyHash, ok := z.Member.(string); ok {
+				totals[keyHash] += int64(z.Score)
+			}
+		}
+	}
+	stats := make([]UsageStat, 0, len(totals))
+	for keyHash, total := range totals {
+		stats = append(stats, UsageStat{APIKeyHash: keyHash, TotalTokens: total})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].TotalTokens != stats[j].TotalTokens {
+			return stats[i].TotalTokens > stats[j].TotalTokens
+		}
+		return stats[i].APIKeyHash < stats[j].APIKeyHash
+	})
+	if len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats, nil
+}
@@ -0,0 +1,79 @@
+package monitoring
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenTrackerDailySeries(t *testing.T) {
+	mr := miniredis.RunT(t)
+	tracker := NewTokenTracker(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	day1 := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	tracker.now = func() time.Time { return day1 }
+	require.NoError(t, tracker.Record(ctx, "sk-a", TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}))
+	require.NoError(t, tracker.Record(ctx, "sk-a", TokenUsage{PromptTokens: 3, CompletionTokens: 2}))
+	tracker.now = func() time.Time { return day1.AddDate(0, 0, 2) }
+	require.NoError(t, tracker.Record(ctx, "sk-a", TokenUsage{TotalTokens: 7}))
+	require.NoError(t, tracker.Record(ctx, "sk-a", TokenUsage{}), "responses without tokens are not counted")
+
+	hash := HashAPIKey("sk-a")
+	key := "usage:2024-03-01:" + hash
+	score, err := mr.ZScore(key, "total_tokens")
+	require.NoError(t, err)
+	assert.Equal(t, float64(20), score, "total tokens default to prompt plus completion")
+	assert.Equal(t, UsageRetention, mr.TTL(key))
+	assert.False(t, mr.Exists("usage:2024-03-02:"+hash))
+
+	series, err := tracker.DailySeries(ctx, hash, day1, day1.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	assert.Equal(t, []DailyTokens{
+		{Date: "2024-03-01", PromptTokens: 13, CompletionTokens: 7, TotalTokens: 20},
+		{Date: "2024-03-02"},
+		{Date: "2024-03-03", TotalTokens: 7},
+	}, series, "days without usage are zero")
+
+	_, err = tracker.DailySeries(ctx, hash, day1, day1.AddDate(0, 0, -1))
+	assert.ErrorIs(t, err, ErrInvalidUsageRange)
+}
+
+func TestTokenTrackerTopConsumers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	tracker := NewTokenTracker(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	record := func(at time.Time, apiKey string, tokens int64) {
+		tracker.now = func() time.Time { return at }
+		require.NoError(t, tracker.Record(ctx, apiKey, TokenUsage{TotalTokens: tokens}))
+	}
+	record(now.AddDate(0, 0, -5), "sk-old", 1000)
+	record(now.AddDate(0, 0, -1), "sk-a", 30)
+	record(now, "sk-a", 20)
+	record(now, "sk-b", 40)
+	record(now, "sk-c", 10)
+	tracker.now = func() time.Time { return now }
+
+	top, err := tracker.GetTopConsumers(2, 24*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []UsageStat{
+		{APIKeyHash: HashAPIKey("sk-a"), TotalTokens: 50},
+		{APIKeyHash: HashAPIKey("sk-b"), TotalTokens: 40},
+	}, top, "usage is summed over the days of the window")
+
+	top, err = tracker.GetTopConsumers(10, 7*24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, top, 4)
+	assert.Equal(t, HashAPIKey("sk-old"), top[0].APIKeyHash)
+
+	top, err = tracker.GetTopConsumers(0, time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, top)
+}
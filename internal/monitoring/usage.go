@@ -0,0 +1,416 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/storage"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// usageKeyPrefix 每个API密钥每天一个哈希：usage:<key_id>:<yyyymmdd>
+	usageKeyPrefix = "usage:"
+	// usageIndexPrefix 每天有用量的密钥ID集合：usage:keys:<yyyymmdd>
+	usageIndexPrefix = "usage:keys:"
+	// usageModelField prefixes the per-model fields of a daily hash: model:<model>:<counter>
+	usageModelField = "model:"
+
+	usageDayLayout = "20060102"
+)
+
+// UsageRetention is how long daily usage is kept
+const UsageRetention = 400 * 24 * time.Hour
+
+// MaxUsageRangeDays caps the days one usage query reads
+const MaxUsageRangeDays = 366
+
+// ErrInvalidUsageRange is returned for usage queries whose range is reversed or too long
+var ErrInvalidUsageRange = errors.New("invalid usage range")
+
+// Counters of a daily usage hash
+const (
+	usageFieldRequests         = "requests"
+	usageFieldPromptTokens     = "prompt_tokens"
+	usageFieldCompletionTokens = "completion_tokens"
+	usageFieldTotalTokens      = "total_tokens"
+)
+
+// TokenUsage 一次响应的usage块
+type TokenUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// UsageCounts 一段时间内累计的请求数和令牌数
+type UsageCounts struct {
+	Requests         int64 `json:"requests"`
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+func (u *UsageCounts) add(other UsageCounts) {
+	u.Requests += other.Requests
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+func (u *UsageCounts) set(counter string, value int64) {
+	switch counter {
+	case usageFieldRequests:
+		u.Requests = value
+	case usageFieldPromptTokens:
+		u.PromptTokens = value
+	case usageFieldCompletionTokens:
+		u.CompletionTokens = value
+	case usageFieldTotalTokens:
+		u.TotalTokens = value
+	}
+}
+
+// DailyUsage 某个密钥一天（UTC）的用量及按模型的拆分
+type DailyUsage struct {
+	Date   string                 `json:"date"` // YYYY-MM-DD
+	Totals UsageCounts            `json:"totals"`
+	Models map[string]UsageCounts `json:"models"`
+}
+
+// KeyUsage 某个密钥在查询范围内的用量
+type KeyUsage struct {
+	KeyID  string                 `json:"key_id"`
+	Totals UsageCounts            `json:"totals"`
+	Models map[string]UsageCounts `json:"models"`
+	Days   []DailyUsage           `json:"days"`
+}
+
+// UsageTracker counts the tokens each API key consumes per day and model in
+// Redis, so that every replica adds to and reports the same totals. Without
+// Redis, e.g. with the embedded storage backend, the daily usage of each key
+// is one record of the persistent store.
+type UsageTracker struct {
+	client    *redis.Client
+	store     storage.Store // used when client is nil
+	mutex     sync.Mutex    // serialises updates of store records
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewUsageTracker creates a usage tracker on client
+func NewUsageTracker(client *redis.Client) *UsageTracker {
+	return &UsageTracker{client: client, now: time.Now}
+}
+
+// NewStoreUsageTracker creates a usage tracker keeping daily usage in store
+func NewStoreUsageTracker(store storage.Store) *UsageTracker {
+	return &UsageTracker{store: store, now: time.Now}
+}
+
+func usageKey(keyID string, day time.Time) string {
+	return usageKeyPrefix + keyID + ":" + day.UTC().Format(usageDayLayout)
+}
+
+// usageRecordKey names a key's daily record in the store: <yyyymmdd>:<key_id>
+func usageRecordKey(keyID string, day time.Time) string {
+	return day.UTC().Format(usageDayLayout) + ":" + keyID
+}
+
+// Record adds the usage of one response to the key's counters for today
+func (t *UsageTracker) Record(ctx context.Context, keyID, model string, usage TokenUsage) error {
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	if model == "" {
+		model = "unknown"
+	}
+	now := t.now()
+	if t.client == nil {
+		return t.recordInStore(ctx, keyID, model, usage, now)
+	}
+	key := usageKey(keyID, now)
+	index := usageIndexPrefix + now.UTC().Format(usageDayLayout)
+
+	_, err := t.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, prefix := range []string{"", usageModelField + model + ":"} {
+			pipe.HIncrBy(ctx, key, prefix+usageFieldRequests, 1)
+			pipe.HIncrBy(ctx, key, prefix+usageFieldPromptTokens, usage.PromptTokens)
+			pipe.HIncrBy(ctx, key, prefix+usageFieldCompletionTokens, usage.CompletionTokens)
+			pipe.HIncrBy(ctx, key, prefix+usageFieldTotalTokens, usage.TotalTokens)
+		}
+		pipe.Expire(ctx, key, UsageRetention)
+		pipe.SAdd(ctx, index, keyID)
+		pipe.Expire(ctx, index, UsageRetention)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record usage of key %s: %w", keyID, err)
+	}
+	return nil
+}
+
+// usageDays returns the UTC days from..to inclusive
+func usageDays(from, to time.Time) ([]time.Time, error) {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: to is before from", ErrInvalidUsageRange)
+	}
+	var days []time.Time
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		if len(days) == MaxUsageRangeDays {
+			return nil, fmt.Errorf("%w: more than %d days", ErrInvalidUsageRange, MaxUsageRangeDays)
+		}
+		days = append(days, day)
+	}
+	return days, nil
+}
+
+// KeyUsage returns the daily usage of one key between from and to inclusive;
+// days without usage are omitted
+func (t *UsageTracker) KeyUsage(ctx context.Context, keyID string, from, to time.Time) (*KeyUsage, error) {
+	days, err := usageDays(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var dailies []DailyUsage
+	if t.client == nil {
+		dailies, err = t.storedKeyUsage(ctx, keyID, days)
+	} else {
+		dailies, err = t.redisKeyUsage(ctx, keyID, days)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage of key %s: %w", keyID, err)
+	}
+
+	result := &KeyUsage{KeyID: keyID, Models: make(map[string]UsageCounts), Days: []DailyUsage{}}
+	for _, daily := range dailies {
+		result.Totals.add(daily.Totals)
+		for model, counts := range daily.Models {
+			total := result.Models[model]
+			total.add(counts)
+			result.Models[model] = total
+		}
+		result.Days = append(result.Days, daily)
+	}
+	return result, nil
+}
+
+// redisKeyUsage reads the daily hashes of a key
+func (t *UsageTracker) redisKeyUsage(ctx context.Context, keyID string, days []time.Time) ([]DailyUsage, error) {
+	cmds := make([]*redis.MapStringStringCmd, len(days))
+	_, err := t.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, day := range days {
+			cmds[i] = pipe.HGetAll(ctx, usageKey(keyID, day))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var dailies []DailyUsage
+	for i, cmd := range cmds {
+		if len(cmd.Val()) > 0 {
+			dailies = append(dailies, parseDailyUsage(days[i], cmd.Val()))
+		}
+	}
+	return dailies, nil
+}
+
+// AllUsage returns the usage of every key with usage between from and to
+// inclusive, ordered by key ID
+func (t *UsageTracker) AllUsage(ctx context.Context, from, to time.Time) ([]*KeyUsage, error) {
+	days, err := usageDays(from, to)
+	if err != nil {
+		return nil, err
+	}
+	var keyIDs []string
+	if t.client == nil {
+		keyIDs, err = t.storedKeyIDs(ctx, days)
+	} else {
+		keyIDs, err = t.redisKeyIDs(ctx, days)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys with usage: %w", err)
+	}
+	sort.Strings(keyIDs)
+
+	usage := make([]*KeyUsage, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		keyUsage, err := t.KeyUsage(ctx, keyID, from, to)
+		if err != nil {
+			return nil, err
+		}
+		usage = append(usage, keyUsage)
+	}
+	return usage, nil
+}
+
+// redisKeyIDs returns the keys with usage on any of days
+func (t *UsageTracker) redisKeyIDs(ctx context.Context, days []time.Time) ([]string, error) {
+	cmds := make([]*redis.StringSliceCmd, len(days))
+	_, err := t.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, day := range days {
+			cmds[i] = pipe.SMembers(ctx, usageIndexPrefix+day.Format(usageDayLayout))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var keyIDs []string
+	for _, cmd := range cmds {
+		for _, keyID := range cmd.Val() {
+			if !seen[keyID] {
+				seen[keyID] = true
+				keyIDs = append(keyIDs, keyID)
+			}
+		}
+	}
+	return keyIDs, nil
+}
+
+// recordInStore adds usage to the key's record for the day of now
+func (t *UsageTracker) recordInStore(ctx context.Context, keyID, model string, usage TokenUsage, now time.Time) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.pruneStore(ctx, now)
+
+	daily, _, err := t.storedDay(ctx, keyID, now)
+	if err != nil {
+		return fmt.Errorf("failed to record usage of key %s: %w", keyID, err)
+	}
+	counts := UsageCounts{
+		Requests:         1,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+	daily.Totals.add(counts)
+	perModel := daily.Models[model]
+	perModel.add(counts)
+	daily.Models[model] = perModel
+
+	data, err := json.Marshal(daily)
+	if err != nil {
+		return fmt.Errorf("failed to encode usage of key %s: %w", keyID, err)
+	}
+	if err := t.store.Put(ctx, storage.BucketUsage, usageRecordKey(keyID, now), data); err != nil {
+		return fmt.Errorf("failed to record usage of key %s: %w", keyID, err)
+	}
+	return nil
+}
+
+// storedDay reads a key's record for day; a missing record is empty
+func (t *UsageTracker) storedDay(ctx context.Context, keyID string, day time.Time) (DailyUsage, bool, error) {
+	empty := DailyUsage{Date: day.UTC().Format("2006-01-02"), Models: make(map[string]UsageCounts)}
+	data, err := t.store.Get(ctx, storage.BucketUsage, usageRecordKey(keyID, day))
+	if errors.Is(err, storage.ErrNotFound) {
+		return empty, false, nil
+	}
+	if err != nil {
+		return empty, false, err
+	}
+	daily := empty
+	if err := json.Unmarshal(data, &daily); err != nil {
+		return empty, false, err
+	}
+	if daily.Models == nil {
+		daily.Models = make(map[string]UsageCounts)
+	}
+	return daily, true, nil
+}
+
+// storedKeyUsage reads the daily records of a key
+func (t *UsageTracker) storedKeyUsage(ctx context.Context, keyID string, days []time.Time) ([]DailyUsage, error) {
+	var dailies []DailyUsage
+	for _, day := range days {
+		daily, ok, err := t.storedDay(ctx, keyID, day)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			dailies = append(dailies, daily)
+		}
+	}
+	return dailies, nil
+}
+
+// storedKeyIDs returns the keys with a record on any of days
+func (t *UsageTracker) storedKeyIDs(ctx context.Context, days []time.Time) ([]string, error) {
+	records, err := t.store.List(ctx, storage.BucketUsage)
+	if err != nil {
+		return nil, err
+	}
+	inRange := make(map[string]bool, len(days))
+	for _, day := range days {
+		inRange[day.Format(usageDayLayout)] = true
+	}
+
+	seen := make(map[string]bool)
+	var keyIDs []string
+	for name := range records {
+		day, keyID, ok := strings.Cut(name, ":")
+		if ok && inRange[day] && !seen[keyID] {
+			seen[keyID] = true
+			keyIDs = append(keyIDs, keyID)
+		}
+	}
+	return keyIDs, nil
+}
+
+// pruneStore deletes records older than UsageRetention once a day; the caller
+// holds the mutex
+func (t *UsageTracker) pruneStore(ctx context.Context, now time.Time) {
+	if now.Sub(t.lastPrune) < 24*time.Hour {
+		return
+	}
+	records, err := t.store.List(ctx, storage.BucketUsage)
+	if err != nil {
+		return
+	}
+	t.lastPrune = now
+	cutoff := now.Add(-UsageRetention).UTC().Format(usageDayLayout)
+	for name := range records {
+		if day, _, _ := strings.Cut(name, ":"); day < cutoff {
+			t.store.Delete(ctx, storage.BucketUsage, name)
+		}
+	}
+}
+
+// parseDailyUsage decodes the counters of a daily usage hash
+func parseDailyUsage(day time.Time, fields map[string]string) DailyUsage {
+	daily := DailyUsage{Date: day.Format("2006-01-02"), Models: make(map[string]UsageCounts)}
+	for field, raw := range fields {
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			continue
+		}
+		rest, isModel := strings.CutPrefix(field, usageModelField)
+		if !isModel {
+			daily.Totals.set(field, value)
+			continue
+		}
+		// Model names may contain colons; the counter is the last segment
+		sep := strings.LastIndex(rest, ":")
+		if sep < 0 {
+			continue
+		}
+		counts := daily.Models[rest[:sep]]
+		counts.set(rest[sep+1:], value)
+		daily.Models[rest[:sep]] = counts
+	}
+	return daily
+}
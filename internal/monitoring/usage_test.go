@@ -0,0 +1,106 @@
+package monitoring
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/storage"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageTrackerRecordsPerKeyAndModel(t *testing.T) {
+	mr := miniredis.RunT(t)
+	tracker := NewUsageTracker(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	day1 := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+	ctx := context.Background()
+
+	tracker.now = func() time.Time { return day1 }
+	require.NoError(t, tracker.Record(ctx, "key-a", "qwen-turbo", TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}))
+	require.NoError(t, tracker.Record(ctx, "key-a", "qwen:plus", TokenUsage{PromptTokens: 3, CompletionTokens: 2}))
+	tracker.now = func() time.Time { return day2 }
+	require.NoError(t, tracker.Record(ctx, "key-a", "qwen-turbo", TokenUsage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2}))
+	require.NoError(t, tracker.Record(ctx, "key-b", "", TokenUsage{TotalTokens: 7}))
+
+	assert.Equal(t, "15", mr.HGet("usage:key-a:20240301", "model:qwen-turbo:total_tokens"))
+	assert.Equal(t, UsageRetention, mr.TTL("usage:key-a:20240301"))
+
+	usage, err := tracker.KeyUsage(ctx, "key-a", day1, day2)
+	require.NoError(t, err)
+	assert.Equal(t, UsageCounts{Requests: 3, PromptTokens: 14, CompletionTokens: 8, TotalTokens: 22}, usage.Totals)
+	assert.Equal(t, UsageCounts{Requests: 2, PromptTokens: 11, CompletionTokens: 6, TotalTokens: 17}, usage.Models["qwen-turbo"])
+	assert.Equal(t, UsageCounts{Requests: 1, PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}, usage.Models["qwen:plus"],
+		"total tokens default to prompt plus completion, and model names may contain colons")
+	require.Len(t, usage.Days, 2)
+	assert.Equal(t, "2024-03-01", usage.Days[0].Date)
+	assert.Equal(t, "2024-03-02", usage.Days[1].Date)
+
+	all, err := tracker.AllUsage(ctx, day1, day2)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "key-a", all[0].KeyID)
+	assert.Equal(t, "key-b", all[1].KeyID)
+	assert.Equal(t, int64(7), all[1].Models["unknown"].TotalTokens)
+
+	only, err := tracker.AllUsage(ctx, day1, day1)
+	require.NoError(t, err)
+	require.Len(t, only, 1, "keys without usage in the range are left out")
+}
+
+func TestStoreUsageTrackerRecordsPerKeyAndModel(t *testing.T) {
+	store, err := storage.OpenBoltStore(filepath.Join(t.TempDir(), "gateway.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	tracker := NewStoreUsageTracker(store)
+	day1 := time.Date(2024, 3, 1, 23, 0, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Hour)
+	ctx := context.Background()
+
+	tracker.now = func() time.Time { return day1 }
+	require.NoError(t, tracker.Record(ctx, "key-a", "qwen-turbo", TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}))
+	require.NoError(t, tracker.Record(ctx, "key-a", "qwen:plus", TokenUsage{PromptTokens: 3, CompletionTokens: 2}))
+	tracker.now = func() time.Time { return day2 }
+	require.NoError(t, tracker.Record(ctx, "key-a", "qwen-turbo", TokenUsage{PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2}))
+	require.NoError(t, tracker.Record(ctx, "key-b", "", TokenUsage{TotalTokens: 7}))
+
+	usage, err := NewStoreUsageTracker(store).KeyUsage(ctx, "key-a", day1, day2)
+	require.NoError(t, err, "usage survives the tracker")
+	assert.Equal(t, UsageCounts{Requests: 3, PromptTokens: 14, CompletionTokens: 8, TotalTokens: 22}, usage.Totals)
+	assert.Equal(t, UsageCounts{Requests: 2, PromptTokens: 11, CompletionTokens: 6, TotalTokens: 17}, usage.Models["qwen-turbo"])
+	assert.Equal(t, UsageCounts{Requests: 1, PromptTokens: 3, CompletionTokens: 2, TotalTokens: 5}, usage.Models["qwen:plus"])
+	require.Len(t, usage.Days, 2)
+	assert.Equal(t, "2024-03-01", usage.Days[0].Date)
+
+	all, err := tracker.AllUsage(ctx, day1, day2)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, "key-a", all[0].KeyID)
+	assert.Equal(t, int64(7), all[1].Models["unknown"].TotalTokens)
+	only, err := tracker.AllUsage(ctx, day1, day1)
+	require.NoError(t, err)
+	require.Len(t, only, 1, "keys without usage in the range are left out")
+
+	// Records older than the retention are pruned
+	tracker.now = func() time.Time { return day2.Add(UsageRetention + 48*time.Hour) }
+	require.NoError(t, tracker.Record(ctx, "key-c", "qwen-turbo", TokenUsage{TotalTokens: 1}))
+	records, err := store.List(ctx, storage.BucketUsage)
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+}
+
+func TestUsageTrackerRejectsInvalidRanges(t *testing.T) {
+	mr := miniredis.RunT(t)
+	tracker := NewUsageTracker(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	now := time.Now()
+
+	_, err := tracker.KeyUsage(context.Background(), "key-a", now, now.AddDate(0, 0, -1))
+	assert.ErrorIs(t, err, ErrInvalidUsageRange)
+	_, err = tracker.AllUsage(context.Background(), now.AddDate(0, 0, -MaxUsageRangeDays), now)
+	assert.ErrorIs(t, err, ErrInvalidUsageRange)
+}
@@ -0,0 +1,35 @@
+package performance
+
+import (
+	"context"
+)
+
+// CacheBackend 响应缓存的存储后端。内存中的 ResponseCache 只在本进程内有效，
+// RedisCacheBackend 让多个网关副本共享同一份缓存。出错时缓存中间件按未命中处理，
+// 请求照常转发到上游。
+type CacheBackend interface {
+	// Fetch returns the entry cached under key; a missing or expired entry is not an error
+	Fetch(ctx context.Context, key string) (*CacheEntry, bool, error)
+	// Store caches entry under key until its TTL expires
+	Store(ctx context.Context, key string, entry *CacheEntry) error
+	// Purge removes the entries whose request path starts with prefix, or all
+	// of them when prefix is empty, and returns how many were removed
+	Purge(ctx context.Context, prefix string) (int, error)
+}
+
+// Fetch implements CacheBackend
+func (rc *ResponseCache) Fetch(_ context.Context, key string) (*CacheEntry, bool, error) {
+	entry, ok := rc.Get(key)
+	return entry, ok, nil
+}
+
+// Store implements CacheBackend
+func (rc *ResponseCache) Store(_ context.Context, key string, entry *CacheEntry) error {
+	rc.Set(key, entry)
+	return nil
+}
+
+// Purge implements CacheBackend
+func (rc *ResponseCache) Purge(_ context.Context, prefix string) (int, error) {
+	return rc.Invalidate(prefix), nil
+}
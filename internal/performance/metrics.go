@@ -0,0 +1,86 @@
+package performance
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	requestsDesc = prometheus.NewDesc("aigateway_performance_requests_total",
+		"Total number of requests timed by the performance optimizer", nil, nil)
+	cacheLookupsDesc = prometheus.NewDesc("aigateway_performance_cache_lookups_total",
+		"Total number of response cache lookups by result", []string{"result"}, nil)
+	cacheEvictionsDesc = prometheus.NewDesc("aigateway_performance_cache_evictions_total",
+		"Total number of responses evicted from the full response cache", nil, nil)
+	cacheBackendErrorsDesc = prometheus.NewDesc("aigateway_performance_cache_backend_errors_total",
+		"Total number of response cache lookups and writes that failed in the cache backend", nil, nil)
+	compressedDesc = prometheus.NewDesc("aigateway_performance_compressed_responses_total",
+		"Total number of responses compressed by the performance optimizer", nil, nil)
+	circuitTripsDesc = prometheus.NewDesc("aigateway_performance_circuit_breaker_rejections_total",
+		"Total number of requests rejected by an open circuit breaker", nil, nil)
+	rateLimitedDesc = prometheus.NewDesc("aigateway_performance_rate_limit_hits_total",
+		"Total number of requests rejected by the adaptive rate limiter", nil, nil)
+	batchesDesc = prometheus.NewDesc("aigateway_performance_batches_processed_total",
+		"Total number of request batches processed", nil, nil)
+	goroutinesDesc = prometheus.NewDesc("aigateway_performance_goroutines",
+		"Goroutine count at the last resource check", nil, nil)
+)
+
+// metricsCollector exposes an optimizer's PerformanceMetrics at scrape time
+type metricsCollector struct {
+	metrics *PerformanceMetrics
+}
+
+// Describe sends the descriptors of the optimizer's metrics
+func (mc *metricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{requestsDesc, cacheLookupsDesc, cacheEvictionsDesc, cacheBackendErrorsDesc, compressedDesc, circuitTripsDesc, rateLimitedDesc, batchesDesc, goroutinesDesc} {
+		ch <- desc
+	}
+}
+
+// Collect reads the current counters
+func (mc *metricsCollector) Collect(ch chan<- prometheus.Metric) {
+	m := mc.metrics
+	m.mutex.RLock()
+	requests := m.RequestCount
+	goroutines := m.GoroutineCount
+	m.mutex.RUnlock()
+
+	counter := func(desc *prometheus.Desc, value *int64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(atomic.LoadInt64(value)), labels...)
+	}
+	ch <- prometheus.MustNewConstMetric(requestsDesc, prometheus.CounterValue, float64(requests))
+	counter(cacheLookupsDesc, &m.CacheHits, "hit")
+	counter(cacheLookupsDesc, &m.CacheMisses, "miss")
+	counter(cacheEvictionsDesc, &m.CacheEvictions)
+	counter(cacheBackendErrorsDesc, &m.CacheBackendErrors)
+	counter(compressedDesc, &m.CompressionUse)
+	counter(circuitTripsDesc, &m.CircuitBreakerTrips)
+	counter(rateLimitedDesc, &m.RateLimitHits)
+	counter(batchesDesc, &m.BatchProcessed)
+	ch <- prometheus.MustNewConstMetric(goroutinesDesc, prometheus.GaugeValue, float64(goroutines))
+}
+
+// registerMetrics registers the optimizer's metrics with reg. Only one
+// optimizer is exported per registry: a newer one replaces the previous, so
+// rebuilding the optimizer after Close never fails on duplicate registration.
+func (po *PerformanceOptimizer) registerMetrics(reg prometheus.Registerer) {
+	if reg == nil {
+		return
+	}
+	collector := &metricsCollector{metrics: po.metrics}
+	if err := reg.Register(collector); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if !errors.As(err, &registered) {
+			po.logger.WithError(err).Warn("Failed to register performance metrics")
+			return
+		}
+		reg.Unregister(registered.ExistingCollector)
+		if err := reg.Register(collector); err != nil {
+			po.logger.WithError(err).Warn("Failed to register performance metrics")
+			return
+		}
+	}
+}
@@ -3,10 +3,17 @@ package performance
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"go-aigateway/internal/config"
-	"io"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/lifecycle"
+	"go-aigateway/internal/logging"
+	"go-aigateway/internal/resources"
+	"go-aigateway/internal/upstream"
+	"math/rand"
 	"net/http"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -14,23 +21,31 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
 
 // PerformanceOptimizer provides comprehensive performance enhancements
 type PerformanceOptimizer struct {
 	config          *config.Config
+	lifecycle       lifecycle.Guard
+	stopMonitor     context.CancelFunc
 	logger          *logrus.Logger
-	cachePool       sync.Pool
 	gzipPool        sync.Pool
 	bufferPool      sync.Pool
 	metrics         *PerformanceMetrics
 	rateLimiter     *AdaptiveRateLimiter
 	loadBalancer    *LoadBalancer
-	circuitBreakers map[string]*CircuitBreaker
+	circuitBreakers map[string]breaker
+	breakerMutex    sync.RWMutex
+	redis           *redis.Client // shares circuit breaker state across replicas when set; guarded by breakerMutex
 	connectionPool  *ConnectionPool
-	cache           map[string]*CacheEntry
-	cacheMutex      sync.RWMutex
+	cache           *ResponseCache
+	cacheOnce       sync.Once
+	backend         CacheBackend // replaces the in-memory cache when set
+	backendMutex    sync.RWMutex
+	cpu             *resources.CPUSampler // process CPU usage for the adaptive rate limit
 }
 
 // PerformanceMetrics tracks comprehensive performance data
@@ -40,6 +55,8 @@ type PerformanceMetrics struct {
 	AverageResponseTime time.Duration
 	CacheHits           int64
 	CacheMisses         int64
+	CacheEvictions      int64
+	CacheBackendErrors  int64
 	CompressionUse      int64
 	ConnectionPoolHits  int64
 	ConnectionPoolMiss  int64
@@ -69,10 +86,13 @@ type RequestWindow struct {
 	lastReset time.Time
 }
 
-// LoadBalancer implements weighted round-robin load balancing
+// latencyEWMAAlpha weights the newest latency sample in Backend.LatencyEWMA
+const latencyEWMAAlpha = 0.1
+
+// LoadBalancer picks backends by the power of two choices: of two random
+// active backends the one with the lower latency average wins
 type LoadBalancer struct {
 	backends []Backend
-	current  int64
 	mutex    sync.RWMutex
 }
 
@@ -83,6 +103,7 @@ type Backend struct {
 	HealthScore float64
 	Active      bool
 	LastCheck   time.Time
+	LatencyEWMA time.Duration // exponentially weighted moving average of proxied request latency
 }
 
 // CircuitBreaker implements circuit breaker pattern for fault tolerance
@@ -90,7 +111,7 @@ type CircuitBreaker struct {
 	failureThreshold int
 	resetTimeout     time.Duration
 	failureCount     int64
-	lastFailureTime  time.Time
+	lastFailure      int64 // unix nanoseconds
 	state            int32 // 0: Closed, 1: Open, 2: HalfOpen
 }
 
@@ -110,21 +131,23 @@ type CacheEntry struct {
 	Body        []byte
 	Timestamp   time.Time
 	TTL         time.Duration
+	Path        string // request path, matched by cache invalidation
 }
 
 // CacheResponseWriter wraps gin.ResponseWriter to capture response data
 type CacheResponseWriter struct {
 	gin.ResponseWriter
-	body   []byte
-	status int
+	body []byte
 }
 
-// NewPerformanceOptimizer creates a new performance optimizer with all features
-func NewPerformanceOptimizer(cfg *config.Config) *PerformanceOptimizer {
+// NewPerformanceOptimizer creates a new performance optimizer with all features.
+// Its metrics are registered with reg; a nil reg leaves them unexported.
+func NewPerformanceOptimizer(cfg *config.Config, reg prometheus.Registerer) *PerformanceOptimizer {
 	po := &PerformanceOptimizer{
 		config:  cfg,
-		logger:  logrus.New(),
+		logger:  logging.Default(),
 		metrics: &PerformanceMetrics{},
+		cpu:     resources.NewCPUSampler(),
 		rateLimiter: &AdaptiveRateLimiter{
 			baseLimit:    1000,
 			currentLimit: 1000,
@@ -136,23 +159,14 @@ func NewPerformanceOptimizer(cfg *config.Config) *PerformanceOptimizer {
 		loadBalancer: &LoadBalancer{
 			backends: make([]Backend, 0),
 		},
-		circuitBreakers: make(map[string]*CircuitBreaker),
+		circuitBreakers: make(map[string]breaker),
 		connectionPool: &ConnectionPool{
-			client: &http.Client{
-				Timeout: 30 * time.Second,
-				Transport: &http.Transport{
-					MaxIdleConns:        100,
-					MaxIdleConnsPerHost: 10,
-					IdleConnTimeout:     90 * time.Second,
-				},
-			},
+			client: httpclient.WrapClient("performance", &http.Client{
+				Timeout:   30 * time.Second,
+				Transport: pooledTransport(10),
+			}),
 			maxConns: 100,
 		},
-		cachePool: sync.Pool{
-			New: func() interface{} {
-				return make(map[string]*CacheEntry)
-			},
-		},
 		gzipPool: sync.Pool{
 			New: func() interface{} {
 				w, _ := gzip.NewWriterLevel(nil, gzip.BestSpeed)
@@ -165,18 +179,53 @@ func NewPerformanceOptimizer(cfg *config.Config) *PerformanceOptimizer {
 			},
 		},
 	}
-
-	// Start background performance monitoring
-	go po.performanceMonitor()
+	po.cache = NewResponseCache(cfg.ResponseCache.MaxEntries, int64(cfg.ResponseCache.MaxSizeMB)<<20, po.metrics)
+	po.registerMetrics(reg)
 
 	return po
 }
 
+// Start launches background performance monitoring; repeated calls are no-ops
+func (po *PerformanceOptimizer) Start(ctx context.Context) error {
+	return po.lifecycle.Start(func() error {
+		monitorCtx, cancel := context.WithCancel(context.Background())
+		po.stopMonitor = cancel
+		go po.performanceMonitor(monitorCtx)
+		return nil
+	})
+}
+
+// SetRedisClient makes circuit breakers created afterwards keep their state in
+// Redis; without a client they are in-memory only
+func (po *PerformanceOptimizer) SetRedisClient(client *redis.Client) {
+	po.breakerMutex.Lock()
+	po.redis = client
+	po.breakerMutex.Unlock()
+}
+
+func (po *PerformanceOptimizer) redisClient() *redis.Client {
+	po.breakerMutex.RLock()
+	defer po.breakerMutex.RUnlock()
+	return po.redis
+}
+
+// State reports the lifecycle state of the optimizer
+func (po *PerformanceOptimizer) State() lifecycle.State {
+	return po.lifecycle.State()
+}
+
+// Close stops background monitoring; it is safe to call more than once
+func (po *PerformanceOptimizer) Close() error {
+	return po.lifecycle.Close(func() error {
+		if po.stopMonitor != nil {
+			po.stopMonitor()
+		}
+		return nil
+	})
+}
+
 // IntelligentCachingMiddleware implements advanced response caching
 func (po *PerformanceOptimizer) IntelligentCachingMiddleware(cacheTTL time.Duration) gin.HandlerFunc {
-	cache := po.cachePool.Get().(map[string]*CacheEntry)
-	var mu sync.RWMutex
-
 	return func(c *gin.Context) {
 		// Only cache GET requests for specific endpoints
 		if c.Request.Method != "GET" || !po.shouldCache(c.Request.URL.Path) {
@@ -186,14 +235,9 @@ func (po *PerformanceOptimizer) IntelligentCachingMiddleware(cacheTTL time.Durat
 
 		cacheKey := po.generateAdvancedCacheKey(c)
 
-		// Check cache with thread safety
-		mu.RLock()
-		entry, exists := cache[cacheKey]
-		mu.RUnlock()
-
-		if exists && time.Since(entry.Timestamp) < entry.TTL {
+		cache := po.cacheBackend()
+		if entry, ok := po.fetchCached(c.Request.Context(), cache, cacheKey); ok {
 			// Cache hit - serve from cache
-			atomic.AddInt64(&po.metrics.CacheHits, 1)
 			c.Header("X-Cache", "HIT")
 			c.Header("X-Cache-Age", strconv.Itoa(int(time.Since(entry.Timestamp).Seconds())))
 
@@ -203,11 +247,11 @@ func (po *PerformanceOptimizer) IntelligentCachingMiddleware(cacheTTL time.Durat
 			}
 
 			c.Data(entry.StatusCode, entry.ContentType, entry.Body)
+			c.Abort()
 			return
 		}
 
-		// Cache miss - record and process request
-		atomic.AddInt64(&po.metrics.CacheMisses, 1)
+		// Cache miss - process request
 		writer := &CacheResponseWriter{
 			ResponseWriter: c.Writer,
 			body:           make([]byte, 0),
@@ -216,24 +260,20 @@ func (po *PerformanceOptimizer) IntelligentCachingMiddleware(cacheTTL time.Durat
 
 		c.Next()
 
-		// Store successful responses in cache
-		if writer.status == http.StatusOK && len(writer.body) > 0 {
+		// Store successful responses in cache; mocked responses are never cached as real ones,
+		// and streams are not cached as a whole
+		if writer.Status() == http.StatusOK && len(writer.body) > 0 && writer.Header().Get("X-Gateway-Mocked") != "true" &&
+			!httpclient.IsEventStream(writer.Header()) {
 			entry := &CacheEntry{
-				StatusCode:  writer.status,
+				StatusCode:  writer.Status(),
 				ContentType: writer.Header().Get("Content-Type"),
 				Headers:     copyHeaders(writer.Header()),
 				Body:        writer.body,
 				Timestamp:   time.Now(),
-				TTL:         po.calculateDynamicTTL(c.Request.URL.Path, len(writer.body)),
-			}
-
-			mu.Lock()
-			cache[cacheKey] = entry
-			// Implement LRU eviction if cache is too large
-			if len(cache) > 1000 {
-				po.evictOldestEntries(cache, 100)
+				TTL:         JitteredTTL(po.calculateDynamicTTL(c.Request.URL.Path, len(writer.body)), cacheTTLJitter),
+				Path:        c.Request.URL.Path,
 			}
-			mu.Unlock()
+			po.storeCached(c.Request.Context(), cache, cacheKey, entry)
 		}
 	}
 }
@@ -271,6 +311,9 @@ func (po *PerformanceOptimizer) AdaptiveCompressionMiddleware() gin.HandlerFunc
 
 		c.Next()
 
+		if writer.passthrough {
+			return
+		}
 		gzipWriter.Close()
 		atomic.AddInt64(&po.metrics.CompressionUse, 1)
 	}
@@ -309,7 +352,9 @@ func (po *PerformanceOptimizer) LoadBalancingMiddleware() gin.HandlerFunc {
 
 		// Store selected backend for downstream use
 		c.Set("selected_backend", backend)
+		start := time.Now()
 		c.Next()
+		po.loadBalancer.recordLatency(backend.URL, time.Since(start))
 	}
 }
 
@@ -321,7 +366,7 @@ func (po *PerformanceOptimizer) CircuitBreakerMiddleware() gin.HandlerFunc {
 			serviceName = "default"
 		}
 
-		cb := po.getOrCreateCircuitBreaker(serviceName)
+		cb := po.getOrCreateCircuitBreaker(serviceName, po.redisClient())
 
 		if !cb.allowRequest() {
 			atomic.AddInt64(&po.metrics.CircuitBreakerTrips, 1)
@@ -366,23 +411,35 @@ func (po *PerformanceOptimizer) ConnectionPoolMiddleware() gin.HandlerFunc {
 }
 
 // Performance monitoring and optimization methods
-func (po *PerformanceOptimizer) performanceMonitor() {
+func (po *PerformanceOptimizer) performanceMonitor(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		po.updateSystemMetrics()
-		po.adjustRateLimits()
-		po.optimizeResourceUsage()
-		po.healthCheckBackends()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			po.updateSystemMetrics()
+			po.adjustRateLimits()
+			po.optimizeResourceUsage()
+			po.healthCheckBackends()
+		}
 	}
 }
 
 func (po *PerformanceOptimizer) updateSystemMetrics() {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
+	cpuUsage, cpuSampled, err := po.cpu.Sample(time.Now())
+	if err != nil {
+		po.logger.WithError(err).Debug("Failed to sample process CPU usage")
+	}
 
 	po.metrics.mutex.Lock()
+	if cpuSampled {
+		po.metrics.CPUUsage = cpuUsage
+	}
 	po.metrics.MemoryUsage = float64(m.Alloc) / 1024 / 1024 // MB
 	po.metrics.GoroutineCount = runtime.NumGoroutine()
 	po.metrics.mutex.Unlock()
@@ -469,34 +526,43 @@ func (po *PerformanceOptimizer) CompressionMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		po.recordCompressionUse()
-
 		// Get gzip writer from pool
 		gz := po.gzipPool.Get().(*gzip.Writer)
 		defer po.gzipPool.Put(gz)
 
 		gz.Reset(c.Writer)
-		defer gz.Close()
 
 		c.Header("Content-Encoding", "gzip")
 		c.Header("Vary", "Accept-Encoding")
-		c.Writer = &gzipResponseWriter{c.Writer, gz}
+		writer := &gzipResponseWriter{ResponseWriter: c.Writer, writer: gz}
+		c.Writer = writer
 
 		c.Next()
+
+		if writer.passthrough {
+			return
+		}
+		gz.Close()
+		po.recordCompressionUse()
 	}
 }
 
+// pooledTransport returns an egress-checked transport keeping up to perHost idle connections per host
+func pooledTransport(perHost int) *http.Transport {
+	t := httpclient.Transport("performance")
+	t.MaxIdleConns = 100
+	t.MaxIdleConnsPerHost = perHost
+	t.IdleConnTimeout = 90 * time.Second
+	return t
+}
+
 // ConnectionPoolingMiddleware optimizes HTTP client connections
 func (po *PerformanceOptimizer) ConnectionPoolingMiddleware() gin.HandlerFunc {
 	// Configure HTTP client with connection pooling
-	client := &http.Client{
-		Transport: &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 100,
-			IdleConnTimeout:     90 * time.Second,
-		},
-		Timeout: 30 * time.Second,
-	}
+	client := httpclient.WrapClient("performance", &http.Client{
+		Transport: pooledTransport(100),
+		Timeout:   30 * time.Second,
+	})
 
 	return func(c *gin.Context) {
 		c.Set("http_client", client)
@@ -568,16 +634,58 @@ func (w *CacheResponseWriter) Write(data []byte) (int, error) {
 	return w.ResponseWriter.Write(data)
 }
 
-// gzipResponseWriter wraps response writer with gzip compression
+// gzipResponseWriter wraps response writer with gzip compression. Event
+// streams are passed through uncompressed so every flushed chunk reaches the
+// client at once instead of waiting in the gzip buffer.
 type gzipResponseWriter struct {
 	gin.ResponseWriter
-	writer io.Writer
+	writer *gzip.Writer
+
+	decided     bool
+	passthrough bool
+}
+
+// decide picks compression or passthrough when the headers are sent; gin's
+// WriteHeader only records the status, before the content type may be set
+func (w *gzipResponseWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	if httpclient.IsEventStream(w.Header()) {
+		w.passthrough = true
+		w.Header().Del("Content-Encoding")
+		return
+	}
+	w.Header().Del("Content-Length")
+}
+
+func (w *gzipResponseWriter) WriteHeaderNow() {
+	w.decide()
+	w.ResponseWriter.WriteHeaderNow()
 }
 
 func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
 	return w.writer.Write(data)
 }
 
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush pushes compressed data written so far to the client
+func (w *gzipResponseWriter) Flush() {
+	w.decide()
+	if !w.passthrough {
+		w.writer.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
 // RequestBatch groups similar requests for batch processing
 type RequestBatch struct {
 	Requests []*gin.Context
@@ -642,45 +750,88 @@ func (po *PerformanceOptimizer) processBatch(batch *RequestBatch) {
 	atomic.AddInt64(&po.metrics.BatchProcessed, 1)
 }
 
-// evictOldestEntries removes old cache entries to maintain cache size limit
-func (po *PerformanceOptimizer) evictOldestEntries(cache map[string]*CacheEntry, maxEntries int) {
-	if len(cache) <= maxEntries {
-		return
+// getOrCreateCircuitBreaker gets or creates a circuit breaker for a service.
+// With a Redis client its state is shared by all replicas.
+func (po *PerformanceOptimizer) getOrCreateCircuitBreaker(serviceName string, client *redis.Client) breaker {
+	po.breakerMutex.RLock()
+	cb, exists := po.circuitBreakers[serviceName]
+	po.breakerMutex.RUnlock()
+	if exists {
+		return cb
 	}
 
-	// Simple LRU eviction based on timestamp
-	entriesToRemove := len(cache) - maxEntries
-	oldestEntries := make([]string, 0, entriesToRemove)
-	oldestTime := time.Now()
+	po.breakerMutex.Lock()
+	defer po.breakerMutex.Unlock()
+	// Another request may have created it while the lock was released
+	if cb, exists := po.circuitBreakers[serviceName]; exists {
+		return cb
+	}
 
-	for key, entry := range cache {
-		if entry.Timestamp.Before(oldestTime) || len(oldestEntries) < entriesToRemove {
-			oldestEntries = append(oldestEntries, key)
-			if len(oldestEntries) > entriesToRemove {
-				// Remove the newest from our removal list
-				oldestEntries = oldestEntries[:entriesToRemove]
-			}
+	const failureThreshold = 5
+	const resetTimeout = 30 * time.Second
+	if client != nil {
+		cb = NewRedisCircuitBreaker(client, serviceName, failureThreshold, resetTimeout)
+	} else {
+		cb = &CircuitBreaker{
+			failureThreshold: failureThreshold,
+			resetTimeout:     resetTimeout,
+			state:            circuitClosed,
 		}
 	}
+	po.circuitBreakers[serviceName] = cb
+	return cb
+}
+
+// CircuitBreakers returns the state of the circuit breaker of every service
+// that has received requests, ordered by service name
+func (po *PerformanceOptimizer) CircuitBreakers() []CircuitBreakerStatus {
+	po.breakerMutex.RLock()
+	breakers := make(map[string]breaker, len(po.circuitBreakers))
+	for name, cb := range po.circuitBreakers {
+		breakers[name] = cb
+	}
+	po.breakerMutex.RUnlock()
 
-	for _, key := range oldestEntries {
-		delete(cache, key)
+	statuses := make([]CircuitBreakerStatus, 0, len(breakers))
+	for name, cb := range breakers {
+		status := cb.status()
+		status.Service = name
+		statuses = append(statuses, status)
 	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Service < statuses[j].Service
+	})
+	return statuses
 }
 
-// getOrCreateCircuitBreaker gets or creates a circuit breaker for a service
-func (po *PerformanceOptimizer) getOrCreateCircuitBreaker(serviceName string) *CircuitBreaker {
-	if cb, exists := po.circuitBreakers[serviceName]; exists {
-		return cb
+// RecordOutcome feeds the result of a call to an upstream into the circuit
+// breaker of that upstream, so passive health shares the breaker state
+func (po *PerformanceOptimizer) RecordOutcome(service string, success bool) {
+	cb := po.getOrCreateCircuitBreaker(service, po.redisClient())
+	if success {
+		cb.recordSuccess()
+	} else {
+		cb.recordFailure()
 	}
+}
 
-	cb := &CircuitBreaker{
-		failureThreshold: 5,
-		resetTimeout:     30 * time.Second,
-		state:            0, // Closed
+// CircuitState reports the state of the circuit breaker of service; ok is
+// false when no breaker tracks it yet
+func (po *PerformanceOptimizer) CircuitState(service string) (upstream.CircuitState, bool) {
+	po.breakerMutex.RLock()
+	cb, exists := po.circuitBreakers[service]
+	po.breakerMutex.RUnlock()
+	if !exists {
+		return "", false
+	}
+	switch cb.status().State {
+	case circuitStateNames[circuitOpen]:
+		return upstream.CircuitOpen, true
+	case circuitStateNames[circuitHalfOpen]:
+		return upstream.CircuitHalfOpen, true
+	default:
+		return upstream.CircuitClosed, true
 	}
-	po.circuitBreakers[serviceName] = cb
-	return cb
 }
 
 // optimizeResourceUsage performs various resource optimization tasks
@@ -695,7 +846,6 @@ func (po *PerformanceOptimizer) optimizeResourceUsage() {
 
 	// Update system metrics
 	po.metrics.mutex.Lock()
-	po.metrics.CPUUsage = float64(runtime.NumCPU())
 	po.metrics.MemoryUsage = float64(m.Alloc)
 	po.metrics.GoroutineCount = runtime.NumGoroutine()
 	po.metrics.mutex.Unlock()
@@ -710,7 +860,7 @@ func (po *PerformanceOptimizer) healthCheckBackends() {
 		backend := &po.loadBalancer.backends[i]
 
 		// Simple HTTP health check
-		client := &http.Client{Timeout: 5 * time.Second}
+		client := httpclient.NewClient("health_check", 5*time.Second)
 		resp, err := client.Get(backend.URL + "/health")
 
 		if err != nil || resp.StatusCode != http.StatusOK {
@@ -761,29 +911,87 @@ func (rl *AdaptiveRateLimiter) allowRequest(clientIP string) bool {
 	return false
 }
 
-// selectBackend selects the next backend using weighted round-robin
+// selectBackend picks two random active backends and returns the one with the
+// lower latency average. Backends without samples yet win so that they get
+// measured. Without active backends the first one is returned.
 func (lb *LoadBalancer) selectBackend() *Backend {
-	lb.mutex.Lock()
-	defer lb.mutex.Unlock()
+	lb.mutex.RLock()
+	defer lb.mutex.RUnlock()
 
 	if len(lb.backends) == 0 {
 		return nil
 	}
 
-	// Find next active backend
-	attempts := 0
-	for attempts < len(lb.backends) {
-		index := atomic.AddInt64(&lb.current, 1) % int64(len(lb.backends))
-		backend := &lb.backends[index]
+	first, second := lb.randomActive(), lb.randomActive()
+	switch {
+	case first == nil:
+		return &lb.backends[0]
+	case second == nil || first == second:
+		return first
+	case second.LatencyEWMA < first.LatencyEWMA:
+		return second
+	default:
+		return first
+	}
+}
 
-		if backend.Active {
+// randomActive returns a random active backend, or nil when none is active.
+// It probes random slots first and scans only when those are all inactive.
+func (lb *LoadBalancer) randomActive() *Backend {
+	n := len(lb.backends)
+	for attempts := 0; attempts < 3; attempts++ {
+		if backend := &lb.backends[rand.Intn(n)]; backend.Active {
 			return backend
 		}
-		attempts++
 	}
+	offset := rand.Intn(n)
+	for i := 0; i < n; i++ {
+		if backend := &lb.backends[(offset+i)%n]; backend.Active {
+			return backend
+		}
+	}
+	return nil
+}
 
-	// If no active backends, return the first one
-	return &lb.backends[0]
+// recordLatency folds the latency of a request proxied to url into its backend's average
+func (lb *LoadBalancer) recordLatency(url string, latency time.Duration) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	for i := range lb.backends {
+		backend := &lb.backends[i]
+		if backend.URL != url {
+			continue
+		}
+		if backend.LatencyEWMA == 0 {
+			backend.LatencyEWMA = latency
+		} else {
+			backend.LatencyEWMA = time.Duration(latencyEWMAAlpha*float64(latency) + (1-latencyEWMAAlpha)*float64(backend.LatencyEWMA))
+		}
+		return
+	}
+}
+
+// AddBackend adds a backend for the load balancing middleware. It is active
+// until a health check fails.
+func (po *PerformanceOptimizer) AddBackend(url string, weight int) {
+	po.loadBalancer.mutex.Lock()
+	defer po.loadBalancer.mutex.Unlock()
+	po.loadBalancer.backends = append(po.loadBalancer.backends, Backend{
+		URL:         url,
+		Weight:      weight,
+		HealthScore: 1.0,
+		Active:      true,
+	})
+}
+
+// Backends returns a copy of the load balancer's backends with their latency averages
+func (po *PerformanceOptimizer) Backends() []Backend {
+	po.loadBalancer.mutex.RLock()
+	defer po.loadBalancer.mutex.RUnlock()
+	backends := make([]Backend, len(po.loadBalancer.backends))
+	copy(backends, po.loadBalancer.backends)
+	return backends
 }
 
 // allowRequest checks if a request should be allowed through the circuit breaker
@@ -791,15 +999,15 @@ func (cb *CircuitBreaker) allowRequest() bool {
 	state := atomic.LoadInt32(&cb.state)
 
 	switch state {
-	case 0: // Closed
+	case circuitClosed:
 		return true
-	case 1: // Open
-		if time.Since(cb.lastFailureTime) > cb.resetTimeout {
-			atomic.StoreInt32(&cb.state, 2) // Half-open
+	case circuitOpen:
+		if time.Since(time.Unix(0, atomic.LoadInt64(&cb.lastFailure))) > cb.resetTimeout {
+			atomic.CompareAndSwapInt32(&cb.state, circuitOpen, circuitHalfOpen)
 			return true
 		}
 		return false
-	case 2: // Half-open
+	case circuitHalfOpen:
 		return true
 	default:
 		return false
@@ -809,17 +1017,26 @@ func (cb *CircuitBreaker) allowRequest() bool {
 // recordFailure records a failure and potentially opens the circuit
 func (cb *CircuitBreaker) recordFailure() {
 	atomic.AddInt64(&cb.failureCount, 1)
-	cb.lastFailureTime = time.Now()
+	atomic.StoreInt64(&cb.lastFailure, time.Now().UnixNano())
 
 	if atomic.LoadInt64(&cb.failureCount) >= int64(cb.failureThreshold) {
-		atomic.StoreInt32(&cb.state, 1) // Open
+		atomic.StoreInt32(&cb.state, circuitOpen)
 	}
 }
 
 // recordSuccess records a success and potentially closes the circuit
 func (cb *CircuitBreaker) recordSuccess() {
 	atomic.StoreInt64(&cb.failureCount, 0)
-	atomic.StoreInt32(&cb.state, 0) // Closed
+	atomic.StoreInt32(&cb.state, circuitClosed)
+}
+
+// status reports the breaker's current state
+func (cb *CircuitBreaker) status() CircuitBreakerStatus {
+	return newCircuitBreakerStatus(
+		int(atomic.LoadInt32(&cb.state)),
+		atomic.LoadInt64(&cb.failureCount),
+		atomic.LoadInt64(&cb.lastFailure),
+	)
 }
 
 // processEndpointBatch processes a batch of requests for a specific endpoint
@@ -939,82 +1156,105 @@ func (po *PerformanceOptimizer) getRequestCount() int64 {
 
 // getCachedResponse retrieves cached response data
 func (po *PerformanceOptimizer) getCachedResponse(key string) interface{} {
-	po.cacheMutex.RLock()
-	defer po.cacheMutex.RUnlock()
-
-	// Check if we have an in-memory cache implementation
-	cache := po.getCache()
-	if cache == nil {
-		return nil
-	}
-
-	// Retrieve entry with TTL check
-	if entry, exists := cache[key]; exists {
-		if time.Since(entry.Timestamp) <= entry.TTL {
-			atomic.AddInt64(&po.metrics.CacheHits, 1)
-			logrus.WithField("cache_key", key).Debug("Cache hit")
-			return entry.Body
-		} else {
-			// Entry expired, remove it (upgrade to write lock)
-			po.cacheMutex.RUnlock()
-			po.cacheMutex.Lock()
-			delete(cache, key)
-			po.cacheMutex.Unlock()
-			po.cacheMutex.RLock()
-
-			atomic.AddInt64(&po.metrics.CacheMisses, 1)
-			logrus.WithField("cache_key", key).Debug("Cache miss (expired)")
-		}
-	} else {
-		atomic.AddInt64(&po.metrics.CacheMisses, 1)
+	entry, ok := po.fetchCached(context.Background(), po.cacheBackend(), key)
+	if !ok {
 		logrus.WithField("cache_key", key).Debug("Cache miss")
+		return nil
 	}
-
-	return nil
+	logrus.WithField("cache_key", key).Debug("Cache hit")
+	return entry.Body
 }
 
 // setCachedResponse stores response data in cache
 func (po *PerformanceOptimizer) setCachedResponse(key string, data interface{}) {
-	po.cacheMutex.Lock()
-	defer po.cacheMutex.Unlock()
-
-	cache := po.getCache()
-	if cache == nil {
-		return
-	}
-
 	// Create cache entry with appropriate TTL
 	entry := &CacheEntry{
 		Body:        data.([]byte),
 		Timestamp:   time.Now(),
-		TTL:         po.calculateCacheTTL(key),
+		TTL:         JitteredTTL(po.calculateCacheTTL(key), cacheTTLJitter),
 		StatusCode:  200,
 		ContentType: "application/json",
 		Headers:     make(map[string]string),
 	}
-
-	// Store in cache with size limit
-	if len(cache) >= 1000 {
-		po.evictOldestCacheEntries(cache)
-	}
-
-	cache[key] = entry
+	po.storeCached(context.Background(), po.cacheBackend(), key, entry)
 	logrus.WithFields(logrus.Fields{
 		"cache_key": key,
 		"ttl":       entry.TTL,
 	}).Debug("Response cached")
 }
 
-// getCache returns the cache map (in a real implementation, this might be Redis)
-func (po *PerformanceOptimizer) getCache() map[string]*CacheEntry {
-	// Simple in-memory cache for this implementation
-	// In production, this would be Redis or another distributed cache
-	if po.cache == nil {
-		po.cache = make(map[string]*CacheEntry)
-	}
+// getCache returns the response cache, creating one with the default limits
+// for optimizers not built by NewPerformanceOptimizer
+func (po *PerformanceOptimizer) getCache() *ResponseCache {
+	po.cacheOnce.Do(func() {
+		if po.cache == nil {
+			po.cache = NewResponseCache(0, 0, po.metrics)
+		}
+	})
 	return po.cache
 }
 
+// SetCacheBackend replaces the in-memory response cache, e.g. with a
+// RedisCacheBackend shared by all replicas; nil restores the in-memory cache
+func (po *PerformanceOptimizer) SetCacheBackend(backend CacheBackend) {
+	if redisBackend, ok := backend.(*RedisCacheBackend); ok {
+		redisBackend.metrics = po.metrics
+	}
+	po.backendMutex.Lock()
+	po.backend = backend
+	po.backendMutex.Unlock()
+}
+
+// cacheBackend returns the configured backend or the in-memory cache
+func (po *PerformanceOptimizer) cacheBackend() CacheBackend {
+	po.backendMutex.RLock()
+	backend := po.backend
+	po.backendMutex.RUnlock()
+	if backend == nil {
+		return po.getCache()
+	}
+	return backend
+}
+
+// fetchCached looks key up in cache; a backend error counts as a miss so the
+// request goes to the upstream instead of failing
+func (po *PerformanceOptimizer) fetchCached(ctx context.Context, cache CacheBackend, key string) (*CacheEntry, bool) {
+	entry, ok, err := cache.Fetch(ctx, key)
+	if err != nil {
+		atomic.AddInt64(&po.metrics.CacheBackendErrors, 1)
+		atomic.AddInt64(&po.metrics.CacheMisses, 1)
+		logrus.WithError(err).WithField("cache_key", key).Warn("Response cache lookup failed")
+		return nil, false
+	}
+	return entry, ok
+}
+
+// storeCached writes entry to cache, counting and logging a backend error
+func (po *PerformanceOptimizer) storeCached(ctx context.Context, cache CacheBackend, key string, entry *CacheEntry) {
+	if err := cache.Store(ctx, key, entry); err != nil {
+		atomic.AddInt64(&po.metrics.CacheBackendErrors, 1)
+		logrus.WithError(err).WithField("cache_key", key).Warn("Response cache write failed")
+	}
+}
+
+// InvalidateCache removes cached responses whose request path starts with
+// prefix, or all of them when prefix is empty, and returns how many were removed
+func (po *PerformanceOptimizer) InvalidateCache(ctx context.Context, prefix string) (int, error) {
+	return po.cacheBackend().Purge(ctx, prefix)
+}
+
+// cacheTTLJitter spreads expiry of entries cached together over 10% of their TTL
+const cacheTTLJitter = 0.1
+
+// JitteredTTL returns base * (1 + rand * jitterFactor) so that entries written
+// at the same time do not all expire, and hit the upstream, at once
+func JitteredTTL(base time.Duration, jitterFactor float64) time.Duration {
+	if jitterFactor <= 0 {
+		return base
+	}
+	return base + time.Duration(float64(base)*rand.Float64()*jitterFactor)
+}
+
 // calculateCacheTTL calculates appropriate TTL based on content type
 func (po *PerformanceOptimizer) calculateCacheTTL(key string) time.Duration {
 	// Different TTLs for different content types
@@ -1030,44 +1270,6 @@ func (po *PerformanceOptimizer) calculateCacheTTL(key string) time.Duration {
 	}
 }
 
-// evictOldestCacheEntries removes oldest entries to maintain cache size
-func (po *PerformanceOptimizer) evictOldestCacheEntries(cache map[string]*CacheEntry) {
-	if len(cache) <= 800 {
-		return
-	}
-
-	// Find and remove 200 oldest entries
-	type keyTimestamp struct {
-		key       string
-		timestamp time.Time
-	}
-
-	var entries []keyTimestamp
-	for k, v := range cache {
-		entries = append(entries, keyTimestamp{key: k, timestamp: v.Timestamp})
-	}
-
-	// Sort by timestamp (oldest first)
-	for i := 0; i < len(entries)-1; i++ {
-		for j := i + 1; j < len(entries); j++ {
-			if entries[i].timestamp.After(entries[j].timestamp) {
-				entries[i], entries[j] = entries[j], entries[i]
-			}
-		}
-	}
-
-	// Remove oldest 200 entries
-	removeCount := 200
-	if len(entries) < removeCount {
-		removeCount = len(entries)
-	}
-	for i := 0; i < removeCount; i++ {
-		delete(cache, entries[i].key)
-	}
-
-	logrus.WithField("evicted_count", removeCount).Debug("Evicted old cache entries")
-}
-
 // shouldSkipCompression determines if compression should be skipped
 func shouldSkipCompression(contentType string) bool {
 	skipTypes := []string{
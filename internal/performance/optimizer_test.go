@@ -0,0 +1,259 @@
+package performance
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/upstream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJitteredTTLBounds(t *testing.T) {
+	base := 5 * time.Minute
+	for i := 0; i < 100; i++ {
+		ttl := JitteredTTL(base, 0.1)
+		assert.GreaterOrEqual(t, ttl, base)
+		assert.Less(t, ttl, base+30*time.Second)
+	}
+	assert.Equal(t, base, JitteredTTL(base, 0))
+}
+
+func TestSetCachedResponseJitterDistribution(t *testing.T) {
+	po := &PerformanceOptimizer{}
+	const n = 1000
+
+	// "chat" keys use a 5 minute base TTL
+	for i := 0; i < n; i++ {
+		po.setCachedResponse(fmt.Sprintf("chat-%d", i), []byte(`{}`))
+	}
+	require.Equal(t, n, po.cache.Len())
+
+	var sum, sumSq float64
+	for _, element := range po.cache.items {
+		s := element.Value.(*cacheItem).entry.TTL.Seconds()
+		sum += s
+		sumSq += s * s
+	}
+	mean := sum / n
+	stddev := math.Sqrt(sumSq/n - mean*mean)
+
+	// Uniform over [300s, 330s): mean 315s, stddev 30/sqrt(12) ≈ 8.66s
+	assert.InDelta(t, 315, mean, 1.5)
+	assert.InDelta(t, 30/math.Sqrt(12), stddev, 1.0)
+}
+
+func TestCachingSkipsMockedResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	po := NewPerformanceOptimizer(&config.Config{}, nil)
+
+	var calls int
+	r := gin.New()
+	r.Use(po.IntelligentCachingMiddleware(time.Minute))
+	r.GET("/api/v1/models", func(c *gin.Context) {
+		calls++
+		if c.Query("mocked") == "true" {
+			c.Header("X-Gateway-Mocked", "true")
+		}
+		c.Data(http.StatusOK, "application/json", []byte(`{"data":[]}`))
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		w := get("/api/v1/models?mocked=true")
+		assert.Equal(t, "true", w.Header().Get("X-Gateway-Mocked"))
+		assert.Empty(t, w.Header().Get("X-Cache"))
+	}
+	assert.Equal(t, 2, calls)
+
+	// Real responses are still cached
+	get("/api/v1/models")
+	assert.Equal(t, "HIT", get("/api/v1/models").Header().Get("X-Cache"))
+	assert.Equal(t, 3, calls)
+}
+
+func TestCircuitBreakerMiddlewareConcurrentRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	po := NewPerformanceOptimizer(&config.Config{}, nil)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("service_name", c.Query("service"))
+		c.Next()
+	})
+	r.Use(po.CircuitBreakerMiddleware())
+	r.GET("/", func(c *gin.Context) {
+		if c.Query("fail") != "" {
+			c.Status(http.StatusBadGateway)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	// Run with -race: breakers are created and updated from many goroutines at once
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				target := fmt.Sprintf("/?service=svc-%d", j%5)
+				if i%2 == 0 {
+					target += "&fail=1"
+				}
+				r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, target, nil))
+				po.CircuitBreakers()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	statuses := po.CircuitBreakers()
+	require.Len(t, statuses, 5)
+	for i, status := range statuses {
+		assert.Equal(t, fmt.Sprintf("svc-%d", i), status.Service)
+		assert.Contains(t, []string{"closed", "open", "half-open"}, status.State)
+	}
+}
+
+func TestCircuitBreakerStatus(t *testing.T) {
+	cb := &CircuitBreaker{failureThreshold: 2, resetTimeout: time.Hour}
+	status := cb.status()
+	assert.Equal(t, "closed", status.State)
+	assert.Zero(t, status.FailureCount)
+	assert.Nil(t, status.LastFailure)
+
+	cb.recordFailure()
+	cb.recordFailure()
+	assert.False(t, cb.allowRequest())
+	status = cb.status()
+	assert.Equal(t, "open", status.State)
+	assert.Equal(t, int64(2), status.FailureCount)
+	require.NotNil(t, status.LastFailure)
+	assert.WithinDuration(t, time.Now(), *status.LastFailure, time.Minute)
+
+	cb.resetTimeout = 0
+	assert.True(t, cb.allowRequest())
+	assert.Equal(t, "half-open", cb.status().State)
+}
+
+func TestUpstreamHealthReadsBreakerState(t *testing.T) {
+	po := NewPerformanceOptimizer(&config.Config{}, nil)
+	registry := upstream.NewRegistry(upstream.DefaultWeights())
+	registry.SetCircuitBreakers(po)
+
+	_, tracked := po.CircuitState("api.example.com")
+	assert.False(t, tracked)
+
+	for i := 0; i < 5; i++ {
+		registry.RecordResult("api.example.com", http.StatusBadGateway, time.Millisecond, nil)
+	}
+	state, tracked := po.CircuitState("api.example.com")
+	require.True(t, tracked)
+	assert.Equal(t, upstream.CircuitOpen, state)
+
+	// The breaker the performance routes report is the one the registry publishes
+	statuses := po.CircuitBreakers()
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "api.example.com", statuses[0].Service)
+	assert.Equal(t, "open", statuses[0].State)
+
+	registry.RecordActiveCheck("api.example.com", false)
+	snapshot := registry.Snapshot()
+	require.Len(t, snapshot, 1)
+	assert.Equal(t, upstream.CircuitOpen, snapshot[0].CircuitState)
+	assert.False(t, snapshot[0].ActiveHealthy)
+
+	// Throttling cools the upstream down without touching the breaker
+	registry.RecordResult("api.example.com", http.StatusTooManyRequests, time.Millisecond, nil)
+	state, _ = po.CircuitState("api.example.com")
+	assert.Equal(t, upstream.CircuitOpen, state)
+
+	registry.RecordResult("api.example.com", http.StatusOK, time.Millisecond, nil)
+	assert.Equal(t, upstream.CircuitClosed, registry.Snapshot()[0].CircuitState)
+}
+
+func TestLoadBalancerPrefersLowerLatency(t *testing.T) {
+	po := NewPerformanceOptimizer(&config.Config{}, nil)
+	po.AddBackend("http://fast", 1)
+	po.AddBackend("http://slow", 1)
+	po.loadBalancer.recordLatency("http://fast", 20*time.Millisecond)
+	po.loadBalancer.recordLatency("http://slow", 400*time.Millisecond)
+
+	picks := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		picks[po.loadBalancer.selectBackend().URL]++
+	}
+	// The slow backend wins only when both choices land on it
+	assert.Greater(t, picks["http://fast"], 650)
+	assert.Greater(t, picks["http://slow"], 150)
+
+	// Inactive backends are skipped
+	po.loadBalancer.backends[0].Active = false
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, "http://slow", po.loadBalancer.selectBackend().URL)
+	}
+}
+
+func TestLoadBalancerLatencyEWMA(t *testing.T) {
+	po := NewPerformanceOptimizer(&config.Config{}, nil)
+	po.AddBackend("http://a", 1)
+
+	po.loadBalancer.recordLatency("http://a", 100*time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, po.Backends()[0].LatencyEWMA, "the first sample seeds the average")
+	po.loadBalancer.recordLatency("http://a", 200*time.Millisecond)
+	assert.Equal(t, 110*time.Millisecond, po.Backends()[0].LatencyEWMA)
+	po.loadBalancer.recordLatency("http://unknown", time.Second)
+	assert.Len(t, po.Backends(), 1)
+}
+
+func TestLoadBalancingMiddlewareRecordsLatency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	po := NewPerformanceOptimizer(&config.Config{}, nil)
+
+	r := gin.New()
+	r.Use(po.LoadBalancingMiddleware())
+	r.GET("/", func(c *gin.Context) {
+		time.Sleep(5 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "no backends configured")
+
+	po.AddBackend("http://a", 1)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.GreaterOrEqual(t, po.Backends()[0].LatencyEWMA, 5*time.Millisecond)
+}
+
+func BenchmarkSelectBackend(b *testing.B) {
+	po := NewPerformanceOptimizer(&config.Config{}, nil)
+	for i := 0; i < 100; i++ {
+		url := fmt.Sprintf("http://backend-%d", i)
+		po.AddBackend(url, 1)
+		po.loadBalancer.recordLatency(url, time.Duration(i+1)*time.Millisecond)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			po.loadBalancer.selectBackend()
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package performance
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// responseCacheKeyPrefix Redis 中缓存响应哈希的键前缀，后接缓存键
+const responseCacheKeyPrefix = "gw:response_cache:"
+
+// defaultCacheBackendTimeout bounds a lookup or write so a slow Redis costs a
+// cache miss rather than request latency
+const defaultCacheBackendTimeout = 50 * time.Millisecond
+
+// Hash fields of a cached response
+const (
+	rcFieldStatus      = "status"
+	rcFieldContentType = "content_type"
+	rcFieldHeaders     = "headers" // JSON object
+	rcFieldBody        = "body"
+	rcFieldTimestamp   = "timestamp" // unix nanoseconds
+	rcFieldTTL         = "ttl"       // nanoseconds
+	rcFieldPath        = "path"
+)
+
+// RedisCacheBackend 将响应缓存保存在 Redis 哈希中，键的过期时间等于条目的 TTL，
+// 供多个网关副本共享
+type RedisCacheBackend struct {
+	client  *redis.Client
+	timeout time.Duration
+	metrics *PerformanceMetrics
+}
+
+// NewRedisCacheBackend creates a backend on client whose lookups and writes
+// give up after timeout; zero or negative uses 50ms
+func NewRedisCacheBackend(client *redis.Client, timeout time.Duration) *RedisCacheBackend {
+	if timeout <= 0 {
+		timeout = defaultCacheBackendTimeout
+	}
+	return &RedisCacheBackend{client: client, timeout: timeout}
+}
+
+// count adds to one of the cache counters when metrics are attached
+func (rb *RedisCacheBackend) count(counter func(*PerformanceMetrics) *int64) {
+	if rb.metrics != nil {
+		atomic.AddInt64(counter(rb.metrics), 1)
+	}
+}
+
+// Fetch implements CacheBackend
+func (rb *RedisCacheBackend) Fetch(ctx context.Context, key string) (*CacheEntry, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, rb.timeout)
+	defer cancel()
+
+	fields, err := rb.client.HGetAll(ctx, responseCacheKeyPrefix+key).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(fields) == 0 {
+		rb.count(func(m *PerformanceMetrics) *int64 { return &m.CacheMisses })
+		return nil, false, nil
+	}
+	entry, err := decodeCacheEntry(fields)
+	if err != nil {
+		return nil, false, fmt.Errorf("corrupt cache entry %s: %w", key, err)
+	}
+	rb.count(func(m *PerformanceMetrics) *int64 { return &m.CacheHits })
+	return entry, true, nil
+}
+
+// Store implements CacheBackend. Entries without a positive TTL are not cached.
+func (rb *RedisCacheBackend) Store(ctx context.Context, key string, entry *CacheEntry) error {
+	if entry.TTL <= 0 {
+		return nil
+	}
+	headers, err := json.Marshal(entry.Headers)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, rb.timeout)
+	defer cancel()
+
+	redisKey := responseCacheKeyPrefix + key
+	_, err = rb.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, redisKey)
+		pipe.HSet(ctx, redisKey, map[string]interface{}{
+			rcFieldStatus:      entry.StatusCode,
+			rcFieldContentType: entry.ContentType,
+			rcFieldHeaders:     headers,
+			rcFieldBody:        entry.Body,
+			rcFieldTimestamp:   entry.Timestamp.UnixNano(),
+			rcFieldTTL:         int64(entry.TTL),
+			rcFieldPath:        entry.Path,
+		})
+		pipe.PExpire(ctx, redisKey, entry.TTL)
+		return nil
+	})
+	return err
+}
+
+// Purge implements CacheBackend. It scans the cached keys, so it is meant
+// for the admin API rather than the request path.
+func (rb *RedisCacheBackend) Purge(ctx context.Context, prefix string) (int, error) {
+	removed := 0
+	iter := rb.client.Scan(ctx, 0, responseCacheKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		redisKey := iter.Val()
+		if prefix != "" {
+			target, err := rb.client.HGet(ctx, redisKey, rcFieldPath).Result()
+			if err != nil && err != redis.Nil {
+				return removed, err
+			}
+			if target == "" {
+				target = strings.TrimPrefix(redisKey, responseCacheKeyPrefix)
+			}
+			if !strings.HasPrefix(target, prefix) {
+				continue
+			}
+		}
+		deleted, err := rb.client.Del(ctx, redisKey).Result()
+		if err != nil {
+			return removed, err
+		}
+		removed += int(deleted)
+	}
+	return removed, iter.Err()
+}
+
+// decodeCacheEntry rebuilds an entry from its hash fields
+func decodeCacheEntry(fields map[string]string) (*CacheEntry, error) {
+	status, err := strconv.Atoi(fields[rcFieldStatus])
+	if err != nil {
+		return nil, fmt.Errorf("invalid status: %w", err)
+	}
+	timestamp, err := strconv.ParseInt(fields[rcFieldTimestamp], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %w", err)
+	}
+	ttl, err := strconv.ParseInt(fields[rcFieldTTL], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ttl: %w", err)
+	}
+	var headers map[string]string
+	if raw := fields[rcFieldHeaders]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &headers); err != nil {
+			return nil, fmt.Errorf("invalid headers: %w", err)
+		}
+	}
+	return &CacheEntry{
+		StatusCode:  status,
+		ContentType: fields[rcFieldContentType],
+		Headers:     headers,
+		Body:        []byte(fields[rcFieldBody]),
+		Timestamp:   time.Unix(0, timestamp),
+		TTL:         time.Duration(ttl),
+		Path:        fields[rcFieldPath],
+	}, nil
+}
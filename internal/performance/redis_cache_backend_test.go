@@ -0,0 +1,174 @@
+package performance
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRedisCache(t *testing.T) (*RedisCacheBackend, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisCacheBackend(client, time.Second), mr
+}
+
+func TestRedisCacheBackendRoundTripsGzipBody(t *testing.T) {
+	backend, mr := newTestRedisCache(t)
+	ctx := context.Background()
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err := gz.Write([]byte(`{"object":"list","data":[{"id":"qwen-max"}]}`))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+
+	stored := &CacheEntry{
+		StatusCode:  http.StatusOK,
+		ContentType: "application/json",
+		Headers:     map[string]string{"Content-Encoding": "gzip", "Vary": "Accept-Encoding"},
+		Body:        compressed.Bytes(),
+		Timestamp:   time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC),
+		TTL:         5 * time.Minute,
+		Path:        "/api/v1/models",
+	}
+	require.NoError(t, backend.Store(ctx, "GET:/api/v1/models", stored))
+	assert.Equal(t, 5*time.Minute, mr.TTL(responseCacheKeyPrefix+"GET:/api/v1/models"), "the key expires with the entry")
+
+	entry, ok, err := backend.Fetch(ctx, "GET:/api/v1/models")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, stored.StatusCode, entry.StatusCode)
+	assert.Equal(t, stored.ContentType, entry.ContentType)
+	assert.Equal(t, stored.Headers, entry.Headers)
+	assert.Equal(t, stored.Body, entry.Body)
+	assert.True(t, stored.Timestamp.Equal(entry.Timestamp))
+	assert.Equal(t, stored.TTL, entry.TTL)
+	assert.Equal(t, stored.Path, entry.Path)
+
+	reader, err := gzip.NewReader(bytes.NewReader(entry.Body))
+	require.NoError(t, err)
+	plain, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"object":"list","data":[{"id":"qwen-max"}]}`, string(plain))
+
+	mr.FastForward(5 * time.Minute)
+	_, ok, err = backend.Fetch(ctx, "GET:/api/v1/models")
+	require.NoError(t, err)
+	assert.False(t, ok, "an expired entry is a miss")
+}
+
+func TestRedisCacheBackendRoundTripsBinaryContent(t *testing.T) {
+	backend, _ := newTestRedisCache(t)
+	ctx := context.Background()
+
+	// Every byte value, including NUL and invalid UTF-8 sequences
+	body := make([]byte, 512)
+	for i := range body {
+		body[i] = byte(i)
+	}
+	require.NoError(t, backend.Store(ctx, "GET:/api/v1/files/logo", &CacheEntry{
+		StatusCode:  http.StatusOK,
+		ContentType: "image/png",
+		Body:        body,
+		Timestamp:   time.Now(),
+		TTL:         time.Minute,
+	}))
+
+	entry, ok, err := backend.Fetch(ctx, "GET:/api/v1/files/logo")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "image/png", entry.ContentType)
+	assert.Equal(t, body, entry.Body)
+	assert.Empty(t, entry.Headers)
+}
+
+func TestRedisCacheBackendPurge(t *testing.T) {
+	backend, _ := newTestRedisCache(t)
+	ctx := context.Background()
+	for key, path := range map[string]string{
+		"GET:/api/v1/models":          "/api/v1/models",
+		"GET:/api/v1/models/qwen-max": "/api/v1/models/qwen-max",
+		"GET:/api/v1/stats":           "/api/v1/stats",
+		"models_list":                 "",
+	} {
+		require.NoError(t, backend.Store(ctx, key, &CacheEntry{StatusCode: 200, Body: []byte("x"), Timestamp: time.Now(), TTL: time.Minute, Path: path}))
+	}
+
+	removed, err := backend.Purge(ctx, "/api/v1/models")
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	removed, err = backend.Purge(ctx, "models_")
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed, "entries without a path are matched by key")
+	removed, err = backend.Purge(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+}
+
+func TestCachingMiddlewareSharesRedisBackend(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	backend, _ := newTestRedisCache(t)
+
+	calls := 0
+	replica := func() *gin.Engine {
+		po := NewPerformanceOptimizer(&config.Config{}, nil)
+		po.SetCacheBackend(backend)
+		r := gin.New()
+		r.Use(po.IntelligentCachingMiddleware(time.Minute))
+		r.GET("/api/v1/models", func(c *gin.Context) {
+			calls++
+			c.JSON(http.StatusOK, gin.H{"calls": calls})
+		})
+		return r
+	}
+	first, second := replica(), replica()
+
+	w := httptest.NewRecorder()
+	first.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/models", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	second.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/models", nil))
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"), "a response cached by one replica is served by another")
+	assert.JSONEq(t, `{"calls":1}`, w.Body.String())
+	assert.Equal(t, 1, calls)
+}
+
+func TestCachingMiddlewareFallsThroughOnRedisError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	backend, mr := newTestRedisCache(t)
+	po := NewPerformanceOptimizer(&config.Config{}, nil)
+	po.SetCacheBackend(backend)
+	mr.Close()
+
+	calls := 0
+	r := gin.New()
+	r.Use(po.IntelligentCachingMiddleware(time.Minute))
+	r.GET("/api/v1/models", func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/models", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-Cache"))
+	}
+	assert.Equal(t, 2, calls, "requests reach the upstream while Redis is down")
+	assert.EqualValues(t, 4, po.metrics.CacheBackendErrors, "each failed lookup and write is counted")
+	assert.EqualValues(t, 2, po.metrics.CacheMisses)
+}
@@ -0,0 +1,194 @@
+package performance
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// circuitBreakerKeyPrefix Redis 中熔断器状态哈希的键前缀，后接服务名
+const circuitBreakerKeyPrefix = "gw:circuit_breaker:"
+
+// circuitBreakerOpTimeout bounds each Redis round trip so an unreachable Redis
+// does not stall requests before the in-memory fallback takes over
+const circuitBreakerOpTimeout = 100 * time.Millisecond
+
+// Hash fields of a persisted circuit breaker
+const (
+	cbFieldFailureCount = "failure_count"
+	cbFieldState        = "state"
+	cbFieldLastFailure  = "last_failure" // unix nanoseconds
+)
+
+// Circuit breaker states, shared by the in-memory and Redis breakers
+const (
+	circuitClosed   = 0
+	circuitOpen     = 1
+	circuitHalfOpen = 2
+)
+
+// circuitStateNames are the states as reported by CircuitBreakerStatus
+var circuitStateNames = map[int]string{
+	circuitClosed:   "closed",
+	circuitOpen:     "open",
+	circuitHalfOpen: "half-open",
+}
+
+// breaker is a circuit breaker guarding one service
+type breaker interface {
+	allowRequest() bool
+	recordFailure()
+	recordSuccess()
+	status() CircuitBreakerStatus
+}
+
+// CircuitBreakerStatus 单个服务熔断器的当前状态
+type CircuitBreakerStatus struct {
+	Service      string     `json:"service"`
+	State        string     `json:"state"` // closed, open or half-open
+	FailureCount int64      `json:"failure_count"`
+	LastFailure  *time.Time `json:"last_failure,omitempty"`
+}
+
+func newCircuitBreakerStatus(state int, failures, lastFailure int64) CircuitBreakerStatus {
+	status := CircuitBreakerStatus{State: circuitStateNames[state], FailureCount: failures}
+	if status.State == "" {
+		status.State = "unknown"
+	}
+	if lastFailure > 0 {
+		at := time.Unix(0, lastFailure)
+		status.LastFailure = &at
+	}
+	return status
+}
+
+// RedisCircuitBreaker keeps circuit breaker state in a Redis hash so that all
+// replicas share it and a restart does not reset trip counts. When Redis
+// cannot be reached it falls back to an in-memory CircuitBreaker.
+type RedisCircuitBreaker struct {
+	client           *redis.Client
+	key              string
+	failureThreshold int
+	resetTimeout     time.Duration
+	fallback         *CircuitBreaker
+	now              func() time.Time
+}
+
+// NewRedisCircuitBreaker creates a breaker for serviceName backed by client
+func NewRedisCircuitBreaker(client *redis.Client, serviceName string, failureThreshold int, resetTimeout time.Duration) *RedisCircuitBreaker {
+	return &RedisCircuitBreaker{
+		client:           client,
+		key:              circuitBreakerKeyPrefix + serviceName,
+		failureThreshold: failureThreshold,
+		resetTimeout:     resetTimeout,
+		fallback: &CircuitBreaker{
+			failureThreshold: failureThreshold,
+			resetTimeout:     resetTimeout,
+		},
+		now: time.Now,
+	}
+}
+
+// ttl keeps an idle breaker's state long enough to outlive one reset timeout
+func (cb *RedisCircuitBreaker) ttl() time.Duration {
+	return cb.resetTimeout * 2
+}
+
+func (cb *RedisCircuitBreaker) logFallback(err error) {
+	logrus.WithError(err).WithField("key", cb.key).Warn("Circuit breaker state unavailable in Redis, using in-memory state")
+}
+
+// allowRequest checks if a request should be allowed through the circuit breaker
+func (cb *RedisCircuitBreaker) allowRequest() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), circuitBreakerOpTimeout)
+	defer cancel()
+
+	values, err := cb.client.HMGet(ctx, cb.key, cbFieldState, cbFieldLastFailure).Result()
+	if err != nil {
+		cb.logFallback(err)
+		return cb.fallback.allowRequest()
+	}
+	state, _ := strconv.Atoi(stringValue(values[0]))
+	switch state {
+	case circuitClosed, circuitHalfOpen:
+		return true
+	case circuitOpen:
+		lastFailure, _ := strconv.ParseInt(stringValue(values[1]), 10, 64)
+		if cb.now().Sub(time.Unix(0, lastFailure)) <= cb.resetTimeout {
+			return false
+		}
+		// Let probe requests through; the first response closes or reopens the circuit
+		if err := cb.client.HSet(ctx, cb.key, cbFieldState, circuitHalfOpen).Err(); err != nil {
+			cb.logFallback(err)
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// recordFailure records a failure and potentially opens the circuit
+func (cb *RedisCircuitBreaker) recordFailure() {
+	ctx, cancel := context.WithTimeout(context.Background(), circuitBreakerOpTimeout)
+	defer cancel()
+
+	var failures *redis.IntCmd
+	_, err := cb.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		failures = pipe.HIncrBy(ctx, cb.key, cbFieldFailureCount, 1)
+		pipe.HSet(ctx, cb.key, cbFieldLastFailure, cb.now().UnixNano())
+		pipe.Expire(ctx, cb.key, cb.ttl())
+		return nil
+	})
+	if err != nil {
+		cb.logFallback(err)
+		cb.fallback.recordFailure()
+		return
+	}
+	if failures.Val() >= int64(cb.failureThreshold) {
+		if err := cb.client.HSet(ctx, cb.key, cbFieldState, circuitOpen).Err(); err != nil {
+			cb.logFallback(err)
+			cb.fallback.recordFailure()
+		}
+	}
+}
+
+// recordSuccess records a success and closes the circuit
+func (cb *RedisCircuitBreaker) recordSuccess() {
+	ctx, cancel := context.WithTimeout(context.Background(), circuitBreakerOpTimeout)
+	defer cancel()
+
+	_, err := cb.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, cb.key, cbFieldFailureCount, 0, cbFieldState, circuitClosed)
+		pipe.Expire(ctx, cb.key, cb.ttl())
+		return nil
+	})
+	if err != nil {
+		cb.logFallback(err)
+	}
+	cb.fallback.recordSuccess()
+}
+
+// status reads the shared state, or the in-memory state when Redis is unavailable
+func (cb *RedisCircuitBreaker) status() CircuitBreakerStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), circuitBreakerOpTimeout)
+	defer cancel()
+
+	values, err := cb.client.HMGet(ctx, cb.key, cbFieldState, cbFieldFailureCount, cbFieldLastFailure).Result()
+	if err != nil {
+		cb.logFallback(err)
+		return cb.fallback.status()
+	}
+	state, _ := strconv.Atoi(stringValue(values[0]))
+	failures, _ := strconv.ParseInt(stringValue(values[1]), 10, 64)
+	lastFailure, _ := strconv.ParseInt(stringValue(values[2]), 10, 64)
+	return newCircuitBreakerStatus(state, failures, lastFailure)
+}
+
+// stringValue converts an HMGET result to a string; missing fields are empty
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,83 @@
+package performance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisCircuitBreakerSharedAcrossReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	now := time.Unix(1_700_000_000, 0)
+	newBreaker := func() *RedisCircuitBreaker {
+		cb := NewRedisCircuitBreaker(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "upstream", 3, 30*time.Second)
+		cb.now = func() time.Time { return now }
+		return cb
+	}
+	a, b := newBreaker(), newBreaker()
+
+	a.recordFailure()
+	b.recordFailure()
+	assert.True(t, a.allowRequest(), "below the threshold the circuit stays closed")
+	b.recordFailure()
+	assert.False(t, a.allowRequest(), "failures of all replicas count towards the threshold")
+	assert.Equal(t, "3", mr.HGet(circuitBreakerKeyPrefix+"upstream", cbFieldFailureCount))
+	assert.Equal(t, 60*time.Second, mr.TTL(circuitBreakerKeyPrefix+"upstream"))
+
+	// A restarted replica sees the open circuit
+	assert.False(t, newBreaker().allowRequest())
+
+	now = now.Add(31 * time.Second)
+	assert.True(t, b.allowRequest(), "after the reset timeout probes are let through")
+	assert.Equal(t, "2", mr.HGet(circuitBreakerKeyPrefix+"upstream", cbFieldState))
+	a.recordSuccess()
+	assert.True(t, b.allowRequest())
+	assert.Equal(t, "0", mr.HGet(circuitBreakerKeyPrefix+"upstream", cbFieldFailureCount))
+}
+
+func TestRedisCircuitBreakerFallsBackToMemory(t *testing.T) {
+	mr := miniredis.RunT(t)
+	cb := NewRedisCircuitBreaker(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "upstream", 2, 30*time.Second)
+	mr.Close()
+
+	cb.recordFailure()
+	assert.True(t, cb.allowRequest())
+	cb.recordFailure()
+	assert.False(t, cb.allowRequest(), "the in-memory breaker trips while Redis is down")
+}
+
+func TestGetOrCreateCircuitBreaker(t *testing.T) {
+	po := &PerformanceOptimizer{circuitBreakers: make(map[string]breaker)}
+	_, inMemory := po.getOrCreateCircuitBreaker("local", nil).(*CircuitBreaker)
+	assert.True(t, inMemory)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	shared := po.getOrCreateCircuitBreaker("shared", client)
+	_, ok := shared.(*RedisCircuitBreaker)
+	require.True(t, ok)
+	assert.Same(t, shared, po.getOrCreateCircuitBreaker("shared", client))
+}
+
+func TestRedisCircuitBreakerStatus(t *testing.T) {
+	mr := miniredis.RunT(t)
+	now := time.Unix(1_700_000_000, 0)
+	cb := NewRedisCircuitBreaker(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "upstream", 2, 30*time.Second)
+	cb.now = func() time.Time { return now }
+
+	status := cb.status()
+	assert.Equal(t, "closed", status.State)
+	assert.Nil(t, status.LastFailure)
+
+	cb.recordFailure()
+	cb.recordFailure()
+	status = cb.status()
+	assert.Equal(t, "open", status.State)
+	assert.Equal(t, int64(2), status.FailureCount)
+	require.NotNil(t, status.LastFailure)
+	assert.True(t, now.Equal(*status.LastFailure))
+}
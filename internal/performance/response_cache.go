@@ -0,0 +1,167 @@
+package performance
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default limits of the response cache when none are configured
+const (
+	defaultCacheMaxEntries = 1000
+	defaultCacheMaxBytes   = 64 << 20
+)
+
+// ResponseCache 响应缓存，按最近最少使用（LRU）淘汰，同时限制条目数和总字节数。
+// 过期条目在读取时删除并按未命中计数；命中、未命中和淘汰次数记入 PerformanceMetrics。
+type ResponseCache struct {
+	mutex      sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	bytes      int64
+	order      *list.List // of *cacheItem, most recently used first
+	items      map[string]*list.Element
+	metrics    *PerformanceMetrics
+	now        func() time.Time
+}
+
+// cacheItem is one cached response in the LRU list
+type cacheItem struct {
+	key   string
+	entry *CacheEntry
+	size  int64
+}
+
+// NewResponseCache creates a cache holding at most maxEntries responses of
+// maxBytes in total; zero or negative limits use the defaults. Lookups are
+// counted in metrics, which may be nil.
+func NewResponseCache(maxEntries int, maxBytes int64, metrics *PerformanceMetrics) *ResponseCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultCacheMaxBytes
+	}
+	return &ResponseCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+		metrics:    metrics,
+		now:        time.Now,
+	}
+}
+
+// entrySize approximates the memory an entry holds
+func entrySize(key string, entry *CacheEntry) int64 {
+	size := len(key) + len(entry.Body) + len(entry.ContentType) + len(entry.Path)
+	for name, value := range entry.Headers {
+		size += len(name) + len(value)
+	}
+	return int64(size)
+}
+
+// count adds to one of the cache counters when metrics are attached
+func (rc *ResponseCache) count(counter func(*PerformanceMetrics) *int64) {
+	if rc.metrics != nil {
+		atomic.AddInt64(counter(rc.metrics), 1)
+	}
+}
+
+// Get returns the entry cached under key unless it is missing or expired
+func (rc *ResponseCache) Get(key string) (*CacheEntry, bool) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	element, ok := rc.items[key]
+	if !ok {
+		rc.count(func(m *PerformanceMetrics) *int64 { return &m.CacheMisses })
+		return nil, false
+	}
+	item := element.Value.(*cacheItem)
+	if rc.now().Sub(item.entry.Timestamp) >= item.entry.TTL {
+		rc.remove(element)
+		rc.count(func(m *PerformanceMetrics) *int64 { return &m.CacheMisses })
+		return nil, false
+	}
+	rc.order.MoveToFront(element)
+	rc.count(func(m *PerformanceMetrics) *int64 { return &m.CacheHits })
+	return item.entry, true
+}
+
+// Set caches entry under key, evicting the least recently used entries until
+// both limits hold. Entries larger than the byte limit are not cached.
+func (rc *ResponseCache) Set(key string, entry *CacheEntry) {
+	size := entrySize(key, entry)
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if element, ok := rc.items[key]; ok {
+		rc.remove(element)
+	}
+	if size > rc.maxBytes {
+		return
+	}
+	rc.items[key] = rc.order.PushFront(&cacheItem{key: key, entry: entry, size: size})
+	rc.bytes += size
+
+	for rc.order.Len() > rc.maxEntries || rc.bytes > rc.maxBytes {
+		rc.remove(rc.order.Back())
+		rc.count(func(m *PerformanceMetrics) *int64 { return &m.CacheEvictions })
+	}
+}
+
+// Invalidate removes the entries whose request path starts with prefix, or
+// whose key does for entries without a path; an empty prefix flushes the
+// whole cache. It returns the number of entries removed.
+func (rc *ResponseCache) Invalidate(prefix string) int {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if prefix == "" {
+		removed := rc.order.Len()
+		rc.order.Init()
+		rc.items = make(map[string]*list.Element)
+		rc.bytes = 0
+		return removed
+	}
+
+	removed := 0
+	for element := rc.order.Front(); element != nil; {
+		next := element.Next()
+		item := element.Value.(*cacheItem)
+		target := item.entry.Path
+		if target == "" {
+			target = item.key
+		}
+		if strings.HasPrefix(target, prefix) {
+			rc.remove(element)
+			removed++
+		}
+		element = next
+	}
+	return removed
+}
+
+// Len returns the number of cached entries, expired ones included
+func (rc *ResponseCache) Len() int {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.order.Len()
+}
+
+// Bytes returns the approximate size of the cached entries
+func (rc *ResponseCache) Bytes() int64 {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.bytes
+}
+
+// remove drops element; the caller holds the mutex
+func (rc *ResponseCache) remove(element *list.Element) {
+	item := rc.order.Remove(element).(*cacheItem)
+	delete(rc.items, item.key)
+	rc.bytes -= item.size
+}
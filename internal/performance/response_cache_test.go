@@ -0,0 +1,201 @@
+package performance
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cacheEntry(path, body string, ttl time.Duration) *CacheEntry {
+	return &CacheEntry{
+		StatusCode: http.StatusOK,
+		Body:       []byte(body),
+		Timestamp:  time.Now(),
+		TTL:        ttl,
+		Path:       path,
+	}
+}
+
+func TestResponseCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	metrics := &PerformanceMetrics{}
+	cache := NewResponseCache(3, 1<<20, metrics)
+	cache.Set("a", cacheEntry("/a", "1", time.Hour))
+	cache.Set("b", cacheEntry("/b", "2", time.Hour))
+	cache.Set("c", cacheEntry("/c", "3", time.Hour))
+
+	// Reading the oldest entry makes b the least recently used
+	_, ok := cache.Get("a")
+	require.True(t, ok)
+	cache.Set("d", cacheEntry("/d", "4", time.Hour))
+
+	_, ok = cache.Get("b")
+	assert.False(t, ok, "the least recently used entry is evicted")
+	for _, key := range []string{"a", "c", "d"} {
+		_, ok := cache.Get(key)
+		assert.True(t, ok, key)
+	}
+	assert.Equal(t, 3, cache.Len())
+	assert.Equal(t, int64(1), metrics.CacheEvictions)
+	assert.Equal(t, int64(4), metrics.CacheHits)
+	assert.Equal(t, int64(1), metrics.CacheMisses)
+}
+
+func TestResponseCacheByteLimit(t *testing.T) {
+	metrics := &PerformanceMetrics{}
+	cache := NewResponseCache(100, 100, metrics)
+	cache.Set("a", cacheEntry("", strings.Repeat("x", 40), time.Hour))
+	cache.Set("b", cacheEntry("", strings.Repeat("x", 40), time.Hour))
+	assert.Equal(t, int64(82), cache.Bytes())
+
+	cache.Set("c", cacheEntry("", strings.Repeat("x", 40), time.Hour))
+	assert.Equal(t, 2, cache.Len())
+	assert.LessOrEqual(t, cache.Bytes(), int64(100))
+	_, ok := cache.Get("a")
+	assert.False(t, ok)
+
+	// An entry larger than the whole cache is not stored and evicts nothing
+	cache.Set("huge", cacheEntry("", strings.Repeat("x", 200), time.Hour))
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, int64(1), metrics.CacheEvictions)
+
+	// Replacing an entry releases the bytes of the old one
+	cache.Set("b", cacheEntry("", "y", time.Hour))
+	assert.Equal(t, int64(43), cache.Bytes())
+}
+
+func TestResponseCacheExpiry(t *testing.T) {
+	cache := NewResponseCache(10, 1<<20, nil)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	entry := cacheEntry("/a", "1", time.Minute)
+	entry.Timestamp = now
+	cache.Set("a", entry)
+
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+	now = now.Add(time.Minute)
+	_, ok = cache.Get("a")
+	assert.False(t, ok, "entries expire once their TTL has passed")
+	assert.Zero(t, cache.Len(), "expired entries are removed when read")
+}
+
+func TestResponseCacheInvalidate(t *testing.T) {
+	cache := NewResponseCache(10, 1<<20, nil)
+	cache.Set("GET:/api/v1/models", cacheEntry("/api/v1/models", "m", time.Hour))
+	cache.Set("GET:/api/v1/models/qwen", cacheEntry("/api/v1/models/qwen", "q", time.Hour))
+	cache.Set("GET:/api/v1/health", cacheEntry("/api/v1/health", "h", time.Hour))
+	cache.Set("models_list", cacheEntry("", "l", time.Hour))
+
+	assert.Equal(t, 2, cache.Invalidate("/api/v1/models"))
+	assert.Equal(t, 2, cache.Len())
+	assert.Equal(t, 1, cache.Invalidate("models_"), "entries without a path match on their key")
+	assert.Equal(t, 1, cache.Invalidate(""))
+	assert.Zero(t, cache.Len())
+	assert.Zero(t, cache.Bytes())
+}
+
+func TestCachingMiddlewareInvalidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	po := NewPerformanceOptimizer(&config.Config{}, nil)
+
+	var calls int
+	r := gin.New()
+	r.Use(po.IntelligentCachingMiddleware(time.Minute))
+	r.GET("/api/v1/models", func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"calls": calls})
+	})
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/models", nil))
+		return w
+	}
+
+	get()
+	assert.Equal(t, "HIT", get().Header().Get("X-Cache"))
+	assert.Equal(t, 1, calls)
+
+	flushed, err := po.InvalidateCache(context.Background(), "/api/v1/models")
+	require.NoError(t, err)
+	assert.Equal(t, 1, flushed)
+	w := get()
+	assert.Empty(t, w.Header().Get("X-Cache"))
+	assert.Equal(t, 2, calls, "an invalidated response is fetched again")
+}
+
+func TestResponseCacheConcurrentAccess(t *testing.T) {
+	cache := NewResponseCache(50, 1<<20, &PerformanceMetrics{})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				key := fmt.Sprintf("k-%d", (i*j)%80)
+				cache.Set(key, cacheEntry("/"+key, "v", time.Hour))
+				cache.Get(key)
+				if j%50 == 0 {
+					cache.Invalidate("/k-1")
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, cache.Len(), 50)
+}
+
+// mapCache is the map and timestamp scan the LRU cache replaced, kept as the
+// baseline of BenchmarkResponseCacheHit
+type mapCache struct {
+	mu      sync.RWMutex
+	entries map[string]*CacheEntry
+}
+
+func (m *mapCache) get(key string) (*CacheEntry, bool) {
+	m.mu.RLock()
+	entry, ok := m.entries[key]
+	m.mu.RUnlock()
+	if ok && time.Since(entry.Timestamp) < entry.TTL {
+		return entry, true
+	}
+	return nil, false
+}
+
+func BenchmarkResponseCacheHit(b *testing.B) {
+	const entries = 1000
+	keys := make([]string, entries)
+	baseline := &mapCache{entries: make(map[string]*CacheEntry, entries)}
+	lru := NewResponseCache(entries, 1<<30, &PerformanceMetrics{})
+	for i := range keys {
+		keys[i] = fmt.Sprintf("GET:/api/v1/models/%d", i)
+		entry := cacheEntry(keys[i], `{"object":"model"}`, time.Hour)
+		baseline.entries[keys[i]] = entry
+		lru.Set(keys[i], entry)
+	}
+
+	b.Run("map", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				baseline.get(keys[i%entries])
+			}
+		})
+	})
+	b.Run("lru", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for i := 0; pb.Next(); i++ {
+				lru.Get(keys[i%entries])
+			}
+		})
+	})
+}
@@ -3,26 +3,73 @@ package protocol
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/lifecycle"
+	"go-aigateway/internal/security"
 	"io"
 	"net/http"
 	"net/url"
+	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials"
+	grpccodes "google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
 )
 
+// tracer creates the spans of protocol conversions
+var tracer = otel.Tracer("go-aigateway/protocol")
+
+// metadataCarrier lets the W3C propagator write trace context into gRPC metadata
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	if values := metadata.MD(m).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (m metadataCarrier) Set(key, value string) {
+	metadata.MD(m).Set(key, value)
+}
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 type ProtocolConverter struct {
 	config     *config.ProtocolConversionConfig
+	lifecycle  lifecycle.Guard
 	httpClient *http.Client
-	grpcConns  map[string]*grpc.ClientConn
+
+	// Cached gRPC connections by scheme and address
+	grpcConns   map[string]*grpcConn
+	connsMutex  sync.RWMutex
+	stopEvictor context.CancelFunc
+
+	// Method descriptors resolved through server reflection, by target and name
+	methods      map[string]protoreflect.MethodDescriptor
+	methodsMutex sync.Mutex
 }
 
 type ConversionRequest struct {
@@ -49,16 +96,10 @@ func NewProtocolConverter(cfg *config.ProtocolConversionConfig) *ProtocolConvert
 	}
 
 	return &ProtocolConverter{
-		config: cfg,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-			Transport: &http.Transport{
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: false,
-				},
-			},
-		},
-		grpcConns: make(map[string]*grpc.ClientConn),
+		config:     cfg,
+		httpClient: security.UpstreamClient("protocol_conversion", 30*time.Second),
+		grpcConns:  make(map[string]*grpcConn),
+		methods:    make(map[string]protoreflect.MethodDescriptor),
 	}
 }
 
@@ -68,6 +109,23 @@ func (pc *ProtocolConverter) Convert(ctx context.Context, req *ConversionRequest
 	if pc == nil {
 		return nil, fmt.Errorf("protocol conversion not enabled")
 	}
+	if pc.State() == lifecycle.StateClosed {
+		return nil, fmt.Errorf("protocol converter: %w", lifecycle.ErrClosed)
+	}
+
+	ctx, span := tracer.Start(ctx, "ProtocolConverter.Convert",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("conversion.source", req.SourceProtocol),
+			attribute.String("conversion.target", req.TargetProtocol),
+		),
+	)
+	defer span.End()
+
+	// Browsers send gRPC-Web over HTTP/1.1; the content type selects that path
+	if IsGRPCWebContentType(headerValue(req.Headers, "Content-Type")) {
+		req.SourceProtocol = "grpc-web"
+	}
 
 	// Validate request
 	if err := pc.validateConversionRequest(req); err != nil {
@@ -78,6 +136,8 @@ func (pc *ProtocolConverter) Convert(ctx context.Context, req *ConversionRequest
 	var err error
 
 	switch {
+	case req.SourceProtocol == "grpc-web" && (req.TargetProtocol == "grpc" || req.TargetProtocol == "grpcs"):
+		resp, err = pc.webToGRPC(ctx, req)
 	case req.SourceProtocol == "https" && req.TargetProtocol == "grpc":
 		resp, err = pc.httpsToGRPC(ctx, req)
 	case req.SourceProtocol == "grpc" && req.TargetProtocol == "https":
@@ -94,6 +154,12 @@ func (pc *ProtocolConverter) Convert(ctx context.Context, req *ConversionRequest
 	if resp != nil {
 		pc.logConversionMetrics(req, resp, time.Since(start))
 	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if resp != nil && resp.Error != "" {
+		span.SetStatus(codes.Error, resp.Error)
+	}
 
 	return resp, err
 }
@@ -115,13 +181,19 @@ func (pc *ProtocolConverter) httpsToGRPC(ctx context.Context, req *ConversionReq
 		return nil, fmt.Errorf("failed to get gRPC connection: %w", err)
 	}
 
+	// The caller's deadline travels as the gRPC deadline (grpc-timeout); fail
+	// locally rather than send a call with no time left
+	if _, _, err := httpclient.RemainingBudget(ctx, 0); err != nil {
+		return nil, err
+	}
+
 	// Convert HTTP headers to gRPC metadata
 	md := metadata.New(req.Headers)
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		propagation.TraceContext{}.Inject(ctx, metadataCarrier(md))
+	}
 	ctx = metadata.NewOutgoingContext(ctx, md)
 
-	// Implement actual gRPC call based on service definition
-	// This implementation supports common gRPC service patterns
-
 	// Prepare request data
 	var requestData []byte
 	if req.Body != nil {
@@ -134,20 +206,35 @@ func (pc *ProtocolConverter) httpsToGRPC(ctx context.Context, req *ConversionReq
 
 	// Determine the gRPC service method based on the endpoint and HTTP method
 	servicePath, methodName := pc.parseGRPCServiceMethod(req.Endpoint, req.Method)
+	methodNames := []string{methodName}
+	if u, err := url.Parse(req.Endpoint); err == nil {
+		if raw := strings.Title(path.Base(u.Path)); raw != methodName {
+			methodNames = append(methodNames, raw)
+		}
+	}
 
-	// Use dynamic gRPC invocation for flexibility
-	response, err := pc.invokeGRPCMethod(ctx, conn, servicePath, methodName, requestData)
+	// A service or method the upstream does not expose is the upstream's
+	// fault as seen by the client: report it as a bad gateway
+	method, err := pc.resolveMethod(ctx, conn, servicePath, methodNames...)
 	if err != nil {
-		return nil, fmt.Errorf("gRPC call failed: %w", err)
+		st := status.Convert(err)
+		return grpcErrorResponse(http.StatusBadGateway, st, servicePath, methodName), nil
 	}
 
-	// Extract metadata from response
+	response, header, err := pc.invokeGRPCMethod(ctx, conn, method, requestData)
+	if err != nil {
+		st, ok := status.FromError(err)
+		if !ok {
+			return nil, fmt.Errorf("gRPC call failed: %w", err)
+		}
+		return grpcErrorResponse(httpStatusFromGRPC(st.Code()), st, servicePath, string(method.Name())), nil
+	}
+
+	// Pass on the response headers the server sent
 	responseMetadata := make(map[string]interface{})
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		for k, v := range md {
-			if len(v) > 0 {
-				responseMetadata[k] = v[0]
-			}
+	for k, v := range header {
+		if len(v) > 0 {
+			responseMetadata[k] = v[0]
 		}
 	}
 
@@ -158,12 +245,34 @@ func (pc *ProtocolConverter) httpsToGRPC(ctx context.Context, req *ConversionReq
 		Metadata: map[string]interface{}{
 			"conversion":    "https-to-grpc",
 			"service":       servicePath,
-			"method":        methodName,
+			"method":        string(method.Name()),
 			"grpc_metadata": responseMetadata,
 		},
 	}, nil
 }
 
+// grpcErrorResponse reports a failed gRPC call in the gateway's error format
+func grpcErrorResponse(statusCode int, st *status.Status, service, method string) *ConversionResponse {
+	return &ConversionResponse{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body: map[string]interface{}{
+			"error": map[string]interface{}{
+				"message": st.Message(),
+				"type":    "api_error",
+				"code":    st.Code().String(),
+			},
+		},
+		Metadata: map[string]interface{}{
+			"conversion":  "https-to-grpc",
+			"service":     service,
+			"method":      method,
+			"grpc_status": st.Code().String(),
+		},
+		Error: st.Message(),
+	}
+}
+
 func (pc *ProtocolConverter) grpcToHTTPS(ctx context.Context, req *ConversionRequest) (*ConversionResponse, error) {
 	logrus.WithFields(logrus.Fields{
 		"source":   "grpc",
@@ -319,50 +428,9 @@ func (pc *ProtocolConverter) executeHTTPRequest(ctx context.Context, method, end
 	}, nil
 }
 
-func (pc *ProtocolConverter) getGRPCConnection(endpoint string) (*grpc.ClientConn, error) {
-	if conn, exists := pc.grpcConns[endpoint]; exists {
-		return conn, nil
-	}
-
-	// Parse endpoint to extract host and port
-	u, err := url.Parse(endpoint)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse gRPC endpoint: %w", err)
-	}
-
-	address := u.Host
-	if u.Port() == "" {
-		if u.Scheme == "grpcs" {
-			address += ":443"
-		} else {
-			address += ":80"
-		}
-	}
-
-	var opts []grpc.DialOption
-	if u.Scheme == "grpcs" {
-		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
-	} else {
-		opts = append(opts, grpc.WithInsecure())
-	}
-
-	conn, err := grpc.Dial(address, opts...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial gRPC server: %w", err)
-	}
-
-	pc.grpcConns[endpoint] = conn
-	return conn, nil
-}
-
-func (pc *ProtocolConverter) Close() error {
-	for endpoint, conn := range pc.grpcConns {
-		if err := conn.Close(); err != nil {
-			logrus.WithError(err).WithField("endpoint", endpoint).Error("Failed to close gRPC connection")
-		}
-	}
-	pc.grpcConns = make(map[string]*grpc.ClientConn)
-	return nil
+// State reports the lifecycle state of the converter
+func (pc *ProtocolConverter) State() lifecycle.State {
+	return pc.lifecycle.State()
 }
 
 // parseGRPCServiceMethod extracts service path and method name from endpoint and HTTP method
@@ -408,58 +476,43 @@ func (pc *ProtocolConverter) parseGRPCServiceMethod(endpoint, httpMethod string)
 	}
 }
 
-// invokeGRPCMethod performs dynamic gRPC method invocation
-func (pc *ProtocolConverter) invokeGRPCMethod(ctx context.Context, conn *grpc.ClientConn, servicePath, methodName string, requestData []byte) (interface{}, error) {
-	// This is a simplified implementation of dynamic gRPC invocation
-	// In a production environment, you would use reflection or generated stubs
-	// Create a generic request message
-	var request map[string]interface{}
-	if len(requestData) > 0 {
-		if err := json.Unmarshal(requestData, &request); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal request data: %w", err)
-		}
-	} else {
-		request = make(map[string]interface{})
+// invokeGRPCMethod calls a unary method with the JSON request decoded into a
+// dynamic message of the method's input type and returns the reply as JSON
+// compatible values together with the response headers
+func (pc *ProtocolConverter) invokeGRPCMethod(ctx context.Context, conn *grpc.ClientConn, method protoreflect.MethodDescriptor, requestData []byte) (interface{}, metadata.MD, error) {
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		return nil, nil, status.Errorf(grpccodes.Unimplemented, "streaming method %s cannot be converted", method.FullName())
 	}
 
-	// Simulate gRPC call - in real implementation, this would use reflection
-	// or protobuf dynamic messages to call the actual gRPC method
-	response := map[string]interface{}{
-		"status":     "success",
-		"data":       request,
-		"service":    servicePath,
-		"method":     methodName,
-		"timestamp":  time.Now().Unix(),
-		"request_id": generateRequestID(),
+	request := dynamicpb.NewMessage(method.Input())
+	if len(requestData) > 0 && string(requestData) != "null" {
+		if err := protojson.Unmarshal(requestData, request); err != nil {
+			return nil, nil, status.Errorf(grpccodes.InvalidArgument, "request body does not match %s: %v", method.Input().FullName(), err)
+		}
 	}
+	reply := dynamicpb.NewMessage(method.Output())
 
-	// Add service-specific response patterns
-	switch {
-	case strings.Contains(methodName, "Get"):
-		response["operation"] = "read"
-	case strings.Contains(methodName, "Create"):
-		response["operation"] = "create"
-		response["created"] = true
-	case strings.Contains(methodName, "Update"):
-		response["operation"] = "update"
-		response["updated"] = true
-	case strings.Contains(methodName, "Delete"):
-		response["operation"] = "delete"
-		response["deleted"] = true
-	default:
-		response["operation"] = "custom"
+	fullMethod := "/" + string(method.Parent().FullName()) + "/" + string(method.Name())
+	var header metadata.MD
+	if err := conn.Invoke(ctx, fullMethod, request, reply, grpc.Header(&header)); err != nil {
+		return nil, nil, err
 	}
 
-	// Simulate network delay
-	time.Sleep(10 * time.Millisecond)
+	data, err := protojson.Marshal(reply)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal gRPC reply: %w", err)
+	}
+	var response interface{}
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode gRPC reply: %w", err)
+	}
 
 	logrus.WithFields(logrus.Fields{
-		"service": servicePath,
-		"method":  methodName,
-		"status":  "completed",
+		"method": fullMethod,
+		"status": "completed",
 	}).Debug("gRPC method invocation completed")
 
-	return response, nil
+	return response, header, nil
 }
 
 // convertGRPCMetadataToHeaders converts gRPC metadata to HTTP headers
@@ -492,9 +545,14 @@ func (pc *ProtocolConverter) convertGRPCMetadataToHeaders(metadata map[string]in
 	return headers
 }
 
-// generateRequestID generates a unique request ID
-func generateRequestID() string {
-	return fmt.Sprintf("req_%d_%d", time.Now().Unix(), time.Now().Nanosecond()%1000000)
+// headerValue looks name up in headers case-insensitively
+func headerValue(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
 }
 
 // Additional helper methods for protocol conversion
@@ -514,7 +572,7 @@ func (pc *ProtocolConverter) validateConversionRequest(req *ConversionRequest) e
 	}
 
 	// Validate supported protocols
-	supportedProtocols := []string{"http", "https", "grpc", "grpcs"}
+	supportedProtocols := []string{"http", "https", "grpc", "grpcs", "grpc-web"}
 	sourceSupported := false
 	targetSupported := false
 
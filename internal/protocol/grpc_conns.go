@@ -0,0 +1,241 @@
+package protocol
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/security"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// minEvictInterval keeps very short idle timeouts from spinning the evictor
+const minEvictInterval = time.Second
+
+// grpcConn 缓存的 gRPC 连接及其最近一次使用时间
+type grpcConn struct {
+	conn     *grpc.ClientConn
+	lastUsed atomic.Int64 // unix nanoseconds
+}
+
+func (gc *grpcConn) touch(now time.Time) {
+	gc.lastUsed.Store(now.UnixNano())
+}
+
+// usable reports whether the connection may be reused. A channel in
+// TransientFailure keeps backing off towards an upstream that may have come
+// back on a new address or process; dialing afresh reconnects at once.
+func (gc *grpcConn) usable() bool {
+	switch gc.conn.GetState() {
+	case connectivity.TransientFailure, connectivity.Shutdown:
+		return false
+	default:
+		return true
+	}
+}
+
+// grpcTarget returns the cache key and dial address of a gRPC endpoint; the
+// path naming the method is not part of either
+func grpcTarget(endpoint string) (key, address string, secure bool, err error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to parse gRPC endpoint: %w", err)
+	}
+
+	address = u.Host
+	if u.Port() == "" {
+		if u.Scheme == "grpcs" {
+			address += ":443"
+		} else {
+			address += ":80"
+		}
+	}
+	secure = u.Scheme == "grpcs"
+	return u.Scheme + "://" + address, address, secure, nil
+}
+
+// getGRPCConnection returns the cached connection to endpoint's server,
+// dialing a new one when there is none or the cached one has failed
+func (pc *ProtocolConverter) getGRPCConnection(endpoint string) (*grpc.ClientConn, error) {
+	key, address, secure, err := grpcTarget(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	pc.connsMutex.RLock()
+	cached, exists := pc.grpcConns[key]
+	pc.connsMutex.RUnlock()
+	if exists && cached.usable() {
+		cached.touch(time.Now())
+		return cached.conn, nil
+	}
+
+	pc.connsMutex.Lock()
+	defer pc.connsMutex.Unlock()
+	// Another request may have redialed while we waited for the lock
+	if cached, exists := pc.grpcConns[key]; exists {
+		if cached.usable() {
+			cached.touch(time.Now())
+			return cached.conn, nil
+		}
+		logrus.WithFields(logrus.Fields{
+			"endpoint": key,
+			"state":    cached.conn.GetState().String(),
+		}).Warn("Replacing failed gRPC connection")
+		cached.conn.Close()
+		delete(pc.grpcConns, key)
+	}
+
+	transport, err := pc.grpcTransportCredentials(address, secure)
+	if err != nil {
+		return nil, err
+	}
+	egressDial := httpclient.EgressDialContext("protocol_conversion", nil)
+	conn, err := grpc.Dial(address,
+		grpc.WithTransportCredentials(transport),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			return egressDial(ctx, "tcp", addr)
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial gRPC server: %w", err)
+	}
+
+	entry := &grpcConn{conn: conn}
+	entry.touch(time.Now())
+	pc.grpcConns[key] = entry
+	return conn, nil
+}
+
+// grpcTransportCredentials returns TLS credentials for grpcs endpoints and
+// endpoints with TLS settings of their own, insecure ones otherwise. Without
+// endpoint settings TLS uses the upstream mutual TLS configuration if any.
+func (pc *ProtocolConverter) grpcTransportCredentials(address string, secure bool) (credentials.TransportCredentials, error) {
+	endpoint, configured := pc.config.GRPCTLS[address]
+	if !secure && !configured {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if transport := security.UpstreamTransport(); transport != nil && transport.TLSClientConfig != nil {
+		tlsConfig = transport.TLSClientConfig.Clone()
+	}
+	if configured {
+		if err := applyGRPCEndpointTLS(tlsConfig, endpoint); err != nil {
+			return nil, fmt.Errorf("gRPC TLS for %s: %w", address, err)
+		}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// applyGRPCEndpointTLS loads an endpoint's CA bundle and client certificate into tlsConfig
+func applyGRPCEndpointTLS(tlsConfig *tls.Config, endpoint config.GRPCEndpointTLSConfig) error {
+	if endpoint.CAFile != "" {
+		pem, err := os.ReadFile(endpoint.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("CA file %s contains no PEM certificates", endpoint.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if endpoint.CertFile != "" || endpoint.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(endpoint.CertFile, endpoint.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if endpoint.ServerName != "" {
+		tlsConfig.ServerName = endpoint.ServerName
+	}
+	return nil
+}
+
+// evictIdleConns closes the connections unused since before now - idle and
+// returns how many were closed
+func (pc *ProtocolConverter) evictIdleConns(now time.Time, idle time.Duration) int {
+	cutoff := now.Add(-idle).UnixNano()
+	pc.connsMutex.Lock()
+	defer pc.connsMutex.Unlock()
+
+	evicted := 0
+	for key, cached := range pc.grpcConns {
+		if cached.lastUsed.Load() >= cutoff {
+			continue
+		}
+		if err := cached.conn.Close(); err != nil {
+			logrus.WithError(err).WithField("endpoint", key).Warn("Failed to close idle gRPC connection")
+		}
+		delete(pc.grpcConns, key)
+		evicted++
+	}
+	return evicted
+}
+
+// idleEvictor closes idle connections until ctx is cancelled
+func (pc *ProtocolConverter) idleEvictor(ctx context.Context, idle time.Duration) {
+	interval := idle / 2
+	if interval < minEvictInterval {
+		interval = minEvictInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if evicted := pc.evictIdleConns(now, idle); evicted > 0 {
+				logrus.WithField("connections", evicted).Debug("Closed idle gRPC connections")
+			}
+		}
+	}
+}
+
+// Start marks the converter running and starts closing idle connections;
+// gRPC connections are dialed on first use
+func (pc *ProtocolConverter) Start(ctx context.Context) error {
+	return pc.lifecycle.Start(func() error {
+		if idle := pc.config.GRPCIdleTimeout; idle > 0 {
+			evictCtx, cancel := context.WithCancel(context.Background())
+			pc.stopEvictor = cancel
+			go pc.idleEvictor(evictCtx, idle)
+		}
+		return nil
+	})
+}
+
+// Close closes the cached gRPC connections; it is safe to call more than once
+func (pc *ProtocolConverter) Close() error {
+	return pc.lifecycle.Close(func() error {
+		if pc.stopEvictor != nil {
+			pc.stopEvictor()
+		}
+		pc.connsMutex.Lock()
+		defer pc.connsMutex.Unlock()
+		for endpoint, cached := range pc.grpcConns {
+			if err := cached.conn.Close(); err != nil {
+				logrus.WithError(err).WithField("endpoint", endpoint).Error("Failed to close gRPC connection")
+			}
+		}
+		pc.grpcConns = make(map[string]*grpcConn)
+		return nil
+	})
+}
@@ -0,0 +1,226 @@
+package protocol
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// startHealthServer serves the standard health service with opts
+func startHealthServer(t *testing.T, opts ...grpc.ServerOption) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := grpc.NewServer(opts...)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+func checkHealth(t *testing.T, conn *grpc.ClientConn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func TestGRPCConnectionsAreSharedAcrossMethods(t *testing.T) {
+	addr := startHealthServer(t)
+	pc := newTestConverter(t)
+
+	var wg sync.WaitGroup
+	conns := make([]*grpc.ClientConn, 50)
+	for i := range conns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := pc.getGRPCConnection("grpc://" + addr + "/grpc.health.v1.Health/Check")
+			assert.NoError(t, err)
+			conns[i] = conn
+		}(i)
+	}
+	wg.Wait()
+	for _, conn := range conns {
+		assert.Same(t, conns[0], conn, "concurrent requests share one connection")
+	}
+
+	other, err := pc.getGRPCConnection("grpc://" + addr + "/grpc.health.v1.Health/Watch")
+	require.NoError(t, err)
+	assert.Same(t, conns[0], other, "the method path does not split the cache")
+	assert.Len(t, pc.grpcConns, 1)
+	require.NoError(t, checkHealth(t, other))
+}
+
+func TestGRPCConnectionIsReplacedAfterFailure(t *testing.T) {
+	addr := startHealthServer(t)
+	pc := newTestConverter(t)
+	endpoint := "grpc://" + addr + "/grpc.health.v1.Health/Check"
+
+	conn, err := pc.getGRPCConnection(endpoint)
+	require.NoError(t, err)
+	conn.Close()
+
+	replaced, err := pc.getGRPCConnection(endpoint)
+	require.NoError(t, err)
+	assert.NotSame(t, conn, replaced, "a shut down connection is redialed")
+	require.NoError(t, checkHealth(t, replaced))
+
+	// A connection whose upstream is gone ends up in TransientFailure
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	deadAddr := lis.Addr().String()
+	lis.Close()
+	dead, err := pc.getGRPCConnection("grpc://" + deadAddr + "/grpc.health.v1.Health/Check")
+	require.NoError(t, err)
+	dead.Connect()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for state := dead.GetState(); state != connectivity.TransientFailure; state = dead.GetState() {
+		require.True(t, dead.WaitForStateChange(ctx, state), "connection never failed")
+	}
+
+	redialed, err := pc.getGRPCConnection("grpc://" + deadAddr + "/grpc.health.v1.Health/Check")
+	require.NoError(t, err)
+	assert.NotSame(t, dead, redialed)
+	assert.Equal(t, connectivity.Shutdown, dead.GetState(), "the failed connection is closed")
+}
+
+func TestEvictIdleGRPCConnections(t *testing.T) {
+	addr := startHealthServer(t)
+	pc := newTestConverter(t)
+
+	conn, err := pc.getGRPCConnection("grpc://" + addr)
+	require.NoError(t, err)
+
+	assert.Zero(t, pc.evictIdleConns(time.Now(), time.Minute), "recently used connections stay")
+	assert.Equal(t, 1, pc.evictIdleConns(time.Now().Add(2*time.Minute), time.Minute))
+	assert.Empty(t, pc.grpcConns)
+	assert.Equal(t, connectivity.Shutdown, conn.GetState())
+}
+
+func TestIdleEvictorRunsWhileStarted(t *testing.T) {
+	addr := startHealthServer(t)
+	pc := NewProtocolConverter(&config.ProtocolConversionConfig{Enabled: true, GRPCSupport: true, GRPCIdleTimeout: time.Millisecond})
+	require.NoError(t, pc.Start(context.Background()))
+	defer pc.Close()
+
+	conn, err := pc.getGRPCConnection("grpc://" + addr)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return conn.GetState() == connectivity.Shutdown
+	}, 5*time.Second, 50*time.Millisecond, "the idle connection is closed by the evictor")
+}
+
+// writeTestPKI writes a CA and a server and a client certificate it signed
+// to dir, returning the server's TLS certificate and the CA pool
+func writeTestPKI(t *testing.T, dir string) (tls.Certificate, *x509.CertPool) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "grpc-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+
+	issue := func(serial int64, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}, caCert, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+
+	serverCert, serverKey := issue(2, "upstream.internal", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := issue(3, "ai-gateway", x509.ExtKeyUsageClientAuth)
+	for name, data := range map[string][]byte{
+		"ca.pem":     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		"client.pem": clientCert,
+		"client.key": clientKey,
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), data, 0o600))
+	}
+	pair, err := tls.X509KeyPair(serverCert, serverKey)
+	require.NoError(t, err)
+	return pair, pool
+}
+
+func TestGRPCEndpointTLSPresentsClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, pool := writeTestPKI(t, dir)
+	addr := startHealthServer(t, grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})))
+
+	pc := NewProtocolConverter(&config.ProtocolConversionConfig{Enabled: true, GRPCSupport: true, GRPCTLS: map[string]config.GRPCEndpointTLSConfig{
+		addr: {
+			CAFile:     filepath.Join(dir, "ca.pem"),
+			CertFile:   filepath.Join(dir, "client.pem"),
+			KeyFile:    filepath.Join(dir, "client.key"),
+			ServerName: "upstream.internal",
+		},
+	}})
+	defer pc.Close()
+
+	conn, err := pc.getGRPCConnection("grpc://" + addr)
+	require.NoError(t, err)
+	assert.NoError(t, checkHealth(t, conn), "the endpoint's CA and client certificate are used")
+
+	// Without the endpoint settings the server rejects the connection
+	plain := NewProtocolConverter(&config.ProtocolConversionConfig{Enabled: true, GRPCSupport: true})
+	defer plain.Close()
+	conn, err = plain.getGRPCConnection("grpcs://" + addr)
+	require.NoError(t, err)
+	assert.Error(t, checkHealth(t, conn))
+
+	broken := NewProtocolConverter(&config.ProtocolConversionConfig{Enabled: true, GRPCTLS: map[string]config.GRPCEndpointTLSConfig{
+		addr: {CAFile: filepath.Join(dir, "missing.pem")},
+	}})
+	defer broken.Close()
+	_, err = broken.getGRPCConnection("grpc://" + addr)
+	assert.ErrorContains(t, err, "failed to read CA file")
+}
@@ -0,0 +1,152 @@
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// resolveMethod 通过上游的 gRPC 服务反射查找方法描述，结果按连接缓存。
+// parseGRPCServiceMethod 会给方法名加上 Get/Create 等前缀；找不到带前缀的方法时
+// 退回到路径中的原始方法名。
+func (pc *ProtocolConverter) resolveMethod(ctx context.Context, conn *grpc.ClientConn, service string, methods ...string) (protoreflect.MethodDescriptor, error) {
+	pc.methodsMutex.Lock()
+	for _, method := range methods {
+		if md, ok := pc.methods[conn.Target()+"/"+service+"/"+method]; ok {
+			pc.methodsMutex.Unlock()
+			return md, nil
+		}
+	}
+	pc.methodsMutex.Unlock()
+
+	files, err := fetchServiceFiles(ctx, conn, service)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(service))
+	if err != nil {
+		return nil, status.Errorf(codes.NotFound, "service %s not found: %v", service, err)
+	}
+	sd, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "%s is not a service", service)
+	}
+	for _, method := range methods {
+		md := sd.Methods().ByName(protoreflect.Name(method))
+		if md == nil {
+			continue
+		}
+		pc.methodsMutex.Lock()
+		pc.methods[conn.Target()+"/"+service+"/"+method] = md
+		pc.methodsMutex.Unlock()
+		return md, nil
+	}
+	return nil, status.Errorf(codes.Unimplemented, "service %s has no method %v", service, methods)
+}
+
+// fetchServiceFiles asks the server reflection service for the file defining
+// service and the files it imports
+func fetchServiceFiles(ctx context.Context, conn *grpc.ClientConn, service string) (*protoregistry.Files, error) {
+	stream, err := rpb.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend()
+
+	fdps := make(map[string]*descriptorpb.FileDescriptorProto)
+	request := &rpb.ServerReflectionRequest{
+		MessageRequest: &rpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service},
+	}
+	for request != nil {
+		if err := stream.Send(request); err != nil {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if errResp := resp.GetErrorResponse(); errResp != nil {
+			return nil, status.Error(codes.Code(errResp.ErrorCode), errResp.ErrorMessage)
+		}
+		for _, raw := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fdp := &descriptorpb.FileDescriptorProto{}
+			if err := proto.Unmarshal(raw, fdp); err != nil {
+				return nil, fmt.Errorf("invalid file descriptor from reflection: %w", err)
+			}
+			fdps[fdp.GetName()] = fdp
+		}
+
+		// Ask for the first import the server has not sent yet; well-known
+		// types compiled into the gateway need no round trip
+		request = nil
+		for _, fdp := range fdps {
+			for _, dep := range fdp.GetDependency() {
+				if _, ok := fdps[dep]; ok {
+					continue
+				}
+				if fd, err := protoregistry.GlobalFiles.FindFileByPath(dep); err == nil {
+					fdps[dep] = protodesc.ToFileDescriptorProto(fd)
+					continue
+				}
+				request = &rpb.ServerReflectionRequest{
+					MessageRequest: &rpb.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+				}
+				break
+			}
+			if request != nil {
+				break
+			}
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, fdp := range fdps {
+		set.File = append(set.File, fdp)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptors from reflection: %w", err)
+	}
+	return files, nil
+}
+
+// httpStatusFromGRPC maps a gRPC status code to the HTTP status a REST
+// client expects, as grpc-gateway does
+func httpStatusFromGRPC(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,139 @@
+package protocol
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// startReflectiveGreeter serves helloworld.Greeter together with the server
+// reflection service describing it, and returns the server address
+func startReflectiveGreeter(t *testing.T) string {
+	file := helloworldFile(t)
+	request, reply := file.Messages().ByName("HelloRequest"), file.Messages().ByName("HelloReply")
+
+	files := &protoregistry.Files{}
+	require.NoError(t, files.RegisterFile(file))
+
+	srv := grpc.NewServer()
+	srv.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "helloworld.Greeter",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "SayHello",
+			Handler: func(_ interface{}, ctx context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				in := dynamicpb.NewMessage(request)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				name := in.Get(request.Fields().ByName("name")).String()
+				if name == "" {
+					return nil, status.Error(codes.InvalidArgument, "name is required")
+				}
+				grpc.SetHeader(ctx, metadata.Pairs("x-greeter", "v1"))
+				out := dynamicpb.NewMessage(reply)
+				out.Set(reply.Fields().ByName("message"), protoreflect.ValueOfString("Hello "+name))
+				return out, nil
+			},
+		}},
+		Metadata: "helloworld.proto",
+	}, struct{}{})
+	// The descriptors are not compiled into the test binary, so the
+	// reflection service resolves them from a registry of its own
+	rpb.RegisterServerReflectionServer(srv, reflection.NewServerV1(reflection.ServerOptions{
+		Services:           srv,
+		DescriptorResolver: files,
+	}))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+func TestConvertHTTPSToGRPCUsesReflection(t *testing.T) {
+	addr := startReflectiveGreeter(t)
+	pc := newTestConverter(t)
+
+	resp, err := pc.Convert(context.Background(), &ConversionRequest{
+		SourceProtocol: "https",
+		TargetProtocol: "grpc",
+		Endpoint:       "grpc://" + addr + "/helloworld.Greeter/SayHello",
+		Method:         "POST",
+		Body:           map[string]interface{}{"name": "gateway"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, map[string]interface{}{"message": "Hello gateway"}, resp.Body, "the reply comes from the server")
+	assert.Equal(t, "SayHello", resp.Metadata["method"], "the verb-prefixed CreateSayHello falls back to the path's method")
+	assert.Equal(t, "v1", resp.Headers["X-Greeter"])
+	assert.Len(t, pc.methods, 1, "the resolved method is cached")
+
+	// The cached descriptor serves the next call
+	resp, err = pc.Convert(context.Background(), &ConversionRequest{
+		SourceProtocol: "https",
+		TargetProtocol: "grpc",
+		Endpoint:       "grpc://" + addr + "/helloworld.Greeter/SayHello",
+		Method:         "POST",
+		Body:           map[string]interface{}{"name": "again"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"message": "Hello again"}, resp.Body)
+}
+
+func TestConvertHTTPSToGRPCErrors(t *testing.T) {
+	addr := startReflectiveGreeter(t)
+	pc := newTestConverter(t)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       interface{}
+		statusCode int
+		grpcStatus string
+	}{
+		{"unknown service", "/helloworld.Missing/SayHello", map[string]interface{}{"name": "x"}, 502, "NotFound"},
+		{"unknown method", "/helloworld.Greeter/SayGoodbye", map[string]interface{}{"name": "x"}, 502, "Unimplemented"},
+		{"server rejects request", "/helloworld.Greeter/SayHello", map[string]interface{}{}, 400, "InvalidArgument"},
+		{"body does not match message", "/helloworld.Greeter/SayHello", map[string]interface{}{"nickname": "x"}, 400, "InvalidArgument"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := pc.Convert(context.Background(), &ConversionRequest{
+				SourceProtocol: "https",
+				TargetProtocol: "grpc",
+				Endpoint:       "grpc://" + addr + tt.path,
+				Method:         "POST",
+				Body:           tt.body,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode)
+			assert.Equal(t, tt.grpcStatus, resp.Metadata["grpc_status"])
+			assert.NotEmpty(t, resp.Error)
+			body := resp.Body.(map[string]interface{})["error"].(map[string]interface{})
+			assert.Equal(t, tt.grpcStatus, body["code"])
+		})
+	}
+}
+
+func TestHTTPStatusFromGRPC(t *testing.T) {
+	assert.Equal(t, 200, httpStatusFromGRPC(codes.OK))
+	assert.Equal(t, 404, httpStatusFromGRPC(codes.NotFound))
+	assert.Equal(t, 429, httpStatusFromGRPC(codes.ResourceExhausted))
+	assert.Equal(t, 503, httpStatusFromGRPC(codes.Unavailable))
+	assert.Equal(t, 504, httpStatusFromGRPC(codes.DeadlineExceeded))
+	assert.Equal(t, 500, httpStatusFromGRPC(codes.DataLoss))
+}
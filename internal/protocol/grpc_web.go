@@ -0,0 +1,257 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-aigateway/internal/httpclient"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// gRPC-Web 帧格式：1 字节标志 + 4 字节大端长度 + 数据。标志最高位表示 trailer 帧，
+// 最低位表示压缩数据。
+const (
+	grpcWebFrameHeaderSize = 5
+	grpcWebFlagCompressed  = 0x01
+	grpcWebFlagTrailer     = 0x80
+)
+
+// GRPCWebContentType is the content type of binary gRPC-Web requests and responses
+const GRPCWebContentType = "application/grpc-web+proto"
+
+// grpcWebSkippedHeaders are HTTP/1.1 and gRPC-Web headers that must not be
+// forwarded to the upstream as gRPC metadata
+var grpcWebSkippedHeaders = map[string]bool{
+	"content-type":   true,
+	"content-length": true,
+	"connection":     true,
+	"host":           true,
+	"te":             true,
+	"accept":         true,
+	"x-grpc-web":     true,
+	"x-user-agent":   true,
+}
+
+// IsGRPCWebContentType reports whether contentType marks a binary gRPC-Web request
+func IsGRPCWebContentType(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return mediaType == "application/grpc-web" || mediaType == GRPCWebContentType
+}
+
+// rawCodec passes protobuf payloads through untouched, so the converter can
+// forward messages without knowing their types
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	data, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("raw codec cannot marshal %T", v)
+	}
+	return *data, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	target, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("raw codec cannot unmarshal into %T", v)
+	}
+	*target = append((*target)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// webToGRPC unwraps a unary gRPC-Web call, invokes the method named by the
+// endpoint path on the upstream gRPC server and wraps the reply and trailers
+// in gRPC-Web framing. A call failing with a gRPC status is still a 200
+// response; the status travels in the trailer frame as gRPC-Web requires.
+func (pc *ProtocolConverter) webToGRPC(ctx context.Context, req *ConversionRequest) (*ConversionResponse, error) {
+	if !pc.config.GRPCSupport {
+		return nil, fmt.Errorf("gRPC support not enabled")
+	}
+	if req.Method != "" && req.Method != http.MethodPost {
+		return nil, fmt.Errorf("gRPC-Web requests must use POST, got %s", req.Method)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"source":   "grpc-web",
+		"target":   req.TargetProtocol,
+		"endpoint": req.Endpoint,
+	}).Info("Converting gRPC-Web to gRPC")
+
+	body, err := grpcWebBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := decodeGRPCWebRequest(body)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(req.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse gRPC endpoint: %w", err)
+	}
+	fullMethod := "/" + strings.Trim(u.Path, "/")
+	if strings.Count(fullMethod, "/") != 2 {
+		return nil, fmt.Errorf("gRPC-Web endpoint path must be /package.Service/Method, got %q", u.Path)
+	}
+
+	conn, err := pc.getGRPCConnection(req.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get gRPC connection: %w", err)
+	}
+	if _, _, err := httpclient.RemainingBudget(ctx, 0); err != nil {
+		return nil, err
+	}
+
+	md := metadata.MD{}
+	for key, value := range req.Headers {
+		if key = strings.ToLower(key); !grpcWebSkippedHeaders[key] {
+			md.Append(key, value)
+		}
+	}
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		propagation.TraceContext{}.Inject(ctx, metadataCarrier(md))
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	var reply []byte
+	var header, trailer metadata.MD
+	callErr := conn.Invoke(ctx, fullMethod, &payload, &reply,
+		grpc.ForceCodec(rawCodec{}), grpc.Header(&header), grpc.Trailer(&trailer))
+	st := status.Convert(callErr)
+
+	headers := map[string]string{
+		"Content-Type":          GRPCWebContentType,
+		"X-Protocol-Conversion": "grpc-to-grpc-web",
+	}
+	for key, values := range header {
+		if len(values) > 0 {
+			headers[key] = values[0]
+		}
+	}
+
+	var framed bytes.Buffer
+	if callErr == nil {
+		writeGRPCWebFrame(&framed, 0, reply)
+	}
+	writeGRPCWebFrame(&framed, grpcWebFlagTrailer, encodeGRPCWebTrailers(st, trailer))
+
+	resp := &ConversionResponse{
+		StatusCode: http.StatusOK,
+		Headers:    headers,
+		Body:       framed.Bytes(),
+		Metadata: map[string]interface{}{
+			"conversion":  "grpc-web-to-grpc",
+			"method":      fullMethod,
+			"grpc_status": st.Code().String(),
+		},
+	}
+	if callErr != nil {
+		resp.Error = st.Message()
+	}
+	return resp, nil
+}
+
+// grpcWebBody returns the raw POST body of a gRPC-Web conversion request
+func grpcWebBody(body interface{}) ([]byte, error) {
+	switch b := body.(type) {
+	case []byte:
+		return b, nil
+	case io.Reader:
+		data, err := io.ReadAll(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gRPC-Web body: %w", err)
+		}
+		return data, nil
+	case nil:
+		return nil, fmt.Errorf("gRPC-Web request has no body")
+	default:
+		return nil, fmt.Errorf("gRPC-Web body must be raw bytes, got %T", body)
+	}
+}
+
+// decodeGRPCWebRequest strips the framing of a unary request and returns its
+// single protobuf message
+func decodeGRPCWebRequest(body []byte) ([]byte, error) {
+	if len(body) < grpcWebFrameHeaderSize {
+		return nil, fmt.Errorf("gRPC-Web body too short for a frame header")
+	}
+	flags := body[0]
+	if flags&grpcWebFlagTrailer != 0 {
+		return nil, fmt.Errorf("gRPC-Web request starts with a trailer frame")
+	}
+	if flags&grpcWebFlagCompressed != 0 {
+		return nil, fmt.Errorf("compressed gRPC-Web messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(body[1:grpcWebFrameHeaderSize])
+	if uint64(len(body)-grpcWebFrameHeaderSize) < uint64(length) {
+		return nil, fmt.Errorf("gRPC-Web frame declares %d bytes but %d follow", length, len(body)-grpcWebFrameHeaderSize)
+	}
+	end := grpcWebFrameHeaderSize + int(length)
+	if end != len(body) {
+		return nil, fmt.Errorf("gRPC-Web request carries more than one message")
+	}
+	return body[grpcWebFrameHeaderSize:end], nil
+}
+
+// writeGRPCWebFrame appends one frame with the given flags to buf
+func writeGRPCWebFrame(buf *bytes.Buffer, flags byte, data []byte) {
+	var header [grpcWebFrameHeaderSize]byte
+	header[0] = flags
+	binary.BigEndian.PutUint32(header[1:], uint32(len(data)))
+	buf.Write(header[:])
+	buf.Write(data)
+}
+
+// encodeGRPCWebTrailers formats the call status and trailer metadata as
+// HTTP/1.1 header lines, the body of a gRPC-Web trailer frame
+func encodeGRPCWebTrailers(st *status.Status, trailer metadata.MD) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("grpc-status: " + strconv.Itoa(int(st.Code())) + "\r\n")
+	buf.WriteString("grpc-message: " + percentEncodeGRPCMessage(st.Message()) + "\r\n")
+
+	keys := make([]string, 0, len(trailer))
+	for key := range trailer {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range trailer[key] {
+			buf.WriteString(key + ": " + value + "\r\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// percentEncodeGRPCMessage escapes a status message as the gRPC spec requires:
+// '%' and bytes outside printable ASCII become %XX
+func percentEncodeGRPCMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,226 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"go-aigateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// helloworldFile builds the descriptor of the gRPC helloworld example:
+// helloworld.Greeter/SayHello taking a HelloRequest and returning a HelloReply
+func helloworldFile(t *testing.T) protoreflect.FileDescriptor {
+	stringField := func(name string) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			Number:   proto.Int32(1),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+			JsonName: proto.String(name),
+		}
+	}
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("helloworld.proto"),
+		Package: proto.String("helloworld"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("HelloRequest"), Field: []*descriptorpb.FieldDescriptorProto{stringField("name")}},
+			{Name: proto.String("HelloReply"), Field: []*descriptorpb.FieldDescriptorProto{stringField("message")}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("Greeter"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("SayHello"),
+				InputType:  proto.String(".helloworld.HelloRequest"),
+				OutputType: proto.String(".helloworld.HelloReply"),
+			}},
+		}},
+	}, nil)
+	require.NoError(t, err)
+	return file
+}
+
+// helloworldMessages returns helloworld.HelloRequest and helloworld.HelloReply
+func helloworldMessages(t *testing.T) (request, reply protoreflect.MessageDescriptor) {
+	file := helloworldFile(t)
+	return file.Messages().ByName("HelloRequest"), file.Messages().ByName("HelloReply")
+}
+
+// startGreeter serves helloworld.Greeter/SayHello, decoding the messages dynamically
+func startGreeter(t *testing.T) string {
+	request, reply := helloworldMessages(t)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}), grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		if method != "/helloworld.Greeter/SayHello" {
+			return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+		}
+		var payload []byte
+		if err := stream.RecvMsg(&payload); err != nil {
+			return err
+		}
+		in := dynamicpb.NewMessage(request)
+		if err := proto.Unmarshal(payload, in); err != nil {
+			return err
+		}
+		name := in.Get(request.Fields().ByName("name")).String()
+		if name == "" {
+			return status.Error(codes.InvalidArgument, "name is required: 100%")
+		}
+
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		stream.SetHeader(metadata.Pairs("x-greeter", "v1"))
+		stream.SetTrailer(metadata.Pairs("x-caller", strings.Join(md.Get("x-caller"), ",")))
+
+		out := dynamicpb.NewMessage(reply)
+		out.Set(reply.Fields().ByName("message"), protoreflect.ValueOfString("Hello "+name))
+		data, err := proto.Marshal(out)
+		if err != nil {
+			return err
+		}
+		return stream.SendMsg(&data)
+	}))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return "grpc://" + lis.Addr().String() + "/helloworld.Greeter/SayHello"
+}
+
+func grpcWebFrame(flags byte, data []byte) []byte {
+	var buf bytes.Buffer
+	writeGRPCWebFrame(&buf, flags, data)
+	return buf.Bytes()
+}
+
+// readGRPCWebFrames splits a gRPC-Web response body into its frames
+func readGRPCWebFrames(t *testing.T, body []byte) (flags []byte, frames [][]byte) {
+	for len(body) > 0 {
+		require.GreaterOrEqual(t, len(body), grpcWebFrameHeaderSize)
+		length := int(binary.BigEndian.Uint32(body[1:grpcWebFrameHeaderSize]))
+		require.GreaterOrEqual(t, len(body), grpcWebFrameHeaderSize+length)
+		flags = append(flags, body[0])
+		frames = append(frames, body[grpcWebFrameHeaderSize:grpcWebFrameHeaderSize+length])
+		body = body[grpcWebFrameHeaderSize+length:]
+	}
+	return flags, frames
+}
+
+func newTestConverter(t *testing.T) *ProtocolConverter {
+	pc := NewProtocolConverter(&config.ProtocolConversionConfig{Enabled: true, GRPCSupport: true})
+	t.Cleanup(func() { pc.Close() })
+	return pc
+}
+
+func TestConvertGRPCWebToGRPC(t *testing.T) {
+	endpoint := startGreeter(t)
+	request, reply := helloworldMessages(t)
+	pc := newTestConverter(t)
+
+	hello := dynamicpb.NewMessage(request)
+	hello.Set(request.Fields().ByName("name"), protoreflect.ValueOfString("gateway"))
+	payload, err := proto.Marshal(hello)
+	require.NoError(t, err)
+
+	resp, err := pc.Convert(context.Background(), &ConversionRequest{
+		TargetProtocol: "grpc",
+		Endpoint:       endpoint,
+		Method:         "POST",
+		Headers:        map[string]string{"Content-Type": GRPCWebContentType, "X-Grpc-Web": "1", "X-Caller": "browser"},
+		Body:           grpcWebFrame(0, payload),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, GRPCWebContentType, resp.Headers["Content-Type"])
+	assert.Equal(t, "v1", resp.Headers["x-greeter"], "response headers are passed on")
+	assert.Empty(t, resp.Error)
+
+	flags, frames := readGRPCWebFrames(t, resp.Body.([]byte))
+	require.Equal(t, []byte{0, grpcWebFlagTrailer}, flags, "a message frame followed by the trailers")
+
+	out := dynamicpb.NewMessage(reply)
+	require.NoError(t, proto.Unmarshal(frames[0], out))
+	assert.Equal(t, "Hello gateway", out.Get(reply.Fields().ByName("message")).String())
+	assert.Equal(t, "grpc-status: 0\r\ngrpc-message: \r\nx-caller: browser\r\n", string(frames[1]))
+}
+
+func TestConvertGRPCWebCarriesStatusInTrailers(t *testing.T) {
+	endpoint := startGreeter(t)
+	request, _ := helloworldMessages(t)
+	pc := newTestConverter(t)
+
+	payload, err := proto.Marshal(dynamicpb.NewMessage(request))
+	require.NoError(t, err)
+	resp, err := pc.Convert(context.Background(), &ConversionRequest{
+		SourceProtocol: "grpc-web",
+		TargetProtocol: "grpc",
+		Endpoint:       endpoint,
+		Body:           bytes.NewReader(grpcWebFrame(0, payload)),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode, "gRPC-Web reports call errors in the trailers")
+	assert.Equal(t, "name is required: 100%", resp.Error)
+
+	flags, frames := readGRPCWebFrames(t, resp.Body.([]byte))
+	require.Equal(t, []byte{grpcWebFlagTrailer}, flags)
+	assert.Contains(t, string(frames[0]), "grpc-status: 3\r\n")
+	assert.Contains(t, string(frames[0]), "grpc-message: name is required: 100%25\r\n")
+}
+
+func TestDecodeGRPCWebRequestRejectsBadFraming(t *testing.T) {
+	for name, body := range map[string][]byte{
+		"short header":   {0, 0, 0},
+		"truncated":      {0, 0, 0, 0, 9, 1, 2},
+		"trailer first":  grpcWebFrame(grpcWebFlagTrailer, []byte("grpc-status: 0\r\n")),
+		"compressed":     grpcWebFrame(grpcWebFlagCompressed, []byte{1}),
+		"two messages":   append(grpcWebFrame(0, []byte{1}), grpcWebFrame(0, []byte{2})...),
+		"trailing stray": append(grpcWebFrame(0, []byte{1}), 0xff),
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := decodeGRPCWebRequest(body)
+			assert.Error(t, err)
+		})
+	}
+
+	payload, err := decodeGRPCWebRequest(grpcWebFrame(0, []byte{}))
+	require.NoError(t, err)
+	assert.Empty(t, payload, "an empty message is valid")
+}
+
+func TestGRPCWebValidation(t *testing.T) {
+	assert.True(t, IsGRPCWebContentType("application/grpc-web+proto"))
+	assert.True(t, IsGRPCWebContentType("application/grpc-web; charset=utf-8"))
+	assert.False(t, IsGRPCWebContentType("application/grpc-web-text"))
+	assert.False(t, IsGRPCWebContentType("application/json"))
+
+	pc := newTestConverter(t)
+	assert.NoError(t, pc.validateConversionRequest(&ConversionRequest{SourceProtocol: "grpc-web", TargetProtocol: "grpc", Endpoint: "grpc://x/a.B/C"}))
+
+	_, err := pc.Convert(context.Background(), &ConversionRequest{
+		SourceProtocol: "grpc-web", TargetProtocol: "grpc", Endpoint: "grpc://127.0.0.1:1/helloworld.Greeter/SayHello",
+		Method: "GET", Body: grpcWebFrame(0, nil),
+	})
+	assert.ErrorContains(t, err, "must use POST")
+
+	_, err = pc.Convert(context.Background(), &ConversionRequest{
+		SourceProtocol: "grpc-web", TargetProtocol: "grpc", Endpoint: "grpc://127.0.0.1:1/SayHello",
+		Body: grpcWebFrame(0, nil),
+	})
+	assert.ErrorContains(t, err, "/package.Service/Method")
+}
@@ -0,0 +1,83 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go-aigateway/internal/httpclient"
+)
+
+// ErrProbeOnly is returned by EndpointProvider for anything but health checks
+var ErrProbeOnly = errors.New("endpoint provider only serves health checks")
+
+// EndpointProvider OpenAI兼容上游的探测器。请求由网关直接代理到该上游，
+// 这里只负责主动健康检查，让管理器的健康检查覆盖配置的上游。
+type EndpointProvider struct {
+	name   string
+	config *ProviderConfig
+	client *http.Client
+}
+
+// NewEndpointProvider creates a probe for the upstream at config.BaseURL
+func NewEndpointProvider(name string, config *ProviderConfig) *EndpointProvider {
+	return &EndpointProvider{
+		name:   name,
+		config: config,
+		client: httpclient.NewClient("provider_"+name, config.Timeout),
+	}
+}
+
+// GetName 获取提供商名称
+func (p *EndpointProvider) GetName() string {
+	return p.name
+}
+
+// GetModels 不返回模型，管理器不会把请求路由到探测器
+func (p *EndpointProvider) GetModels() []Model {
+	return nil
+}
+
+// GetConfig 获取配置
+func (p *EndpointProvider) GetConfig() *ProviderConfig {
+	return p.config
+}
+
+// Chat 聊天补全
+func (p *EndpointProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	return nil, ErrProbeOnly
+}
+
+// ChatStream 流式聊天补全
+func (p *EndpointProvider) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatStreamResponse, error) {
+	return nil, ErrProbeOnly
+}
+
+// Embeddings 文本嵌入
+func (p *EndpointProvider) Embeddings(ctx context.Context, req *EmbeddingsRequest) (*EmbeddingsResponse, error) {
+	return nil, ErrProbeOnly
+}
+
+// HealthCheck 请求上游的模型列表，不消耗token；连接失败或5xx视为不健康
+func (p *EndpointProvider) HealthCheck(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(p.config.BaseURL, "/")+"/models", nil)
+	if err != nil {
+		return err
+	}
+	if p.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.config.APIKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"sync"
 	"time"
+
+	"go-aigateway/internal/upstream"
 )
 
 // HealthChecker 健康检查器
@@ -83,6 +85,7 @@ func (hc *HealthChecker) checkProvider(name string, provider Provider) {
 
 	// 执行健康检查
 	err := provider.HealthCheck(ctx)
+	upstream.DefaultRegistry().RecordActiveCheck(upstreamName(name, provider), err == nil)
 
 	// 更新状态
 	hc.manager.mu.Lock()
@@ -102,3 +105,11 @@ func (hc *HealthChecker) checkProvider(name string, provider Provider) {
 		}
 	}
 }
+
+// upstreamName 返回提供商上游在健康注册表中的标识，与代理记录被动结果时使用的host一致
+func upstreamName(name string, provider Provider) string {
+	if config := provider.GetConfig(); config != nil && config.BaseURL != "" {
+		return upstream.Name(config.BaseURL)
+	}
+	return name
+}
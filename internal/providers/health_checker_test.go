@@ -0,0 +1,55 @@
+package providers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/upstream"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActiveCheckRecordsUnderUpstreamHost(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/models", r.URL.Path)
+		assert.Equal(t, "Bearer sk-target", r.Header.Get("Authorization"))
+		w.WriteHeader(int(status.Load()))
+	}))
+	t.Cleanup(server.Close)
+
+	provider := NewEndpointProvider("target", &ProviderConfig{
+		BaseURL: server.URL + "/v1",
+		APIKey:  "sk-target",
+		Timeout: time.Second,
+	})
+	require.NoError(t, provider.HealthCheck(context.Background()))
+	_, err := provider.Chat(context.Background(), &ChatRequest{})
+	assert.ErrorIs(t, err, ErrProbeOnly)
+
+	manager := NewManager(&ManagerConfig{})
+	manager.RegisterProvider(provider)
+	checker := NewHealthChecker(manager, time.Hour, time.Second)
+
+	// The proxy records passive results under the request host; active checks must match
+	host := upstream.Name(server.URL + "/v1")
+	status.Store(http.StatusServiceUnavailable)
+	checker.checkAllProviders()
+	assert.Equal(t, ProviderStatusUnhealthy, manager.GetMetrics()["target"].Status)
+
+	var found bool
+	for _, h := range upstream.DefaultRegistry().Snapshot() {
+		if h.Name == host {
+			found = true
+			assert.False(t, h.ActiveHealthy)
+		}
+		assert.NotEqual(t, "target", h.Name)
+	}
+	assert.True(t, found)
+}
@@ -0,0 +1,351 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sandbox scenarios selected with the X-Sandbox-Scenario header
+const (
+	SandboxScenarioNone            = ""
+	SandboxScenarioRateLimited     = "rate_limited"
+	SandboxScenarioTimeout         = "timeout"
+	SandboxScenarioContentFiltered = "content_filtered"
+)
+
+// sandboxEmbeddingDimensions 模拟嵌入向量的维度，与 text-embedding-ada-002 一致
+const sandboxEmbeddingDimensions = 1536
+
+// sandboxVocabulary 模拟回复在回显提示词之后使用的填充词
+var sandboxVocabulary = []string{
+	"sandbox", "simulated", "response", "gateway", "token", "stream", "model",
+	"request", "latency", "deterministic", "preview", "integration", "example",
+	"result", "message", "content",
+}
+
+// SandboxOptions 模拟器参数
+type SandboxOptions struct {
+	LatencyMin       time.Duration
+	LatencyMax       time.Duration
+	CompletionTokens int
+	ChunkInterval    time.Duration
+	TimeoutAfter     time.Duration
+}
+
+// SandboxError 模拟的上游错误，携带应返回给客户端的 HTTP 状态和 OpenAI 错误类型
+type SandboxError struct {
+	Scenario string
+	Status   int
+	Type     string
+	Code     string
+	Message  string
+}
+
+func (e *SandboxError) Error() string {
+	return fmt.Sprintf("sandbox scenario %s: %s", e.Scenario, e.Message)
+}
+
+// IsValidSandboxScenario reports whether a scenario name is known
+func IsValidSandboxScenario(scenario string) bool {
+	switch scenario {
+	case SandboxScenarioNone, SandboxScenarioRateLimited, SandboxScenarioTimeout, SandboxScenarioContentFiltered:
+		return true
+	}
+	return false
+}
+
+type sandboxScenarioKey struct{}
+
+// WithSandboxScenario attaches the scenario the simulator should play to a request context
+func WithSandboxScenario(ctx context.Context, scenario string) context.Context {
+	return context.WithValue(ctx, sandboxScenarioKey{}, scenario)
+}
+
+func sandboxScenario(ctx context.Context) string {
+	scenario, _ := ctx.Value(sandboxScenarioKey{}).(string)
+	return scenario
+}
+
+// SandboxProvider 确定性的响应模拟器，供沙箱密钥使用，从不访问真实上游。
+// 相同的请求总是得到相同的内容、token 数和延迟。
+type SandboxProvider struct {
+	opts   SandboxOptions
+	config *ProviderConfig
+}
+
+// NewSandboxProvider creates the simulator
+func NewSandboxProvider(opts SandboxOptions) *SandboxProvider {
+	if opts.CompletionTokens <= 0 {
+		opts.CompletionTokens = 32
+	}
+	if opts.LatencyMax < opts.LatencyMin {
+		opts.LatencyMax = opts.LatencyMin
+	}
+	return &SandboxProvider{
+		opts: opts,
+		config: &ProviderConfig{
+			Enabled: true,
+			Models: []Model{
+				{Name: "gpt-3.5-turbo", MaxTokens: 4096, SupportsStreaming: true},
+				{Name: "gpt-4", MaxTokens: 8192, SupportsStreaming: true},
+				{Name: "text-embedding-ada-002", MaxTokens: 8191},
+			},
+		},
+	}
+}
+
+// GetName 获取提供商名称
+func (p *SandboxProvider) GetName() string {
+	return "sandbox"
+}
+
+// GetModels 获取支持的模型列表
+func (p *SandboxProvider) GetModels() []Model {
+	return p.config.Models
+}
+
+// GetConfig 获取配置
+func (p *SandboxProvider) GetConfig() *ProviderConfig {
+	return p.config
+}
+
+// HealthCheck 健康检查，模拟器始终可用
+func (p *SandboxProvider) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// simulation 一次请求的确定性模拟结果
+type simulation struct {
+	id               string
+	words            []string
+	promptTokens     int
+	completionTokens int
+	latency          time.Duration
+}
+
+// simulate derives content, token counts and latency from a hash of the prompt
+func (p *SandboxProvider) simulate(req *ChatRequest) *simulation {
+	h := sha256.New()
+	h.Write([]byte(req.Model))
+	var prompt, lastUser string
+	for _, msg := range req.Messages {
+		h.Write([]byte{0})
+		h.Write([]byte(msg.Role))
+		h.Write([]byte{0})
+		h.Write([]byte(msg.Content))
+		prompt += msg.Content + " "
+		if msg.Role == "user" {
+			lastUser = msg.Content
+		}
+	}
+	sum := h.Sum(nil)
+	rng := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+
+	completionTokens := p.opts.CompletionTokens
+	if req.MaxTokens != nil && *req.MaxTokens > 0 && *req.MaxTokens < completionTokens {
+		completionTokens = *req.MaxTokens
+	}
+
+	// Echo the prompt back after a hash tag, then pad with filler words
+	words := append([]string{"[sandbox:" + hex.EncodeToString(sum[:4]) + "]"}, strings.Fields(lastUser)...)
+	for len(words) < completionTokens {
+		words = append(words, sandboxVocabulary[rng.Intn(len(sandboxVocabulary))])
+	}
+	words = words[:completionTokens]
+
+	latency := p.opts.LatencyMin
+	if spread := p.opts.LatencyMax - p.opts.LatencyMin; spread > 0 {
+		latency += time.Duration(rng.Int63n(int64(spread)))
+	}
+
+	return &simulation{
+		id:               "chatcmpl-sandbox-" + hex.EncodeToString(sum[:12]),
+		words:            words,
+		promptTokens:     len(strings.Fields(prompt)) + 4*len(req.Messages),
+		completionTokens: completionTokens,
+		latency:          latency,
+	}
+}
+
+// play waits out the simulated latency and returns the injected failure, if any
+func (p *SandboxProvider) play(ctx context.Context, latency time.Duration) error {
+	scenario := sandboxScenario(ctx)
+	wait := latency
+	if scenario == SandboxScenarioTimeout {
+		wait = p.opts.TimeoutAfter
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+
+	switch scenario {
+	case SandboxScenarioRateLimited:
+		return &SandboxError{
+			Scenario: scenario,
+			Status:   http.StatusTooManyRequests,
+			Type:     "rate_limit_error",
+			Code:     "rate_limit_exceeded",
+			Message:  "Rate limit reached for requests (simulated)",
+		}
+	case SandboxScenarioTimeout:
+		return &SandboxError{
+			Scenario: scenario,
+			Status:   http.StatusGatewayTimeout,
+			Type:     "timeout_error",
+			Code:     "upstream_timeout",
+			Message:  "Upstream request timed out (simulated)",
+		}
+	}
+	return nil
+}
+
+// Chat 聊天补全
+func (p *SandboxProvider) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	sim := p.simulate(req)
+	if err := p.play(ctx, sim.latency); err != nil {
+		return nil, err
+	}
+	if sandboxScenario(ctx) == SandboxScenarioContentFiltered {
+		return nil, &SandboxError{
+			Scenario: SandboxScenarioContentFiltered,
+			Status:   http.StatusBadRequest,
+			Type:     "invalid_request_error",
+			Code:     "content_filter",
+			Message:  "The prompt was filtered by the content management policy (simulated)",
+		}
+	}
+
+	return &ChatResponse{
+		ID:      sim.id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   req.Model,
+		Choices: []Choice{{
+			Index:        0,
+			Message:      Message{Role: "assistant", Content: strings.Join(sim.words, " ")},
+			FinishReason: "length",
+		}},
+		Usage: Usage{
+			PromptTokens:     sim.promptTokens,
+			CompletionTokens: sim.completionTokens,
+			TotalTokens:      sim.promptTokens + sim.completionTokens,
+		},
+		Provider: p.GetName(),
+	}, nil
+}
+
+// ChatStream 流式聊天补全：首个分块在模拟延迟后发出，之后每 ChunkInterval 发出一个 token。
+// content_filtered 场景在输出一半后以 finish_reason=content_filter 结束。
+func (p *SandboxProvider) ChatStream(ctx context.Context, req *ChatRequest) (<-chan *ChatStreamResponse, error) {
+	sim := p.simulate(req)
+	if err := p.play(ctx, sim.latency); err != nil {
+		return nil, err
+	}
+
+	words := sim.words
+	finishReason := "length"
+	if sandboxScenario(ctx) == SandboxScenarioContentFiltered {
+		words = words[:len(words)/2]
+		finishReason = "content_filter"
+	}
+
+	responseChan := make(chan *ChatStreamResponse)
+	go func() {
+		defer close(responseChan)
+
+		created := time.Now().Unix()
+		chunk := func(delta *Message, finish string) *ChatStreamResponse {
+			return &ChatStreamResponse{
+				ID:       sim.id,
+				Object:   "chat.completion.chunk",
+				Created:  created,
+				Model:    req.Model,
+				Choices:  []Choice{{Index: 0, Delta: delta, FinishReason: finish}},
+				Provider: p.GetName(),
+			}
+		}
+		send := func(resp *ChatStreamResponse) bool {
+			select {
+			case responseChan <- resp:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		if !send(chunk(&Message{Role: "assistant"}, "")) {
+			return
+		}
+		for i, word := range words {
+			if i > 0 {
+				word = " " + word
+				select {
+				case <-time.After(p.opts.ChunkInterval):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if !send(chunk(&Message{Content: word}, "")) {
+				return
+			}
+		}
+		if send(chunk(&Message{}, finishReason)) {
+			send(&ChatStreamResponse{ID: sim.id, Done: true})
+		}
+	}()
+	return responseChan, nil
+}
+
+// Embeddings 文本嵌入，每个输入得到一个由其哈希决定的单位向量
+func (p *SandboxProvider) Embeddings(ctx context.Context, req *EmbeddingsRequest) (*EmbeddingsResponse, error) {
+	chatReq := &ChatRequest{Model: req.Model}
+	for _, input := range req.Input {
+		chatReq.Messages = append(chatReq.Messages, Message{Role: "user", Content: input})
+	}
+	sim := p.simulate(chatReq)
+	if err := p.play(ctx, sim.latency); err != nil {
+		return nil, err
+	}
+	if sandboxScenario(ctx) == SandboxScenarioContentFiltered {
+		return nil, &SandboxError{
+			Scenario: SandboxScenarioContentFiltered,
+			Status:   http.StatusBadRequest,
+			Type:     "invalid_request_error",
+			Code:     "content_filter",
+			Message:  "The input was filtered by the content management policy (simulated)",
+		}
+	}
+
+	resp := &EmbeddingsResponse{Object: "list", Model: req.Model, Provider: p.GetName()}
+	for i, input := range req.Input {
+		sum := sha256.Sum256([]byte(input))
+		rng := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sum[:8]))))
+		vector := make([]float64, sandboxEmbeddingDimensions)
+		var norm float64
+		for j := range vector {
+			vector[j] = rng.NormFloat64()
+			norm += vector[j] * vector[j]
+		}
+		norm = math.Sqrt(norm)
+		for j := range vector {
+			vector[j] /= norm
+		}
+		resp.Data = append(resp.Data, Embedding{Object: "embedding", Index: i, Embedding: vector})
+		resp.Usage.PromptTokens += len(strings.Fields(input))
+	}
+	resp.Usage.TotalTokens = resp.Usage.PromptTokens
+	return resp, nil
+}
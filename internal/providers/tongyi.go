@@ -8,6 +8,8 @@ import (
 	"io"
 	"net/http"
 	"time"
+
+	"go-aigateway/internal/httpclient"
 )
 
 // TongyiProvider 通义千问提供商
@@ -21,9 +23,7 @@ type TongyiProvider struct {
 // NewTongyiProvider 创建通义千问提供商
 // 这个provider处理所有阿里百炼(DashScope)的"第三方模型"
 func NewTongyiProvider(config *ProviderConfig) *TongyiProvider {
-	client := &http.Client{
-		Timeout: config.Timeout,
-	}
+	client := httpclient.NewClient("provider_tongyi", config.Timeout)
 
 	return &TongyiProvider{
 		config: config,
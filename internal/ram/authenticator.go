@@ -16,6 +16,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
 
@@ -27,10 +28,21 @@ const (
 	UserInfoContextKey contextKey = "ram_user_info"
 )
 
+// maxClockSkew is how far a request timestamp may be from the gateway's clock
+const maxClockSkew = 5 * time.Minute
+
+// Error codes of rejected RAM requests
+const (
+	CodeAuthFailed  = "ram_auth_failed"
+	CodeNonceReused = "nonce_reused"
+)
+
 type RAMAuthenticator struct {
-	config *config.RAMAuthConfig
-	cache  map[string]*CacheEntry
-	mutex  sync.RWMutex
+	config    *config.RAMAuthConfig
+	cache     map[string]*CacheEntry
+	mutex     sync.RWMutex
+	nonces    *nonceStore
+	directory *userDirectory // nil in mock mode
 }
 
 type CacheEntry struct {
@@ -62,6 +74,7 @@ type AuthResponse struct {
 	Authenticated bool      `json:"authenticated"`
 	UserInfo      *UserInfo `json:"user_info,omitempty"`
 	Error         string    `json:"error,omitempty"`
+	Code          string    `json:"code,omitempty"` // set with Error, e.g. CodeNonceReused
 	ExpiresAt     time.Time `json:"expires_at,omitempty"`
 }
 
@@ -70,10 +83,27 @@ func NewRAMAuthenticator(cfg *config.RAMAuthConfig) *RAMAuthenticator {
 		return nil
 	}
 
-	return &RAMAuthenticator{
+	ra := &RAMAuthenticator{
 		config: cfg,
 		cache:  make(map[string]*CacheEntry),
+		nonces: newNonceStore(cfg.NonceCacheSize),
 	}
+	if cfg.Mock {
+		logrus.Warn("RAM authentication is in mock mode, users are derived from access key names")
+	} else {
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = DefaultRAMEndpoint
+		}
+		ra.directory = newUserDirectory(NewClient(endpoint, cfg.AccessKeyID, cfg.AccessKeySecret), cfg.Region)
+	}
+	return ra
+}
+
+// SetRedisClient shares the used nonces with other gateway instances through
+// Redis; nil keeps them in memory
+func (ra *RAMAuthenticator) SetRedisClient(client *redis.Client) {
+	ra.nonces.setRedisClient(client)
 }
 
 func (ra *RAMAuthenticator) Authenticate(ctx context.Context, req *AuthRequest) (*AuthResponse, error) {
@@ -81,20 +111,20 @@ func (ra *RAMAuthenticator) Authenticate(ctx context.Context, req *AuthRequest)
 		return nil, fmt.Errorf("RAM authentication not enabled")
 	}
 
-	// Check cache first
-	if cached := ra.getFromCache(req.AccessKeyID); cached != nil {
-		logrus.WithField("access_key_id", req.AccessKeyID).Debug("Using cached authentication")
-		return &AuthResponse{
-			Authenticated: true,
-			UserInfo:      cached.UserInfo,
-			ExpiresAt:     cached.ExpiresAt,
-		}, nil
-	}
 	// Validate timestamp first (cheaper validation and prevents replay attacks)
 	if !ra.validateTimestamp(req.Timestamp) {
 		return &AuthResponse{
 			Authenticated: false,
 			Error:         "Request timestamp expired",
+			Code:          CodeAuthFailed,
+		}, nil
+	}
+
+	if req.Nonce == "" {
+		return &AuthResponse{
+			Authenticated: false,
+			Error:         "Request nonce is missing",
+			Code:          CodeAuthFailed,
 		}, nil
 	}
 
@@ -103,6 +133,27 @@ func (ra *RAMAuthenticator) Authenticate(ctx context.Context, req *AuthRequest)
 		return &AuthResponse{
 			Authenticated: false,
 			Error:         "Invalid signature",
+			Code:          CodeAuthFailed,
+		}, nil
+	}
+
+	// A signed request is accepted once; its nonce is remembered until the timestamp expires
+	if !ra.reserveNonce(ctx, req) {
+		logrus.WithField("access_key_id", req.AccessKeyID).Warn("Rejected replayed RAM request")
+		return &AuthResponse{
+			Authenticated: false,
+			Error:         "Request nonce has already been used",
+			Code:          CodeNonceReused,
+		}, nil
+	}
+
+	// Check cache first
+	if cached := ra.getFromCache(req.AccessKeyID); cached != nil {
+		logrus.WithField("access_key_id", req.AccessKeyID).Debug("Using cached authentication")
+		return &AuthResponse{
+			Authenticated: true,
+			UserInfo:      cached.UserInfo,
+			ExpiresAt:     cached.ExpiresAt,
 		}, nil
 	}
 
@@ -112,6 +163,7 @@ func (ra *RAMAuthenticator) Authenticate(ctx context.Context, req *AuthRequest)
 		return &AuthResponse{
 			Authenticated: false,
 			Error:         fmt.Sprintf("Failed to get user info: %v", err),
+			Code:          CodeAuthFailed,
 		}, nil
 	}
 
@@ -196,7 +248,20 @@ func (ra *RAMAuthenticator) validateTimestamp(timestamp string) bool {
 	now := time.Now()
 
 	// Allow 5 minutes clock skew
-	return now.Sub(requestTime) <= 5*time.Minute && requestTime.Sub(now) <= 5*time.Minute
+	return now.Sub(requestTime) <= maxClockSkew && requestTime.Sub(now) <= maxClockSkew
+}
+
+// reserveNonce records the nonce of req and reports whether it was unused.
+// The nonce is kept for as long as the request timestamp stays within the
+// allowed clock skew, after which a replay fails the timestamp check instead.
+func (ra *RAMAuthenticator) reserveNonce(ctx context.Context, req *AuthRequest) bool {
+	ttl := maxClockSkew
+	if ts, err := strconv.ParseInt(req.Timestamp, 10, 64); err == nil {
+		if remaining := time.Until(time.Unix(ts, 0).Add(maxClockSkew)); remaining > 0 {
+			ttl = remaining
+		}
+	}
+	return ra.nonces.reserve(ctx, req.AccessKeyID, req.Nonce, ttl)
 }
 
 func (ra *RAMAuthenticator) getUserInfo(ctx context.Context, accessKeyID string) (*UserInfo, error) {
@@ -206,7 +271,15 @@ func (ra *RAMAuthenticator) getUserInfo(ctx context.Context, accessKeyID string)
 	}
 
 	logrus.WithField("access_key_id", accessKeyID).Info("Fetching user info from RAM")
+	if ra.directory != nil {
+		return ra.directory.lookup(ctx, accessKeyID)
+	}
+	return ra.mockUserInfo(ctx, accessKeyID)
+}
 
+// mockUserInfo derives a user from the access key name: keys containing
+// "admin", "readonly" or "service" get those roles. Only used with RAM_AUTH_MOCK.
+func (ra *RAMAuthenticator) mockUserInfo(ctx context.Context, accessKeyID string) (*UserInfo, error) {
 	// Use context for timeout and cancellation support
 	select {
 	case <-ctx.Done():
@@ -417,7 +490,7 @@ func (ra *RAMAuthenticator) Middleware() func(http.Handler) http.Handler {
 					"error": map[string]interface{}{
 						"message": authResp.Error,
 						"type":    "authentication_error",
-						"code":    "ram_auth_failed",
+						"code":    authResp.Code,
 					},
 				})
 				return
@@ -11,6 +11,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -19,6 +21,7 @@ func TestNewRAMAuthenticator(t *testing.T) {
 	t.Run("enabled config", func(t *testing.T) {
 		cfg := &config.RAMAuthConfig{
 			Enabled:         true,
+			Mock:            true,
 			AccessKeySecret: "test-secret",
 			Region:          "us-west-1",
 			CacheExpiration: time.Hour,
@@ -43,6 +46,7 @@ func TestNewRAMAuthenticator(t *testing.T) {
 func TestRAMAuthenticator_Authenticate(t *testing.T) {
 	cfg := &config.RAMAuthConfig{
 		Enabled:         true,
+		Mock:            true,
 		AccessKeySecret: "test-secret-key",
 		Region:          "us-west-1",
 		CacheExpiration: time.Hour,
@@ -147,20 +151,150 @@ func TestRAMAuthenticator_Authenticate(t *testing.T) {
 
 		req := &AuthRequest{
 			AccessKeyID: accessKeyID,
-			Signature:   "any-signature",
 			Timestamp:   strconv.FormatInt(time.Now().Unix(), 10),
+			Nonce:       "cached-nonce",
+			Method:      "POST",
+			URI:         "/api/v1/chat",
 		}
+		req.Signature = auth.calculateSignature(auth.buildCanonicalString(req))
 
 		resp, err := auth.Authenticate(context.Background(), req)
 		require.NoError(t, err)
 		assert.True(t, resp.Authenticated)
 		assert.Equal(t, "cached-user", resp.UserInfo.UserID)
+
+		// A cached user still needs a valid signature
+		forged := *req
+		forged.Nonce = "forged-nonce"
+		forged.Signature = "any-signature"
+		resp, err = auth.Authenticate(context.Background(), &forged)
+		require.NoError(t, err)
+		assert.False(t, resp.Authenticated)
+		assert.Equal(t, "Invalid signature", resp.Error)
+	})
+
+	t.Run("missing nonce", func(t *testing.T) {
+		req := &AuthRequest{
+			AccessKeyID: "LTAI4nononce123",
+			Timestamp:   strconv.FormatInt(time.Now().Unix(), 10),
+			Method:      "POST",
+			URI:         "/api/v1/chat",
+		}
+		req.Signature = auth.calculateSignature(auth.buildCanonicalString(req))
+
+		resp, err := auth.Authenticate(context.Background(), req)
+		require.NoError(t, err)
+		assert.False(t, resp.Authenticated)
+		assert.Equal(t, CodeAuthFailed, resp.Code)
+	})
+}
+
+// signedRequest returns a request for accessKeyID signed by auth
+func signedRequest(auth *RAMAuthenticator, accessKeyID, nonce string) *AuthRequest {
+	req := &AuthRequest{
+		AccessKeyID:     accessKeyID,
+		Timestamp:       strconv.FormatInt(time.Now().Unix(), 10),
+		Nonce:           nonce,
+		Method:          "POST",
+		URI:             "/api/v1/chat",
+		Headers:         map[string]string{"Content-Type": "application/json"},
+		QueryParameters: map[string]string{},
+	}
+	req.Signature = auth.calculateSignature(auth.buildCanonicalString(req))
+	return req
+}
+
+func TestRAMAuthenticator_RejectsReplayedNonce(t *testing.T) {
+	newAuth := func() *RAMAuthenticator {
+		return NewRAMAuthenticator(&config.RAMAuthConfig{
+			Enabled:         true,
+			Mock:            true,
+			AccessKeySecret: "test-secret-key",
+			CacheExpiration: time.Hour,
+		})
+	}
+	redisAuth := newAuth()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	redisAuth.SetRedisClient(client)
+
+	for name, auth := range map[string]*RAMAuthenticator{"memory": newAuth(), "redis": redisAuth} {
+		t.Run(name, func(t *testing.T) {
+			req := signedRequest(auth, "LTAI4replay123456", "nonce-"+name)
+
+			resp, err := auth.Authenticate(context.Background(), req)
+			require.NoError(t, err)
+			assert.True(t, resp.Authenticated)
+
+			replay := *req
+			resp, err = auth.Authenticate(context.Background(), &replay)
+			require.NoError(t, err)
+			assert.False(t, resp.Authenticated, "the same signed request is accepted only once")
+			assert.Equal(t, CodeNonceReused, resp.Code)
+
+			// The nonce is scoped to the access key
+			resp, err = auth.Authenticate(context.Background(), signedRequest(auth, "LTAI4other1234567", "nonce-"+name))
+			require.NoError(t, err)
+			assert.True(t, resp.Authenticated)
+		})
+	}
+
+	// Redis keeps the nonce for no longer than the timestamp stays valid
+	ttl := mr.TTL(nonceKeyPrefix + "LTAI4replay123456:nonce-redis")
+	assert.Greater(t, ttl, maxClockSkew-time.Minute)
+	assert.LessOrEqual(t, ttl, maxClockSkew)
+}
+
+func TestRAMAuthenticator_NonceFallsBackToMemory(t *testing.T) {
+	auth := NewRAMAuthenticator(&config.RAMAuthConfig{
+		Enabled:         true,
+		Mock:            true,
+		AccessKeySecret: "test-secret-key",
+		CacheExpiration: time.Hour,
 	})
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	auth.SetRedisClient(client)
+	mr.Close()
+
+	req := signedRequest(auth, "LTAI4fallback1234", "nonce-1")
+	resp, err := auth.Authenticate(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, resp.Authenticated)
+
+	resp, err = auth.Authenticate(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, CodeNonceReused, resp.Code)
+}
+
+func TestMemoryNoncesAreBounded(t *testing.T) {
+	nonces := newMemoryNonces(3)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	nonces.now = func() time.Time { return now }
+
+	assert.True(t, nonces.reserve("a", time.Minute))
+	assert.True(t, nonces.reserve("b", 3*time.Minute))
+	assert.True(t, nonces.reserve("c", 2*time.Minute))
+	assert.False(t, nonces.reserve("b", 3*time.Minute))
+
+	// Once full the nonce closest to expiry makes room
+	assert.True(t, nonces.reserve("d", 3*time.Minute))
+	assert.Equal(t, 3, nonces.count())
+	assert.True(t, nonces.reserve("a", time.Minute), "the dropped nonce is forgotten")
+	assert.False(t, nonces.reserve("b", time.Minute))
+
+	// Expired nonces are purged and may be used again
+	now = now.Add(4 * time.Minute)
+	assert.True(t, nonces.reserve("b", time.Minute))
+	assert.Equal(t, 1, nonces.count())
 }
 
 func TestRAMAuthenticator_validateSignature(t *testing.T) {
 	cfg := &config.RAMAuthConfig{
 		Enabled:         true,
+		Mock:            true,
 		AccessKeySecret: "test-secret-key",
 		Region:          "us-west-1",
 		CacheExpiration: time.Hour,
@@ -198,6 +332,7 @@ func TestRAMAuthenticator_validateSignature(t *testing.T) {
 func TestRAMAuthenticator_buildCanonicalString(t *testing.T) {
 	cfg := &config.RAMAuthConfig{
 		Enabled:         true,
+		Mock:            true,
 		AccessKeySecret: "test-secret-key",
 		Region:          "us-west-1",
 		CacheExpiration: time.Hour,
@@ -236,6 +371,7 @@ func TestRAMAuthenticator_buildCanonicalString(t *testing.T) {
 func TestRAMAuthenticator_calculateSignature(t *testing.T) {
 	cfg := &config.RAMAuthConfig{
 		Enabled:         true,
+		Mock:            true,
 		AccessKeySecret: "test-secret-key",
 		Region:          "us-west-1",
 		CacheExpiration: time.Hour,
@@ -264,6 +400,7 @@ func TestRAMAuthenticator_calculateSignature(t *testing.T) {
 func TestRAMAuthenticator_validateTimestamp(t *testing.T) {
 	cfg := &config.RAMAuthConfig{
 		Enabled:         true,
+		Mock:            true,
 		AccessKeySecret: "test-secret-key",
 		Region:          "us-west-1",
 		CacheExpiration: time.Hour,
@@ -308,6 +445,7 @@ func TestRAMAuthenticator_validateTimestamp(t *testing.T) {
 func TestRAMAuthenticator_getUserInfo(t *testing.T) {
 	cfg := &config.RAMAuthConfig{
 		Enabled:         true,
+		Mock:            true,
 		AccessKeySecret: "test-secret-key",
 		Region:          "us-west-1",
 		CacheExpiration: time.Hour,
@@ -340,6 +478,7 @@ func TestRAMAuthenticator_getUserInfo(t *testing.T) {
 func TestRAMAuthenticator_CheckPermission(t *testing.T) {
 	cfg := &config.RAMAuthConfig{
 		Enabled:         true,
+		Mock:            true,
 		AccessKeySecret: "test-secret-key",
 		Region:          "us-west-1",
 		CacheExpiration: time.Hour,
@@ -398,6 +537,7 @@ func TestRAMAuthenticator_CheckPermission(t *testing.T) {
 func TestRAMAuthenticator_Cache(t *testing.T) {
 	cfg := &config.RAMAuthConfig{
 		Enabled:         true,
+		Mock:            true,
 		AccessKeySecret: "test-secret-key",
 		Region:          "us-west-1",
 		CacheExpiration: time.Hour,
@@ -461,6 +601,7 @@ func TestRAMAuthenticator_Cache(t *testing.T) {
 func TestRAMAuthenticator_ValidateRequest(t *testing.T) {
 	cfg := &config.RAMAuthConfig{
 		Enabled:         true,
+		Mock:            true,
 		AccessKeySecret: "test-secret-key",
 		Region:          "us-west-1",
 		CacheExpiration: time.Hour,
@@ -533,6 +674,7 @@ func TestRAMAuthenticator_ValidateRequest(t *testing.T) {
 func TestRAMAuthenticator_extractAuthRequest(t *testing.T) {
 	cfg := &config.RAMAuthConfig{
 		Enabled:         true,
+		Mock:            true,
 		AccessKeySecret: "test-secret-key",
 		Region:          "us-west-1",
 		CacheExpiration: time.Hour,
@@ -573,6 +715,7 @@ func TestRAMAuthenticator_extractAuthRequest(t *testing.T) {
 func BenchmarkRAMAuthenticator_validateSignature(b *testing.B) {
 	cfg := &config.RAMAuthConfig{
 		Enabled:         true,
+		Mock:            true,
 		AccessKeySecret: "test-secret-key",
 		Region:          "us-west-1",
 		CacheExpiration: time.Hour,
@@ -601,6 +744,7 @@ func BenchmarkRAMAuthenticator_validateSignature(b *testing.B) {
 func BenchmarkRAMAuthenticator_buildCanonicalString(b *testing.B) {
 	cfg := &config.RAMAuthConfig{
 		Enabled:         true,
+		Mock:            true,
 		AccessKeySecret: "test-secret-key",
 		Region:          "us-west-1",
 		CacheExpiration: time.Hour,
@@ -0,0 +1,145 @@
+package ram
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"go-aigateway/internal/httpclient"
+)
+
+// clientTimeout bounds one Alibaba Cloud API call
+const clientTimeout = 10 * time.Second
+
+// APIError is an error answer of an Alibaba Cloud API
+type APIError struct {
+	StatusCode int
+	Code       string `json:"Code"`
+	Message    string `json:"Message"`
+	RequestID  string `json:"RequestId"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %s (status %d, request %s)", e.Code, e.Message, e.StatusCode, e.RequestID)
+}
+
+// Client 调用阿里云 RPC 风格 API（RAM、STS 等）的最小客户端，
+// 使用 AccessKey 按签名版本 1.0（HMAC-SHA1）对请求签名。
+type Client struct {
+	endpoint        string
+	accessKeyID     string
+	accessKeySecret string
+	httpClient      *http.Client
+	now             func() time.Time
+	nonce           func() string
+}
+
+// NewClient creates a client for the API served at endpoint, e.g.
+// "ram.aliyuncs.com"; endpoints without a scheme use HTTPS
+func NewClient(endpoint, accessKeyID, accessKeySecret string) *Client {
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "https://" + endpoint
+	}
+	return &Client{
+		endpoint:        strings.TrimSuffix(endpoint, "/"),
+		accessKeyID:     accessKeyID,
+		accessKeySecret: accessKeySecret,
+		httpClient:      httpclient.NewClient("ram", clientTimeout),
+		now:             time.Now,
+		nonce:           randomNonce,
+	}
+}
+
+// Call invokes action of API version with params and decodes the JSON answer
+// into out. Error answers are returned as *APIError.
+func (c *Client) Call(ctx context.Context, action, version string, params map[string]string, out interface{}) error {
+	query := url.Values{}
+	for name, value := range params {
+		query.Set(name, value)
+	}
+	query.Set("Action", action)
+	query.Set("Version", version)
+	query.Set("Format", "JSON")
+	query.Set("AccessKeyId", c.accessKeyID)
+	query.Set("SignatureMethod", "HMAC-SHA1")
+	query.Set("SignatureVersion", "1.0")
+	query.Set("SignatureNonce", c.nonce())
+	query.Set("Timestamp", c.now().UTC().Format("2006-01-02T15:04:05Z"))
+	query.Set("Signature", signRPC(http.MethodGet, query, c.accessKeySecret))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint+"/?"+canonicalQuery(query), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", action, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, apiErr) != nil || apiErr.Code == "" {
+			apiErr.Code = "HTTPError"
+			apiErr.Message = strings.TrimSpace(string(body))
+		}
+		return apiErr
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("invalid %s response: %w", action, err)
+	}
+	return nil
+}
+
+// signRPC signs the sorted query of an RPC style request: HMAC-SHA1 keyed
+// with secret + "&" over METHOD&%2F&percentEncode(canonical query)
+func signRPC(method string, query url.Values, secret string) string {
+	stringToSign := method + "&" + percentEncode("/") + "&" + percentEncode(canonicalQuery(query))
+	h := hmac.New(sha1.New, []byte(secret+"&"))
+	h.Write([]byte(stringToSign))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// canonicalQuery joins the parameters sorted by name, percent-encoded
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, percentEncode(name)+"="+percentEncode(query.Get(name)))
+	}
+	return strings.Join(parts, "&")
+}
+
+// percentEncode is URL encoding with the RFC 3986 unreserved set: spaces
+// become %20, '*' %2A and '~' stays
+func percentEncode(s string) string {
+	encoded := url.QueryEscape(s)
+	encoded = strings.ReplaceAll(encoded, "+", "%20")
+	encoded = strings.ReplaceAll(encoded, "*", "%2A")
+	return strings.ReplaceAll(encoded, "%7E", "~")
+}
+
+func randomNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
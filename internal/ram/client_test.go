@@ -0,0 +1,55 @@
+package ram
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignRPCMatchesAlibabaCloudExample(t *testing.T) {
+	// DescribeRegions example of the Alibaba Cloud RPC signature documentation
+	query := url.Values{
+		"AccessKeyId":      {"testid"},
+		"Action":           {"DescribeRegions"},
+		"Format":           {"XML"},
+		"SignatureMethod":  {"HMAC-SHA1"},
+		"SignatureNonce":   {"3ee8c1b8-83d3-44af-a94f-4e0ad82fd6cf"},
+		"SignatureVersion": {"1.0"},
+		"Timestamp":        {"2016-02-23T12:46:24Z"},
+		"Version":          {"2014-05-26"},
+	}
+	assert.Equal(t, "OLeaidS1JvxuMvnyHOwuJ+uX5qY=", signRPC(http.MethodGet, query, "testsecret"))
+}
+
+func TestClientCall(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		signature := query.Get("Signature")
+		query.Del("Signature")
+		if signature != signRPC(http.MethodGet, query, "secret") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"Code":"SignatureDoesNotMatch","Message":"bad signature","RequestId":"req-1"}`))
+			return
+		}
+		w.Write([]byte(`{"User":{"UserName":"` + query.Get("UserName") + `"}}`))
+	}))
+	defer srv.Close()
+
+	var out struct {
+		User struct{ UserName string }
+	}
+	client := NewClient(srv.URL, "AKID", "secret")
+	require.NoError(t, client.Call(t.Context(), "GetUser", ramAPIVersion, map[string]string{"UserName": "alice bob*"}, &out))
+	assert.Equal(t, "alice bob*", out.User.UserName)
+
+	var apiErr *APIError
+	err := NewClient(srv.URL, "AKID", "wrong").Call(t.Context(), "GetUser", ramAPIVersion, nil, &out)
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "SignatureDoesNotMatch", apiErr.Code)
+	assert.Equal(t, "req-1", apiErr.RequestID)
+}
@@ -0,0 +1,196 @@
+package ram
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// ramAPIVersion is the version of the RAM API the directory calls
+	ramAPIVersion = "2015-05-01"
+	// DefaultRAMEndpoint serves the RAM API for every region
+	DefaultRAMEndpoint = "ram.aliyuncs.com"
+	// keyIndexRefreshInterval is how often an unknown access key may trigger
+	// a reload of the access key owners
+	keyIndexRefreshInterval = time.Minute
+)
+
+// ErrUnknownAccessKey is returned for access keys no active RAM user owns
+var ErrUnknownAccessKey = errors.New("access key does not belong to an active RAM user")
+
+// policyGrant is what a RAM policy attached to a user grants in the gateway
+type policyGrant struct {
+	role        string
+	permissions []string
+}
+
+// policyGrants maps RAM policies to the gateway's roles and permissions.
+// Policies not listed grant nothing.
+var policyGrants = map[string]policyGrant{
+	"AdministratorAccess":     {role: "ai-gateway-admin", permissions: []string{"ai:*", "ai:admin", "admin:*", "model:*", "config:*"}},
+	"AIGatewayAdminPolicy":    {role: "ai-gateway-admin", permissions: []string{"ai:*", "ai:admin", "admin:*", "model:*", "config:*"}},
+	"AIGatewayUserPolicy":     {role: "ai-gateway-user", permissions: []string{"ai:chat", "ai:completion", "ai:models"}},
+	"AIGatewayServicePolicy":  {role: "ai-gateway-service", permissions: []string{"ai:chat", "ai:completion", "ai:embeddings"}},
+	"AIGatewayReadOnlyPolicy": {role: "ai-gateway-readonly", permissions: []string{"ai:read", "model:list", "config:read"}},
+}
+
+// userDirectory 通过 RAM API 查找 AccessKey 所属的 RAM 用户及其授权策略。
+// AccessKey 到用户名的索引在遇到未知 AccessKey 时重新加载，且每分钟最多一次。
+type userDirectory struct {
+	client *Client
+	region string
+
+	mutex     sync.Mutex
+	keyOwners map[string]string // access key ID -> user name
+	refreshed time.Time
+	now       func() time.Time
+}
+
+func newUserDirectory(client *Client, region string) *userDirectory {
+	return &userDirectory{
+		client:    client,
+		region:    region,
+		keyOwners: make(map[string]string),
+		now:       time.Now,
+	}
+}
+
+// lookup returns the RAM user owning accessKeyID with the grants of its policies
+func (d *userDirectory) lookup(ctx context.Context, accessKeyID string) (*UserInfo, error) {
+	userName, err := d.owner(ctx, accessKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var user struct {
+		User struct {
+			UserID      string `json:"UserId"`
+			UserName    string `json:"UserName"`
+			DisplayName string `json:"DisplayName"`
+			CreateDate  string `json:"CreateDate"`
+		} `json:"User"`
+	}
+	if err := d.client.Call(ctx, "GetUser", ramAPIVersion, map[string]string{"UserName": userName}, &user); err != nil {
+		return nil, fmt.Errorf("failed to get RAM user %s: %w", userName, err)
+	}
+
+	var policies struct {
+		Policies struct {
+			Policy []struct {
+				PolicyName string `json:"PolicyName"`
+				PolicyType string `json:"PolicyType"`
+			} `json:"Policy"`
+		} `json:"Policies"`
+	}
+	if err := d.client.Call(ctx, "ListPoliciesForUser", ramAPIVersion, map[string]string{"UserName": userName}, &policies); err != nil {
+		return nil, fmt.Errorf("failed to list policies of RAM user %s: %w", userName, err)
+	}
+
+	info := &UserInfo{
+		UserID:   user.User.UserID,
+		UserName: user.User.UserName,
+		Attributes: map[string]string{
+			"region":       d.region,
+			"display_name": user.User.DisplayName,
+			"create_time":  user.User.CreateDate,
+			"access_key":   accessKeyID,
+			"auth_method":  "ram",
+		},
+	}
+	roles := make(map[string]bool)
+	permissions := make(map[string]bool)
+	for _, policy := range policies.Policies.Policy {
+		info.Policies = append(info.Policies, policy.PolicyName)
+		grant, ok := policyGrants[policy.PolicyName]
+		if !ok {
+			continue
+		}
+		if !roles[grant.role] {
+			roles[grant.role] = true
+			info.Roles = append(info.Roles, grant.role)
+		}
+		for _, permission := range grant.permissions {
+			if !permissions[permission] {
+				permissions[permission] = true
+				info.Permissions = append(info.Permissions, permission)
+			}
+		}
+	}
+	return info, nil
+}
+
+// owner returns the name of the user owning accessKeyID, reloading the index
+// of access key owners when the key is not in it
+func (d *userDirectory) owner(ctx context.Context, accessKeyID string) (string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if userName, ok := d.keyOwners[accessKeyID]; ok {
+		return userName, nil
+	}
+	if !d.refreshed.IsZero() && d.now().Sub(d.refreshed) < keyIndexRefreshInterval {
+		return "", ErrUnknownAccessKey
+	}
+	owners, err := d.loadKeyOwners(ctx)
+	if err != nil {
+		return "", err
+	}
+	d.keyOwners = owners
+	d.refreshed = d.now()
+
+	if userName, ok := owners[accessKeyID]; ok {
+		return userName, nil
+	}
+	return "", ErrUnknownAccessKey
+}
+
+// loadKeyOwners lists every RAM user and their active access keys
+func (d *userDirectory) loadKeyOwners(ctx context.Context) (map[string]string, error) {
+	owners := make(map[string]string)
+	marker := ""
+	for {
+		params := map[string]string{"MaxItems": "1000"}
+		if marker != "" {
+			params["Marker"] = marker
+		}
+		var users struct {
+			Users struct {
+				User []struct {
+					UserName string `json:"UserName"`
+				} `json:"User"`
+			} `json:"Users"`
+			IsTruncated bool   `json:"IsTruncated"`
+			Marker      string `json:"Marker"`
+		}
+		if err := d.client.Call(ctx, "ListUsers", ramAPIVersion, params, &users); err != nil {
+			return nil, fmt.Errorf("failed to list RAM users: %w", err)
+		}
+
+		for _, user := range users.Users.User {
+			var keys struct {
+				AccessKeys struct {
+					AccessKey []struct {
+						AccessKeyID string `json:"AccessKeyId"`
+						Status      string `json:"Status"`
+					} `json:"AccessKey"`
+				} `json:"AccessKeys"`
+			}
+			if err := d.client.Call(ctx, "ListAccessKeys", ramAPIVersion, map[string]string{"UserName": user.UserName}, &keys); err != nil {
+				return nil, fmt.Errorf("failed to list access keys of RAM user %s: %w", user.UserName, err)
+			}
+			for _, key := range keys.AccessKeys.AccessKey {
+				if key.Status == "Active" {
+					owners[key.AccessKeyID] = user.UserName
+				}
+			}
+		}
+
+		if !users.IsTruncated || users.Marker == "" {
+			return owners, nil
+		}
+		marker = users.Marker
+	}
+}
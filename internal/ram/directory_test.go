@@ -0,0 +1,171 @@
+package ram
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRAM answers RAM API actions from an in-memory account
+type fakeRAM struct {
+	mutex    sync.Mutex
+	keys     map[string][]string // user name -> active access keys
+	policies map[string][]string // user name -> policy names
+	calls    map[string]int
+	failing  bool
+}
+
+func newFakeRAM(t *testing.T) (*fakeRAM, *httptest.Server) {
+	ram := &fakeRAM{
+		keys:     make(map[string][]string),
+		policies: make(map[string][]string),
+		calls:    make(map[string]int),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(ram.serve))
+	t.Cleanup(srv.Close)
+	return ram, srv
+}
+
+func (f *fakeRAM) serve(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	query := r.URL.Query()
+	action := query.Get("Action")
+	f.calls[action]++
+	if f.failing {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{"Code": "NoPermission", "Message": "denied", "RequestId": "req"})
+		return
+	}
+
+	userName := query.Get("UserName")
+	var out interface{}
+	switch action {
+	case "ListUsers":
+		var users []map[string]string
+		for name := range f.keys {
+			users = append(users, map[string]string{"UserName": name})
+		}
+		out = map[string]interface{}{"Users": map[string]interface{}{"User": users}, "IsTruncated": false}
+	case "ListAccessKeys":
+		var keys []map[string]string
+		for _, key := range f.keys[userName] {
+			keys = append(keys, map[string]string{"AccessKeyId": key, "Status": "Active"})
+		}
+		keys = append(keys, map[string]string{"AccessKeyId": userName + "-disabled", "Status": "Inactive"})
+		out = map[string]interface{}{"AccessKeys": map[string]interface{}{"AccessKey": keys}}
+	case "GetUser":
+		out = map[string]interface{}{"User": map[string]string{"UserId": "id-" + userName, "UserName": userName, "DisplayName": userName}}
+	case "ListPoliciesForUser":
+		var policies []map[string]string
+		for _, name := range f.policies[userName] {
+			policies = append(policies, map[string]string{"PolicyName": name, "PolicyType": "System"})
+		}
+		out = map[string]interface{}{"Policies": map[string]interface{}{"Policy": policies}}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(out)
+}
+
+func (f *fakeRAM) callCount(action string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.calls[action]
+}
+
+func newRAMBackedAuthenticator(endpoint string) *RAMAuthenticator {
+	return NewRAMAuthenticator(&config.RAMAuthConfig{
+		Enabled:         true,
+		AccessKeyID:     "gateway-ak",
+		AccessKeySecret: "gateway-secret",
+		Region:          "cn-hangzhou",
+		Endpoint:        endpoint,
+		CacheExpiration: time.Hour,
+	})
+}
+
+func TestUserDirectoryMapsPolicies(t *testing.T) {
+	fake, srv := newFakeRAM(t)
+	fake.keys["alice"] = []string{"LTAI-alice"}
+	fake.policies["alice"] = []string{"AIGatewayAdminPolicy", "AliyunOSSReadOnlyAccess"}
+	fake.keys["bob"] = []string{"LTAI-bob"}
+	fake.policies["bob"] = []string{"AIGatewayUserPolicy", "AIGatewayReadOnlyPolicy"}
+
+	auth := newRAMBackedAuthenticator(srv.URL)
+	require.NotNil(t, auth.directory)
+
+	alice, err := auth.getUserInfo(t.Context(), "LTAI-alice")
+	require.NoError(t, err)
+	assert.Equal(t, "id-alice", alice.UserID)
+	assert.Equal(t, "alice", alice.UserName)
+	assert.Equal(t, []string{"ai-gateway-admin"}, alice.Roles)
+	assert.Contains(t, alice.Permissions, "admin:*")
+	assert.Equal(t, []string{"AIGatewayAdminPolicy", "AliyunOSSReadOnlyAccess"}, alice.Policies)
+	assert.Equal(t, "cn-hangzhou", alice.Attributes["region"])
+
+	bob, err := auth.getUserInfo(t.Context(), "LTAI-bob")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ai-gateway-user", "ai-gateway-readonly"}, bob.Roles)
+	assert.ElementsMatch(t, []string{"ai:chat", "ai:completion", "ai:models", "ai:read", "model:list", "config:read"}, bob.Permissions)
+	assert.False(t, auth.CheckPermission(bob, "admin", "users"))
+	assert.Equal(t, 1, fake.callCount("ListUsers"), "known keys do not reload the index")
+}
+
+func TestUserDirectoryDoesNotGrantFromKeyNames(t *testing.T) {
+	fake, srv := newFakeRAM(t)
+	fake.keys["intern"] = []string{"LTAI-admin-service"}
+
+	auth := newRAMBackedAuthenticator(srv.URL)
+	user, err := auth.getUserInfo(t.Context(), "LTAI-admin-service")
+	require.NoError(t, err)
+	assert.Empty(t, user.Roles)
+	assert.Empty(t, user.Permissions)
+	assert.False(t, auth.CheckPermission(user, "ai", "chat"))
+}
+
+func TestUserDirectoryUnknownKeys(t *testing.T) {
+	fake, srv := newFakeRAM(t)
+	fake.keys["alice"] = []string{"LTAI-alice"}
+
+	auth := newRAMBackedAuthenticator(srv.URL)
+	_, err := auth.getUserInfo(t.Context(), "LTAI-admin")
+	assert.ErrorIs(t, err, ErrUnknownAccessKey)
+	_, err = auth.getUserInfo(t.Context(), "alice-disabled")
+	assert.ErrorIs(t, err, ErrUnknownAccessKey, "inactive keys are not indexed")
+	assert.Equal(t, 1, fake.callCount("ListUsers"), "the index is reloaded at most once a minute")
+
+	// Keys created after the last reload are found once the interval passed
+	fake.mutex.Lock()
+	fake.keys["carol"] = []string{"LTAI-carol"}
+	fake.mutex.Unlock()
+	auth.directory.now = func() time.Time { return time.Now().Add(keyIndexRefreshInterval) }
+	carol, err := auth.getUserInfo(t.Context(), "LTAI-carol")
+	require.NoError(t, err)
+	assert.Equal(t, "carol", carol.UserName)
+}
+
+func TestAuthenticateFailsWhenRAMLookupFails(t *testing.T) {
+	fake, srv := newFakeRAM(t)
+	fake.keys["alice"] = []string{"LTAI-admin"}
+	fake.failing = true
+
+	auth := newRAMBackedAuthenticator(srv.URL)
+	resp, err := auth.Authenticate(t.Context(), signedRequest(auth, "LTAI-admin", "nonce-1"))
+	require.NoError(t, err)
+	assert.False(t, resp.Authenticated)
+	assert.Equal(t, CodeAuthFailed, resp.Code)
+	assert.Contains(t, resp.Error, "NoPermission")
+	assert.Nil(t, resp.UserInfo)
+	assert.Nil(t, auth.getFromCache("LTAI-admin"), "failed lookups are not cached")
+}
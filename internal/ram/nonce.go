@@ -0,0 +1,129 @@
+package ram
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// nonceKeyPrefix prefixes the Redis keys of used nonces
+	nonceKeyPrefix = "ram:nonce:"
+	// defaultNonceCacheSize bounds the in-memory nonce store when none is configured
+	defaultNonceCacheSize = 100000
+	// nonceRedisTimeout bounds the Redis round trip of a nonce check
+	nonceRedisTimeout = 100 * time.Millisecond
+)
+
+// nonceStore 记录已使用的 nonce（accessKeyID + nonce），在时间戳有效期内拒绝重放。
+// 配置 Redis 时所有实例共享记录；Redis 不可用时退回到有容量上限的内存表。
+type nonceStore struct {
+	mutex  sync.Mutex
+	client *redis.Client
+	memory *memoryNonces
+}
+
+func newNonceStore(size int) *nonceStore {
+	return &nonceStore{memory: newMemoryNonces(size)}
+}
+
+func (ns *nonceStore) setRedisClient(client *redis.Client) {
+	ns.mutex.Lock()
+	ns.client = client
+	ns.mutex.Unlock()
+}
+
+// reserve records the nonce of accessKeyID for ttl and reports whether it
+// was unused
+func (ns *nonceStore) reserve(ctx context.Context, accessKeyID, nonce string, ttl time.Duration) bool {
+	key := accessKeyID + ":" + nonce
+	ns.mutex.Lock()
+	client := ns.client
+	ns.mutex.Unlock()
+
+	if client != nil {
+		ctx, cancel := context.WithTimeout(ctx, nonceRedisTimeout)
+		defer cancel()
+		fresh, err := client.SetNX(ctx, nonceKeyPrefix+key, 1, ttl).Result()
+		if err == nil {
+			return fresh
+		}
+		logrus.WithError(err).Warn("Failed to record RAM nonce in Redis, using the in-memory store")
+	}
+	return ns.memory.reserve(key, ttl)
+}
+
+// memoryNonces is a TTL set of nonces holding at most size entries; once
+// full the entry closest to expiry is dropped first
+type memoryNonces struct {
+	mutex   sync.Mutex
+	size    int
+	order   *list.List // of *nonceEntry, soonest expiry first
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+type nonceEntry struct {
+	key       string
+	expiresAt time.Time
+}
+
+func newMemoryNonces(size int) *memoryNonces {
+	if size <= 0 {
+		size = defaultNonceCacheSize
+	}
+	return &memoryNonces{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+func (m *memoryNonces) reserve(key string, ttl time.Duration) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	if element, ok := m.entries[key]; ok {
+		if now.Before(element.Value.(*nonceEntry).expiresAt) {
+			return false
+		}
+		m.remove(element)
+	}
+	for front := m.order.Front(); front != nil && !now.Before(front.Value.(*nonceEntry).expiresAt); front = m.order.Front() {
+		m.remove(front)
+	}
+	for m.order.Len() >= m.size {
+		m.remove(m.order.Front())
+	}
+
+	entry := &nonceEntry{key: key, expiresAt: now.Add(ttl)}
+	// TTLs vary with the request timestamp, so keep the list sorted by expiry
+	at := m.order.Back()
+	for at != nil && at.Value.(*nonceEntry).expiresAt.After(entry.expiresAt) {
+		at = at.Prev()
+	}
+	if at == nil {
+		m.entries[key] = m.order.PushFront(entry)
+	} else {
+		m.entries[key] = m.order.InsertAfter(entry, at)
+	}
+	return true
+}
+
+// remove drops element; the caller holds the mutex
+func (m *memoryNonces) remove(element *list.Element) {
+	delete(m.entries, m.order.Remove(element).(*nonceEntry).key)
+}
+
+// count returns the number of remembered nonces, expired ones included
+func (m *memoryNonces) count() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.order.Len()
+}
@@ -41,14 +41,43 @@ func DefaultConfig() *Config {
 	}
 }
 
+// Reconnect backoff bounds of StartReconnectLoop
+const (
+	reconnectInitialBackoff = time.Second
+	reconnectMaxBackoff     = time.Minute
+	// probeTimeout bounds one HealthProbe round trip
+	probeTimeout = 2 * time.Second
+)
+
 // Client Redis客户端管理器
 type Client struct {
 	*redis.Client
 	config *Config
+
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
 }
 
-// NewClient 创建Redis客户端
+// NewClient 创建Redis客户端并验证连接
 func NewClient(config *Config) (*Client, error) {
+	client := New(config)
+
+	// Test connection
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.HealthCheck(ctx); err != nil {
+		client.Client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	logrus.WithField("addr", client.config.Addr).Info("Redis client connected successfully")
+	return client, nil
+}
+
+// New 创建Redis客户端但不建立连接，用于 Redis 暂不可用时通过
+// StartReconnectLoop 在后台重连
+func New(config *Config) *Client {
 	if config == nil {
 		config = DefaultConfig()
 	}
@@ -67,21 +96,12 @@ func NewClient(config *Config) (*Client, error) {
 		TLSConfig:    config.TLSConfig,
 	})
 
-	client := &Client{
-		Client: rdb,
-		config: config,
-	}
-
-	// Test connection
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	if err := client.HealthCheck(ctx); err != nil {
-		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	return &Client{
+		Client:         rdb,
+		config:         config,
+		initialBackoff: reconnectInitialBackoff,
+		maxBackoff:     reconnectMaxBackoff,
 	}
-
-	logrus.WithField("addr", config.Addr).Info("Redis client connected successfully")
-	return client, nil
 }
 
 // HealthCheck Redis健康检查
@@ -94,6 +114,45 @@ func (c *Client) HealthCheck(ctx context.Context) error {
 	return nil
 }
 
+// HealthProbe reports whether Redis answers a PING. Unlike HealthCheck it
+// does not log failures, so it can be polled while Redis is known to be down.
+func (c *Client) HealthProbe(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	return c.Ping(ctx).Err() == nil
+}
+
+// StartReconnectLoop 在 Redis 不可用时以指数退避（1秒起，最长1分钟）重试连接，
+// 连接成功后调用一次 onReconnect 并返回。ctx 取消时停止重试。
+func (c *Client) StartReconnectLoop(ctx context.Context, onReconnect func(*redis.Client)) {
+	backoff := c.initialBackoff
+	for attempt := 1; ; attempt++ {
+		if c.HealthProbe(ctx) {
+			logrus.WithFields(logrus.Fields{
+				"addr":     c.config.Addr,
+				"attempts": attempt,
+			}).Info("Redis connection restored")
+			if onReconnect != nil {
+				onReconnect(c.Client)
+			}
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"addr":        c.config.Addr,
+			"retry_after": backoff,
+		}).Debug("Redis still unavailable")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
 // StartHealthCheck 启动健康检查
 func (c *Client) StartHealthCheck(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
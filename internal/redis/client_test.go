@@ -0,0 +1,101 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(addr string) *Config {
+	config := DefaultConfig()
+	config.Addr = addr
+	config.MaxRetries = -1
+	config.MinIdleConns = 0
+	config.DialTimeout = 100 * time.Millisecond
+	return config
+}
+
+func TestNewClientFailsWhenRedisIsDown(t *testing.T) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+
+	client, err := NewClient(testConfig(addr))
+	assert.Error(t, err)
+	assert.Nil(t, client)
+}
+
+func TestHealthProbe(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := New(testConfig(mr.Addr()))
+	defer client.Close()
+
+	assert.True(t, client.HealthProbe(context.Background()))
+	mr.Close()
+	assert.False(t, client.HealthProbe(context.Background()))
+}
+
+func TestStartReconnectLoop(t *testing.T) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+
+	client := New(testConfig(addr))
+	defer client.Close()
+	client.initialBackoff = 10 * time.Millisecond
+	client.maxBackoff = 40 * time.Millisecond
+
+	reconnected := make(chan *redis.Client, 1)
+	done := make(chan struct{})
+	go func() {
+		client.StartReconnectLoop(context.Background(), func(c *redis.Client) { reconnected <- c })
+		close(done)
+	}()
+
+	// Let a few attempts fail before Redis comes back
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-reconnected:
+		t.Fatal("reconnected while Redis was down")
+	default:
+	}
+	require.NoError(t, mr.Restart())
+
+	select {
+	case c := <-reconnected:
+		assert.Same(t, client.Client, c)
+		assert.NoError(t, c.Set(context.Background(), "k", "v", 0).Err())
+	case <-time.After(2 * time.Second):
+		t.Fatal("reconnect callback not called")
+	}
+	<-done
+}
+
+func TestStartReconnectLoopStopsWithContext(t *testing.T) {
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+
+	client := New(testConfig(addr))
+	defer client.Close()
+	client.initialBackoff = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		client.StartReconnectLoop(ctx, func(*redis.Client) { t.Error("unexpected reconnect") })
+		close(done)
+	}()
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("reconnect loop did not stop")
+	}
+}
@@ -0,0 +1,326 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Schema migration keys
+const (
+	SchemaVersionKey = "gw:schema:version"
+	SchemaLockKey    = "gw:schema:lock"
+)
+
+// DefaultAPIKeyPatterns are the locations API key records are migrated in: one
+// string key per API key, and the hash used by the Redis storage backend
+var DefaultAPIKeyPatterns = []string{"gw:apikeys:*", "store:api_keys"}
+
+// ErrMigrationInProgress 其他实例持有迁移锁且在等待时间内未完成
+var ErrMigrationInProgress = errors.New("schema migration in progress on another instance")
+
+// MigrateFunc rewrites one record. key is the Redis key for string records and
+// the field name for records stored in a hash. Returning the input unchanged
+// leaves the record untouched.
+type MigrateFunc func(key string, old []byte) ([]byte, error)
+
+// Migration 单个版本的迁移步骤
+type Migration struct {
+	Version     int
+	Description string
+	Migrate     MigrateFunc
+}
+
+// SchemaMigrator 在Redis键格式变化时原地升级已有记录，多实例间通过分布式锁保证只执行一次
+type SchemaMigrator struct {
+	client     *redis.Client
+	patterns   []string
+	migrations []Migration
+
+	lockTTL      time.Duration
+	waitTimeout  time.Duration
+	pollInterval time.Duration
+}
+
+// NewSchemaMigrator creates a migrator for records matching patterns
+// (DefaultAPIKeyPatterns when none are given)
+func NewSchemaMigrator(client *redis.Client, patterns ...string) *SchemaMigrator {
+	if len(patterns) == 0 {
+		patterns = DefaultAPIKeyPatterns
+	}
+	return &SchemaMigrator{
+		client:       client,
+		patterns:     patterns,
+		lockTTL:      5 * time.Minute,
+		waitTimeout:  2 * time.Minute,
+		pollInterval: 500 * time.Millisecond,
+	}
+}
+
+// Register adds a migration step; steps run in version order
+func (m *SchemaMigrator) Register(migration Migration) {
+	m.migrations = append(m.migrations, migration)
+	sort.Slice(m.migrations, func(i, j int) bool { return m.migrations[i].Version < m.migrations[j].Version })
+}
+
+// CurrentVersion returns the highest registered version
+func (m *SchemaMigrator) CurrentVersion() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// StoredVersion reads gw:schema:version; a missing key is version 0
+func (m *SchemaMigrator) StoredVersion(ctx context.Context) (int, error) {
+	v, err := m.client.Get(ctx, SchemaVersionKey).Int()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return v, err
+}
+
+// Run applies every registered migration newer than the stored version
+func (m *SchemaMigrator) Run(ctx context.Context) error {
+	stored, err := m.StoredVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if stored >= m.CurrentVersion() {
+		return nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"stored_version":  stored,
+		"current_version": m.CurrentVersion(),
+	}).Info("Redis schema migration required")
+
+	for _, migration := range m.migrations {
+		if migration.Version <= stored {
+			continue
+		}
+		if err := m.Migrate(ctx, migration.Version, migration.Migrate); err != nil {
+			return fmt.Errorf("migration to v%d (%s) failed: %w", migration.Version, migration.Description, err)
+		}
+	}
+	return nil
+}
+
+// Migrate applies migrateFn to every record and bumps the stored version. It is
+// a no-op when the stored version is already at or past version. Only one
+// instance migrates at a time; the others wait for it to finish.
+func (m *SchemaMigrator) Migrate(ctx context.Context, version int, migrateFn MigrateFunc) error {
+	token, err := m.acquireLock(ctx, version)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		// 其他实例已完成迁移
+		return nil
+	}
+	defer m.releaseLock(token)
+
+	stored, err := m.StoredVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if stored >= version {
+		return nil
+	}
+	if stored != version-1 {
+		return fmt.Errorf("cannot migrate from v%d to v%d: intermediate migrations missing", stored, version)
+	}
+
+	migrated := 0
+	for _, pattern := range m.patterns {
+		n, err := m.migratePattern(ctx, pattern, migrateFn)
+		migrated += n
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := m.client.Set(ctx, SchemaVersionKey, version, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store schema version: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"version":  version,
+		"migrated": migrated,
+	}).Info("Redis schema migration completed")
+	return nil
+}
+
+// acquireLock takes the migration lock. It returns an empty token without error
+// when another instance finished the migration while we waited.
+func (m *SchemaMigrator) acquireLock(ctx context.Context, version int) (string, error) {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	token := hex.EncodeToString(buf)
+
+	deadline := time.Now().Add(m.waitTimeout)
+	for {
+		ok, err := m.client.SetNX(ctx, SchemaLockKey, token, m.lockTTL).Result()
+		if err != nil {
+			return "", fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if ok {
+			return token, nil
+		}
+
+		if stored, err := m.StoredVersion(ctx); err == nil && stored >= version {
+			return "", nil
+		}
+		if time.Now().After(deadline) {
+			return "", ErrMigrationInProgress
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(m.pollInterval):
+		}
+	}
+}
+
+// releaseScript 仅删除自己持有的锁
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (m *SchemaMigrator) releaseLock(token string) {
+	if err := releaseScript.Run(context.Background(), m.client, []string{SchemaLockKey}, token).Err(); err != nil {
+		logrus.WithError(err).Warn("Failed to release migration lock")
+	}
+}
+
+// migratePattern scans keys matching pattern and migrates string values and hash fields
+func (m *SchemaMigrator) migratePattern(ctx context.Context, pattern string, migrateFn MigrateFunc) (int, error) {
+	migrated := 0
+	iter := m.client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		key := iter.Val()
+		keyType, err := m.client.Type(ctx, key).Result()
+		if err != nil {
+			return migrated, err
+		}
+
+		switch keyType {
+		case "string":
+			changed, err := m.migrateString(ctx, key, migrateFn)
+			if err != nil {
+				return migrated, fmt.Errorf("key %s: %w", key, err)
+			}
+			if changed {
+				migrated++
+			}
+		case "hash":
+			n, err := m.migrateHash(ctx, key, migrateFn)
+			migrated += n
+			if err != nil {
+				return migrated, fmt.Errorf("hash %s: %w", key, err)
+			}
+		default:
+			logrus.WithFields(logrus.Fields{"key": key, "type": keyType}).Warn("Skipping key with unexpected type during migration")
+		}
+	}
+	return migrated, iter.Err()
+}
+
+// migrateString rewrites a string key; WATCH makes the update fail rather than
+// overwrite a value written concurrently by a running instance
+func (m *SchemaMigrator) migrateString(ctx context.Context, key string, migrateFn MigrateFunc) (bool, error) {
+	changed := false
+	err := m.retryWatch(ctx, key, func(tx *redis.Tx) error {
+		old, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		updated, err := migrateFn(key, old)
+		if err != nil {
+			return err
+		}
+		if changed = !bytes.Equal(old, updated); !changed {
+			return nil
+		}
+		ttl, err := tx.PTTL(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if ttl < 0 {
+			ttl = redis.KeepTTL
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, updated, ttl)
+			return nil
+		})
+		return err
+	})
+	return changed, err
+}
+
+// migrateHash rewrites every field of a hash key
+func (m *SchemaMigrator) migrateHash(ctx context.Context, key string, migrateFn MigrateFunc) (int, error) {
+	fields, err := m.client.HKeys(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, field := range fields {
+		err := m.retryWatch(ctx, key, func(tx *redis.Tx) error {
+			old, err := tx.HGet(ctx, key, field).Bytes()
+			if err == redis.Nil {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			updated, err := migrateFn(field, old)
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(old, updated) {
+				return nil
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.HSet(ctx, key, field, updated)
+				return nil
+			})
+			if err == nil {
+				migrated++
+			}
+			return err
+		})
+		if err != nil {
+			return migrated, fmt.Errorf("field %s: %w", field, err)
+		}
+	}
+	return migrated, nil
+}
+
+// retryWatch runs fn in a WATCH transaction, retrying when the key changed underneath
+func (m *SchemaMigrator) retryWatch(ctx context.Context, key string, fn func(tx *redis.Tx) error) error {
+	const maxRetries = 5
+	for i := 0; i < maxRetries; i++ {
+		err := m.client.Watch(ctx, fn, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("record kept changing after %d retries", maxRetries)
+}
@@ -0,0 +1,153 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type apiKeyV1 struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type apiKeyV2 struct {
+	apiKeyV1
+	Scopes []string `json:"scopes"`
+}
+
+// addScopes is the v2 migration: records without scopes get the default one
+func addScopes(calls *int32) MigrateFunc {
+	return func(key string, old []byte) ([]byte, error) {
+		atomic.AddInt32(calls, 1)
+		var record apiKeyV2
+		if err := json.Unmarshal(old, &record); err != nil {
+			return nil, err
+		}
+		if record.Scopes == nil {
+			record.Scopes = []string{"default"}
+		}
+		return json.Marshal(record)
+	}
+}
+
+func newTestClient(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return mr, client
+}
+
+func TestSchemaMigratorAddsDefaultScope(t *testing.T) {
+	ctx := context.Background()
+	mr, client := newTestClient(t)
+
+	v1, _ := json.Marshal(apiKeyV1{ID: "k1", Name: "legacy", Permissions: []string{"ai:chat"}})
+	require.NoError(t, client.Set(ctx, "gw:apikeys:k1", v1, time.Hour).Err())
+	require.NoError(t, client.HSet(ctx, "store:api_keys", "hash-k2", v1).Err())
+	require.NoError(t, client.Set(ctx, SchemaVersionKey, 1, 0).Err())
+
+	var calls int32
+	migrator := NewSchemaMigrator(client)
+	migrator.Register(Migration{Version: 2, Description: "add scopes", Migrate: addScopes(&calls)})
+	require.NoError(t, migrator.Run(ctx))
+
+	var migrated apiKeyV2
+	data, err := client.Get(ctx, "gw:apikeys:k1").Bytes()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &migrated))
+	assert.Equal(t, []string{"default"}, migrated.Scopes)
+	assert.Equal(t, "legacy", migrated.Name)
+	assert.Equal(t, []string{"ai:chat"}, migrated.Permissions)
+	assert.Equal(t, time.Hour, mr.TTL("gw:apikeys:k1"), "TTL is preserved")
+
+	data, err = client.HGet(ctx, "store:api_keys", "hash-k2").Bytes()
+	require.NoError(t, err)
+	migrated = apiKeyV2{}
+	require.NoError(t, json.Unmarshal(data, &migrated))
+	assert.Equal(t, []string{"default"}, migrated.Scopes)
+
+	version, err := migrator.StoredVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.False(t, mr.Exists(SchemaLockKey), "lock is released")
+
+	// already at v2: nothing runs again
+	require.NoError(t, migrator.Run(ctx))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestSchemaMigratorRunsOnceAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	_, client := newTestClient(t)
+
+	v1, _ := json.Marshal(apiKeyV1{ID: "k"})
+	for _, id := range []string{"a", "b", "c"} {
+		require.NoError(t, client.Set(ctx, "gw:apikeys:"+id, v1, 0).Err())
+	}
+	require.NoError(t, client.Set(ctx, SchemaVersionKey, 1, 0).Err())
+
+	var calls int32
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m := NewSchemaMigrator(client)
+			m.pollInterval = 10 * time.Millisecond
+			m.Register(Migration{Version: 2, Migrate: addScopes(&calls)})
+			errs[i] = m.Run(ctx)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls), "each record migrated exactly once")
+}
+
+func TestSchemaMigratorRejectsVersionGap(t *testing.T) {
+	ctx := context.Background()
+	_, client := newTestClient(t)
+
+	var calls int32
+	migrator := NewSchemaMigrator(client)
+	err := migrator.Migrate(ctx, 3, addScopes(&calls))
+	assert.Error(t, err)
+
+	version, err := migrator.StoredVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+}
+
+func TestSchemaMigratorWaitsForLockHolder(t *testing.T) {
+	ctx := context.Background()
+	_, client := newTestClient(t)
+	require.NoError(t, client.Set(ctx, SchemaLockKey, "other-instance", time.Minute).Err())
+
+	migrator := NewSchemaMigrator(client)
+	migrator.pollInterval = 10 * time.Millisecond
+	migrator.waitTimeout = 50 * time.Millisecond
+	var calls int32
+	assert.ErrorIs(t, migrator.Migrate(ctx, 1, addScopes(&calls)), ErrMigrationInProgress)
+
+	// the other instance finishes while we wait
+	migrator.waitTimeout = time.Second
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		client.Set(ctx, SchemaVersionKey, 1, 0)
+	}()
+	assert.NoError(t, migrator.Migrate(ctx, 1, addScopes(&calls)))
+	assert.Zero(t, atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,92 @@
+package resources
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// clockTicksPerSecond is USER_HZ, the unit of the CPU times in /proc; it is
+// 100 on every Linux architecture Go supports
+const clockTicksPerSecond = 100
+
+// CPUSampler 通过 /proc/self/stat 计算本进程的 CPU 使用率：两次采样之间消耗的
+// CPU 时间占同期所有核心可用时间的百分比（0-100）。读取函数可替换以便测试。
+type CPUSampler struct {
+	ReadStat func() ([]byte, error)
+	NumCPU   int
+
+	mutex    sync.Mutex
+	lastCPU  time.Duration
+	lastWall time.Time
+}
+
+// NewCPUSampler returns a sampler of the current process
+func NewCPUSampler() *CPUSampler {
+	return &CPUSampler{
+		ReadStat: func() ([]byte, error) {
+			return os.ReadFile("/proc/self/stat")
+		},
+		NumCPU: runtime.NumCPU(),
+	}
+}
+
+// Sample returns the CPU usage since the previous sample. The first sample
+// only sets the baseline and reports ok false, as do systems without /proc.
+func (s *CPUSampler) Sample(now time.Time) (percent float64, ok bool, err error) {
+	data, err := s.ReadStat()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read process CPU time: %w", err)
+	}
+	cpu, err := parseProcessCPUTime(data)
+	if err != nil {
+		return 0, false, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	lastCPU, lastWall := s.lastCPU, s.lastWall
+	s.lastCPU, s.lastWall = cpu, now
+	wall := now.Sub(lastWall)
+	if lastWall.IsZero() || wall <= 0 || s.NumCPU <= 0 {
+		return 0, false, nil
+	}
+
+	percent = float64(cpu-lastCPU) / float64(wall) / float64(s.NumCPU) * 100
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	return percent, true, nil
+}
+
+// parseProcessCPUTime returns utime + stime of a /proc/<pid>/stat file. The
+// command name in parentheses may contain spaces, so fields are counted from
+// the closing parenthesis: state is field 3, utime 14 and stime 15.
+func parseProcessCPUTime(data []byte) (time.Duration, error) {
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return 0, fmt.Errorf("unexpected process stat format")
+	}
+	fields := bytes.Fields(data[end+1:])
+	const utimeIndex = 14 - 3 // fields[0] is the state
+	if len(fields) <= utimeIndex+1 {
+		return 0, fmt.Errorf("process stat lacks utime and stime")
+	}
+
+	var ticks int64
+	for _, field := range fields[utimeIndex : utimeIndex+2] {
+		value, err := strconv.ParseInt(string(field), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("unexpected CPU time %q in process stat", field)
+		}
+		ticks += value
+	}
+	return time.Duration(ticks) * time.Second / clockTicksPerSecond, nil
+}
@@ -0,0 +1,52 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// procStat returns a /proc/<pid>/stat line with the given utime and stime ticks
+func procStat(utime, stime int) []byte {
+	return []byte(fmt.Sprintf("4242 (ai gateway) S 1 4242 4242 0 -1 4194560 1000 0 0 0 %d %d 0 0 20 0 12 0 100 0 0", utime, stime))
+}
+
+func TestParseProcessCPUTime(t *testing.T) {
+	cpu, err := parseProcessCPUTime(procStat(250, 50))
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Second, cpu, "ticks are hundredths of a second")
+
+	_, err = parseProcessCPUTime([]byte("4242 (gateway) S 1 2"))
+	assert.Error(t, err)
+	_, err = parseProcessCPUTime([]byte("garbage"))
+	assert.Error(t, err)
+}
+
+func TestCPUSamplerReportsShareOfAllCores(t *testing.T) {
+	stat := procStat(0, 0)
+	sampler := &CPUSampler{
+		ReadStat: func() ([]byte, error) { return stat, nil },
+		NumCPU:   4,
+	}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	_, ok, err := sampler.Sample(start)
+	require.NoError(t, err)
+	assert.False(t, ok, "the first sample only sets the baseline")
+
+	// 20s of CPU time in 10s of wall time on 4 cores
+	stat = procStat(1500, 500)
+	percent, ok, err := sampler.Sample(start.Add(10 * time.Second))
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.InDelta(t, 50, percent, 0.001)
+
+	sampler.ReadStat = func() ([]byte, error) { return nil, errors.New("no /proc") }
+	_, ok, err = sampler.Sample(start.Add(20 * time.Second))
+	assert.Error(t, err)
+	assert.False(t, ok)
+}
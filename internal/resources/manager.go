@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"go-aigateway/internal/errors"
+	"go-aigateway/internal/logging"
 
 	"github.com/sirupsen/logrus"
 )
@@ -42,7 +43,7 @@ func NewResourceManager(cfg *ResourceConfig) *ResourceManager {
 
 	rm := &ResourceManager{
 		resources: make(map[string]ManagedResource),
-		logger:    logrus.New(),
+		logger:    logging.Default(),
 		ctx:       ctx,
 		cancel:    cancel,
 	}
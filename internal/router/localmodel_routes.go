@@ -4,13 +4,17 @@ import (
 	"go-aigateway/internal/config"
 	"go-aigateway/internal/handlers"
 	"go-aigateway/internal/localmodel"
+	"go-aigateway/internal/security"
 
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 )
 
-// SetupLocalModelRoutes sets up routes for the local model
-func SetupLocalModelRoutes(r *gin.Engine, manager *localmodel.Manager, cfg *config.Config) {
+// SetupLocalModelRoutes sets up routes for the local model; checkpointed
+// generation needs Redis for its metadata and is skipped without it
+func SetupLocalModelRoutes(r *gin.Engine, manager *localmodel.Manager, source config.Source, localAuth *security.LocalAuthenticator, redisClient *redis.Client) {
+	cfg := source.Current()
 	if !cfg.LocalModel.Enabled {
 		logrus.Info("Local model is disabled")
 		return
@@ -25,4 +29,11 @@ func SetupLocalModelRoutes(r *gin.Engine, manager *localmodel.Manager, cfg *conf
 	// Register routes
 	handlers.RegisterLocalModelRoutes(r, handler)
 	handlers.RegisterLocalModelManagerRoutes(r, managerHandler)
+
+	if redisClient == nil {
+		logrus.Info("Checkpointed local generation is disabled: Redis is not available")
+		return
+	}
+	checkpointer := localmodel.NewInferenceCheckpointer(&cfg.LocalModel, redisClient)
+	handlers.RegisterLocalModelCheckpointRoutes(r, handlers.NewLocalModelCheckpointHandler(checkpointer, &cfg.LocalModel), source, localAuth)
 }
@@ -3,17 +3,28 @@ package router
 import (
 	"time"
 
+	"go-aigateway/internal/chaos"
 	"go-aigateway/internal/cloud"
 	"go-aigateway/internal/config"
+	"go-aigateway/internal/flags"
 	"go-aigateway/internal/handlers"
+	"go-aigateway/internal/lifecycle"
+	"go-aigateway/internal/logging"
 	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/monitoring"
+	"go-aigateway/internal/performance"
 	"go-aigateway/internal/security"
+	"go-aigateway/internal/storage"
 
 	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 )
 
-func SetupRoutes(r *gin.Engine, cfg *config.Config, localAuth *security.LocalAuthenticator) {
+// SetupRoutes registers the core gateway routes. Chat completions are versioned:
+// V2 clients can continue the given conversation sessions, which may be nil.
+func SetupRoutes(r *gin.Engine, source config.Source, localAuth *security.LocalAuthenticator, sessions *handlers.ConversationSessions, proxy ...gin.HandlerFunc) {
+	cfg := source.Current()
+
 	// Health check endpoint (no auth required)
 	if cfg.HealthCheck {
 		r.GET("/health", handlers.HealthCheck)
@@ -24,7 +35,7 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, localAuth *security.LocalAut
 	r.GET("/test", handlers.TestAPIHandler(cfg))
 
 	// Metrics endpoint (no auth required)
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.GET("/metrics", gin.WrapH(monitoring.MetricsHandler()))
 
 	// Standardized API v1 group for management APIs
 	apiV1 := r.Group("/api/v1")
@@ -34,16 +45,25 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, localAuth *security.LocalAut
 	{
 		auth.POST("/login", handlers.Login(localAuth))
 		auth.POST("/refresh", handlers.RefreshToken(localAuth))
+		auth.POST("/revoke", handlers.RevokeToken(localAuth))
+		auth.POST("/logout", middleware.JWTAuth(localAuth, ""), handlers.Logout(localAuth))
 	}
 
 	// API management endpoints (admin auth required)
 	admin := apiV1.Group("/admin")
 	admin.Use(middleware.LocalAuth(localAuth, "admin"))
 	{
-		admin.POST("/api-keys", handlers.CreateAPIKey(localAuth))
-		admin.GET("/api-keys", handlers.ListAPIKeys(localAuth))
-		admin.DELETE("/api-keys/:id", handlers.DeleteAPIKey(localAuth))
-		admin.PUT("/api-keys/:id", handlers.UpdateAPIKey(localAuth))
+		admin.POST("/smoke-test", handlers.SmokeTest(cfg, security.NewAuditLogger()))
+	}
+
+	// API key lifecycle for any user, restricted to holders of admin:keys rather than "admin"
+	apiKeys := apiV1.Group("/admin/api-keys", middleware.LocalAuth(localAuth, ""), middleware.RequirePermission(localAuth, security.PermissionAdminKeys))
+	{
+		apiKeys.POST("", handlers.CreateAPIKey(localAuth))
+		apiKeys.GET("", handlers.ListAPIKeys(localAuth))
+		apiKeys.DELETE("/:id", handlers.DeleteAPIKey(localAuth))
+		apiKeys.POST("/:id/rotate", handlers.RotateAPIKey(localAuth))
+		apiKeys.PUT("/:id", handlers.UpdateAPIKey(localAuth))
 	}
 
 	// Backward compatibility - Legacy authentication endpoints (deprecated but supported)
@@ -53,9 +73,10 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, localAuth *security.LocalAut
 		legacyAuth.POST("/refresh", handlers.RefreshToken(localAuth))
 	}
 
-	// Backward compatibility - Legacy admin endpoints (deprecated but supported)
+	// Backward compatibility - Legacy admin endpoints (deprecated but supported),
+	// restricted to holders of admin:keys like /api/v1/admin/api-keys
 	legacyAdmin := r.Group("/admin")
-	legacyAdmin.Use(middleware.LocalAuth(localAuth, "admin"))
+	legacyAdmin.Use(middleware.LocalAuth(localAuth, ""), middleware.RequirePermission(localAuth, security.PermissionAdminKeys))
 	{
 		legacyAdmin.POST("/api-keys", handlers.CreateAPIKey(localAuth))
 		legacyAdmin.GET("/api-keys", handlers.ListAPIKeys(localAuth))
@@ -65,33 +86,53 @@ func SetupRoutes(r *gin.Engine, cfg *config.Config, localAuth *security.LocalAut
 
 	// OpenAI-compatible API routes with API key authentication for external clients
 	api := r.Group("/v1")
-	api.Use(middleware.APIKeyAuth(cfg))
+	api.Use(middleware.APIKeyAuth(source, localAuth))
+	// proxy runs on the authenticated proxy routes only, e.g. the priority queue
+	api.Use(proxy...)
+
+	// Malformed chat and completion bodies are rejected before they reach the upstream
+	validateChat := middleware.AIRequestValidator(&cfg.Validation, middleware.ChatRequest)
+	validateCompletion := middleware.AIRequestValidator(&cfg.Validation, middleware.CompletionRequest)
+	versioned := NewVersionRouter(api.Group("", validateChat))
+
+	// Chat completions endpoint, selected by X-API-Version or the Accept media type
+	fallback := handlers.NewFallbackRouter(cfg)
+	chatV1 := fallback.Wrap(handlers.ChatCompletions(cfg))
+	chatV2 := handlers.ChatCompletionsV2(cfg, sessions)
+	versioned.POST("/chat/completions", VersionedHandlers{1: chatV1, 2: chatV2})
 
-	// Chat completions endpoint
-	api.POST("/chat/completions", handlers.ChatCompletions(cfg))
+	// Responses API, translated to chat completions
+	api.POST("/responses", handlers.Responses(cfg))
 
 	// Completions endpoint (legacy)
-	api.POST("/completions", handlers.Completions(cfg))
+	api.POST("/completions", validateCompletion, handlers.Completions(cfg))
 
 	// Models endpoint
 	api.GET("/models", handlers.Models(cfg))
 
+	// Embeddings endpoint, with dimension and encoding options from route actions
+	api.POST("/embeddings", handlers.Embeddings(cfg))
+
+	// Conversation summaries with the original messages they replaced
+	api.GET("/conversations/:id/summaries", handlers.GetConversationSummaries())
+
 	// Additional OpenAI-compatible endpoints
-	api.POST("/engines/:engine/completions", handlers.Completions(cfg))
-	api.POST("/engines/:engine/chat/completions", handlers.ChatCompletions(cfg))
+	api.POST("/engines/:engine/completions", validateCompletion, handlers.Completions(cfg))
+	versioned.POST("/engines/:engine/chat/completions", VersionedHandlers{1: chatV1, 2: chatV2})
 
 	// Legacy API routes (for backward compatibility, no auth required for testing)
 	legacy := r.Group("/api/v1")
 	{
-		legacy.POST("/chat", handlers.ChatCompletions(cfg))
-		legacy.POST("/chat/completions", handlers.ChatCompletions(cfg))
-		legacy.POST("/completions", handlers.Completions(cfg))
+		legacy.POST("/chat", validateChat, fallback.Wrap(handlers.ChatCompletions(cfg)))
+		legacy.POST("/chat/completions", validateChat, fallback.Wrap(handlers.ChatCompletions(cfg)))
+		legacy.POST("/completions", validateCompletion, handlers.Completions(cfg))
 		legacy.GET("/models", handlers.Models(cfg))
+		legacy.POST("/embeddings", handlers.Embeddings(cfg))
 	}
 }
 
 // SetupCloudRoutes sets up standardized cloud management routes
-func SetupCloudRoutes(r *gin.Engine, integrator *cloud.CloudIntegrator) {
+func SetupCloudRoutes(r *gin.Engine, integrator cloud.Integrator) {
 	if integrator == nil {
 		return
 	}
@@ -238,3 +279,382 @@ func SetupCloudRoutes(r *gin.Engine, integrator *cloud.CloudIntegrator) {
 		legacyCloudGroup.PUT("/services/:name/config", updateServiceConfigHandler)
 	}
 }
+
+// SetupStorageRoutes registers storage administration routes
+func SetupStorageRoutes(r *gin.Engine, store storage.Store, localAuth *security.LocalAuthenticator) {
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		admin.POST("/backup", handlers.BackupHandler(store))
+	}
+}
+
+// SetupFlagRoutes registers feature flag administration routes
+func SetupFlagRoutes(r *gin.Engine, svc *flags.Service, localAuth *security.LocalAuthenticator) {
+	if svc == nil {
+		return
+	}
+
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		admin.GET("/flags", handlers.GetFlags(svc))
+		admin.PUT("/flags", handlers.UpdateFlags(svc, security.NewAuditLogger()))
+	}
+}
+
+// SetupExperimentRoutes registers the A/B experiment administration endpoints
+func SetupExperimentRoutes(r *gin.Engine, ec *handlers.ExperimentController, localAuth *security.LocalAuthenticator) {
+	if ec == nil {
+		return
+	}
+
+	experiments := r.Group("/api/v1/experiments")
+	experiments.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		experiments.POST("", handlers.CreateExperiment(ec))
+		experiments.GET("", handlers.ListExperiments(ec))
+		experiments.POST("/:id/stop", handlers.StopExperiment(ec))
+		experiments.GET("/:id/results", handlers.GetExperimentResults(ec))
+	}
+}
+
+// SetupSentinelRoutes registers the sentinel prompt drift detection endpoints
+func SetupSentinelRoutes(r *gin.Engine, d *handlers.DriftDetector, localAuth *security.LocalAuthenticator) {
+	if d == nil {
+		return
+	}
+
+	audit := security.NewAuditLogger()
+	sentinels := r.Group("/api/v1/admin/sentinels")
+	sentinels.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		sentinels.POST("", handlers.CreateSentinel(d, audit))
+		sentinels.GET("", handlers.ListSentinels(d))
+		sentinels.GET("/:id/history", handlers.GetSentinelHistory(d))
+		sentinels.POST("/:id/run", handlers.RunSentinel(d))
+		sentinels.POST("/:id/approve", handlers.ApproveSentinelBaseline(d, audit))
+		sentinels.DELETE("/:id", handlers.DeleteSentinel(d, audit))
+	}
+}
+
+// SetupOIDCRoutes registers the OIDC single sign-on endpoints
+func SetupOIDCRoutes(r *gin.Engine, oidcAuth *security.OIDCAuthenticator, tokenExpiration time.Duration) {
+	if oidcAuth == nil {
+		return
+	}
+
+	auth := r.Group("/api/v1/auth/oidc")
+	{
+		auth.POST("/authorize", handlers.OIDCAuthorize(oidcAuth))
+		auth.GET("/callback", handlers.OIDCCallback(oidcAuth, int64(tokenExpiration.Seconds())))
+	}
+}
+
+// SetupDrainRoutes registers the readiness probe and in-flight request listing
+func SetupDrainRoutes(r *gin.Engine, drainer *middleware.Drainer, components *lifecycle.Manager, localAuth *security.LocalAuthenticator) {
+	r.GET("/ready", handlers.Readiness(drainer, components))
+
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		admin.GET("/inflight", handlers.GetInflight(drainer))
+	}
+}
+
+// SetupCapacityRoutes registers reserved capacity pool administration
+func SetupCapacityRoutes(r *gin.Engine, pools *middleware.CapacityPools, localAuth *security.LocalAuthenticator) {
+	if pools == nil {
+		return
+	}
+
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		admin.GET("/capacity", handlers.GetCapacity(pools))
+		admin.PUT("/capacity", handlers.UpdateCapacity(pools))
+	}
+}
+
+// SetupKillSwitchRoutes registers the emergency kill switch endpoints
+func SetupKillSwitchRoutes(r *gin.Engine, ks *middleware.KillSwitches, localAuth *security.LocalAuthenticator) {
+	if ks == nil {
+		return
+	}
+
+	kill := r.Group("/api/v1/admin/kill")
+	kill.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		kill.GET("", handlers.ListKillSwitches(ks))
+		kill.POST("/tenant/:id", handlers.ArmKillSwitch(ks, middleware.KillScopeTenant, "id"))
+		kill.DELETE("/tenant/:id", handlers.LiftKillSwitch(ks, middleware.KillScopeTenant, "id"))
+		kill.POST("/provider/:label", handlers.ArmKillSwitch(ks, middleware.KillScopeProvider, "label"))
+		kill.DELETE("/provider/:label", handlers.LiftKillSwitch(ks, middleware.KillScopeProvider, "label"))
+	}
+}
+
+// SetupContentFilterRoutes registers the response filter pattern endpoints
+func SetupContentFilterRoutes(r *gin.Engine, filter *middleware.ContentFilter, localAuth *security.LocalAuthenticator) {
+	if filter == nil {
+		return
+	}
+
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		admin.GET("/filter-patterns", handlers.ListFilterPatterns(filter))
+		admin.POST("/filter-patterns", handlers.AddFilterPattern(filter))
+	}
+}
+
+// SetupConfigRoutes registers the endpoints showing and reloading the active configuration
+func SetupConfigRoutes(r *gin.Engine, reloader *config.Reloader, localAuth *security.LocalAuthenticator) {
+	if reloader == nil {
+		return
+	}
+
+	admin := r.Group("/api/v1/admin/config")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		admin.GET("", handlers.GetActiveConfig(reloader))
+		admin.POST("/reload", handlers.ReloadConfig(reloader))
+	}
+}
+
+// SetupChaosRoutes registers the chaos rule management endpoints
+func SetupChaosRoutes(r *gin.Engine, inj *chaos.Injector, localAuth *security.LocalAuthenticator) {
+	if inj == nil {
+		return
+	}
+
+	admin := r.Group("/api/v1/admin/chaos")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		admin.GET("", handlers.ListChaosRules(inj))
+		admin.PUT("", handlers.UpdateChaosRules(inj))
+		admin.DELETE("", handlers.ClearChaosRules(inj))
+	}
+}
+
+// SetupSLORoutes registers the SLO dashboard endpoint and definition management
+func SetupSLORoutes(r *gin.Engine, tracker *monitoring.SLOTracker, localAuth *security.LocalAuthenticator) {
+	if tracker == nil {
+		return
+	}
+
+	r.GET("/api/v1/monitoring/slo", handlers.GetSLOStatus(tracker))
+
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		admin.GET("/slos", handlers.ListSLOs(tracker))
+		admin.PUT("/slos/:id", handlers.UpsertSLO(tracker))
+		admin.DELETE("/slos/:id", handlers.DeleteSLO(tracker))
+	}
+}
+
+// SetupEndpointRateLimitRoutes registers the per-endpoint rate limit statistics
+func SetupEndpointRateLimitRoutes(r *gin.Engine, limiter *middleware.EndpointRateLimiter, localAuth *security.LocalAuthenticator) {
+	if limiter == nil {
+		return
+	}
+
+	ratelimit := r.Group("/api/v1/ratelimit")
+	ratelimit.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		ratelimit.GET("/endpoint-stats", handlers.GetEndpointRateStats(limiter))
+	}
+}
+
+// SetupPerformanceRoutes registers the circuit breaker state and the response
+// cache invalidation of the performance optimizer
+func SetupPerformanceRoutes(r *gin.Engine, po *performance.PerformanceOptimizer, localAuth *security.LocalAuthenticator) {
+	if po == nil {
+		return
+	}
+
+	perf := r.Group("/api/v1/performance")
+	perf.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		perf.GET("/circuit-breakers", handlers.GetCircuitBreakers(po))
+	}
+
+	cache := r.Group("/api/v1/cache")
+	cache.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		cache.DELETE("", handlers.FlushCache(po))
+	}
+}
+
+// SetupBackendRoutes registers the load balancer backend latencies of the monitoring handler
+func SetupBackendRoutes(r *gin.Engine, h *handlers.MonitoringHandler, localAuth *security.LocalAuthenticator) {
+	if h == nil {
+		return
+	}
+
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		admin.GET("/backends", h.GetBackends)
+	}
+}
+
+// SetupKeyEventRoutes registers the API key lifecycle event feed
+func SetupKeyEventRoutes(r *gin.Engine, stream *security.KeyEventStream, localAuth *security.LocalAuthenticator) {
+	if stream == nil {
+		return
+	}
+
+	keys := r.Group("/api/v1/keys")
+	keys.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		keys.GET("/events", handlers.GetKeyEvents(stream))
+	}
+}
+
+// SetupDebugCaptureRoutes registers the debug capture inspection and control endpoints
+func SetupDebugCaptureRoutes(r *gin.Engine, dc *monitoring.DebugCapture, localAuth *security.LocalAuthenticator) {
+	if dc == nil {
+		return
+	}
+
+	debug := r.Group("/api/v1/admin/debug/captures")
+	debug.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		debug.GET("", handlers.GetDebugCaptures(dc))
+		debug.POST("/start", handlers.StartDebugCapture(dc))
+		debug.POST("/stop", handlers.StopDebugCapture(dc))
+	}
+}
+
+// SetupLogLevelRoutes registers temporary log level changes
+func SetupLogLevelRoutes(r *gin.Engine, lc *logging.LevelController, localAuth *security.LocalAuthenticator) {
+	audit := security.NewAuditLogger()
+	level := r.Group("/api/v1/admin/log-level")
+	level.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		level.GET("", handlers.GetLogLevel(lc))
+		level.PUT("", handlers.UpdateLogLevel(lc, audit))
+		level.DELETE("", handlers.ResetLogLevel(lc, audit))
+	}
+}
+
+// SetupSlowRequestRoutes registers the slow request listing
+func SetupSlowRequestRoutes(r *gin.Engine, detector *middleware.SlowRequestDetector, localAuth *security.LocalAuthenticator) {
+	if detector == nil {
+		return
+	}
+
+	debug := r.Group("/api/v1/debug")
+	debug.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		debug.GET("/slow-requests", handlers.GetSlowRequests(detector))
+	}
+}
+
+// SetupModelLifecycleRoutes registers model deprecation and retirement administration
+func SetupModelLifecycleRoutes(r *gin.Engine, registry *handlers.ModelLifecycleRegistry, localAuth *security.LocalAuthenticator) {
+	if registry == nil {
+		return
+	}
+
+	models := r.Group("/api/v1/admin/models")
+	models.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		models.GET("/lifecycle", handlers.ListModelLifecycles(registry))
+		models.PUT("/lifecycle/:model", handlers.PutModelLifecycle(registry))
+		models.DELETE("/lifecycle/:model", handlers.DeleteModelLifecycle(registry))
+		models.GET("/deprecation-report", handlers.GetDeprecationReport(registry))
+	}
+}
+
+// SetupPromptRoutes registers the admin API of the versioned prompt template store
+func SetupPromptRoutes(r *gin.Engine, ps *handlers.PromptStore, localAuth *security.LocalAuthenticator) {
+	if ps == nil {
+		return
+	}
+
+	audit := security.NewAuditLogger()
+	prompts := r.Group("/api/v1/admin/prompts")
+	prompts.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		prompts.POST("", handlers.CreatePromptTemplate(ps, audit))
+		prompts.GET("", handlers.ListPromptTemplates(ps))
+		prompts.GET("/:name/versions", handlers.ListPromptVersions(ps))
+		prompts.GET("/:name/versions/:version", handlers.GetPromptVersion(ps))
+		prompts.DELETE("/:name/versions/:version", handlers.RetirePromptVersion(ps, audit))
+		prompts.GET("/:name/diff", handlers.DiffPromptVersions(ps))
+		prompts.PUT("/:name/pins/:tenant", handlers.PutPromptPin(ps, audit))
+		prompts.DELETE("/:name/pins/:tenant", handlers.DeletePromptPin(ps, audit))
+		prompts.PUT("/:name/rollout", handlers.PutPromptRollout(ps, audit))
+		prompts.DELETE("/:name/rollout", handlers.DeletePromptRollout(ps, audit))
+	}
+}
+
+// SetupSessionRoutes registers branchable conversation sessions for API key holders
+func SetupSessionRoutes(r *gin.Engine, source config.Source, localAuth *security.LocalAuthenticator, sessions *handlers.ConversationSessions) {
+	if sessions == nil {
+		return
+	}
+
+	group := r.Group("/api/v1/sessions")
+	group.Use(middleware.APIKeyAuth(source, localAuth))
+	{
+		group.POST("", handlers.CreateSession(sessions))
+		group.GET("/:id", handlers.GetSession(sessions))
+		group.POST("/:id/messages", handlers.AppendSessionMessages(sessions))
+		group.POST("/:id/branch", handlers.BranchSession(sessions))
+		group.GET("/:id/tree", handlers.GetSessionTree(sessions))
+	}
+}
+
+// SetupCapabilityRoutes lets API key holders discover the features and limits of their key
+func SetupCapabilityRoutes(r *gin.Engine, cfg *config.Config, localAuth *security.LocalAuthenticator, client *redis.Client) {
+	r.GET("/api/v1/capabilities", handlers.Capabilities(cfg, localAuth, client))
+}
+
+// SetupUsageRoutes registers per-key token usage reports: every key for admins,
+// the calling key's own for API key holders
+func SetupUsageRoutes(r *gin.Engine, tracker *monitoring.UsageTracker, localAuth *security.LocalAuthenticator) {
+	if tracker == nil {
+		return
+	}
+
+	r.GET("/api/v1/usage", middleware.LocalAuth(localAuth, "admin"), handlers.GetUsage(tracker))
+	r.GET("/api/v1/usage/me", handlers.GetMyUsage(tracker, localAuth))
+}
+
+// SetupTokenUsageRoutes registers the admin billing reports: the daily token
+// series of an API key and the top consumers
+func SetupTokenUsageRoutes(r *gin.Engine, tracker *monitoring.TokenTracker, localAuth *security.LocalAuthenticator) {
+	if tracker == nil {
+		return
+	}
+
+	admin := r.Group("/api/v1/admin/usage")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		admin.GET("", handlers.GetTokenUsage(tracker))
+		admin.GET("/top", handlers.GetTopConsumers(tracker))
+	}
+}
+
+// SetupNotificationRoutes registers the admin endpoints reading and overriding
+// the alert notification channels
+func SetupNotificationRoutes(r *gin.Engine, ms *monitoring.MonitoringSystem, localAuth *security.LocalAuthenticator) {
+	if ms == nil {
+		return
+	}
+
+	admin := r.Group("/api/v1/monitoring/notifications")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	{
+		admin.GET("", handlers.GetNotifications(ms))
+		admin.PUT("", handlers.UpdateNotifications(ms))
+	}
+}
+
+// SetupEnsembleRoutes registers the multi-model ensemble endpoint for API key holders
+func SetupEnsembleRoutes(r *gin.Engine, source config.Source, localAuth *security.LocalAuthenticator) {
+	r.POST("/api/v1/ensemble", middleware.APIKeyAuth(source, localAuth), handlers.Ensemble(source.Current()))
+}
@@ -0,0 +1,48 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegacyAPIKeyRoutesRequireAdminKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{
+		JWTSecret:       "test-secret",
+		TokenExpiration: time.Hour,
+		MaxAPIKeys:      10,
+		APIKeyPrefix:    "gw-",
+	})
+	// An operator holding "admin" but not admin:keys
+	_, err := localAuth.UpsertExternalUser("ops", "ops", "", []string{"admin"})
+	require.NoError(t, err)
+	opsToken, err := localAuth.GenerateJWT("ops")
+	require.NoError(t, err)
+	adminToken, err := localAuth.GenerateJWT("admin")
+	require.NoError(t, err)
+
+	r := gin.New()
+	SetupRoutes(r, config.NewSnapshot(&config.Config{}), localAuth, nil)
+	call := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, call(http.MethodGet, "/admin/api-keys", opsToken))
+	assert.Equal(t, http.StatusForbidden, call(http.MethodGet, "/api/v1/admin/api-keys", opsToken))
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/admin/api-keys", adminToken))
+	assert.Equal(t, http.StatusNotFound, call(http.MethodPost, "/admin/api-keys/some-id/rotate", adminToken),
+		"rotation is served under /api/v1/admin/api-keys only")
+}
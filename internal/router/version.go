@@ -0,0 +1,105 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIVersionHeader selects the API version explicitly; it takes precedence over the Accept header
+const APIVersionHeader = "X-API-Version"
+
+// LatestAPIVersion is the highest API version the gateway serves
+const LatestAPIVersion = 2
+
+// APIVersionContextKey holds the version serving the request
+const APIVersionContextKey = "api_version"
+
+// versionMediaType matches application/vnd.aigateway.v2+json in an Accept header
+var versionMediaType = regexp.MustCompile(`^application/vnd\.aigateway\.v(\d+)(\+json)?$`)
+
+// VersionedHandlers 同一路由在各API版本下的处理函数
+type VersionedHandlers map[int]gin.HandlerFunc
+
+// VersionRouter 按请求头中的API版本把同一路径分发到不同版本的处理函数。
+// 未指定版本的请求按V1处理；某个版本没有自己的实现时沿用更早版本的实现。
+type VersionRouter struct {
+	routes gin.IRoutes
+}
+
+// NewVersionRouter registers versioned routes on routes, usually a router group
+func NewVersionRouter(routes gin.IRoutes) *VersionRouter {
+	return &VersionRouter{routes: routes}
+}
+
+// Handle registers path for method with one handler per API version. A V1
+// handler is required so clients that send no version are always served.
+func (vr *VersionRouter) Handle(method, path string, handlers VersionedHandlers) {
+	if handlers[1] == nil {
+		panic(fmt.Sprintf("versioned route %s %s has no V1 handler", method, path))
+	}
+	vr.routes.Handle(method, path, func(c *gin.Context) {
+		requested, err := RequestedAPIVersion(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": gin.H{
+					"message": err.Error(),
+					"type":    "invalid_request_error",
+					"code":    "unsupported_api_version",
+				},
+			})
+			return
+		}
+
+		version := requested
+		for handlers[version] == nil {
+			version--
+		}
+		c.Set(APIVersionContextKey, version)
+		c.Header(APIVersionHeader, strconv.Itoa(version))
+		handlers[version](c)
+	})
+}
+
+// POST registers a versioned POST route
+func (vr *VersionRouter) POST(path string, handlers VersionedHandlers) {
+	vr.Handle(http.MethodPost, path, handlers)
+}
+
+// GET registers a versioned GET route
+func (vr *VersionRouter) GET(path string, handlers VersionedHandlers) {
+	vr.Handle(http.MethodGet, path, handlers)
+}
+
+// RequestedAPIVersion returns the API version the client asked for through
+// X-API-Version or an application/vnd.aigateway.v<N>+json Accept entry, or 1
+func RequestedAPIVersion(c *gin.Context) (int, error) {
+	raw := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(c.GetHeader(APIVersionHeader))), "v")
+	if raw == "" {
+		raw = acceptedAPIVersion(c.GetHeader("Accept"))
+	}
+	if raw == "" {
+		return 1, nil
+	}
+
+	version, err := strconv.Atoi(raw)
+	if err != nil || version < 1 || version > LatestAPIVersion {
+		return 0, fmt.Errorf("unsupported API version %q, supported versions are 1 to %d", raw, LatestAPIVersion)
+	}
+	return version, nil
+}
+
+// acceptedAPIVersion extracts the version of the first vendor media type in an Accept header
+func acceptedAPIVersion(accept string) string {
+	for _, entry := range strings.Split(accept, ",") {
+		mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(entry, ";", 2)[0]))
+		if m := versionMediaType.FindStringSubmatch(mediaType); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
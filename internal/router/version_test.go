@@ -0,0 +1,125 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupVersionedChat serves chat completions in both versions against an
+// upstream that always answers with a JSON object matching any schema
+func setupVersionedChat(t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","choices":[{"message":{"role":"assistant","content":"{\"city\":\"Paris\"}"}}]}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	cfg := &config.Config{TargetURL: upstream.URL}
+	r := gin.New()
+	NewVersionRouter(r).POST("/v1/chat/completions", VersionedHandlers{
+		1: handlers.ChatCompletions(cfg),
+		2: handlers.ChatCompletionsV2(cfg, nil),
+	})
+	return r
+}
+
+const versionedChatBody = `{"model":"gpt-4o","messages":[{"role":"user","content":"Capital of France?"}],` +
+	`"response_schema":{"type":"object","required":["city"]}}`
+
+func versionedChat(r *gin.Engine, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(versionedChatBody))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestVersionRouterSelectsHandlerByHeader(t *testing.T) {
+	r := setupVersionedChat(t)
+
+	// V1, the default, returns the upstream completion as is
+	for _, headers := range []map[string]string{nil, {APIVersionHeader: "1"}} {
+		w := versionedChat(r, headers)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "1", w.Header().Get(APIVersionHeader))
+		assert.Equal(t, handlers.SchemaValidationPass, w.Header().Get(handlers.SchemaValidationHeader))
+
+		var v1 map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &v1))
+		assert.Equal(t, "chat.completion", v1["object"])
+		assert.Contains(t, v1, "choices")
+		assert.NotContains(t, v1, "api_version")
+	}
+
+	// V2, requested either way, wraps it with the gateway's view of the request
+	for _, headers := range []map[string]string{
+		{APIVersionHeader: "2"},
+		{"Accept": "application/vnd.aigateway.v2+json"},
+		{"Accept": "text/plain;q=0.5, application/vnd.aigateway.v2+json"},
+	} {
+		w := versionedChat(r, headers)
+		require.Equal(t, http.StatusOK, w.Code, headers)
+		assert.Equal(t, "2", w.Header().Get(APIVersionHeader))
+
+		var v2 handlers.ChatResponseV2
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &v2))
+		assert.Equal(t, 2, v2.APIVersion)
+		assert.Equal(t, handlers.ChatObjectV2, v2.Object)
+		assert.Equal(t, "chatcmpl-1", v2.Data["id"])
+		assert.Contains(t, v2.Data, "choices")
+		assert.Equal(t, handlers.SchemaValidationPass, v2.Gateway.SchemaValidation)
+		assert.Nil(t, v2.Gateway.Session)
+	}
+}
+
+func TestVersionRouterRejectsUnsupportedVersions(t *testing.T) {
+	r := setupVersionedChat(t)
+
+	for _, headers := range []map[string]string{
+		{APIVersionHeader: "3"},
+		{APIVersionHeader: "latest"},
+		{"Accept": "application/vnd.aigateway.v9+json"},
+	} {
+		w := versionedChat(r, headers)
+		assert.Equal(t, http.StatusBadRequest, w.Code, headers)
+		assert.Contains(t, w.Body.String(), `"code":"unsupported_api_version"`)
+	}
+
+	// The explicit header wins over the Accept media type
+	w := versionedChat(r, map[string]string{APIVersionHeader: "v1", "Accept": "application/vnd.aigateway.v2+json"})
+	assert.Equal(t, "1", w.Header().Get(APIVersionHeader))
+}
+
+func TestVersionRouterFallsBackToEarlierVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	NewVersionRouter(r).GET("/v1/models", VersionedHandlers{
+		1: func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"version": c.GetInt(APIVersionContextKey)}) },
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	req.Header.Set(APIVersionHeader, "2")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get(APIVersionHeader))
+	assert.JSONEq(t, `{"version":1}`, w.Body.String())
+
+	assert.Panics(t, func() {
+		NewVersionRouter(r).POST("/v1/only-v2", VersionedHandlers{2: func(*gin.Context) {}})
+	})
+}
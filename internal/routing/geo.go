@@ -0,0 +1,277 @@
+package routing
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-aigateway/internal/httpclient"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// rttCacheTTL bounds how often a region's RTT estimates are read from Redis
+const rttCacheTTL = 5 * time.Second
+
+// Selection reasons
+const (
+	ReasonLowestRTT  = "lowest_rtt"
+	ReasonRoundRobin = "round_robin"
+)
+
+// RTTKey returns the Redis hash holding a provider's RTT estimate from a region
+func RTTKey(region, provider string) string {
+	return fmt.Sprintf("gw:rtt:%s:%s", region, provider)
+}
+
+// Endpoint 上游提供商的一个接入点
+type Endpoint struct {
+	Provider string `json:"provider"`
+	URL      string `json:"url"`
+}
+
+// ParseEndpoints parses provider=url pairs, skipping malformed entries
+func ParseEndpoints(entries []string) []Endpoint {
+	var endpoints []Endpoint
+	for _, entry := range entries {
+		provider, base, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || provider == "" || base == "" {
+			continue
+		}
+		endpoints = append(endpoints, Endpoint{Provider: strings.TrimSpace(provider), URL: strings.TrimSpace(base)})
+	}
+	return endpoints
+}
+
+// RegionLocator maps a client IP to a region
+type RegionLocator interface {
+	Region(ip net.IP) (string, bool)
+}
+
+// MaxMindLocator 使用MaxMind GeoLite2数据库按大洲划分区域（eu、na、as等）
+type MaxMindLocator struct {
+	reader *maxminddb.Reader
+}
+
+// OpenMaxMindLocator opens a GeoLite2 Country or City database
+func OpenMaxMindLocator(path string) (*MaxMindLocator, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+	return &MaxMindLocator{reader: reader}, nil
+}
+
+// Region returns the lowercase continent code of the IP
+func (l *MaxMindLocator) Region(ip net.IP) (string, bool) {
+	if ip == nil {
+		return "", false
+	}
+	var record struct {
+		Continent struct {
+			Code string `maxminddb:"code"`
+		} `maxminddb:"continent"`
+	}
+	if err := l.reader.Lookup(ip, &record); err != nil || record.Continent.Code == "" {
+		return "", false
+	}
+	return strings.ToLower(record.Continent.Code), true
+}
+
+// Close releases the database
+func (l *MaxMindLocator) Close() error {
+	return l.reader.Close()
+}
+
+// Selection 一次路由决策
+type Selection struct {
+	Endpoint
+	Region string        `json:"region,omitempty"`
+	RTT    time.Duration `json:"rtt,omitempty"`
+	Reason string        `json:"reason"`
+}
+
+type rttSnapshot struct {
+	rtts    map[string]time.Duration
+	fetched time.Time
+}
+
+// GeoRouter 根据客户端所在区域选择RTT最低的上游接入点；没有地理或RTT数据时轮询
+type GeoRouter struct {
+	endpoints []Endpoint
+	locator   RegionLocator
+	client    *redis.Client
+	now       func() time.Time
+	// probe measures the RTT to an endpoint from this replica
+	probe func(ctx context.Context, endpoint Endpoint) (time.Duration, error)
+
+	counter atomic.Uint64
+
+	mu    sync.Mutex
+	cache map[string]rttSnapshot
+}
+
+// NewGeoRouter creates a router; a nil locator or client always round-robins
+func NewGeoRouter(client *redis.Client, locator RegionLocator, endpoints []Endpoint) *GeoRouter {
+	return &GeoRouter{
+		endpoints: endpoints,
+		locator:   locator,
+		client:    client,
+		now:       time.Now,
+		probe:     dialRTT,
+		cache:     make(map[string]rttSnapshot),
+	}
+}
+
+// Select picks the endpoint for a client IP
+func (r *GeoRouter) Select(ctx context.Context, ip net.IP) Selection {
+	return r.SelectAvoiding(ctx, ip, nil)
+}
+
+// SelectAvoiding picks the endpoint for a client IP among those avoid rejects;
+// the selection is empty when every endpoint is avoided
+func (r *GeoRouter) SelectAvoiding(ctx context.Context, ip net.IP, avoid func(Endpoint) bool) Selection {
+	if len(r.endpoints) == 0 {
+		return Selection{Reason: ReasonRoundRobin}
+	}
+	usable := func(endpoint Endpoint) bool { return avoid == nil || !avoid(endpoint) }
+
+	var region string
+	if r.locator != nil && r.client != nil {
+		if found, ok := r.locator.Region(ip); ok {
+			region = found
+			rtts, err := r.regionRTTs(ctx, region)
+			if err != nil {
+				logrus.WithError(err).WithField("region", region).Warn("Failed to read regional RTT estimates")
+			}
+
+			best := -1
+			for i, endpoint := range r.endpoints {
+				rtt, ok := rtts[endpoint.Provider]
+				if ok && usable(endpoint) && (best < 0 || rtt < rtts[r.endpoints[best].Provider]) {
+					best = i
+				}
+			}
+			if best >= 0 {
+				endpoint := r.endpoints[best]
+				return Selection{Endpoint: endpoint, Region: region, RTT: rtts[endpoint.Provider], Reason: ReasonLowestRTT}
+			}
+		}
+	}
+
+	n := r.counter.Add(1) - 1
+	for i := range r.endpoints {
+		endpoint := r.endpoints[(n+uint64(i))%uint64(len(r.endpoints))]
+		if usable(endpoint) {
+			return Selection{Endpoint: endpoint, Region: region, Reason: ReasonRoundRobin}
+		}
+	}
+	return Selection{Region: region, Reason: ReasonRoundRobin}
+}
+
+// regionRTTs returns the known RTT of each provider from a region, cached briefly
+func (r *GeoRouter) regionRTTs(ctx context.Context, region string) (map[string]time.Duration, error) {
+	now := r.now()
+	r.mu.Lock()
+	snapshot, ok := r.cache[region]
+	r.mu.Unlock()
+	if ok && now.Sub(snapshot.fetched) < rttCacheTTL {
+		return snapshot.rtts, nil
+	}
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(r.endpoints))
+	for i, endpoint := range r.endpoints {
+		cmds[i] = pipe.HGet(ctx, RTTKey(region, endpoint.Provider), "rtt_ms")
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	rtts := make(map[string]time.Duration)
+	for i, cmd := range cmds {
+		ms, err := cmd.Float64()
+		if err != nil {
+			continue
+		}
+		rtts[r.endpoints[i].Provider] = time.Duration(ms * float64(time.Millisecond))
+	}
+
+	r.mu.Lock()
+	r.cache[region] = rttSnapshot{rtts: rtts, fetched: now}
+	r.mu.Unlock()
+	return rtts, nil
+}
+
+// StartProbes measures the RTT from this replica's region to every endpoint
+// each interval until ctx is cancelled
+func (r *GeoRouter) StartProbes(ctx context.Context, region string, interval time.Duration) {
+	r.ProbeOnce(ctx, region, interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.ProbeOnce(ctx, region, interval)
+		}
+	}
+}
+
+// ProbeOnce records one RTT sample per endpoint. Estimates expire after three
+// missed probes so a dead region falls back to round-robin.
+func (r *GeoRouter) ProbeOnce(ctx context.Context, region string, interval time.Duration) {
+	for _, endpoint := range r.endpoints {
+		rtt, err := r.probe(ctx, endpoint)
+		if err != nil {
+			logrus.WithError(err).WithField("provider", endpoint.Provider).Debug("RTT probe failed")
+			continue
+		}
+
+		key := RTTKey(region, endpoint.Provider)
+		pipe := r.client.TxPipeline()
+		pipe.HSet(ctx, key,
+			"rtt_ms", strconv.FormatFloat(float64(rtt)/float64(time.Millisecond), 'f', 3, 64),
+			"updated_at", r.now().Unix())
+		pipe.Expire(ctx, key, 3*interval)
+		if _, err := pipe.Exec(ctx); err != nil {
+			logrus.WithError(err).WithField("key", key).Warn("Failed to store RTT estimate")
+		}
+	}
+}
+
+// dialRTT times a TCP connect to the endpoint's host
+func dialRTT(ctx context.Context, endpoint Endpoint) (time.Duration, error) {
+	u, err := url.Parse(endpoint.URL)
+	if err != nil {
+		return 0, err
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	conn, err := httpclient.EgressDialContext("geo_probe", nil)(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	conn.Close()
+	return rtt, nil
+}
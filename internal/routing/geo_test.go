@@ -0,0 +1,124 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLocator maps exact IPs to regions
+type fakeLocator map[string]string
+
+func (l fakeLocator) Region(ip net.IP) (string, bool) {
+	region, ok := l[ip.String()]
+	return region, ok
+}
+
+var (
+	euClient = net.ParseIP("81.2.69.142")
+	naClient = net.ParseIP("8.8.8.8")
+	unknown  = net.ParseIP("10.0.0.1")
+
+	testEndpoints = []Endpoint{
+		{Provider: "openai-eu", URL: "https://eu.api.example.com"},
+		{Provider: "openai-us", URL: "https://us.api.example.com"},
+	}
+)
+
+func newTestGeoRouter(t *testing.T) (*GeoRouter, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	locator := fakeLocator{euClient.String(): "eu", naClient.String(): "na"}
+	return NewGeoRouter(client, locator, testEndpoints), mr
+}
+
+func TestGeoRouterPicksLowestRTTPerRegion(t *testing.T) {
+	router, mr := newTestGeoRouter(t)
+	mr.HSet(RTTKey("eu", "openai-eu"), "rtt_ms", "12.5")
+	mr.HSet(RTTKey("eu", "openai-us"), "rtt_ms", "95")
+	mr.HSet(RTTKey("na", "openai-eu"), "rtt_ms", "88")
+	mr.HSet(RTTKey("na", "openai-us"), "rtt_ms", "9")
+
+	for i := 0; i < 3; i++ {
+		eu := router.Select(context.Background(), euClient)
+		assert.Equal(t, "openai-eu", eu.Provider)
+		assert.Equal(t, "eu", eu.Region)
+		assert.Equal(t, ReasonLowestRTT, eu.Reason)
+		assert.Equal(t, 12500*time.Microsecond, eu.RTT)
+
+		na := router.Select(context.Background(), naClient)
+		assert.Equal(t, "openai-us", na.Provider)
+		assert.Equal(t, "https://us.api.example.com", na.URL)
+		assert.Equal(t, ReasonLowestRTT, na.Reason)
+	}
+}
+
+func TestGeoRouterFallsBackToRoundRobin(t *testing.T) {
+	router, mr := newTestGeoRouter(t)
+
+	// Unknown IPs and regions without RTT data alternate between endpoints
+	first := router.Select(context.Background(), unknown)
+	second := router.Select(context.Background(), euClient)
+	assert.Equal(t, ReasonRoundRobin, first.Reason)
+	assert.Equal(t, ReasonRoundRobin, second.Reason)
+	assert.Equal(t, "eu", second.Region)
+	assert.NotEqual(t, first.Provider, second.Provider)
+
+	// Without a locator every request round-robins
+	mr.HSet(RTTKey("eu", "openai-us"), "rtt_ms", "5")
+	noGeo := NewGeoRouter(router.client, nil, testEndpoints)
+	assert.Equal(t, "openai-eu", noGeo.Select(context.Background(), euClient).Provider)
+	assert.Equal(t, "openai-us", noGeo.Select(context.Background(), euClient).Provider)
+}
+
+func TestGeoRouterCachesRegionalRTTs(t *testing.T) {
+	router, mr := newTestGeoRouter(t)
+	now := time.Now()
+	router.now = func() time.Time { return now }
+
+	mr.HSet(RTTKey("eu", "openai-eu"), "rtt_ms", "10")
+	mr.HSet(RTTKey("eu", "openai-us"), "rtt_ms", "20")
+	assert.Equal(t, "openai-eu", router.Select(context.Background(), euClient).Provider)
+
+	mr.HSet(RTTKey("eu", "openai-eu"), "rtt_ms", "30")
+	assert.Equal(t, "openai-eu", router.Select(context.Background(), euClient).Provider)
+
+	now = now.Add(rttCacheTTL)
+	assert.Equal(t, "openai-us", router.Select(context.Background(), euClient).Provider)
+}
+
+func TestGeoRouterProbeStoresRTTEstimates(t *testing.T) {
+	router, mr := newTestGeoRouter(t)
+	router.probe = func(_ context.Context, endpoint Endpoint) (time.Duration, error) {
+		if endpoint.Provider == "openai-us" {
+			return 0, errors.New("unreachable")
+		}
+		return 42 * time.Millisecond, nil
+	}
+
+	router.ProbeOnce(context.Background(), "eu", time.Minute)
+
+	assert.Equal(t, "42.000", mr.HGet(RTTKey("eu", "openai-eu"), "rtt_ms"))
+	assert.Equal(t, 3*time.Minute, mr.TTL(RTTKey("eu", "openai-eu")))
+	assert.False(t, mr.Exists(RTTKey("eu", "openai-us")))
+
+	selection := router.Select(context.Background(), euClient)
+	assert.Equal(t, "openai-eu", selection.Provider)
+	assert.Equal(t, ReasonLowestRTT, selection.Reason)
+}
+
+func TestParseEndpoints(t *testing.T) {
+	require.Equal(t, []Endpoint{
+		{Provider: "openai-eu", URL: "https://eu.api.example.com"},
+		{Provider: "openai-us", URL: "https://us.api.example.com"},
+	}, ParseEndpoints([]string{"openai-eu=https://eu.api.example.com", " openai-us = https://us.api.example.com", "broken", "=https://x"}))
+}
@@ -0,0 +1,53 @@
+package security
+
+import (
+	"sync"
+	"time"
+)
+
+// AuditExporter ships audit events to storage outside the process, such as an
+// object storage bucket. Export is called on its own goroutine for every
+// event, so implementations must be safe for concurrent use and should not
+// block for long.
+type AuditExporter interface {
+	Export(event AuditEvent)
+}
+
+var (
+	defaultAuditExportersMu sync.RWMutex
+	defaultAuditExporters   []AuditExporter
+)
+
+// SetAuditExporters installs the exporters used by audit loggers created
+// without their own; nil stops exporting
+func SetAuditExporters(exporters ...AuditExporter) {
+	defaultAuditExportersMu.Lock()
+	defaultAuditExporters = exporters
+	defaultAuditExportersMu.Unlock()
+}
+
+// DefaultAuditExporters returns the installed audit exporters
+func DefaultAuditExporters() []AuditExporter {
+	defaultAuditExportersMu.RLock()
+	defer defaultAuditExportersMu.RUnlock()
+	return defaultAuditExporters
+}
+
+// export hands a copy of event to every exporter asynchronously
+func (al *AuditLogger) export(event *AuditEvent) {
+	exporters := al.exporters
+	if len(exporters) == 0 {
+		exporters = DefaultAuditExporters()
+	}
+	if len(exporters) == 0 {
+		return
+	}
+
+	exported := *event
+	if exported.Timestamp.IsZero() {
+		exported.Timestamp = time.Now()
+	}
+	for _, exporter := range exporters {
+		go exporter.Export(exported)
+	}
+}
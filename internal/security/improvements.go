@@ -7,6 +7,8 @@ import (
 	"strings"
 	"time"
 
+	"go-aigateway/internal/logging"
+
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
@@ -22,7 +24,7 @@ type SecurityImprovements struct {
 // NewSecurityImprovements creates enhanced security middleware
 func NewSecurityImprovements() *SecurityImprovements {
 	return &SecurityImprovements{
-		logger:          logrus.New(),
+		logger:          logging.Default(),
 		bannedIPs:       make(map[string]time.Time),
 		loginAttempts:   make(map[string]int),
 		rateLimitWindow: 15 * time.Minute,
@@ -0,0 +1,109 @@
+package security
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testKeyEventSecret = []byte("key-event-secret")
+
+func newKeyEventAuthenticator(t *testing.T) (*LocalAuthenticator, *KeyEventStream) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	auth := NewLocalAuthenticator(&config.SecurityConfig{
+		JWTSecret:    "secret",
+		APIKeyPrefix: "gw-",
+		MaxAPIKeys:   10,
+	})
+	stream := NewKeyEventStream(client, testKeyEventSecret, 1000)
+	auth.SetKeyEventStream(stream)
+	return auth, stream
+}
+
+func TestKeyLifecycleEventsAreStreamed(t *testing.T) {
+	ctx := context.Background()
+	auth, stream := newKeyEventAuthenticator(t)
+
+	apiKey, err := auth.GenerateAPIKey("api-user", "ci", []string{"ai:chat"}, 60)
+	require.NoError(t, err)
+	keyID, _, ok := auth.LookupAPIKey(apiKey)
+	require.True(t, ok)
+
+	rotated, err := auth.RotateAPIKey(apiKey)
+	require.NoError(t, err)
+	assert.NotEqual(t, apiKey, rotated)
+	_, _, err = auth.ValidateAPIKey(apiKey)
+	assert.Error(t, err, "the old key stops working")
+	rotatedID, _, ok := auth.LookupAPIKey(rotated)
+	require.True(t, ok)
+	assert.Equal(t, keyID, rotatedID, "rotation keeps the key ID")
+
+	require.NoError(t, auth.RevokeAPIKey(rotated))
+
+	events, err := stream.Read(ctx, "0", 50, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	for i, eventType := range []string{KeyEventCreated, KeyEventRotated, KeyEventRevoked} {
+		assert.Equal(t, eventType, events[i].Type)
+		assert.Equal(t, keyID, events[i].KeyID)
+		assert.Equal(t, "api-user", events[i].UserID)
+		assert.NotEmpty(t, events[i].ID)
+		assert.True(t, VerifyKeyEvent(testKeyEventSecret, events[i]), "event %d signature", i)
+	}
+	assert.Equal(t, "ci", events[0].Changes["name"])
+	assert.Contains(t, events[1].Changes, "key_hash_prefix")
+
+	// Paging continues after the last entry ID
+	rest, err := stream.Read(ctx, events[0].ID, 50, 0)
+	require.NoError(t, err)
+	assert.Len(t, rest, 2)
+}
+
+func TestKeyEventSignatureDetectsTampering(t *testing.T) {
+	auth, stream := newKeyEventAuthenticator(t)
+	_, err := auth.GenerateAPIKey("api-user", "ci", []string{"ai:chat"}, 60)
+	require.NoError(t, err)
+
+	events, err := stream.Read(context.Background(), "0", 1, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+
+	tampered := events[0]
+	tampered.UserID = "admin"
+	assert.False(t, VerifyKeyEvent(testKeyEventSecret, tampered))
+	assert.False(t, VerifyKeyEvent([]byte("other-secret"), events[0]))
+}
+
+func TestKeyEventReadBlocksForNewEvents(t *testing.T) {
+	auth, stream := newKeyEventAuthenticator(t)
+
+	done := make(chan []KeyEvent, 1)
+	go func() {
+		events, err := stream.Read(context.Background(), "$", 10, 2*time.Second)
+		assert.NoError(t, err)
+		done <- events
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	_, err := auth.GenerateAPIKey("admin", "ops", []string{"*"}, 0)
+	require.NoError(t, err)
+
+	select {
+	case events := <-done:
+		require.Len(t, events, 1)
+		assert.Equal(t, KeyEventCreated, events[0].Type)
+		assert.Equal(t, "admin", events[0].UserID)
+	case <-time.After(3 * time.Second):
+		t.Fatal("blocking read did not return the new event")
+	}
+}
@@ -5,40 +5,119 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"go-aigateway/internal/config"
+	gwredis "go-aigateway/internal/redis"
+	"go-aigateway/internal/storage"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // LocalAuthenticator provides local authentication without external dependencies
 type LocalAuthenticator struct {
-	config    *config.SecurityConfig
-	apiKeys   map[string]*APIKeyInfo
-	sessions  map[string]*SessionInfo
-	users     map[string]*UserInfo
-	mutex     sync.RWMutex
-	jwtSecret []byte
+	config   *config.SecurityConfig
+	apiKeys  map[string]*APIKeyInfo
+	sessions map[string]*SessionInfo
+	users    map[string]*UserInfo
+	mutex    sync.RWMutex
+	secrets  *SecretRotator
+	store    storage.Store   // optional persistent store for keys and users
+	events   *KeyEventStream // optional feed of key lifecycle events
+
+	// usageDirty holds hashes of keys whose LastUsed or TokensUsed changed since
+	// the last SyncUsage; usage is written to the store in batches, not per request
+	usageDirty map[string]bool
+
+	refreshTokens map[string]*RefreshTokenInfo // by token hash
+	now           func() time.Time
 }
 
 // APIKeyInfo represents an API key
 type APIKeyInfo struct {
-	ID          string            `json:"id"`
-	KeyHash     string            `json:"key_hash"`
-	Name        string            `json:"name"`
-	UserID      string            `json:"user_id"`
-	Permissions []string          `json:"permissions"`
-	RateLimit   int               `json:"rate_limit"`
-	CreatedAt   time.Time         `json:"created_at"`
-	ExpiresAt   *time.Time        `json:"expires_at,omitempty"`
-	LastUsed    *time.Time        `json:"last_used,omitempty"`
-	Metadata    map[string]string `json:"metadata,omitempty"`
+	ID            string            `json:"id"`
+	KeyHash       string            `json:"key_hash"`
+	Name          string            `json:"name"`
+	UserID        string            `json:"user_id"`
+	Permissions   []string          `json:"permissions"`
+	RateLimit     int               `json:"rate_limit"`
+	Sandbox       bool              `json:"sandbox,omitempty"`        // served by the response simulator, never a real upstream
+	AllowedModels []string          `json:"allowed_models,omitempty"` // models the key may call, empty allows any
+	CreatedAt     time.Time         `json:"created_at"`
+	ExpiresAt     *time.Time        `json:"expires_at,omitempty"`
+	LastUsed      *time.Time        `json:"last_used,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	// MetricDimensions label the key's request metrics for BI, e.g. {"product": "chatbot"}
+	MetricDimensions map[string]string `json:"metric_dimensions,omitempty"`
+	// AllowedMethods are the API methods the key may call, e.g. "chat.completions"; empty allows any
+	AllowedMethods []string `json:"allowed_methods,omitempty"`
+	// TokenBudget is the total tokens the key may spend, 0 is unlimited
+	TokenBudget int64 `json:"token_budget,omitempty"`
+	TokensUsed  int64 `json:"tokens_used,omitempty"`
+	// Priority is the request queue tier of the key: high, normal or low; empty defers to its owner's tier
+	Priority string `json:"priority,omitempty"`
+}
+
+// Feature permissions a key holds in addition to its endpoint permissions such as "ai:chat"
+const (
+	PermissionStreaming       = "ai:stream"
+	PermissionVision          = "ai:vision"
+	PermissionFunctionCalling = "ai:tools"
+)
+
+// HasPermission reports whether the key holds permission, directly or through "*"
+func (k *APIKeyInfo) HasPermission(permission string) bool {
+	for _, perm := range k.Permissions {
+		if perm == permission || perm == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenBudgetRemaining returns the tokens left in the key's budget, or -1 when it has none
+func (k *APIKeyInfo) TokenBudgetRemaining() int64 {
+	if k.TokenBudget <= 0 {
+		return -1
+	}
+	return max(k.TokenBudget-k.TokensUsed, 0)
+}
+
+// MaxMetricDimensions is the number of metric dimensions one API key may carry
+const MaxMetricDimensions = 5
+
+var metricDimensionPattern = regexp.MustCompile(`^[a-z_]+$`)
+
+// reservedMetricDimensions are the labels every dimension metric already has
+var reservedMetricDimensions = map[string]bool{"endpoint": true, "status": true}
+
+// ValidateMetricDimensions checks that dimensions can be used as Prometheus labels
+func ValidateMetricDimensions(dimensions map[string]string) error {
+	if len(dimensions) > MaxMetricDimensions {
+		return fmt.Errorf("at most %d metric dimensions are allowed", MaxMetricDimensions)
+	}
+	for name, value := range dimensions {
+		if !metricDimensionPattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid metric dimension %q: names must match [a-z_]+ and not start with __", name)
+		}
+		if reservedMetricDimensions[name] {
+			return fmt.Errorf("metric dimension %q is reserved", name)
+		}
+		if value == "" {
+			return fmt.Errorf("metric dimension %q needs a value", name)
+		}
+	}
+	return nil
 }
 
 // UserInfo represents a user
@@ -86,11 +165,15 @@ func NewLocalAuthenticator(cfg *config.SecurityConfig) *LocalAuthenticator {
 	}
 
 	auth := &LocalAuthenticator{
-		config:    cfg,
-		apiKeys:   make(map[string]*APIKeyInfo),
-		sessions:  make(map[string]*SessionInfo),
-		users:     make(map[string]*UserInfo),
-		jwtSecret: jwtSecret,
+		config:     cfg,
+		apiKeys:    make(map[string]*APIKeyInfo),
+		sessions:   make(map[string]*SessionInfo),
+		users:      make(map[string]*UserInfo),
+		secrets:    NewSecretRotator(jwtSecret, cfg.JWTRotationInterval, cfg.JWTRotationKeepCount),
+		usageDirty: make(map[string]bool),
+
+		refreshTokens: make(map[string]*RefreshTokenInfo),
+		now:           time.Now,
 	}
 
 	// Initialize with default admin user if none exists
@@ -99,6 +182,11 @@ func NewLocalAuthenticator(cfg *config.SecurityConfig) *LocalAuthenticator {
 	return auth
 }
 
+// Secrets returns the rotator holding the JWT signing secrets
+func (la *LocalAuthenticator) Secrets() *SecretRotator {
+	return la.secrets
+}
+
 // initializeDefaultUsers creates default users if none exist
 func (la *LocalAuthenticator) initializeDefaultUsers() {
 	// Create default admin user
@@ -125,6 +213,9 @@ func (la *LocalAuthenticator) initializeDefaultUsers() {
 		Metadata:    map[string]string{"type": "api"},
 	}
 
+	adminUser.Password = defaultUserPasswordHash(adminUser.Username)
+	apiUser.Password = defaultUserPasswordHash(apiUser.Username)
+
 	la.users[adminUser.ID] = adminUser
 	la.users[apiUser.ID] = apiUser
 
@@ -132,6 +223,31 @@ func (la *LocalAuthenticator) initializeDefaultUsers() {
 	la.createDefaultAPIKeys()
 }
 
+// defaultUserPasswordHash returns the bcrypt hash a default user logs in with:
+// USER_<NAME>_PASSWORD_HASH, or USER_<NAME>_PASSWORD hashed at startup. Users
+// without either cannot log in with a password.
+func defaultUserPasswordHash(username string) string {
+	prefix := "USER_" + strings.ToUpper(strings.ReplaceAll(username, "-", "_"))
+	if hash := os.Getenv(prefix + "_PASSWORD_HASH"); hash != "" {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			logrus.WithError(err).Errorf("%s_PASSWORD_HASH is not a bcrypt hash, password login disabled for %s", prefix, username)
+			return ""
+		}
+		return hash
+	}
+	password := os.Getenv(prefix + "_PASSWORD")
+	if password == "" {
+		return ""
+	}
+	hash, err := NewPasswordHasher().HashPassword(password)
+	if err != nil {
+		logrus.WithError(err).Errorf("Failed to hash %s_PASSWORD, password login disabled for %s", prefix, username)
+		return ""
+	}
+	logrus.Warnf("%s_PASSWORD is set in plain text, prefer %s_PASSWORD_HASH", prefix, prefix)
+	return hash
+}
+
 // createDefaultAPIKeys creates default API keys for initial setup
 func (la *LocalAuthenticator) createDefaultAPIKeys() {
 	// Default admin API key
@@ -174,15 +290,11 @@ func (la *LocalAuthenticator) GenerateAPIKey(userID, name string, permissions []
 		return "", fmt.Errorf("maximum API keys reached for user: %s", userID)
 	}
 
-	// Generate random API key
-	keyBytes := make([]byte, 32)
-	if _, err := rand.Read(keyBytes); err != nil {
-		return "", fmt.Errorf("failed to generate random key: %w", err)
+	apiKey, keyHash, err := la.newKeyMaterial()
+	if err != nil {
+		return "", err
 	}
 
-	apiKey := la.config.APIKeyPrefix + hex.EncodeToString(keyBytes)
-	keyHash := la.hashAPIKey(apiKey)
-
 	// Create API key info
 	keyInfo := &APIKeyInfo{
 		ID:          generateID(),
@@ -199,6 +311,12 @@ func (la *LocalAuthenticator) GenerateAPIKey(userID, name string, permissions []
 	}
 
 	la.apiKeys[keyHash] = keyInfo
+	la.persistAPIKey(keyInfo)
+	la.publishKeyEvent(KeyEventCreated, keyInfo, map[string]interface{}{
+		"name":        name,
+		"permissions": permissions,
+		"rate_limit":  rateLimit,
+	})
 
 	logrus.WithFields(logrus.Fields{
 		"user_id":     userID,
@@ -209,12 +327,16 @@ func (la *LocalAuthenticator) GenerateAPIKey(userID, name string, permissions []
 	return apiKey, nil
 }
 
-// ValidateAPIKey validates an API key and returns user information
+// ValidateAPIKey validates an API key and returns user information. Keys
+// missing from memory are looked up in the store, so keys issued by another
+// instance are accepted.
 func (la *LocalAuthenticator) ValidateAPIKey(apiKey string) (*UserInfo, *APIKeyInfo, error) {
+	keyHash := la.hashAPIKey(apiKey)
+	la.loadPersistedAPIKey(keyHash)
+
 	la.mutex.RLock()
 	defer la.mutex.RUnlock()
 
-	keyHash := la.hashAPIKey(apiKey)
 	keyInfo, exists := la.apiKeys[keyHash]
 	if !exists {
 		return nil, nil, fmt.Errorf("invalid API key")
@@ -236,21 +358,266 @@ func (la *LocalAuthenticator) ValidateAPIKey(apiKey string) (*UserInfo, *APIKeyI
 		return nil, nil, fmt.Errorf("user account is disabled")
 	}
 
-	// Update last used timestamp (do this in a separate goroutine to avoid blocking)
+	// Update last used timestamp (do this in a separate goroutine to avoid blocking);
+	// it reaches the store with the next usage sync
 	go func() {
 		la.mutex.Lock()
 		now := time.Now()
 		keyInfo.LastUsed = &now
+		la.usageDirty[keyHash] = true
 		la.mutex.Unlock()
 	}()
 
 	return user, keyInfo, nil
 }
 
+// LookupAPIKey returns the key ID and owning user of an API key without updating usage
+func (la *LocalAuthenticator) LookupAPIKey(apiKey string) (keyID, userID string, ok bool) {
+	keyHash := la.hashAPIKey(apiKey)
+	la.loadPersistedAPIKey(keyHash)
+
+	la.mutex.RLock()
+	defer la.mutex.RUnlock()
+
+	keyInfo, exists := la.apiKeys[keyHash]
+	if !exists {
+		return "", "", false
+	}
+	return keyInfo.ID, keyInfo.UserID, true
+}
+
+// DescribeAPIKey returns a snapshot of a valid API key without updating its usage
+func (la *LocalAuthenticator) DescribeAPIKey(apiKey string) (APIKeyInfo, error) {
+	keyHash := la.hashAPIKey(apiKey)
+	la.loadPersistedAPIKey(keyHash)
+
+	la.mutex.RLock()
+	defer la.mutex.RUnlock()
+
+	keyInfo, exists := la.apiKeys[keyHash]
+	if !exists {
+		return APIKeyInfo{}, fmt.Errorf("invalid API key")
+	}
+	if keyInfo.ExpiresAt != nil && time.Now().After(*keyInfo.ExpiresAt) {
+		return APIKeyInfo{}, fmt.Errorf("API key expired")
+	}
+	if user, exists := la.users[keyInfo.UserID]; !exists || !user.Active {
+		return APIKeyInfo{}, fmt.Errorf("user account is disabled")
+	}
+
+	snapshot := *keyInfo
+	snapshot.Permissions = append([]string(nil), keyInfo.Permissions...)
+	snapshot.AllowedModels = append([]string(nil), keyInfo.AllowedModels...)
+	snapshot.AllowedMethods = append([]string(nil), keyInfo.AllowedMethods...)
+	return snapshot, nil
+}
+
+// IsSandboxKey reports whether an API key is a valid key flagged sandbox
+func (la *LocalAuthenticator) IsSandboxKey(apiKey string) bool {
+	la.mutex.RLock()
+	defer la.mutex.RUnlock()
+
+	keyInfo, exists := la.apiKeys[la.hashAPIKey(apiKey)]
+	if !exists || !keyInfo.Sandbox {
+		return false
+	}
+	return keyInfo.ExpiresAt == nil || time.Now().Before(*keyInfo.ExpiresAt)
+}
+
+// SetSandbox flags or unflags an API key as a sandbox key
+func (la *LocalAuthenticator) SetSandbox(apiKey string, sandbox bool) error {
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	keyInfo, exists := la.apiKeys[la.hashAPIKey(apiKey)]
+	if !exists {
+		return fmt.Errorf("invalid API key")
+	}
+	keyInfo.Sandbox = sandbox
+	la.persistAPIKey(keyInfo)
+	la.publishKeyEvent(KeyEventUpdated, keyInfo, map[string]interface{}{"sandbox": sandbox})
+	return nil
+}
+
+// AllowedModels returns the models an API key is restricted to, nil when it may call any model
+func (la *LocalAuthenticator) AllowedModels(apiKey string) []string {
+	la.mutex.RLock()
+	defer la.mutex.RUnlock()
+
+	keyInfo, exists := la.apiKeys[la.hashAPIKey(apiKey)]
+	if !exists || len(keyInfo.AllowedModels) == 0 {
+		return nil
+	}
+	return append([]string(nil), keyInfo.AllowedModels...)
+}
+
+// SetAllowedModels restricts an API key to the given models; an empty list lifts the restriction
+func (la *LocalAuthenticator) SetAllowedModels(apiKey string, models []string) error {
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	keyInfo, exists := la.apiKeys[la.hashAPIKey(apiKey)]
+	if !exists {
+		return fmt.Errorf("invalid API key")
+	}
+	keyInfo.AllowedModels = append([]string(nil), models...)
+	la.persistAPIKey(keyInfo)
+	la.publishKeyEvent(KeyEventUpdated, keyInfo, map[string]interface{}{"allowed_models": keyInfo.AllowedModels})
+	return nil
+}
+
+// SetAllowedMethods restricts an API key to the given API methods; an empty list lifts the restriction
+func (la *LocalAuthenticator) SetAllowedMethods(apiKey string, methods []string) error {
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	keyInfo, exists := la.apiKeys[la.hashAPIKey(apiKey)]
+	if !exists {
+		return fmt.Errorf("invalid API key")
+	}
+	keyInfo.AllowedMethods = append([]string(nil), methods...)
+	la.persistAPIKey(keyInfo)
+	la.publishKeyEvent(KeyEventUpdated, keyInfo, map[string]interface{}{"allowed_methods": keyInfo.AllowedMethods})
+	return nil
+}
+
+// SetPriority sets the request queue tier of an API key; "" removes it
+func (la *LocalAuthenticator) SetPriority(apiKey, priority string) error {
+	switch priority {
+	case "", "high", "normal", "low":
+	default:
+		return fmt.Errorf("priority must be high, normal or low")
+	}
+
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	keyInfo, exists := la.apiKeys[la.hashAPIKey(apiKey)]
+	if !exists {
+		return fmt.Errorf("invalid API key")
+	}
+	keyInfo.Priority = priority
+	la.persistAPIKey(keyInfo)
+	la.publishKeyEvent(KeyEventUpdated, keyInfo, map[string]interface{}{"priority": priority})
+	return nil
+}
+
+// SetTokenBudget sets the total tokens an API key may spend; 0 removes the budget
+func (la *LocalAuthenticator) SetTokenBudget(apiKey string, budget int64) error {
+	if budget < 0 {
+		return fmt.Errorf("token budget cannot be negative")
+	}
+
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	keyInfo, exists := la.apiKeys[la.hashAPIKey(apiKey)]
+	if !exists {
+		return fmt.Errorf("invalid API key")
+	}
+	keyInfo.TokenBudget = budget
+	la.persistAPIKey(keyInfo)
+	la.publishKeyEvent(KeyEventUpdated, keyInfo, map[string]interface{}{"token_budget": budget})
+	return nil
+}
+
+// Errors returned by CheckKeyUsage
+var (
+	ErrMethodNotAllowed     = errors.New("API method not allowed for this key")
+	ErrTokenBudgetExhausted = errors.New("API key token budget exhausted")
+)
+
+// CheckKeyUsage reports whether apiKey may call the API method, e.g.
+// "chat.completions": ErrMethodNotAllowed when the key's AllowedMethods do not
+// list it, ErrTokenBudgetExhausted once the key has spent its TokenBudget.
+// Keys that are not managed here are not restricted.
+func (la *LocalAuthenticator) CheckKeyUsage(apiKey, method string) error {
+	la.mutex.RLock()
+	defer la.mutex.RUnlock()
+
+	keyInfo, exists := la.apiKeys[la.hashAPIKey(apiKey)]
+	if !exists {
+		return nil
+	}
+	if len(keyInfo.AllowedMethods) > 0 && !slices.Contains(keyInfo.AllowedMethods, method) {
+		return ErrMethodNotAllowed
+	}
+	if keyInfo.TokenBudgetRemaining() == 0 {
+		return ErrTokenBudgetExhausted
+	}
+	return nil
+}
+
+// ChargeTokens adds tokens spent by an API key to its usage; unknown keys are ignored
+func (la *LocalAuthenticator) ChargeTokens(apiKey string, tokens int64) {
+	if tokens <= 0 {
+		return
+	}
+
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	keyInfo, exists := la.apiKeys[la.hashAPIKey(apiKey)]
+	if !exists {
+		return
+	}
+	keyInfo.TokensUsed += tokens
+	if keyInfo.TokenBudget > 0 {
+		// Spent budget is written at once so a restart cannot refill it;
+		// CheckKeyUsage enforces it on this instance's count
+		la.persistAPIKey(keyInfo)
+		return
+	}
+	la.usageDirty[keyInfo.KeyHash] = true
+}
+
+// MetricDimensions returns the metric dimensions of a valid API key, nil when it has none
+func (la *LocalAuthenticator) MetricDimensions(apiKey string) map[string]string {
+	la.mutex.RLock()
+	defer la.mutex.RUnlock()
+
+	keyInfo, exists := la.apiKeys[la.hashAPIKey(apiKey)]
+	if !exists || len(keyInfo.MetricDimensions) == 0 {
+		return nil
+	}
+	if keyInfo.ExpiresAt != nil && time.Now().After(*keyInfo.ExpiresAt) {
+		return nil
+	}
+	return keyInfo.MetricDimensions
+}
+
+// SetMetricDimensions replaces the metric dimensions of an API key; an empty map removes them
+func (la *LocalAuthenticator) SetMetricDimensions(apiKey string, dimensions map[string]string) error {
+	if err := ValidateMetricDimensions(dimensions); err != nil {
+		return err
+	}
+
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	keyInfo, exists := la.apiKeys[la.hashAPIKey(apiKey)]
+	if !exists {
+		return fmt.Errorf("invalid API key")
+	}
+	// Replaced rather than mutated, so maps handed out by MetricDimensions stay unchanged
+	var copied map[string]string
+	if len(dimensions) > 0 {
+		copied = make(map[string]string, len(dimensions))
+		for name, value := range dimensions {
+			copied[name] = value
+		}
+	}
+	keyInfo.MetricDimensions = copied
+	la.persistAPIKey(keyInfo)
+	la.publishKeyEvent(KeyEventUpdated, keyInfo, map[string]interface{}{"metric_dimensions": copied})
+	return nil
+}
+
 // GenerateJWT generates a JWT token for a user
 func (la *LocalAuthenticator) GenerateJWT(userID string) (string, error) {
 	la.mutex.RLock()
 	user, exists := la.users[userID]
+	expiration := la.config.TokenExpiration
 	la.mutex.RUnlock()
 
 	if !exists {
@@ -264,7 +631,7 @@ func (la *LocalAuthenticator) GenerateJWT(userID string) (string, error) {
 		Roles:       user.Roles,
 		Permissions: user.Permissions,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(la.config.TokenExpiration)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "ai-gateway",
@@ -272,9 +639,11 @@ func (la *LocalAuthenticator) GenerateJWT(userID string) (string, error) {
 		},
 	}
 
-	// Create token
+	// Create token, always signed with the newest secret
+	kid, secret := la.secrets.Current()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(la.jwtSecret)
+	token.Header["kid"] = kid
+	tokenString, err := token.SignedString(secret)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign JWT: %w", err)
 	}
@@ -282,13 +651,24 @@ func (la *LocalAuthenticator) GenerateJWT(userID string) (string, error) {
 	return tokenString, nil
 }
 
-// ValidateJWT validates a JWT token and returns claims
+// ValidateJWT validates a JWT token and returns claims. Every secret still in the
+// rotation window is tried, starting with the one named by the token's kid.
 func (la *LocalAuthenticator) ValidateJWT(tokenString string) (*Claims, error) {
+	secrets := la.secrets.Secrets()
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return la.jwtSecret, nil
+		if kid, _ := token.Header["kid"].(string); kid != "" {
+			if secret, ok := secrets[kid]; ok {
+				return secret, nil
+			}
+		}
+		keys := jwt.VerificationKeySet{}
+		for _, secret := range secrets {
+			keys.Keys = append(keys.Keys, secret)
+		}
+		return keys, nil
 	})
 
 	if err != nil {
@@ -331,22 +711,217 @@ func (la *LocalAuthenticator) CheckPermission(userID, resource, action string) b
 	return false
 }
 
+// PermissionAdminKeys lets a user create, list, rotate and revoke API keys of any user
+const PermissionAdminKeys = "admin:keys"
+
+// ErrAPIKeyNotFound is returned for API keys that do not exist or were revoked
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
 // RevokeAPIKey revokes an API key
 func (la *LocalAuthenticator) RevokeAPIKey(apiKey string) error {
 	la.mutex.Lock()
 	defer la.mutex.Unlock()
+	return la.revokeAPIKeyLocked(la.hashAPIKey(apiKey))
+}
 
-	keyHash := la.hashAPIKey(apiKey)
-	if _, exists := la.apiKeys[keyHash]; !exists {
-		return fmt.Errorf("API key not found")
+// RevokeAPIKeyByID revokes the API key with the given ID
+func (la *LocalAuthenticator) RevokeAPIKeyByID(id string) error {
+	keyHash, ok := la.apiKeyHashByID(id)
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+	return la.revokeAPIKeyLocked(keyHash)
+}
+
+// revokeAPIKeyLocked revokes the key stored under keyHash; callers hold la.mutex
+func (la *LocalAuthenticator) revokeAPIKeyLocked(keyHash string) error {
+	keyInfo, exists := la.apiKeys[keyHash]
+	if !exists {
+		return ErrAPIKeyNotFound
 	}
 
 	delete(la.apiKeys, keyHash)
+	la.deletePersistedAPIKey(keyHash)
+	la.publishKeyEvent(KeyEventRevoked, keyInfo, nil)
 	logrus.WithField("key_hash", keyHash[:10]+"...").Info("Revoked API key")
 
 	return nil
 }
 
+// RotateAPIKey replaces the secret of an API key, keeping its ID, owner and
+// permissions. The old key stops working immediately.
+func (la *LocalAuthenticator) RotateAPIKey(apiKey string) (string, error) {
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+	return la.rotateAPIKeyLocked(la.hashAPIKey(apiKey))
+}
+
+// RotateAPIKeyByID rotates the API key with the given ID like RotateAPIKey
+func (la *LocalAuthenticator) RotateAPIKeyByID(id string) (string, error) {
+	keyHash, ok := la.apiKeyHashByID(id)
+	if !ok {
+		return "", ErrAPIKeyNotFound
+	}
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+	return la.rotateAPIKeyLocked(keyHash)
+}
+
+// rotateAPIKeyLocked rotates the key stored under oldHash; callers hold la.mutex
+func (la *LocalAuthenticator) rotateAPIKeyLocked(oldHash string) (string, error) {
+	keyInfo, exists := la.apiKeys[oldHash]
+	if !exists {
+		return "", ErrAPIKeyNotFound
+	}
+
+	newKey, newHash, err := la.newKeyMaterial()
+	if err != nil {
+		return "", err
+	}
+
+	rotated := *keyInfo
+	rotated.KeyHash = newHash
+	rotated.LastUsed = nil
+	delete(la.apiKeys, oldHash)
+	la.deletePersistedAPIKey(oldHash)
+	la.apiKeys[newHash] = &rotated
+	la.persistAPIKey(&rotated)
+	la.publishKeyEvent(KeyEventRotated, &rotated, map[string]interface{}{
+		"previous_key_hash_prefix": oldHash[:10],
+		"key_hash_prefix":          newHash[:10],
+	})
+	logrus.WithField("key_id", rotated.ID).Info("Rotated API key")
+
+	return newKey, nil
+}
+
+// APIKeyUpdate lists the changes UpdateAPIKeyByID makes; nil fields are left as they are
+type APIKeyUpdate struct {
+	Name        *string
+	Permissions []string
+	RateLimit   *int
+}
+
+// UpdateAPIKeyByID changes the name, permissions or rate limit of the API key
+// with the given ID and returns the updated key with its hash masked
+func (la *LocalAuthenticator) UpdateAPIKeyByID(id string, update APIKeyUpdate) (*APIKeyInfo, error) {
+	if update.RateLimit != nil && *update.RateLimit < 0 {
+		return nil, fmt.Errorf("rate limit cannot be negative")
+	}
+	keyHash, ok := la.apiKeyHashByID(id)
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	keyInfo, exists := la.apiKeys[keyHash]
+	if !exists {
+		return nil, ErrAPIKeyNotFound
+	}
+	changes := make(map[string]interface{})
+	if update.Name != nil {
+		keyInfo.Name = *update.Name
+		changes["name"] = keyInfo.Name
+	}
+	if update.Permissions != nil {
+		keyInfo.Permissions = append([]string(nil), update.Permissions...)
+		changes["permissions"] = keyInfo.Permissions
+	}
+	if update.RateLimit != nil {
+		keyInfo.RateLimit = *update.RateLimit
+		changes["rate_limit"] = keyInfo.RateLimit
+	}
+	if len(changes) > 0 {
+		la.persistAPIKey(keyInfo)
+		la.publishKeyEvent(KeyEventUpdated, keyInfo, changes)
+	}
+
+	keyCopy := *keyInfo
+	keyCopy.KeyHash = keyCopy.KeyHash[:10] + "..."
+	return &keyCopy, nil
+}
+
+// apiKeyHashByID finds the hash of the key with the given ID, loading keys
+// issued by other instances from the store when it is not in memory
+func (la *LocalAuthenticator) apiKeyHashByID(id string) (string, bool) {
+	la.mutex.RLock()
+	for keyHash, info := range la.apiKeys {
+		if info.ID == id {
+			la.mutex.RUnlock()
+			return keyHash, true
+		}
+	}
+	store := la.store
+	la.mutex.RUnlock()
+	if store == nil || id == "" {
+		return "", false
+	}
+
+	records, err := store.List(context.Background(), storage.BucketAPIKeys)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to list persisted API keys")
+		return "", false
+	}
+	for keyHash, data := range records {
+		var info APIKeyInfo
+		if json.Unmarshal(data, &info) == nil && info.ID == id {
+			la.loadPersistedAPIKey(keyHash)
+			return keyHash, true
+		}
+	}
+	return "", false
+}
+
+// SetKeyEventStream publishes every later key lifecycle change to stream
+func (la *LocalAuthenticator) SetKeyEventStream(stream *KeyEventStream) {
+	la.mutex.Lock()
+	la.events = stream
+	la.mutex.Unlock()
+}
+
+// publishKeyEvent records a lifecycle change; callers hold la.mutex so events
+// are published in the order the changes were made
+func (la *LocalAuthenticator) publishKeyEvent(eventType string, info *APIKeyInfo, changes map[string]interface{}) {
+	if la.events == nil {
+		return
+	}
+	_, err := la.events.Publish(context.Background(), KeyEvent{
+		Type:    eventType,
+		KeyID:   info.ID,
+		UserID:  info.UserID,
+		Changes: changes,
+	})
+	if err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"key_id":     info.ID,
+			"event_type": eventType,
+		}).Error("Failed to publish API key event")
+	}
+}
+
+// UpdateConfig applies reloaded security settings. Token expiration, the API
+// key limit and the key prefix take effect for new tokens and keys; JWT
+// secrets are managed by the SecretRotator and need a restart to change.
+func (la *LocalAuthenticator) UpdateConfig(cfg *config.Config) {
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+	la.config = &cfg.Security
+}
+
+// newKeyMaterial generates a random API key and its hash
+func (la *LocalAuthenticator) newKeyMaterial() (apiKey, keyHash string, err error) {
+	keyBytes := make([]byte, 32)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return "", "", fmt.Errorf("failed to generate random key: %w", err)
+	}
+	apiKey = la.config.APIKeyPrefix + hex.EncodeToString(keyBytes)
+	return apiKey, la.hashAPIKey(apiKey), nil
+}
+
 // ListAPIKeys returns all API keys for a user
 func (la *LocalAuthenticator) ListAPIKeys(userID string) []*APIKeyInfo {
 	la.mutex.RLock()
@@ -371,6 +946,13 @@ func (la *LocalAuthenticator) hashAPIKey(apiKey string) string {
 	return hex.EncodeToString(hash[:])
 }
 
+// dummyPasswordHash is compared against when a login names no user with a
+// password; it is generated on first use, with the cost of PasswordHasher
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := NewPasswordHasher().HashPassword(generateID())
+	return []byte(hash)
+})
+
 // generateID generates a random ID
 func generateID() string {
 	bytes := make([]byte, 16)
@@ -406,55 +988,110 @@ func (la *LocalAuthenticator) StartCleanupTask(ctx context.Context) {
 	}
 }
 
-// AuthenticateUser authenticates a user with username and password
+// AuthenticateUser authenticates a user with username and password against
+// the bcrypt hash stored on the user
 func (la *LocalAuthenticator) AuthenticateUser(username, password string) (*UserInfo, error) {
 	la.mutex.RLock()
-	defer la.mutex.RUnlock()
-
-	// Find user by username
 	var user *UserInfo
 	for _, u := range la.users {
-		if u.Username == username && u.Active {
+		// Identity providers choose external usernames, so one may equal a
+		// local user's; only local users log in with a password
+		if u.Username == username && u.Active && !isExternalUser(u) {
 			user = u
 			break
 		}
 	}
+	var hash string
+	if user != nil {
+		hash = user.Password
+	}
+	la.mutex.RUnlock()
 
-	if user == nil {
+	if hash == "" {
+		// Compare anyway so unknown users take as long as wrong passwords
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		if user != nil {
+			logrus.WithField("username", username).Warn("No password hash configured for user")
+		}
 		return nil, fmt.Errorf("invalid credentials")
 	}
+	if !NewPasswordHasher().VerifyPassword(password, hash) {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+	return user, nil
+}
 
-	// Use secure password verification
-	hasher := NewPasswordHasher()
+// externalUserType marks users provisioned by an external identity provider in their metadata
+const externalUserType = "external"
 
-	// If no password hash is stored, check environment variable for development
-	if user.Password == "" {
-		expectedPassword := os.Getenv(fmt.Sprintf("USER_%s_PASSWORD", strings.ToUpper(username)))
-		if expectedPassword == "" {
-			logrus.Warn("No password configured for user: " + username)
-			return nil, fmt.Errorf("invalid credentials")
-		}
-		// For environment variables, do simple comparison (should be temporary)
-		if expectedPassword != password {
-			return nil, fmt.Errorf("invalid credentials")
-		}
-	} else {
-		// Use stored hashed password
-		if !hasher.VerifyPassword(user.Password, password) {
-			return nil, fmt.Errorf("invalid credentials")
+// isExternalUser reports whether an external identity provider provisioned u
+func isExternalUser(u *UserInfo) bool {
+	return u.Metadata["type"] == externalUserType
+}
+
+// UpsertExternalUser provisions or refreshes a user authenticated by an external
+// identity provider. Roles and permissions are only set on first login so that
+// grants made by an administrator afterwards are preserved.
+func (la *LocalAuthenticator) UpsertExternalUser(userID, username, email string, permissions []string) (*UserInfo, error) {
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	now := time.Now()
+	user, exists := la.users[userID]
+	if !exists {
+		user = &UserInfo{
+			ID:          userID,
+			Username:    username,
+			Email:       email,
+			Roles:       []string{"user"},
+			Permissions: append([]string(nil), permissions...),
+			Active:      true,
+			CreatedAt:   now,
+			Metadata:    map[string]string{"type": externalUserType},
 		}
+		la.users[userID] = user
+	} else if !user.Active {
+		return nil, fmt.Errorf("user is disabled: %s", userID)
+	} else if email != "" {
+		user.Email = email
 	}
 
+	user.LastLogin = &now
+	la.persistUser(user)
 	return user, nil
 }
 
-// CreateAPIKey creates a new API key for a user with enhanced options
-func (la *LocalAuthenticator) CreateAPIKey(userID, name string, permissions map[string]bool, rateLimit int, expiresAt *int64) (string, error) {
+// CreateSession records a new login session for a user
+func (la *LocalAuthenticator) CreateSession(userID, ipAddress, userAgent string) (*SessionInfo, error) {
 	la.mutex.Lock()
 	defer la.mutex.Unlock()
 
-	// Check if user exists
+	if _, exists := la.users[userID]; !exists {
+		return nil, fmt.Errorf("user not found: %s", userID)
+	}
+
+	now := time.Now()
+	session := &SessionInfo{
+		ID:        generateID(),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(la.config.TokenExpiration),
+		LastSeen:  now,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+	}
+	la.sessions[session.ID] = session
+	return session, nil
+}
+
+// CreateAPIKey creates a new API key for a user with enhanced options
+func (la *LocalAuthenticator) CreateAPIKey(userID, name string, permissions map[string]bool, rateLimit int, expiresAt *int64) (string, error) {
+	// GenerateAPIKey takes the write lock itself, so only hold a read lock here
+	la.mutex.RLock()
 	_, exists := la.users[userID]
+	la.mutex.RUnlock()
+
+	// Check if user exists
 	if !exists {
 		return "", fmt.Errorf("user not found: %s", userID)
 	}
@@ -472,6 +1109,226 @@ func (la *LocalAuthenticator) CreateAPIKey(userID, name string, permissions map[
 	if err != nil {
 		return "", err
 	}
+	if expiresAt != nil {
+		la.setAPIKeyExpiry(apiKey, time.Unix(*expiresAt, 0))
+	}
 
 	return apiKey, nil
 }
+
+// setAPIKeyExpiry makes apiKey stop working at expiresAt
+func (la *LocalAuthenticator) setAPIKeyExpiry(apiKey string, expiresAt time.Time) {
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+	if keyInfo, exists := la.apiKeys[la.hashAPIKey(apiKey)]; exists {
+		keyInfo.ExpiresAt = &expiresAt
+		la.persistAPIKey(keyInfo)
+	}
+}
+
+// storedUser is the persisted form of UserInfo, which hides the password hash from JSON
+type storedUser struct {
+	*UserInfo
+	PasswordHash string `json:"password_hash,omitempty"`
+}
+
+// SetStore attaches a persistent store. Keys and users already in the store
+// replace the in-memory defaults; an empty store is seeded with them.
+func (la *LocalAuthenticator) SetStore(store storage.Store) error {
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	ctx := context.Background()
+	la.store = store
+
+	users, err := store.List(ctx, storage.BucketUsers)
+	if err != nil {
+		return fmt.Errorf("failed to load users: %w", err)
+	}
+	keys, err := store.List(ctx, storage.BucketAPIKeys)
+	if err != nil {
+		return fmt.Errorf("failed to load API keys: %w", err)
+	}
+
+	if len(users) == 0 && len(keys) == 0 {
+		for _, user := range la.users {
+			la.persistUser(user)
+		}
+		for _, key := range la.apiKeys {
+			la.persistAPIKey(key)
+		}
+		logrus.Info("Seeded persistent store with default users and API keys")
+		return nil
+	}
+
+	for id, data := range users {
+		record := storedUser{UserInfo: &UserInfo{}}
+		if err := json.Unmarshal(data, &record); err != nil {
+			logrus.WithError(err).WithField("user_id", id).Warn("Skipping unreadable user record")
+			continue
+		}
+		record.UserInfo.Password = record.PasswordHash
+		la.users[id] = record.UserInfo
+	}
+
+	la.apiKeys = make(map[string]*APIKeyInfo, len(keys))
+	for hash, data := range keys {
+		var info APIKeyInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			logrus.WithError(err).Warn("Skipping unreadable API key record")
+			continue
+		}
+		la.apiKeys[hash] = &info
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"users":    len(la.users),
+		"api_keys": len(la.apiKeys),
+	}).Info("Loaded users and API keys from persistent store")
+	return nil
+}
+
+// persistAPIKey writes an API key to the store; callers hold la.mutex
+func (la *LocalAuthenticator) persistAPIKey(info *APIKeyInfo) {
+	if la.store == nil {
+		return
+	}
+	data, err := json.Marshal(info)
+	if err == nil {
+		err = la.store.Put(context.Background(), storage.BucketAPIKeys, info.KeyHash, data)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("key_id", info.ID).Error("Failed to persist API key")
+	}
+}
+
+// deletePersistedAPIKey removes an API key from the store; callers hold la.mutex
+func (la *LocalAuthenticator) deletePersistedAPIKey(keyHash string) {
+	if la.store == nil {
+		return
+	}
+	if err := la.store.Delete(context.Background(), storage.BucketAPIKeys, keyHash); err != nil {
+		logrus.WithError(err).Error("Failed to delete persisted API key")
+	}
+}
+
+// persistUser writes a user to the store; callers hold la.mutex
+func (la *LocalAuthenticator) persistUser(user *UserInfo) {
+	if la.store == nil {
+		return
+	}
+	data, err := json.Marshal(storedUser{UserInfo: user, PasswordHash: user.Password})
+	if err == nil {
+		err = la.store.Put(context.Background(), storage.BucketUsers, user.ID, data)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("user_id", user.ID).Error("Failed to persist user")
+	}
+}
+
+// loadPersistedAPIKey 内存未命中时从存储加载 API Key（可能由其他实例签发）及其所属用户。
+// Keys already in memory and authenticators without a store are left alone.
+func (la *LocalAuthenticator) loadPersistedAPIKey(keyHash string) {
+	la.mutex.RLock()
+	_, cached := la.apiKeys[keyHash]
+	store := la.store
+	la.mutex.RUnlock()
+	if cached || store == nil {
+		return
+	}
+
+	ctx := context.Background()
+	data, err := store.Get(ctx, storage.BucketAPIKeys, keyHash)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			logrus.WithError(err).Warn("Failed to look up API key in persistent store")
+		}
+		return
+	}
+	var info APIKeyInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		logrus.WithError(err).Warn("Skipping unreadable API key record")
+		return
+	}
+
+	la.mutex.RLock()
+	_, knownUser := la.users[info.UserID]
+	la.mutex.RUnlock()
+	var user *UserInfo
+	if !knownUser {
+		data, err := store.Get(ctx, storage.BucketUsers, info.UserID)
+		if err != nil {
+			logrus.WithError(err).WithField("user_id", info.UserID).Warn("Failed to load owner of persisted API key")
+			return
+		}
+		record := storedUser{UserInfo: &UserInfo{}}
+		if err := json.Unmarshal(data, &record); err != nil {
+			logrus.WithError(err).WithField("user_id", info.UserID).Warn("Skipping unreadable user record")
+			return
+		}
+		record.UserInfo.Password = record.PasswordHash
+		user = record.UserInfo
+	}
+
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+	if _, exists := la.apiKeys[keyHash]; !exists {
+		la.apiKeys[keyHash] = &info
+	}
+	if _, exists := la.users[info.UserID]; !exists && user != nil {
+		la.users[info.UserID] = user
+	}
+}
+
+// SyncUsage writes the LastUsed and TokensUsed of keys used since the last
+// sync to the store and returns how many keys were written
+func (la *LocalAuthenticator) SyncUsage() int {
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	if la.store == nil {
+		clear(la.usageDirty)
+		return 0
+	}
+	synced := 0
+	for keyHash := range la.usageDirty {
+		if info, exists := la.apiKeys[keyHash]; exists {
+			la.persistAPIKey(info)
+			synced++
+		}
+		delete(la.usageDirty, keyHash)
+	}
+	return synced
+}
+
+// StartUsageSync syncs key usage to the store every interval until ctx is done,
+// then once more so usage since the last tick is not lost
+func (la *LocalAuthenticator) StartUsageSync(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			la.SyncUsage()
+			return
+		case <-ticker.C:
+			if synced := la.SyncUsage(); synced > 0 {
+				logrus.WithField("api_keys", synced).Debug("Synced API key usage to persistent store")
+			}
+		}
+	}
+}
+
+// APIKeyMigrations lists the Redis schema migrations for API key records.
+// Append a step with the next version whenever APIKeyInfo changes in a way
+// that old records need rewriting.
+func APIKeyMigrations() []gwredis.Migration {
+	return []gwredis.Migration{
+		{
+			Version:     1,
+			Description: "baseline API key format",
+			Migrate:     func(key string, old []byte) ([]byte, error) { return old, nil },
+		},
+	}
+}
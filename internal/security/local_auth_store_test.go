@@ -0,0 +1,94 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/storage"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStoreAuthenticator(t *testing.T, store storage.Store) *LocalAuthenticator {
+	t.Helper()
+	la := NewLocalAuthenticator(&config.SecurityConfig{
+		JWTSecret:       "test-secret",
+		TokenExpiration: time.Hour,
+		APIKeyPrefix:    "gw-",
+		MaxAPIKeys:      10,
+	})
+	require.NoError(t, la.SetStore(store))
+	return la
+}
+
+func TestAPIKeyIssuedByAnotherInstanceIsLoadedOnMiss(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := storage.NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	issuer := newStoreAuthenticator(t, store)
+	other := newStoreAuthenticator(t, store)
+
+	apiKey, err := issuer.GenerateAPIKey("admin", "shared", []string{"read"}, 30)
+	require.NoError(t, err)
+
+	user, info, err := other.ValidateAPIKey(apiKey)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", user.ID)
+	assert.Equal(t, 30, info.RateLimit)
+
+	_, _, err = other.ValidateAPIKey("gw-unknown")
+	assert.Error(t, err)
+}
+
+func TestSyncUsagePersistsLastUsed(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := storage.NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	la := newStoreAuthenticator(t, store)
+
+	apiKey, err := la.GenerateAPIKey("admin", "usage", []string{"read"}, 0)
+	require.NoError(t, err)
+	_, _, err = la.ValidateAPIKey(apiKey)
+	require.NoError(t, err)
+
+	stored := func() APIKeyInfo {
+		data, err := store.Get(context.Background(), storage.BucketAPIKeys, la.hashAPIKey(apiKey))
+		require.NoError(t, err)
+		var info APIKeyInfo
+		require.NoError(t, json.Unmarshal(data, &info))
+		return info
+	}
+
+	// LastUsed is recorded in the background and only reaches the store on sync
+	assert.Eventually(t, func() bool {
+		info, err := la.DescribeAPIKey(apiKey)
+		return err == nil && info.LastUsed != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, stored().LastUsed)
+
+	assert.Equal(t, 1, la.SyncUsage())
+	assert.NotNil(t, stored().LastUsed)
+	assert.Zero(t, la.SyncUsage())
+}
+
+func TestValidateAPIKeyWithoutStore(t *testing.T) {
+	la := NewLocalAuthenticator(&config.SecurityConfig{
+		JWTSecret:       "test-secret",
+		TokenExpiration: time.Hour,
+		APIKeyPrefix:    "gw-",
+		MaxAPIKeys:      10,
+	})
+
+	apiKey, err := la.GenerateAPIKey("admin", "memory", []string{"read"}, 0)
+	require.NoError(t, err)
+	_, _, err = la.ValidateAPIKey(apiKey)
+	require.NoError(t, err)
+	_, _, err = la.ValidateAPIKey("gw-unknown")
+	assert.Error(t, err)
+	assert.Zero(t, la.SyncUsage())
+}
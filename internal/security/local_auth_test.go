@@ -0,0 +1,73 @@
+package security
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthenticateUserChecksBcryptHashes(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret-admin"), bcrypt.MinCost)
+	require.NoError(t, err)
+	t.Setenv("USER_ADMIN_PASSWORD_HASH", string(hash))
+	t.Setenv("USER_API_USER_PASSWORD", "api-password")
+	la := NewLocalAuthenticator(&config.SecurityConfig{JWTSecret: "test-secret", TokenExpiration: time.Hour})
+
+	user, err := la.AuthenticateUser("admin", "s3cret-admin")
+	require.NoError(t, err)
+	assert.Equal(t, "admin", user.ID)
+	_, err = la.AuthenticateUser("admin", "admin123")
+	assert.Error(t, err)
+
+	// Plain text passwords are hashed at startup and never kept
+	user, err = la.AuthenticateUser("api-user", "api-password")
+	require.NoError(t, err)
+	assert.NotEqual(t, "api-password", user.Password)
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("api-password")))
+
+	_, err = la.AuthenticateUser("nobody", "api-password")
+	assert.Error(t, err)
+}
+
+func TestAuthenticateUserWithoutPasswordHash(t *testing.T) {
+	t.Setenv("USER_ADMIN_PASSWORD_HASH", "not-a-bcrypt-hash")
+	la := NewLocalAuthenticator(&config.SecurityConfig{JWTSecret: "test-secret", TokenExpiration: time.Hour})
+
+	for _, password := range []string{"", "not-a-bcrypt-hash", "admin123"} {
+		_, err := la.AuthenticateUser("admin", password)
+		assert.Error(t, err)
+	}
+	_, err := la.AuthenticateUser("api-user", "")
+	assert.Error(t, err, "users without a hash cannot log in")
+}
+
+func TestAuthenticateUserIgnoresExternalUsers(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("s3cret-admin"), bcrypt.MinCost)
+	require.NoError(t, err)
+	t.Setenv("USER_ADMIN_PASSWORD_HASH", string(hash))
+	la := NewLocalAuthenticator(&config.SecurityConfig{JWTSecret: "test-secret", TokenExpiration: time.Hour})
+
+	// OIDC users keep the identity provider's preferred_username, which may clash
+	for i := 0; i < 20; i++ {
+		_, err := la.UpsertExternalUser(fmt.Sprintf("oidc:issuer:%d", i), "admin", "", nil)
+		require.NoError(t, err)
+	}
+	for i := 0; i < 20; i++ {
+		user, err := la.AuthenticateUser("admin", "s3cret-admin")
+		require.NoError(t, err)
+		assert.Equal(t, "admin", user.ID)
+	}
+
+	_, err = la.AuthenticateUser("external-only", "")
+	assert.Error(t, err)
+	_, err = la.UpsertExternalUser("oidc:issuer:solo", "external-only", "", nil)
+	require.NoError(t, err)
+	_, err = la.AuthenticateUser("external-only", "")
+	assert.Error(t, err, "external users have no password to log in with")
+}
@@ -0,0 +1,102 @@
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/httpclient"
+)
+
+// MutualTLSConfig 上游连接的双向 TLS 配置：向上游出示的客户端证书和私钥，
+// 以及校验上游证书的 CA。CAFile 为空时使用系统根证书。
+type MutualTLSConfig struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// NewMutualTLSConfig returns the mutual TLS settings of cfg, or nil when
+// neither a client certificate nor a CA is configured
+func NewMutualTLSConfig(cfg *config.SecurityConfig) *MutualTLSConfig {
+	if cfg.MTLSCertFile == "" && cfg.MTLSCAFile == "" {
+		return nil
+	}
+	return &MutualTLSConfig{
+		CertFile: cfg.MTLSCertFile,
+		KeyFile:  cfg.MTLSKeyFile,
+		CAFile:   cfg.MTLSCAFile,
+	}
+}
+
+// LoadMTLSTransport loads the certificate pair and the CA pool into a clone
+// of the default transport
+func (m *MutualTLSConfig) LoadMTLSTransport() (*http.Transport, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if m.CertFile != "" || m.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(m.CertFile, m.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load mTLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if m.CAFile != "" {
+		pem, err := os.ReadFile(m.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mTLS CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("mTLS CA file %s contains no PEM certificates", m.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+var (
+	upstreamTransportMu sync.RWMutex
+	upstreamTransport   *http.Transport
+)
+
+// SetUpstreamTransport installs the mutual TLS transport used by upstream
+// clients created afterwards; nil restores the default transport
+func SetUpstreamTransport(transport *http.Transport) {
+	upstreamTransportMu.Lock()
+	upstreamTransport = transport
+	upstreamTransportMu.Unlock()
+}
+
+// UpstreamTransport returns a clone of the installed mutual TLS transport, or
+// nil when none is installed
+func UpstreamTransport() *http.Transport {
+	upstreamTransportMu.RLock()
+	defer upstreamTransportMu.RUnlock()
+	if upstreamTransport == nil {
+		return nil
+	}
+	return upstreamTransport.Clone()
+}
+
+// UpstreamClient returns an HTTP client for feature that obeys the egress
+// policy and, when installed, presents the mutual TLS client certificate
+func UpstreamClient(feature string, timeout time.Duration) *http.Client {
+	transport := UpstreamTransport()
+	if transport == nil {
+		return httpclient.NewClient(feature, timeout)
+	}
+	// Like httpclient.Transport, never hand the connection to an environment proxy
+	transport.Proxy = nil
+	transport.DialContext = httpclient.EgressDialContext(feature, nil)
+	return httpclient.WrapClient(feature, &http.Client{Timeout: timeout, Transport: transport})
+}
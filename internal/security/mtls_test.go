@@ -0,0 +1,183 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA signs the server and client certificates of the mTLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gateway-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pool: pool,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns a certificate signed by the CA together with its PEM encoded
+// certificate and key
+func (ca *testCA) issue(t *testing.T, serial int64, commonName string, usage x509.ExtKeyUsage) (tls.Certificate, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	return pair, certPEM, keyPEM
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+// newMTLSServer starts a server that requires a client certificate signed by
+// ca and echoes the common name of the certificate presented
+func newMTLSServer(t *testing.T, ca *testCA) *httptest.Server {
+	serverCert, _, _ := ca.issue(t, 2, "upstream", x509.ExtKeyUsageServerAuth)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestLoadMTLSTransportPresentsClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newMTLSServer(t, ca)
+
+	dir := t.TempDir()
+	_, certPEM, keyPEM := ca.issue(t, 3, "ai-gateway", x509.ExtKeyUsageClientAuth)
+	mtls := NewMutualTLSConfig(&config.SecurityConfig{
+		MTLSCertFile: writeFile(t, dir, "client.crt", certPEM),
+		MTLSKeyFile:  writeFile(t, dir, "client.key", keyPEM),
+		MTLSCAFile:   writeFile(t, dir, "ca.crt", ca.pem),
+	})
+	require.NotNil(t, mtls)
+	transport, err := mtls.LoadMTLSTransport()
+	require.NoError(t, err)
+
+	client := &http.Client{Transport: transport, Timeout: 5 * time.Second}
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ai-gateway", string(body), "the upstream sees the gateway's client certificate")
+
+	// Without a client certificate the upstream rejects the handshake
+	anonymous := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool}},
+		Timeout:   5 * time.Second,
+	}
+	if resp, err := anonymous.Get(srv.URL); err == nil {
+		resp.Body.Close()
+		t.Fatal("expected the upstream to reject a client without a certificate")
+	}
+}
+
+func TestUpstreamClientUsesInstalledTransport(t *testing.T) {
+	ca := newTestCA(t)
+	srv := newMTLSServer(t, ca)
+	clientCert, _, _ := ca.issue(t, 3, "ai-gateway", x509.ExtKeyUsageClientAuth)
+
+	SetUpstreamTransport(&http.Transport{TLSClientConfig: &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      ca.pool,
+	}})
+	defer SetUpstreamTransport(nil)
+
+	resp, err := UpstreamClient("test", 5*time.Second).Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ai-gateway", string(body))
+
+	SetUpstreamTransport(nil)
+	assert.Nil(t, UpstreamTransport())
+}
+
+func TestLoadMTLSTransportErrors(t *testing.T) {
+	assert.Nil(t, NewMutualTLSConfig(&config.SecurityConfig{}), "mTLS is off unless a certificate or CA is configured")
+
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	_, certPEM, _ := ca.issue(t, 3, "ai-gateway", x509.ExtKeyUsageClientAuth)
+	certFile := writeFile(t, dir, "client.crt", certPEM)
+
+	_, err := (&MutualTLSConfig{CertFile: certFile, KeyFile: filepath.Join(dir, "missing.key")}).LoadMTLSTransport()
+	assert.ErrorContains(t, err, "client certificate")
+
+	_, err = (&MutualTLSConfig{CAFile: writeFile(t, dir, "bad-ca.crt", []byte("not a certificate"))}).LoadMTLSTransport()
+	assert.ErrorContains(t, err, "no PEM certificates")
+
+	_, err = (&MutualTLSConfig{CAFile: filepath.Join(dir, "missing-ca.crt")}).LoadMTLSTransport()
+	assert.ErrorContains(t, err, "CA file")
+}
@@ -0,0 +1,262 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+)
+
+// pkceKeyPrefix Redis中PKCE校验值的键前缀，键名为 oidc:pkce:<state>
+const pkceKeyPrefix = "oidc:pkce:"
+
+// ErrUnknownState state不存在、已过期或已被使用
+var ErrUnknownState = errors.New("unknown or expired OIDC state")
+
+// PKCEState 授权请求发起时保存的校验信息，回调时一次性取出
+type PKCEState struct {
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+}
+
+// PKCEStore 按state保存PKCE校验值
+type PKCEStore interface {
+	Save(ctx context.Context, state string, entry PKCEState, ttl time.Duration) error
+	// Consume returns the entry and deletes it so a state can only be redeemed once
+	Consume(ctx context.Context, state string) (*PKCEState, error)
+}
+
+// RedisPKCEStore 基于Redis的PKCE存储，多实例部署时回调可以落在任意实例
+type RedisPKCEStore struct {
+	client *redis.Client
+}
+
+// NewRedisPKCEStore creates a Redis-backed PKCE store
+func NewRedisPKCEStore(client *redis.Client) *RedisPKCEStore {
+	return &RedisPKCEStore{client: client}
+}
+
+// Save stores the entry under a key that expires after ttl
+func (s *RedisPKCEStore) Save(ctx context.Context, state string, entry PKCEState, ttl time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, pkceKeyPrefix+state, data, ttl).Err()
+}
+
+// Consume atomically reads and deletes the entry
+func (s *RedisPKCEStore) Consume(ctx context.Context, state string) (*PKCEState, error) {
+	data, err := s.client.GetDel(ctx, pkceKeyPrefix+state).Bytes()
+	if err == redis.Nil {
+		return nil, ErrUnknownState
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry PKCEState
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// MemoryPKCEStore 单实例部署（未启用Redis）时使用的内存存储
+type MemoryPKCEStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryPKCEEntry
+}
+
+type memoryPKCEEntry struct {
+	state     PKCEState
+	expiresAt time.Time
+}
+
+// NewMemoryPKCEStore creates an in-memory PKCE store
+func NewMemoryPKCEStore() *MemoryPKCEStore {
+	return &MemoryPKCEStore{entries: make(map[string]memoryPKCEEntry)}
+}
+
+// Save stores the entry and drops expired ones
+func (s *MemoryPKCEStore) Save(ctx context.Context, state string, entry PKCEState, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range s.entries {
+		if now.After(e.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[state] = memoryPKCEEntry{state: entry, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+// Consume reads and deletes the entry
+func (s *MemoryPKCEStore) Consume(ctx context.Context, state string) (*PKCEState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[state]
+	delete(s.entries, state)
+	if !ok || time.Now().After(e.expiresAt) {
+		return nil, ErrUnknownState
+	}
+	return &e.state, nil
+}
+
+// OIDCLoginResult 回调成功后签发的网关凭证
+type OIDCLoginResult struct {
+	Token   string
+	User    *UserInfo
+	Session *SessionInfo
+}
+
+// OIDCAuthenticator 实现带PKCE（S256）的OIDC授权码流程，登录成功后签发网关JWT
+type OIDCAuthenticator struct {
+	cfg       *config.OIDCConfig
+	localAuth *LocalAuthenticator
+	store     PKCEStore
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCAuthenticator creates the authenticator; provider discovery happens on first use
+func NewOIDCAuthenticator(cfg *config.OIDCConfig, localAuth *LocalAuthenticator, store PKCEStore) *OIDCAuthenticator {
+	return &OIDCAuthenticator{
+		cfg:       cfg,
+		localAuth: localAuth,
+		store:     store,
+	}
+}
+
+// provider 惰性加载discovery文档，失败时下次请求重试
+func (a *OIDCAuthenticator) provider(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.oauth != nil {
+		return a.oauth, a.verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, a.cfg.IssuerURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+
+	scopes := []string{oidc.ScopeOpenID}
+	for _, s := range a.cfg.Scopes {
+		if s != "" && s != oidc.ScopeOpenID {
+			scopes = append(scopes, s)
+		}
+	}
+
+	a.oauth = &oauth2.Config{
+		ClientID:     a.cfg.ClientID,
+		ClientSecret: a.cfg.ClientSecret,
+		RedirectURL:  a.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	a.verifier = provider.Verifier(&oidc.Config{ClientID: a.cfg.ClientID})
+	return a.oauth, a.verifier, nil
+}
+
+// AuthorizeURL generates state, nonce and a PKCE verifier, stores them and
+// returns the provider URL the user agent should be redirected to
+func (a *OIDCAuthenticator) AuthorizeURL(ctx context.Context) (string, error) {
+	oauthCfg, _, err := a.provider(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	if err := a.store.Save(ctx, state, PKCEState{Verifier: verifier, Nonce: nonce}, a.cfg.StateTTL); err != nil {
+		return "", fmt.Errorf("failed to store PKCE verifier: %w", err)
+	}
+
+	return oauthCfg.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier), oidc.Nonce(nonce)), nil
+}
+
+// HandleCallback exchanges the authorization code, validates the ID token and
+// issues a gateway JWT for the (possibly newly provisioned) user
+func (a *OIDCAuthenticator) HandleCallback(ctx context.Context, state, code, ipAddress, userAgent string) (*OIDCLoginResult, error) {
+	oauthCfg, verifier, err := a.provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := a.store.Consume(ctx, state)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := oauthCfg.Exchange(ctx, code, oauth2.VerifierOption(entry.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response did not include an id_token")
+	}
+
+	idToken, err := verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if idToken.Nonce != entry.Nonce {
+		return nil, errors.New("ID token nonce mismatch")
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		PreferredUsername string `json:"preferred_username"`
+		Name              string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to parse ID token claims: %w", err)
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Email
+	}
+	if username == "" {
+		username = idToken.Subject
+	}
+
+	user, err := a.localAuth.UpsertExternalUser("oidc:"+idToken.Subject, username, claims.Email, a.cfg.DefaultPermissions)
+	if err != nil {
+		return nil, err
+	}
+	session, err := a.localAuth.CreateSession(user.ID, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+	jwtToken, err := a.localAuth.GenerateJWT(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCLoginResult{Token: jwtToken, User: user, Session: session}, nil
+}
@@ -0,0 +1,288 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-aigateway/internal/storage"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultRefreshTokenExpiration applies when REFRESH_TOKEN_EXPIRATION is unset
+const DefaultRefreshTokenExpiration = 7 * 24 * time.Hour
+
+// refreshTokenPrefix marks opaque refresh tokens so they are not mistaken for JWTs or API keys
+const refreshTokenPrefix = "rt_"
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	// ErrRefreshTokenReused is returned for a revoked token presented again;
+	// all refresh tokens of its user are revoked in response
+	ErrRefreshTokenReused = errors.New("revoked refresh token reused")
+)
+
+// RefreshTokenInfo 刷新令牌记录，只保存令牌哈希
+type RefreshTokenInfo struct {
+	TokenHash string     `json:"token_hash"`
+	UserID    string     `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// GenerateRefreshToken issues a long-lived opaque token that RefreshAccessToken
+// exchanges for access tokens until it expires or is revoked
+func (la *LocalAuthenticator) GenerateRefreshToken(userID string) (string, error) {
+	token, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	if _, exists := la.users[userID]; !exists {
+		return "", fmt.Errorf("user not found: %s", userID)
+	}
+	expiration := la.config.RefreshTokenExpiration
+	if expiration <= 0 {
+		expiration = DefaultRefreshTokenExpiration
+	}
+	now := la.now()
+	la.pruneRefreshTokensLocked(now)
+	la.storeRefreshTokenLocked(token, userID, now, now.Add(expiration))
+	return token, nil
+}
+
+func newRefreshToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	return refreshTokenPrefix + hex.EncodeToString(tokenBytes), nil
+}
+
+// storeRefreshTokenLocked records the hash of token; callers hold la.mutex
+func (la *LocalAuthenticator) storeRefreshTokenLocked(token, userID string, now, expiresAt time.Time) {
+	info := &RefreshTokenInfo{
+		TokenHash: la.hashAPIKey(token),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	la.refreshTokens[info.TokenHash] = info
+	la.persistRefreshToken(info)
+}
+
+// RefreshAccessToken exchanges a valid refresh token for a new access token.
+// The refresh token stays usable until it expires or is revoked. A revoked
+// token being presented again means it leaked, so every refresh token of the
+// user is revoked and ErrRefreshTokenReused returned.
+func (la *LocalAuthenticator) RefreshAccessToken(refreshToken string) (accessToken string, err error) {
+	userID, err := la.redeemRefreshToken(refreshToken, "")
+	if err != nil {
+		return "", err
+	}
+	return la.GenerateJWT(userID)
+}
+
+// RotateRefreshToken is RefreshAccessToken with rotation: it also returns a
+// new refresh token and revokes the presented one, so each refresh token is
+// used once. The new token expires when the presented one would have, so a
+// session cannot be extended indefinitely.
+func (la *LocalAuthenticator) RotateRefreshToken(refreshToken string) (accessToken, nextRefreshToken string, err error) {
+	nextRefreshToken, err = newRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+	userID, err := la.redeemRefreshToken(refreshToken, nextRefreshToken)
+	if err != nil {
+		return "", "", err
+	}
+	accessToken, err = la.GenerateJWT(userID)
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, nextRefreshToken, nil
+}
+
+// redeemRefreshToken validates refreshToken and returns its user. When next is
+// set the presented token is revoked and next stored in its place.
+func (la *LocalAuthenticator) redeemRefreshToken(refreshToken, next string) (string, error) {
+	tokenHash := la.hashAPIKey(refreshToken)
+	la.loadPersistedRefreshToken(tokenHash)
+
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+	info, exists := la.refreshTokens[tokenHash]
+	if !exists {
+		return "", ErrRefreshTokenInvalid
+	}
+	now := la.now()
+	if info.RevokedAt != nil {
+		revoked := la.revokeUserRefreshTokensLocked(info.UserID, now)
+		logrus.WithFields(logrus.Fields{
+			"user_id": info.UserID,
+			"revoked": revoked,
+		}).Warn("Revoked refresh token reused, revoking all refresh tokens of the user")
+		return "", ErrRefreshTokenReused
+	}
+	if !now.Before(info.ExpiresAt) {
+		delete(la.refreshTokens, tokenHash)
+		la.deletePersistedRefreshToken(tokenHash)
+		return "", ErrRefreshTokenExpired
+	}
+	if user, ok := la.users[info.UserID]; !ok || !user.Active {
+		return "", ErrRefreshTokenInvalid
+	}
+	info.LastUsed = &now
+	if next != "" {
+		info.RevokedAt = &now
+		la.storeRefreshTokenLocked(next, info.UserID, now, info.ExpiresAt)
+	}
+	la.persistRefreshToken(info)
+	return info.UserID, nil
+}
+
+// RevokeRefreshToken revokes a refresh token. The record is kept until it
+// expires so that later use is detected as reuse.
+func (la *LocalAuthenticator) RevokeRefreshToken(token string) error {
+	return la.revokeRefreshToken(token, "")
+}
+
+// RevokeUserRefreshToken revokes a refresh token of userID, e.g. at logout.
+// Tokens of other users are reported as ErrRefreshTokenInvalid.
+func (la *LocalAuthenticator) RevokeUserRefreshToken(userID, token string) error {
+	return la.revokeRefreshToken(token, userID)
+}
+
+// revokeRefreshToken revokes token, which must belong to userID unless it is empty
+func (la *LocalAuthenticator) revokeRefreshToken(token, userID string) error {
+	tokenHash := la.hashAPIKey(token)
+	la.loadPersistedRefreshToken(tokenHash)
+
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+
+	info, exists := la.refreshTokens[tokenHash]
+	if !exists || (userID != "" && info.UserID != userID) {
+		return ErrRefreshTokenInvalid
+	}
+	if info.RevokedAt == nil {
+		now := la.now()
+		info.RevokedAt = &now
+		la.persistRefreshToken(info)
+	}
+	return nil
+}
+
+// RevokeAllRefreshTokens revokes every refresh token of userID and returns
+// how many were still usable
+func (la *LocalAuthenticator) RevokeAllRefreshTokens(userID string) int {
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+	return la.revokeUserRefreshTokensLocked(userID, la.now())
+}
+
+// pruneRefreshTokensLocked drops expired refresh tokens from memory; the store
+// keeps them until they are looked up. Callers hold la.mutex.
+func (la *LocalAuthenticator) pruneRefreshTokensLocked(now time.Time) {
+	for tokenHash, info := range la.refreshTokens {
+		if !now.Before(info.ExpiresAt) {
+			delete(la.refreshTokens, tokenHash)
+		}
+	}
+}
+
+// revokeUserRefreshTokensLocked revokes the user's refresh tokens, including
+// those issued by other instances; callers hold la.mutex
+func (la *LocalAuthenticator) revokeUserRefreshTokensLocked(userID string, now time.Time) int {
+	if la.store != nil {
+		records, err := la.store.List(context.Background(), storage.BucketRefreshTokens)
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to list persisted refresh tokens")
+		}
+		for tokenHash, data := range records {
+			if _, cached := la.refreshTokens[tokenHash]; cached {
+				continue
+			}
+			var info RefreshTokenInfo
+			if json.Unmarshal(data, &info) == nil && info.UserID == userID {
+				la.refreshTokens[tokenHash] = &info
+			}
+		}
+	}
+
+	revoked := 0
+	for _, info := range la.refreshTokens {
+		if info.UserID != userID || info.RevokedAt != nil {
+			continue
+		}
+		info.RevokedAt = &now
+		la.persistRefreshToken(info)
+		revoked++
+	}
+	return revoked
+}
+
+// persistRefreshToken writes a refresh token to the store; callers hold la.mutex
+func (la *LocalAuthenticator) persistRefreshToken(info *RefreshTokenInfo) {
+	if la.store == nil {
+		return
+	}
+	data, err := json.Marshal(info)
+	if err == nil {
+		err = la.store.Put(context.Background(), storage.BucketRefreshTokens, info.TokenHash, data)
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("user_id", info.UserID).Error("Failed to persist refresh token")
+	}
+}
+
+// deletePersistedRefreshToken removes a refresh token from the store; callers hold la.mutex
+func (la *LocalAuthenticator) deletePersistedRefreshToken(tokenHash string) {
+	if la.store == nil {
+		return
+	}
+	if err := la.store.Delete(context.Background(), storage.BucketRefreshTokens, tokenHash); err != nil {
+		logrus.WithError(err).Error("Failed to delete persisted refresh token")
+	}
+}
+
+// loadPersistedRefreshToken loads a refresh token issued by another instance on a miss
+func (la *LocalAuthenticator) loadPersistedRefreshToken(tokenHash string) {
+	la.mutex.RLock()
+	_, cached := la.refreshTokens[tokenHash]
+	store := la.store
+	la.mutex.RUnlock()
+	if cached || store == nil {
+		return
+	}
+
+	data, err := store.Get(context.Background(), storage.BucketRefreshTokens, tokenHash)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			logrus.WithError(err).Warn("Failed to look up refresh token in persistent store")
+		}
+		return
+	}
+	var info RefreshTokenInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		logrus.WithError(err).Warn("Skipping unreadable refresh token record")
+		return
+	}
+
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+	if _, exists := la.refreshTokens[tokenHash]; !exists {
+		la.refreshTokens[tokenHash] = &info
+	}
+}
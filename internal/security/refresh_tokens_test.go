@@ -0,0 +1,172 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/storage"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRefreshAuthenticator(t *testing.T) (*LocalAuthenticator, *time.Time) {
+	t.Helper()
+	la := NewLocalAuthenticator(&config.SecurityConfig{
+		JWTSecret:              "test-secret",
+		TokenExpiration:        time.Hour,
+		RefreshTokenExpiration: 7 * 24 * time.Hour,
+	})
+	now := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	la.now = func() time.Time { return now }
+	return la, &now
+}
+
+func TestRefreshAccessToken(t *testing.T) {
+	tests := []struct {
+		name string
+		// prepare runs between issuing the token and refreshing with it
+		prepare func(t *testing.T, la *LocalAuthenticator, now *time.Time, token string)
+		wantErr error
+	}{
+		{
+			name:    "valid token",
+			prepare: func(*testing.T, *LocalAuthenticator, *time.Time, string) {},
+		},
+		{
+			name: "used twice",
+			prepare: func(t *testing.T, la *LocalAuthenticator, now *time.Time, token string) {
+				*now = now.Add(24 * time.Hour)
+				_, err := la.RefreshAccessToken(token)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "rotated",
+			prepare: func(t *testing.T, la *LocalAuthenticator, now *time.Time, token string) {
+				*now = now.Add(24 * time.Hour)
+				_, _, err := la.RotateRefreshToken(token)
+				require.NoError(t, err)
+			},
+			wantErr: ErrRefreshTokenReused,
+		},
+		{
+			name: "expired",
+			prepare: func(t *testing.T, la *LocalAuthenticator, now *time.Time, token string) {
+				*now = now.Add(7 * 24 * time.Hour)
+			},
+			wantErr: ErrRefreshTokenExpired,
+		},
+		{
+			name: "revoked",
+			prepare: func(t *testing.T, la *LocalAuthenticator, now *time.Time, token string) {
+				require.NoError(t, la.RevokeRefreshToken(token))
+			},
+			wantErr: ErrRefreshTokenReused,
+		},
+		{
+			name: "unknown token",
+			prepare: func(t *testing.T, la *LocalAuthenticator, now *time.Time, token string) {
+				require.NoError(t, la.RevokeRefreshToken(token))
+				la.refreshTokens = make(map[string]*RefreshTokenInfo)
+			},
+			wantErr: ErrRefreshTokenInvalid,
+		},
+		{
+			name: "deactivated user",
+			prepare: func(t *testing.T, la *LocalAuthenticator, now *time.Time, token string) {
+				la.users["api-user"].Active = false
+			},
+			wantErr: ErrRefreshTokenInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			la, now := newRefreshAuthenticator(t)
+			token, err := la.GenerateRefreshToken("api-user")
+			require.NoError(t, err)
+			assert.NotContains(t, la.refreshTokens, token, "only the hash is kept")
+
+			tt.prepare(t, la, now, token)
+			accessToken, err := la.RefreshAccessToken(token)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, accessToken)
+				return
+			}
+			require.NoError(t, err)
+			claims, err := la.ValidateJWT(accessToken)
+			require.NoError(t, err)
+			assert.Equal(t, "api-user", claims.UserID)
+		})
+	}
+}
+
+func TestRefreshTokenReuseRevokesAllTokensOfUser(t *testing.T) {
+	la, _ := newRefreshAuthenticator(t)
+	stolen, err := la.GenerateRefreshToken("api-user")
+	require.NoError(t, err)
+	other, err := la.GenerateRefreshToken("api-user")
+	require.NoError(t, err)
+	admin, err := la.GenerateRefreshToken("admin")
+	require.NoError(t, err)
+
+	require.NoError(t, la.RevokeRefreshToken(stolen))
+	require.NoError(t, la.RevokeRefreshToken(stolen), "revoking twice is harmless")
+	_, err = la.RefreshAccessToken(stolen)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+
+	_, err = la.RefreshAccessToken(other)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused, "the user's other tokens are revoked too")
+	_, err = la.RefreshAccessToken(admin)
+	assert.NoError(t, err, "other users keep their tokens")
+
+	_, err = la.GenerateRefreshToken("nobody")
+	assert.Error(t, err)
+	assert.ErrorIs(t, la.RevokeRefreshToken("rt_unknown"), ErrRefreshTokenInvalid)
+}
+
+func TestRefreshTokenRotatesOnUse(t *testing.T) {
+	la, now := newRefreshAuthenticator(t)
+	first, err := la.GenerateRefreshToken("api-user")
+	require.NoError(t, err)
+	expiresAt := la.refreshTokens[la.hashAPIKey(first)].ExpiresAt
+
+	*now = now.Add(time.Hour)
+	_, second, err := la.RotateRefreshToken(first)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, expiresAt, la.refreshTokens[la.hashAPIKey(second)].ExpiresAt, "rotation does not extend the session")
+
+	*now = now.Add(time.Hour)
+	_, third, err := la.RotateRefreshToken(second)
+	require.NoError(t, err)
+
+	// Replaying a rotated token revokes the whole chain
+	_, _, err = la.RotateRefreshToken(first)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	_, err = la.RefreshAccessToken(third)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+}
+
+func TestRefreshTokenSharedThroughStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := storage.NewRedisStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	issuer := newStoreAuthenticator(t, store)
+	other := newStoreAuthenticator(t, store)
+
+	token, err := issuer.GenerateRefreshToken("api-user")
+	require.NoError(t, err)
+	_, err = other.RefreshAccessToken(token)
+	require.NoError(t, err, "a token issued by another instance is loaded on a miss")
+
+	// Revocation on one instance is reuse on another that loads it afresh
+	require.NoError(t, other.RevokeRefreshToken(token))
+	third := newStoreAuthenticator(t, store)
+	_, err = third.RefreshAccessToken(token)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+}
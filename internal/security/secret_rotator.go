@@ -0,0 +1,316 @@
+package security
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Redis keys shared by every gateway instance rotating the same JWT secrets
+const (
+	SecretRotationKey     = "jwt:secrets"
+	SecretRotationChannel = "jwt:secrets:rotated"
+	secretRotationLockKey = "jwt:secrets:lock"
+	secretRotationLockTTL = 30 * time.Second
+)
+
+// signingSecret 一代 JWT 签名密钥
+type signingSecret struct {
+	ID        string    `json:"id"`
+	Secret    []byte    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// errSecretSetUndecryptable marks a stored secret set sealed with another
+// configured JWT secret, which Init replaces
+var errSecretSetUndecryptable = errors.New("stored JWT secrets were sealed with a different JWT secret")
+
+// SecretRotator 定期生成新的 JWT 签名密钥，并保留前 keep 代密钥用于校验。
+// 配置 Redis 时密钥集合以配置的 JWT_SECRET 派生的密钥加密后存放在 Redis 中，
+// 轮换通过 Pub/Sub 通知所有实例重新加载。
+type SecretRotator struct {
+	mu         sync.RWMutex
+	secrets    []signingSecret // newest first
+	keep       int
+	interval   time.Duration
+	client     *redis.Client
+	sealer     cipher.AEAD // encrypts the set stored in Redis
+	instanceID string
+}
+
+// NewSecretRotator creates a rotator seeded with the initial secret. keep is the
+// number of previous secrets still accepted; interval 0 disables timed rotation.
+func NewSecretRotator(initial []byte, interval time.Duration, keep int) *SecretRotator {
+	if keep < 0 {
+		keep = 0
+	}
+	return &SecretRotator{
+		secrets:    []signingSecret{{ID: secretID(initial), Secret: initial, CreatedAt: time.Now()}},
+		keep:       keep,
+		interval:   interval,
+		sealer:     newSecretSealer(initial),
+		instanceID: generateID(),
+	}
+}
+
+// newSecretSealer derives the AES-GCM key sealing the shared set from the
+// configured secret, so only instances configured with it can read the set
+func newSecretSealer(initial []byte) cipher.AEAD {
+	key := sha256.Sum256(append([]byte("go-aigateway jwt secret set:"), initial...))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		panic(err) // a 32 byte key is always valid
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return aead
+}
+
+// secretID derives a stable key ID so instances seeded with the same secret agree on it
+func secretID(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Current returns the newest secret, used to sign new tokens
+func (r *SecretRotator) Current() (id string, secret []byte) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.secrets[0].ID, r.secrets[0].Secret
+}
+
+// Secrets returns every secret still accepted for validation, keyed by ID
+func (r *SecretRotator) Secrets() map[string][]byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	secrets := make(map[string][]byte, len(r.secrets))
+	for _, s := range r.secrets {
+		secrets[s.ID] = s.Secret
+	}
+	return secrets
+}
+
+// Init shares the secrets through Redis. A set stored by instances configured
+// with the same JWT secret is adopted; a missing set, or one sealed with a
+// previous JWT secret, is replaced by this instance's, so changing JWT_SECRET
+// drops every secret derived from the old one.
+func (r *SecretRotator) Init(ctx context.Context, client *redis.Client) error {
+	if client == nil {
+		return nil
+	}
+	r.client = client
+
+	err := r.Load(ctx)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, redis.Nil) && !errors.Is(err, errSecretSetUndecryptable) {
+		return err
+	}
+	if errors.Is(err, errSecretSetUndecryptable) {
+		logrus.Warn("JWT secret changed, replacing the shared JWT signing secrets")
+	}
+
+	r.mu.RLock()
+	secrets := r.secrets
+	r.mu.RUnlock()
+	return r.store(ctx, secrets)
+}
+
+// Load replaces the local secrets with the set stored in Redis
+func (r *SecretRotator) Load(ctx context.Context) error {
+	if r.client == nil {
+		return nil
+	}
+
+	data, err := r.client.Get(ctx, SecretRotationKey).Bytes()
+	if err != nil {
+		return fmt.Errorf("failed to load JWT secrets: %w", err)
+	}
+	nonceSize := r.sealer.NonceSize()
+	if len(data) < nonceSize {
+		return errSecretSetUndecryptable
+	}
+	plain, err := r.sealer.Open(nil, data[:nonceSize], data[nonceSize:], []byte(SecretRotationKey))
+	if err != nil {
+		return errSecretSetUndecryptable
+	}
+	var secrets []signingSecret
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return fmt.Errorf("failed to decode JWT secrets: %w", err)
+	}
+	if len(secrets) == 0 {
+		return errors.New("stored JWT secret set is empty")
+	}
+
+	r.mu.Lock()
+	r.secrets = secrets
+	r.mu.Unlock()
+	return nil
+}
+
+// store seals secrets and writes them to Redis. The set expires once every
+// secret in it would have been rotated out, e.g. after all instances stopped.
+func (r *SecretRotator) store(ctx context.Context, secrets []signingSecret) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, r.sealer.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to seal JWT secrets: %w", err)
+	}
+	data := r.sealer.Seal(nonce, nonce, plain, []byte(SecretRotationKey))
+
+	var ttl time.Duration
+	if r.interval > 0 {
+		ttl = r.interval * time.Duration(r.keep+2)
+	}
+	if err := r.client.Set(ctx, SecretRotationKey, data, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store JWT secrets: %w", err)
+	}
+	return nil
+}
+
+// releaseRotationLockScript deletes the rotation lock only if it still holds
+// our token, so a lock that expired and was taken over stays with its new owner
+var releaseRotationLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Rotate generates a new signing secret and drops secrets older than the keep
+// window. With Redis the change is stored under a lock and announced to other instances.
+func (r *SecretRotator) Rotate(ctx context.Context) error {
+	if r.client != nil {
+		token := generateID()
+		ok, err := r.client.SetNX(ctx, secretRotationLockKey, token, secretRotationLockTTL).Result()
+		if err != nil {
+			return fmt.Errorf("failed to acquire JWT rotation lock: %w", err)
+		}
+		if !ok {
+			// Another instance is rotating; its announcement reloads us
+			return nil
+		}
+		defer func() {
+			if err := releaseRotationLockScript.Run(context.Background(), r.client, []string{secretRotationLockKey}, token).Err(); err != nil {
+				logrus.WithError(err).Warn("Failed to release JWT rotation lock")
+			}
+		}()
+
+		if err := r.Load(ctx); err != nil {
+			return err
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate JWT secret: %w", err)
+	}
+	next := signingSecret{ID: secretID(secret), Secret: secret, CreatedAt: time.Now()}
+
+	r.mu.Lock()
+	secrets := append([]signingSecret{next}, r.secrets...)
+	if len(secrets) > r.keep+1 {
+		secrets = secrets[:r.keep+1]
+	}
+	r.mu.Unlock()
+
+	if r.client != nil {
+		if err := r.store(ctx, secrets); err != nil {
+			return err
+		}
+		if err := r.client.Publish(ctx, SecretRotationChannel, r.instanceID).Err(); err != nil {
+			logrus.WithError(err).Warn("Failed to publish JWT secret rotation")
+		}
+	}
+
+	r.mu.Lock()
+	r.secrets = secrets
+	r.mu.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"kid":  next.ID,
+		"kept": len(secrets) - 1,
+	}).Info("JWT signing secret rotated")
+	return nil
+}
+
+// due reports whether the newest secret has outlived the rotation interval
+func (r *SecretRotator) due() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return time.Since(r.secrets[0].CreatedAt) >= r.interval
+}
+
+// Start rotates the secret on schedule and reloads it when another instance rotates.
+// The age of the newest secret decides, so replicas don't each rotate in turn.
+func (r *SecretRotator) Start(ctx context.Context) {
+	if r.interval <= 0 {
+		return
+	}
+	if r.client != nil {
+		go r.listen(ctx)
+	}
+
+	check := r.interval / 10
+	if check > time.Minute {
+		check = time.Minute
+	}
+	ticker := time.NewTicker(check)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.due() {
+				continue
+			}
+			if err := r.Rotate(ctx); err != nil {
+				logrus.WithError(err).Error("Failed to rotate JWT signing secret")
+			}
+		}
+	}
+}
+
+// listen reloads the secrets whenever another instance announces a rotation
+func (r *SecretRotator) listen(ctx context.Context) {
+	pubsub := r.client.Subscribe(ctx, SecretRotationChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			if msg.Payload == r.instanceID {
+				continue
+			}
+			if err := r.Load(ctx); err != nil {
+				logrus.WithError(err).Warn("Failed to reload JWT secrets after rotation")
+			}
+		}
+	}
+}
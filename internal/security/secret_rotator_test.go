@@ -0,0 +1,194 @@
+package security
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRotatingAuthenticator() *LocalAuthenticator {
+	return NewLocalAuthenticator(&config.SecurityConfig{
+		JWTSecret:            "initial-secret",
+		TokenExpiration:      time.Hour,
+		JWTRotationInterval:  24 * time.Hour,
+		JWTRotationKeepCount: 2,
+	})
+}
+
+func TestSecretRotationKeepsPreviousSecrets(t *testing.T) {
+	ctx := context.Background()
+	auth := newRotatingAuthenticator()
+
+	gen0, err := auth.GenerateJWT("admin")
+	require.NoError(t, err)
+
+	require.NoError(t, auth.Secrets().Rotate(ctx))
+	gen1, err := auth.GenerateJWT("admin")
+	require.NoError(t, err)
+
+	// New tokens use the newest secret, the old token still validates
+	kid, _ := auth.Secrets().Current()
+	parsed, err := auth.ValidateJWT(gen1)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", parsed.UserID)
+	_, err = auth.ValidateJWT(gen0)
+	assert.NoError(t, err)
+	assert.NotEqual(t, secretID([]byte("initial-secret")), kid)
+
+	require.NoError(t, auth.Secrets().Rotate(ctx))
+	_, err = auth.ValidateJWT(gen0)
+	assert.NoError(t, err, "two generations old is within the keep window")
+
+	// A third rotation drops the secret gen0 was signed with
+	require.NoError(t, auth.Secrets().Rotate(ctx))
+	_, err = auth.ValidateJWT(gen0)
+	assert.Error(t, err)
+	_, err = auth.ValidateJWT(gen1)
+	assert.NoError(t, err)
+	assert.Len(t, auth.Secrets().Secrets(), 3)
+}
+
+func TestSecretRotationWithoutKidTriesAllSecrets(t *testing.T) {
+	auth := newRotatingAuthenticator()
+	token, err := auth.GenerateJWT("admin")
+	require.NoError(t, err)
+	require.NoError(t, auth.Secrets().Rotate(context.Background()))
+
+	// Tokens issued before key IDs carry no kid header
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "admin"}).SignedString([]byte("initial-secret"))
+	require.NoError(t, err)
+
+	_, err = auth.ValidateJWT(token)
+	assert.NoError(t, err)
+	_, err = auth.ValidateJWT(legacy)
+	assert.NoError(t, err)
+}
+
+func TestSecretRotationSyncsInstancesThroughRedis(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	a := newRotatingAuthenticator()
+	b := newRotatingAuthenticator()
+	require.NoError(t, a.Secrets().Init(ctx, client))
+	require.NoError(t, a.Secrets().Rotate(ctx))
+	require.NoError(t, b.Secrets().Init(ctx, client))
+
+	// The second instance adopts the shared set, including the rotated secret
+	aKid, _ := a.Secrets().Current()
+	bKid, _ := b.Secrets().Current()
+	assert.Equal(t, aKid, bKid)
+
+	go b.Secrets().Start(ctx)
+	require.Eventually(t, func() bool {
+		n, _ := client.PubSubNumSub(ctx, SecretRotationChannel).Result()
+		return n[SecretRotationChannel] == 1
+	}, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, a.Secrets().Rotate(ctx))
+	aKid, _ = a.Secrets().Current()
+	require.Eventually(t, func() bool {
+		kid, _ := b.Secrets().Current()
+		return kid == aKid
+	}, time.Second, 5*time.Millisecond)
+
+	token, err := b.GenerateJWT("admin")
+	require.NoError(t, err)
+	_, err = a.ValidateJWT(token)
+	assert.NoError(t, err)
+}
+
+func TestSecretRotationStoresSealedSecretsWithExpiry(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	auth := newRotatingAuthenticator()
+	require.NoError(t, auth.Secrets().Init(ctx, client))
+	require.NoError(t, auth.Secrets().Rotate(ctx))
+
+	stored, err := mr.Get(SecretRotationKey)
+	require.NoError(t, err)
+	for _, secret := range auth.Secrets().Secrets() {
+		assert.NotContains(t, stored, string(secret), "secrets are not stored in plaintext")
+	}
+	assert.NotContains(t, stored, "initial-secret")
+	assert.Equal(t, 4*24*time.Hour, mr.TTL(SecretRotationKey))
+}
+
+func TestSecretRotationReseedsWhenJWTSecretChanges(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	leaked := newRotatingAuthenticator()
+	require.NoError(t, leaked.Secrets().Init(ctx, client))
+	require.NoError(t, leaked.Secrets().Rotate(ctx))
+	leakedToken, err := leaked.GenerateJWT("admin")
+	require.NoError(t, err)
+
+	// After a leak the operator changes JWT_SECRET and restarts
+	replaced := NewLocalAuthenticator(&config.SecurityConfig{
+		JWTSecret:            "replacement-secret",
+		TokenExpiration:      time.Hour,
+		JWTRotationInterval:  24 * time.Hour,
+		JWTRotationKeepCount: 2,
+	})
+	require.NoError(t, replaced.Secrets().Init(ctx, client))
+
+	kid, _ := replaced.Secrets().Current()
+	assert.Equal(t, secretID([]byte("replacement-secret")), kid)
+	assert.Len(t, replaced.Secrets().Secrets(), 1, "secrets of the old JWT secret are dropped")
+	_, err = replaced.ValidateJWT(leakedToken)
+	assert.Error(t, err)
+
+	// Instances still on the old secret cannot read or overwrite the new set
+	assert.Error(t, leaked.Secrets().Load(ctx))
+	assert.Error(t, leaked.Secrets().Rotate(ctx))
+	restarted := NewLocalAuthenticator(&config.SecurityConfig{JWTSecret: "replacement-secret", TokenExpiration: time.Hour})
+	require.NoError(t, restarted.Secrets().Init(ctx, client))
+	restartedKid, _ := restarted.Secrets().Current()
+	assert.Equal(t, kid, restartedKid)
+}
+
+func TestSecretRotationKeepsLockOfAnotherInstance(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	auth := newRotatingAuthenticator()
+	require.NoError(t, auth.Secrets().Init(ctx, client))
+
+	// Rotation releases its own lock
+	require.NoError(t, auth.Secrets().Rotate(ctx))
+	assert.False(t, mr.Exists(secretRotationLockKey))
+
+	// A lock held by another instance is neither taken nor deleted
+	require.NoError(t, mr.Set(secretRotationLockKey, "other-instance"))
+	kid, _ := auth.Secrets().Current()
+	require.NoError(t, auth.Secrets().Rotate(ctx))
+	current, _ := auth.Secrets().Current()
+	assert.Equal(t, kid, current)
+	held, err := mr.Get(secretRotationLockKey)
+	require.NoError(t, err)
+	assert.Equal(t, "other-instance", held)
+
+	// The release script only deletes the holder's token
+	require.NoError(t, releaseRotationLockScript.Run(ctx, client, []string{secretRotationLockKey}, "mine").Err())
+	assert.True(t, mr.Exists(secretRotationLockKey))
+}
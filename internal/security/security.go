@@ -13,6 +13,7 @@ import (
 	"unicode"
 
 	"go-aigateway/internal/errors"
+	"go-aigateway/internal/logging"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -91,7 +92,7 @@ type SecurityMiddleware struct {
 func NewSecurityMiddleware(config *Config) *SecurityMiddleware {
 	return &SecurityMiddleware{
 		config:      config,
-		logger:      logrus.New(),
+		logger:      logging.Default(),
 		rateLimiter: NewRateLimiter(config.RateLimitRequests, config.RateLimitWindow),
 		csrfTokens:  make(map[string]time.Time),
 		auditLogger: NewAuditLogger(),
@@ -102,7 +103,7 @@ func NewSecurityMiddleware(config *Config) *SecurityMiddleware {
 func (sm *SecurityMiddleware) Middleware() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
 		// Get client IP for rate limiting
-		clientIP := extractClientIP(c)
+		clientIP := ExtractClientIP(c)
 
 		// Check request size limit
 		if sm.config.MaxRequestSize > 0 && c.Request.ContentLength > sm.config.MaxRequestSize {
@@ -254,7 +255,7 @@ type InputSanitizer struct {
 // NewInputSanitizer creates a new input sanitizer
 func NewInputSanitizer() *InputSanitizer {
 	return &InputSanitizer{
-		logger: logrus.New(),
+		logger: logging.Default(),
 	}
 }
 
@@ -513,7 +514,7 @@ func (s *SecureSession) Refresh(duration time.Duration) {
 func NewSessionManager() *SessionManager {
 	return &SessionManager{
 		sessions: make(map[string]*Session),
-		logger:   logrus.New(),
+		logger:   logging.Default(),
 	}
 }
 
@@ -588,15 +589,18 @@ type AuditEvent struct {
 	Details   map[string]interface{} `json:"details"`
 }
 
-// AuditLogger handles security audit logging
+// AuditLogger handles security audit logging. Events are also handed to its
+// exporters, or to the default exporters when it was created without any.
 type AuditLogger struct {
-	logger *logrus.Logger
+	logger    *logrus.Logger
+	exporters []AuditExporter
 }
 
-// NewAuditLogger creates a new audit logger
-func NewAuditLogger() *AuditLogger {
+// NewAuditLogger creates a new audit logger exporting events to exporters
+func NewAuditLogger(exporters ...AuditExporter) *AuditLogger {
 	return &AuditLogger{
-		logger: logrus.New(),
+		logger:    logging.Audit(),
+		exporters: exporters,
 	}
 }
 
@@ -610,6 +614,7 @@ func (al *AuditLogger) Log(event *AuditEvent) {
 		"user_agent": event.UserAgent,
 		"details":    event.Details,
 	}).Info("Security audit event")
+	al.export(event)
 }
 
 // LogWithContext logs an audit event with context
@@ -622,6 +627,7 @@ func (al *AuditLogger) LogWithContext(ctx context.Context, event *AuditEvent) {
 		"user_agent": event.UserAgent,
 		"details":    event.Details,
 	}).Info("Security audit event")
+	al.export(event)
 }
 
 // IsValidInput validates input against common security threats
@@ -735,68 +741,15 @@ func VerifyPassword(password, hashedPassword string) bool {
 	return err == nil
 }
 
-// extractClientIP extracts the real client IP from the request
-func extractClientIP(c *gin.Context) string {
-	// Check various headers for real IP
-	headers := []string{
-		"X-Forwarded-For",
-		"X-Real-IP",
-		"X-Client-IP",
-		"CF-Connecting-IP",
-	}
-
-	for _, header := range headers {
-		if ip := c.GetHeader(header); ip != "" {
-			// X-Forwarded-For might contain multiple IPs
-			if header == "X-Forwarded-For" {
-				ips := strings.Split(ip, ",")
-				if len(ips) > 0 {
-					return strings.TrimSpace(ips[0])
-				}
-			}
-			return ip
-		}
-	}
-
-	// Fall back to remote address
+// ExtractClientIP returns the client IP as resolved by gin: X-Forwarded-For and
+// X-Real-IP are honoured only when the peer is one of the engine's trusted
+// proxies (TRUSTED_PROXIES), walking X-Forwarded-For from the right and
+// skipping trusted hops. Otherwise, and for malformed headers, it is the
+// remote address.
+func ExtractClientIP(c *gin.Context) string {
 	return c.ClientIP()
 }
 
-// extractClientIPFromRequest extracts the real client IP from an HTTP request (for testing)
-func extractClientIPFromRequest(req *http.Request) string {
-	// Check various headers for real IP
-	headers := []string{
-		"X-Forwarded-For",
-		"X-Real-IP",
-		"X-Client-IP",
-		"CF-Connecting-IP",
-	}
-
-	for _, header := range headers {
-		if ip := req.Header.Get(header); ip != "" {
-			// X-Forwarded-For might contain multiple IPs
-			if header == "X-Forwarded-For" {
-				ips := strings.Split(ip, ",")
-				if len(ips) > 0 {
-					return strings.TrimSpace(ips[0])
-				}
-			}
-			return ip
-		}
-	}
-
-	// Fall back to remote address
-	if req.RemoteAddr != "" {
-		// Remove port if present
-		if colonIndex := strings.LastIndex(req.RemoteAddr, ":"); colonIndex > 0 {
-			return req.RemoteAddr[:colonIndex]
-		}
-		return req.RemoteAddr
-	}
-
-	return ""
-}
-
 // validateCSRFToken validates a CSRF token with enhanced security
 func (sm *SecurityMiddleware) validateCSRFToken(token string) bool {
 	if len(token) < 32 { // Increased minimum length
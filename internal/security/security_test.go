@@ -344,21 +344,45 @@ func TestExtractClientIP(t *testing.T) {
 		expected   string
 	}{
 		{
-			name: "X-Forwarded-For header",
+			name: "X-Forwarded-For from a trusted proxy",
 			headers: map[string]string{
-				"X-Forwarded-For": "203.0.113.1, 70.41.3.18, 150.172.238.178",
+				"X-Forwarded-For": "198.51.100.9, 203.0.113.1",
 			},
-			remoteAddr: "192.168.1.1:12345",
+			remoteAddr: "10.0.0.2:12345",
+			expected:   "203.0.113.1",
+		},
+		{
+			name: "trusted hops are skipped",
+			headers: map[string]string{
+				"X-Forwarded-For": "203.0.113.1, 10.0.0.3",
+			},
+			remoteAddr: "10.0.0.2:12345",
 			expected:   "203.0.113.1",
 		},
 		{
-			name: "X-Real-IP header",
+			name: "X-Real-IP from a trusted proxy",
 			headers: map[string]string{
 				"X-Real-IP": "203.0.113.1",
 			},
-			remoteAddr: "192.168.1.1:12345",
+			remoteAddr: "10.0.0.2:12345",
 			expected:   "203.0.113.1",
 		},
+		{
+			name: "X-Forwarded-For from an untrusted peer",
+			headers: map[string]string{
+				"X-Forwarded-For": "203.0.113.1",
+			},
+			remoteAddr: "192.168.1.1:12345",
+			expected:   "192.168.1.1",
+		},
+		{
+			name: "malformed X-Forwarded-For",
+			headers: map[string]string{
+				"X-Forwarded-For": "not-an-ip",
+			},
+			remoteAddr: "10.0.0.2:12345",
+			expected:   "10.0.0.2",
+		},
 		{
 			name:       "Remote address only",
 			headers:    map[string]string{},
@@ -367,6 +391,12 @@ func TestExtractClientIP(t *testing.T) {
 		},
 	}
 
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	require.NoError(t, r.SetTrustedProxies([]string{"10.0.0.0/8"}))
+	var ip string
+	r.GET("/test", func(c *gin.Context) { ip = ExtractClientIP(c) })
+
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req := httptest.NewRequest(http.MethodGet, "/test", nil)
@@ -375,7 +405,7 @@ func TestExtractClientIP(t *testing.T) {
 				req.Header.Set(k, v)
 			}
 
-			ip := extractClientIPFromRequest(req)
+			r.ServeHTTP(httptest.NewRecorder(), req)
 			assert.Equal(t, tt.expected, ip)
 		})
 	}
@@ -0,0 +1,69 @@
+// Package server holds the gateway's listeners beyond the plain net/http server.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/sirupsen/logrus"
+)
+
+// HTTP3Server serves the gateway handler over QUIC (experimental)
+type HTTP3Server struct {
+	server *http3.Server
+	conn   net.PacketConn
+}
+
+// NewHTTP3Server loads the TLS certificate and binds the UDP socket on addr;
+// the socket is bound up front so Shutdown cannot race a half-started listener
+func NewHTTP3Server(addr, certFile, keyFile string, handler http.Handler) (*HTTP3Server, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	return newHTTP3Server(addr, &tls.Config{Certificates: []tls.Certificate{cert}}, handler)
+}
+
+func newHTTP3Server(addr string, tlsConfig *tls.Config, handler http.Handler) (*HTTP3Server, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on UDP %s: %w", addr, err)
+	}
+	return &HTTP3Server{
+		server: &http3.Server{
+			Addr:      addr,
+			Handler:   handler,
+			TLSConfig: tlsConfig,
+			// 0-RTT requests can be replayed; chat completions are not idempotent
+			QUICConfig: &quic.Config{Allow0RTT: false},
+		},
+		conn: conn,
+	}, nil
+}
+
+// Addr returns the bound UDP address
+func (s *HTTP3Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Serve handles QUIC connections until Shutdown
+func (s *HTTP3Server) Serve() error {
+	logrus.WithField("addr", s.conn.LocalAddr().String()).Info("HTTP/3 (QUIC) listener started")
+	err := s.server.Serve(s.conn)
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// Shutdown sends GOAWAY, waits for in-flight requests until ctx is done and
+// closes the listener
+func (s *HTTP3Server) Shutdown(ctx context.Context) error {
+	defer s.conn.Close()
+	return s.server.Shutdown(ctx)
+}
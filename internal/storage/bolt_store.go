@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltStore 基于bbolt的嵌入式存储后端，适用于单实例部署
+type BoltStore struct {
+	db           *bolt.DB
+	path         string
+	snapshotPath string
+}
+
+// OpenBoltStore opens the database file, checks its integrity and recovers from
+// the last good snapshot when the file is unreadable or corrupted
+func OpenBoltStore(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	store := &BoltStore{
+		path:         path,
+		snapshotPath: path + ".snapshot",
+	}
+
+	db, err := openAndCheck(path)
+	if err != nil {
+		logrus.WithError(err).Error("Embedded storage integrity check failed, recovering from last snapshot")
+		if db, err = store.recover(); err != nil {
+			return nil, err
+		}
+	}
+	store.db = db
+
+	// 启动时完整性校验通过，保存为最近一次可用快照
+	if err := store.Snapshot(); err != nil {
+		logrus.WithError(err).Warn("Failed to write storage snapshot")
+	}
+
+	logrus.WithField("path", path).Info("Embedded storage opened")
+	return store, nil
+}
+
+// openAndCheck opens the database and runs bbolt's consistency check
+func openAndCheck(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		var firstErr error
+		// Drain the channel so the checker goroutine can finish
+		for checkErr := range tx.Check() {
+			if firstErr == nil {
+				firstErr = checkErr
+			}
+		}
+		return firstErr
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database check failed: %w", err)
+	}
+	return db, nil
+}
+
+// recover moves the damaged file aside and restores the last good snapshot
+func (s *BoltStore) recover() (*bolt.DB, error) {
+	if _, err := os.Stat(s.path); err == nil {
+		corrupt := fmt.Sprintf("%s.corrupt-%d", s.path, time.Now().Unix())
+		if err := os.Rename(s.path, corrupt); err != nil {
+			return nil, fmt.Errorf("failed to move corrupted database: %w", err)
+		}
+		logrus.WithField("path", corrupt).Warn("Moved corrupted database aside")
+	}
+
+	if _, err := os.Stat(s.snapshotPath); err == nil {
+		if err := copyFile(s.snapshotPath, s.path); err != nil {
+			return nil, fmt.Errorf("failed to restore snapshot: %w", err)
+		}
+		logrus.WithField("snapshot", s.snapshotPath).Info("Restored database from snapshot")
+	} else {
+		logrus.Warn("No storage snapshot available, starting with an empty database")
+	}
+
+	return openAndCheck(s.path)
+}
+
+// Get 读取键值
+func (s *BoltStore) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrNotFound
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+		value = append([]byte(nil), v...)
+		return nil
+	})
+	return value, err
+}
+
+// Put 写入键值
+func (s *BoltStore) Put(ctx context.Context, bucket, key string, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), value)
+	})
+}
+
+// Delete 删除键
+func (s *BoltStore) Delete(ctx context.Context, bucket, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// List 列出bucket中的所有键值
+func (s *BoltStore) List(ctx context.Context, bucket string) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			result[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	return result, err
+}
+
+// Capabilities 嵌入式存储仅支持单实例，不提供分布式能力
+func (s *BoltStore) Capabilities() Capabilities {
+	return Capabilities{Backup: true}
+}
+
+// Backup streams a consistent snapshot of the database
+func (s *BoltStore) Backup(w io.Writer) (int64, error) {
+	var n int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.WriteTo(w)
+		return err
+	})
+	return n, err
+}
+
+// Snapshot writes a consistent copy of the database next to the data file
+func (s *BoltStore) Snapshot() error {
+	tmp := s.snapshotPath + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.Backup(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.snapshotPath)
+}
+
+// StartSnapshotter 周期性保存快照，用于损坏后的自动恢复
+func (s *BoltStore) StartSnapshotter(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				logrus.WithError(err).Warn("Failed to write storage snapshot")
+			}
+		}
+	}
+}
+
+// Close 关闭数据库
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
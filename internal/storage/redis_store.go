@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore Redis存储后端，每个bucket对应一个hash
+type RedisStore struct {
+	client    *redis.Client
+	keyPrefix string
+}
+
+// NewRedisStore 创建Redis存储后端
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{
+		client:    client,
+		keyPrefix: "store:",
+	}
+}
+
+// Get 读取键值
+func (s *RedisStore) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	value, err := s.client.HGet(ctx, s.keyPrefix+bucket, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+// Put 写入键值
+func (s *RedisStore) Put(ctx context.Context, bucket, key string, value []byte) error {
+	return s.client.HSet(ctx, s.keyPrefix+bucket, key, value).Err()
+}
+
+// Delete 删除键
+func (s *RedisStore) Delete(ctx context.Context, bucket, key string) error {
+	return s.client.HDel(ctx, s.keyPrefix+bucket, key).Err()
+}
+
+// List 列出bucket中的所有键值
+func (s *RedisStore) List(ctx context.Context, bucket string) (map[string][]byte, error) {
+	values, err := s.client.HGetAll(ctx, s.keyPrefix+bucket).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]byte, len(values))
+	for k, v := range values {
+		result[k] = []byte(v)
+	}
+	return result, nil
+}
+
+// Capabilities Redis支持分布式锁和失效通知
+func (s *RedisStore) Capabilities() Capabilities {
+	return Capabilities{
+		DistributedLocks: true,
+		InvalidationBus:  true,
+	}
+}
+
+// Close Redis客户端由调用方管理，这里不关闭
+func (s *RedisStore) Close() error {
+	return nil
+}
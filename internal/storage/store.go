@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"go-aigateway/internal/config"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+// Storage backends
+const (
+	BackendRedis    = "redis"
+	BackendEmbedded = "embedded"
+)
+
+// Buckets used by the gateway's stateful features
+const (
+	BucketAPIKeys         = "api_keys"
+	BucketUsers           = "users"
+	BucketRefreshTokens   = "refresh_tokens"
+	BucketRoutes          = "routes"
+	BucketServiceSources  = "service_sources"
+	BucketFeatureFlags    = "feature_flags"
+	BucketSLOs            = "slos"
+	BucketCapacity        = "capacity"
+	BucketModelLifecycle  = "model_lifecycle"
+	BucketPromptTemplates = "prompt_templates"
+	BucketPromptRollouts  = "prompt_rollouts"
+	BucketPromptPins      = "prompt_pins"
+	BucketUsage           = "usage"
+	BucketIdempotency     = "idempotency"
+)
+
+// ErrNotFound is returned when a key does not exist in a bucket
+var ErrNotFound = errors.New("storage: key not found")
+
+// Capabilities describes which distributed features a backend supports
+type Capabilities struct {
+	DistributedLocks bool
+	InvalidationBus  bool
+	Backup           bool
+}
+
+// Store 持久化存储接口，Redis与嵌入式后端实现相同的语义
+type Store interface {
+	Get(ctx context.Context, bucket, key string) ([]byte, error)
+	Put(ctx context.Context, bucket, key string, value []byte) error
+	Delete(ctx context.Context, bucket, key string) error
+	List(ctx context.Context, bucket string) (map[string][]byte, error)
+	Capabilities() Capabilities
+	Close() error
+}
+
+// Backupper is implemented by stores that can stream a consistent snapshot
+type Backupper interface {
+	Backup(w io.Writer) (int64, error)
+}
+
+// New creates the store selected by STORAGE_BACKEND. For the redis backend a nil
+// client yields a nil store, meaning state is kept in memory only.
+func New(cfg *config.StorageConfig, redisClient *redis.Client) (Store, error) {
+	switch cfg.Backend {
+	case BackendEmbedded:
+		store, err := OpenBoltStore(cfg.Path)
+		if err != nil {
+			return nil, err
+		}
+		caps := store.Capabilities()
+		if !caps.DistributedLocks {
+			logrus.Info("Embedded storage: distributed locks are disabled (single instance only)")
+		}
+		if !caps.InvalidationBus {
+			logrus.Info("Embedded storage: cache invalidation bus is disabled (single instance only)")
+		}
+		return store, nil
+	case BackendRedis, "":
+		if redisClient == nil {
+			logrus.Warn("Redis storage backend selected but Redis is unavailable, state will not be persisted")
+			return nil, nil
+		}
+		return NewRedisStore(redisClient), nil
+	default:
+		return nil, fmt.Errorf("unsupported storage backend: %s", cfg.Backend)
+	}
+}
@@ -0,0 +1,326 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// HealthKeyPrefix 上游健康评分在Redis中的键前缀
+	HealthKeyPrefix = "upstream:health:"
+	// HealthIndexKey 记录所有上游名称的集合
+	HealthIndexKey = "upstream:health:index"
+)
+
+// CircuitState 熔断器状态
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+// CircuitBreakers 提供上游熔断状态的熔断器，注册表把被动请求结果交给它并读取其状态，
+// 而不是自行推导熔断状态
+type CircuitBreakers interface {
+	RecordOutcome(name string, success bool)
+	CircuitState(name string) (CircuitState, bool)
+}
+
+// Name 返回上游的标识（base URL的host），主动探测和被动请求都以它记录
+func Name(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return baseURL
+	}
+	return u.Host
+}
+
+// Weights 综合健康评分的权重
+type Weights struct {
+	ErrorRate     float64
+	ThrottleRate  float64
+	Latency       float64
+	Circuit       float64
+	ActiveCheck   float64
+	LatencyTarget time.Duration
+}
+
+// DefaultWeights 返回默认权重
+func DefaultWeights() Weights {
+	return Weights{
+		ErrorRate:     0.3,
+		ThrottleRate:  0.3,
+		Latency:       0.1,
+		Circuit:       0.2,
+		ActiveCheck:   0.1,
+		LatencyTarget: 2 * time.Second,
+	}
+}
+
+// Health 单个上游的健康快照，发布到Redis供自动扩缩容使用
+type Health struct {
+	Name          string       `json:"name"`
+	Score         float64      `json:"score"` // 0 (完全不可用) - 1 (完全健康)
+	Requests      int64        `json:"requests"`
+	ErrorRate     float64      `json:"error_rate"`    // 5xx及连接错误占比 (0-1)
+	ThrottleRate  float64      `json:"throttle_rate"` // 429占比 (0-1)
+	AvgLatencyMs  float64      `json:"avg_latency_ms"`
+	CircuitState  CircuitState `json:"circuit_state"`
+	ActiveHealthy bool         `json:"active_healthy"`
+	CooldownUntil time.Time    `json:"cooldown_until,omitempty"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// InCooldown 上游是否处于429冷却期
+func (h *Health) InCooldown(now time.Time) bool {
+	return !h.CooldownUntil.IsZero() && now.Before(h.CooldownUntil)
+}
+
+// upstreamState 单个上游的滚动统计
+type upstreamState struct {
+	requests      int64
+	errors        int64
+	throttled     int64
+	totalLatency  time.Duration
+	activeHealthy bool
+	cooldownUntil time.Time
+}
+
+// Registry 上游健康注册表，汇总主动探测和被动请求信号
+type Registry struct {
+	mu              sync.RWMutex
+	states          map[string]*upstreamState
+	weights         Weights
+	breakers        CircuitBreakers
+	defaultCooldown time.Duration
+}
+
+// NewRegistry 创建上游健康注册表
+func NewRegistry(weights Weights) *Registry {
+	return &Registry{
+		states:          make(map[string]*upstreamState),
+		weights:         weights,
+		defaultCooldown: 30 * time.Second,
+	}
+}
+
+var defaultRegistry = NewRegistry(DefaultWeights())
+
+// DefaultRegistry 返回进程级的默认注册表
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// SetWeights 更新评分权重
+func (r *Registry) SetWeights(weights Weights) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.weights = weights
+}
+
+// SetCircuitBreakers 设置熔断器来源，nil表示不跟踪熔断状态
+func (r *Registry) SetCircuitBreakers(breakers CircuitBreakers) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.breakers = breakers
+}
+
+func (r *Registry) state(name string) *upstreamState {
+	s, ok := r.states[name]
+	if !ok {
+		s = &upstreamState{activeHealthy: true}
+		r.states[name] = s
+	}
+	return s
+}
+
+// RecordResult 记录一次被动请求结果，statusCode为0表示连接失败
+func (r *Registry) RecordResult(name string, statusCode int, latency time.Duration, header http.Header) {
+	r.mu.Lock()
+	s := r.state(name)
+	now := time.Now()
+	s.requests++
+	s.totalLatency += latency
+
+	// 429不影响熔断，只触发冷却
+	failed, recorded := false, true
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		s.throttled++
+		cooldown := r.defaultCooldown
+		if header != nil {
+			if secs, err := strconv.Atoi(header.Get("Retry-After")); err == nil && secs > 0 {
+				cooldown = time.Duration(secs) * time.Second
+			}
+		}
+		if until := now.Add(cooldown); until.After(s.cooldownUntil) {
+			s.cooldownUntil = until
+		}
+		recorded = false
+	case statusCode == 0 || statusCode >= 500:
+		s.errors++
+		failed = true
+	}
+	breakers := r.breakers
+	r.mu.Unlock()
+
+	// 熔断器可能访问Redis，不在锁内调用
+	if breakers != nil && recorded {
+		breakers.RecordOutcome(name, !failed)
+	}
+}
+
+// RecordActiveCheck 记录一次主动健康检查结果
+func (r *Registry) RecordActiveCheck(name string, healthy bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state(name).activeHealthy = healthy
+}
+
+// Snapshot 计算所有上游的健康快照，并衰减滚动计数
+func (r *Registry) Snapshot() []*Health {
+	r.mu.Lock()
+	now := time.Now()
+	weights := r.weights
+	breakers := r.breakers
+	result := make([]*Health, 0, len(r.states))
+	for name, s := range r.states {
+		h := &Health{
+			Name:          name,
+			Requests:      s.requests,
+			CircuitState:  CircuitClosed,
+			ActiveHealthy: s.activeHealthy,
+			CooldownUntil: s.cooldownUntil,
+			UpdatedAt:     now,
+		}
+		if s.requests > 0 {
+			h.ErrorRate = float64(s.errors) / float64(s.requests)
+			h.ThrottleRate = float64(s.throttled) / float64(s.requests)
+			h.AvgLatencyMs = float64(s.totalLatency.Milliseconds()) / float64(s.requests)
+		}
+		result = append(result, h)
+
+		// 半衰减，让旧数据逐渐失去影响
+		s.requests /= 2
+		s.errors /= 2
+		s.throttled /= 2
+		s.totalLatency /= 2
+	}
+	r.mu.Unlock()
+
+	for _, h := range result {
+		if breakers != nil {
+			if state, ok := breakers.CircuitState(h.Name); ok {
+				h.CircuitState = state
+			}
+		}
+		h.Score = Score(h, weights)
+	}
+	return result
+}
+
+// Score 按权重计算综合健康评分
+func Score(h *Health, w Weights) float64 {
+	total := w.ErrorRate + w.ThrottleRate + w.Latency + w.Circuit + w.ActiveCheck
+	if total <= 0 {
+		return 1
+	}
+
+	latencyPenalty := 0.0
+	if w.LatencyTarget > 0 {
+		latencyPenalty = math.Min(h.AvgLatencyMs/float64(w.LatencyTarget.Milliseconds()), 1)
+	}
+
+	circuitPenalty := 0.0
+	switch h.CircuitState {
+	case CircuitOpen:
+		circuitPenalty = 1
+	case CircuitHalfOpen:
+		circuitPenalty = 0.5
+	}
+
+	activePenalty := 0.0
+	if !h.ActiveHealthy {
+		activePenalty = 1
+	}
+
+	penalty := w.ErrorRate*h.ErrorRate +
+		w.ThrottleRate*h.ThrottleRate +
+		w.Latency*latencyPenalty +
+		w.Circuit*circuitPenalty +
+		w.ActiveCheck*activePenalty
+
+	return math.Max(0, math.Min(1, 1-penalty/total))
+}
+
+// Publish 将健康快照写入Redis
+func (r *Registry) Publish(ctx context.Context, client *redis.Client, ttl time.Duration) error {
+	pipe := client.Pipeline()
+	for _, h := range r.Snapshot() {
+		data, err := json.Marshal(h)
+		if err != nil {
+			return err
+		}
+		pipe.Set(ctx, HealthKeyPrefix+h.Name, data, ttl)
+		pipe.SAdd(ctx, HealthIndexKey, h.Name)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// StartPublisher 周期性发布健康评分
+func (r *Registry) StartPublisher(ctx context.Context, client *redis.Client, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Publish(ctx, client, interval*4); err != nil {
+				logrus.WithError(err).Warn("Failed to publish upstream health")
+			}
+		}
+	}
+}
+
+// LoadHealth 从Redis读取所有上游的健康快照
+func LoadHealth(ctx context.Context, client *redis.Client) ([]*Health, error) {
+	names, err := client.SMembers(ctx, HealthIndexKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list upstreams: %w", err)
+	}
+
+	var result []*Health
+	for _, name := range names {
+		data, err := client.Get(ctx, HealthKeyPrefix+name).Result()
+		if err == redis.Nil {
+			// 快照已过期，从索引中移除
+			client.SRem(ctx, HealthIndexKey, name)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var h Health
+		if err := json.Unmarshal([]byte(data), &h); err != nil {
+			continue
+		}
+		result = append(result, &h)
+	}
+	return result, nil
+}
@@ -9,35 +9,49 @@ package main
 import (
 	"context"
 	"go-aigateway/internal/autoscaler"
+	"go-aigateway/internal/batch"
+	"go-aigateway/internal/chaos"
 	"go-aigateway/internal/cloud"
 	"go-aigateway/internal/config"
 	"go-aigateway/internal/discovery"
 	"go-aigateway/internal/errors"
+	"go-aigateway/internal/flags"
 	"go-aigateway/internal/handlers"
+	"go-aigateway/internal/httpclient"
+	"go-aigateway/internal/lifecycle"
 	"go-aigateway/internal/localmodel"
+	"go-aigateway/internal/logging"
 	"go-aigateway/internal/middleware"
 	"go-aigateway/internal/monitoring"
 	"go-aigateway/internal/performance"
 	"go-aigateway/internal/protocol"
+	"go-aigateway/internal/providers"
 	"go-aigateway/internal/ram"
 	redisClient "go-aigateway/internal/redis"
 	"go-aigateway/internal/router"
+	"go-aigateway/internal/routing"
 	"go-aigateway/internal/security"
+	"go-aigateway/internal/server"
+	"go-aigateway/internal/storage"
+	"go-aigateway/internal/upstream"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
+	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		logrus.Info("No .env file found, using system environment variables")
+	// Load environment variables; CONFIG_FILE values win over the .env file,
+	// variables already in the environment over both
+	if err := config.LoadFiles(os.Getenv("ENV_FILE"), os.Getenv("CONFIG_FILE")); err != nil {
+		logrus.WithError(err).Fatal("Failed to load configuration files")
 	}
 	// Initialize configuration
 	cfg := config.New()
@@ -47,15 +61,62 @@ func main() {
 		logrus.WithError(err).Fatal("Configuration validation failed")
 	}
 
-	// Setup logging
-	setupLogging(cfg)
+	// Setup logging; components share this logger instead of creating their own
+	logging.Setup(cfg.LogLevel, cfg.LogFormat, os.Stdout)
+
+	// Outbound calls from every feature go through the egress policy
+	if cfg.Egress.Enabled {
+		egressPolicy, err := httpclient.NewEgressPolicy(cfg.Egress)
+		if err != nil {
+			logrus.WithError(err).Fatal("Invalid egress policy")
+		}
+		httpclient.SetEgressPolicy(egressPolicy)
+		egressAudit := security.NewAuditLogger()
+		httpclient.SetEgressAuditor(func(ctx context.Context, violation *httpclient.EgressError) {
+			egressAudit.LogWithContext(ctx, &security.AuditEvent{
+				Type:      "egress_denied",
+				Action:    violation.Reason,
+				Resource:  violation.Target,
+				Timestamp: time.Now(),
+				Details: map[string]interface{}{
+					"feature": violation.Feature,
+					"detail":  violation.Detail,
+				},
+			})
+		})
+		logrus.Info("Egress policy enabled")
+	}
+
+	// Upstream provider connections present a client certificate when mTLS is configured
+	if mtls := security.NewMutualTLSConfig(&cfg.Security); mtls != nil {
+		transport, err := mtls.LoadMTLSTransport()
+		if err != nil {
+			logrus.WithError(err).Fatal("Invalid upstream mTLS configuration")
+		}
+		security.SetUpstreamTransport(transport)
+		logrus.Info("Upstream mTLS enabled")
+	}
 
 	// Initialize services
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Initialize Redis client
+	// The active configuration, swapped as a whole on reload for the middleware
+	// that reads it on every request
+	live := config.NewSnapshot(cfg)
+
+	// Embedded storage runs as a single binary without Redis. Rate limiting and
+	// caching fall back to per-instance memory, so this mode is single-replica only.
+	if cfg.Storage.Backend == storage.BackendEmbedded && cfg.Redis.Enabled {
+		logrus.Warn("Embedded storage backend selected, Redis is disabled; rate limits and caches are per-instance")
+		cfg.Redis.Enabled = false
+	}
+
+	// Initialize Redis client. When Redis is unreachable the gateway still
+	// starts: rate limits fall back to per-instance memory and real-time metrics
+	// are buffered until the reconnect loop reaches Redis.
 	var redisClientInstance *redisClient.Client
+	var redisReconnect *redisClient.Client
 	var err error
 	if cfg.Redis.Enabled {
 		redisConfig := &redisClient.Config{
@@ -66,13 +127,14 @@ func main() {
 		}
 		redisClientInstance, err = redisClient.NewClient(redisConfig)
 		if err != nil {
-			logrus.WithError(err).Fatal("Failed to initialize Redis client")
-		}
-
-		// Start Redis health check
-		go redisClientInstance.StartHealthCheck(ctx)
+			logrus.WithError(err).Warn("Redis is unavailable, starting in degraded mode")
+			redisReconnect = redisClient.New(redisConfig)
+		} else {
+			// Start Redis health check
+			go redisClientInstance.StartHealthCheck(ctx)
 
-		logrus.Info("Redis client initialized")
+			logrus.Info("Redis client initialized")
+		}
 	} else {
 		logrus.Info("Redis is disabled")
 	}
@@ -81,51 +143,200 @@ func main() {
 	errorHandler := errors.NewErrorHandler()
 	// Use error handler as middleware (will be added to Gin router later)
 
+	// Long-running components are started together before serving and closed on shutdown
+	components := lifecycle.NewManager()
+
+	// Ship audit events to object storage when AUDIT_EXPORT_BACKEND is set
+	auditExporter, err := batch.New(&cfg.AuditExport)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize audit export")
+	}
+	if auditExporter != nil {
+		security.SetAuditExporters(auditExporter)
+		components.Register("audit_export", auditExporter)
+		logrus.WithField("backend", cfg.AuditExport.Backend).Info("Audit export enabled")
+	}
+
 	// Initialize performance optimization system
-	performanceOptimizer := performance.NewPerformanceOptimizer(cfg)
+	performanceOptimizer := performance.NewPerformanceOptimizer(cfg, monitoring.Registry())
+	components.Register("performance_optimizer", performanceOptimizer)
 	// Performance optimizer will be used in middleware (added to Gin router later)
 
 	// Initialize monitoring system with enhanced features
 	var monitoringSystem *monitoring.MonitoringSystem
 	if cfg.Monitoring.Enabled && redisClientInstance != nil {
-		monitoringSystem = monitoring.NewMonitoringSystem(&cfg.Monitoring, redisClientInstance.Client)
+		monitoringSystem = monitoring.NewMonitoringSystem(&cfg.Monitoring, redisClientInstance.Client, monitoring.Registry())
 		if monitoringSystem != nil {
+			components.Register("monitoring", monitoringSystem)
+			monitoring.SetDefaultMonitoringSystem(monitoringSystem)
 			logrus.Info("Enhanced monitoring system initialized")
 		}
 	}
 
+	// Export metrics to StatsD/Datadog when STATSD_ADDR is set
+	statsDReporter, err := monitoring.NewStatsDReporter(&cfg.Monitoring.StatsD)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize StatsD reporter")
+	}
+	if statsDReporter != nil {
+		defer statsDReporter.Close()
+		statsDReporter.AttachMonitoringSystem(monitoringSystem)
+		monitoring.SetDefaultStatsDReporter(statsDReporter)
+		go statsDReporter.Start(ctx)
+		logrus.WithFields(logrus.Fields{
+			"addr":   cfg.Monitoring.StatsD.Addr,
+			"format": cfg.Monitoring.StatsD.Format,
+		}).Info("StatsD metrics export enabled")
+	}
+
+	// Push metrics to a Prometheus Pushgateway when PROMETHEUS_PUSHGATEWAY_URL is set
+	if pusher := monitoring.NewMetricsPusher(&cfg.Monitoring.PushGateway, monitoring.Registry()); pusher != nil {
+		go pusher.Start(ctx)
+		logrus.WithFields(logrus.Fields{
+			"job":      cfg.Monitoring.PushGateway.Job,
+			"interval": cfg.Monitoring.PushGateway.Interval,
+		}).Info("Prometheus Pushgateway export enabled")
+	}
+
+	// Export traces over OTLP gRPC when OTEL_EXPORTER_OTLP_ENDPOINT is set
+	tracerProvider, err := monitoring.NewTracerProvider(ctx, &cfg.Monitoring.Tracing)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize tracing")
+	}
+	if tracerProvider != nil {
+		defer func() {
+			// Flush spans still buffered by the batch exporter
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tracerProvider.Shutdown(shutdownCtx); err != nil {
+				logrus.WithError(err).Warn("Failed to flush traces")
+			}
+		}()
+		logrus.WithField("endpoint", cfg.Monitoring.Tracing.OTLPEndpoint).Info("OpenTelemetry tracing enabled")
+	}
+
 	// Initialize service discovery with real implementations
-	serviceDiscovery, err := discovery.NewManager(&cfg.ServiceDiscovery)
+	serviceDiscovery, err := discovery.NewManager(ctx, &cfg.ServiceDiscovery)
 	if err != nil {
 		logrus.WithError(err).Fatal("Failed to initialize service discovery")
 	}
 	if serviceDiscovery != nil {
-		defer serviceDiscovery.Close()
+		components.Register("service_discovery", serviceDiscovery)
 		logrus.Info("Service discovery initialized")
 	}
 
 	// Initialize protocol converter
 	protocolConverter := protocol.NewProtocolConverter(&cfg.ProtocolConversion)
+	if protocolConverter != nil {
+		components.Register("protocol_converter", protocolConverter)
+	}
+
+	// Initialize persistent storage for keys, users and routes
+	var rawRedis *redis.Client
+	if redisClientInstance != nil {
+		rawRedis = redisClientInstance.Client
+	}
+	// Circuit breaker trip counts survive restarts and are shared by replicas
+	performanceOptimizer.SetRedisClient(rawRedis)
+	if cfg.ResponseCache.Backend == "redis" && rawRedis != nil {
+		// Replicas share cached responses instead of each calling the upstream
+		performanceOptimizer.SetCacheBackend(performance.NewRedisCacheBackend(rawRedis, cfg.ResponseCache.RedisTimeout))
+	}
+	if rawRedis != nil {
+		// Upgrade stored records before anything reads them
+		migrator := redisClient.NewSchemaMigrator(rawRedis)
+		for _, migration := range security.APIKeyMigrations() {
+			migrator.Register(migration)
+		}
+		if err := migrator.Run(ctx); err != nil {
+			logrus.WithError(err).Fatal("Failed to migrate Redis schema")
+		}
+	}
+	store, err := storage.New(&cfg.Storage, rawRedis)
+	if err != nil {
+		logrus.WithError(err).Fatal("Failed to initialize storage")
+	}
+	if store != nil {
+		defer store.Close()
+		if boltStore, ok := store.(*storage.BoltStore); ok {
+			go boltStore.StartSnapshotter(ctx, cfg.Storage.SnapshotInterval)
+		}
+		logrus.WithField("backend", cfg.Storage.Backend).Info("Persistent storage initialized")
+	}
 
 	// Initialize authentication systems
 	localAuth := security.NewLocalAuthenticator(&cfg.Security)
+	if store != nil {
+		if err := localAuth.SetStore(store); err != nil {
+			logrus.WithError(err).Fatal("Failed to load authentication state from storage")
+		}
+		// Key usage is written in batches rather than on every request
+		go localAuth.StartUsageSync(ctx, cfg.Security.UsageSyncInterval)
+	}
+	if cfg.Security.JWTRotationInterval > 0 {
+		// Instances share the rotating secrets through Redis and reload on each
+		// rotation; rotating locally would split the instances' secrets
+		if rawRedis == nil {
+			logrus.Warn("JWT secret rotation requires Redis, rotation disabled")
+		} else if err := localAuth.Secrets().Init(ctx, rawRedis); err != nil {
+			logrus.WithError(err).Error("Failed to share JWT secrets through Redis, rotation disabled")
+		} else {
+			go localAuth.Secrets().Start(ctx)
+			logrus.WithField("interval", cfg.Security.JWTRotationInterval).Info("JWT secret rotation enabled")
+		}
+	}
+
+	// Per-owner state and limits are keyed on the user owning a managed key, never on X-Tenant-ID
+	middleware.SetKeyOwnerResolver(func(apiKey string) (string, bool) {
+		_, userID, ok := localAuth.LookupAPIKey(apiKey)
+		return userID, ok
+	})
+
+	// Key lifecycle events feed auditors through a Redis stream
+	var keyEvents *security.KeyEventStream
+	if rawRedis != nil {
+		secret := cfg.Security.KeyEventSecret
+		if secret == "" {
+			secret = cfg.Security.JWTSecret
+		}
+		keyEvents = security.NewKeyEventStream(rawRedis, []byte(secret), cfg.Security.KeyEventMaxLen)
+		localAuth.SetKeyEventStream(keyEvents)
+	}
+
+	// OIDC single sign-on; PKCE verifiers live in Redis so any instance can serve the callback
+	var oidcAuth *security.OIDCAuthenticator
+	if cfg.OIDC.Enabled {
+		var pkceStore security.PKCEStore = security.NewMemoryPKCEStore()
+		if rawRedis != nil {
+			pkceStore = security.NewRedisPKCEStore(rawRedis)
+		}
+		oidcAuth = security.NewOIDCAuthenticator(&cfg.OIDC, localAuth, pkceStore)
+		logrus.WithField("issuer", cfg.OIDC.IssuerURL).Info("OIDC login enabled")
+	}
 
 	// Initialize RAM authentication if enabled
 	var ramAuth *ram.RAMAuthenticator
 	if cfg.RAMAuth.Enabled {
 		ramAuth = ram.NewRAMAuthenticator(&cfg.RAMAuth)
+		if rawRedis != nil {
+			ramAuth.SetRedisClient(rawRedis)
+		}
 		logrus.Info("RAM authentication initialized")
 		// RAM auth will be used in middleware
 		_ = ramAuth // Use ramAuth to avoid unused variable warning
 	}
 
-	// Initialize cloud integrator with real implementations
-	cloudIntegrator, err := cloud.NewCloudIntegrator(&cfg.CloudIntegration)
-	if err != nil {
-		logrus.WithError(err).Warn("Failed to initialize cloud integrator")
-	} else if cloudIntegrator != nil {
+	// Initialize cloud integrator; the provider is created on first use unless preloaded
+	cloudIntegrator := cloud.NewLazyCloudIntegrator(&cfg.CloudIntegration)
+	if cloudIntegrator != nil {
 		defer cloudIntegrator.Close()
-		logrus.Info("Cloud integration initialized")
+		if cfg.CloudIntegration.Preload {
+			if err := cloudIntegrator.Preload(); err != nil {
+				logrus.WithError(err).Warn("Failed to initialize cloud integrator")
+			} else {
+				logrus.Info("Cloud integration initialized")
+			}
+		}
 	}
 
 	// Initialize local model server and manager if enabled
@@ -133,17 +344,16 @@ func main() {
 	if cfg.LocalModel.Enabled {
 		// Create Python model server
 		server := localmodel.NewPythonModelServer(&cfg.LocalModel)
+		if monitoringSystem != nil {
+			server.SetAlertSink(monitoringSystem)
+		}
 		// Create manager
 		localModelManager = localmodel.NewManager(server)
+		// /v1/embeddings is answered by the local model instead of the target
+		handlers.SetLocalModelServer(server)
 
-		// Start local model server
-		go func() {
-			if err := localModelManager.Start(context.Background()); err != nil {
-				logrus.WithError(err).Error("Failed to start local model server")
-			} else {
-				logrus.Info("Local model server started successfully")
-			}
-		}()
+		// Loading the model takes minutes; it starts in the background without gating readiness
+		components.RegisterOptional("local_model", localModelManager)
 	}
 
 	// Initialize advanced monitoring and scaling components
@@ -152,25 +362,62 @@ func main() {
 	var redisRateLimiter *middleware.RedisRateLimiter
 	var monitoringHandler *handlers.MonitoringHandler
 
-	if redisClientInstance != nil {
-		// Initialize advanced metrics collector
-		metricsCollector = middleware.NewAdvancedMetricsCollector(redisClientInstance.Client)
+	if cfg.Redis.Enabled {
+		// Both run without Redis until the reconnect loop provides a client
+		metricsCollector = middleware.NewAdvancedMetricsCollector(rawRedis, monitoring.Registry())
 		go metricsCollector.StartMetricsCollector(ctx)
 
-		// Initialize auto scaler
-		if cfg.AutoScaling.Enabled {
-			autoScaler = autoscaler.NewAutoScaler(redisClientInstance.Client, "ai-gateway")
-			go autoScaler.Start(ctx)
-			logrus.Info("Auto scaler started")
-		}
-
 		// Initialize Redis rate limiter
 		redisRateLimiter = middleware.NewRedisRateLimiter(
-			redisClientInstance.Client,
+			rawRedis,
 			cfg.AutoScaling.TargetQPS, // Global limit
 			cfg.RateLimit,             // User limit
 			time.Minute,               // Window size
 		)
+		redisRateLimiter.SetLegacyWindow(cfg.RedisRateLimitLegacy)
+		redisRateLimiter.SetConfigSource(live)
+	}
+
+	if redisClientInstance != nil {
+
+		// Publish upstream health scores for the auto scaler
+		if cfg.AutoScaling.UpstreamHealth.Enabled {
+			uh := cfg.AutoScaling.UpstreamHealth
+			upstream.DefaultRegistry().SetWeights(upstream.Weights{
+				ErrorRate:     uh.ErrorWeight,
+				ThrottleRate:  uh.ThrottleWeight,
+				Latency:       uh.LatencyWeight,
+				Circuit:       uh.CircuitWeight,
+				ActiveCheck:   uh.ActiveCheckWeight,
+				LatencyTarget: uh.LatencyTarget,
+			})
+			// Circuit state comes from the performance breakers, fed by the proxy's results
+			upstream.DefaultRegistry().SetCircuitBreakers(performanceOptimizer)
+			go upstream.DefaultRegistry().StartPublisher(ctx, redisClientInstance.Client, uh.PublishInterval)
+
+			// Probe the configured target so active checks land on the host the proxy records
+			if cfg.TargetURL != "" {
+				providerManager := providers.NewManager(&providers.ManagerConfig{
+					HealthCheckEnabled:  true,
+					HealthCheckInterval: uh.ActiveCheckInterval,
+					HealthCheckTimeout:  uh.ActiveCheckTimeout,
+				})
+				providerManager.RegisterProvider(providers.NewEndpointProvider("target", &providers.ProviderConfig{
+					Enabled: true,
+					BaseURL: cfg.TargetURL,
+					APIKey:  cfg.TargetKey,
+					Timeout: uh.ActiveCheckTimeout,
+				}))
+				defer providerManager.Stop()
+			}
+		}
+
+		// Initialize auto scaler
+		if cfg.AutoScaling.Enabled {
+			autoScaler = autoscaler.NewAutoScaler(redisClientInstance.Client, "ai-gateway", &cfg.AutoScaling)
+			go autoScaler.Start(ctx)
+			logrus.Info("Auto scaler started")
+		}
 
 		// Initialize monitoring handler
 		monitoringHandler = handlers.NewMonitoringHandler(
@@ -180,43 +427,204 @@ func main() {
 			autoScaler,
 			redisRateLimiter,
 		)
+		monitoringHandler.SetLoadBalancer(performanceOptimizer)
+
+		// Resumable live stream of metrics and alerts; sequence IDs are shared by all replicas
+		if monitoringSystem != nil {
+			streamHub := monitoring.NewStreamHub(redisClientInstance.Client, cfg.Monitoring.Stream)
+			go streamHub.Run(ctx)
+			monitoringSystem.SetStreamHub(streamHub)
+			monitoringHandler.SetStreamHub(streamHub)
+		}
+
+		// Sampled request-shape distributions for capacity planning
+		if cfg.Monitoring.RequestShapes.Enabled {
+			requestShapes := handlers.NewRequestShapeAnalytics(redisClientInstance.Client, cfg.Monitoring.RequestShapes)
+			handlers.SetRequestShapeAnalytics(requestShapes)
+			monitoringHandler.SetRequestShapes(requestShapes)
+		}
 
 		logrus.Info("Advanced monitoring and scaling features initialized")
 	}
 
+	// Track per-tenant SLOs and raise burn-rate alerts through the monitoring system
+	sloTracker := monitoring.NewSLOTracker(rawRedis, store, monitoringSystem)
+	if err := sloTracker.Load(ctx); err != nil {
+		logrus.WithError(err).Warn("Failed to load SLO definitions")
+	}
+	go sloTracker.Start(ctx, cfg.Monitoring.SLOEvalInterval)
+
 	// Setup Gin mode
 	gin.SetMode(cfg.GinMode) // Initialize router
 	r := gin.New()
+	// Forwarding headers are honoured only from TRUSTED_PROXIES, by default from nobody
+	if err := r.SetTrustedProxies(cfg.IPFilter.TrustedProxies); err != nil {
+		logrus.WithError(err).Fatal("Invalid TRUSTED_PROXIES")
+	}
+
+	// Advertise the experimental HTTP/3 listener on the same port
+	if cfg.QUIC.Enabled {
+		r.Use(middleware.AltSvc(serverPort(cfg), cfg.QUIC.AltSvcMaxAge))
+	}
+
+	// Trace every request; W3C trace context is propagated even when no exporter is configured
+	r.Use(middleware.OTelTracing(otel.Tracer("go-aigateway")))
 
 	// Add basic middleware
-	r.Use(gin.Logger())
+	r.Use(logging.Middleware(func(c *gin.Context) string {
+		if token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "); token != "" {
+			return flags.KeyFingerprint(token)
+		}
+		return ""
+	}))
 	r.Use(gin.Recovery())
 
 	// Add enhanced error handling middleware
 	r.Use(errorHandler.RecoveryMiddleware())
 
+	// Reject clients outside IP_ALLOWLIST or on IP_BLOCKLIST before doing any work for them
+	r.Use(middleware.IPFilter(&cfg.IPFilter))
+
+	// Track in-flight requests so shutdown can drain them
+	drainer := middleware.NewDrainer(cfg.Shutdown)
+	r.Use(drainer.Middleware())
+
+	// Emergency kill switches lock out tenants and stop providers within seconds on every replica
+	var killSwitchAlerts middleware.KillSwitchAlertSink
+	if monitoringSystem != nil {
+		killSwitchAlerts = monitoringSystem
+	}
+	killSwitches := middleware.NewKillSwitches(rawRedis, cfg.KillSwitch, security.NewAuditLogger(), killSwitchAlerts)
+	if err := killSwitches.Load(ctx); err != nil {
+		logrus.WithError(err).Warn("Failed to load kill switches")
+	}
+	go killSwitches.Start(ctx)
+	handlers.SetKillSwitches(killSwitches)
+	r.Use(killSwitches.Middleware(func(apiKey string) (string, bool) {
+		_, userID, ok := localAuth.LookupAPIKey(apiKey)
+		return userID, ok
+	}))
+
 	// Add performance optimization middleware
 	r.Use(performanceOptimizer.PerformanceMetricsMiddleware())
 	r.Use(performanceOptimizer.IntelligentCachingMiddleware(5 * time.Minute))
 	r.Use(performanceOptimizer.AdaptiveCompressionMiddleware())
 	r.Use(performanceOptimizer.AdaptiveRateLimitingMiddleware())
 
+	// Classify requests for SLOs; registered before RequestTimeout so its deferred cancel is not mistaken for a client disconnect
+	r.Use(middleware.SLOTracking(sloTracker))
+
 	// Add security middleware
 	r.Use(middleware.RequestTimeout(30 * time.Second))
 	r.Use(middleware.RequestSizeLimit(10 * 1024 * 1024)) // 10MB limit
-	r.Use(middleware.CORS(cfg))                          // Pass config to CORS middleware
+	r.Use(middleware.CORS(live))                         // Follows reloaded CORS_ALLOWED_ORIGINS
 	r.Use(middleware.PrometheusMetrics())
 
+	// Store outlier-latency requests with a goroutine dump for later profiling
+	var slowRequests *middleware.SlowRequestDetector
+	if cfg.Monitoring.SlowRequests.Enabled && rawRedis != nil {
+		slowRequests = middleware.NewSlowRequestDetector(rawRedis, cfg.Monitoring.SlowRequests)
+		r.Use(slowRequests.Middleware())
+		logrus.WithField("multiplier", cfg.Monitoring.SlowRequests.Multiplier).Info("Slow request detector enabled")
+	}
+
+	// Capture redacted exchanges of route/model combinations whose error rate spikes
+	var debugCapture *monitoring.DebugCapture
+	if cfg.Monitoring.DebugCapture.Enabled {
+		debugCapture = monitoring.NewDebugCapture(cfg.Monitoring.DebugCapture, security.NewAuditLogger(), monitoringSystem)
+		r.Use(middleware.DebugCapture(debugCapture))
+		logrus.WithFields(logrus.Fields{
+			"error_threshold": cfg.Monitoring.DebugCapture.ErrorThreshold,
+			"min_requests":    cfg.Monitoring.DebugCapture.MinRequests,
+		}).Info("Adaptive debug capture enabled")
+	}
+
+	// Answer sandbox keys from the simulator before queues, rate limits and upstreams see them
+	if cfg.Sandbox.Enabled {
+		sandboxProvider := providers.NewSandboxProvider(providers.SandboxOptions{
+			LatencyMin:       cfg.Sandbox.LatencyMin,
+			LatencyMax:       cfg.Sandbox.LatencyMax,
+			CompletionTokens: cfg.Sandbox.CompletionTokens,
+			ChunkInterval:    cfg.Sandbox.ChunkInterval,
+			TimeoutAfter:     cfg.Sandbox.TimeoutAfter,
+		})
+		r.Use(middleware.Sandbox(&cfg.Sandbox, sandboxProvider, localAuth.IsSandboxKey))
+	}
+
+	// Middleware of the authenticated /v1 proxy routes, run after APIKeyAuth
+	var proxyMiddleware []gin.HandlerFunc
+
+	// Per-API-key sliding windows in Redis, keyed on the ID of the authenticated key;
+	// keys issued with a rate limit use their own. Without Redis the windows are kept per instance.
+	if cfg.KeyRateLimit.Enabled {
+		keyLimiter := middleware.NewKeyedRateLimiter(rawRedis, middleware.AuthenticatedKeyID, middleware.RatePolicy{
+			Requests: cfg.KeyRateLimit.Requests,
+			Window:   cfg.KeyRateLimit.Window,
+		})
+		keyLimiter.SetPolicyLookup(middleware.APIKeyPolicies(cfg.KeyRateLimit.Window))
+		proxyMiddleware = append(proxyMiddleware, keyLimiter.Middleware())
+		logrus.WithFields(logrus.Fields{
+			"window": cfg.KeyRateLimit.Window,
+			"shared": rawRedis != nil,
+		}).Info("Per-API-key rate limits enabled")
+	}
+
+	// Managed keys may only call their allowed methods until their token budget is spent
+	proxyMiddleware = append(proxyMiddleware, middleware.KeyEntitlements(localAuth))
+
+	// Queue /v1 requests beyond the concurrency limit by the tier of their key or owner
+	if cfg.RequestQueue.Enabled {
+		requestQueue := middleware.NewPriorityQueue(cfg.RequestQueue.MaxConcurrent, cfg.RequestQueue.MaxQueued)
+		requestQueue.SetPriorityResolver(middleware.KeyPriorities(localAuth, cfg.RequestQueue.TenantPriorities))
+		proxyMiddleware = append(proxyMiddleware, requestQueue.Middleware())
+		logrus.WithFields(logrus.Fields{
+			"max_concurrent": cfg.RequestQueue.MaxConcurrent,
+			"max_queued":     cfg.RequestQueue.MaxQueued,
+		}).Info("Priority request queue enabled")
+	}
+
 	// Use Redis rate limiter if available, otherwise use memory-based limiter
+	var ipRateLimiter *middleware.IPRateLimiter
 	if redisRateLimiter != nil {
 		r.Use(middleware.RedisRateLimit(redisRateLimiter))
 	} else {
-		r.Use(middleware.RateLimiter(cfg.RateLimit))
+		ipRateLimiter = middleware.NewIPRateLimiter(cfg.RateLimit)
+		ipRateLimiter.SetConfigSource(live)
+		r.Use(ipRateLimiter.Handler())
+	}
+
+	// Replay responses to retried POSTs carrying an Idempotency-Key
+	if store != nil && cfg.Storage.IdempotencyTTL > 0 {
+		r.Use(middleware.Idempotency(store, cfg.Storage.IdempotencyTTL))
+	}
+
+	// Per-endpoint QPS limits, counted separately from the global limiter
+	var endpointLimiter *middleware.EndpointRateLimiter
+	if len(cfg.EndpointRateLimits) > 0 {
+		endpointLimiter = middleware.NewEndpointRateLimiter(rawRedis, cfg.EndpointRateLimits)
+		r.Use(endpointLimiter.Middleware())
+		logrus.WithField("endpoints", len(cfg.EndpointRateLimits)).Info("Per-endpoint rate limits enabled")
 	}
 
 	// Add advanced metrics middleware if available
 	if metricsCollector != nil {
-		r.Use(middleware.AdvancedPrometheusMetrics(metricsCollector))
+		r.Use(middleware.AdvancedPrometheusMetrics(metricsCollector, localAuth.MetricDimensions))
+	}
+
+	// Redact secrets and personal data in responses
+	var contentFilter *middleware.ContentFilter
+	if cfg.ContentFilter.Enabled {
+		patterns := middleware.DefaultFilterPatterns()
+		if cfg.ContentFilter.PatternsFile != "" {
+			custom, err := middleware.LoadFilterPatterns(cfg.ContentFilter.PatternsFile)
+			if err != nil {
+				logrus.WithError(err).Fatal("Failed to load content filter patterns")
+			}
+			patterns = append(patterns, custom...)
+		}
+		contentFilter = middleware.NewContentFilter(patterns)
+		r.Use(contentFilter.Middleware())
+		logrus.WithField("patterns", len(patterns)).Info("Response content filtering enabled")
 	}
 
 	// Add protocol conversion middleware if enabled
@@ -228,25 +636,280 @@ func main() {
 		})
 	}
 
+	// Enforce per-route JSON schema contracts
+	serviceHandler := handlers.NewServiceHandler()
+	if store != nil {
+		if err := serviceHandler.SetStore(store); err != nil {
+			logrus.WithError(err).Fatal("Failed to load routes from storage")
+		}
+	}
+	// Requests go to the service source listing their model; edits through the service-source API apply live
+	serviceHandler.Providers().SetDefaultSource(cfg.ModelRouting.DefaultSource)
+	handlers.SetProviderRegistry(serviceHandler.Providers())
+	r.Use(serviceHandler.RouteContractMiddleware())
+	r.Use(serviceHandler.RouteActionsMiddleware())
+	// Forward requests on paths no gateway endpoint serves to the target of their route
+	r.Use(serviceHandler.RouteProxyMiddleware())
+
+	// Header passthrough and stripping on the proxy path, extended per route by Actions.headers
+	handlers.SetHeaderPolicy(handlers.NewHeaderPolicy(&cfg.HeaderPolicy))
+
+	// Cap upstream retries across all clients so an outage does not turn into a retry storm
+	handlers.SetRetryBudget(middleware.NewRetryBudget(cfg.RetryBudgetPerSecond))
+
+	// Claude usage is counted in Redis for the Anthropic cloud integration's metrics
+	var anthropicUsage *cloud.UsageCounter
+	if rawRedis != nil && cfg.CloudIntegration.Enabled && cfg.CloudIntegration.CloudProvider == "anthropic" {
+		anthropicUsage = cloud.NewUsageCounter(rawRedis, "anthropic")
+		cloud.SetUsageCounter(anthropicUsage)
+	}
+
+	// Charge the tokens of each response to the managed key that made the request
+	handlers.SetTokenUsageRecorder(func(c *gin.Context, tokens int64) {
+		localAuth.ChargeTokens(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "), tokens)
+		if model := c.GetString(middleware.ModelContextKey); anthropicUsage != nil && strings.HasPrefix(model, "claude") {
+			if err := anthropicUsage.Record(c.Request.Context(), model, tokens); err != nil {
+				logrus.WithError(err).Warn("Failed to record Anthropic token usage")
+			}
+		}
+	})
+
+	// Count the tokens of each managed key per day and model in Redis, or in
+	// the persistent store when running without Redis
+	var usageTracker *monitoring.UsageTracker
+	if rawRedis != nil {
+		usageTracker = monitoring.NewUsageTracker(rawRedis)
+	} else if store != nil {
+		usageTracker = monitoring.NewStoreUsageTracker(store)
+	}
+	if usageTracker != nil {
+		handlers.SetUsageTracker(usageTracker, func(c *gin.Context) (string, bool) {
+			keyID, _, ok := localAuth.LookupAPIKey(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+			return keyID, ok
+		})
+	}
+
+	// Count the tokens of every API key in Redis sorted sets for billing
+	var tokenTracker *monitoring.TokenTracker
+	if rawRedis != nil {
+		tokenTracker = monitoring.NewTokenTracker(rawRedis)
+		handlers.SetTokenTracker(tokenTracker)
+	}
+
+	// Versioned prompt templates; every AI request is audited with the exact versions applied
+	var promptAudit *security.AuditLogger
+	if cfg.Prompts.AuditRequests {
+		promptAudit = security.NewAuditLogger()
+	}
+	promptStore := handlers.NewPromptStore(store, rawRedis, promptAudit)
+	if err := promptStore.Load(ctx); err != nil {
+		logrus.WithError(err).Warn("Failed to load prompt templates")
+	}
+	promptStore.AddReferrer(func(context.Context) ([]string, error) {
+		var refs []string
+		for _, ref := range []string{cfg.Prompts.SystemTemplate, cfg.Prompts.SummaryTemplate} {
+			if ref != "" {
+				refs = append(refs, ref)
+			}
+		}
+		return refs, nil
+	})
+	go promptStore.StartInvalidationListener(ctx)
+	handlers.SetPromptStore(promptStore)
+
+	// Summarize oversized conversation histories for keys with the history_summarization flag
+	if cfg.ContextTruncation.Enabled {
+		summarizer := handlers.NewModelSummarizer(cfg.TargetURL, cfg.TargetKey, cfg.ContextTruncation.SummaryModel)
+		summarizer.SetPromptTemplate(promptStore, cfg.Prompts.SummaryTemplate)
+		handlers.SetHistorySummarizer(handlers.NewHistorySummarizer(summarizer, &cfg.ContextTruncation))
+	}
+
+	// Route chat traffic of enrolled users to A/B experiment variants; assignments live in Redis
+	var experimentController *handlers.ExperimentController
+	if rawRedis != nil {
+		experimentController = handlers.NewExperimentController(rawRedis)
+		handlers.SetExperimentController(experimentController)
+	}
+
+	// Run pinned sentinel prompts against the providers and alert when their answers drift
+	var driftDetector *handlers.DriftDetector
+	if rawRedis != nil {
+		var sentinelAlerts handlers.SentinelAlertSink
+		if monitoringSystem != nil {
+			sentinelAlerts = monitoringSystem
+		}
+		driftDetector = handlers.NewDriftDetector(rawRedis, cfg.Sentinels, handlers.SmokeTargets(cfg), sentinelAlerts)
+		go driftDetector.Start(ctx)
+		promptStore.AddReferrer(driftDetector.PromptRefs)
+	}
+
+	// Send each client to the upstream endpoint with the lowest RTT from its region
+	if cfg.GeoRouting.Enabled {
+		var locator routing.RegionLocator
+		if mm, err := routing.OpenMaxMindLocator(cfg.GeoRouting.GeoIPDatabase); err != nil {
+			logrus.WithError(err).Warn("GeoIP database unavailable, geo routing falls back to round-robin")
+		} else {
+			defer mm.Close()
+			locator = mm
+		}
+		if rawRedis == nil {
+			logrus.Warn("Geo routing needs Redis for RTT estimates, falling back to round-robin")
+		}
+		geoRouter := routing.NewGeoRouter(rawRedis, locator, routing.ParseEndpoints(cfg.GeoRouting.Endpoints))
+		if rawRedis != nil && cfg.GeoRouting.LocalRegion != "" {
+			go geoRouter.StartProbes(ctx, cfg.GeoRouting.LocalRegion, cfg.GeoRouting.ProbeInterval)
+		}
+		handlers.SetGeoRouter(geoRouter)
+		logrus.WithField("endpoints", len(cfg.GeoRouting.Endpoints)).Info("Geo routing enabled")
+	}
+
+	// Evaluate feature flags once per request
+	var flagService *flags.Service
+	if cfg.FeatureFlags.Enabled {
+		flagService = flags.NewService(store, rawRedis)
+		if err := flagService.Load(ctx); err != nil {
+			logrus.WithError(err).Warn("Failed to load feature flags, using defaults")
+		}
+		go flagService.StartInvalidationListener(ctx)
+
+		var flagAudit *security.AuditLogger
+		if cfg.FeatureFlags.AuditAssignments {
+			flagAudit = security.NewAuditLogger()
+		}
+		r.Use(flags.Middleware(flagService, &cfg.FeatureFlags, func(c *gin.Context, apiKey string) flags.Subject {
+			subject := flags.DefaultSubject(c, apiKey)
+			if keyID, _, ok := localAuth.LookupAPIKey(apiKey); ok {
+				// Managed keys are bucketed by their ID; the tenant is already the owning user
+				subject.KeyID = keyID
+			}
+			return subject
+		}, flagAudit))
+		logrus.Info("Feature flags enabled")
+	}
+
+	// Flag deprecated models and migrate or reject retired ones
+	modelLifecycle := handlers.NewModelLifecycleRegistry(store, rawRedis, cfg.ModelLifecycle.RetiredPolicy)
+	if err := modelLifecycle.Load(ctx); err != nil {
+		logrus.WithError(err).Warn("Failed to load model lifecycles")
+	}
+	modelLifecycle.SetCallerResolver(func(c *gin.Context) handlers.ModelCaller {
+		caller := handlers.DefaultModelCaller(c)
+		apiKey := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if keyID, _, ok := localAuth.LookupAPIKey(apiKey); ok {
+			caller.KeyID = keyID
+			caller.AllowedModels = localAuth.AllowedModels(apiKey)
+		}
+		return caller
+	})
+	go modelLifecycle.StartInvalidationListener(ctx)
+	handlers.SetModelLifecycle(modelLifecycle)
+
+	// Partition capacity into shared and per-tenant reserved pools; needs the tenant from the flags middleware
+	var capacityPools *middleware.CapacityPools
+	if cfg.Capacity.Enabled {
+		capacityPools = middleware.NewCapacityPools(rawRedis, store, cfg.Capacity.LeaseTTL)
+		if err := capacityPools.Load(ctx); err != nil {
+			logrus.WithError(err).Warn("Failed to load capacity plan")
+		}
+		go capacityPools.Start(ctx, cfg.Capacity.RefreshInterval)
+		r.Use(capacityPools.Middleware())
+		if monitoringHandler != nil {
+			monitoringHandler.SetCapacityPools(capacityPools)
+		}
+		logrus.Info("Reserved capacity pools enabled")
+	}
+
+	// Chaos fault injection for resilience testing; matches on the tenant from the flags middleware
+	chaosInjector, err := chaos.New(cfg.Chaos, cfg.GinMode)
+	if err != nil {
+		logrus.WithError(err).Error("Chaos injection not activated")
+	}
+	if chaosInjector != nil {
+		chaos.SetDefault(chaosInjector)
+		r.Use(chaosInjector.Middleware())
+		logrus.Warn("Chaos fault injection enabled; rules are managed at /api/v1/admin/chaos")
+	}
+
 	// Setup routes
-	router.SetupRoutes(r, cfg, localAuth)
+	sessions := handlers.NewConversationSessions(cfg.Sessions)
+	router.SetupRoutes(r, live, localAuth, sessions, proxyMiddleware...)
+	// Setup storage and feature flag administration routes
+	router.SetupStorageRoutes(r, store, localAuth)
+	router.SetupFlagRoutes(r, flagService, localAuth)
+	router.SetupModelLifecycleRoutes(r, modelLifecycle, localAuth)
+	router.SetupSessionRoutes(r, live, localAuth, sessions)
+	router.SetupEnsembleRoutes(r, live, localAuth)
+	router.SetupCapabilityRoutes(r, cfg, localAuth, rawRedis)
+	router.SetupUsageRoutes(r, usageTracker, localAuth)
+	router.SetupTokenUsageRoutes(r, tokenTracker, localAuth)
+	router.SetupNotificationRoutes(r, monitoringSystem, localAuth)
+	router.SetupExperimentRoutes(r, experimentController, localAuth)
+	router.SetupSentinelRoutes(r, driftDetector, localAuth)
+	router.SetupPromptRoutes(r, promptStore, localAuth)
+	router.SetupOIDCRoutes(r, oidcAuth, cfg.Security.TokenExpiration)
+	router.SetupSLORoutes(r, sloTracker, localAuth)
+	router.SetupDrainRoutes(r, drainer, components, localAuth)
+	router.SetupCapacityRoutes(r, capacityPools, localAuth)
+	router.SetupKillSwitchRoutes(r, killSwitches, localAuth)
+	router.SetupContentFilterRoutes(r, contentFilter, localAuth)
+	router.SetupChaosRoutes(r, chaosInjector, localAuth)
+	router.SetupEndpointRateLimitRoutes(r, endpointLimiter, localAuth)
+	router.SetupPerformanceRoutes(r, performanceOptimizer, localAuth)
+	router.SetupKeyEventRoutes(r, keyEvents, localAuth)
+	router.SetupDebugCaptureRoutes(r, debugCapture, localAuth)
+	router.SetupSlowRequestRoutes(r, slowRequests, localAuth)
+	levelController := logging.NewLevelController(logging.Default())
+	router.SetupLogLevelRoutes(r, levelController, localAuth)
+
+	// Reload the configuration on file changes (with hot reload), SIGHUP and
+	// POST /api/v1/admin/config/reload. Without a watcher only the process
+	// environment is re-read.
+	configWatcher, err := config.NewConfigWatcher(cfg.EnvFile, cfg.ConfigFile)
+	if err != nil {
+		logrus.WithError(err).Warn("Configuration files cannot be watched; reloads re-read the environment only")
+		configWatcher = nil
+	} else {
+		defer configWatcher.Close()
+		if cfg.HotReload {
+			go configWatcher.Start(ctx)
+		}
+	}
+	reloader := config.NewReloader(live, configWatcher)
+	reloader.OnReload(func(updated *config.Config) {
+		localAuth.UpdateConfig(updated)
+		if monitoringSystem != nil {
+			monitoringSystem.UpdateConfig(updated)
+		}
+		if err := levelController.SetBase(updated.LogLevel); err != nil {
+			logrus.WithError(err).Warn("Ignoring reloaded LOG_LEVEL")
+		}
+		logging.SetFormat(updated.LogFormat)
+	})
+	reloadSignals := make(chan os.Signal, 1)
+	signal.Notify(reloadSignals, syscall.SIGHUP)
+	defer signal.Stop(reloadSignals)
+	go reloader.Run(ctx, reloadSignals)
+	router.SetupConfigRoutes(r, reloader, localAuth)
+
 	// Setup cloud management routes
-	router.SetupCloudRoutes(r, cloudIntegrator)
+	if cloudIntegrator != nil {
+		router.SetupCloudRoutes(r, cloudIntegrator)
+	}
 
 	// Setup local model routes if enabled
 	if cfg.LocalModel.Enabled && localModelManager != nil {
-		router.SetupLocalModelRoutes(r, localModelManager, cfg)
+		router.SetupLocalModelRoutes(r, localModelManager, live, localAuth, rawRedis)
 		logrus.Info("Local model API routes registered")
 	}
 
 	// Setup monitoring routes if available
 	if monitoringHandler != nil {
 		handlers.RegisterMonitoringRoutes(r, monitoringHandler)
+		router.SetupBackendRoutes(r, monitoringHandler, localAuth)
 		logrus.Info("Monitoring API routes registered")
 	}
 
 	// Setup service management routes
-	serviceHandler := handlers.NewServiceHandler()
 	handlers.RegisterServiceRoutes(r, serviceHandler)
 	logrus.Info("Service management API routes registered")
 
@@ -260,14 +923,38 @@ func main() {
 	handlers.RegisterDomainRoutes(r, domainHandler)
 	logrus.Info("Domain management API routes registered")
 
+	// Hand Redis to the components that can switch to it at runtime once it is
+	// reachable; storage, monitoring and the other Redis-backed features stay
+	// disabled until the next restart
+	if redisReconnect != nil {
+		go redisReconnect.StartReconnectLoop(ctx, func(client *redis.Client) {
+			performanceOptimizer.SetRedisClient(client)
+			if ramAuth != nil {
+				ramAuth.SetRedisClient(client)
+			}
+			if metricsCollector != nil {
+				metricsCollector.SetRedisClient(client)
+			}
+			if redisRateLimiter != nil {
+				redisRateLimiter.SetRedisClient(client)
+			}
+			go redisReconnect.StartHealthCheck(ctx)
+			logrus.Warn("Redis reconnected; restart to enable storage and monitoring features that need it")
+		})
+	}
+
 	// Start background services
-	// Service discovery is automatically started in NewManager
+	if err := components.StartAll(ctx); err != nil {
+		logrus.WithError(err).Fatal("Failed to start components")
+	}
+	defer func() {
+		if err := components.CloseAll(); err != nil {
+			logrus.WithError(err).Error("Failed to close components")
+		}
+	}()
 
 	// Start server
-	port := cfg.Port
-	if port == "" {
-		port = "8080"
-	}
+	port := serverPort(cfg)
 
 	logrus.WithField("port", port).Info("Starting AI Gateway server with advanced features")
 
@@ -277,8 +964,29 @@ func main() {
 		Handler: r,
 	}
 
+	// HTTP/3 shares the port over UDP; clients only follow Alt-Svc from TLS origins,
+	// so the TCP listener switches to TLS with the same certificate
+	var h3 *server.HTTP3Server
+	if cfg.QUIC.Enabled {
+		h3, err = server.NewHTTP3Server(srv.Addr, cfg.QUIC.CertFile, cfg.QUIC.KeyFile, r)
+		if err != nil {
+			logrus.WithError(err).Fatal("Failed to start HTTP/3 listener")
+		}
+		go func() {
+			if err := h3.Serve(); err != nil {
+				logrus.WithError(err).Error("HTTP/3 listener stopped")
+			}
+		}()
+	}
+
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.QUIC.Enabled {
+			err = srv.ListenAndServeTLS(cfg.QUIC.CertFile, cfg.QUIC.KeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logrus.WithError(err).Fatal("Failed to start server")
 		}
 	}()
@@ -290,34 +998,35 @@ func main() {
 
 	logrus.Info("Shutting down server...")
 
+	// Fail readiness and let in-flight requests finish within their class grace period
+	maxGrace := cfg.Shutdown.StreamingGrace
+	if cfg.Shutdown.DefaultGrace > maxGrace {
+		maxGrace = cfg.Shutdown.DefaultGrace
+	}
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), maxGrace+5*time.Second)
+	drainer.Drain(drainCtx)
+	drainCancel()
+
 	// Graceful shutdown with timeout
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
 		logrus.WithError(err).Error("Server forced to shutdown")
 	}
+	if h3 != nil {
+		if err := h3.Shutdown(ctx); err != nil {
+			logrus.WithError(err).Error("HTTP/3 listener forced to shutdown")
+		}
+	}
 
 	logrus.Info("Server exited")
 }
 
-func setupLogging(cfg *config.Config) {
-	// Set log level
-	level, err := logrus.ParseLevel(cfg.LogLevel)
-	if err != nil {
-		level = logrus.InfoLevel
-	}
-	logrus.SetLevel(level)
-
-	// Set log format
-	if cfg.LogFormat == "json" {
-		logrus.SetFormatter(&logrus.JSONFormatter{})
-	} else {
-		logrus.SetFormatter(&logrus.TextFormatter{
-			FullTimestamp: true,
-		})
+// serverPort returns the port the gateway listens on, TCP and (with QUIC) UDP
+func serverPort(cfg *config.Config) string {
+	if cfg.Port == "" {
+		return "8080"
 	}
-
-	// Set output
-	logrus.SetOutput(os.Stdout)
+	return cfg.Port
 }
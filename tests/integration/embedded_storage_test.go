@@ -0,0 +1,138 @@
+package integration
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/handlers"
+	"go-aigateway/internal/middleware"
+	"go-aigateway/internal/router"
+	"go-aigateway/internal/security"
+	"go-aigateway/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// embeddedGateway wires the management APIs against an embedded store
+func embeddedGateway(t *testing.T, store storage.Store) (*gin.Engine, *security.LocalAuthenticator) {
+	gin.SetMode(gin.TestMode)
+
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{MaxAPIKeys: 10})
+	require.NoError(t, localAuth.SetStore(store))
+
+	serviceHandler := handlers.NewServiceHandler()
+	require.NoError(t, serviceHandler.SetStore(store))
+
+	r := gin.New()
+	admin := r.Group("/api/v1/admin")
+	admin.Use(middleware.LocalAuth(localAuth, "admin"))
+	admin.POST("/api-keys", handlers.CreateAPIKey(localAuth))
+	router.SetupStorageRoutes(r, store, localAuth)
+	handlers.RegisterServiceRoutes(r, serviceHandler)
+
+	return r, localAuth
+}
+
+func doJSON(r *gin.Engine, method, path, apiKey string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestEmbeddedStorageLifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aigateway.db")
+
+	store, err := storage.OpenBoltStore(path)
+	require.NoError(t, err)
+
+	r, localAuth := embeddedGateway(t, store)
+	adminKey, err := localAuth.GenerateAPIKey("admin", "integration admin", []string{"*"}, 0)
+	require.NoError(t, err)
+
+	// Create an API key through the management API
+	w := doJSON(r, http.MethodPost, "/api/v1/admin/api-keys", adminKey, map[string]interface{}{"name": "client"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created struct {
+		APIKey string `json:"api_key"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.NotEmpty(t, created.APIKey)
+
+	// Create a route
+	w = doJSON(r, http.MethodPost, "/api/v1/routes", "", map[string]interface{}{
+		"name": "embedded-route", "path": "/v1/embedded", "method": "POST", "target": "qwen-turbo", "enabled": true,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	// Backup streams the database
+	w = doJSON(r, http.MethodPost, "/api/v1/admin/backup", adminKey, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	assert.NotZero(t, w.Body.Len())
+
+	require.NoError(t, store.Close())
+
+	// State survives a restart
+	store, err = storage.OpenBoltStore(path)
+	require.NoError(t, err)
+
+	r, localAuth = embeddedGateway(t, store)
+	_, keyInfo, err := localAuth.ValidateAPIKey(created.APIKey)
+	require.NoError(t, err)
+	assert.Equal(t, "client", keyInfo.Name)
+
+	w = doJSON(r, http.MethodGet, "/api/v1/routes", "", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "embedded-route")
+
+	require.NoError(t, store.Close())
+
+	// A corrupted database is recovered from the last snapshot
+	require.NoError(t, os.WriteFile(path, bytes.Repeat([]byte("corrupt"), 4096), 0o600))
+
+	store, err = storage.OpenBoltStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, localAuth = embeddedGateway(t, store)
+	_, _, err = localAuth.ValidateAPIKey(created.APIKey)
+	assert.NoError(t, err)
+
+	matches, _ := filepath.Glob(path + ".corrupt-*")
+	assert.Len(t, matches, 1)
+}
+
+func TestBackupUnsupportedWithoutEmbeddedStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{MaxAPIKeys: 10})
+	adminKey, err := localAuth.GenerateAPIKey("admin", "integration admin", []string{"*"}, 0)
+	require.NoError(t, err)
+
+	r := gin.New()
+	router.SetupStorageRoutes(r, nil, localAuth)
+
+	w := doJSON(r, http.MethodPost, "/api/v1/admin/backup", adminKey, nil)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
@@ -45,7 +45,7 @@ func TestChatEndpointWithAPIKey(t *testing.T) {
 		GatewayKeys: []string{"test-api-key-123"},
 	}
 	router := gin.New()
-	router.Use(middleware.APIKeyAuth(cfg))
+	router.Use(middleware.APIKeyAuth(cfg, nil))
 	router.POST("/api/v1/chat", handlers.ChatHandler(cfg))
 
 	requestBody := map[string]interface{}{
@@ -336,7 +336,7 @@ func TestFullStackAuthentication(t *testing.T) {
 	router.GET("/health", handlers.HealthHandler)
 	// API key protected endpoints
 	apiKeyGroup := router.Group("/api/v1")
-	apiKeyGroup.Use(middleware.APIKeyAuth(cfg))
+	apiKeyGroup.Use(middleware.APIKeyAuth(cfg, nil))
 	{
 		apiKeyGroup.POST("/chat", handlers.ChatHandler(cfg))
 		apiKeyGroup.POST("/completions", handlers.CompletionHandler(cfg))
@@ -396,7 +396,7 @@ func BenchmarkFullRequestFlow(b *testing.B) {
 	router := gin.New()
 	router.Use(middleware.CORS(cfg))
 	router.Use(securityMiddleware.Handler())
-	router.Use(middleware.APIKeyAuth(cfg))
+	router.Use(middleware.APIKeyAuth(cfg, nil))
 	router.POST("/api/v1/chat", handlers.ChatHandler(cfg))
 
 	requestBody := map[string]interface{}{
@@ -0,0 +1,275 @@
+package integration
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/router"
+	"go-aigateway/internal/security"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	oidcClientID    = "gateway-client"
+	oidcRedirectURL = "http://gateway.local/api/v1/auth/oidc/callback"
+)
+
+// mockOIDCServer implements discovery, JWKS and the authorization code flow with PKCE
+type mockOIDCServer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]pendingCode
+}
+
+type pendingCode struct {
+	challenge string
+	nonce     string
+}
+
+func newMockOIDCServer(t *testing.T) *mockOIDCServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	m := &mockOIDCServer{key: key, codes: make(map[string]pendingCode)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/authorize", m.authorize)
+	mux.HandleFunc("/token", m.token)
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockOIDCServer) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                m.URL,
+		"authorization_endpoint":                m.URL + "/authorize",
+		"token_endpoint":                        m.URL + "/token",
+		"jwks_uri":                              m.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockOIDCServer) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := m.key.PublicKey
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize immediately "logs the user in" and redirects back with a code
+func (m *mockOIDCServer) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != oidcClientID || q.Get("response_type") != "code" ||
+		q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+
+	code := "code-" + q.Get("state")[:8]
+	m.mu.Lock()
+	m.codes[code] = pendingCode{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	m.mu.Unlock()
+
+	redirect, _ := url.Parse(q.Get("redirect_uri"))
+	rq := redirect.Query()
+	rq.Set("code", code)
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (m *mockOIDCServer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	m.mu.Lock()
+	pending, ok := m.codes[r.Form.Get("code")]
+	delete(m.codes, r.Form.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || r.Form.Get("grant_type") != "authorization_code" ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != pending.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                m.URL,
+		"sub":                "user-123",
+		"aud":                oidcClientID,
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"nonce":              pending.nonce,
+		"email":              "alice@example.com",
+		"preferred_username": "alice",
+	})
+	idToken.Header["kid"] = "test-key"
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "provider-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+func oidcGateway(t *testing.T, issuer string) (*gin.Engine, *security.LocalAuthenticator, *miniredis.Miniredis) {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	localAuth := security.NewLocalAuthenticator(&config.SecurityConfig{TokenExpiration: time.Hour, MaxAPIKeys: 10})
+	oidcAuth := security.NewOIDCAuthenticator(&config.OIDCConfig{
+		Enabled:            true,
+		IssuerURL:          issuer,
+		ClientID:           oidcClientID,
+		ClientSecret:       "secret",
+		RedirectURL:        oidcRedirectURL,
+		Scopes:             []string{"profile", "email"},
+		StateTTL:           5 * time.Minute,
+		DefaultPermissions: []string{"ai:chat"},
+	}, localAuth, security.NewRedisPKCEStore(client))
+
+	r := gin.New()
+	router.SetupOIDCRoutes(r, oidcAuth, time.Hour)
+	return r, localAuth, mr
+}
+
+// startLogin runs the authorize step and follows the provider redirect, returning the callback URL
+func startLogin(t *testing.T, r *gin.Engine) *url.URL {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/auth/oidc/authorize", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+
+	authURL, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "S256", authURL.Query().Get("code_challenge_method"))
+	assert.NotEmpty(t, authURL.Query().Get("code_challenge"))
+	assert.NotEmpty(t, authURL.Query().Get("nonce"))
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noRedirect.Get(authURL.String())
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return callback
+}
+
+func callbackRequest(r *gin.Engine, callback *url.URL) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil))
+	return w
+}
+
+func TestOIDCAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	provider := newMockOIDCServer(t)
+	r, localAuth, mr := oidcGateway(t, provider.URL)
+
+	callback := startLogin(t, r)
+	state := callback.Query().Get("state")
+
+	// verifier is held in Redis under the state, with a TTL
+	key := "oidc:pkce:" + state
+	require.True(t, mr.Exists(key))
+	assert.Equal(t, 5*time.Minute, mr.TTL(key))
+
+	w := callbackRequest(r, callback)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Token     string `json:"token"`
+		TokenType string `json:"token_type"`
+		ExpiresIn int64  `json:"expires_in"`
+		SessionID string `json:"session_id"`
+		UserID    string `json:"user_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "Bearer", resp.TokenType)
+	assert.Equal(t, int64(3600), resp.ExpiresIn)
+	assert.Equal(t, "oidc:user-123", resp.UserID)
+	assert.NotEmpty(t, resp.SessionID)
+
+	claims, err := localAuth.ValidateJWT(resp.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "oidc:user-123", claims.UserID)
+	assert.Equal(t, "alice", claims.Username)
+	assert.Equal(t, []string{"ai:chat"}, claims.Permissions)
+
+	// the verifier is single use
+	assert.False(t, mr.Exists(key))
+}
+
+func TestOIDCCallbackRejectsReplayAndUnknownState(t *testing.T) {
+	provider := newMockOIDCServer(t)
+	r, _, _ := oidcGateway(t, provider.URL)
+
+	callback := startLogin(t, r)
+	require.Equal(t, http.StatusOK, callbackRequest(r, callback).Code)
+
+	w := callbackRequest(r, callback)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_state")
+
+	forged, _ := url.Parse("/api/v1/auth/oidc/callback?state=forged&code=anything")
+	w = callbackRequest(r, forged)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_state")
+}
+
+func TestOIDCCallbackRejectsWrongVerifier(t *testing.T) {
+	provider := newMockOIDCServer(t)
+	r, _, mr := oidcGateway(t, provider.URL)
+
+	callback := startLogin(t, r)
+
+	// swap the stored verifier so the provider's S256 check fails
+	key := "oidc:pkce:" + callback.Query().Get("state")
+	mr.Set(key, `{"verifier":"not-the-original-verifier-not-the-original-verifier","nonce":"x"}`)
+
+	w := callbackRequest(r, callback)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "oidc_login_failed")
+}
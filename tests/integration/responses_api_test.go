@@ -0,0 +1,146 @@
+package integration
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-aigateway/internal/config"
+	"go-aigateway/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// responsesFixture is one Responses API conformance case: the client request,
+// the chat completion request the upstream must receive and its answer, and
+// the expected response object or event stream. Expected objects only list
+// the fields they check; generated item IDs vary between runs.
+type responsesFixture struct {
+	Request          json.RawMessage   `json:"request"`
+	UpstreamRequest  json.RawMessage   `json:"upstream_request"`
+	UpstreamResponse json.RawMessage   `json:"upstream_response"`
+	UpstreamStream   []json.RawMessage `json:"upstream_stream"`
+	Status           int               `json:"status"`
+	Response         interface{}       `json:"response"`
+	Events           []interface{}     `json:"events"`
+}
+
+// assertSubset checks that every field of expected is present in actual with the same value
+func assertSubset(t *testing.T, expected, actual interface{}, path string) {
+	t.Helper()
+	switch want := expected.(type) {
+	case map[string]interface{}:
+		got, ok := actual.(map[string]interface{})
+		if !assert.Truef(t, ok, "%s: expected an object, got %v", path, actual) {
+			return
+		}
+		for key, value := range want {
+			if !assert.Containsf(t, got, key, "%s.%s is missing", path, key) {
+				continue
+			}
+			assertSubset(t, value, got[key], path+"."+key)
+		}
+	case []interface{}:
+		got, ok := actual.([]interface{})
+		if !assert.Truef(t, ok, "%s: expected an array, got %v", path, actual) || !assert.Lenf(t, got, len(want), "%s", path) {
+			return
+		}
+		for i := range want {
+			assertSubset(t, want[i], got[i], fmt.Sprintf("%s[%d]", path, i))
+		}
+	default:
+		assert.Equalf(t, expected, actual, "%s", path)
+	}
+}
+
+// readResponseEvents decodes a server-sent event stream, checking each data
+// payload names the same type as its event line
+func readResponseEvents(t *testing.T, body []byte) []interface{} {
+	var events []interface{}
+	var name string
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			var event map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event))
+			assert.Equal(t, name, event["type"])
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func TestResponsesAPIConformance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	paths, err := filepath.Glob("testdata/responses/*.json")
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".json"), func(t *testing.T) {
+			raw, err := os.ReadFile(path)
+			require.NoError(t, err)
+			var fixture responsesFixture
+			require.NoError(t, json.Unmarshal(raw, &fixture))
+
+			upstreamCalls := 0
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstreamCalls++
+				assert.Equal(t, "/chat/completions", r.URL.Path)
+				body, _ := io.ReadAll(r.Body)
+				assert.JSONEq(t, string(fixture.UpstreamRequest), string(body))
+
+				if fixture.UpstreamStream != nil {
+					w.Header().Set("Content-Type", "text/event-stream")
+					for _, chunk := range fixture.UpstreamStream {
+						w.Write([]byte("data: " + string(chunk) + "\n\n"))
+					}
+					w.Write([]byte("data: [DONE]\n\n"))
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write(fixture.UpstreamResponse)
+			}))
+			defer upstream.Close()
+
+			router := gin.New()
+			router.POST("/v1/responses", handlers.Responses(&config.Config{TargetURL: upstream.URL, MaxImageSizeMB: 20}))
+			req := httptest.NewRequest(http.MethodPost, "/v1/responses", bytes.NewReader(fixture.Request))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, fixture.Status, w.Code, w.Body.String())
+			if fixture.UpstreamRequest == nil {
+				assert.Zero(t, upstreamCalls, "rejected requests never reach the upstream")
+			}
+
+			if fixture.Events != nil {
+				assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+				events := readResponseEvents(t, w.Body.Bytes())
+				assertSubset(t, fixture.Events, events, "events")
+				for i, event := range events {
+					assert.Equal(t, float64(i), event.(map[string]interface{})["sequence_number"])
+				}
+				return
+			}
+			var response interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assertSubset(t, fixture.Response, response, "response")
+		})
+	}
+}